@@ -0,0 +1,176 @@
+// Package events defines the events of the processing units sent to Trireme and the
+// messages of the RPC monitor. It only depends on the constants of Trireme, so that
+// the clients of the RPC monitor can be built without the datapath, on any platform.
+// The monitor and rpcmonitor packages re-export its types.
+package events
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/aporeto-inc/trireme/constants"
+)
+
+// Event represents the event picked up by the monitor.
+type Event string
+
+const (
+	// EventStart is the event generated when a PU starts.
+	EventStart Event = "start"
+
+	// EventStop is the event generated when a PU stops/dies.
+	EventStop Event = "stop"
+
+	// EventCreate is the event generated when a PU gets created.
+	EventCreate Event = "create"
+
+	// EventDestroy is the event generated when a PU is definitely removed.
+	EventDestroy Event = "destroy"
+
+	// EventPause is the event generated when a PU is set to pause.
+	EventPause Event = "pause"
+
+	// EventUnpause is the event generated when a PU is unpaused.
+	EventUnpause Event = "unpause"
+
+	// EventUpdate is the event generated when the runtime of a running PU changes,
+	// like its IP addresses.
+	EventUpdate Event = "update"
+)
+
+// DefaultRPCAddress is the default Linux socket for the RPC monitor
+const DefaultRPCAddress = "/var/run/trireme.sock"
+
+// The versions of the schema of the events
+const (
+	// EventVersion1 is the version of the events without a version. The RPC monitor
+	// accepts them forever, ignoring their unknown fields.
+	EventVersion1 = 1
+	// EventVersion2 is the version of the events with a version. Their unknown
+	// fields are rejected, so that a misspelled field is never silently ignored.
+	EventVersion2 = 2
+	// CurrentEventVersion is the version of the events of this package
+	CurrentEventVersion = EventVersion2
+)
+
+// EventInfo is a generic structure that defines all the information related to a PU event.
+// EventInfo should be used as a normalized struct container that
+type EventInfo struct {
+
+	// Version is the version of the schema of the event. The events without a
+	// version are EventVersion1 events.
+	Version int `json:",omitempty"`
+
+	// EventType refers to one of the standard events that Trireme handles.
+	EventType Event
+
+	// PUType is the the type of the PU
+	PUType constants.PUType
+
+	// The PUID is a unique value for the Processing Unit. Ideally this should be the UUID.
+	PUID string
+
+	// The Name is a user-friendly name for the Processing Unit.
+	Name string
+
+	// Tags represents the set of MetadataTags associated with this PUID.
+	Tags map[string]string
+
+	// The PID is the PID on the system where this Processing Unit is running.
+	PID string
+
+	// IPs is a map of all the IPs that fully belong to this processing Unit.
+	IPs map[string]string
+
+	// NetNSPath is the path of the network namespace of a Processing Unit that
+	// has no PID, like a namespace created with ip netns.
+	NetNSPath string
+
+	// Metadata carries the trace of the event, like the traceparent of the W3C trace
+	// context, so that its handling is traced as a child of the span of the client.
+	Metadata map[string]string
+
+	// Tenant is the tenant of the monitor that received the event. It is set by the
+	// monitor, whatever the client sends, and recorded with the context of the PU.
+	Tenant string `json:",omitempty"`
+
+	// unknownFields are the fields of the JSON event that are not fields of EventInfo
+	unknownFields []string
+}
+
+// UnmarshalJSON decodes an event and remembers its unknown fields. Like the standard
+// decoder, the names of the fields are matched without their case.
+func (e *EventInfo) UnmarshalJSON(data []byte) error {
+
+	type eventInfo EventInfo
+	decoded := (*eventInfo)(e)
+	if err := json.Unmarshal(data, decoded); err != nil {
+		return err
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	e.unknownFields = nil
+	for name := range fields {
+		if !isEventField(name) {
+			e.unknownFields = append(e.unknownFields, name)
+		}
+	}
+
+	return nil
+}
+
+// UnknownFields returns the fields of the JSON event that are not fields of
+// EventInfo. They are ignored by the decoder.
+func (e *EventInfo) UnknownFields() []string {
+
+	return e.unknownFields
+}
+
+// isEventField returns true if a name is the JSON name of a field of EventInfo
+func isEventField(name string) bool {
+
+	t := reflect.TypeOf(EventInfo{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		jsonName := field.Name
+		if tag := strings.Split(field.Tag.Get("json"), ",")[0]; tag != "" {
+			jsonName = tag
+		}
+
+		if strings.EqualFold(jsonName, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PolicySummary summarizes the policy applied to a ProcessingUnit
+type PolicySummary struct {
+	// Revision is the revision of the policy, the value of its policy revision annotation
+	Revision string
+	// DefaultAction is the action of the flows not matched by the rules: reject when
+	// the PU is policed, accept when its policy allows all
+	DefaultAction string
+	// Rules is the number of ACLs and of tag selector rules of the policy
+	Rules int
+	// Mode is how the policy is enforced
+	Mode string
+}
+
+// RPCResponse encapsulate the error response if any.
+type RPCResponse struct {
+	Error string
+	// Policy summarizes the policy applied to the PU of a start event, when the
+	// monitor was created with the WithPolicySummary option
+	Policy *PolicySummary `json:",omitempty"`
+}
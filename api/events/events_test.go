@@ -0,0 +1,66 @@
+package events
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/aporeto-inc/trireme/constants"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWireFormat(t *testing.T) {
+
+	Convey("Given an event of the RPC monitor", t, func() {
+
+		eventInfo := &EventInfo{
+			EventType: EventStart,
+			PUType:    constants.LinuxProcessPU,
+			PUID:      "/1234",
+			Name:      "nginx",
+			PID:       "1234",
+		}
+
+		Convey("It should be encoded with the field names of the RPC monitor", func() {
+			data, err := json.Marshal(eventInfo)
+			So(err, ShouldBeNil)
+
+			fields := map[string]interface{}{}
+			So(json.Unmarshal(data, &fields), ShouldBeNil)
+			So(fields["EventType"], ShouldEqual, "start")
+			So(fields["PUID"], ShouldEqual, "/1234")
+			So(fields["PID"], ShouldEqual, "1234")
+		})
+
+		Convey("A response without a policy should not encode it", func() {
+			data, err := json.Marshal(&RPCResponse{Error: "failed"})
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, `{"Error":"failed"}`)
+		})
+	})
+}
+
+func TestUnknownFields(t *testing.T) {
+
+	Convey("Given a JSON event with a misspelled field", t, func() {
+
+		eventInfo := &EventInfo{}
+		err := json.Unmarshal([]byte(`{"version":2,"EventType":"start","puid":"/1234","ProcessID":"1234"}`), eventInfo)
+		So(err, ShouldBeNil)
+
+		Convey("The known fields should be decoded without their case", func() {
+			So(eventInfo.Version, ShouldEqual, EventVersion2)
+			So(eventInfo.PUID, ShouldEqual, "/1234")
+		})
+
+		Convey("The misspelled field should be reported", func() {
+			So(eventInfo.UnknownFields(), ShouldResemble, []string{"ProcessID"})
+		})
+	})
+
+	Convey("An event without a version should not encode it", t, func() {
+		data, err := json.Marshal(&EventInfo{EventType: EventStop})
+		So(err, ShouldBeNil)
+		So(strings.Contains(string(data), "Version"), ShouldBeFalse)
+	})
+}
@@ -0,0 +1,310 @@
+// Package records defines the records of the flows, the PUs and the actions of
+// Trireme reported to the collectors. It only depends on the policy package, so that
+// the consumers of the records can be built without the datapath, on any platform.
+// The collector package re-exports its types.
+package records
+
+import (
+	"time"
+
+	"github.com/aporeto-inc/trireme/policy"
+)
+
+const (
+	// FlowReject indicates that a flow was rejected
+	FlowReject = "reject"
+	// FlowAccept logs that a flow is accepted
+	FlowAccept = "accept"
+	// MissingToken indicates that the token was missing
+	MissingToken = "missingtoken"
+	// InvalidToken indicates that the token was invalid
+	InvalidToken = "token"
+	// InvalidFormat indicates that the packet metadata were not correct
+	InvalidFormat = "format"
+	// InvalidContext indicates that there was no context in the metadata
+	InvalidContext = "context"
+	// InvalidState indicates that a packet was received without proper state information
+	InvalidState = "state"
+	// InvalidNonse indicates that the nonse check failed
+	InvalidNonse = "nonse"
+	// PolicyDrop indicates that the flow is rejected because of the policy decision
+	PolicyDrop = "policy"
+	// IdentityRevoked indicates that an accepted flow is no longer accepted after an
+	// identity update of its peer
+	IdentityRevoked = "identityrevoked"
+	// ReauthorizationFailed indicates that an established flow is no longer accepted
+	// by the current policy of its PU
+	ReauthorizationFailed = "reauthorization"
+	// TrustedNetwork indicates that a flow of a trusted network was accepted without
+	// the identity handshake
+	TrustedNetwork = "trusted"
+	// InvalidIssuer indicates that the certificate of the peer was not issued by a
+	// certificate authority accepted by the issuer rules of the PU
+	InvalidIssuer = "issuer"
+	// DNSPolicyDrop indicates that a DNS query was dropped by the DNS policy of the PU
+	DNSPolicyDrop = "dns"
+	// HandshakeBlocked indicates that the handshake of a source blocked after
+	// repeated handshake anomalies was rejected
+	HandshakeBlocked = "handshakeblocked"
+	// PreExistingFlow indicates that flows established before the supervision of
+	// their PU were kept or terminated
+	PreExistingFlow = "preexisting"
+	// FlowVolume indicates the report of the traffic of an accepted flow since its
+	// previous report
+	FlowVolume = "volume"
+	// ContainerStart indicates a container start event
+	ContainerStart = "start"
+	// ContainerStop indicates a container stop event
+	ContainerStop = "stop"
+	// ContainerCreate indicates a container create event
+	ContainerCreate = "create"
+	// ContainerDelete indicates a container delete event
+	ContainerDelete = "delete"
+	// ContainerUpdate indicates a container policy update event
+	ContainerUpdate = "update"
+	// ContainerFailed indicates an event that a container was stopped because of policy issues
+	ContainerFailed = "forcestop"
+	// ContainerIgnored indicates that the container will be ignored by Trireme
+	ContainerIgnored = "ignore"
+	// UnknownContainerDelete indicates that policy for an unknwon container was deleted
+	UnknownContainerDelete = "unknowncontainer"
+	// ContainerTagsTruncated indicates that identity tags of a container were not transmitted
+	// because its tokens exceeded the size budget
+	ContainerTagsTruncated = "tagstruncated"
+	// RejectionDrop indicates that the packets of a rejected flow were dropped
+	RejectionDrop = "drop"
+	// RejectionReset indicates that a rejected flow was reset
+	RejectionReset = "reset"
+	// PolicyValid Normal flow accept
+	PolicyValid = "V"
+)
+
+// FlowRecord describes a flow record for statistis
+type FlowRecord struct {
+	ContextID       string
+	Count           int
+	SourceID        string
+	DestinationID   string
+	SourceIP        string
+	DestinationIP   string
+	DestinationPort uint16
+	Tags            *policy.TagsMap
+	Action          string
+	Mode            string
+	ProcessPath     string
+	ProcessCmdline  string
+	// Rejection is how a rejected flow was terminated, if known
+	Rejection string
+	// SourcePort is the port of the source of the flow, if known. With the addresses
+	// and the destination port, it identifies the socket of the flow.
+	SourcePort uint16
+	// PeerIdentity is the identity of the remote PU verified in the handshake, if
+	// any. With the Tags of the local PU, it describes both ends of the flow.
+	PeerIdentity *policy.TagsMap
+	// Bytes and Packets are the traffic of the flow from its source, ReplyBytes and
+	// ReplyPackets from its destination, since the previous report of the flow. They
+	// are only set in the records of the FlowVolume mode.
+	Bytes        uint64
+	Packets      uint64
+	ReplyBytes   uint64
+	ReplyPackets uint64
+}
+
+// ContainerRecord is a statistics record for a container
+type ContainerRecord struct {
+	ContextID string
+	IPAddress string
+	Tags      *policy.TagsMap
+	Event     string
+}
+
+const (
+	// SecurityPIDRecycled indicates that the PID of a PU no longer belongs to the
+	// process of the PU. Either the PID was reused by another process or the process
+	// changed of executable or namespace.
+	SecurityPIDRecycled = "pidrecycled"
+
+	// SecurityHandshakeDowngrade indicates that a source repeatedly sent handshakes
+	// whose identity was stripped or malformed, like to force the processing of its
+	// connections by the ACLs only
+	SecurityHandshakeDowngrade = "handshakedowngrade"
+)
+
+// SecurityRecord describes a security event detected by Trireme
+type SecurityRecord struct {
+	Event     string
+	ContextID string
+	PID       int
+	// SourceIP is the address of the source of the event, if any
+	SourceIP string
+	// Details describes what was detected
+	Details string
+}
+
+const (
+	// AdminExcludeIPs indicates that IP addresses were excluded from the enforcement
+	AdminExcludeIPs = "excludeips"
+	// AdminQuarantine indicates that a PU was quarantined. The IPs are the networks
+	// it can still reach.
+	AdminQuarantine = "quarantine"
+	// AdminReleaseQuarantine indicates that the quarantine of a PU was lifted
+	AdminReleaseQuarantine = "releasequarantine"
+	// AdminEnforcerRestart indicates that the remote enforcer of a PU was restarted to
+	// run a new binary
+	AdminEnforcerRestart = "enforcerrestart"
+)
+
+// AdminRecord describes an administrative action of Trireme
+type AdminRecord struct {
+	Action    string
+	ContextID string
+	IPs       []string
+}
+
+// PeerRecord describes a pair of peers seen for the first time by a PU
+type PeerRecord struct {
+	ContextID       string
+	SourceID        string
+	DestinationID   string
+	DestinationPort uint16
+	Action          string
+}
+
+// StatsRecord accounts for an interval of flow records reported by a remote
+// enforcer. The remote enforcers number the stats they deliver and report the number
+// of records they delivered before them, so that the records lost between an
+// enforcer and the consumers of the collector can be detected and quantified.
+type StatsRecord struct {
+	// ContextID is the context of the remote enforcer
+	ContextID string
+	// Sequence is the sequence number of the stats, starting at 1 for every remote
+	// enforcer process
+	Sequence uint64
+	// Watermark is the number of records the enforcer delivered before the stats
+	Watermark uint64
+	// Records is the number of records of the stats
+	Records int
+	// Accepted is the number of records of the stats passed to the collector. The
+	// others were dropped by the rate limit of the stats.
+	Accepted int
+	// Retransmitted is true if stats of the same sequence number were already
+	// received. The enforcer sends the records of the stats again when it did not
+	// receive the response, so some of the records may be counted twice.
+	Retransmitted bool
+	// LostIntervals is the number of stats of the enforcer that were never received
+	// since the previous stats
+	LostIntervals uint64
+	// LostRecords is the number of records of the lost intervals
+	LostRecords uint64
+	// Evicted is the number of records the enforcer evicted from its flow cache since
+	// the previous stats, because the cache was full
+	Evicted uint64
+}
+
+// Lost returns the number of records lost since the previous stats of the enforcer,
+// including the records of the stats that were dropped and the records evicted
+func (r *StatsRecord) Lost() uint64 {
+
+	return r.LostRecords + r.Evicted + uint64(r.Records-r.Accepted)
+}
+
+// Directions of the traffic of the rules of a BandwidthRecord
+const (
+	// BandwidthApplication is the traffic sent by the PU, matched by its application ACLs
+	BandwidthApplication = "application"
+	// BandwidthNetwork is the traffic received by the PU, matched by its network ACLs
+	BandwidthNetwork = "network"
+)
+
+// RuleBandwidth is the traffic matched by an ACL of a PU during an accounting
+// interval. Only the packets of the new flows are matched by the ACLs, the packets
+// of the established flows are accounted for in the totals of the PU.
+type RuleBandwidth struct {
+	// Direction is BandwidthApplication or BandwidthNetwork
+	Direction string
+	// Rule is the ACL
+	Rule    policy.IPRule
+	Bytes   uint64
+	Packets uint64
+}
+
+// BandwidthRecord is the traffic of a PU during an accounting interval
+type BandwidthRecord struct {
+	ContextID string
+	Tags      *policy.TagsMap
+	// Interval is the duration of the accounting interval
+	Interval time.Duration
+	// TxBytes and TxPackets are the traffic sent by the PU
+	TxBytes   uint64
+	TxPackets uint64
+	// RxBytes and RxPackets are the traffic received by the PU
+	RxBytes   uint64
+	RxPackets uint64
+	// Rules is the traffic of the ACLs of the PU that matched packets
+	Rules []*RuleBandwidth
+}
+
+// LatencyRecord is the latency of the handshakes of the flows of a PU authorized with
+// a token during a reporting interval, from the SYN seen by the enforcer to the flow
+// authorized. The percentiles are computed from a sample of the handshakes of the
+// interval when there are too many of them.
+type LatencyRecord struct {
+	ContextID string
+	Tags      *policy.TagsMap
+	// Interval is the duration of the reporting interval
+	Interval time.Duration
+	// Count is the number of handshakes of the interval
+	Count uint64
+	// P50, P90 and P99 are the percentiles of the latency of the handshakes
+	P50 time.Duration
+	P90 time.Duration
+	P99 time.Duration
+	// Max is the longest handshake of the interval
+	Max time.Duration
+}
+
+// Directions of the rules of a RuleStatsRecord
+const (
+	// RuleApplication are the application ACLs of the PU, matching the packets it sends
+	RuleApplication = BandwidthApplication
+	// RuleNetwork are the network ACLs of the PU, matching the packets it receives
+	RuleNetwork = BandwidthNetwork
+	// RuleTransmitter are the transmitter rules of the PU, matching the identity of
+	// the peers of the flows it initiates
+	RuleTransmitter = "transmitter"
+	// RuleReceiver are the receiver rules of the PU, matching the identity of the
+	// peers of the flows it accepts
+	RuleReceiver = "receiver"
+)
+
+// RuleHits is the number of matches of a rule of a PU during a reporting interval.
+// The rules without match are reported, so that the unused rules can be found.
+type RuleHits struct {
+	// Direction is RuleApplication, RuleNetwork, RuleTransmitter or RuleReceiver
+	Direction string
+	// Index is the position of the rule in the rules of its direction
+	Index int
+	// Rule is the ACL of the application and network directions
+	Rule policy.IPRule
+	// Selector is the identity rule of the transmitter and receiver directions
+	Selector policy.TagSelector
+	// Network is the additional network of a multi-homed PU whose identity rules are
+	// counted separately, or empty for the rules of the default network
+	Network string
+	// Hits is the number of packets matched by an ACL, or the number of flows
+	// authorized or rejected by an identity rule
+	Hits uint64
+	// Bytes is the traffic matched by an ACL
+	Bytes uint64
+}
+
+// RuleStatsRecord is the number of matches of the rules of a PU during a reporting
+// interval. The supervisors report the ACLs and the enforcers the identity rules,
+// in separate records.
+type RuleStatsRecord struct {
+	ContextID string
+	Tags      *policy.TagsMap
+	// Interval is the duration of the reporting interval
+	Interval time.Duration
+	Rules    []*RuleHits
+}
@@ -0,0 +1,95 @@
+package trireme
+
+import (
+	"fmt"
+
+	"github.com/aporeto-inc/trireme/policy"
+	"github.com/aporeto-inc/trireme/utils/auditlog"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// requestTriggers are the triggers of the audit entries of the requests
+var requestTriggers = map[int]string{
+	policyUpdate:     "policy-update",
+	quarantineUpdate: "quarantine",
+	rolloutStart:     "rollout-start",
+	rolloutEnd:       "rollout-end",
+	retryRequest:     "retry",
+	enforcerRestart:  "enforcer-restart",
+	runtimeUpdate:    "runtime-update",
+}
+
+// triggerOf returns the trigger of the audit entries of a request
+func triggerOf(request *triremeRequest) string {
+
+	if request.reqType == handleEvent {
+		return "monitor-" + string(request.eventType)
+	}
+
+	return requestTriggers[request.reqType]
+}
+
+// SetAuditLog implements the AuditConfigurer interface
+func (t *trireme) SetAuditLog(auditLog *auditlog.Log) {
+
+	t.auditLog = auditLog
+}
+
+// appliedRevision returns the revision of the policy applied to a PU
+func (t *trireme) appliedRevision(contextID string) string {
+
+	applied, ok := t.applied[contextID]
+	if !ok {
+		return ""
+	}
+
+	return revisionOf(applied.Policy)
+}
+
+// audit records an action of the request routine on the policy of a PU. The audit
+// log failures are logged and do not fail the action.
+func (t *trireme) audit(action auditlog.Action, contextID, oldRevision, newRevision string, err error) {
+
+	if t.auditLog == nil {
+		return
+	}
+
+	entry := auditlog.Entry{
+		Time:        t.clock.Now(),
+		Node:        t.serverID,
+		Trigger:     t.trigger,
+		Action:      action,
+		ContextID:   contextID,
+		OldRevision: oldRevision,
+		NewRevision: newRevision,
+	}
+
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	if _, err := t.auditLog.Append(entry); err != nil {
+		log.WithFields(log.Fields{
+			"package":   "trireme",
+			"contextID": contextID,
+			"action":    string(action),
+			"error":     err.Error(),
+		}).Error("Failed to write the audit log")
+	}
+}
+
+// auditResolution records the resolution of the policy of a PU. The new revision is
+// the revision being resolved, or the revision of the policy of the resolver.
+func (t *trireme) auditResolution(contextID, revision string, policyInfo *policy.PUPolicy, err error) {
+
+	if err == nil && policyInfo == nil {
+		err = fmt.Errorf("Nil policy returned")
+	}
+
+	if revision == "" && policyInfo != nil {
+		revision = revisionOf(policyInfo)
+	}
+
+	t.audit(auditlog.ActionResolve, contextID, t.appliedRevision(contextID), revision, err)
+}
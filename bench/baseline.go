@@ -0,0 +1,122 @@
+package bench
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"testing"
+)
+
+// DefaultTolerance is the slowdown over the baseline above which a benchmark is
+// reported as a regression
+const DefaultTolerance = 0.2
+
+// Result is the result of a benchmark
+type Result struct {
+	Name        string  `json:"name"`
+	NsPerOp     float64 `json:"ns_per_op"`
+	AllocsPerOp int64   `json:"allocs_per_op"`
+	BytesPerOp  int64   `json:"bytes_per_op"`
+}
+
+// Regression is a benchmark slower than its baseline, or allocating more
+type Regression struct {
+	Name     string
+	Baseline Result
+	Current  Result
+	// Slowdown is the time per operation over the one of the baseline, minus one
+	Slowdown float64
+}
+
+// String returns a description of the regression
+func (r Regression) String() string {
+
+	return fmt.Sprintf("%s: %.0f ns/op (baseline %.0f ns/op, %+.1f%%), %d allocs/op (baseline %d)",
+		r.Name, r.Current.NsPerOp, r.Baseline.NsPerOp, r.Slowdown*100, r.Current.AllocsPerOp, r.Baseline.AllocsPerOp)
+}
+
+// Run runs the benchmarks whose name matches the expression, or all of them if the
+// expression is nil
+func Run(filter *regexp.Regexp) []Result {
+
+	results := []Result{}
+
+	for _, benchmark := range Benchmarks {
+		if filter != nil && !filter.MatchString(benchmark.Name) {
+			continue
+		}
+
+		r := testing.Benchmark(benchmark.F)
+		if r.N == 0 {
+			continue
+		}
+
+		results = append(results, Result{
+			Name:        benchmark.Name,
+			NsPerOp:     float64(r.T.Nanoseconds()) / float64(r.N),
+			AllocsPerOp: r.AllocsPerOp(),
+			BytesPerOp:  r.AllocedBytesPerOp(),
+		})
+	}
+
+	return results
+}
+
+// WriteResults writes the results in JSON, to be used as a baseline
+func WriteResults(w io.Writer, results []Result) error {
+
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(data, '\n'))
+
+	return err
+}
+
+// ReadResults reads the results written by WriteResults
+func ReadResults(r io.Reader) ([]Result, error) {
+
+	results := []Result{}
+	if err := json.NewDecoder(r).Decode(&results); err != nil {
+		return nil, fmt.Errorf("Invalid benchmark results: %s", err)
+	}
+
+	return results, nil
+}
+
+// Compare returns the benchmarks whose time per operation exceeds the one of the
+// baseline by more than the tolerance, or that allocate more per operation. The
+// benchmarks missing from the baseline are not compared.
+func Compare(baseline, current []Result, tolerance float64) []Regression {
+
+	previous := map[string]Result{}
+	for _, r := range baseline {
+		previous[r.Name] = r
+	}
+
+	regressions := []Regression{}
+
+	for _, r := range current {
+		b, ok := previous[r.Name]
+		if !ok || b.NsPerOp <= 0 {
+			continue
+		}
+
+		slowdown := r.NsPerOp/b.NsPerOp - 1
+		if slowdown <= tolerance && r.AllocsPerOp <= b.AllocsPerOp {
+			continue
+		}
+
+		regressions = append(regressions, Regression{
+			Name:     r.Name,
+			Baseline: b,
+			Current:  r,
+			Slowdown: slowdown,
+		})
+	}
+
+	return regressions
+}
@@ -0,0 +1,208 @@
+// Package bench holds reproducible micro-benchmarks of the hot paths of the datapath:
+// the tokens, the ACL lookups, the caches and the packets. The inputs are fixed so
+// that the results of two releases can be compared with Compare.
+package bench
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aporeto-inc/trireme/cache"
+	"github.com/aporeto-inc/trireme/enforcer/lookup"
+	"github.com/aporeto-inc/trireme/enforcer/utils/packet"
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+	"github.com/aporeto-inc/trireme/policy"
+)
+
+// Benchmark is a named micro-benchmark
+type Benchmark struct {
+	Name string
+	F    func(b *testing.B)
+}
+
+// Benchmarks are the micro-benchmarks of the datapath
+var Benchmarks = []Benchmark{
+	{Name: "TokenSign", F: TokenSign},
+	{Name: "TokenVerify", F: TokenVerify},
+	{Name: "ACLLookup", F: ACLLookup},
+	{Name: "CacheAddOrUpdate", F: CacheAddOrUpdate},
+	{Name: "CacheGet", F: CacheGet},
+	{Name: "PacketParse", F: PacketParse},
+	{Name: "PacketModify", F: PacketModify},
+}
+
+// synPacket is a TCP SYN packet from 127.0.0.1 to the port 99 of 127.0.0.1
+var synPacket = []byte{
+	0x45, 0x10, 0x00, 0x3c, 0xec, 0x6c, 0x40, 0x00, 0x40, 0x06, 0x50,
+	0x3d, 0x7f, 0x00, 0x00, 0x01, 0x7f, 0x00, 0x00, 0x01, 0x8c, 0x80, 0x00, 0x63, 0x2c, 0x32,
+	0xa8, 0xd6, 0x00, 0x00, 0x00, 0x00, 0xa0, 0x02, 0xaa, 0xaa, 0xfe, 0x88, 0x00, 0x00, 0x02,
+	0x04, 0xff, 0xd7, 0x04, 0x02, 0x08, 0x0a, 0xff, 0xff, 0x44, 0xba, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x03, 0x03, 0x07,
+}
+
+// benchmarkTags returns the tags of a typical PU
+func benchmarkTags() *policy.TagsMap {
+
+	return policy.NewTagsMap(map[string]string{
+		"app":          "web",
+		"env":          "production",
+		"tier":         "frontend",
+		"team":         "payments",
+		"version":      "1.4.2",
+		"region":       "us-west",
+		"$id":          "5a1b2c3d4e5f",
+		"$namespace":   "/acme/payments",
+		"$identity":    "processingunit",
+		"$operational": "running",
+	})
+}
+
+// benchmarkClaims returns the claims of a SYN packet
+func benchmarkClaims() *tokens.ConnectionClaims {
+
+	return &tokens.ConnectionClaims{
+		T:   benchmarkTags(),
+		LCL: []byte("0123456789abcdef0123456789abcdef"),
+	}
+}
+
+// benchmarkTokenEngine returns a JWT engine signing with a pre-shared key
+func benchmarkTokenEngine(b *testing.B) tokens.TokenEngine {
+
+	engine, err := tokens.NewJWT(time.Hour, "bench", tokens.NewPSKSecrets([]byte("benchmark key")))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	return engine
+}
+
+// TokenSign measures the creation and signature of the token of a SYN packet
+func TokenSign(b *testing.B) {
+
+	engine := benchmarkTokenEngine(b)
+	claims := benchmarkClaims()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		engine.CreateAndSign(false, claims)
+	}
+}
+
+// TokenVerify measures the verification and decoding of the token of a SYN packet
+func TokenVerify(b *testing.B) {
+
+	engine := benchmarkTokenEngine(b)
+	token := engine.CreateAndSign(false, benchmarkClaims())
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		engine.Decode(false, token, nil)
+	}
+}
+
+// ACLLookup measures the search of the tags of a PU in a policy of 100 rules,
+// matching the last one
+func ACLLookup(b *testing.B) {
+
+	db := lookup.NewPolicyDB()
+	for i := 0; i < 100; i++ {
+		db.AddPolicy(policy.TagSelector{
+			Clause: []policy.KeyValueOperator{
+				{Key: "app", Value: []string{"web"}, Operator: policy.Equal},
+				{Key: "team", Value: []string{"team" + strconv.Itoa(i)}, Operator: policy.Equal},
+			},
+			Action: policy.Accept,
+		})
+	}
+
+	tags := benchmarkTags()
+	tags.Add("team", "team99")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		db.Search(tags)
+	}
+}
+
+// CacheAddOrUpdate measures the updates of the flows of a cache of 1000 flows
+func CacheAddOrUpdate(b *testing.B) {
+
+	c := cache.NewCache()
+	keys := benchmarkKeys(1000)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.AddOrUpdate(keys[i%len(keys)], i)
+	}
+}
+
+// CacheGet measures the lookups of the flows of a cache of 1000 flows
+func CacheGet(b *testing.B) {
+
+	c := cache.NewCache()
+	keys := benchmarkKeys(1000)
+	for i, key := range keys {
+		c.AddOrUpdate(key, i)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Get(keys[i%len(keys)])
+	}
+}
+
+// benchmarkKeys returns the flow hashes of n flows
+func benchmarkKeys(n int) []string {
+
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = "10.1.1." + strconv.Itoa(i%256) + ":" + strconv.Itoa(1024+i) + ":10.2.2.2:443"
+	}
+
+	return keys
+}
+
+// PacketParse measures the parsing of a SYN packet
+func PacketParse(b *testing.B) {
+
+	buffer := make([]byte, len(synPacket))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		copy(buffer, synPacket)
+		if _, err := packet.New(0, buffer, "0"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// PacketModify measures the attachment of a token to a SYN packet, as the datapath
+// does before sending it
+func PacketModify(b *testing.B) {
+
+	buffer := make([]byte, len(synPacket))
+	options := []byte{34, 4, 0, 0}
+	token := make([]byte, 256)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		copy(buffer, synPacket)
+		p, err := packet.New(0, buffer, "0")
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := p.TCPDataAttach(options, token); err != nil {
+			b.Fatal(err)
+		}
+		p.GetBytes()
+	}
+}
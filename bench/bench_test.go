@@ -0,0 +1,73 @@
+package bench
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func BenchmarkTokenSign(b *testing.B)        { TokenSign(b) }
+func BenchmarkTokenVerify(b *testing.B)      { TokenVerify(b) }
+func BenchmarkACLLookup(b *testing.B)        { ACLLookup(b) }
+func BenchmarkCacheAddOrUpdate(b *testing.B) { CacheAddOrUpdate(b) }
+func BenchmarkCacheGet(b *testing.B)         { CacheGet(b) }
+func BenchmarkPacketParse(b *testing.B)      { PacketParse(b) }
+func BenchmarkPacketModify(b *testing.B)     { PacketModify(b) }
+
+func TestCompare(t *testing.T) {
+	Convey("Given the results of a baseline", t, func() {
+		baseline := []Result{
+			{Name: "TokenSign", NsPerOp: 1000, AllocsPerOp: 10},
+			{Name: "CacheGet", NsPerOp: 100, AllocsPerOp: 0},
+		}
+
+		Convey("When the benchmarks are within the tolerance, there should be no regression", func() {
+			current := []Result{
+				{Name: "TokenSign", NsPerOp: 1150, AllocsPerOp: 10},
+				{Name: "CacheGet", NsPerOp: 80, AllocsPerOp: 0},
+				{Name: "PacketParse", NsPerOp: 50, AllocsPerOp: 1},
+			}
+			So(Compare(baseline, current, DefaultTolerance), ShouldBeEmpty)
+		})
+
+		Convey("When a benchmark is slower than the tolerance, it should regress", func() {
+			current := []Result{
+				{Name: "TokenSign", NsPerOp: 1500, AllocsPerOp: 10},
+				{Name: "CacheGet", NsPerOp: 100, AllocsPerOp: 0},
+			}
+
+			regressions := Compare(baseline, current, DefaultTolerance)
+			So(len(regressions), ShouldEqual, 1)
+			So(regressions[0].Name, ShouldEqual, "TokenSign")
+			So(regressions[0].Slowdown, ShouldAlmostEqual, 0.5)
+		})
+
+		Convey("When a benchmark allocates more, it should regress", func() {
+			current := []Result{
+				{Name: "CacheGet", NsPerOp: 100, AllocsPerOp: 1},
+			}
+			So(len(Compare(baseline, current, DefaultTolerance)), ShouldEqual, 1)
+		})
+	})
+}
+
+func TestResults(t *testing.T) {
+	Convey("Given results written as a baseline", t, func() {
+		results := []Result{{Name: "ACLLookup", NsPerOp: 312.5, AllocsPerOp: 2, BytesPerOp: 64}}
+
+		var buffer bytes.Buffer
+		So(WriteResults(&buffer, results), ShouldBeNil)
+
+		Convey("Then I should read the same results", func() {
+			read, err := ReadResults(&buffer)
+			So(err, ShouldBeNil)
+			So(read, ShouldResemble, results)
+		})
+
+		Convey("Then invalid results should fail", func() {
+			_, err := ReadResults(bytes.NewBufferString("not json"))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/aporeto-inc/trireme/utils/clock"
 )
 
 // DataStore is the interface to a datastore.
@@ -15,6 +16,7 @@ type DataStore interface {
 	Get(u interface{}) (i interface{}, err error)
 	Remove(u interface{}) (err error)
 	DumpStore()
+	KeyList() []interface{}
 	LockedModify(u interface{}, add func(a, b interface{}) interface{}, increment interface{}) (interface{}, error)
 }
 
@@ -29,6 +31,7 @@ type Cleanable interface {
 type Cache struct {
 	data     map[interface{}]entry
 	lifetime time.Duration
+	clock    clock.Clock
 	sync.RWMutex
 }
 
@@ -37,7 +40,7 @@ type Cache struct {
 type entry struct {
 	value     interface{}
 	timestamp time.Time
-	timer     *time.Timer
+	timer     clock.Timer
 }
 
 // NewCache creates a new data cache
@@ -46,6 +49,7 @@ func NewCache() *Cache {
 	c := &Cache{
 		data:     make(map[interface{}]entry),
 		lifetime: -1,
+		clock:    clock.New(),
 	}
 
 	return c
@@ -54,22 +58,29 @@ func NewCache() *Cache {
 // NewCacheWithExpiration creates a new data cache
 func NewCacheWithExpiration(lifetime time.Duration) *Cache {
 
+	return NewCacheWithClock(lifetime, clock.New())
+}
+
+// NewCacheWithClock creates a new data cache whose entries expire after the lifetime
+// measured by the clock
+func NewCacheWithClock(lifetime time.Duration, clk clock.Clock) *Cache {
+
 	return &Cache{
 		data:     make(map[interface{}]entry),
 		lifetime: lifetime,
+		clock:    clk,
 	}
-
 }
 
 // Add stores an entry into the cache and updates the timestamp
 func (c *Cache) Add(u interface{}, value interface{}) (err error) {
 
-	var timer *time.Timer
+	var timer clock.Timer
 	if c.lifetime != -1 {
-		timer = time.AfterFunc(c.lifetime, func() { c.Remove(u) })
+		timer = c.clock.AfterFunc(c.lifetime, func() { c.Remove(u) })
 	}
 
-	t := time.Now()
+	t := c.clock.Now()
 
 	c.Lock()
 	defer c.Unlock()
@@ -90,12 +101,12 @@ func (c *Cache) Add(u interface{}, value interface{}) (err error) {
 // Update changes the value of an entry into the cache and updates the timestamp
 func (c *Cache) Update(u interface{}, value interface{}) (err error) {
 
-	var timer *time.Timer
+	var timer clock.Timer
 	if c.lifetime != -1 {
-		timer = time.AfterFunc(c.lifetime, func() { c.Remove(u) })
+		timer = c.clock.AfterFunc(c.lifetime, func() { c.Remove(u) })
 	}
 
-	t := time.Now()
+	t := c.clock.Now()
 
 	c.Lock()
 	defer c.Unlock()
@@ -122,12 +133,12 @@ func (c *Cache) Update(u interface{}, value interface{}) (err error) {
 // if needed. If an update happens the timestamp is also updated.
 func (c *Cache) AddOrUpdate(u interface{}, value interface{}) (err error) {
 
-	var timer *time.Timer
+	var timer clock.Timer
 	if c.lifetime != -1 {
-		timer = time.AfterFunc(c.lifetime, func() { c.Remove(u) })
+		timer = c.clock.AfterFunc(c.lifetime, func() { c.Remove(u) })
 	}
 
-	t := time.Now()
+	t := c.clock.Now()
 
 	c.Lock()
 	defer c.Unlock()
@@ -194,15 +205,29 @@ func (c *Cache) SizeOf() int {
 	return len(c.data)
 }
 
+// KeyList returns the keys of all the entries of the cache
+func (c *Cache) KeyList() []interface{} {
+
+	c.RLock()
+	defer c.RUnlock()
+
+	list := make([]interface{}, 0, len(c.data))
+	for u := range c.data {
+		list = append(list, u)
+	}
+
+	return list
+}
+
 // LockedModify  locks the data store
 func (c *Cache) LockedModify(u interface{}, add func(a, b interface{}) interface{}, increment interface{}) (interface{}, error) {
 
-	var timer *time.Timer
+	var timer clock.Timer
 	if c.lifetime != -1 {
-		timer = time.AfterFunc(c.lifetime, func() { c.Remove(u) })
+		timer = c.clock.AfterFunc(c.lifetime, func() { c.Remove(u) })
 	}
 
-	t := time.Now()
+	t := c.clock.Now()
 
 	c.Lock()
 	defer c.Unlock()
@@ -4,6 +4,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/aporeto-inc/trireme/utils/clock"
 	"github.com/satori/go.uuid"
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -165,6 +166,26 @@ func TestLockedModify(t *testing.T) {
 	})
 }
 
+func TestKeyList(t *testing.T) {
+
+	t.Parallel()
+
+	Convey("Given a new cache", t, func() {
+		c := NewCache()
+
+		Convey("Given two elements", func() {
+			c.Add("key1", 1)
+			c.Add("key2", 2)
+
+			Convey("I should get both keys", func() {
+				So(c.KeyList(), ShouldHaveLength, 2)
+				So(c.KeyList(), ShouldContain, "key1")
+				So(c.KeyList(), ShouldContain, "key2")
+			})
+		})
+	})
+}
+
 func TestTimerExpirationWithUpdate(t *testing.T) {
 
 	t.Parallel()
@@ -189,6 +210,29 @@ func TestTimerExpirationWithUpdate(t *testing.T) {
 	})
 }
 
+func TestExpirationWithClock(t *testing.T) {
+
+	t.Parallel()
+
+	Convey("Given that I instantiate 1 object with a 2 second timer of a fake clock", t, func() {
+		clk := clock.NewFake(time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC))
+		c := NewCacheWithClock(2*time.Second, clk)
+		c.Add(1, 1)
+
+		Convey("When I update the object after 1 second and advance the clock by another second, the size should be 1", func() {
+			clk.Advance(1 * time.Second)
+			c.Update(1, 1)
+			clk.Advance(1 * time.Second)
+			So(c.SizeOf(), ShouldEqual, 1)
+
+			Convey("When I advance the clock past the lifetime of the update, the size should be 0", func() {
+				clk.Advance(1 * time.Second)
+				So(c.SizeOf(), ShouldEqual, 0)
+			})
+		})
+	})
+}
+
 func TestThousandsOfTimers(t *testing.T) {
 
 	t.Parallel()
@@ -0,0 +1,129 @@
+// +build linux
+
+package remoteenforcer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aporeto-inc/trireme/enforcer"
+)
+
+const (
+	// envFlowStateDir enables the persistence of the accepted flows in the given
+	// directory. It should be on a tmpfs so that the state does not survive a reboot.
+	envFlowStateDir = "FLOWSTATE_DIR"
+
+	defaultFlowStateInterval = 5 * time.Second
+)
+
+// flowStore persists the state of the accepted flows and of the connections being
+// authorized by the enforcer so that an enforcer restarted in the same context does
+// not challenge them again
+type flowStore struct {
+	path    string
+	pending []*enforcer.FlowState
+	sync.Mutex
+}
+
+// newFlowStore returns a store for the enforcer listening on the given socket. It
+// returns nil if the persistence is not enabled.
+func newFlowStore(socketPath string) *flowStore {
+
+	dir := os.Getenv(envFlowStateDir)
+	if dir == "" {
+		return nil
+	}
+
+	name := strings.TrimSuffix(filepath.Base(socketPath), ".sock")
+
+	return &flowStore{
+		path:    filepath.Join(dir, name+".flows"),
+		pending: []*enforcer.FlowState{},
+	}
+}
+
+// load reads the flows saved by the previous enforcer. The file is removed so that
+// the state is restored only once.
+func (f *flowStore) load() {
+
+	data, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return
+	}
+
+	os.Remove(f.path)
+
+	flows := []*enforcer.FlowState{}
+	if err := json.Unmarshal(data, &flows); err != nil {
+		log.WithFields(log.Fields{
+			"package": "remote_enforcer",
+			"path":    f.path,
+			"error":   err.Error(),
+		}).Warn("Ignoring invalid flow state")
+		return
+	}
+
+	f.Lock()
+	f.pending = flows
+	f.Unlock()
+}
+
+// save writes the flows of the enforcer. The file is replaced atomically.
+func (f *flowStore) save(exporter enforcer.FlowStateExporter) error {
+
+	data, err := json.Marshal(exporter.ExportFlows())
+	if err != nil {
+		return err
+	}
+
+	tmp := f.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, f.path)
+}
+
+// restore imports the pending flows of a PU once its policy is enforced
+func (f *flowStore) restore(contextID string, exporter enforcer.FlowStateExporter) {
+
+	f.Lock()
+	flows := []*enforcer.FlowState{}
+	remaining := []*enforcer.FlowState{}
+	for _, flow := range f.pending {
+		if flow.ContextID == contextID {
+			flows = append(flows, flow)
+		} else {
+			remaining = append(remaining, flow)
+		}
+	}
+	f.pending = remaining
+	f.Unlock()
+
+	if len(flows) > 0 {
+		exporter.ImportFlows(flows)
+	}
+}
+
+// run saves the flows periodically so that they survive a crash of the enforcer
+func (f *flowStore) run(exporter enforcer.FlowStateExporter) {
+
+	ticker := time.NewTicker(defaultFlowStateInterval)
+
+	for range ticker.C {
+		if err := f.save(exporter); err != nil {
+			log.WithFields(log.Fields{
+				"package": "remote_enforcer",
+				"path":    f.path,
+				"error":   err.Error(),
+			}).Warn("Failed to save flow state")
+		}
+	}
+}
@@ -1,33 +1,247 @@
 package remoteenforcer
 
 import (
+	"container/list"
+	"hash/fnv"
 	"sync"
+	"sync/atomic"
 
 	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/enforcer"
 )
 
+// collectorShards is the number of shards of the flow cache. The datapath collects
+// the flows of every queue concurrently, so they should rarely wait for each other.
+const collectorShards = 32
+
+// maxLatencyRecords is the number of latency records kept while the controller cannot
+// be reached. The oldest records are dropped first.
+const maxLatencyRecords = 64
+
+// maxRuleStatsRecords is the number of rule stats records kept while the controller
+// cannot be reached. The oldest records are dropped first.
+const maxRuleStatsRecords = 16
+
+// flowEntry is a record of the flow cache
+type flowEntry struct {
+	hash   string
+	record *collector.FlowRecord
+}
+
+// flowShard is a shard of the flow cache with its own lock. The records are kept
+// from the most to the least recently updated.
+type flowShard struct {
+	flows map[string]*list.Element
+	lru   *list.List
+	sync.Mutex
+}
+
+// reset empties the shard
+func (s *flowShard) reset() {
+
+	s.flows = map[string]*list.Element{}
+	s.lru = list.New()
+}
+
+// remove removes a record from the shard
+func (s *flowShard) remove(element *list.Element) *flowEntry {
+
+	entry := s.lru.Remove(element).(*flowEntry)
+	delete(s.flows, entry.hash)
+
+	return entry
+}
+
 //CollectorImpl : This is a local implementation for the collector interface
 // It has a flow entries cache which contains unique flows that are reported back to the
-//controller/launcher process
+//controller/launcher process. The cache is sharded by flow, so that the packet path
+//only contends with the other flows of the same shard and with the stats flush.
+//The cache is bounded: once it holds the maximum number of flows, a new flow evicts
+//the least recently updated flow of its shard, or is dropped if its shard is empty.
 type CollectorImpl struct {
-	Flows map[string]*collector.FlowRecord
-	sync.Mutex
+	// evicted is the number of records evicted or dropped since the last stats. It
+	// is first so that it is aligned for the atomic operations.
+	evicted uint64
+	key     *collector.FlowKey
+	shards  [collectorShards]flowShard
+	// records is the number of records in the cache. full is notified when it
+	// reaches the size of a batch, if set.
+	records  int32
+	batch    int32
+	maxFlows int32
+	full     chan struct{}
+	// latencies are the latency records of the handshakes not sent yet
+	latencies     []*collector.LatencyRecord
+	latenciesLock sync.Mutex
+	// ruleStats are the matches of the identity rules not sent yet
+	ruleStats     []*collector.RuleStatsRecord
+	ruleStatsLock sync.Mutex
+}
+
+// NewCollectorImpl returns a CollectorImpl with an empty flow cache. The flows are
+// aggregated with the given key, or with the default key if it is nil.
+func NewCollectorImpl(key *collector.FlowKey) *CollectorImpl {
+
+	if key == nil {
+		key = collector.NewFlowKey(collector.DefaultFlowKeyFields...)
+	}
+
+	c := &CollectorImpl{
+		key:      key,
+		maxFlows: enforcer.DefaultMaxFlows,
+		full:     make(chan struct{}, 1),
+	}
+
+	for i := range c.shards {
+		c.shards[i].reset()
+	}
+
+	return c
+}
+
+// shard returns the shard of a flow hash
+func (c *CollectorImpl) shard(hash string) *flowShard {
+
+	h := fnv.New32a()
+	h.Write([]byte(hash))
+
+	return &c.shards[h.Sum32()%collectorShards]
 }
 
 //CollectFlowEvent collects a new flow event and adds it to a local list it shares with SendStats
 func (c *CollectorImpl) CollectFlowEvent(record *collector.FlowRecord) {
 
-	hash := collector.StatsFlowHash(record)
+	hash := c.key.Hash(record)
+	shard := c.shard(hash)
 
-	c.Lock()
-	defer c.Unlock()
+	shard.Lock()
+	defer shard.Unlock()
 
-	if r, ok := c.Flows[hash]; ok {
+	if element, ok := shard.flows[hash]; ok {
+		r := element.Value.(*flowEntry).record
 		r.Count = r.Count + record.Count
+		r.Bytes = r.Bytes + record.Bytes
+		r.Packets = r.Packets + record.Packets
+		r.ReplyBytes = r.ReplyBytes + record.ReplyBytes
+		r.ReplyPackets = r.ReplyPackets + record.ReplyPackets
+		shard.lru.MoveToFront(element)
 		return
 	}
 
-	c.Flows[hash] = record
+	// Only the shard of the flow is locked, so the cache makes room in it
+	if atomic.LoadInt32(&c.records) >= c.maxFlows {
+		atomic.AddUint64(&c.evicted, 1)
+
+		oldest := shard.lru.Back()
+		if oldest == nil {
+			return
+		}
+
+		shard.remove(oldest)
+		atomic.AddInt32(&c.records, -1)
+	}
+
+	shard.flows[hash] = shard.lru.PushFront(&flowEntry{hash: hash, record: record})
+
+	if n := atomic.AddInt32(&c.records, 1); c.batch > 0 && n >= c.batch {
+		select {
+		case c.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// setBatchSize sets the number of records that makes a full batch. It must be called
+// before the flows are collected.
+func (c *CollectorImpl) setBatchSize(size int) {
+
+	c.batch = int32(size)
+}
+
+// setMaxFlows sets the maximum number of records of the cache, or the default
+// maximum if it is not positive. It must be called before the flows are collected.
+func (c *CollectorImpl) setMaxFlows(max int) {
+
+	if max <= 0 {
+		max = enforcer.DefaultMaxFlows
+	}
+
+	c.maxFlows = int32(max)
+}
+
+// takeEvicted returns the number of records evicted or dropped since the previous
+// call
+func (c *CollectorImpl) takeEvicted() uint64 {
+
+	return atomic.SwapUint64(&c.evicted, 0)
+}
+
+// restoreEvicted adds back the number of records evicted of stats that were not sent
+func (c *CollectorImpl) restoreEvicted(evicted uint64) {
+
+	atomic.AddUint64(&c.evicted, evicted)
+}
+
+// CollectLatencyEvent is part of the collector.LatencyEventCollector interface. The
+// records are sent with the next stats.
+func (c *CollectorImpl) CollectLatencyEvent(record *collector.LatencyRecord) {
+
+	c.restoreLatencies([]*collector.LatencyRecord{record})
+}
+
+// takeLatencies returns the latency records collected since the previous call
+func (c *CollectorImpl) takeLatencies() []*collector.LatencyRecord {
+
+	c.latenciesLock.Lock()
+	defer c.latenciesLock.Unlock()
+
+	latencies := c.latencies
+	c.latencies = nil
+
+	return latencies
+}
+
+// restoreLatencies adds back the latency records of stats that were not sent
+func (c *CollectorImpl) restoreLatencies(latencies []*collector.LatencyRecord) {
+
+	c.latenciesLock.Lock()
+	defer c.latenciesLock.Unlock()
+
+	c.latencies = append(c.latencies, latencies...)
+	if len(c.latencies) > maxLatencyRecords {
+		c.latencies = c.latencies[len(c.latencies)-maxLatencyRecords:]
+	}
+}
+
+// CollectRuleStatsEvent is part of the collector.RuleStatsEventCollector interface.
+// The records are sent with the next stats.
+func (c *CollectorImpl) CollectRuleStatsEvent(record *collector.RuleStatsRecord) {
+
+	c.restoreRuleStats([]*collector.RuleStatsRecord{record})
+}
+
+// takeRuleStats returns the rule stats records collected since the previous call
+func (c *CollectorImpl) takeRuleStats() []*collector.RuleStatsRecord {
+
+	c.ruleStatsLock.Lock()
+	defer c.ruleStatsLock.Unlock()
+
+	ruleStats := c.ruleStats
+	c.ruleStats = nil
+
+	return ruleStats
+}
+
+// restoreRuleStats adds back the rule stats records of stats that were not sent
+func (c *CollectorImpl) restoreRuleStats(ruleStats []*collector.RuleStatsRecord) {
+
+	c.ruleStatsLock.Lock()
+	defer c.ruleStatsLock.Unlock()
+
+	c.ruleStats = append(c.ruleStats, ruleStats...)
+	if len(c.ruleStats) > maxRuleStatsRecords {
+		c.ruleStats = c.ruleStats[len(c.ruleStats)-maxRuleStatsRecords:]
+	}
 }
 
 //CollectContainerEvent exported
@@ -35,3 +249,75 @@ func (c *CollectorImpl) CollectFlowEvent(record *collector.FlowRecord) {
 func (c *CollectorImpl) CollectContainerEvent(record *collector.ContainerRecord) {
 	return
 }
+
+// drain removes at most max flow records from the cache, the least recently updated
+// first, and returns them. The remaining records are sent with the next stats. A
+// record removed from the cache is never updated again, the next events of its flow
+// create a new record.
+func (c *CollectorImpl) drain(max int) map[string]*collector.FlowRecord {
+
+	flows := map[string]*collector.FlowRecord{}
+	defer func() {
+		atomic.AddInt32(&c.records, -int32(len(flows)))
+	}()
+
+	for i := range c.shards {
+		shard := &c.shards[i]
+
+		shard.Lock()
+
+		if len(shard.flows) == 0 {
+			shard.Unlock()
+			continue
+		}
+
+		if len(flows)+len(shard.flows) <= max {
+			for hash, element := range shard.flows {
+				flows[hash] = element.Value.(*flowEntry).record
+			}
+			shard.reset()
+			shard.Unlock()
+			continue
+		}
+
+		for len(flows) < max {
+			entry := shard.remove(shard.lru.Back())
+			flows[entry.hash] = entry.record
+		}
+
+		shard.Unlock()
+
+		return flows
+	}
+
+	return flows
+}
+
+// flow returns the record of a flow hash in the cache
+func (c *CollectorImpl) flow(hash string) *collector.FlowRecord {
+
+	shard := c.shard(hash)
+
+	shard.Lock()
+	defer shard.Unlock()
+
+	if element, ok := shard.flows[hash]; ok {
+		return element.Value.(*flowEntry).record
+	}
+
+	return nil
+}
+
+// size returns the number of records in the cache
+func (c *CollectorImpl) size() int {
+
+	count := 0
+
+	for i := range c.shards {
+		c.shards[i].Lock()
+		count += len(c.shards[i].flows)
+		c.shards[i].Unlock()
+	}
+
+	return count
+}
@@ -1,17 +1,18 @@
 package remoteenforcer
 
 import (
+	"strconv"
+	"sync"
 	"testing"
 
 	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/enforcer"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
 func TestCollectFlowEvent(t *testing.T) {
 	Convey("Given a stats collector", t, func() {
-		c := &CollectorImpl{
-			Flows: map[string]*collector.FlowRecord{},
-		}
+		c := NewCollectorImpl(nil)
 
 		Convey("When I add a flow event", func() {
 			r := &collector.FlowRecord{
@@ -26,9 +27,9 @@ func TestCollectFlowEvent(t *testing.T) {
 			c.CollectFlowEvent(r)
 
 			Convey("The flow should be in the cache", func() {
-				So(len(c.Flows), ShouldEqual, 1)
-				So(c.Flows[collector.StatsFlowHash(r)], ShouldNotBeNil)
-				So(c.Flows[collector.StatsFlowHash(r)].Count, ShouldEqual, 1)
+				So(c.size(), ShouldEqual, 1)
+				So(c.flow(collector.StatsFlowHash(r)), ShouldNotBeNil)
+				So(c.flow(collector.StatsFlowHash(r)).Count, ShouldEqual, 1)
 			})
 
 			Convey("When I add a second flow that matches", func() {
@@ -43,9 +44,45 @@ func TestCollectFlowEvent(t *testing.T) {
 				}
 				c.CollectFlowEvent(r)
 				Convey("The flow should be in the cache", func() {
-					So(len(c.Flows), ShouldEqual, 1)
-					So(c.Flows[collector.StatsFlowHash(r)], ShouldNotBeNil)
-					So(c.Flows[collector.StatsFlowHash(r)].Count, ShouldEqual, 11)
+					So(c.size(), ShouldEqual, 1)
+					So(c.flow(collector.StatsFlowHash(r)), ShouldNotBeNil)
+					So(c.flow(collector.StatsFlowHash(r)).Count, ShouldEqual, 11)
+				})
+			})
+
+			Convey("When I add the traffic of the flow twice", func() {
+				for i := 0; i < 2; i++ {
+					c.CollectFlowEvent(&collector.FlowRecord{
+						ContextID:       "1",
+						SourceID:        "A",
+						DestinationID:   "B",
+						SourceIP:        "1.1.1.1",
+						DestinationIP:   "2.2.2.2",
+						DestinationPort: 80,
+						Mode:            collector.FlowVolume,
+						Bytes:           100,
+						Packets:         2,
+						ReplyBytes:      1000,
+						ReplyPackets:    3,
+					})
+				}
+
+				Convey("The traffic should be summed in its own record", func() {
+					So(c.size(), ShouldEqual, 2)
+					volume := c.flow(collector.StatsFlowHash(&collector.FlowRecord{
+						ContextID:       "1",
+						SourceID:        "A",
+						DestinationID:   "B",
+						SourceIP:        "1.1.1.1",
+						DestinationIP:   "2.2.2.2",
+						DestinationPort: 80,
+						Mode:            collector.FlowVolume,
+					}))
+					So(volume, ShouldNotBeNil)
+					So(volume.Bytes, ShouldEqual, 200)
+					So(volume.Packets, ShouldEqual, 4)
+					So(volume.ReplyBytes, ShouldEqual, 2000)
+					So(volume.ReplyPackets, ShouldEqual, 6)
 				})
 			})
 
@@ -61,11 +98,267 @@ func TestCollectFlowEvent(t *testing.T) {
 				}
 				c.CollectFlowEvent(r)
 				Convey("The flow should be in the cache", func() {
-					So(len(c.Flows), ShouldEqual, 2)
-					So(c.Flows[collector.StatsFlowHash(r)], ShouldNotBeNil)
-					So(c.Flows[collector.StatsFlowHash(r)].Count, ShouldEqual, 33)
+					So(c.size(), ShouldEqual, 2)
+					So(c.flow(collector.StatsFlowHash(r)), ShouldNotBeNil)
+					So(c.flow(collector.StatsFlowHash(r)).Count, ShouldEqual, 33)
 				})
 			})
 		})
 	})
 }
+
+func TestDrain(t *testing.T) {
+	Convey("Given a stats collector with three flows", t, func() {
+		c := NewCollectorImpl(nil)
+
+		for _, port := range []uint16{80, 443, 8080} {
+			c.CollectFlowEvent(&collector.FlowRecord{
+				ContextID:       "1",
+				SourceIP:        "1.1.1.1",
+				DestinationIP:   "2.2.2.2",
+				DestinationPort: port,
+				Count:           1,
+			})
+		}
+
+		Convey("When I drain two flows", func() {
+			flows := c.drain(2)
+
+			Convey("The remaining flow should be drained next", func() {
+				So(len(flows), ShouldEqual, 2)
+				So(c.size(), ShouldEqual, 1)
+
+				for hash := range c.drain(2) {
+					So(flows[hash], ShouldBeNil)
+				}
+				So(c.size(), ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+func TestFullBatch(t *testing.T) {
+	Convey("Given a stats collector with batches of two flows", t, func() {
+		c := NewCollectorImpl(nil)
+		c.setBatchSize(2)
+
+		collect := func(port uint16) {
+			c.CollectFlowEvent(&collector.FlowRecord{
+				ContextID:       "1",
+				SourceIP:        "1.1.1.1",
+				DestinationIP:   "2.2.2.2",
+				DestinationPort: port,
+				Count:           1,
+			})
+		}
+
+		full := func() bool {
+			select {
+			case <-c.full:
+				return true
+			default:
+				return false
+			}
+		}
+
+		Convey("The batch should be full with two different flows only", func() {
+			collect(80)
+			collect(80)
+			So(full(), ShouldBeFalse)
+
+			collect(443)
+			So(full(), ShouldBeTrue)
+
+			Convey("The batch should not be full once drained", func() {
+				c.drain(2)
+				collect(8080)
+				So(full(), ShouldBeFalse)
+			})
+		})
+	})
+}
+
+func TestMaxFlows(t *testing.T) {
+	Convey("Given a stats collector of at most ten flows", t, func() {
+		c := NewCollectorImpl(nil)
+		c.setMaxFlows(10)
+
+		flow := func(port uint16) *collector.FlowRecord {
+			return &collector.FlowRecord{
+				ContextID:       "1",
+				SourceIP:        "1.1.1.1",
+				DestinationIP:   "2.2.2.2",
+				DestinationPort: port,
+				Count:           1,
+			}
+		}
+
+		Convey("The cache should not grow past ten flows", func() {
+			for port := uint16(1); port <= 100; port++ {
+				c.CollectFlowEvent(flow(port))
+			}
+
+			So(c.size(), ShouldBeLessThanOrEqualTo, 10)
+			So(c.takeEvicted(), ShouldEqual, 90)
+			So(c.takeEvicted(), ShouldEqual, 0)
+
+			Convey("The evicted count should be restored if the stats are not sent", func() {
+				c.restoreEvicted(90)
+				So(c.takeEvicted(), ShouldEqual, 90)
+			})
+		})
+
+		Convey("The least recently updated flow of a shard should be evicted", func() {
+			c.setMaxFlows(2)
+
+			// Three flows of the same shard
+			flows := []*collector.FlowRecord{flow(1)}
+			shard := c.shard(c.key.Hash(flows[0]))
+			for port := uint16(2); len(flows) < 3; port++ {
+				if c.shard(c.key.Hash(flow(port))) == shard {
+					flows = append(flows, flow(port))
+				}
+			}
+
+			c.CollectFlowEvent(flows[0])
+			c.CollectFlowEvent(flows[1])
+			c.CollectFlowEvent(flow(flows[0].DestinationPort))
+			c.CollectFlowEvent(flows[2])
+
+			So(c.size(), ShouldEqual, 2)
+			So(c.takeEvicted(), ShouldEqual, 1)
+			So(c.flow(c.key.Hash(flows[0])).Count, ShouldEqual, 2)
+			So(c.flow(c.key.Hash(flows[1])), ShouldBeNil)
+			So(c.flow(c.key.Hash(flows[2])), ShouldNotBeNil)
+		})
+
+		Convey("The default maximum should be used if the maximum is not positive", func() {
+			c.setMaxFlows(0)
+			So(c.maxFlows, ShouldEqual, enforcer.DefaultMaxFlows)
+		})
+	})
+}
+
+func TestConcurrentCollectFlowEvent(t *testing.T) {
+	Convey("Given a stats collector drained while flows are collected concurrently", t, func() {
+		c := NewCollectorImpl(nil)
+
+		collected := 0
+		drained := make(chan int)
+		stop := make(chan struct{})
+
+		go func() {
+			count := 0
+			for {
+				select {
+				case <-stop:
+					drained <- count
+					return
+				default:
+					for _, record := range c.drain(10) {
+						count += record.Count
+					}
+				}
+			}
+		}()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 1000; j++ {
+					c.CollectFlowEvent(&collector.FlowRecord{
+						ContextID:       "1",
+						SourceID:        "src" + strconv.Itoa(j%50),
+						DestinationPort: 80,
+						Count:           1,
+					})
+				}
+			}()
+		}
+		wg.Wait()
+		close(stop)
+		collected = <-drained
+
+		Convey("No event should be lost", func() {
+			for _, record := range c.drain(1000) {
+				collected += record.Count
+			}
+			So(collected, ShouldEqual, 8000)
+		})
+	})
+}
+
+func benchmarkFlows() []*collector.FlowRecord {
+
+	records := make([]*collector.FlowRecord, 256)
+	for i := range records {
+		records[i] = &collector.FlowRecord{
+			ContextID:       "1",
+			SourceID:        "src" + strconv.Itoa(i),
+			DestinationID:   "dst",
+			DestinationPort: 80,
+			Count:           1,
+		}
+	}
+
+	return records
+}
+
+func BenchmarkCollectFlowEvent(b *testing.B) {
+
+	c := NewCollectorImpl(nil)
+	records := benchmarkFlows()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := *records[i%len(records)]
+		c.CollectFlowEvent(&r)
+	}
+}
+
+func BenchmarkCollectFlowEventParallel(b *testing.B) {
+
+	c := NewCollectorImpl(nil)
+	records := benchmarkFlows()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			r := *records[i%len(records)]
+			c.CollectFlowEvent(&r)
+			i++
+		}
+	})
+}
+
+func BenchmarkCollectFlowEventParallelWithDrain(b *testing.B) {
+
+	c := NewCollectorImpl(nil)
+	records := benchmarkFlows()
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				c.drain(1000)
+			}
+		}
+	}()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			r := *records[i%len(records)]
+			c.CollectFlowEvent(&r)
+			i++
+		}
+	})
+}
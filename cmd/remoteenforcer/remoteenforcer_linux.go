@@ -8,6 +8,9 @@ import (
 	"fmt"
 	"os"
 	"os/user"
+	"path/filepath"
+	"reflect"
+	"sync"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
@@ -19,6 +22,7 @@ import (
 	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
 	"github.com/aporeto-inc/trireme/policy"
 	"github.com/aporeto-inc/trireme/supervisor"
+	"github.com/aporeto-inc/trireme/utils/errortypes"
 )
 
 const (
@@ -48,6 +52,17 @@ type Server struct {
 	rpcchannel  string
 	rpchdl      *rpcwrapper.RPCWrapper
 	Excluder    supervisor.Excluder
+	flows       *flowStore
+	stats       *StatsClient
+	// federation trusts the federated deployments with the PKI secrets, if any
+	federation tokens.FederatedSecrets
+	// mtls are the settings of the mutual TLS data-plane mode applied to the enforcer
+	mtls *rpcwrapper.MTLSPayload
+	// enforced is the last PU enforced and dropped is set while its enforcement is
+	// removed because the controller is lost
+	enforced *policy.PUInfo
+	dropped  bool
+	lock     sync.Mutex
 }
 
 // NewServer starts a new server
@@ -63,6 +78,10 @@ func NewServer(service enforcer.PacketProcessor, rpcchan string, secret string)
 // InitEnforcer is a function called from the controller using RPC. It intializes data structure required by the
 // remote enforcer
 func (s *Server) InitEnforcer(req rpcwrapper.Request, resp *rpcwrapper.Response) error {
+
+	_, span := rpcwrapper.StartServerSpan(&req, "remoteenforcer.InitEnforcer")
+	defer span.End()
+
 	//Check if sucessfully switched namespace
 	nsEnterState := os.Getenv("NSENTER_ERROR_STATE")
 	if len(nsEnterState) != 0 {
@@ -70,22 +89,47 @@ func (s *Server) InitEnforcer(req rpcwrapper.Request, resp *rpcwrapper.Response)
 		return errors.New(resp.Status)
 	}
 
+	if os.Getenv(envContainerUserns) != "" {
+		if err := checkUserNamespaceCapabilities(); err != nil {
+			resp.Status = err.Error()
+			return err
+		}
+	}
+
 	if !s.rpchdl.CheckValidity(&req, s.rpcSecret) {
 		resp.Status = ("Message Auth Failed")
 		return errors.New(resp.Status)
 	}
 
-	collectorInstance := &CollectorImpl{
-		Flows: map[string]*collector.FlowRecord{},
+	payload := req.Payload.(rpcwrapper.InitRequestPayload)
+
+	var flowKey *collector.FlowKey
+	if len(payload.FlowKey) > 0 {
+		flowKey = collector.NewFlowKey(payload.FlowKey...)
 	}
 
-	s.Collector = collectorInstance
+	collectorInstance := NewCollectorImpl(flowKey)
 
-	payload := req.Payload.(rpcwrapper.InitRequestPayload)
+	interval, maxRecords := newStatsBatch(payload.StatsBatch)
+	collectorInstance.setBatchSize(maxRecords)
+	collectorInstance.setMaxFlows(payload.StatsBatch.MaxFlows)
+
+	s.Collector = collectorInstance
 
 	if payload.SecretType == tokens.PKIType {
 		//PKI params
 		secrets := tokens.NewPKISecrets(payload.PrivatePEM, payload.PublicPEM, payload.CAPEM, map[string]*ecdsa.PublicKey{})
+		if secrets == nil {
+			resp.Status = "Invalid PKI secrets"
+			return errors.New(resp.Status)
+		}
+
+		if err := tokens.SetFederations(secrets, payload.Federations); err != nil {
+			resp.Status = err.Error()
+			return err
+		}
+		s.federation = secrets
+
 		s.Enforcer = enforcer.NewDatapathEnforcer(
 			payload.MutualAuth,
 			payload.FqConfig,
@@ -109,10 +153,59 @@ func (s *Server) InitEnforcer(req rpcwrapper.Request, resp *rpcwrapper.Response)
 			constants.RemoteContainer)
 	}
 
+	if volumes, ok := s.Enforcer.(enforcer.FlowVolumeConfigurer); ok {
+		volumes.SetFlowVolumes(payload.FlowVolumes)
+	}
+
+	if latencies, ok := s.Enforcer.(enforcer.LatencyConfigurer); ok {
+		latencies.SetHandshakeLatencies(payload.Latencies)
+	}
+
+	if ruleStats, ok := s.Enforcer.(enforcer.RuleStatsConfigurer); ok {
+		ruleStats.SetRuleStats(payload.RuleStats)
+	}
+
+	if err := applyDatapath(s.Enforcer, &payload.Datapath); err != nil {
+		resp.Status = err.Error()
+		return err
+	}
+
+	if err := s.applyMTLS(payload.Datapath.MTLS); err != nil {
+		resp.Status = err.Error()
+		return err
+	}
+
 	s.Enforcer.Start()
 
-	statsClient := &StatsClient{collector: collectorInstance, server: s, Rpchdl: rpcwrapper.NewRPCWrapper()}
+	if exporter, ok := s.Enforcer.(enforcer.FlowStateExporter); ok {
+		if s.flows = newFlowStore(s.rpcchannel); s.flows != nil {
+			s.flows.load()
+			go s.flows.run(exporter)
+		}
+	}
+
+	timeout := payload.ControllerLoss.Timeout
+	if timeout == 0 {
+		timeout = enforcer.DefaultControllerTimeout
+	}
+
+	statsClient := &StatsClient{
+		collector: collectorInstance,
+		server:    s,
+		Rpchdl:    rpcwrapper.NewRPCWrapper(rpcwrapper.WithTransport(rpcwrapper.TransportFromEnv())),
+		contextID: s.enforcedContext,
+		timeout:   timeout,
+		lost: func() {
+			s.controllerLost(payload.ControllerLoss.Action)
+		},
+		recovered:  s.controllerRecovered,
+		flushes:    make(chan chan error),
+		interval:   interval,
+		maxRecords: maxRecords,
+		backoff:    1,
+	}
 
+	s.stats = statsClient
 	s.connectStatsClient(statsClient)
 
 	resp.Status = ""
@@ -148,7 +241,20 @@ func (s *Server) InitSupervisor(req rpcwrapper.Request, resp *rpcwrapper.Respons
 			if err != nil {
 				resp.Status = err.Error()
 			}
-			return err
+			return rpcwrapper.ServerError(err)
+		}
+		supervisorHandle.SetPreExistingFlows(payload.PreExistingFlows)
+		if payload.IPv6 {
+			if err := supervisorHandle.EnableIPv6(); err != nil {
+				resp.Status = err.Error()
+				return rpcwrapper.ServerError(err)
+			}
+		}
+		if payload.MTLSRedirect != nil {
+			if err := supervisorHandle.SetMTLSRedirect(payload.MTLSRedirect.Networks, payload.MTLSRedirect.ClientPort, payload.MTLSRedirect.ServerPort); err != nil {
+				resp.Status = err.Error()
+				return rpcwrapper.ServerError(err)
+			}
 		}
 		s.Excluder = supervisorHandle
 		s.Supervisor = supervisorHandle
@@ -164,6 +270,9 @@ func (s *Server) InitSupervisor(req rpcwrapper.Request, resp *rpcwrapper.Respons
 //Supervise This method calls the supervisor method on the supervisor created during initsupervisor
 func (s *Server) Supervise(req rpcwrapper.Request, resp *rpcwrapper.Response) error {
 
+	_, span := rpcwrapper.StartServerSpan(&req, "remoteenforcer.Supervise")
+	defer span.End()
+
 	if !s.rpchdl.CheckValidity(&req, s.rpcSecret) {
 		resp.Status = ("Message Auth Failed")
 		return errors.New(resp.Status)
@@ -182,6 +291,11 @@ func (s *Server) Supervise(req rpcwrapper.Request, resp *rpcwrapper.Response) er
 		payload.TriremeNetworks,
 		nil)
 
+	pupolicy.UpdateTrustedNetworks(payload.TrustedNetworks)
+	pupolicy.UpdateDNSPolicy(payload.DNSPolicy)
+	pupolicy.UpdateMirrorPolicy(payload.MirrorPolicy)
+	pupolicy.UpdateFeatures(payload.Features)
+
 	runtime := policy.NewPURuntimeWithDefaults()
 
 	puInfo := policy.PUInfoFromPolicyAndRuntime(payload.ContextID, pupolicy, runtime)
@@ -206,41 +320,197 @@ func (s *Server) Supervise(req rpcwrapper.Request, resp *rpcwrapper.Response) er
 	}
 
 	//We are good here now add the Excluded ip list as well
-	return s.Excluder.AddExcludedIPs(payload.ExcludedIPs)
+	return rpcwrapper.ServerError(s.Excluder.AddExcludedIPs(payload.ExcludedIPs))
 
 }
 
 //Unenforce this method calls the unenforce method on the enforcer created from initenforcer
 func (s *Server) Unenforce(req rpcwrapper.Request, resp *rpcwrapper.Response) error {
 
+	_, span := rpcwrapper.StartServerSpan(&req, "remoteenforcer.Unenforce")
+	defer span.End()
+
 	if !s.rpchdl.CheckValidity(&req, s.rpcSecret) {
 		resp.Status = ("Message Auth Failed")
 		return errors.New(resp.Status)
 	}
 	payload := req.Payload.(rpcwrapper.UnEnforcePayload)
-	return s.Enforcer.Unenforce(payload.ContextID)
+
+	s.lock.Lock()
+	if s.enforced != nil && s.enforced.ContextID == payload.ContextID {
+		s.enforced = nil
+	}
+	s.lock.Unlock()
+
+	return rpcwrapper.ServerError(s.Enforcer.Unenforce(payload.ContextID))
+}
+
+// FlushStats sends the flows collected by the enforcer to the controller immediately.
+// The controller calls it before it destroys the PU, so that the last flows of a short
+// lived PU are not lost with the enforcer.
+func (s *Server) FlushStats(req rpcwrapper.Request, resp *rpcwrapper.Response) error {
+
+	if !s.rpchdl.CheckValidity(&req, s.rpcSecret) {
+		resp.Status = ("Message Auth Failed")
+		return errors.New(resp.Status)
+	}
+
+	if s.stats == nil {
+		resp.Status = "Enforcer not initialized"
+		return errors.New(resp.Status)
+	}
+
+	if err := s.stats.Flush(); err != nil {
+		resp.Status = err.Error()
+		return err
+	}
+
+	return nil
+}
+
+// HealthCheck is called periodically by the controller. It responds with the context
+// enforced and the PID of the enforcer once the enforcer is initialized. The enforcer
+// lock is taken, so a deadlocked enforcer does not respond.
+func (s *Server) HealthCheck(req rpcwrapper.Request, resp *rpcwrapper.Response) error {
+
+	if !s.rpchdl.CheckValidity(&req, s.rpcSecret) {
+		resp.Status = ("Message Auth Failed")
+		return errors.New(resp.Status)
+	}
+
+	if s.Enforcer == nil {
+		resp.Status = "Enforcer not initialized"
+		return errors.New(resp.Status)
+	}
+
+	resp.Payload = rpcwrapper.HealthCheckResponsePayload{
+		ContextID: s.enforcedContext(),
+		Pid:       os.Getpid(),
+	}
+
+	return nil
 }
 
 //Unsupervise This method calls the unsupervise method on the supervisor created during initsupervisor
 func (s *Server) Unsupervise(req rpcwrapper.Request, resp *rpcwrapper.Response) error {
 
+	_, span := rpcwrapper.StartServerSpan(&req, "remoteenforcer.Unsupervise")
+	defer span.End()
+
 	if !s.rpchdl.CheckValidity(&req, s.rpcSecret) {
 		resp.Status = ("Message Auth Failed")
 		return errors.New(resp.Status)
 	}
 	payload := req.Payload.(rpcwrapper.UnSupervisePayload)
-	return s.Supervisor.Unsupervise(payload.ContextID)
+	return rpcwrapper.ServerError(s.Supervisor.Unsupervise(payload.ContextID))
 }
 
 //Enforce this method calls the enforce method on the enforcer created during initenforcer
 func (s *Server) Enforce(req rpcwrapper.Request, resp *rpcwrapper.Response) error {
 
+	_, span := rpcwrapper.StartServerSpan(&req, "remoteenforcer.Enforce")
+	defer span.End()
+
 	if !s.rpchdl.CheckValidity(&req, s.rpcSecret) {
 		resp.Status = ("Message Auth Failed")
 		return errors.New(resp.Status)
 	}
 	payload := req.Payload.(rpcwrapper.EnforcePayload)
 
+	puInfo := enforcePUInfo(&payload)
+	if puInfo == nil {
+		log.WithFields(log.Fields{
+			"package": "remote_enforcer",
+		}).Info("Failed Runtime")
+		return fmt.Errorf("Unable to instantiate puInfo")
+	}
+	err := s.Enforcer.Enforce(payload.ContextID, puInfo)
+	log.WithFields(log.Fields{"package": "remote_enforcer",
+		"method": "Enforce",
+		"error":  err,
+	}).Info("ENFORCE STATUS")
+	if err != nil {
+		resp.Status = err.Error()
+		return rpcwrapper.ServerError(err)
+	}
+
+	if s.flows != nil {
+		s.flows.restore(payload.ContextID, s.Enforcer.(enforcer.FlowStateExporter))
+	}
+
+	s.lock.Lock()
+	s.enforced = puInfo
+	s.dropped = false
+	s.lock.Unlock()
+
+	return nil
+}
+
+// EnforceAndSupervise applies the policy of the PU to the enforcer and the supervisor.
+// If either fails, both are returned to the policy last applied. The failure is
+// reported in the status of the response so that the controller knows whether the
+// previous policy was restored.
+func (s *Server) EnforceAndSupervise(req rpcwrapper.Request, resp *rpcwrapper.Response) error {
+
+	_, span := rpcwrapper.StartServerSpan(&req, "remoteenforcer.EnforceAndSupervise")
+	defer span.End()
+
+	if !s.rpchdl.CheckValidity(&req, s.rpcSecret) {
+		resp.Status = ("Message Auth Failed")
+		return errors.New(resp.Status)
+	}
+	payload := req.Payload.(rpcwrapper.EnforceAndSupervisePayload)
+
+	puInfo := enforcePUInfo(&payload.EnforcePayload)
+	if puInfo == nil {
+		return fmt.Errorf("Unable to instantiate puInfo")
+	}
+
+	// TODO - Set PID to 1 - needed only for statistics
+	puInfo.Runtime.SetPid(1)
+
+	s.lock.Lock()
+	previous := s.enforced
+	s.lock.Unlock()
+
+	if previous != nil && previous.ContextID != payload.ContextID {
+		previous = nil
+	}
+
+	if err := supervisor.ApplyTransaction(s.Enforcer, s.Supervisor, payload.ContextID, puInfo, previous); err != nil {
+		log.WithFields(log.Fields{
+			"package": "remote_enforcer",
+			"method":  "EnforceAndSupervise",
+			"error":   err.Error(),
+		}).Error("Failed to apply the policy")
+
+		// The status carries the error of the component with its category
+		resp.Status = err.Error()
+		if terr, ok := err.(*supervisor.TransactionError); ok {
+			resp.Status = errortypes.Encode(terr.Err)
+			resp.Payload = rpcwrapper.TransactionResponsePayload{
+				Component:  terr.Component,
+				RolledBack: terr.RolledBack,
+			}
+		}
+		return nil
+	}
+
+	if s.flows != nil {
+		s.flows.restore(payload.ContextID, s.Enforcer.(enforcer.FlowStateExporter))
+	}
+
+	s.lock.Lock()
+	s.enforced = puInfo
+	s.dropped = false
+	s.lock.Unlock()
+
+	return s.Excluder.AddExcludedIPs(payload.ExcludedIPs)
+}
+
+// enforcePUInfo returns the PU of an enforce payload
+func enforcePUInfo(payload *rpcwrapper.EnforcePayload) *policy.PUInfo {
+
 	pupolicy := policy.NewPUPolicy(payload.ManagementID,
 		payload.TriremeAction,
 		payload.ApplicationACLs,
@@ -253,29 +523,92 @@ func (s *Server) Enforce(req rpcwrapper.Request, resp *rpcwrapper.Response) erro
 		payload.TriremeNetworks,
 		nil)
 
+	pupolicy.UpdateTrustedNetworks(payload.TrustedNetworks)
+	pupolicy.UpdateDNSPolicy(payload.DNSPolicy)
+	pupolicy.UpdateMirrorPolicy(payload.MirrorPolicy)
+	pupolicy.UpdateIssuerRules(payload.IssuerRules)
+	pupolicy.UpdateResetRejected(payload.ResetRejected)
+	pupolicy.UpdateFeatures(payload.Features)
+
 	runtime := policy.NewPURuntimeWithDefaults()
-	puInfo := policy.PUInfoFromPolicyAndRuntime(payload.ContextID, pupolicy, runtime)
-	if puInfo == nil {
+
+	return policy.PUInfoFromPolicyAndRuntime(payload.ContextID, pupolicy, runtime)
+}
+
+// enforcedContext returns the context of the PU enforced, or an empty string before
+// the first Enforce
+func (s *Server) enforcedContext() string {
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.enforced == nil {
+		return ""
+	}
+
+	return s.enforced.ContextID
+}
+
+// controllerLost applies the controller loss action to the enforced PU
+func (s *Server) controllerLost(action enforcer.ControllerLossAction) {
+
+	if action != enforcer.ControllerLossDrop {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.enforced == nil || s.dropped {
+		return
+	}
+
+	if err := s.Enforcer.Unenforce(s.enforced.ContextID); err != nil {
 		log.WithFields(log.Fields{
 			"package": "remote_enforcer",
-		}).Info("Failed Runtime")
-		return fmt.Errorf("Unable to instantiate puInfo")
+			"error":   err.Error(),
+		}).Error("Failed to drop the traffic after the controller loss")
+		return
 	}
-	err := s.Enforcer.Enforce(payload.ContextID, puInfo)
-	log.WithFields(log.Fields{"package": "remote_enforcer",
-		"method": "Enforce",
-		"error":  err,
-	}).Info("ENFORCE STATUS")
-	if err != nil {
-		resp.Status = err.Error()
+
+	s.dropped = true
+}
+
+// controllerRecovered enforces the last policy again if it was removed when the
+// controller was lost
+func (s *Server) controllerRecovered() {
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.enforced == nil || !s.dropped {
+		return
+	}
+
+	if err := s.Enforcer.Enforce(s.enforced.ContextID, s.enforced); err != nil {
+		log.WithFields(log.Fields{
+			"package": "remote_enforcer",
+			"error":   err.Error(),
+		}).Error("Failed to enforce the policy after the controller recovered")
+		return
 	}
-	return err
+
+	s.dropped = false
 }
 
 //EnforcerExit this method is called when  we received a killrpocess message from the controller
 //THis allows a graceful exit of the enforcer
 func (s *Server) EnforcerExit(req rpcwrapper.Request, resp *rpcwrapper.Response) error {
 
+	if s.flows != nil {
+		if err := s.flows.save(s.Enforcer.(enforcer.FlowStateExporter)); err != nil {
+			log.WithFields(log.Fields{
+				"package": "remote_enforcer",
+				"error":   err.Error(),
+			}).Warn("Failed to save flow state")
+		}
+	}
+
 	//Cleanup resources held in this namespace
 	s.Supervisor.Stop()
 	s.Enforcer.Stop()
@@ -283,13 +616,193 @@ func (s *Server) EnforcerExit(req rpcwrapper.Request, resp *rpcwrapper.Response)
 	return nil
 }
 
+// UpdateFederations replaces the federated deployments trusted by the secrets of the
+// enforcer
+func (s *Server) UpdateFederations(req rpcwrapper.Request, resp *rpcwrapper.Response) error {
+
+	if !s.rpchdl.CheckValidity(&req, s.rpcSecret) {
+		resp.Status = ("Message Auth Failed")
+		return errors.New(resp.Status)
+	}
+
+	if s.federation == nil {
+		resp.Status = "Enforcer has no PKI secrets"
+		return errors.New(resp.Status)
+	}
+
+	payload := req.Payload.(rpcwrapper.FederationsPayload)
+	if err := tokens.SetFederations(s.federation, payload.Federations); err != nil {
+		resp.Status = err.Error()
+		return err
+	}
+
+	return nil
+}
+
+// UpdateSecrets rotates the keys and the authorities of the secrets of the enforcer
+func (s *Server) UpdateSecrets(req rpcwrapper.Request, resp *rpcwrapper.Response) error {
+
+	if !s.rpchdl.CheckValidity(&req, s.rpcSecret) {
+		resp.Status = ("Message Auth Failed")
+		return errors.New(resp.Status)
+	}
+
+	updater, ok := s.Enforcer.(enforcer.SecretsUpdater)
+	if !ok {
+		resp.Status = "Enforcer does not support the rotation of the secrets"
+		return errors.New(resp.Status)
+	}
+
+	payload := req.Payload.(rpcwrapper.UpdateSecretsPayload)
+
+	var secrets tokens.Secrets
+	switch payload.SecretType {
+	case tokens.PKIType:
+		pki := tokens.NewPKISecrets(payload.PrivatePEM, payload.PublicPEM, payload.CAPEM, map[string]*ecdsa.PublicKey{})
+		if pki == nil {
+			resp.Status = "Invalid PKI secrets"
+			return errors.New(resp.Status)
+		}
+		secrets = pki
+	case tokens.PSKType:
+		secrets = tokens.NewPSKSecrets(payload.PrivatePEM)
+	default:
+		resp.Status = "Invalid secrets type"
+		return errors.New(resp.Status)
+	}
+
+	if err := updater.UpdateSecrets(secrets); err != nil {
+		resp.Status = err.Error()
+		return err
+	}
+
+	return nil
+}
+
+// UpdateDatapath replaces the settings of the datapath of the enforcer
+func (s *Server) UpdateDatapath(req rpcwrapper.Request, resp *rpcwrapper.Response) error {
+
+	if !s.rpchdl.CheckValidity(&req, s.rpcSecret) {
+		resp.Status = ("Message Auth Failed")
+		return errors.New(resp.Status)
+	}
+
+	if s.Enforcer == nil {
+		resp.Status = "Enforcer not initialized"
+		return errors.New(resp.Status)
+	}
+
+	payload := req.Payload.(rpcwrapper.DatapathSettingsPayload)
+	if err := applyDatapath(s.Enforcer, &payload); err != nil {
+		resp.Status = err.Error()
+		return err
+	}
+
+	if err := s.applyMTLS(payload.MTLS); err != nil {
+		resp.Status = err.Error()
+		return err
+	}
+
+	return nil
+}
+
+// applyMTLS enables the mutual TLS data-plane mode of the enforcer with its PKI
+// secrets, or disables it if the settings are nil. The listeners are only restarted
+// when the settings change.
+func (s *Server) applyMTLS(settings *rpcwrapper.MTLSPayload) error {
+
+	if reflect.DeepEqual(settings, s.mtls) {
+		return nil
+	}
+
+	configurer, ok := s.Enforcer.(enforcer.MTLSConfigurer)
+	if !ok {
+		return fmt.Errorf("Enforcer does not support mutual TLS")
+	}
+
+	if settings == nil {
+		configurer.DisableMTLS()
+		s.mtls = nil
+		return nil
+	}
+
+	secrets, ok := s.federation.(*tokens.PKISecrets)
+	if !ok {
+		return fmt.Errorf("Mutual TLS requires PKI secrets")
+	}
+
+	if err := configurer.EnableMTLS(&enforcer.MTLSConfig{
+		Networks:   settings.Networks,
+		ClientPort: settings.ClientPort,
+		ServerPort: settings.ServerPort,
+		Secrets:    secrets,
+	}); err != nil {
+		return err
+	}
+
+	s.mtls = settings
+
+	return nil
+}
+
+// applyDatapath applies the settings of the datapath to the enforcer. The external
+// endpoints missing from the settings are unregistered.
+func applyDatapath(e enforcer.PolicyEnforcer, settings *rpcwrapper.DatapathSettingsPayload) error {
+
+	intraHost, ok := e.(enforcer.IntraHostConfigurer)
+	if !ok {
+		return fmt.Errorf("Enforcer does not support the intra-host modes")
+	}
+
+	interop, ok := e.(enforcer.InteropConfigurer)
+	if !ok {
+		return fmt.Errorf("Enforcer does not support the interop policies")
+	}
+
+	registry, ok := e.(enforcer.ExternalEndpointRegistry)
+	if !ok {
+		return fmt.Errorf("Enforcer does not support the external endpoints")
+	}
+
+	budget, ok := e.(enforcer.TagBudgetConfigurer)
+	if !ok {
+		return fmt.Errorf("Enforcer does not support the tag budgets")
+	}
+
+	if err := intraHost.SetIntraHostMode(settings.IntraHostMode); err != nil {
+		return err
+	}
+
+	if err := interop.SetInteropPolicies(settings.InteropPolicies); err != nil {
+		return err
+	}
+
+	registered := map[string]bool{}
+	for _, endpoint := range settings.ExternalEndpoints {
+		if err := registry.RegisterExternalEndpoint(endpoint); err != nil {
+			return err
+		}
+		registered[endpoint.Name] = true
+	}
+
+	for _, endpoint := range registry.ExternalEndpoints() {
+		if !registered[endpoint.Name] {
+			if err := registry.UnregisterExternalEndpoint(endpoint.Name); err != nil {
+				return err
+			}
+		}
+	}
+
+	return budget.SetTagBudget(settings.TagBudget)
+}
+
 func (s *Server) AddExcludedIPs(req rpcwrapper.Request, resp *rpcwrapper.Response) error {
 	if !s.rpchdl.CheckValidity(&req, s.rpcSecret) {
 		resp.Status = ("Message Auth Failed")
 		return errors.New(resp.Status)
 	}
 	payload := req.Payload.(rpcwrapper.ExcludeIPRequestPayload)
-	return s.Excluder.AddExcludedIPs(payload.IPs)
+	return rpcwrapper.ServerError(s.Excluder.AddExcludedIPs(payload.IPs))
 
 }
 
@@ -310,9 +823,18 @@ func LaunchRemoteEnforcer(service enforcer.PacketProcessor, logLevel log.Level)
 		os.Exit(-1)
 	}
 
+	// The root filesystem may be read-only. The sockets are only created in the
+	// runtime directory, which must be writable.
+	if err := rpcwrapper.CheckRuntimeDir(filepath.Dir(namedPipe)); err != nil {
+		log.WithFields(log.Fields{"package": "remote_enforcer",
+			"error": err.Error(),
+		}).Error("Cannot create the socket of the enforcer. Set " + rpcwrapper.EnvRuntimeDir + " to a tmpfs directory")
+		os.Exit(-1)
+	}
+
 	server := NewServer(service, namedPipe, secret)
 
-	rpchdl := rpcwrapper.NewRPCServer()
+	rpchdl := rpcwrapper.NewRPCServer(rpcwrapper.WithTransport(rpcwrapper.TransportFromEnv()))
 
 	userDetails, _ := user.Current()
 	log.WithFields(log.Fields{"package": "remote_enforcer",
@@ -321,7 +843,11 @@ func LaunchRemoteEnforcer(service enforcer.PacketProcessor, logLevel log.Level)
 		"username": userDetails.Username,
 	}).Info("Enforcer user id")
 
-	rpchdl.StartServer("unix", namedPipe, server)
+	if err := rpchdl.StartServer("unix", namedPipe, server); err != nil {
+		log.WithFields(log.Fields{"package": "remote_enforcer",
+			"error": err.Error(),
+		}).Error("Failed to start the server of the enforcer")
+	}
 
 	server.EnforcerExit(rpcwrapper.Request{}, nil)
 
@@ -1,23 +1,27 @@
 package remoteenforcer
 
 import (
+	"fmt"
 	"os"
 	"strconv"
 	"time"
 
 	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/enforcer"
 	"github.com/aporeto-inc/trireme/enforcer/utils/rpcwrapper"
 
 	log "github.com/Sirupsen/logrus"
 )
 
 const (
-	defaultStatsIntervalMiliseconds = 250
-	envStatsChannelPath             = "STATSCHANNEL_PATH"
-	envSocketPath                   = "SOCKET_PATH"
-	envSecret                       = "SECRET"
-	envStatsSecret                  = "STATS_SECRET"
-	statsContextID                  = "UNUSED"
+	envStatsChannelPath = "STATSCHANNEL_PATH"
+	envSocketPath       = "SOCKET_PATH"
+	envSecret           = "SECRET"
+	envStatsSecret      = "STATS_SECRET"
+	statsContextID      = "UNUSED"
+	// maxStatsBackoff is the maximum factor of the stats interval while the
+	// controller is slow
+	maxStatsBackoff = 8
 )
 
 //StatsClient  This is the struct for storing state for the rpc client
@@ -26,73 +30,359 @@ type StatsClient struct {
 	collector *CollectorImpl
 	server    *Server
 	Rpchdl    *rpcwrapper.RPCWrapper
+
+	channel string
+	secret  string
+
+	// contextID returns the context of the enforcer, or an empty string until it
+	// is known
+	contextID func() string
+	// timeout is the time without contact with the controller after which lost is
+	// called. A negative timeout disables it.
+	timeout time.Duration
+	// lost and recovered are called when the controller is lost and when the
+	// enforcer registers again
+	lost      func()
+	recovered func()
+
+	registered  bool
+	isLost      bool
+	lastContact time.Time
+
+	// flushes receives the flush requests, with the channel of their result
+	flushes chan chan error
+	// sequence is the sequence number of the last stats delivered and delivered the
+	// number of records delivered so far
+	sequence  uint64
+	delivered uint64
+
+	// interval is the stats interval and maxRecords the maximum size of a batch.
+	// backoff multiplies the interval while the controller is slow.
+	interval   time.Duration
+	maxRecords int
+	backoff    int
 }
 
-//SendStats  async function which makes a rpc call to send stats every STATS_INTERVAL
-func (s *StatsClient) SendStats() {
+// newStatsBatch returns the interval and the size of the batches of the stats. The
+// STATS_INTERVAL environment variable, in seconds, sets the interval unless the
+// controller configured it.
+func newStatsBatch(config enforcer.StatsBatchConfig) (time.Duration, int) {
+
+	interval := config.Interval
+	if interval <= 0 {
+		interval = enforcer.DefaultStatsInterval
+		if seconds, err := strconv.Atoi(os.Getenv("STATS_INTERVAL")); err == nil && seconds > 0 {
+			interval = time.Duration(seconds) * time.Second
+		}
+	}
+
+	maxRecords := config.MaxRecords
+	if maxRecords <= 0 || maxRecords > rpcwrapper.MaxStatsRecords {
+		maxRecords = rpcwrapper.MaxStatsRecords
+	}
+
+	return interval, maxRecords
+}
+
+// batchSize returns the maximum number of records of a batch
+func (s *StatsClient) batchSize() int {
 
-	EnvstatsInterval, err := strconv.Atoi(os.Getenv("STATS_INTERVAL"))
+	if s.maxRecords <= 0 {
+		return rpcwrapper.MaxStatsRecords
+	}
+
+	return s.maxRecords
+}
+
+// currentInterval returns the stats interval with the backoff of the controller
+func (s *StatsClient) currentInterval() time.Duration {
+
+	interval := s.interval
+	if interval <= 0 {
+		interval = enforcer.DefaultStatsInterval
+	}
+
+	if s.backoff > 1 {
+		return interval * time.Duration(s.backoff)
+	}
+
+	return interval
+}
+
+// adjustBackoff applies the backpressure of the controller. The interval doubles
+// when a batch fails or takes more than half the stats interval to be accepted, and
+// halves again once the controller accepts them quickly.
+func (s *StatsClient) adjustBackoff(elapsed time.Duration, err error) {
 
-	statsInterval := defaultStatsIntervalMiliseconds * time.Millisecond
-	if err == nil && EnvstatsInterval != 0 {
-		statsInterval = time.Duration(EnvstatsInterval) * time.Second
+	if s.backoff < 1 {
+		s.backoff = 1
 	}
 
-	ticker := time.NewTicker(statsInterval)
+	interval := s.interval
+	if interval <= 0 {
+		interval = enforcer.DefaultStatsInterval
+	}
+
+	switch {
+	case err != nil || elapsed > interval/2:
+		if s.backoff < maxStatsBackoff {
+			s.backoff *= 2
+
+			log.WithFields(log.Fields{
+				"package":  "remoteEnforcer",
+				"elapsed":  elapsed,
+				"interval": s.currentInterval(),
+			}).Debug("Controller slow, increasing the stats interval")
+		}
+
+	case elapsed < interval/4 && s.backoff > 1:
+		s.backoff /= 2
+	}
+}
+
+//SendStats  async function which makes a rpc call to send stats every stats interval,
+//or as soon as a batch is full unless the controller is slow
+func (s *StatsClient) SendStats() {
+
+	timer := time.NewTimer(s.currentInterval())
 
 	for {
+		full := s.collector.full
+		if s.backoff > 1 {
+			full = nil
+		}
+
 		select {
-		case <-ticker.C:
-
-			s.collector.Lock()
-			collected := s.collector.Flows
-			s.collector.Flows = map[string]*collector.FlowRecord{}
-			s.collector.Unlock()
-
-			if len(collected) == 0 {
-				continue
-			}
-
-			rpcPayload := &rpcwrapper.StatsPayload{
-				Flows: collected,
-			}
-
-			request := rpcwrapper.Request{
-				Payload: rpcPayload,
-			}
-
-			err := s.Rpchdl.RemoteCall(
-				statsContextID,
-				"StatsServer.GetStats",
-				&request,
-				&rpcwrapper.Response{},
-			)
-
-			if err != nil {
-				log.WithFields(log.Fields{
-					"package": "remoteEnforcer",
-					"Msg":     "Unable to send flows",
-				}).Error("RPC failure in sending statistics")
-			}
+		case <-timer.C:
+			s.sendStats(time.Now())
+			timer.Reset(s.currentInterval())
+			continue
+		case <-full:
+			s.sendStats(time.Now())
+		case done := <-s.flushes:
+			done <- s.flushStats(time.Now())
+		}
+
+		if !timer.Stop() {
+			<-timer.C
+		}
+		timer.Reset(s.currentInterval())
+	}
+
+}
+
+// sendStats sends the collected flows to the controller. The client reconnects and
+// registers again when the controller cannot be reached.
+func (s *StatsClient) sendStats(now time.Time) {
+
+	if !s.registered {
+		if err := s.connect(now); err != nil {
+			log.WithFields(log.Fields{
+				"package": "remoteEnforcer",
+				"error":   err.Error(),
+			}).Debug("Unable to register with the controller")
+		}
+	} else if s.timeout > 0 && now.Sub(s.lastContact) >= s.timeout/3 {
+		// Heartbeat, so that the enforcer of a quiet PU does not consider the
+		// controller lost
+		s.register(now)
+	}
+
+	s.checkController(now)
+
+	if !s.registered {
+		return
+	}
+
+	collected := s.collector.drain(s.batchSize())
+	evicted := s.collector.takeEvicted()
+	latencies := s.collector.takeLatencies()
+	ruleStats := s.collector.takeRuleStats()
+	if len(collected) == 0 && evicted == 0 && len(latencies) == 0 && len(ruleStats) == 0 {
+		return
+	}
+
+	records := make([]*collector.FlowRecord, 0, len(collected))
+	for _, record := range collected {
+		records = append(records, record)
+	}
+
+	rpcPayload := &rpcwrapper.StatsPayload{
+		Records:   records,
+		ContextID: s.contextID(),
+		Pid:       os.Getpid(),
+		Sequence:  s.sequence + 1,
+		Watermark: s.delivered,
+		Evicted:   evicted,
+		Latencies: latencies,
+		RuleStats: ruleStats,
+	}
+
+	request := rpcwrapper.Request{
+		Payload: rpcPayload,
+	}
+
+	start := time.Now()
+	err := s.Rpchdl.RemoteCall(
+		statsContextID,
+		"StatsServer.GetStats",
+		&request,
+		&rpcwrapper.Response{},
+	)
+	s.adjustBackoff(time.Since(start), err)
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"package": "remoteEnforcer",
+			"Msg":     "Unable to send flows",
+		}).Error("RPC failure in sending statistics")
+
+		// Keep the flows for the next connection
+		for _, record := range records {
+			s.collector.CollectFlowEvent(record)
+		}
+		s.collector.restoreEvicted(evicted)
+		s.collector.restoreLatencies(latencies)
+		s.collector.restoreRuleStats(ruleStats)
+
+		s.registered = false
+		return
+	}
+
+	// The records of a failed call are sent again with the same sequence number, so
+	// that the controller can tell if it received them after all
+	s.sequence++
+	s.delivered += uint64(len(records))
+
+	s.contact(now)
+}
+
+// Flush sends the collected flows to the controller without waiting for the stats
+// interval. It returns once they are sent, or with an error if the controller cannot
+// be reached, in which case the flows are kept for the next stats.
+func (s *StatsClient) Flush() error {
 
+	done := make(chan error, 1)
+	s.flushes <- done
+
+	return <-done
+}
+
+// flushStats sends all the collected flows, in as many stats as needed. The flows
+// collected while they are sent are left to the next stats, so that a busy PU does
+// not hold the flush.
+func (s *StatsClient) flushStats(now time.Time) error {
+
+	for batches := s.collector.size()/s.batchSize() + 1; batches > 0; batches-- {
+		if s.collector.size() == 0 {
+			return nil
+		}
+
+		s.sendStats(now)
+
+		if !s.registered {
+			return fmt.Errorf("Unable to send the flows to the controller")
 		}
 	}
 
+	return nil
+}
+
+// connect replaces the connection to the stats channel and registers the enforcer
+func (s *StatsClient) connect(now time.Time) error {
+
+	if client, err := s.Rpchdl.GetRPCClient(statsContextID); err == nil {
+		client.Close()
+	}
+
+	s.Rpchdl = rpcwrapper.NewRPCWrapper(rpcwrapper.WithTransport(rpcwrapper.TransportFromEnv()))
+
+	if err := s.Rpchdl.NewRPCClient(statsContextID, s.channel, s.secret); err != nil {
+		return err
+	}
+
+	return s.register(now)
+}
+
+// register makes the registration handshake with the controller. The controller
+// only accepts the enforcers it launched for the context.
+func (s *StatsClient) register(now time.Time) error {
+
+	contextID := s.contextID()
+
+	// The controller always enforces a context after the initialization
+	if contextID == "" {
+		s.registered = true
+		return nil
+	}
+
+	request := rpcwrapper.Request{
+		Payload: &rpcwrapper.RegisterPayload{
+			ContextID: contextID,
+			Pid:       os.Getpid(),
+		},
+	}
+
+	if err := s.Rpchdl.RemoteCall(statsContextID, "StatsServer.Register", &request, &rpcwrapper.Response{}); err != nil {
+		s.registered = false
+		return err
+	}
+
+	s.registered = true
+	s.contact(now)
+
+	return nil
+}
+
+// contact records a successful exchange with the controller
+func (s *StatsClient) contact(now time.Time) {
+
+	s.lastContact = now
+
+	if s.isLost {
+		s.isLost = false
+
+		log.WithFields(log.Fields{
+			"package": "remoteEnforcer",
+		}).Info("Registered with the controller again")
+
+		s.recovered()
+	}
+}
+
+// checkController calls lost once the controller has not been reached for the timeout
+func (s *StatsClient) checkController(now time.Time) {
+
+	if s.timeout < 0 || s.isLost || now.Sub(s.lastContact) < s.timeout {
+		return
+	}
+
+	s.isLost = true
+
+	log.WithFields(log.Fields{
+		"package":     "remoteEnforcer",
+		"lastContact": s.lastContact,
+	}).Warn("Controller lost")
+
+	s.lost()
 }
 
 //connectStatsCLient  This is an private function called by the remoteenforcer to connect back
 //to the controller over a stats channel
 func (s *Server) connectStatsClient(statsClient *StatsClient) error {
 
-	statsChannel := os.Getenv(envStatsChannelPath)
-	secret := os.Getenv(envStatsSecret)
-	err := statsClient.Rpchdl.NewRPCClient(statsContextID, statsChannel, secret)
+	statsClient.channel = os.Getenv(envStatsChannelPath)
+	statsClient.secret = os.Getenv(envStatsSecret)
+	statsClient.lastContact = time.Now()
+
+	err := statsClient.Rpchdl.NewRPCClient(statsContextID, statsClient.channel, statsClient.secret)
 	if err != nil {
 		log.WithFields(log.Fields{"package": "remote_enforcer",
 			"error": err.Error(),
 		}).Error("Stats RPC client cannot connect")
 	}
 	_, err = statsClient.Rpchdl.GetRPCClient(statsContextID)
+	statsClient.registered = err == nil
 
 	go statsClient.SendStats()
 	return err
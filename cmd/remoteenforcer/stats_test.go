@@ -0,0 +1,161 @@
+package remoteenforcer
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/enforcer"
+	"github.com/aporeto-inc/trireme/enforcer/utils/rpcwrapper"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestControllerLoss(t *testing.T) {
+	Convey("Given a stats client with a controller timeout of a minute", t, func() {
+		lost, recovered := 0, 0
+		start := time.Now()
+
+		s := &StatsClient{
+			timeout:     time.Minute,
+			lastContact: start,
+			lost:        func() { lost++ },
+			recovered:   func() { recovered++ },
+		}
+
+		Convey("The controller should not be lost before the timeout", func() {
+			s.checkController(start.Add(59 * time.Second))
+			So(lost, ShouldEqual, 0)
+		})
+
+		Convey("When the timeout expires", func() {
+			s.checkController(start.Add(time.Minute))
+			s.checkController(start.Add(2 * time.Minute))
+
+			Convey("The controller should be lost once", func() {
+				So(lost, ShouldEqual, 1)
+			})
+
+			Convey("A new contact should recover it once", func() {
+				s.contact(start.Add(3 * time.Minute))
+				s.contact(start.Add(4 * time.Minute))
+				So(recovered, ShouldEqual, 1)
+
+				s.checkController(start.Add(4*time.Minute + 30*time.Second))
+				So(lost, ShouldEqual, 1)
+			})
+		})
+
+		Convey("The controller should never be lost with a negative timeout", func() {
+			s.timeout = -1
+			s.checkController(start.Add(time.Hour))
+			So(lost, ShouldEqual, 0)
+		})
+	})
+}
+
+func TestFlushStats(t *testing.T) {
+	Convey("Given a registered stats client", t, func() {
+		now := time.Now()
+
+		s := &StatsClient{
+			collector:   NewCollectorImpl(nil),
+			Rpchdl:      rpcwrapper.NewRPCWrapper(),
+			contextID:   func() string { return "" },
+			timeout:     -1,
+			registered:  true,
+			lastContact: now,
+		}
+
+		Convey("A flush without flows should succeed", func() {
+			So(s.flushStats(now), ShouldBeNil)
+			So(s.registered, ShouldBeTrue)
+		})
+
+		Convey("When the controller cannot be reached", func() {
+			s.collector.CollectFlowEvent(&collector.FlowRecord{
+				ContextID:       "context",
+				SourceIP:        "1.1.1.1",
+				DestinationIP:   "2.2.2.2",
+				DestinationPort: 80,
+				Count:           1,
+			})
+
+			err := s.flushStats(now)
+
+			Convey("The flush should fail and keep the flows for the next stats", func() {
+				So(err, ShouldNotBeNil)
+				So(s.registered, ShouldBeFalse)
+				So(s.collector.size(), ShouldEqual, 1)
+				So(s.sequence, ShouldEqual, 0)
+				So(s.delivered, ShouldEqual, 0)
+			})
+		})
+
+		Convey("When the controller cannot be reached with latency records", func() {
+			s.collector.CollectLatencyEvent(&collector.LatencyRecord{ContextID: "context", Count: 1})
+
+			s.sendStats(now)
+
+			Convey("The stats should fail and keep the records for the next stats", func() {
+				So(s.registered, ShouldBeFalse)
+				So(s.collector.takeLatencies(), ShouldHaveLength, 1)
+			})
+		})
+
+		Convey("When the controller cannot be reached with rule stats records", func() {
+			s.collector.CollectRuleStatsEvent(&collector.RuleStatsRecord{ContextID: "context"})
+
+			s.sendStats(now)
+
+			Convey("The stats should fail and keep the records for the next stats", func() {
+				So(s.registered, ShouldBeFalse)
+				So(s.collector.takeRuleStats(), ShouldHaveLength, 1)
+			})
+		})
+	})
+}
+
+func TestStatsBatch(t *testing.T) {
+	Convey("Given the batch configuration of the controller", t, func() {
+
+		Convey("The defaults should apply to an empty configuration", func() {
+			interval, maxRecords := newStatsBatch(enforcer.StatsBatchConfig{})
+			So(interval, ShouldEqual, enforcer.DefaultStatsInterval)
+			So(maxRecords, ShouldEqual, rpcwrapper.MaxStatsRecords)
+		})
+
+		Convey("The batches should not exceed the maximum of the controller", func() {
+			interval, maxRecords := newStatsBatch(enforcer.StatsBatchConfig{Interval: time.Second, MaxRecords: 10 * rpcwrapper.MaxStatsRecords})
+			So(interval, ShouldEqual, time.Second)
+			So(maxRecords, ShouldEqual, rpcwrapper.MaxStatsRecords)
+		})
+	})
+
+	Convey("Given a stats client with an interval of a second", t, func() {
+		s := &StatsClient{interval: time.Second, backoff: 1}
+
+		Convey("When the controller is slow, the interval should double up to its maximum", func() {
+			for i := 0; i < 5; i++ {
+				s.adjustBackoff(800*time.Millisecond, nil)
+			}
+			So(s.currentInterval(), ShouldEqual, maxStatsBackoff*time.Second)
+
+			Convey("Then it should decrease once the controller is fast again", func() {
+				s.adjustBackoff(10*time.Millisecond, nil)
+				So(s.currentInterval(), ShouldEqual, maxStatsBackoff/2*time.Second)
+			})
+		})
+
+		Convey("When the controller fails, the interval should double", func() {
+			s.adjustBackoff(0, fmt.Errorf("failed"))
+			So(s.currentInterval(), ShouldEqual, 2*time.Second)
+		})
+
+		Convey("When the controller is fast, the interval should not change", func() {
+			s.adjustBackoff(10*time.Millisecond, nil)
+			So(s.currentInterval(), ShouldEqual, time.Second)
+		})
+	})
+}
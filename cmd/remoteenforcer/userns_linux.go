@@ -0,0 +1,34 @@
+package remoteenforcer
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/aporeto-inc/trireme/utils/preflight"
+)
+
+// envContainerUserns is set by the launcher when the enforcer enters the user
+// namespace of a rootless container
+const envContainerUserns = "CONTAINER_USERNS"
+
+// checkUserNamespaceCapabilities returns an error if the enforcer did not gain the
+// capabilities required to program the network namespace of a rootless container
+// when it entered its user namespace
+func checkUserNamespaceCapabilities() error {
+
+	status, err := ioutil.ReadFile("/proc/self/status")
+	if err != nil {
+		return err
+	}
+
+	capabilities, err := preflight.EffectiveCapabilities(string(status))
+	if err != nil {
+		return err
+	}
+
+	if capabilities&(1<<preflight.CapNetAdmin.Bit) == 0 {
+		return fmt.Errorf("Enforcer has no CAP_NET_ADMIN in the user namespace of the container")
+	}
+
+	return nil
+}
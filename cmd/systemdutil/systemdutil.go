@@ -74,7 +74,7 @@ func ExecuteCommand(arguments map[string]interface{}) error {
 		ports = args.(string)
 	}
 
-	name, metadatamap, err := createMetadata(servicename, command, ports, metadata)
+	name, metadatamap, err := CreateMetadata(servicename, command, ports, metadata)
 
 	if err != nil {
 		err = fmt.Errorf("Invalid metadata: %s", err)
@@ -94,6 +94,7 @@ func ExecuteCommand(arguments map[string]interface{}) error {
 	//This is added since the release_notification comes in this format
 	//Easier to massage it while creation rather than change at the receiving end depending on event
 	request := &rpcmonitor.EventInfo{
+		Version:   rpcmonitor.CurrentEventVersion,
 		PUType:    constants.LinuxProcessPU,
 		PUID:      "/" + strconv.Itoa(os.Getpid()),
 		Name:      name,
@@ -122,8 +123,8 @@ func ExecuteCommand(arguments map[string]interface{}) error {
 
 }
 
-// createMetadata extracts the relevant metadata
-func createMetadata(servicename string, command string, ports string, metadata []string) (string, map[string]string, error) {
+// CreateMetadata extracts the relevant metadata
+func CreateMetadata(servicename string, command string, ports string, metadata []string) (string, map[string]string, error) {
 
 	metadatamap := map[string]string{}
 
@@ -166,6 +167,7 @@ func HandleCgroupStop(cgroupName string) error {
 	}
 
 	request := &rpcmonitor.EventInfo{
+		Version:   rpcmonitor.CurrentEventVersion,
 		PUType:    constants.LinuxProcessPU,
 		PUID:      cgroupName,
 		Name:      cgroupName,
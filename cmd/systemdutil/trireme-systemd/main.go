@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aporeto-inc/trireme/cmd/systemdutil"
+	"github.com/kardianos/osext"
+)
+
+/*
+
+trireme-systemd activates systemd services as Linux Process PUs.
+
+Usage:
+  trireme-systemd install [--unit-dir dir] <unit> [key=value...]
+  trireme-systemd start [--label key=value]... <unit> <mainpid>
+  trireme-systemd stop <unit>
+  trireme-systemd <normal-dir> <early-dir> <late-dir>
+
+The last form is the systemd generator interface. When the binary is linked in
+/etc/systemd/system-generators it installs the drop-ins of all the units listed
+in /etc/trireme/systemd-units at every boot or daemon-reload.
+
+*/
+
+// labelList collects repeated --label flags
+type labelList []string
+
+func (l *labelList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *labelList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: trireme-systemd install|start|stop <unit> ...")
+	os.Exit(2)
+}
+
+func main() {
+
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	binary, err := osext.Executable()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	switch os.Args[1] {
+
+	case "install":
+		flags := flag.NewFlagSet("install", flag.ExitOnError)
+		unitDir := flags.String("unit-dir", systemdutil.DefaultUnitDir, "Directory where the drop-in is installed")
+		flags.Parse(os.Args[2:])
+		if flags.NArg() < 1 {
+			usage()
+		}
+		err = systemdutil.InstallDropIn(*unitDir, binary, &systemdutil.UnitConfig{
+			Unit:   flags.Arg(0),
+			Labels: flags.Args()[1:],
+		})
+
+	case "start":
+		var labels labelList
+		flags := flag.NewFlagSet("start", flag.ExitOnError)
+		flags.Var(&labels, "label", "Label of the PU in the form key=value (repeatable)")
+		flags.Parse(os.Args[2:])
+		if flags.NArg() != 2 {
+			usage()
+		}
+		err = systemdutil.HandleUnitStart(flags.Arg(0), flags.Arg(1), labels)
+
+	case "stop":
+		if len(os.Args) != 3 {
+			usage()
+		}
+		err = systemdutil.HandleUnitStop(os.Args[2])
+
+	default:
+		if len(os.Args) != 4 {
+			usage()
+		}
+		err = systemdutil.Generate(os.Args[1], binary, systemdutil.DefaultUnitsConfig)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,272 @@
+package systemdutil
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/rpc/jsonrpc"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/monitor"
+	"github.com/aporeto-inc/trireme/monitor/linuxmonitor/cgnetcls"
+	"github.com/aporeto-inc/trireme/monitor/rpcmonitor"
+)
+
+const (
+	// DropInName is the name of the drop-in file installed for every unit
+	DropInName = "trireme.conf"
+
+	// DefaultUnitDir is the directory where drop-ins of administrator units are installed
+	DefaultUnitDir = "/etc/systemd/system"
+
+	// DefaultUnitsConfig is the file listing the units activated by the generator.
+	// Every line holds a unit name optionally followed by key=value labels.
+	DefaultUnitsConfig = "/etc/trireme/systemd-units"
+
+	// unitTagPrefix is prepended to the tags derived from the unit properties
+	unitTagPrefix = "systemd:"
+)
+
+var (
+	// unitStatePath keeps the main PID of every activated unit so that it
+	// can be cleaned up when the unit stops.
+	unitStatePath = "/var/run/trireme/systemd"
+
+	// unitProperties are the unit properties exported as tags
+	unitProperties = []string{"Id", "Description", "Slice", "User", "Group", "FragmentPath"}
+)
+
+// UnitConfig is the activation configuration of a systemd unit
+type UnitConfig struct {
+	Unit   string
+	Labels []string
+}
+
+// GenerateDropIn returns the content of a drop-in that activates a unit as a PU
+// when it starts and deletes the PU when it stops. binary is the path of the
+// command line tool that invokes HandleUnitStart and HandleUnitStop.
+func GenerateDropIn(binary string, labels []string) string {
+
+	var buffer bytes.Buffer
+
+	buffer.WriteString("# Generated by trireme. Do not edit.\n")
+	buffer.WriteString("[Service]\n")
+
+	startCmd := []string{binary, "start"}
+	for _, label := range labels {
+		startCmd = append(startCmd, "--label", label)
+	}
+	startCmd = append(startCmd, "%n", "${MAINPID}")
+
+	buffer.WriteString("ExecStartPost=" + strings.Join(startCmd, " ") + "\n")
+	buffer.WriteString("ExecStopPost=-" + binary + " stop %n\n")
+
+	return buffer.String()
+}
+
+// InstallDropIn writes the drop-in of a unit in unitDir. systemd must be
+// reloaded for the drop-in to be taken into account.
+func InstallDropIn(unitDir string, binary string, config *UnitConfig) error {
+
+	if config.Unit == "" {
+		return fmt.Errorf("Unit name is empty")
+	}
+
+	dropInDir := filepath.Join(unitDir, config.Unit+".d")
+	if err := os.MkdirAll(dropInDir, 0755); err != nil {
+		return fmt.Errorf("Cannot create drop-in directory %s: %s", dropInDir, err)
+	}
+
+	return ioutil.WriteFile(filepath.Join(dropInDir, DropInName), []byte(GenerateDropIn(binary, config.Labels)), 0644)
+}
+
+// Generate implements a systemd generator. It installs the drop-ins of all the
+// units listed in the configuration file in the given generator output directory.
+func Generate(outputDir string, binary string, configFile string) error {
+
+	data, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	configs, err := ParseUnitsConfig(string(data))
+	if err != nil {
+		return err
+	}
+
+	for _, config := range configs {
+		if err := InstallDropIn(outputDir, binary, config); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ParseUnitsConfig parses the list of units activated by the generator
+func ParseUnitsConfig(data string) ([]*UnitConfig, error) {
+
+	configs := []*UnitConfig{}
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		for _, label := range fields[1:] {
+			if !strings.Contains(label, "=") {
+				return nil, fmt.Errorf("Invalid label %s for unit %s", label, fields[0])
+			}
+		}
+
+		configs = append(configs, &UnitConfig{
+			Unit:   fields[0],
+			Labels: fields[1:],
+		})
+	}
+
+	return configs, scanner.Err()
+}
+
+// HandleUnitStart activates the main process of a unit as a PU. The
+// properties of the unit are added as tags to the PU.
+func HandleUnitStart(unit string, mainPID string, labels []string) error {
+
+	if _, err := strconv.Atoi(mainPID); err != nil {
+		return fmt.Errorf("Invalid main PID %s for unit %s", mainPID, unit)
+	}
+
+	command, err := os.Readlink("/proc/" + mainPID + "/exe")
+	if err != nil {
+		return fmt.Errorf("Cannot find the command of unit %s: %s", unit, err)
+	}
+
+	_, metadatamap, err := CreateMetadata(unit, command, "0", labels)
+	if err != nil {
+		return fmt.Errorf("Invalid metadata: %s", err)
+	}
+
+	properties, err := unitShow(unit)
+	if err != nil {
+		return err
+	}
+
+	for k, v := range UnitTags(properties) {
+		metadatamap[k] = v
+	}
+
+	request := &rpcmonitor.EventInfo{
+		Version:   rpcmonitor.CurrentEventVersion,
+		PUType:    constants.LinuxProcessPU,
+		PUID:      "/" + mainPID,
+		Name:      command,
+		Tags:      metadatamap,
+		PID:       mainPID,
+		EventType: monitor.EventStart,
+	}
+
+	if err := sendUnitEvent(request); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(unitStatePath, 0700); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(unitStatePath, unit), []byte(mainPID), 0600)
+}
+
+// HandleUnitStop deletes the PU of a unit
+func HandleUnitStop(unit string) error {
+
+	stateFile := filepath.Join(unitStatePath, unit)
+
+	data, err := ioutil.ReadFile(stateFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	defer os.Remove(stateFile)
+
+	return HandleCgroupStop(cgnetcls.TriremeBasePath + "/" + strings.TrimSpace(string(data)))
+}
+
+// UnitTags converts the properties of a unit into tags
+func UnitTags(properties map[string]string) map[string]string {
+
+	tags := map[string]string{}
+
+	for _, property := range unitProperties {
+		if value, ok := properties[property]; ok && value != "" {
+			tags[unitTagPrefix+strings.ToLower(property)] = value
+		}
+	}
+
+	return tags
+}
+
+// ParseUnitProperties parses the output of systemctl show
+func ParseUnitProperties(output string) map[string]string {
+
+	properties := map[string]string{}
+
+	for _, line := range strings.Split(output, "\n") {
+		keyvalue := strings.SplitN(line, "=", 2)
+		if len(keyvalue) != 2 {
+			continue
+		}
+		properties[keyvalue[0]] = keyvalue[1]
+	}
+
+	return properties
+}
+
+// unitShow returns the properties of a unit
+func unitShow(unit string) (map[string]string, error) {
+
+	output, err := exec.Command("systemctl", "show", "--property="+strings.Join(unitProperties, ","), unit).Output()
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read properties of unit %s: %s", unit, err)
+	}
+
+	return ParseUnitProperties(string(output)), nil
+}
+
+// sendUnitEvent sends an event to the RPC monitor
+func sendUnitEvent(request *rpcmonitor.EventInfo) error {
+
+	client, err := net.Dial("unix", rpcmonitor.DefaultRPCAddress)
+	if err != nil {
+		return fmt.Errorf("Cannot connect to policy process %s", err)
+	}
+
+	rpcClient := jsonrpc.NewClient(client)
+	defer rpcClient.Close()
+
+	response := &rpcmonitor.RPCResponse{}
+	if err := rpcClient.Call(remoteMethodCall, request, response); err != nil {
+		return fmt.Errorf("Policy Server call failed %s", err.Error())
+	}
+
+	if len(response.Error) > 0 {
+		return fmt.Errorf("Policy Server refused unit: %s", response.Error)
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package systemdutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGenerateDropIn(t *testing.T) {
+	Convey("When I generate a drop-in with labels", t, func() {
+		dropIn := GenerateDropIn("/usr/bin/trireme-systemd", []string{"app=web"})
+
+		Convey("It should register the main PID when the unit starts", func() {
+			So(dropIn, ShouldContainSubstring, "ExecStartPost=/usr/bin/trireme-systemd start --label app=web %n ${MAINPID}\n")
+		})
+
+		Convey("It should clean up when the unit stops", func() {
+			So(dropIn, ShouldContainSubstring, "ExecStopPost=-/usr/bin/trireme-systemd stop %n\n")
+		})
+	})
+}
+
+func TestParseUnitsConfig(t *testing.T) {
+	Convey("When I parse a valid configuration", t, func() {
+		configs, err := ParseUnitsConfig("# comment\n\nnginx.service app=web tier=frontend\nredis.service\n")
+
+		Convey("I should get all the units", func() {
+			So(err, ShouldBeNil)
+			So(len(configs), ShouldEqual, 2)
+			So(configs[0].Unit, ShouldEqual, "nginx.service")
+			So(configs[0].Labels, ShouldResemble, []string{"app=web", "tier=frontend"})
+			So(configs[1].Unit, ShouldEqual, "redis.service")
+			So(len(configs[1].Labels), ShouldEqual, 0)
+		})
+	})
+
+	Convey("When I parse a configuration with an invalid label", t, func() {
+		_, err := ParseUnitsConfig("nginx.service web\n")
+
+		Convey("I should get an error", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestUnitTags(t *testing.T) {
+	Convey("When I convert the output of systemctl show", t, func() {
+		properties := ParseUnitProperties("Id=nginx.service\nDescription=A high performance web server\nUser=\nSlice=system.slice\n")
+		tags := UnitTags(properties)
+
+		Convey("I should get the non-empty properties as tags", func() {
+			So(tags, ShouldResemble, map[string]string{
+				"systemd:id":          "nginx.service",
+				"systemd:description": "A high performance web server",
+				"systemd:slice":       "system.slice",
+			})
+		})
+	})
+}
+
+func TestGenerate(t *testing.T) {
+	Convey("Given a units configuration file", t, func() {
+		dir, err := ioutil.TempDir("", "trireme-systemd")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		configFile := filepath.Join(dir, "units")
+		So(ioutil.WriteFile(configFile, []byte("nginx.service app=web\n"), 0644), ShouldBeNil)
+
+		Convey("When I run the generator", func() {
+			err := Generate(dir, "/usr/bin/trireme-systemd", configFile)
+
+			Convey("It should install the drop-in of the unit", func() {
+				So(err, ShouldBeNil)
+				data, err := ioutil.ReadFile(filepath.Join(dir, "nginx.service.d", DropInName))
+				So(err, ShouldBeNil)
+				So(strings.Contains(string(data), "--label app=web"), ShouldBeTrue)
+			})
+		})
+
+		Convey("When the configuration file does not exist", func() {
+			err := Generate(dir, "/usr/bin/trireme-systemd", filepath.Join(dir, "missing"))
+
+			Convey("It should not fail", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+
+	"github.com/aporeto-inc/trireme/bench"
+)
+
+// benchCommand runs the micro-benchmarks of the datapath, saves their results and
+// compares them with a baseline. It fails if a benchmark regressed.
+func benchCommand(args []string, out io.Writer) error {
+
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	run := flags.String("run", "", "Regular expression selecting the benchmarks")
+	save := flags.String("save", "", "File where the results are saved as a baseline")
+	baselineFile := flags.String("baseline", "", "File of the baseline results to compare with")
+	tolerance := flags.Float64("tolerance", bench.DefaultTolerance, "Slowdown over the baseline tolerated, as a ratio")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var filter *regexp.Regexp
+	if *run != "" {
+		var err error
+		if filter, err = regexp.Compile(*run); err != nil {
+			return fmt.Errorf("Invalid benchmark expression: %s", err)
+		}
+	}
+
+	var baseline []bench.Result
+	if *baselineFile != "" {
+		file, err := os.Open(*baselineFile)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		if baseline, err = bench.ReadResults(file); err != nil {
+			return err
+		}
+	}
+
+	results := bench.Run(filter)
+	for _, r := range results {
+		fmt.Fprintf(out, "%-20s %12.0f ns/op %8d B/op %6d allocs/op\n", r.Name, r.NsPerOp, r.BytesPerOp, r.AllocsPerOp)
+	}
+
+	if *save != "" {
+		file, err := os.Create(*save)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		if err := bench.WriteResults(file, results); err != nil {
+			return err
+		}
+	}
+
+	if baseline == nil {
+		return nil
+	}
+
+	regressions := bench.Compare(baseline, results, *tolerance)
+	for _, r := range regressions {
+		fmt.Fprintln(out, "REGRESSION", r)
+	}
+
+	if len(regressions) > 0 {
+		return fmt.Errorf("%d benchmarks regressed", len(regressions))
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+// triremectl is a command line tool to debug Trireme deployments.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `Usage:
+  triremectl token [--psk <key>] [--key <file> --cert <file> --ca <file>] [--ack] (--hex <token> | --pcap <file>)
+  triremectl bench [--run <regexp>] [--save <file>] [--baseline <file> [--tolerance <ratio>]]
+`
+
+func main() {
+
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+
+	switch os.Args[1] {
+	case "token":
+		err = tokenCommand(os.Args[2:], os.Stdout)
+	case "bench":
+		err = benchCommand(os.Args[2:], os.Stdout)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aporeto-inc/trireme/enforcer/utils/packet"
+)
+
+const (
+	pcapMagic        = 0xa1b2c3d4
+	pcapMagicNano    = 0xa1b23c4d
+	pcapHeaderLen    = 24
+	pcapRecordLen    = 16
+	linkTypeEthernet = 1
+	linkTypeRaw      = 101
+	linkTypeLinuxSLL = 113
+	etherTypeIPv4    = 0x0800
+	minTCPPacketLen  = 40
+
+	// maxSnapLen is the largest packet length of the captures, used when the
+	// snapshot length of the header is not set or is larger
+	maxSnapLen = 262144
+)
+
+// capturedToken is a token found in a capture file
+type capturedToken struct {
+	description string
+	isAck       bool
+	data        []byte
+}
+
+// readTokens returns the tokens carried by the SYN, SYN/ACK and ACK packets of a
+// classic pcap capture.
+func readTokens(r io.Reader) ([]*capturedToken, error) {
+
+	header := make([]byte, pcapHeaderLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("Cannot read pcap header: %s", err)
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	switch binary.LittleEndian.Uint32(header) {
+	case pcapMagic, pcapMagicNano:
+	default:
+		order = binary.BigEndian
+		if magic := order.Uint32(header); magic != pcapMagic && magic != pcapMagicNano {
+			return nil, errors.New("Not a pcap file")
+		}
+	}
+
+	snapLen := order.Uint32(header[16:20])
+	if snapLen == 0 || snapLen > maxSnapLen {
+		snapLen = maxSnapLen
+	}
+
+	linkType := order.Uint32(header[20:24])
+
+	captured := []*capturedToken{}
+	record := make([]byte, pcapRecordLen)
+
+	for index := 1; ; index++ {
+		if _, err := io.ReadFull(r, record); err != nil {
+			if err == io.EOF {
+				return captured, nil
+			}
+			return nil, fmt.Errorf("Cannot read packet %d: %s", index, err)
+		}
+
+		length := order.Uint32(record[8:12])
+		if length > snapLen {
+			return nil, fmt.Errorf("Cannot read packet %d: length %d exceeds the snapshot length %d", index, length, snapLen)
+		}
+
+		frame := make([]byte, length)
+		if _, err := io.ReadFull(r, frame); err != nil {
+			return nil, fmt.Errorf("Cannot read packet %d: %s", index, err)
+		}
+
+		ip := ipPayload(linkType, frame)
+		if len(ip) < minTCPPacketLen || ip[0]>>4 != 4 || ip[9] != 6 {
+			continue
+		}
+
+		p, err := packet.New(packet.PacketTypeNetwork, ip, "")
+		if err != nil {
+			continue
+		}
+
+		data := p.ReadTCPData()
+		if len(data) == 0 {
+			continue
+		}
+
+		var kind string
+		switch p.TCPFlags & (packet.TCPSynMask | packet.TCPAckMask) {
+		case packet.TCPSynMask:
+			kind = "SYN"
+		case packet.TCPSynMask | packet.TCPAckMask:
+			kind = "SYN/ACK"
+		default:
+			kind = "ACK"
+		}
+
+		captured = append(captured, &capturedToken{
+			description: fmt.Sprintf("packet %d: %s %s:%d -> %s:%d", index, kind, p.SourceAddress, p.SourcePort, p.DestinationAddress, p.DestinationPort),
+			isAck:       kind == "ACK",
+			data:        data,
+		})
+	}
+}
+
+// ipPayload strips the link layer header of a frame
+func ipPayload(linkType uint32, frame []byte) []byte {
+
+	switch linkType {
+	case linkTypeRaw:
+		return frame
+	case linkTypeEthernet:
+		if len(frame) < 14 || binary.BigEndian.Uint16(frame[12:14]) != etherTypeIPv4 {
+			return nil
+		}
+		return frame[14:]
+	case linkTypeLinuxSLL:
+		if len(frame) < 16 || binary.BigEndian.Uint16(frame[14:16]) != etherTypeIPv4 {
+			return nil
+		}
+		return frame[16:]
+	}
+
+	return nil
+}
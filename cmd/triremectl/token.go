@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+)
+
+// tokenCommand decodes and verifies captured tokens against the configured secrets
+func tokenCommand(args []string, out io.Writer) error {
+
+	flags := flag.NewFlagSet("token", flag.ContinueOnError)
+	psk := flags.String("psk", "", "Pre-shared key")
+	keyFile := flags.String("key", "", "PEM file of the private key")
+	certFile := flags.String("cert", "", "PEM file of the certificate")
+	caFile := flags.String("ca", "", "PEM file of the certificate authority")
+	isAck := flags.Bool("ack", false, "The token is an ACK token")
+	hexToken := flags.String("hex", "", "Token encoded in hex")
+	pcapFile := flags.String("pcap", "", "Capture file with SYN and SYN/ACK packets")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	secrets, err := loadSecrets(*psk, *keyFile, *certFile, *caFile)
+	if err != nil {
+		return err
+	}
+
+	engine, err := tokens.NewJWT(time.Hour, "triremectl", secrets)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case *hexToken != "":
+		data, err := hex.DecodeString(strings.TrimSpace(*hexToken))
+		if err != nil {
+			return fmt.Errorf("Invalid hex token: %s", err)
+		}
+		return printDiagnosis(out, engine, "token", *isAck, data)
+
+	case *pcapFile != "":
+		file, err := os.Open(*pcapFile)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		captured, err := readTokens(file)
+		if err != nil {
+			return err
+		}
+
+		if len(captured) == 0 {
+			return errors.New("No token found in the capture")
+		}
+
+		for _, c := range captured {
+			if err := printDiagnosis(out, engine, c.description, c.isAck, c.data); err != nil {
+				fmt.Fprintf(out, "%s\n  error: %s\n", c.description, err)
+			}
+		}
+		return nil
+	}
+
+	return errors.New("A token must be provided with --hex or --pcap")
+}
+
+// loadSecrets creates the secrets used to verify the tokens
+func loadSecrets(psk, keyFile, certFile, caFile string) (tokens.Secrets, error) {
+
+	if psk != "" {
+		return tokens.NewPSKSecrets([]byte(psk)), nil
+	}
+
+	if keyFile == "" || certFile == "" || caFile == "" {
+		return nil, errors.New("Either --psk or --key, --cert and --ca must be provided")
+	}
+
+	pems := [][]byte{}
+	for _, file := range []string{keyFile, certFile, caFile} {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		pems = append(pems, data)
+	}
+
+	secrets := tokens.NewPKISecrets(pems[0], pems[1], pems[2], nil)
+	if secrets == nil {
+		return nil, errors.New("Invalid PKI secrets")
+	}
+
+	return secrets, nil
+}
+
+// printDiagnosis prints everything that can be learned from a token
+func printDiagnosis(out io.Writer, engine *tokens.JWTConfig, description string, isAck bool, data []byte) error {
+
+	diagnosis, err := engine.Diagnose(isAck, data)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "%s\n", description)
+	fmt.Fprintf(out, "  algorithm: %s\n", diagnosis.Algorithm)
+	fmt.Fprintf(out, "  issuer:    %s\n", diagnosis.Issuer)
+
+	if !diagnosis.ExpiresAt.IsZero() {
+		fmt.Fprintf(out, "  expires:   %s (expired: %t)\n", diagnosis.ExpiresAt.UTC().Format(time.RFC3339), diagnosis.Expired)
+	}
+
+	if diagnosis.Certificate != nil {
+		fmt.Fprintf(out, "  signer:    %s (issued by %s)\n", diagnosis.Certificate.Subject.CommonName, diagnosis.Certificate.Issuer.CommonName)
+	}
+
+	if diagnosis.CertificateError != nil {
+		fmt.Fprintf(out, "  certificate error: %s\n", diagnosis.CertificateError)
+	}
+
+	if diagnosis.Claims != nil {
+		fmt.Fprintf(out, "  local context:  %x\n", diagnosis.Claims.LCL)
+		fmt.Fprintf(out, "  remote context: %x\n", diagnosis.Claims.RMT)
+
+		if diagnosis.Claims.T != nil {
+			keys := []string{}
+			for k := range diagnosis.Claims.T.Tags {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+
+			fmt.Fprintf(out, "  tags:\n")
+			for _, k := range keys {
+				fmt.Fprintf(out, "    %s=%s\n", k, diagnosis.Claims.T.Tags[k])
+			}
+		}
+	}
+
+	if diagnosis.Verified {
+		fmt.Fprintf(out, "  verified:  yes\n")
+	} else {
+		fmt.Fprintf(out, "  verified:  no (%s)\n", diagnosis.VerificationError)
+	}
+
+	return nil
+}
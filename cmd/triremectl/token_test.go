@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+	"github.com/aporeto-inc/trireme/policy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// synPacket returns an IPv4 SYN packet carrying data as payload
+func synPacket(data []byte) []byte {
+
+	p := make([]byte, 40+len(data))
+	p[0] = 0x45
+	binary.BigEndian.PutUint16(p[2:4], uint16(len(p)))
+	p[9] = 6
+	copy(p[12:16], []byte{10, 0, 0, 1})
+	copy(p[16:20], []byte{10, 0, 0, 2})
+	binary.BigEndian.PutUint16(p[20:22], 32000)
+	binary.BigEndian.PutUint16(p[22:24], 80)
+	p[32] = 5 << 4
+	p[33] = 0x2
+	copy(p[40:], data)
+
+	return p
+}
+
+// pcapFile returns a raw IP capture with the given packets
+func pcapFile(packets ...[]byte) []byte {
+
+	buffer := &bytes.Buffer{}
+	header := make([]byte, pcapHeaderLen)
+	binary.LittleEndian.PutUint32(header[0:4], pcapMagic)
+	binary.LittleEndian.PutUint32(header[16:20], 65535)
+	binary.LittleEndian.PutUint32(header[20:24], linkTypeRaw)
+	buffer.Write(header)
+
+	for _, p := range packets {
+		record := make([]byte, pcapRecordLen)
+		binary.LittleEndian.PutUint32(record[8:12], uint32(len(p)))
+		binary.LittleEndian.PutUint32(record[12:16], uint32(len(p)))
+		buffer.Write(record)
+		buffer.Write(p)
+	}
+
+	return buffer.Bytes()
+}
+
+func TestTokenCommand(t *testing.T) {
+	Convey("Given a token signed with a pre-shared key", t, func() {
+		engine, err := tokens.NewJWT(time.Hour, "server1", tokens.NewPSKSecrets([]byte("secret")))
+		So(err, ShouldBeNil)
+
+		token := engine.CreateAndSign(false, &tokens.ConnectionClaims{
+			T:   policy.NewTagsMap(map[string]string{"app": "web"}),
+			LCL: []byte("local"),
+		})
+
+		Convey("When I diagnose it in hex with the right key", func() {
+			out := &bytes.Buffer{}
+			err := tokenCommand([]string{"--psk", "secret", "--hex", hex.EncodeToString(token)}, out)
+
+			Convey("It should print the claims and verify it", func() {
+				So(err, ShouldBeNil)
+				So(out.String(), ShouldContainSubstring, "issuer:    server1")
+				So(out.String(), ShouldContainSubstring, "app=web")
+				So(out.String(), ShouldContainSubstring, "verified:  yes")
+			})
+		})
+
+		Convey("When I diagnose it from a capture with the wrong key", func() {
+			file, err := ioutil.TempFile("", "triremectl")
+			So(err, ShouldBeNil)
+			defer os.Remove(file.Name())
+
+			_, err = file.Write(pcapFile(synPacket(token)))
+			So(err, ShouldBeNil)
+			So(file.Close(), ShouldBeNil)
+
+			out := &bytes.Buffer{}
+			err = tokenCommand([]string{"--psk", "wrong", "--pcap", file.Name()}, out)
+
+			Convey("It should print the packet, the claims and the verification failure", func() {
+				So(err, ShouldBeNil)
+				So(out.String(), ShouldContainSubstring, "packet 1: SYN 10.0.0.1:32000 -> 10.0.0.2:80")
+				So(out.String(), ShouldContainSubstring, "app=web")
+				So(out.String(), ShouldContainSubstring, "verified:  no")
+			})
+		})
+	})
+
+	Convey("When I read a capture with a packet longer than the snapshot length", t, func() {
+		capture := pcapFile(synPacket([]byte("token")))
+		binary.LittleEndian.PutUint32(capture[pcapHeaderLen+8:], 0xffffffff)
+
+		_, err := readTokens(bytes.NewReader(capture))
+
+		Convey("I should get an error", func() {
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "exceeds the snapshot length 65535")
+		})
+	})
+
+	Convey("When I run the command without secrets", t, func() {
+		err := tokenCommand([]string{"--hex", "00"}, &bytes.Buffer{})
+
+		Convey("I should get an error", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
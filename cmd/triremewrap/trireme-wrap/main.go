@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aporeto-inc/trireme/cmd/triremewrap"
+)
+
+/*
+
+trireme-wrap runs a command as a Linux Process PU.
+
+Usage: trireme-wrap [--label key=value]... [--service-name name] [--ports ports] [--socket path] <command> [<params>...]
+
+Labels, service name, ports and socket can also be provided through the
+TRIREME_WRAP_LABELS, TRIREME_WRAP_SERVICE_NAME, TRIREME_WRAP_PORTS and
+TRIREME_WRAP_SOCKET environment variables.
+
+*/
+
+// labelList collects repeated --label flags
+type labelList []string
+
+func (l *labelList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *labelList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func main() {
+
+	var labels labelList
+
+	flag.Var(&labels, "label", "Label of the PU in the form key=value (repeatable)")
+	serviceName := flag.String("service-name", "", "Name of the PU")
+	ports := flag.String("ports", "", "Ports used by the PU")
+	socket := flag.String("socket", "", "Path of the RPC monitor socket")
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: trireme-wrap [options] <command> [<params>...]")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	arguments := map[string]interface{}{
+		"<command>":      flag.Arg(0),
+		"<params>":       flag.Args()[1:],
+		"--label":        []string(labels),
+		"--service-name": *serviceName,
+		"--ports":        *ports,
+		"--socket":       *socket,
+	}
+
+	config, err := triremewrap.ConfigFromArguments(arguments)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	exitCode, _ := triremewrap.Wrap(config)
+	os.Exit(exitCode)
+}
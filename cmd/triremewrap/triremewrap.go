@@ -0,0 +1,273 @@
+// Package triremewrap implements a launcher that activates an arbitrary command
+// as a Linux Process PU. It registers the launcher with the RPC monitor, runs the
+// command as a child process, forwards signals to it and cleans up the PU when the
+// child exits.
+package triremewrap
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/aporeto-inc/trireme/cmd/systemdutil"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/monitor"
+	"github.com/aporeto-inc/trireme/monitor/linuxmonitor/cgnetcls"
+	"github.com/aporeto-inc/trireme/monitor/rpcmonitor"
+)
+
+const (
+	remoteMethodCall = "Server.HandleEvent"
+
+	// EnvLabels is a comma separated list of key=value labels added to the PU
+	EnvLabels = "TRIREME_WRAP_LABELS"
+	// EnvServiceName is the service name of the PU if not provided as an argument
+	EnvServiceName = "TRIREME_WRAP_SERVICE_NAME"
+	// EnvPorts is the ports of the PU if not provided as an argument
+	EnvPorts = "TRIREME_WRAP_PORTS"
+	// EnvRPCAddress is the RPC monitor socket if not provided as an argument
+	EnvRPCAddress = "TRIREME_WRAP_SOCKET"
+)
+
+// ErrPolicyDenied is returned when the policy process refuses to activate the command
+var ErrPolicyDenied = errors.New("Your policy does not allow you to run this command")
+
+// forwardedSignals are the signals relayed from the launcher to the wrapped command
+var forwardedSignals = []os.Signal{
+	syscall.SIGINT,
+	syscall.SIGTERM,
+	syscall.SIGHUP,
+	syscall.SIGQUIT,
+	syscall.SIGUSR1,
+	syscall.SIGUSR2,
+}
+
+// Config holds the parameters of a wrapped command
+type Config struct {
+	Command     string
+	Params      []string
+	Labels      []string
+	ServiceName string
+	Ports       string
+	RPCAddress  string
+}
+
+// ConfigFromArguments builds a Config out of docopt style arguments. Values that
+// are not provided as arguments are looked up in the environment.
+func ConfigFromArguments(arguments map[string]interface{}) (*Config, error) {
+
+	c := &Config{}
+
+	if args, ok := arguments["<command>"]; ok && args != nil {
+		c.Command = args.(string)
+	}
+
+	if c.Command == "" {
+		return nil, fmt.Errorf("Bad arguments - no command")
+	}
+
+	if args, ok := arguments["<params>"]; ok && args != nil {
+		c.Params = args.([]string)
+	}
+
+	if args, ok := arguments["--label"]; ok && args != nil {
+		c.Labels = args.([]string)
+	}
+
+	if args, ok := arguments["--service-name"]; ok && args != nil {
+		c.ServiceName = args.(string)
+	}
+
+	if args, ok := arguments["--ports"]; ok && args != nil {
+		c.Ports = args.(string)
+	}
+
+	if args, ok := arguments["--socket"]; ok && args != nil {
+		c.RPCAddress = args.(string)
+	}
+
+	c.mergeEnvironment(os.Getenv)
+
+	return c, nil
+}
+
+// mergeEnvironment fills the missing values of the configuration from the environment
+func (c *Config) mergeEnvironment(getenv func(string) string) {
+
+	if labels := getenv(EnvLabels); labels != "" {
+		for _, label := range strings.Split(labels, ",") {
+			if label = strings.TrimSpace(label); label != "" {
+				c.Labels = append(c.Labels, label)
+			}
+		}
+	}
+
+	if c.ServiceName == "" {
+		c.ServiceName = getenv(EnvServiceName)
+	}
+
+	if c.Ports == "" {
+		c.Ports = getenv(EnvPorts)
+	}
+
+	if c.Ports == "" {
+		c.Ports = "0"
+	}
+
+	if c.RPCAddress == "" {
+		c.RPCAddress = getenv(EnvRPCAddress)
+	}
+
+	if c.RPCAddress == "" {
+		c.RPCAddress = rpcmonitor.DefaultRPCAddress
+	}
+}
+
+// Wrap activates the launcher as a PU, runs the command and waits for it to exit.
+// It returns the exit code of the command.
+func Wrap(c *Config) (int, error) {
+
+	var err error
+
+	stderrlogger := log.New(os.Stderr, "", 0)
+
+	command := c.Command
+	if !path.IsAbs(command) {
+		command, err = exec.LookPath(command)
+		if err != nil {
+			return 1, err
+		}
+	}
+
+	name, metadatamap, err := systemdutil.CreateMetadata(c.ServiceName, command, c.Ports, c.Labels)
+	if err != nil {
+		err = fmt.Errorf("Invalid metadata: %s", err)
+		stderrlogger.Print(err)
+		return 1, err
+	}
+
+	client, err := net.Dial("unix", c.RPCAddress)
+	if err != nil {
+		err = fmt.Errorf("Cannot connect to policy process %s", err)
+		stderrlogger.Print(err)
+		return 1, err
+	}
+
+	rpcClient := jsonrpc.NewClient(client)
+	defer rpcClient.Close()
+
+	pid := strconv.Itoa(os.Getpid())
+
+	// The child is started after the launcher is placed in the cgroup and
+	// inherits it, so that the policy applies to the whole process tree.
+	request := &rpcmonitor.EventInfo{
+		Version:   rpcmonitor.CurrentEventVersion,
+		PUType:    constants.LinuxProcessPU,
+		PUID:      "/" + pid,
+		Name:      name,
+		Tags:      metadatamap,
+		PID:       pid,
+		EventType: monitor.EventStart,
+	}
+
+	if err = sendEvent(rpcClient, request); err != nil {
+		stderrlogger.Print(err)
+		return 1, err
+	}
+
+	cmd := exec.Command(command, c.Params...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, forwardedSignals...)
+	defer signal.Stop(signals)
+
+	exitCode := 0
+	if err = cmd.Start(); err != nil {
+		stderrlogger.Printf("Failed to start command %s: %s", command, err)
+		exitCode = 1
+	} else {
+		exitCode, err = waitAndForward(cmd, signals)
+	}
+
+	cleanup := &rpcmonitor.EventInfo{
+		Version:   rpcmonitor.CurrentEventVersion,
+		PUType:    constants.LinuxProcessPU,
+		PUID:      cgnetcls.TriremeBasePath + "/" + pid,
+		Name:      cgnetcls.TriremeBasePath + "/" + pid,
+		PID:       pid,
+		EventType: monitor.EventStop,
+	}
+
+	if serr := sendEvent(rpcClient, cleanup); serr != nil {
+		stderrlogger.Printf("Failed to stop PU: %s", serr)
+	}
+
+	cleanup.EventType = monitor.EventDestroy
+	if serr := sendEvent(rpcClient, cleanup); serr != nil {
+		stderrlogger.Printf("Failed to destroy PU: %s", serr)
+	}
+
+	return exitCode, err
+}
+
+// waitAndForward relays signals to the child until it exits and returns its exit code
+func waitAndForward(cmd *exec.Cmd, signals chan os.Signal) (int, error) {
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	for {
+		select {
+		case sig := <-signals:
+			cmd.Process.Signal(sig)
+		case err := <-done:
+			if err == nil {
+				return 0, nil
+			}
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+					if status.Signaled() {
+						return 128 + int(status.Signal()), nil
+					}
+					return status.ExitStatus(), nil
+				}
+			}
+			return 1, err
+		}
+	}
+}
+
+// sendEvent sends an event to the RPC monitor
+func sendEvent(rpcClient *rpc.Client, request *rpcmonitor.EventInfo) error {
+
+	response := &rpcmonitor.RPCResponse{}
+
+	if err := rpcClient.Call(remoteMethodCall, request, response); err != nil {
+		return fmt.Errorf("Policy Server call failed %s", err.Error())
+	}
+
+	if len(response.Error) > 0 {
+		if request.EventType == monitor.EventStart {
+			return ErrPolicyDenied
+		}
+		return errors.New(response.Error)
+	}
+
+	return nil
+}
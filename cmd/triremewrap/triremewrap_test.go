@@ -0,0 +1,64 @@
+package triremewrap
+
+import (
+	"testing"
+
+	"github.com/aporeto-inc/trireme/monitor/rpcmonitor"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConfigFromArguments(t *testing.T) {
+	Convey("When I build a configuration without a command", t, func() {
+		_, err := ConfigFromArguments(map[string]interface{}{})
+
+		Convey("I should get an error", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("When I build a configuration with only a command", t, func() {
+		c, err := ConfigFromArguments(map[string]interface{}{"<command>": "/bin/true"})
+
+		Convey("I should get the defaults", func() {
+			So(err, ShouldBeNil)
+			So(c.Command, ShouldEqual, "/bin/true")
+			So(c.Ports, ShouldEqual, "0")
+			So(c.RPCAddress, ShouldEqual, rpcmonitor.DefaultRPCAddress)
+		})
+	})
+}
+
+func TestMergeEnvironment(t *testing.T) {
+	Convey("Given an environment with wrapper variables", t, func() {
+		env := map[string]string{
+			EnvLabels:      "app=web, tier=frontend,,",
+			EnvServiceName: "envservice",
+			EnvPorts:       "80",
+			EnvRPCAddress:  "/tmp/trireme.sock",
+		}
+		getenv := func(key string) string { return env[key] }
+
+		Convey("When the arguments are empty", func() {
+			c := &Config{Labels: []string{"owner=me"}}
+			c.mergeEnvironment(getenv)
+
+			Convey("I should get the values of the environment", func() {
+				So(c.Labels, ShouldResemble, []string{"owner=me", "app=web", "tier=frontend"})
+				So(c.ServiceName, ShouldEqual, "envservice")
+				So(c.Ports, ShouldEqual, "80")
+				So(c.RPCAddress, ShouldEqual, "/tmp/trireme.sock")
+			})
+		})
+
+		Convey("When the arguments are provided", func() {
+			c := &Config{ServiceName: "argservice", Ports: "443", RPCAddress: "/var/run/other.sock"}
+			c.mergeEnvironment(getenv)
+
+			Convey("The arguments should take precedence", func() {
+				So(c.ServiceName, ShouldEqual, "argservice")
+				So(c.Ports, ShouldEqual, "443")
+				So(c.RPCAddress, ShouldEqual, "/var/run/other.sock")
+			})
+		})
+	})
+}
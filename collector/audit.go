@@ -0,0 +1,186 @@
+package collector
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aporeto-inc/trireme/api/records"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	// AdminExcludeIPs indicates that IP addresses were excluded from the enforcement
+	AdminExcludeIPs = records.AdminExcludeIPs
+	// AdminQuarantine indicates that a PU was quarantined. The IPs are the networks
+	// it can still reach.
+	AdminQuarantine = records.AdminQuarantine
+	// AdminReleaseQuarantine indicates that the quarantine of a PU was lifted
+	AdminReleaseQuarantine = records.AdminReleaseQuarantine
+	// AdminEnforcerRestart indicates that the remote enforcer of a PU was restarted to
+	// run a new binary
+	AdminEnforcerRestart = records.AdminEnforcerRestart
+)
+
+// AdminRecord describes an administrative action of Trireme
+type AdminRecord = records.AdminRecord
+
+// AdminEventCollector is an optional interface of an EventCollector that wants to
+// be notified of administrative actions.
+type AdminEventCollector interface {
+
+	// CollectAdminEvent collects an administrative action
+	CollectAdminEvent(record *AdminRecord)
+}
+
+// AuditWriter is a backend that records audit messages
+type AuditWriter interface {
+
+	// WriteAudit records an audit message
+	WriteAudit(message string) error
+}
+
+// AuditCollector is an EventCollector that emits an audit record for every policy
+// denial, PU event and administrative action. All events are forwarded to the
+// wrapped collector.
+type AuditCollector struct {
+	collector EventCollector
+	writer    AuditWriter
+}
+
+// NewAuditCollector returns an AuditCollector wrapping the given collector and
+// recording the audit messages with the given writer
+func NewAuditCollector(collector EventCollector, writer AuditWriter) *AuditCollector {
+
+	return &AuditCollector{
+		collector: collector,
+		writer:    writer,
+	}
+}
+
+// CollectFlowEvent is part of the EventCollector interface. Only the rejected
+// flows are audited.
+func (a *AuditCollector) CollectFlowEvent(record *FlowRecord) {
+
+	if record.Action == FlowReject {
+		a.audit(auditMessage("flow-deny", [][2]string{
+			{"context", record.ContextID},
+			{"source", record.SourceID},
+			{"destination", record.DestinationID},
+			{"saddr", record.SourceIP},
+			{"daddr", record.DestinationIP},
+			{"dport", strconv.Itoa(int(record.DestinationPort))},
+			{"reason", record.Mode},
+		}))
+	}
+
+	a.collector.CollectFlowEvent(record)
+}
+
+// CollectContainerEvent is part of the EventCollector interface.
+func (a *AuditCollector) CollectContainerEvent(record *ContainerRecord) {
+
+	a.audit(auditMessage("pu-"+record.Event, [][2]string{
+		{"context", record.ContextID},
+		{"addr", record.IPAddress},
+	}))
+
+	a.collector.CollectContainerEvent(record)
+}
+
+// CollectAdminEvent is part of the AdminEventCollector interface.
+func (a *AuditCollector) CollectAdminEvent(record *AdminRecord) {
+
+	a.audit(auditMessage("admin-"+record.Action, [][2]string{
+		{"context", record.ContextID},
+		{"addrs", strings.Join(record.IPs, ",")},
+	}))
+
+	if c, ok := a.collector.(AdminEventCollector); ok {
+		c.CollectAdminEvent(record)
+	}
+}
+
+// CollectSecurityEvent is part of the SecurityEventCollector interface.
+func (a *AuditCollector) CollectSecurityEvent(record *SecurityRecord) {
+
+	pid := ""
+	if record.PID > 0 {
+		pid = strconv.Itoa(record.PID)
+	}
+
+	a.audit(auditMessage("security-"+record.Event, [][2]string{
+		{"context", record.ContextID},
+		{"pid", pid},
+		{"src", record.SourceIP},
+		{"details", record.Details},
+	}))
+
+	if c, ok := a.collector.(SecurityEventCollector); ok {
+		c.CollectSecurityEvent(record)
+	}
+}
+
+func (a *AuditCollector) audit(message string) {
+
+	if err := a.writer.WriteAudit(message); err != nil {
+		log.WithFields(log.Fields{
+			"package": "collector",
+			"error":   err.Error(),
+		}).Error("Failed to write audit record")
+	}
+}
+
+// auditMessage formats an audit message as key=value pairs like the other records
+// of the audit log. Empty fields are omitted and values are quoted.
+func auditMessage(op string, fields [][2]string) string {
+
+	pairs := []string{"op=" + op}
+
+	for _, field := range fields {
+		if field[1] == "" {
+			continue
+		}
+		pairs = append(pairs, field[0]+"="+strconv.Quote(field[1]))
+	}
+
+	return "trireme " + strings.Join(pairs, " ")
+}
+
+// AuditFileWriter appends the audit messages to a file, one record per line, with
+// the time of the record
+type AuditFileWriter struct {
+	file *os.File
+	sync.Mutex
+}
+
+// NewAuditFileWriter opens the file at the given path for appending audit records
+func NewAuditFileWriter(path string) (*AuditFileWriter, error) {
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open audit file %s: %s", path, err)
+	}
+
+	return &AuditFileWriter{file: file}, nil
+}
+
+// WriteAudit is part of the AuditWriter interface.
+func (w *AuditFileWriter) WriteAudit(message string) error {
+
+	w.Lock()
+	defer w.Unlock()
+
+	_, err := fmt.Fprintf(w.file, "time=%s %s\n", time.Now().UTC().Format(time.RFC3339Nano), message)
+	return err
+}
+
+// Close closes the audit file
+func (w *AuditFileWriter) Close() error {
+
+	return w.file.Close()
+}
@@ -0,0 +1,109 @@
+// +build linux
+
+package collector
+
+import (
+	"fmt"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// netlinkAudit is the netlink family of the kernel audit subsystem
+	netlinkAudit = 9
+
+	// auditTrustedApp is the type of the audit messages of trusted applications
+	auditTrustedApp = 1121
+)
+
+// AuditNetlinkWriter sends the audit messages to the kernel audit subsystem. The
+// process needs the CAP_AUDIT_WRITE capability.
+type AuditNetlinkWriter struct {
+	fd  int
+	seq uint32
+	sync.Mutex
+}
+
+// NewAuditNetlinkWriter opens a netlink socket to the audit subsystem
+func NewAuditNetlinkWriter() (*AuditNetlinkWriter, error) {
+
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW, netlinkAudit)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open audit socket: %s", err)
+	}
+
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("Unable to bind audit socket: %s", err)
+	}
+
+	return &AuditNetlinkWriter{fd: fd}, nil
+}
+
+// WriteAudit is part of the AuditWriter interface. It waits for the acknowledgment
+// of the kernel.
+func (w *AuditNetlinkWriter) WriteAudit(message string) error {
+
+	w.Lock()
+	defer w.Unlock()
+
+	w.seq++
+
+	payload := append([]byte(message), 0)
+	buf := make([]byte, syscall.NLMSG_HDRLEN+len(payload))
+
+	*(*syscall.NlMsghdr)(unsafe.Pointer(&buf[0])) = syscall.NlMsghdr{
+		Len:   uint32(len(buf)),
+		Type:  auditTrustedApp,
+		Flags: syscall.NLM_F_REQUEST | syscall.NLM_F_ACK,
+		Seq:   w.seq,
+	}
+	copy(buf[syscall.NLMSG_HDRLEN:], payload)
+
+	if err := syscall.Sendto(w.fd, buf, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return fmt.Errorf("Unable to send audit message: %s", err)
+	}
+
+	return w.ack()
+}
+
+// ack reads the acknowledgment of the last message
+func (w *AuditNetlinkWriter) ack() error {
+
+	buf := make([]byte, syscall.Getpagesize())
+
+	for {
+		n, _, err := syscall.Recvfrom(w.fd, buf, 0)
+		if err != nil {
+			return fmt.Errorf("Unable to read audit acknowledgment: %s", err)
+		}
+
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return fmt.Errorf("Invalid audit acknowledgment: %s", err)
+		}
+
+		for _, m := range msgs {
+			if m.Header.Seq != w.seq || m.Header.Type != syscall.NLMSG_ERROR {
+				continue
+			}
+
+			if len(m.Data) < 4 {
+				return fmt.Errorf("Invalid audit acknowledgment")
+			}
+
+			if errno := *(*int32)(unsafe.Pointer(&m.Data[0])); errno != 0 {
+				return fmt.Errorf("Audit message rejected: %s", syscall.Errno(-errno))
+			}
+
+			return nil
+		}
+	}
+}
+
+// Close closes the audit socket
+func (w *AuditNetlinkWriter) Close() error {
+
+	return syscall.Close(w.fd)
+}
@@ -0,0 +1,26 @@
+// +build !linux
+
+package collector
+
+import "fmt"
+
+// AuditNetlinkWriter sends the audit messages to the kernel audit subsystem
+type AuditNetlinkWriter struct{}
+
+// NewAuditNetlinkWriter is not supported on this platform
+func NewAuditNetlinkWriter() (*AuditNetlinkWriter, error) {
+
+	return nil, fmt.Errorf("Audit subsystem not supported on this platform")
+}
+
+// WriteAudit is part of the AuditWriter interface.
+func (w *AuditNetlinkWriter) WriteAudit(message string) error {
+
+	return fmt.Errorf("Audit subsystem not supported on this platform")
+}
+
+// Close closes the audit socket
+func (w *AuditNetlinkWriter) Close() error {
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package collector
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type auditRecorder struct {
+	messages []string
+}
+
+func (w *auditRecorder) WriteAudit(message string) error {
+	w.messages = append(w.messages, message)
+	return nil
+}
+
+type adminCollector struct {
+	DefaultCollector
+	flows  int
+	admins []*AdminRecord
+}
+
+func (c *adminCollector) CollectFlowEvent(record *FlowRecord) {
+	c.flows++
+}
+
+func (c *adminCollector) CollectAdminEvent(record *AdminRecord) {
+	c.admins = append(c.admins, record)
+}
+
+func TestAuditCollector(t *testing.T) {
+	Convey("Given an audit collector", t, func() {
+		c := &adminCollector{}
+		w := &auditRecorder{}
+		a := NewAuditCollector(c, w)
+
+		Convey("When I collect an accepted and a rejected flow", func() {
+			a.CollectFlowEvent(&FlowRecord{ContextID: "pu1", SourceID: "src", DestinationPort: 80, Action: FlowAccept})
+			a.CollectFlowEvent(&FlowRecord{ContextID: "pu1", SourceID: "src", SourceIP: "10.1.1.1", DestinationPort: 80, Action: FlowReject, Mode: PolicyDrop})
+
+			Convey("Only the denial should be audited and both flows forwarded", func() {
+				So(len(w.messages), ShouldEqual, 1)
+				So(w.messages[0], ShouldEqual, `trireme op=flow-deny context="pu1" source="src" saddr="10.1.1.1" dport="80" reason="policy"`)
+				So(c.flows, ShouldEqual, 2)
+			})
+		})
+
+		Convey("When I collect a policy update", func() {
+			a.CollectContainerEvent(&ContainerRecord{ContextID: "pu1", IPAddress: "10.1.1.2", Event: ContainerUpdate})
+
+			Convey("It should be audited", func() {
+				So(w.messages, ShouldResemble, []string{`trireme op=pu-update context="pu1" addr="10.1.1.2"`})
+			})
+		})
+
+		Convey("When I collect a security event", func() {
+			a.CollectSecurityEvent(&SecurityRecord{Event: SecurityPIDRecycled, ContextID: "pu1", PID: 42, Details: "start time changed"})
+
+			Convey("It should be audited", func() {
+				So(w.messages, ShouldResemble, []string{`trireme op=security-pidrecycled context="pu1" pid="42" details="start time changed"`})
+			})
+		})
+
+		Convey("When I collect an exclusion", func() {
+			a.CollectAdminEvent(&AdminRecord{Action: AdminExcludeIPs, IPs: []string{"10.0.0.1", "10.0.0.2"}})
+
+			Convey("It should be audited and forwarded", func() {
+				So(w.messages, ShouldResemble, []string{`trireme op=admin-excludeips addrs="10.0.0.1,10.0.0.2"`})
+				So(len(c.admins), ShouldEqual, 1)
+			})
+		})
+	})
+
+	Convey("Given an audit file writer", t, func() {
+		dir, err := ioutil.TempDir("", "audit")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		w, err := NewAuditFileWriter(dir + "/audit.log")
+		So(err, ShouldBeNil)
+
+		Convey("When I write two records", func() {
+			So(w.WriteAudit("trireme op=one"), ShouldBeNil)
+			So(w.WriteAudit("trireme op=two"), ShouldBeNil)
+			So(w.Close(), ShouldBeNil)
+
+			Convey("The file should contain one timestamped line per record", func() {
+				data, err := ioutil.ReadFile(dir + "/audit.log")
+				So(err, ShouldBeNil)
+				lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+				So(len(lines), ShouldEqual, 2)
+				So(lines[0], ShouldStartWith, "time=")
+				So(strings.HasSuffix(lines[0], "trireme op=one"), ShouldBeTrue)
+				So(strings.HasSuffix(lines[1], "trireme op=two"), ShouldBeTrue)
+			})
+		})
+	})
+}
@@ -0,0 +1,27 @@
+package collector
+
+import "github.com/aporeto-inc/trireme/api/records"
+
+// Directions of the traffic of the rules of a BandwidthRecord
+const (
+	// BandwidthApplication is the traffic sent by the PU, matched by its application ACLs
+	BandwidthApplication = records.BandwidthApplication
+	// BandwidthNetwork is the traffic received by the PU, matched by its network ACLs
+	BandwidthNetwork = records.BandwidthNetwork
+)
+
+// RuleBandwidth is the traffic matched by an ACL of a PU during an accounting
+// interval. Only the packets of the new flows are matched by the ACLs, the packets
+// of the established flows are accounted for in the totals of the PU.
+type RuleBandwidth = records.RuleBandwidth
+
+// BandwidthRecord is the traffic of a PU during an accounting interval
+type BandwidthRecord = records.BandwidthRecord
+
+// BandwidthEventCollector is an optional interface of an EventCollector that wants
+// the traffic of the PUs reported by the supervisors that account for it.
+type BandwidthEventCollector interface {
+
+	// CollectBandwidthEvent collects the traffic of a PU during an interval
+	CollectBandwidthEvent(record *BandwidthRecord)
+}
@@ -1,7 +1,5 @@
 package collector
 
-import "strconv"
-
 // DefaultCollector implements a default collector infrastructure to syslog
 type DefaultCollector struct{}
 
@@ -15,7 +13,7 @@ func (d *DefaultCollector) CollectContainerEvent(record *ContainerRecord) {
 	return
 }
 
-// StatsFlowHash is a has function to hash flows
+// StatsFlowHash is a has function to hash flows. It uses the default aggregation key.
 func StatsFlowHash(r *FlowRecord) string {
-	return r.SourceID + ":" + r.DestinationID + ":" + strconv.Itoa(int(r.DestinationPort)) + ":" + r.Action + ":" + r.Mode
+	return defaultFlowKey.Hash(r)
 }
@@ -0,0 +1,127 @@
+package collector
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strconv"
+)
+
+// FlowKeyField is a field of the flow records that can be part of the aggregation key
+type FlowKeyField int
+
+const (
+	// FlowKeyContextID is the context of the PU that reported the flow
+	FlowKeyContextID FlowKeyField = iota
+	// FlowKeySourceID is the identity of the source
+	FlowKeySourceID
+	// FlowKeyDestinationID is the identity of the destination
+	FlowKeyDestinationID
+	// FlowKeySourceIP is the address of the source
+	FlowKeySourceIP
+	// FlowKeyDestinationIP is the address of the destination
+	FlowKeyDestinationIP
+	// FlowKeyDestinationPort is the destination port
+	FlowKeyDestinationPort
+	// FlowKeyAction is the action applied to the flow
+	FlowKeyAction
+	// FlowKeyMode is the reason of a rejected flow
+	FlowKeyMode
+	// FlowKeyProcess is the process of the flow
+	FlowKeyProcess
+)
+
+var flowKeyNames = map[string]FlowKeyField{
+	"context":       FlowKeyContextID,
+	"source":        FlowKeySourceID,
+	"destination":   FlowKeyDestinationID,
+	"sourceip":      FlowKeySourceIP,
+	"destinationip": FlowKeyDestinationIP,
+	"port":          FlowKeyDestinationPort,
+	"action":        FlowKeyAction,
+	"reason":        FlowKeyMode,
+	"process":       FlowKeyProcess,
+}
+
+// DefaultFlowKeyFields are the fields of the default aggregation key
+var DefaultFlowKeyFields = []FlowKeyField{
+	FlowKeySourceID,
+	FlowKeyDestinationID,
+	FlowKeyDestinationPort,
+	FlowKeyAction,
+	FlowKeyMode,
+}
+
+var defaultFlowKey = NewFlowKey(DefaultFlowKeyFields...)
+
+// ParseFlowKeyFields returns the fields of an aggregation key from their names, as
+// used in the configuration of a deployment
+func ParseFlowKeyFields(names []string) ([]FlowKeyField, error) {
+
+	fields := []FlowKeyField{}
+
+	for _, name := range names {
+		field, ok := flowKeyNames[name]
+		if !ok {
+			return nil, fmt.Errorf("Unknown flow key field %s", name)
+		}
+		fields = append(fields, field)
+	}
+
+	return fields, nil
+}
+
+// FlowKey computes the aggregation key of the flow records. The records with the
+// same key are reported as a single record with the sum of their counts.
+type FlowKey struct {
+	fields []FlowKeyField
+}
+
+// NewFlowKey returns a FlowKey of the given fields
+func NewFlowKey(fields ...FlowKeyField) *FlowKey {
+
+	return &FlowKey{fields: fields}
+}
+
+// Hash returns the key of the record. Every field is written with its length before
+// it is hashed, so that different records cannot produce the same input.
+func (k *FlowKey) Hash(r *FlowRecord) string {
+
+	h := sha256.New()
+
+	for _, field := range k.fields {
+		switch field {
+		case FlowKeyContextID:
+			writeKeyField(h, r.ContextID)
+		case FlowKeySourceID:
+			writeKeyField(h, r.SourceID)
+		case FlowKeyDestinationID:
+			writeKeyField(h, r.DestinationID)
+		case FlowKeySourceIP:
+			writeKeyField(h, r.SourceIP)
+		case FlowKeyDestinationIP:
+			writeKeyField(h, r.DestinationIP)
+		case FlowKeyDestinationPort:
+			writeKeyField(h, strconv.Itoa(int(r.DestinationPort)))
+		case FlowKeyAction:
+			writeKeyField(h, r.Action)
+		case FlowKeyMode:
+			writeKeyField(h, r.Mode)
+		case FlowKeyProcess:
+			writeKeyField(h, r.ProcessPath)
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+func writeKeyField(h hash.Hash, value string) {
+
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(value)))
+
+	h.Write(length[:])
+	h.Write([]byte(value))
+}
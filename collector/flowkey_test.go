@@ -0,0 +1,48 @@
+package collector
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFlowKey(t *testing.T) {
+	Convey("Given two records whose fields concatenate to the same string", t, func() {
+		a := &FlowRecord{SourceID: "web:1", DestinationID: "db", DestinationPort: 80}
+		b := &FlowRecord{SourceID: "web", DestinationID: "1:db", DestinationPort: 80}
+
+		Convey("They should have different default keys", func() {
+			So(StatsFlowHash(a), ShouldNotEqual, StatsFlowHash(b))
+		})
+	})
+
+	Convey("Given a key without the destination port", t, func() {
+		key := NewFlowKey(FlowKeySourceID, FlowKeyDestinationID, FlowKeyMode)
+
+		Convey("Records to different ports should be aggregated", func() {
+			a := &FlowRecord{SourceID: "web", DestinationID: "db", DestinationPort: 80, Mode: PolicyDrop}
+			b := &FlowRecord{SourceID: "web", DestinationID: "db", DestinationPort: 443, Mode: PolicyDrop}
+			So(key.Hash(a), ShouldEqual, key.Hash(b))
+		})
+
+		Convey("Records with different drop reasons should not be aggregated", func() {
+			a := &FlowRecord{SourceID: "web", DestinationID: "db", Mode: PolicyDrop}
+			b := &FlowRecord{SourceID: "web", DestinationID: "db", Mode: InvalidToken}
+			So(key.Hash(a), ShouldNotEqual, key.Hash(b))
+		})
+	})
+
+	Convey("Given the names of the fields of a key", t, func() {
+
+		Convey("They should be parsed", func() {
+			fields, err := ParseFlowKeyFields([]string{"source", "destination", "reason"})
+			So(err, ShouldBeNil)
+			So(fields, ShouldResemble, []FlowKeyField{FlowKeySourceID, FlowKeyDestinationID, FlowKeyMode})
+		})
+
+		Convey("An unknown name should be rejected", func() {
+			_, err := ParseFlowKeyFields([]string{"sourceport"})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
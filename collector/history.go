@@ -0,0 +1,82 @@
+package collector
+
+import "sync"
+
+// EventHistory is an optional interface of an EventCollector that keeps the recent
+// events, so that they can be attached to the support bundles.
+type EventHistory interface {
+
+	// RecentEvents returns the recent flow and container events, oldest first.
+	RecentEvents() ([]*FlowRecord, []*ContainerRecord)
+}
+
+// HistoryCollector is an EventCollector that keeps the last events it collected.
+// All events are forwarded to the wrapped collector.
+type HistoryCollector struct {
+	collector EventCollector
+	size      int
+	// flows and containers are ring buffers whose oldest event is at the next index
+	// once they are full
+	flows         []*FlowRecord
+	nextFlow      int
+	containers    []*ContainerRecord
+	nextContainer int
+	sync.Mutex
+}
+
+// NewHistoryCollector returns a HistoryCollector wrapping the given collector and
+// keeping the last size flow events and the last size container events
+func NewHistoryCollector(collector EventCollector, size int) *HistoryCollector {
+
+	return &HistoryCollector{
+		collector:  collector,
+		size:       size,
+		flows:      []*FlowRecord{},
+		containers: []*ContainerRecord{},
+	}
+}
+
+// CollectFlowEvent is part of the EventCollector interface.
+func (h *HistoryCollector) CollectFlowEvent(record *FlowRecord) {
+
+	h.Lock()
+	if len(h.flows) < h.size {
+		h.flows = append(h.flows, record)
+	} else if h.size > 0 {
+		h.flows[h.nextFlow] = record
+		h.nextFlow = (h.nextFlow + 1) % h.size
+	}
+	h.Unlock()
+
+	h.collector.CollectFlowEvent(record)
+}
+
+// CollectContainerEvent is part of the EventCollector interface.
+func (h *HistoryCollector) CollectContainerEvent(record *ContainerRecord) {
+
+	h.Lock()
+	if len(h.containers) < h.size {
+		h.containers = append(h.containers, record)
+	} else if h.size > 0 {
+		h.containers[h.nextContainer] = record
+		h.nextContainer = (h.nextContainer + 1) % h.size
+	}
+	h.Unlock()
+
+	h.collector.CollectContainerEvent(record)
+}
+
+// RecentEvents implements the EventHistory interface
+func (h *HistoryCollector) RecentEvents() ([]*FlowRecord, []*ContainerRecord) {
+
+	h.Lock()
+	defer h.Unlock()
+
+	flows := append([]*FlowRecord{}, h.flows[h.nextFlow:]...)
+	flows = append(flows, h.flows[:h.nextFlow]...)
+
+	containers := append([]*ContainerRecord{}, h.containers[h.nextContainer:]...)
+	containers = append(containers, h.containers[:h.nextContainer]...)
+
+	return flows, containers
+}
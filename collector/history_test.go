@@ -0,0 +1,28 @@
+package collector
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHistoryCollector(t *testing.T) {
+	Convey("Given a history collector of size 2", t, func() {
+		c := &peerCollector{}
+		h := NewHistoryCollector(c, 2)
+
+		Convey("The recent events should be kept oldest first and forwarded", func() {
+			h.CollectFlowEvent(&FlowRecord{ContextID: "pu1"})
+			h.CollectFlowEvent(&FlowRecord{ContextID: "pu2"})
+			h.CollectFlowEvent(&FlowRecord{ContextID: "pu3"})
+			h.CollectContainerEvent(&ContainerRecord{ContextID: "pu1"})
+
+			flows, containers := h.RecentEvents()
+			So(len(flows), ShouldEqual, 2)
+			So(flows[0].ContextID, ShouldEqual, "pu2")
+			So(flows[1].ContextID, ShouldEqual, "pu3")
+			So(len(containers), ShouldEqual, 1)
+			So(c.flows, ShouldEqual, 3)
+		})
+	})
+}
@@ -1,44 +1,74 @@
 package collector
 
-import "github.com/aporeto-inc/trireme/policy"
+import "github.com/aporeto-inc/trireme/api/records"
 
 const (
 	// FlowReject indicates that a flow was rejected
-	FlowReject = "reject"
+	FlowReject = records.FlowReject
 	// FlowAccept logs that a flow is accepted
-	FlowAccept = "accept"
+	FlowAccept = records.FlowAccept
 	// MissingToken indicates that the token was missing
-	MissingToken = "missingtoken"
+	MissingToken = records.MissingToken
 	// InvalidToken indicates that the token was invalid
-	InvalidToken = "token"
+	InvalidToken = records.InvalidToken
 	// InvalidFormat indicates that the packet metadata were not correct
-	InvalidFormat = "format"
+	InvalidFormat = records.InvalidFormat
 	// InvalidContext indicates that there was no context in the metadata
-	InvalidContext = "context"
+	InvalidContext = records.InvalidContext
 	// InvalidState indicates that a packet was received without proper state information
-	InvalidState = "state"
+	InvalidState = records.InvalidState
 	// InvalidNonse indicates that the nonse check failed
-	InvalidNonse = "nonse"
+	InvalidNonse = records.InvalidNonse
 	// PolicyDrop indicates that the flow is rejected because of the policy decision
-	PolicyDrop = "policy"
+	PolicyDrop = records.PolicyDrop
+	// IdentityRevoked indicates that an accepted flow is no longer accepted after an
+	// identity update of its peer
+	IdentityRevoked = records.IdentityRevoked
+	// ReauthorizationFailed indicates that an established flow is no longer accepted
+	// by the current policy of its PU
+	ReauthorizationFailed = records.ReauthorizationFailed
+	// TrustedNetwork indicates that a flow of a trusted network was accepted without
+	// the identity handshake
+	TrustedNetwork = records.TrustedNetwork
+	// InvalidIssuer indicates that the certificate of the peer was not issued by a
+	// certificate authority accepted by the issuer rules of the PU
+	InvalidIssuer = records.InvalidIssuer
+	// DNSPolicyDrop indicates that a DNS query was dropped by the DNS policy of the PU
+	DNSPolicyDrop = records.DNSPolicyDrop
+	// HandshakeBlocked indicates that the handshake of a source blocked after
+	// repeated handshake anomalies was rejected
+	HandshakeBlocked = records.HandshakeBlocked
+	// PreExistingFlow indicates that flows established before the supervision of
+	// their PU were kept or terminated
+	PreExistingFlow = records.PreExistingFlow
+	// FlowVolume indicates the report of the traffic of an accepted flow since its
+	// previous report
+	FlowVolume = records.FlowVolume
 	// ContainerStart indicates a container start event
-	ContainerStart = "start"
+	ContainerStart = records.ContainerStart
 	// ContainerStop indicates a container stop event
-	ContainerStop = "stop"
+	ContainerStop = records.ContainerStop
 	// ContainerCreate indicates a container create event
-	ContainerCreate = "create"
+	ContainerCreate = records.ContainerCreate
 	// ContainerDelete indicates a container delete event
-	ContainerDelete = "delete"
+	ContainerDelete = records.ContainerDelete
 	// ContainerUpdate indicates a container policy update event
-	ContainerUpdate = "update"
+	ContainerUpdate = records.ContainerUpdate
 	// ContainerFailed indicates an event that a container was stopped because of policy issues
-	ContainerFailed = "forcestop"
+	ContainerFailed = records.ContainerFailed
 	// ContainerIgnored indicates that the container will be ignored by Trireme
-	ContainerIgnored = "ignore"
+	ContainerIgnored = records.ContainerIgnored
 	// UnknownContainerDelete indicates that policy for an unknwon container was deleted
-	UnknownContainerDelete = "unknowncontainer"
+	UnknownContainerDelete = records.UnknownContainerDelete
+	// ContainerTagsTruncated indicates that identity tags of a container were not transmitted
+	// because its tokens exceeded the size budget
+	ContainerTagsTruncated = records.ContainerTagsTruncated
+	// RejectionDrop indicates that the packets of a rejected flow were dropped
+	RejectionDrop = records.RejectionDrop
+	// RejectionReset indicates that a rejected flow was reset
+	RejectionReset = records.RejectionReset
 	// PolicyValid Normal flow accept
-	PolicyValid = "V"
+	PolicyValid = records.PolicyValid
 )
 
 // EventCollector is the interface for collecting events.
@@ -52,23 +82,7 @@ type EventCollector interface {
 }
 
 // FlowRecord describes a flow record for statistis
-type FlowRecord struct {
-	ContextID       string
-	Count           int
-	SourceID        string
-	DestinationID   string
-	SourceIP        string
-	DestinationIP   string
-	DestinationPort uint16
-	Tags            *policy.TagsMap
-	Action          string
-	Mode            string
-}
+type FlowRecord = records.FlowRecord
 
 // ContainerRecord is a statistics record for a container
-type ContainerRecord struct {
-	ContextID string
-	IPAddress string
-	Tags      *policy.TagsMap
-	Event     string
-}
+type ContainerRecord = records.ContainerRecord
@@ -0,0 +1,16 @@
+package collector
+
+import "github.com/aporeto-inc/trireme/api/records"
+
+// LatencyRecord is the latency of the handshakes of the flows of a PU during a
+// reporting interval
+type LatencyRecord = records.LatencyRecord
+
+// LatencyEventCollector is an optional interface of an EventCollector that wants the
+// latency of the handshakes of the PUs reported by the enforcers that measure it.
+type LatencyEventCollector interface {
+
+	// CollectLatencyEvent collects the latency of the handshakes of a PU during an
+	// interval
+	CollectLatencyEvent(record *LatencyRecord)
+}
@@ -0,0 +1,105 @@
+package collector
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/aporeto-inc/trireme/api/records"
+)
+
+// PeerRecord describes a pair of peers seen for the first time by a PU
+type PeerRecord = records.PeerRecord
+
+// PeerEventCollector is an optional interface of an EventCollector that wants
+// to be notified of first-seen peer pairs by the PeerDetector.
+type PeerEventCollector interface {
+
+	// CollectPeerEvent collects a first-seen peer pair
+	CollectPeerEvent(record *PeerRecord)
+}
+
+// PeerDetector is an EventCollector that tracks the set of (source, destination, port)
+// tuples of every PU and reports the tuples seen for the first time. All events
+// are forwarded to the wrapped collector.
+type PeerDetector struct {
+	collector EventCollector
+	callback  func(record *PeerRecord)
+	maxPeers  int
+	peers     map[string]map[string]struct{}
+	sync.Mutex
+}
+
+// NewPeerDetector returns a PeerDetector wrapping the given collector. The callback
+// is invoked for every first-seen peer pair and can be nil. maxPeers limits the
+// number of pairs tracked per PU. A value of 0 means no limit.
+func NewPeerDetector(collector EventCollector, callback func(record *PeerRecord), maxPeers int) *PeerDetector {
+
+	return &PeerDetector{
+		collector: collector,
+		callback:  callback,
+		maxPeers:  maxPeers,
+		peers:     map[string]map[string]struct{}{},
+	}
+}
+
+// CollectFlowEvent is part of the EventCollector interface.
+func (p *PeerDetector) CollectFlowEvent(record *FlowRecord) {
+
+	if record.Action == FlowAccept || record.Mode == PolicyDrop {
+		if peer := p.firstSeen(record); peer != nil {
+			if p.callback != nil {
+				p.callback(peer)
+			}
+			if c, ok := p.collector.(PeerEventCollector); ok {
+				c.CollectPeerEvent(peer)
+			}
+		}
+	}
+
+	p.collector.CollectFlowEvent(record)
+}
+
+// CollectContainerEvent is part of the EventCollector interface. The peers
+// of a PU are forgotten when the PU is deleted.
+func (p *PeerDetector) CollectContainerEvent(record *ContainerRecord) {
+
+	if record.Event == ContainerDelete {
+		p.Lock()
+		delete(p.peers, record.ContextID)
+		p.Unlock()
+	}
+
+	p.collector.CollectContainerEvent(record)
+}
+
+// firstSeen records the peers of a flow and returns a PeerRecord if they were not known
+func (p *PeerDetector) firstSeen(record *FlowRecord) *PeerRecord {
+
+	p.Lock()
+	defer p.Unlock()
+
+	peers, ok := p.peers[record.ContextID]
+	if !ok {
+		peers = map[string]struct{}{}
+		p.peers[record.ContextID] = peers
+	}
+
+	key := record.SourceID + ":" + record.DestinationID + ":" + strconv.Itoa(int(record.DestinationPort))
+	if _, ok := peers[key]; ok {
+		return nil
+	}
+
+	if p.maxPeers > 0 && len(peers) >= p.maxPeers {
+		return nil
+	}
+
+	peers[key] = struct{}{}
+
+	return &PeerRecord{
+		ContextID:       record.ContextID,
+		SourceID:        record.SourceID,
+		DestinationID:   record.DestinationID,
+		DestinationPort: record.DestinationPort,
+		Action:          record.Action,
+	}
+}
@@ -0,0 +1,73 @@
+package collector
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type peerCollector struct {
+	DefaultCollector
+	flows int
+	peers []*PeerRecord
+}
+
+func (c *peerCollector) CollectFlowEvent(record *FlowRecord) {
+	c.flows++
+}
+
+func (c *peerCollector) CollectPeerEvent(record *PeerRecord) {
+	c.peers = append(c.peers, record)
+}
+
+func TestPeerDetector(t *testing.T) {
+	Convey("Given a peer detector", t, func() {
+		c := &peerCollector{}
+		seen := []*PeerRecord{}
+		d := NewPeerDetector(c, func(r *PeerRecord) { seen = append(seen, r) }, 2)
+
+		flow := &FlowRecord{ContextID: "pu1", SourceID: "src", DestinationID: "dst", DestinationPort: 80, Action: FlowAccept}
+
+		Convey("When I collect the same flow twice", func() {
+			d.CollectFlowEvent(flow)
+			d.CollectFlowEvent(flow)
+
+			Convey("The pair should be reported once and the flows forwarded", func() {
+				So(len(seen), ShouldEqual, 1)
+				So(seen[0].SourceID, ShouldEqual, "src")
+				So(seen[0].DestinationPort, ShouldEqual, 80)
+				So(len(c.peers), ShouldEqual, 1)
+				So(c.flows, ShouldEqual, 2)
+			})
+		})
+
+		Convey("When I collect a flow rejected because of an invalid token", func() {
+			d.CollectFlowEvent(&FlowRecord{ContextID: "pu1", SourceID: "src", Action: FlowReject, Mode: InvalidToken})
+
+			Convey("No pair should be reported", func() {
+				So(len(seen), ShouldEqual, 0)
+				So(c.flows, ShouldEqual, 1)
+			})
+		})
+
+		Convey("When I collect more pairs than the limit", func() {
+			for port := uint16(1); port <= 3; port++ {
+				d.CollectFlowEvent(&FlowRecord{ContextID: "pu1", SourceID: "src", DestinationPort: port, Action: FlowAccept})
+			}
+
+			Convey("Only the pairs up to the limit should be reported", func() {
+				So(len(seen), ShouldEqual, 2)
+			})
+		})
+
+		Convey("When the PU is deleted", func() {
+			d.CollectFlowEvent(flow)
+			d.CollectContainerEvent(&ContainerRecord{ContextID: "pu1", Event: ContainerDelete})
+			d.CollectFlowEvent(flow)
+
+			Convey("The pair should be reported again", func() {
+				So(len(seen), ShouldEqual, 2)
+			})
+		})
+	})
+}
@@ -0,0 +1,335 @@
+package collector
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aporeto-inc/trireme/policy"
+)
+
+// PrivacyField is a field of the records that can be hashed or dropped by the
+// PrivacyCollector
+type PrivacyField string
+
+const (
+	// PrivacySourceIP is the address of the source of the flows
+	PrivacySourceIP PrivacyField = "sourceip"
+	// PrivacyDestinationIP is the address of the destination of the flows
+	PrivacyDestinationIP PrivacyField = "destinationip"
+	// PrivacySourceID is the identity of the source of the flows
+	PrivacySourceID PrivacyField = "source"
+	// PrivacyDestinationID is the identity of the destination of the flows
+	PrivacyDestinationID PrivacyField = "destination"
+	// PrivacyProcess is the path and the command line of the process of the flows
+	PrivacyProcess PrivacyField = "process"
+	// PrivacyPUIP is the address of the PU in the container records
+	PrivacyPUIP PrivacyField = "puip"
+)
+
+var privacyFields = map[PrivacyField]bool{
+	PrivacySourceIP:      true,
+	PrivacyDestinationIP: true,
+	PrivacySourceID:      true,
+	PrivacyDestinationID: true,
+	PrivacyProcess:       true,
+	PrivacyPUIP:          true,
+}
+
+// ParsePrivacyFields returns the fields of their names, as used in the configuration
+// of a deployment
+func ParsePrivacyFields(names []string) ([]PrivacyField, error) {
+
+	fields := []PrivacyField{}
+
+	for _, name := range names {
+		if !privacyFields[PrivacyField(name)] {
+			return nil, fmt.Errorf("Unknown privacy field %s", name)
+		}
+		fields = append(fields, PrivacyField(name))
+	}
+
+	return fields, nil
+}
+
+// PrivacyConfig selects the values the PrivacyCollector hashes or drops. A value both
+// hashed and dropped is dropped.
+type PrivacyConfig struct {
+	// HashedFields are the fields replaced by their hash
+	HashedFields []PrivacyField
+	// DroppedFields are the fields removed from the records
+	DroppedFields []PrivacyField
+	// HashedTags are the keys of the tags whose values are replaced by their hash, in
+	// the tags of the PUs and the identities of the peers
+	HashedTags []string
+	// DroppedTags are the keys of the tags removed from the records
+	DroppedTags []string
+	// SaltRotation is the interval after which the salt of the hashes is replaced. The
+	// hashes of a value only match within an interval. Zero never replaces it.
+	SaltRotation time.Duration
+}
+
+// redacted is the value of the dropped fields
+const redacted = ""
+
+// PrivacyCollector is an EventCollector that hashes or drops the personal data of
+// the records before they are forwarded to the wrapped collector, so that they
+// never leave the host. The values are hashed with a random salt, so the hashes
+// only tell whether two records have the same value.
+type PrivacyCollector struct {
+	collector EventCollector
+	fields    map[PrivacyField]bool
+	tags      map[string]bool
+	rotation  time.Duration
+	now       func() time.Time
+	salt      []byte
+	saltTime  time.Time
+	sync.Mutex
+}
+
+// NewPrivacyCollector returns a PrivacyCollector wrapping the given collector
+func NewPrivacyCollector(collector EventCollector, config *PrivacyConfig) (*PrivacyCollector, error) {
+
+	// The value of a field is true if it is dropped and false if it is hashed
+	fields := map[PrivacyField]bool{}
+	for _, f := range config.HashedFields {
+		fields[f] = false
+	}
+	for _, f := range config.DroppedFields {
+		fields[f] = true
+	}
+
+	tags := map[string]bool{}
+	for _, k := range config.HashedTags {
+		tags[k] = false
+	}
+	for _, k := range config.DroppedTags {
+		tags[k] = true
+	}
+
+	p := &PrivacyCollector{
+		collector: collector,
+		fields:    fields,
+		tags:      tags,
+		rotation:  config.SaltRotation,
+		now:       time.Now,
+	}
+
+	if err := p.rotate(p.now()); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// rotate replaces the salt. It must be called with the lock held.
+func (p *PrivacyCollector) rotate(now time.Time) error {
+
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("Cannot generate the salt of the privacy mode: %s", err)
+	}
+
+	p.salt = salt
+	p.saltTime = now
+
+	return nil
+}
+
+// currentSalt returns the salt, after replacing it if it expired
+func (p *PrivacyCollector) currentSalt() []byte {
+
+	p.Lock()
+	defer p.Unlock()
+
+	if now := p.now(); p.rotation > 0 && now.Sub(p.saltTime) >= p.rotation {
+		// The previous salt is kept if no salt can be generated, rather than
+		// exporting the values in clear
+		if err := p.rotate(now); err != nil {
+			log.WithFields(log.Fields{
+				"package": "collector",
+				"error":   err.Error(),
+			}).Warn("Failed to rotate the salt of the privacy mode")
+		}
+	}
+
+	return p.salt
+}
+
+// saltedHash returns the hash of a value with the salt
+func saltedHash(salt []byte, value string) string {
+
+	if value == "" {
+		return value
+	}
+
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte(value))
+
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// field returns the value of a field after applying the privacy mode
+func (p *PrivacyCollector) field(salt []byte, f PrivacyField, value string) string {
+
+	dropped, ok := p.fields[f]
+	if !ok {
+		return value
+	}
+
+	if dropped {
+		return redacted
+	}
+
+	return saltedHash(salt, value)
+}
+
+// tagsMap returns a copy of the tags after applying the privacy mode
+func (p *PrivacyCollector) tagsMap(salt []byte, tags *policy.TagsMap) *policy.TagsMap {
+
+	if tags == nil || len(p.tags) == 0 {
+		return tags
+	}
+
+	private := policy.NewTagsMap(nil)
+	for k, v := range tags.Tags {
+		dropped, ok := p.tags[k]
+		switch {
+		case !ok:
+			private.Add(k, v)
+		case !dropped:
+			private.Add(k, saltedHash(salt, v))
+		}
+	}
+
+	return private
+}
+
+// CollectFlowEvent is part of the EventCollector interface. The wrapped collector
+// receives a copy of the record.
+func (p *PrivacyCollector) CollectFlowEvent(record *FlowRecord) {
+
+	salt := p.currentSalt()
+
+	private := *record
+	private.SourceIP = p.field(salt, PrivacySourceIP, record.SourceIP)
+	private.DestinationIP = p.field(salt, PrivacyDestinationIP, record.DestinationIP)
+	private.SourceID = p.field(salt, PrivacySourceID, record.SourceID)
+	private.DestinationID = p.field(salt, PrivacyDestinationID, record.DestinationID)
+	private.ProcessPath = p.field(salt, PrivacyProcess, record.ProcessPath)
+	private.ProcessCmdline = p.field(salt, PrivacyProcess, record.ProcessCmdline)
+	private.Tags = p.tagsMap(salt, record.Tags)
+	private.PeerIdentity = p.tagsMap(salt, record.PeerIdentity)
+
+	p.collector.CollectFlowEvent(&private)
+}
+
+// CollectContainerEvent is part of the EventCollector interface. The wrapped
+// collector receives a copy of the record.
+func (p *PrivacyCollector) CollectContainerEvent(record *ContainerRecord) {
+
+	salt := p.currentSalt()
+
+	private := *record
+	private.IPAddress = p.field(salt, PrivacyPUIP, record.IPAddress)
+	private.Tags = p.tagsMap(salt, record.Tags)
+
+	p.collector.CollectContainerEvent(&private)
+}
+
+// CollectPeerEvent is part of the PeerEventCollector interface.
+func (p *PrivacyCollector) CollectPeerEvent(record *PeerRecord) {
+
+	c, ok := p.collector.(PeerEventCollector)
+	if !ok {
+		return
+	}
+
+	salt := p.currentSalt()
+
+	private := *record
+	private.SourceID = p.field(salt, PrivacySourceID, record.SourceID)
+	private.DestinationID = p.field(salt, PrivacyDestinationID, record.DestinationID)
+
+	c.CollectPeerEvent(&private)
+}
+
+// CollectAdminEvent is part of the AdminEventCollector interface. The administrative
+// actions carry no personal data and are forwarded as they are.
+func (p *PrivacyCollector) CollectAdminEvent(record *AdminRecord) {
+
+	if c, ok := p.collector.(AdminEventCollector); ok {
+		c.CollectAdminEvent(record)
+	}
+}
+
+// CollectSecurityEvent is part of the SecurityEventCollector interface. The wrapped
+// collector receives a copy of the record whose source is treated like the source
+// of the flows.
+func (p *PrivacyCollector) CollectSecurityEvent(record *SecurityRecord) {
+
+	if c, ok := p.collector.(SecurityEventCollector); ok {
+		private := *record
+		private.SourceIP = p.field(p.currentSalt(), PrivacySourceIP, record.SourceIP)
+
+		c.CollectSecurityEvent(&private)
+	}
+}
+
+// CollectStatsEvent is part of the StatsEventCollector interface.
+func (p *PrivacyCollector) CollectStatsEvent(record *StatsRecord) {
+
+	if c, ok := p.collector.(StatsEventCollector); ok {
+		c.CollectStatsEvent(record)
+	}
+}
+
+// CollectBandwidthEvent is part of the BandwidthEventCollector interface. The wrapped
+// collector receives a copy of the record.
+func (p *PrivacyCollector) CollectBandwidthEvent(record *BandwidthRecord) {
+
+	c, ok := p.collector.(BandwidthEventCollector)
+	if !ok {
+		return
+	}
+
+	private := *record
+	private.Tags = p.tagsMap(p.currentSalt(), record.Tags)
+
+	c.CollectBandwidthEvent(&private)
+}
+
+// CollectLatencyEvent is part of the LatencyEventCollector interface. The wrapped
+// collector receives a copy of the record.
+func (p *PrivacyCollector) CollectLatencyEvent(record *LatencyRecord) {
+
+	c, ok := p.collector.(LatencyEventCollector)
+	if !ok {
+		return
+	}
+
+	private := *record
+	private.Tags = p.tagsMap(p.currentSalt(), record.Tags)
+
+	c.CollectLatencyEvent(&private)
+}
+
+// CollectRuleStatsEvent is part of the RuleStatsEventCollector interface. The wrapped
+// collector receives a copy of the record.
+func (p *PrivacyCollector) CollectRuleStatsEvent(record *RuleStatsRecord) {
+
+	c, ok := p.collector.(RuleStatsEventCollector)
+	if !ok {
+		return
+	}
+
+	private := *record
+	private.Tags = p.tagsMap(p.currentSalt(), record.Tags)
+
+	c.CollectRuleStatsEvent(&private)
+}
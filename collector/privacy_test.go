@@ -0,0 +1,94 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aporeto-inc/trireme/policy"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type recordingCollector struct {
+	flows      []*FlowRecord
+	containers []*ContainerRecord
+}
+
+func (c *recordingCollector) CollectFlowEvent(record *FlowRecord) {
+	c.flows = append(c.flows, record)
+}
+
+func (c *recordingCollector) CollectContainerEvent(record *ContainerRecord) {
+	c.containers = append(c.containers, record)
+}
+
+func TestPrivacyCollector(t *testing.T) {
+	Convey("Given a privacy collector hashing the source IPs and the user tags", t, func() {
+		c := &recordingCollector{}
+		now := time.Now()
+
+		p, err := NewPrivacyCollector(c, &PrivacyConfig{
+			HashedFields:  []PrivacyField{PrivacySourceIP},
+			DroppedFields: []PrivacyField{PrivacyProcess},
+			HashedTags:    []string{"user"},
+			DroppedTags:   []string{"email"},
+			SaltRotation:  time.Hour,
+		})
+		So(err, ShouldBeNil)
+		p.now = func() time.Time { return now }
+
+		record := func() *FlowRecord {
+			return &FlowRecord{
+				ContextID:      "pu",
+				SourceIP:       "10.0.0.1",
+				DestinationIP:  "10.0.0.2",
+				ProcessPath:    "/usr/bin/curl",
+				ProcessCmdline: "curl http://server",
+				Tags:           policy.NewTagsMap(map[string]string{"user": "alice", "email": "alice@example.com", "app": "web"}),
+			}
+		}
+
+		Convey("When I collect a flow", func() {
+			original := record()
+			p.CollectFlowEvent(original)
+			flow := c.flows[0]
+
+			Convey("The configured fields should be hashed or dropped", func() {
+				So(flow.SourceIP, ShouldNotEqual, "10.0.0.1")
+				So(len(flow.SourceIP), ShouldEqual, 32)
+				So(flow.DestinationIP, ShouldEqual, "10.0.0.2")
+				So(flow.ProcessPath, ShouldEqual, "")
+				So(flow.ProcessCmdline, ShouldEqual, "")
+			})
+
+			Convey("The configured tags should be hashed or dropped", func() {
+				user, _ := flow.Tags.Get("user")
+				So(user, ShouldNotEqual, "alice")
+				_, ok := flow.Tags.Get("email")
+				So(ok, ShouldBeFalse)
+				app, _ := flow.Tags.Get("app")
+				So(app, ShouldEqual, "web")
+			})
+
+			Convey("The record of the caller should not be modified", func() {
+				So(original.SourceIP, ShouldEqual, "10.0.0.1")
+				_, ok := original.Tags.Get("email")
+				So(ok, ShouldBeTrue)
+			})
+
+			Convey("The same value should have the same hash until the salt is rotated", func() {
+				p.CollectFlowEvent(record())
+				So(c.flows[1].SourceIP, ShouldEqual, flow.SourceIP)
+
+				now = now.Add(time.Hour + time.Minute)
+				p.CollectFlowEvent(record())
+				So(c.flows[2].SourceIP, ShouldNotEqual, flow.SourceIP)
+			})
+		})
+
+		Convey("The unknown fields should be rejected", func() {
+			_, err := ParsePrivacyFields([]string{"sourceip", "password"})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
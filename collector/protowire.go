@@ -0,0 +1,158 @@
+package collector
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// Wire types of the protobuf encoding
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+	protoFixed32 = 5
+)
+
+// protoBuffer is a minimal protobuf encoder for the records. The fields with the
+// default value are omitted like in proto3.
+type protoBuffer struct {
+	data []byte
+}
+
+func (b *protoBuffer) varint(v uint64) {
+
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	b.data = append(b.data, buf[:n]...)
+}
+
+func (b *protoBuffer) key(field int, wireType int) {
+
+	b.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+func (b *protoBuffer) uint(field int, v uint64) {
+
+	if v == 0 {
+		return
+	}
+
+	b.key(field, protoVarint)
+	b.varint(v)
+}
+
+func (b *protoBuffer) bytes(field int, v []byte) {
+
+	b.key(field, protoBytes)
+	b.varint(uint64(len(v)))
+	b.data = append(b.data, v...)
+}
+
+func (b *protoBuffer) string(field int, v string) {
+
+	if v == "" {
+		return
+	}
+
+	b.bytes(field, []byte(v))
+}
+
+// stringMap encodes a map<string, string> as repeated entries of key 1 and value 2,
+// in the order of the keys
+func (b *protoBuffer) stringMap(field int, m map[string]string) {
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		entry := &protoBuffer{}
+		entry.bytes(1, []byte(k))
+		entry.bytes(2, []byte(m[k]))
+		b.bytes(field, entry.data)
+	}
+}
+
+// decodeProto calls fn for every field of a message with its varint value or its
+// bytes. The fixed size fields are skipped since the records do not use them.
+func decodeProto(data []byte, fn func(field int, value uint64, bytes []byte) error) error {
+
+	for len(data) > 0 {
+
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return fmt.Errorf("Invalid protobuf field key")
+		}
+		data = data[n:]
+
+		field := int(key >> 3)
+
+		switch key & 7 {
+		case protoVarint:
+			value, n := binary.Uvarint(data)
+			if n <= 0 {
+				return fmt.Errorf("Invalid protobuf varint in field %d", field)
+			}
+			data = data[n:]
+
+			if err := fn(field, value, nil); err != nil {
+				return err
+			}
+
+		case protoBytes:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return fmt.Errorf("Invalid protobuf length in field %d", field)
+			}
+			value := data[n : n+int(length)]
+			data = data[n+int(length):]
+
+			if err := fn(field, 0, value); err != nil {
+				return err
+			}
+
+		case protoFixed64:
+			if len(data) < 8 {
+				return fmt.Errorf("Invalid protobuf fixed64 in field %d", field)
+			}
+			data = data[8:]
+
+		case protoFixed32:
+			if len(data) < 4 {
+				return fmt.Errorf("Invalid protobuf fixed32 in field %d", field)
+			}
+			data = data[4:]
+
+		default:
+			return fmt.Errorf("Unsupported protobuf wire type in field %d", field)
+		}
+	}
+
+	return nil
+}
+
+// decodeMapEntry decodes an entry of a map<string, string> into m
+func decodeMapEntry(data []byte, m map[string]string) error {
+
+	var key, value string
+
+	err := decodeProto(data, func(field int, _ uint64, bytes []byte) error {
+		switch field {
+		case 1:
+			key = string(bytes)
+		case 2:
+			value = string(bytes)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	m[key] = value
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package collector
+
+import "sync"
+
+// PolicyRevisionTag is the annotation of a policy that identifies its revision. The
+// enforcer reports the annotations of a PU in the tags of its flow records.
+const PolicyRevisionTag = "@policy_revision"
+
+// RevisionMetrics are the flow counters of a policy revision
+type RevisionMetrics struct {
+	Accepted int
+	Rejected int
+}
+
+// RevisionCollector is an EventCollector that counts the flows of every policy
+// revision, so that a candidate revision can be compared with the current one
+// during a rollout. All events are forwarded to the wrapped collector.
+type RevisionCollector struct {
+	collector EventCollector
+	metrics   map[string]*RevisionMetrics
+	sync.Mutex
+}
+
+// NewRevisionCollector returns a RevisionCollector wrapping the given collector
+func NewRevisionCollector(collector EventCollector) *RevisionCollector {
+
+	return &RevisionCollector{
+		collector: collector,
+		metrics:   map[string]*RevisionMetrics{},
+	}
+}
+
+// CollectFlowEvent is part of the EventCollector interface. The flows of the PUs
+// whose policy has no revision are counted in the empty revision.
+func (r *RevisionCollector) CollectFlowEvent(record *FlowRecord) {
+
+	revision := ""
+	if record.Tags != nil {
+		revision, _ = record.Tags.Get(PolicyRevisionTag)
+	}
+
+	count := record.Count
+	if count == 0 {
+		count = 1
+	}
+
+	r.Lock()
+	metrics, ok := r.metrics[revision]
+	if !ok {
+		metrics = &RevisionMetrics{}
+		r.metrics[revision] = metrics
+	}
+	if record.Action == FlowAccept {
+		metrics.Accepted += count
+	} else {
+		metrics.Rejected += count
+	}
+	r.Unlock()
+
+	r.collector.CollectFlowEvent(record)
+}
+
+// CollectContainerEvent is part of the EventCollector interface.
+func (r *RevisionCollector) CollectContainerEvent(record *ContainerRecord) {
+
+	r.collector.CollectContainerEvent(record)
+}
+
+// Metrics returns a copy of the flow counters of every revision
+func (r *RevisionCollector) Metrics() map[string]RevisionMetrics {
+
+	r.Lock()
+	defer r.Unlock()
+
+	metrics := map[string]RevisionMetrics{}
+	for revision, m := range r.metrics {
+		metrics[revision] = *m
+	}
+
+	return metrics
+}
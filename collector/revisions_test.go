@@ -0,0 +1,28 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/aporeto-inc/trireme/policy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRevisionCollector(t *testing.T) {
+	Convey("Given a revision collector", t, func() {
+		c := &peerCollector{}
+		r := NewRevisionCollector(c)
+
+		candidate := policy.NewTagsMap(map[string]string{PolicyRevisionTag: "v2"})
+
+		Convey("The flows should be counted by revision and forwarded", func() {
+			r.CollectFlowEvent(&FlowRecord{ContextID: "pu1", Tags: candidate, Action: FlowAccept})
+			r.CollectFlowEvent(&FlowRecord{ContextID: "pu1", Tags: candidate, Action: FlowReject, Count: 3})
+			r.CollectFlowEvent(&FlowRecord{ContextID: "pu2", Action: FlowAccept})
+
+			metrics := r.Metrics()
+			So(metrics["v2"], ShouldResemble, RevisionMetrics{Accepted: 1, Rejected: 3})
+			So(metrics[""], ShouldResemble, RevisionMetrics{Accepted: 1})
+			So(c.flows, ShouldEqual, 3)
+		})
+	})
+}
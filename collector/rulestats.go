@@ -0,0 +1,31 @@
+package collector
+
+import "github.com/aporeto-inc/trireme/api/records"
+
+// Directions of the rules of a RuleStatsRecord
+const (
+	// RuleApplication are the application ACLs of the PU
+	RuleApplication = records.RuleApplication
+	// RuleNetwork are the network ACLs of the PU
+	RuleNetwork = records.RuleNetwork
+	// RuleTransmitter are the transmitter rules of the PU
+	RuleTransmitter = records.RuleTransmitter
+	// RuleReceiver are the receiver rules of the PU
+	RuleReceiver = records.RuleReceiver
+)
+
+// RuleHits is the number of matches of a rule of a PU during a reporting interval
+type RuleHits = records.RuleHits
+
+// RuleStatsRecord is the number of matches of the rules of a PU during a reporting
+// interval
+type RuleStatsRecord = records.RuleStatsRecord
+
+// RuleStatsEventCollector is an optional interface of an EventCollector that wants
+// the matches of the rules of the PUs, to find the unused rules and the busiest ones.
+type RuleStatsEventCollector interface {
+
+	// CollectRuleStatsEvent collects the matches of the rules of a PU during an
+	// interval
+	CollectRuleStatsEvent(record *RuleStatsRecord)
+}
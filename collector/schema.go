@@ -0,0 +1,303 @@
+package collector
+
+import (
+	"encoding/json"
+
+	"github.com/aporeto-inc/trireme/policy"
+)
+
+// RecordSchemaVersion is the version of the wire schema of the records defined in
+// records.proto. The schema only evolves by adding fields, so the consumers decode
+// the records of any version and ignore the fields they do not know.
+const RecordSchemaVersion = 4
+
+// Field numbers of records.proto
+const (
+	flowVersionField         = 1
+	flowContextIDField       = 2
+	flowCountField           = 3
+	flowSourceIDField        = 4
+	flowDestinationIDField   = 5
+	flowSourceIPField        = 6
+	flowDestinationIPField   = 7
+	flowDestinationPortField = 8
+	flowTagsField            = 9
+	flowActionField          = 10
+	flowModeField            = 11
+	flowProcessPathField     = 12
+	flowProcessCmdlineField  = 13
+	flowRejectionField       = 14
+	flowPeerIdentityField    = 15
+	flowBytesField           = 16
+	flowPacketsField         = 17
+	flowReplyBytesField      = 18
+	flowReplyPacketsField    = 19
+
+	containerVersionField   = 1
+	containerContextIDField = 2
+	containerIPAddressField = 3
+	containerTagsField      = 4
+	containerEventField     = 5
+)
+
+// flowRecordJSON is the canonical JSON form of a FlowRecord
+type flowRecordJSON struct {
+	Version         int               `json:"version"`
+	ContextID       string            `json:"context_id,omitempty"`
+	Count           int               `json:"count,omitempty"`
+	SourceID        string            `json:"source_id,omitempty"`
+	DestinationID   string            `json:"destination_id,omitempty"`
+	SourceIP        string            `json:"source_ip,omitempty"`
+	DestinationIP   string            `json:"destination_ip,omitempty"`
+	DestinationPort uint16            `json:"destination_port,omitempty"`
+	Tags            map[string]string `json:"tags,omitempty"`
+	Action          string            `json:"action,omitempty"`
+	Mode            string            `json:"mode,omitempty"`
+	ProcessPath     string            `json:"process_path,omitempty"`
+	ProcessCmdline  string            `json:"process_cmdline,omitempty"`
+	Rejection       string            `json:"rejection,omitempty"`
+	PeerIdentity    map[string]string `json:"peer_identity,omitempty"`
+	Bytes           uint64            `json:"bytes,omitempty"`
+	Packets         uint64            `json:"packets,omitempty"`
+	ReplyBytes      uint64            `json:"reply_bytes,omitempty"`
+	ReplyPackets    uint64            `json:"reply_packets,omitempty"`
+}
+
+// containerRecordJSON is the canonical JSON form of a ContainerRecord
+type containerRecordJSON struct {
+	Version   int               `json:"version"`
+	ContextID string            `json:"context_id,omitempty"`
+	IPAddress string            `json:"ip_address,omitempty"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	Event     string            `json:"event,omitempty"`
+}
+
+// MarshalFlowRecordJSON returns the canonical JSON form of the record
+func MarshalFlowRecordJSON(r *FlowRecord) ([]byte, error) {
+
+	return json.Marshal(&flowRecordJSON{
+		Version:         RecordSchemaVersion,
+		ContextID:       r.ContextID,
+		Count:           r.Count,
+		SourceID:        r.SourceID,
+		DestinationID:   r.DestinationID,
+		SourceIP:        r.SourceIP,
+		DestinationIP:   r.DestinationIP,
+		DestinationPort: r.DestinationPort,
+		Tags:            tagsOf(r.Tags),
+		Action:          r.Action,
+		Mode:            r.Mode,
+		ProcessPath:     r.ProcessPath,
+		ProcessCmdline:  r.ProcessCmdline,
+		Rejection:       r.Rejection,
+		PeerIdentity:    tagsOf(r.PeerIdentity),
+		Bytes:           r.Bytes,
+		Packets:         r.Packets,
+		ReplyBytes:      r.ReplyBytes,
+		ReplyPackets:    r.ReplyPackets,
+	})
+}
+
+// UnmarshalFlowRecordJSON decodes a record from its canonical JSON form
+func UnmarshalFlowRecordJSON(data []byte) (*FlowRecord, error) {
+
+	w := &flowRecordJSON{}
+	if err := json.Unmarshal(data, w); err != nil {
+		return nil, err
+	}
+
+	return &FlowRecord{
+		ContextID:       w.ContextID,
+		Count:           w.Count,
+		SourceID:        w.SourceID,
+		DestinationID:   w.DestinationID,
+		SourceIP:        w.SourceIP,
+		DestinationIP:   w.DestinationIP,
+		DestinationPort: w.DestinationPort,
+		Tags:            tagsMapOf(w.Tags),
+		Action:          w.Action,
+		Mode:            w.Mode,
+		ProcessPath:     w.ProcessPath,
+		ProcessCmdline:  w.ProcessCmdline,
+		Rejection:       w.Rejection,
+		PeerIdentity:    tagsMapOf(w.PeerIdentity),
+		Bytes:           w.Bytes,
+		Packets:         w.Packets,
+		ReplyBytes:      w.ReplyBytes,
+		ReplyPackets:    w.ReplyPackets,
+	}, nil
+}
+
+// MarshalContainerRecordJSON returns the canonical JSON form of the record
+func MarshalContainerRecordJSON(r *ContainerRecord) ([]byte, error) {
+
+	return json.Marshal(&containerRecordJSON{
+		Version:   RecordSchemaVersion,
+		ContextID: r.ContextID,
+		IPAddress: r.IPAddress,
+		Tags:      tagsOf(r.Tags),
+		Event:     r.Event,
+	})
+}
+
+// UnmarshalContainerRecordJSON decodes a record from its canonical JSON form
+func UnmarshalContainerRecordJSON(data []byte) (*ContainerRecord, error) {
+
+	w := &containerRecordJSON{}
+	if err := json.Unmarshal(data, w); err != nil {
+		return nil, err
+	}
+
+	return &ContainerRecord{
+		ContextID: w.ContextID,
+		IPAddress: w.IPAddress,
+		Tags:      tagsMapOf(w.Tags),
+		Event:     w.Event,
+	}, nil
+}
+
+// MarshalFlowRecordProto returns the protobuf encoding of the record
+func MarshalFlowRecordProto(r *FlowRecord) []byte {
+
+	b := &protoBuffer{}
+
+	b.uint(flowVersionField, RecordSchemaVersion)
+	b.string(flowContextIDField, r.ContextID)
+	b.uint(flowCountField, uint64(int64(r.Count)))
+	b.string(flowSourceIDField, r.SourceID)
+	b.string(flowDestinationIDField, r.DestinationID)
+	b.string(flowSourceIPField, r.SourceIP)
+	b.string(flowDestinationIPField, r.DestinationIP)
+	b.uint(flowDestinationPortField, uint64(r.DestinationPort))
+	b.stringMap(flowTagsField, tagsOf(r.Tags))
+	b.string(flowActionField, r.Action)
+	b.string(flowModeField, r.Mode)
+	b.string(flowProcessPathField, r.ProcessPath)
+	b.string(flowProcessCmdlineField, r.ProcessCmdline)
+	b.string(flowRejectionField, r.Rejection)
+	b.stringMap(flowPeerIdentityField, tagsOf(r.PeerIdentity))
+	b.uint(flowBytesField, r.Bytes)
+	b.uint(flowPacketsField, r.Packets)
+	b.uint(flowReplyBytesField, r.ReplyBytes)
+	b.uint(flowReplyPacketsField, r.ReplyPackets)
+
+	return b.data
+}
+
+// UnmarshalFlowRecordProto decodes a record from its protobuf encoding
+func UnmarshalFlowRecordProto(data []byte) (*FlowRecord, error) {
+
+	r := &FlowRecord{}
+	tags := map[string]string{}
+	peerIdentity := map[string]string{}
+
+	err := decodeProto(data, func(field int, value uint64, bytes []byte) error {
+		switch field {
+		case flowContextIDField:
+			r.ContextID = string(bytes)
+		case flowCountField:
+			r.Count = int(int64(value))
+		case flowSourceIDField:
+			r.SourceID = string(bytes)
+		case flowDestinationIDField:
+			r.DestinationID = string(bytes)
+		case flowSourceIPField:
+			r.SourceIP = string(bytes)
+		case flowDestinationIPField:
+			r.DestinationIP = string(bytes)
+		case flowDestinationPortField:
+			r.DestinationPort = uint16(value)
+		case flowTagsField:
+			return decodeMapEntry(bytes, tags)
+		case flowActionField:
+			r.Action = string(bytes)
+		case flowModeField:
+			r.Mode = string(bytes)
+		case flowProcessPathField:
+			r.ProcessPath = string(bytes)
+		case flowProcessCmdlineField:
+			r.ProcessCmdline = string(bytes)
+		case flowRejectionField:
+			r.Rejection = string(bytes)
+		case flowPeerIdentityField:
+			return decodeMapEntry(bytes, peerIdentity)
+		case flowBytesField:
+			r.Bytes = value
+		case flowPacketsField:
+			r.Packets = value
+		case flowReplyBytesField:
+			r.ReplyBytes = value
+		case flowReplyPacketsField:
+			r.ReplyPackets = value
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r.Tags = tagsMapOf(tags)
+	r.PeerIdentity = tagsMapOf(peerIdentity)
+
+	return r, nil
+}
+
+// MarshalContainerRecordProto returns the protobuf encoding of the record
+func MarshalContainerRecordProto(r *ContainerRecord) []byte {
+
+	b := &protoBuffer{}
+
+	b.uint(containerVersionField, RecordSchemaVersion)
+	b.string(containerContextIDField, r.ContextID)
+	b.string(containerIPAddressField, r.IPAddress)
+	b.stringMap(containerTagsField, tagsOf(r.Tags))
+	b.string(containerEventField, r.Event)
+
+	return b.data
+}
+
+// UnmarshalContainerRecordProto decodes a record from its protobuf encoding
+func UnmarshalContainerRecordProto(data []byte) (*ContainerRecord, error) {
+
+	r := &ContainerRecord{}
+	tags := map[string]string{}
+
+	err := decodeProto(data, func(field int, value uint64, bytes []byte) error {
+		switch field {
+		case containerContextIDField:
+			r.ContextID = string(bytes)
+		case containerIPAddressField:
+			r.IPAddress = string(bytes)
+		case containerTagsField:
+			return decodeMapEntry(bytes, tags)
+		case containerEventField:
+			r.Event = string(bytes)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r.Tags = tagsMapOf(tags)
+
+	return r, nil
+}
+
+func tagsOf(tags *policy.TagsMap) map[string]string {
+
+	if tags == nil {
+		return nil
+	}
+
+	return tags.Tags
+}
+
+func tagsMapOf(tags map[string]string) *policy.TagsMap {
+
+	if len(tags) == 0 {
+		return nil
+	}
+
+	return policy.NewTagsMap(tags)
+}
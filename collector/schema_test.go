@@ -0,0 +1,145 @@
+package collector
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aporeto-inc/trireme/policy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func testFlowRecord() *FlowRecord {
+
+	return &FlowRecord{
+		ContextID:       "pu1",
+		Count:           3,
+		SourceID:        "web",
+		DestinationID:   "db",
+		SourceIP:        "10.0.0.1",
+		DestinationIP:   "10.0.0.2",
+		DestinationPort: 5432,
+		Tags:            policy.NewTagsMap(map[string]string{"app": "web", "env": "prod"}),
+		Action:          FlowAccept,
+		Mode:            "",
+		ProcessPath:     "/usr/bin/psql",
+		ProcessCmdline:  "psql -h db",
+		PeerIdentity:    policy.NewTagsMap(map[string]string{"app": "db"}),
+	}
+}
+
+func TestFlowRecordSchema(t *testing.T) {
+	Convey("Given a flow record", t, func() {
+		record := testFlowRecord()
+
+		Convey("It should round trip through JSON", func() {
+			data, err := MarshalFlowRecordJSON(record)
+			So(err, ShouldBeNil)
+
+			decoded, err := UnmarshalFlowRecordJSON(data)
+			So(err, ShouldBeNil)
+			So(decoded, ShouldResemble, record)
+		})
+
+		Convey("Its JSON should use the field names of the schema", func() {
+			data, err := MarshalFlowRecordJSON(record)
+			So(err, ShouldBeNil)
+
+			fields := map[string]interface{}{}
+			So(json.Unmarshal(data, &fields), ShouldBeNil)
+			So(fields["version"], ShouldEqual, RecordSchemaVersion)
+			So(fields["context_id"], ShouldEqual, "pu1")
+			So(fields["destination_port"], ShouldEqual, 5432)
+			So(fields["process_cmdline"], ShouldEqual, "psql -h db")
+			So(fields["peer_identity"], ShouldResemble, map[string]interface{}{"app": "db"})
+			So(fields, ShouldNotContainKey, "mode")
+		})
+
+		Convey("It should round trip through protobuf", func() {
+			decoded, err := UnmarshalFlowRecordProto(MarshalFlowRecordProto(record))
+			So(err, ShouldBeNil)
+			So(decoded, ShouldResemble, record)
+		})
+
+		Convey("The traffic of a volume record should round trip", func() {
+			record.Mode = FlowVolume
+			record.Bytes = 1 << 40
+			record.Packets = 12
+			record.ReplyBytes = 2048
+			record.ReplyPackets = 3
+
+			data, err := MarshalFlowRecordJSON(record)
+			So(err, ShouldBeNil)
+			decoded, err := UnmarshalFlowRecordJSON(data)
+			So(err, ShouldBeNil)
+			So(decoded, ShouldResemble, record)
+
+			decoded, err = UnmarshalFlowRecordProto(MarshalFlowRecordProto(record))
+			So(err, ShouldBeNil)
+			So(decoded, ShouldResemble, record)
+		})
+
+		Convey("Its protobuf encoding should be stable", func() {
+			So(MarshalFlowRecordProto(record), ShouldResemble, MarshalFlowRecordProto(testFlowRecord()))
+		})
+	})
+
+	Convey("Given a record of a newer schema", t, func() {
+
+		Convey("The unknown JSON fields should be ignored", func() {
+			decoded, err := UnmarshalFlowRecordJSON([]byte(`{"version":2,"context_id":"pu1","latency":{"p99":3}}`))
+			So(err, ShouldBeNil)
+			So(decoded.ContextID, ShouldEqual, "pu1")
+		})
+
+		Convey("The unknown protobuf fields should be skipped", func() {
+			b := &protoBuffer{}
+			b.uint(flowVersionField, 2)
+			b.string(flowContextIDField, "pu1")
+			b.uint(100, 42)
+			b.string(101, "unknown")
+			b.key(102, protoFixed32)
+			b.data = append(b.data, 1, 2, 3, 4)
+			b.uint(flowDestinationPortField, 80)
+
+			decoded, err := UnmarshalFlowRecordProto(b.data)
+			So(err, ShouldBeNil)
+			So(decoded.ContextID, ShouldEqual, "pu1")
+			So(decoded.DestinationPort, ShouldEqual, 80)
+		})
+	})
+
+	Convey("Given a truncated protobuf record", t, func() {
+		data := MarshalFlowRecordProto(testFlowRecord())
+
+		Convey("It should be rejected", func() {
+			_, err := UnmarshalFlowRecordProto(data[:len(data)-2])
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestContainerRecordSchema(t *testing.T) {
+	Convey("Given a container record", t, func() {
+		record := &ContainerRecord{
+			ContextID: "pu1",
+			IPAddress: "10.0.0.1",
+			Tags:      policy.NewTagsMap(map[string]string{"app": "web"}),
+			Event:     ContainerStart,
+		}
+
+		Convey("It should round trip through JSON", func() {
+			data, err := MarshalContainerRecordJSON(record)
+			So(err, ShouldBeNil)
+
+			decoded, err := UnmarshalContainerRecordJSON(data)
+			So(err, ShouldBeNil)
+			So(decoded, ShouldResemble, record)
+		})
+
+		Convey("It should round trip through protobuf", func() {
+			decoded, err := UnmarshalContainerRecordProto(MarshalContainerRecordProto(record))
+			So(err, ShouldBeNil)
+			So(decoded, ShouldResemble, record)
+		})
+	})
+}
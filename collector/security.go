@@ -0,0 +1,26 @@
+package collector
+
+import "github.com/aporeto-inc/trireme/api/records"
+
+const (
+	// SecurityPIDRecycled indicates that the PID of a PU no longer belongs to the
+	// process of the PU. Either the PID was reused by another process or the process
+	// changed of executable or namespace.
+	SecurityPIDRecycled = records.SecurityPIDRecycled
+
+	// SecurityHandshakeDowngrade indicates that a source repeatedly sent handshakes
+	// whose identity was stripped or malformed, like to force the processing of its
+	// connections by the ACLs only
+	SecurityHandshakeDowngrade = records.SecurityHandshakeDowngrade
+)
+
+// SecurityRecord describes a security event detected by Trireme
+type SecurityRecord = records.SecurityRecord
+
+// SecurityEventCollector is an optional interface of an EventCollector that wants to
+// be notified of security events.
+type SecurityEventCollector interface {
+
+	// CollectSecurityEvent collects a security event
+	CollectSecurityEvent(record *SecurityRecord)
+}
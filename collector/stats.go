@@ -0,0 +1,17 @@
+package collector
+
+import "github.com/aporeto-inc/trireme/api/records"
+
+// StatsRecord accounts for an interval of flow records reported by a remote
+// enforcer. The remote enforcers number the stats they deliver and report the number
+// of records they delivered before them, so that the records lost between an
+// enforcer and the consumers of the collector can be detected and quantified.
+type StatsRecord = records.StatsRecord
+
+// StatsEventCollector is an optional interface of an EventCollector that wants to
+// account for the stats intervals of the remote enforcers.
+type StatsEventCollector interface {
+
+	// CollectStatsEvent collects the accounting of a stats interval
+	CollectStatsEvent(record *StatsRecord)
+}
@@ -4,6 +4,10 @@ package configurator
 
 import (
 	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/aporeto-inc/trireme"
@@ -11,9 +15,11 @@ import (
 	"github.com/aporeto-inc/trireme/constants"
 	"github.com/aporeto-inc/trireme/enforcer"
 	"github.com/aporeto-inc/trireme/monitor"
+	"github.com/aporeto-inc/trireme/monitor/crimonitor"
 	"github.com/aporeto-inc/trireme/monitor/dockermonitor"
 	"github.com/aporeto-inc/trireme/monitor/linuxmonitor"
 	"github.com/aporeto-inc/trireme/monitor/rpcmonitor"
+	"github.com/aporeto-inc/trireme/processmon"
 
 	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
 
@@ -21,8 +27,100 @@ import (
 	"github.com/aporeto-inc/trireme/enforcer/utils/rpcwrapper"
 	"github.com/aporeto-inc/trireme/supervisor"
 	"github.com/aporeto-inc/trireme/supervisor/proxy"
+	"github.com/aporeto-inc/trireme/utils/clock"
+	"github.com/aporeto-inc/trireme/utils/logging"
+	"github.com/aporeto-inc/trireme/utils/preflight"
 )
 
+// SetLogger sends the logs of Trireme to the logger of the program, with their
+// levels and their structured fields. It should be called before Trireme is
+// created. The logs are written by logrus if it is never called.
+func SetLogger(logger logging.Logger) {
+
+	logging.SetLogger(logger)
+}
+
+// rpcTransport is the transport between the controller and the remote enforcers
+var rpcTransport = rpcwrapper.NetRPCTransport
+
+// SetRPCTransport selects the transport of the calls between the controller and the
+// remote enforcers, which are launched with the same transport. It must be called
+// before Trireme is created. The calls use net/rpc if it is never called.
+func SetRPCTransport(transport rpcwrapper.Transport) {
+
+	rpcTransport = transport
+}
+
+// SetBinaryVerifier verifies the binary of the remote enforcers before they are
+// launched, so that a binary that is not verified is never launched. It should be
+// called before Trireme is started. The binary is not verified if it is never called.
+func SetBinaryVerifier(verifier processmon.BinaryVerifier) {
+
+	processmon.GetProcessManagerHdl().SetBinaryVerifier(verifier)
+}
+
+// NewBinaryVerifierFromDigests creates a verifier accepting the binaries whose
+// sha256, hex encoded, is one of the digests
+func NewBinaryVerifierFromDigests(digests []string) processmon.BinaryVerifier {
+
+	return processmon.NewSHA256Allowlist(digests)
+}
+
+// NewBinaryVerifierFromKey creates a verifier accepting the binaries signed with the
+// private key of the PEM encoded ECDSA public key. The signature of a binary is read
+// from the file next to it with the .sig extension.
+func NewBinaryVerifierFromKey(keyPEM []byte) (processmon.BinaryVerifier, error) {
+
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("Invalid public key: no PEM block")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid public key: %s", err)
+	}
+
+	ecKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("Invalid public key: not an ECDSA key")
+	}
+
+	return processmon.NewSignatureVerifier(ecKey), nil
+}
+
+// probeContainers adds the docker monitor to the liveness probes of Trireme, so that
+// the containers removed while their events were missed are destroyed
+func probeContainers(triremeInstance trireme.Trireme, monitorInstance monitor.Monitor) {
+
+	probe, ok := monitorInstance.(trireme.LivenessProbe)
+	if !ok {
+		return
+	}
+
+	reaper := trireme.DefaultReaperPolicy
+	reaper.Probes = append([]trireme.LivenessProbe{probe}, reaper.Probes...)
+
+	if err := triremeInstance.(trireme.ReaperConfigurer).SetReaperPolicy(reaper); err != nil {
+		log.WithFields(log.Fields{
+			"package": "configurator",
+			"error":   err.Error(),
+		}).Warn("Failed to probe the containers")
+	}
+}
+
+// checkHost stops the program if the host does not meet the requirements of a
+// supervisor of the mode and the implementation
+func checkHost(mode constants.ModeType, impl constants.ImplementationType) {
+
+	if err := preflight.NewHost().Check(preflight.RequirementsFor(mode, impl)); err != nil {
+		log.WithFields(log.Fields{
+			"package": "configurator",
+			"error":   err.Error(),
+		}).Fatal("Host is not ready for Trireme")
+	}
+}
+
 // NewTriremeLinuxProcess instantiates Trireme for a Linux process implementation
 func NewTriremeLinuxProcess(
 	serverID string,
@@ -38,9 +136,11 @@ func NewTriremeLinuxProcess(
 		eventCollector = &collector.DefaultCollector{}
 	}
 
+	checkHost(constants.LocalServer, constants.IPTables)
+
 	enforcers := map[constants.PUType]enforcer.PolicyEnforcer{
 		constants.LinuxProcessPU: enforcer.NewDefaultDatapathEnforcer(serverID,
-			eventCollector,
+			linuxmonitor.NewProcessInfoCollector(eventCollector),
 			nil,
 			secrets,
 			constants.LocalServer,
@@ -82,6 +182,8 @@ func NewLocalTriremeDocker(
 		eventCollector = &collector.DefaultCollector{}
 	}
 
+	checkHost(constants.LocalContainer, impl)
+
 	enforcers := map[constants.PUType]enforcer.PolicyEnforcer{
 		constants.ContainerPU: enforcer.NewDefaultDatapathEnforcer(serverID,
 			eventCollector,
@@ -125,14 +227,76 @@ func NewDistributedTriremeDocker(serverID string,
 		eventCollector = &collector.DefaultCollector{}
 	}
 
-	rpcwrapper := rpcwrapper.NewRPCWrapper()
+	rpcwrapper := rpcwrapper.NewRPCWrapper(rpcwrapper.WithTransport(rpcTransport))
 
-	enforcers := map[constants.PUType]enforcer.PolicyEnforcer{
-		constants.ContainerPU: enforcerproxy.NewDefaultProxyEnforcer(
+	return newDistributedTriremeDocker(serverID, resolver, eventCollector, impl, rpcwrapper,
+		enforcerproxy.NewDefaultProxyEnforcer(
 			serverID,
 			eventCollector,
 			secrets,
-			rpcwrapper),
+			rpcwrapper))
+}
+
+// NewDistributedTriremeDockerWithCapture instantiates Trireme using remote enforcers
+// on the container namespaces capturing the packets with the capture mode instead
+// of the netfilter queues. The eBPF capture loads the classifier of the program, or
+// enforcer.DefaultEBPFProgram if empty.
+func NewDistributedTriremeDockerWithCapture(serverID string,
+	resolver trireme.PolicyResolver,
+	processor enforcer.PacketProcessor,
+	eventCollector collector.EventCollector,
+	secrets tokens.Secrets,
+	impl constants.ImplementationType,
+	capture enforcer.CaptureMode,
+	program string) trireme.Trireme {
+
+	if eventCollector == nil {
+		log.WithFields(log.Fields{
+			"package": "configurator",
+		}).Warn("Using a default collector for events")
+		eventCollector = &collector.DefaultCollector{}
+	}
+
+	fqConfig := &enforcer.FilterQueue{
+		NetworkQueue:              enforcer.DefaultNetworkQueue,
+		NetworkQueueSize:          enforcer.DefaultQueueSize,
+		NumberOfNetworkQueues:     enforcer.DefaultNumberOfQueues,
+		ApplicationQueue:          enforcer.DefaultApplicationQueue,
+		ApplicationQueueSize:      enforcer.DefaultQueueSize,
+		NumberOfApplicationQueues: enforcer.DefaultNumberOfQueues,
+		MarkValue:                 enforcer.DefaultMarkValue,
+		CaptureMode:               capture,
+		CaptureProgram:            program,
+	}
+
+	rpcwrapper := rpcwrapper.NewRPCWrapper(rpcwrapper.WithTransport(rpcTransport))
+
+	return newDistributedTriremeDocker(serverID, resolver, eventCollector, impl, rpcwrapper,
+		enforcerproxy.NewProxyEnforcer(
+			false,
+			fqConfig,
+			eventCollector,
+			processor,
+			secrets,
+			serverID,
+			time.Hour*8760,
+			rpcwrapper,
+			constants.DefaultRemoteArg))
+}
+
+// newDistributedTriremeDocker instantiates Trireme with the proxy of the remote
+// enforcers
+func newDistributedTriremeDocker(serverID string,
+	resolver trireme.PolicyResolver,
+	eventCollector collector.EventCollector,
+	impl constants.ImplementationType,
+	rpcwrapper *rpcwrapper.RPCWrapper,
+	proxyEnforcer enforcer.PolicyEnforcer) trireme.Trireme {
+
+	checkHost(constants.RemoteContainer, impl)
+
+	enforcers := map[constants.PUType]enforcer.PolicyEnforcer{
+		constants.ContainerPU: proxyEnforcer,
 	}
 
 	s, err := supervisorproxy.NewProxySupervisor(eventCollector, enforcers[0], rpcwrapper)
@@ -165,7 +329,9 @@ func NewHybridTrireme(
 		eventCollector = &collector.DefaultCollector{}
 	}
 
-	rpcwrapper := rpcwrapper.NewRPCWrapper()
+	checkHost(constants.LocalServer, constants.IPTables)
+
+	rpcwrapper := rpcwrapper.NewRPCWrapper(rpcwrapper.WithTransport(rpcTransport))
 	containerEnforcer := enforcerproxy.NewDefaultProxyEnforcer(
 		serverID,
 		eventCollector,
@@ -287,6 +453,8 @@ func NewPSKTriremeWithDockerMonitor(
 		syncAtStart,
 		nil)
 
+	probeContainers(triremeInstance, monitorInstance)
+
 	return triremeInstance, monitorInstance, triremeInstance.Supervisor(constants.ContainerPU).(supervisor.Excluder)
 
 }
@@ -346,10 +514,67 @@ func NewPKITriremeWithDockerMonitor(
 		syncAtStart,
 		nil)
 
+	probeContainers(triremeInstance, monitorInstance)
+
 	return triremeInstance, monitorInstance, triremeInstance.Supervisor(constants.ContainerPU).(supervisor.Excluder), publicKeyAdder
 
 }
 
+// NewTriremeWithCRIMonitor creates a new network isolator for the containers of
+// the CRI runtime of containerd, without the docker daemon. The calling module
+// must provide a policy engine implementation and the secrets.
+func NewTriremeWithCRIMonitor(
+	serverID string,
+	resolver trireme.PolicyResolver,
+	processor enforcer.PacketProcessor,
+	eventCollector collector.EventCollector,
+	syncAtStart bool,
+	secrets tokens.Secrets,
+	criMetadataExtractor crimonitor.CRIMetadataExtractor,
+	remoteEnforcer bool,
+) (trireme.Trireme, monitor.Monitor, supervisor.Excluder) {
+
+	if eventCollector == nil {
+		log.WithFields(log.Fields{
+			"package": "configurator",
+		}).Warn("Using a default collector for events")
+		eventCollector = &collector.DefaultCollector{}
+	}
+
+	var triremeInstance trireme.Trireme
+
+	if remoteEnforcer {
+		triremeInstance = NewDistributedTriremeDocker(
+			serverID,
+			resolver,
+			processor,
+			eventCollector,
+			secrets,
+			constants.IPTables)
+	} else {
+		triremeInstance = NewLocalTriremeDocker(
+			serverID,
+			resolver,
+			processor,
+			eventCollector,
+			secrets,
+			constants.IPTables)
+	}
+
+	monitorInstance := crimonitor.NewCRIMonitor(
+		constants.DefaultCRIEndpoint,
+		crimonitor.DefaultPollInterval,
+		triremeInstance,
+		criMetadataExtractor,
+		eventCollector,
+		syncAtStart,
+		nil)
+
+	probeContainers(triremeInstance, monitorInstance)
+
+	return triremeInstance, monitorInstance, triremeInstance.Supervisor(constants.ContainerPU).(supervisor.Excluder)
+}
+
 // NewPSKHybridTriremeWithMonitor creates a new network isolator. The calling module must provide
 // a policy engine implementation and a pre-shared secret. This is for backward
 // compatibility. Will be removed
@@ -389,6 +614,9 @@ func NewPSKHybridTriremeWithMonitor(
 		syncAtStart,
 		nil,
 	)
+
+	probeContainers(triremeInstance, monitorDocker)
+
 	// use rpcmonitor no need to return it since no other consumer for it
 	rpcmon, _ := rpcmonitor.NewRPCMonitor(
 		rpcmonitor.DefaultRPCAddress,
@@ -396,10 +624,168 @@ func NewPSKHybridTriremeWithMonitor(
 		eventCollector,
 	)
 
-	// configure a LinuxServices processor for the rpc monitor
+	// configure a LinuxServices processor for the rpc monitor, which verifies the
+	// processes of the PUs while the monitor runs
 	linuxMonitorProcessor := linuxmonitor.NewLinuxProcessor(eventCollector, triremeInstance, linuxmonitor.SystemdRPCMetadataExtractor, "")
 	rpcmon.RegisterProcessor(constants.LinuxProcessPU, linuxMonitorProcessor)
 
 	return triremeInstance, monitorDocker, rpcmon, triremeInstance.Supervisor(constants.ContainerPU).(supervisor.Excluder)
 
 }
+
+// DatapathSettings are the settings of the datapath of the enforcers
+type DatapathSettings struct {
+	// IntraHostMode defines how the connections between the PUs of the host are
+	// authorized
+	IntraHostMode enforcer.IntraHostMode
+	// InteropPolicies define the treatment of the peers without trireme per network
+	InteropPolicies []*enforcer.InteropPolicy
+	// ExternalEndpoints are the identities of the endpoints without trireme
+	ExternalEndpoints []*enforcer.ExternalEndpoint
+	// TagBudget is the budget of the transmitted tags, or nil for the default budget
+	TagBudget *tokens.TagBudget
+}
+
+// ConfigureDatapath applies the settings of the datapath to the enforcers of all the
+// PU types of a Trireme instance. The settings replace the previous ones: the external
+// endpoints missing from them are unregistered. The proxies of the remote enforcers
+// send them to the running remote enforcers and to the ones launched afterwards.
+func ConfigureDatapath(triremeInstance trireme.Trireme, settings *DatapathSettings) error {
+
+	enforcers := map[enforcer.PolicyEnforcer]bool{}
+
+	for _, kind := range []constants.PUType{constants.ContainerPU, constants.LinuxProcessPU} {
+
+		e := triremeInstance.Enforcer(kind)
+		if e == nil || enforcers[e] {
+			continue
+		}
+
+		if err := configureDatapath(e, settings); err != nil {
+			return fmt.Errorf("Failed to configure the datapath of the PU type %d: %s", kind, err)
+		}
+		enforcers[e] = true
+	}
+
+	return nil
+}
+
+// configureDatapath applies the settings of the datapath to an enforcer
+func configureDatapath(e enforcer.PolicyEnforcer, settings *DatapathSettings) error {
+
+	intraHost, ok := e.(enforcer.IntraHostConfigurer)
+	if !ok {
+		return fmt.Errorf("Enforcer does not support the intra-host modes")
+	}
+
+	interop, ok := e.(enforcer.InteropConfigurer)
+	if !ok {
+		return fmt.Errorf("Enforcer does not support the interop policies")
+	}
+
+	registry, ok := e.(enforcer.ExternalEndpointRegistry)
+	if !ok {
+		return fmt.Errorf("Enforcer does not support the external endpoints")
+	}
+
+	budget, ok := e.(enforcer.TagBudgetConfigurer)
+	if !ok {
+		return fmt.Errorf("Enforcer does not support the tag budgets")
+	}
+
+	if err := intraHost.SetIntraHostMode(settings.IntraHostMode); err != nil {
+		return err
+	}
+
+	if err := interop.SetInteropPolicies(settings.InteropPolicies); err != nil {
+		return err
+	}
+
+	registered := map[string]bool{}
+	for _, endpoint := range settings.ExternalEndpoints {
+		if err := registry.RegisterExternalEndpoint(endpoint); err != nil {
+			return err
+		}
+		registered[endpoint.Name] = true
+	}
+
+	for _, endpoint := range registry.ExternalEndpoints() {
+		if !registered[endpoint.Name] {
+			if err := registry.UnregisterExternalEndpoint(endpoint.Name); err != nil {
+				return err
+			}
+		}
+	}
+
+	return budget.SetTagBudget(settings.TagBudget)
+}
+
+// ConfigureClock replaces the clock of the enforcers of Trireme, so that the flows
+// and the tokens expire with it. It must be called before Trireme is started.
+func ConfigureClock(triremeInstance trireme.Trireme, clk clock.Clock) error {
+
+	enforcers := map[enforcer.PolicyEnforcer]bool{}
+
+	for _, kind := range []constants.PUType{constants.ContainerPU, constants.LinuxProcessPU} {
+
+		e := triremeInstance.Enforcer(kind)
+		if e == nil || enforcers[e] {
+			continue
+		}
+
+		configurer, ok := e.(enforcer.ClockConfigurer)
+		if !ok {
+			return fmt.Errorf("Enforcer of the PU type %d does not support alternative clocks", kind)
+		}
+
+		if err := configurer.SetClock(clk); err != nil {
+			return err
+		}
+		enforcers[e] = true
+	}
+
+	return nil
+}
+
+// ConfigureMTLS enables the mutual TLS data-plane mode of the enforcers of all the PU
+// types of a Trireme instance, and redirects the connections of their PUs to the
+// enforcers. The remote enforcers use their own PKI secrets. It must be called
+// before Trireme is started.
+func ConfigureMTLS(triremeInstance trireme.Trireme, config *enforcer.MTLSConfig) error {
+
+	if config == nil {
+		return fmt.Errorf("Mutual TLS configuration is missing")
+	}
+
+	enforcers := map[enforcer.PolicyEnforcer]bool{}
+	supervisors := map[supervisor.Supervisor]bool{}
+
+	for _, kind := range []constants.PUType{constants.ContainerPU, constants.LinuxProcessPU} {
+
+		if e := triremeInstance.Enforcer(kind); e != nil && !enforcers[e] {
+			configurer, ok := e.(enforcer.MTLSConfigurer)
+			if !ok {
+				return fmt.Errorf("Enforcer of the PU type %d does not support mutual TLS", kind)
+			}
+
+			if err := configurer.EnableMTLS(config); err != nil {
+				return err
+			}
+			enforcers[e] = true
+		}
+
+		if s := triremeInstance.Supervisor(kind); s != nil && !supervisors[s] {
+			redirector, ok := s.(supervisor.MTLSRedirector)
+			if !ok {
+				return fmt.Errorf("Supervisor of the PU type %d does not support mutual TLS", kind)
+			}
+
+			if err := redirector.SetMTLSRedirect(config.Networks, config.ClientPort, config.ServerPort); err != nil {
+				return err
+			}
+			supervisors[s] = true
+		}
+	}
+
+	return nil
+}
@@ -6,6 +6,9 @@ const (
 
 	// DefaultDockerSocketType is unix
 	DefaultDockerSocketType = "unix"
+
+	// DefaultCRIEndpoint is the default endpoint of the CRI runtime, containerd
+	DefaultCRIEndpoint = "unix:///run/containerd/containerd.sock"
 )
 
 // ModeType defines the mode of the enforcement and supervisor.
@@ -30,6 +33,12 @@ const (
 	IPSets ImplementationType = iota
 	// IPTables mandates an IPTable supervisor implementation
 	IPTables
+	// IPTablesDockerUser mandates an IPTable supervisor implementation anchored
+	// in the DOCKER-USER chain
+	IPTablesDockerUser
+	// IPSetsVerdictCache mandates an IPset supervisor implementation that caches the
+	// verdicts of the datapath for the accepted flows in an ipset
+	IPSetsVerdictCache
 	// Remote indicates that this is a remote supervisor
 )
 
@@ -41,6 +50,8 @@ const (
 	ContainerPU PUType = iota
 	// LinuxProcessPU indicates that this is Linux process
 	LinuxProcessPU
+	// WindowsProcessPU indicates that this is Windows process
+	WindowsProcessPU
 )
 
 const (
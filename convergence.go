@@ -0,0 +1,255 @@
+package trireme
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/policy"
+	"github.com/aporeto-inc/trireme/supervisor"
+)
+
+// PUConvergence is the convergence of a PU to a policy revision
+type PUConvergence struct {
+	// ContextID is the identifier of the PU
+	ContextID string
+	// Acknowledged is true if the datapath of the PU applied the revision
+	Acknowledged bool
+	// Lag is the time the datapath of the PU took to apply the revision, or the time
+	// elapsed since the revision was requested if it is not acknowledged yet
+	Lag time.Duration
+}
+
+// ConvergenceReport is the convergence of the PUs to a policy revision
+type ConvergenceReport struct {
+	// Revision is the policy revision, the value of the collector.PolicyRevisionTag
+	// annotation of the policies
+	Revision string
+	// Converged is true if all the PUs of the revision acknowledged it
+	Converged bool
+	// PUs is the convergence of the PUs whose latest policy is of the revision,
+	// sorted by contextID
+	PUs []*PUConvergence
+	// MaxLag is the largest lag of the PUs
+	MaxLag time.Duration
+}
+
+// puRevision is the latest revision requested for a PU and the latest revision
+// acknowledged by its datapath
+type puRevision struct {
+	requested   string
+	requestedAt time.Time
+	acked       string
+	ackedAt     time.Time
+}
+
+// convergenceTracker tracks the revisions of the PUs. The revisions are requested by
+// the request routine and acknowledged either by the request routine or, for the
+// supervisors implementing supervisor.PolicyAcknowledger, by the supervisors.
+type convergenceTracker struct {
+	pus     map[string]*puRevision
+	waiters map[string][]chan *ConvergenceReport
+	sync.Mutex
+}
+
+func newConvergenceTracker() *convergenceTracker {
+
+	return &convergenceTracker{
+		pus:     map[string]*puRevision{},
+		waiters: map[string][]chan *ConvergenceReport{},
+	}
+}
+
+// revisionOf returns the revision of a policy
+func revisionOf(p *policy.PUPolicy) string {
+
+	revision, _ := p.Annotations().Get(collector.PolicyRevisionTag)
+
+	return revision
+}
+
+// requested records the revision of the policy being applied to a PU
+func (c *convergenceTracker) requested(contextID, revision string, at time.Time) {
+
+	c.Lock()
+	defer c.Unlock()
+
+	pu, ok := c.pus[contextID]
+	if !ok {
+		pu = &puRevision{}
+		c.pus[contextID] = pu
+	}
+
+	// A PU retried keeps the time of the first request of the revision
+	if pu.requested == revision && pu.acked != revision {
+		return
+	}
+
+	pu.requested = revision
+	pu.requestedAt = at
+	pu.acked = ""
+
+	c.notify(at)
+}
+
+// acknowledged records the revision applied by the datapath of a PU
+func (c *convergenceTracker) acknowledged(contextID, revision string, at time.Time) {
+
+	c.Lock()
+	defer c.Unlock()
+
+	pu, ok := c.pus[contextID]
+	if !ok || pu.requested != revision {
+		return
+	}
+
+	pu.acked = revision
+	pu.ackedAt = at
+
+	c.notify(at)
+}
+
+// remove forgets a deleted PU
+func (c *convergenceTracker) remove(contextID string, at time.Time) {
+
+	c.Lock()
+	defer c.Unlock()
+
+	delete(c.pus, contextID)
+
+	c.notify(at)
+}
+
+// wait sends the report of the revision to the channel once it converged
+func (c *convergenceTracker) wait(revision string, ch chan *ConvergenceReport, at time.Time) {
+
+	c.Lock()
+	defer c.Unlock()
+
+	if report := c.report(revision, at); report.Converged {
+		ch <- report
+		return
+	}
+
+	c.waiters[revision] = append(c.waiters[revision], ch)
+}
+
+// convergence returns the report of the revision
+func (c *convergenceTracker) convergence(revision string, at time.Time) *ConvergenceReport {
+
+	c.Lock()
+	defer c.Unlock()
+
+	return c.report(revision, at)
+}
+
+// notify sends their report to the waiters of the revisions that converged. It must
+// be called with the lock held.
+func (c *convergenceTracker) notify(at time.Time) {
+
+	for revision, waiters := range c.waiters {
+		report := c.report(revision, at)
+		if !report.Converged {
+			continue
+		}
+
+		for _, ch := range waiters {
+			ch <- report
+		}
+		delete(c.waiters, revision)
+	}
+}
+
+// report returns the report of the revision. It must be called with the lock held.
+func (c *convergenceTracker) report(revision string, at time.Time) *ConvergenceReport {
+
+	report := &ConvergenceReport{
+		Revision:  revision,
+		Converged: true,
+		PUs:       []*PUConvergence{},
+	}
+
+	for _, contextID := range sortedKeys(c.pus) {
+		pu := c.pus[contextID]
+		if pu.requested != revision {
+			continue
+		}
+
+		state := &PUConvergence{
+			ContextID:    contextID,
+			Acknowledged: pu.acked == revision,
+			Lag:          at.Sub(pu.requestedAt),
+		}
+
+		if state.Acknowledged {
+			state.Lag = pu.ackedAt.Sub(pu.requestedAt)
+		} else {
+			report.Converged = false
+		}
+
+		if state.Lag > report.MaxLag {
+			report.MaxLag = state.Lag
+		}
+
+		report.PUs = append(report.PUs, state)
+	}
+
+	return report
+}
+
+// sortedKeys returns the sorted contextIDs of the PUs
+func sortedKeys(pus map[string]*puRevision) []string {
+
+	keys := make([]string, 0, len(pus))
+	for contextID := range pus {
+		keys = append(keys, contextID)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Convergence implements the ConvergenceReporter interface
+func (t *trireme) Convergence(revision string) *ConvergenceReport {
+
+	return t.convergence.convergence(revision, t.clock.Now())
+}
+
+// WaitForConvergence implements the ConvergenceReporter interface. The request is
+// handled after the requests made before it, so the PUs updated by them are part of
+// the report.
+func (t *trireme) WaitForConvergence(revision string) <-chan *ConvergenceReport {
+
+	c := make(chan *ConvergenceReport, 1)
+
+	t.requests <- &triremeRequest{
+		reqType:     convergenceRequest,
+		revision:    revision,
+		convergence: c,
+		returnChan:  make(chan error, 1),
+	}
+
+	return c
+}
+
+// doWaitForConvergence registers the channel of a WaitForConvergence request
+func (t *trireme) doWaitForConvergence(revision string, c chan *ConvergenceReport) error {
+
+	t.convergence.wait(revision, c, t.clock.Now())
+
+	return nil
+}
+
+// trackAcknowledgements sets the handler of the supervisors that acknowledge the
+// policies themselves, because they apply some of them after the call returned
+func (t *trireme) trackAcknowledgements() {
+
+	for _, s := range t.supervisors {
+		if acknowledger, ok := s.(supervisor.PolicyAcknowledger); ok {
+			acknowledger.SetAckHandler(func(contextID string, puInfo *policy.PUInfo) {
+				t.convergence.acknowledged(contextID, revisionOf(puInfo.Policy), t.clock.Now())
+			})
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package enforcer
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aporeto-inc/trireme/cache"
+	"github.com/aporeto-inc/trireme/enforcer/netfilter"
+	"github.com/aporeto-inc/trireme/utils/clock"
+)
+
+// PacketVerdict is the decision of the enforcer for a captured packet
+type PacketVerdict int
+
+const (
+	// VerdictDrop drops the packet
+	VerdictDrop PacketVerdict = iota
+	// VerdictAccept transmits the packet
+	VerdictAccept
+)
+
+// CapturedPacket is a packet captured by a datapath
+type CapturedPacket struct {
+	// Buffer holds the IP packet
+	Buffer []byte
+	// Mark is the decimal packet mark, or empty if the capture mechanism has no marks
+	Mark string
+	// Context is opaque to the enforcer and handed back with the verdict of the packet
+	Context interface{}
+}
+
+// PacketSource captures the packets of the processing units in one direction
+type PacketSource interface {
+
+	// Start starts delivering the captured packets to the handler. The handler
+	// can be called concurrently and returns once the verdict of the packet is set.
+	Start(handler func(p *CapturedPacket)) error
+}
+
+// VerdictSink receives the verdicts of the enforcer
+type VerdictSink interface {
+
+	// SetVerdict releases the packet. An accepted packet is transmitted as the
+	// concatenation of buffer, options and payload, where buffer holds the
+	// headers and options and payload are the TCP options and data rewritten
+	// by the enforcer. The mark is the one to apply to the packet.
+	SetVerdict(p *CapturedPacket, verdict PacketVerdict, buffer, options, payload []byte, mark int) error
+}
+
+// FlowTable tracks the state of the flows of the datapath
+type FlowTable interface {
+	cache.DataStore
+}
+
+// Datapath is a packet capture mechanism. Alternative mechanisms such as
+// AF_PACKET, AF_XDP or DPDK implement it to reuse the policy, token and collector
+// layers of the enforcer. The supervisor must steer the packets of the processing
+// units to the datapath.
+type Datapath interface {
+	VerdictSink
+
+	// NetworkSource returns the source of the packets received from the network.
+	NetworkSource() PacketSource
+
+	// ApplicationSource returns the source of the packets sent by the applications.
+	ApplicationSource() PacketSource
+
+	// NewFlowTable returns a flow table whose entries expire after the lifetime,
+	// measured by the clock of the enforcer.
+	NewFlowTable(lifetime time.Duration, clk clock.Clock) FlowTable
+}
+
+// nfqDatapath is the default datapath, based on the netfilter queues
+type nfqDatapath struct {
+	network     *nfqSource
+	application *nfqSource
+}
+
+// nfqSource captures the packets of a range of netfilter queues
+type nfqSource struct {
+	first  uint16
+	number uint16
+	size   uint32
+}
+
+// newNFQDatapath returns the datapath of the netfilter queues of the configuration
+func newNFQDatapath(fq *FilterQueue) *nfqDatapath {
+
+	return &nfqDatapath{
+		network: &nfqSource{
+			first:  fq.NetworkQueue,
+			number: fq.NumberOfNetworkQueues,
+			size:   fq.NetworkQueueSize,
+		},
+		application: &nfqSource{
+			first:  fq.ApplicationQueue,
+			number: fq.NumberOfApplicationQueues,
+			size:   fq.ApplicationQueueSize,
+		},
+	}
+}
+
+// NetworkSource implements the Datapath interface
+func (n *nfqDatapath) NetworkSource() PacketSource {
+	return n.network
+}
+
+// ApplicationSource implements the Datapath interface
+func (n *nfqDatapath) ApplicationSource() PacketSource {
+	return n.application
+}
+
+// NewFlowTable implements the Datapath interface
+func (n *nfqDatapath) NewFlowTable(lifetime time.Duration, clk clock.Clock) FlowTable {
+	return cache.NewCacheWithClock(lifetime, clk)
+}
+
+// SetVerdict implements the Datapath interface
+func (n *nfqDatapath) SetVerdict(p *CapturedPacket, verdict PacketVerdict, buffer, options, payload []byte, mark int) error {
+
+	nfp, ok := p.Context.(*netfilter.NFPacket)
+	if !ok {
+		return fmt.Errorf("Packet was not captured by a netfilter queue")
+	}
+
+	v := &netfilter.Verdict{
+		V:           netfilter.NfDrop,
+		Buffer:      buffer,
+		Xbuffer:     nfp.Xbuffer,
+		ID:          nfp.ID,
+		QueueHandle: nfp.QueueHandle,
+	}
+
+	if verdict == VerdictAccept {
+		v.V = netfilter.NfAccept
+		v.Options = options
+		v.Payload = payload
+	}
+
+	netfilter.SetVerdict(v, mark)
+
+	return nil
+}
+
+// Start implements the PacketSource interface
+func (s *nfqSource) Start(handler func(p *CapturedPacket)) error {
+
+	for i := uint16(0); i < s.number; i++ {
+
+		nfq, err := netfilter.NewNFQueue(s.first+i, s.size, netfilter.NfDefaultPacketSize)
+		if err != nil {
+			return fmt.Errorf("Unable to initialize netfilter queue %d: %s", s.first+i, err)
+		}
+
+		go func() {
+			for p := range nfq.Packets {
+				handler(&CapturedPacket{
+					Buffer:  p.Buffer,
+					Mark:    p.Mark,
+					Context: p,
+				})
+			}
+		}()
+	}
+
+	log.WithFields(log.Fields{
+		"package": "enforcer",
+		"queue":   s.first,
+		"number":  s.number,
+	}).Debug("Started netfilter queues")
+
+	return nil
+}
@@ -0,0 +1,169 @@
+// +build linux
+
+package enforcer
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aporeto-inc/trireme/constants"
+)
+
+const (
+	// ebpfSection is the section of the classifier in the object of the program
+	ebpfSection = "classifier"
+	// ebpfFlowMap is the map of the accepted flows, pinned by tc when it loads the
+	// classifier
+	ebpfFlowMap = "/sys/fs/bpf/tc/globals/trireme_flows"
+	// ebpfUpdateQueue is the number of updates of the map waiting for bpftool
+	ebpfUpdateQueue = 1024
+	// ebpfUpdateBatch is the maximum number of updates of the map run by a single
+	// bpftool process
+	ebpfUpdateBatch = 256
+)
+
+// runBatch runs the commands with a single bpftool process reading them from its
+// standard input
+var runBatch = func(commands []string) error {
+
+	cmd := exec.Command("bpftool", "batch", "file", "-")
+	cmd.Stdin = strings.NewReader(strings.Join(commands, "\n") + "\n")
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("bpftool batch of %d updates: %s %s", len(commands), err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// ebpfDatapath is the raw socket datapath with an eBPF classifier ahead of the
+// redirection of the packets to the raw sockets. The classifier transmits the
+// packets of the flows of its map, where the enforcer caches the accepted flows.
+// The map is updated by bpftool in the background, so that the packets are not
+// delayed by the updates. The pending updates are run in batches by a single
+// bpftool process.
+type ebpfDatapath struct {
+	*rawDatapath
+	updates chan string
+}
+
+// newEBPFDatapath returns the eBPF datapath of the configuration
+func newEBPFDatapath(fq *FilterQueue, mode constants.ModeType) *ebpfDatapath {
+
+	dp := &ebpfDatapath{
+		rawDatapath: newRawDatapath(fq, mode),
+		updates:     make(chan string, ebpfUpdateQueue),
+	}
+
+	dp.program = fq.CaptureProgram
+	if dp.program == "" {
+		dp.program = DefaultEBPFProgram
+	}
+
+	go dp.runUpdates()
+
+	return dp
+}
+
+// CacheVerdict implements the VerdictCache interface. The flows are only cached
+// with their source port.
+func (e *ebpfDatapath) CacheVerdict(source, destination net.IP, port uint16) error {
+	return fmt.Errorf("eBPF capture only caches the flows with their source port")
+}
+
+// EvictVerdict implements the VerdictCache interface
+func (e *ebpfDatapath) EvictVerdict(source, destination net.IP, port uint16) error {
+	return fmt.Errorf("eBPF capture only caches the flows with their source port")
+}
+
+// CacheFlowVerdict implements the FlowVerdictCache interface
+func (e *ebpfDatapath) CacheFlowVerdict(source, destination net.IP, sourcePort, destinationPort uint16) error {
+
+	key, err := ebpfFlowKey(source, destination, sourcePort, destinationPort)
+	if err != nil {
+		return err
+	}
+
+	return e.update("map update pinned " + ebpfFlowMap + " key hex " + strings.Join(key, " ") + " value hex 01 any")
+}
+
+// EvictFlowVerdict implements the FlowVerdictCache interface
+func (e *ebpfDatapath) EvictFlowVerdict(source, destination net.IP, sourcePort, destinationPort uint16) error {
+
+	key, err := ebpfFlowKey(source, destination, sourcePort, destinationPort)
+	if err != nil {
+		return err
+	}
+
+	return e.update("map delete pinned " + ebpfFlowMap + " key hex " + strings.Join(key, " "))
+}
+
+// update queues the bpftool command updating the map. It fails rather than waiting
+// when too many updates are pending, the packets of the flow being processed in user
+// space.
+func (e *ebpfDatapath) update(cmd string) error {
+
+	select {
+	case e.updates <- cmd:
+		return nil
+	default:
+		return fmt.Errorf("Too many pending updates of the flow map")
+	}
+}
+
+// runUpdates runs the updates of the map in order, batching the pending updates
+func (e *ebpfDatapath) runUpdates() {
+
+	for cmd := range e.updates {
+		batch := []string{cmd}
+
+	pending:
+		for len(batch) < ebpfUpdateBatch {
+			select {
+			case next, ok := <-e.updates:
+				if !ok {
+					break pending
+				}
+				batch = append(batch, next)
+			default:
+				break pending
+			}
+		}
+
+		if err := runBatch(batch); err != nil {
+			log.WithFields(log.Fields{
+				"package": "enforcer",
+				"error":   err.Error(),
+			}).Debug("Failed to update the flow map of the eBPF classifier")
+		}
+	}
+}
+
+// ebpfFlowKey returns the bytes of the key of a flow in the map of the classifier,
+// in the hexadecimal format of bpftool. The key is the client address, the server
+// address, the client port and the server port, all in the network byte order.
+func ebpfFlowKey(source, destination net.IP, sourcePort, destinationPort uint16) ([]string, error) {
+
+	client := source.To4()
+	server := destination.To4()
+	if client == nil || server == nil {
+		return nil, fmt.Errorf("eBPF capture only caches IPv4 flows")
+	}
+
+	key := make([]byte, 0, 12)
+	key = append(key, client...)
+	key = append(key, server...)
+	key = append(key, byte(sourcePort>>8), byte(sourcePort), byte(destinationPort>>8), byte(destinationPort))
+
+	bytes := make([]string, len(key))
+	for i, b := range key {
+		bytes[i] = hex.EncodeToString([]byte{b})
+	}
+
+	return bytes, nil
+}
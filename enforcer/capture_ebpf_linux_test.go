@@ -0,0 +1,142 @@
+// +build linux
+
+package enforcer
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEBPFCaptureCommands(t *testing.T) {
+
+	Convey("Given the eBPF capture of an interface", t, func() {
+
+		mac, _ := net.ParseMAC("02:42:ac:11:00:02")
+		c := &rawCapture{
+			iface:       net.Interface{Index: 7, Name: "eth0", HardwareAddr: mac},
+			network:     "trc7n",
+			application: "trc7a",
+		}
+
+		cmds := rawCaptureCommands(c, 0x400, 0xf00, "/tmp/flows.o")
+
+		joined := []string{}
+		for _, cmd := range cmds {
+			joined = append(joined, strings.Join(cmd, " "))
+		}
+
+		Convey("The classifier should be loaded ahead of the redirection in both directions", func() {
+			So(joined, ShouldContain, "tc filter add dev eth0 ingress prio 2 protocol ip bpf da obj /tmp/flows.o sec classifier")
+			So(joined, ShouldContain, "tc filter add dev eth0 egress prio 2 protocol ip bpf da obj /tmp/flows.o sec classifier")
+			So(joined, ShouldContain, "tc filter add dev eth0 ingress prio 3 protocol ip u32 match ip protocol 6 0xff action mirred egress redirect dev trc7n0")
+			So(joined, ShouldContain, "tc filter add dev eth0 egress prio 3 protocol ip u32 match ip protocol 6 0xff action mirred egress redirect dev trc7a0")
+		})
+	})
+}
+
+func TestEBPFFlowKey(t *testing.T) {
+
+	Convey("Given an IPv4 flow", t, func() {
+
+		Convey("The key should hold the addresses and the ports in the network byte order", func() {
+			key, err := ebpfFlowKey(net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), 40000, 443)
+			So(err, ShouldBeNil)
+			So(strings.Join(key, " "), ShouldEqual, "0a 00 00 01 0a 00 00 02 9c 40 01 bb")
+		})
+
+		Convey("IPv6 flows should not be cached", func() {
+			_, err := ebpfFlowKey(net.ParseIP("2001:db8::1"), net.ParseIP("10.0.0.2"), 40000, 443)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestEBPFDatapath(t *testing.T) {
+
+	Convey("Given an eBPF datapath", t, func() {
+
+		commands := make(chan string, 10)
+		saved := runBatch
+		runBatch = func(batch []string) error {
+			for _, cmd := range batch {
+				commands <- cmd
+			}
+			return nil
+		}
+		defer func() { runBatch = saved }()
+
+		dp := newEBPFDatapath(&FilterQueue{MarkValue: 0x400}, constants.RemoteContainer)
+
+		Convey("It should load the default classifier", func() {
+			So(dp.program, ShouldEqual, DefaultEBPFProgram)
+		})
+
+		Convey("When a flow is cached and evicted, the map should be updated in order", func() {
+			So(dp.CacheFlowVerdict(net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), 40000, 443), ShouldBeNil)
+			So(dp.EvictFlowVerdict(net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), 40000, 443), ShouldBeNil)
+
+			So(<-commands, ShouldEqual, "map update pinned "+ebpfFlowMap+" key hex 0a 00 00 01 0a 00 00 02 9c 40 01 bb value hex 01 any")
+			So(<-commands, ShouldEqual, "map delete pinned "+ebpfFlowMap+" key hex 0a 00 00 01 0a 00 00 02 9c 40 01 bb")
+		})
+
+		Convey("The flows should not be cached without their source port", func() {
+			So(dp.CacheVerdict(net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), 443), ShouldNotBeNil)
+		})
+
+		close(dp.updates)
+	})
+
+	Convey("Given an eBPF datapath whose updates are blocked", t, func() {
+
+		dp := &ebpfDatapath{updates: make(chan string, 1)}
+
+		Convey("The updates should fail once the queue is full", func() {
+			So(dp.CacheFlowVerdict(net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), 40000, 443), ShouldBeNil)
+			So(dp.CacheFlowVerdict(net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), 40001, 443), ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given an eBPF datapath with pending updates", t, func() {
+
+		batches := [][]string{}
+		saved := runBatch
+		runBatch = func(batch []string) error {
+			batches = append(batches, batch)
+			return nil
+		}
+		defer func() { runBatch = saved }()
+
+		dp := &ebpfDatapath{updates: make(chan string, 10)}
+		for port := uint16(40000); port < 40003; port++ {
+			So(dp.CacheFlowVerdict(net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), port, 443), ShouldBeNil)
+		}
+		close(dp.updates)
+
+		dp.runUpdates()
+
+		Convey("The pending updates should be run by a single bpftool", func() {
+			So(len(batches), ShouldEqual, 1)
+			So(len(batches[0]), ShouldEqual, 3)
+		})
+	})
+
+	Convey("Given an enforcer with the eBPF capture", t, func() {
+
+		secret := tokens.NewPSKSecrets([]byte("Dummy Test Password"))
+		fq := &FilterQueue{MarkValue: 0x400, CaptureMode: CaptureEBPF, CaptureProgram: "/tmp/flows.o"}
+		d := NewDatapathEnforcer(false, fq, &flowCollector{}, nil, secret, "server", time.Hour, constants.RemoteContainer).(*datapathEnforcer)
+
+		Convey("The datapath should cache the verdicts of the accepted flows", func() {
+			dp, ok := d.datapath.(*ebpfDatapath)
+			So(ok, ShouldBeTrue)
+			So(dp.program, ShouldEqual, "/tmp/flows.o")
+			So(d.verdicts, ShouldEqual, dp)
+		})
+	})
+}
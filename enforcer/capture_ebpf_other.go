@@ -0,0 +1,40 @@
+// +build !linux
+
+package enforcer
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/aporeto-inc/trireme/constants"
+)
+
+// ebpfDatapath is not supported on this platform
+type ebpfDatapath struct {
+	*rawDatapath
+}
+
+// newEBPFDatapath returns a datapath failing to start
+func newEBPFDatapath(fq *FilterQueue, mode constants.ModeType) *ebpfDatapath {
+	return &ebpfDatapath{rawDatapath: newRawDatapath(fq, mode)}
+}
+
+// CacheVerdict implements the VerdictCache interface
+func (e *ebpfDatapath) CacheVerdict(source, destination net.IP, port uint16) error {
+	return fmt.Errorf("eBPF capture is not supported on this platform")
+}
+
+// EvictVerdict implements the VerdictCache interface
+func (e *ebpfDatapath) EvictVerdict(source, destination net.IP, port uint16) error {
+	return fmt.Errorf("eBPF capture is not supported on this platform")
+}
+
+// CacheFlowVerdict implements the FlowVerdictCache interface
+func (e *ebpfDatapath) CacheFlowVerdict(source, destination net.IP, sourcePort, destinationPort uint16) error {
+	return fmt.Errorf("eBPF capture is not supported on this platform")
+}
+
+// EvictFlowVerdict implements the FlowVerdictCache interface
+func (e *ebpfDatapath) EvictFlowVerdict(source, destination net.IP, sourcePort, destinationPort uint16) error {
+	return fmt.Errorf("eBPF capture is not supported on this platform")
+}
@@ -0,0 +1,383 @@
+// +build linux
+
+package enforcer
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aporeto-inc/trireme/cache"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/utils/clock"
+	"github.com/aporeto-inc/trireme/utils/marks"
+)
+
+const (
+	// rawCapturePrefix prefixes the names of the veth pairs of the raw socket capture
+	rawCapturePrefix = "trc"
+	// ethHeaderLen is the length of the ethernet header of the captured frames
+	ethHeaderLen = 14
+	// ethPIP is the ethernet type of the IPv4 packets
+	ethPIP = 0x0800
+)
+
+// runCommand runs the commands configuring the interfaces
+var runCommand = func(name string, args ...string) error {
+
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s: %s %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// rawDatapath captures the packets with raw sockets. The TCP packets of each
+// interface are redirected by tc filters to a veth pair per direction, whose
+// peer holds the socket. The accepted packets are sent back through the veth
+// pair with the mark of the enforcer, and redirected to their interface where
+// the mark exempts them from the capture.
+type rawDatapath struct {
+	interfaces []string
+	mark       uint32
+	mask       uint32
+	mode       constants.ModeType
+	// program is the object of the eBPF classifier of the capture, if any
+	program string
+
+	network     *rawSource
+	application *rawSource
+
+	setupOnce sync.Once
+	setupErr  error
+	captures  []*rawCapture
+}
+
+// rawCapture holds the veth pairs of a captured interface
+type rawCapture struct {
+	iface       net.Interface
+	network     string
+	application string
+}
+
+// rawSource captures the packets of a direction
+type rawSource struct {
+	dp      *rawDatapath
+	ingress bool
+}
+
+// rawSocket is a packet socket bound to the peer of a veth pair
+type rawSocket struct {
+	fd   int
+	mark int
+	sync.Mutex
+}
+
+// rawPacket is the context of a packet captured by a raw socket
+type rawPacket struct {
+	socket *rawSocket
+	header []byte
+}
+
+// newRawDatapath returns the raw socket datapath of the configuration
+func newRawDatapath(fq *FilterQueue, mode constants.ModeType) *rawDatapath {
+
+	mask := fq.MarkMask
+	if mask == 0 {
+		mask = marks.FullMask
+	}
+
+	dp := &rawDatapath{
+		interfaces: fq.CaptureInterfaces,
+		mark:       uint32(fq.MarkValue) & mask,
+		mask:       mask,
+		mode:       mode,
+	}
+	dp.network = &rawSource{dp: dp, ingress: true}
+	dp.application = &rawSource{dp: dp, ingress: false}
+
+	return dp
+}
+
+// NetworkSource implements the Datapath interface
+func (r *rawDatapath) NetworkSource() PacketSource {
+	return r.network
+}
+
+// ApplicationSource implements the Datapath interface
+func (r *rawDatapath) ApplicationSource() PacketSource {
+	return r.application
+}
+
+// NewFlowTable implements the Datapath interface
+func (r *rawDatapath) NewFlowTable(lifetime time.Duration, clk clock.Clock) FlowTable {
+	return cache.NewCacheWithClock(lifetime, clk)
+}
+
+// SetVerdict implements the Datapath interface. The dropped packets are not sent back.
+func (r *rawDatapath) SetVerdict(p *CapturedPacket, verdict PacketVerdict, buffer, options, payload []byte, mark int) error {
+
+	rp, ok := p.Context.(*rawPacket)
+	if !ok {
+		return fmt.Errorf("Packet was not captured by a raw socket")
+	}
+
+	if verdict != VerdictAccept {
+		return nil
+	}
+
+	frame := make([]byte, 0, len(rp.header)+len(buffer)+len(options)+len(payload))
+	frame = append(frame, rp.header...)
+	frame = append(frame, buffer...)
+	frame = append(frame, options...)
+	frame = append(frame, payload...)
+
+	return rp.socket.send(frame, mark)
+}
+
+// setup creates the veth pairs and the tc filters of the captured interfaces
+func (r *rawDatapath) setup() error {
+
+	r.setupOnce.Do(func() {
+
+		if r.mode != constants.RemoteContainer {
+			r.setupErr = fmt.Errorf("Raw socket capture is only supported for remote containers")
+			return
+		}
+
+		ifaces, err := r.capturedInterfaces()
+		if err != nil {
+			r.setupErr = err
+			return
+		}
+
+		for _, iface := range ifaces {
+			c := &rawCapture{
+				iface:       iface,
+				network:     fmt.Sprintf("%s%dn", rawCapturePrefix, iface.Index),
+				application: fmt.Sprintf("%s%da", rawCapturePrefix, iface.Index),
+			}
+
+			// Remove the pairs left by a previous enforcer
+			runCommand("ip", "link", "del", c.network+"0")
+			runCommand("ip", "link", "del", c.application+"0")
+
+			for _, cmd := range rawCaptureCommands(c, r.mark, r.mask, r.program) {
+				if err := runCommand(cmd[0], cmd[1:]...); err != nil {
+					r.setupErr = fmt.Errorf("Unable to redirect the packets of %s: %s", iface.Name, err)
+					return
+				}
+			}
+
+			r.captures = append(r.captures, c)
+		}
+
+		log.WithFields(log.Fields{
+			"package":    "enforcer",
+			"interfaces": len(r.captures),
+		}).Info("Capturing the packets with raw sockets")
+	})
+
+	return r.setupErr
+}
+
+// capturedInterfaces returns the configured interfaces, or all the interfaces but
+// the loopback and the veth pairs of the capture
+func (r *rawDatapath) capturedInterfaces() ([]net.Interface, error) {
+
+	if len(r.interfaces) > 0 {
+		ifaces := []net.Interface{}
+		for _, name := range r.interfaces {
+			iface, err := net.InterfaceByName(name)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid capture interface %s: %s", name, err)
+			}
+			ifaces = append(ifaces, *iface)
+		}
+		return ifaces, nil
+	}
+
+	all, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list the interfaces: %s", err)
+	}
+
+	ifaces := []net.Interface{}
+	for _, iface := range all {
+		if iface.Flags&net.FlagLoopback != 0 || strings.HasPrefix(iface.Name, rawCapturePrefix) {
+			continue
+		}
+		ifaces = append(ifaces, iface)
+	}
+
+	return ifaces, nil
+}
+
+// rawCaptureCommands returns the commands redirecting the TCP packets of the
+// interface to the veth pairs of the capture. The second interface of each pair
+// holds the socket. The first one carries the MAC address of the interface, so
+// that the packets sent back and redirected to the ingress of the interface are
+// still addressed to the host. The eBPF classifier of the program, if any, transmits
+// the packets of the flows it accepts ahead of the redirection.
+func rawCaptureCommands(c *rawCapture, mark, mask uint32, program string) [][]string {
+
+	iface := c.iface.Name
+	handle := fmt.Sprintf("0x%x/0x%x", mark, mask)
+
+	cmds := [][]string{
+		{"tc", "qdisc", "replace", "dev", iface, "clsact"},
+	}
+
+	directions := []struct {
+		pair     string
+		hook     string
+		redirect string
+	}{
+		{pair: c.network, hook: "ingress", redirect: "ingress"},
+		{pair: c.application, hook: "egress", redirect: "egress"},
+	}
+
+	for _, d := range directions {
+		redirect, socket := d.pair+"0", d.pair+"1"
+
+		cmds = append(cmds,
+			[]string{"ip", "link", "add", redirect, "type", "veth", "peer", "name", socket},
+			[]string{"ip", "link", "set", redirect, "address", c.iface.HardwareAddr.String()},
+			[]string{"ip", "link", "set", redirect, "up"},
+			[]string{"ip", "link", "set", socket, "up"},
+			[]string{"tc", "qdisc", "replace", "dev", redirect, "clsact"},
+			// The packets sent back by the enforcer go back to the interface
+			[]string{"tc", "filter", "add", "dev", redirect, "ingress", "prio", "1", "matchall",
+				"action", "mirred", d.redirect, "redirect", "dev", iface},
+			// The packets marked by the enforcer are not captured again
+			[]string{"tc", "filter", "add", "dev", iface, d.hook, "prio", "1", "protocol", "ip",
+				"handle", handle, "fw", "action", "ok"},
+		)
+
+		prio := "2"
+		if program != "" {
+			// The packets of the flows accepted by the classifier are transmitted
+			cmds = append(cmds, []string{"tc", "filter", "add", "dev", iface, d.hook, "prio", "2", "protocol", "ip",
+				"bpf", "da", "obj", program, "sec", ebpfSection})
+			prio = "3"
+		}
+
+		cmds = append(cmds, []string{"tc", "filter", "add", "dev", iface, d.hook, "prio", prio, "protocol", "ip",
+			"u32", "match", "ip", "protocol", "6", "0xff",
+			"action", "mirred", "egress", "redirect", "dev", redirect})
+	}
+
+	return cmds
+}
+
+// Start implements the PacketSource interface
+func (s *rawSource) Start(handler func(p *CapturedPacket)) error {
+
+	if err := s.dp.setup(); err != nil {
+		return err
+	}
+
+	for _, c := range s.dp.captures {
+
+		name := c.application + "1"
+		if s.ingress {
+			name = c.network + "1"
+		}
+
+		socket, err := openRawSocket(name)
+		if err != nil {
+			return err
+		}
+
+		go socket.run(handler)
+	}
+
+	return nil
+}
+
+// openRawSocket opens a packet socket receiving the IPv4 frames of the interface
+func openRawSocket(name string) (*rawSocket, error) {
+
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to find the capture interface %s: %s", name, err)
+	}
+
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, int(htons(ethPIP)))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open a packet socket: %s", err)
+	}
+
+	if err := syscall.Bind(fd, &syscall.SockaddrLinklayer{Protocol: htons(ethPIP), Ifindex: iface.Index}); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("Unable to bind the packet socket to %s: %s", name, err)
+	}
+
+	return &rawSocket{fd: fd}, nil
+}
+
+// run delivers the packets received by the socket to the handler
+func (s *rawSocket) run(handler func(p *CapturedPacket)) {
+
+	buffer := make([]byte, 65536)
+
+	for {
+		n, _, err := syscall.Recvfrom(s.fd, buffer, 0)
+		if err != nil {
+			if err == syscall.EINTR {
+				continue
+			}
+			log.WithFields(log.Fields{
+				"package": "enforcer",
+				"error":   err.Error(),
+			}).Error("Unable to read the packet socket")
+			return
+		}
+
+		if n <= ethHeaderLen {
+			continue
+		}
+
+		frame := make([]byte, n)
+		copy(frame, buffer[:n])
+
+		handler(&CapturedPacket{
+			Buffer: frame[ethHeaderLen:],
+			Mark:   "0",
+			Context: &rawPacket{
+				socket: s,
+				header: frame[:ethHeaderLen],
+			},
+		})
+	}
+}
+
+// send transmits the frame with the mark
+func (s *rawSocket) send(frame []byte, mark int) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if mark != s.mark {
+		if err := syscall.SetsockoptInt(s.fd, syscall.SOL_SOCKET, syscall.SO_MARK, mark); err != nil {
+			return fmt.Errorf("Unable to set the mark of the packet socket: %s", err)
+		}
+		s.mark = mark
+	}
+
+	if _, err := syscall.Write(s.fd, frame); err != nil {
+		return fmt.Errorf("Unable to send the packet: %s", err)
+	}
+
+	return nil
+}
+
+// htons converts a short to the network byte order
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
@@ -0,0 +1,47 @@
+// +build linux
+
+package enforcer
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRawCaptureCommands(t *testing.T) {
+
+	Convey("Given the capture of an interface", t, func() {
+
+		mac, _ := net.ParseMAC("02:42:ac:11:00:02")
+		c := &rawCapture{
+			iface:       net.Interface{Index: 7, Name: "eth0", HardwareAddr: mac},
+			network:     "trc7n",
+			application: "trc7a",
+		}
+
+		cmds := rawCaptureCommands(c, 0x400, 0xf00, "")
+
+		joined := []string{}
+		for _, cmd := range cmds {
+			joined = append(joined, strings.Join(cmd, " "))
+		}
+
+		Convey("The marked packets should bypass the capture in both directions", func() {
+			So(joined, ShouldContain, "tc filter add dev eth0 ingress prio 1 protocol ip handle 0x400/0xf00 fw action ok")
+			So(joined, ShouldContain, "tc filter add dev eth0 egress prio 1 protocol ip handle 0x400/0xf00 fw action ok")
+		})
+
+		Convey("The TCP packets should be redirected to the veth pairs", func() {
+			So(joined, ShouldContain, "tc filter add dev eth0 ingress prio 2 protocol ip u32 match ip protocol 6 0xff action mirred egress redirect dev trc7n0")
+			So(joined, ShouldContain, "tc filter add dev eth0 egress prio 2 protocol ip u32 match ip protocol 6 0xff action mirred egress redirect dev trc7a0")
+		})
+
+		Convey("The packets sent back should return to the interface", func() {
+			So(joined, ShouldContain, "ip link set trc7n0 address 02:42:ac:11:00:02")
+			So(joined, ShouldContain, "tc filter add dev trc7n0 ingress prio 1 matchall action mirred ingress redirect dev eth0")
+			So(joined, ShouldContain, "tc filter add dev trc7a0 ingress prio 1 matchall action mirred egress redirect dev eth0")
+		})
+	})
+}
@@ -0,0 +1,45 @@
+// +build !linux
+
+package enforcer
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aporeto-inc/trireme/cache"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/utils/clock"
+)
+
+// rawDatapath is not supported on this platform
+type rawDatapath struct{}
+
+// newRawDatapath returns a datapath failing to start
+func newRawDatapath(fq *FilterQueue, mode constants.ModeType) *rawDatapath {
+	return &rawDatapath{}
+}
+
+// NetworkSource implements the Datapath interface
+func (r *rawDatapath) NetworkSource() PacketSource {
+	return r
+}
+
+// ApplicationSource implements the Datapath interface
+func (r *rawDatapath) ApplicationSource() PacketSource {
+	return r
+}
+
+// NewFlowTable implements the Datapath interface
+func (r *rawDatapath) NewFlowTable(lifetime time.Duration, clk clock.Clock) FlowTable {
+	return cache.NewCacheWithClock(lifetime, clk)
+}
+
+// SetVerdict implements the Datapath interface
+func (r *rawDatapath) SetVerdict(p *CapturedPacket, verdict PacketVerdict, buffer, options, payload []byte, mark int) error {
+	return fmt.Errorf("Raw socket capture is not supported on this platform")
+}
+
+// Start implements the PacketSource interface
+func (r *rawDatapath) Start(handler func(p *CapturedPacket)) error {
+	return fmt.Errorf("Raw socket capture is not supported on this platform")
+}
@@ -0,0 +1,111 @@
+package enforcer
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aporeto-inc/trireme/cache"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+	"github.com/aporeto-inc/trireme/policy"
+	"github.com/aporeto-inc/trireme/utils/clock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// testSource delivers its packets when started
+type testSource struct {
+	packets []*CapturedPacket
+}
+
+func (s *testSource) Start(handler func(p *CapturedPacket)) error {
+
+	for _, p := range s.packets {
+		handler(p)
+	}
+
+	return nil
+}
+
+// testDatapath records the verdicts of the enforcer
+type testDatapath struct {
+	network     *testSource
+	application *testSource
+	tables      int
+	verdicts    map[interface{}]PacketVerdict
+	sync.Mutex
+}
+
+func (t *testDatapath) NetworkSource() PacketSource {
+	return t.network
+}
+
+func (t *testDatapath) ApplicationSource() PacketSource {
+	return t.application
+}
+
+func (t *testDatapath) NewFlowTable(lifetime time.Duration, clk clock.Clock) FlowTable {
+
+	t.tables++
+
+	return cache.NewCacheWithClock(lifetime, clk)
+}
+
+func (t *testDatapath) SetVerdict(p *CapturedPacket, verdict PacketVerdict, buffer, options, payload []byte, mark int) error {
+	t.Lock()
+	defer t.Unlock()
+
+	t.verdicts[p.Context] = verdict
+
+	return nil
+}
+
+func TestCustomDatapath(t *testing.T) {
+
+	Convey("Given I create an enforcer with a custom datapath", t, func() {
+
+		secret := tokens.NewPSKSecrets([]byte("Dummy Test Password"))
+		enforcer := NewDefaultDatapathEnforcer("SomeServerId", &flowCollector{}, nil, secret, constants.LocalContainer).(*datapathEnforcer)
+
+		dp := &testDatapath{
+			network: &testSource{},
+			application: &testSource{
+				packets: []*CapturedPacket{
+					{Buffer: udpPacket("164.67.228.152", "8.8.8.8", dnsQuery("www.example.com")), Mark: "0", Context: "allowed"},
+					{Buffer: udpPacket("164.67.228.152", "8.8.8.8", dnsQuery("notexample.com")), Mark: "0", Context: "denied"},
+				},
+			},
+			verdicts: map[interface{}]PacketVerdict{},
+		}
+		enforcer.SetDatapath(dp)
+
+		puInfo := intraHostPUInfo("SomeProcessingUnitId1", "164.67.228.152", &policy.TagSelector{})
+		puInfo.Policy.UpdateDNSPolicy(policy.NewDNSPolicy([]string{"8.8.8.8/32"}, []string{"example.com"}))
+		So(enforcer.Enforce("SomeProcessingUnitId1", puInfo), ShouldBeNil)
+
+		Convey("Then the flow tables should be created by the datapath", func() {
+			So(dp.tables, ShouldEqual, 5)
+		})
+
+		Convey("When I set the clock of the enforcer", func() {
+			So(enforcer.SetClock(clock.NewFake(time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC))), ShouldBeNil)
+
+			Convey("Then the flow tables should be created again with the clock", func() {
+				So(dp.tables, ShouldEqual, 10)
+			})
+		})
+
+		Convey("When I start the enforcer", func() {
+			So(enforcer.Start(), ShouldBeNil)
+
+			Convey("Then the clock should not be set anymore", func() {
+				So(enforcer.SetClock(clock.New()), ShouldNotBeNil)
+			})
+
+			Convey("Then the verdicts of the captured packets should be handed to the datapath", func() {
+				So(dp.verdicts["allowed"], ShouldEqual, VerdictAccept)
+				So(dp.verdicts["denied"], ShouldEqual, VerdictDrop)
+			})
+		})
+	})
+}
@@ -1,21 +1,35 @@
 package enforcer
 
-import "github.com/aporeto-inc/trireme/crypto"
+import (
+	"time"
+
+	"github.com/aporeto-inc/trireme/crypto"
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+	"github.com/aporeto-inc/trireme/policy"
+)
 
 // AuthInfo keeps authentication information about a connection
 type AuthInfo struct {
 	LocalContext    []byte
 	RemoteContext   []byte
 	RemoteContextID string
+	// RemoteIdentity is the identity of the peer verified in its token
+	RemoteIdentity  *policy.TagsMap
 	RemotePublicKey interface{}
 	RemoteIP        string
 	RemotePort      string
+	// TokenFormat is the format of the tokens negotiated with the peer
+	TokenFormat tokens.TokenFormat
 }
 
 // TCPConnection is information regarding TCP Connection
 type TCPConnection struct {
 	State TCPFlowState
 	Auth  AuthInfo
+	// Started is when the enforcer saw the first SYN of the connection
+	Started time.Time
+	// flow is the flow of the connection and the PU that tracks it
+	flow *FlowState
 }
 
 // NewTCPConnection returns a TCPConnection information struct
@@ -7,6 +7,10 @@ const (
 	TCPAuthenticationOptionAckLen = 20
 	// PortNumberLabelString is the label to use for port numbers
 	PortNumberLabelString = "@port"
+	// IdentityLabelString is the label holding the identity of peers that did not present a token
+	IdentityLabelString = "@identity"
+	// UnknownIdentity is the identity of peers that do not run trireme
+	UnknownIdentity = "unknown"
 )
 
 // Default parameters for the NFQUEUE configuration. Parameters can be
@@ -0,0 +1,29 @@
+package enforcer
+
+import "time"
+
+// DefaultControllerTimeout is the default time after which a remote enforcer that
+// cannot register with the controller applies the controller loss action
+const DefaultControllerTimeout = 2 * time.Minute
+
+// ControllerLossAction defines what happens to the traffic of a PU when its remote
+// enforcer loses the controller
+type ControllerLossAction int
+
+const (
+	// ControllerLossKeep keeps enforcing the last policy received. This is the default.
+	ControllerLossKeep ControllerLossAction = iota
+	// ControllerLossDrop stops enforcing the policy, so that the new connections of the
+	// PU are dropped until the controller registers the enforcer again
+	ControllerLossDrop
+)
+
+// ControllerLossConfig configures the behavior of the remote enforcers when the
+// controller is lost
+type ControllerLossConfig struct {
+	// Timeout is the time without contact with the controller after which the action
+	// is applied. A negative timeout disables the action.
+	Timeout time.Duration
+	// Action is applied to the traffic of the PU
+	Action ControllerLossAction
+}
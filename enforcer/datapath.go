@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"net"
 	"os/exec"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
@@ -13,12 +15,15 @@ import (
 	"github.com/aporeto-inc/trireme/collector"
 	"github.com/aporeto-inc/trireme/constants"
 	"github.com/aporeto-inc/trireme/enforcer/lookup"
-	"github.com/aporeto-inc/trireme/enforcer/netfilter"
 
 	"github.com/aporeto-inc/trireme/enforcer/utils/packet"
 	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
 	"github.com/aporeto-inc/trireme/monitor/linuxmonitor/cgnetcls"
 	"github.com/aporeto-inc/trireme/policy"
+	"github.com/aporeto-inc/trireme/utils/clock"
+	"github.com/aporeto-inc/trireme/utils/errortypes"
+	"github.com/aporeto-inc/trireme/utils/features"
+	"github.com/aporeto-inc/trireme/utils/marks"
 )
 
 // datapathEnforcer is the structure holding all information about a connection filter
@@ -30,6 +35,7 @@ type datapathEnforcer struct {
 	tokenEngine         tokens.TokenEngine
 	collector           collector.EventCollector
 	service             PacketProcessor
+	datapath            Datapath
 
 	// Internal structures and caches
 	// Key=ContextId Value=ContainerIP
@@ -45,6 +51,59 @@ type datapathEnforcer struct {
 	sourcePortCache      cache.DataStore
 	destinationPortCache cache.DataStore
 
+	// Key=FlowHash Value=FlowState. Created on syn packets of intra-host
+	// connections authorized without a token exchange
+	intraHostFlows cache.DataStore
+	intraHostMode  IntraHostMode
+	hostAddresses  map[string]bool
+
+	// Key=FlowHash Value=FlowState. Created on syn packets without token accepted
+	// from the interop networks
+	interopFlows      cache.DataStore
+	interopNetworks   interopNetworks
+	externalEndpoints *externalEndpointDB
+
+	// Key=FlowHash Value=udpFlow. Created on datagrams sent by the PUs with a token
+	udpAppFlows cache.DataStore
+	// Key=FlowHash Value=ContextID. Created on datagrams received with an accepted token
+	udpNetFlows cache.DataStore
+
+	// Key=FlowHash Value=peerFlow. Created on syn packets accepted with a token
+	peerFlows cache.DataStore
+	peers     *peerIdentities
+
+	// volumes reports the traffic of the flows accepted with a token
+	volumes *flowVolumes
+
+	// latencies reports the latency of the handshakes of the flows with a token
+	latencies *handshakeLatencies
+
+	// ruleStatsInterval is the interval of the reports of the matches of the
+	// identity rules, or zero if they are not reported
+	ruleStatsInterval time.Duration
+
+	// tagBudget selects the identity tags transmitted in the tokens
+	tagBudget *tokens.TagBudget
+
+	// settingsLock protects the intra-host mode, the host addresses, the interop
+	// networks and the tag budget, which are replaced while the packets are processed
+	settingsLock sync.RWMutex
+
+	// federation restricts the tags of the peers of the federated deployments, if
+	// the secrets trust them
+	federation tokens.FederatedSecrets
+
+	// authorities report the certificate authorities of the peers for the issuer
+	// rules, if the secrets verify certificates
+	authorities tokens.AuthoritySecrets
+
+	// rotation rotates the keys of the secrets, if they can be rotated
+	rotation tokens.RotatableSecrets
+
+	// mtls carries the connections to the mutual TLS networks
+	mtls     *mtlsProxy
+	mtlsLock sync.RWMutex
+
 	// stats
 	net    *InterfaceStats
 	app    *InterfaceStats
@@ -54,6 +113,21 @@ type datapathEnforcer struct {
 	// ack size
 	ackSize uint32
 
+	// sendReset transmits the resets of the rejected flows
+	sendReset func(rst *packet.Packet) error
+
+	// clock is the source of time of the flows
+	clock clock.Clock
+
+	// started is set once the enforcer started, after which the clock is fixed
+	started bool
+
+	// verdicts caches the accepted flows in the kernel, if set
+	verdicts VerdictCache
+
+	// downgrades detects the handshakes whose identity is stripped
+	downgrades *downgradeDetector
+
 	// mode captures the mode of the enforcer
 	mode constants.ModeType
 }
@@ -91,24 +165,59 @@ func NewDatapathEnforcer(
 	}
 
 	d := &datapathEnforcer{
-		contextTracker:           cache.NewCache(),
-		puTracker:                cache.NewCache(),
-		networkConnectionTracker: cache.NewCacheWithExpiration(time.Second * 60),
-		appConnectionTracker:     cache.NewCacheWithExpiration(time.Second * 60),
-		contextConnectionTracker: cache.NewCacheWithExpiration(time.Second * 60),
-		sourcePortCache:          cache.NewCacheWithExpiration(time.Second * 60),
-		destinationPortCache:     cache.NewCacheWithExpiration(time.Second * 60),
-		filterQueue:              filterQueue,
-		mutualAuthorization:      mutualAuth,
-		service:                  service,
-		collector:                collector,
-		tokenEngine:              tokenEngine,
-		net:                      &InterfaceStats{},
-		app:                      &InterfaceStats{},
-		netTCP:                   &PacketStats{},
-		appTCP:                   &PacketStats{},
-		ackSize:                  secrets.AckSize(),
-		mode:                     mode,
+		contextTracker:      cache.NewCache(),
+		puTracker:           cache.NewCache(),
+		intraHostFlows:      cache.NewCacheWithExpiration(acceptedFlowLifetime),
+		intraHostMode:       IntraHostTokens,
+		hostAddresses:       map[string]bool{},
+		interopFlows:        cache.NewCacheWithExpiration(acceptedFlowLifetime),
+		interopNetworks:     interopNetworks{},
+		udpAppFlows:         cache.NewCacheWithExpiration(udpFlowLifetime),
+		udpNetFlows:         cache.NewCacheWithExpiration(udpFlowLifetime),
+		externalEndpoints:   newExternalEndpointDB(),
+		peerFlows:           cache.NewCache(),
+		peers:               newPeerIdentities(),
+		volumes:             newFlowVolumes(),
+		latencies:           newHandshakeLatencies(),
+		tagBudget:           tokens.NewTagBudget(),
+		filterQueue:         filterQueue,
+		mutualAuthorization: mutualAuth,
+		service:             service,
+		collector:           collector,
+		tokenEngine:         tokenEngine,
+		net:                 &InterfaceStats{},
+		app:                 &InterfaceStats{},
+		netTCP:              &PacketStats{},
+		appTCP:              &PacketStats{},
+		ackSize:             secrets.AckSize(),
+		mode:                mode,
+		clock:               clock.New(),
+		downgrades:          newDowngradeDetector(),
+	}
+
+	d.sendReset = d.sendRawReset
+
+	if federation, ok := secrets.(tokens.FederatedSecrets); ok {
+		d.federation = federation
+	}
+
+	if authorities, ok := secrets.(tokens.AuthoritySecrets); ok {
+		d.authorities = authorities
+	}
+
+	if rotation, ok := secrets.(tokens.RotatableSecrets); ok {
+		d.rotation = rotation
+	}
+
+	switch filterQueue.CaptureMode {
+	case CaptureRawSocket:
+		d.SetDatapath(newRawDatapath(filterQueue, mode))
+	case CaptureEBPF:
+		dp := newEBPFDatapath(filterQueue, mode)
+		d.SetDatapath(dp)
+		d.SetVerdictCache(dp)
+	default:
+		d.SetDatapath(newNFQDatapath(filterQueue))
 	}
 
 	if d.tokenEngine == nil {
@@ -169,7 +278,7 @@ func (d *datapathEnforcer) Enforce(contextID string, puInfo *policy.PUInfo) erro
 	}
 
 	if len(hashSlice.([]*DualHash)) == 0 {
-		return fmt.Errorf("Unable to resolve context from existing hash")
+		return errortypes.Errorf(errortypes.ErrPUNotFound, "Unable to resolve context from existing hash")
 	}
 
 	puContext, err := d.puTracker.Get(hashSlice.([]*DualHash)[0].app)
@@ -177,8 +286,38 @@ func (d *datapathEnforcer) Enforce(contextID string, puInfo *policy.PUInfo) erro
 		return d.doUpdatePU(puContext.(*PUContext), puInfo)
 	}
 
-	return d.doCreatePU(contextID, puInfo)
+	if err := d.doCreatePU(contextID, puInfo); err != nil {
+		return err
+	}
+
+	d.removeStaleHashes(contextID, hashSlice.([]*DualHash))
+
+	return nil
+}
+
+// removeStaleHashes removes the hashes of a previous version of the PU that are
+// not used anymore, like the previous IP address of a container
+func (d *datapathEnforcer) removeStaleHashes(contextID string, previous []*DualHash) {
+
+	current, err := d.contextTracker.Get(contextID)
+	if err != nil {
+		return
+	}
+
+	used := map[string]bool{}
+	for _, hash := range current.([]*DualHash) {
+		used[hash.app] = true
+		used[hash.net] = true
+	}
 
+	for _, hash := range previous {
+		if !used[hash.app] {
+			d.puTracker.Remove(hash.app)
+		}
+		if !used[hash.net] {
+			d.puTracker.Remove(hash.net)
+		}
+	}
 }
 
 func (d *datapathEnforcer) createHashForProcess(puInfo *policy.PUInfo) []*DualHash {
@@ -230,14 +369,25 @@ func (d *datapathEnforcer) doCreatePU(contextID string, puInfo *policy.PUInfo) e
 	// IP are not required to process rules we have for cgroup
 
 	if d.mode == constants.LocalContainer && (puInfo.Runtime.PUType() == constants.ContainerPU) {
+		// A container without default address, like one attached only to other
+		// networks, is found by the address of its first network
+		if _, ok := puInfo.Policy.DefaultIPAddress(); !ok {
+			puInfo = policy.PUInfoFromPolicyAndRuntime(contextID, puInfo.Policy.PromoteDefaultNetwork(), puInfo.Runtime)
+		}
+
 		if _, ok := puInfo.Policy.DefaultIPAddress(); !ok {
 			return fmt.Errorf("No IP address found")
 		}
 
 		ip, _ = puInfo.Policy.DefaultIPAddress()
-		if net.ParseIP(ip) == nil {
+		addr := net.ParseIP(ip)
+		if addr == nil {
 			return fmt.Errorf("invalid up address %s ", ip)
 		}
+
+		// The PUs are found by the string of the addresses of the packets, which
+		// is the canonical form of the IPv6 addresses
+		ip = addr.String()
 	}
 	pu := &PUContext{
 		ID:           contextID,
@@ -248,21 +398,72 @@ func (d *datapathEnforcer) doCreatePU(contextID string, puInfo *policy.PUInfo) e
 
 	d.doUpdatePU(pu, puInfo)
 
-	d.contextTracker.AddOrUpdate(contextID, hashSlice)
-
 	for _, hash := range hashSlice {
 		d.puTracker.AddOrUpdate(hash.app, pu)
 		d.puTracker.AddOrUpdate(hash.net, pu)
 	}
 
+	if d.mode == constants.LocalContainer && (puInfo.Runtime.PUType() == constants.ContainerPU) {
+		hashSlice = append(hashSlice, d.doCreateInterfaces(contextID, ip, puInfo)...)
+	}
+
+	d.contextTracker.AddOrUpdate(contextID, hashSlice)
+
 	return nil
 }
 
+// doCreateInterfaces creates a context for each additional interface of a multi-homed
+// container with the section of the policy of its network
+func (d *datapathEnforcer) doCreateInterfaces(contextID string, defaultIP string, puInfo *policy.PUInfo) []*DualHash {
+
+	hashSlice := []*DualHash{}
+	ips := puInfo.Policy.IPAddresses()
+
+	for _, network := range ips.AdditionalNetworks() {
+
+		addr := net.ParseIP(ips.IPs[network])
+		if addr == nil || addr.String() == defaultIP {
+			continue
+		}
+
+		// The IPv6 addresses of the dual-stack containers are found in their
+		// canonical form, as the default address
+		ip := addr.String()
+
+		pu := &PUContext{
+			ID:           contextID,
+			ManagementID: puInfo.Policy.ManagementID,
+			network:      network,
+		}
+
+		d.doUpdatePU(pu, policy.PUInfoFromPolicyAndRuntime(contextID, puInfo.Policy.PolicyForNetwork(network), puInfo.Runtime))
+
+		hash := &DualHash{app: ip, net: ip}
+		d.puTracker.AddOrUpdate(hash.app, pu)
+		d.puTracker.AddOrUpdate(hash.net, pu)
+
+		hashSlice = append(hashSlice, hash)
+	}
+
+	return hashSlice
+}
+
 func (d *datapathEnforcer) doUpdatePU(puContext *PUContext, containerInfo *policy.PUInfo) error {
 	puContext.acceptRcvRules, puContext.rejectRcvRules = createRuleDB(containerInfo.Policy.ReceiverRules())
 	puContext.acceptTxtRules, puContext.rejectTxtRules = createRuleDB(containerInfo.Policy.TransmitterRules())
+	puContext.receiverRules = newIdentityRules(containerInfo.Policy.ReceiverRules())
+	puContext.transmitterRules = newIdentityRules(containerInfo.Policy.TransmitterRules())
 	puContext.Identity = containerInfo.Policy.Identity()
 	puContext.Annotations = containerInfo.Policy.Annotations()
+	puContext.txIdentity = d.transmittedIdentity(puContext)
+	puContext.identityRevision = identityRevision(puContext.txIdentity)
+	puContext.revision = policyRevision(containerInfo.Policy)
+	puContext.trustedNetworks = parseTrustedNetworks(containerInfo.Policy.TrustedNetworks())
+	puContext.issuerRules = parseIssuerRules(containerInfo.Policy.IssuerRules())
+	puContext.dnsDomains = parseDNSDomains(containerInfo.Policy.DNSPolicy())
+	puContext.resetRejected = containerInfo.Policy.ResetRejected()
+	puContext.udpNetworks = parseUDPNetworks(containerInfo.Policy)
+	puContext.fastPath = containerInfo.Policy.FeatureEnabled(string(features.EBPFFastPath))
 	return nil
 }
 
@@ -270,7 +471,7 @@ func (d *datapathEnforcer) Unenforce(contextID string) error {
 
 	hashSlice, err := d.contextTracker.Get(contextID)
 	if err != nil {
-		return fmt.Errorf("ContextID not found in Enforcer")
+		return errortypes.Errorf(errortypes.ErrPUNotFound, "ContextID not found in Enforcer")
 	}
 
 	for _, hash := range hashSlice.([]*DualHash) {
@@ -296,9 +497,25 @@ func (d *datapathEnforcer) Start() error {
 		"mode":    d.mode,
 	}).Debug("Start enforcer")
 
-	d.StartApplicationInterceptor()
+	if err := d.datapath.ApplicationSource().Start(d.processApplicationPacket); err != nil {
+		return fmt.Errorf("Unable to start the application interceptor: %s", err)
+	}
+
+	if err := d.datapath.NetworkSource().Start(d.processNetworkPacket); err != nil {
+		return fmt.Errorf("Unable to start the network interceptor: %s", err)
+	}
+
+	d.started = true
+
+	go d.startRevalidation()
+
+	go d.startKeepalive()
+
+	go d.startFlowVolumes()
 
-	d.StartNetworkInterceptor()
+	go d.startHandshakeLatencies()
+
+	go d.startRuleStats()
 
 	return nil
 }
@@ -308,66 +525,77 @@ func (d *datapathEnforcer) Stop() error {
 	log.WithFields(log.Fields{
 		"package": "enforcer",
 	}).Debug("Stop enforcer")
+
+	d.DisableMTLS()
+
 	return nil
 }
 
-// StartNetworkInterceptor will the process that processes  packets from the network
-// Still has one more copy than needed. Can be improved.
-func (d *datapathEnforcer) StartNetworkInterceptor() {
-	var err error
+// SetDatapath replaces the mechanism capturing the packets. It must be called
+// before Start since the flow tables of the datapath replace the current ones.
+func (d *datapathEnforcer) SetDatapath(dp Datapath) {
 
-	nfq := make([]*netfilter.NFQueue, d.filterQueue.NumberOfNetworkQueues)
+	d.datapath = dp
+	d.newFlowTables()
+}
 
-	for i := uint16(0); i < d.filterQueue.NumberOfNetworkQueues; i++ {
+// newFlowTables replaces the flow tables by the ones of the datapath, whose entries
+// expire with the clock
+func (d *datapathEnforcer) newFlowTables() {
 
-		// Initalize all the queues
-		nfq[i], err = netfilter.NewNFQueue(d.filterQueue.NetworkQueue+i, d.filterQueue.NetworkQueueSize, netfilter.NfDefaultPacketSize)
-		if err != nil {
-			log.WithFields(log.Fields{
-				"package": "enforcer",
-				"error":   err.Error(),
-			}).Fatal("Unable to initialize netfilter queue - Aborting")
-		}
+	d.networkConnectionTracker = d.datapath.NewFlowTable(time.Second*60, d.clock)
+	d.appConnectionTracker = d.datapath.NewFlowTable(time.Second*60, d.clock)
+	d.contextConnectionTracker = d.datapath.NewFlowTable(time.Second*60, d.clock)
+	d.sourcePortCache = d.datapath.NewFlowTable(time.Second*60, d.clock)
+	d.destinationPortCache = d.datapath.NewFlowTable(time.Second*60, d.clock)
+}
 
-		go func(i uint16) {
-			for true {
-				select {
-				case packet := <-nfq[i].Packets:
-					d.processNetworkPacketsFromNFQ(packet)
-				}
-			}
-		}(i)
+// SetTokenEngine implements the TokenEngineConfigurer interface. The ACK tokens have
+// the size given by the secrets unless the engine is an AckSizer.
+func (d *datapathEnforcer) SetTokenEngine(engine tokens.TokenEngine) error {
 
+	if engine == nil {
+		return fmt.Errorf("Token engine cannot be nil")
 	}
-}
 
-// StartApplicationInterceptor will create a interceptor that processes
-// packets originated from a local application
-func (d *datapathEnforcer) StartApplicationInterceptor() {
+	if sizer, ok := engine.(tokens.AckSizer); ok {
+		d.ackSize = sizer.AckSize()
+	}
 
-	var err error
+	if setter, ok := engine.(clockSetter); ok {
+		setter.SetClock(d.clock)
+	}
 
-	nfq := make([]*netfilter.NFQueue, d.filterQueue.NumberOfApplicationQueues)
+	d.tokenEngine = engine
 
-	for i := uint16(0); i < d.filterQueue.NumberOfApplicationQueues; i++ {
-		nfq[i], err = netfilter.NewNFQueue(d.filterQueue.ApplicationQueue+i, d.filterQueue.ApplicationQueueSize, netfilter.NfDefaultPacketSize)
+	return nil
+}
 
-		if err != nil {
-			log.WithFields(log.Fields{
-				"package": "enforcer",
-				"error":   err.Error(),
-			}).Fatal("Unable to initialize netfilter queue - Aborting")
-		}
+// SetClock implements the ClockConfigurer interface. The connections, the accepted
+// flows, the UDP flows and the tokens expire with the clock. The clock cannot be
+// replaced once the enforcer started, since the flow tables are replaced.
+func (d *datapathEnforcer) SetClock(clk clock.Clock) error {
+
+	if clk == nil {
+		return fmt.Errorf("Clock cannot be nil")
+	}
 
-		go func(i uint16) {
-			for true {
-				select {
-				case packet := <-nfq[i].Packets:
-					d.processApplicationPacketsFromNFQ(packet)
-				}
-			}
-		}(i)
+	if d.started {
+		return fmt.Errorf("The clock cannot be set once the enforcer started")
 	}
+
+	d.clock = clk
+	d.intraHostFlows = cache.NewCacheWithClock(acceptedFlowLifetime, clk)
+	d.interopFlows = cache.NewCacheWithClock(acceptedFlowLifetime, clk)
+	d.udpAppFlows = cache.NewCacheWithClock(udpFlowLifetime, clk)
+	d.udpNetFlows = cache.NewCacheWithClock(udpFlowLifetime, clk)
+	d.newFlowTables()
+
+	if engine, ok := d.tokenEngine.(clockSetter); ok {
+		engine.SetClock(clk)
+	}
+
+	return nil
 }
 
 // createRuleDB creates the database of rules from the policy
@@ -389,8 +617,8 @@ func createRuleDB(policyRules *policy.TagSelectorList) (*lookup.PolicyDB, *looku
 	return acceptRules, rejectRules
 }
 
-// processNetworkPacketsFromNFQ processes packets arriving from the network in an NF queue
-func (d *datapathEnforcer) processNetworkPacketsFromNFQ(p *netfilter.NFPacket) {
+// processNetworkPacket processes packets arriving from the network
+func (d *datapathEnforcer) processNetworkPacket(p *CapturedPacket) {
 
 	d.net.IncomingPackets++
 
@@ -402,42 +630,48 @@ func (d *datapathEnforcer) processNetworkPacketsFromNFQ(p *netfilter.NFPacket) {
 		netPacket.Print(packet.PacketFailureCreate)
 	} else if netPacket.IPProto == packet.IPProtocolTCP {
 		err = d.processNetworkTCPPackets(netPacket)
+	} else if netPacket.IPProto == packet.IPProtocolUDP {
+		err = d.processNetworkUDPPacket(netPacket)
 	} else {
 		d.net.ProtocolDropPackets++
 		err = fmt.Errorf("Invalid IP Protocol %d", netPacket.IPProto)
 	}
 
 	if err != nil {
-		netfilter.SetVerdict(&netfilter.Verdict{
-			V:           netfilter.NfDrop,
-			Buffer:      netPacket.Buffer,
-			Payload:     nil,
-			Options:     nil,
-			Xbuffer:     p.Xbuffer,
-			ID:          p.ID,
-			QueueHandle: p.QueueHandle,
-		}, d.filterQueue.MarkValue)
+		d.setVerdict(p, VerdictDrop, netPacket.Buffer, nil, nil)
 		return
 	}
 
 	// Accept the packet
-	netfilter.SetVerdict(&netfilter.Verdict{
-		V:           netfilter.NfAccept,
-		Buffer:      netPacket.Buffer,
-		Payload:     netPacket.GetTCPData(),
-		Options:     netPacket.GetTCPOptions(),
-		Xbuffer:     p.Xbuffer,
-		ID:          p.ID,
-		QueueHandle: p.QueueHandle,
-	}, d.filterQueue.MarkValue)
+	d.setVerdict(p, VerdictAccept, netPacket.Buffer, netPacket.GetTCPOptions(), netPacket.GetTCPData())
 }
 
-// processApplicationPackets processes packets arriving from an application and are destined to the network
-func (d *datapathEnforcer) processApplicationPacketsFromNFQ(p *netfilter.NFPacket) {
+// setVerdict hands the verdict of the packet to the datapath
+func (d *datapathEnforcer) setVerdict(p *CapturedPacket, verdict PacketVerdict, buffer, options, payload []byte) {
+
+	if err := d.datapath.SetVerdict(p, verdict, buffer, options, payload, d.verdictMark(p)); err != nil {
+		log.WithFields(log.Fields{
+			"package": "enforcer",
+			"error":   err.Error(),
+		}).Error("Unable to set the verdict of the packet")
+	}
+}
+
+// verdictMark returns the mark of a packet with the bits of the mark mask replaced by
+// the mark of the enforcer
+func (d *datapathEnforcer) verdictMark(p *CapturedPacket) int {
+
+	mark, _ := strconv.ParseUint(p.Mark, 10, 32)
+
+	return int(marks.Apply(uint32(mark), uint32(d.filterQueue.MarkValue), d.filterQueue.MarkMask))
+}
+
+// processApplicationPacket processes packets arriving from an application and are destined to the network
+func (d *datapathEnforcer) processApplicationPacket(p *CapturedPacket) {
 
 	log.WithFields(log.Fields{
 		"package": "enforcer",
-	}).Debug("process application packets from NFQ")
+	}).Debug("process application packets")
 
 	d.app.IncomingPackets++
 
@@ -451,46 +685,37 @@ func (d *datapathEnforcer) processApplicationPacketsFromNFQ(p *netfilter.NFPacke
 		appPacket.Print(packet.PacketFailureCreate)
 	} else if appPacket.IPProto == packet.IPProtocolTCP {
 		err = d.processApplicationTCPPackets(appPacket)
+	} else if appPacket.IPProto == packet.IPProtocolUDP {
+		err = d.processApplicationUDPPacket(appPacket)
 	} else {
 		d.app.ProtocolDropPackets++
 		err = fmt.Errorf("Invalid IP Protocol %d", appPacket.IPProto)
 	}
 
 	if err != nil {
-		netfilter.SetVerdict(&netfilter.Verdict{
-			V:           netfilter.NfDrop,
-			Buffer:      appPacket.Buffer,
-			Payload:     nil,
-			Options:     nil,
-			Xbuffer:     p.Xbuffer,
-			ID:          p.ID,
-			QueueHandle: p.QueueHandle,
-		}, d.filterQueue.MarkValue)
+		d.setVerdict(p, VerdictDrop, appPacket.Buffer, nil, nil)
 		return
 	}
 
 	// Accept the packet
-	netfilter.SetVerdict(&netfilter.Verdict{
-		V:           netfilter.NfAccept,
-		Buffer:      appPacket.Buffer,
-		Payload:     appPacket.GetTCPData(),
-		Options:     appPacket.GetTCPOptions(),
-		Xbuffer:     p.Xbuffer,
-		ID:          p.ID,
-		QueueHandle: p.QueueHandle,
-	}, d.filterQueue.MarkValue)
+	d.setVerdict(p, VerdictAccept, appPacket.Buffer, appPacket.GetTCPOptions(), appPacket.GetTCPData())
 
 }
 
 func (d *datapathEnforcer) createPacketToken(ackToken bool, context *PUContext, auth *AuthInfo) []byte {
 
 	claims := &tokens.ConnectionClaims{
-		LCL: auth.LocalContext,
-		RMT: auth.RemoteContext,
+		LCL:    auth.LocalContext,
+		RMT:    auth.RemoteContext,
+		Format: auth.TokenFormat,
 	}
 
 	if !ackToken {
 		claims.T = context.Identity
+		if context.txIdentity != nil {
+			claims.T = context.txIdentity
+		}
+		claims.RV = context.identityRevision
 	}
 
 	return d.tokenEngine.CreateAndSign(ackToken, claims)
@@ -501,18 +726,22 @@ func (d *datapathEnforcer) parsePacketToken(auth *AuthInfo, data []byte) (*token
 	// Validate the certificate and parse the token
 	claims, cert := d.tokenEngine.Decode(false, data, auth.RemotePublicKey)
 	if claims == nil {
-		return nil, fmt.Errorf("Cannot decode the token")
+		return nil, errortypes.Errorf(errortypes.ErrPolicyRejected, "Cannot decode the token")
 	}
 
+	d.federatedClaims(claims, cert)
+
 	// We always a need a valid remote context ID
 	remoteContextID, ok := claims.T.Get(TransmitterLabel)
 	if !ok {
-		return nil, fmt.Errorf("No Transmitter Label ")
+		return nil, errortypes.Errorf(errortypes.ErrPolicyRejected, "No Transmitter Label ")
 	}
 
 	auth.RemotePublicKey = cert
 	auth.RemoteContext = claims.LCL
 	auth.RemoteContextID = remoteContextID
+	auth.RemoteIdentity = verifiedIdentity(claims)
+	auth.TokenFormat = claims.Format
 
 	return claims, nil
 }
@@ -534,7 +763,7 @@ func (d *datapathEnforcer) contextFromIP(app bool, ip string, mark string, port
 		markKey := "mark:" + mark + "$"
 		pu, err = d.puTracker.Get(markKey)
 		if err != nil {
-			return nil, fmt.Errorf("PU context cannot be found using ip %v mark %v mode %v", ip, markKey, d.mode)
+			return nil, errortypes.Errorf(errortypes.ErrPUNotFound, "PU context cannot be found using ip %v mark %v mode %v", ip, markKey, d.mode)
 		}
 		return pu, nil
 	}
@@ -542,7 +771,7 @@ func (d *datapathEnforcer) contextFromIP(app bool, ip string, mark string, port
 	portKey := "port:" + port
 	pu, err = d.puTracker.Get(portKey)
 	if err != nil {
-		return nil, fmt.Errorf("PU Context cannot be found using ip %v port key %v mode %v", ip, portKey, d.mode)
+		return nil, errortypes.Errorf(errortypes.ErrPUNotFound, "PU Context cannot be found using ip %v port key %v mode %v", ip, portKey, d.mode)
 	}
 	return pu, nil
 }
@@ -11,6 +11,7 @@ import (
 	"github.com/aporeto-inc/trireme/constants"
 	"github.com/aporeto-inc/trireme/enforcer/utils/packet"
 	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+	"github.com/aporeto-inc/trireme/utils/errortypes"
 )
 
 // processNetworkPackets processes packets arriving from network and are destined to the application
@@ -153,14 +154,14 @@ func (d *datapathEnforcer) parseAckToken(connection *AuthInfo, data []byte) (*to
 	// Validate the certificate and parse the token
 	claims, _ := d.tokenEngine.Decode(true, data, connection.RemotePublicKey)
 	if claims == nil {
-		return nil, fmt.Errorf("Cannot decode the token")
+		return nil, errortypes.Errorf(errortypes.ErrPolicyRejected, "Cannot decode the token")
 	}
 
 	// Compare the incoming random context with the stored context
 	matchLocal := bytes.Compare(claims.RMT, connection.LocalContext)
 	matchRemote := bytes.Compare(claims.LCL, connection.RemoteContext)
 	if matchLocal != 0 || matchRemote != 0 {
-		return nil, fmt.Errorf("Failed to match context in ACK packet")
+		return nil, errortypes.Errorf(errortypes.ErrPolicyRejected, "Failed to match context in ACK packet")
 	}
 
 	return claims, nil
@@ -176,6 +177,22 @@ func (d *datapathEnforcer) processApplicationSynPacket(tcpPacket *packet.Packet)
 		return nil, nil
 	}
 
+	if d.processTrustedSynPacket(context.(*PUContext), tcpPacket, true) {
+		return nil, nil
+	}
+
+	if local, err := d.processIntraHostSynPacket(context.(*PUContext), tcpPacket); local {
+		return nil, err
+	}
+
+	if external, err := d.processExternalSynPacket(context.(*PUContext), tcpPacket); external {
+		return nil, err
+	}
+
+	if d.processMTLSSynPacket(context.(*PUContext), tcpPacket) {
+		return nil, nil
+	}
+
 	existing, err := d.appConnectionTracker.Get(tcpPacket.L4FlowHash())
 	if err == nil {
 		connection = existing.(*TCPConnection)
@@ -183,6 +200,7 @@ func (d *datapathEnforcer) processApplicationSynPacket(tcpPacket *packet.Packet)
 		connection = NewTCPConnection()
 		connection.Auth.RemoteIP = tcpPacket.DestinationAddress.String()
 		connection.Auth.RemotePort = strconv.Itoa(int(tcpPacket.DestinationPort))
+		connection.Started = d.clock.Now()
 	}
 
 	// Create TCP Option
@@ -193,6 +211,7 @@ func (d *datapathEnforcer) processApplicationSynPacket(tcpPacket *packet.Packet)
 
 	// Track the connection
 	connection.State = TCPSynSend
+	connection.flow = d.newFlowState(TokenFlow, context.(*PUContext), tcpPacket)
 	d.appConnectionTracker.AddOrUpdate(tcpPacket.L4FlowHash(), connection)
 	d.contextConnectionTracker.AddOrUpdate(string(connection.Auth.LocalContext), connection)
 
@@ -295,6 +314,8 @@ func (d *datapathEnforcer) processApplicationAckPacket(tcpPacket *packet.Packet)
 
 		connection.State = TCPAckSend
 
+		d.cacheVerdict(context.(*PUContext), tcpPacket)
+
 		return nil, nil
 	}
 
@@ -312,6 +333,12 @@ func (d *datapathEnforcer) processApplicationAckPacket(tcpPacket *packet.Packet)
 
 func (d *datapathEnforcer) processApplicationTCPPacket(tcpPacket *packet.Packet) (interface{}, error) {
 
+	// Intra-host connections authorized locally and connections of non-trireme
+	// peers carry no tokens
+	if tcpPacket.TCPFlags != packet.TCPSynMask && (d.isIntraHostFlow(tcpPacket) || d.isInteropFlow(tcpPacket)) {
+		return nil, nil
+	}
+
 	// State machine based on the flags
 	switch tcpPacket.TCPFlags {
 	case packet.TCPSynMask: //Processing SYN packet from Application
@@ -344,6 +371,24 @@ func (d *datapathEnforcer) processNetworkSynPacket(context *PUContext, tcpPacket
 		connection = existing.(*TCPConnection)
 	} else {
 		connection = NewTCPConnection()
+		connection.Started = d.clock.Now()
+	}
+
+	if d.processTrustedSynPacket(context, tcpPacket, false) {
+		return nil, nil
+	}
+
+	if err := d.rejectBlockedSyn(context, tcpPacket); err != nil {
+		return nil, err
+	}
+
+	if len(tcpPacket.ReadTCPData()) == 0 {
+		d.detectTokenlessSyn(context, tcpPacket)
+	}
+
+	// Peers that do not run trireme send no token
+	if interop, action, err := d.processInteropSynPacket(context, tcpPacket); interop {
+		return action, err
 	}
 
 	// Decode the JWT token using the context key
@@ -365,10 +410,15 @@ func (d *datapathEnforcer) processNetworkSynPacket(context *PUContext, tcpPacket
 			Mode:            collector.InvalidToken,
 			SourceIP:        tcpPacket.SourceAddress.String(),
 			DestinationIP:   tcpPacket.DestinationAddress.String(),
+			SourcePort:      tcpPacket.SourcePort,
 			DestinationPort: tcpPacket.DestinationPort,
 		})
 
-		return nil, fmt.Errorf("Syn packet dropped because of invalid token %v %+v", err, claims)
+		if len(tcpPacket.ReadTCPData()) != 0 {
+			d.handshakeAnomaly(context, tcpPacket, anomalyInvalidToken)
+		}
+
+		return nil, errortypes.Errorf(errortypes.ErrPolicyRejected, "Syn packet dropped because of invalid token %v %+v", err, claims)
 	}
 
 	txLabel, ok := claims.T.Get(TransmitterLabel)
@@ -382,10 +432,34 @@ func (d *datapathEnforcer) processNetworkSynPacket(context *PUContext, tcpPacket
 			Mode:            collector.InvalidFormat,
 			SourceIP:        tcpPacket.SourceAddress.String(),
 			DestinationIP:   tcpPacket.DestinationAddress.String(),
+			SourcePort:      tcpPacket.SourcePort,
 			DestinationPort: tcpPacket.DestinationPort,
+			PeerIdentity:    connection.Auth.RemoteIdentity,
 		})
 
-		return nil, fmt.Errorf("TCP Authentication Option not found %v", err)
+		d.handshakeAnomaly(context, tcpPacket, anomalyInvalidFormat)
+
+		return nil, errortypes.Errorf(errortypes.ErrPolicyRejected, "TCP Authentication Option not found %v", err)
+	}
+
+	d.downgrades.tokenSeen(tcpPacket.SourceAddress.String(), d.clock.Now())
+
+	if !context.issuerAccepted(tcpPacket.SourceAddress, tcpPacket.DestinationPort, connection.Auth.RemotePublicKey, d.authorities) {
+		d.collector.CollectFlowEvent(&collector.FlowRecord{
+			ContextID:       context.ID,
+			SourceID:        txLabel,
+			DestinationID:   context.ManagementID,
+			Tags:            context.Annotations,
+			Action:          collector.FlowReject,
+			Mode:            collector.InvalidIssuer,
+			SourceIP:        tcpPacket.SourceAddress.String(),
+			DestinationIP:   tcpPacket.DestinationAddress.String(),
+			SourcePort:      tcpPacket.SourcePort,
+			DestinationPort: tcpPacket.DestinationPort,
+			PeerIdentity:    connection.Auth.RemoteIdentity,
+		})
+
+		return nil, errortypes.Errorf(errortypes.ErrPolicyRejected, "Syn packet dropped because the issuer of the peer is not accepted")
 	}
 
 	// Remove any of our data from the packet. No matter what we don't need the
@@ -403,10 +477,12 @@ func (d *datapathEnforcer) processNetworkSynPacket(context *PUContext, tcpPacket
 			Mode:            collector.InvalidFormat,
 			SourceIP:        tcpPacket.SourceAddress.String(),
 			DestinationIP:   tcpPacket.DestinationAddress.String(),
+			SourcePort:      tcpPacket.SourcePort,
 			DestinationPort: tcpPacket.DestinationPort,
+			PeerIdentity:    connection.Auth.RemoteIdentity,
 		})
 
-		return nil, fmt.Errorf("Syn packet dropped because of invalid format %v", err)
+		return nil, errortypes.Errorf(errortypes.ErrPolicyRejected, "Syn packet dropped because of invalid format %v", err)
 	}
 
 	tcpPacket.DropDetachedBytes()
@@ -417,7 +493,9 @@ func (d *datapathEnforcer) processNetworkSynPacket(context *PUContext, tcpPacket
 	claims.T.Add(PortNumberLabelString, strconv.Itoa(int(tcpPacket.DestinationPort)))
 
 	// Validate against reject rules first - We always process reject with higher priority
-	if index, _ := context.rejectRcvRules.Search(claims.T); index >= 0 {
+	if index, action := context.rejectRcvRules.Search(claims.T); index >= 0 {
+		context.receiverRules.hit(index, false)
+
 		// Reject the connection
 		d.collector.CollectFlowEvent(&collector.FlowRecord{
 			ContextID:       context.ID,
@@ -428,21 +506,27 @@ func (d *datapathEnforcer) processNetworkSynPacket(context *PUContext, tcpPacket
 			Mode:            collector.PolicyDrop,
 			SourceIP:        tcpPacket.SourceAddress.String(),
 			DestinationIP:   tcpPacket.DestinationAddress.String(),
+			SourcePort:      tcpPacket.SourcePort,
 			DestinationPort: tcpPacket.DestinationPort,
+			PeerIdentity:    connection.Auth.RemoteIdentity,
+			Rejection:       d.rejectFlow(context, tcpPacket, action),
 		})
 
-		return nil, fmt.Errorf("Connection rejected because of policy %+v", claims.T)
+		return nil, errortypes.Errorf(errortypes.ErrPolicyRejected, "Connection rejected because of policy %+v", claims.T)
 	}
 
 	// Search the policy rules for a matching rule.
 	if index, action := context.acceptRcvRules.Search(claims.T); index >= 0 {
 
+		context.receiverRules.hit(index, true)
+
 		hash := tcpPacket.L4FlowHash()
 
 		// Update the connection state and store the Nonse send to us by the host.
 		// We use the nonse in the subsequent packets to achieve randomization.
 
 		connection.State = TCPSynReceived
+		connection.flow = d.newFlowState(TokenFlow, context, tcpPacket)
 
 		// Note that if the connection exists already we will just end-up replicating it. No
 		// harm here.
@@ -450,6 +534,8 @@ func (d *datapathEnforcer) processNetworkSynPacket(context *PUContext, tcpPacket
 		portHash := tcpPacket.DestinationAddress.String() + ":" + strconv.Itoa(int(tcpPacket.DestinationPort)) + ":" + strconv.Itoa(int(tcpPacket.SourcePort))
 		d.destinationPortCache.AddOrUpdate(portHash, context)
 
+		d.trackPeerFlow(context, tcpPacket, txLabel, claims)
+
 		// Accept the connection
 		return action, nil
 	}
@@ -463,10 +549,13 @@ func (d *datapathEnforcer) processNetworkSynPacket(context *PUContext, tcpPacket
 		Mode:            collector.PolicyDrop,
 		SourceIP:        tcpPacket.SourceAddress.String(),
 		DestinationIP:   tcpPacket.DestinationAddress.String(),
+		SourcePort:      tcpPacket.SourcePort,
 		DestinationPort: tcpPacket.DestinationPort,
+		PeerIdentity:    connection.Auth.RemoteIdentity,
+		Rejection:       d.rejectFlow(context, tcpPacket, nil),
 	})
 
-	return nil, fmt.Errorf("No matched tags - reject %+v", claims.T)
+	return nil, errortypes.Errorf(errortypes.ErrPolicyRejected, "No matched tags - reject %+v", claims.T)
 }
 
 func (d *datapathEnforcer) processNetworkSynAckPacket(context *PUContext, tcpPacket *packet.Packet) (interface{}, error) {
@@ -485,10 +574,11 @@ func (d *datapathEnforcer) processNetworkSynAckPacket(context *PUContext, tcpPac
 			Mode:            collector.MissingToken,
 			SourceIP:        tcpPacket.SourceAddress.String(),
 			DestinationIP:   tcpPacket.DestinationAddress.String(),
+			SourcePort:      tcpPacket.SourcePort,
 			DestinationPort: tcpPacket.DestinationPort,
 		})
 
-		return nil, fmt.Errorf("SynAck packet dropped because of missing token")
+		return nil, errortypes.Errorf(errortypes.ErrPolicyRejected, "SynAck packet dropped because of missing token")
 	}
 
 	// Validate the certificate and parse the token
@@ -504,12 +594,15 @@ func (d *datapathEnforcer) processNetworkSynAckPacket(context *PUContext, tcpPac
 			Mode:            collector.MissingToken,
 			SourceIP:        tcpPacket.SourceAddress.String(),
 			DestinationIP:   tcpPacket.DestinationAddress.String(),
+			SourcePort:      tcpPacket.SourcePort,
 			DestinationPort: tcpPacket.DestinationPort,
 		})
 
-		return nil, fmt.Errorf("Synack  packet dropped because of bad claims %v", claims)
+		return nil, errortypes.Errorf(errortypes.ErrPolicyRejected, "Synack  packet dropped because of bad claims %v", claims)
 	}
 
+	d.federatedClaims(claims, cert)
+
 	// We always a need a valid remote context ID
 	remoteContextID, ok := claims.T.Get(TransmitterLabel)
 	if !ok {
@@ -528,6 +621,7 @@ func (d *datapathEnforcer) processNetworkSynAckPacket(context *PUContext, tcpPac
 	connection.Auth.RemotePublicKey = cert
 	connection.Auth.RemoteContext = claims.LCL
 	connection.Auth.RemoteContextID = remoteContextID
+	connection.Auth.RemoteIdentity = verifiedIdentity(claims)
 	tcpPacket.ConnectionMetadata = &connection.Auth
 
 	if err := tcpPacket.CheckTCPAuthenticationOption(TCPAuthenticationOptionBaseLen); err != nil {
@@ -541,10 +635,30 @@ func (d *datapathEnforcer) processNetworkSynAckPacket(context *PUContext, tcpPac
 			DestinationID:   remoteContextID,
 			SourceIP:        tcpPacket.SourceAddress.String(),
 			DestinationIP:   tcpPacket.DestinationAddress.String(),
+			SourcePort:      tcpPacket.SourcePort,
+			DestinationPort: tcpPacket.DestinationPort,
+			PeerIdentity:    connection.Auth.RemoteIdentity,
+		})
+
+		return nil, errortypes.Errorf(errortypes.ErrPolicyRejected, "TCP Authentication Option not found")
+	}
+
+	if !context.issuerAccepted(tcpPacket.SourceAddress, tcpPacket.SourcePort, cert, d.authorities) {
+		d.collector.CollectFlowEvent(&collector.FlowRecord{
+			ContextID:       context.ID,
+			SourceID:        context.ManagementID,
+			Tags:            context.Annotations,
+			Action:          collector.FlowReject,
+			Mode:            collector.InvalidIssuer,
+			DestinationID:   remoteContextID,
+			SourceIP:        tcpPacket.SourceAddress.String(),
+			DestinationIP:   tcpPacket.DestinationAddress.String(),
+			SourcePort:      tcpPacket.SourcePort,
 			DestinationPort: tcpPacket.DestinationPort,
+			PeerIdentity:    connection.Auth.RemoteIdentity,
 		})
 
-		return nil, fmt.Errorf("TCP Authentication Option not found")
+		return nil, errortypes.Errorf(errortypes.ErrPolicyRejected, "SynAck packet dropped because the issuer of the peer is not accepted")
 	}
 
 	// Remove any of our data
@@ -563,10 +677,12 @@ func (d *datapathEnforcer) processNetworkSynAckPacket(context *PUContext, tcpPac
 			DestinationID:   remoteContextID,
 			SourceIP:        tcpPacket.SourceAddress.String(),
 			DestinationIP:   tcpPacket.DestinationAddress.String(),
+			SourcePort:      tcpPacket.SourcePort,
 			DestinationPort: tcpPacket.DestinationPort,
+			PeerIdentity:    connection.Auth.RemoteIdentity,
 		})
 
-		return nil, fmt.Errorf("SynAck packet dropped because of invalid format")
+		return nil, errortypes.Errorf(errortypes.ErrPolicyRejected, "SynAck packet dropped because of invalid format")
 	}
 
 	tcpPacket.DropDetachedBytes()
@@ -578,6 +694,8 @@ func (d *datapathEnforcer) processNetworkSynAckPacket(context *PUContext, tcpPac
 
 	// First validate that there are no reject rules
 	if index, _ := context.rejectTxtRules.Search(claims.T); d.mutualAuthorization && index >= 0 {
+		context.transmitterRules.hit(index, false)
+
 		d.collector.CollectFlowEvent(&collector.FlowRecord{
 			ContextID:       context.ID,
 			SourceID:        context.ManagementID,
@@ -587,13 +705,19 @@ func (d *datapathEnforcer) processNetworkSynAckPacket(context *PUContext, tcpPac
 			DestinationID:   remoteContextID,
 			SourceIP:        tcpPacket.SourceAddress.String(),
 			DestinationIP:   tcpPacket.DestinationAddress.String(),
+			SourcePort:      tcpPacket.SourcePort,
 			DestinationPort: tcpPacket.DestinationPort,
+			PeerIdentity:    connection.Auth.RemoteIdentity,
 		})
 
-		return nil, fmt.Errorf("Dropping because of reject rule on transmitter")
+		return nil, errortypes.Errorf(errortypes.ErrPolicyRejected, "Dropping because of reject rule on transmitter")
 	}
 
 	if index, action := context.acceptTxtRules.Search(claims.T); !d.mutualAuthorization || index >= 0 {
+		if connection.State != TCPSynAckReceived {
+			d.observeHandshake(context, connection)
+			context.transmitterRules.hit(index, true)
+		}
 		connection.State = TCPSynAckReceived
 		return action, nil
 	}
@@ -607,10 +731,12 @@ func (d *datapathEnforcer) processNetworkSynAckPacket(context *PUContext, tcpPac
 		DestinationID:   remoteContextID,
 		SourceIP:        tcpPacket.SourceAddress.String(),
 		DestinationIP:   tcpPacket.DestinationAddress.String(),
+		SourcePort:      tcpPacket.SourcePort,
 		DestinationPort: tcpPacket.DestinationPort,
+		PeerIdentity:    connection.Auth.RemoteIdentity,
 	})
 
-	return nil, fmt.Errorf("Dropping packet SYNACK at the network ")
+	return nil, errortypes.Errorf(errortypes.ErrPolicyRejected, "Dropping packet SYNACK at the network ")
 }
 
 func (d *datapathEnforcer) processNetworkAckPacket(context *PUContext, tcpPacket *packet.Packet) (interface{}, error) {
@@ -641,10 +767,11 @@ func (d *datapathEnforcer) processNetworkAckPacket(context *PUContext, tcpPacket
 				SourceID:        "",
 				SourceIP:        tcpPacket.SourceAddress.String(),
 				DestinationIP:   tcpPacket.DestinationAddress.String(),
+				SourcePort:      tcpPacket.SourcePort,
 				DestinationPort: tcpPacket.DestinationPort,
 			})
 
-			return nil, fmt.Errorf("TCP Authentication Option not found")
+			return nil, errortypes.Errorf(errortypes.ErrPolicyRejected, "TCP Authentication Option not found")
 		}
 
 		if _, err := d.parseAckToken(&connection.Auth, tcpPacket.ReadTCPData()); err != nil {
@@ -658,10 +785,11 @@ func (d *datapathEnforcer) processNetworkAckPacket(context *PUContext, tcpPacket
 				SourceID:        "",
 				SourceIP:        tcpPacket.SourceAddress.String(),
 				DestinationIP:   tcpPacket.DestinationAddress.String(),
+				SourcePort:      tcpPacket.SourcePort,
 				DestinationPort: tcpPacket.DestinationPort,
 			})
 
-			return nil, fmt.Errorf("Ack packet dropped because singature validation failed %v", err)
+			return nil, errortypes.Errorf(errortypes.ErrPolicyRejected, "Ack packet dropped because singature validation failed %v", err)
 		}
 
 		connection.State = TCPAckProcessed
@@ -679,9 +807,10 @@ func (d *datapathEnforcer) processNetworkAckPacket(context *PUContext, tcpPacket
 				SourceID:        "",
 				SourceIP:        tcpPacket.SourceAddress.String(),
 				DestinationIP:   tcpPacket.DestinationAddress.String(),
+				SourcePort:      tcpPacket.SourcePort,
 				DestinationPort: tcpPacket.DestinationPort,
 			})
-			return nil, fmt.Errorf("Ack packet dropped because of invalid format %v", err)
+			return nil, errortypes.Errorf(errortypes.ErrPolicyRejected, "Ack packet dropped because of invalid format %v", err)
 		}
 
 		tcpPacket.DropDetachedBytes()
@@ -690,6 +819,8 @@ func (d *datapathEnforcer) processNetworkAckPacket(context *PUContext, tcpPacket
 
 		d.networkConnectionTracker.Remove(hash)
 
+		d.observeHandshake(context, connection)
+
 		// We accept the packet as a new flow
 		d.collector.CollectFlowEvent(&collector.FlowRecord{
 			ContextID:       context.ID,
@@ -700,9 +831,13 @@ func (d *datapathEnforcer) processNetworkAckPacket(context *PUContext, tcpPacket
 			SourceID:        connection.Auth.RemoteContextID,
 			SourceIP:        tcpPacket.SourceAddress.String(),
 			DestinationIP:   tcpPacket.DestinationAddress.String(),
+			SourcePort:      tcpPacket.SourcePort,
 			DestinationPort: tcpPacket.DestinationPort,
+			PeerIdentity:    connection.Auth.RemoteIdentity,
 		})
 
+		d.cacheVerdict(context, tcpPacket)
+
 		// Accept the packet
 		return nil, nil
 
@@ -718,6 +853,7 @@ func (d *datapathEnforcer) processNetworkAckPacket(context *PUContext, tcpPacket
 		SourceID:        connection.Auth.RemoteContextID,
 		SourceIP:        tcpPacket.SourceAddress.String(),
 		DestinationIP:   tcpPacket.DestinationAddress.String(),
+		SourcePort:      tcpPacket.SourcePort,
 		DestinationPort: tcpPacket.DestinationPort,
 	})
 
@@ -728,7 +864,7 @@ func (d *datapathEnforcer) processNetworkAckPacket(context *PUContext, tcpPacket
 		return nil, nil
 	}
 
-	return nil, fmt.Errorf("Ack packet dropped - no matching rules")
+	return nil, errortypes.Errorf(errortypes.ErrPolicyRejected, "Ack packet dropped - no matching rules")
 }
 
 func (d *datapathEnforcer) processNetworkTCPPacket(tcpPacket *packet.Packet) (interface{}, error) {
@@ -736,6 +872,10 @@ func (d *datapathEnforcer) processNetworkTCPPacket(tcpPacket *packet.Packet) (in
 	var err error
 	var context interface{}
 
+	if d.isIntraHostFlow(tcpPacket) || d.isInteropFlow(tcpPacket) {
+		return nil, nil
+	}
+
 	if d.mode != constants.LocalContainer && tcpPacket.TCPFlags == packet.TCPSynAckMask {
 		if context, err = d.sourcePortCache.Get(tcpPacket.SynAckNetworkHash()); err != nil {
 			return nil, nil
@@ -749,7 +889,7 @@ func (d *datapathEnforcer) processNetworkTCPPacket(tcpPacket *packet.Packet) (in
 	}
 
 	if err != nil {
-		return nil, fmt.Errorf("Context not found for container %s %v", tcpPacket.DestinationAddress.String(), d.puTracker)
+		return nil, errortypes.Errorf(errortypes.ErrPUNotFound, "Context not found for container %s %v", tcpPacket.DestinationAddress.String(), d.puTracker)
 	}
 
 	// Update connection state in the internal state machine tracker
@@ -5,6 +5,7 @@ import (
 	"net"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/aporeto-inc/trireme/collector"
 	"github.com/aporeto-inc/trireme/constants"
@@ -309,3 +310,114 @@ func TestCacheState(t *testing.T) {
 		t.Errorf("Expected failure, no IP but passed %s", err)
 	}
 }
+
+// prefixEngine is a custom token engine carrying the tokens of another engine after
+// a marker
+type prefixEngine struct {
+	tokens.TokenEngine
+	ackSize uint32
+	decoded int
+}
+
+func (e *prefixEngine) CreateAndSign(isAck bool, claims *tokens.ConnectionClaims) []byte {
+	return append([]byte{'#'}, e.TokenEngine.CreateAndSign(isAck, claims)...)
+}
+
+func (e *prefixEngine) Decode(isAck bool, buffer []byte, cert interface{}) (*tokens.ConnectionClaims, interface{}) {
+	if len(buffer) == 0 || buffer[0] != '#' {
+		return nil, nil
+	}
+	e.decoded++
+	return e.TokenEngine.Decode(isAck, buffer[1:], cert)
+}
+
+func (e *prefixEngine) AckSize() uint32 {
+	return e.ackSize
+}
+
+// formatEngine is a token engine decoding the tokens in the standard format and
+// recording the format of the tokens it creates
+type formatEngine struct {
+	tokens.TokenEngine
+	created []tokens.TokenFormat
+}
+
+func (e *formatEngine) CreateAndSign(isAck bool, claims *tokens.ConnectionClaims) []byte {
+	e.created = append(e.created, claims.Format)
+	return e.TokenEngine.CreateAndSign(isAck, claims)
+}
+
+func (e *formatEngine) Decode(isAck bool, buffer []byte, cert interface{}) (*tokens.ConnectionClaims, interface{}) {
+	claims, cert := e.TokenEngine.Decode(isAck, buffer, cert)
+	if claims != nil {
+		claims.Format = tokens.StandardFormat
+	}
+	return claims, cert
+}
+
+func TestSetTokenEngine(t *testing.T) {
+
+	Convey("Given I create a new enforcer instance", t, func() {
+
+		secret := tokens.NewPSKSecrets([]byte("Dummy Test Password"))
+		collector := &collector.DefaultCollector{}
+		enforcer := NewDefaultDatapathEnforcer("SomeServerId", collector, nil, secret, constants.LocalContainer).(*datapathEnforcer)
+
+		jwt, err := tokens.NewJWT(time.Hour, "SomeServerId", secret)
+		So(err, ShouldBeNil)
+
+		Convey("When I set a nil token engine", func() {
+			err := enforcer.SetTokenEngine(nil)
+
+			Convey("Then I should get an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When I set a custom token engine", func() {
+			engine := &prefixEngine{TokenEngine: jwt, ackSize: secret.AckSize() + 1}
+			err := enforcer.SetTokenEngine(engine)
+			So(err, ShouldBeNil)
+
+			Convey("Then the ACK tokens should have the size of the engine", func() {
+				So(enforcer.ackSize, ShouldEqual, secret.AckSize()+1)
+			})
+
+			Convey("Then the tokens should be decoded by the engine", func() {
+				identity := policy.NewTagsMap(map[string]string{TransmitterLabel: "peer", "app": "web"})
+				token := engine.CreateAndSign(false, &tokens.ConnectionClaims{T: identity, LCL: []byte("09876543210987654321098765432109")})
+
+				auth := &AuthInfo{}
+				claims, err := enforcer.parsePacketToken(auth, token)
+				So(err, ShouldBeNil)
+				So(engine.decoded, ShouldEqual, 1)
+				So(auth.RemoteContextID, ShouldEqual, "peer")
+				So(claims.T.Tags["app"], ShouldEqual, "web")
+
+				_, err = enforcer.parsePacketToken(auth, token[1:])
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When I set an engine negotiating the format of the tokens", func() {
+			engine := &formatEngine{TokenEngine: jwt}
+			So(enforcer.SetTokenEngine(engine), ShouldBeNil)
+
+			Convey("Then the tokens should be answered in the format of the peer", func() {
+				identity := policy.NewTagsMap(map[string]string{TransmitterLabel: "peer"})
+				context := &PUContext{Identity: identity}
+
+				auth := &AuthInfo{}
+				enforcer.createPacketToken(false, context, auth)
+
+				_, err := enforcer.parsePacketToken(auth, jwt.CreateAndSign(false, &tokens.ConnectionClaims{T: identity, LCL: []byte("09876543210987654321098765432109")}))
+				So(err, ShouldBeNil)
+				So(auth.TokenFormat, ShouldEqual, tokens.StandardFormat)
+
+				enforcer.createPacketToken(false, context, auth)
+				enforcer.createPacketToken(true, context, auth)
+				So(engine.created, ShouldResemble, []tokens.TokenFormat{tokens.DefaultFormat, tokens.StandardFormat, tokens.StandardFormat})
+			})
+		})
+	})
+}
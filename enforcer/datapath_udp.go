@@ -0,0 +1,251 @@
+package enforcer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/enforcer/utils/packet"
+	"github.com/aporeto-inc/trireme/policy"
+	"github.com/aporeto-inc/trireme/utils/errortypes"
+	"github.com/aporeto-inc/trireme/utils/features"
+)
+
+// The UDP flows between the PUs that enable the UDP enforcement are authorized with
+// the token of the transmitter, appended to the payload of its datagrams until the
+// receiver replies. The receiver removes the token before the datagram reaches the
+// PU. The limitations are:
+//   - The tokens make the datagrams bigger, which may fragment them.
+//   - The transmitter does not authorize the receiver, even with mutual
+//     authorization, since the replies carry no token.
+//   - A flow without replies carries a token in every datagram.
+//   - The DNS queries accepted by a DNS policy carry no token.
+
+const (
+	// udpFlowLifetime is the time a UDP flow is remembered after its last datagram
+	udpFlowLifetime = time.Second * 60
+	// udpTokenLengthSize is the size of the length of the token in a datagram
+	udpTokenLengthSize = 2
+	// dnsPort is the port of the DNS servers
+	dnsPort = 53
+)
+
+// udpTokenMarker ends the payload of the datagrams carrying a token. It follows the
+// token and its length.
+var udpTokenMarker = []byte("TRMU")
+
+// udpFlow is a UDP flow sent by a PU
+type udpFlow struct {
+	contextID string
+	// replied is true once the receiver replied, after which the datagrams of the
+	// flow carry no token
+	replied bool
+}
+
+// parseUDPNetworks returns the networks whose UDP flows are authorized with tokens,
+// or nil if the policy does not enable the UDP enforcement
+func parseUDPNetworks(p *policy.PUPolicy) []*net.IPNet {
+
+	if !p.FeatureEnabled(string(features.UDPEnforcement)) {
+		return nil
+	}
+
+	return parseTrustedNetworks(p.TriremeNetworks())
+}
+
+// udpEnforced returns true if the UDP flows of the PU with the address are
+// authorized with tokens
+func (p *PUContext) udpEnforced(ip net.IP) bool {
+
+	for _, network := range p.udpNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// udpTokenTrailer returns the bytes appended to a datagram to carry a token
+func udpTokenTrailer(token []byte) []byte {
+
+	trailer := make([]byte, len(token)+udpTokenLengthSize, len(token)+udpTokenLengthSize+len(udpTokenMarker))
+	copy(trailer, token)
+	binary.BigEndian.PutUint16(trailer[len(token):], uint16(len(token)))
+
+	return append(trailer, udpTokenMarker...)
+}
+
+// udpToken returns the token at the end of the payload of a datagram, or nil if the
+// datagram carries no token
+func udpToken(payload []byte) []byte {
+
+	overhead := udpTokenLengthSize + len(udpTokenMarker)
+	if len(payload) < overhead || !bytes.HasSuffix(payload, udpTokenMarker) {
+		return nil
+	}
+
+	end := len(payload) - overhead
+	length := int(binary.BigEndian.Uint16(payload[end : end+udpTokenLengthSize]))
+	if length == 0 || length > end {
+		return nil
+	}
+
+	return payload[end-length : end]
+}
+
+// processApplicationUDPPacket processes the datagrams sent by the PUs. The DNS
+// queries are validated, and the datagrams of the flows authorized with tokens
+// carry the token of the PU until the receiver replies.
+func (d *datapathEnforcer) processApplicationUDPPacket(p *packet.Packet) error {
+
+	context, err := d.contextFromIP(true, p.SourceAddress.String(), p.Mark, strconv.Itoa(int(p.DestinationPort)))
+	if err != nil {
+		return err
+	}
+	puContext := context.(*PUContext)
+
+	if p.DestinationPort == dnsPort && len(puContext.dnsDomains) > 0 {
+		if err := d.processApplicationDNSPacket(p); err != nil {
+			return err
+		}
+	}
+
+	if !puContext.udpEnforced(p.DestinationAddress) {
+		return nil
+	}
+
+	// The replies to a flow authorized by the PU carry no token
+	if _, err := d.udpNetFlows.Get(p.L4ReverseFlowHash()); err == nil {
+		d.udpNetFlows.AddOrUpdate(p.L4ReverseFlowHash(), puContext.ID)
+		return nil
+	}
+
+	hash := p.L4FlowHash()
+	flow := &udpFlow{contextID: puContext.ID}
+	if cached, err := d.udpAppFlows.Get(hash); err == nil {
+		flow = cached.(*udpFlow)
+	}
+	d.udpAppFlows.AddOrUpdate(hash, flow)
+
+	if flow.replied {
+		return nil
+	}
+
+	token := d.createPacketToken(false, puContext, &AuthInfo{})
+
+	return p.UDPDataAttach(udpTokenTrailer(token))
+}
+
+// processNetworkUDPPacket processes the datagrams received by the PUs that enable
+// the UDP enforcement. The first datagram of a flow must carry a token accepted by
+// the policy of the PU. The token is removed from the datagrams of the flow.
+func (d *datapathEnforcer) processNetworkUDPPacket(p *packet.Packet) error {
+
+	context, err := d.contextFromIP(false, p.DestinationAddress.String(), p.Mark, strconv.Itoa(int(p.DestinationPort)))
+	if err != nil {
+		return err
+	}
+	puContext := context.(*PUContext)
+
+	if !puContext.udpEnforced(p.SourceAddress) {
+		return nil
+	}
+
+	// A reply to a flow of the PU stops the tokens of the flow
+	if cached, err := d.udpAppFlows.Get(p.L4ReverseFlowHash()); err == nil {
+		d.udpAppFlows.AddOrUpdate(p.L4ReverseFlowHash(), &udpFlow{contextID: cached.(*udpFlow).contextID, replied: true})
+		return nil
+	}
+
+	hash := p.L4FlowHash()
+	token := udpToken(p.UDPPayload())
+
+	if _, err := d.udpNetFlows.Get(hash); err == nil {
+		d.udpNetFlows.AddOrUpdate(hash, puContext.ID)
+		return d.detachUDPToken(p, token)
+	}
+
+	if token == nil {
+		d.reportUDPFlow(puContext, p, "", nil, collector.FlowReject, collector.MissingToken)
+		return errortypes.Errorf(errortypes.ErrPolicyRejected, "UDP datagram dropped because of missing token")
+	}
+
+	auth := &AuthInfo{}
+	claims, err := d.parsePacketToken(auth, token)
+	if err != nil {
+		d.reportUDPFlow(puContext, p, "", nil, collector.FlowReject, collector.InvalidToken)
+		return errortypes.Errorf(errortypes.ErrPolicyRejected, "UDP datagram dropped because of invalid token %v", err)
+	}
+
+	if !puContext.issuerAccepted(p.SourceAddress, p.DestinationPort, auth.RemotePublicKey, d.authorities) {
+		d.reportUDPFlow(puContext, p, auth.RemoteContextID, auth.RemoteIdentity, collector.FlowReject, collector.InvalidIssuer)
+		return errortypes.Errorf(errortypes.ErrPolicyRejected, "UDP datagram dropped because the issuer of the peer is not accepted")
+	}
+
+	if err := d.detachUDPToken(p, token); err != nil {
+		d.reportUDPFlow(puContext, p, auth.RemoteContextID, auth.RemoteIdentity, collector.FlowReject, collector.InvalidFormat)
+		return err
+	}
+
+	claims.T.Add(PortNumberLabelString, strconv.Itoa(int(p.DestinationPort)))
+
+	if index, _ := puContext.rejectRcvRules.Search(claims.T); index >= 0 {
+		puContext.receiverRules.hit(index, false)
+		d.reportUDPFlow(puContext, p, auth.RemoteContextID, auth.RemoteIdentity, collector.FlowReject, collector.PolicyDrop)
+		return errortypes.Errorf(errortypes.ErrPolicyRejected, "UDP flow rejected because of policy %+v", claims.T)
+	}
+
+	index, _ := puContext.acceptRcvRules.Search(claims.T)
+	if index < 0 {
+		d.reportUDPFlow(puContext, p, auth.RemoteContextID, auth.RemoteIdentity, collector.FlowReject, collector.PolicyDrop)
+		return errortypes.Errorf(errortypes.ErrPolicyRejected, "No matched tags for UDP flow - reject %+v", claims.T)
+	}
+
+	puContext.receiverRules.hit(index, true)
+
+	d.udpNetFlows.AddOrUpdate(hash, puContext.ID)
+	d.reportUDPFlow(puContext, p, auth.RemoteContextID, auth.RemoteIdentity, collector.FlowAccept, "NA")
+
+	return nil
+}
+
+// detachUDPToken removes the token from a datagram, if it carries one
+func (d *datapathEnforcer) detachUDPToken(p *packet.Packet, token []byte) error {
+
+	if token == nil {
+		return nil
+	}
+
+	if err := p.UDPDataDetach(uint16(len(token) + udpTokenLengthSize + len(udpTokenMarker))); err != nil {
+		log.WithFields(log.Fields{
+			"package": "enforcer",
+			"error":   err.Error(),
+		}).Debug("Unable to remove the token of a UDP datagram")
+		return errortypes.Errorf(errortypes.ErrPolicyRejected, "UDP datagram dropped because of invalid format %v", err)
+	}
+
+	return nil
+}
+
+// reportUDPFlow reports the decision on a UDP flow received by a PU
+func (d *datapathEnforcer) reportUDPFlow(context *PUContext, p *packet.Packet, sourceID string, identity *policy.TagsMap, action string, mode string) {
+
+	d.collector.CollectFlowEvent(&collector.FlowRecord{
+		ContextID:       context.ID,
+		SourceID:        sourceID,
+		DestinationID:   context.ManagementID,
+		Tags:            context.Annotations,
+		Action:          action,
+		Mode:            mode,
+		SourceIP:        p.SourceAddress.String(),
+		DestinationIP:   p.DestinationAddress.String(),
+		SourcePort:      p.SourcePort,
+		DestinationPort: p.DestinationPort,
+		PeerIdentity:    identity,
+	})
+}
@@ -0,0 +1,176 @@
+package enforcer
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/enforcer/utils/packet"
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+	"github.com/aporeto-inc/trireme/policy"
+	"github.com/aporeto-inc/trireme/utils/features"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// udpFlowPacket returns a UDP packet from src:sport to dst:dport with the payload
+func udpFlowPacket(src string, sport uint16, dst string, dport uint16, payload string) *packet.Packet {
+
+	buffer := udpPacket(src, dst, []byte(payload))
+	binary.BigEndian.PutUint16(buffer[20:22], sport)
+	binary.BigEndian.PutUint16(buffer[22:24], dport)
+
+	p, _ := packet.New(0, buffer, "0")
+	p.UpdateIPChecksum()
+	p.UpdateUDPChecksum()
+
+	return p
+}
+
+// udpPUInfo returns a PU enforcing its UDP flows with the Trireme networks
+func udpPUInfo(contextID string, ip string, selector *policy.TagSelector) *policy.PUInfo {
+
+	puInfo := intraHostPUInfo(contextID, ip, selector)
+	puInfo.Policy.AddIdentityTag("app", contextID)
+	puInfo.Policy.UpdateTriremeNetworks([]string{"10.0.0.0/8"})
+	puInfo.Policy.UpdateFeatures([]string{string(features.UDPEnforcement)})
+
+	return puInfo
+}
+
+func TestUDPFlows(t *testing.T) {
+
+	Convey("Given I create an enforcer with a client and a server enforcing their UDP flows", t, func() {
+
+		acceptClient := &policy.TagSelector{
+			Clause: []policy.KeyValueOperator{
+				{Key: "app", Value: []string{"client"}, Operator: policy.Equal},
+				{Key: PortNumberLabelString, Value: []string{"514"}, Operator: policy.Equal},
+			},
+			Action: policy.Accept,
+		}
+
+		flows := &flowCollector{}
+		secret := tokens.NewPSKSecrets([]byte("Dummy Test Password"))
+		enforcer := NewDefaultDatapathEnforcer("SomeServerId", flows, nil, secret, constants.LocalContainer).(*datapathEnforcer)
+
+		So(enforcer.Enforce("client", udpPUInfo("client", "10.1.1.1", &policy.TagSelector{})), ShouldBeNil)
+		So(enforcer.Enforce("server", udpPUInfo("server", "10.1.1.2", acceptClient)), ShouldBeNil)
+
+		Convey("When the client sends a datagram to the server", func() {
+
+			datagram := udpFlowPacket("10.1.1.1", 40000, "10.1.1.2", 514, "syslog")
+			So(enforcer.processApplicationUDPPacket(datagram), ShouldBeNil)
+
+			Convey("Then the datagram should carry the token of the client", func() {
+				So(udpToken(datagram.UDPPayload()), ShouldNotBeNil)
+				So(datagram.VerifyUDPChecksum(), ShouldBeTrue)
+			})
+
+			Convey("When the server receives it", func() {
+
+				received, err := packet.New(0, datagram.GetBytes(), "0")
+				So(err, ShouldBeNil)
+				So(enforcer.processNetworkUDPPacket(received), ShouldBeNil)
+
+				Convey("Then the token should be removed and the flow reported", func() {
+					So(string(received.UDPPayload()), ShouldEqual, "syslog")
+					So(received.VerifyIPChecksum(), ShouldBeTrue)
+					So(received.VerifyUDPChecksum(), ShouldBeTrue)
+
+					So(len(flows.flows), ShouldEqual, 1)
+					So(flows.flows[0].Action, ShouldEqual, collector.FlowAccept)
+					So(flows.flows[0].ContextID, ShouldEqual, "server")
+					So(flows.flows[0].SourceID, ShouldEqual, "client")
+					So(flows.flows[0].DestinationPort, ShouldEqual, 514)
+				})
+
+				Convey("When the server replies", func() {
+
+					reply := udpFlowPacket("10.1.1.2", 514, "10.1.1.1", 40000, "ack")
+					So(enforcer.processApplicationUDPPacket(reply), ShouldBeNil)
+					So(string(reply.UDPPayload()), ShouldEqual, "ack")
+					So(enforcer.processNetworkUDPPacket(reply), ShouldBeNil)
+
+					Convey("Then the next datagrams of the client should carry no token", func() {
+						next := udpFlowPacket("10.1.1.1", 40000, "10.1.1.2", 514, "syslog")
+						So(enforcer.processApplicationUDPPacket(next), ShouldBeNil)
+						So(string(next.UDPPayload()), ShouldEqual, "syslog")
+						So(enforcer.processNetworkUDPPacket(next), ShouldBeNil)
+					})
+				})
+			})
+		})
+
+		Convey("When the server receives a datagram without token", func() {
+
+			datagram := udpFlowPacket("10.1.1.1", 40000, "10.1.1.2", 514, "syslog")
+
+			Convey("Then the datagram should be dropped and reported", func() {
+				So(enforcer.processNetworkUDPPacket(datagram), ShouldNotBeNil)
+				So(len(flows.flows), ShouldEqual, 1)
+				So(flows.flows[0].Action, ShouldEqual, collector.FlowReject)
+				So(flows.flows[0].Mode, ShouldEqual, collector.MissingToken)
+			})
+		})
+
+		Convey("When the client sends a datagram to a port the server does not accept", func() {
+
+			datagram := udpFlowPacket("10.1.1.1", 40000, "10.1.1.2", 53, "query")
+			So(enforcer.processApplicationUDPPacket(datagram), ShouldBeNil)
+
+			received, err := packet.New(0, datagram.GetBytes(), "0")
+			So(err, ShouldBeNil)
+
+			Convey("Then the datagram should be dropped and reported", func() {
+				So(enforcer.processNetworkUDPPacket(received), ShouldNotBeNil)
+				So(len(flows.flows), ShouldEqual, 1)
+				So(flows.flows[0].Action, ShouldEqual, collector.FlowReject)
+				So(flows.flows[0].Mode, ShouldEqual, collector.PolicyDrop)
+				So(flows.flows[0].SourceID, ShouldEqual, "client")
+			})
+		})
+
+		Convey("When the client sends a datagram outside the Trireme networks", func() {
+
+			datagram := udpFlowPacket("10.1.1.1", 40000, "192.168.1.1", 514, "syslog")
+
+			Convey("Then the datagram should carry no token", func() {
+				So(enforcer.processApplicationUDPPacket(datagram), ShouldBeNil)
+				So(string(datagram.UDPPayload()), ShouldEqual, "syslog")
+			})
+		})
+	})
+}
+
+func TestUDPToken(t *testing.T) {
+
+	Convey("Given a payload carrying a token", t, func() {
+
+		payload := append([]byte("data"), udpTokenTrailer([]byte("token"))...)
+
+		Convey("Then the token should be found", func() {
+			So(string(udpToken(payload)), ShouldEqual, "token")
+		})
+
+		Convey("Then a payload without marker or with an invalid length should carry no token", func() {
+			So(udpToken([]byte("data")), ShouldBeNil)
+			So(udpToken(payload[:len(payload)-1]), ShouldBeNil)
+
+			invalid := append([]byte{}, payload...)
+			binary.BigEndian.PutUint16(invalid[len(invalid)-len(udpTokenMarker)-udpTokenLengthSize:], 100)
+			So(udpToken(invalid), ShouldBeNil)
+		})
+	})
+
+	Convey("Given a PU enforcing its UDP flows", t, func() {
+
+		context := &PUContext{udpNetworks: parseUDPNetworks(udpPUInfo("pu", "10.1.1.1", &policy.TagSelector{}).Policy)}
+
+		Convey("Then only the flows of the Trireme networks should be enforced", func() {
+			So(context.udpEnforced(net.ParseIP("10.2.2.2")), ShouldBeTrue)
+			So(context.udpEnforced(net.ParseIP("192.168.1.1")), ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,139 @@
+package enforcer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/enforcer/utils/packet"
+	"github.com/aporeto-inc/trireme/policy"
+)
+
+const (
+	// dnsHeaderLength is the length of the header of a DNS message
+	dnsHeaderLength = 12
+	// dnsMaxLabelLength is the maximum length of a label of a domain name
+	dnsMaxLabelLength = 63
+)
+
+// parseDNSDomains returns the normalized domains of a DNS policy
+func parseDNSDomains(dns *policy.DNSPolicy) []string {
+
+	domains := []string{}
+
+	if dns == nil {
+		return domains
+	}
+
+	for _, domain := range dns.Domains {
+		domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+		if domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+
+	return domains
+}
+
+// dnsDomainAllowed returns true if the PU can resolve the name
+func (p *PUContext) dnsDomainAllowed(name string) bool {
+
+	if len(p.dnsDomains) == 0 {
+		return true
+	}
+
+	name = strings.ToLower(name)
+
+	for _, domain := range p.dnsDomains {
+		if name == domain || strings.HasSuffix(name, "."+domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseDNSQuestion returns the name of the single question of a DNS query. The
+// queries with several questions or compressed names are rejected since the
+// resolvers never send them.
+func parseDNSQuestion(message []byte) (string, error) {
+
+	if len(message) < dnsHeaderLength {
+		return "", fmt.Errorf("DNS message too short")
+	}
+
+	if message[2]&0x80 != 0 {
+		return "", fmt.Errorf("DNS message is not a query")
+	}
+
+	if binary.BigEndian.Uint16(message[4:6]) != 1 {
+		return "", fmt.Errorf("DNS query must have a single question")
+	}
+
+	labels := []string{}
+	data := message[dnsHeaderLength:]
+
+	for {
+		if len(data) == 0 {
+			return "", fmt.Errorf("DNS question truncated")
+		}
+
+		length := int(data[0])
+		if length == 0 {
+			break
+		}
+
+		if length > dnsMaxLabelLength || len(data) < length+1 {
+			return "", fmt.Errorf("Invalid DNS label")
+		}
+
+		labels = append(labels, string(data[1:length+1]))
+		data = data[length+1:]
+	}
+
+	return strings.Join(labels, "."), nil
+}
+
+// processApplicationDNSPacket validates the DNS queries sent by the PUs whose domains
+// are restricted. The supervisor only sends the queries to the allowed servers.
+func (d *datapathEnforcer) processApplicationDNSPacket(p *packet.Packet) error {
+
+	context, err := d.contextFromIP(true, p.SourceAddress.String(), p.Mark, strconv.Itoa(int(p.DestinationPort)))
+	if err != nil {
+		return err
+	}
+	puContext := context.(*PUContext)
+
+	name, err := parseDNSQuestion(p.UDPPayload())
+	if err == nil && puContext.dnsDomainAllowed(name) {
+		return nil
+	}
+
+	if err == nil {
+		err = fmt.Errorf("Domain %s is not allowed by the DNS policy", name)
+	}
+
+	log.WithFields(log.Fields{
+		"package":   "enforcer",
+		"contextID": puContext.ID,
+		"error":     err.Error(),
+	}).Debug("Dropping DNS query")
+
+	d.collector.CollectFlowEvent(&collector.FlowRecord{
+		ContextID:       puContext.ID,
+		SourceID:        puContext.ManagementID,
+		DestinationID:   name,
+		Tags:            puContext.Annotations,
+		Action:          collector.FlowReject,
+		Mode:            collector.DNSPolicyDrop,
+		SourceIP:        p.SourceAddress.String(),
+		DestinationIP:   p.DestinationAddress.String(),
+		SourcePort:      p.SourcePort,
+		DestinationPort: p.DestinationPort,
+	})
+
+	return err
+}
@@ -0,0 +1,123 @@
+package enforcer
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/enforcer/utils/packet"
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+	"github.com/aporeto-inc/trireme/policy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// dnsQuery returns the message of a DNS query for name
+func dnsQuery(name string) []byte {
+
+	message := []byte{0x12, 0x34, 0x01, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0}
+
+	question := []byte{}
+	start := 0
+	for i := 0; i <= len(name); i++ {
+		if i == len(name) || name[i] == '.' {
+			question = append(question, byte(i-start))
+			question = append(question, name[start:i]...)
+			start = i + 1
+		}
+	}
+	question = append(question, 0, 0, 1, 0, 1)
+
+	return append(message, question...)
+}
+
+// udpPacket returns the bytes of a UDP packet from src to dst:53 with the payload
+func udpPacket(src string, dst string, payload []byte) []byte {
+
+	length := 20 + 8 + len(payload)
+	buffer := make([]byte, length)
+
+	buffer[0] = 0x45
+	binary.BigEndian.PutUint16(buffer[2:4], uint16(length))
+	buffer[8] = 64
+	buffer[9] = packet.IPProtocolUDP
+	copy(buffer[12:16], net.ParseIP(src).To4())
+	copy(buffer[16:20], net.ParseIP(dst).To4())
+
+	binary.BigEndian.PutUint16(buffer[20:22], 40000)
+	binary.BigEndian.PutUint16(buffer[22:24], 53)
+	binary.BigEndian.PutUint16(buffer[24:26], uint16(8+len(payload)))
+	copy(buffer[28:], payload)
+
+	return buffer
+}
+
+func TestParseDNSQuestion(t *testing.T) {
+
+	Convey("Given a DNS query", t, func() {
+
+		Convey("Its question should be parsed", func() {
+			name, err := parseDNSQuestion(dnsQuery("www.Example.com"))
+			So(err, ShouldBeNil)
+			So(name, ShouldEqual, "www.Example.com")
+		})
+
+		Convey("A truncated question should be rejected", func() {
+			query := dnsQuery("www.example.com")
+			_, err := parseDNSQuestion(query[:16])
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("A response should be rejected", func() {
+			query := dnsQuery("www.example.com")
+			query[2] |= 0x80
+			_, err := parseDNSQuestion(query)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("A query with several questions should be rejected", func() {
+			query := dnsQuery("www.example.com")
+			query[5] = 2
+			_, err := parseDNSQuestion(query)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestDNSPolicy(t *testing.T) {
+
+	Convey("Given I create an enforcer with a processing unit restricted to example.com", t, func() {
+
+		flows := &flowCollector{}
+		secret := tokens.NewPSKSecrets([]byte("Dummy Test Password"))
+		enforcer := NewDefaultDatapathEnforcer("SomeServerId", flows, nil, secret, constants.LocalContainer).(*datapathEnforcer)
+
+		puInfo := intraHostPUInfo("SomeProcessingUnitId1", "164.67.228.152", &policy.TagSelector{})
+		puInfo.Policy.UpdateDNSPolicy(policy.NewDNSPolicy([]string{"8.8.8.8/32"}, []string{"Example.com."}))
+		So(enforcer.Enforce("SomeProcessingUnitId1", puInfo), ShouldBeNil)
+
+		Convey("When the PU resolves a subdomain of example.com", func() {
+			udp, err := packet.New(0, udpPacket("164.67.228.152", "8.8.8.8", dnsQuery("www.example.com")), "0")
+			So(err, ShouldBeNil)
+
+			Convey("Then the query should be accepted", func() {
+				So(enforcer.processApplicationDNSPacket(udp), ShouldBeNil)
+				So(len(flows.flows), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When the PU resolves another domain", func() {
+			udp, err := packet.New(0, udpPacket("164.67.228.152", "8.8.8.8", dnsQuery("notexample.com")), "0")
+			So(err, ShouldBeNil)
+
+			Convey("Then the query should be dropped and reported", func() {
+				So(enforcer.processApplicationDNSPacket(udp), ShouldNotBeNil)
+				So(len(flows.flows), ShouldEqual, 1)
+				So(flows.flows[0].Action, ShouldEqual, collector.FlowReject)
+				So(flows.flows[0].Mode, ShouldEqual, collector.DNSPolicyDrop)
+				So(flows.flows[0].DestinationID, ShouldEqual, "notexample.com")
+			})
+		})
+	})
+}
@@ -0,0 +1,285 @@
+package enforcer
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/enforcer/utils/packet"
+	"github.com/aporeto-inc/trireme/utils/errortypes"
+)
+
+const (
+	// DefaultDowngradeThreshold is the default number of handshake anomalies of a
+	// source that raise an alert
+	DefaultDowngradeThreshold = 3
+	// DefaultDowngradeWindow is the default window in which the handshake anomalies
+	// of a source are counted
+	DefaultDowngradeWindow = time.Minute
+	// DefaultBlocklistDuration is the default time the handshakes of an offending
+	// source are rejected
+	DefaultBlocklistDuration = 10 * time.Minute
+
+	// maxDowngradeSources bounds the number of sources tracked by the detector
+	maxDowngradeSources = 65536
+)
+
+// Handshake anomalies that may reveal a downgrade of the identity handshake
+const (
+	// anomalyStrippedToken is a SYN carrying the authentication option without a token
+	anomalyStrippedToken = "stripped token"
+	// anomalyMissingToken is a SYN without token from a source that sent tokens
+	anomalyMissingToken = "missing token"
+	// anomalyInvalidToken is a SYN whose token cannot be verified
+	anomalyInvalidToken = "invalid token"
+	// anomalyInvalidFormat is a SYN whose token is not followed by the authentication option
+	anomalyInvalidFormat = "invalid format"
+)
+
+// DowngradeConfig configures the detection of the handshakes downgraded to the
+// processing of the peers that do not run trireme, like when an attacker strips
+// the identity of the SYN packets so that only the ACLs apply
+type DowngradeConfig struct {
+	// Threshold is the number of anomalies of a source within the window that raise
+	// a security event
+	Threshold int
+	// Window is the window in which the anomalies of a source are counted
+	Window time.Duration
+	// Blocklist rejects the handshakes of the offending sources
+	Blocklist bool
+	// BlocklistDuration is the time the handshakes of an offending source are rejected
+	BlocklistDuration time.Duration
+}
+
+// downgradeDetector counts the handshake anomalies per source
+type downgradeDetector struct {
+	config *DowngradeConfig
+	// anomalies are the times of the recent anomalies, by source
+	anomalies map[string][]time.Time
+	// peers are the last times the sources sent a valid token
+	peers map[string]time.Time
+	// blocked are the ends of the blocking of the sources
+	blocked map[string]time.Time
+	sync.Mutex
+}
+
+func newDowngradeDetector() *downgradeDetector {
+
+	return &downgradeDetector{
+		anomalies: map[string][]time.Time{},
+		peers:     map[string]time.Time{},
+		blocked:   map[string]time.Time{},
+	}
+}
+
+// SetDowngradeDetection enables the detection of the handshake downgrades, or
+// disables it if the configuration is nil
+func (d *datapathEnforcer) SetDowngradeDetection(config *DowngradeConfig) {
+
+	d.downgrades.Lock()
+	defer d.downgrades.Unlock()
+
+	d.downgrades.anomalies = map[string][]time.Time{}
+	d.downgrades.peers = map[string]time.Time{}
+	d.downgrades.blocked = map[string]time.Time{}
+
+	if config == nil {
+		d.downgrades.config = nil
+		return
+	}
+
+	c := *config
+
+	if c.Threshold <= 0 {
+		c.Threshold = DefaultDowngradeThreshold
+	}
+
+	if c.Window <= 0 {
+		c.Window = DefaultDowngradeWindow
+	}
+
+	if c.BlocklistDuration <= 0 {
+		c.BlocklistDuration = DefaultBlocklistDuration
+	}
+
+	d.downgrades.config = &c
+}
+
+// tokenSeen records that the source sent a valid token
+func (g *downgradeDetector) tokenSeen(source string, now time.Time) {
+
+	g.Lock()
+	defer g.Unlock()
+
+	if g.config == nil {
+		return
+	}
+
+	g.prune(now)
+	g.peers[source] = now
+}
+
+// knownPeer returns true if the source sent a valid token within the window
+func (g *downgradeDetector) knownPeer(source string, now time.Time) bool {
+
+	g.Lock()
+	defer g.Unlock()
+
+	if g.config == nil {
+		return false
+	}
+
+	seen, ok := g.peers[source]
+
+	return ok && now.Sub(seen) < g.config.Window
+}
+
+// isBlocked returns true if the handshakes of the source are rejected
+func (g *downgradeDetector) isBlocked(source string, now time.Time) bool {
+
+	g.Lock()
+	defer g.Unlock()
+
+	until, ok := g.blocked[source]
+	if !ok {
+		return false
+	}
+
+	if !now.Before(until) {
+		delete(g.blocked, source)
+		return false
+	}
+
+	return true
+}
+
+// anomaly records an anomaly of the source. It returns the number of anomalies of
+// the source within the window when it reaches the threshold, and zero otherwise,
+// and whether the source was blocked, if the blocklist is enabled.
+func (g *downgradeDetector) anomaly(source string, now time.Time) (int, bool) {
+
+	g.Lock()
+	defer g.Unlock()
+
+	if g.config == nil {
+		return 0, false
+	}
+
+	g.prune(now)
+
+	recent := []time.Time{now}
+	for _, t := range g.anomalies[source] {
+		if now.Sub(t) < g.config.Window {
+			recent = append(recent, t)
+		}
+	}
+
+	if len(recent) < g.config.Threshold {
+		g.anomalies[source] = recent
+		return 0, false
+	}
+
+	// The next alert of the source needs as many anomalies again
+	delete(g.anomalies, source)
+
+	if g.config.Blocklist {
+		g.blocked[source] = now.Add(g.config.BlocklistDuration)
+	}
+
+	return len(recent), g.config.Blocklist
+}
+
+// prune forgets the expired sources once the detector tracks too many of them
+func (g *downgradeDetector) prune(now time.Time) {
+
+	if len(g.anomalies)+len(g.peers) < maxDowngradeSources {
+		return
+	}
+
+	for source, times := range g.anomalies {
+		if len(times) == 0 || now.Sub(times[0]) >= g.config.Window {
+			delete(g.anomalies, source)
+		}
+	}
+
+	for source, seen := range g.peers {
+		if now.Sub(seen) >= g.config.Window {
+			delete(g.peers, source)
+		}
+	}
+}
+
+// rejectBlockedSyn rejects the SYN packets of the blocked sources
+func (d *datapathEnforcer) rejectBlockedSyn(context *PUContext, tcpPacket *packet.Packet) error {
+
+	if !d.downgrades.isBlocked(tcpPacket.SourceAddress.String(), d.clock.Now()) {
+		return nil
+	}
+
+	d.collector.CollectFlowEvent(&collector.FlowRecord{
+		ContextID:       context.ID,
+		DestinationID:   context.ManagementID,
+		Tags:            context.Annotations,
+		Action:          collector.FlowReject,
+		Mode:            collector.HandshakeBlocked,
+		SourceIP:        tcpPacket.SourceAddress.String(),
+		DestinationIP:   tcpPacket.DestinationAddress.String(),
+		SourcePort:      tcpPacket.SourcePort,
+		DestinationPort: tcpPacket.DestinationPort,
+	})
+
+	return errortypes.Errorf(errortypes.ErrPolicyRejected, "Syn packet dropped because its source is blocked after handshake anomalies")
+}
+
+// detectTokenlessSyn records an anomaly for the SYN packets without token that
+// still carry the authentication option, or that come from a source known to send
+// tokens. The SYN packets of the peers that do not run trireme have neither.
+func (d *datapathEnforcer) detectTokenlessSyn(context *PUContext, tcpPacket *packet.Packet) {
+
+	source := tcpPacket.SourceAddress.String()
+
+	switch {
+	case tcpPacket.HasTCPAuthenticationOption(TCPAuthenticationOptionBaseLen):
+		d.handshakeAnomaly(context, tcpPacket, anomalyStrippedToken)
+	case d.downgrades.knownPeer(source, d.clock.Now()):
+		d.handshakeAnomaly(context, tcpPacket, anomalyMissingToken)
+	}
+}
+
+// handshakeAnomaly records an anomaly of the source of the SYN packet and emits a
+// security event when the source reaches the threshold
+func (d *datapathEnforcer) handshakeAnomaly(context *PUContext, tcpPacket *packet.Packet, kind string) {
+
+	source := tcpPacket.SourceAddress.String()
+
+	count, blocked := d.downgrades.anomaly(source, d.clock.Now())
+	if count == 0 {
+		return
+	}
+
+	details := []string{fmt.Sprintf("%d handshake anomalies, last one %s on port %d", count, kind, tcpPacket.DestinationPort)}
+	if blocked {
+		details = append(details, "source blocked")
+	}
+
+	log.WithFields(log.Fields{
+		"package":   "enforcer",
+		"contextID": context.ID,
+		"source":    source,
+		"anomaly":   kind,
+		"count":     count,
+		"blocked":   blocked,
+	}).Warn("Possible downgrade of the identity handshake")
+
+	if c, ok := d.collector.(collector.SecurityEventCollector); ok {
+		c.CollectSecurityEvent(&collector.SecurityRecord{
+			Event:     collector.SecurityHandshakeDowngrade,
+			ContextID: context.ID,
+			SourceIP:  source,
+			Details:   strings.Join(details, ", "),
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package enforcer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/enforcer/utils/packet"
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+	"github.com/aporeto-inc/trireme/policy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// securityCollector records the flow and security events
+type securityCollector struct {
+	flowCollector
+	security []*collector.SecurityRecord
+}
+
+func (c *securityCollector) CollectSecurityEvent(record *collector.SecurityRecord) {
+	c.security = append(c.security, record)
+}
+
+func TestDowngradeDetection(t *testing.T) {
+
+	Convey("Given an enforcer detecting the handshake downgrades", t, func() {
+
+		c := &securityCollector{}
+		secret := tokens.NewPSKSecrets([]byte("Dummy Test Password"))
+		enforcer := NewDefaultDatapathEnforcer("SomeServerId", c, nil, secret, constants.LocalContainer).(*datapathEnforcer)
+		enforcer.Enforce("SomeProcessingUnitId1", intraHostPUInfo("SomeProcessingUnitId1", "164.67.228.152", &policy.TagSelector{Action: policy.Accept}))
+
+		So(enforcer.SetInteropPolicies([]*InteropPolicy{{Network: "10.1.0.0/16", Mode: InteropACL}}), ShouldBeNil)
+		enforcer.SetDowngradeDetection(&DowngradeConfig{Threshold: 2, Blocklist: true})
+
+		// syn returns the syn packet of a new flow of the peer, since the retransmitted
+		// syn packets of the accepted flows are not processed again
+		port := byte(0)
+		syn := func() *packet.Packet {
+			port++
+			buffer := append([]byte{}, TCPFlow[0]...)
+			buffer[21] = port
+			p, err := packet.New(0, buffer, "0")
+			So(err, ShouldBeNil)
+			return p
+		}
+
+		Convey("When a peer that does not run trireme connects", func() {
+
+			So(enforcer.processNetworkTCPPackets(syn()), ShouldBeNil)
+			So(enforcer.processNetworkTCPPackets(syn()), ShouldBeNil)
+
+			Convey("Then no anomaly should be detected", func() {
+				So(c.security, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When a source that sent tokens connects without token", func() {
+
+			enforcer.downgrades.tokenSeen("10.1.10.76", enforcer.clock.Now())
+
+			So(enforcer.processNetworkTCPPackets(syn()), ShouldBeNil)
+			So(c.security, ShouldBeEmpty)
+			So(enforcer.processNetworkTCPPackets(syn()), ShouldBeNil)
+
+			Convey("Then a security event should be emitted at the threshold", func() {
+				So(len(c.security), ShouldEqual, 1)
+				So(c.security[0].Event, ShouldEqual, collector.SecurityHandshakeDowngrade)
+				So(c.security[0].ContextID, ShouldEqual, "SomeProcessingUnitId1")
+				So(c.security[0].SourceIP, ShouldEqual, "10.1.10.76")
+				So(c.security[0].Details, ShouldEqual, "2 handshake anomalies, last one missing token on port 80, source blocked")
+			})
+
+			Convey("Then the next handshakes of the source should be rejected", func() {
+				So(enforcer.processNetworkTCPPackets(syn()), ShouldNotBeNil)
+
+				last := c.flows[len(c.flows)-1]
+				So(last.Action, ShouldEqual, collector.FlowReject)
+				So(last.Mode, ShouldEqual, collector.HandshakeBlocked)
+			})
+		})
+
+		Convey("When the syn packets carry the authentication option without token", func() {
+
+			for i := 0; i < 2; i++ {
+				p := syn()
+				p.Buffer[len(p.Buffer)-TCPAuthenticationOptionBaseLen] = packet.TCPAuthenticationOption
+				enforcer.processNetworkTCPPackets(p)
+			}
+
+			Convey("Then the stripped tokens should be detected", func() {
+				So(len(c.security), ShouldEqual, 1)
+				So(c.security[0].Details, ShouldEqual, "2 handshake anomalies, last one stripped token on port 80, source blocked")
+			})
+		})
+
+		Convey("When the detection is disabled", func() {
+
+			enforcer.SetDowngradeDetection(nil)
+			enforcer.downgrades.tokenSeen("10.1.10.76", enforcer.clock.Now())
+
+			So(enforcer.processNetworkTCPPackets(syn()), ShouldBeNil)
+			So(enforcer.processNetworkTCPPackets(syn()), ShouldBeNil)
+
+			Convey("Then no anomaly should be detected", func() {
+				So(c.security, ShouldBeEmpty)
+			})
+		})
+	})
+
+	Convey("Given a downgrade detector", t, func() {
+
+		g := newDowngradeDetector()
+		g.config = &DowngradeConfig{Threshold: 3, Window: time.Minute, BlocklistDuration: time.Hour}
+		now := time.Now()
+
+		Convey("The anomalies out of the window should not count", func() {
+			count, _ := g.anomaly("10.0.0.1", now)
+			So(count, ShouldEqual, 0)
+			count, _ = g.anomaly("10.0.0.1", now.Add(2*time.Minute))
+			So(count, ShouldEqual, 0)
+			count, _ = g.anomaly("10.0.0.1", now.Add(2*time.Minute+time.Second))
+			So(count, ShouldEqual, 0)
+			count, blocked := g.anomaly("10.0.0.1", now.Add(2*time.Minute+2*time.Second))
+			So(count, ShouldEqual, 3)
+			So(blocked, ShouldBeFalse)
+			So(g.isBlocked("10.0.0.1", now.Add(3*time.Minute)), ShouldBeFalse)
+		})
+
+		Convey("The sources should be unblocked after the blocklist duration", func() {
+			g.config.Blocklist = true
+			g.anomaly("10.0.0.1", now)
+			g.anomaly("10.0.0.1", now)
+			_, blocked := g.anomaly("10.0.0.1", now)
+			So(blocked, ShouldBeTrue)
+			So(g.isBlocked("10.0.0.1", now.Add(time.Minute)), ShouldBeTrue)
+			So(g.isBlocked("10.0.0.1", now.Add(time.Hour)), ShouldBeFalse)
+		})
+
+		Convey("The peers should be forgotten after the window", func() {
+			g.tokenSeen("10.0.0.1", now)
+			So(g.knownPeer("10.0.0.1", now.Add(time.Second)), ShouldBeTrue)
+			So(g.knownPeer("10.0.0.1", now.Add(time.Minute)), ShouldBeFalse)
+		})
+	})
+}
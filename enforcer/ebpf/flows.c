@@ -0,0 +1,106 @@
+/*
+ * flows.c is the eBPF classifier of the eBPF capture of the enforcer. It is loaded
+ * by tc ahead of the redirection of the TCP packets to the raw sockets of the
+ * enforcer. The packets of the flows accepted by the enforcer, which caches them in
+ * the trireme_flows map, are transmitted. The other packets are left to the next
+ * filters. The handshakes are always left to the enforcer since they carry the
+ * tokens.
+ *
+ * Build it with:
+ *
+ *   clang -O2 -target bpf -c flows.c -o flows.o
+ */
+
+#include <linux/bpf.h>
+#include <linux/if_ether.h>
+#include <linux/in.h>
+#include <linux/ip.h>
+#include <linux/pkt_cls.h>
+#include <linux/tcp.h>
+
+#define SEC(name) __attribute__((section(name), used))
+
+/* The maps pinned in the global namespace are shared by all the classifiers */
+#define PIN_GLOBAL_NS 2
+
+/* bpf_elf_map is the definition of a map understood by tc */
+struct bpf_elf_map {
+	__u32 type;
+	__u32 size_key;
+	__u32 size_value;
+	__u32 max_elem;
+	__u32 flags;
+	__u32 id;
+	__u32 pinning;
+};
+
+/* flow_key identifies a flow in both directions, in the network byte order */
+struct flow_key {
+	__be32 client;
+	__be32 server;
+	__be16 client_port;
+	__be16 server_port;
+};
+
+/* trireme_flows are the flows accepted by the enforcer. The least recently used
+ * flows are forgotten when it is full, their packets going through the enforcer
+ * again. */
+struct bpf_elf_map SEC("maps") trireme_flows = {
+	.type = BPF_MAP_TYPE_LRU_HASH,
+	.size_key = sizeof(struct flow_key),
+	.size_value = sizeof(__u8),
+	.max_elem = 65536,
+	.pinning = PIN_GLOBAL_NS,
+};
+
+static void *(*bpf_map_lookup_elem)(void *map, const void *key) = (void *)BPF_FUNC_map_lookup_elem;
+static int (*bpf_map_delete_elem)(void *map, const void *key) = (void *)BPF_FUNC_map_delete_elem;
+
+SEC("classifier")
+int classify(struct __sk_buff *skb)
+{
+	void *data = (void *)(long)skb->data;
+	void *data_end = (void *)(long)skb->data_end;
+	struct ethhdr *eth = data;
+	struct iphdr *ip = data + sizeof(*eth);
+	struct tcphdr *tcp;
+	struct flow_key key = {};
+
+	if ((void *)(ip + 1) > data_end)
+		return TC_ACT_UNSPEC;
+
+	if (eth->h_proto != __constant_htons(ETH_P_IP) || ip->protocol != IPPROTO_TCP)
+		return TC_ACT_UNSPEC;
+
+	tcp = (void *)ip + ip->ihl * 4;
+	if ((void *)(tcp + 1) > data_end)
+		return TC_ACT_UNSPEC;
+
+	if (tcp->syn)
+		return TC_ACT_UNSPEC;
+
+	/* The packets of the client */
+	key.client = ip->saddr;
+	key.server = ip->daddr;
+	key.client_port = tcp->source;
+	key.server_port = tcp->dest;
+
+	if (!bpf_map_lookup_elem(&trireme_flows, &key)) {
+		/* The packets of the server */
+		key.client = ip->daddr;
+		key.server = ip->saddr;
+		key.client_port = tcp->dest;
+		key.server_port = tcp->source;
+
+		if (!bpf_map_lookup_elem(&trireme_flows, &key))
+			return TC_ACT_UNSPEC;
+	}
+
+	/* The flow is forgotten when it is reset */
+	if (tcp->rst)
+		bpf_map_delete_elem(&trireme_flows, &key);
+
+	return TC_ACT_OK;
+}
+
+char _license[] SEC("license") = "GPL";
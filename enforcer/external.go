@@ -0,0 +1,170 @@
+package enforcer
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/enforcer/utils/packet"
+	"github.com/aporeto-inc/trireme/policy"
+)
+
+// ExternalEndpoint is the static identity of an endpoint that does not run trireme,
+// like a database or a legacy VM. Connections without a token from the endpoint
+// network are evaluated against the endpoint claims and reported with its name.
+type ExternalEndpoint struct {
+	Name    string
+	Network string
+	Tags    map[string]string
+}
+
+// externalEndpoint is a registered endpoint with its parsed network
+type externalEndpoint struct {
+	*ExternalEndpoint
+	network *net.IPNet
+}
+
+// externalEndpointDB holds the registered external endpoints indexed by name
+type externalEndpointDB struct {
+	endpoints map[string]*externalEndpoint
+	sync.RWMutex
+}
+
+func newExternalEndpointDB() *externalEndpointDB {
+
+	return &externalEndpointDB{
+		endpoints: map[string]*externalEndpoint{},
+	}
+}
+
+// RegisterExternalEndpoint registers or replaces the identity of an external endpoint
+func (d *datapathEnforcer) RegisterExternalEndpoint(endpoint *ExternalEndpoint) error {
+
+	if endpoint.Name == "" {
+		return fmt.Errorf("External endpoint name is empty")
+	}
+
+	_, network, err := net.ParseCIDR(endpoint.Network)
+	if err != nil {
+		return fmt.Errorf("Invalid network %s for external endpoint %s: %s", endpoint.Network, endpoint.Name, err)
+	}
+
+	d.externalEndpoints.Lock()
+	defer d.externalEndpoints.Unlock()
+
+	d.externalEndpoints.endpoints[endpoint.Name] = &externalEndpoint{
+		ExternalEndpoint: endpoint,
+		network:          network,
+	}
+
+	return nil
+}
+
+// UnregisterExternalEndpoint removes the identity of an external endpoint
+func (d *datapathEnforcer) UnregisterExternalEndpoint(name string) error {
+
+	d.externalEndpoints.Lock()
+	defer d.externalEndpoints.Unlock()
+
+	if _, ok := d.externalEndpoints.endpoints[name]; !ok {
+		return fmt.Errorf("External endpoint %s not found", name)
+	}
+
+	delete(d.externalEndpoints.endpoints, name)
+
+	return nil
+}
+
+// ExternalEndpoints returns the registered external endpoints
+func (d *datapathEnforcer) ExternalEndpoints() []*ExternalEndpoint {
+
+	d.externalEndpoints.RLock()
+	defer d.externalEndpoints.RUnlock()
+
+	endpoints := []*ExternalEndpoint{}
+	for _, e := range d.externalEndpoints.endpoints {
+		endpoints = append(endpoints, e.ExternalEndpoint)
+	}
+
+	return endpoints
+}
+
+// lookup returns the most specific endpoint whose network contains the ip
+func (db *externalEndpointDB) lookup(ip net.IP) (*ExternalEndpoint, bool) {
+
+	db.RLock()
+	defer db.RUnlock()
+
+	var match *externalEndpoint
+	longest := -1
+
+	for _, e := range db.endpoints {
+		if !e.network.Contains(ip) {
+			continue
+		}
+		if ones, _ := e.network.Mask.Size(); ones > longest {
+			match = e
+			longest = ones
+		}
+	}
+
+	if match == nil {
+		return nil, false
+	}
+
+	return match.ExternalEndpoint, true
+}
+
+// claims returns the tags of the endpoint evaluated against the receiver rules
+func (e *ExternalEndpoint) claims() *policy.TagsMap {
+
+	tags := policy.NewTagsMap(e.Tags)
+	tags.Add(IdentityLabelString, e.Name)
+
+	return tags
+}
+
+// processExternalSynPacket processes a SYN packet of a PU to a registered external
+// endpoint. No token is attached since the endpoint cannot validate it. With mutual
+// authorization the transmitter rules of the PU are evaluated against the endpoint
+// claims. It returns false if the destination is not an external endpoint.
+func (d *datapathEnforcer) processExternalSynPacket(context *PUContext, tcpPacket *packet.Packet) (bool, error) {
+
+	endpoint, ok := d.externalEndpoints.lookup(tcpPacket.DestinationAddress)
+	if !ok {
+		return false, nil
+	}
+
+	record := &collector.FlowRecord{
+		ContextID:       context.ID,
+		SourceID:        context.ManagementID,
+		DestinationID:   endpoint.Name,
+		Tags:            context.Annotations,
+		Action:          collector.FlowAccept,
+		Mode:            "NA",
+		SourceIP:        tcpPacket.SourceAddress.String(),
+		DestinationIP:   tcpPacket.DestinationAddress.String(),
+		SourcePort:      tcpPacket.SourcePort,
+		DestinationPort: tcpPacket.DestinationPort,
+	}
+
+	if d.mutualAuthorization {
+		tags := endpoint.claims()
+		rejected, _ := context.rejectTxtRules.Search(tags)
+		accepted, _ := context.acceptTxtRules.Search(tags)
+
+		if rejected >= 0 || accepted < 0 {
+			record.Action = collector.FlowReject
+			record.Mode = collector.PolicyDrop
+			d.collector.CollectFlowEvent(record)
+
+			return true, fmt.Errorf("Connection to external endpoint %s rejected because of policy", endpoint.Name)
+		}
+	}
+
+	d.collector.CollectFlowEvent(record)
+	d.acceptFlow(InteropFlow, context, tcpPacket)
+
+	return true, nil
+}
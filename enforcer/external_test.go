@@ -0,0 +1,109 @@
+package enforcer
+
+import (
+	"testing"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/enforcer/utils/packet"
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+	"github.com/aporeto-inc/trireme/policy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestExternalEndpoints(t *testing.T) {
+
+	Convey("Given I create an enforcer", t, func() {
+
+		secret := tokens.NewPSKSecrets([]byte("Dummy Test Password"))
+		enforcer := NewDefaultDatapathEnforcer("SomeServerId", &collector.DefaultCollector{}, nil, secret, constants.LocalContainer).(*datapathEnforcer)
+
+		dbSelector := &policy.TagSelector{
+			Clause: []policy.KeyValueOperator{
+				{
+					Key:      "role",
+					Value:    []string{"db"},
+					Operator: policy.Equal,
+				},
+			},
+			Action: policy.Accept,
+		}
+
+		Convey("When I register an endpoint with an invalid network", func() {
+
+			err := enforcer.RegisterExternalEndpoint(&ExternalEndpoint{Name: "db", Network: "10.1.10.76"})
+
+			Convey("Then I should get an error", func() {
+				So(err, ShouldNotBeNil)
+				So(len(enforcer.ExternalEndpoints()), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When I register an endpoint without name", func() {
+
+			err := enforcer.RegisterExternalEndpoint(&ExternalEndpoint{Network: "10.1.10.76/32"})
+
+			Convey("Then I should get an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When I register overlapping endpoints", func() {
+
+			So(enforcer.RegisterExternalEndpoint(&ExternalEndpoint{Name: "legacy", Network: "10.0.0.0/8", Tags: map[string]string{"role": "vm"}}), ShouldBeNil)
+			So(enforcer.RegisterExternalEndpoint(&ExternalEndpoint{Name: "legacy-db", Network: "10.1.10.0/24", Tags: map[string]string{"role": "db"}}), ShouldBeNil)
+
+			Convey("Then the most specific endpoint should be used", func() {
+
+				So(len(enforcer.ExternalEndpoints()), ShouldEqual, 2)
+
+				tcpPacket, err := packet.New(0, append([]byte{}, TCPFlow[0]...), "0")
+				So(err, ShouldBeNil)
+
+				endpoint, ok := enforcer.externalEndpoints.lookup(tcpPacket.SourceAddress)
+				So(ok, ShouldBeTrue)
+				So(endpoint.Name, ShouldEqual, "legacy-db")
+			})
+
+			Convey("Then a syn packet without token from the endpoint should be evaluated against its claims", func() {
+
+				enforcer.Enforce("SomeProcessingUnitId1", intraHostPUInfo("SomeProcessingUnitId1", "164.67.228.152", dbSelector))
+
+				tcpPacket, err := packet.New(0, append([]byte{}, TCPFlow[0]...), "0")
+				So(err, ShouldBeNil)
+				So(enforcer.processNetworkTCPPackets(tcpPacket), ShouldBeNil)
+			})
+
+			Convey("Then the syn packet should be dropped when I unregister the endpoint", func() {
+
+				enforcer.Enforce("SomeProcessingUnitId1", intraHostPUInfo("SomeProcessingUnitId1", "164.67.228.152", dbSelector))
+
+				So(enforcer.UnregisterExternalEndpoint("legacy-db"), ShouldBeNil)
+				So(enforcer.UnregisterExternalEndpoint("legacy-db"), ShouldNotBeNil)
+
+				tcpPacket, err := packet.New(0, append([]byte{}, TCPFlow[0]...), "0")
+				So(err, ShouldBeNil)
+				So(enforcer.processNetworkTCPPackets(tcpPacket), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When a processing unit connects to an external endpoint", func() {
+
+			enforcer.Enforce("SomeProcessingUnitId2", intraHostPUInfo("SomeProcessingUnitId2", "10.1.10.76", dbSelector))
+			So(enforcer.RegisterExternalEndpoint(&ExternalEndpoint{Name: "web", Network: "164.67.228.0/24"}), ShouldBeNil)
+
+			Convey("Then the syn packet and the response should go through untouched", func() {
+
+				syn, err := packet.New(0, append([]byte{}, TCPFlow[0]...), "0")
+				So(err, ShouldBeNil)
+				length := syn.IPTotalLength
+				So(enforcer.processApplicationTCPPackets(syn), ShouldBeNil)
+				So(syn.IPTotalLength, ShouldEqual, length)
+
+				synack, err := packet.New(0, append([]byte{}, TCPFlow[1]...), "0")
+				So(err, ShouldBeNil)
+				So(enforcer.processNetworkTCPPackets(synack), ShouldBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,22 @@
+package enforcer
+
+import (
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+)
+
+// federatedClaims restricts the tags of the claims of a peer of a federated
+// deployment to the ones its federation honors. The claims of the local peers are
+// not modified.
+func (d *datapathEnforcer) federatedClaims(claims *tokens.ConnectionClaims, cert interface{}) {
+
+	if d.federation == nil {
+		return
+	}
+
+	f, ok := d.federation.PeerFederation(cert)
+	if !ok {
+		return
+	}
+
+	claims.T = f.HonoredTags(claims.T, TransmitterLabel)
+}
@@ -0,0 +1,318 @@
+package enforcer
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aporeto-inc/trireme/cache"
+	"github.com/aporeto-inc/trireme/enforcer/utils/packet"
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+	"github.com/aporeto-inc/trireme/policy"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// acceptedFlowLifetime is the time an accepted flow is remembered after its last SYN
+const acceptedFlowLifetime = time.Second * 60
+
+// FlowKind identifies how an accepted flow was authorized
+type FlowKind string
+
+const (
+	// IntraHostFlow is a flow between two PUs of the host authorized without tokens
+	IntraHostFlow FlowKind = "intrahost"
+
+	// InteropFlow is a flow of a peer that does not exchange tokens
+	InteropFlow FlowKind = "interop"
+
+	// TokenFlow is a flow authorized with a token exchange
+	TokenFlow FlowKind = "token"
+)
+
+// FlowState is the state of an accepted flow. It is exported before an enforcer
+// restarts and imported by the new enforcer so that the flow is not challenged again.
+type FlowState struct {
+	Kind            FlowKind
+	ContextID       string
+	SourceIP        string
+	DestinationIP   string
+	SourcePort      uint16
+	DestinationPort uint16
+	Protocol        uint8
+	Expiry          time.Time
+	// Revision is the revision of the policy of the PU that accepted the flow
+	Revision string
+	// Connection is the state of the token exchange of a TokenFlow
+	Connection *ConnectionState
+}
+
+// ConnectionTracker identifies the tracker of a connection being authorized
+type ConnectionTracker string
+
+const (
+	// ApplicationTracker tracks the connections initiated by the PUs
+	ApplicationTracker ConnectionTracker = "application"
+
+	// NetworkTracker tracks the connections received by the PUs
+	NetworkTracker ConnectionTracker = "network"
+)
+
+// ConnectionState is the state of a connection whose token exchange is in progress
+type ConnectionState struct {
+	Tracker         ConnectionTracker
+	State           TCPFlowState
+	LocalContext    []byte
+	RemoteContext   []byte
+	RemoteContextID string
+	RemoteIdentity  *policy.TagsMap
+	// RemoteCertificate is the DER encoding of the certificate of the peer, if any,
+	// that verifies its ack token
+	RemoteCertificate []byte
+	RemoteIP          string
+	RemotePort        string
+	TokenFormat       tokens.TokenFormat
+	Started           time.Time
+}
+
+// hash returns the key of the flow in the flow caches
+func (f *FlowState) hash() string {
+
+	return f.SourceIP + ":" + f.DestinationIP + ":" + strconv.Itoa(int(f.SourcePort)) + ":" + strconv.Itoa(int(f.DestinationPort))
+}
+
+// policyRevision returns a fingerprint of the parts of a policy used by the datapath
+func policyRevision(p *policy.PUPolicy) string {
+
+	data, err := json.Marshal(struct {
+		ManagementID     string
+		Identity         *policy.TagsMap
+		ReceiverRules    *policy.TagSelectorList
+		TransmitterRules *policy.TagSelectorList
+	}{
+		ManagementID:     p.ManagementID,
+		Identity:         p.Identity(),
+		ReceiverRules:    p.ReceiverRules(),
+		TransmitterRules: p.TransmitterRules(),
+	})
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// acceptFlow remembers a flow accepted for a PU
+func (d *datapathEnforcer) acceptFlow(kind FlowKind, context *PUContext, tcpPacket *packet.Packet) {
+
+	flow := d.newFlowState(kind, context, tcpPacket)
+
+	d.flowCache(kind).AddOrUpdate(flow.hash(), flow)
+}
+
+// newFlowState returns the state of the flow of a packet for a PU
+func (d *datapathEnforcer) newFlowState(kind FlowKind, context *PUContext, tcpPacket *packet.Packet) *FlowState {
+
+	return &FlowState{
+		Kind:            kind,
+		ContextID:       context.ID,
+		SourceIP:        tcpPacket.SourceAddress.String(),
+		DestinationIP:   tcpPacket.DestinationAddress.String(),
+		SourcePort:      tcpPacket.SourcePort,
+		DestinationPort: tcpPacket.DestinationPort,
+		Protocol:        tcpPacket.IPProto,
+		Expiry:          d.clock.Now().Add(acceptedFlowLifetime),
+		Revision:        context.revision,
+	}
+}
+
+// flowCache returns the cache of the accepted flows of a kind
+func (d *datapathEnforcer) flowCache(kind FlowKind) cache.DataStore {
+
+	if kind == IntraHostFlow {
+		return d.intraHostFlows
+	}
+
+	return d.interopFlows
+}
+
+// ExportFlows returns the state of the accepted flows and of the connections whose
+// token exchange is in progress
+func (d *datapathEnforcer) ExportFlows() []*FlowState {
+
+	flows := []*FlowState{}
+
+	for _, kind := range []FlowKind{IntraHostFlow, InteropFlow} {
+		c := d.flowCache(kind)
+		for _, hash := range c.KeyList() {
+			if flow, err := c.Get(hash); err == nil {
+				flows = append(flows, flow.(*FlowState))
+			}
+		}
+	}
+
+	flows = append(flows, exportConnections(ApplicationTracker, d.appConnectionTracker)...)
+	flows = append(flows, exportConnections(NetworkTracker, d.networkConnectionTracker)...)
+
+	return flows
+}
+
+// exportConnections returns the flows of the connections of a tracker
+func exportConnections(tracker ConnectionTracker, connections cache.DataStore) []*FlowState {
+
+	flows := []*FlowState{}
+
+	for _, hash := range connections.KeyList() {
+		entry, err := connections.Get(hash)
+		if err != nil {
+			continue
+		}
+
+		connection := entry.(*TCPConnection)
+		if connection.flow == nil {
+			continue
+		}
+
+		flow := *connection.flow
+		flow.Connection = &ConnectionState{
+			Tracker:         tracker,
+			State:           connection.State,
+			LocalContext:    connection.Auth.LocalContext,
+			RemoteContext:   connection.Auth.RemoteContext,
+			RemoteContextID: connection.Auth.RemoteContextID,
+			RemoteIdentity:  connection.Auth.RemoteIdentity,
+			RemoteIP:        connection.Auth.RemoteIP,
+			RemotePort:      connection.Auth.RemotePort,
+			TokenFormat:     connection.Auth.TokenFormat,
+			Started:         connection.Started,
+		}
+
+		if cert, ok := connection.Auth.RemotePublicKey.(*x509.Certificate); ok {
+			flow.Connection.RemoteCertificate = cert.Raw
+		}
+
+		flows = append(flows, &flow)
+	}
+
+	return flows
+}
+
+// importConnection restores a connection in its tracker and the port cache used to
+// find its PU
+func (d *datapathEnforcer) importConnection(flow *FlowState, context *PUContext) error {
+
+	state := flow.Connection
+
+	connection := &TCPConnection{
+		State: state.State,
+		Auth: AuthInfo{
+			LocalContext:    state.LocalContext,
+			RemoteContext:   state.RemoteContext,
+			RemoteContextID: state.RemoteContextID,
+			RemoteIdentity:  state.RemoteIdentity,
+			RemoteIP:        state.RemoteIP,
+			RemotePort:      state.RemotePort,
+			TokenFormat:     state.TokenFormat,
+		},
+		Started: state.Started,
+	}
+
+	tracked := *flow
+	tracked.Connection = nil
+	connection.flow = &tracked
+
+	if len(state.RemoteCertificate) > 0 {
+		cert, err := x509.ParseCertificate(state.RemoteCertificate)
+		if err != nil {
+			return err
+		}
+		connection.Auth.RemotePublicKey = cert
+	}
+
+	switch state.Tracker {
+	case ApplicationTracker:
+		d.appConnectionTracker.AddOrUpdate(flow.hash(), connection)
+		d.contextConnectionTracker.AddOrUpdate(string(connection.Auth.LocalContext), connection)
+		d.sourcePortCache.AddOrUpdate(flow.SourceIP+":"+strconv.Itoa(int(flow.SourcePort)), context)
+	case NetworkTracker:
+		d.networkConnectionTracker.AddOrUpdate(flow.hash(), connection)
+		d.destinationPortCache.AddOrUpdate(flow.DestinationIP+":"+strconv.Itoa(int(flow.DestinationPort))+":"+strconv.Itoa(int(flow.SourcePort)), context)
+	default:
+		return fmt.Errorf("Unknown connection tracker %s", state.Tracker)
+	}
+
+	return nil
+}
+
+// ImportFlows restores the state of flows accepted by a previous enforcer. Flows that
+// expired, belong to unknown PUs or were accepted under a different policy are ignored.
+// It returns the number of flows restored.
+func (d *datapathEnforcer) ImportFlows(flows []*FlowState) int {
+
+	restored := 0
+	now := d.clock.Now()
+
+	for _, flow := range flows {
+
+		if flow.Expiry.Before(now) {
+			continue
+		}
+
+		context := d.revisionContext(flow.ContextID, flow.Revision)
+		if context == nil {
+			continue
+		}
+
+		switch flow.Kind {
+		case IntraHostFlow, InteropFlow:
+			d.flowCache(flow.Kind).AddOrUpdate(flow.hash(), flow)
+		case TokenFlow:
+			if flow.Connection == nil {
+				continue
+			}
+			if err := d.importConnection(flow, context); err != nil {
+				log.WithFields(log.Fields{
+					"package":   "enforcer",
+					"contextID": flow.ContextID,
+					"error":     err.Error(),
+				}).Warn("Ignoring invalid connection state")
+				continue
+			}
+		default:
+			continue
+		}
+
+		restored++
+	}
+
+	log.WithFields(log.Fields{
+		"package":  "enforcer",
+		"flows":    len(flows),
+		"restored": restored,
+	}).Info("Imported flow state")
+
+	return restored
+}
+
+// revisionContext returns the context of a PU that enforces the given policy revision,
+// or nil if there is none
+func (d *datapathEnforcer) revisionContext(contextID string, revision string) *PUContext {
+
+	hashSlice, err := d.contextTracker.Get(contextID)
+	if err != nil {
+		return nil
+	}
+
+	for _, hash := range hashSlice.([]*DualHash) {
+		if context, err := d.puTracker.Get(hash.app); err == nil && context.(*PUContext).revision == revision {
+			return context.(*PUContext)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,156 @@
+package enforcer
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/enforcer/utils/packet"
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+	"github.com/aporeto-inc/trireme/policy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFlowState(t *testing.T) {
+
+	Convey("Given I create an enforcer that accepted a connection of a non-trireme peer", t, func() {
+
+		acceptAll := &policy.TagSelector{
+			Clause: []policy.KeyValueOperator{
+				{
+					Key:      PortNumberLabelString,
+					Value:    []string{"80"},
+					Operator: policy.Equal,
+				},
+			},
+			Action: policy.Accept,
+		}
+
+		secret := tokens.NewPSKSecrets([]byte("Dummy Test Password"))
+		newEnforcer := func() *datapathEnforcer {
+			return NewDefaultDatapathEnforcer("SomeServerId", &collector.DefaultCollector{}, nil, secret, constants.LocalContainer).(*datapathEnforcer)
+		}
+
+		enforcer := newEnforcer()
+		enforcer.Enforce("SomeProcessingUnitId1", intraHostPUInfo("SomeProcessingUnitId1", "164.67.228.152", acceptAll))
+		So(enforcer.SetInteropPolicies([]*InteropPolicy{{Network: "10.1.0.0/16", Mode: InteropACL}}), ShouldBeNil)
+
+		syn, err := packet.New(0, append([]byte{}, TCPFlow[0]...), "0")
+		So(err, ShouldBeNil)
+		So(enforcer.processNetworkTCPPackets(syn), ShouldBeNil)
+
+		Convey("When I export the flows", func() {
+
+			flows := enforcer.ExportFlows()
+
+			Convey("Then I should get the accepted flow", func() {
+				So(len(flows), ShouldEqual, 1)
+				So(flows[0].Kind, ShouldEqual, InteropFlow)
+				So(flows[0].ContextID, ShouldEqual, "SomeProcessingUnitId1")
+				So(flows[0].SourceIP, ShouldEqual, syn.SourceAddress.String())
+				So(flows[0].DestinationPort, ShouldEqual, syn.DestinationPort)
+				So(flows[0].Revision, ShouldNotBeEmpty)
+			})
+
+			Convey("When a new enforcer with the same policy imports them", func() {
+
+				restarted := newEnforcer()
+				restarted.Enforce("SomeProcessingUnitId1", intraHostPUInfo("SomeProcessingUnitId1", "164.67.228.152", acceptAll))
+
+				Convey("Then the flow should be restored", func() {
+					So(restarted.ImportFlows(flows), ShouldEqual, 1)
+					So(restarted.isInteropFlow(syn), ShouldBeTrue)
+				})
+			})
+
+			Convey("When a new enforcer with a different policy imports them", func() {
+
+				restarted := newEnforcer()
+				restarted.Enforce("SomeProcessingUnitId1", intraHostPUInfo("SomeProcessingUnitId1", "164.67.228.152", &policy.TagSelector{Action: policy.Accept}))
+
+				Convey("Then the flow should not be restored", func() {
+					So(restarted.ImportFlows(flows), ShouldEqual, 0)
+					So(restarted.isInteropFlow(syn), ShouldBeFalse)
+				})
+			})
+
+			Convey("When a new enforcer imports them after they expired", func() {
+
+				restarted := newEnforcer()
+				restarted.Enforce("SomeProcessingUnitId1", intraHostPUInfo("SomeProcessingUnitId1", "164.67.228.152", acceptAll))
+				flows[0].Expiry = time.Now().Add(-time.Second)
+
+				Convey("Then the flow should not be restored", func() {
+					So(restarted.ImportFlows(flows), ShouldEqual, 0)
+				})
+			})
+		})
+	})
+	Convey("Given I create an enforcer that sent the SYN of a connection of a PU", t, func() {
+
+		secret := tokens.NewPSKSecrets([]byte("Dummy Test Password"))
+		newEnforcer := func() *datapathEnforcer {
+			enforcer := NewDefaultDatapathEnforcer("SomeServerId", &collector.DefaultCollector{}, nil, secret, constants.LocalContainer).(*datapathEnforcer)
+			enforcer.Enforce("SomeProcessingUnitId2", intraHostPUInfo("SomeProcessingUnitId2", "10.1.10.76", &policy.TagSelector{Action: policy.Accept}))
+			return enforcer
+		}
+
+		enforcer := newEnforcer()
+
+		syn, err := packet.New(0, append([]byte{}, TCPFlow[0]...), "0")
+		So(err, ShouldBeNil)
+		So(enforcer.processApplicationTCPPackets(syn), ShouldBeNil)
+
+		Convey("When I export the flows", func() {
+
+			flows := enforcer.ExportFlows()
+
+			Convey("Then I should get the connection being authorized", func() {
+				So(len(flows), ShouldEqual, 1)
+				So(flows[0].Kind, ShouldEqual, TokenFlow)
+				So(flows[0].ContextID, ShouldEqual, "SomeProcessingUnitId2")
+				So(flows[0].Connection, ShouldNotBeNil)
+				So(flows[0].Connection.Tracker, ShouldEqual, ApplicationTracker)
+				So(flows[0].Connection.State, ShouldEqual, TCPSynSend)
+				So(flows[0].Connection.LocalContext, ShouldNotBeEmpty)
+			})
+
+			Convey("When a new enforcer with the same policy imports them", func() {
+
+				restarted := newEnforcer()
+
+				Convey("Then the connection should be restored in the trackers", func() {
+					So(restarted.ImportFlows(flows), ShouldEqual, 1)
+
+					connection, err := restarted.appConnectionTracker.Get(syn.L4FlowHash())
+					So(err, ShouldBeNil)
+					So(connection.(*TCPConnection).State, ShouldEqual, TCPSynSend)
+
+					byContext, err := restarted.contextConnectionTracker.Get(string(flows[0].Connection.LocalContext))
+					So(err, ShouldBeNil)
+					So(byContext, ShouldEqual, connection)
+
+					_, err = restarted.sourcePortCache.Get(syn.SourceAddress.String() + ":" + strconv.Itoa(int(syn.SourcePort)))
+					So(err, ShouldBeNil)
+				})
+
+				Convey("Then the connection should be exported again", func() {
+					So(restarted.ImportFlows(flows), ShouldEqual, 1)
+					So(len(restarted.ExportFlows()), ShouldEqual, 1)
+				})
+			})
+
+			Convey("When a new enforcer imports a connection of an unknown tracker", func() {
+
+				restarted := newEnforcer()
+				flows[0].Connection.Tracker = "unknown"
+
+				Convey("Then the connection should not be restored", func() {
+					So(restarted.ImportFlows(flows), ShouldEqual, 0)
+				})
+			})
+		})
+	})
+}
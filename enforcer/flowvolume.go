@@ -0,0 +1,150 @@
+package enforcer
+
+import (
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/aporeto-inc/trireme/collector"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// conntrackAcct is the setting of the kernel counting the traffic of the flows in the
+// connection tracking
+const conntrackAcct = "/proc/sys/net/netfilter/nf_conntrack_acct"
+
+// flowCounters is the traffic of a flow in both directions
+type flowCounters struct {
+	bytes        uint64
+	packets      uint64
+	replyBytes   uint64
+	replyPackets uint64
+}
+
+// flowCounter reads the traffic of the flows
+type flowCounter interface {
+
+	// Counters returns the traffic of the flow since it was established
+	Counters(flow *FlowState) (*flowCounters, error)
+}
+
+// flowVolumes reports the traffic of the flows accepted with a token. The datapath
+// only sees the first packets of the flows, so the traffic is read from the
+// connection tracking of the kernel.
+type flowVolumes struct {
+	interval time.Duration
+	counter  flowCounter
+	// last are the counters of the flows at their previous report
+	last map[string]*flowCounters
+	sync.Mutex
+}
+
+func newFlowVolumes() *flowVolumes {
+
+	return &flowVolumes{
+		counter: newConntrackCounter(),
+		last:    map[string]*flowCounters{},
+	}
+}
+
+// SetFlowVolumes reports the traffic of the flows accepted with a token at every
+// interval, or disables the reports if the interval is zero. It must be called before
+// Start.
+func (d *datapathEnforcer) SetFlowVolumes(interval time.Duration) {
+
+	d.volumes.Lock()
+	defer d.volumes.Unlock()
+
+	d.volumes.interval = interval
+}
+
+// startFlowVolumes reports the traffic of the flows periodically, if enabled
+func (d *datapathEnforcer) startFlowVolumes() {
+
+	d.volumes.Lock()
+	interval := d.volumes.interval
+	d.volumes.Unlock()
+
+	if interval <= 0 {
+		return
+	}
+
+	if err := ioutil.WriteFile(conntrackAcct, []byte("1"), 0644); err != nil {
+		log.WithFields(log.Fields{
+			"package": "enforcer",
+			"error":   err.Error(),
+		}).Warn("Unable to enable the accounting of the connection tracking. The traffic of the flows may not be reported")
+	}
+
+	for {
+		d.clock.Sleep(interval)
+		d.reportFlowVolumes()
+	}
+}
+
+// reportFlowVolumes reports the traffic of the flows since their previous report. The
+// flows without traffic are not reported.
+func (d *datapathEnforcer) reportFlowVolumes() {
+
+	d.volumes.Lock()
+	defer d.volumes.Unlock()
+
+	last := map[string]*flowCounters{}
+
+	for hash, pf := range d.activePeerFlows() {
+
+		counters, err := d.volumes.counter.Counters(pf.flow)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"package":   "enforcer",
+				"contextID": pf.context.ID,
+				"error":     err.Error(),
+			}).Debug("Unable to read the traffic of the flow")
+			continue
+		}
+
+		last[hash] = counters
+
+		delta := counters.since(d.volumes.last[hash])
+		if delta.packets == 0 && delta.replyPackets == 0 {
+			continue
+		}
+
+		d.collector.CollectFlowEvent(&collector.FlowRecord{
+			ContextID:       pf.context.ID,
+			Count:           1,
+			SourceID:        pf.peer,
+			DestinationID:   pf.context.ManagementID,
+			Tags:            pf.context.Annotations,
+			Action:          collector.FlowAccept,
+			Mode:            collector.FlowVolume,
+			SourceIP:        pf.flow.SourceIP,
+			DestinationIP:   pf.flow.DestinationIP,
+			DestinationPort: pf.flow.DestinationPort,
+			PeerIdentity:    pf.tags,
+			Bytes:           delta.bytes,
+			Packets:         delta.packets,
+			ReplyBytes:      delta.replyBytes,
+			ReplyPackets:    delta.replyPackets,
+		})
+	}
+
+	d.volumes.last = last
+}
+
+// since returns the traffic since the previous counters of the flow, or all the
+// traffic if there are none or if the flow was established again since
+func (c *flowCounters) since(previous *flowCounters) *flowCounters {
+
+	if previous == nil || c.packets < previous.packets || c.replyPackets < previous.replyPackets {
+		return c
+	}
+
+	return &flowCounters{
+		bytes:        c.bytes - previous.bytes,
+		packets:      c.packets - previous.packets,
+		replyBytes:   c.replyBytes - previous.replyBytes,
+		replyPackets: c.replyPackets - previous.replyPackets,
+	}
+}
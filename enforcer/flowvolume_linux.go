@@ -0,0 +1,232 @@
+// +build linux
+
+package enforcer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"syscall"
+)
+
+const (
+	// netlinkNetfilter is the netlink family of the netfilter subsystems
+	netlinkNetfilter = 12
+	// ctnetlinkSubsystem is the netfilter subsystem of the connection tracking
+	ctnetlinkSubsystem = 1
+	// ctnetlinkGet is the message getting a flow
+	ctnetlinkGet = 1
+
+	// Attributes of a flow
+	ctaTupleOrig     = 1
+	ctaCountersOrig  = 9
+	ctaCountersReply = 10
+
+	// Attributes of a tuple
+	ctaTupleIP    = 1
+	ctaTupleProto = 2
+
+	// Attributes of the addresses of a tuple
+	ctaIPv4Src = 1
+	ctaIPv4Dst = 2
+	ctaIPv6Src = 3
+	ctaIPv6Dst = 4
+
+	// Attributes of the protocol of a tuple
+	ctaProtoNum     = 1
+	ctaProtoSrcPort = 2
+	ctaProtoDstPort = 3
+
+	// Attributes of the counters of a direction
+	ctaCountersPackets = 1
+	ctaCountersBytes   = 2
+
+	// nlaFNested flags the nested attributes
+	nlaFNested = 0x8000
+	// nlaHeaderLen is the length of the header of an attribute
+	nlaHeaderLen = 4
+	// nfgenmsgLen is the length of the header of the netfilter messages
+	nfgenmsgLen = 4
+)
+
+// conntrackCounter reads the counters of the flows in the connection tracking of the
+// network namespace of the enforcer, with the netlink messages of the connection
+// tracking subsystem. The kernel only counts the traffic of the flows if its
+// accounting is enabled.
+type conntrackCounter struct {
+	seq uint32
+	sync.Mutex
+}
+
+// newConntrackCounter returns the counter of the connection tracking of the kernel
+func newConntrackCounter() flowCounter {
+
+	return &conntrackCounter{}
+}
+
+// Counters implements the flowCounter interface
+func (c *conntrackCounter) Counters(flow *FlowState) (*flowCounters, error) {
+
+	source := net.ParseIP(flow.SourceIP)
+	destination := net.ParseIP(flow.DestinationIP)
+	if source == nil || destination == nil {
+		return nil, fmt.Errorf("Invalid addresses %s and %s", flow.SourceIP, flow.DestinationIP)
+	}
+
+	family := uint8(syscall.AF_INET6)
+	var addresses []byte
+	if source4, destination4 := source.To4(), destination.To4(); source4 != nil && destination4 != nil {
+		family = syscall.AF_INET
+		addresses = append(ctnetlinkAttribute(ctaIPv4Src, source4), ctnetlinkAttribute(ctaIPv4Dst, destination4)...)
+	} else {
+		addresses = append(ctnetlinkAttribute(ctaIPv6Src, source.To16()), ctnetlinkAttribute(ctaIPv6Dst, destination.To16())...)
+	}
+
+	protocol := flow.Protocol
+	if protocol == 0 {
+		protocol = syscall.IPPROTO_TCP
+	}
+
+	ports := make([]byte, 4)
+	binary.BigEndian.PutUint16(ports[0:2], flow.SourcePort)
+	binary.BigEndian.PutUint16(ports[2:4], flow.DestinationPort)
+
+	proto := ctnetlinkAttribute(ctaProtoNum, []byte{protocol})
+	proto = append(proto, ctnetlinkAttribute(ctaProtoSrcPort, ports[0:2])...)
+	proto = append(proto, ctnetlinkAttribute(ctaProtoDstPort, ports[2:4])...)
+
+	tuple := append(ctnetlinkAttribute(ctaTupleIP|nlaFNested, addresses), ctnetlinkAttribute(ctaTupleProto|nlaFNested, proto)...)
+
+	answer, err := c.request(family, ctnetlinkAttribute(ctaTupleOrig|nlaFNested, tuple))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get the flow: %s", err)
+	}
+
+	return parseCtnetlinkCounters(answer)
+}
+
+// request sends a get request on a new socket and returns the flow of the answer
+func (c *conntrackCounter) request(family uint8, attributes []byte) ([]byte, error) {
+
+	c.Lock()
+	c.seq++
+	seq := c.seq
+	c.Unlock()
+
+	request := make([]byte, syscall.NLMSG_HDRLEN+nfgenmsgLen, syscall.NLMSG_HDRLEN+nfgenmsgLen+len(attributes))
+	request = append(request, attributes...)
+
+	binary.LittleEndian.PutUint32(request[0:4], uint32(len(request)))
+	binary.LittleEndian.PutUint16(request[4:6], ctnetlinkSubsystem<<8|ctnetlinkGet)
+	binary.LittleEndian.PutUint16(request[6:8], syscall.NLM_F_REQUEST)
+	binary.LittleEndian.PutUint32(request[8:12], seq)
+	request[syscall.NLMSG_HDRLEN] = family
+
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, netlinkNetfilter)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot open netlink socket: %s", err)
+	}
+	defer syscall.Close(fd)
+
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return nil, fmt.Errorf("Cannot bind netlink socket: %s", err)
+	}
+
+	if err := syscall.Sendto(fd, request, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return nil, fmt.Errorf("Cannot send the request: %s", err)
+	}
+
+	buffer := make([]byte, syscall.Getpagesize())
+
+	for {
+		n, _, err := syscall.Recvfrom(fd, buffer, 0)
+		if err != nil {
+			if err == syscall.EINTR {
+				continue
+			}
+			return nil, err
+		}
+
+		messages, err := syscall.ParseNetlinkMessage(buffer[:n])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, m := range messages {
+			if m.Header.Seq != seq {
+				continue
+			}
+			if m.Header.Type == syscall.NLMSG_ERROR {
+				if len(m.Data) < 4 {
+					return nil, fmt.Errorf("Invalid netlink error")
+				}
+				return nil, syscall.Errno(-int32(binary.LittleEndian.Uint32(m.Data[0:4])))
+			}
+			return m.Data, nil
+		}
+	}
+}
+
+// ctnetlinkAttribute returns the attribute padded to 4 bytes
+func ctnetlinkAttribute(attrType uint16, value []byte) []byte {
+
+	length := nlaHeaderLen + len(value)
+	attribute := make([]byte, (length+3)&^3)
+
+	binary.LittleEndian.PutUint16(attribute[0:2], uint16(length))
+	binary.LittleEndian.PutUint16(attribute[2:4], attrType)
+	copy(attribute[nlaHeaderLen:], value)
+
+	return attribute
+}
+
+// parseCtnetlinkAttributes returns the values of the attributes by type
+func parseCtnetlinkAttributes(data []byte) map[uint16][]byte {
+
+	attributes := map[uint16][]byte{}
+
+	for len(data) >= nlaHeaderLen {
+		length := int(binary.LittleEndian.Uint16(data[0:2]))
+		if length < nlaHeaderLen || length > len(data) {
+			break
+		}
+
+		attributes[binary.LittleEndian.Uint16(data[2:4])&^nlaFNested] = data[nlaHeaderLen:length]
+
+		aligned := (length + 3) &^ 3
+		if aligned > len(data) {
+			break
+		}
+		data = data[aligned:]
+	}
+
+	return attributes
+}
+
+// parseCtnetlinkCounters returns the counters of both directions of a flow message
+// of the connection tracking subsystem
+func parseCtnetlinkCounters(data []byte) (*flowCounters, error) {
+
+	if len(data) < nfgenmsgLen {
+		return nil, fmt.Errorf("Invalid flow message")
+	}
+
+	attributes := parseCtnetlinkAttributes(data[nfgenmsgLen:])
+
+	orig := parseCtnetlinkAttributes(attributes[ctaCountersOrig])
+	reply := parseCtnetlinkAttributes(attributes[ctaCountersReply])
+
+	for _, counter := range [][]byte{orig[ctaCountersPackets], orig[ctaCountersBytes], reply[ctaCountersPackets], reply[ctaCountersBytes]} {
+		if len(counter) != 8 {
+			return nil, fmt.Errorf("Flow without counters. The accounting of the connection tracking is disabled")
+		}
+	}
+
+	return &flowCounters{
+		packets:      binary.BigEndian.Uint64(orig[ctaCountersPackets]),
+		bytes:        binary.BigEndian.Uint64(orig[ctaCountersBytes]),
+		replyPackets: binary.BigEndian.Uint64(reply[ctaCountersPackets]),
+		replyBytes:   binary.BigEndian.Uint64(reply[ctaCountersBytes]),
+	}, nil
+}
@@ -0,0 +1,47 @@
+// +build linux
+
+package enforcer
+
+import (
+	"encoding/binary"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// testCountersAttribute returns the counters attribute of a direction of a flow
+func testCountersAttribute(direction uint16, packets, bytes uint64) []byte {
+
+	values := make([]byte, 16)
+	binary.BigEndian.PutUint64(values[0:8], packets)
+	binary.BigEndian.PutUint64(values[8:16], bytes)
+
+	counters := append(ctnetlinkAttribute(ctaCountersPackets, values[0:8]), ctnetlinkAttribute(ctaCountersBytes, values[8:16])...)
+
+	return ctnetlinkAttribute(direction|nlaFNested, counters)
+}
+
+func TestCtnetlinkCounters(t *testing.T) {
+
+	Convey("Given a flow message with its counters", t, func() {
+
+		data := append(make([]byte, nfgenmsgLen), testCountersAttribute(ctaCountersOrig, 10, 1<<33)...)
+		data = append(data, testCountersAttribute(ctaCountersReply, 8, 5000)...)
+
+		Convey("The counters of both directions should be parsed", func() {
+			counters, err := parseCtnetlinkCounters(data)
+			So(err, ShouldBeNil)
+			So(counters, ShouldResemble, &flowCounters{packets: 10, bytes: 1 << 33, replyPackets: 8, replyBytes: 5000})
+		})
+	})
+
+	Convey("Given a flow message without counters", t, func() {
+
+		data := append(make([]byte, nfgenmsgLen), testCountersAttribute(ctaCountersOrig, 10, 1000)...)
+
+		Convey("An error should be returned", func() {
+			_, err := parseCtnetlinkCounters(data)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
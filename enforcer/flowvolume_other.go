@@ -0,0 +1,20 @@
+// +build !linux
+
+package enforcer
+
+import "fmt"
+
+// conntrackCounter is not supported outside of Linux
+type conntrackCounter struct{}
+
+// newConntrackCounter returns the counter of the connection tracking of the kernel
+func newConntrackCounter() flowCounter {
+
+	return &conntrackCounter{}
+}
+
+// Counters implements the flowCounter interface
+func (c *conntrackCounter) Counters(flow *FlowState) (*flowCounters, error) {
+
+	return nil, fmt.Errorf("Connection tracking not supported on this platform")
+}
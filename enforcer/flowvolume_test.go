@@ -0,0 +1,110 @@
+package enforcer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/enforcer/utils/packet"
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+	"github.com/aporeto-inc/trireme/policy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// testCounter returns the counters of its flows by source port
+type testCounter struct {
+	counters map[uint16]*flowCounters
+}
+
+func (c *testCounter) Counters(flow *FlowState) (*flowCounters, error) {
+
+	counters, ok := c.counters[flow.SourcePort]
+	if !ok {
+		return nil, fmt.Errorf("No flow")
+	}
+
+	return counters, nil
+}
+
+func TestFlowVolumes(t *testing.T) {
+
+	Convey("Given I create an enforcer with an established flow of a web peer", t, func() {
+
+		secret := tokens.NewPSKSecrets([]byte("Dummy Test Password"))
+		flows := &flowCollector{}
+		enforcer := NewDefaultDatapathEnforcer("SomeServerId", flows, nil, secret, constants.LocalContainer).(*datapathEnforcer)
+		web := &policy.TagSelector{
+			Clause: []policy.KeyValueOperator{
+				{
+					Key:      "app",
+					Value:    []string{"web"},
+					Operator: policy.Equal,
+				},
+			},
+			Action: policy.Accept,
+		}
+		enforcer.Enforce("SomeProcessingUnitId1", intraHostPUInfo("SomeProcessingUnitId1", "164.67.228.152", web))
+
+		counter := &testCounter{counters: map[uint16]*flowCounters{}}
+		enforcer.volumes.counter = counter
+
+		context, err := enforcer.puTracker.Get("164.67.228.152")
+		So(err, ShouldBeNil)
+
+		syn, err := packet.New(0, append([]byte{}, TCPFlow[0]...), "0")
+		So(err, ShouldBeNil)
+
+		enforcer.trackPeerFlow(context.(*PUContext), syn, "peer", &tokens.ConnectionClaims{
+			T: policy.NewTagsMap(map[string]string{TransmitterLabel: "peer", "app": "web"}),
+		})
+
+		Convey("When the flow has traffic", func() {
+			counter.counters[syn.SourcePort] = &flowCounters{bytes: 1000, packets: 10, replyBytes: 5000, replyPackets: 8}
+			enforcer.reportFlowVolumes()
+
+			Convey("Then its traffic should be reported", func() {
+				So(flows.flows, ShouldHaveLength, 1)
+				record := flows.flows[0]
+				So(record.Mode, ShouldEqual, collector.FlowVolume)
+				So(record.SourceID, ShouldEqual, "peer")
+				So(record.Bytes, ShouldEqual, 1000)
+				So(record.Packets, ShouldEqual, 10)
+				So(record.ReplyBytes, ShouldEqual, 5000)
+				So(record.ReplyPackets, ShouldEqual, 8)
+			})
+
+			Convey("Then only the traffic since the previous report should be reported", func() {
+				counter.counters[syn.SourcePort] = &flowCounters{bytes: 1500, packets: 12, replyBytes: 5000, replyPackets: 8}
+				enforcer.reportFlowVolumes()
+
+				So(flows.flows, ShouldHaveLength, 2)
+				So(flows.flows[1].Bytes, ShouldEqual, 500)
+				So(flows.flows[1].Packets, ShouldEqual, 2)
+				So(flows.flows[1].ReplyBytes, ShouldEqual, 0)
+			})
+
+			Convey("Then a flow without new traffic should not be reported", func() {
+				enforcer.reportFlowVolumes()
+
+				So(flows.flows, ShouldHaveLength, 1)
+			})
+
+			Convey("Then a flow established again should be reported with all its traffic", func() {
+				counter.counters[syn.SourcePort] = &flowCounters{bytes: 100, packets: 2}
+				enforcer.reportFlowVolumes()
+
+				So(flows.flows, ShouldHaveLength, 2)
+				So(flows.flows[1].Bytes, ShouldEqual, 100)
+			})
+		})
+
+		Convey("When the traffic of the flow cannot be read", func() {
+			enforcer.reportFlowVolumes()
+
+			Convey("Then nothing should be reported", func() {
+				So(flows.flows, ShouldBeEmpty)
+			})
+		})
+	})
+}
@@ -1,6 +1,14 @@
 package enforcer
 
-import "github.com/aporeto-inc/trireme/policy"
+import (
+	"net"
+	"time"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+	"github.com/aporeto-inc/trireme/policy"
+	"github.com/aporeto-inc/trireme/utils/clock"
+)
 
 // A PolicyEnforcer is implementing the enforcer that will modify//analyze the capture packets
 type PolicyEnforcer interface {
@@ -28,6 +36,236 @@ type PublicKeyAdder interface {
 	PublicKeyAdd(host string, cert []byte) error
 }
 
+// FederationUpdater applies the federated deployments trusted by the secrets to the
+// remote enforcers
+type FederationUpdater interface {
+
+	// UpdateFederations sends the federations of the secrets to the running remote enforcers.
+	UpdateFederations() error
+}
+
+// SecretsUpdater rotates the keys and the certificate authorities of the secrets
+// without restarting the enforcers
+type SecretsUpdater interface {
+
+	// UpdateSecrets replaces the keys and the authorities by the ones of the secrets.
+	UpdateSecrets(secrets tokens.Secrets) error
+}
+
+// IntraHostConfigurer configures the processing of connections between PUs of the same host
+type IntraHostConfigurer interface {
+
+	// SetIntraHostMode sets how connections between local PUs are authorized.
+	SetIntraHostMode(mode IntraHostMode) error
+}
+
+// InteropConfigurer configures the treatment of peers that do not run trireme
+type InteropConfigurer interface {
+
+	// SetInteropPolicies sets the treatment of non-trireme peers per network.
+	SetInteropPolicies(policies []*InteropPolicy) error
+}
+
+// ExternalEndpointRegistry registers the identity of endpoints that do not run trireme
+type ExternalEndpointRegistry interface {
+
+	// RegisterExternalEndpoint registers or replaces the identity of an external endpoint.
+	RegisterExternalEndpoint(endpoint *ExternalEndpoint) error
+
+	// UnregisterExternalEndpoint removes the identity of an external endpoint.
+	UnregisterExternalEndpoint(name string) error
+
+	// ExternalEndpoints returns the registered external endpoints.
+	ExternalEndpoints() []*ExternalEndpoint
+}
+
+// TokenEngineConfigurer replaces the engine creating and verifying the tokens of the
+// identity handshake
+type TokenEngineConfigurer interface {
+
+	// SetTokenEngine sets the token engine. It must be called before Start, as the
+	// flows authorized by the previous engine cannot be completed.
+	SetTokenEngine(engine tokens.TokenEngine) error
+}
+
+// TagBudgetConfigurer configures the identity tags transmitted in the tokens
+type TagBudgetConfigurer interface {
+
+	// SetTagBudget sets the size budget and priority of the transmitted tags.
+	SetTagBudget(budget *tokens.TagBudget) error
+}
+
+// MTLSConfigurer configures the mutual TLS data-plane mode
+type MTLSConfigurer interface {
+
+	// EnableMTLS starts carrying the connections to the configured networks over mutual TLS.
+	EnableMTLS(config *MTLSConfig) error
+
+	// DisableMTLS stops the mutual TLS data-plane mode.
+	DisableMTLS()
+}
+
+// PeerIdentityUpdater applies the identity updates of the peers to the flows accepted from them
+type PeerIdentityUpdater interface {
+
+	// UpdatePeerIdentity records the new identity of a peer.
+	UpdatePeerIdentity(peer string, revision string, tags *policy.TagsMap)
+
+	// SetRevalidationInterval sets the window in which identity updates are applied.
+	SetRevalidationInterval(interval time.Duration)
+
+	// SetFlowRevoker sets the function called with the flows revoked by identity updates.
+	SetFlowRevoker(revoker FlowRevoker)
+}
+
+// DowngradeConfigurer configures the detection of the downgrades of the identity
+// handshake
+type DowngradeConfigurer interface {
+
+	// SetDowngradeDetection sets the thresholds and the blocklist of the detection,
+	// or disables it if the configuration is nil.
+	SetDowngradeDetection(config *DowngradeConfig)
+}
+
+// KeepaliveConfigurer configures the re-authorization of the established flows
+type KeepaliveConfigurer interface {
+
+	// SetKeepalive sets the interval and the action of the re-authorization.
+	SetKeepalive(config *KeepaliveConfig)
+}
+
+// FlowVolumeConfigurer configures the reports of the traffic of the established flows
+type FlowVolumeConfigurer interface {
+
+	// SetFlowVolumes sets the interval of the reports, or disables them if it is zero.
+	// It must be called before Start.
+	SetFlowVolumes(interval time.Duration)
+}
+
+// LatencyConfigurer configures the reports of the latency of the handshakes
+type LatencyConfigurer interface {
+
+	// SetHandshakeLatencies sets the interval of the reports, or disables them if it
+	// is zero. It must be called before Start.
+	SetHandshakeLatencies(interval time.Duration)
+}
+
+// RuleStatsConfigurer configures the reports of the matches of the identity rules
+type RuleStatsConfigurer interface {
+
+	// SetRuleStats sets the interval of the reports, or disables them if it is zero.
+	// It must be called before Start.
+	SetRuleStats(interval time.Duration)
+}
+
+// ControllerLossConfigurer configures the behavior of the remote enforcers when the
+// controller is lost
+type ControllerLossConfigurer interface {
+
+	// SetControllerLoss sets the timeout and the action applied by the remote enforcers.
+	SetControllerLoss(config *ControllerLossConfig)
+}
+
+// StatsBatchConfigurer configures how the remote enforcers batch the flows they report
+type StatsBatchConfigurer interface {
+
+	// SetStatsBatch sets the interval and the size of the batches.
+	SetStatsBatch(config *StatsBatchConfig)
+}
+
+// FlowAggregationConfigurer configures how the remote enforcers aggregate the flows
+// they report
+type FlowAggregationConfigurer interface {
+
+	// SetFlowAggregation sets the fields of the aggregation key of the flows.
+	SetFlowAggregation(fields []collector.FlowKeyField)
+}
+
+// StatsFlusher flushes the flows aggregated by the remote enforcers, which otherwise
+// report them periodically
+type StatsFlusher interface {
+
+	// FlushStats makes the remote enforcer of the PU report its flows immediately.
+	FlushStats(contextID string) error
+}
+
+// VerdictCache caches the verdicts of the accepted TCP flows in the kernel, so that
+// their packets are accepted without the datapath or the connection tracking
+type VerdictCache interface {
+
+	// CacheVerdict caches the flow from the source to the destination address and port.
+	CacheVerdict(source, destination net.IP, port uint16) error
+
+	// EvictVerdict removes the flow from the cache.
+	EvictVerdict(source, destination net.IP, port uint16) error
+}
+
+// FlowVerdictCache is a VerdictCache caching the flows with their source port, so
+// that the new flows between the same addresses and destination port are still
+// authorized by the datapath
+type FlowVerdictCache interface {
+	VerdictCache
+
+	// CacheFlowVerdict caches the flow from the source address and port to the
+	// destination address and port.
+	CacheFlowVerdict(source, destination net.IP, sourcePort, destinationPort uint16) error
+
+	// EvictFlowVerdict removes the flow from the cache.
+	EvictFlowVerdict(source, destination net.IP, sourcePort, destinationPort uint16) error
+}
+
+// VerdictCacheConfigurer configures the cache of the verdicts of the datapath
+type VerdictCacheConfigurer interface {
+
+	// SetVerdictCache sets the cache of the verdicts. It must be called before Start.
+	SetVerdictCache(cache VerdictCache)
+}
+
+// FlowStateExporter exports and restores the state of the accepted flows
+type FlowStateExporter interface {
+
+	// ExportFlows returns the state of the accepted flows and of the connections
+	// being authorized.
+	ExportFlows() []*FlowState
+
+	// ImportFlows restores the state of flows accepted by a previous enforcer.
+	ImportFlows(flows []*FlowState) int
+}
+
+// RemoteEnforcerReporter is implemented by the enforcers that run the datapath of the
+// PUs in remote enforcer processes
+type RemoteEnforcerReporter interface {
+
+	// RemoteEnforcerStatus returns the PID of the remote enforcer of a PU and whether it is running.
+	RemoteEnforcerStatus(contextID string) (int, bool, error)
+}
+
+// RemoteEnforcerHealthChecker is implemented by the enforcers that can check that the
+// remote enforcers of the PUs still serve their requests
+type RemoteEnforcerHealthChecker interface {
+
+	// HealthCheck returns an error if the remote enforcer of a PU is not running or
+	// does not respond in time.
+	HealthCheck(contextID string) error
+
+	// AbortRemoteEnforcer kills the remote enforcer of a PU without waiting for it to
+	// exit. It is launched again when the policy of the PU is applied.
+	AbortRemoteEnforcer(contextID string) error
+}
+
+// RemoteEnforcerUpdater is implemented by the enforcers that can replace the binary of
+// their remote enforcers without restarting the controller
+type RemoteEnforcerUpdater interface {
+
+	// StageRemoteEnforcer sets the binary of the remote enforcers launched afterwards
+	// and returns the binary staged before. An empty binary stages the binary of the
+	// controller.
+	StageRemoteEnforcer(binary string) (string, error)
+
+	// RemoteEnforcerBinary returns the binary the remote enforcer of a PU runs.
+	RemoteEnforcerBinary(contextID string) (string, error)
+}
+
 // PacketProcessor is an interface implemented to stitch into our enforcer
 type PacketProcessor interface {
 
@@ -43,3 +281,22 @@ type PacketProcessor interface {
 	// PostProcessTCPNetPacket will be called for network packets and return value of false means drop packet
 	PostProcessTCPNetPacket(pkt interface{}, action interface{}) bool
 }
+
+// DatapathConfigurer plugs an alternative packet capture mechanism
+type DatapathConfigurer interface {
+
+	// SetDatapath replaces the netfilter queues by the datapath. It must be called before Start.
+	SetDatapath(dp Datapath)
+}
+
+// ClockConfigurer sets the source of time of the enforcer
+type ClockConfigurer interface {
+
+	// SetClock replaces the clock of the system. It fails once the enforcer started.
+	SetClock(clk clock.Clock) error
+}
+
+// clockSetter is implemented by the token engines whose expiry uses a clock
+type clockSetter interface {
+	SetClock(clk clock.Clock)
+}
@@ -0,0 +1,161 @@
+package enforcer
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/enforcer/utils/packet"
+	"github.com/aporeto-inc/trireme/policy"
+)
+
+// InteropMode defines how connections from peers that do not run trireme are treated.
+// Such peers are detected by the absence of a token in the SYN packet.
+type InteropMode int
+
+const (
+	// InteropReject rejects connections without a token. This is the default.
+	InteropReject InteropMode = iota
+	// InteropACL accepts connections without a token. Only the ACLs of the PU apply.
+	InteropACL
+	// InteropUnknownIdentity evaluates the receiver rules of the PU against the
+	// unknown identity claims and accepts the connection if a rule matches
+	InteropUnknownIdentity
+)
+
+// InteropPolicy associates a network with the treatment of its non-trireme peers
+type InteropPolicy struct {
+	Network string
+	Mode    InteropMode
+}
+
+type interopNetwork struct {
+	network *net.IPNet
+	mode    InteropMode
+}
+
+// interopNetworks sorts networks from the most to the least specific
+type interopNetworks []*interopNetwork
+
+func (n interopNetworks) Len() int      { return len(n) }
+func (n interopNetworks) Swap(i, j int) { n[i], n[j] = n[j], n[i] }
+func (n interopNetworks) Less(i, j int) bool {
+	ones, _ := n[i].network.Mask.Size()
+	others, _ := n[j].network.Mask.Size()
+	return ones > others
+}
+
+// SetInteropPolicies configures the treatment of non-trireme peers per network. When
+// networks overlap the most specific one applies.
+func (d *datapathEnforcer) SetInteropPolicies(policies []*InteropPolicy) error {
+
+	networks := interopNetworks{}
+
+	for _, p := range policies {
+		_, network, err := net.ParseCIDR(p.Network)
+		if err != nil {
+			return fmt.Errorf("Invalid interop network %s: %s", p.Network, err)
+		}
+		networks = append(networks, &interopNetwork{network: network, mode: p.Mode})
+	}
+
+	sort.Stable(networks)
+
+	d.settingsLock.Lock()
+	d.interopNetworks = networks
+	d.settingsLock.Unlock()
+
+	return nil
+}
+
+// interopMode returns the treatment of a non-trireme peer
+func (d *datapathEnforcer) interopMode(ip net.IP) InteropMode {
+
+	d.settingsLock.RLock()
+	defer d.settingsLock.RUnlock()
+
+	for _, n := range d.interopNetworks {
+		if n.network.Contains(ip) {
+			return n.mode
+		}
+	}
+
+	return InteropReject
+}
+
+// processInteropSynPacket processes a SYN packet without a token. Peers registered
+// as external endpoints are evaluated against their claims. Other peers are treated
+// according to the mode of their network. It returns false if the regular processing
+// applies.
+func (d *datapathEnforcer) processInteropSynPacket(context *PUContext, tcpPacket *packet.Packet) (bool, interface{}, error) {
+
+	if len(tcpPacket.ReadTCPData()) != 0 {
+		return false, nil, nil
+	}
+
+	var tags *policy.TagsMap
+	sourceID := UnknownIdentity
+
+	if endpoint, ok := d.externalEndpoints.lookup(tcpPacket.SourceAddress); ok {
+		sourceID = endpoint.Name
+		tags = endpoint.claims()
+	} else {
+		switch d.interopMode(tcpPacket.SourceAddress) {
+		case InteropReject:
+			return false, nil, nil
+		case InteropUnknownIdentity:
+			tags = policy.NewTagsMap(map[string]string{IdentityLabelString: UnknownIdentity})
+		}
+	}
+
+	record := &collector.FlowRecord{
+		ContextID:       context.ID,
+		SourceID:        sourceID,
+		DestinationID:   context.ManagementID,
+		Tags:            context.Annotations,
+		Action:          collector.FlowAccept,
+		Mode:            "NA",
+		SourceIP:        tcpPacket.SourceAddress.String(),
+		DestinationIP:   tcpPacket.DestinationAddress.String(),
+		SourcePort:      tcpPacket.SourcePort,
+		DestinationPort: tcpPacket.DestinationPort,
+	}
+
+	var action interface{}
+
+	if tags != nil {
+		tags.Add(PortNumberLabelString, strconv.Itoa(int(tcpPacket.DestinationPort)))
+
+		rejected, _ := context.rejectRcvRules.Search(tags)
+
+		var accepted int
+		accepted, action = context.acceptRcvRules.Search(tags)
+
+		if rejected >= 0 || accepted < 0 {
+			record.Action = collector.FlowReject
+			record.Mode = collector.PolicyDrop
+			d.collector.CollectFlowEvent(record)
+
+			return true, nil, fmt.Errorf("Connection without token rejected because of policy %+v", tags)
+		}
+	}
+
+	d.collector.CollectFlowEvent(record)
+	d.acceptFlow(InteropFlow, context, tcpPacket)
+
+	return true, action, nil
+}
+
+// isInteropFlow returns true if the packet belongs to an accepted connection of a
+// non-trireme peer
+func (d *datapathEnforcer) isInteropFlow(tcpPacket *packet.Packet) bool {
+
+	if _, err := d.interopFlows.Get(tcpPacket.L4FlowHash()); err == nil {
+		return true
+	}
+
+	_, err := d.interopFlows.Get(tcpPacket.L4ReverseFlowHash())
+	return err == nil
+}
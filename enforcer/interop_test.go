@@ -0,0 +1,111 @@
+package enforcer
+
+import (
+	"testing"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/enforcer/utils/packet"
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+	"github.com/aporeto-inc/trireme/policy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestInteropPeers(t *testing.T) {
+
+	Convey("Given I create an enforcer with a processing unit that accepts unknown peers", t, func() {
+
+		unknownSelector := &policy.TagSelector{
+			Clause: []policy.KeyValueOperator{
+				{
+					Key:      IdentityLabelString,
+					Value:    []string{UnknownIdentity},
+					Operator: policy.Equal,
+				},
+			},
+			Action: policy.Accept,
+		}
+
+		secret := tokens.NewPSKSecrets([]byte("Dummy Test Password"))
+		enforcer := NewDefaultDatapathEnforcer("SomeServerId", &collector.DefaultCollector{}, nil, secret, constants.LocalContainer).(*datapathEnforcer)
+		enforcer.Enforce("SomeProcessingUnitId1", intraHostPUInfo("SomeProcessingUnitId1", "164.67.228.152", unknownSelector))
+
+		syn := func() *packet.Packet {
+			p, err := packet.New(0, append([]byte{}, TCPFlow[0]...), "0")
+			So(err, ShouldBeNil)
+			return p
+		}
+
+		Convey("When no interop network is configured", func() {
+
+			Convey("Then a syn packet without token should be dropped", func() {
+				So(enforcer.processNetworkTCPPackets(syn()), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When I configure an invalid network", func() {
+
+			err := enforcer.SetInteropPolicies([]*InteropPolicy{{Network: "10.1.0.0", Mode: InteropACL}})
+
+			Convey("Then I should get an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the network of the peer is in ACL mode", func() {
+
+			err := enforcer.SetInteropPolicies([]*InteropPolicy{{Network: "10.1.0.0/16", Mode: InteropACL}})
+			So(err, ShouldBeNil)
+
+			Convey("Then the syn packet and the response should go through untouched", func() {
+
+				So(enforcer.processNetworkTCPPackets(syn()), ShouldBeNil)
+
+				synack, err := packet.New(0, append([]byte{}, TCPFlow[1]...), "0")
+				So(err, ShouldBeNil)
+				length := synack.IPTotalLength
+				So(enforcer.processApplicationTCPPackets(synack), ShouldBeNil)
+				So(synack.IPTotalLength, ShouldEqual, length)
+			})
+		})
+
+		Convey("When a more specific network rejects the peer", func() {
+
+			err := enforcer.SetInteropPolicies([]*InteropPolicy{
+				{Network: "10.0.0.0/8", Mode: InteropACL},
+				{Network: "10.1.10.0/24", Mode: InteropReject},
+			})
+			So(err, ShouldBeNil)
+
+			Convey("Then the syn packet should be dropped", func() {
+				So(enforcer.processNetworkTCPPackets(syn()), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the network of the peer is in unknown identity mode", func() {
+
+			err := enforcer.SetInteropPolicies([]*InteropPolicy{{Network: "10.1.10.76/32", Mode: InteropUnknownIdentity}})
+			So(err, ShouldBeNil)
+
+			Convey("Then the syn packet should be accepted by the unknown identity rule", func() {
+				So(enforcer.processNetworkTCPPackets(syn()), ShouldBeNil)
+			})
+
+			Convey("Then the syn packet should be dropped if no rule matches", func() {
+
+				enforcer.Enforce("SomeProcessingUnitId1", intraHostPUInfo("SomeProcessingUnitId1", "164.67.228.152", &policy.TagSelector{
+					Clause: []policy.KeyValueOperator{
+						{
+							Key:      TransmitterLabel,
+							Value:    []string{"value"},
+							Operator: policy.Equal,
+						},
+					},
+					Action: policy.Accept,
+				}))
+
+				So(enforcer.processNetworkTCPPackets(syn()), ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,190 @@
+package enforcer
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/enforcer/utils/packet"
+)
+
+// IntraHostMode defines how connections between two PUs of the same host are authorized
+type IntraHostMode int
+
+const (
+	// IntraHostTokens processes intra-host connections with the full token exchange
+	// as any other connection. This is the default.
+	IntraHostTokens IntraHostMode = iota
+	// IntraHostLocal evaluates the policy of intra-host connections against the
+	// identity of the local PUs without exchanging tokens
+	IntraHostLocal
+	// IntraHostAccept accepts all intra-host connections without evaluating policy
+	IntraHostAccept
+)
+
+// SetIntraHostMode configures how connections between local PUs are authorized
+func (d *datapathEnforcer) SetIntraHostMode(mode IntraHostMode) error {
+
+	hostAddresses := map[string]bool{}
+	if mode != IntraHostTokens && d.mode == constants.LocalServer {
+		hostAddresses = localAddresses()
+	}
+
+	d.settingsLock.Lock()
+	d.intraHostMode = mode
+	d.hostAddresses = hostAddresses
+	d.settingsLock.Unlock()
+
+	return nil
+}
+
+// localAddresses returns the addresses of the interfaces of the host
+func localAddresses() map[string]bool {
+
+	addresses := map[string]bool{}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"package": "enforcer",
+			"error":   err.Error(),
+		}).Warn("Unable to read host addresses. Only loopback will be treated as intra-host")
+		return addresses
+	}
+
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok {
+			addresses[ipnet.IP.String()] = true
+		}
+	}
+
+	return addresses
+}
+
+// intraHostSettings returns the intra-host mode and the addresses of the host. The
+// addresses are replaced and never modified.
+func (d *datapathEnforcer) intraHostSettings() (IntraHostMode, map[string]bool) {
+
+	d.settingsLock.RLock()
+	defer d.settingsLock.RUnlock()
+
+	return d.intraHostMode, d.hostAddresses
+}
+
+// localDestinationContext returns the context of the destination PU of a packet if
+// the destination is a PU of this host
+func (d *datapathEnforcer) localDestinationContext(tcpPacket *packet.Packet) (*PUContext, bool) {
+
+	var key string
+
+	switch d.mode {
+	case constants.LocalContainer:
+		key = tcpPacket.DestinationAddress.String()
+	case constants.LocalServer:
+		_, hostAddresses := d.intraHostSettings()
+		if !tcpPacket.DestinationAddress.IsLoopback() && !hostAddresses[tcpPacket.DestinationAddress.String()] {
+			return nil, false
+		}
+		key = "port:" + strconv.Itoa(int(tcpPacket.DestinationPort))
+	default:
+		return nil, false
+	}
+
+	context, err := d.puTracker.Get(key)
+	if err != nil {
+		return nil, false
+	}
+
+	return context.(*PUContext), true
+}
+
+// processIntraHostSynPacket authorizes a connection between two local PUs without
+// a token exchange. It returns false if the destination is not a local PU and the
+// connection must follow the regular path.
+func (d *datapathEnforcer) processIntraHostSynPacket(source *PUContext, tcpPacket *packet.Packet) (bool, error) {
+
+	mode, _ := d.intraHostSettings()
+	if mode == IntraHostTokens {
+		return false, nil
+	}
+
+	destination, ok := d.localDestinationContext(tcpPacket)
+	if !ok {
+		return false, nil
+	}
+
+	sourceID, _ := source.Identity.Get(TransmitterLabel)
+
+	record := &collector.FlowRecord{
+		ContextID:       destination.ID,
+		SourceID:        sourceID,
+		DestinationID:   destination.ManagementID,
+		Tags:            destination.Annotations,
+		Action:          collector.FlowAccept,
+		Mode:            "NA",
+		SourceIP:        tcpPacket.SourceAddress.String(),
+		DestinationIP:   tcpPacket.DestinationAddress.String(),
+		SourcePort:      tcpPacket.SourcePort,
+		DestinationPort: tcpPacket.DestinationPort,
+	}
+
+	if mode == IntraHostLocal && !d.intraHostAuthorized(source, destination, tcpPacket) {
+		record.Action = collector.FlowReject
+		record.Mode = collector.PolicyDrop
+		d.collector.CollectFlowEvent(record)
+
+		return true, fmt.Errorf("Intra-host connection rejected because of policy %+v", source.Identity)
+	}
+
+	d.collector.CollectFlowEvent(record)
+	d.acceptFlow(IntraHostFlow, destination, tcpPacket)
+
+	return true, nil
+}
+
+// intraHostAuthorized evaluates the receiver rules of the destination against the
+// identity of the source and, with mutual authorization, the transmitter rules of
+// the source against the identity of the destination
+func (d *datapathEnforcer) intraHostAuthorized(source, destination *PUContext, tcpPacket *packet.Packet) bool {
+
+	tags := source.Identity.Clone()
+	tags.Add(PortNumberLabelString, strconv.Itoa(int(tcpPacket.DestinationPort)))
+
+	if index, _ := destination.rejectRcvRules.Search(tags); index >= 0 {
+		return false
+	}
+
+	if index, _ := destination.acceptRcvRules.Search(tags); index < 0 {
+		return false
+	}
+
+	if !d.mutualAuthorization {
+		return true
+	}
+
+	if index, _ := source.rejectTxtRules.Search(destination.Identity); index >= 0 {
+		return false
+	}
+
+	index, _ := source.acceptTxtRules.Search(destination.Identity)
+	return index >= 0
+}
+
+// isIntraHostFlow returns true if the packet belongs to an intra-host connection
+// that was authorized without a token exchange
+func (d *datapathEnforcer) isIntraHostFlow(tcpPacket *packet.Packet) bool {
+
+	if mode, _ := d.intraHostSettings(); mode == IntraHostTokens {
+		return false
+	}
+
+	if _, err := d.intraHostFlows.Get(tcpPacket.L4FlowHash()); err == nil {
+		return true
+	}
+
+	_, err := d.intraHostFlows.Get(tcpPacket.L4ReverseFlowHash())
+	return err == nil
+}
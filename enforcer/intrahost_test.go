@@ -0,0 +1,119 @@
+package enforcer
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/enforcer/utils/packet"
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+	"github.com/aporeto-inc/trireme/policy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func intraHostPUInfo(contextID string, ip string, selector *policy.TagSelector) *policy.PUInfo {
+
+	puInfo := policy.NewPUInfo(contextID, constants.ContainerPU)
+	puInfo.Runtime.SetIPAddresses(policy.NewIPMap(map[string]string{"bridge": ip}))
+	puInfo.Policy.SetIPAddresses(policy.NewIPMap(map[string]string{policy.DefaultNamespace: ip}))
+	puInfo.Policy.AddIdentityTag(TransmitterLabel, contextID)
+	puInfo.Policy.AddReceiverRules(selector)
+
+	return puInfo
+}
+
+func TestIntraHostFlows(t *testing.T) {
+
+	Convey("Given I create an enforcer with two local processing units", t, func() {
+
+		acceptAll := &policy.TagSelector{
+			Clause: []policy.KeyValueOperator{
+				{
+					Key:      PortNumberLabelString,
+					Value:    []string{"80"},
+					Operator: policy.Equal,
+				},
+			},
+			Action: policy.Accept,
+		}
+
+		secret := tokens.NewPSKSecrets([]byte("Dummy Test Password"))
+		enforcer := NewDefaultDatapathEnforcer("SomeServerId", &collector.DefaultCollector{}, nil, secret, constants.LocalContainer).(*datapathEnforcer)
+		enforcer.Enforce("SomeProcessingUnitId2", intraHostPUInfo("SomeProcessingUnitId2", "10.1.10.76", acceptAll))
+
+		Convey("When the destination accepts the source and the intra-host mode is local", func() {
+
+			enforcer.Enforce("SomeProcessingUnitId1", intraHostPUInfo("SomeProcessingUnitId1", "164.67.228.152", acceptAll))
+			So(enforcer.SetIntraHostMode(IntraHostLocal), ShouldBeNil)
+
+			Convey("Then all the packets of the flow should go through unmodified", func() {
+
+				for _, p := range TCPFlow {
+
+					input := make([]byte, len(p))
+					copy(input, p)
+
+					tcpPacket, err := packet.New(0, input, "0")
+					So(err, ShouldBeNil)
+					tcpPacket.UpdateIPChecksum()
+					tcpPacket.UpdateTCPChecksum()
+					original := make([]byte, len(tcpPacket.GetBytes()))
+					copy(original, tcpPacket.GetBytes())
+
+					So(enforcer.processApplicationTCPPackets(tcpPacket), ShouldBeNil)
+					So(enforcer.processNetworkTCPPackets(tcpPacket), ShouldBeNil)
+					So(reflect.DeepEqual(original, tcpPacket.GetBytes()), ShouldBeTrue)
+				}
+			})
+		})
+
+		Convey("When the destination rejects the source and the intra-host mode is local", func() {
+
+			rejectAll := &policy.TagSelector{
+				Clause: []policy.KeyValueOperator{
+					{
+						Key:      TransmitterLabel,
+						Value:    []string{"SomeProcessingUnitId2"},
+						Operator: policy.Equal,
+					},
+				},
+				Action: policy.Reject,
+			}
+
+			enforcer.Enforce("SomeProcessingUnitId1", intraHostPUInfo("SomeProcessingUnitId1", "164.67.228.152", rejectAll))
+			So(enforcer.SetIntraHostMode(IntraHostLocal), ShouldBeNil)
+
+			Convey("Then the syn packet should be dropped", func() {
+
+				tcpPacket, err := packet.New(0, append([]byte{}, TCPFlow[0]...), "0")
+				So(err, ShouldBeNil)
+				So(enforcer.processApplicationTCPPackets(tcpPacket), ShouldNotBeNil)
+			})
+
+			Convey("Then the syn packet should be accepted if the mode is accept", func() {
+
+				So(enforcer.SetIntraHostMode(IntraHostAccept), ShouldBeNil)
+
+				tcpPacket, err := packet.New(0, append([]byte{}, TCPFlow[0]...), "0")
+				So(err, ShouldBeNil)
+				So(enforcer.processApplicationTCPPackets(tcpPacket), ShouldBeNil)
+				So(enforcer.isIntraHostFlow(tcpPacket), ShouldBeTrue)
+			})
+		})
+
+		Convey("When the intra-host mode is tokens", func() {
+
+			enforcer.Enforce("SomeProcessingUnitId1", intraHostPUInfo("SomeProcessingUnitId1", "164.67.228.152", acceptAll))
+
+			Convey("Then the syn packet should carry a token", func() {
+
+				tcpPacket, err := packet.New(0, append([]byte{}, TCPFlow[0]...), "0")
+				So(err, ShouldBeNil)
+				length := tcpPacket.IPTotalLength
+				So(enforcer.processApplicationTCPPackets(tcpPacket), ShouldBeNil)
+				So(tcpPacket.IPTotalLength, ShouldBeGreaterThan, length)
+			})
+		})
+	})
+}
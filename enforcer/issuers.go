@@ -0,0 +1,164 @@
+package enforcer
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+	"github.com/aporeto-inc/trireme/policy"
+)
+
+// issuerRule is a parsed policy.IssuerRule
+type issuerRule struct {
+	networks []*net.IPNet
+	ports    [][2]uint16
+	issuers  map[string]bool
+}
+
+// parseIssuerRules parses the issuer rules of a policy. Invalid networks and ports
+// are ignored, a rule left without networks or ports is ignored as well since it
+// would otherwise apply to all the peers.
+func parseIssuerRules(rules []*policy.IssuerRule) []*issuerRule {
+
+	parsed := []*issuerRule{}
+
+	for _, r := range rules {
+		rule := &issuerRule{issuers: map[string]bool{}}
+
+		for _, n := range r.Networks {
+			_, network, err := net.ParseCIDR(n)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"package": "enforcer",
+					"network": n,
+					"error":   err.Error(),
+				}).Warn("Ignoring invalid network of issuer rule")
+				continue
+			}
+			rule.networks = append(rule.networks, network)
+		}
+
+		for _, p := range r.Ports {
+			ports, err := parsePortRange(p)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"package": "enforcer",
+					"port":    p,
+					"error":   err.Error(),
+				}).Warn("Ignoring invalid port of issuer rule")
+				continue
+			}
+			rule.ports = append(rule.ports, ports)
+		}
+
+		if (len(r.Networks) > 0 && len(rule.networks) == 0) || (len(r.Ports) > 0 && len(rule.ports) == 0) {
+			continue
+		}
+
+		for _, issuer := range r.Issuers {
+			rule.issuers[tokens.NormalizeFingerprint(issuer)] = true
+		}
+
+		parsed = append(parsed, rule)
+	}
+
+	return parsed
+}
+
+// parsePortRange parses a port or a range of ports such as 8000:8100
+func parsePortRange(p string) ([2]uint16, error) {
+
+	bounds := strings.SplitN(p, ":", 2)
+
+	min, err := strconv.ParseUint(bounds[0], 10, 16)
+	if err != nil {
+		return [2]uint16{}, err
+	}
+
+	max := min
+	if len(bounds) == 2 {
+		if max, err = strconv.ParseUint(bounds[1], 10, 16); err != nil {
+			return [2]uint16{}, err
+		}
+	}
+
+	return [2]uint16{uint16(min), uint16(max)}, nil
+}
+
+// applies returns true if the rule applies to the connections of the peer to the port
+func (r *issuerRule) applies(peer net.IP, port uint16) bool {
+
+	if len(r.networks) > 0 {
+		found := false
+		for _, network := range r.networks {
+			if network.Contains(peer) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(r.ports) > 0 {
+		found := false
+		for _, ports := range r.ports {
+			if port >= ports[0] && port <= ports[1] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// accepts returns true if one of the certificate authorities is accepted by the rule
+func (r *issuerRule) accepts(authorities []string) bool {
+
+	for _, authority := range authorities {
+		if r.issuers[authority] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// issuerAccepted returns true if the certificate of the peer was issued by a
+// certificate authority accepted by all the issuer rules of the PU applying to the
+// connection to the port. The authorities are the ones of the chains verifying the
+// certificate with the trusted roots, matched by their fingerprints, so that an
+// authority cannot pass for another one by taking its name. The issuer of a peer is
+// unknown, and rejected by the rules, when its certificate is not transmitted in
+// the tokens or when the secrets do not report the authorities.
+func (p *PUContext) issuerAccepted(peer net.IP, port uint16, cert interface{}, secrets tokens.AuthoritySecrets) bool {
+
+	var authorities []string
+	resolved := false
+
+	for _, rule := range p.issuerRules {
+		if !rule.applies(peer, port) {
+			continue
+		}
+
+		if !resolved {
+			if secrets != nil && cert != nil {
+				authorities = secrets.PeerAuthorities(cert)
+			}
+			resolved = true
+		}
+
+		if !rule.accepts(authorities) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,77 @@
+package enforcer
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"testing"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+	"github.com/aporeto-inc/trireme/policy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// testAuthorities reports the fingerprints of the authorities of the certificates
+type testAuthorities map[*x509.Certificate][]string
+
+func (a testAuthorities) PeerAuthorities(cert interface{}) []string {
+
+	c, _ := cert.(*x509.Certificate)
+
+	return a[c]
+}
+
+func TestIssuerRules(t *testing.T) {
+
+	Convey("Given I create an enforcer with a processing unit that only accepts the prod CA on some networks and ports", t, func() {
+
+		secret := tokens.NewPSKSecrets([]byte("Dummy Test Password"))
+		enforcer := NewDefaultDatapathEnforcer("SomeServerId", &collector.DefaultCollector{}, nil, secret, constants.LocalContainer).(*datapathEnforcer)
+
+		puInfo := intraHostPUInfo("SomeProcessingUnitId1", "164.67.228.152", &policy.TagSelector{})
+		puInfo.Policy.UpdateIssuerRules([]*policy.IssuerRule{
+			policy.NewIssuerRule([]string{"10.1.0.0/16"}, []string{"443", "8000:8100"}, []string{"AB:CD:EF"}),
+			policy.NewIssuerRule([]string{"invalid"}, nil, nil),
+		})
+		So(enforcer.Enforce("SomeProcessingUnitId1", puInfo), ShouldBeNil)
+
+		c, err := enforcer.puTracker.Get("164.67.228.152")
+		So(err, ShouldBeNil)
+		context := c.(*PUContext)
+
+		prod := &x509.Certificate{Issuer: pkix.Name{CommonName: "prod-ca"}}
+		impostor := &x509.Certificate{Issuer: pkix.Name{CommonName: "prod-ca"}}
+		dev := &x509.Certificate{Issuer: pkix.Name{CommonName: "dev-ca"}}
+
+		authorities := testAuthorities{
+			prod:     []string{"abcdef"},
+			impostor: []string{"012345"},
+			dev:      []string{"6789ab"},
+		}
+
+		Convey("Then the invalid rule should be ignored", func() {
+			So(len(context.issuerRules), ShouldEqual, 1)
+		})
+
+		Convey("Then only the peers of the prod CA should be accepted by the rule", func() {
+			So(context.issuerAccepted(net.ParseIP("10.1.2.3"), 443, prod, authorities), ShouldBeTrue)
+			So(context.issuerAccepted(net.ParseIP("10.1.2.3"), 8050, dev, authorities), ShouldBeFalse)
+			So(context.issuerAccepted(net.ParseIP("10.1.2.3"), 443, nil, authorities), ShouldBeFalse)
+		})
+
+		Convey("Then a CA with the name of the prod CA should be rejected by the rule", func() {
+			So(context.issuerAccepted(net.ParseIP("10.1.2.3"), 443, impostor, authorities), ShouldBeFalse)
+		})
+
+		Convey("Then the peers should be rejected by the rule without the authorities of the secrets", func() {
+			So(context.issuerAccepted(net.ParseIP("10.1.2.3"), 443, prod, nil), ShouldBeFalse)
+		})
+
+		Convey("Then the peers outside the networks and ports of the rule should be accepted", func() {
+			So(context.issuerAccepted(net.ParseIP("10.2.2.3"), 443, dev, authorities), ShouldBeTrue)
+			So(context.issuerAccepted(net.ParseIP("10.1.2.3"), 80, dev, authorities), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,124 @@
+package enforcer
+
+import (
+	"time"
+
+	"github.com/aporeto-inc/trireme/collector"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// DefaultKeepaliveInterval is the default interval of the re-authorization of the
+// established flows
+const DefaultKeepaliveInterval = time.Minute
+
+// KeepaliveAction defines what happens to an established flow that the current
+// policy of its PU no longer accepts
+type KeepaliveAction int
+
+const (
+	// KeepaliveIgnore does not re-evaluate the established flows. This is the default.
+	KeepaliveIgnore KeepaliveAction = iota
+	// KeepaliveLog reports the flows that are no longer accepted and keeps them
+	KeepaliveLog
+	// KeepaliveTerminate reports the flows that are no longer accepted and revokes them
+	// with the flow revoker
+	KeepaliveTerminate
+)
+
+// KeepaliveConfig configures the periodic re-authorization of the established flows
+type KeepaliveConfig struct {
+	// Interval is the interval between two re-authorizations
+	Interval time.Duration
+	// Action is applied to the flows that are no longer accepted
+	Action KeepaliveAction
+	// MaxAge is the time a flow is re-authorized after it was accepted. The datapath
+	// does not see the end of the flows. It applies to the flows accepted afterwards.
+	MaxAge time.Duration
+}
+
+// SetKeepalive configures the re-authorization of the established flows
+func (d *datapathEnforcer) SetKeepalive(config *KeepaliveConfig) {
+
+	d.peers.Lock()
+	defer d.peers.Unlock()
+
+	d.peers.keepalive = *config
+
+	if d.peers.keepalive.Interval <= 0 {
+		d.peers.keepalive.Interval = DefaultKeepaliveInterval
+	}
+
+	if d.peers.keepalive.MaxAge <= 0 {
+		d.peers.keepalive.MaxAge = peerFlowLifetime
+	}
+}
+
+// reauthorizeFlows evaluates the established flows against the current policy of their
+// PU. It returns the flows that are no longer accepted.
+func (d *datapathEnforcer) reauthorizeFlows() []*FlowState {
+
+	d.peers.Lock()
+	action := d.peers.keepalive.Action
+	revoker := d.peers.revoker
+	d.peers.Unlock()
+
+	denied := []*FlowState{}
+
+	if action == KeepaliveIgnore {
+		return denied
+	}
+
+	for hash, pf := range d.activePeerFlows() {
+
+		if pf.accepted(pf.tags) {
+			continue
+		}
+
+		d.collector.CollectFlowEvent(&collector.FlowRecord{
+			ContextID:       pf.context.ID,
+			SourceID:        pf.peer,
+			DestinationID:   pf.context.ManagementID,
+			Tags:            pf.context.Annotations,
+			Action:          collector.FlowReject,
+			Mode:            collector.ReauthorizationFailed,
+			SourceIP:        pf.flow.SourceIP,
+			DestinationIP:   pf.flow.DestinationIP,
+			DestinationPort: pf.flow.DestinationPort,
+		})
+
+		log.WithFields(log.Fields{
+			"package":   "enforcer",
+			"contextID": pf.context.ID,
+			"peer":      pf.peer,
+			"source":    pf.flow.SourceIP,
+			"port":      pf.flow.DestinationPort,
+		}).Warn("Established flow no longer accepted by the policy")
+
+		if action == KeepaliveTerminate {
+			d.peerFlows.Remove(hash)
+			d.evictVerdict(pf.flow)
+
+			if revoker != nil {
+				revoker(pf.flow)
+			}
+		}
+
+		denied = append(denied, pf.flow)
+	}
+
+	return denied
+}
+
+// startKeepalive re-authorizes the established flows periodically
+func (d *datapathEnforcer) startKeepalive() {
+
+	for {
+		d.peers.Lock()
+		interval := d.peers.keepalive.Interval
+		d.peers.Unlock()
+
+		d.clock.Sleep(interval)
+		d.reauthorizeFlows()
+	}
+}
@@ -0,0 +1,97 @@
+package enforcer
+
+import (
+	"testing"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/enforcer/utils/packet"
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+	"github.com/aporeto-inc/trireme/policy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestKeepalive(t *testing.T) {
+
+	Convey("Given I create an enforcer with an established flow of a web peer", t, func() {
+
+		selector := func(app string) *policy.TagSelector {
+			return &policy.TagSelector{
+				Clause: []policy.KeyValueOperator{
+					{
+						Key:      "app",
+						Value:    []string{app},
+						Operator: policy.Equal,
+					},
+				},
+				Action: policy.Accept,
+			}
+		}
+
+		secret := tokens.NewPSKSecrets([]byte("Dummy Test Password"))
+		enforcer := NewDefaultDatapathEnforcer("SomeServerId", &collector.DefaultCollector{}, nil, secret, constants.LocalContainer).(*datapathEnforcer)
+		enforcer.Enforce("SomeProcessingUnitId1", intraHostPUInfo("SomeProcessingUnitId1", "164.67.228.152", selector("web")))
+
+		revoked := []*FlowState{}
+		enforcer.SetFlowRevoker(func(flow *FlowState) {
+			revoked = append(revoked, flow)
+		})
+
+		context, err := enforcer.puTracker.Get("164.67.228.152")
+		So(err, ShouldBeNil)
+
+		syn, err := packet.New(0, append([]byte{}, TCPFlow[0]...), "0")
+		So(err, ShouldBeNil)
+
+		enforcer.trackPeerFlow(context.(*PUContext), syn, "peer", &tokens.ConnectionClaims{
+			T: policy.NewTagsMap(map[string]string{TransmitterLabel: "peer", "app": "web"}),
+		})
+
+		Convey("When the policy no longer accepts the peer", func() {
+
+			enforcer.Enforce("SomeProcessingUnitId1", intraHostPUInfo("SomeProcessingUnitId1", "164.67.228.152", selector("db")))
+
+			Convey("Then the flow should not be re-evaluated by default", func() {
+				So(enforcer.reauthorizeFlows(), ShouldBeEmpty)
+			})
+
+			Convey("Then the flow should be reported and kept in log mode", func() {
+				enforcer.SetKeepalive(&KeepaliveConfig{Action: KeepaliveLog})
+
+				So(len(enforcer.reauthorizeFlows()), ShouldEqual, 1)
+				So(revoked, ShouldBeEmpty)
+				So(len(enforcer.reauthorizeFlows()), ShouldEqual, 1)
+			})
+
+			Convey("Then the flow should be revoked once in terminate mode", func() {
+				enforcer.SetKeepalive(&KeepaliveConfig{Action: KeepaliveTerminate})
+
+				denied := enforcer.reauthorizeFlows()
+				So(len(denied), ShouldEqual, 1)
+				So(revoked, ShouldResemble, denied)
+				So(enforcer.reauthorizeFlows(), ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the policy still accepts the peer", func() {
+
+			enforcer.SetKeepalive(&KeepaliveConfig{Action: KeepaliveTerminate})
+
+			Convey("Then the flow should be kept", func() {
+				So(enforcer.reauthorizeFlows(), ShouldBeEmpty)
+				So(revoked, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the processing unit is deleted", func() {
+
+			enforcer.SetKeepalive(&KeepaliveConfig{Action: KeepaliveTerminate})
+			So(enforcer.Unenforce("SomeProcessingUnitId1"), ShouldBeNil)
+
+			Convey("Then the flow should be forgotten", func() {
+				So(enforcer.reauthorizeFlows(), ShouldBeEmpty)
+				So(enforcer.peerFlows.KeyList(), ShouldBeEmpty)
+			})
+		})
+	})
+}
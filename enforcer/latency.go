@@ -0,0 +1,182 @@
+package enforcer
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/policy"
+)
+
+// maxLatencySamples is the number of handshakes of a PU sampled per interval to
+// compute the percentiles of their latency
+const maxLatencySamples = 1024
+
+// latencySamples are the handshakes of a PU during an interval
+type latencySamples struct {
+	tags    *policy.TagsMap
+	count   uint64
+	max     time.Duration
+	samples []time.Duration
+}
+
+// handshakeLatencies reports the percentiles of the latency of the handshakes of the
+// PUs, from the SYN seen by the enforcer to the flow authorized. It includes the
+// processing of the tokens by both enforcers and the round trip to the peer. The
+// handshakes are sampled uniformly once there are too many of them.
+type handshakeLatencies struct {
+	interval time.Duration
+	pus      map[string]*latencySamples
+	random   *rand.Rand
+	sync.Mutex
+}
+
+func newHandshakeLatencies() *handshakeLatencies {
+
+	return &handshakeLatencies{
+		pus:    map[string]*latencySamples{},
+		random: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// observe records the latency of a handshake of a PU, if the reports are enabled
+func (l *handshakeLatencies) observe(context *PUContext, latency time.Duration) {
+
+	l.Lock()
+	defer l.Unlock()
+
+	if l.interval <= 0 {
+		return
+	}
+
+	s, ok := l.pus[context.ID]
+	if !ok {
+		s = &latencySamples{}
+		l.pus[context.ID] = s
+	}
+
+	s.tags = context.Annotations
+	s.count++
+	if latency > s.max {
+		s.max = latency
+	}
+
+	if len(s.samples) < maxLatencySamples {
+		s.samples = append(s.samples, latency)
+		return
+	}
+
+	if i := l.random.Int63n(int64(s.count)); i < maxLatencySamples {
+		s.samples[i] = latency
+	}
+}
+
+// take returns the handshakes of the interval and starts a new interval
+func (l *handshakeLatencies) take() map[string]*latencySamples {
+
+	l.Lock()
+	defer l.Unlock()
+
+	pus := l.pus
+	l.pus = map[string]*latencySamples{}
+
+	return pus
+}
+
+// record returns the latency record of the handshakes of a PU
+func (s *latencySamples) record(contextID string, interval time.Duration) *collector.LatencyRecord {
+
+	sorted := make([]time.Duration, len(s.samples))
+	copy(sorted, s.samples)
+	sort.Sort(durations(sorted))
+
+	return &collector.LatencyRecord{
+		ContextID: contextID,
+		Tags:      s.tags,
+		Interval:  interval,
+		Count:     s.count,
+		P50:       percentile(sorted, 50),
+		P90:       percentile(sorted, 90),
+		P99:       percentile(sorted, 99),
+		Max:       s.max,
+	}
+}
+
+// percentile returns the nearest rank percentile of sorted durations
+func percentile(sorted []time.Duration, p int) time.Duration {
+
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+
+	return sorted[rank-1]
+}
+
+// durations sorts the durations in increasing order
+type durations []time.Duration
+
+func (d durations) Len() int           { return len(d) }
+func (d durations) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d durations) Less(i, j int) bool { return d[i] < d[j] }
+
+// SetHandshakeLatencies reports the percentiles of the latency of the handshakes of the
+// PUs at every interval, or disables the reports if the interval is zero. The collector
+// must be a collector.LatencyEventCollector. It must be called before Start.
+func (d *datapathEnforcer) SetHandshakeLatencies(interval time.Duration) {
+
+	d.latencies.Lock()
+	defer d.latencies.Unlock()
+
+	d.latencies.interval = interval
+}
+
+// startHandshakeLatencies reports the latency of the handshakes periodically, if
+// enabled
+func (d *datapathEnforcer) startHandshakeLatencies() {
+
+	d.latencies.Lock()
+	interval := d.latencies.interval
+	d.latencies.Unlock()
+
+	if interval <= 0 {
+		return
+	}
+
+	for {
+		d.clock.Sleep(interval)
+		d.reportHandshakeLatencies(interval)
+	}
+}
+
+// reportHandshakeLatencies reports the latency of the handshakes of the PUs since the
+// previous report. The PUs without handshakes are not reported.
+func (d *datapathEnforcer) reportHandshakeLatencies(interval time.Duration) {
+
+	pus := d.latencies.take()
+
+	c, ok := d.collector.(collector.LatencyEventCollector)
+	if !ok {
+		return
+	}
+
+	for contextID, s := range pus {
+		c.CollectLatencyEvent(s.record(contextID, interval))
+	}
+}
+
+// observeHandshake records the latency of the handshake of a connection authorized
+func (d *datapathEnforcer) observeHandshake(context *PUContext, connection *TCPConnection) {
+
+	if connection.Started.IsZero() {
+		return
+	}
+
+	d.latencies.observe(context, d.clock.Now().Sub(connection.Started))
+}
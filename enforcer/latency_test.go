@@ -0,0 +1,101 @@
+package enforcer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+	"github.com/aporeto-inc/trireme/policy"
+	"github.com/aporeto-inc/trireme/utils/clock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// latencyCollector records the latency records
+type latencyCollector struct {
+	flowCollector
+	latencies []*collector.LatencyRecord
+}
+
+func (c *latencyCollector) CollectLatencyEvent(record *collector.LatencyRecord) {
+	c.latencies = append(c.latencies, record)
+}
+
+func TestHandshakeLatencies(t *testing.T) {
+
+	Convey("Given I create an enforcer reporting the latency of the handshakes", t, func() {
+
+		secret := tokens.NewPSKSecrets([]byte("Dummy Test Password"))
+		latencies := &latencyCollector{}
+		enforcer := NewDefaultDatapathEnforcer("SomeServerId", latencies, nil, secret, constants.LocalContainer).(*datapathEnforcer)
+		enforcer.SetHandshakeLatencies(time.Minute)
+
+		clk := clock.NewFake(time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC))
+		enforcer.SetClock(clk)
+
+		context := &PUContext{ID: "pu", Annotations: policy.NewTagsMap(map[string]string{"app": "web"})}
+
+		Convey("The percentiles of the handshakes of the interval should be reported", func() {
+			for i := 1; i <= 100; i++ {
+				connection := NewTCPConnection()
+				connection.Started = clk.Now()
+				clk.Advance(time.Duration(i) * time.Millisecond)
+				enforcer.observeHandshake(context, connection)
+			}
+
+			enforcer.reportHandshakeLatencies(time.Minute)
+
+			So(latencies.latencies, ShouldHaveLength, 1)
+			record := latencies.latencies[0]
+			So(record.ContextID, ShouldEqual, "pu")
+			So(record.Interval, ShouldEqual, time.Minute)
+			So(record.Count, ShouldEqual, 100)
+			So(record.P50, ShouldEqual, 50*time.Millisecond)
+			So(record.P90, ShouldEqual, 90*time.Millisecond)
+			So(record.P99, ShouldEqual, 99*time.Millisecond)
+			So(record.Max, ShouldEqual, 100*time.Millisecond)
+
+			Convey("The PUs without handshakes should not be reported afterwards", func() {
+				enforcer.reportHandshakeLatencies(time.Minute)
+
+				So(latencies.latencies, ShouldHaveLength, 1)
+			})
+		})
+
+		Convey("The connections without a SYN seen should not be measured", func() {
+			enforcer.observeHandshake(context, NewTCPConnection())
+			enforcer.reportHandshakeLatencies(time.Minute)
+
+			So(latencies.latencies, ShouldBeEmpty)
+		})
+
+		Convey("The handshakes should be sampled once there are too many", func() {
+			for i := 0; i < 3*maxLatencySamples; i++ {
+				connection := NewTCPConnection()
+				connection.Started = clk.Now()
+				clk.Advance(time.Millisecond)
+				enforcer.observeHandshake(context, connection)
+			}
+
+			samples := enforcer.latencies.take()["pu"]
+			So(samples.count, ShouldEqual, 3*maxLatencySamples)
+			So(samples.samples, ShouldHaveLength, maxLatencySamples)
+		})
+	})
+
+	Convey("Given an enforcer not reporting the latency of the handshakes", t, func() {
+
+		secret := tokens.NewPSKSecrets([]byte("Dummy Test Password"))
+		latencies := &latencyCollector{}
+		enforcer := NewDefaultDatapathEnforcer("SomeServerId", latencies, nil, secret, constants.LocalContainer).(*datapathEnforcer)
+
+		Convey("The handshakes should not be recorded", func() {
+			connection := NewTCPConnection()
+			connection.Started = time.Now()
+			enforcer.observeHandshake(&PUContext{ID: "pu"}, connection)
+
+			So(enforcer.latencies.take(), ShouldBeEmpty)
+		})
+	})
+}
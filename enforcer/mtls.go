@@ -0,0 +1,547 @@
+package enforcer
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/crypto"
+	"github.com/aporeto-inc/trireme/enforcer/utils/packet"
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+	"github.com/aporeto-inc/trireme/utils/marks"
+)
+
+const (
+	// mtlsHandshakeTimeout bounds the TLS handshake and the token exchange
+	mtlsHandshakeTimeout = 5 * time.Second
+
+	// mtlsMaxTokenSize is the maximum size of a token exchanged over TLS
+	mtlsMaxTokenSize = 16384
+)
+
+// MTLSConfig configures the mutual TLS data-plane mode. Connections of the PUs to the
+// given networks are carried over mutual TLS between enforcers instead of exchanging
+// tokens in the TCP handshake, for networks where middleboxes mangle the handshake
+// payloads. The supervisor redirects the application connections to the ClientPort
+// and the connections of the peer enforcers to the ServerPort.
+type MTLSConfig struct {
+	Networks   []string
+	ClientPort int
+	ServerPort int
+	Secrets    *tokens.PKISecrets
+}
+
+// mtlsProxy holds the listeners of the mutual TLS mode
+type mtlsProxy struct {
+	config    *MTLSConfig
+	networks  []*net.IPNet
+	tlsConfig *tls.Config
+	roots     *x509.CertPool
+	listeners []net.Listener
+}
+
+// EnableMTLS starts the mutual TLS data-plane mode. The same identity certificates
+// as the tokens are used to authenticate the enforcers.
+func (d *datapathEnforcer) EnableMTLS(config *MTLSConfig) error {
+
+	if config == nil || config.Secrets == nil {
+		return fmt.Errorf("Mutual TLS requires PKI secrets")
+	}
+
+	if config.ClientPort == 0 || config.ServerPort == 0 {
+		return fmt.Errorf("Mutual TLS requires a client and a server port")
+	}
+
+	networks := []*net.IPNet{}
+	for _, n := range config.Networks {
+		_, network, err := net.ParseCIDR(n)
+		if err != nil {
+			return fmt.Errorf("Invalid mutual TLS network %s: %s", n, err)
+		}
+		networks = append(networks, network)
+	}
+
+	proxy := &mtlsProxy{
+		config:   config,
+		networks: networks,
+	}
+
+	if err := proxy.loadCredentials(); err != nil {
+		return err
+	}
+
+	// The ports of the previous configuration may be the same
+	d.DisableMTLS()
+
+	client, err := net.Listen("tcp", ":"+strconv.Itoa(config.ClientPort))
+	if err != nil {
+		return fmt.Errorf("Cannot listen on mutual TLS client port: %s", err)
+	}
+
+	server, err := net.Listen("tcp", ":"+strconv.Itoa(config.ServerPort))
+	if err != nil {
+		client.Close()
+		return fmt.Errorf("Cannot listen on mutual TLS server port: %s", err)
+	}
+
+	proxy.listeners = []net.Listener{client, server}
+
+	d.mtlsLock.Lock()
+	d.mtls = proxy
+	d.mtlsLock.Unlock()
+
+	go d.serveMTLS(client, d.handleMTLSClient)
+	go d.serveMTLS(server, d.handleMTLSServer)
+
+	return nil
+}
+
+// DisableMTLS stops the mutual TLS data-plane mode. Established connections are
+// not interrupted.
+func (d *datapathEnforcer) DisableMTLS() {
+
+	d.mtlsLock.Lock()
+	defer d.mtlsLock.Unlock()
+
+	if d.mtls == nil {
+		return
+	}
+
+	for _, l := range d.mtls.listeners {
+		l.Close()
+	}
+
+	d.mtls = nil
+}
+
+// loadCredentials loads the certificate and the authorities of the secrets of the
+// configuration
+func (p *mtlsProxy) loadCredentials() error {
+
+	cert, err := tls.X509KeyPair(p.config.Secrets.TransmittedPEM(), p.config.Secrets.EncodingPEM())
+	if err != nil {
+		return fmt.Errorf("Invalid mutual TLS certificate: %s", err)
+	}
+
+	roots := crypto.LoadRootCertificates(p.config.Secrets.AuthPEM())
+	if roots == nil {
+		return fmt.Errorf("Invalid mutual TLS authority")
+	}
+
+	// Peers are addressed by IP and their certificates do not carry it. The chain
+	// is verified after the handshake instead.
+	p.roots = roots
+	p.tlsConfig = &tls.Config{
+		Certificates:       []tls.Certificate{cert},
+		ClientAuth:         tls.RequireAnyClientCert,
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	return nil
+}
+
+// reloadMTLS loads the rotated secrets in the mutual TLS configuration. The
+// listeners and the established connections are kept.
+func (d *datapathEnforcer) reloadMTLS() error {
+
+	d.mtlsLock.Lock()
+	defer d.mtlsLock.Unlock()
+
+	if d.mtls == nil {
+		return nil
+	}
+
+	proxy := &mtlsProxy{
+		config:    d.mtls.config,
+		networks:  d.mtls.networks,
+		listeners: d.mtls.listeners,
+	}
+
+	if err := proxy.loadCredentials(); err != nil {
+		return err
+	}
+
+	d.mtls = proxy
+
+	return nil
+}
+
+// mtlsDestination returns the mutual TLS configuration if connections to the ip are
+// carried over mutual TLS
+func (d *datapathEnforcer) mtlsDestination(ip net.IP) (*mtlsProxy, bool) {
+
+	d.mtlsLock.RLock()
+	defer d.mtlsLock.RUnlock()
+
+	if d.mtls == nil {
+		return nil, false
+	}
+
+	for _, n := range d.mtls.networks {
+		if n.Contains(ip) {
+			return d.mtls, true
+		}
+	}
+
+	return nil, false
+}
+
+// processMTLSSynPacket lets the SYN packets of connections carried over mutual TLS go
+// through untouched. They are redirected to the proxy which exchanges the tokens
+// after the TLS handshake. It returns false if the regular processing applies.
+func (d *datapathEnforcer) processMTLSSynPacket(context *PUContext, tcpPacket *packet.Packet) bool {
+
+	if _, ok := d.mtlsDestination(tcpPacket.DestinationAddress); !ok {
+		return false
+	}
+
+	d.acceptFlow(InteropFlow, context, tcpPacket)
+
+	return true
+}
+
+func (d *datapathEnforcer) serveMTLS(listener net.Listener, handler func(net.Conn) error) {
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			if err := handler(conn); err != nil {
+				log.WithFields(log.Fields{
+					"package": "enforcer",
+					"remote":  conn.RemoteAddr().String(),
+					"error":   err.Error(),
+				}).Debug("Mutual TLS connection closed")
+				conn.Close()
+			}
+		}()
+	}
+}
+
+// handleMTLSClient carries a redirected application connection to the enforcer of
+// the destination over mutual TLS
+func (d *datapathEnforcer) handleMTLSClient(conn net.Conn) error {
+
+	destination, err := originalDestination(conn)
+	if err != nil {
+		return err
+	}
+
+	proxy, ok := d.mtlsDestination(destination.IP)
+	if !ok {
+		return fmt.Errorf("Destination %s is not in a mutual TLS network", destination.IP)
+	}
+
+	source := conn.RemoteAddr().(*net.TCPAddr)
+	c, err := d.contextFromIP(true, source.IP.String(), d.mtlsClientMark(conn), strconv.Itoa(destination.Port))
+	if err != nil {
+		return err
+	}
+	context := c.(*PUContext)
+
+	record := &collector.FlowRecord{
+		ContextID:       context.ID,
+		SourceID:        context.ManagementID,
+		Tags:            context.Annotations,
+		Action:          collector.FlowAccept,
+		Mode:            "NA",
+		SourceIP:        source.IP.String(),
+		DestinationIP:   destination.IP.String(),
+		DestinationPort: uint16(destination.Port),
+	}
+
+	peer, err := dialMarked(&net.TCPAddr{IP: destination.IP, Port: proxy.config.ServerPort}, d.filterQueue.MarkValue, mtlsHandshakeTimeout)
+	if err != nil {
+		return err
+	}
+
+	tlsConn := tls.Client(peer, proxy.tlsConfig)
+	if err := proxy.handshake(tlsConn); err != nil {
+		peer.Close()
+		return err
+	}
+
+	auth := &AuthInfo{}
+	initConnection(auth)
+	if err := writeMTLSFrame(tlsConn, uint16(destination.Port), d.createPacketToken(false, context, auth)); err != nil {
+		tlsConn.Close()
+		return err
+	}
+
+	_, token, err := readMTLSFrame(tlsConn)
+	if err != nil {
+		tlsConn.Close()
+		record.Action = collector.FlowReject
+		record.Mode = collector.PolicyDrop
+		d.collector.CollectFlowEvent(record)
+		return fmt.Errorf("Connection rejected by the destination: %s", err)
+	}
+
+	claims, err := d.parseMTLSToken(tlsConn, auth, token)
+	if err != nil || !bytes.Equal(claims.RMT, auth.LocalContext) {
+		tlsConn.Close()
+		record.Action = collector.FlowReject
+		record.Mode = collector.InvalidToken
+		d.collector.CollectFlowEvent(record)
+		return fmt.Errorf("Invalid token from the destination")
+	}
+
+	record.DestinationID = auth.RemoteContextID
+	record.PeerIdentity = auth.RemoteIdentity
+
+	if d.mutualAuthorization {
+		rejected, _ := context.rejectTxtRules.Search(claims.T)
+		accepted, _ := context.acceptTxtRules.Search(claims.T)
+
+		if rejected >= 0 || accepted < 0 {
+			tlsConn.Close()
+			record.Action = collector.FlowReject
+			record.Mode = collector.PolicyDrop
+			d.collector.CollectFlowEvent(record)
+			return fmt.Errorf("Connection rejected because of policy %+v", claims.T)
+		}
+	}
+
+	tlsConn.SetDeadline(time.Time{})
+	d.collector.CollectFlowEvent(record)
+
+	go pipeMTLS(conn, tlsConn)
+
+	return nil
+}
+
+// mtlsClientMark returns the cgroup mark of a redirected connection of a local
+// process. The supervisor sends the connections of each cgroup to the loopback
+// address of its mark.
+func (d *datapathEnforcer) mtlsClientMark(conn net.Conn) string {
+
+	if d.mode != constants.LocalServer {
+		return ""
+	}
+
+	local, ok := conn.LocalAddr().(*net.TCPAddr)
+	if !ok {
+		return ""
+	}
+
+	mark, ok := marks.FromLoopback(local.IP)
+	if !ok {
+		return ""
+	}
+
+	return strconv.FormatUint(uint64(mark), 10)
+}
+
+// handleMTLSServer terminates a mutual TLS connection of a peer enforcer and carries
+// it to the destination PU after the policy is evaluated
+func (d *datapathEnforcer) handleMTLSServer(conn net.Conn) error {
+
+	d.mtlsLock.RLock()
+	proxy := d.mtls
+	d.mtlsLock.RUnlock()
+
+	if proxy == nil {
+		return fmt.Errorf("Mutual TLS is disabled")
+	}
+
+	destination, err := originalDestination(conn)
+	if err != nil {
+		destination = conn.LocalAddr().(*net.TCPAddr)
+	}
+
+	tlsConn := tls.Server(conn, proxy.tlsConfig)
+	if err := proxy.handshake(tlsConn); err != nil {
+		return err
+	}
+
+	port, token, err := readMTLSFrame(tlsConn)
+	if err != nil {
+		return err
+	}
+
+	c, err := d.contextFromIP(false, destination.IP.String(), "", strconv.Itoa(int(port)))
+	if err != nil {
+		return err
+	}
+	context := c.(*PUContext)
+
+	source := conn.RemoteAddr().(*net.TCPAddr)
+	record := &collector.FlowRecord{
+		ContextID:       context.ID,
+		DestinationID:   context.ManagementID,
+		Tags:            context.Annotations,
+		Action:          collector.FlowReject,
+		Mode:            collector.InvalidToken,
+		SourceIP:        source.IP.String(),
+		DestinationIP:   destination.IP.String(),
+		DestinationPort: port,
+	}
+
+	auth := &AuthInfo{}
+	initConnection(auth)
+	claims, err := d.parseMTLSToken(tlsConn, auth, token)
+	if err != nil {
+		d.collector.CollectFlowEvent(record)
+		return err
+	}
+
+	record.SourceID = auth.RemoteContextID
+	record.PeerIdentity = auth.RemoteIdentity
+
+	tags := claims.T.Clone()
+	tags.Add(PortNumberLabelString, strconv.Itoa(int(port)))
+
+	rejected, _ := context.rejectRcvRules.Search(tags)
+	accepted, _ := context.acceptRcvRules.Search(tags)
+
+	if rejected >= 0 || accepted < 0 {
+		record.Mode = collector.PolicyDrop
+		d.collector.CollectFlowEvent(record)
+		return fmt.Errorf("Connection rejected because of policy %+v", tags)
+	}
+
+	service, err := dialMarked(&net.TCPAddr{IP: destination.IP, Port: int(port)}, d.filterQueue.MarkValue, mtlsHandshakeTimeout)
+	if err != nil {
+		return err
+	}
+
+	if err := writeMTLSFrame(tlsConn, 0, d.createPacketToken(false, context, auth)); err != nil {
+		service.Close()
+		return err
+	}
+
+	tlsConn.SetDeadline(time.Time{})
+
+	record.Action = collector.FlowAccept
+	record.Mode = "NA"
+	d.collector.CollectFlowEvent(record)
+
+	go pipeMTLS(tlsConn, service)
+
+	return nil
+}
+
+// parseMTLSToken decodes a token received over TLS. The certificate that signed the
+// token must be the certificate of the TLS peer.
+func (d *datapathEnforcer) parseMTLSToken(conn *tls.Conn, auth *AuthInfo, token []byte) (*tokens.ConnectionClaims, error) {
+
+	claims, err := d.parsePacketToken(auth, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if cert, ok := auth.RemotePublicKey.(*x509.Certificate); ok {
+		peers := conn.ConnectionState().PeerCertificates
+		if len(peers) == 0 || !bytes.Equal(peers[0].Raw, cert.Raw) {
+			return nil, fmt.Errorf("Token not signed by the TLS peer")
+		}
+	}
+
+	return claims, nil
+}
+
+// handshake completes the TLS handshake and verifies the chain of the peer
+// certificate with the authority of the secrets or of a federated deployment
+func (p *mtlsProxy) handshake(conn *tls.Conn) error {
+
+	conn.SetDeadline(time.Now().Add(mtlsHandshakeTimeout))
+
+	if err := conn.Handshake(); err != nil {
+		return err
+	}
+
+	peers := conn.ConnectionState().PeerCertificates
+	if len(peers) == 0 {
+		return fmt.Errorf("No peer certificate")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range peers[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := peers[0].Verify(x509.VerifyOptions{
+		Roots:         p.roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+
+	// The peers of the federated deployments are verified with their authorities
+	if err != nil {
+		if _, ok := p.config.Secrets.PeerFederation(peers[0]); ok {
+			return nil
+		}
+	}
+
+	return err
+}
+
+// writeMTLSFrame writes the destination port and the token of a connection
+func writeMTLSFrame(w io.Writer, port uint16, token []byte) error {
+
+	if len(token) == 0 || len(token) > mtlsMaxTokenSize {
+		return fmt.Errorf("Invalid token size %d", len(token))
+	}
+
+	buffer := make([]byte, 4+len(token))
+	binary.BigEndian.PutUint16(buffer[0:2], port)
+	binary.BigEndian.PutUint16(buffer[2:4], uint16(len(token)))
+	copy(buffer[4:], token)
+
+	_, err := w.Write(buffer)
+	return err
+}
+
+// readMTLSFrame reads the destination port and the token of a connection
+func readMTLSFrame(r io.Reader) (uint16, []byte, error) {
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+
+	size := int(binary.BigEndian.Uint16(header[2:4]))
+	if size == 0 || size > mtlsMaxTokenSize {
+		return 0, nil, fmt.Errorf("Invalid token size %d", size)
+	}
+
+	token := make([]byte, size)
+	if _, err := io.ReadFull(r, token); err != nil {
+		return 0, nil, err
+	}
+
+	return binary.BigEndian.Uint16(header[0:2]), token, nil
+}
+
+// pipeMTLS copies the data of the connections until one of them is closed
+func pipeMTLS(a, b net.Conn) {
+
+	var once sync.Once
+	closeAll := func() {
+		a.Close()
+		b.Close()
+	}
+
+	go func() {
+		io.Copy(a, b)
+		once.Do(closeAll)
+	}()
+
+	io.Copy(b, a)
+	once.Do(closeAll)
+}
@@ -0,0 +1,127 @@
+// +build linux
+
+package enforcer
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// soOriginalDst is the socket option returning the destination of a connection
+// before it was redirected by netfilter
+const soOriginalDst = 80
+
+// originalDestination returns the destination of a redirected connection
+func originalDestination(conn net.Conn) (*net.TCPAddr, error) {
+
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil, fmt.Errorf("Not a TCP connection")
+	}
+
+	f, err := tcpConn.File()
+	if err != nil {
+		return nil, err
+	}
+
+	var addr *net.TCPAddr
+	if local, ok := tcpConn.LocalAddr().(*net.TCPAddr); ok && local.IP.To4() == nil {
+		addr, err = originalDestination6(int(f.Fd()))
+	} else {
+		addr, err = originalDestination4(int(f.Fd()))
+	}
+
+	// File puts the shared file description in blocking mode. Restore it for
+	// the connection.
+	syscall.SetNonblock(int(f.Fd()), true)
+	f.Close()
+
+	if err != nil {
+		return nil, fmt.Errorf("Cannot get the original destination: %s", err)
+	}
+
+	return addr, nil
+}
+
+// originalDestination4 returns the original destination of an IPv4 socket
+func originalDestination4(fd int) (*net.TCPAddr, error) {
+
+	// The sockaddr_in returned by the kernel fits in the ipv6_mreq structure
+	addr, err := syscall.GetsockoptIPv6Mreq(fd, syscall.SOL_IP, soOriginalDst)
+	if err != nil {
+		return nil, err
+	}
+
+	return &net.TCPAddr{
+		IP:   net.IPv4(addr.Multiaddr[4], addr.Multiaddr[5], addr.Multiaddr[6], addr.Multiaddr[7]),
+		Port: int(addr.Multiaddr[2])<<8 + int(addr.Multiaddr[3]),
+	}, nil
+}
+
+// originalDestination6 returns the original destination of an IPv6 socket. The
+// option of ip6tables has the same number as the one of iptables.
+func originalDestination6(fd int) (*net.TCPAddr, error) {
+
+	var addr syscall.RawSockaddrInet6
+	size := uint32(syscall.SizeofSockaddrInet6)
+
+	if _, _, errno := syscall.Syscall6(syscall.SYS_GETSOCKOPT, uintptr(fd), syscall.SOL_IPV6, soOriginalDst, uintptr(unsafe.Pointer(&addr)), uintptr(unsafe.Pointer(&size)), 0); errno != 0 {
+		return nil, errno
+	}
+
+	// The port is in network byte order
+	port := (*[2]byte)(unsafe.Pointer(&addr.Port))
+
+	return &net.TCPAddr{
+		IP:   net.IP(append([]byte{}, addr.Addr[:]...)),
+		Port: int(port[0])<<8 + int(port[1]),
+	}, nil
+}
+
+// dialMarked opens a connection whose packets carry the mark so that they are not
+// captured by the trireme chains
+func dialMarked(addr *net.TCPAddr, mark int, timeout time.Duration) (net.Conn, error) {
+
+	family := syscall.AF_INET
+	var sa syscall.Sockaddr
+	if ip := addr.IP.To4(); ip != nil {
+		sa4 := &syscall.SockaddrInet4{Port: addr.Port}
+		copy(sa4.Addr[:], ip)
+		sa = sa4
+	} else if ip := addr.IP.To16(); ip != nil {
+		family = syscall.AF_INET6
+		sa6 := &syscall.SockaddrInet6{Port: addr.Port}
+		copy(sa6.Addr[:], ip)
+		sa = sa6
+	} else {
+		return nil, fmt.Errorf("Invalid destination: %s", addr.IP)
+	}
+
+	fd, err := syscall.Socket(family, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	f := os.NewFile(uintptr(fd), "mtls")
+	defer f.Close()
+
+	if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_MARK, mark); err != nil {
+		return nil, fmt.Errorf("Cannot mark socket: %s", err)
+	}
+
+	// A blocking connect is bounded by the send timeout
+	tv := syscall.NsecToTimeval(timeout.Nanoseconds())
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_SNDTIMEO, &tv); err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Connect(fd, sa); err != nil {
+		return nil, fmt.Errorf("Cannot connect to %s: %s", addr, err)
+	}
+
+	return net.FileConn(f)
+}
@@ -0,0 +1,21 @@
+// +build !linux
+
+package enforcer
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// originalDestination returns the destination of a redirected connection
+func originalDestination(conn net.Conn) (*net.TCPAddr, error) {
+
+	return nil, fmt.Errorf("Original destination not supported on this platform")
+}
+
+// dialMarked opens a connection whose packets carry the mark
+func dialMarked(addr *net.TCPAddr, mark int, timeout time.Duration) (net.Conn, error) {
+
+	return nil, fmt.Errorf("Marked connections not supported on this platform")
+}
@@ -0,0 +1,90 @@
+package enforcer
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/enforcer/utils/packet"
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+	"github.com/aporeto-inc/trireme/policy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMTLS(t *testing.T) {
+
+	Convey("Given I create an enforcer", t, func() {
+
+		secret := tokens.NewPSKSecrets([]byte("Dummy Test Password"))
+		enforcer := NewDefaultDatapathEnforcer("SomeServerId", &collector.DefaultCollector{}, nil, secret, constants.LocalContainer).(*datapathEnforcer)
+
+		Convey("When I enable mutual TLS without PKI secrets", func() {
+
+			err := enforcer.EnableMTLS(&MTLSConfig{ClientPort: 5001, ServerPort: 5002})
+
+			Convey("Then I should get an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When I enable mutual TLS without ports", func() {
+
+			err := enforcer.EnableMTLS(&MTLSConfig{Secrets: &tokens.PKISecrets{}})
+
+			Convey("Then I should get an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When a processing unit connects to a mutual TLS network", func() {
+
+			enforcer.Enforce("SomeProcessingUnitId2", intraHostPUInfo("SomeProcessingUnitId2", "10.1.10.76", &policy.TagSelector{
+				Clause: []policy.KeyValueOperator{
+					{
+						Key:      TransmitterLabel,
+						Value:    []string{"SomeProcessingUnitId1"},
+						Operator: policy.Equal,
+					},
+				},
+				Action: policy.Accept,
+			}))
+
+			_, network, _ := net.ParseCIDR("164.67.228.0/24")
+			enforcer.mtls = &mtlsProxy{networks: []*net.IPNet{network}}
+
+			Convey("Then the syn packet should go through without a token", func() {
+
+				syn, err := packet.New(0, append([]byte{}, TCPFlow[0]...), "0")
+				So(err, ShouldBeNil)
+				length := syn.IPTotalLength
+				So(enforcer.processApplicationTCPPackets(syn), ShouldBeNil)
+				So(syn.IPTotalLength, ShouldEqual, length)
+			})
+		})
+
+		Convey("When I exchange a token frame", func() {
+
+			buffer := &bytes.Buffer{}
+			So(writeMTLSFrame(buffer, 80, []byte("token")), ShouldBeNil)
+
+			port, token, err := readMTLSFrame(buffer)
+
+			Convey("Then I should read the port and the token", func() {
+				So(err, ShouldBeNil)
+				So(port, ShouldEqual, 80)
+				So(string(token), ShouldEqual, "token")
+			})
+		})
+
+		Convey("When I read a frame with an empty token", func() {
+
+			_, _, err := readMTLSFrame(bytes.NewReader([]byte{0, 80, 0, 0}))
+
+			Convey("Then I should get an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
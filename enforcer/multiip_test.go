@@ -0,0 +1,76 @@
+package enforcer
+
+import (
+	"testing"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+	"github.com/aporeto-inc/trireme/policy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMultiIPContext(t *testing.T) {
+
+	Convey("Given I create an enforcer in the local container mode", t, func() {
+
+		secret := tokens.NewPSKSecrets([]byte("Dummy Test Password"))
+		enforcer := NewDefaultDatapathEnforcer("SomeServerId", &collector.DefaultCollector{}, nil, secret, constants.LocalContainer).(*datapathEnforcer)
+
+		Convey("When I enforce a dual-stack processing unit", func() {
+
+			puInfo := intraHostPUInfo("SomeProcessingUnitId1", "172.17.0.2", &policy.TagSelector{})
+			puInfo.Policy.SetIPAddresses(policy.NewIPMap(map[string]string{
+				policy.DefaultNamespace:     "172.17.0.2",
+				policy.DefaultIPv6Namespace: "fd00:0:0::2",
+			}))
+			So(enforcer.Enforce("SomeProcessingUnitId1", puInfo), ShouldBeNil)
+
+			Convey("Then the context should be found by both addresses", func() {
+				c4, err := enforcer.puTracker.Get("172.17.0.2")
+				So(err, ShouldBeNil)
+				c6, err := enforcer.puTracker.Get("fd00::2")
+				So(err, ShouldBeNil)
+				So(c4.(*PUContext).ID, ShouldEqual, "SomeProcessingUnitId1")
+				So(c6.(*PUContext).ID, ShouldEqual, "SomeProcessingUnitId1")
+			})
+
+			Convey("Then the addresses should be forgotten when the IPv6 one is gone", func() {
+				puInfo.Policy.SetIPAddresses(policy.NewIPMap(map[string]string{policy.DefaultNamespace: "172.17.0.3"}))
+				So(enforcer.Enforce("SomeProcessingUnitId1", puInfo), ShouldBeNil)
+
+				_, err := enforcer.puTracker.Get("fd00::2")
+				So(err, ShouldNotBeNil)
+				_, err = enforcer.puTracker.Get("172.17.0.3")
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When I enforce a processing unit attached only to additional networks", func() {
+
+			puInfo := intraHostPUInfo("SomeProcessingUnitId2", "10.1.0.2", &policy.TagSelector{})
+			puInfo.Policy.SetIPAddresses(policy.NewIPMap(map[string]string{
+				"net1": "10.1.0.2",
+				"net2": "10.2.0.2",
+			}))
+			So(enforcer.Enforce("SomeProcessingUnitId2", puInfo), ShouldBeNil)
+
+			Convey("Then the context should be found by all its addresses", func() {
+				_, err := enforcer.puTracker.Get("10.1.0.2")
+				So(err, ShouldBeNil)
+				_, err = enforcer.puTracker.Get("10.2.0.2")
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When I enforce a processing unit without address", func() {
+
+			puInfo := intraHostPUInfo("SomeProcessingUnitId3", "10.1.0.2", &policy.TagSelector{})
+			puInfo.Policy.SetIPAddresses(policy.NewIPMap(nil))
+
+			Convey("Then I should get an error", func() {
+				So(enforcer.Enforce("SomeProcessingUnitId3", puInfo), ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -26,6 +26,8 @@ type verdictType uint
 const (
 	//AfInet Address Family Inet
 	AfInet = 2
+	//AfInet6 Address Family Inet6
+	AfInet6 = 10
 
 	//NfDrop Net filter verdict
 	NfDrop verdictType = 0
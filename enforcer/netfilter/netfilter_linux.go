@@ -42,6 +42,8 @@ type verdictType C.uint
 const (
 	//AfInet Address Family Inet
 	AfInet = 2
+	//AfInet6 Address Family Inet6
+	AfInet6 = 10
 
 	//NfDrop Net filter verdict
 	NfDrop verdictType = 0
@@ -118,24 +120,30 @@ func NewNFQueue(queueID uint16, maxPacketsInQueue uint32, packetSize uint32) (*N
 		return nil, fmt.Errorf("Error opening NFQueue handle: %v\n", err)
 	}
 
-	if ret, err = C.nfq_unbind_pf(nfq.h, AfInet); err != nil || ret < 0 {
+	// The IPv6 packets are queued by the ip6tables rules of the PUs with IPv6 addresses
+	for _, family := range []C.u_int16_t{AfInet, AfInet6} {
 
-		log.WithFields(log.Fields{
-			"package": "netfilter",
-			"error":   err.Error(),
-		}).Debug("Error unbinding existing NFQ handler from AfInet protocol family")
+		if ret, err = C.nfq_unbind_pf(nfq.h, family); err != nil || ret < 0 {
 
-		return nil, fmt.Errorf("Error unbinding existing NFQ handler from AfInet protocol family: %v\n", err)
-	}
+			log.WithFields(log.Fields{
+				"package": "netfilter",
+				"family":  family,
+				"error":   err,
+			}).Debug("Error unbinding existing NFQ handler from protocol family")
 
-	if ret, err = C.nfq_bind_pf(nfq.h, AfInet); err != nil || ret < 0 {
+			return nil, fmt.Errorf("Error unbinding existing NFQ handler from protocol family %d: %v\n", family, err)
+		}
 
-		log.WithFields(log.Fields{
-			"package": "netfilter",
-			"error":   err.Error(),
-		}).Debug("Error binding to AfInet protocol family")
+		if ret, err = C.nfq_bind_pf(nfq.h, family); err != nil || ret < 0 {
+
+			log.WithFields(log.Fields{
+				"package": "netfilter",
+				"family":  family,
+				"error":   err,
+			}).Debug("Error binding to protocol family")
 
-		return nil, fmt.Errorf("Error binding to AfInet protocol family: %v\n", err)
+			return nil, fmt.Errorf("Error binding to protocol family %d: %v\n", family, err)
+		}
 	}
 
 	nfq.idx = uint32(time.Now().UnixNano())
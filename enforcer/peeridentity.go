@@ -0,0 +1,331 @@
+package enforcer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/enforcer/utils/packet"
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+	"github.com/aporeto-inc/trireme/policy"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	// DefaultRevalidationInterval is the default window in which the identity updates
+	// of the peers are applied to the flows accepted from them
+	DefaultRevalidationInterval = 10 * time.Second
+
+	// peerFlowLifetime is the default time a flow accepted from a peer is revalidated.
+	// The datapath does not see the end of the flows.
+	peerFlowLifetime = time.Hour
+)
+
+// FlowRevoker is called with the flows that are no longer accepted after an identity
+// update of their peer. It can be used to terminate the connections.
+type FlowRevoker func(flow *FlowState)
+
+// peerIdentity is the last identity known for a peer
+type peerIdentity struct {
+	revision string
+	tags     *policy.TagsMap
+}
+
+// peerFlow is a flow accepted from a peer with the identity it was accepted with
+type peerFlow struct {
+	context  *PUContext
+	flow     *FlowState
+	peer     string
+	revision string
+	tags     *policy.TagsMap
+}
+
+// peerIdentities tracks the identities of the peers and the updates that must be
+// applied to the flows
+type peerIdentities struct {
+	identities map[string]*peerIdentity
+	pending    map[string]bool
+	interval   time.Duration
+	revoker    FlowRevoker
+	keepalive  KeepaliveConfig
+	sync.Mutex
+}
+
+func newPeerIdentities() *peerIdentities {
+
+	return &peerIdentities{
+		identities: map[string]*peerIdentity{},
+		pending:    map[string]bool{},
+		interval:   DefaultRevalidationInterval,
+		keepalive: KeepaliveConfig{
+			Interval: DefaultKeepaliveInterval,
+			Action:   KeepaliveIgnore,
+			MaxAge:   peerFlowLifetime,
+		},
+	}
+}
+
+// identityRevision returns a short fingerprint of the identity transmitted by a PU
+func identityRevision(tags *policy.TagsMap) string {
+
+	data, err := json.Marshal(tags)
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// UpdatePeerIdentity records the new identity of a peer. The policy resolver can push
+// the updates it learns about. The flows accepted from the peer are revalidated
+// within the revalidation interval.
+func (d *datapathEnforcer) UpdatePeerIdentity(peer string, revision string, tags *policy.TagsMap) {
+
+	d.peers.Lock()
+	defer d.peers.Unlock()
+
+	d.updatePeerIdentity(peer, revision, tags)
+}
+
+// updatePeerIdentity records the identity of a peer and schedules the revalidation of
+// its flows if it changed. It must be called with the lock held.
+func (d *datapathEnforcer) updatePeerIdentity(peer string, revision string, tags *policy.TagsMap) {
+
+	current, ok := d.peers.identities[peer]
+	if ok && current.revision == revision {
+		return
+	}
+
+	d.peers.identities[peer] = &peerIdentity{revision: revision, tags: tags}
+
+	if ok {
+		d.peers.pending[peer] = true
+	}
+}
+
+// SetRevalidationInterval sets the window in which identity updates are applied
+func (d *datapathEnforcer) SetRevalidationInterval(interval time.Duration) {
+
+	d.peers.Lock()
+	defer d.peers.Unlock()
+
+	d.peers.interval = interval
+}
+
+// SetFlowRevoker sets the function called with the flows revoked by identity updates
+func (d *datapathEnforcer) SetFlowRevoker(revoker FlowRevoker) {
+
+	d.peers.Lock()
+	defer d.peers.Unlock()
+
+	d.peers.revoker = revoker
+}
+
+// trackPeerFlow remembers a flow accepted from a peer with its identity. The tokens of
+// peers that transmit a new revision of their identity schedule the revalidation of the
+// flows accepted with the previous one.
+func (d *datapathEnforcer) trackPeerFlow(context *PUContext, tcpPacket *packet.Packet, peer string, claims *tokens.ConnectionClaims) {
+
+	tags := verifiedIdentity(claims)
+
+	d.peers.Lock()
+	if claims.RV != "" {
+		d.updatePeerIdentity(peer, claims.RV, tags)
+	}
+	maxAge := d.peers.keepalive.MaxAge
+	d.peers.Unlock()
+
+	d.peerFlows.AddOrUpdate(tcpPacket.L4FlowHash(), &peerFlow{
+		context: context,
+		flow: &FlowState{
+			Kind:            TokenFlow,
+			ContextID:       context.ID,
+			SourceIP:        tcpPacket.SourceAddress.String(),
+			DestinationIP:   tcpPacket.DestinationAddress.String(),
+			SourcePort:      tcpPacket.SourcePort,
+			DestinationPort: tcpPacket.DestinationPort,
+			Protocol:        tcpPacket.IPProto,
+			Expiry:          d.clock.Now().Add(maxAge),
+			Revision:        context.revision,
+		},
+		peer:     peer,
+		revision: claims.RV,
+		tags:     tags,
+	})
+}
+
+// revalidatePeerFlows evaluates the flows of the peers whose identity changed against
+// the policy of their PU with the new identity. It returns the flows revoked.
+func (d *datapathEnforcer) revalidatePeerFlows() []*FlowState {
+
+	d.peers.Lock()
+	pending := d.peers.pending
+	d.peers.pending = map[string]bool{}
+	identities := map[string]*peerIdentity{}
+	for peer := range pending {
+		identities[peer] = d.peers.identities[peer]
+	}
+	revoker := d.peers.revoker
+	d.peers.Unlock()
+
+	revoked := []*FlowState{}
+
+	if len(identities) == 0 {
+		return revoked
+	}
+
+	for hash, pf := range d.activePeerFlows() {
+
+		identity, ok := identities[pf.peer]
+		if !ok || pf.revision == identity.revision {
+			continue
+		}
+
+		if pf.accepted(identity.tags) {
+			d.peerFlows.AddOrUpdate(hash, &peerFlow{
+				context:  pf.context,
+				flow:     pf.flow,
+				peer:     pf.peer,
+				revision: identity.revision,
+				tags:     identity.tags,
+			})
+			continue
+		}
+
+		d.peerFlows.Remove(hash)
+
+		d.collector.CollectFlowEvent(&collector.FlowRecord{
+			ContextID:       pf.context.ID,
+			SourceID:        pf.peer,
+			DestinationID:   pf.context.ManagementID,
+			Tags:            pf.context.Annotations,
+			Action:          collector.FlowReject,
+			Mode:            collector.IdentityRevoked,
+			SourceIP:        pf.flow.SourceIP,
+			DestinationIP:   pf.flow.DestinationIP,
+			DestinationPort: pf.flow.DestinationPort,
+		})
+
+		d.evictVerdict(pf.flow)
+
+		if revoker != nil {
+			revoker(pf.flow)
+		}
+
+		revoked = append(revoked, pf.flow)
+	}
+
+	if len(revoked) > 0 {
+		log.WithFields(log.Fields{
+			"package": "enforcer",
+			"flows":   len(revoked),
+		}).Info("Flows revoked after identity updates of their peers")
+	}
+
+	return revoked
+}
+
+// accepted returns true if the flow is accepted by the current policy of its PU
+// with the given identity of the peer
+func (pf *peerFlow) accepted(identity *policy.TagsMap) bool {
+
+	tags := identity.Clone()
+	tags.Add(PortNumberLabelString, strconv.Itoa(int(pf.flow.DestinationPort)))
+
+	rejected, _ := pf.context.rejectRcvRules.Search(tags)
+	accepted, _ := pf.context.acceptRcvRules.Search(tags)
+
+	return rejected < 0 && accepted >= 0
+}
+
+// activePeerFlows returns the tracked flows by flow hash with the current context of
+// their PU. The flows older than their maximum age or of deleted PUs are forgotten.
+func (d *datapathEnforcer) activePeerFlows() map[string]*peerFlow {
+
+	now := d.clock.Now()
+	flows := map[string]*peerFlow{}
+
+	for _, hash := range d.peerFlows.KeyList() {
+
+		entry, err := d.peerFlows.Get(hash)
+		if err != nil {
+			continue
+		}
+
+		pf := entry.(*peerFlow)
+		context, ok := d.currentContext(pf.flow)
+		if !ok || pf.flow.Expiry.Before(now) {
+			d.peerFlows.Remove(hash)
+			continue
+		}
+
+		if context != pf.context {
+			pf = &peerFlow{
+				context:  context,
+				flow:     pf.flow,
+				peer:     pf.peer,
+				revision: pf.revision,
+				tags:     pf.tags,
+			}
+			d.peerFlows.AddOrUpdate(hash, pf)
+		}
+
+		flows[hash.(string)] = pf
+	}
+
+	return flows
+}
+
+// currentContext returns the context that enforces the policy of the PU of a flow.
+// A policy update replaces the context of the PU.
+func (d *datapathEnforcer) currentContext(flow *FlowState) (*PUContext, bool) {
+
+	hashSlice, err := d.contextTracker.Get(flow.ContextID)
+	if err != nil {
+		return nil, false
+	}
+
+	var context *PUContext
+
+	for _, hash := range hashSlice.([]*DualHash) {
+		c, err := d.puTracker.Get(hash.net)
+		if err != nil {
+			continue
+		}
+
+		if context == nil || hash.net == flow.DestinationIP {
+			context = c.(*PUContext)
+		}
+	}
+
+	return context, context != nil
+}
+
+// startRevalidation applies the identity updates of the peers periodically
+func (d *datapathEnforcer) startRevalidation() {
+
+	for {
+		d.peers.Lock()
+		interval := d.peers.interval
+		d.peers.Unlock()
+
+		d.clock.Sleep(interval)
+		d.revalidatePeerFlows()
+	}
+}
+
+// verifiedIdentity returns the identity of the peer verified in its token, without
+// the port label added to the claims by the receiver
+func verifiedIdentity(claims *tokens.ConnectionClaims) *policy.TagsMap {
+
+	tags := claims.T.Clone()
+	delete(tags.Tags, PortNumberLabelString)
+
+	return tags
+}
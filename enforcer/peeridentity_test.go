@@ -0,0 +1,168 @@
+package enforcer
+
+import (
+	"testing"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/enforcer/utils/packet"
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+	"github.com/aporeto-inc/trireme/policy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPeerIdentityUpdates(t *testing.T) {
+
+	Convey("Given I create an enforcer with a processing unit that accepts web peers", t, func() {
+
+		acceptWeb := &policy.TagSelector{
+			Clause: []policy.KeyValueOperator{
+				{
+					Key:      "app",
+					Value:    []string{"web"},
+					Operator: policy.Equal,
+				},
+			},
+			Action: policy.Accept,
+		}
+
+		secret := tokens.NewPSKSecrets([]byte("Dummy Test Password"))
+		enforcer := NewDefaultDatapathEnforcer("SomeServerId", &collector.DefaultCollector{}, nil, secret, constants.LocalContainer).(*datapathEnforcer)
+		enforcer.Enforce("SomeProcessingUnitId1", intraHostPUInfo("SomeProcessingUnitId1", "164.67.228.152", acceptWeb))
+
+		revoked := []*FlowState{}
+		enforcer.SetFlowRevoker(func(flow *FlowState) {
+			revoked = append(revoked, flow)
+		})
+
+		context, err := enforcer.puTracker.Get("164.67.228.152")
+		So(err, ShouldBeNil)
+
+		syn, err := packet.New(0, append([]byte{}, TCPFlow[0]...), "0")
+		So(err, ShouldBeNil)
+
+		claims := &tokens.ConnectionClaims{
+			T:  policy.NewTagsMap(map[string]string{TransmitterLabel: "peer", "app": "web"}),
+			RV: "1",
+		}
+		enforcer.trackPeerFlow(context.(*PUContext), syn, "peer", claims)
+
+		Convey("When the tokens of the processing unit are created", func() {
+
+			token := enforcer.createPacketToken(false, context.(*PUContext), &AuthInfo{LocalContext: make([]byte, 32)})
+			decoded, _ := enforcer.tokenEngine.Decode(false, token, nil)
+
+			Convey("Then they should carry the revision of its identity", func() {
+				So(decoded, ShouldNotBeNil)
+				So(decoded.RV, ShouldNotBeEmpty)
+				So(decoded.RV, ShouldEqual, context.(*PUContext).identityRevision)
+			})
+		})
+
+		Convey("When the peer keeps the same revision", func() {
+
+			enforcer.UpdatePeerIdentity("peer", "1", policy.NewTagsMap(map[string]string{"app": "db"}))
+
+			Convey("Then no flow should be revoked", func() {
+				So(enforcer.revalidatePeerFlows(), ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the new identity of the peer is still accepted", func() {
+
+			enforcer.UpdatePeerIdentity("peer", "2", policy.NewTagsMap(map[string]string{"app": "web", "env": "prod"}))
+
+			Convey("Then no flow should be revoked", func() {
+				So(enforcer.revalidatePeerFlows(), ShouldBeEmpty)
+				So(revoked, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the new identity of the peer is no longer accepted", func() {
+
+			enforcer.UpdatePeerIdentity("peer", "2", policy.NewTagsMap(map[string]string{"app": "db"}))
+
+			Convey("Then the flow should be revoked once", func() {
+				flows := enforcer.revalidatePeerFlows()
+				So(len(flows), ShouldEqual, 1)
+				So(flows[0].SourceIP, ShouldEqual, syn.SourceAddress.String())
+				So(revoked, ShouldResemble, flows)
+				So(enforcer.revalidatePeerFlows(), ShouldBeEmpty)
+			})
+		})
+
+		Convey("When a new token of the peer carries a new revision", func() {
+
+			syn2, err := packet.New(0, append([]byte{}, TCPFlow[0]...), "0")
+			So(err, ShouldBeNil)
+			syn2.SourcePort++
+
+			enforcer.trackPeerFlow(context.(*PUContext), syn2, "peer", &tokens.ConnectionClaims{
+				T:  policy.NewTagsMap(map[string]string{TransmitterLabel: "peer", "app": "db"}),
+				RV: "2",
+			})
+
+			Convey("Then only the flow accepted with the previous revision should be revoked", func() {
+				flows := enforcer.revalidatePeerFlows()
+				So(len(flows), ShouldEqual, 1)
+				So(flows[0].SourcePort, ShouldEqual, syn.SourcePort)
+			})
+		})
+	})
+}
+
+func TestFlowRecordPeerIdentity(t *testing.T) {
+
+	Convey("Given I create an enforcer with two processing units of different apps", t, func() {
+
+		acceptAll := &policy.TagSelector{
+			Clause: []policy.KeyValueOperator{
+				{
+					Key:      PortNumberLabelString,
+					Value:    []string{"80"},
+					Operator: policy.Equal,
+				},
+			},
+			Action: policy.Accept,
+		}
+
+		flows := &flowCollector{}
+		secret := tokens.NewPSKSecrets([]byte("Dummy Test Password"))
+		enforcer := NewDefaultDatapathEnforcer("SomeServerId", flows, nil, secret, constants.LocalContainer).(*datapathEnforcer)
+
+		apps := map[string]string{"164.67.228.152": "web", "10.1.10.76": "db"}
+		for ip, app := range apps {
+			puInfo := intraHostPUInfo("PU-"+app, ip, acceptAll)
+			puInfo.Policy.AddIdentityTag("app", app)
+			So(enforcer.Enforce("PU-"+app, puInfo), ShouldBeNil)
+		}
+
+		Convey("When a connection is established between them", func() {
+
+			for _, p := range TCPFlow {
+				tcpPacket, err := packet.New(0, append([]byte{}, p...), "0")
+				So(err, ShouldBeNil)
+				So(enforcer.processApplicationTCPPackets(tcpPacket), ShouldBeNil)
+
+				outPacket, err := packet.New(0, append([]byte{}, tcpPacket.GetBytes()...), "0")
+				So(err, ShouldBeNil)
+				So(enforcer.processNetworkTCPPackets(outPacket), ShouldBeNil)
+			}
+
+			Convey("Then the accepted flow should carry the verified identity of the peer", func() {
+
+				var accepted *collector.FlowRecord
+				for _, flow := range flows.flows {
+					if flow.Action == collector.FlowAccept {
+						accepted = flow
+					}
+				}
+
+				So(accepted, ShouldNotBeNil)
+				So(accepted.PeerIdentity, ShouldNotBeNil)
+				So(accepted.PeerIdentity.Tags["app"], ShouldEqual, apps[accepted.SourceIP])
+				So(accepted.PeerIdentity.Tags, ShouldNotContainKey, PortNumberLabelString)
+			})
+		})
+	})
+}
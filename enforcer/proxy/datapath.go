@@ -0,0 +1,183 @@
+package enforcerproxy
+
+import (
+	"fmt"
+	"net"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aporeto-inc/trireme/enforcer"
+	"github.com/aporeto-inc/trireme/enforcer/utils/rpcwrapper"
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+	"github.com/aporeto-inc/trireme/utils/errortypes"
+)
+
+// SetIntraHostMode is part of the IntraHostConfigurer interface. It applies to the
+// running remote enforcers and to the ones initialized afterwards.
+func (s *proxyInfo) SetIntraHostMode(mode enforcer.IntraHostMode) error {
+
+	s.datapathLock.Lock()
+	s.datapath.IntraHostMode = mode
+	s.datapathLock.Unlock()
+
+	return s.updateDatapath()
+}
+
+// SetInteropPolicies is part of the InteropConfigurer interface. It applies to the
+// running remote enforcers and to the ones initialized afterwards.
+func (s *proxyInfo) SetInteropPolicies(policies []*enforcer.InteropPolicy) error {
+
+	for _, p := range policies {
+		if _, _, err := net.ParseCIDR(p.Network); err != nil {
+			return fmt.Errorf("Invalid interop network %s: %s", p.Network, err)
+		}
+	}
+
+	s.datapathLock.Lock()
+	s.datapath.InteropPolicies = append([]*enforcer.InteropPolicy{}, policies...)
+	s.datapathLock.Unlock()
+
+	return s.updateDatapath()
+}
+
+// RegisterExternalEndpoint is part of the ExternalEndpointRegistry interface. It
+// applies to the running remote enforcers and to the ones initialized afterwards.
+func (s *proxyInfo) RegisterExternalEndpoint(endpoint *enforcer.ExternalEndpoint) error {
+
+	if endpoint.Name == "" {
+		return fmt.Errorf("External endpoint name is empty")
+	}
+
+	if _, _, err := net.ParseCIDR(endpoint.Network); err != nil {
+		return fmt.Errorf("Invalid network %s for external endpoint %s: %s", endpoint.Network, endpoint.Name, err)
+	}
+
+	s.datapathLock.Lock()
+	endpoints := []*enforcer.ExternalEndpoint{}
+	for _, e := range s.datapath.ExternalEndpoints {
+		if e.Name != endpoint.Name {
+			endpoints = append(endpoints, e)
+		}
+	}
+	s.datapath.ExternalEndpoints = append(endpoints, endpoint)
+	s.datapathLock.Unlock()
+
+	return s.updateDatapath()
+}
+
+// UnregisterExternalEndpoint is part of the ExternalEndpointRegistry interface
+func (s *proxyInfo) UnregisterExternalEndpoint(name string) error {
+
+	s.datapathLock.Lock()
+	endpoints := []*enforcer.ExternalEndpoint{}
+	for _, e := range s.datapath.ExternalEndpoints {
+		if e.Name != name {
+			endpoints = append(endpoints, e)
+		}
+	}
+	found := len(endpoints) != len(s.datapath.ExternalEndpoints)
+	s.datapath.ExternalEndpoints = endpoints
+	s.datapathLock.Unlock()
+
+	if !found {
+		return fmt.Errorf("External endpoint %s not found", name)
+	}
+
+	return s.updateDatapath()
+}
+
+// ExternalEndpoints is part of the ExternalEndpointRegistry interface
+func (s *proxyInfo) ExternalEndpoints() []*enforcer.ExternalEndpoint {
+
+	s.datapathLock.Lock()
+	defer s.datapathLock.Unlock()
+
+	return append([]*enforcer.ExternalEndpoint{}, s.datapath.ExternalEndpoints...)
+}
+
+// SetTagBudget is part of the TagBudgetConfigurer interface. It applies to the
+// running remote enforcers and to the ones initialized afterwards.
+func (s *proxyInfo) SetTagBudget(budget *tokens.TagBudget) error {
+
+	s.datapathLock.Lock()
+	s.datapath.TagBudget = budget
+	s.datapathLock.Unlock()
+
+	return s.updateDatapath()
+}
+
+// EnableMTLS is part of the MTLSConfigurer interface. The remote enforcers use their
+// own PKI secrets, so the secrets of the configuration are ignored. It applies to the
+// running remote enforcers and to the ones initialized afterwards.
+func (s *proxyInfo) EnableMTLS(config *enforcer.MTLSConfig) error {
+
+	if config == nil || config.ClientPort == 0 || config.ServerPort == 0 {
+		return fmt.Errorf("Mutual TLS requires a client and a server port")
+	}
+
+	for _, n := range config.Networks {
+		if _, _, err := net.ParseCIDR(n); err != nil {
+			return fmt.Errorf("Invalid mutual TLS network %s: %s", n, err)
+		}
+	}
+
+	s.datapathLock.Lock()
+	s.datapath.MTLS = &rpcwrapper.MTLSPayload{
+		Networks:   append([]string{}, config.Networks...),
+		ClientPort: config.ClientPort,
+		ServerPort: config.ServerPort,
+	}
+	s.datapathLock.Unlock()
+
+	return s.updateDatapath()
+}
+
+// DisableMTLS is part of the MTLSConfigurer interface
+func (s *proxyInfo) DisableMTLS() {
+
+	s.datapathLock.Lock()
+	s.datapath.MTLS = nil
+	s.datapathLock.Unlock()
+
+	s.warnDatapath(s.updateDatapath())
+}
+
+// datapathSettings returns the current settings of the datapath. The lists are
+// replaced and never modified, so that they can be shared with the payloads.
+func (s *proxyInfo) datapathSettings() rpcwrapper.DatapathSettingsPayload {
+
+	s.datapathLock.Lock()
+	defer s.datapathLock.Unlock()
+
+	return s.datapath
+}
+
+// updateDatapath sends the settings of the datapath to the running remote enforcers
+func (s *proxyInfo) updateDatapath() error {
+
+	settings := s.datapathSettings()
+
+	request := &rpcwrapper.Request{
+		Payload: &settings,
+	}
+
+	for _, contextID := range s.rpchdl.ContextList() {
+		if err := s.rpchdl.RemoteCall(contextID, "Server.UpdateDatapath", request, &rpcwrapper.Response{}); err != nil {
+			return errortypes.Wrapf(nil, err, "Failed to update the datapath of %s", contextID)
+		}
+	}
+
+	return nil
+}
+
+// warnDatapath logs the failure of the settings without error
+func (s *proxyInfo) warnDatapath(err error) {
+
+	if err == nil {
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"package": "enforcerproxy",
+		"error":   err.Error(),
+	}).Warn("Failed to update the datapath of the remote enforcers")
+}
@@ -0,0 +1,94 @@
+package enforcerproxy
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aporeto-inc/trireme/enforcer"
+	"github.com/aporeto-inc/trireme/enforcer/utils/rpcwrapper"
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDatapathSettings(t *testing.T) {
+	Convey("Given a proxy with a running remote enforcer", t, func() {
+		rpchdl := rpcwrapper.NewTestRPCClient()
+		s := &proxyInfo{
+			rpchdl:   rpchdl,
+			initDone: map[string]bool{"context": true},
+		}
+
+		rpchdl.MockContextList(t, func() []string {
+			return []string{"context"}
+		})
+
+		sent := []rpcwrapper.DatapathSettingsPayload{}
+		rpchdl.MockRemoteCall(t, func(contextID string, methodName string, req *rpcwrapper.Request, resp *rpcwrapper.Response) error {
+			if methodName == "Server.UpdateDatapath" {
+				sent = append(sent, *req.Payload.(*rpcwrapper.DatapathSettingsPayload))
+			}
+			return nil
+		})
+
+		Convey("When I change the settings, they should be sent to the remote enforcer", func() {
+			So(s.SetIntraHostMode(enforcer.IntraHostLocal), ShouldBeNil)
+			So(s.SetInteropPolicies([]*enforcer.InteropPolicy{{Network: "10.0.0.0/8", Mode: enforcer.InteropACL}}), ShouldBeNil)
+			So(s.RegisterExternalEndpoint(&enforcer.ExternalEndpoint{Name: "db", Network: "10.1.0.0/16"}), ShouldBeNil)
+			So(s.SetTagBudget(&tokens.TagBudget{MaxSize: 512}), ShouldBeNil)
+
+			So(len(sent), ShouldEqual, 4)
+			last := sent[3]
+			So(last.IntraHostMode, ShouldEqual, enforcer.IntraHostLocal)
+			So(len(last.InteropPolicies), ShouldEqual, 1)
+			So(len(last.ExternalEndpoints), ShouldEqual, 1)
+			So(last.TagBudget.MaxSize, ShouldEqual, 512)
+
+			Convey("Then a registered endpoint should be replaced and unregistered by name", func() {
+				So(s.RegisterExternalEndpoint(&enforcer.ExternalEndpoint{Name: "db", Network: "10.2.0.0/16"}), ShouldBeNil)
+				So(s.ExternalEndpoints(), ShouldHaveLength, 1)
+				So(s.ExternalEndpoints()[0].Network, ShouldEqual, "10.2.0.0/16")
+
+				So(s.UnregisterExternalEndpoint("db"), ShouldBeNil)
+				So(s.ExternalEndpoints(), ShouldBeEmpty)
+				So(sent[len(sent)-1].ExternalEndpoints, ShouldBeEmpty)
+				So(s.UnregisterExternalEndpoint("db"), ShouldNotBeNil)
+			})
+
+			Convey("Then the settings should be sent to the remote enforcers initialized afterwards", func() {
+				So(s.datapathSettings().IntraHostMode, ShouldEqual, enforcer.IntraHostLocal)
+			})
+		})
+
+		Convey("When I enable the mutual TLS mode, its settings should be sent to the remote enforcer", func() {
+			So(s.EnableMTLS(&enforcer.MTLSConfig{Networks: []string{"10.0.0.0/8"}, ClientPort: 5001, ServerPort: 5002}), ShouldBeNil)
+			So(len(sent), ShouldEqual, 1)
+			So(sent[0].MTLS.Networks, ShouldResemble, []string{"10.0.0.0/8"})
+			So(sent[0].MTLS.ServerPort, ShouldEqual, 5002)
+
+			Convey("Then disabling it should remove the settings", func() {
+				s.DisableMTLS()
+				So(len(sent), ShouldEqual, 2)
+				So(sent[1].MTLS, ShouldBeNil)
+			})
+		})
+
+		Convey("When the remote enforcer fails to apply the settings, the error should be returned", func() {
+			rpchdl.MockRemoteCall(t, func(contextID string, methodName string, req *rpcwrapper.Request, resp *rpcwrapper.Response) error {
+				return fmt.Errorf("remote failure")
+			})
+
+			So(s.SetIntraHostMode(enforcer.IntraHostLocal), ShouldNotBeNil)
+			So(s.SetTagBudget(&tokens.TagBudget{MaxSize: 512}), ShouldNotBeNil)
+		})
+
+		Convey("When I set invalid settings, they should be rejected without being sent", func() {
+			So(s.SetInteropPolicies([]*enforcer.InteropPolicy{{Network: "invalid"}}), ShouldNotBeNil)
+			So(s.RegisterExternalEndpoint(&enforcer.ExternalEndpoint{Name: "db", Network: "invalid"}), ShouldNotBeNil)
+			So(s.RegisterExternalEndpoint(&enforcer.ExternalEndpoint{Network: "10.1.0.0/16"}), ShouldNotBeNil)
+			So(s.EnableMTLS(&enforcer.MTLSConfig{Networks: []string{"invalid"}, ClientPort: 5001, ServerPort: 5002}), ShouldNotBeNil)
+			So(s.EnableMTLS(&enforcer.MTLSConfig{Networks: []string{"10.0.0.0/8"}}), ShouldNotBeNil)
+			So(sent, ShouldBeEmpty)
+		})
+	})
+}
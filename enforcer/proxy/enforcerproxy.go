@@ -6,6 +6,8 @@ package enforcerproxy
 import (
 	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
@@ -17,6 +19,7 @@ import (
 	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
 	"github.com/aporeto-inc/trireme/policy"
 	"github.com/aporeto-inc/trireme/processmon"
+	"github.com/aporeto-inc/trireme/utils/errortypes"
 )
 
 //keyPEM is a private interface required by the enforcerlauncher to expose method not exposed by the
@@ -39,6 +42,9 @@ var ErrEnforceFailed = errors.New("Failed to enforce rules")
 // ErrInitFailed exported
 var ErrInitFailed = errors.New("Failed remote Init")
 
+// healthCheckTimeout is the time a remote enforcer has to respond to a health check
+var healthCheckTimeout = 5 * time.Second
+
 //proxyInfo is the struct used to hold state about active enforcers in the system
 type proxyInfo struct {
 	MutualAuth        bool
@@ -51,6 +57,16 @@ type proxyInfo struct {
 	filterQueue       *enforcer.FilterQueue
 	commandArg        string
 	statsServerSecret string
+	controllerLoss    enforcer.ControllerLossConfig
+	flowKey           []collector.FlowKeyField
+	statsBatch        enforcer.StatsBatchConfig
+	flowVolumes       time.Duration
+	latencies         time.Duration
+	ruleStats         time.Duration
+	calls             *rpcwrapper.CallQueue
+	stats             *StatsServer
+	datapath          rpcwrapper.DatapathSettingsPayload
+	datapathLock      sync.Mutex
 }
 
 //InitRemoteEnforcer method makes a RPC call to the remote enforcer
@@ -67,6 +83,15 @@ func (s *proxyInfo) InitRemoteEnforcer(contextID string) error {
 			CAPEM:      s.Secrets.(keyPEM).AuthPEM(),
 			PublicPEM:  s.Secrets.(keyPEM).TransmittedPEM(),
 			PrivatePEM: s.Secrets.(keyPEM).EncodingPEM(),
+
+			ControllerLoss: s.controllerLoss,
+			FlowKey:        s.flowKey,
+			Federations:    federations(s.Secrets),
+			StatsBatch:     s.statsBatch,
+			FlowVolumes:    s.flowVolumes,
+			Latencies:      s.latencies,
+			RuleStats:      s.ruleStats,
+			Datapath:       s.datapathSettings(),
 		},
 	}
 
@@ -76,7 +101,7 @@ func (s *proxyInfo) InitRemoteEnforcer(contextID string) error {
 			"error":          err.Error(),
 			"Error Response": resp.Status,
 		}).Debug("Failed to initialize enforcer")
-		return fmt.Errorf("Failed to initialize remote enforcer")
+		return errortypes.Wrapf(nil, err, "Failed to initialize remote enforcer")
 	}
 
 	s.initDone[contextID] = true
@@ -84,15 +109,238 @@ func (s *proxyInfo) InitRemoteEnforcer(contextID string) error {
 	return nil
 }
 
+// UpdateFederations is part of the FederationUpdater interface. The remote enforcers
+// initialized afterwards receive the federations of the secrets at initialization.
+func (s *proxyInfo) UpdateFederations() error {
+
+	request := &rpcwrapper.Request{
+		Payload: &rpcwrapper.FederationsPayload{
+			Federations: federations(s.Secrets),
+		},
+	}
+
+	for _, contextID := range s.rpchdl.ContextList() {
+		if err := s.rpchdl.RemoteCall(contextID, "Server.UpdateFederations", request, &rpcwrapper.Response{}); err != nil {
+			return errortypes.Wrapf(nil, err, "Failed to update the federations of %s", contextID)
+		}
+	}
+
+	return nil
+}
+
+// UpdateSecrets is part of the SecretsUpdater interface. The secrets of the proxy are
+// rotated, so that the remote enforcers initialized afterwards receive the new keys,
+// and the running remote enforcers rotate their secrets in place. The secrets are sent
+// to all the running remote enforcers even if some of them fail, and the failures are
+// returned together.
+func (s *proxyInfo) UpdateSecrets(secrets tokens.Secrets) error {
+
+	rotation, ok := s.Secrets.(tokens.RotatableSecrets)
+	if !ok {
+		return errortypes.Errorf(nil, "The secrets of the enforcers cannot be rotated")
+	}
+
+	if err := rotation.UpdateSecrets(secrets); err != nil {
+		return errortypes.Wrapf(nil, err, "Failed to rotate the secrets")
+	}
+
+	request := &rpcwrapper.Request{
+		Payload: &rpcwrapper.UpdateSecretsPayload{
+			SecretType: s.Secrets.Type(),
+			CAPEM:      s.Secrets.(keyPEM).AuthPEM(),
+			PublicPEM:  s.Secrets.(keyPEM).TransmittedPEM(),
+			PrivatePEM: s.Secrets.(keyPEM).EncodingPEM(),
+		},
+	}
+
+	failed := []string{}
+
+	for _, contextID := range s.rpchdl.ContextList() {
+		if err := s.rpchdl.RemoteCall(contextID, "Server.UpdateSecrets", request, &rpcwrapper.Response{}); err != nil {
+			log.WithFields(log.Fields{
+				"package":   "enforcerproxy",
+				"contextID": contextID,
+				"error":     err.Error(),
+			}).Error("Failed to update the secrets of the remote enforcer")
+			failed = append(failed, contextID+": "+err.Error())
+		}
+	}
+
+	if len(failed) > 0 {
+		return errortypes.Errorf(nil, "Failed to update the secrets of the remote enforcers %s", strings.Join(failed, ", "))
+	}
+
+	return nil
+}
+
+// federations returns the federated deployments of the secrets, if they trust any
+func federations(secrets tokens.Secrets) []*tokens.Federation {
+
+	if f, ok := secrets.(tokens.FederatedSecrets); ok {
+		return f.Federations()
+	}
+
+	return nil
+}
+
+// SetControllerLoss is part of the ControllerLossConfigurer interface. It applies to
+// the remote enforcers initialized afterwards.
+func (s *proxyInfo) SetControllerLoss(config *enforcer.ControllerLossConfig) {
+
+	s.controllerLoss = *config
+}
+
+// SetFlowAggregation is part of the FlowAggregationConfigurer interface. It applies to
+// the remote enforcers initialized afterwards.
+func (s *proxyInfo) SetFlowAggregation(fields []collector.FlowKeyField) {
+
+	s.flowKey = fields
+}
+
+// SetStatsBatch is part of the StatsBatchConfigurer interface. It applies to the
+// remote enforcers initialized afterwards.
+func (s *proxyInfo) SetStatsBatch(config *enforcer.StatsBatchConfig) {
+
+	s.statsBatch = *config
+}
+
+// SetFlowVolumes is part of the FlowVolumeConfigurer interface. It applies to the
+// remote enforcers initialized afterwards.
+func (s *proxyInfo) SetFlowVolumes(interval time.Duration) {
+
+	s.flowVolumes = interval
+}
+
+// SetHandshakeLatencies is part of the LatencyConfigurer interface. It applies to the
+// remote enforcers initialized afterwards.
+func (s *proxyInfo) SetHandshakeLatencies(interval time.Duration) {
+
+	s.latencies = interval
+}
+
+// SetRuleStats is part of the RuleStatsConfigurer interface. It applies to the remote
+// enforcers initialized afterwards.
+func (s *proxyInfo) SetRuleStats(interval time.Duration) {
+
+	s.ruleStats = interval
+}
+
 //Enforcer: Enforce method makes a RPC call for the remote enforcer enforce emthod
+// The policies received while the remote enforcer of the PU is starting, or while
+// another call is in progress, are coalesced and only the latest one is applied.
 func (s *proxyInfo) Enforce(contextID string, puInfo *policy.PUInfo) error {
 
-	log.WithFields(log.Fields{
-		"package": "enforcerproxy",
-		"pid":     puInfo.Runtime.Pid(),
-	}).Info("PID of container")
+	if !s.calls.Acquire(contextID, puInfo) {
+		log.WithFields(log.Fields{
+			"package":   "enforcerproxy",
+			"contextID": contextID,
+		}).Debug("Queued the policy until the remote enforcer is ready")
+		return nil
+	}
+
+	return s.drain(contextID, s.enforce(contextID, puInfo))
+}
+
+// Unenforce stops enforcing policy for the given contexID. It is applied after the
+// call in progress for the PU, if any.
+func (s *proxyInfo) Unenforce(contextID string) error {
+
+	if !s.calls.Acquire(contextID, nil) {
+		log.WithFields(log.Fields{
+			"package":   "enforcerproxy",
+			"contextID": contextID,
+		}).Debug("Queued the unenforce until the remote enforcer is ready")
+		return nil
+	}
+
+	return s.drain(contextID, s.unenforce(contextID))
+}
+
+// drain makes the call queued for the context while its previous call was in
+// progress. The callers of the queued calls already returned, so their errors are
+// only logged. It returns the error of the previous call.
+func (s *proxyInfo) drain(contextID string, err error) error {
+
+	for {
+		call, ok := s.calls.Next(contextID)
+		if !ok {
+			return err
+		}
+
+		var qerr error
+		if puInfo, ok := call.(*policy.PUInfo); ok {
+			qerr = s.enforce(contextID, puInfo)
+		} else {
+			qerr = s.unenforce(contextID)
+		}
+
+		if qerr != nil {
+			log.WithFields(log.Fields{
+				"package":   "enforcerproxy",
+				"contextID": contextID,
+				"error":     qerr.Error(),
+			}).Error("Failed to apply the queued call to the remote enforcer")
+		}
+	}
+}
+
+// enforce launches the remote enforcer of the PU if needed and sends it the policy
+func (s *proxyInfo) enforce(contextID string, puInfo *policy.PUInfo) error {
+
+	if err := s.LaunchRemoteEnforcer(contextID, puInfo); err != nil {
+		return err
+	}
+
+	request := &rpcwrapper.Request{
+		Payload: rpcwrapper.NewEnforcePayload(contextID, puInfo),
+	}
+
+	if err := s.rpchdl.RemoteCall(contextID, "Server.Enforce", request, &rpcwrapper.Response{}); err != nil {
+		log.WithFields(log.Fields{
+			"package": "remenforcer",
+			"error":   err,
+		}).Error("Failed to Enforce remote enforcer")
+		return enforceFailed(err)
+	}
+
+	return nil
+}
+
+// enforceFailed returns the error of a remote enforcer that failed to enforce or
+// unenforce a policy. It is ErrEnforceFailed itself when the remote error has no
+// category. Otherwise it has the category of the remote error and is caused by
+// ErrEnforceFailed, so that errortypes.Is matches both.
+func enforceFailed(err error) error {
+
+	category := errortypes.Category(err)
+	if category == nil {
+		return ErrEnforceFailed
+	}
+
+	return errortypes.Wrapf(category, ErrEnforceFailed, "%s", err)
+}
+
+// LaunchRemoteEnforcer launches and initializes the remote enforcer of the PU, unless
+// it is already running, without enforcing any policy
+func (s *proxyInfo) LaunchRemoteEnforcer(contextID string, puInfo *policy.PUInfo) error {
+
+	var err error
+
+	if netnsPath, ok := puInfo.Runtime.NetNSPath(); ok {
+		log.WithFields(log.Fields{
+			"package": "enforcerproxy",
+			"netns":   netnsPath,
+		}).Info("Network namespace of PU")
 
-	err := s.prochdl.LaunchProcess(contextID, puInfo.Runtime.Pid(), s.rpchdl, s.commandArg, s.statsServerSecret)
+		err = s.prochdl.LaunchProcessInNetns(contextID, netnsPath, s.rpchdl, s.commandArg, s.statsServerSecret)
+	} else {
+		log.WithFields(log.Fields{
+			"package": "enforcerproxy",
+			"pid":     puInfo.Runtime.Pid(),
+		}).Info("PID of container")
+
+		err = s.prochdl.LaunchProcess(contextID, puInfo.Runtime.Pid(), s.rpchdl, s.commandArg, s.statsServerSecret)
+	}
 	if err != nil {
 		return err
 	}
@@ -106,39 +354,40 @@ func (s *proxyInfo) Enforce(contextID string, puInfo *policy.PUInfo) error {
 		if err = s.InitRemoteEnforcer(contextID); err != nil {
 			return err
 		}
-
 	}
 
+	return nil
+}
+
+// FlushStats is part of the StatsFlusher interface. It returns once the remote
+// enforcer of the PU sent its flows to the stats server.
+func (s *proxyInfo) FlushStats(contextID string) error {
+
 	request := &rpcwrapper.Request{
-		Payload: &rpcwrapper.EnforcePayload{
-			ContextID:        contextID,
-			ManagementID:     puInfo.Policy.ManagementID,
-			TriremeAction:    puInfo.Policy.TriremeAction,
-			ApplicationACLs:  puInfo.Policy.ApplicationACLs(),
-			NetworkACLs:      puInfo.Policy.NetworkACLs(),
-			PolicyIPs:        puInfo.Policy.IPAddresses(),
-			Annotations:      puInfo.Policy.Annotations(),
-			Identity:         puInfo.Policy.Identity(),
-			ReceiverRules:    puInfo.Policy.ReceiverRules(),
-			TransmitterRules: puInfo.Policy.TransmitterRules(),
-			TriremeNetworks:  puInfo.Policy.TriremeNetworks(),
+		Payload: &rpcwrapper.FlushStatsPayload{
+			ContextID: contextID,
 		},
 	}
 
-	err = s.rpchdl.RemoteCall(contextID, "Server.Enforce", request, &rpcwrapper.Response{})
-	if err != nil {
-		log.WithFields(log.Fields{
-			"package": "remenforcer",
-			"error":   err,
-		}).Error("Failed to Enforce remote enforcer")
-		return ErrEnforceFailed
+	if err := s.rpchdl.RemoteCall(contextID, "Server.FlushStats", request, &rpcwrapper.Response{}); err != nil {
+		return errortypes.Wrapf(nil, err, "Failed to flush the stats of %s", contextID)
 	}
 
 	return nil
 }
 
-// Unenforce stops enforcing policy for the given contexID.
-func (s *proxyInfo) Unenforce(contextID string) error {
+// unenforce stops the enforcement of the remote enforcer of the PU
+func (s *proxyInfo) unenforce(contextID string) error {
+
+	// The remote enforcer exits with the PU, so the flows since the last stats
+	// would be lost
+	if err := s.FlushStats(contextID); err != nil {
+		log.WithFields(log.Fields{
+			"package":   "enforcerproxy",
+			"contextID": contextID,
+			"error":     err.Error(),
+		}).Warn("Failed to flush the stats before unenforcing")
+	}
 
 	request := &rpcwrapper.Request{
 		Payload: &rpcwrapper.UnEnforcePayload{
@@ -148,14 +397,30 @@ func (s *proxyInfo) Unenforce(contextID string) error {
 
 	err := s.rpchdl.RemoteCall(contextID, "Server.Unenforce", request, &rpcwrapper.Response{})
 	if err != nil {
+		// A dead remote enforcer enforces nothing, but its state must be forgotten
+		// so that it is launched and initialized again
+		if _, running, serr := s.prochdl.GetProcessStatus(contextID); serr == nil && running {
+			log.WithFields(log.Fields{
+				"package": "remenforcer",
+				"error":   err,
+			}).Error("Failed to Enforce remote enforcer")
+			return enforceFailed(err)
+		}
+
 		log.WithFields(log.Fields{
-			"package": "remenforcer",
-			"error":   err,
-		}).Error("Failed to Enforce remote enforcer")
-		return ErrEnforceFailed
+			"package":   "enforcerproxy",
+			"contextID": contextID,
+		}).Warn("Forgetting the remote enforcer that is not running")
+
+		delete(s.initDone, contextID)
+		s.stats.forget(contextID)
+		s.prochdl.KillProcess(contextID)
+
+		return nil
 	}
 
 	delete(s.initDone, contextID)
+	s.stats.forget(contextID)
 
 	if s.prochdl.GetExitStatus(contextID) == false {
 		s.prochdl.SetExitStatus(contextID, true)
@@ -181,13 +446,92 @@ func (s *proxyInfo) GetFilterQueue() *enforcer.FilterQueue {
 	return fqConfig
 }
 
+// RemoteEnforcerStatus returns the PID of the remote enforcer of a PU and whether it is running.
+func (s *proxyInfo) RemoteEnforcerStatus(contextID string) (int, bool, error) {
+
+	return s.prochdl.GetProcessStatus(contextID)
+}
+
+// HealthCheck is part of the RemoteEnforcerHealthChecker interface. The remote
+// enforcer must be running and respond before the health check timeout, so that a
+// remote enforcer that hangs is detected as well.
+func (s *proxyInfo) HealthCheck(contextID string) error {
+
+	_, running, err := s.prochdl.GetProcessStatus(contextID)
+	if err != nil {
+		return err
+	}
+
+	if !running {
+		return fmt.Errorf("Remote enforcer of %s is not running", contextID)
+	}
+
+	request := &rpcwrapper.Request{
+		Payload: &rpcwrapper.HealthCheckPayload{
+			ContextID: contextID,
+		},
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.rpchdl.RemoteCall(contextID, "Server.HealthCheck", request, &rpcwrapper.Response{})
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return errortypes.Wrapf(nil, err, "Remote enforcer of %s failed its health check", contextID)
+		}
+		return nil
+	case <-time.After(healthCheckTimeout):
+		return errortypes.Errorf(errortypes.ErrRPCTimeout, "Remote enforcer of %s did not respond in %s", contextID, healthCheckTimeout)
+	}
+}
+
+// AbortRemoteEnforcer is part of the RemoteEnforcerHealthChecker interface
+func (s *proxyInfo) AbortRemoteEnforcer(contextID string) error {
+
+	return s.prochdl.AbortProcess(contextID)
+}
+
+// StageRemoteEnforcer is part of the RemoteEnforcerUpdater interface. The remote
+// enforcers running keep their binary until they are launched again.
+func (s *proxyInfo) StageRemoteEnforcer(binary string) (string, error) {
+
+	previous := s.prochdl.EnforcerBinary()
+
+	if err := s.prochdl.SetEnforcerBinary(binary); err != nil {
+		return previous, err
+	}
+
+	log.WithFields(log.Fields{
+		"package":  "enforcerproxy",
+		"binary":   binary,
+		"previous": previous,
+	}).Info("Staged the binary of the remote enforcers")
+
+	return previous, nil
+}
+
+// RemoteEnforcerBinary is part of the RemoteEnforcerUpdater interface
+func (s *proxyInfo) RemoteEnforcerBinary(contextID string) (string, error) {
+
+	return s.prochdl.GetProcessBinary(contextID)
+}
+
 // Start starts the the remote enforcer proxy.
 func (s *proxyInfo) Start() error {
 	return nil
 }
 
-// Stop stops the remote enforcer.
+// Stop stops the remote enforcer. The server of the statistics stops and its socket
+// is removed.
 func (s *proxyInfo) Stop() error {
+
+	if s.stats != nil {
+		s.stats.rpchdl.Stop()
+	}
+
 	return nil
 }
 
@@ -227,17 +571,29 @@ func NewProxyEnforcer(mutualAuth bool,
 		filterQueue:       filterQueue,
 		commandArg:        cmdArg,
 		statsServerSecret: statsServersecret,
+		calls:             rpcwrapper.NewCallQueue(),
 	}
 	log.WithFields(log.Fields{
 		"package": "remenforcer",
 		"method":  "NewDataPathEnforcer",
 	}).Info("Called NewDataPathEnforcer")
 
-	statsServer := rpcwrapper.NewRPCWrapper()
-	rpcServer := &StatsServer{rpchdl: statsServer, collector: collector, secret: statsServersecret}
+	statsServer := rpcwrapper.NewRPCWrapper(rpcwrapper.WithTransport(rpcwrapper.TransportOf(rpchdl)))
+	statsServer.SetReadLimit(rpcwrapper.MaxStatsBytes, rpcwrapper.StatsLimitInterval)
+	statsServer.SetMessageLimit(rpcwrapper.MaxStatsMessageBytes)
+
+	rpcServer := &StatsServer{
+		rpchdl:    statsServer,
+		collector: collector,
+		secret:    statsServersecret,
+		prochdl:   proxydata.prochdl,
+		budgets:   map[string]*rpcwrapper.RecordBudget{},
+		streams:   map[string]*statsStream{},
+	}
+	proxydata.stats = rpcServer
 
 	// Start hte server for statistics collection
-	go statsServer.StartServer("unix", rpcwrapper.StatsChannel, rpcServer)
+	go statsServer.StartServer("unix", rpcwrapper.StatsChannelPath(), rpcServer)
 
 	return proxydata
 }
@@ -277,6 +633,55 @@ type StatsServer struct {
 	collector collector.EventCollector
 	rpchdl    rpcwrapper.RPCServer
 	secret    string
+	prochdl   processmon.ProcessManager
+	// budgets are the budgets of the flow records of the remote enforcers, per
+	// context, so that an enforcer cannot use up the budget of the others
+	budgets map[string]*rpcwrapper.RecordBudget
+	// streams are the positions in the stats of the remote enforcers, per context
+	streams map[string]*statsStream
+	sync.Mutex
+}
+
+// budget returns the budget of the flow records of the remote enforcer of a context
+func (r *StatsServer) budget(contextID string) *rpcwrapper.RecordBudget {
+
+	r.Lock()
+	defer r.Unlock()
+
+	budget, ok := r.budgets[contextID]
+	if !ok {
+		budget = rpcwrapper.NewRecordBudget(rpcwrapper.MaxStatsRecordsPerInterval, rpcwrapper.StatsLimitInterval)
+		r.budgets[contextID] = budget
+	}
+
+	return budget
+}
+
+// Register is called by a remote enforcer when it connects to the stats channel. It
+// fails unless the enforcer is the process launched for the context, so that the
+// enforcers that were not launched by this controller know that they lost it.
+func (r *StatsServer) Register(req rpcwrapper.Request, resp *rpcwrapper.Response) error {
+
+	if !r.rpchdl.ProcessMessage(&req, r.secret) {
+		return errors.New("Message sender cannot be verified")
+	}
+
+	payload, ok := req.Payload.(rpcwrapper.RegisterPayload)
+	if !ok {
+		return errors.New("Invalid register payload")
+	}
+
+	pid, running, err := r.prochdl.GetProcessStatus(payload.ContextID)
+	if err != nil || !running || pid != payload.Pid {
+		log.WithFields(log.Fields{
+			"package":   "enforcerproxy",
+			"contextID": payload.ContextID,
+			"pid":       payload.Pid,
+		}).Warn("Unknown remote enforcer registration")
+		return fmt.Errorf("Unknown remote enforcer %s", payload.ContextID)
+	}
+
+	return nil
 }
 
 //GetStats  is the function called from the remoteenforcer when it has new flow events to publish
@@ -287,11 +692,70 @@ func (r *StatsServer) GetStats(req rpcwrapper.Request, resp *rpcwrapper.Response
 		return errors.New("Message sender cannot be verified")
 	}
 
-	payload := req.Payload.(rpcwrapper.StatsPayload)
+	payload, ok := req.Payload.(rpcwrapper.StatsPayload)
+	if !ok {
+		return errors.New("Invalid stats payload")
+	}
+
+	records := payload.FlowRecords()
+
+	if len(records) > rpcwrapper.MaxStatsRecords {
+		log.WithFields(log.Fields{
+			"package": "enforcerproxy",
+			"records": len(records),
+		}).Error("Stats payload exceeds the maximum number of records")
+		return fmt.Errorf("Stats payload exceeds %d records", rpcwrapper.MaxStatsRecords)
+	}
+
+	granted := r.budget(payload.ContextID).Take(len(records))
+	if granted < len(records) {
+		log.WithFields(log.Fields{
+			"package": "enforcerproxy",
+			"dropped": len(records) - granted,
+		}).Warn("Stats rate limit reached, dropping flow records")
+	}
 
-	for _, record := range payload.Flows {
+	for _, record := range records[:granted] {
 		r.collector.CollectFlowEvent(record)
 	}
 
+	// The stats sent before the enforcer knows its context are not accounted for
+	if payload.ContextID == "" {
+		return nil
+	}
+
+	record := r.account(&payload, granted)
+	if record.Lost() > 0 || record.Retransmitted {
+		log.WithFields(log.Fields{
+			"package":       "enforcerproxy",
+			"contextID":     record.ContextID,
+			"sequence":      record.Sequence,
+			"lost":          record.Lost(),
+			"retransmitted": record.Retransmitted,
+		}).Warn("Flow records lost or retransmitted by a remote enforcer")
+	}
+
+	if c, ok := r.collector.(collector.StatsEventCollector); ok {
+		c.CollectStatsEvent(record)
+	}
+
+	// An enforcer only reports the latency of the handshakes of its own PU
+	if c, ok := r.collector.(collector.LatencyEventCollector); ok {
+		for _, latency := range payload.Latencies {
+			if latency.ContextID == payload.ContextID {
+				c.CollectLatencyEvent(latency)
+			}
+		}
+	}
+
+	// Nor the matches of the rules of another PU
+	if c, ok := r.collector.(collector.RuleStatsEventCollector); ok {
+		for _, stats := range payload.RuleStats {
+			if stats.ContextID == payload.ContextID {
+				c.CollectRuleStatsEvent(stats)
+			}
+		}
+	}
+
 	return nil
 }
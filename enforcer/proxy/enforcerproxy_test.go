@@ -0,0 +1,51 @@
+package enforcerproxy
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aporeto-inc/trireme/enforcer/utils/rpcwrapper"
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUpdateSecrets(t *testing.T) {
+	Convey("Given a proxy with three running remote enforcers", t, func() {
+		rpchdl := rpcwrapper.NewTestRPCClient()
+		s := &proxyInfo{
+			Secrets:  tokens.NewPSKSecrets([]byte("old")),
+			rpchdl:   rpchdl,
+			initDone: map[string]bool{"c1": true, "c2": true, "c3": true},
+		}
+
+		rpchdl.MockContextList(t, func() []string {
+			return []string{"c1", "c2", "c3"}
+		})
+
+		updated := []string{}
+		rpchdl.MockRemoteCall(t, func(contextID string, methodName string, req *rpcwrapper.Request, resp *rpcwrapper.Response) error {
+			updated = append(updated, contextID)
+			if contextID != "c2" {
+				return fmt.Errorf("connection refused")
+			}
+			return nil
+		})
+
+		Convey("When two of them fail to update their secrets", func() {
+			err := s.UpdateSecrets(tokens.NewPSKSecrets([]byte("new")))
+
+			Convey("Then all of them should receive the secrets", func() {
+				So(updated, ShouldResemble, []string{"c1", "c2", "c3"})
+			})
+
+			Convey("Then the failures should be returned together", func() {
+				So(err, ShouldNotBeNil)
+				So(strings.Contains(err.Error(), "c1: connection refused"), ShouldBeTrue)
+				So(strings.Contains(err.Error(), "c3: connection refused"), ShouldBeTrue)
+				So(strings.Contains(err.Error(), "c2"), ShouldBeFalse)
+			})
+		})
+	})
+}
@@ -0,0 +1,99 @@
+package enforcerproxy
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aporeto-inc/trireme/enforcer/utils/rpcwrapper"
+	"github.com/aporeto-inc/trireme/processmon"
+	"github.com/aporeto-inc/trireme/utils/errortypes"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHealthCheck(t *testing.T) {
+	Convey("Given a proxy with a remote enforcer", t, func() {
+		prochdl := processmon.NewTestProcessMon().(processmon.TestProcessManager)
+		rpchdl := rpcwrapper.NewTestRPCClient()
+		s := &proxyInfo{
+			prochdl:  prochdl,
+			rpchdl:   rpchdl,
+			initDone: map[string]bool{"context": true},
+			stats:    &StatsServer{streams: map[string]*statsStream{}},
+		}
+
+		running := true
+		prochdl.MockGetProcessStatus(t, func(contextID string) (int, bool, error) {
+			return 10, running, nil
+		})
+
+		methods := []string{}
+		rpchdl.MockRemoteCall(t, func(contextID string, methodName string, req *rpcwrapper.Request, resp *rpcwrapper.Response) error {
+			methods = append(methods, methodName)
+			if !running {
+				return fmt.Errorf("connection refused")
+			}
+			return nil
+		})
+
+		Convey("When the remote enforcer responds, it should be healthy", func() {
+			So(s.HealthCheck("context"), ShouldBeNil)
+			So(methods, ShouldResemble, []string{"Server.HealthCheck"})
+		})
+
+		Convey("When the remote enforcer is dead", func() {
+			running = false
+
+			Convey("Then it should not be healthy without being called", func() {
+				So(s.HealthCheck("context"), ShouldNotBeNil)
+				So(methods, ShouldBeEmpty)
+			})
+
+			Convey("Then unenforcing it should forget it so that it is launched again", func() {
+				killed := ""
+				prochdl.MockKillProcess(t, func(contextID string) {
+					killed = contextID
+				})
+
+				So(s.unenforce("context"), ShouldBeNil)
+				So(s.initDone, ShouldBeEmpty)
+				So(killed, ShouldEqual, "context")
+			})
+		})
+
+		Convey("When the remote enforcer hangs, it should not be healthy after the timeout", func() {
+			defer func(timeout time.Duration) { healthCheckTimeout = timeout }(healthCheckTimeout)
+			healthCheckTimeout = 10 * time.Millisecond
+
+			hang := make(chan struct{})
+			defer close(hang)
+			rpchdl.MockRemoteCall(t, func(contextID string, methodName string, req *rpcwrapper.Request, resp *rpcwrapper.Response) error {
+				<-hang
+				return nil
+			})
+
+			So(s.HealthCheck("context"), ShouldNotBeNil)
+		})
+
+		Convey("When the remote enforcer fails to unenforce while running, I should get an error", func() {
+			rpchdl.MockRemoteCall(t, func(contextID string, methodName string, req *rpcwrapper.Request, resp *rpcwrapper.Response) error {
+				return fmt.Errorf("failed")
+			})
+
+			err := s.unenforce("context")
+			So(err, ShouldEqual, ErrEnforceFailed)
+			So(s.initDone["context"], ShouldBeTrue)
+		})
+
+		Convey("When the remote enforcer fails to unenforce with a category, I should get an error of the category", func() {
+			rpchdl.MockRemoteCall(t, func(contextID string, methodName string, req *rpcwrapper.Request, resp *rpcwrapper.Response) error {
+				return errortypes.Errorf(errortypes.ErrRuleProgramming, "failed")
+			})
+
+			err := s.unenforce("context")
+			So(errortypes.Is(err, errortypes.ErrRuleProgramming), ShouldBeTrue)
+			So(errortypes.Is(err, ErrEnforceFailed), ShouldBeTrue)
+		})
+	})
+}
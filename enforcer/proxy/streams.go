@@ -0,0 +1,72 @@
+package enforcerproxy
+
+import (
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/enforcer/utils/rpcwrapper"
+)
+
+// statsStream is the position in the stats of a remote enforcer
+type statsStream struct {
+	pid       int
+	sequence  uint64
+	watermark uint64
+}
+
+// account returns the accounting of stats of which accepted records were passed to
+// the collector, and advances the stream of their enforcer
+func (r *StatsServer) account(payload *rpcwrapper.StatsPayload, accepted int) *collector.StatsRecord {
+
+	record := &collector.StatsRecord{
+		ContextID: payload.ContextID,
+		Sequence:  payload.Sequence,
+		Watermark: payload.Watermark,
+		Records:   len(payload.Records) + len(payload.Flows),
+		Accepted:  accepted,
+		Evicted:   payload.Evicted,
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	stream, ok := r.streams[payload.ContextID]
+
+	switch {
+	case !ok:
+		// The first stats of the enforcer since the controller started. The stats of
+		// an enforcer that started before cannot be accounted for.
+		stream = &statsStream{pid: payload.Pid}
+		r.streams[payload.ContextID] = stream
+
+	case stream.pid != payload.Pid:
+		// A new enforcer for the context numbers its stats from the start
+		stream.pid = payload.Pid
+		record.LostIntervals = payload.Sequence - 1
+		record.LostRecords = payload.Watermark
+
+	case payload.Sequence <= stream.sequence:
+		record.Retransmitted = true
+		if payload.Sequence < stream.sequence {
+			return record
+		}
+
+	default:
+		record.LostIntervals = payload.Sequence - stream.sequence - 1
+		if payload.Watermark > stream.watermark {
+			record.LostRecords = payload.Watermark - stream.watermark
+		}
+	}
+
+	stream.sequence = payload.Sequence
+	stream.watermark = payload.Watermark + uint64(record.Records)
+
+	return record
+}
+
+// forget removes the stream of the enforcer of a context
+func (r *StatsServer) forget(contextID string) {
+
+	r.Lock()
+	defer r.Unlock()
+
+	delete(r.streams, contextID)
+}
@@ -0,0 +1,95 @@
+package enforcerproxy
+
+import (
+	"testing"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/enforcer/utils/rpcwrapper"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// stats returns the stats of an enforcer with the given number of records
+func stats(pid int, sequence, watermark uint64, records int) *rpcwrapper.StatsPayload {
+
+	flows := map[string]*collector.FlowRecord{}
+	for i := 0; i < records; i++ {
+		flows[string(rune('a'+i))] = &collector.FlowRecord{Count: 1}
+	}
+
+	return &rpcwrapper.StatsPayload{
+		Flows:     flows,
+		ContextID: "context",
+		Pid:       pid,
+		Sequence:  sequence,
+		Watermark: watermark,
+	}
+}
+
+func TestStatsAccounting(t *testing.T) {
+	Convey("Given a stats server that received the first stats of an enforcer", t, func() {
+		r := &StatsServer{streams: map[string]*statsStream{}}
+
+		record := r.account(stats(10, 4, 30, 3), 3)
+		So(record.Lost(), ShouldEqual, 0)
+
+		Convey("The next stats should lose nothing", func() {
+			record := r.account(stats(10, 5, 33, 2), 2)
+			So(record.LostIntervals, ShouldEqual, 0)
+			So(record.Lost(), ShouldEqual, 0)
+		})
+
+		Convey("The stats after a gap should account for the lost intervals", func() {
+			record := r.account(stats(10, 7, 40, 2), 2)
+			So(record.LostIntervals, ShouldEqual, 2)
+			So(record.LostRecords, ShouldEqual, 7)
+		})
+
+		Convey("The records dropped by the rate limit should be lost", func() {
+			record := r.account(stats(10, 5, 33, 5), 2)
+			So(record.Lost(), ShouldEqual, 3)
+		})
+
+		Convey("The records evicted by the enforcer should be lost", func() {
+			payload := stats(10, 5, 33, 2)
+			payload.Evicted = 4
+			record := r.account(payload, 2)
+			So(record.Evicted, ShouldEqual, 4)
+			So(record.Lost(), ShouldEqual, 4)
+		})
+
+		Convey("Retransmitted stats should be flagged and keep the stream consistent", func() {
+			record := r.account(stats(10, 4, 30, 5), 5)
+			So(record.Retransmitted, ShouldBeTrue)
+			So(record.Lost(), ShouldEqual, 0)
+
+			record = r.account(stats(10, 5, 35, 1), 1)
+			So(record.Retransmitted, ShouldBeFalse)
+			So(record.Lost(), ShouldEqual, 0)
+		})
+
+		Convey("A new enforcer should account for its stats that were not received", func() {
+			record := r.account(stats(11, 3, 8, 1), 1)
+			So(record.LostIntervals, ShouldEqual, 2)
+			So(record.LostRecords, ShouldEqual, 8)
+		})
+
+		Convey("A forgotten enforcer should start a new stream", func() {
+			r.forget("context")
+			record := r.account(stats(10, 9, 60, 1), 1)
+			So(record.Lost(), ShouldEqual, 0)
+		})
+	})
+}
+
+func TestStatsBudgets(t *testing.T) {
+	Convey("Given a stats server", t, func() {
+		r := &StatsServer{budgets: map[string]*rpcwrapper.RecordBudget{}}
+
+		Convey("An enforcer exhausting its budget should not use up the budget of another one", func() {
+			So(r.budget("pu1").Take(rpcwrapper.MaxStatsRecordsPerInterval+1), ShouldEqual, rpcwrapper.MaxStatsRecordsPerInterval)
+			So(r.budget("pu1").Take(1), ShouldEqual, 0)
+			So(r.budget("pu2").Take(10), ShouldEqual, 10)
+		})
+	})
+}
@@ -0,0 +1,72 @@
+package enforcer
+
+import (
+	"fmt"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/enforcer/utils/packet"
+	"github.com/aporeto-inc/trireme/policy"
+)
+
+// rejectFlow terminates the flow of a syn packet rejected by the policy and returns
+// how. The flow is reset when the rule rejecting it or the policy of the PU asks
+// for it, and otherwise silently dropped. The syn packet is dropped in both cases.
+func (d *datapathEnforcer) rejectFlow(context *PUContext, tcpPacket *packet.Packet, action interface{}) string {
+
+	reset := context.resetRejected
+	if flowAction, ok := action.(policy.FlowAction); ok && flowAction&policy.Reset != 0 {
+		reset = true
+	}
+
+	if !reset {
+		return collector.RejectionDrop
+	}
+
+	if err := d.sendReset(tcpPacket.TCPReset()); err != nil {
+		log.WithFields(log.Fields{
+			"package": "enforcer",
+			"error":   err.Error(),
+		}).Warn("Unable to reset the rejected flow")
+		return collector.RejectionDrop
+	}
+
+	return collector.RejectionReset
+}
+
+// sendRawReset transmits the reset through a raw socket. The reset carries the
+// mark of the enforcer so that it is not processed again.
+func (d *datapathEnforcer) sendRawReset(rst *packet.Packet) error {
+
+	// The raw sockets of the IPPROTO_RAW protocol send the IP header of the buffer
+	// for both families
+	family := syscall.AF_INET
+	var addr syscall.Sockaddr
+	if rst.IsIPv6() {
+		family = syscall.AF_INET6
+		addr6 := &syscall.SockaddrInet6{}
+		copy(addr6.Addr[:], rst.DestinationAddress.To16())
+		addr = addr6
+	} else {
+		addr4 := &syscall.SockaddrInet4{}
+		copy(addr4.Addr[:], rst.DestinationAddress.To4())
+		addr = addr4
+	}
+
+	fd, err := syscall.Socket(family, syscall.SOCK_RAW, syscall.IPPROTO_RAW)
+	if err != nil {
+		return fmt.Errorf("Unable to open a raw socket: %s", err)
+	}
+	defer syscall.Close(fd)
+
+	if err := setSocketMark(fd, d.verdictMark(&CapturedPacket{Mark: "0"})); err != nil {
+		return err
+	}
+
+	if err := syscall.Sendto(fd, rst.Buffer, 0, addr); err != nil {
+		return fmt.Errorf("Unable to send the reset: %s", err)
+	}
+
+	return nil
+}
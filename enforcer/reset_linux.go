@@ -0,0 +1,18 @@
+// +build linux
+
+package enforcer
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// setSocketMark sets the mark of the packets of the socket
+func setSocketMark(fd int, mark int) error {
+
+	if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_MARK, mark); err != nil {
+		return fmt.Errorf("Unable to set the socket mark: %s", err)
+	}
+
+	return nil
+}
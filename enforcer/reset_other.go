@@ -0,0 +1,8 @@
+// +build !linux
+
+package enforcer
+
+// setSocketMark is a no-op on the platforms without packet marks
+func setSocketMark(fd int, mark int) error {
+	return nil
+}
@@ -0,0 +1,73 @@
+package enforcer
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/enforcer/utils/packet"
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+	"github.com/aporeto-inc/trireme/policy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// synPacket returns a syn packet from src to dst:80
+func synPacket(src string, dst string) *packet.Packet {
+
+	buffer := make([]byte, 40)
+
+	buffer[0] = 0x45
+	binary.BigEndian.PutUint16(buffer[2:4], 40)
+	buffer[8] = 64
+	buffer[9] = packet.IPProtocolTCP
+	copy(buffer[12:16], net.ParseIP(src).To4())
+	copy(buffer[16:20], net.ParseIP(dst).To4())
+
+	binary.BigEndian.PutUint16(buffer[20:22], 40000)
+	binary.BigEndian.PutUint16(buffer[22:24], 80)
+	binary.BigEndian.PutUint32(buffer[24:28], 1000)
+	buffer[32] = 5 << 4
+	buffer[33] = packet.TCPSynMask
+
+	p, _ := packet.New(packet.PacketTypeNetwork, buffer, "0")
+
+	return p
+}
+
+func TestRejectFlow(t *testing.T) {
+
+	Convey("Given an enforcer sending its resets to a list", t, func() {
+
+		secret := tokens.NewPSKSecrets([]byte("Dummy Test Password"))
+		enforcer := NewDefaultDatapathEnforcer("SomeServerId", &flowCollector{}, nil, secret, constants.LocalContainer).(*datapathEnforcer)
+
+		resets := []*packet.Packet{}
+		enforcer.sendReset = func(rst *packet.Packet) error {
+			resets = append(resets, rst)
+			return nil
+		}
+
+		context := &PUContext{ID: "pu1"}
+		syn := synPacket("10.0.0.1", "10.0.0.2")
+
+		Convey("A flow rejected by a rule without reset should be dropped", func() {
+			So(enforcer.rejectFlow(context, syn, policy.Reject), ShouldEqual, collector.RejectionDrop)
+			So(len(resets), ShouldEqual, 0)
+		})
+
+		Convey("A flow rejected by a rule with reset should be reset", func() {
+			So(enforcer.rejectFlow(context, syn, policy.Reject|policy.Reset), ShouldEqual, collector.RejectionReset)
+			So(len(resets), ShouldEqual, 1)
+			So(resets[0].DestinationAddress.String(), ShouldEqual, "10.0.0.1")
+			So(resets[0].TCPAck, ShouldEqual, 1001)
+		})
+
+		Convey("A flow of a PU resetting its rejected flows should be reset", func() {
+			context.resetRejected = true
+			So(enforcer.rejectFlow(context, syn, nil), ShouldEqual, collector.RejectionReset)
+			So(len(resets), ShouldEqual, 1)
+		})
+	})
+}
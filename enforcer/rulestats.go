@@ -0,0 +1,169 @@
+package enforcer
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/policy"
+)
+
+// identityRules counts the flows authorized or rejected by each identity rule of a
+// direction of a PU context. The counters restart from zero with each policy of the
+// context.
+type identityRules struct {
+	selectors []policy.TagSelector
+	// accept and reject are the positions of the rules of the accept and reject rule
+	// databases in the selectors, by their index in the databases minus one
+	accept []int
+	reject []int
+	hits   []uint64
+}
+
+// newIdentityRules returns the counters of the identity rules of a direction, whose
+// databases are created by createRuleDB
+func newIdentityRules(rules *policy.TagSelectorList) *identityRules {
+
+	r := &identityRules{
+		selectors: []policy.TagSelector{},
+		accept:    []int{},
+		reject:    []int{},
+	}
+
+	if rules == nil {
+		return r
+	}
+
+	for position, rule := range rules.TagSelectors {
+		if rule.Action&policy.Accept != 0 {
+			r.accept = append(r.accept, position)
+		} else if rule.Action&policy.Reject != 0 {
+			r.reject = append(r.reject, position)
+		}
+		r.selectors = append(r.selectors, rule)
+	}
+
+	r.hits = make([]uint64, len(r.selectors))
+
+	return r
+}
+
+// hit counts a flow matched by the rule found at the index of the accept or the
+// reject database
+func (r *identityRules) hit(index int, accepted bool) {
+
+	if r == nil || index < 1 {
+		return
+	}
+
+	positions := r.reject
+	if accepted {
+		positions = r.accept
+	}
+
+	if index > len(positions) {
+		return
+	}
+
+	atomic.AddUint64(&r.hits[positions[index-1]], 1)
+}
+
+// take returns the matches of all the rules since the previous call
+func (r *identityRules) take(direction, network string) []*collector.RuleHits {
+
+	hits := []*collector.RuleHits{}
+
+	if r == nil {
+		return hits
+	}
+
+	for position, selector := range r.selectors {
+		hits = append(hits, &collector.RuleHits{
+			Direction: direction,
+			Index:     position,
+			Selector:  selector,
+			Network:   network,
+			Hits:      atomic.SwapUint64(&r.hits[position], 0),
+		})
+	}
+
+	return hits
+}
+
+// SetRuleStats reports the matches of the identity rules of the PUs at every interval,
+// or disables the reports if the interval is zero. The collector must be a
+// collector.RuleStatsEventCollector. It must be called before Start.
+func (d *datapathEnforcer) SetRuleStats(interval time.Duration) {
+
+	d.ruleStatsInterval = interval
+}
+
+// startRuleStats reports the matches of the identity rules periodically, if enabled
+func (d *datapathEnforcer) startRuleStats() {
+
+	interval := d.ruleStatsInterval
+	if interval <= 0 {
+		return
+	}
+
+	for {
+		d.clock.Sleep(interval)
+		d.reportRuleStats(interval)
+	}
+}
+
+// reportRuleStats reports the matches of the identity rules of the PUs since the
+// previous report. The rules without match are reported, so that the unused rules
+// can be found. The rules of the additional networks of a multi-homed PU are reported
+// with their network.
+func (d *datapathEnforcer) reportRuleStats(interval time.Duration) {
+
+	c, ok := d.collector.(collector.RuleStatsEventCollector)
+	if !ok {
+		return
+	}
+
+	for _, key := range d.contextTracker.KeyList() {
+		contextID, ok := key.(string)
+		if !ok {
+			continue
+		}
+
+		hashes, err := d.contextTracker.Get(contextID)
+		if err != nil {
+			continue
+		}
+
+		record := &collector.RuleStatsRecord{
+			ContextID: contextID,
+			Interval:  interval,
+			Rules:     []*collector.RuleHits{},
+		}
+
+		reported := map[*PUContext]bool{}
+
+		for _, hash := range hashes.([]*DualHash) {
+			entry, err := d.puTracker.Get(hash.app)
+			if err != nil {
+				continue
+			}
+
+			context := entry.(*PUContext)
+			if reported[context] {
+				continue
+			}
+			reported[context] = true
+
+			if record.Tags == nil {
+				record.Tags = context.Annotations
+			}
+
+			record.Rules = append(record.Rules, context.transmitterRules.take(collector.RuleTransmitter, context.network)...)
+			record.Rules = append(record.Rules, context.receiverRules.take(collector.RuleReceiver, context.network)...)
+		}
+
+		if len(reported) > 0 {
+			c.CollectRuleStatsEvent(record)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package enforcer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+	"github.com/aporeto-inc/trireme/policy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// ruleStatsCollector records the rule stats records
+type ruleStatsCollector struct {
+	flowCollector
+	ruleStats []*collector.RuleStatsRecord
+}
+
+func (c *ruleStatsCollector) CollectRuleStatsEvent(record *collector.RuleStatsRecord) {
+	c.ruleStats = append(c.ruleStats, record)
+}
+
+// portSelector returns a rule matching the flows to a port
+func portSelector(port string, action policy.FlowAction) *policy.TagSelector {
+
+	return &policy.TagSelector{
+		Clause: []policy.KeyValueOperator{
+			{
+				Key:      PortNumberLabelString,
+				Value:    []string{port},
+				Operator: policy.Equal,
+			},
+		},
+		Action: action,
+	}
+}
+
+// portTags returns the tags of a flow to a port
+func portTags(port string) *policy.TagsMap {
+
+	return policy.NewTagsMap(map[string]string{PortNumberLabelString: port})
+}
+
+func TestIdentityRules(t *testing.T) {
+
+	Convey("Given the counters of identity rules mixing accept and reject rules", t, func() {
+
+		rules := policy.NewTagSelectorList([]policy.TagSelector{
+			*portSelector("80", policy.Accept),
+			*portSelector("22", policy.Reject),
+			*portSelector("443", policy.Accept),
+		})
+
+		acceptRules, rejectRules := createRuleDB(rules)
+		counters := newIdentityRules(rules)
+
+		Convey("The matches of the databases should be counted for their rule", func() {
+			index, _ := acceptRules.Search(portTags("443"))
+			counters.hit(index, true)
+			counters.hit(index, true)
+
+			index, _ = rejectRules.Search(portTags("22"))
+			counters.hit(index, false)
+
+			hits := counters.take(collector.RuleReceiver, "")
+			So(hits, ShouldHaveLength, 3)
+			So(hits[0].Hits, ShouldEqual, 0)
+			So(hits[1].Hits, ShouldEqual, 1)
+			So(hits[1].Selector.Action, ShouldEqual, policy.Reject)
+			So(hits[2].Hits, ShouldEqual, 2)
+			So(hits[2].Index, ShouldEqual, 2)
+			So(hits[2].Direction, ShouldEqual, collector.RuleReceiver)
+
+			Convey("The counters should restart from zero after they are taken", func() {
+				for _, h := range counters.take(collector.RuleReceiver, "") {
+					So(h.Hits, ShouldEqual, 0)
+				}
+			})
+		})
+
+		Convey("The flows without a matching rule should not be counted", func() {
+			index, _ := acceptRules.Search(portTags("8080"))
+			counters.hit(index, true)
+
+			for _, h := range counters.take(collector.RuleReceiver, "") {
+				So(h.Hits, ShouldEqual, 0)
+			}
+		})
+	})
+}
+
+func TestReportRuleStats(t *testing.T) {
+
+	Convey("Given I create an enforcer reporting the matches of the identity rules", t, func() {
+
+		secret := tokens.NewPSKSecrets([]byte("Dummy Test Password"))
+		ruleStats := &ruleStatsCollector{}
+		enforcer := NewDefaultDatapathEnforcer("SomeServerId", ruleStats, nil, secret, constants.LocalContainer).(*datapathEnforcer)
+		enforcer.SetRuleStats(time.Minute)
+
+		puInfo := intraHostPUInfo("pu", "10.1.10.76", portSelector("80", policy.Accept))
+		puInfo.Policy.AddReceiverRules(portSelector("22", policy.Reject))
+		So(enforcer.Enforce("pu", puInfo), ShouldBeNil)
+
+		entry, err := enforcer.puTracker.Get("10.1.10.76")
+		So(err, ShouldBeNil)
+		context := entry.(*PUContext)
+
+		Convey("The matches of the interval should be reported with the unused rules", func() {
+			index, _ := context.acceptRcvRules.Search(portTags("80"))
+			context.receiverRules.hit(index, true)
+
+			enforcer.reportRuleStats(time.Minute)
+
+			So(ruleStats.ruleStats, ShouldHaveLength, 1)
+			record := ruleStats.ruleStats[0]
+			So(record.ContextID, ShouldEqual, "pu")
+			So(record.Interval, ShouldEqual, time.Minute)
+			So(record.Rules, ShouldHaveLength, 2)
+			So(record.Rules[0].Direction, ShouldEqual, collector.RuleReceiver)
+			So(record.Rules[0].Hits, ShouldEqual, 1)
+			So(record.Rules[1].Hits, ShouldEqual, 0)
+
+			Convey("The rules should be reported without match afterwards", func() {
+				enforcer.reportRuleStats(time.Minute)
+
+				So(ruleStats.ruleStats, ShouldHaveLength, 2)
+				So(ruleStats.ruleStats[1].Rules[0].Hits, ShouldEqual, 0)
+			})
+		})
+
+		Convey("The PUs no longer enforced should not be reported", func() {
+			So(enforcer.Unenforce("pu"), ShouldBeNil)
+			enforcer.reportRuleStats(time.Minute)
+
+			So(ruleStats.ruleStats, ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,36 @@
+package enforcer
+
+import (
+	"fmt"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+)
+
+// UpdateSecrets is part of the SecretsUpdater interface. The keys and the authorities
+// of the secrets of the enforcer are replaced in place, so that the new handshakes
+// use them. The established flows are not affected and the handshakes in flight may
+// be retried by the peers. During the rotation of an authority, the bundle of the new
+// secrets should hold both the old and the new authorities.
+func (d *datapathEnforcer) UpdateSecrets(secrets tokens.Secrets) error {
+
+	if d.rotation == nil {
+		return fmt.Errorf("The secrets of the enforcer cannot be rotated")
+	}
+
+	if err := d.rotation.UpdateSecrets(secrets); err != nil {
+		return err
+	}
+
+	if err := d.reloadMTLS(); err != nil {
+		return fmt.Errorf("Secrets rotated but mutual TLS not reloaded: %s", err)
+	}
+
+	log.WithFields(log.Fields{
+		"package": "enforcer",
+		"type":    secrets.Type(),
+	}).Info("Secrets rotated")
+
+	return nil
+}
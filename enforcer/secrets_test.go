@@ -0,0 +1,45 @@
+package enforcer
+
+import (
+	"testing"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUpdateSecrets(t *testing.T) {
+
+	Convey("Given I create an enforcer with a pre-shared key", t, func() {
+
+		secret := tokens.NewPSKSecrets([]byte("Dummy Test Password"))
+		enforcer := NewDefaultDatapathEnforcer("SomeServerId", &collector.DefaultCollector{}, nil, secret, constants.LocalServer).(*datapathEnforcer)
+
+		Convey("When I rotate the key", func() {
+			err := enforcer.UpdateSecrets(tokens.NewPSKSecrets([]byte("Rotated Test Password")))
+
+			Convey("Then the new key should sign the tokens", func() {
+				So(err, ShouldBeNil)
+				So(string(secret.EncodingKey().([]byte)), ShouldEqual, "Rotated Test Password")
+			})
+		})
+
+		Convey("When I rotate the key with secrets of another type", func() {
+			err := enforcer.UpdateSecrets(&tokens.PKISecrets{})
+
+			Convey("Then I should get an error", func() {
+				So(err, ShouldNotBeNil)
+				So(string(secret.EncodingKey().([]byte)), ShouldEqual, "Dummy Test Password")
+			})
+		})
+
+		Convey("When the secrets cannot be rotated", func() {
+			enforcer.rotation = nil
+
+			Convey("Then I should get an error", func() {
+				So(enforcer.UpdateSecrets(tokens.NewPSKSecrets([]byte("Rotated Test Password"))), ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,30 @@
+package enforcer
+
+import "time"
+
+// DefaultStatsInterval is the default maximum time the flows collected by a remote
+// enforcer wait before they are reported
+const DefaultStatsInterval = 250 * time.Millisecond
+
+// DefaultMaxFlows is the default maximum number of flow records a remote enforcer
+// keeps between two batches
+const DefaultMaxFlows = 100000
+
+// StatsBatchConfig configures how the remote enforcers batch the flows they report
+// to the controller. A batch is sent when the interval expires or as soon as it is
+// full. While the controller is slow to accept the batches the interval is
+// increased and the full batches wait for it, so that the flows are aggregated
+// longer instead of queued.
+type StatsBatchConfig struct {
+	// Interval is the maximum time the flows wait before they are sent. It is
+	// DefaultStatsInterval if zero.
+	Interval time.Duration
+	// MaxRecords is the maximum number of flow records of a batch. It is the
+	// maximum accepted by the controller if zero or above.
+	MaxRecords int
+	// MaxFlows is the maximum number of flow records the enforcer keeps between two
+	// batches, so that a port scan cannot exhaust its memory. The least recently
+	// updated records are evicted beyond it and reported as lost. It is
+	// DefaultMaxFlows if zero.
+	MaxFlows int
+}
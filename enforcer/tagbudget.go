@@ -0,0 +1,64 @@
+package enforcer
+
+import (
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+	"github.com/aporeto-inc/trireme/policy"
+)
+
+// SetTagBudget sets the size budget and priority of the identity tags transmitted
+// in the tokens. It applies to PUs enforced or updated afterwards.
+func (d *datapathEnforcer) SetTagBudget(budget *tokens.TagBudget) error {
+
+	if budget == nil {
+		budget = tokens.NewTagBudget()
+	}
+
+	d.settingsLock.Lock()
+	d.tagBudget = budget
+	d.settingsLock.Unlock()
+
+	return nil
+}
+
+// transmittedIdentity returns the identity tags of the PU that fit in the tokens. The
+// collector is notified with the dropped tags when the identity is truncated.
+func (d *datapathEnforcer) transmittedIdentity(context *PUContext) *policy.TagsMap {
+
+	if context.Identity == nil {
+		return nil
+	}
+
+	d.settingsLock.RLock()
+	budget := d.tagBudget
+	d.settingsLock.RUnlock()
+
+	selected, dropped := budget.Select(d.tokenEngine, context.Identity, TransmitterLabel)
+	if len(dropped) == 0 {
+		return selected
+	}
+
+	tags := policy.NewTagsMap(nil)
+	for _, k := range dropped {
+		v, _ := context.Identity.Get(k)
+		tags.Add(k, v)
+	}
+
+	log.WithFields(log.Fields{
+		"package":   "enforcer",
+		"contextID": context.ID,
+		"dropped":   strings.Join(dropped, ","),
+	}).Warn("Identity tags not transmitted because of the token budget")
+
+	d.collector.CollectContainerEvent(&collector.ContainerRecord{
+		ContextID: context.ID,
+		Tags:      tags,
+		Event:     collector.ContainerTagsTruncated,
+	})
+
+	return selected
+}
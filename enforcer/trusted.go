@@ -0,0 +1,81 @@
+package enforcer
+
+import (
+	"net"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/enforcer/utils/packet"
+)
+
+// parseTrustedNetworks parses the trusted networks of a policy. Invalid networks
+// are ignored, they are never accepted by the supervisor either.
+func parseTrustedNetworks(networks []string) []*net.IPNet {
+
+	trusted := []*net.IPNet{}
+
+	for _, n := range networks {
+		_, network, err := net.ParseCIDR(n)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"package": "enforcer",
+				"network": n,
+				"error":   err.Error(),
+			}).Warn("Ignoring invalid trusted network")
+			continue
+		}
+
+		trusted = append(trusted, network)
+	}
+
+	return trusted
+}
+
+// trustedNetwork returns the trusted network of the PU that contains the ip
+func (p *PUContext) trustedNetwork(ip net.IP) (*net.IPNet, bool) {
+
+	for _, network := range p.trustedNetworks {
+		if network.Contains(ip) {
+			return network, true
+		}
+	}
+
+	return nil, false
+}
+
+// processTrustedSynPacket accepts the SYN packets exchanged with a trusted network
+// without a token. The supervisor accepts the rest of the connection, so the SYN is
+// the only packet the enforcer sees and it is reported here.
+func (d *datapathEnforcer) processTrustedSynPacket(context *PUContext, tcpPacket *packet.Packet, application bool) bool {
+
+	peer := tcpPacket.SourceAddress
+	if application {
+		peer = tcpPacket.DestinationAddress
+	}
+
+	network, ok := context.trustedNetwork(peer)
+	if !ok {
+		return false
+	}
+
+	record := &collector.FlowRecord{
+		ContextID:       context.ID,
+		SourceID:        network.String(),
+		DestinationID:   context.ManagementID,
+		Tags:            context.Annotations,
+		Action:          collector.FlowAccept,
+		Mode:            collector.TrustedNetwork,
+		SourceIP:        tcpPacket.SourceAddress.String(),
+		DestinationIP:   tcpPacket.DestinationAddress.String(),
+		SourcePort:      tcpPacket.SourcePort,
+		DestinationPort: tcpPacket.DestinationPort,
+	}
+
+	if application {
+		record.SourceID, record.DestinationID = context.ManagementID, network.String()
+	}
+
+	d.collector.CollectFlowEvent(record)
+
+	return true
+}
@@ -0,0 +1,67 @@
+package enforcer
+
+import (
+	"testing"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/enforcer/utils/packet"
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+	"github.com/aporeto-inc/trireme/policy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// flowCollector records the flow events
+type flowCollector struct {
+	collector.DefaultCollector
+	flows []*collector.FlowRecord
+}
+
+func (c *flowCollector) CollectFlowEvent(record *collector.FlowRecord) {
+	c.flows = append(c.flows, record)
+}
+
+func TestTrustedNetworks(t *testing.T) {
+
+	Convey("Given I create an enforcer with a processing unit", t, func() {
+
+		flows := &flowCollector{}
+		secret := tokens.NewPSKSecrets([]byte("Dummy Test Password"))
+		enforcer := NewDefaultDatapathEnforcer("SomeServerId", flows, nil, secret, constants.LocalContainer).(*datapathEnforcer)
+
+		puInfo := intraHostPUInfo("SomeProcessingUnitId1", "164.67.228.152", &policy.TagSelector{})
+
+		Convey("When the source of a syn packet without token is a trusted network", func() {
+
+			puInfo.Policy.UpdateTrustedNetworks([]string{"invalid", "10.1.10.0/24"})
+			So(enforcer.Enforce("SomeProcessingUnitId1", puInfo), ShouldBeNil)
+
+			tcpPacket, err := packet.New(0, append([]byte{}, TCPFlow[0]...), "0")
+			So(err, ShouldBeNil)
+
+			Convey("Then the packet should be accepted and reported", func() {
+
+				So(enforcer.processNetworkTCPPackets(tcpPacket), ShouldBeNil)
+				So(len(flows.flows), ShouldEqual, 1)
+				So(flows.flows[0].Action, ShouldEqual, collector.FlowAccept)
+				So(flows.flows[0].Mode, ShouldEqual, collector.TrustedNetwork)
+				So(flows.flows[0].SourceID, ShouldEqual, "10.1.10.0/24")
+			})
+		})
+
+		Convey("When the source of a syn packet without token is not trusted", func() {
+
+			puInfo.Policy.UpdateTrustedNetworks([]string{"10.2.0.0/16"})
+			So(enforcer.Enforce("SomeProcessingUnitId1", puInfo), ShouldBeNil)
+
+			tcpPacket, err := packet.New(0, append([]byte{}, TCPFlow[0]...), "0")
+			So(err, ShouldBeNil)
+
+			Convey("Then the packet should be dropped", func() {
+
+				So(enforcer.processNetworkTCPPackets(tcpPacket), ShouldNotBeNil)
+				So(flows.flows[len(flows.flows)-1].Mode, ShouldNotEqual, collector.TrustedNetwork)
+			})
+		})
+	})
+}
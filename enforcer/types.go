@@ -1,6 +1,8 @@
 package enforcer
 
 import (
+	"net"
+
 	"github.com/aporeto-inc/trireme/enforcer/lookup"
 	"github.com/aporeto-inc/trireme/policy"
 )
@@ -72,8 +74,42 @@ type FilterQueue struct {
 	NumberOfApplicationQueues uint16
 	// MarkValue is the default mark to set in packets in the RAW chain
 	MarkValue int
+	// MarkMask is the set of bits of the packet mark owned by trireme. The other bits
+	// are left to the other tools. 0 is the whole mark.
+	MarkMask uint32
+	// CaptureMode selects the mechanism capturing the packets
+	CaptureMode CaptureMode
+	// CaptureInterfaces are the interfaces of the raw socket capture. All the
+	// interfaces but the loopback are captured when empty.
+	CaptureInterfaces []string
+	// CaptureProgram is the object of the eBPF classifier of the eBPF capture.
+	// DefaultEBPFProgram is used when empty.
+	CaptureProgram string
 }
 
+// CaptureMode is the mechanism capturing the packets
+type CaptureMode int
+
+const (
+	// CaptureNFQueue captures the packets with the netfilter queues
+	CaptureNFQueue CaptureMode = iota
+	// CaptureRawSocket captures the packets with raw sockets, the packets of the
+	// interfaces being redirected to the sockets by tc filters. It is meant for
+	// the kernels without netfilter queues, every TCP packet being processed in
+	// user space. Only the remote containers are supported and the DNS queries
+	// restricted by domain are dropped since they are not inspected.
+	CaptureRawSocket
+	// CaptureEBPF captures the packets like CaptureRawSocket, but an eBPF classifier
+	// transmits the packets of the flows accepted by the enforcer without leaving the
+	// kernel. Only the handshakes and the packets of the rejected flows are processed
+	// in user space. The classifier is loaded by tc and its map updated by bpftool.
+	CaptureEBPF
+)
+
+// DefaultEBPFProgram is the default object of the eBPF classifier, built from
+// enforcer/ebpf/flows.c
+const DefaultEBPFProgram = "/usr/lib/trireme/flows.o"
+
 // PUContext holds data indexed by the docker ID
 type PUContext struct {
 	ID             string
@@ -85,6 +121,32 @@ type PUContext struct {
 	acceptRcvRules *lookup.PolicyDB
 	rejectRcvRules *lookup.PolicyDB
 	Extension      interface{}
+	// txIdentity is the part of the identity transmitted in the tokens
+	txIdentity *policy.TagsMap
+	// revision is the fingerprint of the policy of the context
+	revision string
+	// identityRevision is the fingerprint of the transmitted identity
+	identityRevision string
+	// trustedNetworks are the networks exchanging traffic with the PU without tokens
+	trustedNetworks []*net.IPNet
+	// issuerRules restrict the certificate authorities of the peers
+	issuerRules []*issuerRule
+	// dnsDomains are the domains the PU can resolve, or empty if they are not restricted
+	dnsDomains []string
+	// resetRejected resets the flows rejected by the policy instead of dropping them
+	resetRejected bool
+	// udpNetworks are the networks whose UDP flows are authorized with tokens, or nil
+	// if the UDP enforcement is disabled
+	udpNetworks []*net.IPNet
+	// fastPath caches the verdicts of the accepted flows in the kernel, if the
+	// feature is enabled for the PU
+	fastPath bool
+	// transmitterRules and receiverRules count the matches of the identity rules
+	transmitterRules *identityRules
+	receiverRules    *identityRules
+	// network is the additional network of the context of an interface of a
+	// multi-homed container, or empty for the default context
+	network string
 }
 
 // DualHash is a record of app and net hash
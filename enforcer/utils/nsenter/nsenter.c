@@ -9,10 +9,49 @@
 #include <sys/stat.h>
 #include <fcntl.h>
 #include<errno.h>
+#include <unistd.h>
+#include <sys/ioctl.h>
+
+#ifndef NS_GET_USERNS
+#define NS_GET_USERNS _IO(0xb7, 0x1)
+#endif
+
+//enter_netns switches to the network namespace. The network namespace of a
+//user-namespaced container is owned by its user namespace, which is entered first
+//when CONTAINER_USERNS is set. The credentials are not changed, the process keeps
+//the host uid and gid whatever the uid mapping of the container and only gains
+//the capabilities of the user namespace.
+static void enter_netns(int fd){
+  if(getenv("CONTAINER_USERNS") != NULL){
+    int userfd = ioctl(fd,NS_GET_USERNS);
+    if(userfd < 0){
+      setenv("NSENTER_ERROR_STATE",strerror(errno),1);
+      return;
+    }
+    int retval = setns(userfd,CLONE_NEWUSER);
+    close(userfd);
+    if(retval < 0){
+      setenv("NSENTER_ERROR_STATE",strerror(errno),1);
+      return;
+    }
+  }
+  if(setns(fd,CLONE_NEWNET) < 0){
+    setenv("NSENTER_ERROR_STATE",strerror(errno),1);
+  }
+}
+
 void nsexec(void){
   char *path = NULL;
   char *str = getenv("CONTAINER_PID");
+  char *nsfd = getenv("NETNS_FD");
   int fd =0;
+  if(str == NULL && nsfd != NULL){
+    //The namespace was opened by the parent and is not referenced by a process
+    fd = atoi(nsfd);
+    enter_netns(fd);
+    close(fd);
+    return;
+  }
   if(str == NULL){
     //We are not running as remote enforcer
     return;
@@ -21,10 +60,13 @@ void nsexec(void){
   path = calloc(1,path_len+1);
   snprintf(path,path_len+1,"/proc/%s/ns/net",str);
   fd = open(path,O_RDONLY);
-  int retval = setns(fd,0);
-  if(retval < 0){
+  if(fd < 0){
     setenv("NSENTER_ERROR_STATE",strerror(errno),1);
+    free(path);
+    return;
   }
+  enter_netns(fd);
+  close(fd);
   free(path);
 
 }
@@ -8,6 +8,9 @@ const (
 	minIPHdrSize = 20
 
 	minIPHdrWords = (minIPHdrSize / 4)
+
+	// udpHdrSize is the size of the UDP header
+	udpHdrSize = 8
 )
 
 // IP Header field position constants
@@ -34,6 +37,36 @@ const (
 	ipDestAddrPos = 16
 )
 
+// IPv6 Header field position constants
+const (
+	// ipv6HdrSize is the size of the IPv6 header
+	ipv6HdrSize = 40
+
+	// ipv6PayloadLenPos is the location of the IPv6 payload length
+	ipv6PayloadLenPos = 4
+
+	// ipv6NextHeaderPos is the location of the protocol of the IPv6 payload
+	ipv6NextHeaderPos = 6
+
+	// ipv6HopLimitPos is the location of the IPv6 hop limit
+	ipv6HopLimitPos = 7
+
+	// ipv6SourceAddrPos is location of source IPv6 address
+	ipv6SourceAddrPos = 8
+
+	// ipv6DestAddrPos is location of destination IPv6 address
+	ipv6DestAddrPos = 24
+)
+
+// IP versions
+const (
+	// ipVersion4 is the version of the IPv4 packets
+	ipVersion4 = 4
+
+	// ipVersion6 is the version of the IPv6 packets
+	ipVersion6 = 6
+)
+
 // IP Protocol numbers
 const (
 	// IPProtocolTCP defines the constant for UDP protocol number
@@ -48,28 +81,47 @@ const (
 	ipHdrLenMask = 0xF
 )
 
-// TCP Header field position constants
+// TCP Header field position constants, relative to the beginning of the TCP header
+// since the IP header of the IPv4 and IPv6 packets have different sizes
 const (
 	// tcpSourcePortPos is the location of source port
-	tcpSourcePortPos = 20
+	tcpSourcePortPos = 0
 
 	// tcpDestPortPos is the location of destination port
-	tcpDestPortPos = 22
+	tcpDestPortPos = 2
 
 	// tcpSeqPos is the location of seq
-	tcpSeqPos = 24
+	tcpSeqPos = 4
 
 	// tcpAckPos is the location of seq
-	tcpAckPos = 28
+	tcpAckPos = 8
 
 	// tcpDataOffsetPos is the location of the TCP data offset
-	tcpDataOffsetPos = 32
+	tcpDataOffsetPos = 12
+
+	// minTCPHeaderLen is the length of the TCP header without options
+	minTCPHeaderLen = 20
 
 	//tcpFlagsOfsetPos is the location of the TCP flags
-	tcpFlagsOffsetPos = 33
+	tcpFlagsOffsetPos = 13
 
 	// TCPChecksumPos is the location of TCP checksum
-	TCPChecksumPos = 36
+	TCPChecksumPos = 16
+)
+
+// UDP Header field position constants, relative to the beginning of the UDP header
+const (
+	// udpSourcePortPos is the location of source port
+	udpSourcePortPos = 0
+
+	// udpDestPortPos is the location of destination port
+	udpDestPortPos = 2
+
+	// udpLengthPos is the location of the length of the UDP header and payload
+	udpLengthPos = 4
+
+	// udpChecksumPos is the location of UDP checksum
+	udpChecksumPos = 6
 )
 
 // TCP Header masks
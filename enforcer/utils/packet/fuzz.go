@@ -0,0 +1,55 @@
+// +build gofuzz
+
+package packet
+
+// Fuzz is the entry point of go-fuzz for the packet parser. The packets come from
+// the network and are parsed before any authorization, so the parser and the
+// accessors used by the datapath must never panic whatever the bytes. Build with:
+//
+//	go-fuzz-build github.com/aporeto-inc/trireme/enforcer/utils/packet
+//	go-fuzz -bin=packet-fuzz.zip -workdir=enforcer/utils/packet/testdata/fuzz
+//
+// The corpus is checked with go test -tags gofuzz.
+//
+// It returns 1 for the packets parsed, so that the fuzzer favors them, and 0
+// otherwise.
+func Fuzz(data []byte) int {
+
+	// The parser keeps the buffer and the datapath modifies it in place
+	buffer := make([]byte, len(data))
+	copy(buffer, data)
+
+	p, err := New(0, buffer, "")
+	if err != nil {
+		return 0
+	}
+
+	p.VerifyIPChecksum()
+	_ = p.String()
+	_ = p.L4FlowHash()
+
+	if p.IPProto == IPProtocolUDP {
+		p.VerifyUDPChecksum()
+		if payload := p.UDPPayload(); len(payload) > 0 {
+			_ = p.UDPDataDetach(uint16(len(payload)))
+		}
+		return 1
+	}
+
+	p.VerifyTCPChecksum()
+	p.ReadTCPData()
+	p.TCPReset()
+
+	// The datapath detaches the authentication option and the token of the packets
+	// carrying the option
+	if p.HasTCPAuthenticationOption(fuzzOptionLength) {
+		if err := p.TCPDataDetach(fuzzOptionLength); err == nil {
+			_ = p.TCPDataAttach(p.GetTCPOptions(), p.GetTCPData())
+		}
+	}
+
+	return 1
+}
+
+// fuzzOptionLength is the length of the authentication option of the datapath
+const fuzzOptionLength = 4
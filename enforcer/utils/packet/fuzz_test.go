@@ -0,0 +1,30 @@
+// +build gofuzz
+
+package packet
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestFuzzCorpus(t *testing.T) {
+
+	files, err := filepath.Glob(filepath.Join("testdata", "fuzz", "corpus", "*"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("No fuzzing corpus: %v", err)
+	}
+
+	parsed := 0
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed += Fuzz(data)
+	}
+
+	if parsed == 0 {
+		t.Error("Expected the corpus to have valid packets")
+	}
+}
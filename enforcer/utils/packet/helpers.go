@@ -8,6 +8,7 @@ import (
 	"strconv"
 
 	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
 )
 
 // Helpher functions for the package, mainly for debugging and validation
@@ -18,6 +19,11 @@ import (
 // modified.
 func (p *Packet) VerifyIPChecksum() bool {
 
+	// The IPv6 header has no checksum
+	if p.ipVersion == ipVersion6 {
+		return true
+	}
+
 	sum := p.computeIPChecksum()
 
 	return sum == p.ipChecksum
@@ -27,6 +33,10 @@ func (p *Packet) VerifyIPChecksum() bool {
 // packet with the value.
 func (p *Packet) UpdateIPChecksum() {
 
+	if p.ipVersion == ipVersion6 {
+		return
+	}
+
 	p.ipChecksum = p.computeIPChecksum()
 
 	binary.BigEndian.PutUint16(p.Buffer[ipChecksumPos:ipChecksumPos+2], p.ipChecksum)
@@ -48,7 +58,28 @@ func (p *Packet) UpdateTCPChecksum() {
 
 	p.TCPChecksum = p.computeTCPChecksum()
 
-	binary.BigEndian.PutUint16(p.Buffer[TCPChecksumPos:TCPChecksumPos+2], p.TCPChecksum)
+	binary.BigEndian.PutUint16(p.tcpHeader()[TCPChecksumPos:TCPChecksumPos+2], p.TCPChecksum)
+}
+
+// VerifyUDPChecksum returns true if the UDP checksum is correct for this packet or
+// not computed by the sender of an IPv4 packet, false otherwise
+func (p *Packet) VerifyUDPChecksum() bool {
+
+	udp := p.Buffer[p.l4BeginPos:]
+	sum := binary.BigEndian.Uint16(udp[udpChecksumPos : udpChecksumPos+2])
+
+	if sum == 0 && p.ipVersion == ipVersion4 {
+		return true
+	}
+
+	return sum == p.computeUDPChecksum()
+}
+
+// UpdateUDPChecksum computes the UDP checksum and updates the packet with the value
+func (p *Packet) UpdateUDPChecksum() {
+
+	udp := p.Buffer[p.l4BeginPos:]
+	binary.BigEndian.PutUint16(udp[udpChecksumPos:udpChecksumPos+2], p.computeUDPChecksum())
 }
 
 // String returns a string representation of fields contained in this packet.
@@ -57,11 +88,11 @@ func (p *Packet) String() string {
 	var buf bytes.Buffer
 	buf.WriteString("(error)")
 
-	header, err := ipv4.ParseHeader(p.Buffer)
+	header, err := p.ipHeaderString()
 
 	if err == nil {
 		buf.Reset()
-		buf.WriteString(header.String())
+		buf.WriteString(header)
 		buf.WriteString(" srcport=")
 		buf.WriteString(strconv.Itoa(int(p.SourcePort)))
 		buf.WriteString(" dstport=")
@@ -74,6 +105,25 @@ func (p *Packet) String() string {
 	return buf.String()
 }
 
+// ipHeaderString returns a string representation of the IP header
+func (p *Packet) ipHeaderString() (string, error) {
+
+	if p.ipVersion == ipVersion6 {
+		header, err := ipv6.ParseHeader(p.Buffer)
+		if err != nil {
+			return "", err
+		}
+		return header.String(), nil
+	}
+
+	header, err := ipv4.ParseHeader(p.Buffer)
+	if err != nil {
+		return "", err
+	}
+
+	return header.String(), nil
+}
+
 // Computes the IP header checksum. The packet is not modified.
 func (p *Packet) computeIPChecksum() uint16 {
 
@@ -92,30 +142,42 @@ func (p *Packet) computeIPChecksum() uint16 {
 // Computes the TCP header checksum. The packet is not modified.
 func (p *Packet) computeTCPChecksum() uint16 {
 
-	var pseudoHeaderLen uint16 = 12
 	tcpSize := uint16(len(p.Buffer)) - p.l4BeginPos
-	bufLen := pseudoHeaderLen + tcpSize
-	buf := make([]byte, bufLen)
+	tcpLength := tcpSize + uint16(len(p.tcpData)+len(p.tcpOptions))
+
+	// Construct the pseudo-header for TCP checksum computation
+	var buf []byte
+	if p.ipVersion == ipVersion6 {
+
+		// bytes 0-31: Source and destination IPv6 addresses
+		buf = make([]byte, 40, 40+int(tcpLength))
+		copy(buf[0:16], p.Buffer[ipv6SourceAddrPos:ipv6SourceAddrPos+16])
+		copy(buf[16:32], p.Buffer[ipv6DestAddrPos:ipv6DestAddrPos+16])
 
-	// Construct the pseudo-header for TCP checksum computation:
+		// bytes 32-35: TCP buffer size (real header + payload)
+		binary.BigEndian.PutUint32(buf[32:36], uint32(tcpLength))
 
-	// bytes 0-3: Source IP address
-	copy(buf[0:4], p.Buffer[ipSourceAddrPos:ipSourceAddrPos+4])
+		// bytes 36-38: Constant zero, byte 39: Next header (6==TCP)
+		buf[39] = 6
 
-	// bytes 4-7: Destination IP address
-	copy(buf[4:8], p.Buffer[ipDestAddrPos:ipDestAddrPos+4])
+	} else {
 
-	// byte 8: Constant zero
-	buf[8] = 0
+		// bytes 0-3: Source IP address, bytes 4-7: Destination IP address
+		buf = make([]byte, 12, 12+int(tcpLength))
+		copy(buf[0:4], p.Buffer[ipSourceAddrPos:ipSourceAddrPos+4])
+		copy(buf[4:8], p.Buffer[ipDestAddrPos:ipDestAddrPos+4])
 
-	// byte 9: Protocol (6==TCP)
-	buf[9] = 6
+		// byte 8: Constant zero, byte 9: Protocol (6==TCP)
+		buf[9] = 6
+
+		// bytes 10,11: TCP buffer size (real header + payload)
+		binary.BigEndian.PutUint16(buf[10:12], tcpLength)
+	}
 
-	// bytes 10,11: TCP buffer size (real header + payload)
-	binary.BigEndian.PutUint16(buf[10:12], tcpSize+uint16(len(p.tcpData)+len(p.tcpOptions)))
+	pseudoHeaderLen := uint16(len(buf))
 
-	// bytes 12+: The TCP buffer (real header + payload)
-	copy(buf[12:], p.Buffer[p.l4BeginPos:])
+	// The TCP buffer (real header + payload)
+	buf = append(buf, p.Buffer[p.l4BeginPos:]...)
 
 	// Set current checksum to zero (in buf, not changing packet)
 	buf[pseudoHeaderLen+16] = 0
@@ -127,6 +189,51 @@ func (p *Packet) computeTCPChecksum() uint16 {
 	return checksum(buf)
 }
 
+// Computes the UDP checksum. The packet is not modified.
+func (p *Packet) computeUDPChecksum() uint16 {
+
+	udpLength := uint16(len(p.Buffer)) - p.l4BeginPos
+
+	// Construct the pseudo-header for UDP checksum computation
+	var buf []byte
+	if p.ipVersion == ipVersion6 {
+
+		// bytes 0-31: Source and destination IPv6 addresses
+		buf = make([]byte, 40, 40+int(udpLength))
+		copy(buf[0:16], p.Buffer[ipv6SourceAddrPos:ipv6SourceAddrPos+16])
+		copy(buf[16:32], p.Buffer[ipv6DestAddrPos:ipv6DestAddrPos+16])
+
+		// bytes 32-35: UDP length, bytes 36-38: Constant zero, byte 39: Next header (17==UDP)
+		binary.BigEndian.PutUint32(buf[32:36], uint32(udpLength))
+		buf[39] = IPProtocolUDP
+
+	} else {
+
+		// bytes 0-3: Source IP address, bytes 4-7: Destination IP address
+		buf = make([]byte, 12, 12+int(udpLength))
+		copy(buf[0:4], p.Buffer[ipSourceAddrPos:ipSourceAddrPos+4])
+		copy(buf[4:8], p.Buffer[ipDestAddrPos:ipDestAddrPos+4])
+
+		// byte 8: Constant zero, byte 9: Protocol (17==UDP), bytes 10,11: UDP length
+		buf[9] = IPProtocolUDP
+		binary.BigEndian.PutUint16(buf[10:12], udpLength)
+	}
+
+	pseudoHeaderLen := len(buf)
+
+	// The UDP header and payload, with the checksum set to zero
+	buf = append(buf, p.Buffer[p.l4BeginPos:]...)
+	buf[pseudoHeaderLen+udpChecksumPos] = 0
+	buf[pseudoHeaderLen+udpChecksumPos+1] = 0
+
+	// A computed checksum of zero is transmitted as all ones
+	if sum := checksum(buf); sum != 0 {
+		return sum
+	}
+
+	return 0xffff
+}
+
 // incCsum16 implements rfc1624, equation 3.
 func incCsum16(start, old, new uint16) uint16 {
 
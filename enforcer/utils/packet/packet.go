@@ -60,7 +60,63 @@ func New(context uint64, bytes []byte, mark string) (packet *Packet, err error)
 	p.tcpOptions = []byte{}
 	p.tcpData = []byte{}
 
+	if len(bytes) > 0 && bytes[0]>>4 == ipVersion6 {
+		if err := p.parseIPv6Header(); err != nil {
+			return nil, err
+		}
+	} else if err := p.parseIPv4Header(); err != nil {
+		return nil, err
+	}
+
+	p.context = context
+
+	// UDP Header Processing. Only the ports are parsed.
+	if p.IPProto == IPProtocolUDP {
+		udp := p.Buffer[p.l4BeginPos:]
+		p.SourcePort = binary.BigEndian.Uint16(udp[udpSourcePortPos : udpSourcePortPos+2])
+		p.DestinationPort = binary.BigEndian.Uint16(udp[udpDestPortPos : udpDestPortPos+2])
+		return &p, nil
+	}
+
+	// TCP Header Processing
+	tcp := p.Buffer[p.l4BeginPos:]
+	p.TCPChecksum = binary.BigEndian.Uint16(tcp[TCPChecksumPos : TCPChecksumPos+2])
+	p.SourcePort = binary.BigEndian.Uint16(tcp[tcpSourcePortPos : tcpSourcePortPos+2])
+	p.DestinationPort = binary.BigEndian.Uint16(tcp[tcpDestPortPos : tcpDestPortPos+2])
+	p.TCPAck = binary.BigEndian.Uint32(tcp[tcpAckPos : tcpAckPos+4])
+	p.TCPSeq = binary.BigEndian.Uint32(tcp[tcpSeqPos : tcpSeqPos+4])
+	p.tcpDataOffset = (tcp[tcpDataOffsetPos] & tcpDataOffsetMask) >> 4
+	p.TCPFlags = tcp[tcpFlagsOffsetPos]
+
+	// The data offset is read from the network and the payload is located with it
+	if tcpHeaderLen := int(p.tcpDataOffset) * 4; tcpHeaderLen < minTCPHeaderLen || tcpHeaderLen > len(tcp) {
+		log.WithFields(log.Fields{
+			"package":       "packet",
+			"tcpDataOffset": p.tcpDataOffset,
+		}).Debug("Invalid TCP data offset")
+
+		return nil, fmt.Errorf("Invalid TCP data offset %d for %d bytes of TCP segment", p.tcpDataOffset, len(tcp))
+	}
+
+	return &p, nil
+}
+
+// parseIPv4Header processes the header of an IPv4 packet
+func (p *Packet) parseIPv4Header() error {
+
+	bytes := p.Buffer
+
+	if len(bytes) < minIPHdrSize {
+		log.WithFields(log.Fields{
+			"package":      "packet",
+			"bufferLength": len(bytes),
+		}).Debug("IP Packet too small")
+
+		return fmt.Errorf("IP Packet too small")
+	}
+
 	// IP Header Processing
+	p.ipVersion = ipVersion4
 	p.ipHeaderLen = bytes[ipHdrLenPos] & ipHdrLenMask
 	p.IPProto = bytes[ipProtoPos]
 	p.IPTotalLength = binary.BigEndian.Uint16(bytes[ipLengthPos : ipLengthPos+2])
@@ -70,13 +126,13 @@ func New(context uint64, bytes []byte, mark string) (packet *Packet, err error)
 	p.DestinationAddress = net.IP(bytes[ipDestAddrPos : ipDestAddrPos+4])
 
 	// Some sanity checking...
-	if p.IPTotalLength < minIPPacketLen {
+	if p.IPTotalLength < minIPHdrSize+p.minL4HdrSize() {
 		log.WithFields(log.Fields{
 			"package":        "packet",
 			"ipHeaderLength": p.ipHeaderLen,
 		}).Debug("IP Packet too small")
 
-		return nil, fmt.Errorf("IP Packet too small")
+		return fmt.Errorf("IP Packet too small")
 	}
 
 	if p.ipHeaderLen != minIPHdrWords {
@@ -85,9 +141,82 @@ func New(context uint64, bytes []byte, mark string) (packet *Packet, err error)
 			"ipHeaderLength": p.ipHeaderLen,
 		}).Debug("Packets with IP options not supported")
 
-		return nil, fmt.Errorf("Packets with IP options not supported (hdrlen=%d)", p.ipHeaderLen)
+		return fmt.Errorf("Packets with IP options not supported (hdrlen=%d)", p.ipHeaderLen)
+	}
+
+	if err := p.checkLength(); err != nil {
+		return err
 	}
 
+	p.l4BeginPos = minIPHdrSize
+
+	return nil
+}
+
+// parseIPv6Header processes the header of an IPv6 packet. The packets with extension
+// headers are not supported, like the IPv4 packets with options.
+func (p *Packet) parseIPv6Header() error {
+
+	bytes := p.Buffer
+
+	if len(bytes) < ipv6HdrSize {
+		log.WithFields(log.Fields{
+			"package":      "packet",
+			"bufferLength": len(bytes),
+		}).Debug("IPv6 Packet too small")
+
+		return fmt.Errorf("IPv6 Packet too small")
+	}
+
+	p.ipVersion = ipVersion6
+	p.ipHeaderLen = ipv6HdrSize / 4
+	p.IPProto = bytes[ipv6NextHeaderPos]
+	p.IPTotalLength = ipv6HdrSize + binary.BigEndian.Uint16(bytes[ipv6PayloadLenPos:ipv6PayloadLenPos+2])
+	p.SourceAddress = net.IP(bytes[ipv6SourceAddrPos : ipv6SourceAddrPos+16])
+	p.DestinationAddress = net.IP(bytes[ipv6DestAddrPos : ipv6DestAddrPos+16])
+
+	if p.IPProto != IPProtocolTCP && p.IPProto != IPProtocolUDP {
+		log.WithFields(log.Fields{
+			"package":    "packet",
+			"nextHeader": p.IPProto,
+		}).Debug("Packets with IPv6 extension headers not supported")
+
+		return fmt.Errorf("Packets with IPv6 extension headers not supported (nextheader=%d)", p.IPProto)
+	}
+
+	// The transport header of the packets of IPv4 minimum length must be there as well
+	if p.IPTotalLength < ipv6HdrSize+p.minL4HdrSize() {
+		log.WithFields(log.Fields{
+			"package":       "packet",
+			"IPTotalLength": p.IPTotalLength,
+		}).Debug("IPv6 Packet too small")
+
+		return fmt.Errorf("IPv6 Packet too small")
+	}
+
+	if err := p.checkLength(); err != nil {
+		return err
+	}
+
+	p.l4BeginPos = ipv6HdrSize
+
+	return nil
+}
+
+// minL4HdrSize returns the minimum size of the transport header of the packet
+func (p *Packet) minL4HdrSize() uint16 {
+
+	if p.IPProto == IPProtocolUDP {
+		return udpHdrSize
+	}
+
+	return minIPPacketLen - minIPHdrSize
+}
+
+// checkLength truncates the buffer to the stated length of the packet, or returns an
+// error if the buffer is shorter
+func (p *Packet) checkLength() error {
+
 	if p.IPTotalLength != uint16(len(p.Buffer)) {
 		if p.IPTotalLength < uint16(len(p.Buffer)) {
 			p.Buffer = p.Buffer[:p.IPTotalLength]
@@ -97,23 +226,78 @@ func New(context uint64, bytes []byte, mark string) (packet *Packet, err error)
 				"IPTotalLength": p.IPTotalLength,
 				"bufferLength":  len(p.Buffer),
 			}).Debug("Stated IP packet length differs from bytes available")
-			return nil, fmt.Errorf("Stated IP packet length (%d) differs from bytes available (%d)", p.IPTotalLength, len(p.Buffer))
+			return fmt.Errorf("Stated IP packet length (%d) differs from bytes available (%d)", p.IPTotalLength, len(p.Buffer))
 		}
 	}
 
-	// TCP Header Processing
-	p.l4BeginPos = minIPHdrSize
-	p.TCPChecksum = binary.BigEndian.Uint16(bytes[TCPChecksumPos : TCPChecksumPos+2])
-	p.SourcePort = binary.BigEndian.Uint16(bytes[tcpSourcePortPos : tcpSourcePortPos+2])
-	p.DestinationPort = binary.BigEndian.Uint16(bytes[tcpDestPortPos : tcpDestPortPos+2])
-	p.TCPAck = binary.BigEndian.Uint32(bytes[tcpAckPos : tcpAckPos+4])
-	p.TCPSeq = binary.BigEndian.Uint32(bytes[tcpSeqPos : tcpSeqPos+4])
-	p.tcpDataOffset = (bytes[tcpDataOffsetPos] & tcpDataOffsetMask) >> 4
-	p.TCPFlags = bytes[tcpFlagsOffsetPos]
+	return nil
+}
 
-	p.context = context
+// IsIPv6 returns true if the packet is an IPv6 packet
+func (p *Packet) IsIPv6() bool {
+	return p.ipVersion == ipVersion6
+}
 
-	return &p, nil
+// UDPPayload returns the payload of a UDP packet, or nil for the other packets
+func (p *Packet) UDPPayload() []byte {
+
+	if p.IPProto != IPProtocolUDP || len(p.Buffer) < int(p.l4BeginPos)+udpHdrSize {
+		return nil
+	}
+
+	return p.Buffer[int(p.l4BeginPos)+udpHdrSize:]
+}
+
+// UDPDataAttach appends data to the payload of a UDP packet and updates the lengths
+// and the checksums of the IP and UDP headers
+func (p *Packet) UDPDataAttach(data []byte) error {
+
+	if p.IPProto != IPProtocolUDP {
+		return fmt.Errorf("Cannot attach UDP data to a packet of protocol %d", p.IPProto)
+	}
+
+	if int(p.IPTotalLength)+len(data) > 0xffff {
+		return fmt.Errorf("Cannot attach %d bytes to a UDP packet of %d bytes", len(data), p.IPTotalLength)
+	}
+
+	buffer := make([]byte, len(p.Buffer), len(p.Buffer)+len(data))
+	copy(buffer, p.Buffer)
+	p.Buffer = append(buffer, data...)
+
+	p.FixupIPHdrOnDataModify(p.IPTotalLength, p.IPTotalLength+uint16(len(data)))
+	p.fixupUDPHdrOnDataModify()
+
+	return nil
+}
+
+// UDPDataDetach removes the last length bytes of the payload of a UDP packet and
+// updates the lengths and the checksums of the IP and UDP headers
+func (p *Packet) UDPDataDetach(length uint16) error {
+
+	payload := p.UDPPayload()
+	if payload == nil || int(length) > len(payload) {
+		return fmt.Errorf("Cannot detach %d bytes from a UDP payload of %d bytes", length, len(payload))
+	}
+
+	p.Buffer = p.Buffer[:len(p.Buffer)-int(length)]
+
+	p.FixupIPHdrOnDataModify(p.IPTotalLength, p.IPTotalLength-length)
+	p.fixupUDPHdrOnDataModify()
+
+	return nil
+}
+
+// fixupUDPHdrOnDataModify updates the length and the checksum of the UDP header to
+// the current payload
+func (p *Packet) fixupUDPHdrOnDataModify() {
+
+	binary.BigEndian.PutUint16(p.Buffer[int(p.l4BeginPos)+udpLengthPos:int(p.l4BeginPos)+udpLengthPos+2], uint16(len(p.Buffer))-p.l4BeginPos)
+	p.UpdateUDPChecksum()
+}
+
+// tcpHeader returns the buffer from the beginning of the TCP header
+func (p *Packet) tcpHeader() []byte {
+	return p.Buffer[p.l4BeginPos:]
 }
 
 // GetTCPData returns any additional data in the packet
@@ -189,8 +373,8 @@ func (p *Packet) Print(context uint64) {
 			p.ipID,
 			flagsToDir(p.context|context),
 			flagsToStr(p.context|context),
-			p.SourceAddress.To4().String(), p.SourcePort,
-			p.DestinationAddress.To4().String(), p.DestinationPort,
+			p.SourceAddress.String(), p.SourcePort,
+			p.DestinationAddress.String(), p.DestinationPort,
 			tcpFlagsToStr(p.TCPFlags),
 			p.TCPSeq, p.TCPAck, p.IPTotalLength-p.TCPDataStartBytes(),
 			expAck, expAck, p.tcpDataOffset,
@@ -261,9 +445,28 @@ func (p *Packet) CheckTCPAuthenticationOption(iOptionLength int) (err error) {
 	return
 }
 
+// HasTCPAuthenticationOption returns true if the options of the TCP header end with
+// the authentication option. Unlike CheckTCPAuthenticationOption, it does not read
+// the fixed part of the header of the packets without options.
+func (p *Packet) HasTCPAuthenticationOption(iOptionLength int) bool {
+
+	if int(p.tcpDataOffset)*4-minTCPHeaderLen < iOptionLength {
+		return false
+	}
+
+	return p.Buffer[p.TCPDataStartBytes()-uint16(iOptionLength)] == TCPAuthenticationOption
+}
+
 // FixupIPHdrOnDataModify modifies the IP header fields and checksum
 func (p *Packet) FixupIPHdrOnDataModify(old, new uint16) {
 
+	// The IPv6 header has no checksum and states the length of the payload only
+	if p.ipVersion == ipVersion6 {
+		p.IPTotalLength = p.IPTotalLength + new - old
+		binary.BigEndian.PutUint16(p.Buffer[ipv6PayloadLenPos:ipv6PayloadLenPos+2], p.IPTotalLength-ipv6HdrSize)
+		return
+	}
+
 	// IP Header Processing
 	// IP chekcsum fixup.
 	p.ipChecksum = incCsum16(p.ipChecksum, old, new)
@@ -285,7 +488,7 @@ func (p *Packet) FixTCPCsum(old, new uint32) {
 	}
 
 	p.TCPChecksum = -uint16(a)
-	binary.BigEndian.PutUint16(p.Buffer[TCPChecksumPos:TCPChecksumPos+2], p.TCPChecksum)
+	binary.BigEndian.PutUint16(p.tcpHeader()[TCPChecksumPos:TCPChecksumPos+2], p.TCPChecksum)
 }
 
 // IncreaseTCPSeq increases TCP seq number by incr
@@ -293,7 +496,7 @@ func (p *Packet) IncreaseTCPSeq(incr uint32) {
 
 	oldTCPSeq := p.TCPSeq
 	p.TCPSeq = p.TCPSeq + incr
-	binary.BigEndian.PutUint32(p.Buffer[tcpSeqPos:tcpSeqPos+4], p.TCPSeq)
+	binary.BigEndian.PutUint32(p.tcpHeader()[tcpSeqPos:tcpSeqPos+4], p.TCPSeq)
 	p.FixTCPCsum(oldTCPSeq, p.TCPSeq)
 }
 
@@ -302,7 +505,7 @@ func (p *Packet) DecreaseTCPSeq(decr uint32) {
 
 	oldTCPSeq := p.TCPSeq
 	p.TCPSeq = p.TCPSeq - decr
-	binary.BigEndian.PutUint32(p.Buffer[tcpSeqPos:tcpSeqPos+4], p.TCPSeq)
+	binary.BigEndian.PutUint32(p.tcpHeader()[tcpSeqPos:tcpSeqPos+4], p.TCPSeq)
 	p.FixTCPCsum(oldTCPSeq, p.TCPSeq)
 }
 
@@ -311,7 +514,7 @@ func (p *Packet) IncreaseTCPAck(incr uint32) {
 
 	oldTCPAck := p.TCPAck
 	p.TCPAck = p.TCPAck + incr
-	binary.BigEndian.PutUint32(p.Buffer[tcpAckPos:tcpAckPos+4], p.TCPAck)
+	binary.BigEndian.PutUint32(p.tcpHeader()[tcpAckPos:tcpAckPos+4], p.TCPAck)
 	p.FixTCPCsum(oldTCPAck, p.TCPAck)
 }
 
@@ -320,7 +523,7 @@ func (p *Packet) DecreaseTCPAck(decr uint32) {
 
 	oldTCPAck := p.TCPAck
 	p.TCPAck = p.TCPAck - decr
-	binary.BigEndian.PutUint32(p.Buffer[tcpAckPos:tcpAckPos+4], p.TCPAck)
+	binary.BigEndian.PutUint32(p.tcpHeader()[tcpAckPos:tcpAckPos+4], p.TCPAck)
 	p.FixTCPCsum(oldTCPAck, p.TCPAck)
 }
 
@@ -362,11 +565,11 @@ func (p *Packet) FixupTCPHdrOnTCPDataDetach(dataLength uint16, optionLength uint
 	a := uint32(-p.TCPChecksum) - p.computeTCPChecksumDelta(p.tcpOptions[:optionLength], optionLength, p.tcpData[:dataLength], dataLength)
 	a = a + (a >> 16)
 	p.TCPChecksum = -uint16(a)
-	binary.BigEndian.PutUint16(p.Buffer[TCPChecksumPos:TCPChecksumPos+2], p.TCPChecksum)
+	binary.BigEndian.PutUint16(p.tcpHeader()[TCPChecksumPos:TCPChecksumPos+2], p.TCPChecksum)
 
 	// Update DataOffset
 	p.tcpDataOffset = p.tcpDataOffset - uint8(optionLength/4)
-	p.Buffer[tcpDataOffsetPos] = p.tcpDataOffset << 4
+	p.tcpHeader()[tcpDataOffsetPos] = p.tcpDataOffset << 4
 }
 
 // tcpDataDetach splits the p.Buffer into p.Buffer (header + some options), p.tcpOptions (optionLength) and p.TCPData (dataLength)
@@ -458,8 +661,8 @@ func (p *Packet) FixupTCPHdrOnTCPDataAttach(tcpOptions []byte, tcpData []byte) {
 
 	// Modify the fields
 	p.tcpDataOffset = p.tcpDataOffset + uint8(numberOfOptions)
-	binary.BigEndian.PutUint16(p.Buffer[TCPChecksumPos:TCPChecksumPos+2], p.TCPChecksum)
-	p.Buffer[tcpDataOffsetPos] = p.tcpDataOffset << 4
+	binary.BigEndian.PutUint16(p.tcpHeader()[TCPChecksumPos:TCPChecksumPos+2], p.TCPChecksum)
+	p.tcpHeader()[tcpDataOffsetPos] = p.tcpDataOffset << 4
 }
 
 // tcpDataAttach splits the p.Buffer into p.Buffer (header + some options), p.tcpOptions (optionLength) and p.TCPData (dataLength)
@@ -535,3 +738,49 @@ func (p *Packet) SynAckNetworkHash() string {
 func (p *Packet) SynAckApplicationHash() string {
 	return p.SourceAddress.String() + ":" + strconv.Itoa(int(p.SourcePort)) + ":" + strconv.Itoa(int(p.DestinationPort))
 }
+
+// TCPReset returns the TCP reset answering the packet. The reset acknowledges the
+// sequence space of the packet, so that its sender accepts it.
+func (p *Packet) TCPReset() *Packet {
+
+	var buffer []byte
+
+	if p.ipVersion == ipVersion6 {
+		buffer = make([]byte, ipv6HdrSize+minIPPacketLen-minIPHdrSize)
+		buffer[0] = ipVersion6 << 4
+		binary.BigEndian.PutUint16(buffer[ipv6PayloadLenPos:ipv6PayloadLenPos+2], minIPPacketLen-minIPHdrSize)
+		buffer[ipv6NextHeaderPos] = IPProtocolTCP
+		buffer[ipv6HopLimitPos] = 64
+		copy(buffer[ipv6SourceAddrPos:ipv6SourceAddrPos+16], p.DestinationAddress.To16())
+		copy(buffer[ipv6DestAddrPos:ipv6DestAddrPos+16], p.SourceAddress.To16())
+	} else {
+		buffer = make([]byte, minIPPacketLen)
+		buffer[ipHdrLenPos] = 0x40 | minIPHdrWords
+		binary.BigEndian.PutUint16(buffer[ipLengthPos:ipLengthPos+2], minIPPacketLen)
+		buffer[8] = 64
+		buffer[ipProtoPos] = IPProtocolTCP
+		copy(buffer[ipSourceAddrPos:ipSourceAddrPos+4], p.DestinationAddress.To4())
+		copy(buffer[ipDestAddrPos:ipDestAddrPos+4], p.SourceAddress.To4())
+	}
+
+	ack := p.TCPSeq + uint32(len(p.Buffer)) - uint32(p.TCPDataStartBytes())
+	if p.TCPFlags&(TCPSynMask|TCPFinMask) != 0 {
+		ack++
+	}
+
+	tcp := buffer[len(buffer)-(minIPPacketLen-minIPHdrSize):]
+	binary.BigEndian.PutUint16(tcp[tcpSourcePortPos:tcpSourcePortPos+2], p.DestinationPort)
+	binary.BigEndian.PutUint16(tcp[tcpDestPortPos:tcpDestPortPos+2], p.SourcePort)
+	if p.TCPFlags&TCPAckMask != 0 {
+		binary.BigEndian.PutUint32(tcp[tcpSeqPos:tcpSeqPos+4], p.TCPAck)
+	}
+	binary.BigEndian.PutUint32(tcp[tcpAckPos:tcpAckPos+4], ack)
+	tcp[tcpDataOffsetPos] = 5 << 4
+	tcp[tcpFlagsOffsetPos] = TCPRstMask | TCPAckMask
+
+	rst, _ := New(p.context, buffer, p.Mark)
+	rst.UpdateIPChecksum()
+	rst.UpdateTCPChecksum()
+
+	return rst
+}
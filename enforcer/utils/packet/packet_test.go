@@ -11,6 +11,7 @@ const (
 	synIPLenTooSmall
 	synMissingBytes
 	synBadIPChecksum
+	synIPv6GoodTCPChecksum
 )
 
 var testPackets = [][]byte{
@@ -57,7 +58,16 @@ var testPackets = [][]byte{
 		0x00, 0x7f, 0x00, 0x00, 0x01, 0x7f, 0x00, 0x00, 0x01, 0xb2, 0x64, 0x00, 0x63, 0x58, 0xd1,
 		0x24, 0xd9, 0x00, 0x00, 0x00, 0x00, 0xa0, 0x02, 0xaa, 0xaa, 0xfe, 0x30, 0x00, 0x00, 0x02,
 		0x04, 0xff, 0xd7, 0x04, 0x02, 0x08, 0x0a, 0x00, 0xc5, 0x8e, 0xf7, 0x00, 0x00, 0x00, 0x00,
-		0x01, 0x03, 0x03, 0x07}}
+		0x01, 0x03, 0x03, 0x07},
+
+	// SYN packet from ::1 port 35968 to ::1 port 99.
+	// Everything is correct.
+	[]byte{0x60, 0x00, 0x00, 0x00, 0x00, 0x28, 0x06, 0x40, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x8c, 0x80, 0x00,
+		0x63, 0x2c, 0x32, 0xa8, 0xd6, 0x00, 0x00, 0x00, 0x00, 0xa0, 0x02, 0xaa, 0xaa, 0xfc, 0x9c,
+		0x00, 0x00, 0x02, 0x04, 0xff, 0xc4, 0x04, 0x02, 0x08, 0x0a, 0xff, 0xff, 0x44, 0xba, 0x00,
+		0x00, 0x00, 0x00, 0x01, 0x03, 0x03, 0x07}}
 
 func TestGoodPacket(t *testing.T) {
 
@@ -223,6 +233,155 @@ func TestSetTCPChecksum(t *testing.T) {
 	}
 }
 
+func TestTCPReset(t *testing.T) {
+
+	t.Parallel()
+	pkt := getTestPacket(t, synGoodTCPChecksum)
+	rst := pkt.TCPReset()
+
+	if !rst.SourceAddress.Equal(pkt.DestinationAddress) || !rst.DestinationAddress.Equal(pkt.SourceAddress) {
+		t.Error("Reset addresses are not reversed")
+	}
+
+	if rst.SourcePort != pkt.DestinationPort || rst.DestinationPort != pkt.SourcePort {
+		t.Error("Reset ports are not reversed")
+	}
+
+	if rst.TCPFlags != TCPRstMask|TCPAckMask || rst.TCPSeq != 0 || rst.TCPAck != pkt.TCPSeq+1 {
+		t.Errorf("Reset does not acknowledge the syn: flags=%x seq=%d ack=%d", rst.TCPFlags, rst.TCPSeq, rst.TCPAck)
+	}
+
+	if !rst.VerifyIPChecksum() || !rst.VerifyTCPChecksum() {
+		t.Error("Reset checksums are wrong")
+	}
+}
+
+func TestHasTCPAuthenticationOption(t *testing.T) {
+
+	t.Parallel()
+	pkt := getTestPacket(t, synGoodTCPChecksum)
+	if pkt.HasTCPAuthenticationOption(4) {
+		t.Error("Unexpected authentication option in the options of the syn")
+	}
+
+	// The last option of the syn becomes the authentication option
+	pkt.Buffer[len(pkt.Buffer)-4] = TCPAuthenticationOption
+	if !pkt.HasTCPAuthenticationOption(4) {
+		t.Error("Authentication option not found")
+	}
+
+	// A header without options whose checksum looks like the option
+	tmp := make([]byte, len(testPackets[synGoodTCPChecksum]))
+	copy(tmp, testPackets[synGoodTCPChecksum])
+	tmp[32], tmp[36] = 0x50, TCPAuthenticationOption
+
+	pkt, err := New(0, tmp, "0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pkt.HasTCPAuthenticationOption(4) {
+		t.Error("Unexpected authentication option in a header without options")
+	}
+}
+
+func TestIPv6Packet(t *testing.T) {
+
+	t.Parallel()
+	pkt := getTestPacket(t, synIPv6GoodTCPChecksum)
+
+	if !pkt.IsIPv6() {
+		t.Error("Packet is not an IPv6 packet")
+	}
+
+	if pkt.SourceAddress.String() != "::1" || pkt.DestinationAddress.String() != "::1" {
+		t.Errorf("Unexpected addresses %s %s", pkt.SourceAddress, pkt.DestinationAddress)
+	}
+
+	if pkt.SourcePort != 35968 || pkt.DestinationPort != 99 {
+		t.Errorf("Unexpected ports %d %d", pkt.SourcePort, pkt.DestinationPort)
+	}
+
+	if pkt.IPTotalLength != 80 || pkt.TCPDataStartBytes() != 80 || pkt.TCPFlags != TCPSynMask {
+		t.Errorf("Unexpected lengths or flags: length=%d data=%d flags=%x", pkt.IPTotalLength, pkt.TCPDataStartBytes(), pkt.TCPFlags)
+	}
+
+	if !pkt.VerifyTCPChecksum() {
+		t.Error("TCP checksum failed")
+	}
+}
+
+func TestIPv6ExtensionHeader(t *testing.T) {
+
+	t.Parallel()
+	tmp := make([]byte, len(testPackets[synIPv6GoodTCPChecksum]))
+	copy(tmp, testPackets[synIPv6GoodTCPChecksum])
+
+	// Hop-by-hop options
+	tmp[6] = 0
+	if _, err := New(0, tmp, "0"); err == nil {
+		t.Error("Expected failure on an IPv6 extension header")
+	}
+}
+
+func TestIPv6DataAttachDetach(t *testing.T) {
+
+	t.Parallel()
+	pkt := getTestPacket(t, synIPv6GoodTCPChecksum)
+
+	options := []byte{TCPAuthenticationOption, 4, 0, 0}
+	data := []byte("IPv6 token")
+
+	if err := pkt.TCPDataAttach(options, data); err != nil {
+		t.Fatal(err)
+	}
+
+	pkt2, err := New(0, pkt.GetBytes(), "0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pkt2.IPTotalLength != 80+uint16(len(options)+len(data)) || !pkt2.VerifyTCPChecksum() {
+		t.Errorf("Attached packet is wrong: length=%d", pkt2.IPTotalLength)
+	}
+
+	if string(pkt2.ReadTCPData()) != string(data) {
+		t.Errorf("Unexpected data %s", pkt2.ReadTCPDataString())
+	}
+
+	if err := pkt2.TCPDataDetach(uint16(len(options))); err != nil {
+		t.Fatal(err)
+	}
+	pkt2.DropDetachedBytes()
+
+	if pkt2.IPTotalLength != 80 || !pkt2.VerifyTCPChecksum() {
+		t.Errorf("Detached packet is wrong: length=%d", pkt2.IPTotalLength)
+	}
+}
+
+func TestIPv6TCPReset(t *testing.T) {
+
+	t.Parallel()
+	pkt := getTestPacket(t, synIPv6GoodTCPChecksum)
+	rst := pkt.TCPReset()
+
+	if !rst.IsIPv6() || !rst.SourceAddress.Equal(pkt.DestinationAddress) || !rst.DestinationAddress.Equal(pkt.SourceAddress) {
+		t.Error("Reset addresses are not reversed")
+	}
+
+	if rst.SourcePort != pkt.DestinationPort || rst.DestinationPort != pkt.SourcePort {
+		t.Error("Reset ports are not reversed")
+	}
+
+	if rst.TCPFlags != TCPRstMask|TCPAckMask || rst.TCPAck != pkt.TCPSeq+1 {
+		t.Errorf("Reset does not acknowledge the syn: flags=%x ack=%d", rst.TCPFlags, rst.TCPAck)
+	}
+
+	if !rst.VerifyTCPChecksum() {
+		t.Error("Reset checksum is wrong")
+	}
+}
+
 func TestAddTag(t *testing.T) {
 
 	/*
@@ -435,3 +594,111 @@ func getTestPacketWithError(t *testing.T, id SamplePacketName) error {
 	_, err := New(0, tmp, "0")
 	return err
 }
+
+// udpTestPacket returns the bytes of a UDP packet from 127.0.0.1:40000 to
+// 127.0.0.1:53 with the payload and no UDP checksum
+func udpTestPacket(payload []byte) []byte {
+
+	buffer := []byte{0x45, 0x00, 0x00, 0x00, 0x00, 0x00, 0x40, 0x00, 0x40, 0x11, 0x00,
+		0x00, 0x7f, 0x00, 0x00, 0x01, 0x7f, 0x00, 0x00, 0x01, 0x9c, 0x40, 0x00, 0x35, 0x00,
+		0x00, 0x00, 0x00}
+
+	buffer = append(buffer, payload...)
+	buffer[3] = byte(len(buffer))
+	buffer[25] = byte(len(buffer) - minIPHdrSize)
+
+	return buffer
+}
+
+func TestUDPPacket(t *testing.T) {
+
+	t.Parallel()
+	pkt, err := New(0, udpTestPacket([]byte("ping")), "0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pkt.IPProto != IPProtocolUDP || pkt.SourcePort != 40000 || pkt.DestinationPort != 53 {
+		t.Errorf("Unexpected protocol or ports %d %d %d", pkt.IPProto, pkt.SourcePort, pkt.DestinationPort)
+	}
+
+	if string(pkt.UDPPayload()) != "ping" {
+		t.Errorf("Unexpected payload %s", pkt.UDPPayload())
+	}
+
+	if !pkt.VerifyUDPChecksum() {
+		t.Error("A UDP packet without checksum should be valid")
+	}
+
+	pkt.UpdateUDPChecksum()
+	if pkt.Buffer[26] != 0x86 || pkt.Buffer[27] != 0x8d {
+		t.Errorf("Unexpected UDP checksum %x", pkt.Buffer[26:28])
+	}
+}
+
+func TestUDPDataAttachDetach(t *testing.T) {
+
+	t.Parallel()
+	pkt, err := New(0, udpTestPacket([]byte("ping")), "0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkt.UpdateIPChecksum()
+
+	if err := pkt.UDPDataAttach([]byte("token")); err != nil {
+		t.Fatal(err)
+	}
+
+	pkt2, err := New(0, pkt.GetBytes(), "0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pkt2.IPTotalLength != 37 || string(pkt2.UDPPayload()) != "pingtoken" {
+		t.Errorf("Attached packet is wrong: length=%d payload=%s", pkt2.IPTotalLength, pkt2.UDPPayload())
+	}
+
+	if !pkt2.VerifyIPChecksum() || !pkt2.VerifyUDPChecksum() {
+		t.Error("Checksums of the attached packet are wrong")
+	}
+
+	if err := pkt2.UDPDataDetach(5); err != nil {
+		t.Fatal(err)
+	}
+
+	if pkt2.IPTotalLength != 32 || string(pkt2.UDPPayload()) != "ping" || pkt2.Buffer[25] != 12 {
+		t.Errorf("Detached packet is wrong: length=%d payload=%s", pkt2.IPTotalLength, pkt2.UDPPayload())
+	}
+
+	if !pkt2.VerifyIPChecksum() || !pkt2.VerifyUDPChecksum() {
+		t.Error("Checksums of the detached packet are wrong")
+	}
+
+	if err := pkt2.UDPDataDetach(5); err == nil {
+		t.Error("Expected failure detaching more than the payload")
+	}
+}
+
+func TestTruncatedIPHeader(t *testing.T) {
+
+	t.Parallel()
+	for length := 0; length < minIPHdrSize; length++ {
+		if _, err := New(0, testPackets[synGoodTCPChecksum][:length], "0"); err == nil {
+			t.Errorf("Expected failure given a buffer of %d bytes", length)
+		}
+	}
+}
+
+func TestInvalidTCPDataOffset(t *testing.T) {
+
+	t.Parallel()
+	for _, offset := range []byte{0, 4, 11, 15} {
+		buffer := make([]byte, len(testPackets[synGoodTCPChecksum]))
+		copy(buffer, testPackets[synGoodTCPChecksum])
+		buffer[minIPHdrSize+tcpDataOffsetPos] = offset << 4
+
+		if _, err := New(0, buffer, "0"); err == nil {
+			t.Errorf("Expected failure given a TCP data offset of %d", offset)
+		}
+	}
+}
@@ -148,6 +148,7 @@ type Packet struct {
 	tcpData    []byte
 
 	// IP Header fields
+	ipVersion          uint8
 	ipHeaderLen        uint8
 	IPProto            uint8
 	IPTotalLength      uint16
@@ -0,0 +1,251 @@
+package rpcwrapper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/aporeto-inc/trireme/utils/errortypes"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+)
+
+// The servers select the codec of a call by the content subtype of the client
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+// jsonCodec encodes the messages of the gRPC transport in JSON
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+// grpcMessage is a Request or a Response carried by the gRPC transport. The payload
+// is identified by its name in payloadNames.
+type grpcMessage struct {
+	HashAuth []byte            `json:"hash_auth,omitempty"`
+	Status   string            `json:"status,omitempty"`
+	Error    string            `json:"error,omitempty"`
+	Type     string            `json:"type,omitempty"`
+	Payload  json.RawMessage   `json:"payload,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// encodePayload sets the payload of a message
+func (m *grpcMessage) encodePayload(payload interface{}) error {
+
+	if payload == nil {
+		return nil
+	}
+
+	t := reflect.TypeOf(payload)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	for _, p := range payloadNames {
+		if reflect.TypeOf(p.payload) != t {
+			continue
+		}
+
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("Cannot encode payload %s: %s", p.name, err)
+		}
+
+		m.Type = p.name
+		m.Payload = data
+
+		return nil
+	}
+
+	return fmt.Errorf("Unknown payload type %s", t)
+}
+
+// decodePayload returns the payload of a message. Like gob, it returns the value and
+// not a pointer to it.
+func (m *grpcMessage) decodePayload() (interface{}, error) {
+
+	if m.Type == "" {
+		return nil, nil
+	}
+
+	for _, p := range payloadNames {
+		if p.name != m.Type {
+			continue
+		}
+
+		value := reflect.New(reflect.TypeOf(p.payload))
+		if err := json.Unmarshal(m.Payload, value.Interface()); err != nil {
+			return nil, fmt.Errorf("Cannot decode payload %s: %s", p.name, err)
+		}
+
+		return value.Elem().Interface(), nil
+	}
+
+	return nil, fmt.Errorf("Unknown payload type %s", m.Type)
+}
+
+// grpcMethod returns the gRPC method of a net/rpc method name, Service.Method
+func grpcMethod(methodName string) string {
+
+	return "/" + strings.Replace(methodName, ".", "/", 1)
+}
+
+// dialGRPC connects to the gRPC server of a channel
+func dialGRPC(channel string) (*RPCHdl, error) {
+
+	// gRPC connects lazily, so the channel is checked first like the net/rpc
+	// transport does
+	conn, err := net.Dial("unix", channel)
+	if err != nil {
+		return nil, err
+	}
+	conn.Close()
+
+	cc, err := grpc.Dial(channel,
+		grpc.WithInsecure(),
+		grpc.WithDialer(func(addr string, timeout time.Duration) (net.Conn, error) {
+			return net.DialTimeout("unix", addr, timeout)
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RPCHdl{Channel: channel, conn: cc}, nil
+}
+
+// invokeGRPC makes a remote call over a gRPC connection
+func invokeGRPC(cc *grpc.ClientConn, methodName string, req *Request, resp *Response, timeout time.Duration) error {
+
+	in := &grpcMessage{HashAuth: req.HashAuth, Metadata: req.Metadata}
+	if err := in.encodePayload(req.Payload); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	out := &grpcMessage{}
+	if err := grpc.Invoke(ctx, grpcMethod(methodName), in, out, cc, grpc.ForceCodec(jsonCodec{})); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return errortypes.Errorf(errortypes.ErrRPCTimeout, "%s timed out after %s", methodName, timeout)
+		}
+		return err
+	}
+
+	if out.Error != "" {
+		return errortypes.Decode(out.Error)
+	}
+
+	payload, err := out.decodePayload()
+	if err != nil {
+		return err
+	}
+
+	resp.Status = out.Status
+	resp.Payload = payload
+
+	return nil
+}
+
+var (
+	requestType  = reflect.TypeOf(Request{})
+	responseType = reflect.TypeOf(&Response{})
+	errorType    = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// newGRPCServer returns a gRPC server calling the methods of the handler. Like
+// net/rpc, the service is named after the type of the handler and its methods are
+// the exported methods of the form func(Request, *Response) error. The messages
+// larger than the message limit are rejected, if it is positive.
+func newGRPCServer(handler interface{}, messageLimit int) (*grpc.Server, error) {
+
+	value := reflect.ValueOf(handler)
+	service := reflect.Indirect(value).Type().Name()
+
+	desc := &grpc.ServiceDesc{
+		ServiceName: service,
+		HandlerType: (*interface{})(nil),
+		Methods:     []grpc.MethodDesc{},
+		Streams:     []grpc.StreamDesc{},
+	}
+
+	t := value.Type()
+	for i := 0; i < t.NumMethod(); i++ {
+		method := t.Method(i)
+		mt := method.Type
+
+		if mt.NumIn() != 3 || mt.In(1) != requestType || mt.In(2) != responseType || mt.NumOut() != 1 || mt.Out(0) != errorType {
+			continue
+		}
+
+		desc.Methods = append(desc.Methods, grpc.MethodDesc{
+			MethodName: method.Name,
+			Handler:    grpcHandler(value.Method(i)),
+		})
+	}
+
+	if len(desc.Methods) == 0 {
+		return nil, fmt.Errorf("Type %s has no method to serve", service)
+	}
+
+	options := []grpc.ServerOption{}
+	if messageLimit > 0 {
+		options = append(options, grpc.MaxRecvMsgSize(messageLimit))
+	}
+
+	server := grpc.NewServer(options...)
+	server.RegisterService(desc, handler)
+
+	return server, nil
+}
+
+// grpcHandler returns the gRPC handler of a method of the form
+// func(Request, *Response) error
+func grpcHandler(method reflect.Value) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+
+	return func(_ interface{}, _ context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+
+		in := &grpcMessage{}
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+
+		payload, err := in.decodePayload()
+		if err != nil {
+			return nil, err
+		}
+
+		req := Request{HashAuth: in.HashAuth, Payload: payload, Metadata: in.Metadata}
+		resp := &Response{}
+
+		// The error of the method is carried by the response with its category
+		ret := method.Call([]reflect.Value{reflect.ValueOf(req), reflect.ValueOf(resp)})
+		if err, ok := ret[0].Interface().(error); ok && err != nil {
+			return &grpcMessage{Error: errortypes.Encode(err)}, nil
+		}
+
+		out := &grpcMessage{Status: resp.Status}
+		if err := out.encodePayload(resp.Payload); err != nil {
+			return nil, err
+		}
+
+		return out, nil
+	}
+}
@@ -0,0 +1,96 @@
+package rpcwrapper
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aporeto-inc/trireme/utils/errortypes"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type grpcTestServer struct {
+	received interface{}
+	metadata map[string]string
+}
+
+func (s *grpcTestServer) Unenforce(req Request, resp *Response) error {
+	s.received = req.Payload
+	s.metadata = req.Metadata
+	resp.Payload = TransactionResponsePayload{Component: "enforcer"}
+	return nil
+}
+
+func (s *grpcTestServer) Fail(req Request, resp *Response) error {
+	return errortypes.Wrapf(errortypes.ErrPUNotFound, errors.New("failed"), "No context")
+}
+
+func (s *grpcTestServer) NotAMethod(value int) {}
+
+func TestGRPCMessages(t *testing.T) {
+	Convey("Given a message with a payload", t, func() {
+		m := &grpcMessage{}
+		So(m.encodePayload(&UnEnforcePayload{ContextID: "context"}), ShouldBeNil)
+
+		Convey("The payload should be named and encoded in JSON", func() {
+			So(m.Type, ShouldEqual, "github.com/aporeto-inc/enforcer/utils/rpcwrapper.UnEnforce_Payload")
+			So(string(m.Payload), ShouldEqual, `{"ContextID":"context"}`)
+		})
+
+		Convey("The payload should be decoded as a value", func() {
+			payload, err := m.decodePayload()
+			So(err, ShouldBeNil)
+			So(payload, ShouldResemble, UnEnforcePayload{ContextID: "context"})
+		})
+
+		Convey("The unknown payloads should be rejected", func() {
+			So(m.encodePayload(&grpcTestServer{}), ShouldNotBeNil)
+
+			m.Type = "unknown"
+			_, err := m.decodePayload()
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("The methods should be named like net/rpc", t, func() {
+		So(grpcMethod("Server.Unenforce"), ShouldEqual, "/Server/Unenforce")
+	})
+}
+
+func TestGRPCHandler(t *testing.T) {
+	Convey("Given a handler", t, func() {
+		s := &grpcTestServer{}
+		value := reflect.ValueOf(s)
+
+		in := &grpcMessage{HashAuth: []byte("hash"), Metadata: map[string]string{"traceparent": "00-trace-span-01"}}
+		So(in.encodePayload(&UnEnforcePayload{ContextID: "context"}), ShouldBeNil)
+		data, _ := json.Marshal(in)
+		dec := func(v interface{}) error { return json.Unmarshal(data, v) }
+
+		Convey("A call should receive the payload and return the response", func() {
+			out, err := grpcHandler(value.MethodByName("Unenforce"))(s, nil, dec, nil)
+			So(err, ShouldBeNil)
+			So(s.received, ShouldResemble, UnEnforcePayload{ContextID: "context"})
+			So(s.metadata, ShouldResemble, map[string]string{"traceparent": "00-trace-span-01"})
+
+			payload, err := out.(*grpcMessage).decodePayload()
+			So(err, ShouldBeNil)
+			So(payload, ShouldResemble, TransactionResponsePayload{Component: "enforcer"})
+		})
+
+		Convey("A failed call should return its error with its category", func() {
+			out, err := grpcHandler(value.MethodByName("Fail"))(s, nil, dec, nil)
+			So(err, ShouldBeNil)
+
+			failure := errortypes.Decode(out.(*grpcMessage).Error)
+			So(failure.Error(), ShouldEqual, "No context: failed")
+			So(errortypes.Is(failure, errortypes.ErrPUNotFound), ShouldBeTrue)
+		})
+
+		Convey("A type without methods to serve should be rejected", func() {
+			_, err := newGRPCServer(&struct{}{}, 0)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -1,5 +1,7 @@
 package rpcwrapper
 
+import "context"
+
 // RPCClient is the client interface
 type RPCClient interface {
 	NewRPCClient(contextID string, channel string, rpcSecret string) error
@@ -12,5 +14,7 @@ type RPCClient interface {
 // RPCServer is the server interface
 type RPCServer interface {
 	StartServer(protocol string, path string, handler interface{}) error
+	StartServerContext(ctx context.Context, protocol string, path string, handler interface{}) error
+	Stop()
 	ProcessMessage(req *Request, secret string) bool
 }
@@ -0,0 +1,250 @@
+package rpcwrapper
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrReadLimit is returned when a client sends more than the read limit of the server
+var ErrReadLimit = errors.New("RPC client exceeded the read limit")
+
+// ErrMessageLimit is returned when a client sends a message larger than the message
+// limit of the server
+var ErrMessageLimit = errors.New("RPC client exceeded the message limit")
+
+// limitedListener wraps the accepted connections in limitedConn
+type limitedListener struct {
+	net.Listener
+	limit    int64
+	interval time.Duration
+}
+
+// Accept is part of the net.Listener interface
+func (l *limitedListener) Accept() (net.Conn, error) {
+
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return &limitedConn{Conn: conn, limit: l.limit, interval: l.interval}, nil
+}
+
+// limitedConn is a connection that fails once more than limit bytes are read in an
+// interval. The rpc server closes the connection on the failure, so the client must
+// reconnect.
+type limitedConn struct {
+	net.Conn
+	limit    int64
+	interval time.Duration
+	start    time.Time
+	read     int64
+}
+
+// Read is part of the net.Conn interface
+func (c *limitedConn) Read(b []byte) (int, error) {
+
+	now := time.Now()
+	if now.Sub(c.start) >= c.interval {
+		c.start = now
+		c.read = 0
+	}
+
+	if c.read >= c.limit {
+		return 0, ErrReadLimit
+	}
+
+	if int64(len(b)) > c.limit-c.read {
+		b = b[:c.limit-c.read]
+	}
+
+	n, err := c.Conn.Read(b)
+	c.read += int64(n)
+
+	return n, err
+}
+
+// gobMessageReader reads the stream of gob messages of a connection and fails on the
+// length prefix of a message larger than the limit, before the decoder allocates
+// it. The connection is closed and the reader keeps failing afterwards.
+type gobMessageReader struct {
+	conn  io.ReadCloser
+	limit uint64
+	// remaining is the number of bytes of the current message left to read
+	remaining uint64
+	// prefix is the number of bytes of the length prefix left to read, and length
+	// the length read so far
+	prefix int
+	length uint64
+	err    error
+}
+
+// newGobMessageReader returns a reader of the messages of the connection up to the
+// limit, or the connection itself without limit
+func newGobMessageReader(conn io.ReadCloser, limit int) io.Reader {
+
+	if limit <= 0 {
+		return conn
+	}
+
+	return &gobMessageReader{conn: conn, limit: uint64(limit)}
+}
+
+// Read is part of the io.Reader interface. A gob message is prefixed by its length,
+// a single byte below 0x80, or a byte holding the negated number of the big endian
+// bytes of the length that follow.
+func (m *gobMessageReader) Read(b []byte) (int, error) {
+
+	if m.err != nil {
+		return 0, m.err
+	}
+
+	n, err := m.conn.Read(b)
+
+	// start is the position of the length prefix being read in the buffer
+	start := 0
+
+	for i := 0; i < n; {
+		if m.remaining > 0 {
+			skip := uint64(n - i)
+			if skip > m.remaining {
+				skip = m.remaining
+			}
+			m.remaining -= skip
+			i += int(skip)
+			continue
+		}
+
+		if m.prefix == 0 {
+			start = i
+		}
+
+		c := b[i]
+		i++
+
+		switch {
+		case m.prefix > 0:
+			m.length = m.length<<8 | uint64(c)
+			m.prefix--
+			if m.prefix > 0 {
+				continue
+			}
+		case c < 0x80:
+			m.length = uint64(c)
+		default:
+			m.prefix = 256 - int(c)
+			m.length = 0
+			if m.prefix > 8 {
+				return m.fail(start)
+			}
+			continue
+		}
+
+		if m.length > m.limit {
+			return m.fail(start)
+		}
+		m.remaining = m.length
+	}
+
+	return n, err
+}
+
+// fail closes the connection and records the error. The bytes of the buffer before
+// the length prefix of the message are returned, the error is returned by the next
+// reads.
+func (m *gobMessageReader) fail(start int) (int, error) {
+
+	m.err = ErrMessageLimit
+	m.conn.Close()
+
+	if start == 0 {
+		return 0, m.err
+	}
+
+	return start, nil
+}
+
+// RecordBudget limits the number of records accepted in an interval
+type RecordBudget struct {
+	limit    int
+	interval time.Duration
+	start    time.Time
+	used     int
+	sync.Mutex
+}
+
+// NewRecordBudget returns a RecordBudget of limit records per interval
+func NewRecordBudget(limit int, interval time.Duration) *RecordBudget {
+
+	return &RecordBudget{
+		limit:    limit,
+		interval: interval,
+	}
+}
+
+// Take reserves n records from the budget of the current interval and returns
+// the number of records granted
+func (b *RecordBudget) Take(n int) int {
+
+	b.Lock()
+	defer b.Unlock()
+
+	now := time.Now()
+	if now.Sub(b.start) >= b.interval {
+		b.start = now
+		b.used = 0
+	}
+
+	if n > b.limit-b.used {
+		n = b.limit - b.used
+	}
+
+	b.used += n
+
+	return n
+}
+
+// payloadBytes returns the bytes of the payload covered by the hmac of a request.
+// The flows of the stats payload are a map and are serialized in the order of their
+// keys, followed by its records.
+func payloadBytes(payload interface{}) []byte {
+
+	var buf bytes.Buffer
+
+	switch p := payload.(type) {
+	case *StatsPayload:
+		writeStatsPayload(&buf, p)
+	case StatsPayload:
+		writeStatsPayload(&buf, &p)
+	default:
+		binary.Write(&buf, binary.BigEndian, payload)
+	}
+
+	return buf.Bytes()
+}
+
+func writeStatsPayload(buf *bytes.Buffer, p *StatsPayload) {
+
+	keys := make([]string, 0, len(p.Flows))
+	for key := range p.Flows {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	encoder := json.NewEncoder(buf)
+	for _, key := range keys {
+		buf.WriteString(key)
+		encoder.Encode(p.Flows[key])
+	}
+
+	for _, record := range p.Records {
+		encoder.Encode(record)
+	}
+}
@@ -0,0 +1,145 @@
+package rpcwrapper
+
+import (
+	"bytes"
+	"encoding/gob"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aporeto-inc/trireme/collector"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLimitedConn(t *testing.T) {
+	Convey("Given a connection limited to 4 bytes per interval", t, func() {
+		client, server := net.Pipe()
+		defer client.Close()
+
+		conn := &limitedConn{Conn: server, limit: 4, interval: time.Hour}
+
+		go client.Write([]byte("abcdefgh"))
+
+		Convey("Reads should fail once the limit is reached", func() {
+			buf := make([]byte, 8)
+			n, err := conn.Read(buf)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 4)
+
+			_, err = conn.Read(buf)
+			So(err, ShouldEqual, ErrReadLimit)
+		})
+	})
+}
+
+// closeRecorder records that the reader was closed
+type closeRecorder struct {
+	*bytes.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+
+	c.closed = true
+
+	return nil
+}
+
+func TestGobMessageReader(t *testing.T) {
+	Convey("Given a stream of gob messages", t, func() {
+		var buf bytes.Buffer
+		enc := gob.NewEncoder(&buf)
+		So(enc.Encode("small"), ShouldBeNil)
+		So(enc.Encode(strings.Repeat("x", 1000)), ShouldBeNil)
+
+		Convey("The messages below the limit should be decoded", func() {
+			conn := &closeRecorder{Reader: bytes.NewReader(buf.Bytes())}
+			dec := gob.NewDecoder(newGobMessageReader(conn, 2000))
+
+			var small, large string
+			So(dec.Decode(&small), ShouldBeNil)
+			So(dec.Decode(&large), ShouldBeNil)
+			So(len(large), ShouldEqual, 1000)
+			So(conn.closed, ShouldBeFalse)
+		})
+
+		Convey("A message over the limit should close the connection", func() {
+			conn := &closeRecorder{Reader: bytes.NewReader(buf.Bytes())}
+			dec := gob.NewDecoder(newGobMessageReader(conn, 100))
+
+			var small, large string
+			So(dec.Decode(&small), ShouldBeNil)
+			So(dec.Decode(&large), ShouldNotBeNil)
+			So(conn.closed, ShouldBeTrue)
+		})
+	})
+}
+
+func TestRecordBudget(t *testing.T) {
+	Convey("Given a budget of 10 records", t, func() {
+		b := NewRecordBudget(10, time.Hour)
+
+		Convey("It should grant records until it is exhausted", func() {
+			So(b.Take(6), ShouldEqual, 6)
+			So(b.Take(6), ShouldEqual, 4)
+			So(b.Take(1), ShouldEqual, 0)
+		})
+
+		Convey("It should be renewed in the next interval", func() {
+			So(b.Take(10), ShouldEqual, 10)
+			b.start = time.Now().Add(-2 * time.Hour)
+			So(b.Take(3), ShouldEqual, 3)
+		})
+	})
+}
+
+func TestStatsPayloadValidity(t *testing.T) {
+	Convey("Given a signed stats payload", t, func() {
+		r := NewRPCWrapper()
+
+		payload := StatsPayload{
+			Flows: map[string]*collector.FlowRecord{
+				"a": {ContextID: "1", DestinationPort: 80},
+				"b": {ContextID: "1", DestinationPort: 443},
+			},
+		}
+
+		digest := payloadHash(&payload, "statssecret")
+
+		Convey("The server should accept it with the stats secret only", func() {
+			So(r.CheckValidity(&Request{HashAuth: digest, Payload: payload}, "statssecret"), ShouldBeTrue)
+			So(r.CheckValidity(&Request{HashAuth: digest, Payload: payload}, "othersecret"), ShouldBeFalse)
+		})
+
+		Convey("The server should reject it if the records are modified", func() {
+			payload.Flows["b"] = &collector.FlowRecord{ContextID: "1", DestinationPort: 22}
+			So(r.CheckValidity(&Request{HashAuth: digest, Payload: payload}, "statssecret"), ShouldBeFalse)
+		})
+	})
+
+	Convey("Given a signed stats payload carrying a slice of records", t, func() {
+		r := NewRPCWrapper()
+
+		payload := StatsPayload{
+			Records: []*collector.FlowRecord{
+				{ContextID: "1", DestinationPort: 80},
+				{ContextID: "1", DestinationPort: 443},
+			},
+		}
+
+		digest := payloadHash(&payload, "statssecret")
+
+		Convey("The server should reject it if the records are modified", func() {
+			So(r.CheckValidity(&Request{HashAuth: digest, Payload: payload}, "statssecret"), ShouldBeTrue)
+
+			payload.Records[1] = &collector.FlowRecord{ContextID: "1", DestinationPort: 22}
+			So(r.CheckValidity(&Request{HashAuth: digest, Payload: payload}, "statssecret"), ShouldBeFalse)
+		})
+
+		Convey("The records of both fields should be returned", func() {
+			payload.Flows = map[string]*collector.FlowRecord{"a": {ContextID: "1", DestinationPort: 22}}
+			So(len(payload.FlowRecords()), ShouldEqual, 3)
+		})
+	})
+}
@@ -0,0 +1,56 @@
+package rpcwrapper
+
+import "sync"
+
+// CallQueue serializes the calls made to the remote enforcer of each context. The
+// calls received while a call of the same context is in progress, such as the policy
+// updates of a PU whose remote enforcer is still starting, are coalesced: only the
+// latest one is kept and it is applied when the call in progress completes.
+type CallQueue struct {
+	active  map[string]bool
+	pending map[string]interface{}
+	sync.Mutex
+}
+
+// NewCallQueue returns an empty call queue
+func NewCallQueue() *CallQueue {
+
+	return &CallQueue{
+		active:  map[string]bool{},
+		pending: map[string]interface{}{},
+	}
+}
+
+// Acquire returns true if the caller must make the call of the context, and then
+// drain the queue with Next. It returns false if a call of the context is already in
+// progress, in which case the call replaces the one pending for the context.
+func (q *CallQueue) Acquire(contextID string, call interface{}) bool {
+	q.Lock()
+	defer q.Unlock()
+
+	if q.active[contextID] {
+		q.pending[contextID] = call
+		return false
+	}
+
+	q.active[contextID] = true
+
+	return true
+}
+
+// Next returns the call pending for the context, which the caller must make next. It
+// returns false and releases the context when no call is pending.
+func (q *CallQueue) Next(contextID string) (interface{}, bool) {
+	q.Lock()
+	defer q.Unlock()
+
+	call, ok := q.pending[contextID]
+	if !ok {
+		delete(q.active, contextID)
+		return nil, false
+	}
+
+	delete(q.pending, contextID)
+
+	return call, true
+}
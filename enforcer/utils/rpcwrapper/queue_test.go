@@ -0,0 +1,49 @@
+package rpcwrapper
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCallQueue(t *testing.T) {
+	Convey("Given a call queue", t, func() {
+		q := NewCallQueue()
+
+		Convey("When a call is acquired for a context", func() {
+			So(q.Acquire("context", 1), ShouldBeTrue)
+
+			Convey("Then the calls of other contexts should not wait", func() {
+				So(q.Acquire("other", 1), ShouldBeTrue)
+			})
+
+			Convey("Then the calls of the context should be coalesced to the latest one", func() {
+				So(q.Acquire("context", 2), ShouldBeFalse)
+				So(q.Acquire("context", nil), ShouldBeFalse)
+				So(q.Acquire("context", 3), ShouldBeFalse)
+
+				call, ok := q.Next("context")
+				So(ok, ShouldBeTrue)
+				So(call, ShouldEqual, 3)
+
+				_, ok = q.Next("context")
+				So(ok, ShouldBeFalse)
+				So(q.Acquire("context", 4), ShouldBeTrue)
+			})
+
+			Convey("Then a queued nil call should be returned", func() {
+				So(q.Acquire("context", nil), ShouldBeFalse)
+
+				call, ok := q.Next("context")
+				So(ok, ShouldBeTrue)
+				So(call, ShouldBeNil)
+			})
+
+			Convey("Then the context should be released when no call is pending", func() {
+				_, ok := q.Next("context")
+				So(ok, ShouldBeFalse)
+				So(q.Acquire("context", 2), ShouldBeTrue)
+			})
+		})
+	})
+}
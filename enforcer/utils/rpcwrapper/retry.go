@@ -0,0 +1,77 @@
+package rpcwrapper
+
+import (
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy is the strategy of the connections to the channels of the remote
+// enforcers, which are created some time after the enforcers are launched. The delay
+// between two attempts starts at InitialDelay and is multiplied by Multiplier up to
+// MaxDelay. The attempts stop when the next one would start after Timeout.
+type RetryPolicy struct {
+	// InitialDelay is the delay after the first failed attempt
+	InitialDelay time.Duration
+	// MaxDelay caps the delay between two attempts, if not zero
+	MaxDelay time.Duration
+	// Multiplier is the exponential backoff factor. The delay is constant if it is
+	// not greater than 1.
+	Multiplier float64
+	// Jitter is the fraction of the delay randomly added or removed, between 0 and 1,
+	// so that the connections of enforcers launched together do not retry in lockstep
+	Jitter float64
+	// Timeout bounds the total time of the attempts. The channel is dialed only once
+	// if it is zero.
+	Timeout time.Duration
+}
+
+// DefaultRetryPolicy returns the policy of the wrappers created without the
+// WithRetryPolicy option. It waits for about 10 seconds.
+func DefaultRetryPolicy() *RetryPolicy {
+
+	return &RetryPolicy{
+		InitialDelay: 5 * time.Millisecond,
+		MaxDelay:     500 * time.Millisecond,
+		Multiplier:   2,
+		Jitter:       0.2,
+		Timeout:      10 * time.Second,
+	}
+}
+
+// WithRetryPolicy sets the strategy of the connections of NewRPCClient
+func WithRetryPolicy(policy *RetryPolicy) Option {
+
+	return func(r *RPCWrapper) {
+		r.retry = policy
+	}
+}
+
+// backoff returns the delays between the attempts of the policy
+func (p *RetryPolicy) backoff() func() time.Duration {
+
+	next := p.InitialDelay
+
+	return func() time.Duration {
+
+		delay := next
+
+		if p.Multiplier > 1 {
+			next = time.Duration(float64(next) * p.Multiplier)
+		}
+
+		if p.MaxDelay > 0 && next > p.MaxDelay {
+			next = p.MaxDelay
+		}
+
+		// Past the timeout, the delay cannot grow anymore
+		if p.MaxDelay == 0 && next > p.Timeout {
+			next = p.Timeout
+		}
+
+		if p.Jitter > 0 {
+			delay += time.Duration(float64(delay) * p.Jitter * (2*rand.Float64() - 1))
+		}
+
+		return delay
+	}
+}
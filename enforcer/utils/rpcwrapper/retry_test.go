@@ -0,0 +1,80 @@
+package rpcwrapper
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aporeto-inc/trireme/utils/errortypes"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	Convey("Given an exponential retry policy", t, func() {
+		policy := &RetryPolicy{
+			InitialDelay: 10 * time.Millisecond,
+			MaxDelay:     50 * time.Millisecond,
+			Multiplier:   2,
+			Timeout:      time.Second,
+		}
+
+		Convey("The delays should double up to the maximum delay", func() {
+			backoff := policy.backoff()
+			delays := []time.Duration{}
+			for i := 0; i < 5; i++ {
+				delays = append(delays, backoff())
+			}
+
+			So(delays, ShouldResemble, []time.Duration{
+				10 * time.Millisecond,
+				20 * time.Millisecond,
+				40 * time.Millisecond,
+				50 * time.Millisecond,
+				50 * time.Millisecond,
+			})
+		})
+
+		Convey("The delays should stay within the jitter", func() {
+			policy.Jitter = 0.5
+			backoff := policy.backoff()
+
+			for i := 0; i < 20; i++ {
+				delay := backoff()
+				So(delay, ShouldBeGreaterThanOrEqualTo, 5*time.Millisecond)
+				So(delay, ShouldBeLessThanOrEqualTo, 75*time.Millisecond)
+			}
+		})
+	})
+
+	Convey("Given a wrapper without server", t, func() {
+		channel := filepath.Join("/nonexistent", "enforcer.sock")
+
+		Convey("The connection should fail with the channel once the timeout expires", func() {
+			rpchdl := NewRPCWrapper(WithRetryPolicy(&RetryPolicy{
+				InitialDelay: 5 * time.Millisecond,
+				Multiplier:   2,
+				Timeout:      50 * time.Millisecond,
+			}))
+
+			start := time.Now()
+			err := rpchdl.NewRPCClient("12345", channel, "mysecret")
+
+			So(err, ShouldNotBeNil)
+			So(errortypes.Is(err, errortypes.ErrRPCTimeout), ShouldBeTrue)
+			So(strings.Contains(err.Error(), channel), ShouldBeTrue)
+			So(time.Since(start), ShouldBeLessThan, 50*time.Millisecond+time.Second)
+		})
+
+		Convey("The channel should be dialed only once without timeout", func() {
+			rpchdl := NewRPCWrapper(WithRetryPolicy(&RetryPolicy{InitialDelay: time.Second}))
+
+			start := time.Now()
+			err := rpchdl.NewRPCClient("12345", channel, "mysecret")
+
+			So(err, ShouldNotBeNil)
+			So(strings.Contains(err.Error(), "after 1 attempts"), ShouldBeTrue)
+			So(time.Since(start), ShouldBeLessThan, time.Second)
+		})
+	})
+}
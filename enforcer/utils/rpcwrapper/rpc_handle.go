@@ -1,22 +1,27 @@
 package rpcwrapper
 
 import (
-	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
-	"encoding/binary"
 	"encoding/gob"
-	"log"
+	"errors"
+	"fmt"
 	"net"
-	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
+	"sync"
 	"time"
 
 	"net/rpc"
 
 	"github.com/aporeto-inc/trireme/cache"
+	"github.com/aporeto-inc/trireme/utils/errortypes"
+	"github.com/aporeto-inc/trireme/utils/selfprotect"
+	"github.com/aporeto-inc/trireme/utils/sockets"
+	"github.com/aporeto-inc/trireme/utils/tracing"
+	"google.golang.org/grpc"
 )
 
 //RPCHdl is a per client handle
@@ -24,28 +29,56 @@ type RPCHdl struct {
 	Client  *rpc.Client
 	Channel string
 	Secret  string
+	// conn is the connection of the gRPC transport. Client is nil when it is set.
+	conn *grpc.ClientConn
+}
+
+// Close closes the connection of the handle
+func (h *RPCHdl) Close() error {
+
+	if h.conn != nil {
+		return h.conn.Close()
+	}
+
+	return h.Client.Close()
 }
 
 //RPCWrapper  is a struct which holds stats for all rpc sesions
 type RPCWrapper struct {
 	rpcClientMap *cache.Cache
 	contextList  []string
+	readLimit    int64
+	readInterval time.Duration
+	messageLimit int
+	transport    Transport
+	sockets      *sockets.Options
+	retry        *RetryPolicy
+	drainTimeout time.Duration
+	// stop is closed when the servers of the wrapper are stopped
+	stop     chan struct{}
+	stopped  bool
+	servers  sync.WaitGroup
+	stopLock sync.Mutex
 }
 
 //NewRPCWrapper creates a new rpcwrapper
-func NewRPCWrapper() *RPCWrapper {
+func NewRPCWrapper(options ...Option) *RPCWrapper {
 	rpcwrapper := &RPCWrapper{
 		rpcClientMap: cache.NewCache(),
 		contextList:  []string{},
 	}
 
+	for _, option := range options {
+		option(rpcwrapper)
+	}
+
 	rpcwrapper.rpcClientMap = cache.NewCache()
 	return rpcwrapper
 }
 
 const (
-	maxRetries     = 1000
-	envRetryString = "REMOTE_RPCRETRIES"
+	defaultTimeout   = 2 * time.Minute
+	envTimeoutString = "REMOTE_RPCTIMEOUT"
 )
 
 //NewRPCClient exported
@@ -55,33 +88,54 @@ func (r *RPCWrapper) NewRPCClient(contextID string, channel string, sharedsecret
 
 	//establish new connection to context/container
 	RegisterTypes()
-	var max int
-	retries := os.Getenv(envRetryString)
-	if len(retries) > 0 {
-		max, _ = strconv.Atoi(retries)
 
-	} else {
-		max = maxRetries
+	policy := r.retry
+	if policy == nil {
+		policy = DefaultRetryPolicy()
 	}
-	numRetries := 0
-	client, err := rpc.DialHTTP("unix", channel)
+
+	backoff := policy.backoff()
+	start := time.Now()
+	attempts := 1
+
+	hdl, err := r.dial(channel)
 
 	for err != nil {
-		time.Sleep(5 * time.Millisecond)
+		delay := backoff()
+		elapsed := time.Since(start)
 
-		numRetries = numRetries + 1
-		if numRetries < max {
-			client, err = rpc.DialHTTP("unix", channel)
-		} else {
-			return err
+		if elapsed+delay > policy.Timeout {
+			return errortypes.Wrapf(errortypes.ErrRPCTimeout, err, "Cannot connect to %s after %d attempts in %s", channel, attempts, elapsed)
 		}
+
+		time.Sleep(delay)
+
+		attempts++
+		hdl, err = r.dial(channel)
 	}
 
+	hdl.Secret = sharedsecret
+
 	r.contextList = append(r.contextList, contextID)
-	return r.rpcClientMap.Add(contextID, &RPCHdl{Client: client, Channel: channel, Secret: sharedsecret})
+	return r.rpcClientMap.Add(contextID, hdl)
 
 }
 
+// dial connects to a channel with the transport of the wrapper
+func (r *RPCWrapper) dial(channel string) (*RPCHdl, error) {
+
+	if r.transport == GRPCTransport {
+		return dialGRPC(channel)
+	}
+
+	client, err := rpc.DialHTTP("unix", channel)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RPCHdl{Client: client, Channel: channel}, nil
+}
+
 //GetRPCClient gets a handle to the rpc client for the contextID( enforcer in the container)
 func (r *RPCWrapper) GetRPCClient(contextID string) (*RPCHdl, error) {
 
@@ -89,81 +143,284 @@ func (r *RPCWrapper) GetRPCClient(contextID string) (*RPCHdl, error) {
 	if err == nil {
 		return val.(*RPCHdl), err
 	}
-	return nil, err
+	return nil, errortypes.Wrapf(errortypes.ErrPUNotFound, err, "No rpc client for %s", contextID)
 }
 
 //RemoteCall is a wrapper around rpc.Call and also ensure message integrity by adding a hmac
-func (r *RPCWrapper) RemoteCall(contextID string, methodName string, req *Request, resp *Response) error {
+//The call is traced as a child of the operation bound to the PU, and its trace is
+//carried in the metadata of the request.
+func (r *RPCWrapper) RemoteCall(contextID string, methodName string, req *Request, resp *Response) (err error) {
+
+	ctx, span := tracing.Start(tracing.ContextOf(contextID), "rpcwrapper.RemoteCall")
+	span.SetAttribute(tracing.ContextIDAttribute, contextID)
+	span.SetAttribute(tracing.MethodAttribute, methodName)
+	defer func() {
+		tracing.End(span, err)
+	}()
 
-	var rpcBuf bytes.Buffer
-	binary.Write(&rpcBuf, binary.BigEndian, req.Payload)
 	rpcClient, err := r.GetRPCClient(contextID)
 	if err != nil {
 		return err
 	}
 
-	digest := hmac.New(sha256.New, []byte(rpcClient.Secret))
-	digest.Write(rpcBuf.Bytes())
-	req.HashAuth = digest.Sum(nil)
+	req.HashAuth = payloadHash(req.Payload, rpcClient.Secret)
+	req.Metadata = tracing.Inject(ctx)
+
+	timeout := rpcTimeout()
+
+	if rpcClient.conn != nil {
+		return invokeGRPC(rpcClient.conn, methodName, req, resp, timeout)
+	}
+
+	// The response of a call that timed out can still be decoded later, so each call
+	// decodes its own response, copied once the call is done
+	reply := &Response{}
+	call := rpcClient.Client.Go(methodName, req, reply, make(chan *rpc.Call, 1))
+
+	select {
+	case <-call.Done:
+		if serr, ok := call.Error.(rpc.ServerError); ok {
+			return errortypes.Decode(string(serr))
+		}
+		if call.Error != nil {
+			return call.Error
+		}
+		*resp = *reply
+		return nil
+	case <-time.After(timeout):
+		return errortypes.Errorf(errortypes.ErrRPCTimeout, "%s timed out after %s", methodName, timeout)
+	}
+}
+
+// StartServerSpan starts the span of a remote call received by a server, child of
+// the span of the caller carried by the metadata of the request
+func StartServerSpan(req *Request, methodName string) (context.Context, tracing.Span) {
+
+	ctx, span := tracing.Start(tracing.Extract(context.Background(), req.Metadata), methodName)
+	span.SetAttribute(tracing.MethodAttribute, methodName)
+
+	return ctx, span
+}
+
+// rpcTimeout returns the timeout of the remote calls, in seconds in the environment
+func rpcTimeout() time.Duration {
+
+	if seconds, err := strconv.Atoi(os.Getenv(envTimeoutString)); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	return defaultTimeout
+}
+
+// ServerError returns the error of a server method carrying the category of err, so
+// that the caller gets an error of the same category. net/rpc only carries the
+// message of the errors.
+func ServerError(err error) error {
 
-	return rpcClient.Client.Call(methodName, req, resp)
+	if err == nil {
+		return nil
+	}
 
+	return errors.New(errortypes.Encode(err))
 }
 
 //CheckValidity checks if the received message is valid
 func (r *RPCWrapper) CheckValidity(req *Request, secret string) bool {
 
-	var rpcBuf bytes.Buffer
-	binary.Write(&rpcBuf, binary.BigEndian, req.Payload)
+	return hmac.Equal(req.HashAuth, payloadHash(req.Payload, secret))
+}
+
+// payloadHash returns the hmac of a payload with the given secret
+func payloadHash(payload interface{}, secret string) []byte {
+
 	digest := hmac.New(sha256.New, []byte(secret))
-	digest.Write(rpcBuf.Bytes())
-	return hmac.Equal(req.HashAuth, digest.Sum(nil))
+	digest.Write(payloadBytes(payload))
+	return digest.Sum(nil)
 }
 
 //NewRPCServer returns an interface RPCServer
-func NewRPCServer() RPCServer {
+func NewRPCServer(options ...Option) RPCServer {
+
+	r := &RPCWrapper{}
 
-	return &RPCWrapper{}
+	for _, option := range options {
+		option(r)
+	}
+
+	return r
 }
 
-//StartServer Starts a server and waits for new connections this function never returns
+// SetReadLimit limits the number of bytes the server reads from every client
+// connection per interval. Connections that exceed the limit are closed.
+func (r *RPCWrapper) SetReadLimit(limit int64, interval time.Duration) {
+
+	r.readLimit = limit
+	r.readInterval = interval
+}
+
+// SetMessageLimit limits the size of the messages the server reads from its clients.
+// The connection of a client sending a larger message is closed.
+func (r *RPCWrapper) SetMessageLimit(limit int) {
+
+	r.messageLimit = limit
+}
+
+//StartServer starts a server and serves the connections until the process is
+//interrupted or the server is stopped with Stop
 func (r *RPCWrapper) StartServer(protocol string, path string, handler interface{}) error {
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	defer signal.Stop(c)
+
+	go func() {
+		select {
+		case <-c:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return r.StartServerContext(ctx, protocol, path, handler)
+}
+
+// StartServerContext starts a server and serves the connections until the context is
+// done or the server is stopped with Stop. The server then stops accepting
+// connections, waits for the calls in flight up to the drain timeout and removes the
+// socket before returning.
+func (r *RPCWrapper) StartServerContext(ctx context.Context, protocol string, path string, handler interface{}) error {
+
 	RegisterTypes()
 
-	rpc.Register(handler)
-	rpc.HandleHTTP()
-	os.Remove(path)
 	if len(path) == 0 {
-		log.Fatal("Sock param not passed in environment")
+		return fmt.Errorf("Sock param not passed in environment")
+	}
+
+	stop, err := r.startServing()
+	if err != nil {
+		return err
 	}
-	listen, err := net.Listen(protocol, path)
+	defer r.servers.Done()
 
+	server, err := r.newServer(handler)
 	if err != nil {
+		return err
+	}
 
+	listen, err := r.listen(protocol, path)
+	if err != nil {
 		return err
 	}
-	go http.Serve(listen, nil)
+
+	// The socket is removed whatever the reason the server stops
 	defer func() {
 		listen.Close()
-		os.Remove(path)
+		if protocol == "unix" {
+			os.Remove(path)
+		}
+	}()
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.serve(listen)
 	}()
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	<-c
 
-	_, err = os.Stat(path)
-	if !os.IsNotExist(err) {
-		os.Remove(path)
+	select {
+	case <-ctx.Done():
+	case <-stop:
+	case err := <-errs:
+		server.shutdown(0)
+		return err
 	}
+
+	listen.Close()
+	server.shutdown(r.drainTime())
+
 	return nil
 }
 
+// listen returns the listener of a server, with the protections and the limits of
+// the wrapper
+func (r *RPCWrapper) listen(protocol string, path string) (net.Listener, error) {
+
+	var listen net.Listener
+	var err error
+
+	if protocol == "unix" {
+		listen, err = sockets.ListenWithOptions(path, r.sockets)
+	} else {
+		listen, err = net.Listen(protocol, path)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if protocol == "unix" {
+		listen = selfprotect.NewWorkloadFilter(listen)
+	}
+
+	if r.readLimit > 0 {
+		listen = &limitedListener{Listener: listen, limit: r.readLimit, interval: r.readInterval}
+	}
+
+	return listen, nil
+}
+
+// startServing registers a server of the wrapper and returns the channel closed when
+// it must stop, unless the wrapper is stopped already
+func (r *RPCWrapper) startServing() (chan struct{}, error) {
+
+	r.stopLock.Lock()
+	defer r.stopLock.Unlock()
+
+	if r.stopped {
+		return nil, fmt.Errorf("Server stopped")
+	}
+
+	if r.stop == nil {
+		r.stop = make(chan struct{})
+	}
+
+	r.servers.Add(1)
+
+	return r.stop, nil
+}
+
+// Stop stops the servers of the wrapper and returns once they are stopped and their
+// sockets are removed. The servers started afterwards fail.
+func (r *RPCWrapper) Stop() {
+
+	r.stopLock.Lock()
+	if !r.stopped {
+		r.stopped = true
+		if r.stop != nil {
+			close(r.stop)
+		}
+	}
+	r.stopLock.Unlock()
+
+	r.servers.Wait()
+}
+
+// drainTime returns the time the servers wait for the calls in flight when they stop
+func (r *RPCWrapper) drainTime() time.Duration {
+
+	if r.drainTimeout > 0 {
+		return r.drainTimeout
+	}
+
+	return DefaultDrainTimeout
+}
+
 // DestroyRPCClient calls close on the rpc and cleans up the connection
 func (r *RPCWrapper) DestroyRPCClient(contextID string) {
 
 	rpcHdl, _ := r.rpcClientMap.Get(contextID)
-	rpcHdl.(*RPCHdl).Client.Close()
+	rpcHdl.(*RPCHdl).Close()
 	os.Remove(rpcHdl.(*RPCHdl).Channel)
 	r.rpcClientMap.Remove(contextID)
 }
@@ -179,18 +436,36 @@ func (r *RPCWrapper) ContextList() []string {
 	return r.contextList
 }
 
+// payloadNames are the names of the payloads exchanged between the controller and
+// the remote enforcers. They identify the payloads in both transports.
+var payloadNames = []struct {
+	name    string
+	payload interface{}
+}{
+	{"github.com/aporeto-inc/enforcer/utils/rpcwrapper.Init_Request_Payload", InitRequestPayload{}},
+	{"github.com/aporeto-inc/enforcer/utils/rpcwrapper.Init_Response_Payload", InitResponsePayload{}},
+	{"github.com/aporeto-inc/enforcer/utils/rpcwrapper.Init_Supervisor_Payload", InitSupervisorPayload{}},
+	{"github.com/aporeto-inc/enforcer/utils/rpcwrapper.Enforce_Payload", EnforcePayload{}},
+	{"github.com/aporeto-inc/enforcer/utils/rpcwrapper.UnEnforce_Payload", UnEnforcePayload{}},
+	{"github.com/aporeto-inc/enforcer/utils/rpcwrapper.Flush_Stats_Payload", FlushStatsPayload{}},
+	{"github.com/aporeto-inc/enforcer/utils/rpcwrapper.Supervise_Request_Payload", SuperviseRequestPayload{}},
+	{"github.com/aporeto-inc/enforcer/utils/rpcwrapper.UnSupervise_Payload", UnSupervisePayload{}},
+	{"github.com/aporeto-inc/enforcer/utils/rpcwrapper.Enforce_And_Supervise_Payload", EnforceAndSupervisePayload{}},
+	{"github.com/aporeto-inc/enforcer/utils/rpcwrapper.Transaction_Response_Payload", TransactionResponsePayload{}},
+	{"github.com/aporeto-inc/enforcer/utils/rpcwrapper.Stats_Payload", StatsPayload{}},
+	{"github.com/aporeto-inc/enforcer/utils/rpcwrapper.ExcludeIPRequestPayload", ExcludeIPRequestPayload{}},
+	{"github.com/aporeto-inc/enforcer/utils/rpcwrapper.Register_Payload", RegisterPayload{}},
+	{"github.com/aporeto-inc/enforcer/utils/rpcwrapper.Federations_Payload", FederationsPayload{}},
+	{"github.com/aporeto-inc/enforcer/utils/rpcwrapper.Update_Secrets_Payload", UpdateSecretsPayload{}},
+	{"github.com/aporeto-inc/enforcer/utils/rpcwrapper.Health_Check_Payload", HealthCheckPayload{}},
+	{"github.com/aporeto-inc/enforcer/utils/rpcwrapper.Health_Check_Response_Payload", HealthCheckResponsePayload{}},
+	{"github.com/aporeto-inc/enforcer/utils/rpcwrapper.Datapath_Settings_Payload", DatapathSettingsPayload{}},
+}
+
 // RegisterTypes  registers types that are exchanged between the controller and remoteenforcer
 func RegisterTypes() {
 
-	gob.RegisterName("github.com/aporeto-inc/enforcer/utils/rpcwrapper.Init_Request_Payload", *(&InitRequestPayload{}))
-	gob.RegisterName("github.com/aporeto-inc/enforcer/utils/rpcwrapper.Init_Response_Payload", *(&InitResponsePayload{}))
-	gob.RegisterName("github.com/aporeto-inc/enforcer/utils/rpcwrapper.Init_Supervisor_Payload", *(&InitSupervisorPayload{}))
-
-	gob.RegisterName("github.com/aporeto-inc/enforcer/utils/rpcwrapper.Enforce_Payload", *(&EnforcePayload{}))
-	gob.RegisterName("github.com/aporeto-inc/enforcer/utils/rpcwrapper.UnEnforce_Payload", *(&UnEnforcePayload{}))
-
-	gob.RegisterName("github.com/aporeto-inc/enforcer/utils/rpcwrapper.Supervise_Request_Payload", *(&SuperviseRequestPayload{}))
-	gob.RegisterName("github.com/aporeto-inc/enforcer/utils/rpcwrapper.UnSupervise_Payload", *(&UnSupervisePayload{}))
-	gob.RegisterName("github.com/aporeto-inc/enforcer/utils/rpcwrapper.Stats_Payload", *(&StatsPayload{}))
-	gob.RegisterName("github.com/aporeto-inc/enforcer/utils/rpcwrapper.ExcludeIPRequestPayload", *(&ExcludeIPRequestPayload{}))
+	for _, p := range payloadNames {
+		gob.RegisterName(p.name, p.payload)
+	}
 }
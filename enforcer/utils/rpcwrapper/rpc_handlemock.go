@@ -1,6 +1,7 @@
 package rpcwrapper
 
 import (
+	"context"
 	"net/rpc"
 	"sync"
 	"testing"
@@ -18,6 +19,7 @@ type mockedMethods struct {
 	RemoteCallMock       func(contextID string, methodName string, req *Request, resp *Response) error
 	DestroyRPCClientMock func(contextID string)
 	StartServerMock      func(protocol string, path string, handler interface{}) error
+	StopMock             func()
 	ProcessMessageMock   func(req *Request, secret string) bool
 	ContextListMock      func() []string
 }
@@ -36,6 +38,7 @@ type TestRPCClient interface {
 type TestRPCServer interface {
 	RPCServer
 	MockStartServer(t *testing.T, impl func(protocol string, path string, handler interface{}) error)
+	MockStop(t *testing.T, impl func())
 	MockProcessMessage(t *testing.T, impl func(req *Request, secret string) bool)
 }
 
@@ -81,6 +84,10 @@ func (m *testRPC) MockStartServer(t *testing.T, impl func(protocol string, path
 
 }
 
+func (m *testRPC) MockStop(t *testing.T, impl func()) {
+	m.currentMocks(t).StopMock = impl
+}
+
 func (m *testRPC) MockProcessMessage(t *testing.T, impl func(req *Request, secret string) bool) {
 	m.currentMocks(t).ProcessMessageMock = impl
 }
@@ -122,6 +129,20 @@ func (m *testRPC) StartServer(protocol string, path string, handler interface{})
 	}
 	return nil
 }
+
+func (m *testRPC) StartServerContext(ctx context.Context, protocol string, path string, handler interface{}) error {
+	if mock := m.currentMocks(m.currentTest); mock != nil && mock.StartServerMock != nil {
+		return mock.StartServerMock(protocol, path, handler)
+	}
+	return nil
+}
+
+func (m *testRPC) Stop() {
+	if mock := m.currentMocks(m.currentTest); mock != nil && mock.StopMock != nil {
+		mock.StopMock()
+	}
+}
+
 func (m *testRPC) ProcessMessage(req *Request, secret string) bool {
 	if mock := m.currentMocks(m.currentTest); mock != nil && mock.ProcessMessageMock != nil {
 		return mock.ProcessMessageMock(req, secret)
@@ -0,0 +1,95 @@
+package rpcwrapper
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// EnvRuntimeDir is the environment variable of the directory of the sockets of the
+// enforcers. The controller passes its runtime directory to the remote enforcers.
+const EnvRuntimeDir = "TRIREME_RUNTIME_DIR"
+
+// defaultRuntimeDirs are the runtime directories used when none is configured, in
+// order of preference. They are tmpfs on most systems, and /dev/shm remains writable
+// when the root filesystem is mounted read-only.
+var defaultRuntimeDirs = []string{"/var/run", "/run", "/dev/shm"}
+
+var (
+	runtimeDir  string
+	runtimeLock sync.Mutex
+)
+
+// SetRuntimeDir sets the directory of the sockets of the enforcers. It must be called
+// before the enforcers are created. An empty directory restores the default.
+func SetRuntimeDir(dir string) error {
+
+	if dir != "" {
+		if err := CheckRuntimeDir(dir); err != nil {
+			return err
+		}
+	}
+
+	runtimeLock.Lock()
+	runtimeDir = dir
+	runtimeLock.Unlock()
+
+	return nil
+}
+
+// RuntimeDir returns the directory of the sockets of the enforcers. It is the one set
+// with SetRuntimeDir, or the one of the environment, or else the first writable
+// default directory.
+func RuntimeDir() string {
+
+	runtimeLock.Lock()
+	defer runtimeLock.Unlock()
+
+	if runtimeDir != "" {
+		return runtimeDir
+	}
+
+	if dir := os.Getenv(EnvRuntimeDir); dir != "" {
+		runtimeDir = dir
+		return runtimeDir
+	}
+
+	runtimeDir = defaultRuntimeDirs[0]
+	for _, dir := range defaultRuntimeDirs {
+		if CheckRuntimeDir(dir) == nil {
+			runtimeDir = dir
+			break
+		}
+	}
+
+	return runtimeDir
+}
+
+// CheckRuntimeDir verifies that the files of the enforcers can be created in the
+// directory
+func CheckRuntimeDir(dir string) error {
+
+	probe, err := ioutil.TempFile(dir, ".trireme-probe")
+	if err != nil {
+		return fmt.Errorf("Runtime directory %s is not writable: %s", dir, err)
+	}
+
+	probe.Close()
+	os.Remove(probe.Name())
+
+	return nil
+}
+
+// StatsChannelPath returns the path of the socket of the stats channel
+func StatsChannelPath() string {
+
+	return filepath.Join(RuntimeDir(), filepath.Base(StatsChannel))
+}
+
+// EnforcerSocketPath returns the path of the socket of the remote enforcer of a context
+func EnforcerSocketPath(contextID string) string {
+
+	return filepath.Join(RuntimeDir(), contextID+".sock")
+}
@@ -0,0 +1,56 @@
+package rpcwrapper
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRuntimeDir(t *testing.T) {
+	Convey("Given a writable directory and a read-only one", t, func() {
+		dir, err := ioutil.TempDir("", "runtime")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		missing := filepath.Join(dir, "missing")
+
+		defaults := defaultRuntimeDirs
+		defer func() {
+			defaultRuntimeDirs = defaults
+			SetRuntimeDir("")
+		}()
+
+		Convey("The runtime directory should not be set to the read-only one", func() {
+			So(CheckRuntimeDir(missing), ShouldNotBeNil)
+			So(SetRuntimeDir(missing), ShouldNotBeNil)
+		})
+
+		Convey("The sockets should be in the runtime directory that is set", func() {
+			So(SetRuntimeDir(dir), ShouldBeNil)
+			So(RuntimeDir(), ShouldEqual, dir)
+			So(StatsChannelPath(), ShouldEqual, filepath.Join(dir, "statschannel.sock"))
+			So(EnforcerSocketPath("pu1"), ShouldEqual, filepath.Join(dir, "pu1.sock"))
+		})
+
+		Convey("The runtime directory should be the one of the environment", func() {
+			So(SetRuntimeDir(""), ShouldBeNil)
+			os.Setenv(EnvRuntimeDir, dir)
+			defer os.Unsetenv(EnvRuntimeDir)
+
+			So(RuntimeDir(), ShouldEqual, dir)
+		})
+
+		Convey("The read-only default directories should be skipped", func() {
+			So(SetRuntimeDir(""), ShouldBeNil)
+			defaultRuntimeDirs = []string{missing, dir}
+
+			So(RuntimeDir(), ShouldEqual, dir)
+
+			files, _ := ioutil.ReadDir(dir)
+			So(files, ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,276 @@
+package rpcwrapper
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/rpc"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// DefaultDrainTimeout is the time the servers wait for the calls in flight when they
+// are stopped, before they close the connections of their clients
+const DefaultDrainTimeout = 5 * time.Second
+
+// errServerStopping is returned to the net/rpc server for the calls received once the
+// server is stopping. The server closes the connection of the client.
+var errServerStopping = errors.New("RPC server is stopping")
+
+// server is a transport of the servers of the wrapper
+type server interface {
+	// serve accepts the connections of the listener until it is closed
+	serve(listen net.Listener) error
+	// shutdown refuses the new calls, waits for the calls in flight up to the timeout
+	// and closes the connections of the clients. The listener must be closed.
+	shutdown(timeout time.Duration)
+}
+
+// newServer returns a server calling the methods of the handler with the transport
+// of the wrapper
+func (r *RPCWrapper) newServer(handler interface{}) (server, error) {
+
+	if r.transport == GRPCTransport {
+		s, err := newGRPCServer(handler, r.messageLimit)
+		if err != nil {
+			return nil, err
+		}
+
+		return &grpcServer{server: s}, nil
+	}
+
+	return newNetRPCServer(handler, r.messageLimit)
+}
+
+// grpcServer is a server of the gRPC transport
+type grpcServer struct {
+	server *grpc.Server
+}
+
+func (s *grpcServer) serve(listen net.Listener) error {
+
+	return s.server.Serve(listen)
+}
+
+func (s *grpcServer) shutdown(timeout time.Duration) {
+
+	stopped := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(timeout):
+		s.server.Stop()
+	}
+}
+
+// netRPCServer is a server of the net/rpc transport. Unlike the default server of
+// net/rpc, it tracks the connections and the calls in flight of its clients, so that
+// it can be stopped.
+type netRPCServer struct {
+	server   *rpc.Server
+	calls    sync.WaitGroup
+	conns    map[net.Conn]struct{}
+	draining bool
+	// messageLimit is the maximum size of the messages of the clients, if positive
+	messageLimit int
+	sync.Mutex
+}
+
+func newNetRPCServer(handler interface{}, messageLimit int) (*netRPCServer, error) {
+
+	s := rpc.NewServer()
+	if err := s.Register(handler); err != nil {
+		return nil, err
+	}
+
+	return &netRPCServer{
+		server:       s,
+		messageLimit: messageLimit,
+		conns:        map[net.Conn]struct{}{},
+	}, nil
+}
+
+func (s *netRPCServer) serve(listen net.Listener) error {
+
+	mux := http.NewServeMux()
+	mux.Handle(rpc.DefaultRPCPath, s)
+
+	return http.Serve(listen, mux)
+}
+
+// ServeHTTP answers the CONNECT requests of the clients of rpc.DialHTTP and serves
+// the calls of the connection, like the default server of net/rpc
+func (s *netRPCServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	if req.Method != "CONNECT" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		io.WriteString(w, "405 must CONNECT\n")
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "Connection cannot be hijacked", http.StatusInternalServerError)
+		return
+	}
+
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+
+	if !s.track(conn) {
+		conn.Close()
+		return
+	}
+	defer s.untrack(conn)
+
+	if _, err := io.WriteString(conn, "HTTP/1.0 200 Connected to Go RPC\n\n"); err != nil {
+		conn.Close()
+		return
+	}
+
+	buf := bufio.NewWriter(conn)
+	s.server.ServeCodec(&gobServerCodec{
+		server: s,
+		rwc:    conn,
+		dec:    gob.NewDecoder(newGobMessageReader(conn, s.messageLimit)),
+		enc:    gob.NewEncoder(buf),
+		encBuf: buf,
+	})
+}
+
+// track adds a connection to the connections to close on shutdown, unless the server
+// is stopping
+func (s *netRPCServer) track(conn net.Conn) bool {
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s.draining {
+		return false
+	}
+
+	s.conns[conn] = struct{}{}
+
+	return true
+}
+
+func (s *netRPCServer) untrack(conn net.Conn) {
+
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.conns, conn)
+}
+
+// startCall counts a call in flight, unless the server is stopping
+func (s *netRPCServer) startCall() bool {
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s.draining {
+		return false
+	}
+
+	s.calls.Add(1)
+
+	return true
+}
+
+func (s *netRPCServer) shutdown(timeout time.Duration) {
+
+	s.Lock()
+	s.draining = true
+	s.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		s.calls.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-time.After(timeout):
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// gobServerCodec is the gob codec of net/rpc, counting the calls in flight of the server
+type gobServerCodec struct {
+	server *netRPCServer
+	rwc    io.ReadWriteCloser
+	dec    *gob.Decoder
+	enc    *gob.Encoder
+	encBuf *bufio.Writer
+	closed bool
+}
+
+func (c *gobServerCodec) ReadRequestHeader(r *rpc.Request) error {
+
+	if err := c.dec.Decode(r); err != nil {
+		return err
+	}
+
+	// The server answers every request once its header is read
+	if !c.server.startCall() {
+		return errServerStopping
+	}
+
+	return nil
+}
+
+func (c *gobServerCodec) ReadRequestBody(body interface{}) error {
+
+	return c.dec.Decode(body)
+}
+
+func (c *gobServerCodec) WriteResponse(r *rpc.Response, body interface{}) (err error) {
+
+	defer c.server.calls.Done()
+
+	if err = c.enc.Encode(r); err != nil {
+		if c.encBuf.Flush() == nil {
+			c.Close()
+		}
+		return err
+	}
+
+	if err = c.enc.Encode(body); err != nil {
+		if c.encBuf.Flush() == nil {
+			c.Close()
+		}
+		return err
+	}
+
+	return c.encBuf.Flush()
+}
+
+func (c *gobServerCodec) Close() error {
+
+	if c.closed {
+		return nil
+	}
+
+	c.closed = true
+
+	return c.rwc.Close()
+}
@@ -0,0 +1,166 @@
+package rpcwrapper
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aporeto-inc/trireme/utils/errortypes"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// SlowTestServer answers its calls once they are released. net/rpc only registers
+// the exported types.
+type SlowTestServer struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *SlowTestServer) Slow(req Request, resp *Response) error {
+	s.started <- struct{}{}
+	<-s.release
+	resp.Status = "done"
+	return nil
+}
+
+// FailingTestServer fails its calls with an error of a category
+type FailingTestServer struct{}
+
+func (s *FailingTestServer) Fail(req Request, resp *Response) error {
+	resp.Status = "failed"
+	return ServerError(errortypes.Errorf(errortypes.ErrRuleProgramming, "Cannot configure the rules of pu"))
+}
+
+// startTestServer starts a server of the wrapper on a socket of the directory and
+// returns the channel of its result
+func startTestServer(ctx context.Context, server *RPCWrapper, socket string, handler interface{}) chan error {
+
+	result := make(chan error, 1)
+	go func() {
+		result <- server.StartServerContext(ctx, "unix", socket, handler)
+	}()
+
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(socket); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return result
+}
+
+func TestStopServer(t *testing.T) {
+
+	Convey("Given a server with a call in flight", t, func() {
+
+		dir, err := ioutil.TempDir("", "rpcwrapper")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		socket := filepath.Join(dir, "server.sock")
+		handler := &SlowTestServer{started: make(chan struct{}, 1), release: make(chan struct{})}
+		server := NewRPCWrapper(WithDrainTimeout(time.Second))
+		result := startTestServer(context.Background(), server, socket, handler)
+
+		client := NewRPCWrapper()
+		So(client.NewRPCClient("pu", socket, "secret"), ShouldBeNil)
+
+		resp := &Response{}
+		called := make(chan error, 1)
+		go func() {
+			called <- client.RemoteCall("pu", "SlowTestServer.Slow", &Request{Payload: UnEnforcePayload{ContextID: "pu"}}, resp)
+		}()
+		<-handler.started
+
+		Convey("Stop should wait for the call and remove the socket", func() {
+			stopped := make(chan struct{})
+			go func() {
+				server.Stop()
+				close(stopped)
+			}()
+
+			select {
+			case <-stopped:
+				t.Error("Stop returned with a call in flight")
+			case <-time.After(100 * time.Millisecond):
+			}
+
+			close(handler.release)
+			<-stopped
+
+			So(<-called, ShouldBeNil)
+			So(resp.Status, ShouldEqual, "done")
+			So(<-result, ShouldBeNil)
+
+			_, err := os.Stat(socket)
+			So(os.IsNotExist(err), ShouldBeTrue)
+
+			Convey("The servers started afterwards should fail", func() {
+				So(server.StartServerContext(context.Background(), "unix", socket, handler), ShouldNotBeNil)
+			})
+		})
+
+		Convey("Stop should give up on the calls exceeding the drain timeout", func() {
+			start := time.Now()
+			server.Stop()
+
+			So(time.Since(start), ShouldBeGreaterThanOrEqualTo, time.Second)
+			So(<-called, ShouldNotBeNil)
+			So(<-result, ShouldBeNil)
+
+			close(handler.release)
+		})
+	})
+
+	Convey("Given a server started with a context", t, func() {
+
+		dir, err := ioutil.TempDir("", "rpcwrapper")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		socket := filepath.Join(dir, "server.sock")
+		ctx, cancel := context.WithCancel(context.Background())
+		result := startTestServer(ctx, NewRPCWrapper(), socket, &SlowTestServer{})
+
+		Convey("The server should stop when the context is done", func() {
+			cancel()
+
+			So(<-result, ShouldBeNil)
+
+			_, err := os.Stat(socket)
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+	})
+}
+
+func TestRemoteCallErrors(t *testing.T) {
+
+	Convey("Given a server failing its calls", t, func() {
+
+		dir, err := ioutil.TempDir("", "rpcwrapper")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		socket := filepath.Join(dir, "server.sock")
+		startTestServer(ctx, NewRPCWrapper(), socket, &FailingTestServer{})
+
+		client := NewRPCWrapper()
+		So(client.NewRPCClient("pu", socket, "secret"), ShouldBeNil)
+
+		Convey("The error of a call should have the category of the error of the server", func() {
+			resp := &Response{}
+			err := client.RemoteCall("pu", "FailingTestServer.Fail", &Request{Payload: UnEnforcePayload{ContextID: "pu"}}, resp)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "Cannot configure the rules of pu")
+			So(errortypes.Is(err, errortypes.ErrRuleProgramming), ShouldBeTrue)
+			So(resp.Status, ShouldEqual, "")
+		})
+	})
+}
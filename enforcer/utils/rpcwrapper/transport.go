@@ -0,0 +1,95 @@
+package rpcwrapper
+
+import (
+	"os"
+	"time"
+
+	"github.com/aporeto-inc/trireme/utils/sockets"
+)
+
+// Transport carries the remote calls between the controller and the remote
+// enforcers. Both ends of a channel must use the same transport.
+type Transport int
+
+const (
+	// NetRPCTransport encodes the calls with gob over net/rpc. It is the default.
+	NetRPCTransport Transport = iota
+	// GRPCTransport encodes the payloads in JSON over gRPC, so that the remote
+	// enforcers do not have to be written in Go, and bounds the calls with deadlines.
+	GRPCTransport
+)
+
+// EnvTransport is the environment variable of the transport of the remote enforcers.
+// The controller passes the transport of its wrapper to the remote enforcers.
+const EnvTransport = "TRIREME_RPC_TRANSPORT"
+
+// String returns the name of the transport in EnvTransport
+func (t Transport) String() string {
+
+	if t == GRPCTransport {
+		return "grpc"
+	}
+
+	return "netrpc"
+}
+
+// TransportFromEnv returns the transport named by EnvTransport, or NetRPCTransport
+func TransportFromEnv() Transport {
+
+	if os.Getenv(EnvTransport) == GRPCTransport.String() {
+		return GRPCTransport
+	}
+
+	return NetRPCTransport
+}
+
+// transportSelector is implemented by the clients that select their transport
+type transportSelector interface {
+	Transport() Transport
+}
+
+// TransportOf returns the transport of a client, or NetRPCTransport if the client
+// does not select it
+func TransportOf(client interface{}) Transport {
+
+	if t, ok := client.(transportSelector); ok {
+		return t.Transport()
+	}
+
+	return NetRPCTransport
+}
+
+// Transport returns the transport of the wrapper
+func (r *RPCWrapper) Transport() Transport {
+
+	return r.transport
+}
+
+// Option configures an RPCWrapper
+type Option func(*RPCWrapper)
+
+// WithTransport selects the transport of the wrapper
+func WithTransport(transport Transport) Option {
+
+	return func(r *RPCWrapper) {
+		r.transport = transport
+	}
+}
+
+// WithSocketOptions sets the permissions and the ownership of the unix sockets of the
+// servers of the wrapper. The default options of the sockets package apply otherwise.
+func WithSocketOptions(options *sockets.Options) Option {
+
+	return func(r *RPCWrapper) {
+		r.sockets = options
+	}
+}
+
+// WithDrainTimeout sets the time the servers of the wrapper wait for the calls in
+// flight when they are stopped. DefaultDrainTimeout applies otherwise.
+func WithDrainTimeout(timeout time.Duration) Option {
+
+	return func(r *RPCWrapper) {
+		r.drainTimeout = timeout
+	}
+}
@@ -0,0 +1,30 @@
+package rpcwrapper
+
+import (
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTransport(t *testing.T) {
+	Convey("Given a wrapper using the gRPC transport", t, func() {
+		r := NewRPCWrapper(WithTransport(GRPCTransport))
+
+		Convey("The transport of the wrapper should be found", func() {
+			So(TransportOf(r), ShouldEqual, GRPCTransport)
+			So(TransportOf(NewTestRPCClient()), ShouldEqual, NetRPCTransport)
+		})
+
+		Convey("The transport passed in the environment should be selected", func() {
+			os.Setenv(EnvTransport, TransportOf(r).String())
+			defer os.Unsetenv(EnvTransport)
+
+			So(TransportFromEnv(), ShouldEqual, GRPCTransport)
+		})
+
+		Convey("The net/rpc transport should be selected without environment", func() {
+			So(TransportFromEnv(), ShouldEqual, NetRPCTransport)
+		})
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/aporeto-inc/trireme/enforcer"
 	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
 	"github.com/aporeto-inc/trireme/policy"
+	"github.com/aporeto-inc/trireme/supervisor"
 )
 
 var gobTypes = []interface{}{
@@ -17,6 +18,9 @@ var gobTypes = []interface{}{
 	UnEnforcePayload{},
 	SuperviseRequestPayload{},
 	UnSupervisePayload{},
+	EnforceAndSupervisePayload{},
+	TransactionResponsePayload{},
+	FlushStatsPayload{},
 }
 
 // CaptureType identifies the type of iptables implementation that should be used
@@ -33,18 +37,41 @@ const (
 type Request struct {
 	HashAuth []byte
 	Payload  interface{}
+	// Metadata carries the trace of the call. It is not covered by the HashAuth.
+	Metadata map[string]string
 }
 
 //exported consts from the package
 const (
-	SUCCESS      = 0
+	SUCCESS = 0
+	// StatsChannel is the path of the stats channel in the default runtime directory.
+	// The path in use is the one of StatsChannelPath.
 	StatsChannel = "/var/run/statschannel.sock"
 )
 
+// Limits of the stats channel. A remote enforcer runs in the network namespace of
+// the workload and must not be able to exhaust the memory of the controller.
+const (
+	// StatsLimitInterval is the interval the stats limits apply to
+	StatsLimitInterval = time.Second
+	// MaxStatsBytes is the number of bytes a remote enforcer can send on the stats
+	// channel per StatsLimitInterval
+	MaxStatsBytes = 4 * 1024 * 1024
+	// MaxStatsMessageBytes is the maximum size of a message on the stats channel
+	MaxStatsMessageBytes = 2 * 1024 * 1024
+	// MaxStatsRecords is the maximum number of flow records of a stats payload
+	MaxStatsRecords = 1000
+	// MaxStatsRecordsPerInterval is the number of flow records the controller accepts
+	// from each remote enforcer per StatsLimitInterval
+	MaxStatsRecordsPerInterval = 20000
+)
+
 //Response is the response for every RPC call. This is used to carry the status of the actual function call
 //made on the remote end
 type Response struct {
 	Status string
+	// Payload is the result of the calls that return one
+	Payload interface{}
 }
 
 //InitRequestPayload Payload for enforcer init request
@@ -57,11 +84,94 @@ type InitRequestPayload struct {
 	CAPEM      []byte
 	PublicPEM  []byte
 	PrivatePEM []byte
+	// ControllerLoss configures the enforcer when the controller is lost
+	ControllerLoss enforcer.ControllerLossConfig
+	// FlowKey are the fields of the aggregation key of the stats, or empty for the
+	// default key
+	FlowKey []collector.FlowKeyField
+	// Federations are the federated deployments trusted by the PKI secrets
+	Federations []*tokens.Federation
+	// StatsBatch configures the batches of the stats
+	StatsBatch enforcer.StatsBatchConfig
+	// FlowVolumes is the interval of the reports of the traffic of the flows, or zero
+	// if the traffic is not reported
+	FlowVolumes time.Duration
+	// Latencies is the interval of the reports of the latency of the handshakes, or
+	// zero if the latency is not reported
+	Latencies time.Duration
+	// RuleStats is the interval of the reports of the matches of the identity rules,
+	// or zero if they are not reported
+	RuleStats time.Duration
+	// Datapath are the settings of the datapath
+	Datapath DatapathSettingsPayload
+}
+
+// DatapathSettingsPayload replaces the settings of the datapath of the remote enforcer
+type DatapathSettingsPayload struct {
+	IntraHostMode     enforcer.IntraHostMode
+	InteropPolicies   []*enforcer.InteropPolicy
+	ExternalEndpoints []*enforcer.ExternalEndpoint
+	// TagBudget is the budget of the transmitted tags, or nil for the default budget
+	TagBudget *tokens.TagBudget
+	// MTLS enables the mutual TLS data-plane mode, if not nil
+	MTLS *MTLSPayload
+}
+
+// FederationsPayload replaces the federated deployments of the remote enforcer
+type FederationsPayload struct {
+	Federations []*tokens.Federation
+}
+
+// UpdateSecretsPayload rotates the secrets of the remote enforcer
+type UpdateSecretsPayload struct {
+	SecretType tokens.SecretsType
+	CAPEM      []byte
+	PublicPEM  []byte
+	PrivatePEM []byte
 }
 
 //InitSupervisorPayload for supervisor init request
 type InitSupervisorPayload struct {
 	CaptureMethod CaptureType
+	// PreExistingFlows is the treatment of the flows established before the PU is supervised
+	PreExistingFlows supervisor.PreExistingFlows
+	// IPv6 enables the rules of the IPv6 addresses
+	IPv6 bool
+	// MTLSRedirect redirects the connections of the mutual TLS data-plane mode, if
+	// not nil
+	MTLSRedirect *MTLSPayload
+}
+
+// MTLSPayload configures the mutual TLS data-plane mode. The remote enforcer uses
+// its own PKI secrets.
+type MTLSPayload struct {
+	Networks   []string
+	ClientPort int
+	ServerPort int
+}
+
+// NewEnforcePayload returns the payload enforcing the policy of a PU
+func NewEnforcePayload(contextID string, puInfo *policy.PUInfo) *EnforcePayload {
+
+	return &EnforcePayload{
+		ContextID:        contextID,
+		ManagementID:     puInfo.Policy.ManagementID,
+		TriremeAction:    puInfo.Policy.TriremeAction,
+		ApplicationACLs:  puInfo.Policy.ApplicationACLs(),
+		NetworkACLs:      puInfo.Policy.NetworkACLs(),
+		PolicyIPs:        puInfo.Policy.IPAddresses(),
+		Annotations:      puInfo.Policy.Annotations(),
+		Identity:         puInfo.Policy.Identity(),
+		ReceiverRules:    puInfo.Policy.ReceiverRules(),
+		TransmitterRules: puInfo.Policy.TransmitterRules(),
+		TriremeNetworks:  puInfo.Policy.TriremeNetworks(),
+		TrustedNetworks:  puInfo.Policy.TrustedNetworks(),
+		DNSPolicy:        puInfo.Policy.DNSPolicy(),
+		MirrorPolicy:     puInfo.Policy.MirrorPolicy(),
+		IssuerRules:      puInfo.Policy.IssuerRules(),
+		ResetRejected:    puInfo.Policy.ResetRejected(),
+		Features:         puInfo.Policy.Features(),
+	}
 }
 
 // EnforcePayload Payload for enforce request
@@ -78,6 +188,12 @@ type EnforcePayload struct {
 	TransmitterRules *policy.TagSelectorList
 	PuPolicy         *policy.PUPolicy
 	TriremeNetworks  []string
+	TrustedNetworks  []string
+	DNSPolicy        *policy.DNSPolicy
+	MirrorPolicy     *policy.MirrorPolicy
+	IssuerRules      []*policy.IssuerRule
+	ResetRejected    bool
+	Features         []string
 }
 
 //SuperviseRequestPayload for Supervise request
@@ -95,6 +211,25 @@ type SuperviseRequestPayload struct {
 	PuPolicy         *policy.PUPolicy
 	ExcludedIPs      []string
 	TriremeNetworks  []string
+	TrustedNetworks  []string
+	DNSPolicy        *policy.DNSPolicy
+	MirrorPolicy     *policy.MirrorPolicy
+	Features         []string
+}
+
+// EnforceAndSupervisePayload is the payload of a policy applied to the enforcer and
+// the supervisor of a remote enforcer as a single transaction
+type EnforceAndSupervisePayload struct {
+	EnforcePayload
+	ExcludedIPs []string
+}
+
+// TransactionResponsePayload is the result of a failed EnforceAndSupervise request
+type TransactionResponsePayload struct {
+	// Component is the component that failed to apply the policy
+	Component string
+	// RolledBack is true if the PU was returned to its previous policy
+	RolledBack bool
 }
 
 //UnEnforcePayload payload for unenforce request
@@ -102,6 +237,25 @@ type UnEnforcePayload struct {
 	ContextID string
 }
 
+// FlushStatsPayload is the payload of a request to send the flows collected by the
+// remote enforcer without waiting for the stats interval
+type FlushStatsPayload struct {
+	ContextID string
+}
+
+// HealthCheckPayload is the payload of a request checking that the remote enforcer
+// of a context serves the requests of the controller
+type HealthCheckPayload struct {
+	ContextID string
+}
+
+// HealthCheckResponsePayload is the payload of the response of a healthy remote
+// enforcer
+type HealthCheckResponsePayload struct {
+	ContextID string
+	Pid       int
+}
+
 //UnSupervisePayload payload for unsupervise request
 type UnSupervisePayload struct {
 	ContextID string
@@ -129,7 +283,47 @@ type UnEnforceResponsePayload struct {
 
 //StatsPayload is the payload carries by the stats reporting form the remote enforcer
 type StatsPayload struct {
-	Flows map[string]*collector.FlowRecord
+	// Records are the flow records of the stats. Flows only carries the records of
+	// the remote enforcers older than the controller.
+	Records []*collector.FlowRecord
+	Flows   map[string]*collector.FlowRecord
+	// ContextID and Pid identify the remote enforcer
+	ContextID string
+	Pid       int
+	// Sequence numbers the stats delivered by the enforcer, from 1
+	Sequence uint64
+	// Watermark is the number of records the enforcer delivered before the stats
+	Watermark uint64
+	// Evicted is the number of records the enforcer evicted from its full flow cache
+	// since the previous stats
+	Evicted uint64
+	// Latencies are the latency records of the handshakes of the stats
+	Latencies []*collector.LatencyRecord
+	// RuleStats are the matches of the identity rules of the stats
+	RuleStats []*collector.RuleStatsRecord
+}
+
+// FlowRecords returns the flow records of the stats, whichever field carries them
+func (p *StatsPayload) FlowRecords() []*collector.FlowRecord {
+
+	if len(p.Flows) == 0 {
+		return p.Records
+	}
+
+	records := make([]*collector.FlowRecord, 0, len(p.Records)+len(p.Flows))
+	records = append(records, p.Records...)
+	for _, record := range p.Flows {
+		records = append(records, record)
+	}
+
+	return records
+}
+
+// RegisterPayload is sent by the remote enforcer over the stats channel to register
+// with the controller when it connects
+type RegisterPayload struct {
+	ContextID string
+	Pid       int
 }
 
 //ExcludeIPRequestPayload carries the list of excluded ips
@@ -0,0 +1,78 @@
+package tokens
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"strings"
+)
+
+// AuthoritySecrets are the secrets that report the certificate authorities that
+// issued the certificates of the peers
+type AuthoritySecrets interface {
+
+	// PeerAuthorities returns the fingerprints of the certificate authorities of the
+	// chains verifying the certificate of a peer, or nil if it cannot be verified.
+	PeerAuthorities(cert interface{}) []string
+}
+
+// Fingerprint returns the fingerprint of a certificate: the SHA-256 of its DER
+// encoding, in lower case hexadecimal.
+func Fingerprint(cert *x509.Certificate) string {
+
+	sum := sha256.Sum256(cert.Raw)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// NormalizeFingerprint returns a fingerprint in the form of Fingerprint. The colons
+// separating the bytes and the case of the digits are ignored.
+func NormalizeFingerprint(fingerprint string) string {
+
+	return strings.ToLower(strings.Replace(fingerprint, ":", "", -1))
+}
+
+// PeerAuthorities implements the AuthoritySecrets interface. The authorities of
+// the chains of the local and of the federated certificate authorities are
+// returned.
+func (p *PKISecrets) PeerAuthorities(cert interface{}) []string {
+
+	c, ok := cert.(*x509.Certificate)
+	if !ok || c == nil {
+		return nil
+	}
+
+	authorities := chainAuthorities(c, p.pool())
+
+	p.federationLock.RLock()
+	defer p.federationLock.RUnlock()
+
+	for _, f := range p.federations {
+		authorities = append(authorities, chainAuthorities(c, f.pool)...)
+	}
+
+	return authorities
+}
+
+// chainAuthorities returns the fingerprints of the certificate authorities of the
+// chains verifying the certificate with the roots
+func chainAuthorities(cert *x509.Certificate, roots *x509.CertPool) []string {
+
+	if roots == nil {
+		return nil
+	}
+
+	chains, err := cert.Verify(x509.VerifyOptions{Roots: roots})
+	if err != nil {
+		return nil
+	}
+
+	authorities := []string{}
+	for _, chain := range chains {
+		for _, authority := range chain[1:] {
+			authorities = append(authorities, Fingerprint(authority))
+		}
+	}
+
+	return authorities
+}
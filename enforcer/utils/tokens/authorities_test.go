@@ -0,0 +1,59 @@
+package tokens
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// certificateOf returns the certificate of PKI secrets
+func certificateOf(secrets *PKISecrets) *x509.Certificate {
+
+	block, _ := pem.Decode(secrets.TransmittedKey())
+	cert, _ := x509.ParseCertificate(block.Bytes)
+
+	return cert
+}
+
+func TestPeerAuthorities(t *testing.T) {
+
+	Convey("Given two certificate authorities with the same name, one local and one federated", t, func() {
+
+		prod := newTestAuthority("prod-ca")
+		impostor := newTestAuthority("prod-ca")
+
+		secrets := prod.secrets("local")
+		So(secrets, ShouldNotBeNil)
+		So(secrets.Federate(&Federation{Name: "partner", AuthorityPEM: impostor.pem}), ShouldBeNil)
+
+		prodCert := certificateOf(prod.secrets("payments"))
+		impostorCert := certificateOf(impostor.secrets("payments"))
+		So(prodCert.Issuer.CommonName, ShouldEqual, impostorCert.Issuer.CommonName)
+
+		Convey("Then the authorities of the peers should be told apart by their fingerprints", func() {
+			So(secrets.PeerAuthorities(prodCert), ShouldResemble, []string{Fingerprint(prod.cert)})
+			So(secrets.PeerAuthorities(impostorCert), ShouldResemble, []string{Fingerprint(impostor.cert)})
+			So(Fingerprint(prod.cert), ShouldNotEqual, Fingerprint(impostor.cert))
+		})
+
+		Convey("Then a certificate of an untrusted authority should have no authority", func() {
+			untrusted := certificateOf(newTestAuthority("prod-ca").secrets("payments"))
+			So(secrets.PeerAuthorities(untrusted), ShouldBeEmpty)
+			So(secrets.PeerAuthorities(nil), ShouldBeNil)
+		})
+
+		Convey("Then the fingerprints with colons should be normalized", func() {
+			fingerprint := Fingerprint(prod.cert)
+
+			pairs := []string{}
+			for i := 0; i < len(fingerprint); i += 2 {
+				pairs = append(pairs, strings.ToUpper(fingerprint[i:i+2]))
+			}
+
+			So(NormalizeFingerprint(strings.Join(pairs, ":")), ShouldEqual, fingerprint)
+		})
+	})
+}
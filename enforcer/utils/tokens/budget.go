@@ -0,0 +1,133 @@
+package tokens
+
+import (
+	"sort"
+
+	"github.com/aporeto-inc/trireme/policy"
+)
+
+const (
+	// DefaultTokenBudget is the default maximum size of a token. The token is carried
+	// as the payload of the SYN packet and must fit in a single segment.
+	DefaultTokenBudget = 1400
+
+	// nonceSize is the size of the local context carried in every token
+	nonceSize = 32
+)
+
+// TagBudget defines which identity tags are transmitted in the tokens and how they
+// are prioritized when the tokens exceed their maximum size
+type TagBudget struct {
+	// MaxSize is the maximum size of a token in bytes
+	MaxSize int
+	// Priority lists the keys of the tags to keep first when tags must be dropped.
+	// Tags that are not listed are kept in alphabetical order of their keys.
+	Priority []string
+	// Allowlist restricts the tags transmitted to the given keys. All tags are
+	// transmitted if it is empty.
+	Allowlist []string
+}
+
+// NewTagBudget returns a budget of the default size without priorities or allowlist
+func NewTagBudget() *TagBudget {
+
+	return &TagBudget{
+		MaxSize: DefaultTokenBudget,
+	}
+}
+
+// EstimateSize returns the size of a SYN token carrying the given tags
+func EstimateSize(engine TokenEngine, tags *policy.TagsMap) int {
+
+	return len(engine.CreateAndSign(false, &ConnectionClaims{
+		T:   tags,
+		LCL: make([]byte, nonceSize),
+	}))
+}
+
+// Select returns the tags that are transmitted in the tokens and the keys of the tags
+// that were dropped to fit the budget. The mandatory tags are always transmitted.
+func (b *TagBudget) Select(engine TokenEngine, tags *policy.TagsMap, mandatory ...string) (*policy.TagsMap, []string) {
+
+	dropped := []string{}
+	selected := policy.NewTagsMap(nil)
+
+	for _, k := range mandatory {
+		if v, ok := tags.Get(k); ok {
+			selected.Add(k, v)
+		}
+	}
+
+	candidates := b.order(tags, selected)
+
+	if len(b.Allowlist) > 0 {
+		allowed := map[string]bool{}
+		for _, k := range b.Allowlist {
+			allowed[k] = true
+		}
+
+		filtered := []string{}
+		for _, k := range candidates {
+			if allowed[k] {
+				filtered = append(filtered, k)
+			} else {
+				dropped = append(dropped, k)
+			}
+		}
+		candidates = filtered
+	}
+
+	for _, k := range candidates {
+		v, _ := tags.Get(k)
+		selected.Add(k, v)
+	}
+
+	if b.MaxSize <= 0 || EstimateSize(engine, selected) <= b.MaxSize {
+		return selected, dropped
+	}
+
+	// Add the candidates one by one in order of priority and skip the ones
+	// that do not fit. A smaller tag of lower priority may still fit.
+	for _, k := range candidates {
+		delete(selected.Tags, k)
+	}
+
+	for _, k := range candidates {
+		v, _ := tags.Get(k)
+		selected.Add(k, v)
+		if EstimateSize(engine, selected) > b.MaxSize {
+			delete(selected.Tags, k)
+			dropped = append(dropped, k)
+		}
+	}
+
+	return selected, dropped
+}
+
+// order returns the keys of the tags that are not already selected in order of priority
+func (b *TagBudget) order(tags *policy.TagsMap, selected *policy.TagsMap) []string {
+
+	keys := []string{}
+	seen := map[string]bool{}
+
+	for k := range selected.Tags {
+		seen[k] = true
+	}
+
+	for _, k := range b.Priority {
+		if _, ok := tags.Get(k); ok && !seen[k] {
+			keys = append(keys, k)
+			seen[k] = true
+		}
+	}
+
+	others := []string{}
+	for k := range tags.Tags {
+		if !seen[k] {
+			others = append(others, k)
+		}
+	}
+	sort.Strings(others)
+
+	return append(keys, others...)
+}
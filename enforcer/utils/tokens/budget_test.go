@@ -0,0 +1,82 @@
+package tokens
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aporeto-inc/trireme/policy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTagBudget(t *testing.T) {
+
+	Convey("Given I create a token engine and an identity", t, func() {
+
+		engine, err := NewJWT(validity, "TRIREME", NewPSKSecrets(psk))
+		So(err, ShouldBeNil)
+
+		identity := policy.NewTagsMap(map[string]string{
+			"id":    "pu1",
+			"app":   "web",
+			"large": strings.Repeat("x", 600),
+			"zone":  "public",
+		})
+
+		Convey("When I estimate the size of a token", func() {
+
+			size := EstimateSize(engine, identity)
+
+			Convey("Then it should match the size of a signed token", func() {
+				token := engine.CreateAndSign(false, &ConnectionClaims{T: identity, LCL: []byte(lcl)})
+				So(size, ShouldEqual, len(token))
+			})
+		})
+
+		Convey("When the identity fits the budget", func() {
+
+			selected, dropped := NewTagBudget().Select(engine, identity, "id")
+
+			Convey("Then all tags should be transmitted", func() {
+				So(len(dropped), ShouldEqual, 0)
+				So(selected.Tags, ShouldResemble, identity.Tags)
+			})
+		})
+
+		Convey("When I restrict the tags with an allowlist", func() {
+
+			budget := &TagBudget{MaxSize: DefaultTokenBudget, Allowlist: []string{"app"}}
+			selected, dropped := budget.Select(engine, identity, "id")
+
+			Convey("Then only the allowed and mandatory tags should be transmitted", func() {
+				So(selected.Tags, ShouldResemble, map[string]string{"id": "pu1", "app": "web"})
+				So(dropped, ShouldResemble, []string{"large", "zone"})
+			})
+		})
+
+		Convey("When the identity exceeds the budget", func() {
+
+			budget := &TagBudget{
+				MaxSize:  EstimateSize(engine, identity) - 100,
+				Priority: []string{"zone"},
+			}
+			selected, dropped := budget.Select(engine, identity, "id")
+
+			Convey("Then the tags that do not fit should be dropped in reverse priority", func() {
+				So(dropped, ShouldResemble, []string{"large"})
+				So(selected.Tags, ShouldResemble, map[string]string{"id": "pu1", "app": "web", "zone": "public"})
+				So(EstimateSize(engine, selected), ShouldBeLessThanOrEqualTo, budget.MaxSize)
+			})
+		})
+
+		Convey("When even the mandatory tags exceed the budget", func() {
+
+			budget := &TagBudget{MaxSize: 10}
+			selected, dropped := budget.Select(engine, identity, "id")
+
+			Convey("Then only the mandatory tags should be transmitted", func() {
+				So(selected.Tags, ShouldResemble, map[string]string{"id": "pu1"})
+				So(dropped, ShouldResemble, []string{"app", "large", "zone"})
+			})
+		})
+	})
+}
@@ -0,0 +1,119 @@
+package tokens
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// TokenDiagnosis describes the content of a token and the outcome of its verification
+// against the configured secrets
+type TokenDiagnosis struct {
+	// Algorithm is the signing algorithm of the token
+	Algorithm string
+	// Issuer is the server that issued the token
+	Issuer string
+	// ExpiresAt is the expiration time of the token
+	ExpiresAt time.Time
+	// Expired is true if the token is expired
+	Expired bool
+	// Claims are the claims of the token. They are decoded even if the token cannot be verified
+	Claims *ConnectionClaims
+	// Certificate is the certificate attached to the token, if any
+	Certificate *x509.Certificate
+	// CertificateError is the reason why the attached certificate is not trusted
+	CertificateError error
+	// Verified is true if the token was verified with the configured secrets
+	Verified bool
+	// VerificationError is the reason why the token cannot be verified
+	VerificationError error
+}
+
+// Diagnose decodes a token and verifies it against the configured secrets. Unlike
+// Decode it does not stop at the first failure and returns everything that could
+// be learned from the token. An error is returned only if the token is malformed.
+func (c *JWTConfig) Diagnose(isAck bool, data []byte) (*TokenDiagnosis, error) {
+
+	diagnosis := &TokenDiagnosis{}
+
+	token := data
+	var ackCert interface{}
+
+	if !isAck {
+		index := bytes.IndexByte(data, []byte("%")[0])
+		if index < 0 {
+			return nil, fmt.Errorf("Token separator not found")
+		}
+
+		token = data[:index]
+
+		if key := data[index+1:]; len(key) > 0 {
+			if block, _ := pem.Decode(key); block != nil {
+				diagnosis.Certificate, _ = x509.ParseCertificate(block.Bytes)
+			}
+			ackCert, diagnosis.CertificateError = c.secrets.VerifyPublicKey(key)
+		}
+	}
+
+	segments := strings.Split(string(token), ".")
+	if len(segments) != 3 {
+		return nil, fmt.Errorf("Malformed token: expected 3 segments, got %d", len(segments))
+	}
+
+	header := map[string]interface{}{}
+	if err := decodeSegment(segments[0], &header); err != nil {
+		return nil, fmt.Errorf("Malformed token header: %s", err)
+	}
+
+	claims := &JWTClaims{ConnectionClaims: &ConnectionClaims{}}
+	if err := decodeSegment(segments[1], claims); err != nil {
+		return nil, fmt.Errorf("Malformed token claims: %s", err)
+	}
+
+	if alg, ok := header["alg"].(string); ok {
+		diagnosis.Algorithm = alg
+	}
+	diagnosis.Issuer = strings.Trim(claims.Issuer, " ")
+	diagnosis.Claims = claims.ConnectionClaims
+
+	if claims.ExpiresAt != 0 {
+		diagnosis.ExpiresAt = time.Unix(claims.ExpiresAt, 0)
+		diagnosis.Expired = c.clock.Now().After(diagnosis.ExpiresAt)
+	}
+
+	if diagnosis.Algorithm != c.signMethod.Alg() {
+		diagnosis.VerificationError = fmt.Errorf("Token signed with %s but secrets expect %s", diagnosis.Algorithm, c.signMethod.Alg())
+		return diagnosis, nil
+	}
+
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	jwttoken, err := parser.ParseWithClaims(string(token), &JWTClaims{}, func(t *jwt.Token) (interface{}, error) {
+		return c.secrets.DecodingKey(diagnosis.Issuer, ackCert, nil)
+	})
+
+	if err != nil {
+		diagnosis.VerificationError = err
+		return diagnosis, nil
+	}
+
+	diagnosis.Verified = jwttoken.Valid
+
+	return diagnosis, nil
+}
+
+// decodeSegment decodes a base64 encoded JSON segment of a token
+func decodeSegment(segment string, v interface{}) error {
+
+	data, err := jwt.DecodeSegment(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
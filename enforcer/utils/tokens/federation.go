@@ -0,0 +1,118 @@
+package tokens
+
+import (
+	"crypto/x509"
+	"fmt"
+
+	"github.com/aporeto-inc/trireme/crypto"
+	"github.com/aporeto-inc/trireme/policy"
+)
+
+// Federation is another deployment whose certificate authorities are trusted. The
+// peers of a federated deployment are authenticated with its certificate authorities,
+// but only the tags the federation honors are used by the policies. The peers must
+// transmit their certificates in their tokens.
+type Federation struct {
+	// Name identifies the federated deployment
+	Name string
+	// AuthorityPEM is the bundle of the certificate authorities of the deployment
+	AuthorityPEM []byte
+	// Tags are the keys of the tags honored from the peers of the deployment. The
+	// other tags of their tokens are ignored.
+	Tags []string
+}
+
+// Clone returns a copy of the federation
+func (f *Federation) Clone() *Federation {
+
+	return &Federation{
+		Name:         f.Name,
+		AuthorityPEM: append([]byte{}, f.AuthorityPEM...),
+		Tags:         append([]string{}, f.Tags...),
+	}
+}
+
+// HonoredTags returns the tags of a peer of the federation that are honored. The
+// reserved keys, which identify the peer rather than grant it access, are kept.
+func (f *Federation) HonoredTags(tags *policy.TagsMap, reserved ...string) *policy.TagsMap {
+
+	honored := policy.NewTagsMap(nil)
+	if tags == nil {
+		return honored
+	}
+
+	for _, keys := range [][]string{f.Tags, reserved} {
+		for _, k := range keys {
+			if v, ok := tags.Get(k); ok {
+				honored.Add(k, v)
+			}
+		}
+	}
+
+	return honored
+}
+
+// FederatedSecrets are the secrets that trust the certificate authorities of other
+// deployments
+type FederatedSecrets interface {
+
+	// Federate trusts the certificate authorities of a deployment, or replaces the
+	// federation of the same name.
+	Federate(f *Federation) error
+
+	// Unfederate stops trusting the certificate authorities of a deployment.
+	Unfederate(name string) error
+
+	// Federations returns the federated deployments.
+	Federations() []*Federation
+
+	// PeerFederation returns the federation that issued the certificate of a peer, or
+	// false if the certificate was issued by the local certificate authorities.
+	PeerFederation(cert interface{}) (*Federation, bool)
+}
+
+// federation is a federated deployment with its parsed certificate authorities
+type federation struct {
+	config *Federation
+	pool   *x509.CertPool
+}
+
+// newFederation validates a federation and parses its certificate authorities
+func newFederation(f *Federation) (*federation, error) {
+
+	if f.Name == "" {
+		return nil, fmt.Errorf("Federation must have a name")
+	}
+
+	pool := crypto.LoadRootCertificates(f.AuthorityPEM)
+	if pool == nil {
+		return nil, fmt.Errorf("Invalid certificate authorities for federation %s", f.Name)
+	}
+
+	return &federation{
+		config: f.Clone(),
+		pool:   pool,
+	}, nil
+}
+
+// SetFederations replaces the federated deployments of the secrets
+func SetFederations(secrets FederatedSecrets, federations []*Federation) error {
+
+	names := map[string]bool{}
+	for _, f := range federations {
+		if err := secrets.Federate(f); err != nil {
+			return err
+		}
+		names[f.Name] = true
+	}
+
+	for _, f := range secrets.Federations() {
+		if !names[f.Name] {
+			if err := secrets.Unfederate(f.Name); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,177 @@
+package tokens
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/aporeto-inc/trireme/policy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// testAuthority is a certificate authority issuing the certificates of the tests
+type testAuthority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+// newTestAuthority returns a self-signed certificate authority
+func newTestAuthority(name string) *testAuthority {
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, _ := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	cert, _ := x509.ParseCertificate(der)
+
+	return &testAuthority{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+// secrets returns the PKI secrets of a certificate issued by the authority
+func (a *testAuthority) secrets(name string) *PKISecrets {
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	der, _ := x509.CreateCertificate(rand.Reader, template, a.cert, &key.PublicKey, a.key)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	return NewPKISecrets(keyPEM, certPEM, a.pem, nil)
+}
+
+func TestFederation(t *testing.T) {
+
+	Convey("Given the secrets of two deployments with different certificate authorities", t, func() {
+
+		local := newTestAuthority("local-ca")
+		remote := newTestAuthority("remote-ca")
+
+		secrets := local.secrets("local")
+		peerSecrets := remote.secrets("peer")
+		So(secrets, ShouldNotBeNil)
+		So(peerSecrets, ShouldNotBeNil)
+
+		engine, err := NewJWT(validity, "local", secrets)
+		So(err, ShouldBeNil)
+		peerEngine, err := NewJWT(validity, "peer", peerSecrets)
+		So(err, ShouldBeNil)
+
+		identity := policy.NewTagsMap(map[string]string{
+			"AporetoContextID": "peer-context",
+			"app":              "web",
+			"role":             "admin",
+		})
+		token := peerEngine.CreateAndSign(false, &ConnectionClaims{T: identity, LCL: []byte(lcl)})
+
+		Convey("When the deployments are not federated", func() {
+
+			claims, _ := engine.Decode(false, token, nil)
+
+			Convey("Then the tokens of the peer should be rejected", func() {
+				So(claims, ShouldBeNil)
+			})
+		})
+
+		Convey("When I federate the deployment of the peer", func() {
+
+			err := secrets.Federate(&Federation{
+				Name:         "remote",
+				AuthorityPEM: remote.pem,
+				Tags:         []string{"app"},
+			})
+			So(err, ShouldBeNil)
+
+			claims, cert := engine.Decode(false, token, nil)
+
+			Convey("Then the tokens of the peer should be accepted", func() {
+				So(claims, ShouldNotBeNil)
+			})
+
+			Convey("Then the certificate of the peer should belong to the federation", func() {
+				f, ok := secrets.PeerFederation(cert)
+				So(ok, ShouldBeTrue)
+				So(f.Name, ShouldEqual, "remote")
+
+				honored := f.HonoredTags(claims.T, "AporetoContextID")
+				So(honored.Tags, ShouldResemble, map[string]string{
+					"AporetoContextID": "peer-context",
+					"app":              "web",
+				})
+			})
+
+			Convey("Then the certificates of the local deployment should not belong to the federation", func() {
+				localToken := engine.CreateAndSign(false, &ConnectionClaims{T: identity, LCL: []byte(lcl)})
+				_, localCert := engine.Decode(false, localToken, nil)
+
+				_, ok := secrets.PeerFederation(localCert)
+				So(ok, ShouldBeFalse)
+			})
+
+			Convey("When I unfederate it", func() {
+
+				So(secrets.Unfederate("remote"), ShouldBeNil)
+				claims, _ := engine.Decode(false, token, nil)
+
+				Convey("Then the tokens of the peer should be rejected again", func() {
+					So(claims, ShouldBeNil)
+					So(secrets.Federations(), ShouldBeEmpty)
+				})
+			})
+
+			Convey("When I replace the federations", func() {
+
+				other := newTestAuthority("other-ca")
+				err := SetFederations(secrets, []*Federation{{Name: "other", AuthorityPEM: other.pem}})
+
+				Convey("Then only the new federation should be trusted", func() {
+					So(err, ShouldBeNil)
+					So(len(secrets.Federations()), ShouldEqual, 1)
+					So(secrets.Federations()[0].Name, ShouldEqual, "other")
+				})
+			})
+		})
+
+		Convey("When I federate a deployment without a name or a valid authority", func() {
+
+			errName := secrets.Federate(&Federation{AuthorityPEM: remote.pem})
+			errPEM := secrets.Federate(&Federation{Name: "remote", AuthorityPEM: []byte("invalid")})
+
+			Convey("Then I should get errors", func() {
+				So(errName, ShouldNotBeNil)
+				So(errPEM, ShouldNotBeNil)
+				So(secrets.Unfederate("remote"), ShouldNotBeNil)
+			})
+		})
+	})
+}
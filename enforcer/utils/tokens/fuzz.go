@@ -0,0 +1,51 @@
+// +build gofuzz
+
+package tokens
+
+import (
+	"crypto/x509"
+	"time"
+)
+
+// Fuzz is the entry point of go-fuzz for the token decoders. The tokens are read
+// from the payload of the SYN, SYN/ACK and ACK packets before the peer is
+// authenticated, so the decoders must never panic whatever the bytes. Build with:
+//
+//	go-fuzz-build github.com/aporeto-inc/trireme/enforcer/utils/tokens
+//	go-fuzz -bin=tokens-fuzz.zip -workdir=enforcer/utils/tokens/testdata/fuzz
+//
+// The corpus is checked with go test -tags gofuzz.
+//
+// The tokens are decoded as the compact tokens of pre-shared key secrets and as the
+// tokens of both formats of PKI secrets without any trusted authority, so that the
+// attached certificates are parsed but never trusted. It returns 1 for the well
+// formed tokens, so that the fuzzer favors them, and 0 otherwise.
+func Fuzz(data []byte) int {
+
+	psk, err := NewJWT(time.Minute, "fuzz", NewPSKSecrets([]byte("fuzz")))
+	if err != nil {
+		panic(err)
+	}
+
+	pki := &PKISecrets{certPool: x509.NewCertPool(), federations: map[string]*federation{}}
+	standard, err := NewStandardJWT(time.Minute, "fuzz", pki)
+	if err != nil {
+		panic(err)
+	}
+
+	wellFormed := 0
+
+	for _, isAck := range []bool{false, true} {
+		psk.Decode(isAck, data, nil)
+		standard.Decode(isAck, data, nil)
+
+		if _, err := psk.Diagnose(isAck, data); err == nil {
+			wellFormed = 1
+		}
+		if _, err := standard.compact.Diagnose(isAck, data); err == nil {
+			wellFormed = 1
+		}
+	}
+
+	return wellFormed
+}
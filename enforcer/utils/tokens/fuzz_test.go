@@ -0,0 +1,53 @@
+// +build gofuzz
+
+package tokens
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFuzz(t *testing.T) {
+
+	Convey("Given the corpus of the fuzzer", t, func() {
+
+		files, err := filepath.Glob(filepath.Join("testdata", "fuzz", "corpus", "*"))
+		So(err, ShouldBeNil)
+		So(files, ShouldNotBeEmpty)
+
+		Convey("The tokens of the corpus should be decoded without panicking", func() {
+			for _, file := range files {
+				data, err := ioutil.ReadFile(file)
+				So(err, ShouldBeNil)
+				So(func() { Fuzz(data) }, ShouldNotPanic)
+			}
+		})
+
+		Convey("The truncated tokens should be decoded without panicking", func() {
+			for _, file := range files {
+				data, err := ioutil.ReadFile(file)
+				So(err, ShouldBeNil)
+				for i := 0; i < len(data); i += 7 {
+					So(func() { Fuzz(data[:i]) }, ShouldNotPanic)
+				}
+			}
+		})
+	})
+
+	Convey("Given PKI secrets and a trusted certificate without an ECDSA key", t, func() {
+
+		secrets := &PKISecrets{certPool: x509.NewCertPool()}
+		cert := &x509.Certificate{PublicKey: &rsa.PublicKey{}}
+
+		Convey("The certificate should not be a decoding key", func() {
+			key, err := secrets.DecodingKey("server", cert, nil)
+			So(err, ShouldNotBeNil)
+			So(key, ShouldBeNil)
+		})
+	})
+}
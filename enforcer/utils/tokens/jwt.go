@@ -7,6 +7,7 @@ import (
 	"time"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/aporeto-inc/trireme/utils/clock"
 	"github.com/dgrijalva/jwt-go"
 )
 
@@ -27,6 +28,8 @@ type JWTConfig struct {
 	signMethod jwt.SigningMethod
 	// secrets is the secrets used for signing and verifying the JWT
 	secrets Secrets
+	// clock is the source of time of the expiry of the tokens
+	clock clock.Clock
 }
 
 // NewJWT creates a new JWT token processor
@@ -62,9 +65,16 @@ func NewJWT(validity time.Duration, issuer string, secrets Secrets) (*JWTConfig,
 		Issuer:         issuer,
 		signMethod:     signMethod,
 		secrets:        secrets,
+		clock:          clock.New(),
 	}, nil
 }
 
+// SetClock sets the source of time of the expiry of the tokens
+func (c *JWTConfig) SetClock(clk clock.Clock) {
+
+	c.clock = clk
+}
+
 // CreateAndSign  creates a new token, attaches an ephemeral key pair and signs with the issuer
 // key. It returns back the token and the private key.
 func (c *JWTConfig) CreateAndSign(isAck bool, claims *ConnectionClaims) []byte {
@@ -73,7 +83,7 @@ func (c *JWTConfig) CreateAndSign(isAck bool, claims *ConnectionClaims) []byte {
 	allclaims := &JWTClaims{
 		claims,
 		jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(c.ValidityPeriod).Unix(),
+			ExpiresAt: c.clock.Now().Add(c.ValidityPeriod).Unix(),
 			Issuer:    c.Issuer,
 		},
 	}
@@ -140,8 +150,10 @@ func (c *JWTConfig) Decode(isAck bool, data []byte, previousCert interface{}) (*
 
 	}
 
-	// Parse the JWT token with the public key recovered
-	jwttoken, err := jwt.ParseWithClaims(string(token), jwtClaims, func(token *jwt.Token) (interface{}, error) {
+	// Parse the JWT token with the public key recovered. The expiry is verified
+	// with the clock of the engine.
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	jwttoken, err := parser.ParseWithClaims(string(token), jwtClaims, func(token *jwt.Token) (interface{}, error) {
 		server := token.Claims.(*JWTClaims).Issuer
 		server = strings.Trim(server, " ")
 		return c.secrets.DecodingKey(server, ackCert, previousCert)
@@ -157,5 +169,13 @@ func (c *JWTConfig) Decode(isAck bool, data []byte, previousCert interface{}) (*
 		return nil, nil
 	}
 
+	if jwtClaims.ExpiresAt != 0 && c.clock.Now().Unix() > jwtClaims.ExpiresAt {
+		log.WithFields(log.Fields{
+			"package": "tokens",
+		}).Error("Token is expired")
+
+		return nil, nil
+	}
+
 	return jwtClaims.ConnectionClaims, ackCert
 }
@@ -7,6 +7,7 @@ import (
 
 	"github.com/aporeto-inc/trireme/crypto"
 	"github.com/aporeto-inc/trireme/policy"
+	"github.com/aporeto-inc/trireme/utils/clock"
 	jwt "github.com/dgrijalva/jwt-go"
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -143,6 +144,113 @@ func TestCreateAndVerifyPSK(t *testing.T) {
 	})
 }
 
+func TestExpiryWithClock(t *testing.T) {
+	Convey("Given a JWT valid engine with a fake clock", t, func() {
+		jwtConfig, _ := NewJWT(validity, "TRIREME", NewPSKSecrets(psk))
+		clk := clock.NewFake(time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC))
+		jwtConfig.SetClock(clk)
+
+		token := jwtConfig.CreateAndSign(false, &defaultClaims)
+
+		Convey("Then the token should be valid during its validity period", func() {
+			clk.Advance(validity)
+			recoveredClaims, _ := jwtConfig.Decode(false, token, nil)
+
+			So(recoveredClaims, ShouldNotBeNil)
+		})
+
+		Convey("Then the token should be rejected after its validity period", func() {
+			clk.Advance(validity + time.Second)
+			recoveredClaims, _ := jwtConfig.Decode(false, token, nil)
+
+			So(recoveredClaims, ShouldBeNil)
+		})
+	})
+}
+
+func TestRotateSecrets(t *testing.T) {
+	Convey("Given two JWT engines of the same certificate authority", t, func() {
+		oldCA := newTestAuthority("old-ca")
+		newCA := newTestAuthority("new-ca")
+
+		secrets1 := oldCA.secrets("server1")
+		secrets2 := oldCA.secrets("server2")
+		jwt1, _ := NewJWT(validity, "server1", secrets1)
+		jwt2, _ := NewJWT(validity, "server2", secrets2)
+
+		Convey("When both secrets are rotated to the new authority", func() {
+			So(secrets1.UpdateSecrets(newCA.secrets("server1")), ShouldBeNil)
+			So(secrets2.UpdateSecrets(newCA.secrets("server2")), ShouldBeNil)
+
+			Convey("Then the tokens signed with the new keys should be verified", func() {
+				claims, _ := jwt2.Decode(false, jwt1.CreateAndSign(false, &defaultClaims), nil)
+				So(claims, ShouldNotBeNil)
+				So(string(claims.LCL), ShouldEqual, lcl)
+			})
+		})
+
+		Convey("When only one secrets is rotated to the new authority", func() {
+			So(secrets1.UpdateSecrets(newCA.secrets("server1")), ShouldBeNil)
+
+			Convey("Then its tokens should be rejected by the old authority", func() {
+				claims, _ := jwt2.Decode(false, jwt1.CreateAndSign(false, &defaultClaims), nil)
+				So(claims, ShouldBeNil)
+			})
+		})
+
+		Convey("When the secrets are rotated with a bundle of both authorities", func() {
+			rotated := newCA.secrets("server2")
+			bundle := append(append([]byte{}, oldCA.pem...), newCA.pem...)
+			So(secrets2.UpdateSecrets(NewPKISecrets(rotated.PrivateKeyPEM, rotated.PublicKeyPEM, bundle, nil)), ShouldBeNil)
+
+			Convey("Then the tokens of both authorities should be verified", func() {
+				claims, _ := jwt2.Decode(false, jwt1.CreateAndSign(false, &defaultClaims), nil)
+				So(claims, ShouldNotBeNil)
+
+				other, _ := NewJWT(validity, "server3", newCA.secrets("server3"))
+				claims, _ = jwt2.Decode(false, other.CreateAndSign(false, &defaultClaims), nil)
+				So(claims, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the secrets are rotated with pre-shared key secrets", func() {
+			err := secrets1.UpdateSecrets(NewPSKSecrets(psk))
+
+			Convey("Then I should get an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given two JWT engines with a pre-shared key", t, func() {
+		secrets1 := NewPSKSecrets(psk)
+		secrets2 := NewPSKSecrets(psk)
+		jwt1, _ := NewJWT(validity, "server1", secrets1)
+		jwt2, _ := NewJWT(validity, "server2", secrets2)
+
+		Convey("When the key of one engine is rotated", func() {
+			So(secrets1.UpdateSecrets(NewPSKSecrets([]byte("rotated pre-shared key"))), ShouldBeNil)
+
+			Convey("Then its tokens should be rejected until the peer is rotated", func() {
+				claims, _ := jwt2.Decode(false, jwt1.CreateAndSign(false, &defaultClaims), nil)
+				So(claims, ShouldBeNil)
+
+				So(secrets2.UpdateSecrets(NewPSKSecrets([]byte("rotated pre-shared key"))), ShouldBeNil)
+				claims, _ = jwt2.Decode(false, jwt1.CreateAndSign(false, &defaultClaims), nil)
+				So(claims, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the key is rotated with PKI secrets", func() {
+			err := secrets1.UpdateSecrets(newTestAuthority("ca").secrets("server1"))
+
+			Convey("Then I should get an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
 func TestCreateAndVerifyPKI(t *testing.T) {
 	Convey("Given a JWT valid engine with a PKI  key ", t, func() {
 		secrets := NewPKISecrets([]byte(keyPEM), []byte(certPEM), []byte(caPool), nil)
@@ -173,3 +281,44 @@ func TestCreateAndVerifyPKI(t *testing.T) {
 
 	})
 }
+
+func TestDiagnose(t *testing.T) {
+	Convey("Given a JWT engine with a pre-shared key", t, func() {
+		jwtConfig, _ := NewJWT(validity, "TRIREME", NewPSKSecrets(psk))
+		token := jwtConfig.CreateAndSign(false, &defaultClaims)
+
+		Convey("When I diagnose a valid token", func() {
+			diagnosis, err := jwtConfig.Diagnose(false, token)
+
+			Convey("I should get the claims and a verified token", func() {
+				So(err, ShouldBeNil)
+				So(diagnosis.Verified, ShouldBeTrue)
+				So(diagnosis.VerificationError, ShouldBeNil)
+				So(diagnosis.Issuer, ShouldEqual, "TRIREME")
+				So(diagnosis.Expired, ShouldBeFalse)
+				So(diagnosis.Claims.T.Tags["label1"], ShouldEqual, "value1")
+			})
+		})
+
+		Convey("When I diagnose a token signed with a different key", func() {
+			otherConfig, _ := NewJWT(validity, "OTHER", NewPSKSecrets([]byte("A DIFFERENT KEY")))
+			diagnosis, err := otherConfig.Diagnose(false, token)
+
+			Convey("I should get the claims and the verification error", func() {
+				So(err, ShouldBeNil)
+				So(diagnosis.Verified, ShouldBeFalse)
+				So(diagnosis.VerificationError, ShouldNotBeNil)
+				So(diagnosis.Issuer, ShouldEqual, "TRIREME")
+				So(string(diagnosis.Claims.LCL), ShouldEqual, lcl)
+			})
+		})
+
+		Convey("When I diagnose garbage", func() {
+			_, err := jwtConfig.Diagnose(false, []byte("garbage%"))
+
+			Convey("I should get an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
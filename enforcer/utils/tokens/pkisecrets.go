@@ -4,6 +4,7 @@ import (
 	"crypto/ecdsa"
 	"crypto/x509"
 	"fmt"
+	"sync"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/aporeto-inc/trireme/crypto"
@@ -18,6 +19,9 @@ type PKISecrets struct {
 	privateKey       *ecdsa.PrivateKey
 	publicKey        *x509.Certificate
 	certPool         *x509.CertPool
+	federations      map[string]*federation
+	federationLock   sync.RWMutex
+	keyLock          sync.RWMutex
 }
 
 // NewPKISecrets creates new secrets for PKI implementations
@@ -36,6 +40,7 @@ func NewPKISecrets(keyPEM, certPEM, caPEM []byte, certCache map[string]*ecdsa.Pu
 		privateKey:       key,
 		publicKey:        cert,
 		certPool:         caCertPool,
+		federations:      map[string]*federation{},
 	}
 
 	return p
@@ -48,6 +53,9 @@ func (p *PKISecrets) Type() SecretsType {
 
 // EncodingKey returns the private key
 func (p *PKISecrets) EncodingKey() interface{} {
+	p.keyLock.RLock()
+	defer p.keyLock.RUnlock()
+
 	return p.privateKey
 }
 
@@ -71,8 +79,19 @@ func (p *PKISecrets) DecodingKey(server string, ackCert interface{}, prevCert in
 	}
 
 	// If we have an inband certificate, return this one
+	// The certificates of other key types are trusted but cannot verify the tokens
 	if ackCert != nil {
-		return ackCert.(*x509.Certificate).PublicKey.(*ecdsa.PublicKey), nil
+		cert, ok := ackCert.(*x509.Certificate)
+		if !ok {
+			return nil, fmt.Errorf("Invalid certificate")
+		}
+
+		key, ok := cert.PublicKey.(*ecdsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("Certificate of %s does not have an ECDSA key", cert.Subject.CommonName)
+		}
+
+		return key, nil
 	}
 
 	// Otherwise, return the prevCert
@@ -83,20 +102,117 @@ func (p *PKISecrets) DecodingKey(server string, ackCert interface{}, prevCert in
 	return nil, fmt.Errorf("No valid certificate")
 }
 
-// VerifyPublicKey verifies if the inband public key is correct.
+// VerifyPublicKey verifies if the inband public key is correct. The certificates
+// issued by the certificate authorities of the federated deployments are accepted.
 func (p *PKISecrets) VerifyPublicKey(pkey []byte) (interface{}, error) {
-	decodedCert, err := crypto.LoadAndVerifyCertificate(pkey, p.certPool)
+	decodedCert, err := crypto.LoadAndVerifyCertificate(pkey, p.pool())
 
 	if err != nil {
+		p.federationLock.RLock()
+		defer p.federationLock.RUnlock()
+
+		for _, f := range p.federations {
+			if cert, ferr := crypto.LoadAndVerifyCertificate(pkey, f.pool); ferr == nil {
+				return cert, nil
+			}
+		}
+
 		return nil, err
 	}
 
 	return decodedCert, nil
 }
 
+// Federate implements the FederatedSecrets interface
+func (p *PKISecrets) Federate(f *Federation) error {
+
+	parsed, err := newFederation(f)
+	if err != nil {
+		return err
+	}
+
+	p.federationLock.Lock()
+	defer p.federationLock.Unlock()
+
+	if p.federations == nil {
+		p.federations = map[string]*federation{}
+	}
+	p.federations[f.Name] = parsed
+
+	log.WithFields(log.Fields{
+		"package":    "tokens",
+		"federation": f.Name,
+		"tags":       f.Tags,
+	}).Info("Trusting the certificate authorities of federated deployment")
+
+	return nil
+}
+
+// Unfederate implements the FederatedSecrets interface
+func (p *PKISecrets) Unfederate(name string) error {
+
+	p.federationLock.Lock()
+	defer p.federationLock.Unlock()
+
+	if _, ok := p.federations[name]; !ok {
+		return fmt.Errorf("No federation %s", name)
+	}
+
+	delete(p.federations, name)
+
+	return nil
+}
+
+// Federations implements the FederatedSecrets interface
+func (p *PKISecrets) Federations() []*Federation {
+
+	p.federationLock.RLock()
+	defer p.federationLock.RUnlock()
+
+	federations := []*Federation{}
+	for _, f := range p.federations {
+		federations = append(federations, f.config.Clone())
+	}
+
+	return federations
+}
+
+// PeerFederation implements the FederatedSecrets interface. A certificate verified
+// by the local certificate authorities is never attributed to a federation, even if
+// a federated deployment shares them.
+func (p *PKISecrets) PeerFederation(cert interface{}) (*Federation, bool) {
+
+	c, ok := cert.(*x509.Certificate)
+	if !ok {
+		return nil, false
+	}
+
+	p.federationLock.RLock()
+	defer p.federationLock.RUnlock()
+
+	if len(p.federations) == 0 {
+		return nil, false
+	}
+
+	if _, err := c.Verify(x509.VerifyOptions{Roots: p.pool()}); err == nil {
+		return nil, false
+	}
+
+	for _, f := range p.federations {
+		if _, err := c.Verify(x509.VerifyOptions{Roots: f.pool}); err == nil {
+			return f.config.Clone(), true
+		}
+	}
+
+	return nil, false
+}
+
 // TransmittedKey returns the PEM of the public key in the case of PKI
 // if there is no certificate cache configured
 func (p *PKISecrets) TransmittedKey() []byte {
+	p.keyLock.RLock()
+	defer p.keyLock.RUnlock()
+
 	return p.PublicKeyPEM
 }
 
@@ -110,7 +226,7 @@ func (p *PKISecrets) AckSize() uint32 {
 // If Invalid, an error is returned.
 func (p *PKISecrets) PublicKeyAdd(host string, newCert []byte) error {
 
-	cert, err := crypto.LoadAndVerifyCertificate(newCert, p.certPool)
+	cert, err := crypto.LoadAndVerifyCertificate(newCert, p.pool())
 	if err != nil {
 		return fmt.Errorf("Error loading new Cert: %s", err)
 	}
@@ -125,13 +241,56 @@ func (p *PKISecrets) PublicKeyAdd(host string, newCert []byte) error {
 }
 
 func (p *PKISecrets) AuthPEM() []byte {
+	p.keyLock.RLock()
+	defer p.keyLock.RUnlock()
+
 	return p.AuthorityPEM
 }
 
 func (p *PKISecrets) TransmittedPEM() []byte {
+	p.keyLock.RLock()
+	defer p.keyLock.RUnlock()
+
 	return p.PublicKeyPEM
 }
 
 func (p *PKISecrets) EncodingPEM() []byte {
+	p.keyLock.RLock()
+	defer p.keyLock.RUnlock()
+
 	return p.PrivateKeyPEM
 }
+
+// pool returns the pool of the certificate authorities
+func (p *PKISecrets) pool() *x509.CertPool {
+	p.keyLock.RLock()
+	defer p.keyLock.RUnlock()
+
+	return p.certPool
+}
+
+// UpdateSecrets implements the RotatableSecrets interface. The key, the certificate
+// and the certificate authorities are replaced by the ones of the given PKI secrets.
+// The certificate cache and the federations are kept.
+func (p *PKISecrets) UpdateSecrets(secrets Secrets) error {
+
+	s, ok := secrets.(*PKISecrets)
+	if !ok || s == nil {
+		return fmt.Errorf("PKI secrets can only be rotated with PKI secrets")
+	}
+
+	s.keyLock.RLock()
+	defer s.keyLock.RUnlock()
+
+	p.keyLock.Lock()
+	defer p.keyLock.Unlock()
+
+	p.PrivateKeyPEM = s.PrivateKeyPEM
+	p.PublicKeyPEM = s.PublicKeyPEM
+	p.AuthorityPEM = s.AuthorityPEM
+	p.privateKey = s.privateKey
+	p.publicKey = s.publicKey
+	p.certPool = s.certPool
+
+	return nil
+}
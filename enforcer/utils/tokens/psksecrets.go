@@ -1,8 +1,14 @@
 package tokens
 
+import (
+	"fmt"
+	"sync"
+)
+
 // PSKSecrets holds the shared key
 type PSKSecrets struct {
 	SharedKey []byte
+	sync.RWMutex
 }
 
 // NewPSKSecrets creates new PSK Secrets
@@ -17,11 +23,17 @@ func (p *PSKSecrets) Type() SecretsType {
 
 // EncodingKey returns the pre-shared key
 func (p *PSKSecrets) EncodingKey() interface{} {
+	p.RLock()
+	defer p.RUnlock()
+
 	return p.SharedKey
 }
 
 // DecodingKey returns the preshared key
 func (p *PSKSecrets) DecodingKey(server string, ackCert, prevCert interface{}) (interface{}, error) {
+	p.RLock()
+	defer p.RUnlock()
+
 	return p.SharedKey, nil
 }
 
@@ -41,13 +53,41 @@ func (p *PSKSecrets) AckSize() uint32 {
 }
 
 func (p *PSKSecrets) AuthPEM() []byte {
+	p.RLock()
+	defer p.RUnlock()
+
 	return p.SharedKey
 }
 
 func (p *PSKSecrets) TransmittedPEM() []byte {
+	p.RLock()
+	defer p.RUnlock()
+
 	return p.SharedKey
 }
 
 func (p *PSKSecrets) EncodingPEM() []byte {
+	p.RLock()
+	defer p.RUnlock()
+
 	return p.SharedKey
 }
+
+// UpdateSecrets implements the RotatableSecrets interface. The shared key is replaced
+// by the one of the given PSK secrets.
+func (p *PSKSecrets) UpdateSecrets(secrets Secrets) error {
+
+	s, ok := secrets.(*PSKSecrets)
+	if !ok || s == nil {
+		return fmt.Errorf("PSK secrets can only be rotated with PSK secrets")
+	}
+
+	key := s.EncodingPEM()
+
+	p.Lock()
+	defer p.Unlock()
+
+	p.SharedKey = key
+
+	return nil
+}
@@ -0,0 +1,223 @@
+package tokens
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aporeto-inc/trireme/policy"
+	"github.com/aporeto-inc/trireme/utils/clock"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// TokenFormat is the format of the tokens of a connection
+type TokenFormat int
+
+const (
+	// DefaultFormat lets the engine choose the format of the token
+	DefaultFormat TokenFormat = iota
+	// CompactFormat is the format of the JWT engine: a JWT with the claims of the
+	// connection and a padded issuer, followed by the certificate of the sender
+	CompactFormat
+	// StandardFormat is a standards-compliant JWT signed with ES256, whose claims are
+	// registered or named claims and whose certificate is in the x5c header, that
+	// third-party systems validate with off-the-shelf JWT libraries
+	StandardFormat
+)
+
+// standardClaims are the claims of the tokens of the standard format
+type standardClaims struct {
+	Tags map[string]string `json:"tags,omitempty"`
+	LCL  []byte            `json:"lcl,omitempty"`
+	RMT  []byte            `json:"rmt,omitempty"`
+	EK   []byte            `json:"ek,omitempty"`
+	RV   string            `json:"rv,omitempty"`
+	jwt.StandardClaims
+}
+
+// StandardJWTConfig is a token engine negotiating the format of the tokens per
+// connection. It decodes the tokens of both formats and answers a token in the
+// format of the token of the peer, so that the peers that only know the compact
+// format keep working. The tokens of the ACK packets, which carry no identity and
+// must all have the same size, are always in the compact format.
+type StandardJWTConfig struct {
+	// ValidityPeriod is the validity period of the tokens
+	ValidityPeriod time.Duration
+	// Issuer is the server that issues the tokens
+	Issuer string
+	// Preferred is the format of the tokens that start the connections
+	Preferred TokenFormat
+
+	compact *JWTConfig
+	secrets Secrets
+	clock   clock.Clock
+}
+
+// NewStandardJWT creates a token engine that prefers the standard format. The
+// secrets must be PKI secrets, since the tokens are signed with ES256.
+func NewStandardJWT(validity time.Duration, issuer string, secrets Secrets) (*StandardJWTConfig, error) {
+
+	if secrets == nil {
+		return nil, fmt.Errorf("Secrets cannnot be nil")
+	}
+
+	if secrets.Type() != PKIType {
+		return nil, fmt.Errorf("Standard tokens require PKI secrets")
+	}
+
+	compact, err := NewJWT(validity, issuer, secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StandardJWTConfig{
+		ValidityPeriod: validity,
+		Issuer:         issuer,
+		Preferred:      StandardFormat,
+		compact:        compact,
+		secrets:        secrets,
+		clock:          clock.New(),
+	}, nil
+}
+
+// SetClock sets the source of time of the expiry of the tokens
+func (c *StandardJWTConfig) SetClock(clk clock.Clock) {
+
+	c.clock = clk
+	c.compact.SetClock(clk)
+}
+
+// CreateAndSign creates a token in the format of the claims, or in the preferred
+// format if the claims have none, and signs it with the key of the secrets
+func (c *StandardJWTConfig) CreateAndSign(isAck bool, claims *ConnectionClaims) []byte {
+
+	format := claims.Format
+	if format == DefaultFormat {
+		format = c.Preferred
+	}
+
+	if isAck || format != StandardFormat {
+		return c.compact.CreateAndSign(isAck, claims)
+	}
+
+	now := c.clock.Now()
+
+	allclaims := &standardClaims{
+		LCL: claims.LCL,
+		RMT: claims.RMT,
+		EK:  claims.EK,
+		RV:  claims.RV,
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    c.Issuer,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(c.ValidityPeriod).Unix(),
+		},
+	}
+
+	if claims.T != nil {
+		allclaims.Tags = claims.T.Tags
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, allclaims)
+
+	if block, _ := pem.Decode(c.secrets.TransmittedKey()); block != nil {
+		token.Header["x5c"] = []string{base64.StdEncoding.EncodeToString(block.Bytes)}
+	}
+
+	strtoken, err := token.SignedString(c.secrets.EncodingKey())
+	if err != nil {
+		return []byte{}
+	}
+
+	return []byte(strtoken)
+}
+
+// Decode decodes a token of either format. The claims of the tokens are returned
+// with the format of the token, so that the answer is in the same format.
+func (c *StandardJWTConfig) Decode(isAck bool, data []byte, previousCert interface{}) (*ConnectionClaims, interface{}) {
+
+	// The compact tokens separate the certificate with a character that is never
+	// part of a JWT
+	if isAck || bytes.IndexByte(data, []byte("%")[0]) >= 0 {
+		claims, cert := c.compact.Decode(isAck, data, previousCert)
+		if claims != nil {
+			claims.Format = CompactFormat
+		}
+		return claims, cert
+	}
+
+	claims, cert, err := c.decodeStandard(string(data), previousCert)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"package": "tokens",
+			"error":   err.Error(),
+		}).Error("Standard token rejected")
+
+		return nil, nil
+	}
+
+	return claims, cert
+}
+
+// decodeStandard verifies a token of the standard format with the certificate of
+// its header, if any, or the certificate given out of band
+func (c *StandardJWTConfig) decodeStandard(token string, previousCert interface{}) (*ConnectionClaims, interface{}, error) {
+
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		return nil, nil, fmt.Errorf("Malformed token: expected 3 segments, got %d", len(segments))
+	}
+
+	header := struct {
+		X5C []string `json:"x5c"`
+	}{}
+	if err := decodeSegment(segments[0], &header); err != nil {
+		return nil, nil, fmt.Errorf("Malformed token header: %s", err)
+	}
+
+	var cert interface{}
+
+	if len(header.X5C) > 0 {
+		der, err := base64.StdEncoding.DecodeString(header.X5C[0])
+		if err != nil {
+			return nil, nil, fmt.Errorf("Malformed certificate: %s", err)
+		}
+
+		cert, err = c.secrets.VerifyPublicKey(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+		if err != nil {
+			return nil, nil, fmt.Errorf("Untrusted certificate: %s", err)
+		}
+	}
+
+	claims := &standardClaims{}
+
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	jwttoken, err := parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		// Only ES256 is accepted, whatever the algorithm the token claims
+		if t.Method.Alg() != jwt.SigningMethodES256.Alg() {
+			return nil, fmt.Errorf("Unexpected signing method %s", t.Method.Alg())
+		}
+		return c.secrets.DecodingKey(claims.Issuer, cert, previousCert)
+	})
+
+	if err != nil || !jwttoken.Valid {
+		return nil, nil, fmt.Errorf("Invalid token: %v", err)
+	}
+
+	if claims.ExpiresAt == 0 || c.clock.Now().Unix() > claims.ExpiresAt {
+		return nil, nil, fmt.Errorf("Token is expired")
+	}
+
+	return &ConnectionClaims{
+		T:      policy.NewTagsMap(claims.Tags),
+		LCL:    claims.LCL,
+		RMT:    claims.RMT,
+		EK:     claims.EK,
+		RV:     claims.RV,
+		Format: StandardFormat,
+	}, cert, nil
+}
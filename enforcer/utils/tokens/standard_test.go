@@ -0,0 +1,141 @@
+package tokens
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aporeto-inc/trireme/utils/clock"
+	jwt "github.com/dgrijalva/jwt-go"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStandardJWT(t *testing.T) {
+
+	Convey("Given two servers of the same certificate authority", t, func() {
+
+		authority := newTestAuthority("local-ca")
+		secrets1 := authority.secrets("server1")
+		secrets2 := authority.secrets("server2")
+
+		standard, err := NewStandardJWT(validity, "server1", secrets1)
+		So(err, ShouldBeNil)
+		peer, err := NewStandardJWT(validity, "server2", secrets2)
+		So(err, ShouldBeNil)
+
+		Convey("The standard tokens should be validated by a generic JWT library", func() {
+			token := standard.CreateAndSign(false, &defaultClaims)
+			So(bytes.IndexByte(token, '%'), ShouldEqual, -1)
+
+			segments := strings.Split(string(token), ".")
+			So(segments, ShouldHaveLength, 3)
+
+			header := map[string]interface{}{}
+			So(decodeSegment(segments[0], &header), ShouldBeNil)
+			So(header["alg"], ShouldEqual, "ES256")
+			So(header["x5c"], ShouldHaveLength, 1)
+
+			der, err := base64.StdEncoding.DecodeString(header["x5c"].([]interface{})[0].(string))
+			So(err, ShouldBeNil)
+			cert, err := x509.ParseCertificate(der)
+			So(err, ShouldBeNil)
+
+			claims := jwt.MapClaims{}
+			parsed, err := jwt.ParseWithClaims(string(token), &claims, func(t *jwt.Token) (interface{}, error) {
+				return cert.PublicKey.(*ecdsa.PublicKey), nil
+			})
+			So(err, ShouldBeNil)
+			So(parsed.Valid, ShouldBeTrue)
+			So(claims["iss"], ShouldEqual, "server1")
+			So(claims["tags"], ShouldResemble, map[string]interface{}{"label1": "value1", "label2": "value2"})
+		})
+
+		Convey("The standard tokens should be decoded by the peer", func() {
+			token := standard.CreateAndSign(false, &defaultClaims)
+
+			claims, cert := peer.Decode(false, token, nil)
+			So(claims, ShouldNotBeNil)
+			So(cert, ShouldNotBeNil)
+			So(claims.Format, ShouldEqual, StandardFormat)
+			So(claims.T.Tags, ShouldResemble, defaultClaims.T.Tags)
+			So(claims.LCL, ShouldResemble, defaultClaims.LCL)
+			So(claims.RMT, ShouldResemble, defaultClaims.RMT)
+
+			Convey("The ACK tokens should be compact and verified with the certificate of the connection", func() {
+				compact, err := NewJWT(validity, "server1", secrets1)
+				So(err, ShouldBeNil)
+
+				ack := standard.CreateAndSign(true, &ackClaims)
+				So(len(ack), ShouldEqual, len(compact.CreateAndSign(true, &ackClaims)))
+
+				claims, _ := peer.Decode(true, ack, cert.(*x509.Certificate).PublicKey)
+				So(claims, ShouldNotBeNil)
+				So(claims.LCL, ShouldResemble, ackClaims.LCL)
+			})
+		})
+
+		Convey("The tokens of a peer of the compact format should be answered in the compact format", func() {
+			compact, err := NewJWT(validity, "server2", secrets2)
+			So(err, ShouldBeNil)
+
+			claims, _ := standard.Decode(false, compact.CreateAndSign(false, &defaultClaims), nil)
+			So(claims, ShouldNotBeNil)
+			So(claims.Format, ShouldEqual, CompactFormat)
+
+			answer := standard.CreateAndSign(false, &ConnectionClaims{T: tags, LCL: []byte(lcl), RMT: []byte(rmt), Format: claims.Format})
+			So(bytes.IndexByte(answer, '%'), ShouldBeGreaterThan, 0)
+
+			decoded, _ := compact.Decode(false, answer, nil)
+			So(decoded, ShouldNotBeNil)
+			So(decoded.T.Tags, ShouldResemble, tags.Tags)
+		})
+
+		Convey("The tokens should be compact if the compact format is preferred", func() {
+			standard.Preferred = CompactFormat
+
+			token := standard.CreateAndSign(false, &defaultClaims)
+			So(bytes.IndexByte(token, '%'), ShouldBeGreaterThan, 0)
+		})
+
+		Convey("The tampered tokens should be rejected", func() {
+			token := string(standard.CreateAndSign(false, &defaultClaims))
+			segments := strings.Split(token, ".")
+			segments[1] = jwt.EncodeSegment([]byte(`{"iss":"server1","tags":{"label1":"admin"},"exp":4102444800}`))
+
+			claims, _ := peer.Decode(false, []byte(strings.Join(segments, ".")), nil)
+			So(claims, ShouldBeNil)
+		})
+
+		Convey("The tokens of an untrusted certificate authority should be rejected", func() {
+			other, err := NewStandardJWT(validity, "server3", newTestAuthority("other-ca").secrets("server3"))
+			So(err, ShouldBeNil)
+
+			claims, _ := peer.Decode(false, other.CreateAndSign(false, &defaultClaims), nil)
+			So(claims, ShouldBeNil)
+		})
+
+		Convey("The expired tokens should be rejected", func() {
+			clk := clock.NewFake(time.Now())
+			standard.SetClock(clk)
+			peer.SetClock(clk)
+
+			token := standard.CreateAndSign(false, &defaultClaims)
+			clk.Advance(validity + time.Second)
+
+			claims, _ := peer.Decode(false, token, nil)
+			So(claims, ShouldBeNil)
+		})
+	})
+
+	Convey("Given pre-shared key secrets", t, func() {
+
+		Convey("The standard engine should not be created", func() {
+			_, err := NewStandardJWT(validity, "server1", NewPSKSecrets(psk))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
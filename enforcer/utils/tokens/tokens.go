@@ -8,14 +8,33 @@ type ConnectionClaims struct {
 	LCL []byte
 	RMT []byte
 	EK  []byte
+	// RV is the revision of the identity of the sender. It is optional.
+	RV string `json:",omitempty"`
+	// Format is the format of the token. It is set by the engines that negotiate the
+	// format of the tokens per connection.
+	Format TokenFormat `json:"-"`
 }
 
-// TokenEngine is the interface to the different implementations of tokens
+// TokenEngine is the interface to the different implementations of tokens. The
+// datapath uses the JWT engine unless another engine is configured, which lets
+// integrators carry the claims in their own format or sign them with an external
+// service.
 type TokenEngine interface {
-	// CreteAndSign creates a token, signs it and produces the final byte string
-	CreateAndSign(attachCert bool, claims *ConnectionClaims) []byte
-	// Decode decodes an incoming buffer and returns the claims and the sender certificate
-	Decode(decodeCert bool, buffer []byte, cert interface{}) (*ConnectionClaims, interface{})
+	// CreteAndSign creates a token, signs it and produces the final byte string.
+	// The tokens of the ACK packets, created with isAck, carry no tags and must all
+	// have the same size.
+	CreateAndSign(isAck bool, claims *ConnectionClaims) []byte
+	// Decode decodes an incoming buffer and returns the claims and the sender
+	// certificate. The certificate is given back to the decoding of the ACK token of
+	// the same connection. The claims are nil if the token is invalid.
+	Decode(isAck bool, buffer []byte, cert interface{}) (*ConnectionClaims, interface{})
+}
+
+// AckSizer is implemented by the token engines whose ACK tokens do not have the size
+// given by the secrets
+type AckSizer interface {
+	// AckSize returns the size of the ACK tokens
+	AckSize() uint32
 }
 
 // SecretsType identifies the different secrets that are supported
@@ -42,3 +61,12 @@ type Secrets interface {
 	VerifyPublicKey(pkey []byte) (interface{}, error)
 	AckSize() uint32
 }
+
+// RotatableSecrets are the secrets whose keys are rotated without restarting the
+// enforcers. The engines keep the secrets, so the new handshakes use the new keys
+// and the established flows are not affected.
+type RotatableSecrets interface {
+	// UpdateSecrets replaces the keys and the certificate authorities by the ones of
+	// secrets of the same type
+	UpdateSecrets(secrets Secrets) error
+}
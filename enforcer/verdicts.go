@@ -0,0 +1,65 @@
+package enforcer
+
+import (
+	"net"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aporeto-inc/trireme/enforcer/utils/packet"
+)
+
+// SetVerdictCache implements the VerdictCacheConfigurer interface
+func (d *datapathEnforcer) SetVerdictCache(cache VerdictCache) {
+
+	d.verdicts = cache
+}
+
+// cacheVerdict caches the verdict of the flow of an accepted Ack packet, if the fast
+// path is enabled for the PU. The flow is still accepted if it cannot be cached, its
+// packets are only queued again.
+func (d *datapathEnforcer) cacheVerdict(context *PUContext, tcpPacket *packet.Packet) {
+
+	if d.verdicts == nil || !context.fastPath {
+		return
+	}
+
+	var err error
+	if flows, ok := d.verdicts.(FlowVerdictCache); ok {
+		err = flows.CacheFlowVerdict(tcpPacket.SourceAddress, tcpPacket.DestinationAddress, tcpPacket.SourcePort, tcpPacket.DestinationPort)
+	} else {
+		err = d.verdicts.CacheVerdict(tcpPacket.SourceAddress, tcpPacket.DestinationAddress, tcpPacket.DestinationPort)
+	}
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"package": "enforcer",
+			"source":  tcpPacket.SourceAddress.String(),
+			"port":    tcpPacket.DestinationPort,
+			"error":   err.Error(),
+		}).Debug("Failed to cache the verdict of the flow")
+	}
+}
+
+// evictVerdict removes the verdict of a flow that is no longer accepted, so that its
+// packets are queued to the datapath again
+func (d *datapathEnforcer) evictVerdict(flow *FlowState) {
+
+	if d.verdicts == nil {
+		return
+	}
+
+	var err error
+	if flows, ok := d.verdicts.(FlowVerdictCache); ok {
+		err = flows.EvictFlowVerdict(net.ParseIP(flow.SourceIP), net.ParseIP(flow.DestinationIP), flow.SourcePort, flow.DestinationPort)
+	} else {
+		err = d.verdicts.EvictVerdict(net.ParseIP(flow.SourceIP), net.ParseIP(flow.DestinationIP), flow.DestinationPort)
+	}
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"package": "enforcer",
+			"source":  flow.SourceIP,
+			"port":    flow.DestinationPort,
+			"error":   err.Error(),
+		}).Warn("Failed to evict the verdict of a revoked flow")
+	}
+}
@@ -0,0 +1,51 @@
+package enforcer
+
+import (
+	"net"
+	"testing"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/enforcer/utils/packet"
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// countingVerdicts counts the verdicts cached
+type countingVerdicts struct {
+	cached int
+}
+
+func (c *countingVerdicts) CacheVerdict(source, destination net.IP, port uint16) error {
+	c.cached++
+	return nil
+}
+
+func (c *countingVerdicts) EvictVerdict(source, destination net.IP, port uint16) error {
+	return nil
+}
+
+func TestCacheVerdict(t *testing.T) {
+
+	Convey("Given an enforcer with a verdict cache", t, func() {
+
+		secret := tokens.NewPSKSecrets([]byte("Dummy Test Password"))
+		enforcer := NewDefaultDatapathEnforcer("SomeServerId", &collector.DefaultCollector{}, nil, secret, constants.LocalContainer).(*datapathEnforcer)
+
+		verdicts := &countingVerdicts{}
+		enforcer.SetVerdictCache(verdicts)
+
+		tcpPacket, err := packet.New(0, append([]byte{}, TCPFlow[2]...), "0")
+		So(err, ShouldBeNil)
+
+		Convey("When the fast path is enabled for the PU, the verdict should be cached", func() {
+			enforcer.cacheVerdict(&PUContext{fastPath: true}, tcpPacket)
+			So(verdicts.cached, ShouldEqual, 1)
+		})
+
+		Convey("When the fast path is disabled for the PU, the verdict should not be cached", func() {
+			enforcer.cacheVerdict(&PUContext{}, tcpPacket)
+			So(verdicts.cached, ShouldEqual, 0)
+		})
+	})
+}
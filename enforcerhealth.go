@@ -0,0 +1,166 @@
+package trireme
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/aporeto-inc/trireme/enforcer"
+	"github.com/aporeto-inc/trireme/utils/errortypes"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// EnforcerHealthPolicy is how the remote enforcers of the PUs are checked. A remote
+// enforcer that dies or stops responding is restarted once it failed MaxFailures
+// health checks in a row, and the policy of its PU applied again.
+type EnforcerHealthPolicy struct {
+	// Interval is the interval between two health checks. Zero disables the health
+	// checks.
+	Interval time.Duration
+	// MaxFailures is the number of health checks failed in a row before the remote
+	// enforcer is restarted
+	MaxFailures int
+}
+
+// DefaultEnforcerHealthPolicy is the health policy of the remote enforcers unless
+// configured otherwise
+var DefaultEnforcerHealthPolicy = EnforcerHealthPolicy{
+	Interval:    10 * time.Second,
+	MaxFailures: 3,
+}
+
+// validate returns an error if the health policy is invalid
+func (h EnforcerHealthPolicy) validate() error {
+
+	if h.Interval < 0 {
+		return fmt.Errorf("Health check interval cannot be negative")
+	}
+
+	if h.MaxFailures < 1 {
+		return fmt.Errorf("Max failures must be at least 1")
+	}
+
+	return nil
+}
+
+// SetEnforcerHealthPolicy implements the EnforcerHealthConfigurer interface
+func (t *trireme) SetEnforcerHealthPolicy(health EnforcerHealthPolicy) error {
+
+	if err := health.validate(); err != nil {
+		return err
+	}
+
+	t.health = health
+
+	return nil
+}
+
+// scheduleHealthChecks schedules the next health checks of the remote enforcers,
+// unless they are disabled or Trireme is stopped
+func (t *trireme) scheduleHealthChecks() {
+
+	t.healthLock.Lock()
+	defer t.healthLock.Unlock()
+
+	if t.health.Interval == 0 || t.healthStopped {
+		return
+	}
+
+	t.healthTimer = t.clock.AfterFunc(t.health.Interval, t.checkEnforcers)
+}
+
+// stopHealthChecks cancels the health checks scheduled
+func (t *trireme) stopHealthChecks() {
+
+	t.healthLock.Lock()
+	defer t.healthLock.Unlock()
+
+	t.healthStopped = true
+	if t.healthTimer != nil {
+		t.healthTimer.Stop()
+	}
+}
+
+// checkEnforcers checks the remote enforcers of the enforced PUs and restarts the
+// ones that failed too many health checks. The checks are skipped while the remote
+// enforcers are updated, since the update restarts them.
+func (t *trireme) checkEnforcers() {
+
+	defer t.scheduleHealthChecks()
+
+	if atomic.LoadInt32(&t.updating) != 0 {
+		return
+	}
+
+	failures := map[string]int{}
+
+	for _, contextID := range t.states.contextIDs() {
+
+		checker, ok := t.checkedEnforcer(contextID)
+		if !ok {
+			continue
+		}
+
+		err := checker.HealthCheck(contextID)
+		if err == nil {
+			continue
+		}
+
+		failures[contextID] = t.healthFailures[contextID] + 1
+		if failures[contextID] < t.health.MaxFailures {
+			log.WithFields(log.Fields{
+				"package":   "trireme",
+				"contextID": contextID,
+				"failures":  failures[contextID],
+				"error":     err.Error(),
+			}).Warn("Remote enforcer failed its health check")
+			continue
+		}
+
+		delete(failures, contextID)
+
+		log.WithFields(log.Fields{
+			"package":   "trireme",
+			"contextID": contextID,
+			"error":     err.Error(),
+		}).Error("Restarting the unhealthy remote enforcer")
+
+		if aerr := checker.AbortRemoteEnforcer(contextID); aerr != nil && !errortypes.Is(aerr, errortypes.ErrPUNotFound) {
+			log.WithFields(log.Fields{
+				"package":   "trireme",
+				"contextID": contextID,
+				"error":     aerr.Error(),
+			}).Warn("Failed to abort the remote enforcer")
+		}
+
+		if rerr := t.restartEnforcer(contextID); rerr != nil {
+			log.WithFields(log.Fields{
+				"package":   "trireme",
+				"contextID": contextID,
+				"error":     rerr.Error(),
+			}).Error("Failed to restart the remote enforcer")
+		}
+	}
+
+	t.healthFailures = failures
+}
+
+// checkedEnforcer returns the enforcer of a PU if its remote enforcer is checked:
+// the policy of the PU is applied and its enforcer runs remote enforcers
+func (t *trireme) checkedEnforcer(contextID string) (enforcer.RemoteEnforcerHealthChecker, bool) {
+
+	mode := t.states.get(contextID).mode
+	if mode != EnforcementEnforced && mode != EnforcementQuarantined {
+		return nil, false
+	}
+
+	runtime, err := t.PURuntime(contextID)
+	if err != nil {
+		return nil, false
+	}
+
+	checker, ok := t.enforcers[runtime.PUType()].(enforcer.RemoteEnforcerHealthChecker)
+
+	return checker, ok
+}
@@ -0,0 +1,359 @@
+package trireme
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/enforcer"
+	"github.com/aporeto-inc/trireme/utils/errortypes"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// DefaultEnforcerHealthTimeout is the time the restarted remote enforcer of a PU has
+// to become healthy unless the update sets another one
+const DefaultEnforcerHealthTimeout = 30 * time.Second
+
+// enforcerHealthInterval is the interval between two health checks of a restarted
+// remote enforcer
+var enforcerHealthInterval = 500 * time.Millisecond
+
+// EnforcerUpdate replaces the binary of the remote enforcers
+type EnforcerUpdate struct {
+	// Binary is the path of the new remote enforcer binary. An empty path restores
+	// the binary of the controller.
+	Binary string
+	// Selector selects the PUs by their runtime tags. An empty selector selects all
+	// the PUs.
+	Selector map[string]string
+	// HealthTimeout is the time the restarted remote enforcer of a PU has to become
+	// healthy. It is DefaultEnforcerHealthTimeout if zero.
+	HealthTimeout time.Duration
+	// HealthCheck is an optional check of the restarted remote enforcer of a PU, in
+	// addition to its process running the new binary. It is called until it
+	// succeeds or the health timeout expires.
+	HealthCheck func(contextID string) error
+}
+
+// validate returns an error if the update is invalid
+func (u *EnforcerUpdate) validate() error {
+
+	if u.HealthTimeout < 0 {
+		return fmt.Errorf("Health timeout cannot be negative")
+	}
+
+	return nil
+}
+
+// EnforcerUpdateReport is the outcome of an update of the remote enforcers
+type EnforcerUpdateReport struct {
+	// Binary is the binary of the update
+	Binary string
+	// Updated are the PUs whose remote enforcer was restarted with the binary
+	Updated []string
+	// Failed is the PU whose remote enforcer did not become healthy, if any. The PUs
+	// after it were not updated.
+	Failed string
+	// Err is the error that stopped the update
+	Err error
+	// RolledBack is true if the previous binary was staged again and the remote
+	// enforcer of the failed PU restarted with it
+	RolledBack bool
+}
+
+// UpdateRemoteEnforcers implements the EnforcerUpdater interface. The PUs are
+// restarted by the request routine, so the events of the other PUs are handled
+// between two restarts.
+func (t *trireme) UpdateRemoteEnforcers(update *EnforcerUpdate) <-chan *EnforcerUpdateReport {
+
+	c := make(chan *EnforcerUpdateReport, 1)
+
+	if !atomic.CompareAndSwapInt32(&t.updating, 0, 1) {
+		c <- &EnforcerUpdateReport{
+			Binary: update.Binary,
+			Err:    fmt.Errorf("An update of the remote enforcers is already running"),
+		}
+		return c
+	}
+
+	go func() {
+		defer atomic.StoreInt32(&t.updating, 0)
+		c <- t.updateRemoteEnforcers(update)
+	}()
+
+	return c
+}
+
+// updateRemoteEnforcers stages the binary and restarts the remote enforcers of the
+// selected PUs one at a time. If one does not become healthy, the previous binary is
+// staged again and the remote enforcer of the PU restarted with it.
+func (t *trireme) updateRemoteEnforcers(update *EnforcerUpdate) *EnforcerUpdateReport {
+
+	report := &EnforcerUpdateReport{
+		Binary:  update.Binary,
+		Updated: []string{},
+	}
+
+	if report.Err = update.validate(); report.Err != nil {
+		return report
+	}
+
+	timeout := update.HealthTimeout
+	if timeout == 0 {
+		timeout = DefaultEnforcerHealthTimeout
+	}
+
+	previous := map[constants.PUType]string{}
+	for puType, e := range t.enforcers {
+		updater, ok := e.(enforcer.RemoteEnforcerUpdater)
+		if !ok {
+			continue
+		}
+
+		binary, err := updater.StageRemoteEnforcer(update.Binary)
+		if err != nil {
+			t.restoreEnforcerBinaries(previous)
+			report.Err = errortypes.Wrapf(nil, err, "Cannot stage the remote enforcer binary")
+			return report
+		}
+		previous[puType] = binary
+	}
+
+	if len(previous) == 0 {
+		report.Err = fmt.Errorf("No enforcer runs remote enforcers")
+		return report
+	}
+
+	log.WithFields(log.Fields{
+		"package": "trireme",
+		"binary":  update.Binary,
+	}).Info("Updating the remote enforcers")
+
+	for _, contextID := range t.states.contextIDs() {
+
+		updater, ok := t.updatedEnforcer(contextID, update)
+		if !ok {
+			continue
+		}
+
+		if err := t.restartEnforcer(contextID); err != nil {
+			if errortypes.Is(err, errortypes.ErrPUNotFound) {
+				continue
+			}
+		} else if err = t.waitEnforcerHealth(contextID, updater, update, timeout); err == nil {
+			report.Updated = append(report.Updated, contextID)
+			continue
+		}
+
+		report.Failed = contextID
+		report.Err = fmt.Errorf("Remote enforcer of %s is not healthy", contextID)
+		report.RolledBack = t.rollbackEnforcer(contextID, previous)
+
+		log.WithFields(log.Fields{
+			"package":    "trireme",
+			"contextID":  contextID,
+			"binary":     update.Binary,
+			"rolledBack": report.RolledBack,
+		}).Error("Stopped the update of the remote enforcers")
+
+		return report
+	}
+
+	log.WithFields(log.Fields{
+		"package": "trireme",
+		"binary":  update.Binary,
+		"updated": len(report.Updated),
+	}).Info("Updated the remote enforcers")
+
+	return report
+}
+
+// updatedEnforcer returns the enforcer of a PU if its remote enforcer is updated:
+// the PU is selected, its policy is applied and its enforcer does not run the binary
+// of the update yet
+func (t *trireme) updatedEnforcer(contextID string, update *EnforcerUpdate) (enforcer.RemoteEnforcerUpdater, bool) {
+
+	mode := t.states.get(contextID).mode
+	if mode != EnforcementEnforced && mode != EnforcementQuarantined {
+		return nil, false
+	}
+
+	runtime, err := t.PURuntime(contextID)
+	if err != nil {
+		return nil, false
+	}
+
+	tags := runtime.Tags()
+	for k, v := range update.Selector {
+		if value, ok := tags.Get(k); !ok || value != v {
+			return nil, false
+		}
+	}
+
+	updater, ok := t.enforcers[runtime.PUType()].(enforcer.RemoteEnforcerUpdater)
+	if !ok {
+		return nil, false
+	}
+
+	if binary, err := updater.RemoteEnforcerBinary(contextID); err == nil && update.Binary != "" && binary == update.Binary {
+		return nil, false
+	}
+
+	return updater, true
+}
+
+// restartEnforcer restarts the remote enforcer of a PU through the request routine
+func (t *trireme) restartEnforcer(contextID string) error {
+
+	c := make(chan error, 1)
+	stop := t.stop
+
+	select {
+	case t.requests <- &triremeRequest{
+		contextID:  contextID,
+		reqType:    enforcerRestart,
+		returnChan: c,
+	}:
+	case <-stop:
+		return fmt.Errorf("Cannot restart the enforcer of context %s: trireme is stopped", contextID)
+	}
+
+	return <-c
+}
+
+// doRestartEnforcer drains the remote enforcer of a PU, stops it and applies the
+// policy of the PU again, which launches the remote enforcer with the staged binary
+func (t *trireme) doRestartEnforcer(contextID string) error {
+
+	containerInfo, ok := t.applied[contextID]
+	if !ok {
+		return errortypes.Errorf(errortypes.ErrPUNotFound, "No policy applied to context %s", contextID)
+	}
+
+	puType := containerInfo.Runtime.PUType()
+	mode := t.states.get(contextID).mode
+
+	// The stats of the PU are flushed when it is unenforced
+	errS := t.supervisors[puType].Unsupervise(contextID)
+	errE := t.enforcers[puType].Unenforce(contextID)
+	if errS != nil || errE != nil {
+		log.WithFields(log.Fields{
+			"package":    "trireme",
+			"contextID":  contextID,
+			"supervisor": errS,
+			"enforcer":   errE,
+		}).Warn("Failed to stop the remote enforcer")
+	}
+
+	delete(t.applied, contextID)
+
+	if err := t.applyPolicy(contextID, containerInfo); err != nil {
+		t.applied[contextID] = containerInfo
+		t.states.failed(contextID, err)
+		return errortypes.Wrapf(nil, err, "Cannot restart the remote enforcer of %s", contextID)
+	}
+
+	t.states.applied(contextID, mode)
+
+	if c, ok := t.collector.(collector.AdminEventCollector); ok {
+		c.CollectAdminEvent(&collector.AdminRecord{
+			Action:    collector.AdminEnforcerRestart,
+			ContextID: contextID,
+		})
+	}
+
+	return nil
+}
+
+// waitEnforcerHealth returns nil once the remote enforcer of a PU runs the binary of
+// the update and passes its health check, or the last error after the timeout
+func (t *trireme) waitEnforcerHealth(contextID string, updater enforcer.RemoteEnforcerUpdater, update *EnforcerUpdate, timeout time.Duration) error {
+
+	deadline := t.clock.Now().Add(timeout)
+
+	for {
+		err := t.enforcerHealth(contextID, updater, update)
+		if err == nil {
+			return nil
+		}
+
+		remaining := deadline.Sub(t.clock.Now())
+		if remaining <= 0 {
+			return err
+		}
+
+		if remaining > enforcerHealthInterval {
+			remaining = enforcerHealthInterval
+		}
+		t.clock.Sleep(remaining)
+	}
+}
+
+// enforcerHealth returns an error if the remote enforcer of a PU is not healthy
+func (t *trireme) enforcerHealth(contextID string, updater enforcer.RemoteEnforcerUpdater, update *EnforcerUpdate) error {
+
+	if reporter, ok := updater.(enforcer.RemoteEnforcerReporter); ok {
+		if _, running, err := reporter.RemoteEnforcerStatus(contextID); err != nil || !running {
+			return fmt.Errorf("Remote enforcer of %s is not running", contextID)
+		}
+	}
+
+	if update.Binary != "" {
+		binary, err := updater.RemoteEnforcerBinary(contextID)
+		if err != nil {
+			return err
+		}
+
+		if binary != update.Binary {
+			return fmt.Errorf("Remote enforcer of %s runs %s", contextID, binary)
+		}
+	}
+
+	if update.HealthCheck != nil {
+		return update.HealthCheck(contextID)
+	}
+
+	return nil
+}
+
+// rollbackEnforcer stages the previous binaries again and restarts the remote
+// enforcer of the failed PU with it. It returns true if the restart succeeded.
+func (t *trireme) rollbackEnforcer(contextID string, previous map[constants.PUType]string) bool {
+
+	if !t.restoreEnforcerBinaries(previous) {
+		return false
+	}
+
+	if err := t.restartEnforcer(contextID); err != nil {
+		log.WithFields(log.Fields{
+			"package":   "trireme",
+			"contextID": contextID,
+			"error":     err.Error(),
+		}).Error("Failed to restart the remote enforcer with the previous binary")
+		return false
+	}
+
+	return true
+}
+
+// restoreEnforcerBinaries stages the previous binaries of the enforcers again
+func (t *trireme) restoreEnforcerBinaries(previous map[constants.PUType]string) bool {
+
+	restored := true
+
+	for puType, binary := range previous {
+		if _, err := t.enforcers[puType].(enforcer.RemoteEnforcerUpdater).StageRemoteEnforcer(binary); err != nil {
+			log.WithFields(log.Fields{
+				"package": "trireme",
+				"binary":  binary,
+				"error":   err.Error(),
+			}).Error("Failed to stage the previous remote enforcer binary")
+			restored = false
+		}
+	}
+
+	return restored
+}
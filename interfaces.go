@@ -1,10 +1,15 @@
 package trireme
 
 import (
+	"io"
+
 	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/enforcer"
 	"github.com/aporeto-inc/trireme/monitor"
 	"github.com/aporeto-inc/trireme/policy"
 	"github.com/aporeto-inc/trireme/supervisor"
+	"github.com/aporeto-inc/trireme/utils/auditlog"
+	"github.com/aporeto-inc/trireme/utils/features"
 )
 
 // Trireme is the main interface to the Trireme package.
@@ -19,17 +24,132 @@ type Trireme interface {
 	// Stop stops the component.
 	Stop() error
 
+	// ListPUs returns the state of all the PUs managed by this instance.
+	ListPUs() []*PUState
+
 	// Supervisor returns the supervisor for a given PU type
 	Supervisor(kind constants.PUType) supervisor.Supervisor
 
+	// Enforcer returns the enforcer for a given PU type
+	Enforcer(kind constants.PUType) enforcer.PolicyEnforcer
+
 	//AddExcludedIPList adds the ips to all supervisor instances managed by this trireme instance
 
 	AddExcludedIPList(ipList []string) error
+
+	// Quarantine restricts a PU to the minimal policy of the mode, or lifts the
+	// quarantine if the mode is nil.
+	Quarantine(contextID string, mode *QuarantineMode) <-chan error
+
+	// StartRollout applies a candidate policy revision to the subset of the PUs
+	// selected by the rollout.
+	StartRollout(rollout *Rollout) <-chan error
+
+	// EndRollout ends the running rollout and promotes its revision to all the PUs
+	// or returns its PUs to the current revision.
+	EndRollout(promote bool) <-chan error
+
+	// Snapshot writes a gzipped tar archive of the state of Trireme, without the
+	// secrets of the policies, to attach to the bug reports.
+	Snapshot(w io.Writer) error
+
 	monitor.ProcessingUnitsHandler
 
 	PolicyUpdater
 }
 
+// A RetryConfigurer configures how the PUs whose policy fails to apply are retried
+type RetryConfigurer interface {
+
+	// SetRetryPolicy sets the retry policy. It must be called before Start.
+	SetRetryPolicy(retry RetryPolicy) error
+}
+
+// An EnforcerHealthConfigurer configures the health checks of the remote enforcers
+type EnforcerHealthConfigurer interface {
+
+	// SetEnforcerHealthPolicy sets the health policy. It must be called before Start.
+	SetEnforcerHealthPolicy(health EnforcerHealthPolicy) error
+}
+
+// A ReaperConfigurer configures the detection of the PUs whose workload died without
+// their monitor noticing
+type ReaperConfigurer interface {
+
+	// SetReaperPolicy sets the reaper policy. It must be called before Start.
+	SetReaperPolicy(reaper ReaperPolicy) error
+}
+
+// A FeatureConfigurer configures the feature flags gating the risky behaviors of
+// the datapath
+type FeatureConfigurer interface {
+
+	// SetFeatureFlags sets the feature flags. They apply to the policies applied
+	// afterwards. It must be called before Start.
+	SetFeatureFlags(flags *features.Flags)
+}
+
+// A ServiceConfigurer configures the services referenced by name in the IPRules
+type ServiceConfigurer interface {
+
+	// SetServiceRegistry sets the registry of the services. It replaces the registry
+	// of the well known services. It must be called before Start.
+	SetServiceRegistry(services *policy.ServiceRegistry)
+}
+
+// An AuditConfigurer records the policy resolutions and enforcements in a
+// tamper-evident audit log
+type AuditConfigurer interface {
+
+	// SetAuditLog sets the audit log. It must be called before Start.
+	SetAuditLog(auditLog *auditlog.Log)
+}
+
+// A ConvergenceReporter reports the convergence of the PUs to a policy revision, the
+// value of the collector.PolicyRevisionTag annotation of their policies. The PUs of
+// a revision are the PUs whose latest policy is of the revision, and a PU
+// acknowledges the revision when its datapath, local or remote, applied it.
+type ConvergenceReporter interface {
+
+	// Convergence returns the convergence of the PUs to the revision.
+	Convergence(revision string) *ConvergenceReport
+
+	// WaitForConvergence returns a channel receiving the report of the revision
+	// once all its PUs acknowledged it. The PUs updated by the requests made before
+	// the call are part of the revision.
+	WaitForConvergence(revision string) <-chan *ConvergenceReport
+}
+
+// A StatsFlusher makes the remote enforcers report the flows they aggregated without
+// waiting for their stats interval
+type StatsFlusher interface {
+
+	// FlushStats flushes the flows of the PU. It does nothing for the PUs enforced
+	// locally, whose flows are collected as they happen.
+	FlushStats(contextID string) error
+}
+
+// An EnforcerUpdater replaces the binary of the remote enforcers without restarting
+// Trireme. The PUs are restarted one at a time and the update stops at the first
+// remote enforcer that does not become healthy.
+type EnforcerUpdater interface {
+
+	// UpdateRemoteEnforcers stages the binary of the update and restarts the remote
+	// enforcers of the PUs it selects. The channel receives the report once the
+	// update ended. Only one update can run at a time.
+	UpdateRemoteEnforcers(update *EnforcerUpdate) <-chan *EnforcerUpdateReport
+}
+
+// A RuntimeUpdater changes the runtime tags of the running PUs, for instance to flag
+// a compromised PU or to change its owner, without restarting them
+type RuntimeUpdater interface {
+
+	// UpdateRuntimeTags sets the tags of the runtime of a PU, and removes the tags
+	// with an empty value. The policy of the PU is resolved again with its new tags
+	// and applied, which refreshes its identity.
+	UpdateRuntimeTags(contextID string, tags map[string]string) <-chan error
+}
+
 // A PolicyUpdater has the ability to receive an update for a specific policy.
 type PolicyUpdater interface {
 
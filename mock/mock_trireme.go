@@ -1,97 +1,564 @@
 // Automatically generated by MockGen. DO NOT EDIT!
-// Source: ./monitor/monitor.go
+// Source: interfaces.go
 
 package mock_trireme
 
 import (
-	"github.com/aporeto-inc/trireme/monitor"
+	trireme "github.com/aporeto-inc/trireme"
+	constants "github.com/aporeto-inc/trireme/constants"
+	enforcer "github.com/aporeto-inc/trireme/enforcer"
+	monitor "github.com/aporeto-inc/trireme/monitor"
 	policy "github.com/aporeto-inc/trireme/policy"
+	supervisor "github.com/aporeto-inc/trireme/supervisor"
+	auditlog "github.com/aporeto-inc/trireme/utils/auditlog"
+	features "github.com/aporeto-inc/trireme/utils/features"
 	gomock "github.com/golang/mock/gomock"
+	io "io"
 )
 
-// Mock of Monitor interface
-type MockMonitor struct {
+// Mock of Trireme interface
+type MockTrireme struct {
 	ctrl     *gomock.Controller
-	recorder *_MockMonitorRecorder
+	recorder *_MockTriremeRecorder
 }
 
-// Recorder for MockMonitor (not exported)
-type _MockMonitorRecorder struct {
-	mock *MockMonitor
+// Recorder for MockTrireme (not exported)
+type _MockTriremeRecorder struct {
+	mock *MockTrireme
 }
 
-func NewMockMonitor(ctrl *gomock.Controller) *MockMonitor {
-	mock := &MockMonitor{ctrl: ctrl}
-	mock.recorder = &_MockMonitorRecorder{mock}
+func NewMockTrireme(ctrl *gomock.Controller) *MockTrireme {
+	mock := &MockTrireme{ctrl: ctrl}
+	mock.recorder = &_MockTriremeRecorder{mock}
 	return mock
 }
 
-func (_m *MockMonitor) EXPECT() *_MockMonitorRecorder {
+func (_m *MockTrireme) EXPECT() *_MockTriremeRecorder {
 	return _m.recorder
 }
 
-func (_m *MockMonitor) Start() error {
+func (_m *MockTrireme) PURuntime(contextID string) (policy.RuntimeReader, error) {
+	ret := _m.ctrl.Call(_m, "PURuntime", contextID)
+	ret0, _ := ret[0].(policy.RuntimeReader)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTriremeRecorder) PURuntime(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "PURuntime", arg0)
+}
+
+func (_m *MockTrireme) Start() error {
 	ret := _m.ctrl.Call(_m, "Start")
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockMonitorRecorder) Start() *gomock.Call {
+func (_mr *_MockTriremeRecorder) Start() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Start")
 }
 
-func (_m *MockMonitor) Stop() error {
+func (_m *MockTrireme) Stop() error {
 	ret := _m.ctrl.Call(_m, "Stop")
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockMonitorRecorder) Stop() *gomock.Call {
+func (_mr *_MockTriremeRecorder) Stop() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Stop")
 }
 
-// Mock of ProcessingUnitsHandler interface
-type MockProcessingUnitsHandler struct {
+func (_m *MockTrireme) ListPUs() []*trireme.PUState {
+	ret := _m.ctrl.Call(_m, "ListPUs")
+	ret0, _ := ret[0].([]*trireme.PUState)
+	return ret0
+}
+
+func (_mr *_MockTriremeRecorder) ListPUs() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "ListPUs")
+}
+
+func (_m *MockTrireme) Supervisor(kind constants.PUType) supervisor.Supervisor {
+	ret := _m.ctrl.Call(_m, "Supervisor", kind)
+	ret0, _ := ret[0].(supervisor.Supervisor)
+	return ret0
+}
+
+func (_mr *_MockTriremeRecorder) Supervisor(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Supervisor", arg0)
+}
+
+func (_m *MockTrireme) Enforcer(kind constants.PUType) enforcer.PolicyEnforcer {
+	ret := _m.ctrl.Call(_m, "Enforcer", kind)
+	ret0, _ := ret[0].(enforcer.PolicyEnforcer)
+	return ret0
+}
+
+func (_mr *_MockTriremeRecorder) Enforcer(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Enforcer", arg0)
+}
+
+func (_m *MockTrireme) AddExcludedIPList(ipList []string) error {
+	ret := _m.ctrl.Call(_m, "AddExcludedIPList", ipList)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockTriremeRecorder) AddExcludedIPList(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "AddExcludedIPList", arg0)
+}
+
+func (_m *MockTrireme) Quarantine(contextID string, mode *trireme.QuarantineMode) <-chan error {
+	ret := _m.ctrl.Call(_m, "Quarantine", contextID, mode)
+	ret0, _ := ret[0].(<-chan error)
+	return ret0
+}
+
+func (_mr *_MockTriremeRecorder) Quarantine(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Quarantine", arg0, arg1)
+}
+
+func (_m *MockTrireme) StartRollout(rollout *trireme.Rollout) <-chan error {
+	ret := _m.ctrl.Call(_m, "StartRollout", rollout)
+	ret0, _ := ret[0].(<-chan error)
+	return ret0
+}
+
+func (_mr *_MockTriremeRecorder) StartRollout(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "StartRollout", arg0)
+}
+
+func (_m *MockTrireme) EndRollout(promote bool) <-chan error {
+	ret := _m.ctrl.Call(_m, "EndRollout", promote)
+	ret0, _ := ret[0].(<-chan error)
+	return ret0
+}
+
+func (_mr *_MockTriremeRecorder) EndRollout(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "EndRollout", arg0)
+}
+
+func (_m *MockTrireme) Snapshot(w io.Writer) error {
+	ret := _m.ctrl.Call(_m, "Snapshot", w)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockTriremeRecorder) Snapshot(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Snapshot", arg0)
+}
+
+func (_m *MockTrireme) SetPURuntime(contextID string, runtimeInfo *policy.PURuntime) error {
+	ret := _m.ctrl.Call(_m, "SetPURuntime", contextID, runtimeInfo)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockTriremeRecorder) SetPURuntime(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetPURuntime", arg0, arg1)
+}
+
+func (_m *MockTrireme) HandlePUEvent(contextID string, event monitor.Event) <-chan error {
+	ret := _m.ctrl.Call(_m, "HandlePUEvent", contextID, event)
+	ret0, _ := ret[0].(<-chan error)
+	return ret0
+}
+
+func (_mr *_MockTriremeRecorder) HandlePUEvent(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "HandlePUEvent", arg0, arg1)
+}
+
+func (_m *MockTrireme) UpdatePolicy(contextID string, newPolicy *policy.PUPolicy) <-chan error {
+	ret := _m.ctrl.Call(_m, "UpdatePolicy", contextID, newPolicy)
+	ret0, _ := ret[0].(<-chan error)
+	return ret0
+}
+
+func (_mr *_MockTriremeRecorder) UpdatePolicy(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "UpdatePolicy", arg0, arg1)
+}
+
+// Mock of RetryConfigurer interface
+type MockRetryConfigurer struct {
 	ctrl     *gomock.Controller
-	recorder *_MockProcessingUnitsHandlerRecorder
+	recorder *_MockRetryConfigurerRecorder
 }
 
-// Recorder for MockProcessingUnitsHandler (not exported)
-type _MockProcessingUnitsHandlerRecorder struct {
-	mock *MockProcessingUnitsHandler
+// Recorder for MockRetryConfigurer (not exported)
+type _MockRetryConfigurerRecorder struct {
+	mock *MockRetryConfigurer
 }
 
-func NewMockProcessingUnitsHandler(ctrl *gomock.Controller) *MockProcessingUnitsHandler {
-	mock := &MockProcessingUnitsHandler{ctrl: ctrl}
-	mock.recorder = &_MockProcessingUnitsHandlerRecorder{mock}
+func NewMockRetryConfigurer(ctrl *gomock.Controller) *MockRetryConfigurer {
+	mock := &MockRetryConfigurer{ctrl: ctrl}
+	mock.recorder = &_MockRetryConfigurerRecorder{mock}
 	return mock
 }
 
-func (_m *MockProcessingUnitsHandler) EXPECT() *_MockProcessingUnitsHandlerRecorder {
+func (_m *MockRetryConfigurer) EXPECT() *_MockRetryConfigurerRecorder {
 	return _m.recorder
 }
 
-func (_m *MockProcessingUnitsHandler) SetPURuntime(contextID string, runtimeInfo *policy.PURuntime) error {
+func (_m *MockRetryConfigurer) SetRetryPolicy(retry trireme.RetryPolicy) error {
+	ret := _m.ctrl.Call(_m, "SetRetryPolicy", retry)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
 
-	ret := _m.ctrl.Call(_m, "SetPURuntime", contextID, runtimeInfo)
+func (_mr *_MockRetryConfigurerRecorder) SetRetryPolicy(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetRetryPolicy", arg0)
+}
+
+// Mock of EnforcerHealthConfigurer interface
+type MockEnforcerHealthConfigurer struct {
+	ctrl     *gomock.Controller
+	recorder *_MockEnforcerHealthConfigurerRecorder
+}
 
+// Recorder for MockEnforcerHealthConfigurer (not exported)
+type _MockEnforcerHealthConfigurerRecorder struct {
+	mock *MockEnforcerHealthConfigurer
+}
+
+func NewMockEnforcerHealthConfigurer(ctrl *gomock.Controller) *MockEnforcerHealthConfigurer {
+	mock := &MockEnforcerHealthConfigurer{ctrl: ctrl}
+	mock.recorder = &_MockEnforcerHealthConfigurerRecorder{mock}
+	return mock
+}
+
+func (_m *MockEnforcerHealthConfigurer) EXPECT() *_MockEnforcerHealthConfigurerRecorder {
+	return _m.recorder
+}
+
+func (_m *MockEnforcerHealthConfigurer) SetEnforcerHealthPolicy(health trireme.EnforcerHealthPolicy) error {
+	ret := _m.ctrl.Call(_m, "SetEnforcerHealthPolicy", health)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockProcessingUnitsHandlerRecorder) SetPURuntime(arg0, arg1 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetPURuntime", arg0, arg1)
+func (_mr *_MockEnforcerHealthConfigurerRecorder) SetEnforcerHealthPolicy(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetEnforcerHealthPolicy", arg0)
 }
 
-func (_m *MockProcessingUnitsHandler) HandlePUEvent(contextID string, event monitor.Event) <-chan error {
+// Mock of ReaperConfigurer interface
+type MockReaperConfigurer struct {
+	ctrl     *gomock.Controller
+	recorder *_MockReaperConfigurerRecorder
+}
 
-	ret := _m.ctrl.Call(_m, "HandlePUEvent", contextID, event)
+// Recorder for MockReaperConfigurer (not exported)
+type _MockReaperConfigurerRecorder struct {
+	mock *MockReaperConfigurer
+}
+
+func NewMockReaperConfigurer(ctrl *gomock.Controller) *MockReaperConfigurer {
+	mock := &MockReaperConfigurer{ctrl: ctrl}
+	mock.recorder = &_MockReaperConfigurerRecorder{mock}
+	return mock
+}
+
+func (_m *MockReaperConfigurer) EXPECT() *_MockReaperConfigurerRecorder {
+	return _m.recorder
+}
+
+func (_m *MockReaperConfigurer) SetReaperPolicy(reaper trireme.ReaperPolicy) error {
+	ret := _m.ctrl.Call(_m, "SetReaperPolicy", reaper)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
 
+func (_mr *_MockReaperConfigurerRecorder) SetReaperPolicy(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetReaperPolicy", arg0)
+}
+
+// Mock of FeatureConfigurer interface
+type MockFeatureConfigurer struct {
+	ctrl     *gomock.Controller
+	recorder *_MockFeatureConfigurerRecorder
+}
+
+// Recorder for MockFeatureConfigurer (not exported)
+type _MockFeatureConfigurerRecorder struct {
+	mock *MockFeatureConfigurer
+}
+
+func NewMockFeatureConfigurer(ctrl *gomock.Controller) *MockFeatureConfigurer {
+	mock := &MockFeatureConfigurer{ctrl: ctrl}
+	mock.recorder = &_MockFeatureConfigurerRecorder{mock}
+	return mock
+}
+
+func (_m *MockFeatureConfigurer) EXPECT() *_MockFeatureConfigurerRecorder {
+	return _m.recorder
+}
+
+func (_m *MockFeatureConfigurer) SetFeatureFlags(flags *features.Flags) {
+	_m.ctrl.Call(_m, "SetFeatureFlags", flags)
+}
+
+func (_mr *_MockFeatureConfigurerRecorder) SetFeatureFlags(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetFeatureFlags", arg0)
+}
+
+// Mock of ServiceConfigurer interface
+type MockServiceConfigurer struct {
+	ctrl     *gomock.Controller
+	recorder *_MockServiceConfigurerRecorder
+}
+
+// Recorder for MockServiceConfigurer (not exported)
+type _MockServiceConfigurerRecorder struct {
+	mock *MockServiceConfigurer
+}
+
+func NewMockServiceConfigurer(ctrl *gomock.Controller) *MockServiceConfigurer {
+	mock := &MockServiceConfigurer{ctrl: ctrl}
+	mock.recorder = &_MockServiceConfigurerRecorder{mock}
+	return mock
+}
+
+func (_m *MockServiceConfigurer) EXPECT() *_MockServiceConfigurerRecorder {
+	return _m.recorder
+}
+
+func (_m *MockServiceConfigurer) SetServiceRegistry(services *policy.ServiceRegistry) {
+	_m.ctrl.Call(_m, "SetServiceRegistry", services)
+}
+
+func (_mr *_MockServiceConfigurerRecorder) SetServiceRegistry(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetServiceRegistry", arg0)
+}
+
+// Mock of AuditConfigurer interface
+type MockAuditConfigurer struct {
+	ctrl     *gomock.Controller
+	recorder *_MockAuditConfigurerRecorder
+}
+
+// Recorder for MockAuditConfigurer (not exported)
+type _MockAuditConfigurerRecorder struct {
+	mock *MockAuditConfigurer
+}
+
+func NewMockAuditConfigurer(ctrl *gomock.Controller) *MockAuditConfigurer {
+	mock := &MockAuditConfigurer{ctrl: ctrl}
+	mock.recorder = &_MockAuditConfigurerRecorder{mock}
+	return mock
+}
+
+func (_m *MockAuditConfigurer) EXPECT() *_MockAuditConfigurerRecorder {
+	return _m.recorder
+}
+
+func (_m *MockAuditConfigurer) SetAuditLog(auditLog *auditlog.Log) {
+	_m.ctrl.Call(_m, "SetAuditLog", auditLog)
+}
+
+func (_mr *_MockAuditConfigurerRecorder) SetAuditLog(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetAuditLog", arg0)
+}
+
+// Mock of ConvergenceReporter interface
+type MockConvergenceReporter struct {
+	ctrl     *gomock.Controller
+	recorder *_MockConvergenceReporterRecorder
+}
+
+// Recorder for MockConvergenceReporter (not exported)
+type _MockConvergenceReporterRecorder struct {
+	mock *MockConvergenceReporter
+}
+
+func NewMockConvergenceReporter(ctrl *gomock.Controller) *MockConvergenceReporter {
+	mock := &MockConvergenceReporter{ctrl: ctrl}
+	mock.recorder = &_MockConvergenceReporterRecorder{mock}
+	return mock
+}
+
+func (_m *MockConvergenceReporter) EXPECT() *_MockConvergenceReporterRecorder {
+	return _m.recorder
+}
+
+func (_m *MockConvergenceReporter) Convergence(revision string) *trireme.ConvergenceReport {
+	ret := _m.ctrl.Call(_m, "Convergence", revision)
+	ret0, _ := ret[0].(*trireme.ConvergenceReport)
+	return ret0
+}
+
+func (_mr *_MockConvergenceReporterRecorder) Convergence(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Convergence", arg0)
+}
+
+func (_m *MockConvergenceReporter) WaitForConvergence(revision string) <-chan *trireme.ConvergenceReport {
+	ret := _m.ctrl.Call(_m, "WaitForConvergence", revision)
+	ret0, _ := ret[0].(<-chan *trireme.ConvergenceReport)
+	return ret0
+}
+
+func (_mr *_MockConvergenceReporterRecorder) WaitForConvergence(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "WaitForConvergence", arg0)
+}
+
+// Mock of StatsFlusher interface
+type MockStatsFlusher struct {
+	ctrl     *gomock.Controller
+	recorder *_MockStatsFlusherRecorder
+}
+
+// Recorder for MockStatsFlusher (not exported)
+type _MockStatsFlusherRecorder struct {
+	mock *MockStatsFlusher
+}
+
+func NewMockStatsFlusher(ctrl *gomock.Controller) *MockStatsFlusher {
+	mock := &MockStatsFlusher{ctrl: ctrl}
+	mock.recorder = &_MockStatsFlusherRecorder{mock}
+	return mock
+}
+
+func (_m *MockStatsFlusher) EXPECT() *_MockStatsFlusherRecorder {
+	return _m.recorder
+}
+
+func (_m *MockStatsFlusher) FlushStats(contextID string) error {
+	ret := _m.ctrl.Call(_m, "FlushStats", contextID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockStatsFlusherRecorder) FlushStats(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "FlushStats", arg0)
+}
+
+// Mock of EnforcerUpdater interface
+type MockEnforcerUpdater struct {
+	ctrl     *gomock.Controller
+	recorder *_MockEnforcerUpdaterRecorder
+}
+
+// Recorder for MockEnforcerUpdater (not exported)
+type _MockEnforcerUpdaterRecorder struct {
+	mock *MockEnforcerUpdater
+}
+
+func NewMockEnforcerUpdater(ctrl *gomock.Controller) *MockEnforcerUpdater {
+	mock := &MockEnforcerUpdater{ctrl: ctrl}
+	mock.recorder = &_MockEnforcerUpdaterRecorder{mock}
+	return mock
+}
+
+func (_m *MockEnforcerUpdater) EXPECT() *_MockEnforcerUpdaterRecorder {
+	return _m.recorder
+}
+
+func (_m *MockEnforcerUpdater) UpdateRemoteEnforcers(update *trireme.EnforcerUpdate) <-chan *trireme.EnforcerUpdateReport {
+	ret := _m.ctrl.Call(_m, "UpdateRemoteEnforcers", update)
+	ret0, _ := ret[0].(<-chan *trireme.EnforcerUpdateReport)
+	return ret0
+}
+
+func (_mr *_MockEnforcerUpdaterRecorder) UpdateRemoteEnforcers(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "UpdateRemoteEnforcers", arg0)
+}
+
+// Mock of RuntimeUpdater interface
+type MockRuntimeUpdater struct {
+	ctrl     *gomock.Controller
+	recorder *_MockRuntimeUpdaterRecorder
+}
+
+// Recorder for MockRuntimeUpdater (not exported)
+type _MockRuntimeUpdaterRecorder struct {
+	mock *MockRuntimeUpdater
+}
+
+func NewMockRuntimeUpdater(ctrl *gomock.Controller) *MockRuntimeUpdater {
+	mock := &MockRuntimeUpdater{ctrl: ctrl}
+	mock.recorder = &_MockRuntimeUpdaterRecorder{mock}
+	return mock
+}
+
+func (_m *MockRuntimeUpdater) EXPECT() *_MockRuntimeUpdaterRecorder {
+	return _m.recorder
+}
+
+func (_m *MockRuntimeUpdater) UpdateRuntimeTags(contextID string, tags map[string]string) <-chan error {
+	ret := _m.ctrl.Call(_m, "UpdateRuntimeTags", contextID, tags)
+	ret0, _ := ret[0].(<-chan error)
+	return ret0
+}
+
+func (_mr *_MockRuntimeUpdaterRecorder) UpdateRuntimeTags(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "UpdateRuntimeTags", arg0, arg1)
+}
+
+// Mock of PolicyUpdater interface
+type MockPolicyUpdater struct {
+	ctrl     *gomock.Controller
+	recorder *_MockPolicyUpdaterRecorder
+}
+
+// Recorder for MockPolicyUpdater (not exported)
+type _MockPolicyUpdaterRecorder struct {
+	mock *MockPolicyUpdater
+}
+
+func NewMockPolicyUpdater(ctrl *gomock.Controller) *MockPolicyUpdater {
+	mock := &MockPolicyUpdater{ctrl: ctrl}
+	mock.recorder = &_MockPolicyUpdaterRecorder{mock}
+	return mock
+}
+
+func (_m *MockPolicyUpdater) EXPECT() *_MockPolicyUpdaterRecorder {
+	return _m.recorder
+}
+
+func (_m *MockPolicyUpdater) UpdatePolicy(contextID string, newPolicy *policy.PUPolicy) <-chan error {
+	ret := _m.ctrl.Call(_m, "UpdatePolicy", contextID, newPolicy)
 	ret0, _ := ret[0].(<-chan error)
 	return ret0
 }
 
-func (_mr *_MockProcessingUnitsHandlerRecorder) HandlePUEvent(arg0, arg1 interface{}) *gomock.Call {
+func (_mr *_MockPolicyUpdaterRecorder) UpdatePolicy(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "UpdatePolicy", arg0, arg1)
+}
+
+// Mock of PolicyResolver interface
+type MockPolicyResolver struct {
+	ctrl     *gomock.Controller
+	recorder *_MockPolicyResolverRecorder
+}
+
+// Recorder for MockPolicyResolver (not exported)
+type _MockPolicyResolverRecorder struct {
+	mock *MockPolicyResolver
+}
+
+func NewMockPolicyResolver(ctrl *gomock.Controller) *MockPolicyResolver {
+	mock := &MockPolicyResolver{ctrl: ctrl}
+	mock.recorder = &_MockPolicyResolverRecorder{mock}
+	return mock
+}
+
+func (_m *MockPolicyResolver) EXPECT() *_MockPolicyResolverRecorder {
+	return _m.recorder
+}
+
+func (_m *MockPolicyResolver) ResolvePolicy(contextID string, RuntimeReader policy.RuntimeReader) (*policy.PUPolicy, error) {
+	ret := _m.ctrl.Call(_m, "ResolvePolicy", contextID, RuntimeReader)
+	ret0, _ := ret[0].(*policy.PUPolicy)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockPolicyResolverRecorder) ResolvePolicy(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "ResolvePolicy", arg0, arg1)
+}
+
+func (_m *MockPolicyResolver) HandlePUEvent(contextID string, eventType monitor.Event) {
+	_m.ctrl.Call(_m, "HandlePUEvent", contextID, eventType)
+}
 
+func (_mr *_MockPolicyResolverRecorder) HandlePUEvent(arg0, arg1 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "HandlePUEvent", arg0, arg1)
 }
@@ -0,0 +1,107 @@
+package trireme
+
+import (
+	"sort"
+
+	"github.com/aporeto-inc/trireme/policy"
+	"github.com/aporeto-inc/trireme/utils/errortypes"
+	"github.com/aporeto-inc/trireme/utils/features"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// ModeTag is the runtime tag selecting the mode of a PU, so that the workloads can
+// be opted in to the enforcement gradually
+const ModeTag = "trireme:mode"
+
+// PUMode is a mode of a PU selected by its ModeTag
+type PUMode string
+
+const (
+	// PUModeEnforce enforces the policy of the PU with the enforcer of its type, local
+	// or remote. It is the mode of the PUs without a ModeTag.
+	PUModeEnforce PUMode = "enforce"
+
+	// PUModeObserve resolves and reports the policy of the PU, but does not enforce it
+	PUModeObserve PUMode = "observe"
+
+	// PUModeOffload enforces the policy of the PU and accepts its established flows
+	// in the eBPF fast path of the datapath
+	PUModeOffload PUMode = "offload"
+)
+
+// puModeOf returns the mode selected by the tags of a PU. The PUs with an unknown
+// mode are enforced.
+func puModeOf(contextID string, runtime *policy.PURuntime) PUMode {
+
+	tags := runtime.Tags()
+	if tags == nil {
+		return PUModeEnforce
+	}
+
+	value, ok := tags.Get(ModeTag)
+	if !ok {
+		return PUModeEnforce
+	}
+
+	switch mode := PUMode(value); mode {
+	case PUModeEnforce, PUModeObserve, PUModeOffload:
+		return mode
+	}
+
+	log.WithFields(log.Fields{
+		"package":   "trireme",
+		"contextID": contextID,
+		"mode":      value,
+	}).Warn("Unknown mode of the PU. Enforcing it.")
+
+	return PUModeEnforce
+}
+
+// modeFeatures adds the datapath features of the mode of a PU to the features of the
+// flags
+func modeFeatures(contextID string, runtime *policy.PURuntime, enabled []string) []string {
+
+	if puModeOf(contextID, runtime) != PUModeOffload {
+		return enabled
+	}
+
+	for _, feature := range enabled {
+		if feature == string(features.EBPFFastPath) {
+			return enabled
+		}
+	}
+
+	enabled = append(enabled, string(features.EBPFFastPath))
+	sort.Strings(enabled)
+
+	return enabled
+}
+
+// doObserve reports the policy of an observed PU without enforcing it. The policy
+// applied before the PU was observed is removed.
+func (t *trireme) doObserve(contextID string, containerInfo *policy.PUInfo) error {
+
+	if _, ok := t.applied[contextID]; ok {
+		puType := containerInfo.Runtime.PUType()
+
+		errS := t.supervisors[puType].Unsupervise(contextID)
+		errE := t.enforcers[puType].Unenforce(contextID)
+		if errS != nil || errE != nil {
+			t.states.applied(contextID, EnforcementFailed)
+			return errortypes.Errorf(nil, "Observation failed for contextID %s. supervisor %s, enforcer %s", contextID, errS, errE)
+		}
+
+		delete(t.applied, contextID)
+	}
+
+	log.WithFields(log.Fields{
+		"package":   "trireme",
+		"contextID": contextID,
+	}).Debug("PU in observe mode. Not policing.")
+
+	t.states.applied(contextID, EnforcementObserved)
+	t.states.summarized(contextID, containerInfo.Policy)
+
+	return nil
+}
@@ -0,0 +1,11 @@
+// +build !linux
+
+package addrwatcher
+
+import "fmt"
+
+// Watch is only supported on linux
+func Watch(pid int, stop <-chan struct{}, handler Handler) error {
+
+	return fmt.Errorf("Address watching is not supported on this platform")
+}
@@ -0,0 +1,311 @@
+// +build linux
+
+package addrwatcher
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	// receiveTimeout bounds the time to notice that the watch is stopped
+	receiveTimeout = time.Second
+
+	// Multicast groups of the address notifications
+	rtmgrpIPv4IfAddr = 0x10
+	rtmgrpIPv6IfAddr = 0x100
+)
+
+// setnsTrap is the number of the setns system call, which is not exported by the
+// syscall package. Only little endian architectures are listed since the netlink
+// messages are encoded in the host byte order.
+var setnsTrap = map[string]uintptr{
+	"386":     346,
+	"amd64":   308,
+	"arm":     375,
+	"arm64":   268,
+	"ppc64le": 350,
+}[runtime.GOARCH]
+
+// Watch subscribes to the address changes in the network namespace of the process
+// and calls the handler with the current addresses and then at every change. It
+// returns once the subscription is done and watches until stop is closed.
+func Watch(pid int, stop <-chan struct{}, handler Handler) error {
+
+	fd, err := subscribe(pid)
+	if err != nil {
+		return err
+	}
+
+	// Dump the current addresses on the same socket. The answers are processed
+	// like the notifications.
+	if err := syscall.Sendto(fd, dumpRequest(), 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		syscall.Close(fd)
+		return fmt.Errorf("Cannot request the addresses: %s", err)
+	}
+
+	go watch(fd, pid, stop, handler)
+
+	return nil
+}
+
+// subscribe opens a netlink socket bound to the address notifications in the network
+// namespace of the process. The socket remains attached to the namespace.
+func subscribe(pid int) (int, error) {
+
+	type result struct {
+		fd  int
+		err error
+	}
+
+	c := make(chan result, 1)
+
+	// The namespace of the thread is changed. The thread is dedicated to it and
+	// only released when it is back in the original namespace.
+	go func() {
+		runtime.LockOSThread()
+
+		origin, err := os.Open("/proc/self/task/" + strconv.Itoa(syscall.Gettid()) + "/ns/net")
+		if err != nil {
+			runtime.UnlockOSThread()
+			c <- result{err: err}
+			return
+		}
+		defer origin.Close()
+
+		target, err := os.Open("/proc/" + strconv.Itoa(pid) + "/ns/net")
+		if err != nil {
+			runtime.UnlockOSThread()
+			c <- result{err: err}
+			return
+		}
+		defer target.Close()
+
+		if err := setns(target.Fd()); err != nil {
+			runtime.UnlockOSThread()
+			c <- result{err: fmt.Errorf("Cannot enter the network namespace of %d: %s", pid, err)}
+			return
+		}
+
+		fd, err := openSocket()
+
+		if rerr := setns(origin.Fd()); rerr != nil {
+			log.WithFields(log.Fields{
+				"package": "addrwatcher",
+				"error":   rerr.Error(),
+			}).Error("Cannot restore the network namespace of the thread")
+		} else {
+			runtime.UnlockOSThread()
+		}
+
+		c <- result{fd: fd, err: err}
+	}()
+
+	r := <-c
+
+	return r.fd, r.err
+}
+
+// dumpRequest returns the netlink request for all the addresses of the namespace
+func dumpRequest() []byte {
+
+	request := make([]byte, syscall.NLMSG_HDRLEN+syscall.SizeofRtGenmsg)
+
+	binary.LittleEndian.PutUint32(request[0:4], uint32(len(request)))
+	binary.LittleEndian.PutUint16(request[4:6], syscall.RTM_GETADDR)
+	binary.LittleEndian.PutUint16(request[6:8], syscall.NLM_F_DUMP|syscall.NLM_F_REQUEST)
+	binary.LittleEndian.PutUint32(request[8:12], 1)
+	request[syscall.NLMSG_HDRLEN] = syscall.AF_UNSPEC
+
+	return request
+}
+
+func setns(fd uintptr) error {
+
+	if setnsTrap == 0 {
+		return fmt.Errorf("setns is not supported on %s", runtime.GOARCH)
+	}
+
+	if _, _, errno := syscall.RawSyscall(setnsTrap, fd, syscall.CLONE_NEWNET, 0); errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+func openSocket() (int, error) {
+
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return -1, fmt.Errorf("Cannot open netlink socket: %s", err)
+	}
+
+	addr := &syscall.SockaddrNetlink{
+		Family: syscall.AF_NETLINK,
+		Groups: rtmgrpIPv4IfAddr | rtmgrpIPv6IfAddr,
+	}
+
+	if err := syscall.Bind(fd, addr); err != nil {
+		syscall.Close(fd)
+		return -1, fmt.Errorf("Cannot subscribe to address changes: %s", err)
+	}
+
+	tv := syscall.NsecToTimeval(receiveTimeout.Nanoseconds())
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		syscall.Close(fd)
+		return -1, err
+	}
+
+	return fd, nil
+}
+
+func watch(fd int, pid int, stop <-chan struct{}, handler Handler) {
+
+	defer syscall.Close(fd)
+
+	set := newAddressSet()
+	buffer := make([]byte, syscall.Getpagesize()*4)
+
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		n, _, err := syscall.Recvfrom(fd, buffer, 0)
+		if err != nil {
+			if err == syscall.EAGAIN || err == syscall.EINTR {
+				continue
+			}
+
+			log.WithFields(log.Fields{
+				"package": "addrwatcher",
+				"pid":     pid,
+				"error":   err.Error(),
+			}).Error("Stopped watching the addresses")
+			return
+		}
+
+		messages, err := syscall.ParseNetlinkMessage(buffer[:n])
+		if err != nil {
+			continue
+		}
+
+		changed := false
+		for i := range messages {
+			if set.apply(&messages[i]) {
+				changed = true
+			}
+		}
+
+		if changed {
+			handler(set.addresses())
+		}
+	}
+}
+
+// addressSet tracks the global unicast addresses of a namespace from the netlink
+// messages. Addresses are indexed by interface since the same address may be
+// configured on several interfaces.
+type addressSet struct {
+	ips map[string]net.IP
+}
+
+func newAddressSet() *addressSet {
+
+	return &addressSet{
+		ips: map[string]net.IP{},
+	}
+}
+
+// apply updates the set with an address message and returns true if it changed
+func (s *addressSet) apply(m *syscall.NetlinkMessage) bool {
+
+	if m.Header.Type != syscall.RTM_NEWADDR && m.Header.Type != syscall.RTM_DELADDR {
+		return false
+	}
+
+	// The message starts with a struct ifaddrmsg
+	if len(m.Data) < syscall.SizeofIfAddrmsg {
+		return false
+	}
+
+	scope := m.Data[3]
+	index := binary.LittleEndian.Uint32(m.Data[4:8])
+	if scope != syscall.RT_SCOPE_UNIVERSE {
+		return false
+	}
+
+	attrs, err := syscall.ParseNetlinkRouteAttr(m)
+	if err != nil {
+		return false
+	}
+
+	var ip net.IP
+	for _, a := range attrs {
+		switch a.Attr.Type {
+		case syscall.IFA_LOCAL:
+			ip = append(net.IP(nil), a.Value...)
+		case syscall.IFA_ADDRESS:
+			if ip == nil {
+				ip = append(net.IP(nil), a.Value...)
+			}
+		}
+	}
+
+	if ip == nil {
+		return false
+	}
+
+	key := strconv.Itoa(int(index)) + "/" + ip.String()
+	_, exists := s.ips[key]
+
+	if m.Header.Type == syscall.RTM_DELADDR {
+		delete(s.ips, key)
+		return exists
+	}
+
+	s.ips[key] = ip
+	return !exists
+}
+
+// addresses returns the distinct addresses of the set, IPv4 first
+func (s *addressSet) addresses() []net.IP {
+
+	unique := map[string]net.IP{}
+	for _, ip := range s.ips {
+		unique[ip.String()] = ip
+	}
+
+	ips := addressList{}
+	for _, ip := range unique {
+		ips = append(ips, ip)
+	}
+	sort.Sort(ips)
+
+	return ips
+}
+
+// addressList sorts the IPv4 addresses before the IPv6 ones
+type addressList []net.IP
+
+func (l addressList) Len() int      { return len(l) }
+func (l addressList) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l addressList) Less(i, j int) bool {
+	iv4, jv4 := l[i].To4() != nil, l[j].To4() != nil
+	if iv4 != jv4 {
+		return iv4
+	}
+	return bytes.Compare(l[i], l[j]) < 0
+}
@@ -0,0 +1,85 @@
+// +build linux
+
+package addrwatcher
+
+import (
+	"encoding/binary"
+	"net"
+	"syscall"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func addressMessage(msgType uint16, index uint32, scope uint8, ip net.IP) *syscall.NetlinkMessage {
+
+	data := make([]byte, syscall.SizeofIfAddrmsg+syscall.SizeofRtAttr+len(ip))
+	data[0] = syscall.AF_INET
+	data[3] = scope
+	binary.LittleEndian.PutUint32(data[4:8], index)
+
+	attr := data[syscall.SizeofIfAddrmsg:]
+	binary.LittleEndian.PutUint16(attr[0:2], uint16(syscall.SizeofRtAttr+len(ip)))
+	binary.LittleEndian.PutUint16(attr[2:4], syscall.IFA_LOCAL)
+	copy(attr[syscall.SizeofRtAttr:], ip)
+
+	return &syscall.NetlinkMessage{
+		Header: syscall.NlMsghdr{Type: msgType},
+		Data:   data,
+	}
+}
+
+func TestAddressSet(t *testing.T) {
+
+	Convey("Given an empty address set", t, func() {
+
+		set := newAddressSet()
+
+		Convey("When an address is added", func() {
+
+			changed := set.apply(addressMessage(syscall.RTM_NEWADDR, 2, syscall.RT_SCOPE_UNIVERSE, net.ParseIP("10.1.1.2").To4()))
+
+			Convey("Then the set should change and contain the address", func() {
+				So(changed, ShouldBeTrue)
+				So(len(set.addresses()), ShouldEqual, 1)
+				So(set.addresses()[0].String(), ShouldEqual, "10.1.1.2")
+			})
+
+			Convey("Then adding it again should not change the set", func() {
+				So(set.apply(addressMessage(syscall.RTM_NEWADDR, 2, syscall.RT_SCOPE_UNIVERSE, net.ParseIP("10.1.1.2").To4())), ShouldBeFalse)
+			})
+
+			Convey("Then the address should not change when the receive buffer is reused", func() {
+				m := addressMessage(syscall.RTM_NEWADDR, 3, syscall.RT_SCOPE_UNIVERSE, net.ParseIP("10.1.1.3").To4())
+				So(set.apply(m), ShouldBeTrue)
+
+				copy(m.Data[syscall.SizeofIfAddrmsg+syscall.SizeofRtAttr:], net.ParseIP("10.9.9.9").To4())
+				So(set.ips["3/10.1.1.3"].String(), ShouldEqual, "10.1.1.3")
+			})
+
+			Convey("Then removing it should empty the set", func() {
+				So(set.apply(addressMessage(syscall.RTM_DELADDR, 2, syscall.RT_SCOPE_UNIVERSE, net.ParseIP("10.1.1.2").To4())), ShouldBeTrue)
+				So(len(set.addresses()), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When a loopback address is added", func() {
+
+			changed := set.apply(addressMessage(syscall.RTM_NEWADDR, 1, syscall.RT_SCOPE_HOST, net.ParseIP("127.0.0.1").To4()))
+
+			Convey("Then it should be ignored", func() {
+				So(changed, ShouldBeFalse)
+				So(len(set.addresses()), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When another message is received", func() {
+
+			changed := set.apply(&syscall.NetlinkMessage{Header: syscall.NlMsghdr{Type: syscall.NLMSG_DONE}})
+
+			Convey("Then it should be ignored", func() {
+				So(changed, ShouldBeFalse)
+			})
+		})
+	})
+}
@@ -0,0 +1,11 @@
+// Package addrwatcher detects the changes of the addresses of a running processing
+// unit. It subscribes to the netlink address notifications in the network namespace
+// of the processing unit, so that a DHCP renewal or an IPAM reassignment can be
+// propagated to the policy without restarting it.
+package addrwatcher
+
+import "net"
+
+// A Handler is called with the global unicast addresses of the network namespace
+// every time they change.
+type Handler func(addresses []net.IP)
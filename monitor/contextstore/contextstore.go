@@ -7,6 +7,8 @@ import (
 	"os"
 
 	log "github.com/Sirupsen/logrus"
+
+	"github.com/aporeto-inc/trireme/utils/errortypes"
 )
 
 type store struct{}
@@ -49,6 +51,9 @@ func (s *store) StoreContext(contextID string, eventInfo interface{}) error {
 		return err
 	}
 
+	// The watchers must know the eventInfo before they see it written
+	stored(contextID, data)
+
 	if err = ioutil.WriteFile(storebasePath+contextID+eventInfoFile, data, 0600); err != nil {
 		return err
 	}
@@ -65,7 +70,7 @@ func (s *store) GetContextInfo(contextID string) (interface{}, error) {
 			"package": "contextstore",
 			"Error":   err.Error(),
 		}).Debug("ContextID not known")
-		return nil, fmt.Errorf("Unknown ContextID %s", contextID)
+		return nil, errortypes.Errorf(errortypes.ErrPUNotFound, "Unknown ContextID %s", contextID)
 	}
 
 	data, err := ioutil.ReadFile(storebasePath + contextID + eventInfoFile)
@@ -88,9 +93,11 @@ func (s *store) RemoveContext(contextID string) error {
 			"package": "contextstore",
 			"Error":   err.Error(),
 		}).Debug("ContextID not known")
-		return fmt.Errorf("Unknown ContextID %s", contextID)
+		return errortypes.Errorf(errortypes.ErrPUNotFound, "Unknown ContextID %s", contextID)
 	}
 
+	removed(contextID)
+
 	return os.RemoveAll(storebasePath + contextID)
 
 }
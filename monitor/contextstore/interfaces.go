@@ -18,3 +18,23 @@ type ContextStore interface {
 	// WalkStore walks the whole store and returns a channel for the values
 	WalkStore() (chan string, error)
 }
+
+// ContextChange is a change of a context of the store made by another process
+type ContextChange struct {
+	// ContextID is the context that changed
+	ContextID string
+	// Removed is true if the context was removed from the store
+	Removed bool
+	// Data is the new eventInfo of the context, or the last one known if it was
+	// removed. It is nil for the removed contexts never seen by this process.
+	Data []byte
+}
+
+// ContextWatcher is implemented by the stores notifying the changes made to them
+// outside of the store, like the contexts dropped or removed by an operator tool
+type ContextWatcher interface {
+
+	// WatchStore returns a channel of the changes of the store, closed when stop is
+	// closed
+	WatchStore(stop <-chan struct{}) (<-chan *ContextChange, error)
+}
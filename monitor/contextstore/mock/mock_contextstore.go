@@ -4,6 +4,7 @@
 package mock_contextstore
 
 import (
+	contextstore "github.com/aporeto-inc/trireme/monitor/contextstore"
 	gomock "github.com/golang/mock/gomock"
 )
 
@@ -79,3 +80,35 @@ func (_m *MockContextStore) WalkStore() (chan string, error) {
 func (_mr *_MockContextStoreRecorder) WalkStore() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "WalkStore")
 }
+
+// Mock of ContextWatcher interface
+type MockContextWatcher struct {
+	ctrl     *gomock.Controller
+	recorder *_MockContextWatcherRecorder
+}
+
+// Recorder for MockContextWatcher (not exported)
+type _MockContextWatcherRecorder struct {
+	mock *MockContextWatcher
+}
+
+func NewMockContextWatcher(ctrl *gomock.Controller) *MockContextWatcher {
+	mock := &MockContextWatcher{ctrl: ctrl}
+	mock.recorder = &_MockContextWatcherRecorder{mock}
+	return mock
+}
+
+func (_m *MockContextWatcher) EXPECT() *_MockContextWatcherRecorder {
+	return _m.recorder
+}
+
+func (_m *MockContextWatcher) WatchStore(stop <-chan struct{}) (<-chan *contextstore.ContextChange, error) {
+	ret := _m.ctrl.Call(_m, "WatchStore", stop)
+	ret0, _ := ret[0].(<-chan *contextstore.ContextChange)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockContextWatcherRecorder) WatchStore(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "WatchStore", arg0)
+}
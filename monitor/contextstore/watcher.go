@@ -0,0 +1,109 @@
+package contextstore
+
+import (
+	"bytes"
+	"sync"
+)
+
+// known is the last eventInfo of the contexts, written through the store or seen by
+// the watchers. The watchers only notify the changes that do not match it, so that
+// the changes made through the store are not notified back. A context removed
+// through the store is known with a nil eventInfo until its watcher sees it removed.
+// The contexts are only tracked while the store is watched.
+var known = struct {
+	contexts map[string][]byte
+	watchers int
+	sync.Mutex
+}{contexts: map[string][]byte{}}
+
+// startWatching starts tracking the contexts for a new watcher
+func startWatching() {
+
+	known.Lock()
+	defer known.Unlock()
+
+	known.watchers++
+}
+
+// stopWatching stops tracking the contexts once the last watcher is stopped
+func stopWatching() {
+
+	known.Lock()
+	defer known.Unlock()
+
+	known.watchers--
+	if known.watchers == 0 {
+		known.contexts = map[string][]byte{}
+	}
+}
+
+// stored records the eventInfo written through the store
+func stored(contextID string, data []byte) {
+
+	known.Lock()
+	defer known.Unlock()
+
+	if known.watchers > 0 {
+		known.contexts[contextID] = data
+	}
+}
+
+// removed records a context removed through the store
+func removed(contextID string) {
+
+	known.Lock()
+	defer known.Unlock()
+
+	if known.watchers > 0 {
+		known.contexts[contextID] = nil
+	}
+}
+
+// changed returns true if the eventInfo seen by a watcher is not the one known, and
+// records it
+func changed(contextID string, data []byte) bool {
+
+	known.Lock()
+	defer known.Unlock()
+
+	if previous, ok := known.contexts[contextID]; ok && bytes.Equal(previous, data) {
+		return false
+	}
+
+	known.contexts[contextID] = data
+
+	return true
+}
+
+// disappeared forgets a context a watcher has seen removed. It returns the last
+// eventInfo known of the context and true if it was not removed through the store.
+func disappeared(contextID string) ([]byte, bool) {
+
+	known.Lock()
+	defer known.Unlock()
+
+	data, ok := known.contexts[contextID]
+	delete(known.contexts, contextID)
+
+	if ok && data == nil {
+		return nil, false
+	}
+
+	return data, true
+}
+
+// knownContexts returns the contexts known to be in the store
+func knownContexts() []string {
+
+	known.Lock()
+	defer known.Unlock()
+
+	contexts := []string{}
+	for contextID, data := range known.contexts {
+		if data != nil {
+			contexts = append(contexts, contextID)
+		}
+	}
+
+	return contexts
+}
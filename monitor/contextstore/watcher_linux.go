@@ -0,0 +1,287 @@
+// +build linux
+
+package contextstore
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	// storeEvents are the events of the base directory of the store: the contexts
+	// added and removed
+	storeEvents = syscall.IN_CREATE | syscall.IN_MOVED_TO | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_ONLYDIR
+
+	// contextEvents are the events of the directory of a context: its eventInfo
+	// written in place or renamed over
+	contextEvents = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_ONLYDIR
+
+	// watchBufferSize is the size of the buffer of the inotify events
+	watchBufferSize = 64 * (syscall.SizeofInotifyEvent + syscall.NAME_MAX + 1)
+)
+
+// inotifyWatcher watches the contexts at the top of the store with inotify
+type inotifyWatcher struct {
+	fd       int
+	base     string
+	wd       int32
+	contexts map[int32]string
+	changes  chan *ContextChange
+	stop     <-chan struct{}
+	done     chan struct{}
+	stopped  chan struct{}
+}
+
+// WatchStore watches the store with inotify. The changes are notified once the
+// eventInfo of a context is written, and once the directory of a context is removed.
+func (s *store) WatchStore(stop <-chan struct{}) (<-chan *ContextChange, error) {
+
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to watch the store: %s", err)
+	}
+
+	wd, err := syscall.InotifyAddWatch(fd, storebasePath, storeEvents)
+	if err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("Unable to watch the store %s: %s", storebasePath, err)
+	}
+
+	w := &inotifyWatcher{
+		fd:       fd,
+		base:     storebasePath,
+		wd:       int32(wd),
+		contexts: map[int32]string{},
+		changes:  make(chan *ContextChange),
+		stop:     stop,
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+
+	startWatching()
+
+	// The contexts already in the store are not changes
+	w.rescan()
+
+	go w.run()
+
+	// Removing the watch of the store wakes up the reads
+	go func() {
+		defer close(w.stopped)
+		select {
+		case <-stop:
+			syscall.InotifyRmWatch(fd, uint32(wd))
+		case <-w.done:
+		}
+	}()
+
+	return w.changes, nil
+}
+
+// run reads the events until the watcher is stopped or the store is removed
+func (w *inotifyWatcher) run() {
+
+	defer func() {
+		close(w.done)
+		<-w.stopped
+		syscall.Close(w.fd)
+		stopWatching()
+		close(w.changes)
+	}()
+
+	buffer := make([]byte, watchBufferSize)
+
+	for {
+		n, err := syscall.Read(w.fd, buffer)
+		if err == syscall.EINTR {
+			continue
+		}
+
+		if err != nil || n <= 0 {
+			log.WithFields(log.Fields{
+				"package": "contextstore",
+				"error":   fmt.Sprintf("%v", err),
+			}).Error("Unable to read the events of the store")
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buffer[offset]))
+			start := offset + syscall.SizeofInotifyEvent
+			offset = start + int(event.Len)
+
+			name := strings.TrimRight(string(buffer[start:offset]), "\x00")
+
+			changes, ok := w.handle(event.Wd, event.Mask, name)
+			if !ok {
+				return
+			}
+
+			for _, change := range changes {
+				select {
+				case w.changes <- change:
+				case <-w.stop:
+					return
+				}
+			}
+		}
+
+		select {
+		case <-w.stop:
+			return
+		default:
+		}
+	}
+}
+
+// handle returns the changes of an event, and false once the store is not watched
+func (w *inotifyWatcher) handle(wd int32, mask uint32, name string) ([]*ContextChange, bool) {
+
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		log.WithFields(log.Fields{
+			"package": "contextstore",
+			"store":   w.base,
+		}).Warn("Events of the store lost, rescanning the store")
+		return w.rescan(), true
+	}
+
+	if wd == w.wd {
+		if mask&syscall.IN_IGNORED != 0 {
+			log.WithFields(log.Fields{
+				"package": "contextstore",
+				"store":   w.base,
+			}).Info("Store not watched anymore")
+			return nil, false
+		}
+
+		if mask&syscall.IN_ISDIR == 0 {
+			return nil, true
+		}
+
+		if mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+			return w.addContext(name), true
+		}
+
+		return w.removeContext(name), true
+	}
+
+	context, ok := w.contexts[wd]
+	if !ok {
+		return nil, true
+	}
+
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(w.contexts, wd)
+		return nil, true
+	}
+
+	if name != strings.TrimPrefix(eventInfoFile, "/") {
+		return nil, true
+	}
+
+	return w.read(context), true
+}
+
+// addContext watches the directory of a new context and returns its eventInfo if
+// it was already written
+func (w *inotifyWatcher) addContext(name string) []*ContextChange {
+
+	wd, err := syscall.InotifyAddWatch(w.fd, filepath.Join(w.base, name), contextEvents)
+	if err != nil {
+		return nil
+	}
+
+	w.contexts[int32(wd)] = name
+
+	return w.read(name)
+}
+
+// removeContext returns the removal of a context, unless it was removed through
+// the store
+func (w *inotifyWatcher) removeContext(name string) []*ContextChange {
+
+	for wd, context := range w.contexts {
+		if context == name {
+			// The watch of a directory moved out of the store remains
+			syscall.InotifyRmWatch(w.fd, uint32(wd))
+			delete(w.contexts, wd)
+		}
+	}
+
+	contextID := "/" + name
+
+	data, ok := disappeared(contextID)
+	if !ok {
+		return nil
+	}
+
+	return []*ContextChange{{ContextID: contextID, Removed: true, Data: data}}
+}
+
+// read returns the eventInfo of a context if it changed
+func (w *inotifyWatcher) read(name string) []*ContextChange {
+
+	// The eventInfo is empty until it is written
+	data, err := ioutil.ReadFile(w.base + "/" + name + eventInfoFile)
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+
+	contextID := "/" + name
+
+	if !changed(contextID, data) {
+		return nil
+	}
+
+	return []*ContextChange{{ContextID: contextID, Data: data}}
+}
+
+// rescan watches all the contexts of the store and returns the changes that were
+// not notified
+func (w *inotifyWatcher) rescan() []*ContextChange {
+
+	changes := []*ContextChange{}
+
+	files, err := ioutil.ReadDir(w.base)
+	if err != nil {
+		return changes
+	}
+
+	present := map[string]bool{}
+	for _, file := range files {
+		if !file.IsDir() {
+			continue
+		}
+
+		present["/"+file.Name()] = true
+
+		watched := false
+		for _, context := range w.contexts {
+			if context == file.Name() {
+				watched = true
+				break
+			}
+		}
+
+		if watched {
+			changes = append(changes, w.read(file.Name())...)
+			continue
+		}
+
+		changes = append(changes, w.addContext(file.Name())...)
+	}
+
+	for _, contextID := range knownContexts() {
+		if !present[contextID] {
+			changes = append(changes, w.removeContext(strings.TrimPrefix(contextID, "/"))...)
+		}
+	}
+
+	return changes
+}
@@ -0,0 +1,90 @@
+// +build linux
+
+package contextstore
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// nextChange returns the next change of the store, or nil if there is none
+func nextChange(changes <-chan *ContextChange, timeout time.Duration) *ContextChange {
+
+	select {
+	case change := <-changes:
+		return change
+	case <-time.After(timeout):
+		return nil
+	}
+}
+
+// writeContext writes the eventInfo of a context like another process
+func writeContext(t *testing.T, contextID string, data string) {
+
+	if err := os.MkdirAll(storebasePath+contextID, 0700); err != nil {
+		t.Fatalf("Unable to create the context: %s", err)
+	}
+
+	if err := ioutil.WriteFile(storebasePath+contextID+eventInfoFile, []byte(data), 0600); err != nil {
+		t.Fatalf("Unable to write the context: %s", err)
+	}
+}
+
+func TestWatchStore(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "contextstore")
+	if err != nil {
+		t.Fatalf("Unable to create the store: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	setStoreBasePath(dir)
+	cstore := NewContextStore()
+	cstore.StoreContext("/existing", &testdatastruct{data: 10})
+
+	stop := make(chan struct{})
+	changes, err := cstore.(ContextWatcher).WatchStore(stop)
+	if err != nil {
+		t.Fatalf("Unable to watch the store: %s", err)
+	}
+
+	cstore.StoreContext("/local", map[string]string{"PUID": "/local"})
+	if change := nextChange(changes, 200*time.Millisecond); change != nil {
+		t.Errorf("Context stored through the store notified: %v", change)
+	}
+
+	writeContext(t, "/external", `{"PUID":"/external"}`)
+	change := nextChange(changes, 2*time.Second)
+	if change == nil || change.ContextID != "/external" || change.Removed || string(change.Data) != `{"PUID":"/external"}` {
+		t.Fatalf("Context added by another process not notified: %v", change)
+	}
+
+	writeContext(t, "/existing", `{"PUID":"/existing"}`)
+	change = nextChange(changes, 2*time.Second)
+	if change == nil || change.ContextID != "/existing" || string(change.Data) != `{"PUID":"/existing"}` {
+		t.Fatalf("Context modified by another process not notified: %v", change)
+	}
+
+	os.RemoveAll(storebasePath + "/external")
+	change = nextChange(changes, 2*time.Second)
+	if change == nil || change.ContextID != "/external" || !change.Removed || string(change.Data) != `{"PUID":"/external"}` {
+		t.Fatalf("Context removed by another process not notified: %v", change)
+	}
+
+	cstore.RemoveContext("/local")
+	if change := nextChange(changes, 200*time.Millisecond); change != nil {
+		t.Errorf("Context removed through the store notified: %v", change)
+	}
+
+	close(stop)
+	select {
+	case _, ok := <-changes:
+		if ok {
+			t.Errorf("Change notified after the watcher was stopped")
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("Changes not closed once the watcher was stopped")
+	}
+}
@@ -0,0 +1,11 @@
+// +build !linux
+
+package contextstore
+
+import "fmt"
+
+// WatchStore is not supported on this platform
+func (s *store) WatchStore(stop <-chan struct{}) (<-chan *ContextChange, error) {
+
+	return nil, fmt.Errorf("Store watcher not supported on this platform")
+}
@@ -0,0 +1,422 @@
+package crimonitor
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/monitor"
+	"github.com/aporeto-inc/trireme/policy"
+	"github.com/aporeto-inc/trireme/utils/errortypes"
+)
+
+const (
+	// DefaultPollInterval is the default interval between two listings of the
+	// containers of a runtime without events
+	DefaultPollInterval = 2 * time.Second
+
+	// DefaultResyncInterval is the interval between two listings of the containers
+	// of a runtime whose events are streamed, in case an event was missed
+	DefaultResyncInterval = time.Minute
+)
+
+// A CRIMetadataExtractor is a function used to extract a *policy.PURuntime from a
+// given container of the CRI runtime.
+type CRIMetadataExtractor func(*CRIContainer) (*policy.PURuntime, error)
+
+func contextIDFromContainerID(containerID string) (string, error) {
+
+	if containerID == "" {
+		return "", fmt.Errorf("Empty container ID String")
+	}
+
+	if len(containerID) < 12 {
+		return "", fmt.Errorf("container ID smaller than 12 characters")
+	}
+
+	return containerID[:12], nil
+}
+
+func defaultCRIMetadataExtractor(container *CRIContainer) (*policy.PURuntime, error) {
+
+	tags := policy.NewTagsMap(map[string]string{
+		"image": container.Image,
+		"name":  container.Name,
+	})
+
+	if container.PodName != "" {
+		tags.Add("pod", container.PodName)
+		tags.Add("namespace", container.PodNamespace)
+	}
+
+	for k, v := range container.Labels {
+		tags.Add(k, v)
+	}
+
+	return policy.NewPURuntime(container.Name, container.Pid, tags, criAddresses(container), constants.ContainerPU, nil), nil
+}
+
+// criAddresses returns all the addresses of the pod of a container. The first IPv6
+// address after an IPv4 default address is the one of DefaultIPv6Namespace, and the
+// other ones are named after their position.
+func criAddresses(container *CRIContainer) *policy.IPMap {
+
+	ipa := policy.NewIPMap(map[string]string{
+		policy.DefaultNamespace: container.IPAddress,
+	})
+
+	for index, ip := range container.AdditionalIPAddresses {
+		name := fmt.Sprintf("%s-%d", policy.DefaultNamespace, index+1)
+
+		_, taken := ipa.Get(policy.DefaultIPv6Namespace)
+		if !taken && policy.FamilyOf(ip) == policy.IPv6 && policy.FamilyOf(container.IPAddress) == policy.IPv4 {
+			name = policy.DefaultIPv6Namespace
+		}
+
+		ipa.Add(name, ip)
+	}
+
+	return ipa
+}
+
+// criMonitor monitors the containers of a CRI runtime, like containerd, without
+// the docker daemon. The containers are listed when the runtime streams an event
+// of a container, and the changes of their states generate the same events as the
+// ones of the docker monitor. The containers are listed periodically while the
+// events cannot be streamed.
+type criMonitor struct {
+	runtime           criRuntime
+	metadataExtractor CRIMetadataExtractor
+	interval          time.Duration
+	syncAtStart       bool
+	syncHandler       monitor.SynchronizationHandler
+
+	collector collector.EventCollector
+	puHandler monitor.ProcessingUnitsHandler
+
+	// containers are the containers of the last listing, by ID
+	containers map[string]*CRIContainer
+	stop       chan bool
+}
+
+// NewCRIMonitor returns a monitor of the containers of the CRI runtime of the
+// endpoint, like DefaultCRIEndpoint for containerd. The containers are listed on
+// the events of containerd, or every interval while they cannot be streamed.
+func NewCRIMonitor(
+	endpoint string,
+	interval time.Duration,
+	p monitor.ProcessingUnitsHandler,
+	m CRIMetadataExtractor,
+	l collector.EventCollector,
+	syncAtStart bool,
+	s monitor.SynchronizationHandler,
+) monitor.Monitor {
+
+	return newCRIMonitor(&criCLI{endpoint: endpoint}, interval, p, m, l, syncAtStart, s)
+}
+
+func newCRIMonitor(
+	runtime criRuntime,
+	interval time.Duration,
+	p monitor.ProcessingUnitsHandler,
+	m CRIMetadataExtractor,
+	l collector.EventCollector,
+	syncAtStart bool,
+	s monitor.SynchronizationHandler,
+) *criMonitor {
+
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	return &criMonitor{
+		runtime:           runtime,
+		metadataExtractor: m,
+		interval:          interval,
+		syncAtStart:       syncAtStart,
+		syncHandler:       s,
+		collector:         l,
+		puHandler:         p,
+		containers:        map[string]*CRIContainer{},
+		stop:              make(chan bool),
+	}
+}
+
+// Start will start the CRI policy enforcement. It applies a policy to each
+// container already running if the monitor syncs at start, and follows the
+// changes of the containers.
+func (c *criMonitor) Start() error {
+
+	log.WithFields(log.Fields{
+		"package": "monitor",
+	}).Debug("Starting the CRI monitor")
+
+	containers, err := c.runtime.Containers()
+	if err != nil {
+		return fmt.Errorf("Unable to reach the CRI runtime: %s", err)
+	}
+
+	if c.syncAtStart {
+		c.syncContainers(containers)
+	} else {
+		for _, container := range containers {
+			c.containers[container.ID] = container
+		}
+	}
+
+	go c.poller()
+
+	return nil
+}
+
+// Stop monitoring the CRI runtime.
+func (c *criMonitor) Stop() error {
+
+	log.WithFields(log.Fields{
+		"package": "monitor",
+	}).Debug("Stopping the CRI monitor")
+
+	c.stop <- true
+
+	return nil
+}
+
+// poller lists the containers of the runtime on its events until the monitor
+// stops. The containers are listed every interval while the events cannot be
+// streamed, and every DefaultResyncInterval otherwise.
+func (c *criMonitor) poller() {
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	cancel := make(chan bool)
+	defer close(cancel)
+
+	events := c.subscribe(cancel)
+	last := time.Now()
+
+	for {
+		select {
+		case <-ticker.C:
+			if events == nil {
+				events = c.subscribe(cancel)
+			} else if time.Since(last) < DefaultResyncInterval {
+				continue
+			}
+		case _, ok := <-events:
+			if !ok {
+				log.WithFields(log.Fields{
+					"package": "monitor",
+				}).Warn("Lost the events of the CRI runtime, listing the containers periodically")
+				events = nil
+			}
+		case <-c.stop:
+			return
+		}
+
+		last = time.Now()
+		if err := c.poll(); err != nil {
+			log.WithFields(log.Fields{
+				"package": "monitor",
+				"error":   err.Error(),
+			}).Debug("Failed to list the containers of the CRI runtime")
+		}
+	}
+}
+
+// subscribe returns the stream of the events of the runtime, or nil if the runtime
+// cannot stream them
+func (c *criMonitor) subscribe(cancel <-chan bool) <-chan string {
+
+	source, ok := c.runtime.(criEventSource)
+	if !ok {
+		return nil
+	}
+
+	events, err := source.Events(cancel)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"package": "monitor",
+			"error":   err.Error(),
+		}).Debug("Failed to subscribe to the events of the CRI runtime")
+		return nil
+	}
+
+	return events
+}
+
+// poll lists the containers of the runtime and generates the events of the changes
+// since the previous listing
+func (c *criMonitor) poll() error {
+
+	containers, err := c.runtime.Containers()
+	if err != nil {
+		return err
+	}
+
+	seen := map[string]bool{}
+
+	for _, container := range containers {
+		seen[container.ID] = true
+
+		previous, known := c.containers[container.ID]
+		c.containers[container.ID] = container
+
+		if !known {
+			c.handleEvent(container.ID, monitor.EventCreate)
+		}
+
+		wasRunning := known && previous.State == ContainerRunning
+
+		switch {
+		case container.State == ContainerRunning && !wasRunning:
+			c.logError(container.ID, monitor.EventStart, c.startContainer(container))
+		case container.State != ContainerRunning && wasRunning:
+			c.handleEvent(container.ID, monitor.EventStop)
+		}
+	}
+
+	for id, container := range c.containers {
+		if seen[id] {
+			continue
+		}
+
+		if container.State == ContainerRunning {
+			c.handleEvent(id, monitor.EventStop)
+		}
+		c.handleEvent(id, monitor.EventDestroy)
+
+		delete(c.containers, id)
+	}
+
+	return nil
+}
+
+// syncContainers resyncs all the existing containers of the runtime, using the
+// same process as when a container is initially spawn up
+func (c *criMonitor) syncContainers(containers []*CRIContainer) {
+
+	log.WithFields(log.Fields{
+		"package": "monitor",
+	}).Debug("Syncing all existing containers")
+
+	if c.syncHandler != nil {
+		for _, container := range containers {
+			if err := c.runtime.Inspect(container); err != nil {
+				log.WithFields(log.Fields{
+					"package": "monitor",
+					"error":   err.Error(),
+				}).Error("Error Syncing existing Container")
+				continue
+			}
+
+			contextID, err := contextIDFromContainerID(container.ID)
+			if err != nil {
+				continue
+			}
+
+			runtimeInfo, _ := c.extractMetadata(container)
+
+			state := monitor.StateStopped
+			if container.State == ContainerRunning {
+				state = monitor.StateStarted
+			}
+
+			c.syncHandler.HandleSynchronization(contextID, state, runtimeInfo, monitor.SynchronizationTypeInitial)
+		}
+
+		c.syncHandler.HandleSynchronizationComplete(monitor.SynchronizationTypeInitial)
+	}
+
+	for _, container := range containers {
+		c.containers[container.ID] = container
+
+		if container.State != ContainerRunning {
+			continue
+		}
+
+		if err := c.startContainer(container); err != nil {
+			log.WithFields(log.Fields{
+				"package": "monitor",
+				"error":   err.Error(),
+			}).Error("Error Syncing existing Container")
+		}
+	}
+}
+
+// startContainer sends the runtime of a running container and its start event.
+// The container is stopped if its policy cannot be set.
+func (c *criMonitor) startContainer(container *CRIContainer) error {
+
+	contextID, err := contextIDFromContainerID(container.ID)
+	if err != nil {
+		return fmt.Errorf("Couldn't generate ContextID: %s", err)
+	}
+
+	if err := c.runtime.Inspect(container); err != nil {
+		// If we see errors, we will kill the container for security reasons.
+		c.runtime.Stop(container.ID)
+
+		c.collector.CollectContainerEvent(&collector.ContainerRecord{
+			ContextID: contextID,
+			IPAddress: "N/A",
+			Tags:      nil,
+			Event:     collector.ContainerFailed,
+		})
+
+		return fmt.Errorf("Cannot read container information. Killing container. ")
+	}
+
+	runtimeInfo, err := c.extractMetadata(container)
+	if err != nil {
+		return fmt.Errorf("Error getting some of the CRI primitives: %s", err)
+	}
+
+	c.puHandler.SetPURuntime(contextID, runtimeInfo)
+
+	if err := <-c.puHandler.HandlePUEvent(contextID, monitor.EventStart); err != nil {
+		c.runtime.Stop(container.ID)
+		return errortypes.Wrapf(nil, err, "Policy cound't be set - container was killed")
+	}
+
+	return nil
+}
+
+// handleEvent sends the event of the container upstream
+func (c *criMonitor) handleEvent(containerID string, event monitor.Event) {
+
+	contextID, err := contextIDFromContainerID(containerID)
+	if err != nil {
+		c.logError(containerID, event, fmt.Errorf("Error Generating ContextID: %s", err))
+		return
+	}
+
+	c.logError(containerID, event, <-c.puHandler.HandlePUEvent(contextID, event))
+}
+
+// logError logs the error of the handling of an event
+func (c *criMonitor) logError(containerID string, event monitor.Event, err error) {
+
+	if err == nil {
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"package":     "monitor",
+		"containerID": containerID,
+		"event":       event,
+		"error":       err.Error(),
+	}).Error("Error while handling event")
+}
+
+// extractMetadata generates the RuntimeInfo based on the CRI primitives
+func (c *criMonitor) extractMetadata(container *CRIContainer) (*policy.PURuntime, error) {
+
+	if c.metadataExtractor != nil {
+		return c.metadataExtractor(container)
+	}
+
+	return defaultCRIMetadataExtractor(container)
+}
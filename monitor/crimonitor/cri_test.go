@@ -0,0 +1,300 @@
+package crimonitor
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/monitor"
+	"github.com/aporeto-inc/trireme/policy"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// testRuntime is a fake CRI runtime
+type testRuntime struct {
+	containers []*CRIContainer
+	stopped    []string
+	failures   map[string]bool
+}
+
+func (r *testRuntime) Containers() ([]*CRIContainer, error) {
+
+	containers := []*CRIContainer{}
+	for _, c := range r.containers {
+		copied := *c
+		containers = append(containers, &copied)
+	}
+
+	return containers, nil
+}
+
+func (r *testRuntime) Inspect(container *CRIContainer) error {
+
+	if r.failures[container.ID] {
+		return fmt.Errorf("inspect failed")
+	}
+
+	container.Pid = 100
+	container.IPAddress = "10.1.0.2"
+	container.PodName = "frontend"
+	container.PodNamespace = "default"
+
+	return nil
+}
+
+func (r *testRuntime) Stop(id string) error {
+
+	r.stopped = append(r.stopped, id)
+
+	return nil
+}
+
+// testEventRuntime is a fake CRI runtime streaming its events
+type testEventRuntime struct {
+	testRuntime
+	events        chan string
+	subscriptions chan (<-chan bool)
+}
+
+func (r *testEventRuntime) Events(cancel <-chan bool) (<-chan string, error) {
+
+	select {
+	case r.subscriptions <- cancel:
+	default:
+	}
+
+	return r.events, nil
+}
+
+// testHandler records the events of the PUs
+type testHandler struct {
+	events   []string
+	runtimes map[string]*policy.PURuntime
+	err      error
+}
+
+func (h *testHandler) SetPURuntime(contextID string, runtimeInfo *policy.PURuntime) error {
+
+	h.runtimes[contextID] = runtimeInfo
+
+	return nil
+}
+
+func (h *testHandler) HandlePUEvent(contextID string, event monitor.Event) <-chan error {
+
+	h.events = append(h.events, contextID+" "+string(event))
+
+	c := make(chan error, 1)
+	if event == monitor.EventStart {
+		c <- h.err
+	} else {
+		c <- nil
+	}
+
+	return c
+}
+
+func TestCRIMonitor(t *testing.T) {
+
+	Convey("Given a CRI monitor", t, func() {
+
+		runtime := &testRuntime{
+			containers: []*CRIContainer{
+				&CRIContainer{ID: "aaaaaaaaaaaaaaaa", SandboxID: "pod", Name: "nginx", Image: "nginx:1.13", State: ContainerRunning},
+			},
+			failures: map[string]bool{},
+		}
+		handler := &testHandler{runtimes: map[string]*policy.PURuntime{}}
+
+		c := newCRIMonitor(runtime, 0, handler, nil, &collector.DefaultCollector{}, false, nil)
+
+		Convey("The existing containers should be ignored without the sync at start", func() {
+			So(c.Start(), ShouldBeNil)
+			So(c.interval, ShouldEqual, DefaultPollInterval)
+			So(c.Stop(), ShouldBeNil)
+
+			So(c.poll(), ShouldBeNil)
+			So(handler.events, ShouldBeEmpty)
+		})
+
+		Convey("When a container is created and started", func() {
+			runtime.containers = append(runtime.containers, &CRIContainer{ID: "bbbbbbbbbbbbbbbb", Name: "redis", Image: "redis", State: ContainerCreated})
+			c.containers["aaaaaaaaaaaaaaaa"] = runtime.containers[0]
+
+			So(c.poll(), ShouldBeNil)
+			So(handler.events, ShouldResemble, []string{"bbbbbbbbbbbb create"})
+
+			runtime.containers[1].State = ContainerRunning
+			So(c.poll(), ShouldBeNil)
+
+			Convey("Then its runtime should be set before its start event", func() {
+				So(handler.events, ShouldResemble, []string{"bbbbbbbbbbbb create", "bbbbbbbbbbbb start"})
+
+				r := handler.runtimes["bbbbbbbbbbbb"]
+				So(r, ShouldNotBeNil)
+				So(r.Pid(), ShouldEqual, 100)
+				ip, _ := r.IPAddresses().Get("bridge")
+				So(ip, ShouldEqual, "10.1.0.2")
+				pod, _ := r.Tag("pod")
+				So(pod, ShouldEqual, "frontend")
+			})
+
+			Convey("Then it should be stopped and destroyed when it exits and is removed", func() {
+				runtime.containers[1].State = ContainerExited
+				So(c.poll(), ShouldBeNil)
+
+				runtime.containers = runtime.containers[:1]
+				So(c.poll(), ShouldBeNil)
+
+				So(handler.events[2:], ShouldResemble, []string{"bbbbbbbbbbbb stop", "bbbbbbbbbbbb destroy"})
+				So(c.containers, ShouldNotContainKey, "bbbbbbbbbbbbbbbb")
+			})
+		})
+
+		Convey("When a running container is removed", func() {
+			c.containers["aaaaaaaaaaaaaaaa"] = runtime.containers[0]
+			runtime.containers = nil
+
+			So(c.poll(), ShouldBeNil)
+
+			Convey("Then it should be stopped and destroyed", func() {
+				So(handler.events, ShouldResemble, []string{"aaaaaaaaaaaa stop", "aaaaaaaaaaaa destroy"})
+			})
+		})
+
+		Convey("When the policy of a started container cannot be set", func() {
+			handler.err = fmt.Errorf("no policy")
+			c.syncAtStart = true
+
+			So(c.Start(), ShouldBeNil)
+			So(c.Stop(), ShouldBeNil)
+
+			Convey("Then the container should be stopped", func() {
+				So(handler.events, ShouldResemble, []string{"aaaaaaaaaaaa start"})
+				So(runtime.stopped, ShouldResemble, []string{"aaaaaaaaaaaaaaaa"})
+			})
+		})
+
+		Convey("When a started container cannot be inspected", func() {
+			runtime.failures["aaaaaaaaaaaaaaaa"] = true
+
+			So(c.poll(), ShouldBeNil)
+
+			Convey("Then the container should be stopped without start event", func() {
+				So(handler.events, ShouldResemble, []string{"aaaaaaaaaaaa create"})
+				So(runtime.stopped, ShouldResemble, []string{"aaaaaaaaaaaaaaaa"})
+			})
+		})
+	})
+}
+
+func TestCRIMonitorEvents(t *testing.T) {
+
+	Convey("Given a CRI monitor of a runtime streaming its events", t, func() {
+
+		runtime := &testEventRuntime{
+			testRuntime:   testRuntime{failures: map[string]bool{}},
+			events:        make(chan string),
+			subscriptions: make(chan (<-chan bool), 10),
+		}
+		handler := &testHandler{runtimes: map[string]*policy.PURuntime{}}
+
+		c := newCRIMonitor(runtime, 10*time.Millisecond, handler, nil, &collector.DefaultCollector{}, false, nil)
+		So(c.Start(), ShouldBeNil)
+
+		cancel := <-runtime.subscriptions
+
+		Convey("When a container is created", func() {
+			runtime.containers = []*CRIContainer{
+				&CRIContainer{ID: "bbbbbbbbbbbbbbbb", Name: "redis", Image: "redis", State: ContainerCreated},
+			}
+			runtime.events <- "/containers/create"
+			So(c.Stop(), ShouldBeNil)
+
+			Convey("Then the containers should be listed on its event", func() {
+				So(handler.events, ShouldResemble, []string{"bbbbbbbbbbbb create"})
+			})
+
+			Convey("Then the stream should be cancelled", func() {
+				_, ok := <-cancel
+				So(ok, ShouldBeFalse)
+			})
+		})
+
+		Convey("When the stream ends", func() {
+			runtime.containers = []*CRIContainer{
+				&CRIContainer{ID: "bbbbbbbbbbbbbbbb", Name: "redis", Image: "redis", State: ContainerCreated},
+			}
+			close(runtime.events)
+			<-runtime.subscriptions
+			So(c.Stop(), ShouldBeNil)
+
+			Convey("Then the containers should be listed and the events resubscribed", func() {
+				So(handler.events, ShouldResemble, []string{"bbbbbbbbbbbb create"})
+			})
+		})
+	})
+}
+
+func TestParseEventTopic(t *testing.T) {
+
+	Convey("The topics of the containers and their tasks should be parsed", t, func() {
+		So(parseEventTopic("2017-11-05 10:12:31.125 +0000 UTC k8s.io /tasks/start {\"container_id\":\"aaaa\",\"pid\":100}"), ShouldEqual, "/tasks/start")
+		So(parseEventTopic("2017-11-05 10:12:31.125 +0000 UTC k8s.io /containers/delete {\"id\":\"aaaa\"}"), ShouldEqual, "/containers/delete")
+		So(parseEventTopic("2017-11-05 10:12:31.125 +0000 UTC k8s.io /images/update {\"name\":\"redis\"}"), ShouldEqual, "")
+	})
+}
+
+func TestParseCRI(t *testing.T) {
+
+	Convey("Given the outputs of crictl", t, func() {
+
+		Convey("The containers should be parsed", func() {
+			containers, err := parseCRIContainers([]byte(`{"containers":[{"id":"aaaaaaaaaaaaaaaa","podSandboxId":"pod1","metadata":{"name":"nginx","attempt":0},"image":{"image":"nginx:1.13"},"state":"CONTAINER_RUNNING","labels":{"app":"web"}}]}`))
+			So(err, ShouldBeNil)
+			So(len(containers), ShouldEqual, 1)
+			So(containers[0].ID, ShouldEqual, "aaaaaaaaaaaaaaaa")
+			So(containers[0].SandboxID, ShouldEqual, "pod1")
+			So(containers[0].Name, ShouldEqual, "nginx")
+			So(containers[0].Image, ShouldEqual, "nginx:1.13")
+			So(containers[0].State, ShouldEqual, ContainerRunning)
+			So(containers[0].Labels["app"], ShouldEqual, "web")
+		})
+
+		Convey("The status and the pod of a container should be parsed", func() {
+			container := &CRIContainer{ID: "aaaaaaaaaaaaaaaa", State: ContainerCreated}
+
+			So(parseCRIStatus(container, []byte(`{"status":{"state":"CONTAINER_RUNNING"},"info":{"pid":4242,"sandboxID":"pod1"}}`)), ShouldBeNil)
+			So(container.State, ShouldEqual, ContainerRunning)
+			So(container.Pid, ShouldEqual, 4242)
+			So(container.SandboxID, ShouldEqual, "pod1")
+
+			So(parseCRISandbox(container, []byte(`{"status":{"metadata":{"name":"frontend","namespace":"default"},"network":{"ip":"10.1.0.2"}}}`)), ShouldBeNil)
+			So(container.PodName, ShouldEqual, "frontend")
+			So(container.PodNamespace, ShouldEqual, "default")
+			So(container.IPAddress, ShouldEqual, "10.1.0.2")
+		})
+
+		Convey("All the addresses of a dual-stack pod should be extracted", func() {
+			container := &CRIContainer{ID: "aaaaaaaaaaaaaaaa", SandboxID: "pod1"}
+
+			So(parseCRISandbox(container, []byte(`{"status":{"network":{"ip":"10.1.0.2","additionalIps":[{"ip":"fd00::2"},{"ip":"10.2.0.2"}]}}}`)), ShouldBeNil)
+			So(container.AdditionalIPAddresses, ShouldResemble, []string{"fd00::2", "10.2.0.2"})
+
+			runtime, err := defaultCRIMetadataExtractor(container)
+			So(err, ShouldBeNil)
+			So(runtime.IPAddresses().IPs, ShouldResemble, map[string]string{
+				"bridge":      "10.1.0.2",
+				"bridge-ipv6": "fd00::2",
+				"bridge-2":    "10.2.0.2",
+			})
+		})
+
+		Convey("Invalid outputs should be rejected", func() {
+			_, err := parseCRIContainers([]byte("not json"))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,301 @@
+package crimonitor
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// States of the containers of the CRI runtime
+const (
+	// ContainerCreated is the state of a created container
+	ContainerCreated = "CONTAINER_CREATED"
+
+	// ContainerRunning is the state of a running container
+	ContainerRunning = "CONTAINER_RUNNING"
+
+	// ContainerExited is the state of an exited container
+	ContainerExited = "CONTAINER_EXITED"
+)
+
+// CRIContainer describes a container of the CRI runtime and of its pod
+type CRIContainer struct {
+	ID                    string
+	SandboxID             string
+	Name                  string
+	Image                 string
+	State                 string
+	Labels                map[string]string
+	Annotations           map[string]string
+	Pid                   int
+	IPAddress             string
+	AdditionalIPAddresses []string
+	PodName               string
+	PodNamespace          string
+}
+
+// criRuntime lists and controls the containers of the CRI runtime
+type criRuntime interface {
+
+	// Containers returns the containers of the runtime, without their pid and
+	// the description of their pod
+	Containers() ([]*CRIContainer, error)
+
+	// Inspect completes the description of the container
+	Inspect(container *CRIContainer) error
+
+	// Stop stops the container
+	Stop(id string) error
+}
+
+// criEventSource is implemented by the runtimes that stream the changes of their
+// containers
+type criEventSource interface {
+
+	// Events streams the topics of the events of the containers until the cancel
+	// channel is closed. The stream is closed when it ends.
+	Events(cancel <-chan bool) (<-chan string, error)
+}
+
+// criCLI is the CRI runtime of the crictl command, talking to the CRI gRPC API of
+// the runtime endpoint. The events are streamed by the ctr command of containerd.
+type criCLI struct {
+	endpoint string
+}
+
+// Events implements the criEventSource interface
+func (c *criCLI) Events(cancel <-chan bool) (<-chan string, error) {
+
+	cmd := exec.Command("ctr", "--address", strings.TrimPrefix(c.endpoint, "unix://"), "events")
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("Unable to subscribe to the events of the runtime: %s", err)
+	}
+
+	events := make(chan string)
+	done := make(chan bool)
+
+	go func() {
+		select {
+		case <-cancel:
+			cmd.Process.Kill()
+		case <-done:
+		}
+	}()
+
+	go func() {
+		defer close(events)
+		defer close(done)
+
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			topic := parseEventTopic(scanner.Text())
+			if topic == "" {
+				continue
+			}
+
+			select {
+			case events <- topic:
+			case <-cancel:
+				cmd.Process.Kill()
+				cmd.Wait()
+				return
+			}
+		}
+
+		cmd.Wait()
+	}()
+
+	return events, nil
+}
+
+// parseEventTopic returns the topic of a line of ctr events if the event changes a
+// container or its task, or an empty string otherwise. The lines are made of the
+// time, the namespace, the topic and the event.
+func parseEventTopic(line string) string {
+
+	for _, field := range strings.Fields(line) {
+		if strings.HasPrefix(field, "/containers/") || strings.HasPrefix(field, "/tasks/") {
+			return field
+		}
+	}
+
+	return ""
+}
+
+// Containers implements the criRuntime interface
+func (c *criCLI) Containers() ([]*CRIContainer, error) {
+
+	out, err := c.crictl("ps", "-a", "-o", "json")
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list the containers: %s", err)
+	}
+
+	return parseCRIContainers(out)
+}
+
+// Inspect implements the criRuntime interface
+func (c *criCLI) Inspect(container *CRIContainer) error {
+
+	out, err := c.crictl("inspect", "-o", "json", container.ID)
+	if err != nil {
+		return fmt.Errorf("Unable to inspect the container %s: %s", container.ID, err)
+	}
+
+	if err := parseCRIStatus(container, out); err != nil {
+		return err
+	}
+
+	if container.SandboxID == "" {
+		return nil
+	}
+
+	out, err = c.crictl("inspectp", "-o", "json", container.SandboxID)
+	if err != nil {
+		return fmt.Errorf("Unable to inspect the pod %s: %s", container.SandboxID, err)
+	}
+
+	return parseCRISandbox(container, out)
+}
+
+// Stop implements the criRuntime interface
+func (c *criCLI) Stop(id string) error {
+
+	if _, err := c.crictl("stop", "--timeout", "0", id); err != nil {
+		return fmt.Errorf("Unable to stop the container %s: %s", id, err)
+	}
+
+	return nil
+}
+
+// crictl runs crictl against the endpoint of the runtime
+func (c *criCLI) crictl(args ...string) ([]byte, error) {
+
+	out, err := exec.Command("crictl", append([]string{"--runtime-endpoint", c.endpoint}, args...)...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("%s %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// criMetadata is the metadata of the containers and pods of the CRI API
+type criMetadata struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+// criImage is the image of the containers of the CRI API
+type criImage struct {
+	Image string `json:"image"`
+}
+
+// parseCRIContainers parses the output of crictl ps
+func parseCRIContainers(out []byte) ([]*CRIContainer, error) {
+
+	var list struct {
+		Containers []struct {
+			ID           string            `json:"id"`
+			PodSandboxID string            `json:"podSandboxId"`
+			Metadata     criMetadata       `json:"metadata"`
+			Image        criImage          `json:"image"`
+			State        string            `json:"state"`
+			Labels       map[string]string `json:"labels"`
+			Annotations  map[string]string `json:"annotations"`
+		} `json:"containers"`
+	}
+
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, fmt.Errorf("Invalid list of containers: %s", err)
+	}
+
+	containers := []*CRIContainer{}
+	for _, c := range list.Containers {
+		containers = append(containers, &CRIContainer{
+			ID:          c.ID,
+			SandboxID:   c.PodSandboxID,
+			Name:        c.Metadata.Name,
+			Image:       c.Image.Image,
+			State:       c.State,
+			Labels:      c.Labels,
+			Annotations: c.Annotations,
+		})
+	}
+
+	return containers, nil
+}
+
+// parseCRIStatus parses the state and the pid of the container of the output of
+// crictl inspect
+func parseCRIStatus(container *CRIContainer, out []byte) error {
+
+	var status struct {
+		Status struct {
+			State string `json:"state"`
+		} `json:"status"`
+		Info struct {
+			Pid       int    `json:"pid"`
+			SandboxID string `json:"sandboxID"`
+		} `json:"info"`
+	}
+
+	if err := json.Unmarshal(out, &status); err != nil {
+		return fmt.Errorf("Invalid status of the container %s: %s", container.ID, err)
+	}
+
+	if status.Status.State != "" {
+		container.State = status.Status.State
+	}
+
+	if container.SandboxID == "" {
+		container.SandboxID = status.Info.SandboxID
+	}
+
+	container.Pid = status.Info.Pid
+
+	return nil
+}
+
+// parseCRISandbox parses the name and the address of the pod of the output of
+// crictl inspectp
+func parseCRISandbox(container *CRIContainer, out []byte) error {
+
+	var sandbox struct {
+		Status struct {
+			Metadata criMetadata `json:"metadata"`
+			Network  struct {
+				IP            string `json:"ip"`
+				AdditionalIPs []struct {
+					IP string `json:"ip"`
+				} `json:"additionalIps"`
+			} `json:"network"`
+		} `json:"status"`
+	}
+
+	if err := json.Unmarshal(out, &sandbox); err != nil {
+		return fmt.Errorf("Invalid status of the pod %s: %s", container.SandboxID, err)
+	}
+
+	container.PodName = sandbox.Status.Metadata.Name
+	container.PodNamespace = sandbox.Status.Metadata.Namespace
+	container.IPAddress = sandbox.Status.Network.IP
+
+	container.AdditionalIPAddresses = []string{}
+	for _, additional := range sandbox.Status.Network.AdditionalIPs {
+		if additional.IP != "" {
+			container.AdditionalIPAddresses = append(container.AdditionalIPAddresses, additional.IP)
+		}
+	}
+
+	return nil
+}
@@ -4,14 +4,18 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net"
 	"os"
+	"sync"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/aporeto-inc/trireme/collector"
 	"github.com/aporeto-inc/trireme/constants"
 	"github.com/aporeto-inc/trireme/monitor"
+	"github.com/aporeto-inc/trireme/monitor/addrwatcher"
 	"github.com/aporeto-inc/trireme/policy"
+	"github.com/aporeto-inc/trireme/utils/errortypes"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/events"
 	"github.com/docker/docker/api/types/filters"
@@ -112,11 +116,50 @@ func defaultDockerMetadataExtractor(info *types.ContainerJSON) (*policy.PURuntim
 		tags.Add(k, v)
 	}
 
+	return policy.NewPURuntime(info.Name, info.State.Pid, tags, dockerAddresses(info.NetworkSettings), constants.ContainerPU, nil), nil
+}
+
+// dockerAddresses returns the addresses of all the networks of a container. The
+// addresses of the default bridge are the default ones, and the IPv6 address of a
+// network is the one of the network name with the suffix of DefaultIPv6Namespace.
+func dockerAddresses(settings *types.NetworkSettings) *policy.IPMap {
+
 	ipa := policy.NewIPMap(map[string]string{
-		"bridge": info.NetworkSettings.IPAddress,
+		policy.DefaultNamespace: settings.IPAddress,
 	})
 
-	return policy.NewPURuntime(info.Name, info.State.Pid, tags, ipa, constants.ContainerPU, nil), nil
+	if settings.GlobalIPv6Address != "" {
+		ipa.Add(policy.DefaultIPv6Namespace, settings.GlobalIPv6Address)
+	}
+
+	known := map[string]bool{
+		settings.IPAddress:         true,
+		settings.GlobalIPv6Address: true,
+	}
+
+	for name, endpoint := range settings.Networks {
+		if endpoint == nil {
+			continue
+		}
+
+		if !known[endpoint.IPAddress] {
+			ipa.Add(name, endpoint.IPAddress)
+			known[endpoint.IPAddress] = true
+		}
+
+		if !known[endpoint.GlobalIPv6Address] {
+			ipa.Add(name+policy.IPv6NetworkSuffix, endpoint.GlobalIPv6Address)
+			known[endpoint.GlobalIPv6Address] = true
+		}
+	}
+
+	// A container attached only to user defined networks has no address on the
+	// default bridge, and the address of its first network becomes the default one
+	if settings.IPAddress == "" && len(ipa.IPs) > 1 {
+		delete(ipa.IPs, policy.DefaultNamespace)
+	}
+
+	return ipa
 }
 
 // dockerMonitor implements the connection to Docker and monitoring based on events
@@ -132,6 +175,10 @@ type dockerMonitor struct {
 
 	collector collector.EventCollector
 	puHandler monitor.ProcessingUnitsHandler
+
+	// addressWatchers stops the watch of the addresses of the running containers
+	addressWatchers map[string]chan struct{}
+	watchersLock    sync.Mutex
 }
 
 // NewDockerMonitor returns a pointer to a DockerMonitor initialized with the given
@@ -170,6 +217,7 @@ func NewDockerMonitor(
 		dockerClient:       cli,
 		syncAtStart:        syncAtStart,
 		syncHandler:        s,
+		addressWatchers:    map[string]chan struct{}{},
 	}
 
 	// Add handlers for the events that we know how to process
@@ -398,9 +446,11 @@ func (d *dockerMonitor) startDockerContainer(dockerInfo *types.ContainerJSON) er
 
 	if err := <-errorChan; err != nil {
 		d.dockerClient.ContainerStop(context.Background(), dockerInfo.ID, &timeout)
-		return fmt.Errorf("Policy cound't be set - container was killed")
+		return errortypes.Wrapf(nil, err, "Policy cound't be set - container was killed")
 	}
 
+	d.watchAddresses(contextID, dockerInfo.ID, dockerInfo.State.Pid)
+
 	return nil
 }
 
@@ -412,10 +462,89 @@ func (d *dockerMonitor) stopDockerContainer(dockerID string) error {
 		return fmt.Errorf("Couldn't generate ContextID: %s", err)
 	}
 
+	d.unwatchAddresses(contextID)
+
 	errChan := d.puHandler.HandlePUEvent(contextID, monitor.EventStop)
 	return <-errChan
 }
 
+// watchAddresses updates the runtime of the container when the addresses of its
+// network namespace change
+func (d *dockerMonitor) watchAddresses(contextID string, dockerID string, pid int) {
+
+	d.unwatchAddresses(contextID)
+
+	stop := make(chan struct{})
+
+	if err := addrwatcher.Watch(pid, stop, func(addresses []net.IP) {
+		if err := d.handleAddressChange(contextID, dockerID, addresses); err != nil {
+			log.WithFields(log.Fields{
+				"package":   "monitor",
+				"contextID": contextID,
+				"error":     err.Error(),
+			}).Error("Failed to update the addresses of the container")
+		}
+	}); err != nil {
+		log.WithFields(log.Fields{
+			"package":   "monitor",
+			"contextID": contextID,
+			"error":     err.Error(),
+		}).Debug("Addresses of the container not watched")
+		return
+	}
+
+	d.watchersLock.Lock()
+	d.addressWatchers[contextID] = stop
+	d.watchersLock.Unlock()
+}
+
+func (d *dockerMonitor) unwatchAddresses(contextID string) {
+
+	d.watchersLock.Lock()
+	defer d.watchersLock.Unlock()
+
+	if stop, ok := d.addressWatchers[contextID]; ok {
+		close(stop)
+		delete(d.addressWatchers, contextID)
+	}
+}
+
+// handleAddressChange regenerates the runtime of the container and sends an update
+// event if the default address of the container is gone. Addresses that are not
+// known to docker, like after a DHCP renewal, replace the default one.
+func (d *dockerMonitor) handleAddressChange(contextID string, dockerID string, addresses []net.IP) error {
+
+	info, err := d.dockerClient.ContainerInspect(context.Background(), dockerID)
+	if err != nil {
+		return errortypes.Wrapf(errortypes.ErrPUNotFound, err, "Cannot read container information")
+	}
+
+	runtimeInfo, err := d.extractMetadata(&info)
+	if err != nil {
+		return err
+	}
+
+	ips := runtimeInfo.IPAddresses()
+	current, _ := ips.Get(policy.DefaultNamespace)
+
+	for _, ip := range addresses {
+		if ip.String() == current {
+			return nil
+		}
+	}
+
+	if len(addresses) == 0 || addresses[0].To4() == nil {
+		return nil
+	}
+
+	ips.Add(policy.DefaultNamespace, addresses[0].String())
+	runtimeInfo.SetIPAddresses(ips)
+
+	d.puHandler.SetPURuntime(contextID, runtimeInfo)
+
+	return <-d.puHandler.HandlePUEvent(contextID, monitor.EventUpdate)
+}
+
 // ExtractMetadata generates the RuntimeInfo based on Docker primitive
 func (d *dockerMonitor) extractMetadata(dockerInfo *types.ContainerJSON) (*policy.PURuntime, error) {
 
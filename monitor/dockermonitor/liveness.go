@@ -0,0 +1,30 @@
+package dockermonitor
+
+import (
+	"context"
+
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/policy"
+
+	dockerClient "github.com/docker/docker/client"
+)
+
+// Alive returns false if the container of a PU was removed or does not run anymore.
+// It lets the docker monitor be a liveness probe of the PUs, destroying the ones
+// whose events were missed. The PUs that are not containers are alive.
+func (d *dockerMonitor) Alive(contextID string, runtime policy.RuntimeReader) (bool, error) {
+
+	if runtime.PUType() != constants.ContainerPU {
+		return true, nil
+	}
+
+	info, err := d.dockerClient.ContainerInspect(context.Background(), contextID)
+	if err != nil {
+		if dockerClient.IsErrContainerNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return info.State != nil && info.State.Running, nil
+}
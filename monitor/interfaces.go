@@ -1,6 +1,9 @@
 package monitor
 
-import "github.com/aporeto-inc/trireme/policy"
+import (
+	"github.com/aporeto-inc/trireme/api/events"
+	"github.com/aporeto-inc/trireme/policy"
+)
 
 // A Monitor is the interface to implement low level monitoring functions on some well defined primitive.
 type Monitor interface {
@@ -22,6 +25,16 @@ type ProcessingUnitsHandler interface {
 	HandlePUEvent(contextID string, event Event) <-chan error
 }
 
+// PolicySummary summarizes the policy applied to a ProcessingUnit
+type PolicySummary = events.PolicySummary
+
+// A PolicySummarizer reports the policy applied to the ProcessingUnits.
+type PolicySummarizer interface {
+
+	// PolicySummary returns the summary of the policy applied to the PU.
+	PolicySummary(contextID string) (*PolicySummary, error)
+}
+
 // A SynchronizationHandler can handle a PU synchronization routine.
 type SynchronizationHandler interface {
 
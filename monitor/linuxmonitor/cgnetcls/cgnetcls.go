@@ -32,10 +32,16 @@ const (
 
 var markval uint64 = initialmarkval
 
+// markFirst and markSize are the range of the marks, or a zero size when the marks
+// are not bounded
+var markFirst, markSize uint64
+
 //Empty receiver struct
 type netCls struct {
 	markchan         chan uint64
 	ReleaseAgentPath string
+	// root is the mount point of the net_cls controller
+	root string
 }
 
 // Creategroup creates a cgroup/net_cls structure and writes the allocated classid to the file.
@@ -43,32 +49,32 @@ type netCls struct {
 func (s *netCls) Creategroup(cgroupname string) error {
 
 	//Create the directory structure
-	_, err := os.Stat(basePath + procs)
+	_, err := os.Stat(s.root + procs)
 	if os.IsNotExist(err) {
-		syscall.Mount("cgroup", basePath, "cgroup", 0, "net_cls,net_prio")
+		syscall.Mount("cgroup", s.root, "cgroup", 0, "net_cls,net_prio")
 
 	}
 
-	os.MkdirAll((basePath + TriremeBasePath + cgroupname), 0700)
+	os.MkdirAll((s.root + TriremeBasePath + cgroupname), 0700)
 
 	//Write to the notify on release file and release agent files
 
-	err = ioutil.WriteFile(basePath+releaseAgentConfFile, []byte(s.ReleaseAgentPath), 0644)
+	err = ioutil.WriteFile(s.root+releaseAgentConfFile, []byte(s.ReleaseAgentPath), 0644)
 	if err != nil {
 		return fmt.Errorf("Failed to register a release agent error %s", err.Error())
 	}
 
-	err = ioutil.WriteFile(basePath+notifyOnReleaseFile, []byte("1"), 0644)
+	err = ioutil.WriteFile(s.root+notifyOnReleaseFile, []byte("1"), 0644)
 	if err != nil {
 		return fmt.Errorf("Failed to write to the notify file %s", err.Error())
 	}
 
-	err = ioutil.WriteFile(basePath+TriremeBasePath+notifyOnReleaseFile, []byte("1"), 0644)
+	err = ioutil.WriteFile(s.root+TriremeBasePath+notifyOnReleaseFile, []byte("1"), 0644)
 	if err != nil {
 		return fmt.Errorf("Failed to write to the notify file %s", err.Error())
 	}
 
-	err = ioutil.WriteFile(basePath+TriremeBasePath+cgroupname+notifyOnReleaseFile, []byte("1"), 0644)
+	err = ioutil.WriteFile(s.root+TriremeBasePath+cgroupname+notifyOnReleaseFile, []byte("1"), 0644)
 	if err != nil {
 		return fmt.Errorf("Failed to write to the notify file %s", err.Error())
 	}
@@ -80,7 +86,7 @@ func (s *netCls) Creategroup(cgroupname string) error {
 //AssignMark writes the mark value to net_cls.classid file.
 func (s *netCls) AssignMark(cgroupname string, mark uint64) error {
 
-	_, err := os.Stat(basePath + TriremeBasePath + cgroupname)
+	_, err := os.Stat(s.root + TriremeBasePath + cgroupname)
 	if os.IsNotExist(err) {
 		log.WithFields(log.Fields{
 			"package":    "cgnetcls",
@@ -93,7 +99,7 @@ func (s *netCls) AssignMark(cgroupname string, mark uint64) error {
 	//16 is the base since the mark file expects hexadecimal values
 	markval := "0x" + (strconv.FormatUint(mark, 16))
 
-	if err := ioutil.WriteFile(basePath+TriremeBasePath+cgroupname+markFile, []byte(markval), 0644); err != nil {
+	if err := ioutil.WriteFile(s.root+TriremeBasePath+cgroupname+markFile, []byte(markval), 0644); err != nil {
 		log.WithFields(log.Fields{
 			"package":    "cgnetls",
 			"Error":      err.Error(),
@@ -108,7 +114,7 @@ func (s *netCls) AssignMark(cgroupname string, mark uint64) error {
 // AddProcess adds the process to the net_cls group
 func (s *netCls) AddProcess(cgroupname string, pid int) error {
 
-	_, err := os.Stat(basePath + TriremeBasePath + cgroupname)
+	_, err := os.Stat(s.root + TriremeBasePath + cgroupname)
 	if os.IsNotExist(err) {
 		log.WithFields(log.Fields{"package": "cgnetcls",
 			"Error":      err.Error(),
@@ -121,7 +127,7 @@ func (s *netCls) AddProcess(cgroupname string, pid int) error {
 		return nil
 	}
 
-	if err := ioutil.WriteFile(basePath+TriremeBasePath+cgroupname+procs, PID, 0644); err != nil {
+	if err := ioutil.WriteFile(s.root+TriremeBasePath+cgroupname+procs, PID, 0644); err != nil {
 		log.WithFields(log.Fields{
 			"package":    "cgnetls",
 			"Error":      err.Error(),
@@ -138,7 +144,7 @@ func (s *netCls) AddProcess(cgroupname string, pid int) error {
 //top of net_cls cgroup cgroup.procs
 func (s *netCls) RemoveProcess(cgroupname string, pid int) error {
 
-	_, err := os.Stat(basePath + TriremeBasePath + cgroupname)
+	_, err := os.Stat(s.root + TriremeBasePath + cgroupname)
 	if os.IsNotExist(err) {
 		log.WithFields(log.Fields{
 			"package":    "cgnetcls",
@@ -148,7 +154,7 @@ func (s *netCls) RemoveProcess(cgroupname string, pid int) error {
 		return errors.New("Cgroup does not exist")
 	}
 
-	data, err := ioutil.ReadFile(basePath + procs)
+	data, err := ioutil.ReadFile(s.root + procs)
 	if err != nil || !strings.Contains(string(data), strconv.Itoa(pid)) {
 		log.WithFields(log.Fields{
 			"package":    "cgnetls",
@@ -158,7 +164,7 @@ func (s *netCls) RemoveProcess(cgroupname string, pid int) error {
 		return errors.New("Process is not a part of this cgroup")
 	}
 
-	if err := ioutil.WriteFile(basePath+procs, []byte(strconv.Itoa(pid)), 0644); err != nil {
+	if err := ioutil.WriteFile(s.root+procs, []byte(strconv.Itoa(pid)), 0644); err != nil {
 		log.WithFields(log.Fields{
 			"package":    "cgnetls",
 			"Error":      err.Error(),
@@ -176,7 +182,7 @@ func (s *netCls) RemoveProcess(cgroupname string, pid int) error {
 // Before we try deletion
 func (s *netCls) DeleteCgroup(cgroupname string) error {
 
-	_, err := os.Stat(basePath + TriremeBasePath + cgroupname)
+	_, err := os.Stat(s.root + TriremeBasePath + cgroupname)
 	if os.IsNotExist(err) {
 		log.WithFields(log.Fields{
 			"package":    "cgnetcls",
@@ -186,7 +192,7 @@ func (s *netCls) DeleteCgroup(cgroupname string) error {
 		return nil
 	}
 
-	err = os.Remove(basePath + TriremeBasePath + cgroupname)
+	err = os.Remove(s.root + TriremeBasePath + cgroupname)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"package":    "cgnetcls",
@@ -203,19 +209,60 @@ func (s *netCls) DeleteCgroup(cgroupname string) error {
 func (s *netCls) Deletebasepath(cgroupName string) bool {
 
 	if cgroupName == TriremeBasePath {
-		os.Remove(basePath + cgroupName)
+		os.Remove(s.root + cgroupName)
 		return true
 	}
 
 	return false
 }
 
+// ListCgroupProcesses lists the processes of the cgroup
+func (s *netCls) ListCgroupProcesses(cgroupname string) ([]string, error) {
+
+	_, err := os.Stat(s.root + TriremeBasePath + cgroupname)
+	if os.IsNotExist(err) {
+		return []string{}, errors.New("Cgroup does not exist")
+	}
+
+	data, err := ioutil.ReadFile(s.root + TriremeBasePath + cgroupname + procs)
+	if err != nil {
+		return []string{}, errors.New("Cannot read procs file")
+	}
+
+	procs := []string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			procs = append(procs, line)
+		}
+	}
+	return procs, nil
+}
+
+// ListAllCgroups lists the cgroups created by trireme
+func (s *netCls) ListAllCgroups() []string {
+
+	entries, err := ioutil.ReadDir(s.root + TriremeBasePath)
+	if err != nil {
+		return []string{}
+	}
+
+	cgroups := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			cgroups = append(cgroups, "/"+entry.Name())
+		}
+	}
+
+	return cgroups
+}
+
 //NewCgroupNetController returns a handle to call functions on the cgroup net_cls controller
 func NewCgroupNetController(releasePath string) Cgroupnetcls {
 	binpath, _ := osext.Executable()
 	controller := &netCls{
 		markchan:         make(chan uint64),
 		ReleaseAgentPath: binpath,
+		root:             basePath,
 	}
 
 	if releasePath != "" {
@@ -227,28 +274,33 @@ func NewCgroupNetController(releasePath string) Cgroupnetcls {
 
 // MarkVal returns a new Mark Value
 func MarkVal() uint64 {
-	return atomic.AddUint64(&markval, 1)
+
+	value := atomic.AddUint64(&markval, 1)
+	if markSize == 0 {
+		return value
+	}
+
+	return markFirst + (value-1)%markSize
 }
 
-// ListCgroupProcesses lists the processes of the cgroup
-func ListCgroupProcesses(cgroupname string) ([]string, error) {
+// SetMarkRange restricts the marks of the cgroups to [first, last] so that they fit
+// in the packet mark mask of trireme. The marks wrap around at the end of the range.
+// It must be called before the first cgroup is created.
+func SetMarkRange(first, last uint64) error {
 
-	_, err := os.Stat(basePath + TriremeBasePath + cgroupname)
-	if os.IsNotExist(err) {
-		return []string{}, errors.New("Cgroup does not exist")
+	if first == 0 || last < first {
+		return fmt.Errorf("Invalid mark range %d-%d", first, last)
 	}
 
-	data, err := ioutil.ReadFile(basePath + TriremeBasePath + cgroupname + "/cgroup.procs")
-	if err != nil {
-		return []string{}, errors.New("Cannot read procs file")
-	}
+	markFirst = first
+	markSize = last - first + 1
+	atomic.StoreUint64(&markval, 0)
 
-	procs := []string{}
-	if len(procs) == 0 {
-		return procs, nil
-	}
-	for _, line := range strings.Split(string(data), "\n") {
-		procs = append(procs, string(line))
-	}
-	return procs, nil
+	return nil
+}
+
+// ListCgroupProcesses lists the processes of the cgroup
+func ListCgroupProcesses(cgroupname string) ([]string, error) {
+
+	return (&netCls{root: basePath}).ListCgroupProcesses(cgroupname)
 }
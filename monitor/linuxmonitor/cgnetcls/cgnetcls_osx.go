@@ -49,6 +49,18 @@ func (s *netCls) RemoveProcess(cgroupname string, pid int) error {
 	return nil
 }
 
+// ListCgroupProcesses lists the processes of the cgroup
+func (s *netCls) ListCgroupProcesses(cgroupname string) ([]string, error) {
+
+	return []string{}, nil
+}
+
+// ListAllCgroups lists the cgroups created by trireme
+func (s *netCls) ListAllCgroups() []string {
+
+	return []string{}
+}
+
 //NewCgroupNetController returns a handle to call functions on the cgroup net_cls controller
 func NewCgroupNetController(releasePath string) Cgroupnetcls {
 
@@ -62,6 +74,11 @@ func MarkVal() uint64 {
 	return 0
 }
 
+// SetMarkRange restricts the marks of the cgroups
+func SetMarkRange(first, last uint64) error {
+	return nil
+}
+
 // ListCgroupProcesses lists the processes of the cgroup
 func ListCgroupProcesses(cgroupname string) ([]string, error) {
 	return []string{}, nil
@@ -230,3 +230,45 @@ func TestDeleteBasePath(t *testing.T) {
 		t.SkipNow()
 	}
 }
+
+func TestNetClsInDirectory(t *testing.T) {
+
+	root, err := ioutil.TempDir("", "netcls")
+	if err != nil {
+		t.Fatalf("Failed to create the directory %s", err)
+	}
+	defer os.RemoveAll(root)
+
+	// The controller is only mounted when the root has no cgroup.procs file
+	if err := ioutil.WriteFile(root+procs, []byte{}, 0644); err != nil {
+		t.Fatalf("Failed to create the procs file %s", err)
+	}
+
+	cg := &netCls{root: root}
+
+	if err := cg.Creategroup(testcgroupname); err != nil {
+		t.Fatalf("Failed to create group error returned %s", err.Error())
+	}
+
+	if err := cg.AssignMark(testcgroupname, testmark); err != nil {
+		t.Errorf("Failed to assign mark error returned %s", err.Error())
+	}
+
+	if data, _ := ioutil.ReadFile(root + TriremeBasePath + testcgroupname + markFile); string(data) != "0x64" {
+		t.Errorf("Mark was not written, got %s", string(data))
+	}
+
+	ioutil.WriteFile(root+TriremeBasePath+testcgroupname+procs, []byte("10\n20\n"), 0644)
+
+	if processes, err := cg.ListCgroupProcesses(testcgroupname); err != nil || len(processes) != 2 {
+		t.Errorf("Expected the processes of the cgroup, got %v %v", processes, err)
+	}
+
+	if _, err := cg.ListCgroupProcesses("/missing"); err == nil {
+		t.Errorf("Expected an error listing the processes of a missing cgroup")
+	}
+
+	if cgroups := cg.ListAllCgroups(); len(cgroups) != 1 || cgroups[0] != testcgroupname {
+		t.Errorf("Expected the cgroup to be listed, got %v", cgroups)
+	}
+}
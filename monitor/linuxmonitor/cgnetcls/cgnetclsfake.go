@@ -0,0 +1,227 @@
+package cgnetcls
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// TestCgroupnetcls is a net_cls controller keeping the cgroups in memory, for the
+// tests of the packages managing cgroups without root
+type TestCgroupnetcls interface {
+	Cgroupnetcls
+	// Mark returns the mark assigned to a cgroup, if any
+	Mark(cgroupname string) (uint64, bool)
+	// Fail makes the calls of a method of the Cgroupnetcls interface return the
+	// error, or succeed again if the error is nil
+	Fail(method string, err error)
+}
+
+// testCgroup is a cgroup of the test controller
+type testCgroup struct {
+	mark      uint64
+	marked    bool
+	processes []int
+}
+
+type testNetCls struct {
+	cgroups  map[string]*testCgroup
+	failures map[string]error
+	sync.Mutex
+}
+
+// NewTestCgroupNetController returns a net_cls controller keeping the cgroups in memory
+func NewTestCgroupNetController() TestCgroupnetcls {
+
+	return &testNetCls{
+		cgroups:  map[string]*testCgroup{},
+		failures: map[string]error{},
+	}
+}
+
+// Fail implements the TestCgroupnetcls interface
+func (s *testNetCls) Fail(method string, err error) {
+
+	s.Lock()
+	defer s.Unlock()
+
+	if err == nil {
+		delete(s.failures, method)
+		return
+	}
+
+	s.failures[method] = err
+}
+
+// Mark implements the TestCgroupnetcls interface
+func (s *testNetCls) Mark(cgroupname string) (uint64, bool) {
+
+	s.Lock()
+	defer s.Unlock()
+
+	cgroup, ok := s.cgroups[cgroupname]
+	if !ok || !cgroup.marked {
+		return 0, false
+	}
+
+	return cgroup.mark, true
+}
+
+// Creategroup creates the cgroup unless it exists
+func (s *testNetCls) Creategroup(cgroupname string) error {
+
+	s.Lock()
+	defer s.Unlock()
+
+	if err := s.failures["Creategroup"]; err != nil {
+		return err
+	}
+
+	if _, ok := s.cgroups[cgroupname]; !ok {
+		s.cgroups[cgroupname] = &testCgroup{}
+	}
+
+	return nil
+}
+
+// AssignMark assigns the mark to the cgroup
+func (s *testNetCls) AssignMark(cgroupname string, mark uint64) error {
+
+	s.Lock()
+	defer s.Unlock()
+
+	if err := s.failures["AssignMark"]; err != nil {
+		return err
+	}
+
+	cgroup, ok := s.cgroups[cgroupname]
+	if !ok {
+		return errors.New("Cgroup does not exist")
+	}
+
+	cgroup.mark = mark
+	cgroup.marked = true
+
+	return nil
+}
+
+// AddProcess adds the process to the cgroup
+func (s *testNetCls) AddProcess(cgroupname string, pid int) error {
+
+	s.Lock()
+	defer s.Unlock()
+
+	if err := s.failures["AddProcess"]; err != nil {
+		return err
+	}
+
+	cgroup, ok := s.cgroups[cgroupname]
+	if !ok {
+		return errors.New("Cgroup does not exist")
+	}
+
+	for _, p := range cgroup.processes {
+		if p == pid {
+			return nil
+		}
+	}
+
+	cgroup.processes = append(cgroup.processes, pid)
+
+	return nil
+}
+
+// RemoveProcess removes the process from the cgroup
+func (s *testNetCls) RemoveProcess(cgroupname string, pid int) error {
+
+	s.Lock()
+	defer s.Unlock()
+
+	if err := s.failures["RemoveProcess"]; err != nil {
+		return err
+	}
+
+	cgroup, ok := s.cgroups[cgroupname]
+	if !ok {
+		return errors.New("Cgroup does not exist")
+	}
+
+	for i, p := range cgroup.processes {
+		if p == pid {
+			cgroup.processes = append(cgroup.processes[:i], cgroup.processes[i+1:]...)
+			return nil
+		}
+	}
+
+	return errors.New("Process is not a part of this cgroup")
+}
+
+// DeleteCgroup deletes the cgroup, which must be empty
+func (s *testNetCls) DeleteCgroup(cgroupname string) error {
+
+	s.Lock()
+	defer s.Unlock()
+
+	if err := s.failures["DeleteCgroup"]; err != nil {
+		return err
+	}
+
+	cgroup, ok := s.cgroups[cgroupname]
+	if !ok {
+		return nil
+	}
+
+	if len(cgroup.processes) > 0 {
+		return fmt.Errorf("Failed to delete cgroup %s error returned cgroup not empty", cgroupname)
+	}
+
+	delete(s.cgroups, cgroupname)
+
+	return nil
+}
+
+// Deletebasepath returns true if the cgroup is the base cgroup of trireme
+func (s *testNetCls) Deletebasepath(cgroupName string) bool {
+
+	return cgroupName == TriremeBasePath
+}
+
+// ListCgroupProcesses lists the processes of the cgroup
+func (s *testNetCls) ListCgroupProcesses(cgroupname string) ([]string, error) {
+
+	s.Lock()
+	defer s.Unlock()
+
+	if err := s.failures["ListCgroupProcesses"]; err != nil {
+		return []string{}, err
+	}
+
+	cgroup, ok := s.cgroups[cgroupname]
+	if !ok {
+		return []string{}, errors.New("Cgroup does not exist")
+	}
+
+	processes := []string{}
+	for _, pid := range cgroup.processes {
+		processes = append(processes, strconv.Itoa(pid))
+	}
+
+	return processes, nil
+}
+
+// ListAllCgroups lists the cgroups in order
+func (s *testNetCls) ListAllCgroups() []string {
+
+	s.Lock()
+	defer s.Unlock()
+
+	cgroups := []string{}
+	for cgroupname := range s.cgroups {
+		cgroups = append(cgroups, cgroupname)
+	}
+	sort.Strings(cgroups)
+
+	return cgroups
+}
@@ -87,3 +87,24 @@ func (_m *MockCgroupnetcls) Deletebasepath(contextID string) bool {
 func (_mr *_MockCgroupnetclsRecorder) Deletebasepath(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Deletebasepath", arg0)
 }
+
+func (_m *MockCgroupnetcls) ListCgroupProcesses(cgroupname string) ([]string, error) {
+	ret := _m.ctrl.Call(_m, "ListCgroupProcesses", cgroupname)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockCgroupnetclsRecorder) ListCgroupProcesses(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "ListCgroupProcesses", arg0)
+}
+
+func (_m *MockCgroupnetcls) ListAllCgroups() []string {
+	ret := _m.ctrl.Call(_m, "ListAllCgroups")
+	ret0, _ := ret[0].([]string)
+	return ret0
+}
+
+func (_mr *_MockCgroupnetclsRecorder) ListAllCgroups() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "ListAllCgroups")
+}
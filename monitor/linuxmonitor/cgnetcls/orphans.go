@@ -0,0 +1,64 @@
+package cgnetcls
+
+import (
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// CleanupOrphans deletes the cgroups of trireme that are not active, such as the ones
+// left by a crash between the creation of a cgroup and the storage of its context.
+// The processes of an orphaned cgroup are moved back to the root cgroup first, since
+// its mark may be assigned to a new cgroup and apply the policy of another processing
+// unit to them. It returns the cgroups deleted.
+func CleanupOrphans(netcls Cgroupnetcls, active map[string]bool) []string {
+
+	deleted := []string{}
+
+	for _, cgroupname := range netcls.ListAllCgroups() {
+
+		if active[cgroupname] {
+			continue
+		}
+
+		processes, err := netcls.ListCgroupProcesses(cgroupname)
+		if err != nil {
+			continue
+		}
+
+		for _, process := range processes {
+			pid, err := strconv.Atoi(process)
+			if err != nil {
+				continue
+			}
+
+			if err := netcls.RemoveProcess(cgroupname, pid); err != nil {
+				log.WithFields(log.Fields{
+					"package":    "cgnetcls",
+					"cgroupname": cgroupname,
+					"pid":        pid,
+					"error":      err.Error(),
+				}).Warn("Failed to move the process out of the orphaned cgroup")
+			}
+		}
+
+		if err := netcls.DeleteCgroup(cgroupname); err != nil {
+			log.WithFields(log.Fields{
+				"package":    "cgnetcls",
+				"cgroupname": cgroupname,
+				"error":      err.Error(),
+			}).Warn("Failed to delete the orphaned cgroup")
+			continue
+		}
+
+		log.WithFields(log.Fields{
+			"package":    "cgnetcls",
+			"cgroupname": cgroupname,
+			"processes":  len(processes),
+		}).Info("Deleted the orphaned cgroup")
+
+		deleted = append(deleted, cgroupname)
+	}
+
+	return deleted
+}
@@ -0,0 +1,84 @@
+package cgnetcls
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCleanupOrphans(t *testing.T) {
+
+	netcls := NewTestCgroupNetController()
+
+	for _, cgroupname := range []string{"/active", "/empty", "/busy", "/stuck"} {
+		if err := netcls.Creategroup(cgroupname); err != nil {
+			t.Fatalf("Failed to create cgroup %s", err)
+		}
+	}
+	netcls.AddProcess("/active", 10)
+	netcls.AddProcess("/busy", 20)
+	netcls.AddProcess("/busy", 21)
+	netcls.AddProcess("/stuck", 30)
+
+	deleted := CleanupOrphans(netcls, map[string]bool{"/active": true, "/stuck": true})
+
+	if !reflect.DeepEqual(deleted, []string{"/busy", "/empty"}) {
+		t.Errorf("Expected the orphaned cgroups to be deleted, got %v", deleted)
+	}
+
+	if cgroups := netcls.ListAllCgroups(); !reflect.DeepEqual(cgroups, []string{"/active", "/stuck"}) {
+		t.Errorf("Expected the active cgroups to be kept, got %v", cgroups)
+	}
+
+	if processes, _ := netcls.ListCgroupProcesses("/active"); !reflect.DeepEqual(processes, []string{"10"}) {
+		t.Errorf("Expected the processes of the active cgroup to be kept, got %v", processes)
+	}
+}
+
+func TestCleanupOrphansFailure(t *testing.T) {
+
+	netcls := NewTestCgroupNetController()
+	netcls.Creategroup("/orphan")
+	netcls.Fail("DeleteCgroup", errors.New("busy"))
+
+	if deleted := CleanupOrphans(netcls, map[string]bool{}); len(deleted) != 0 {
+		t.Errorf("Expected no cgroup to be deleted, got %v", deleted)
+	}
+
+	netcls.Fail("DeleteCgroup", nil)
+
+	if deleted := CleanupOrphans(netcls, map[string]bool{}); !reflect.DeepEqual(deleted, []string{"/orphan"}) {
+		t.Errorf("Expected the orphaned cgroup to be deleted, got %v", deleted)
+	}
+}
+
+func TestTestCgroupNetController(t *testing.T) {
+
+	netcls := NewTestCgroupNetController()
+
+	if err := netcls.AssignMark("/pu", 100); err == nil {
+		t.Errorf("Expected an error assigning a mark to a missing cgroup")
+	}
+
+	netcls.Creategroup("/pu")
+	if err := netcls.AssignMark("/pu", 100); err != nil {
+		t.Errorf("Failed to assign the mark %s", err)
+	}
+
+	if mark, ok := netcls.Mark("/pu"); !ok || mark != 100 {
+		t.Errorf("Expected the mark 100, got %d", mark)
+	}
+
+	netcls.AddProcess("/pu", 42)
+	if err := netcls.DeleteCgroup("/pu"); err == nil {
+		t.Errorf("Expected an error deleting a cgroup with processes")
+	}
+
+	if err := netcls.RemoveProcess("/pu", 42); err != nil {
+		t.Errorf("Failed to remove the process %s", err)
+	}
+
+	if err := netcls.DeleteCgroup("/pu"); err != nil {
+		t.Errorf("Failed to delete the cgroup %s", err)
+	}
+}
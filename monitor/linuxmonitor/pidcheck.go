@@ -0,0 +1,224 @@
+package linuxmonitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/monitor"
+	"github.com/aporeto-inc/trireme/monitor/contextstore"
+	"github.com/aporeto-inc/trireme/monitor/rpcmonitor"
+)
+
+// DefaultProcessCheckInterval is the default interval between two verifications of
+// the processes of the PUs
+const DefaultProcessCheckInterval = 30 * time.Second
+
+// statStartTimeField is the position of the start time in /proc/<pid>/stat, after
+// the command name
+const statStartTimeField = 19
+
+// processIdentity identifies a process beyond its PID, which the kernel reuses once
+// the process exited
+type processIdentity struct {
+	startTime string
+	exe       string
+	pidNS     string
+}
+
+// trackedProcess is the process of a PU and its identity when the PU started
+type trackedProcess struct {
+	eventInfo *rpcmonitor.EventInfo
+	identity  *processIdentity
+}
+
+// readProcessIdentity reads the identity of a process from the proc filesystem
+func readProcessIdentity(procRoot string, pid string) (*processIdentity, error) {
+
+	stat, err := ioutil.ReadFile(filepath.Join(procRoot, pid, "stat"))
+	if err != nil {
+		return nil, err
+	}
+
+	// The command name is between parentheses and may contain spaces
+	end := strings.LastIndex(string(stat), ")")
+	if end < 0 {
+		return nil, fmt.Errorf("Invalid stat of process %s", pid)
+	}
+
+	fields := strings.Fields(string(stat)[end+1:])
+	if len(fields) <= statStartTimeField {
+		return nil, fmt.Errorf("Invalid stat of process %s", pid)
+	}
+
+	exe, err := os.Readlink(filepath.Join(procRoot, pid, "exe"))
+	if err != nil {
+		return nil, err
+	}
+
+	pidNS, err := os.Readlink(filepath.Join(procRoot, pid, "ns", "pid"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &processIdentity{
+		startTime: fields[statStartTimeField],
+		exe:       exe,
+		pidNS:     pidNS,
+	}, nil
+}
+
+// changes describes how the identity of the process differs from the given one, or
+// returns an empty string if it is the same process
+func (i *processIdentity) changes(current *processIdentity) string {
+
+	changes := []string{}
+
+	if i.startTime != current.startTime {
+		changes = append(changes, "start time "+i.startTime+" changed to "+current.startTime)
+	}
+
+	if i.exe != current.exe {
+		changes = append(changes, "executable "+i.exe+" changed to "+current.exe)
+	}
+
+	if i.pidNS != current.pidNS {
+		changes = append(changes, "PID namespace "+i.pidNS+" changed to "+current.pidNS)
+	}
+
+	return strings.Join(changes, ", ")
+}
+
+// track records the identity of the process of a PU that started. The PUs whose
+// process cannot be identified are not verified.
+func (s *LinuxProcessor) track(contextID string, eventInfo *rpcmonitor.EventInfo) {
+
+	identity, err := readProcessIdentity(s.procRoot, eventInfo.PID)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"package":   "linuxmonitor",
+			"contextID": contextID,
+			"pid":       eventInfo.PID,
+			"error":     err.Error(),
+		}).Warn("Cannot identify the process of the PU")
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.processes[contextID] = &trackedProcess{
+		eventInfo: eventInfo,
+		identity:  identity,
+	}
+}
+
+// untrack forgets the process of a PU
+func (s *LinuxProcessor) untrack(contextID string) {
+
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.processes, contextID)
+}
+
+// CheckProcesses verifies that the PIDs of the PUs still belong to the processes that
+// started them. A PID reused by another process, or whose process changed of
+// executable or PID namespace, is reported as a security event and its PU is
+// destroyed, so that the policy of the PU does not apply to another process. The
+// processes that exited are left to their stop event, which stops their verification.
+func (s *LinuxProcessor) CheckProcesses() {
+
+	s.Lock()
+	processes := make(map[string]*trackedProcess, len(s.processes))
+	for contextID, process := range s.processes {
+		processes[contextID] = process
+	}
+	s.Unlock()
+
+	for contextID, process := range processes {
+
+		current, err := readProcessIdentity(s.procRoot, process.eventInfo.PID)
+		if err != nil {
+			continue
+		}
+
+		changes := process.identity.changes(current)
+		if changes == "" {
+			continue
+		}
+
+		log.WithFields(log.Fields{
+			"package":   "linuxmonitor",
+			"contextID": contextID,
+			"pid":       process.eventInfo.PID,
+			"changes":   changes,
+		}).Error("The PID of the PU belongs to another process. Destroying the PU")
+
+		pid, _ := strconv.Atoi(process.eventInfo.PID)
+		if c, ok := s.collector.(collector.SecurityEventCollector); ok {
+			c.CollectSecurityEvent(&collector.SecurityRecord{
+				Event:     collector.SecurityPIDRecycled,
+				ContextID: contextID,
+				PID:       pid,
+				Details:   changes,
+			})
+		}
+
+		s.destroyRecycled(contextID, process.eventInfo)
+	}
+}
+
+// destroyRecycled stops and destroys a PU whose PID belongs to another process
+func (s *LinuxProcessor) destroyRecycled(contextID string, eventInfo *rpcmonitor.EventInfo) {
+
+	s.untrack(contextID)
+
+	if err := <-s.puHandler.HandlePUEvent(contextID, monitor.EventStop); err != nil {
+		log.WithFields(log.Fields{
+			"package":   "linuxmonitor",
+			"contextID": contextID,
+			"error":     err.Error(),
+		}).Warn("Failed to stop the PU")
+	}
+
+	<-s.puHandler.HandlePUEvent(contextID, monitor.EventDestroy)
+
+	s.netcls.DeleteCgroup(eventInfo.PUID)
+	contextstore.NewContextStore().RemoveContext(contextID)
+
+	s.collector.CollectContainerEvent(&collector.ContainerRecord{
+		ContextID: contextID,
+		Event:     collector.ContainerFailed,
+	})
+}
+
+// Run implements the BackgroundProcessor interface of the RPC monitor. It verifies
+// the processes of the PUs every DefaultProcessCheckInterval while the monitor runs.
+func (s *LinuxProcessor) Run(stop <-chan struct{}) {
+
+	s.RunProcessChecks(DefaultProcessCheckInterval, stop)
+}
+
+// RunProcessChecks verifies the processes of the PUs at every interval until the stop
+// channel is closed
+func (s *LinuxProcessor) RunProcessChecks(interval time.Duration, stop <-chan struct{}) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.CheckProcesses()
+		case <-stop:
+			return
+		}
+	}
+}
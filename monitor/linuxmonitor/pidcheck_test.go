@@ -0,0 +1,133 @@
+package linuxmonitor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/monitor"
+	"github.com/aporeto-inc/trireme/monitor/linuxmonitor/cgnetcls"
+	"github.com/aporeto-inc/trireme/monitor/rpcmonitor"
+	"github.com/aporeto-inc/trireme/policy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type securityCollector struct {
+	collector.DefaultCollector
+	events []*collector.SecurityRecord
+}
+
+func (c *securityCollector) CollectSecurityEvent(record *collector.SecurityRecord) {
+	c.events = append(c.events, record)
+}
+
+type eventsHandler struct {
+	events []monitor.Event
+}
+
+func (h *eventsHandler) SetPURuntime(contextID string, runtimeInfo *policy.PURuntime) error {
+	return nil
+}
+
+func (h *eventsHandler) HandlePUEvent(contextID string, event monitor.Event) <-chan error {
+	h.events = append(h.events, event)
+
+	c := make(chan error, 1)
+	c <- nil
+
+	return c
+}
+
+// createProcess creates a process with the start time, executable and PID namespace
+// in a fake proc tree
+func createProcess(root string, pid string, startTime string, exe string, pidNS string) error {
+
+	os.RemoveAll(filepath.Join(root, pid))
+
+	if err := os.MkdirAll(filepath.Join(root, pid, "ns"), 0755); err != nil {
+		return err
+	}
+
+	stat := pid + " (my server) S 1 1 1 0 -1 4194560 100 0 0 0 1 1 0 0 20 0 1 0 " + startTime + " 1000 100\n"
+	if err := ioutil.WriteFile(filepath.Join(root, pid, "stat"), []byte(stat), 0644); err != nil {
+		return err
+	}
+
+	if err := os.Symlink(exe, filepath.Join(root, pid, "exe")); err != nil {
+		return err
+	}
+
+	return os.Symlink(pidNS, filepath.Join(root, pid, "ns", "pid"))
+}
+
+func TestCheckProcesses(t *testing.T) {
+	Convey("Given a processor tracking the process of a PU", t, func() {
+		root, err := ioutil.TempDir("", "pidcheck")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(root)
+
+		So(createProcess(root, "42", "1000", "/usr/bin/server", "pid:[4026531836]"), ShouldBeNil)
+
+		c := &securityCollector{}
+		puHandler := &eventsHandler{}
+		netcls := cgnetcls.NewTestCgroupNetController()
+		So(netcls.Creategroup("/trireme/1234"), ShouldBeNil)
+		p := NewLinuxProcessor(c, puHandler, rpcmonitor.DefaultRPCMetadataExtractor, "")
+		p.netcls = netcls
+		p.procRoot = root
+
+		p.track("/trireme/1234", &rpcmonitor.EventInfo{PUID: "/trireme/1234", PID: "42"})
+		So(len(p.processes), ShouldEqual, 1)
+
+		Convey("When the process did not change, the PU should be kept", func() {
+			p.CheckProcesses()
+			So(c.events, ShouldBeEmpty)
+			So(len(p.processes), ShouldEqual, 1)
+		})
+
+		Convey("When the process exited, the PU should be left to its stop event", func() {
+			os.RemoveAll(filepath.Join(root, "42"))
+			p.CheckProcesses()
+			So(c.events, ShouldBeEmpty)
+			So(len(p.processes), ShouldEqual, 1)
+		})
+
+		Convey("When the PID was reused by another process", func() {
+			So(createProcess(root, "42", "5000", "/usr/bin/other", "pid:[4026531836]"), ShouldBeNil)
+			p.CheckProcesses()
+
+			Convey("Then a security event should be reported and the PU destroyed", func() {
+				So(len(c.events), ShouldEqual, 1)
+				So(c.events[0].Event, ShouldEqual, collector.SecurityPIDRecycled)
+				So(c.events[0].PID, ShouldEqual, 42)
+				So(c.events[0].Details, ShouldContainSubstring, "start time 1000 changed to 5000")
+				So(puHandler.events, ShouldResemble, []monitor.Event{monitor.EventStop, monitor.EventDestroy})
+				So(netcls.ListAllCgroups(), ShouldBeEmpty)
+				So(p.processes, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the PU stopped and its PID was reused by another process", func() {
+			So(p.Stop(&rpcmonitor.EventInfo{PUID: "/trireme/1234", PID: "42"}), ShouldBeNil)
+			So(createProcess(root, "42", "5000", "/usr/bin/other", "pid:[4026531836]"), ShouldBeNil)
+			p.CheckProcesses()
+
+			Convey("Then the process should not be verified anymore", func() {
+				So(p.processes, ShouldBeEmpty)
+				So(c.events, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the process moved to another PID namespace", func() {
+			So(createProcess(root, "42", "1000", "/usr/bin/server", "pid:[4026532000]"), ShouldBeNil)
+			p.CheckProcesses()
+
+			Convey("Then a security event should be reported", func() {
+				So(len(c.events), ShouldEqual, 1)
+				So(c.events[0].Details, ShouldContainSubstring, "PID namespace")
+			})
+		})
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/aporeto-inc/trireme/collector"
@@ -22,6 +23,10 @@ type LinuxProcessor struct {
 	puHandler         monitor.ProcessingUnitsHandler
 	metadataExtractor rpcmonitor.RPCMetadataExtractor
 	netcls            cgnetcls.Cgroupnetcls
+	procRoot          string
+	// processes are the processes of the started PUs, verified by CheckProcesses
+	processes map[string]*trackedProcess
+	sync.Mutex
 }
 
 // NewLinuxProcessor initializes a processor
@@ -32,6 +37,8 @@ func NewLinuxProcessor(collector collector.EventCollector, puHandler monitor.Pro
 		puHandler:         puHandler,
 		metadataExtractor: metadataExtractor,
 		netcls:            cgnetcls.NewCgroupNetController(releasePath),
+		procRoot:          "/proc",
+		processes:         map[string]*trackedProcess{},
 	}
 }
 
@@ -60,12 +67,19 @@ func (s *LinuxProcessor) Create(eventInfo *rpcmonitor.EventInfo) error {
 // Start handles start events
 func (s *LinuxProcessor) Start(eventInfo *rpcmonitor.EventInfo) error {
 
+	return s.StartWithExtractor(eventInfo, s.metadataExtractor)
+}
+
+// StartWithExtractor handles the start events of a tenant of the monitor, with the
+// extractor of the tenant
+func (s *LinuxProcessor) StartWithExtractor(eventInfo *rpcmonitor.EventInfo, extractor rpcmonitor.RPCMetadataExtractor) error {
+
 	contextID, err := generateContextID(eventInfo)
 	if err != nil {
 		return err
 	}
 
-	runtimeInfo, err := s.metadataExtractor(eventInfo)
+	runtimeInfo, err := extractor(eventInfo)
 	if err != nil {
 		return err
 	}
@@ -130,6 +144,8 @@ func (s *LinuxProcessor) Start(eventInfo *rpcmonitor.EventInfo) error {
 			Tags:      runtimeInfo.Tags(),
 			Event:     collector.ContainerStart,
 		})
+
+		s.track(contextID, eventInfo)
 	}
 
 	// Store the state in the context store for future access
@@ -149,6 +165,9 @@ func (s *LinuxProcessor) Stop(eventInfo *rpcmonitor.EventInfo) error {
 		return nil
 	}
 
+	// The PID of a stopped PU may be reused by another process
+	s.untrack(eventInfo.PUID)
+
 	contextID = contextID[strings.LastIndex(contextID, "/"):]
 
 	// Send the event upstream
@@ -172,6 +191,8 @@ func (s *LinuxProcessor) Destroy(eventInfo *rpcmonitor.EventInfo) error {
 
 	contextID = contextID[strings.LastIndex(contextID, "/"):]
 
+	s.untrack(eventInfo.PUID)
+
 	contextStoreHdl := contextstore.NewContextStore()
 
 	s.netcls.Deletebasepath(contextID)
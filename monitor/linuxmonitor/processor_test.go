@@ -6,9 +6,9 @@ import (
 
 	"github.com/aporeto-inc/trireme/collector"
 	"github.com/aporeto-inc/trireme/constants"
-	"github.com/aporeto-inc/trireme/mock"
 	"github.com/aporeto-inc/trireme/monitor"
 	"github.com/aporeto-inc/trireme/monitor/linuxmonitor/cgnetcls/mock"
+	"github.com/aporeto-inc/trireme/monitor/mock"
 	"github.com/aporeto-inc/trireme/monitor/rpcmonitor"
 	"github.com/golang/mock/gomock"
 	. "github.com/smartystreets/goconvey/convey"
@@ -35,7 +35,7 @@ func TestCreate(t *testing.T) {
 	defer ctrl.Finish()
 
 	Convey("Given a valid processor", t, func() {
-		puHandler := mock_trireme.NewMockProcessingUnitsHandler(ctrl)
+		puHandler := mock_monitor.NewMockProcessingUnitsHandler(ctrl)
 		p := NewLinuxProcessor(&collector.DefaultCollector{}, puHandler, rpcmonitor.DefaultRPCMetadataExtractor, "")
 
 		Convey("When I get an event with no PUID", func() {
@@ -68,7 +68,7 @@ func TestStop(t *testing.T) {
 	defer ctrl.Finish()
 
 	Convey("Given a valid processor", t, func() {
-		puHandler := mock_trireme.NewMockProcessingUnitsHandler(ctrl)
+		puHandler := mock_monitor.NewMockProcessingUnitsHandler(ctrl)
 		p := NewLinuxProcessor(&collector.DefaultCollector{}, puHandler, rpcmonitor.DefaultRPCMetadataExtractor, "")
 		p.netcls = mock_cgnetcls.NewMockCgroupnetcls(ctrl)
 
@@ -114,7 +114,7 @@ func TestDestroy(t *testing.T) {
 	defer ctrl.Finish()
 
 	Convey("Given a valid processor", t, func() {
-		puHandler := mock_trireme.NewMockProcessingUnitsHandler(ctrl)
+		puHandler := mock_monitor.NewMockProcessingUnitsHandler(ctrl)
 		p := NewLinuxProcessor(&collector.DefaultCollector{}, puHandler, rpcmonitor.DefaultRPCMetadataExtractor, "")
 		mockcls := mock_cgnetcls.NewMockCgroupnetcls(ctrl)
 		p.netcls = mockcls
@@ -163,7 +163,7 @@ func TestPause(t *testing.T) {
 	defer ctrl.Finish()
 
 	Convey("Given a valid processor", t, func() {
-		puHandler := mock_trireme.NewMockProcessingUnitsHandler(ctrl)
+		puHandler := mock_monitor.NewMockProcessingUnitsHandler(ctrl)
 		p := NewLinuxProcessor(&collector.DefaultCollector{}, puHandler, rpcmonitor.DefaultRPCMetadataExtractor, "")
 
 		Convey("When I get a pause event with no PUID", func() {
@@ -197,7 +197,7 @@ func TestStart(t *testing.T) {
 	defer ctrl.Finish()
 
 	Convey("Given a valid processor", t, func() {
-		puHandler := mock_trireme.NewMockProcessingUnitsHandler(ctrl)
+		puHandler := mock_monitor.NewMockProcessingUnitsHandler(ctrl)
 		p := NewLinuxProcessor(&collector.DefaultCollector{}, puHandler, rpcmonitor.DefaultRPCMetadataExtractor, "")
 
 		Convey("When I get a start event with no PUID", func() {
@@ -0,0 +1,371 @@
+package linuxmonitor
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/monitor/linuxmonitor/cgnetcls"
+	"github.com/aporeto-inc/trireme/utils/clock"
+)
+
+const (
+	// maxCmdlineLength is the maximum length of the command line added to a flow record
+	maxCmdlineLength = 256
+
+	// tcpListenState is the state of a listening socket in /proc/net/tcp
+	tcpListenState = "0A"
+
+	// UnknownProcess is the process path of the flow records whose owner is not known
+	UnknownProcess = "unknown"
+
+	// DefaultSocketRefreshInterval is the maximum age of the sockets used to resolve
+	// the owners of the flows
+	DefaultSocketRefreshInterval = 5 * time.Second
+
+	// minSocketRefreshInterval is the minimum age of the sockets refreshed because
+	// the socket of a flow is not known yet
+	minSocketRefreshInterval = time.Second
+)
+
+// socketOwner is the process owning a socket, with the information added to the
+// flow records
+type socketOwner struct {
+	pid     string
+	path    string
+	cmdline string
+}
+
+// socketTuple identifies a connected socket by its local and remote addresses, as
+// host:port strings
+type socketTuple struct {
+	local  string
+	remote string
+}
+
+// newSocketTuple returns the tuple of the addresses and the ports. The IPv4 mapped
+// IPv6 addresses are the same as their IPv4 addresses.
+func newSocketTuple(localIP net.IP, localPort uint16, remoteIP net.IP, remotePort uint16) socketTuple {
+
+	return socketTuple{
+		local:  net.JoinHostPort(localIP.String(), strconv.Itoa(int(localPort))),
+		remote: net.JoinHostPort(remoteIP.String(), strconv.Itoa(int(remotePort))),
+	}
+}
+
+// procSockets are the TCP sockets of a /proc/net table, by inode
+type procSockets struct {
+	listening map[string]uint16
+	connected map[string]socketTuple
+}
+
+// ProcessInfoCollector is an EventCollector that adds the path and command line
+// of the process owning a flow to the flow records of Linux Process PUs. The
+// owner is the process of the PU whose connected socket has the addresses and the
+// ports of the flow, like the sockets of the outbound flows, or else the process of
+// the PU listening on the destination port of the flow. The sockets and their
+// processes are read from /proc in the background every DefaultSocketRefreshInterval
+// at most, never while a flow is reported. If no owner is found, the process path is
+// UnknownProcess.
+type ProcessInfoCollector struct {
+	collector     collector.EventCollector
+	procRoot      string
+	listProcesses func(cgroupName string) ([]string, error)
+	clock         clock.Clock
+
+	listeners   map[uint16][]*socketOwner
+	connections map[socketTuple][]*socketOwner
+	refreshed   time.Time
+	refreshing  bool
+	sync.Mutex
+}
+
+// NewProcessInfoCollector returns a ProcessInfoCollector wrapping the given collector
+func NewProcessInfoCollector(c collector.EventCollector) *ProcessInfoCollector {
+
+	return &ProcessInfoCollector{
+		collector:     c,
+		procRoot:      "/proc",
+		listProcesses: cgnetcls.ListCgroupProcesses,
+		clock:         clock.New(),
+		listeners:     map[uint16][]*socketOwner{},
+		connections:   map[socketTuple][]*socketOwner{},
+	}
+}
+
+// SetClock sets the clock of the refreshes of the sockets
+func (p *ProcessInfoCollector) SetClock(clk clock.Clock) {
+
+	p.Lock()
+	defer p.Unlock()
+
+	p.clock = clk
+}
+
+// CollectFlowEvent is part of the EventCollector interface.
+func (p *ProcessInfoCollector) CollectFlowEvent(record *collector.FlowRecord) {
+
+	if record.ProcessPath == "" {
+		p.enrich(record)
+	}
+
+	p.collector.CollectFlowEvent(record)
+}
+
+// CollectContainerEvent is part of the EventCollector interface.
+func (p *ProcessInfoCollector) CollectContainerEvent(record *collector.ContainerRecord) {
+
+	p.collector.CollectContainerEvent(record)
+}
+
+// enrich resolves the owner of a flow and adds its information to the record
+func (p *ProcessInfoCollector) enrich(record *collector.FlowRecord) {
+
+	// The context of a Linux Process PU is the name of its cgroup
+	if !strings.HasPrefix(record.ContextID, "/") {
+		return
+	}
+
+	pids, err := p.listProcesses(record.ContextID)
+	if err != nil || len(pids) == 0 {
+		return
+	}
+
+	owner := p.flowOwner(pids, record)
+	if owner == nil {
+		record.ProcessPath = UnknownProcess
+		return
+	}
+
+	record.ProcessPath = owner.path
+	record.ProcessCmdline = owner.cmdline
+}
+
+// flowOwner returns the process out of pids that owns the connected socket of the
+// flow in either direction, or else the one listening on its destination port. It
+// refreshes the sockets in the background when they are too old.
+func (p *ProcessInfoCollector) flowOwner(pids []string, record *collector.FlowRecord) *socketOwner {
+
+	p.Lock()
+	defer p.Unlock()
+
+	p.refreshAfter(DefaultSocketRefreshInterval)
+
+	source := net.ParseIP(record.SourceIP)
+	destination := net.ParseIP(record.DestinationIP)
+
+	if record.SourcePort != 0 && source != nil && destination != nil {
+		// The socket of an outbound flow, then the one of an accepted connection
+		tuples := []socketTuple{
+			newSocketTuple(source, record.SourcePort, destination, record.DestinationPort),
+			newSocketTuple(destination, record.DestinationPort, source, record.SourcePort),
+		}
+
+		for _, tuple := range tuples {
+			if owner := ownerOf(p.connections[tuple], pids); owner != nil {
+				return owner
+			}
+		}
+	}
+
+	if owner := ownerOf(p.listeners[record.DestinationPort], pids); owner != nil {
+		return owner
+	}
+
+	// The socket may have been created since the refresh, like the one of a new
+	// outbound connection, and be known for the next records of the flow
+	if record.SourcePort != 0 {
+		p.refreshAfter(minSocketRefreshInterval)
+	}
+
+	return nil
+}
+
+// refreshAfter refreshes the sockets in the background if they are older than the
+// interval. The lock must be held.
+func (p *ProcessInfoCollector) refreshAfter(interval time.Duration) {
+
+	if !p.refreshing && p.clock.Now().Sub(p.refreshed) > interval {
+		p.refreshing = true
+		go p.refresh()
+	}
+}
+
+// ownerOf returns the first owner out of pids
+func ownerOf(owners []*socketOwner, pids []string) *socketOwner {
+
+	for _, owner := range owners {
+		for _, pid := range pids {
+			if owner.pid == pid {
+				return owner
+			}
+		}
+	}
+
+	return nil
+}
+
+// refresh reads the sockets and the processes owning them from /proc
+func (p *ProcessInfoCollector) refresh() {
+
+	sockets := &procSockets{
+		listening: map[string]uint16{},
+		connected: map[string]socketTuple{},
+	}
+	for _, file := range []string{"tcp", "tcp6"} {
+		p.readSockets(filepath.Join(p.procRoot, "net", file), sockets)
+	}
+
+	listeners := map[uint16][]*socketOwner{}
+	connections := map[socketTuple][]*socketOwner{}
+
+	if len(sockets.listening) > 0 || len(sockets.connected) > 0 {
+		procs, err := ioutil.ReadDir(p.procRoot)
+		if err == nil {
+			for _, proc := range procs {
+				if _, err := strconv.Atoi(proc.Name()); err != nil {
+					continue
+				}
+				p.addOwner(proc.Name(), sockets, listeners, connections)
+			}
+		}
+	}
+
+	p.Lock()
+	p.listeners = listeners
+	p.connections = connections
+	p.refreshed = p.clock.Now()
+	p.refreshing = false
+	p.Unlock()
+}
+
+// addOwner adds the process to the owners of its listening and connected sockets
+func (p *ProcessInfoCollector) addOwner(pid string, sockets *procSockets, listeners map[uint16][]*socketOwner, connections map[socketTuple][]*socketOwner) {
+
+	fdDir := filepath.Join(p.procRoot, pid, "fd")
+	fds, err := ioutil.ReadDir(fdDir)
+	if err != nil {
+		return
+	}
+
+	var info *socketOwner
+	added := map[uint16]bool{}
+
+	for _, fd := range fds {
+		link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+		if err != nil || !strings.HasPrefix(link, "socket:[") {
+			continue
+		}
+
+		inode := strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")
+
+		port, listening := sockets.listening[inode]
+		tuple, connected := sockets.connected[inode]
+		if (!listening || added[port]) && !connected {
+			continue
+		}
+
+		if info == nil {
+			exe, err := os.Readlink(filepath.Join(p.procRoot, pid, "exe"))
+			if err != nil {
+				return
+			}
+			info = &socketOwner{pid: pid, path: exe}
+			if cmdline, err := ioutil.ReadFile(filepath.Join(p.procRoot, pid, "cmdline")); err == nil {
+				info.cmdline = formatCmdline(cmdline)
+			}
+		}
+
+		if connected {
+			connections[tuple] = append(connections[tuple], info)
+			continue
+		}
+
+		added[port] = true
+		listeners[port] = append(listeners[port], info)
+	}
+}
+
+// readSockets adds to the sockets the listening and the connected sockets of a
+// /proc/net table
+func (p *ProcessInfoCollector) readSockets(table string, sockets *procSockets) {
+
+	file, err := os.Open(table)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[9] == "0" {
+			continue
+		}
+
+		localIP, localPort, err := parseProcAddress(fields[1])
+		if err != nil {
+			continue
+		}
+
+		if fields[3] == tcpListenState {
+			sockets.listening[fields[9]] = localPort
+			continue
+		}
+
+		remoteIP, remotePort, err := parseProcAddress(fields[2])
+		if err != nil {
+			continue
+		}
+
+		sockets.connected[fields[9]] = newSocketTuple(localIP, localPort, remoteIP, remotePort)
+	}
+}
+
+// parseProcAddress parses an address of a /proc/net table. The address is made of
+// 32 bit words in host order, which is little endian on the supported hosts.
+func parseProcAddress(address string) (net.IP, uint16, error) {
+
+	parts := strings.Split(address, ":")
+	if len(parts) != 2 {
+		return nil, 0, fmt.Errorf("Invalid socket address %s", address)
+	}
+
+	raw, err := hex.DecodeString(parts[0])
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return nil, 0, fmt.Errorf("Invalid socket address %s", address)
+	}
+
+	ip := make(net.IP, len(raw))
+	for i := 0; i < len(raw); i += 4 {
+		ip[i], ip[i+1], ip[i+2], ip[i+3] = raw[i+3], raw[i+2], raw[i+1], raw[i]
+	}
+
+	port, err := strconv.ParseUint(parts[1], 16, 16)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Invalid socket port %s", address)
+	}
+
+	return ip, uint16(port), nil
+}
+
+// formatCmdline converts a NUL separated command line into a truncated string
+func formatCmdline(cmdline []byte) string {
+
+	s := strings.TrimSpace(strings.Replace(string(cmdline), "\x00", " ", -1))
+	if len(s) > maxCmdlineLength {
+		s = s[:maxCmdlineLength]
+	}
+
+	return s
+}
@@ -0,0 +1,198 @@
+package linuxmonitor
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/utils/clock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type flowCollector struct {
+	collector.DefaultCollector
+	records []*collector.FlowRecord
+}
+
+func (c *flowCollector) CollectFlowEvent(record *collector.FlowRecord) {
+	c.records = append(c.records, record)
+}
+
+// createProc creates a fake proc tree where process 20 listens on port 80 and
+// process 10 connects from 10.0.0.5:40000 to 93.184.216.34:443
+func createProc(root string) error {
+
+	tcp := "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n" +
+		"   0: 00000000:0050 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 12345 1 0000000000000000 100 0 0 10 0\n" +
+		"   1: 0500000A:9C40 22D8B85D:01BB 02 00000000:00000000 01:00000064 00000000     0        0 23456 1 0000000000000000 100 0 0 10 0\n"
+
+	if err := os.MkdirAll(filepath.Join(root, "net"), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "net", "tcp"), []byte(tcp), 0644); err != nil {
+		return err
+	}
+
+	for _, pid := range []string{"10", "20"} {
+		if err := os.MkdirAll(filepath.Join(root, pid, "fd"), 0755); err != nil {
+			return err
+		}
+		if err := os.Symlink("/usr/bin/server"+pid, filepath.Join(root, pid, "exe")); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filepath.Join(root, pid, "cmdline"), []byte("server"+pid+"\x00--port\x0080\x00"), 0644); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Symlink("socket:[23456]", filepath.Join(root, "10", "fd", "4")); err != nil {
+		return err
+	}
+
+	return os.Symlink("socket:[12345]", filepath.Join(root, "20", "fd", "3"))
+}
+
+func TestProcessInfoCollector(t *testing.T) {
+	Convey("Given a process info collector over a fake proc tree", t, func() {
+		root, err := ioutil.TempDir("", "procinfo")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(root)
+		So(createProc(root), ShouldBeNil)
+
+		now := time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC)
+		fake := clock.NewFake(now)
+
+		c := &flowCollector{}
+		p := NewProcessInfoCollector(c)
+		p.SetClock(fake)
+		p.procRoot = root
+		p.listProcesses = func(cgroupName string) ([]string, error) {
+			return []string{"10", "20"}, nil
+		}
+		p.refresh()
+
+		Convey("When I collect a flow to the listening port", func() {
+			p.CollectFlowEvent(&collector.FlowRecord{ContextID: "/10", DestinationPort: 80})
+
+			Convey("The record should carry the listening process", func() {
+				So(len(c.records), ShouldEqual, 1)
+				So(c.records[0].ProcessPath, ShouldEqual, "/usr/bin/server20")
+				So(c.records[0].ProcessCmdline, ShouldEqual, "server20 --port 80")
+			})
+		})
+
+		Convey("When I collect an outbound flow of the PU", func() {
+			p.CollectFlowEvent(&collector.FlowRecord{
+				ContextID:       "/10",
+				SourceIP:        "10.0.0.5",
+				SourcePort:      40000,
+				DestinationIP:   "93.184.216.34",
+				DestinationPort: 443,
+			})
+
+			Convey("The record should carry the process of the connected socket", func() {
+				So(c.records[0].ProcessPath, ShouldEqual, "/usr/bin/server10")
+			})
+		})
+
+		Convey("When I collect a flow after the refresh interval", func() {
+			So(p.refreshed, ShouldResemble, now)
+
+			fake.Advance(DefaultSocketRefreshInterval + time.Second)
+			p.CollectFlowEvent(&collector.FlowRecord{ContextID: "/10", DestinationPort: 80})
+
+			Convey("The sockets should be refreshed with the time of the clock", func() {
+				refreshed := func() time.Time {
+					p.Lock()
+					defer p.Unlock()
+					return p.refreshed
+				}
+
+				for i := 0; i < 100 && refreshed().Equal(now); i++ {
+					time.Sleep(10 * time.Millisecond)
+				}
+				So(refreshed(), ShouldResemble, fake.Now())
+			})
+		})
+
+		Convey("When I collect a flow to another port", func() {
+			p.CollectFlowEvent(&collector.FlowRecord{ContextID: "/10", DestinationPort: 443})
+
+			Convey("The record should carry an unknown process", func() {
+				So(c.records[0].ProcessPath, ShouldEqual, UnknownProcess)
+				So(c.records[0].ProcessCmdline, ShouldEqual, "")
+			})
+		})
+
+		Convey("When the proc tree is removed after the refresh", func() {
+			So(os.RemoveAll(root), ShouldBeNil)
+			p.CollectFlowEvent(&collector.FlowRecord{ContextID: "/10", DestinationPort: 80})
+
+			Convey("The record should carry the listening process read at the refresh", func() {
+				So(c.records[0].ProcessPath, ShouldEqual, "/usr/bin/server20")
+			})
+		})
+
+		Convey("When the port is owned by a process of another PU", func() {
+			p.listProcesses = func(cgroupName string) ([]string, error) {
+				return []string{"10"}, nil
+			}
+			p.CollectFlowEvent(&collector.FlowRecord{ContextID: "/10", DestinationPort: 80})
+
+			Convey("The record should carry an unknown process", func() {
+				So(c.records[0].ProcessPath, ShouldEqual, UnknownProcess)
+			})
+		})
+
+		Convey("When I collect a flow of a container", func() {
+			p.CollectFlowEvent(&collector.FlowRecord{ContextID: "c9f2a1", DestinationPort: 80})
+
+			Convey("The record should not be modified", func() {
+				So(c.records[0].ProcessPath, ShouldEqual, "")
+			})
+		})
+	})
+}
+
+func TestParseProcAddress(t *testing.T) {
+	Convey("When I parse the addresses of the /proc/net tables", t, func() {
+
+		Convey("An IPv4 address should be parsed", func() {
+			ip, port, err := parseProcAddress("0100007F:1F90")
+			So(err, ShouldBeNil)
+			So(ip.Equal(net.ParseIP("127.0.0.1")), ShouldBeTrue)
+			So(port, ShouldEqual, 8080)
+		})
+
+		Convey("An IPv6 address should be parsed", func() {
+			ip, port, err := parseProcAddress("00000000000000000000000001000000:0050")
+			So(err, ShouldBeNil)
+			So(ip.Equal(net.ParseIP("::1")), ShouldBeTrue)
+			So(port, ShouldEqual, 80)
+		})
+
+		Convey("An invalid address should be rejected", func() {
+			_, _, err := parseProcAddress("0100007F")
+			So(err, ShouldNotBeNil)
+
+			_, _, err = parseProcAddress("ZZ:0050")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestFormatCmdline(t *testing.T) {
+	Convey("When I format a long command line", t, func() {
+		cmdline := formatCmdline([]byte(strings.Repeat("a\x00", maxCmdlineLength)))
+
+		Convey("It should be truncated", func() {
+			So(len(cmdline), ShouldEqual, maxCmdlineLength)
+			So(strings.Contains(cmdline, "\x00"), ShouldBeFalse)
+		})
+	})
+}
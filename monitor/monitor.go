@@ -1,26 +1,32 @@
 package monitor
 
+import "github.com/aporeto-inc/trireme/api/events"
+
 // Event represents the event picked up by the monitor.
-type Event string
+type Event = events.Event
 
 const (
 	// EventStart is the event generated when a PU starts.
-	EventStart Event = "start"
+	EventStart = events.EventStart
 
 	// EventStop is the event generated when a PU stops/dies.
-	EventStop Event = "stop"
+	EventStop = events.EventStop
 
 	// EventCreate is the event generated when a PU gets created.
-	EventCreate Event = "create"
+	EventCreate = events.EventCreate
 
 	// EventDestroy is the event generated when a PU is definitely removed.
-	EventDestroy Event = "destroy"
+	EventDestroy = events.EventDestroy
 
 	// EventPause is the event generated when a PU is set to pause.
-	EventPause Event = "pause"
+	EventPause = events.EventPause
 
 	// EventUnpause is the event generated when a PU is unpaused.
-	EventUnpause Event = "unpause"
+	EventUnpause = events.EventUnpause
+
+	// EventUpdate is the event generated when the runtime of a running PU changes,
+	// like its IP addresses.
+	EventUpdate = events.EventUpdate
 )
 
 // A State describes the state of the PU.
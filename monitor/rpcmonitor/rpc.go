@@ -1,6 +1,8 @@
 package rpcmonitor
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"net"
@@ -18,6 +20,9 @@ import (
 	"github.com/aporeto-inc/trireme/monitor/contextstore"
 	"github.com/aporeto-inc/trireme/monitor/linuxmonitor/cgnetcls"
 	"github.com/aporeto-inc/trireme/policy"
+	"github.com/aporeto-inc/trireme/utils/selfprotect"
+	"github.com/aporeto-inc/trireme/utils/sockets"
+	"github.com/aporeto-inc/trireme/utils/tracing"
 )
 
 // RPCMetadataExtractor is a function used to extract a *policy.PURuntime from a given
@@ -30,30 +35,48 @@ type RPCEventHandler func(*EventInfo) error
 // RPCMonitor implements the RPC connection
 type RPCMonitor struct {
 	rpcAddress    string
+	network       string
+	address       string
+	tlsConfig     *tls.Config
+	sockets       *sockets.Options
+	summaries     bool
+	watchStore    bool
+	stopWatch     chan struct{}
+	background    []BackgroundProcessor
+	stopTasks     chan struct{}
 	rpcServer     *rpc.Server
 	monitorServer *Server
 	listensock    net.Listener
 	contextstore  contextstore.ContextStore
+	netcls        cgnetcls.Cgroupnetcls
 	collector     collector.EventCollector
 	puHandler     monitor.ProcessingUnitsHandler
+	tenantConfigs []Tenant
+	tenantDir     string
+	tenants       []*tenantServer
 }
 
 // Server represents the Monitor RPC Server implementation
 type Server struct {
 	handlers map[constants.PUType]map[monitor.Event]RPCEventHandler
+	// summarizer summarizes the policies returned to the callers, if enabled
+	summarizer monitor.PolicySummarizer
+	// tenant is the tenant of the events of the server, if any
+	tenant *Tenant
 }
 
-// NewRPCMonitor returns a base RPC monitor. Processors must be registered externally
-func NewRPCMonitor(rpcAddress string, puHandler monitor.ProcessingUnitsHandler, collector collector.EventCollector) (*RPCMonitor, error) {
+// NewRPCMonitor returns a base RPC monitor. Processors must be registered externally.
+// The address is the path of a unix socket, or tcp://host:port for a monitor receiving
+// the events of another network namespace, usually with the WithTLS option.
+func NewRPCMonitor(rpcAddress string, puHandler monitor.ProcessingUnitsHandler, collector collector.EventCollector, opts ...Option) (*RPCMonitor, error) {
 
 	if rpcAddress == "" {
 		return nil, fmt.Errorf("RPC endpoint address invalid")
 	}
 
-	if _, err := os.Stat(rpcAddress); err == nil {
-		if err := os.Remove(rpcAddress); err != nil {
-			return nil, fmt.Errorf("Failed to clean up rpc socket")
-		}
+	network, address, err := parseRPCAddress(rpcAddress)
+	if err != nil {
+		return nil, fmt.Errorf("RPC endpoint address invalid: %s", err)
 	}
 
 	if puHandler == nil {
@@ -66,40 +89,90 @@ func NewRPCMonitor(rpcAddress string, puHandler monitor.ProcessingUnitsHandler,
 
 	r := &RPCMonitor{
 		rpcAddress:    rpcAddress,
+		network:       network,
+		address:       address,
 		monitorServer: monitorServer,
 		contextstore:  contextstore.NewContextStore(),
+		netcls:        cgnetcls.NewCgroupNetController(""),
 		collector:     collector,
+		puHandler:     puHandler,
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if r.summaries {
+		summarizer, ok := puHandler.(monitor.PolicySummarizer)
+		if !ok {
+			return nil, fmt.Errorf("PU Handler cannot summarize the policies")
+		}
+		monitorServer.summarizer = summarizer
+	}
+
+	if network == "tcp" && r.tlsConfig == nil {
+		log.WithFields(log.Fields{
+			"package": "RPCMonitor",
+			"address": address,
+		}).Warn("RPC monitor listening on TCP without TLS")
 	}
 
 	// Registering the monitorRPCServer as an RPC Server.
 	r.rpcServer = rpc.NewServer()
-	err := r.rpcServer.Register(r.monitorServer)
+	err = r.rpcServer.Register(r.monitorServer)
 	if err != nil {
-		log.Fatalf("Format of service MonitorServer isn't correct. %s", err)
+		return nil, fmt.Errorf("Format of service MonitorServer isn't correct: %s", err)
+	}
+
+	if r.tenants, err = r.newTenantServers(); err != nil {
+		return nil, err
 	}
 
 	return r, nil
 }
 
 // RegisterProcessor registers an event processor for a given PUTYpe. Only one
-// processor is allowed for a given PU Type.
+// processor is allowed for a given PU Type. The processor handles the events of the
+// tenants of the PU type as well.
 func (r *RPCMonitor) RegisterProcessor(puType constants.PUType, processor MonitorProcessor) error {
 	if _, ok := r.monitorServer.handlers[puType]; ok {
 		return fmt.Errorf("Processor already registered for this PU type %d ", puType)
 	}
 
-	r.monitorServer.handlers[puType] = map[monitor.Event]RPCEventHandler{}
+	if err := r.registerTenantProcessor(puType, processor); err != nil {
+		return err
+	}
 
-	r.monitorServer.addHandler(puType, monitor.EventStart, processor.Start)
-	r.monitorServer.addHandler(puType, monitor.EventStop, processor.Stop)
-	r.monitorServer.addHandler(puType, monitor.EventCreate, processor.Create)
-	r.monitorServer.addHandler(puType, monitor.EventDestroy, processor.Destroy)
-	r.monitorServer.addHandler(puType, monitor.EventPause, processor.Pause)
+	r.monitorServer.addProcessor(puType, processor, nil)
+
+	if b, ok := processor.(BackgroundProcessor); ok {
+		r.background = append(r.background, b)
+	}
 
 	return nil
 }
 
-// reSync resyncs with all the existing services that were there before we start
+// startProcessors runs the tasks of the background processors until the monitor stops
+func (r *RPCMonitor) startProcessors() {
+
+	r.stopTasks = make(chan struct{})
+
+	for _, processor := range r.background {
+		go processor.Run(r.stopTasks)
+	}
+}
+
+// stopProcessors stops the tasks of the background processors
+func (r *RPCMonitor) stopProcessors() {
+
+	if r.stopTasks != nil {
+		close(r.stopTasks)
+		r.stopTasks = nil
+	}
+}
+
+// reSync resyncs with all the existing services that were there before we start.
+// The cgroups of the services that are not restored are deleted.
 func (r *RPCMonitor) reSync() error {
 
 	var eventInfo EventInfo
@@ -110,9 +183,9 @@ func (r *RPCMonitor) reSync() error {
 
 		return fmt.Errorf("error in accessing context store")
 	}
-	//This is create to only delete if required don't create groups using this handle here
-	cgnetclshandle := cgnetcls.NewCgroupNetController("")
+
 	cstorehandle := contextstore.NewContextStore()
+	active := map[string]bool{}
 	for {
 		contextID := <-walker
 		if contextID == "" {
@@ -125,7 +198,7 @@ func (r *RPCMonitor) reSync() error {
 			if err := json.Unmarshal(data.([]byte), &eventInfo); err != nil {
 				return fmt.Errorf("error in umarshalling date")
 			}
-			processlist, err := cgnetcls.ListCgroupProcesses(eventInfo.PUID)
+			processlist, err := r.netcls.ListCgroupProcesses(eventInfo.PUID)
 
 			if err != nil {
 				cstorehandle.RemoveContext(eventInfo.PUID)
@@ -136,26 +209,33 @@ func (r *RPCMonitor) reSync() error {
 			if len(processlist) <= 0 {
 				//We have an empty cgroup
 				//Remove the cgroup and context store file
-				cgnetclshandle.DeleteCgroup(eventInfo.PUID)
+				r.netcls.DeleteCgroup(eventInfo.PUID)
 				cstorehandle.RemoveContext(eventInfo.PUID)
 				continue
 			}
-			f, _ := r.monitorServer.handlers[eventInfo.PUType][monitor.EventStart]
+			// The PUs of a tenant are restored with the extractor of the tenant
+			f, _ := r.serverOf(eventInfo.Tenant).handlers[eventInfo.PUType][monitor.EventStart]
 
 			if err := f(&eventInfo); err != nil {
 				return fmt.Errorf("error in processing existing data")
 			}
+
+			active[eventInfo.PUID] = true
 		}
 	}
 
+	if r.netcls != nil {
+		cgnetcls.CleanupOrphans(r.netcls, active)
+	}
+
 	return nil
 }
 
-// processRequests processes the RPC requests
-func (r *RPCMonitor) processRequests() {
+// processRequests processes the RPC requests of a listener
+func (r *RPCMonitor) processRequests(listener net.Listener, rpcServer *rpc.Server) {
 	for {
 
-		conn, err := r.listensock.Accept()
+		conn, err := listener.Accept()
 		if err != nil {
 			if !strings.Contains(err.Error(), "closed") {
 				log.WithFields(log.Fields{
@@ -166,7 +246,7 @@ func (r *RPCMonitor) processRequests() {
 			break
 		}
 
-		r.rpcServer.ServeCodec(jsonrpc.NewServerCodec(conn))
+		rpcServer.ServeCodec(jsonrpc.NewServerCodec(conn))
 	}
 }
 
@@ -189,34 +269,80 @@ func (r *RPCMonitor) Start() error {
 		}).Error("Failed to resync existing services")
 	}
 
-	if r.listensock, err = net.Listen("unix", r.rpcAddress); err != nil {
+	if r.watchStore {
+		if err = r.startStoreWatcher(); err != nil {
+			return err
+		}
+	}
+
+	if r.listensock, err = r.listen(r.network, r.address, r.sockets); err != nil {
 		log.WithFields(log.Fields{"package": "RPCMonitor",
 			"error":    err.Error(),
 			"message:": "Starting",
 		}).Info("Failed RPC monitor")
+		r.stopStoreWatcher()
 		return fmt.Errorf("couldn't create binding: %s", err)
 	}
 
-	if err = os.Chmod(r.rpcAddress, 0766); err != nil {
-		log.WithFields(log.Fields{"package": "RPCMonitor",
-			"error":    err.Error(),
-			"message:": "Failed to adjust permissions on rpc socket path",
-		}).Info("Failed RPC monitor")
-		return fmt.Errorf("couldn't create binding: %s", err)
+	if err = r.listenTenants(); err != nil {
+		r.listensock.Close()
+		r.stopStoreWatcher()
+		return err
 	}
 
+	r.startProcessors()
+
 	//Launch a go func to accept connections
-	go r.processRequests()
+	go r.processRequests(r.listensock, r.rpcServer)
 
 	return nil
 }
 
+// listen returns the listener of a socket of the monitor
+func (r *RPCMonitor) listen(network string, address string, options *sockets.Options) (net.Listener, error) {
+
+	var listener net.Listener
+	var err error
+
+	// The stale unix socket is removed, and the socket gets the mode and the
+	// ownership of the socket options
+	if network == "unix" {
+		listener, err = sockets.ListenWithOptions(address, options)
+	} else {
+		listener, err = net.Listen(network, address)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if network == "unix" {
+		// The socket is open to the users of the socket options, but not to the
+		// processing units
+		listener = selfprotect.NewWorkloadFilter(listener)
+	}
+
+	// The workload filter needs the unix connection, so TLS is layered over it
+	if r.tlsConfig != nil {
+		listener = tls.NewListener(listener, r.tlsConfig)
+	}
+
+	return listener, nil
+}
+
 // Stop monitoring RPC events.
 func (r *RPCMonitor) Stop() error {
 
+	r.stopStoreWatcher()
+	r.stopProcessors()
+
 	r.listensock.Close()
 
-	os.RemoveAll(r.rpcAddress)
+	if r.network == "unix" {
+		os.RemoveAll(r.address)
+	}
+
+	r.closeTenants()
 
 	return nil
 }
@@ -226,17 +352,56 @@ func (s *Server) addHandler(puType constants.PUType, event monitor.Event, handle
 	s.handlers[puType][event] = handler
 }
 
+// addProcessor adds the handlers of the events of a processor. The runtime of the PUs
+// is extracted with the extractor, if any, instead of the extractor of the processor.
+func (s *Server) addProcessor(puType constants.PUType, processor MonitorProcessor, extractor RPCMetadataExtractor) {
+
+	s.handlers[puType] = map[monitor.Event]RPCEventHandler{}
+
+	start := processor.Start
+	if extractor != nil {
+		start = func(eventInfo *EventInfo) error {
+			return processor.(ExtractorProcessor).StartWithExtractor(eventInfo, extractor)
+		}
+	}
+
+	s.addHandler(puType, monitor.EventStart, start)
+	s.addHandler(puType, monitor.EventStop, processor.Stop)
+	s.addHandler(puType, monitor.EventCreate, processor.Create)
+	s.addHandler(puType, monitor.EventDestroy, processor.Destroy)
+	s.addHandler(puType, monitor.EventPause, processor.Pause)
+}
+
 // HandleEvent Gets called when clients generate events.
-func (s *Server) HandleEvent(eventInfo *EventInfo, result *RPCResponse) error {
+func (s *Server) HandleEvent(eventInfo *EventInfo, result *RPCResponse) (err error) {
+
+	ctx, span := tracing.Start(tracing.Extract(context.Background(), eventInfo.Metadata), "rpcmonitor.HandleEvent")
+	span.SetAttribute(tracing.ContextIDAttribute, eventInfo.PUID)
+	span.SetAttribute(tracing.EventAttribute, string(eventInfo.EventType))
+	defer func() {
+		tracing.End(span, err)
+	}()
+
+	if err := ValidateEvent(eventInfo); err != nil {
+		result.Error = err.Error()
+		return err
+	}
 
-	if eventInfo.EventType == "" {
-		return fmt.Errorf("Invalid event type")
+	if err := s.tenantEvent(eventInfo); err != nil {
+		result.Error = err.Error()
+		return err
 	}
 
 	if _, ok := s.handlers[eventInfo.PUType]; ok {
 		f, present := s.handlers[eventInfo.PUType][eventInfo.EventType]
 		if present {
-			if err := f(eventInfo); err != nil {
+			// The processors use the PUID as the context of the PU. Its operations
+			// are traced as children of the event while it is handled.
+			unbind := tracing.Bind(eventInfo.PUID, ctx)
+			err := f(eventInfo)
+			unbind()
+
+			if err != nil {
 				log.WithFields(log.Fields{
 					"package": "monitor",
 					"error":   err.Error(),
@@ -244,11 +409,18 @@ func (s *Server) HandleEvent(eventInfo *EventInfo, result *RPCResponse) error {
 				result.Error = err.Error()
 				return err
 			}
+
+			if s.summarizer != nil && eventInfo.EventType == monitor.EventStart {
+				if summary, err := s.summarizer.PolicySummary(eventInfo.PUID); err == nil {
+					result.Policy = summary
+				}
+			}
+
 			return nil
 		}
 	}
 
-	err := fmt.Errorf("No handler found for the event")
+	err = fmt.Errorf("No handler found for the event")
 	result.Error = err.Error()
 	return err
 
@@ -261,7 +433,7 @@ func DefaultRPCMetadataExtractor(event *EventInfo) (*policy.PURuntime, error) {
 		return nil, fmt.Errorf("EventInfo PU Name is empty")
 	}
 
-	if event.PID == "" {
+	if event.PID == "" && event.NetNSPath == "" {
 		return nil, fmt.Errorf("EventInfo PID is empty")
 	}
 
@@ -271,6 +443,12 @@ func DefaultRPCMetadataExtractor(event *EventInfo) (*policy.PURuntime, error) {
 
 	runtimeTags := policy.NewTagsMap(event.Tags)
 	runtimeIps := policy.NewIPMap(event.IPs)
+
+	if event.NetNSPath != "" {
+		options := policy.NewTagsMap(map[string]string{policy.NetNSPathOption: event.NetNSPath})
+		return policy.NewPURuntime(event.Name, 0, runtimeTags, runtimeIps, constants.ContainerPU, options), nil
+	}
+
 	runtimePID, err := strconv.Atoi(event.PID)
 	if err != nil {
 		return nil, fmt.Errorf("PID is invalid: %s", err)
@@ -118,6 +118,40 @@ func TestRegisterProcessor(t *testing.T) {
 	})
 }
 
+// backgroundProcessor is a processor with a background task
+type backgroundProcessor struct {
+	CustomProcessor
+	running chan bool
+	stopped chan bool
+}
+
+func (p *backgroundProcessor) Run(stop <-chan struct{}) {
+	p.running <- true
+	<-stop
+	p.stopped <- true
+}
+
+func TestBackgroundProcessors(t *testing.T) {
+	Convey("Given a new rpc monitor with a background processor", t, func() {
+		mon, _ := NewRPCMonitor(testRPCAddress, &CustomPolicyResolver{}, nil)
+		processor := &backgroundProcessor{running: make(chan bool, 1), stopped: make(chan bool, 1)}
+		So(mon.RegisterProcessor(constants.LinuxProcessPU, processor), ShouldBeNil)
+
+		Convey("When the processors are started and stopped", func() {
+			mon.startProcessors()
+			running := <-processor.running
+			mon.stopProcessors()
+			stopped := <-processor.stopped
+
+			Convey("Then the task should run until the monitor stops", func() {
+				So(running, ShouldBeTrue)
+				So(stopped, ShouldBeTrue)
+				So(mon.stopTasks, ShouldBeNil)
+			})
+		})
+	})
+}
+
 func TestStart(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -388,6 +422,25 @@ func TestDefaultRPCMetadataExtractor(t *testing.T) {
 			})
 		})
 
+		Convey("If the PU is identified by a network namespace path", func() {
+			eventInfo := &EventInfo{
+				Name:      "PU",
+				PUID:      "12345",
+				NetNSPath: "/var/run/netns/appliance",
+				EventType: monitor.EventStart,
+				PUType:    constants.ContainerPU,
+			}
+
+			Convey("The default extractor must return the path in the runtime", func() {
+				runtime, err := DefaultRPCMetadataExtractor(eventInfo)
+				So(err, ShouldBeNil)
+				So(runtime.Pid(), ShouldEqual, 0)
+				path, ok := runtime.NetNSPath()
+				So(ok, ShouldBeTrue)
+				So(path, ShouldEqual, "/var/run/netns/appliance")
+			})
+		})
+
 	})
 }
 
@@ -420,3 +473,63 @@ func TestResync(t *testing.T) {
 		})
 	})
 }
+
+type summarizingPolicyResolver struct {
+	monitor.ProcessingUnitsHandler
+	summaries map[string]*monitor.PolicySummary
+}
+
+func (s *summarizingPolicyResolver) PolicySummary(contextID string) (*monitor.PolicySummary, error) {
+
+	if summary, ok := s.summaries[contextID]; ok {
+		return summary, nil
+	}
+
+	return nil, fmt.Errorf("No policy")
+}
+
+func TestPolicySummary(t *testing.T) {
+
+	Convey("Given a PU handler that does not summarize the policies", t, func() {
+
+		Convey("The monitor should not return the summaries", func() {
+			_, err := NewRPCMonitor(testRPCAddress, &CustomPolicyResolver{}, nil, WithPolicySummary())
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given an RPC monitor returning the summaries of the policies", t, func() {
+
+		summary := &monitor.PolicySummary{Revision: "r1", DefaultAction: "reject", Rules: 3, Mode: "enforced"}
+		puHandler := &summarizingPolicyResolver{summaries: map[string]*monitor.PolicySummary{"/1234": summary}}
+
+		mon, err := NewRPCMonitor(testRPCAddress, puHandler, nil, WithPolicySummary())
+		So(err, ShouldBeNil)
+
+		mon.monitorServer.handlers[constants.LinuxProcessPU] = map[monitor.Event]RPCEventHandler{
+			monitor.EventStart: func(*EventInfo) error { return nil },
+			monitor.EventStop:  func(*EventInfo) error { return nil },
+		}
+
+		Convey("The start events should return the summary of the policy of the PU", func() {
+			response := &RPCResponse{}
+			err := mon.monitorServer.HandleEvent(&EventInfo{EventType: monitor.EventStart, PUType: constants.LinuxProcessPU, PUID: "/1234"}, response)
+			So(err, ShouldBeNil)
+			So(response.Policy, ShouldResemble, summary)
+		})
+
+		Convey("The other events should not return a summary", func() {
+			response := &RPCResponse{}
+			err := mon.monitorServer.HandleEvent(&EventInfo{EventType: monitor.EventStop, PUType: constants.LinuxProcessPU, PUID: "/1234"}, response)
+			So(err, ShouldBeNil)
+			So(response.Policy, ShouldBeNil)
+		})
+
+		Convey("The start events of a PU without policy should not return a summary", func() {
+			response := &RPCResponse{}
+			err := mon.monitorServer.HandleEvent(&EventInfo{EventType: monitor.EventStart, PUType: constants.LinuxProcessPU, PUID: "/5678"}, response)
+			So(err, ShouldBeNil)
+			So(response.Policy, ShouldBeNil)
+		})
+	})
+}
@@ -1,46 +1,23 @@
 package rpcmonitor
 
-import (
-	"github.com/aporeto-inc/trireme/constants"
-	"github.com/aporeto-inc/trireme/monitor"
-)
+import "github.com/aporeto-inc/trireme/api/events"
 
 const (
 
 	// DefaultRPCAddress is the default Linux socket for the RPC monitor
-	DefaultRPCAddress = "/var/run/trireme.sock"
+	DefaultRPCAddress = events.DefaultRPCAddress
+
+	// CurrentEventVersion is the version of the schema of the events sent by the
+	// clients of this package
+	CurrentEventVersion = events.CurrentEventVersion
 )
 
 // EventInfo is a generic structure that defines all the information related to a PU event.
-// EventInfo should be used as a normalized struct container that
-type EventInfo struct {
-
-	// EventType refers to one of the standard events that Trireme handles.
-	EventType monitor.Event
-
-	// PUType is the the type of the PU
-	PUType constants.PUType
-
-	// The PUID is a unique value for the Processing Unit. Ideally this should be the UUID.
-	PUID string
-
-	// The Name is a user-friendly name for the Processing Unit.
-	Name string
-
-	// Tags represents the set of MetadataTags associated with this PUID.
-	Tags map[string]string
-
-	// The PID is the PID on the system where this Processing Unit is running.
-	PID string
-
-	// IPs is a map of all the IPs that fully belong to this processing Unit.
-	IPs map[string]string
-}
+// It is defined by the api/events package, for the clients of the RPC monitor.
+type EventInfo = events.EventInfo
 
 // RPCResponse encapsulate the error response if any.
-type RPCResponse struct {
-	Error string
-}
+type RPCResponse = events.RPCResponse
 
 // MonitorProcessor is a generic interface that processes monitor events using
 // a normalized event structure.
@@ -61,3 +38,22 @@ type MonitorProcessor interface {
 	// Event processes a pause event
 	Pause(eventInfo *EventInfo) error
 }
+
+// BackgroundProcessor is a MonitorProcessor with a task running while the monitor
+// runs. The task returns when the stop channel is closed.
+type BackgroundProcessor interface {
+	MonitorProcessor
+
+	// Run runs the task of the processor until the stop channel is closed
+	Run(stop <-chan struct{})
+}
+
+// ExtractorProcessor is a MonitorProcessor that extracts the runtime of the PUs with
+// another extractor than its own, so that the PUs of each tenant of the monitor are
+// extracted with the extractor of the tenant.
+type ExtractorProcessor interface {
+	MonitorProcessor
+
+	// StartWithExtractor processes PU start events with the extractor
+	StartWithExtractor(eventInfo *EventInfo, extractor RPCMetadataExtractor) error
+}
@@ -0,0 +1,120 @@
+package rpcmonitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/aporeto-inc/trireme/monitor"
+	"github.com/aporeto-inc/trireme/monitor/contextstore"
+)
+
+// startStoreWatcher starts handling the changes of the context store
+func (r *RPCMonitor) startStoreWatcher() error {
+
+	watcher, ok := r.contextstore.(contextstore.ContextWatcher)
+	if !ok {
+		return fmt.Errorf("Context store cannot be watched")
+	}
+
+	stop := make(chan struct{})
+
+	changes, err := watcher.WatchStore(stop)
+	if err != nil {
+		return fmt.Errorf("Unable to watch the context store: %s", err)
+	}
+
+	r.stopWatch = stop
+
+	go func() {
+		for change := range changes {
+			if err := r.handleStoreChange(change); err != nil {
+				log.WithFields(log.Fields{
+					"package":   "RPCMonitor",
+					"contextID": change.ContextID,
+					"removed":   change.Removed,
+					"error":     err.Error(),
+				}).Warn("Ignoring the change of the context store")
+			}
+		}
+	}()
+
+	return nil
+}
+
+// stopStoreWatcher stops handling the changes of the context store
+func (r *RPCMonitor) stopStoreWatcher() {
+
+	if r.stopWatch != nil {
+		close(r.stopWatch)
+		r.stopWatch = nil
+	}
+}
+
+// handleStoreChange starts the PU of a context added or modified in the store, and
+// stops and destroys the PU of a context removed from the store
+func (r *RPCMonitor) handleStoreChange(change *contextstore.ContextChange) error {
+
+	if change.Data == nil {
+		return fmt.Errorf("Unknown context")
+	}
+
+	eventInfo := &EventInfo{}
+	if err := json.Unmarshal(change.Data, eventInfo); err != nil {
+		return fmt.Errorf("Invalid eventInfo: %s", err)
+	}
+
+	if err := r.validateStoredEvent(change.ContextID, eventInfo, change.Removed); err != nil {
+		return err
+	}
+
+	handlers := r.serverOf(eventInfo.Tenant).handlers[eventInfo.PUType]
+
+	if !change.Removed {
+		eventInfo.EventType = monitor.EventStart
+		return handlers[monitor.EventStart](eventInfo)
+	}
+
+	eventInfo.EventType = monitor.EventStop
+	if err := handlers[monitor.EventStop](eventInfo); err != nil {
+		return err
+	}
+
+	eventInfo.EventType = monitor.EventDestroy
+	return handlers[monitor.EventDestroy](eventInfo)
+}
+
+// validateStoredEvent checks the eventInfo of a context changed in the store. The
+// eventInfo of a removed context only needs to identify its PU.
+func (r *RPCMonitor) validateStoredEvent(contextID string, eventInfo *EventInfo, removed bool) error {
+
+	if eventInfo.PUID != contextID {
+		return fmt.Errorf("PUID %s does not match the context", eventInfo.PUID)
+	}
+
+	if _, ok := r.serverOf(eventInfo.Tenant).handlers[eventInfo.PUType]; !ok {
+		return fmt.Errorf("No processor registered for the PU type %d", eventInfo.PUType)
+	}
+
+	if removed {
+		return nil
+	}
+
+	if eventInfo.Name == "" {
+		return fmt.Errorf("PU name is empty")
+	}
+
+	if eventInfo.PID == "" && eventInfo.NetNSPath == "" {
+		return fmt.Errorf("PU has no PID nor network namespace")
+	}
+
+	if eventInfo.PID != "" {
+		if _, err := strconv.Atoi(eventInfo.PID); err != nil {
+			return fmt.Errorf("Invalid PID %s", eventInfo.PID)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package rpcmonitor
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/monitor"
+	"github.com/aporeto-inc/trireme/monitor/contextstore"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// watchedStore is a context store notifying the changes of its channel
+type watchedStore struct {
+	contextstore.ContextStore
+	changes chan *contextstore.ContextChange
+}
+
+func (s *watchedStore) WatchStore(stop <-chan struct{}) (<-chan *contextstore.ContextChange, error) {
+
+	return s.changes, nil
+}
+
+func TestStoreWatcher(t *testing.T) {
+
+	Convey("Given an RPC monitor watching its context store", t, func() {
+
+		mon, err := NewRPCMonitor(testRPCAddress, &CustomPolicyResolver{}, nil, WithStoreWatcher())
+		So(err, ShouldBeNil)
+
+		events := make(chan *EventInfo, 10)
+		handler := func(eventInfo *EventInfo) error {
+			event := *eventInfo
+			events <- &event
+			return nil
+		}
+
+		mon.monitorServer.handlers[constants.LinuxProcessPU] = map[monitor.Event]RPCEventHandler{
+			monitor.EventStart:   handler,
+			monitor.EventStop:    handler,
+			monitor.EventDestroy: handler,
+		}
+
+		Convey("A context added to the store should start its PU", func() {
+			err := mon.handleStoreChange(&contextstore.ContextChange{
+				ContextID: "/1234",
+				Data:      []byte(`{"PUType":1,"PUID":"/1234","Name":"nginx","PID":"1234"}`),
+			})
+			So(err, ShouldBeNil)
+			So(len(events), ShouldEqual, 1)
+			So((<-events).EventType, ShouldEqual, monitor.EventStart)
+		})
+
+		Convey("A context removed from the store should stop and destroy its PU", func() {
+			err := mon.handleStoreChange(&contextstore.ContextChange{
+				ContextID: "/1234",
+				Removed:   true,
+				Data:      []byte(`{"PUType":1,"PUID":"/1234"}`),
+			})
+			So(err, ShouldBeNil)
+			So(len(events), ShouldEqual, 2)
+			So((<-events).EventType, ShouldEqual, monitor.EventStop)
+			So((<-events).EventType, ShouldEqual, monitor.EventDestroy)
+		})
+
+		Convey("The invalid contexts should be ignored", func() {
+			for _, data := range []string{
+				`{"PUType":1,"PUID":"/4321","Name":"nginx","PID":"1234"}`,
+				`{"PUType":2,"PUID":"/1234","Name":"nginx","PID":"1234"}`,
+				`{"PUType":1,"PUID":"/1234","PID":"1234"}`,
+				`{"PUType":1,"PUID":"/1234","Name":"nginx"}`,
+				`{"PUType":1,"PUID":"/1234","Name":"nginx","PID":"nginx"}`,
+				`{"PUType":1,"PUID":"/1234"`,
+			} {
+				err := mon.handleStoreChange(&contextstore.ContextChange{ContextID: "/1234", Data: []byte(data)})
+				So(err, ShouldNotBeNil)
+			}
+
+			err := mon.handleStoreChange(&contextstore.ContextChange{ContextID: "/1234", Removed: true})
+			So(err, ShouldNotBeNil)
+			So(len(events), ShouldEqual, 0)
+		})
+
+		Convey("The changes of the store should be handled once the watcher is started", func() {
+			store := &watchedStore{changes: make(chan *contextstore.ContextChange, 1)}
+			mon.contextstore = store
+
+			So(mon.startStoreWatcher(), ShouldBeNil)
+			defer mon.stopStoreWatcher()
+
+			store.changes <- &contextstore.ContextChange{
+				ContextID: "/1234",
+				Data:      []byte(`{"PUType":1,"PUID":"/1234","Name":"nginx","PID":"1234"}`),
+			}
+
+			select {
+			case eventInfo := <-events:
+				So(eventInfo.PUID, ShouldEqual, "/1234")
+			case <-time.After(2 * time.Second):
+				So(fmt.Errorf("PU not started"), ShouldBeNil)
+			}
+		})
+
+		Convey("A store that cannot be watched should fail the watcher", func() {
+			mon.contextstore = contextstore.ContextStore(nil)
+			So(mon.startStoreWatcher(), ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,261 @@
+package rpcmonitor
+
+import (
+	"fmt"
+	"net"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/monitor"
+	"github.com/aporeto-inc/trireme/utils/sockets"
+)
+
+// Tenant is a socket of the monitor serving a class of clients of the same trust, like
+// the host services, the CNI plugins or the daemons of the users. The events received
+// on the socket of a tenant are events of the tenant: their PUs are of the type of the
+// tenant and their runtime is extracted by the extractor of the tenant.
+type Tenant struct {
+	// Name identifies the tenant. It is recorded in the events of the tenant, so that
+	// their PUs are restored by the tenant.
+	Name string
+
+	// Address is the address of the socket of the tenant, like the address of the
+	// monitor. A relative path is a socket of the directory of WithTenantDirectory,
+	// and no address is the socket named after the tenant in this directory.
+	Address string
+
+	// PUType is the type of the PUs of the tenant. The events of the default type of
+	// the events, constants.ContainerPU, are of this type, and the events of another
+	// type are rejected.
+	PUType constants.PUType
+
+	// Extractor extracts the runtime of the PUs of the tenant instead of the extractor
+	// of the processor of the PU type, which must be an ExtractorProcessor. The
+	// extractor of the processor is used otherwise.
+	Extractor RPCMetadataExtractor
+
+	// Sockets sets the permissions and the ownership of the unix socket of the tenant,
+	// instead of the socket options of the monitor
+	Sockets *sockets.Options
+}
+
+// tenantServer serves the socket of a tenant
+type tenantServer struct {
+	Tenant
+	network       string
+	address       string
+	rpcServer     *rpc.Server
+	monitorServer *Server
+	listensock    net.Listener
+}
+
+// WithTenants serves the tenants on their own socket, in addition to the socket of
+// the monitor. The events of the socket of the monitor are handled as before, with
+// the PU type of the events and the extractors of the processors.
+func WithTenants(tenants ...Tenant) Option {
+
+	return func(r *RPCMonitor) {
+		r.tenantConfigs = append(r.tenantConfigs, tenants...)
+	}
+}
+
+// WithTenantDirectory creates the sockets of the tenants without an absolute address
+// in the directory, which is created if needed
+func WithTenantDirectory(dir string) Option {
+
+	return func(r *RPCMonitor) {
+		r.tenantDir = dir
+	}
+}
+
+// newTenantServers validates the tenants of the monitor and returns their servers
+func (r *RPCMonitor) newTenantServers() ([]*tenantServer, error) {
+
+	names := map[string]bool{}
+	addresses := map[string]bool{r.address: true}
+	servers := make([]*tenantServer, 0, len(r.tenantConfigs))
+
+	for _, tenant := range r.tenantConfigs {
+
+		if tenant.Name == "" {
+			return nil, fmt.Errorf("Tenant name is empty")
+		}
+
+		if names[tenant.Name] {
+			return nil, fmt.Errorf("Tenant %s is defined twice", tenant.Name)
+		}
+		names[tenant.Name] = true
+
+		if tenant.PUType != constants.ContainerPU && tenant.PUType != constants.LinuxProcessPU {
+			return nil, fmt.Errorf("Tenant %s has an unknown PU type %d", tenant.Name, tenant.PUType)
+		}
+
+		rpcAddress, err := r.tenantAddress(tenant)
+		if err != nil {
+			return nil, err
+		}
+
+		network, address, err := parseRPCAddress(rpcAddress)
+		if err != nil {
+			return nil, fmt.Errorf("Tenant %s address invalid: %s", tenant.Name, err)
+		}
+
+		if addresses[address] {
+			return nil, fmt.Errorf("Tenant %s address %s is already used", tenant.Name, address)
+		}
+		addresses[address] = true
+
+		t := &tenantServer{
+			Tenant:  tenant,
+			network: network,
+			address: address,
+		}
+
+		t.monitorServer = &Server{
+			handlers:   map[constants.PUType]map[monitor.Event]RPCEventHandler{},
+			summarizer: r.monitorServer.summarizer,
+			tenant:     &t.Tenant,
+		}
+
+		t.rpcServer = rpc.NewServer()
+		if err := t.rpcServer.Register(t.monitorServer); err != nil {
+			return nil, fmt.Errorf("Format of service MonitorServer isn't correct: %s", err)
+		}
+
+		servers = append(servers, t)
+	}
+
+	return servers, nil
+}
+
+// tenantAddress returns the address of the socket of a tenant
+func (r *RPCMonitor) tenantAddress(tenant Tenant) (string, error) {
+
+	address := tenant.Address
+	if address == "" {
+		address = tenant.Name + ".sock"
+	}
+
+	if strings.HasPrefix(address, tcpScheme) {
+		return address, nil
+	}
+
+	path := strings.TrimPrefix(address, unixScheme)
+	if filepath.IsAbs(path) {
+		return path, nil
+	}
+
+	if r.tenantDir == "" {
+		return "", fmt.Errorf("Tenant %s address %s is relative without a tenant directory", tenant.Name, address)
+	}
+
+	return filepath.Join(r.tenantDir, path), nil
+}
+
+// registerTenantProcessor registers the processor of a PU type with the tenants of
+// this type
+func (r *RPCMonitor) registerTenantProcessor(puType constants.PUType, processor MonitorProcessor) error {
+
+	for _, t := range r.tenants {
+		if t.PUType != puType || t.Extractor == nil {
+			continue
+		}
+
+		if _, ok := processor.(ExtractorProcessor); !ok {
+			return fmt.Errorf("Processor of PU type %d cannot use the extractor of tenant %s", puType, t.Name)
+		}
+	}
+
+	for _, t := range r.tenants {
+		if t.PUType == puType {
+			t.monitorServer.addProcessor(puType, processor, t.Extractor)
+		}
+	}
+
+	return nil
+}
+
+// serverOf returns the server of the events of a tenant. The events of the tenants
+// that are not served anymore are handled by the server of the monitor.
+func (r *RPCMonitor) serverOf(tenant string) *Server {
+
+	for _, t := range r.tenants {
+		if t.Name == tenant {
+			return t.monitorServer
+		}
+	}
+
+	return r.monitorServer
+}
+
+// listenTenants starts listening on the sockets of the tenants
+func (r *RPCMonitor) listenTenants() error {
+
+	if r.tenantDir != "" {
+		if err := os.MkdirAll(r.tenantDir, 0755); err != nil {
+			return fmt.Errorf("Unable to create the tenant directory: %s", err)
+		}
+	}
+
+	for _, t := range r.tenants {
+
+		options := t.Sockets
+		if options == nil {
+			options = r.sockets
+		}
+
+		listener, err := r.listen(t.network, t.address, options)
+		if err != nil {
+			r.closeTenants()
+			return fmt.Errorf("couldn't create binding of tenant %s: %s", t.Name, err)
+		}
+
+		t.listensock = listener
+	}
+
+	for _, t := range r.tenants {
+		go r.processRequests(t.listensock, t.rpcServer)
+	}
+
+	return nil
+}
+
+// closeTenants closes the sockets of the tenants
+func (r *RPCMonitor) closeTenants() {
+
+	for _, t := range r.tenants {
+		if t.listensock == nil {
+			continue
+		}
+
+		t.listensock.Close()
+		t.listensock = nil
+
+		if t.network == "unix" {
+			os.RemoveAll(t.address)
+		}
+	}
+}
+
+// tenantEvent makes an event an event of the tenant of the server, or of no tenant
+// for the server of the monitor. The events of another PU type than the type of the
+// tenant are rejected.
+func (s *Server) tenantEvent(eventInfo *EventInfo) error {
+
+	if s.tenant == nil {
+		eventInfo.Tenant = ""
+		return nil
+	}
+
+	if eventInfo.PUType != constants.ContainerPU && eventInfo.PUType != s.tenant.PUType {
+		return fmt.Errorf("Tenant %s does not accept the PU type %d", s.tenant.Name, eventInfo.PUType)
+	}
+
+	eventInfo.PUType = s.tenant.PUType
+	eventInfo.Tenant = s.tenant.Name
+
+	return nil
+}
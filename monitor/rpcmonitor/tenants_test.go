@@ -0,0 +1,151 @@
+package rpcmonitor
+
+import (
+	"io/ioutil"
+	"net/rpc/jsonrpc"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/monitor"
+	"github.com/aporeto-inc/trireme/policy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// extractingProcessor records the events it starts and the extractor of their runtime
+type extractingProcessor struct {
+	CustomProcessor
+	started   []*EventInfo
+	extracted []string
+}
+
+func (p *extractingProcessor) Start(eventInfo *EventInfo) error {
+
+	return p.StartWithExtractor(eventInfo, DefaultRPCMetadataExtractor)
+}
+
+func (p *extractingProcessor) StartWithExtractor(eventInfo *EventInfo, extractor RPCMetadataExtractor) error {
+
+	runtime, err := extractor(eventInfo)
+	if err != nil {
+		return err
+	}
+
+	p.started = append(p.started, eventInfo)
+	p.extracted = append(p.extracted, runtime.Name())
+
+	return nil
+}
+
+// cniExtractor names the runtime of the PUs after their tenant
+func cniExtractor(eventInfo *EventInfo) (*policy.PURuntime, error) {
+
+	return policy.NewPURuntime("cni-"+eventInfo.Name, 0, nil, nil, constants.ContainerPU, nil), nil
+}
+
+func TestTenants(t *testing.T) {
+
+	Convey("Given a tenant directory", t, func() {
+
+		dir, err := ioutil.TempDir("", "tenants")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		address := filepath.Join(dir, "monitor.sock")
+
+		Convey("The tenants should be validated", func() {
+			_, err := NewRPCMonitor(address, &CustomPolicyResolver{}, nil, WithTenants(Tenant{Address: "cni.sock"}), WithTenantDirectory(dir))
+			So(err, ShouldNotBeNil)
+
+			_, err = NewRPCMonitor(address, &CustomPolicyResolver{}, nil, WithTenants(Tenant{Name: "cni"}, Tenant{Name: "cni", Address: "other.sock"}), WithTenantDirectory(dir))
+			So(err, ShouldNotBeNil)
+
+			_, err = NewRPCMonitor(address, &CustomPolicyResolver{}, nil, WithTenants(Tenant{Name: "cni"}))
+			So(err, ShouldNotBeNil)
+
+			_, err = NewRPCMonitor(address, &CustomPolicyResolver{}, nil, WithTenants(Tenant{Name: "cni", Address: address}))
+			So(err, ShouldNotBeNil)
+
+			_, err = NewRPCMonitor(address, &CustomPolicyResolver{}, nil, WithTenants(Tenant{Name: "cni", PUType: constants.PUType(42)}), WithTenantDirectory(dir))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Given a monitor with a tenant of the Linux processes with its own extractor", func() {
+
+			mon, err := NewRPCMonitor(address, &CustomPolicyResolver{}, nil,
+				WithTenants(Tenant{Name: "cni", PUType: constants.LinuxProcessPU, Extractor: cniExtractor}),
+				WithTenantDirectory(filepath.Join(dir, "tenants")),
+			)
+			So(err, ShouldBeNil)
+
+			Convey("The processors that cannot use the extractor should be rejected", func() {
+				So(mon.RegisterProcessor(constants.LinuxProcessPU, &CustomProcessor{}), ShouldNotBeNil)
+				So(mon.RegisterProcessor(constants.ContainerPU, &CustomProcessor{}), ShouldBeNil)
+			})
+
+			Convey("When I register a processor extracting the runtime", func() {
+				processor := &extractingProcessor{}
+				So(mon.RegisterProcessor(constants.LinuxProcessPU, processor), ShouldBeNil)
+
+				tenant := mon.tenants[0].monitorServer
+
+				Convey("The events of the tenant should be started with the extractor of the tenant", func() {
+					event := &EventInfo{EventType: monitor.EventStart, PUID: "/1234", Name: "pod", PID: "1", Tenant: "spoofed"}
+					So(tenant.HandleEvent(event, &RPCResponse{}), ShouldBeNil)
+
+					So(processor.extracted, ShouldResemble, []string{"cni-pod"})
+					So(processor.started[0].PUType, ShouldEqual, constants.LinuxProcessPU)
+					So(processor.started[0].Tenant, ShouldEqual, "cni")
+				})
+
+				Convey("The events of another PU type should be rejected by the tenant", func() {
+					event := &EventInfo{EventType: monitor.EventStart, PUType: constants.PUType(42), PUID: "/1234", Name: "pod", PID: "1"}
+					So(tenant.HandleEvent(event, &RPCResponse{}), ShouldNotBeNil)
+					So(processor.started, ShouldBeEmpty)
+				})
+
+				Convey("The events of the monitor socket should be started with the extractor of the processor", func() {
+					event := &EventInfo{EventType: monitor.EventStart, PUType: constants.LinuxProcessPU, PUID: "/1234", Name: "service", PID: "1", Tenant: "cni"}
+					So(mon.monitorServer.HandleEvent(event, &RPCResponse{}), ShouldBeNil)
+
+					So(processor.extracted, ShouldResemble, []string{"service"})
+					So(processor.started[0].Tenant, ShouldEqual, "")
+				})
+
+				Convey("The stored PUs of the tenant should be restored by the tenant", func() {
+					So(mon.serverOf("cni"), ShouldEqual, tenant)
+					So(mon.serverOf(""), ShouldEqual, mon.monitorServer)
+					So(mon.serverOf("removed"), ShouldEqual, mon.monitorServer)
+				})
+
+				Convey("When I start the monitor", func() {
+					So(mon.Start(), ShouldBeNil)
+					socket := filepath.Join(dir, "tenants", "cni.sock")
+
+					Convey("The events sent to the socket of the tenant should be events of the tenant", func() {
+						client, err := jsonrpc.Dial("unix", socket)
+						So(err, ShouldBeNil)
+						defer client.Close()
+
+						event := &EventInfo{EventType: monitor.EventStart, PUID: "/1234", Name: "pod", PID: "1"}
+						So(client.Call("Server.HandleEvent", event, &RPCResponse{}), ShouldBeNil)
+						So(processor.extracted, ShouldResemble, []string{"cni-pod"})
+
+						So(mon.Stop(), ShouldBeNil)
+					})
+
+					Convey("The socket of the tenant should be removed when the monitor stops", func() {
+						_, err := os.Stat(socket)
+						So(err, ShouldBeNil)
+
+						So(mon.Stop(), ShouldBeNil)
+
+						_, err = os.Stat(socket)
+						So(os.IsNotExist(err), ShouldBeTrue)
+					})
+				})
+			})
+		})
+	})
+}
@@ -0,0 +1,150 @@
+package rpcmonitor
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"strings"
+
+	"github.com/aporeto-inc/trireme/utils/sockets"
+)
+
+const (
+	// tcpScheme prefixes the addresses of the monitors listening on TCP, as
+	// tcp://host:port
+	tcpScheme = "tcp://"
+	// unixScheme optionally prefixes the addresses of the monitors listening on a unix
+	// socket. An address without scheme is the path of a unix socket.
+	unixScheme = "unix://"
+)
+
+// Option configures an RPCMonitor
+type Option func(*RPCMonitor)
+
+// WithTLS secures the connections of the monitor with the configuration. The clients
+// must present a certificate if the configuration requires it, see NewServerTLSConfig.
+func WithTLS(config *tls.Config) Option {
+
+	return func(r *RPCMonitor) {
+		r.tlsConfig = config
+	}
+}
+
+// WithSocketOptions sets the permissions and the ownership of the unix socket of the
+// monitor. By default, only the user of the process connects to the socket. The
+// users allowed to start processing units through the socket are granted access by
+// the mode and the group of the options.
+func WithSocketOptions(options *sockets.Options) Option {
+
+	return func(r *RPCMonitor) {
+		r.sockets = options
+	}
+}
+
+// WithPolicySummary returns the summary of the policy applied to the PU of the start
+// events to the callers. The PU handler must be a monitor.PolicySummarizer.
+func WithPolicySummary() Option {
+
+	return func(r *RPCMonitor) {
+		r.summaries = true
+	}
+}
+
+// WithStoreWatcher watches the context store, so that the contexts added, modified
+// or removed by other processes, like an operator tool, start or stop their PUs
+// without restarting the monitor. The context store must be a
+// contextstore.ContextWatcher.
+func WithStoreWatcher() Option {
+
+	return func(r *RPCMonitor) {
+		r.watchStore = true
+	}
+}
+
+// parseRPCAddress returns the network and the address of the listener of an RPC
+// monitor address
+func parseRPCAddress(rpcAddress string) (network string, address string, err error) {
+
+	switch {
+	case strings.HasPrefix(rpcAddress, tcpScheme):
+		address = strings.TrimPrefix(rpcAddress, tcpScheme)
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return "", "", fmt.Errorf("Invalid TCP address %s: %s", address, err)
+		}
+		return "tcp", address, nil
+
+	case strings.HasPrefix(rpcAddress, unixScheme):
+		address = strings.TrimPrefix(rpcAddress, unixScheme)
+
+	default:
+		address = rpcAddress
+	}
+
+	if address == "" {
+		return "", "", fmt.Errorf("Empty unix socket path")
+	}
+
+	return "unix", address, nil
+}
+
+// NewServerTLSConfig returns the TLS configuration of a monitor presenting the
+// certificate and the key of the PEM files. If clientCAFile is not empty, the clients
+// must present a certificate issued by one of the authorities of the PEM file.
+func NewServerTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot load the certificate of the monitor: %s", err)
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if clientCAFile == "" {
+		return config, nil
+	}
+
+	pem, err := ioutil.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read the client authorities: %s", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("No certificate in %s", clientCAFile)
+	}
+
+	config.ClientCAs = pool
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+
+	return config, nil
+}
+
+// Dial connects an event producer to the monitor of the address. The configuration
+// of the client must be given if the monitor uses TLS, and nil otherwise.
+func Dial(rpcAddress string, tlsConfig *tls.Config) (*rpc.Client, error) {
+
+	network, address, err := parseRPCAddress(rpcAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	var conn net.Conn
+	if tlsConfig != nil {
+		conn, err = tls.Dial(network, address, tlsConfig)
+	} else {
+		conn, err = net.Dial(network, address)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Cannot connect to the monitor at %s: %s", rpcAddress, err)
+	}
+
+	return jsonrpc.NewClient(conn), nil
+}
@@ -0,0 +1,205 @@
+package rpcmonitor
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/monitor"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// testCertificate returns a certificate and its key signed by the parent, or self
+// signed if parent is nil
+func testCertificate(serial int64, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, ca bool) (*x509.Certificate, *ecdsa.PrivateKey, []byte, []byte) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	So(err, ShouldBeNil)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "trireme test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  ca,
+	}
+
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	So(err, ShouldBeNil)
+
+	cert, err := x509.ParseCertificate(der)
+	So(err, ShouldBeNil)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	So(err, ShouldBeNil)
+
+	return cert, key,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// freeTCPAddress returns a local TCP address that is not in use
+func freeTCPAddress() string {
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	So(err, ShouldBeNil)
+	defer l.Close()
+
+	return l.Addr().String()
+}
+
+func TestParseRPCAddress(t *testing.T) {
+	Convey("When I parse the address of a monitor", t, func() {
+
+		Convey("A path should be a unix socket", func() {
+			network, address, err := parseRPCAddress("/var/run/trireme.sock")
+			So(err, ShouldBeNil)
+			So(network, ShouldEqual, "unix")
+			So(address, ShouldEqual, "/var/run/trireme.sock")
+		})
+
+		Convey("A unix URL should be a unix socket", func() {
+			network, address, err := parseRPCAddress("unix:///var/run/trireme.sock")
+			So(err, ShouldBeNil)
+			So(network, ShouldEqual, "unix")
+			So(address, ShouldEqual, "/var/run/trireme.sock")
+		})
+
+		Convey("A tcp URL should be a TCP address", func() {
+			network, address, err := parseRPCAddress("tcp://10.0.0.1:9443")
+			So(err, ShouldBeNil)
+			So(network, ShouldEqual, "tcp")
+			So(address, ShouldEqual, "10.0.0.1:9443")
+		})
+
+		Convey("A tcp URL without port should fail", func() {
+			_, _, err := parseRPCAddress("tcp://10.0.0.1")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("An empty unix URL should fail", func() {
+			_, _, err := parseRPCAddress("unix://")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestTLSMonitor(t *testing.T) {
+	Convey("Given the certificates of a monitor and its clients", t, func() {
+
+		dir, err := ioutil.TempDir("", "rpcmonitor")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		ca, caKey, caPEM, _ := testCertificate(1, nil, nil, true)
+		_, _, serverPEM, serverKeyPEM := testCertificate(2, ca, caKey, false)
+		_, _, clientPEM, clientKeyPEM := testCertificate(3, ca, caKey, false)
+
+		files := map[string][]byte{
+			"ca.pem":         caPEM,
+			"server.pem":     serverPEM,
+			"server-key.pem": serverKeyPEM,
+		}
+		for name, content := range files {
+			So(ioutil.WriteFile(filepath.Join(dir, name), content, 0600), ShouldBeNil)
+		}
+
+		Convey("When the files are invalid, the configuration should fail", func() {
+			_, err := NewServerTLSConfig(filepath.Join(dir, "ca.pem"), filepath.Join(dir, "server-key.pem"), "")
+			So(err, ShouldNotBeNil)
+
+			_, err = NewServerTLSConfig(filepath.Join(dir, "server.pem"), filepath.Join(dir, "server-key.pem"), filepath.Join(dir, "server-key.pem"))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("When I start a monitor requiring client certificates on TCP", func() {
+			config, err := NewServerTLSConfig(filepath.Join(dir, "server.pem"), filepath.Join(dir, "server-key.pem"), filepath.Join(dir, "ca.pem"))
+			So(err, ShouldBeNil)
+			So(config.ClientAuth, ShouldEqual, tls.RequireAndVerifyClientCert)
+
+			address := "tcp://" + freeTCPAddress()
+			mon, err := NewRPCMonitor(address, &CustomPolicyResolver{}, nil, WithTLS(config))
+			So(err, ShouldBeNil)
+
+			events := make(chan *EventInfo, 1)
+			mon.monitorServer.handlers[constants.LinuxProcessPU] = map[monitor.Event]RPCEventHandler{
+				monitor.EventStart: func(event *EventInfo) error {
+					events <- event
+					return nil
+				},
+			}
+
+			So(mon.Start(), ShouldBeNil)
+			defer mon.Stop()
+
+			pool := x509.NewCertPool()
+			pool.AppendCertsFromPEM(caPEM)
+
+			event := &EventInfo{
+				EventType: monitor.EventStart,
+				PUType:    constants.LinuxProcessPU,
+				PUID:      "pu1",
+			}
+
+			Convey("A client with a certificate should deliver its events", func() {
+				clientCert, err := tls.X509KeyPair(clientPEM, clientKeyPEM)
+				So(err, ShouldBeNil)
+
+				client, err := Dial(address, &tls.Config{RootCAs: pool, Certificates: []tls.Certificate{clientCert}})
+				So(err, ShouldBeNil)
+				defer client.Close()
+
+				So(client.Call("Server.HandleEvent", event, &RPCResponse{}), ShouldBeNil)
+				So((<-events).PUID, ShouldEqual, "pu1")
+			})
+
+			Convey("A client without certificate should be rejected", func() {
+				client, err := Dial(address, &tls.Config{RootCAs: pool})
+				if err == nil {
+					err = client.Call("Server.HandleEvent", event, &RPCResponse{})
+					client.Close()
+				}
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("A client without TLS should be rejected", func() {
+				client, err := Dial(address, nil)
+				So(err, ShouldBeNil)
+
+				errs := make(chan error, 1)
+				go func() {
+					errs <- client.Call("Server.HandleEvent", event, &RPCResponse{})
+				}()
+
+				// The server closes the connection after the failed handshake
+				select {
+				case err := <-errs:
+					So(err, ShouldNotBeNil)
+				case <-time.After(5 * time.Second):
+					t.Errorf("Call of a client without TLS did not fail")
+				}
+				client.Close()
+			})
+		})
+	})
+}
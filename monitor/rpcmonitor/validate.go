@@ -0,0 +1,149 @@
+package rpcmonitor
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aporeto-inc/trireme/api/events"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/monitor"
+)
+
+// knownEvents are the events of the schema
+var knownEvents = map[monitor.Event]bool{
+	monitor.EventStart:   true,
+	monitor.EventStop:    true,
+	monitor.EventCreate:  true,
+	monitor.EventDestroy: true,
+	monitor.EventPause:   true,
+	monitor.EventUnpause: true,
+	monitor.EventUpdate:  true,
+}
+
+// FieldError is a field of an event that is invalid
+type FieldError struct {
+	Field  string
+	Reason string
+}
+
+// EventValidationError is returned for the events that do not match their schema.
+// It lists all the invalid fields, so that a client can fix them at once.
+type EventValidationError struct {
+	Version int
+	Fields  []FieldError
+}
+
+func (e *EventValidationError) Error() string {
+
+	reasons := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		reasons = append(reasons, f.Field+": "+f.Reason)
+	}
+
+	return fmt.Sprintf("Invalid version %d event: %s", e.Version, strings.Join(reasons, "; "))
+}
+
+// add adds an invalid field
+func (e *EventValidationError) add(field string, format string, args ...interface{}) {
+
+	e.Fields = append(e.Fields, FieldError{Field: field, Reason: fmt.Sprintf(format, args...)})
+}
+
+// ValidateEvent checks an event against the schema of its version, and upgrades the
+// events without a version to the current version. The events of a version newer than
+// the current version are rejected, since their fields may mean something else. The
+// version 1 events are not checked beyond what the monitor always required.
+func ValidateEvent(eventInfo *EventInfo) error {
+
+	version := eventInfo.Version
+	if version == 0 {
+		version = events.EventVersion1
+	}
+
+	verr := &EventValidationError{Version: version}
+
+	if version < events.EventVersion1 || version > events.CurrentEventVersion {
+		verr.add("Version", "unsupported version %d, the monitor supports the versions %d to %d. Send a version %d event or upgrade the monitor",
+			eventInfo.Version, events.EventVersion1, events.CurrentEventVersion, events.CurrentEventVersion)
+		return verr
+	}
+
+	// The version 1 events are accepted like they always were, the monitor only
+	// requires their event type
+	if version == events.EventVersion1 {
+		if eventInfo.EventType == "" {
+			verr.add("EventType", "required")
+		}
+	} else {
+		validateFields(eventInfo, verr)
+	}
+
+	if len(verr.Fields) > 0 {
+		return verr
+	}
+
+	eventInfo.Version = events.CurrentEventVersion
+
+	return nil
+}
+
+// validateFields checks the fields of the events with a version
+func validateFields(eventInfo *EventInfo, verr *EventValidationError) {
+
+	unknown := append([]string{}, eventInfo.UnknownFields()...)
+	sort.Strings(unknown)
+	for _, field := range unknown {
+		verr.add(field, "unknown field")
+	}
+
+	switch {
+	case eventInfo.EventType == "":
+		verr.add("EventType", "required")
+	case !knownEvents[eventInfo.EventType]:
+		verr.add("EventType", "unknown event %q", eventInfo.EventType)
+	}
+
+	if eventInfo.PUType != constants.ContainerPU && eventInfo.PUType != constants.LinuxProcessPU {
+		verr.add("PUType", "unknown PU type %d", eventInfo.PUType)
+	}
+
+	if eventInfo.PUID == "" {
+		verr.add("PUID", "required")
+	}
+
+	if eventInfo.PID != "" {
+		if pid, err := strconv.Atoi(eventInfo.PID); err != nil || pid <= 0 {
+			verr.add("PID", "must be a positive integer, got %q", eventInfo.PID)
+		}
+	}
+
+	if eventInfo.NetNSPath != "" && !filepath.IsAbs(eventInfo.NetNSPath) {
+		verr.add("NetNSPath", "must be an absolute path, got %q", eventInfo.NetNSPath)
+	}
+
+	for _, name := range sortedKeys(eventInfo.IPs) {
+		if net.ParseIP(eventInfo.IPs[name]) == nil {
+			verr.add("IPs["+name+"]", "invalid IP address %q", eventInfo.IPs[name])
+		}
+	}
+
+	if _, ok := eventInfo.Tags[""]; ok {
+		verr.add("Tags", "empty tag key")
+	}
+}
+
+// sortedKeys returns the keys of a map sorted
+func sortedKeys(m map[string]string) []string {
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
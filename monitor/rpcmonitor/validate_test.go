@@ -0,0 +1,80 @@
+package rpcmonitor
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/monitor"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestValidateEvent(t *testing.T) {
+
+	Convey("Given an event without a version", t, func() {
+		eventInfo := &EventInfo{EventType: monitor.EventStop, PUType: constants.LinuxProcessPU, PID: "not a pid"}
+
+		Convey("It should be accepted like before and upgraded to the current version", func() {
+			So(ValidateEvent(eventInfo), ShouldBeNil)
+			So(eventInfo.Version, ShouldEqual, CurrentEventVersion)
+		})
+
+		Convey("It should be rejected without an event type", func() {
+			eventInfo.EventType = ""
+			So(ValidateEvent(eventInfo), ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given a version 2 event", t, func() {
+		eventInfo := &EventInfo{
+			Version:   2,
+			EventType: monitor.EventStart,
+			PUType:    constants.LinuxProcessPU,
+			PUID:      "/1234",
+			PID:       "1234",
+			IPs:       map[string]string{"bridge": "172.17.0.2"},
+		}
+
+		Convey("A valid event should be accepted", func() {
+			So(ValidateEvent(eventInfo), ShouldBeNil)
+		})
+
+		Convey("All the invalid fields should be reported", func() {
+			eventInfo.EventType = "restart"
+			eventInfo.PUID = ""
+			eventInfo.PID = "-1"
+			eventInfo.NetNSPath = "netns/ns1"
+			eventInfo.IPs["bridge"] = "172.17.0"
+
+			err := ValidateEvent(eventInfo)
+			So(err, ShouldNotBeNil)
+
+			verr := err.(*EventValidationError)
+			fields := []string{}
+			for _, f := range verr.Fields {
+				fields = append(fields, f.Field)
+			}
+			So(fields, ShouldResemble, []string{"EventType", "PUID", "PID", "NetNSPath", "IPs[bridge]"})
+			So(err.Error(), ShouldContainSubstring, `PID: must be a positive integer, got "-1"`)
+		})
+
+		Convey("Its unknown fields should be rejected", func() {
+			decoded := &EventInfo{}
+			So(json.Unmarshal([]byte(`{"Version":2,"EventType":"stop","PUID":"/1234","ProcessID":"1234"}`), decoded), ShouldBeNil)
+
+			err := ValidateEvent(decoded)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "ProcessID: unknown field")
+		})
+	})
+
+	Convey("Given an event of a future version", t, func() {
+		eventInfo := &EventInfo{Version: CurrentEventVersion + 1, EventType: monitor.EventStart}
+
+		Convey("It should be rejected with the supported versions", func() {
+			err := ValidateEvent(eventInfo)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "supports the versions 1 to 2")
+		})
+	})
+}
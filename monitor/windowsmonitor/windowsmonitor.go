@@ -0,0 +1,416 @@
+// Package windowsmonitor monitors the processes of a Windows host through the
+// process events of WMI, and sends the events of the processes selected as PUs
+// to the ProcessingUnitsHandler like the other monitors.
+package windowsmonitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/monitor"
+	"github.com/aporeto-inc/trireme/policy"
+	"github.com/aporeto-inc/trireme/utils/errortypes"
+)
+
+// DefaultRetryInterval is the interval between two subscriptions to the process
+// events after their stream ends
+const DefaultRetryInterval = 10 * time.Second
+
+// Types of the process events
+const (
+	// ProcessRunning is the type of the processes listed as running
+	ProcessRunning = "running"
+
+	// ProcessStarted is the type of the events of the started processes
+	ProcessStarted = "start"
+
+	// ProcessStopped is the type of the events of the stopped processes
+	ProcessStopped = "stop"
+)
+
+// WindowsProcess describes a process of the Windows host
+type WindowsProcess struct {
+	PID  int    `json:"pid"`
+	PPID int    `json:"ppid"`
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// processEvent is an event of a process, as a line of JSON of the process source
+type processEvent struct {
+	Type string `json:"type"`
+	WindowsProcess
+}
+
+// parseProcessEvent parses a line of the process source
+func parseProcessEvent(line string) (*processEvent, error) {
+
+	event := &processEvent{}
+	if err := json.Unmarshal([]byte(line), event); err != nil {
+		return nil, fmt.Errorf("Invalid process event %q: %s", line, err)
+	}
+
+	switch event.Type {
+	case ProcessRunning, ProcessStarted, ProcessStopped:
+	default:
+		return nil, fmt.Errorf("Unknown type of process event: %q", event.Type)
+	}
+
+	if event.PID <= 0 {
+		return nil, fmt.Errorf("Invalid pid of process event: %d", event.PID)
+	}
+
+	return event, nil
+}
+
+// processSource lists the processes of the host and streams their events
+type processSource interface {
+
+	// Processes returns the running processes
+	Processes() ([]*WindowsProcess, error)
+
+	// Events streams the events of the processes until the cancel channel is
+	// closed. The stream is closed when it ends.
+	Events(cancel <-chan bool) (<-chan *processEvent, error)
+
+	// Kill kills the process
+	Kill(pid int) error
+}
+
+// A ProcessFilter selects the processes monitored as PUs
+type ProcessFilter func(*WindowsProcess) bool
+
+// ImageFilter returns a filter selecting the processes of the images, matched with
+// the path or the name of the processes, case insensitively
+func ImageFilter(images ...string) ProcessFilter {
+
+	selected := map[string]bool{}
+	for _, image := range images {
+		selected[strings.ToLower(image)] = true
+	}
+
+	return func(p *WindowsProcess) bool {
+		return selected[strings.ToLower(p.Path)] || selected[strings.ToLower(p.Name)]
+	}
+}
+
+// A WindowsMetadataExtractor is a function used to extract a *policy.PURuntime from
+// a given process of the host
+type WindowsMetadataExtractor func(*WindowsProcess) (*policy.PURuntime, error)
+
+func contextIDFromPID(pid int) string {
+
+	return strconv.Itoa(pid)
+}
+
+// defaultWindowsMetadataExtractor tags the PU with the name and the image of its
+// process, the identifiers the filters of the Windows Filtering Platform match
+func defaultWindowsMetadataExtractor(p *WindowsProcess) (*policy.PURuntime, error) {
+
+	if p.Name == "" {
+		return nil, fmt.Errorf("Process %d has no name", p.PID)
+	}
+
+	tags := policy.NewTagsMap(map[string]string{
+		"name": p.Name,
+	})
+
+	if p.Path != "" {
+		tags.Add("image", p.Path)
+	}
+
+	return policy.NewPURuntime(p.Name, p.PID, tags, nil, constants.WindowsProcessPU, nil), nil
+}
+
+// windowsMonitor monitors the processes of the host selected by its filter. The
+// processes are started and stopped on the events of the source, and the running
+// processes are listed again after the events could not be streamed.
+type windowsMonitor struct {
+	source            processSource
+	filter            ProcessFilter
+	metadataExtractor WindowsMetadataExtractor
+	interval          time.Duration
+	syncAtStart       bool
+	syncHandler       monitor.SynchronizationHandler
+
+	puHandler monitor.ProcessingUnitsHandler
+
+	// processes are the processes of the PUs, by pid
+	processes map[int]*WindowsProcess
+	stop      chan bool
+}
+
+func newWindowsMonitor(
+	source processSource,
+	filter ProcessFilter,
+	p monitor.ProcessingUnitsHandler,
+	m WindowsMetadataExtractor,
+	syncAtStart bool,
+	s monitor.SynchronizationHandler,
+) *windowsMonitor {
+
+	return &windowsMonitor{
+		source:            source,
+		filter:            filter,
+		metadataExtractor: m,
+		interval:          DefaultRetryInterval,
+		syncAtStart:       syncAtStart,
+		syncHandler:       s,
+		puHandler:         p,
+		processes:         map[int]*WindowsProcess{},
+		stop:              make(chan bool),
+	}
+}
+
+// Start subscribes to the process events. It applies a policy to each selected
+// process already running if the monitor syncs at start.
+func (w *windowsMonitor) Start() error {
+
+	log.WithFields(log.Fields{
+		"package": "monitor",
+	}).Debug("Starting the Windows monitor")
+
+	cancel := make(chan bool)
+
+	events, err := w.source.Events(cancel)
+	if err != nil {
+		close(cancel)
+		return fmt.Errorf("Unable to subscribe to the process events: %s", err)
+	}
+
+	if w.syncAtStart {
+		processes, err := w.source.Processes()
+		if err != nil {
+			close(cancel)
+			return fmt.Errorf("Unable to list the processes: %s", err)
+		}
+
+		w.syncProcesses(processes)
+	}
+
+	go w.listener(events, cancel)
+
+	return nil
+}
+
+// Stop monitoring the processes.
+func (w *windowsMonitor) Stop() error {
+
+	log.WithFields(log.Fields{
+		"package": "monitor",
+	}).Debug("Stopping the Windows monitor")
+
+	w.stop <- true
+
+	return nil
+}
+
+// listener handles the process events until the monitor stops. When the stream
+// ends, it subscribes again every interval and reconciles the PUs with the running
+// processes, since events may have been missed.
+func (w *windowsMonitor) listener(events <-chan *processEvent, cancel chan bool) {
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	defer close(cancel)
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				log.WithFields(log.Fields{
+					"package": "monitor",
+				}).Warn("Lost the process events, subscribing again")
+				events = nil
+				continue
+			}
+			w.handleProcessEvent(event)
+		case <-ticker.C:
+			if events != nil {
+				continue
+			}
+			events = w.resubscribe(cancel)
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// resubscribe subscribes to the process events and reconciles the PUs with the
+// running processes. It returns nil if the events cannot be streamed yet.
+func (w *windowsMonitor) resubscribe(cancel <-chan bool) <-chan *processEvent {
+
+	events, err := w.source.Events(cancel)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"package": "monitor",
+			"error":   err.Error(),
+		}).Debug("Failed to subscribe to the process events")
+		return nil
+	}
+
+	processes, err := w.source.Processes()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"package": "monitor",
+			"error":   err.Error(),
+		}).Debug("Failed to list the processes")
+		return events
+	}
+
+	w.reconcile(processes)
+
+	return events
+}
+
+// handleProcessEvent starts the PU of a selected process, and stops and destroys
+// the PU of a stopped one
+func (w *windowsMonitor) handleProcessEvent(event *processEvent) {
+
+	switch event.Type {
+	case ProcessStarted:
+		if !w.selected(&event.WindowsProcess) {
+			return
+		}
+		if _, ok := w.processes[event.PID]; ok {
+			return
+		}
+		process := event.WindowsProcess
+		w.logError(event.PID, monitor.EventStart, w.startProcess(&process))
+	case ProcessStopped:
+		if process, ok := w.processes[event.PID]; ok {
+			w.stopProcess(process)
+		}
+	}
+}
+
+// syncProcesses resyncs the selected running processes, using the same process as
+// when a process is started
+func (w *windowsMonitor) syncProcesses(processes []*WindowsProcess) {
+
+	log.WithFields(log.Fields{
+		"package": "monitor",
+	}).Debug("Syncing all existing processes")
+
+	if w.syncHandler != nil {
+		for _, p := range processes {
+			if !w.selected(p) {
+				continue
+			}
+
+			runtimeInfo, err := w.extractMetadata(p)
+			if err != nil {
+				continue
+			}
+
+			w.syncHandler.HandleSynchronization(contextIDFromPID(p.PID), monitor.StateStarted, runtimeInfo, monitor.SynchronizationTypeInitial)
+		}
+
+		w.syncHandler.HandleSynchronizationComplete(monitor.SynchronizationTypeInitial)
+	}
+
+	w.reconcile(processes)
+}
+
+// reconcile starts the PUs of the selected running processes that are not known,
+// and stops the PUs whose process is not running anymore
+func (w *windowsMonitor) reconcile(processes []*WindowsProcess) {
+
+	running := map[int]bool{}
+
+	for _, p := range processes {
+		if !w.selected(p) {
+			continue
+		}
+
+		running[p.PID] = true
+		if _, ok := w.processes[p.PID]; ok {
+			continue
+		}
+
+		w.logError(p.PID, monitor.EventStart, w.startProcess(p))
+	}
+
+	for pid, p := range w.processes {
+		if !running[pid] {
+			w.stopProcess(p)
+		}
+	}
+}
+
+// startProcess sends the runtime of a process and its create and start events. The
+// process is killed if its policy cannot be set.
+func (w *windowsMonitor) startProcess(p *WindowsProcess) error {
+
+	contextID := contextIDFromPID(p.PID)
+
+	runtimeInfo, err := w.extractMetadata(p)
+	if err != nil {
+		return fmt.Errorf("Error getting the metadata of the process: %s", err)
+	}
+
+	w.processes[p.PID] = p
+
+	w.puHandler.SetPURuntime(contextID, runtimeInfo)
+
+	if err := <-w.puHandler.HandlePUEvent(contextID, monitor.EventCreate); err != nil {
+		w.source.Kill(p.PID)
+		return errortypes.Wrapf(nil, err, "PU couldn't be created - process was killed")
+	}
+
+	if err := <-w.puHandler.HandlePUEvent(contextID, monitor.EventStart); err != nil {
+		w.source.Kill(p.PID)
+		return errortypes.Wrapf(nil, err, "Policy couldn't be set - process was killed")
+	}
+
+	return nil
+}
+
+// stopProcess sends the stop and destroy events of the PU of a process
+func (w *windowsMonitor) stopProcess(p *WindowsProcess) {
+
+	contextID := contextIDFromPID(p.PID)
+
+	delete(w.processes, p.PID)
+
+	w.logError(p.PID, monitor.EventStop, <-w.puHandler.HandlePUEvent(contextID, monitor.EventStop))
+	w.logError(p.PID, monitor.EventDestroy, <-w.puHandler.HandlePUEvent(contextID, monitor.EventDestroy))
+}
+
+// selected returns true if the process is monitored as a PU. A nil filter selects
+// all the processes.
+func (w *windowsMonitor) selected(p *WindowsProcess) bool {
+
+	return w.filter == nil || w.filter(p)
+}
+
+// extractMetadata returns the runtime of the process with the metadata extractor
+// of the monitor, or the default one
+func (w *windowsMonitor) extractMetadata(p *WindowsProcess) (*policy.PURuntime, error) {
+
+	if w.metadataExtractor == nil {
+		return defaultWindowsMetadataExtractor(p)
+	}
+
+	return w.metadataExtractor(p)
+}
+
+// logError logs the error of the handling of an event
+func (w *windowsMonitor) logError(pid int, event monitor.Event, err error) {
+
+	if err == nil {
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"package": "monitor",
+		"pid":     pid,
+		"event":   event,
+		"error":   err.Error(),
+	}).Error("Error while handling event")
+}
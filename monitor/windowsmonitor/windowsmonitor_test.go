@@ -0,0 +1,178 @@
+package windowsmonitor
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/monitor"
+	"github.com/aporeto-inc/trireme/policy"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// testSource is a fake process source
+type testSource struct {
+	processes     []*WindowsProcess
+	events        chan *processEvent
+	subscriptions chan (<-chan bool)
+	killed        []int
+}
+
+func (s *testSource) Processes() ([]*WindowsProcess, error) {
+
+	return s.processes, nil
+}
+
+func (s *testSource) Events(cancel <-chan bool) (<-chan *processEvent, error) {
+
+	select {
+	case s.subscriptions <- cancel:
+	default:
+	}
+
+	return s.events, nil
+}
+
+func (s *testSource) Kill(pid int) error {
+
+	s.killed = append(s.killed, pid)
+
+	return nil
+}
+
+// testHandler records the events of the PUs
+type testHandler struct {
+	events   []string
+	runtimes map[string]*policy.PURuntime
+	err      error
+}
+
+func (h *testHandler) SetPURuntime(contextID string, runtimeInfo *policy.PURuntime) error {
+
+	h.runtimes[contextID] = runtimeInfo
+
+	return nil
+}
+
+func (h *testHandler) HandlePUEvent(contextID string, event monitor.Event) <-chan error {
+
+	h.events = append(h.events, contextID+" "+string(event))
+
+	c := make(chan error, 1)
+	if event == monitor.EventStart {
+		c <- h.err
+	} else {
+		c <- nil
+	}
+
+	return c
+}
+
+func TestWindowsMonitor(t *testing.T) {
+
+	Convey("Given a Windows monitor of the nginx processes", t, func() {
+
+		source := &testSource{
+			processes: []*WindowsProcess{
+				&WindowsProcess{PID: 100, Name: "nginx.exe", Path: `C:\nginx\nginx.exe`},
+				&WindowsProcess{PID: 200, Name: "svchost.exe", Path: `C:\Windows\System32\svchost.exe`},
+			},
+			events:        make(chan *processEvent),
+			subscriptions: make(chan (<-chan bool), 10),
+		}
+		handler := &testHandler{runtimes: map[string]*policy.PURuntime{}}
+
+		w := newWindowsMonitor(source, ImageFilter(`C:\NGINX\nginx.exe`), handler, nil, false, nil)
+
+		Convey("The running processes should be ignored without the sync at start", func() {
+			So(w.Start(), ShouldBeNil)
+			So(w.Stop(), ShouldBeNil)
+
+			So(handler.events, ShouldBeEmpty)
+		})
+
+		Convey("The selected running processes should be started with the sync at start", func() {
+			w.syncAtStart = true
+
+			So(w.Start(), ShouldBeNil)
+			So(w.Stop(), ShouldBeNil)
+
+			So(handler.events, ShouldResemble, []string{"100 create", "100 start"})
+
+			r := handler.runtimes["100"]
+			So(r, ShouldNotBeNil)
+			So(r.Pid(), ShouldEqual, 100)
+			So(r.PUType(), ShouldEqual, constants.WindowsProcessPU)
+			image, _ := r.Tag("image")
+			So(image, ShouldEqual, `C:\nginx\nginx.exe`)
+		})
+
+		Convey("When a selected process starts and stops", func() {
+			w.handleProcessEvent(&processEvent{Type: ProcessStarted, WindowsProcess: WindowsProcess{PID: 300, Name: "nginx.exe", Path: `C:\nginx\nginx.exe`}})
+			w.handleProcessEvent(&processEvent{Type: ProcessStarted, WindowsProcess: WindowsProcess{PID: 400, Name: "cmd.exe"}})
+			w.handleProcessEvent(&processEvent{Type: ProcessStopped, WindowsProcess: WindowsProcess{PID: 300}})
+			w.handleProcessEvent(&processEvent{Type: ProcessStopped, WindowsProcess: WindowsProcess{PID: 400}})
+
+			Convey("Then only its PU should be started, stopped and destroyed", func() {
+				So(handler.events, ShouldResemble, []string{"300 create", "300 start", "300 stop", "300 destroy"})
+				So(w.processes, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the policy of a started process cannot be set", func() {
+			handler.err = fmt.Errorf("no policy")
+
+			w.handleProcessEvent(&processEvent{Type: ProcessStarted, WindowsProcess: WindowsProcess{PID: 300, Name: "nginx.exe", Path: `C:\nginx\nginx.exe`}})
+
+			Convey("Then the process should be killed", func() {
+				So(source.killed, ShouldResemble, []int{300})
+			})
+		})
+
+		Convey("When the events are lost while a process stops", func() {
+			w.interval = 10 * time.Millisecond
+			w.syncAtStart = true
+
+			So(w.Start(), ShouldBeNil)
+			<-source.subscriptions
+
+			source.processes = nil
+			close(source.events)
+
+			<-source.subscriptions
+			So(w.Stop(), ShouldBeNil)
+
+			Convey("Then its PU should be stopped after the subscription", func() {
+				So(handler.events, ShouldResemble, []string{"100 create", "100 start", "100 stop", "100 destroy"})
+			})
+		})
+	})
+}
+
+func TestParseProcessEvent(t *testing.T) {
+
+	Convey("Given lines of the process source", t, func() {
+
+		Convey("A process event should be parsed", func() {
+			event, err := parseProcessEvent(`{"type":"start","pid":300,"ppid":4,"name":"nginx.exe","path":"C:\\nginx\\nginx.exe"}`)
+			So(err, ShouldBeNil)
+			So(event.Type, ShouldEqual, ProcessStarted)
+			So(event.PID, ShouldEqual, 300)
+			So(event.PPID, ShouldEqual, 4)
+			So(event.Path, ShouldEqual, `C:\nginx\nginx.exe`)
+		})
+
+		Convey("Invalid lines should be rejected", func() {
+			_, err := parseProcessEvent(`not json`)
+			So(err, ShouldNotBeNil)
+
+			_, err = parseProcessEvent(`{"type":"exit","pid":300}`)
+			So(err, ShouldNotBeNil)
+
+			_, err = parseProcessEvent(`{"type":"stop","pid":0}`)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,158 @@
+//go:build windows
+// +build windows
+
+package windowsmonitor
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/aporeto-inc/trireme/monitor"
+)
+
+// processesScript writes the running processes as lines of JSON
+const processesScript = `
+Get-CimInstance Win32_Process | ForEach-Object {
+	[Console]::Out.WriteLine(([pscustomobject]@{
+		type = 'running'; pid = [int]$_.ProcessId; ppid = [int]$_.ParentProcessId;
+		name = $_.Name; path = $_.ExecutablePath
+	} | ConvertTo-Json -Compress))
+}
+`
+
+// eventsScript writes the events of the WMI process traces as lines of JSON. The
+// path of the image of a started process is read from Win32_Process, since the
+// trace only carries its name.
+const eventsScript = `
+Register-CimIndicationEvent -ClassName Win32_ProcessStartTrace -SourceIdentifier trireme.start | Out-Null
+Register-CimIndicationEvent -ClassName Win32_ProcessStopTrace -SourceIdentifier trireme.stop | Out-Null
+while ($true) {
+	$e = Wait-Event
+	Remove-Event -EventIdentifier $e.EventIdentifier
+	$t = $e.SourceEventArgs.NewEvent
+	$type = 'stop'
+	$path = ''
+	if ($e.SourceIdentifier -eq 'trireme.start') {
+		$type = 'start'
+		$p = Get-CimInstance Win32_Process -Filter "ProcessId=$($t.ProcessID)"
+		if ($p) { $path = $p.ExecutablePath }
+	}
+	[Console]::Out.WriteLine(([pscustomobject]@{
+		type = $type; pid = [int]$t.ProcessID; ppid = [int]$t.ParentProcessID;
+		name = $t.ProcessName; path = $path
+	} | ConvertTo-Json -Compress))
+	[Console]::Out.Flush()
+}
+`
+
+// NewWindowsMonitor returns a monitor of the processes of the Windows host selected
+// by the filter, notified by the Win32_ProcessStartTrace and Win32_ProcessStopTrace
+// events of WMI. It needs no driver.
+func NewWindowsMonitor(
+	filter ProcessFilter,
+	p monitor.ProcessingUnitsHandler,
+	m WindowsMetadataExtractor,
+	syncAtStart bool,
+	s monitor.SynchronizationHandler,
+) monitor.Monitor {
+
+	return newWindowsMonitor(&wmiSource{}, filter, p, m, syncAtStart, s)
+}
+
+// wmiSource is the process source of the WMI classes, queried by powershell
+type wmiSource struct{}
+
+// powershell returns the command running the script
+func powershell(script string) *exec.Cmd {
+
+	return exec.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-Command", script)
+}
+
+// Processes implements the processSource interface
+func (s *wmiSource) Processes() ([]*WindowsProcess, error) {
+
+	output, err := powershell(processesScript).Output()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list the processes: %s", err)
+	}
+
+	processes := []*WindowsProcess{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		event, err := parseProcessEvent(scanner.Text())
+		if err != nil {
+			continue
+		}
+
+		process := event.WindowsProcess
+		processes = append(processes, &process)
+	}
+
+	return processes, scanner.Err()
+}
+
+// Events implements the processSource interface
+func (s *wmiSource) Events(cancel <-chan bool) (<-chan *processEvent, error) {
+
+	cmd := powershell(eventsScript)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("Unable to subscribe to the process events: %s", err)
+	}
+
+	events := make(chan *processEvent)
+	done := make(chan bool)
+
+	go func() {
+		select {
+		case <-cancel:
+			cmd.Process.Kill()
+		case <-done:
+		}
+	}()
+
+	go func() {
+		defer close(events)
+		defer close(done)
+
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			event, err := parseProcessEvent(scanner.Text())
+			if err != nil {
+				continue
+			}
+
+			select {
+			case events <- event:
+			case <-cancel:
+				cmd.Process.Kill()
+				cmd.Wait()
+				return
+			}
+		}
+
+		cmd.Wait()
+	}()
+
+	return events, nil
+}
+
+// Kill implements the processSource interface
+func (s *wmiSource) Kill(pid int) error {
+
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+
+	return process.Kill()
+}
@@ -0,0 +1,135 @@
+package policy
+
+import (
+	"net"
+	"strings"
+)
+
+// IPFamily is the family of the IP addresses
+type IPFamily int
+
+const (
+	// IPv4 is the family of the IPv4 addresses
+	IPv4 IPFamily = 4
+	// IPv6 is the family of the IPv6 addresses
+	IPv6 IPFamily = 6
+)
+
+// FamilyOf returns the family of an address or a network in CIDR notation
+func FamilyOf(address string) IPFamily {
+
+	ip := net.ParseIP(address)
+	if ip == nil {
+		if addr, _, err := net.ParseCIDR(address); err == nil {
+			ip = addr
+		}
+	}
+
+	if ip == nil {
+		// The addresses are only validated by iptables, so the ones that cannot be
+		// parsed are programmed with the IPv4 rules, as they were before IPv6
+		if strings.Contains(address, ":") {
+			return IPv6
+		}
+		return IPv4
+	}
+
+	if ip.To4() != nil {
+		return IPv4
+	}
+
+	return IPv6
+}
+
+// FamilyNetworks returns the addresses or networks of the family
+func FamilyNetworks(networks []string, family IPFamily) []string {
+
+	if networks == nil {
+		return nil
+	}
+
+	filtered := []string{}
+	for _, network := range networks {
+		if FamilyOf(network) == family {
+			filtered = append(filtered, network)
+		}
+	}
+
+	return filtered
+}
+
+// Family returns a list of the rules whose address is of the family
+func (l *IPRuleList) Family(family IPFamily) *IPRuleList {
+
+	rules := []IPRule{}
+	for _, rule := range l.Rules {
+		if FamilyOf(rule.Address) == family {
+			rules = append(rules, rule)
+		}
+	}
+
+	return NewIPRuleList(rules)
+}
+
+// Family returns a map of the addresses of the family
+func (i *IPMap) Family(family IPFamily) *IPMap {
+
+	ipm := NewIPMap(nil)
+	for k, v := range i.IPs {
+		if FamilyOf(v) == family {
+			ipm.IPs[k] = v
+		}
+	}
+
+	return ipm
+}
+
+// PolicyForFamily returns a copy of the policy where the addresses, the networks and
+// the ACLs are restricted to the ones of the family
+func (p *PUPolicy) PolicyForFamily(family IPFamily) *PUPolicy {
+
+	np := p.Clone()
+
+	np.applicationACLs = np.applicationACLs.Family(family)
+	np.networkACLs = np.networkACLs.Family(family)
+	np.ips = np.ips.Family(family)
+	np.triremeNetworks = FamilyNetworks(np.triremeNetworks, family)
+	np.trustedNetworks = FamilyNetworks(np.trustedNetworks, family)
+
+	for _, n := range np.networkPolicies {
+		if n.ApplicationACLs != nil {
+			n.ApplicationACLs = n.ApplicationACLs.Family(family)
+		}
+		if n.NetworkACLs != nil {
+			n.NetworkACLs = n.NetworkACLs.Family(family)
+		}
+	}
+
+	if np.dnsPolicy != nil && len(np.dnsPolicy.Servers) > 0 {
+		servers := FamilyNetworks(np.dnsPolicy.Servers, family)
+		if len(servers) == 0 {
+			// A restricted list without server of the family blocks all the queries of
+			// the family, rather than allowing all of them
+			servers = []string{blackholeNetwork(family)}
+		}
+		np.dnsPolicy.Servers = servers
+	}
+
+	// The gateway of the mirrored packets must be of the family of the packets
+	if np.mirrorPolicy != nil && np.mirrorPolicy.Target == MirrorGateway && FamilyOf(np.mirrorPolicy.Gateway) != family {
+		np.mirrorPolicy = nil
+	}
+
+	return np
+}
+
+// blackholeNetwork returns a reserved network of the family that never holds a
+// server: the discard prefix of IPv6 and the documentation network of IPv4
+func blackholeNetwork(family IPFamily) string {
+
+	if family == IPv6 {
+		return "100::/64"
+	}
+
+	return "192.0.2.0/24"
+}
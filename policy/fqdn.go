@@ -0,0 +1,127 @@
+package policy
+
+import (
+	"net"
+	"sort"
+	"strings"
+)
+
+// IsDomainName returns true if the address of a rule is a fully qualified domain
+// name, such as api.example.com, rather than an address or a network
+func IsDomainName(address string) bool {
+
+	if net.ParseIP(address) != nil || strings.Contains(address, "/") || strings.Contains(address, ":") {
+		return false
+	}
+
+	name := strings.TrimSuffix(address, ".")
+	if len(name) == 0 || len(name) > 253 {
+		return false
+	}
+
+	letter := false
+	for _, label := range strings.Split(name, ".") {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+
+		for _, c := range label {
+			switch {
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+				letter = true
+			case c >= '0' && c <= '9', c == '-', c == '_':
+			default:
+				return false
+			}
+		}
+	}
+
+	// A name of digits only, such as 10.1, is a partial address
+	return letter
+}
+
+// DomainNames returns the domain names of the rules
+func (l *IPRuleList) DomainNames() []string {
+
+	names := []string{}
+	for _, rule := range l.Rules {
+		if IsDomainName(rule.Address) {
+			names = append(names, rule.Address)
+		}
+	}
+
+	return names
+}
+
+// Resolve returns a list where the rules of the domain names are replaced by one
+// rule per address of the name. The rules of the names without address are removed.
+func (l *IPRuleList) Resolve(addresses map[string][]string) *IPRuleList {
+
+	rules := []IPRule{}
+	for _, rule := range l.Rules {
+		if !IsDomainName(rule.Address) {
+			rules = append(rules, rule)
+			continue
+		}
+
+		for _, address := range addresses[rule.Address] {
+			resolved := rule
+			resolved.Address = address
+			rules = append(rules, resolved)
+		}
+	}
+
+	return NewIPRuleList(rules)
+}
+
+// DomainNames returns the sorted domain names of the ACLs of the policy, including
+// the ones of its network policies
+func (p *PUPolicy) DomainNames() []string {
+	p.puPolicyMutex.Lock()
+	defer p.puPolicyMutex.Unlock()
+
+	unique := map[string]bool{}
+
+	lists := []*IPRuleList{p.applicationACLs, p.networkACLs}
+	for _, n := range p.networkPolicies {
+		lists = append(lists, n.ApplicationACLs, n.NetworkACLs)
+	}
+
+	for _, l := range lists {
+		if l == nil {
+			continue
+		}
+		for _, name := range l.DomainNames() {
+			unique[name] = true
+		}
+	}
+
+	names := []string{}
+	for name := range unique {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// PolicyForAddresses returns a copy of the policy where the domain names of the
+// ACLs are replaced by their addresses
+func (p *PUPolicy) PolicyForAddresses(addresses map[string][]string) *PUPolicy {
+
+	np := p.Clone()
+
+	np.applicationACLs = np.applicationACLs.Resolve(addresses)
+	np.networkACLs = np.networkACLs.Resolve(addresses)
+
+	for _, n := range np.networkPolicies {
+		if n.ApplicationACLs != nil {
+			n.ApplicationACLs = n.ApplicationACLs.Resolve(addresses)
+		}
+		if n.NetworkACLs != nil {
+			n.NetworkACLs = n.NetworkACLs.Resolve(addresses)
+		}
+	}
+
+	return np
+}
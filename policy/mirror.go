@@ -0,0 +1,85 @@
+package policy
+
+import (
+	"fmt"
+	"net"
+)
+
+// MirrorTarget is the kind of destination of the mirrored packets
+type MirrorTarget string
+
+const (
+	// MirrorGateway sends a copy of the full packets to a gateway with the TEE target.
+	// The gateway is usually the remote end of an ERSPAN or VXLAN tunnel configured on
+	// the host, or an IDS on a directly connected network.
+	MirrorGateway MirrorTarget = "gateway"
+	// MirrorNFLOG sends a copy of the packets to a netlink log group, where they can be
+	// captured in pcap format on the host, for instance with tcpdump -i nflog:<group>
+	MirrorNFLOG MirrorTarget = "nflog"
+)
+
+// MirrorHeadersLength is the length the packets are truncated to when only their
+// headers are mirrored. It covers the IPv4 and TCP headers with all their options.
+const MirrorHeadersLength = 128
+
+// MirrorPolicy is the destination of the packets of the ACLs with the Mirror action
+type MirrorPolicy struct {
+	// Target is the kind of destination
+	Target MirrorTarget
+	// Gateway is the address of the gateway of the MirrorGateway target
+	Gateway string
+	// Group is the netlink log group of the MirrorNFLOG target
+	Group int
+	// HeadersOnly truncates the mirrored packets to MirrorHeadersLength. Only the
+	// MirrorNFLOG target can truncate the packets.
+	HeadersOnly bool
+	// RateLimit caps the number of packets mirrored per second for each ACL. All the
+	// packets are mirrored when it is zero.
+	RateLimit int
+}
+
+// Clone returns a copy of the mirror policy
+func (m *MirrorPolicy) Clone() *MirrorPolicy {
+
+	c := *m
+
+	return &c
+}
+
+// Validate returns an error if the mirror policy is incomplete or inconsistent
+func (m *MirrorPolicy) Validate() error {
+
+	switch m.Target {
+	case MirrorGateway:
+		if net.ParseIP(m.Gateway) == nil {
+			return fmt.Errorf("Invalid mirror gateway %s", m.Gateway)
+		}
+		if m.HeadersOnly {
+			return fmt.Errorf("Mirror gateway cannot truncate the packets")
+		}
+	case MirrorNFLOG:
+		if m.Group < 0 || m.Group > 65535 {
+			return fmt.Errorf("Invalid mirror log group %d", m.Group)
+		}
+	default:
+		return fmt.Errorf("Unknown mirror target %s", m.Target)
+	}
+
+	if m.RateLimit < 0 {
+		return fmt.Errorf("Invalid mirror rate limit %d", m.RateLimit)
+	}
+
+	return nil
+}
+
+// Mirrored returns true if some ACLs of the list mirror their flows
+func (l *IPRuleList) Mirrored() bool {
+
+	for _, rule := range l.Rules {
+		if rule.Action&Mirror != 0 {
+			return true
+		}
+	}
+
+	return false
+}
@@ -1,6 +1,40 @@
 package policy
 
-import "sync"
+import (
+	"strings"
+	"sync"
+)
+
+// NetworkPolicy is the section of the policy that applies to the interface of a
+// processing unit attached to a given network. Nil fields inherit the rules of
+// the processing unit.
+type NetworkPolicy struct {
+	ApplicationACLs  *IPRuleList
+	NetworkACLs      *IPRuleList
+	TransmitterRules *TagSelectorList
+	ReceiverRules    *TagSelectorList
+}
+
+// Clone returns a copy of the network policy
+func (n *NetworkPolicy) Clone() *NetworkPolicy {
+
+	c := &NetworkPolicy{}
+
+	if n.ApplicationACLs != nil {
+		c.ApplicationACLs = n.ApplicationACLs.Clone()
+	}
+	if n.NetworkACLs != nil {
+		c.NetworkACLs = n.NetworkACLs.Clone()
+	}
+	if n.TransmitterRules != nil {
+		c.TransmitterRules = n.TransmitterRules.Clone()
+	}
+	if n.ReceiverRules != nil {
+		c.ReceiverRules = n.ReceiverRules.Clone()
+	}
+
+	return c
+}
 
 // PUPolicy captures all policy information related ot the container
 type PUPolicy struct {
@@ -29,6 +63,25 @@ type PUPolicy struct {
 	ips *IPMap
 	// triremeNetworks is the list of networks that Authorization must be enforced
 	triremeNetworks []string
+	// trustedNetworks is the list of networks whose traffic is accepted without
+	// the identity handshake
+	trustedNetworks []string
+	// dnsPolicy restricts the DNS queries of the PU, or is nil
+	dnsPolicy *DNSPolicy
+	// mirrorPolicy is the destination of the flows of the mirrored ACLs, or nil
+	mirrorPolicy *MirrorPolicy
+	// issuerRules restrict the certificate authorities of the peers of the PU
+	issuerRules []*IssuerRule
+	// resetRejected resets the rejected flows of the PU instead of dropping them
+	resetRejected bool
+	// keepTrackedFlows leaves the established flows of the PU denied by a new
+	// version of its policy until they expire
+	keepTrackedFlows bool
+	// features are the names of the datapath features enabled for the PU
+	features []string
+	// networkPolicies are the sections of the policy specific to the interfaces
+	// of the container, indexed by the network name of the ips
+	networkPolicies map[string]*NetworkPolicy
 	// Extensions is an interface to a data structure that allows the policy supervisor
 	// to pass additional instructions to a plugin. Plugin and policy must be
 	// coordinated to implement the interface
@@ -80,6 +133,7 @@ func NewPUPolicy(
 		annotations:      annotations,
 		ips:              ips,
 		triremeNetworks:  triremeNetworks,
+		networkPolicies:  map[string]*NetworkPolicy{},
 		Extensions:       e,
 	}
 }
@@ -109,6 +163,31 @@ func (p *PUPolicy) Clone() *PUPolicy {
 		p.Extensions,
 	)
 
+	for network, n := range p.networkPolicies {
+		np.networkPolicies[network] = n.Clone()
+	}
+
+	if p.trustedNetworks != nil {
+		np.trustedNetworks = append([]string{}, p.trustedNetworks...)
+	}
+
+	if p.dnsPolicy != nil {
+		np.dnsPolicy = p.dnsPolicy.Clone()
+	}
+
+	if p.mirrorPolicy != nil {
+		np.mirrorPolicy = p.mirrorPolicy.Clone()
+	}
+
+	np.issuerRules = cloneIssuerRules(p.issuerRules)
+
+	np.resetRejected = p.resetRejected
+	np.keepTrackedFlows = p.keepTrackedFlows
+
+	if p.features != nil {
+		np.features = append([]string{}, p.features...)
+	}
+
 	return np
 }
 
@@ -184,6 +263,14 @@ func (p *PUPolicy) AddIdentityTag(k, v string) {
 	p.identity.Tags[k] = v
 }
 
+// AddAnnotation adds an annotation to the policy
+func (p *PUPolicy) AddAnnotation(k, v string) {
+	p.puPolicyMutex.Lock()
+	defer p.puPolicyMutex.Unlock()
+
+	p.annotations.Tags[k] = v
+}
+
 // IPAddresses returns all the IP addresses for the processing unit
 func (p *PUPolicy) IPAddresses() *IPMap {
 	p.puPolicyMutex.Lock()
@@ -224,3 +311,246 @@ func (p *PUPolicy) UpdateTriremeNetworks(networks []string) {
 	p.triremeNetworks = []string{}
 	p.triremeNetworks = append(p.triremeNetworks, networks...)
 }
+
+// TrustedNetworks returns the list of networks whose traffic bypasses the identity
+// handshake. The connections are still reported.
+func (p *PUPolicy) TrustedNetworks() []string {
+	p.puPolicyMutex.Lock()
+	defer p.puPolicyMutex.Unlock()
+
+	return append([]string{}, p.trustedNetworks...)
+}
+
+// UpdateTrustedNetworks updates the set of trusted networks
+func (p *PUPolicy) UpdateTrustedNetworks(networks []string) {
+	p.puPolicyMutex.Lock()
+	defer p.puPolicyMutex.Unlock()
+
+	p.trustedNetworks = append([]string{}, networks...)
+}
+
+// DNSPolicy returns a copy of the DNS policy, or nil if the DNS queries are not
+// restricted
+func (p *PUPolicy) DNSPolicy() *DNSPolicy {
+	p.puPolicyMutex.Lock()
+	defer p.puPolicyMutex.Unlock()
+
+	if p.dnsPolicy == nil {
+		return nil
+	}
+
+	return p.dnsPolicy.Clone()
+}
+
+// UpdateDNSPolicy updates the DNS policy. A nil policy removes the restrictions.
+func (p *PUPolicy) UpdateDNSPolicy(d *DNSPolicy) {
+	p.puPolicyMutex.Lock()
+	defer p.puPolicyMutex.Unlock()
+
+	if d == nil {
+		p.dnsPolicy = nil
+		return
+	}
+
+	p.dnsPolicy = d.Clone()
+}
+
+// MirrorPolicy returns a copy of the mirror policy, or nil if no flow is mirrored
+func (p *PUPolicy) MirrorPolicy() *MirrorPolicy {
+	p.puPolicyMutex.Lock()
+	defer p.puPolicyMutex.Unlock()
+
+	if p.mirrorPolicy == nil {
+		return nil
+	}
+
+	return p.mirrorPolicy.Clone()
+}
+
+// UpdateMirrorPolicy updates the destination of the mirrored flows. A nil policy
+// stops the mirroring.
+func (p *PUPolicy) UpdateMirrorPolicy(m *MirrorPolicy) {
+	p.puPolicyMutex.Lock()
+	defer p.puPolicyMutex.Unlock()
+
+	if m == nil {
+		p.mirrorPolicy = nil
+		return
+	}
+
+	p.mirrorPolicy = m.Clone()
+}
+
+// IssuerRules returns a copy of the rules restricting the certificate authorities of
+// the peers
+func (p *PUPolicy) IssuerRules() []*IssuerRule {
+	p.puPolicyMutex.Lock()
+	defer p.puPolicyMutex.Unlock()
+
+	return cloneIssuerRules(p.issuerRules)
+}
+
+// UpdateIssuerRules updates the rules restricting the certificate authorities of the
+// peers. The peers of all the certificate authorities are accepted without rules.
+func (p *PUPolicy) UpdateIssuerRules(rules []*IssuerRule) {
+	p.puPolicyMutex.Lock()
+	defer p.puPolicyMutex.Unlock()
+
+	p.issuerRules = cloneIssuerRules(rules)
+}
+
+// cloneIssuerRules returns a copy of the issuer rules, or nil if there are none
+func cloneIssuerRules(rules []*IssuerRule) []*IssuerRule {
+
+	if len(rules) == 0 {
+		return nil
+	}
+
+	c := make([]*IssuerRule, len(rules))
+	for i, r := range rules {
+		c[i] = r.Clone()
+	}
+
+	return c
+}
+
+// ResetRejected returns true if the rejected flows of the PU are reset whatever
+// the rule rejecting them
+func (p *PUPolicy) ResetRejected() bool {
+	p.puPolicyMutex.Lock()
+	defer p.puPolicyMutex.Unlock()
+
+	return p.resetRejected
+}
+
+// UpdateResetRejected sets whether the rejected flows of the PU are reset
+func (p *PUPolicy) UpdateResetRejected(reset bool) {
+	p.puPolicyMutex.Lock()
+	defer p.puPolicyMutex.Unlock()
+
+	p.resetRejected = reset
+}
+
+// KeepTrackedFlows returns true if the established flows of the PU are left to
+// expire when a new version of its policy denies them
+func (p *PUPolicy) KeepTrackedFlows() bool {
+	p.puPolicyMutex.Lock()
+	defer p.puPolicyMutex.Unlock()
+
+	return p.keepTrackedFlows
+}
+
+// UpdateKeepTrackedFlows sets whether the established flows of the PU denied by a
+// new version of its policy are left to expire
+func (p *PUPolicy) UpdateKeepTrackedFlows(keep bool) {
+	p.puPolicyMutex.Lock()
+	defer p.puPolicyMutex.Unlock()
+
+	p.keepTrackedFlows = keep
+}
+
+// Features returns the names of the datapath features enabled for the PU
+func (p *PUPolicy) Features() []string {
+	p.puPolicyMutex.Lock()
+	defer p.puPolicyMutex.Unlock()
+
+	return append([]string{}, p.features...)
+}
+
+// UpdateFeatures sets the names of the datapath features enabled for the PU
+func (p *PUPolicy) UpdateFeatures(features []string) {
+	p.puPolicyMutex.Lock()
+	defer p.puPolicyMutex.Unlock()
+
+	if len(features) == 0 {
+		p.features = nil
+		return
+	}
+
+	p.features = append([]string{}, features...)
+}
+
+// FeatureEnabled returns true if the datapath feature is enabled for the PU
+func (p *PUPolicy) FeatureEnabled(feature string) bool {
+	p.puPolicyMutex.Lock()
+	defer p.puPolicyMutex.Unlock()
+
+	for _, f := range p.features {
+		if f == feature {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SetNetworkPolicy sets the section of the policy that applies to the interface
+// attached to the network
+func (p *PUPolicy) SetNetworkPolicy(network string, n *NetworkPolicy) {
+	p.puPolicyMutex.Lock()
+	defer p.puPolicyMutex.Unlock()
+
+	p.networkPolicies[network] = n.Clone()
+}
+
+// NetworkPolicy returns a copy of the section of the policy for the network
+func (p *PUPolicy) NetworkPolicy(network string) (*NetworkPolicy, bool) {
+	p.puPolicyMutex.Lock()
+	defer p.puPolicyMutex.Unlock()
+
+	n, ok := p.networkPolicies[network]
+	if !ok {
+		return nil, false
+	}
+
+	return n.Clone(), true
+}
+
+// PolicyForNetwork returns a copy of the policy where the rules are replaced by
+// the ones of the section for the network, if any. The IPv6 address of a network
+// has the section of the network.
+func (p *PUPolicy) PolicyForNetwork(network string) *PUPolicy {
+
+	np := p.Clone()
+
+	n, ok := np.networkPolicies[network]
+	if !ok {
+		n, ok = np.networkPolicies[strings.TrimSuffix(network, IPv6NetworkSuffix)]
+	}
+	if !ok {
+		return np
+	}
+
+	if n.ApplicationACLs != nil {
+		np.applicationACLs = n.ApplicationACLs
+	}
+	if n.NetworkACLs != nil {
+		np.networkACLs = n.NetworkACLs
+	}
+	if n.TransmitterRules != nil {
+		np.transmitterRules = n.TransmitterRules
+	}
+	if n.ReceiverRules != nil {
+		np.receiverRules = n.ReceiverRules
+	}
+
+	return np
+}
+
+// PromoteDefaultNetwork returns a copy of the policy where the first additional
+// network becomes the default one, with the rules of its section, when the policy
+// has no default address, like a PU restricted to one of the families of its
+// addresses. Otherwise it returns the policy itself.
+func (p *PUPolicy) PromoteDefaultNetwork() *PUPolicy {
+
+	ips, network := p.IPAddresses().PromoteDefault()
+	if network == "" {
+		return p
+	}
+
+	np := p.PolicyForNetwork(network)
+	np.ips = ips
+	delete(np.networkPolicies, network)
+
+	return np
+}
@@ -7,6 +7,10 @@ import (
 	"github.com/aporeto-inc/trireme/constants"
 )
 
+// NetNSPathOption is the runtime option holding the path of the network namespace of
+// a PU that is not identified by a PID, like the namespaces created with ip netns
+const NetNSPathOption = "@netns_path"
+
 // PURuntime holds all data related to the status of the container run time
 type PURuntime struct {
 	// puType is the type of the PU (container or process )
@@ -119,6 +123,15 @@ func (r *PURuntime) SetPid(pid int) {
 	r.pid = pid
 }
 
+// NetNSPath returns the path of the network namespace of the PU if it is not
+// identified by a PID
+func (r *PURuntime) NetNSPath() (string, bool) {
+	r.puRuntimeMutex.Lock()
+	defer r.puRuntimeMutex.Unlock()
+
+	return r.options.Get(NetNSPathOption)
+}
+
 // SetOptions sets the Options
 func (r *PURuntime) SetOptions(options *TagsMap) {
 	r.options = options
@@ -177,6 +190,14 @@ func (r *PURuntime) Tags() *TagsMap {
 	return r.tags.Clone()
 }
 
+// SetTags sets the tags of the processing unit
+func (r *PURuntime) SetTags(tags *TagsMap) {
+	r.puRuntimeMutex.Lock()
+	defer r.puRuntimeMutex.Unlock()
+
+	r.tags = tags.Clone()
+}
+
 // Options returns tags for the processing unit
 func (r *PURuntime) Options() *TagsMap {
 	r.puRuntimeMutex.Lock()
@@ -0,0 +1,365 @@
+package policy
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// ServicePort is a protocol and a port, or a range of ports such as 9092:9093, of a
+// service
+type ServicePort struct {
+	Protocol string
+	Port     string
+}
+
+// Service is a named set of protocols and ports, such as https for TCP/443. The
+// IPRules of a service apply to all its ports. Its aliases are other names of the
+// service, like its names in the languages of the teams writing the policies.
+type Service struct {
+	Name    string
+	Aliases []string
+	Ports   []ServicePort
+}
+
+// WellKnownServices are the services registered in the registries of Trireme unless
+// they are unregistered
+var WellKnownServices = []*Service{
+	{Name: "dns", Ports: []ServicePort{{Protocol: "UDP", Port: "53"}, {Protocol: "TCP", Port: "53"}}},
+	{Name: "http", Ports: []ServicePort{{Protocol: "TCP", Port: "80"}}},
+	{Name: "https", Ports: []ServicePort{{Protocol: "TCP", Port: "443"}}},
+	{Name: "ssh", Ports: []ServicePort{{Protocol: "TCP", Port: "22"}}},
+}
+
+// ServiceName returns the canonical form of a name of a service. The names are
+// compared without their case and their surrounding spaces, in any language.
+func ServiceName(name string) string {
+
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// validServiceName returns an error if a name of a service is not made of letters,
+// digits, dashes, underscores and dots
+func validServiceName(name string) error {
+
+	if name == "" {
+		return fmt.Errorf("Empty service name")
+	}
+
+	for _, c := range name {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '-' && c != '_' && c != '.' {
+			return fmt.Errorf("Invalid character %q in service name %s", c, name)
+		}
+	}
+
+	return nil
+}
+
+// normalizePort returns the port or the range of ports of a service in the form of the
+// IPRules, with the ranges separated by a colon
+func normalizePort(port string) (string, error) {
+
+	bounds := strings.FieldsFunc(port, func(c rune) bool { return c == ':' || c == '-' })
+	if len(bounds) == 0 || len(bounds) > 2 || strings.Count(port, ":")+strings.Count(port, "-") != len(bounds)-1 {
+		return "", fmt.Errorf("Invalid port %s", port)
+	}
+
+	values := []int{}
+	for _, bound := range bounds {
+		value, err := strconv.Atoi(bound)
+		if err != nil || value < 1 || value > 65535 {
+			return "", fmt.Errorf("Invalid port %s", port)
+		}
+		values = append(values, value)
+	}
+
+	if len(values) == 2 && values[0] > values[1] {
+		return "", fmt.Errorf("Invalid port range %s", port)
+	}
+
+	return strings.Join(bounds, ":"), nil
+}
+
+// normalize returns a copy of the service with the canonical names, the protocols in
+// upper case and the ranges separated by a colon, or an error if it is invalid
+func (s *Service) normalize() (*Service, error) {
+
+	normalized := &Service{Name: ServiceName(s.Name)}
+	if err := validServiceName(normalized.Name); err != nil {
+		return nil, err
+	}
+
+	for _, alias := range s.Aliases {
+		alias = ServiceName(alias)
+		if err := validServiceName(alias); err != nil {
+			return nil, err
+		}
+		normalized.Aliases = append(normalized.Aliases, alias)
+	}
+
+	if len(s.Ports) == 0 {
+		return nil, fmt.Errorf("Service %s has no port", s.Name)
+	}
+
+	for _, p := range s.Ports {
+		protocol := strings.ToUpper(p.Protocol)
+		if protocol != "TCP" && protocol != "UDP" {
+			return nil, fmt.Errorf("Invalid protocol %s of service %s", p.Protocol, s.Name)
+		}
+
+		port, err := normalizePort(p.Port)
+		if err != nil {
+			return nil, fmt.Errorf("Service %s: %s", s.Name, err)
+		}
+
+		normalized.Ports = append(normalized.Ports, ServicePort{Protocol: protocol, Port: port})
+	}
+
+	return normalized, nil
+}
+
+// ServiceRegistry holds the definitions of the services referenced by the IPRules. A
+// service is found by its name or by any of its aliases.
+type ServiceRegistry struct {
+	services map[string]*Service
+	names    map[string]string
+	sync.RWMutex
+}
+
+// NewServiceRegistry returns a registry of the services after validating them
+func NewServiceRegistry(services ...*Service) (*ServiceRegistry, error) {
+
+	r := &ServiceRegistry{
+		services: map[string]*Service{},
+		names:    map[string]string{},
+	}
+
+	for _, s := range services {
+		if err := r.Register(s); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// NewWellKnownServiceRegistry returns a registry of the well known services. It
+// panics if they were changed to invalid services.
+func NewWellKnownServiceRegistry() *ServiceRegistry {
+
+	r, err := NewServiceRegistry(WellKnownServices...)
+	if err != nil {
+		panic(fmt.Sprintf("Invalid well known services: %s", err))
+	}
+
+	return r
+}
+
+// Register adds a service to the registry, or replaces the service of the same name.
+// It fails if the service is invalid or if one of its names is a name of another
+// service.
+func (r *ServiceRegistry) Register(s *Service) error {
+
+	normalized, err := s.normalize()
+	if err != nil {
+		return err
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	for _, name := range append([]string{normalized.Name}, normalized.Aliases...) {
+		if owner, ok := r.names[name]; ok && owner != normalized.Name {
+			return fmt.Errorf("Service name %s already used by service %s", name, owner)
+		}
+	}
+
+	r.unregister(normalized.Name)
+
+	r.services[normalized.Name] = normalized
+	for _, name := range append([]string{normalized.Name}, normalized.Aliases...) {
+		r.names[name] = normalized.Name
+	}
+
+	return nil
+}
+
+// Unregister removes the service of a name or an alias from the registry
+func (r *ServiceRegistry) Unregister(name string) {
+
+	r.Lock()
+	defer r.Unlock()
+
+	if owner, ok := r.names[ServiceName(name)]; ok {
+		r.unregister(owner)
+	}
+}
+
+// unregister removes a service by its canonical name. It must be called with the lock
+// held.
+func (r *ServiceRegistry) unregister(name string) {
+
+	s, ok := r.services[name]
+	if !ok {
+		return
+	}
+
+	delete(r.services, name)
+	for _, n := range append([]string{s.Name}, s.Aliases...) {
+		delete(r.names, n)
+	}
+}
+
+// Lookup returns the service of a name or an alias
+func (r *ServiceRegistry) Lookup(name string) (*Service, bool) {
+
+	r.RLock()
+	defer r.RUnlock()
+
+	owner, ok := r.names[ServiceName(name)]
+	if !ok {
+		return nil, false
+	}
+
+	return r.services[owner], true
+}
+
+// Services returns the services of the registry sorted by name
+func (r *ServiceRegistry) Services() []*Service {
+
+	r.RLock()
+	defer r.RUnlock()
+
+	services := make([]*Service, 0, len(r.services))
+	for _, s := range r.services {
+		services = append(services, s)
+	}
+
+	sort.Sort(servicesByName(services))
+
+	return services
+}
+
+// servicesByName sorts the services by name
+type servicesByName []*Service
+
+func (s servicesByName) Len() int           { return len(s) }
+func (s servicesByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s servicesByName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+
+// ServiceNames returns the services referenced by the rules
+func (l *IPRuleList) ServiceNames() []string {
+
+	names := []string{}
+	for _, rule := range l.Rules {
+		if rule.Service != "" {
+			names = append(names, rule.Service)
+		}
+	}
+
+	return names
+}
+
+// ResolveServices returns a list where the rules of a service are replaced by one rule
+// per port of the service. The protocol of a rule of a service restricts it to the
+// ports of the protocol. It fails if a service is unknown.
+func (l *IPRuleList) ResolveServices(registry *ServiceRegistry) (*IPRuleList, error) {
+
+	rules := []IPRule{}
+	for _, rule := range l.Rules {
+		if rule.Service == "" {
+			rules = append(rules, rule)
+			continue
+		}
+
+		service, ok := registry.Lookup(rule.Service)
+		if !ok {
+			return nil, fmt.Errorf("Unknown service %s", rule.Service)
+		}
+
+		matched := false
+		for _, p := range service.Ports {
+			if rule.Protocol != "" && !strings.EqualFold(rule.Protocol, p.Protocol) {
+				continue
+			}
+
+			resolved := rule
+			resolved.Service = ""
+			resolved.Protocol = p.Protocol
+			resolved.Port = p.Port
+			rules = append(rules, resolved)
+			matched = true
+		}
+
+		if !matched {
+			return nil, fmt.Errorf("Service %s has no port of protocol %s", rule.Service, rule.Protocol)
+		}
+	}
+
+	return NewIPRuleList(rules), nil
+}
+
+// ServiceNames returns the sorted services referenced by the ACLs of the policy,
+// including the ones of its network policies
+func (p *PUPolicy) ServiceNames() []string {
+	p.puPolicyMutex.Lock()
+	defer p.puPolicyMutex.Unlock()
+
+	unique := map[string]bool{}
+
+	lists := []*IPRuleList{p.applicationACLs, p.networkACLs}
+	for _, n := range p.networkPolicies {
+		lists = append(lists, n.ApplicationACLs, n.NetworkACLs)
+	}
+
+	for _, l := range lists {
+		if l == nil {
+			continue
+		}
+		for _, name := range l.ServiceNames() {
+			unique[name] = true
+		}
+	}
+
+	names := []string{}
+	for name := range unique {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// PolicyForServices returns a copy of the policy where the rules of the services of
+// the ACLs are replaced by the rules of their ports
+func (p *PUPolicy) PolicyForServices(registry *ServiceRegistry) (*PUPolicy, error) {
+
+	np := p.Clone()
+
+	var err error
+	if np.applicationACLs, err = np.applicationACLs.ResolveServices(registry); err != nil {
+		return nil, err
+	}
+
+	if np.networkACLs, err = np.networkACLs.ResolveServices(registry); err != nil {
+		return nil, err
+	}
+
+	for _, n := range np.networkPolicies {
+		if n.ApplicationACLs != nil {
+			if n.ApplicationACLs, err = n.ApplicationACLs.ResolveServices(registry); err != nil {
+				return nil, err
+			}
+		}
+		if n.NetworkACLs != nil {
+			if n.NetworkACLs, err = n.NetworkACLs.ResolveServices(registry); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return np, nil
+}
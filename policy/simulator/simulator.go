@@ -0,0 +1,185 @@
+// Package simulator evaluates recorded flows against a candidate set of
+// policies. It allows a policy implementation to find out which flows would be
+// accepted or rejected before a new set of policies is rolled out.
+package simulator
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/enforcer/lookup"
+	"github.com/aporeto-inc/trireme/policy"
+)
+
+const (
+	// portNumberLabel is the label added by the datapath with the destination port
+	portNumberLabel = "@port"
+
+	// Unresolved indicates that the flow could not be evaluated because the
+	// identity of the source or the policy of the destination is not known
+	Unresolved = "unresolved"
+)
+
+// Result is the outcome of the simulation of a single flow
+type Result struct {
+	// Record is the recorded flow
+	Record *collector.FlowRecord
+	// Action is the simulated action. One of collector.FlowAccept,
+	// collector.FlowReject or Unresolved
+	Action string
+	// Changed is true if the simulated action differs from the recorded one
+	Changed bool
+}
+
+// Report summarizes the outcome of a simulation
+type Report struct {
+	Total      int
+	Accepted   int
+	Rejected   int
+	Unresolved int
+	Changed    int
+	Results    []*Result
+}
+
+// ruleDB holds the lookup tables of the receiver rules of a PU
+type ruleDB struct {
+	accept *lookup.PolicyDB
+	reject *lookup.PolicyDB
+}
+
+// Simulator evaluates flows against a set of policies
+type Simulator struct {
+	rules      map[string]*ruleDB
+	identities map[string]*policy.TagsMap
+}
+
+// NewSimulator returns a simulator without any policy
+func NewSimulator() *Simulator {
+
+	return &Simulator{
+		rules:      map[string]*ruleDB{},
+		identities: map[string]*policy.TagsMap{},
+	}
+}
+
+// AddPolicy adds the candidate policy of the PU identified by contextID. The
+// identity of the policy is used for flows originating from the PU.
+func (s *Simulator) AddPolicy(contextID string, p *policy.PUPolicy) {
+
+	db := &ruleDB{
+		accept: lookup.NewPolicyDB(),
+		reject: lookup.NewPolicyDB(),
+	}
+
+	for _, rule := range p.ReceiverRules().TagSelectors {
+		if rule.Action&policy.Accept != 0 {
+			db.accept.AddPolicy(rule)
+		} else if rule.Action&policy.Reject != 0 {
+			db.reject.AddPolicy(rule)
+		}
+	}
+
+	s.rules[contextID] = db
+
+	sourceID := p.ManagementID
+	if sourceID == "" {
+		sourceID = contextID
+	}
+	s.identities[sourceID] = p.Identity()
+}
+
+// AddIdentity adds the identity of a source that is not covered by the
+// candidate policies, such as a PU running on a different node.
+func (s *Simulator) AddIdentity(sourceID string, identity *policy.TagsMap) {
+
+	s.identities[sourceID] = identity
+}
+
+// Evaluate returns the action that the candidate policies apply to a flow
+func (s *Simulator) Evaluate(record *collector.FlowRecord) string {
+
+	db, ok := s.rules[record.ContextID]
+	if !ok {
+		return Unresolved
+	}
+
+	identity, ok := s.identities[record.SourceID]
+	if !ok {
+		return Unresolved
+	}
+
+	tags := identity.Clone()
+	tags.Add(portNumberLabel, strconv.Itoa(int(record.DestinationPort)))
+
+	// Reject rules are always processed first, as in the datapath
+	if index, _ := db.reject.Search(tags); index >= 0 {
+		return collector.FlowReject
+	}
+
+	if index, _ := db.accept.Search(tags); index >= 0 {
+		return collector.FlowAccept
+	}
+
+	return collector.FlowReject
+}
+
+// Simulate evaluates all the records and reports the outcome. Only records that
+// were the result of a policy decision are evaluated. Records rejected for
+// other reasons, like an invalid token, are ignored.
+func (s *Simulator) Simulate(records []*collector.FlowRecord) *Report {
+
+	report := &Report{
+		Results: []*Result{},
+	}
+
+	for _, record := range records {
+
+		if record.Action == collector.FlowReject && record.Mode != collector.PolicyDrop {
+			continue
+		}
+
+		result := &Result{
+			Record: record,
+			Action: s.Evaluate(record),
+		}
+
+		switch result.Action {
+		case collector.FlowAccept:
+			report.Accepted++
+		case collector.FlowReject:
+			report.Rejected++
+		default:
+			report.Unresolved++
+		}
+
+		if result.Action != Unresolved && result.Action != record.Action {
+			result.Changed = true
+			report.Changed++
+		}
+
+		report.Total++
+		report.Results = append(report.Results, result)
+	}
+
+	return report
+}
+
+// ReadFlowRecords reads a stream of JSON encoded flow records
+func ReadFlowRecords(r io.Reader) ([]*collector.FlowRecord, error) {
+
+	records := []*collector.FlowRecord{}
+	decoder := json.NewDecoder(r)
+
+	for {
+		record := &collector.FlowRecord{}
+		if err := decoder.Decode(record); err != nil {
+			if err == io.EOF {
+				return records, nil
+			}
+			return nil, err
+		}
+		records = append(records, record)
+	}
+}
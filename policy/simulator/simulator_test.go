@@ -0,0 +1,125 @@
+package simulator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/policy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newPolicy(managementID string, identity map[string]string, rules []policy.TagSelector) *policy.PUPolicy {
+	return policy.NewPUPolicy(
+		managementID,
+		policy.Police,
+		nil,
+		nil,
+		nil,
+		policy.NewTagSelectorList(rules),
+		policy.NewTagsMap(identity),
+		nil,
+		nil,
+		nil,
+		nil,
+	)
+}
+
+func TestEvaluate(t *testing.T) {
+	Convey("Given a simulator with a server accepting web clients and rejecting qa", t, func() {
+		s := NewSimulator()
+
+		s.AddPolicy("server", newPolicy("server", map[string]string{"app": "db"}, []policy.TagSelector{
+			{
+				Clause: []policy.KeyValueOperator{{Key: "app", Value: []string{"web"}, Operator: policy.Equal}},
+				Action: policy.Accept,
+			},
+			{
+				Clause: []policy.KeyValueOperator{{Key: "env", Value: []string{"qa"}, Operator: policy.Equal}},
+				Action: policy.Reject,
+			},
+		}))
+		s.AddIdentity("web", policy.NewTagsMap(map[string]string{"app": "web"}))
+		s.AddIdentity("webqa", policy.NewTagsMap(map[string]string{"app": "web", "env": "qa"}))
+
+		Convey("A flow from a web client should be accepted", func() {
+			So(s.Evaluate(&collector.FlowRecord{ContextID: "server", SourceID: "web"}), ShouldEqual, collector.FlowAccept)
+		})
+
+		Convey("A flow from a qa web client should be rejected", func() {
+			So(s.Evaluate(&collector.FlowRecord{ContextID: "server", SourceID: "webqa"}), ShouldEqual, collector.FlowReject)
+		})
+
+		Convey("A flow from the server to itself should be rejected", func() {
+			So(s.Evaluate(&collector.FlowRecord{ContextID: "server", SourceID: "server"}), ShouldEqual, collector.FlowReject)
+		})
+
+		Convey("A flow from an unknown source should be unresolved", func() {
+			So(s.Evaluate(&collector.FlowRecord{ContextID: "server", SourceID: "unknown"}), ShouldEqual, Unresolved)
+		})
+
+		Convey("A flow to an unknown destination should be unresolved", func() {
+			So(s.Evaluate(&collector.FlowRecord{ContextID: "unknown", SourceID: "web"}), ShouldEqual, Unresolved)
+		})
+	})
+
+	Convey("Given a simulator with a port specific policy", t, func() {
+		s := NewSimulator()
+		s.AddPolicy("server", newPolicy("", nil, []policy.TagSelector{
+			{
+				Clause: []policy.KeyValueOperator{{Key: portNumberLabel, Value: []string{"443"}, Operator: policy.Equal}},
+				Action: policy.Accept,
+			},
+		}))
+
+		Convey("Only flows to the port should be accepted", func() {
+			So(s.Evaluate(&collector.FlowRecord{ContextID: "server", SourceID: "server", DestinationPort: 443}), ShouldEqual, collector.FlowAccept)
+			So(s.Evaluate(&collector.FlowRecord{ContextID: "server", SourceID: "server", DestinationPort: 80}), ShouldEqual, collector.FlowReject)
+		})
+	})
+}
+
+func TestSimulate(t *testing.T) {
+	Convey("Given a simulator and recorded flows", t, func() {
+		s := NewSimulator()
+		s.AddPolicy("server", newPolicy("server", nil, []policy.TagSelector{
+			{
+				Clause: []policy.KeyValueOperator{{Key: "app", Value: []string{"web"}, Operator: policy.Equal}},
+				Action: policy.Accept,
+			},
+		}))
+		s.AddIdentity("web", policy.NewTagsMap(map[string]string{"app": "web"}))
+		s.AddIdentity("other", policy.NewTagsMap(map[string]string{"app": "other"}))
+
+		data := `{"ContextID":"server","SourceID":"web","Action":"reject","Mode":"policy"}
+{"ContextID":"server","SourceID":"other","Action":"accept"}
+{"ContextID":"server","SourceID":"web","Action":"reject","Mode":"token"}
+{"ContextID":"server","SourceID":"missing","Action":"accept"}`
+
+		records, err := ReadFlowRecords(strings.NewReader(data))
+		So(err, ShouldBeNil)
+		So(len(records), ShouldEqual, 4)
+
+		Convey("When I simulate the flows", func() {
+			report := s.Simulate(records)
+
+			Convey("I should get the outcome of the policy decisions only", func() {
+				So(report.Total, ShouldEqual, 3)
+				So(report.Accepted, ShouldEqual, 1)
+				So(report.Rejected, ShouldEqual, 1)
+				So(report.Unresolved, ShouldEqual, 1)
+				So(report.Changed, ShouldEqual, 2)
+				So(report.Results[0].Changed, ShouldBeTrue)
+				So(report.Results[2].Changed, ShouldBeFalse)
+			})
+		})
+	})
+
+	Convey("When I read invalid flow records", t, func() {
+		_, err := ReadFlowRecords(strings.NewReader("{invalid"))
+
+		Convey("I should get an error", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
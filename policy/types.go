@@ -1,5 +1,7 @@
 package policy
 
+import "sort"
+
 // This file defines types and accessor methods for these types
 
 // Operator defines the operation between your key and value.
@@ -28,11 +30,23 @@ const (
 	Log FlowAction = 0x4
 	// Encrypt instructs data to be encrypted
 	Encrypt FlowAction = 0x8
+	// Reset instructs a rejected flow to be reset instead of silently dropped, so
+	// that the client fails fast
+	Reset FlowAction = 0x10
+	// Mirror instructs the packets of the flows of an ACL to be copied to the mirror
+	// destination of the policy, whatever the other actions of the rule
+	Mirror FlowAction = 0x20
 )
 
 const (
 	// DefaultNamespace is the default namespace for applying policy
 	DefaultNamespace = "bridge"
+	// IPv6NetworkSuffix is the suffix of the network of the IPv6 address of a
+	// network of the dual-stack PUs
+	IPv6NetworkSuffix = "-ipv6"
+	// DefaultIPv6Namespace is the network of the IPv6 address of the default
+	// namespace of the dual-stack PUs
+	DefaultIPv6Namespace = DefaultNamespace + IPv6NetworkSuffix
 )
 
 // PUAction defines the action types that applies for a specific PU as a whole.
@@ -47,10 +61,15 @@ const (
 
 // IPRule holds IP rules to external services
 type IPRule struct {
+	// Address is an address, a network in CIDR notation or a domain name. The rules
+	// of the domain names apply to the addresses they resolve to.
 	Address  string
 	Port     string
 	Protocol string
 	Action   FlowAction
+	// Service is the name of a service of the registry of Trireme. The rules of a
+	// service apply to its ports, of its protocols matching the protocol of the rule.
+	Service string
 }
 
 // IPRuleList is a list of IP rules
@@ -74,6 +93,65 @@ func (l *IPRuleList) Clone() *IPRuleList {
 	return NewIPRuleList(l.Rules)
 }
 
+// DNSPolicy restricts the DNS queries of a PU
+type DNSPolicy struct {
+	// Servers are the networks of the DNS servers the PU can query. All the servers
+	// can be queried when the list is empty.
+	Servers []string
+	// Domains are the domains the PU can resolve, including their subdomains. All
+	// the domains can be resolved when the list is empty.
+	Domains []string
+}
+
+// NewDNSPolicy returns a new DNS policy
+func NewDNSPolicy(servers []string, domains []string) *DNSPolicy {
+	return &DNSPolicy{
+		Servers: append([]string{}, servers...),
+		Domains: append([]string{}, domains...),
+	}
+}
+
+// Clone returns a copy of the DNS policy
+func (d *DNSPolicy) Clone() *DNSPolicy {
+	return NewDNSPolicy(d.Servers, d.Domains)
+}
+
+// Restricted returns true if the policy restricts the DNS queries
+func (d *DNSPolicy) Restricted() bool {
+	return d != nil && (len(d.Servers) > 0 || len(d.Domains) > 0)
+}
+
+// IssuerRule restricts the certificate authorities whose certificates are accepted
+// from the peers of a PU on some networks or ports
+type IssuerRule struct {
+	// Networks are the networks of the peers of the rule. The rule applies to all the
+	// peers when the list is empty.
+	Networks []string
+	// Ports are the destination ports of the connections of the rule, as single ports
+	// or ranges such as 8000:8100. The rule applies to all the ports when the list is
+	// empty.
+	Ports []string
+	// Issuers are the fingerprints of the certificate authorities accepted by the
+	// rule: the SHA-256 of their certificates in hexadecimal, with or without colons.
+	// The certificate of a peer is accepted when one of the authorities of its
+	// verified chain is listed.
+	Issuers []string
+}
+
+// NewIssuerRule returns a new issuer rule
+func NewIssuerRule(networks, ports, issuers []string) *IssuerRule {
+	return &IssuerRule{
+		Networks: append([]string{}, networks...),
+		Ports:    append([]string{}, ports...),
+		Issuers:  append([]string{}, issuers...),
+	}
+}
+
+// Clone returns a copy of the issuer rule
+func (r *IssuerRule) Clone() *IssuerRule {
+	return NewIssuerRule(r.Networks, r.Ports, r.Issuers)
+}
+
 // An IPMap is a map of Key:Values used for IP Addresses.
 type IPMap struct {
 	IPs map[string]string
@@ -106,6 +184,42 @@ func (i *IPMap) Get(k string) (string, bool) {
 	return v, ok
 }
 
+// AdditionalNetworks returns the names of the networks other than the default
+// namespace in alphabetical order
+func (i *IPMap) AdditionalNetworks() []string {
+
+	networks := []string{}
+	for k := range i.IPs {
+		if k != DefaultNamespace {
+			networks = append(networks, k)
+		}
+	}
+	sort.Strings(networks)
+
+	return networks
+}
+
+// PromoteDefault returns a copy of the map where the address of the first additional
+// network becomes the default address, and the name of that network, when the map
+// has no default address. Otherwise it returns the map itself and an empty name.
+func (i *IPMap) PromoteDefault() (*IPMap, string) {
+
+	if _, ok := i.IPs[DefaultNamespace]; ok {
+		return i, ""
+	}
+
+	networks := i.AdditionalNetworks()
+	if len(networks) == 0 {
+		return i, ""
+	}
+
+	ipm := i.Clone()
+	ipm.IPs[DefaultNamespace] = ipm.IPs[networks[0]]
+	delete(ipm.IPs, networks[0])
+
+	return ipm, networks[0]
+}
+
 // A TagsMap is a map of Key:Values used as tags.
 type TagsMap struct {
 	Tags map[string]string
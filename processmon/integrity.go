@@ -0,0 +1,170 @@
+package processmon
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+)
+
+// BinaryVerifier verifies the remote enforcer binary before it is launched
+type BinaryVerifier interface {
+
+	// VerifyBinary verifies the binary read from the given file. The path is the
+	// location the file was opened from.
+	VerifyBinary(path string, binary io.Reader) error
+}
+
+// SHA256Allowlist accepts the binaries whose sha256 is in the list
+type SHA256Allowlist struct {
+	digests map[string]bool
+}
+
+// NewSHA256Allowlist returns an allowlist of the given hex encoded sha256 digests
+func NewSHA256Allowlist(digests []string) *SHA256Allowlist {
+
+	a := &SHA256Allowlist{digests: map[string]bool{}}
+
+	for _, digest := range digests {
+		a.digests[strings.ToLower(digest)] = true
+	}
+
+	return a
+}
+
+// VerifyBinary is part of the BinaryVerifier interface
+func (a *SHA256Allowlist) VerifyBinary(path string, binary io.Reader) error {
+
+	digest, err := binaryDigest(binary)
+	if err != nil {
+		return err
+	}
+
+	if !a.digests[hex.EncodeToString(digest)] {
+		return fmt.Errorf("Digest of %s is not allowed", path)
+	}
+
+	return nil
+}
+
+// SignatureVerifier accepts the binaries signed with the given key. The ASN.1
+// ECDSA signature of the sha256 of the binary is read from the file next to the
+// binary with the .sig extension.
+type SignatureVerifier struct {
+	key *ecdsa.PublicKey
+}
+
+// NewSignatureVerifier returns a verifier of the signatures made with the private
+// key of the given public key
+func NewSignatureVerifier(key *ecdsa.PublicKey) *SignatureVerifier {
+
+	return &SignatureVerifier{key: key}
+}
+
+// VerifyBinary is part of the BinaryVerifier interface
+func (v *SignatureVerifier) VerifyBinary(path string, binary io.Reader) error {
+
+	data, err := ioutil.ReadFile(path + ".sig")
+	if err != nil {
+		return fmt.Errorf("Cannot read signature of %s: %s", path, err)
+	}
+
+	signature := struct {
+		R, S *big.Int
+	}{}
+
+	if _, err := asn1.Unmarshal(data, &signature); err != nil {
+		return fmt.Errorf("Invalid signature of %s: %s", path, err)
+	}
+
+	digest, err := binaryDigest(binary)
+	if err != nil {
+		return err
+	}
+
+	if !ecdsa.Verify(v.key, digest, signature.R, signature.S) {
+		return fmt.Errorf("Signature of %s does not match", path)
+	}
+
+	return nil
+}
+
+func binaryDigest(binary io.Reader) ([]byte, error) {
+
+	hash := sha256.New()
+
+	if _, err := io.Copy(hash, binary); err != nil {
+		return nil, fmt.Errorf("Cannot read binary: %s", err)
+	}
+
+	return hash.Sum(nil), nil
+}
+
+// openVerifiedBinary opens the binary and verifies it. The caller must launch the
+// process from the returned file, so that the binary cannot be replaced after it
+// was verified.
+func openVerifiedBinary(path string, verifier BinaryVerifier) (*os.File, error) {
+
+	binary, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verifier.VerifyBinary(path, binary); err != nil {
+		binary.Close()
+		return nil, err
+	}
+
+	return binary, nil
+}
+
+// launcherEnv are the variables set by the launcher for the remote enforcer. The
+// variables of the environment with the same names must not reach the process,
+// since the first definition of a variable takes precedence.
+var launcherEnv = []string{
+	"SOCKET_PATH",
+	"STATSCHANNEL_PATH",
+	"SECRET",
+	"STATS_SECRET",
+	"CONTAINER_PID",
+	"CONTAINER_USERNS",
+	"NETNS_FD",
+	"TRIREME_RUNTIME_DIR",
+	"TRIREME_RPC_TRANSPORT",
+}
+
+// launchEnv returns the environment of the launcher without the variables set for
+// the remote enforcer and the variables that change how the binary is loaded
+func launchEnv(environ []string) []string {
+
+	env := []string{}
+
+	for _, variable := range environ {
+		name := strings.SplitN(variable, "=", 2)[0]
+
+		if strings.HasPrefix(name, "LD_") || isLauncherEnv(name) {
+			continue
+		}
+
+		env = append(env, variable)
+	}
+
+	return env
+}
+
+func isLauncherEnv(name string) bool {
+
+	for _, reserved := range launcherEnv {
+		if name == reserved {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,97 @@
+package processmon
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/aporeto-inc/trireme/enforcer/utils/rpcwrapper"
+)
+
+func TestSHA256Allowlist(t *testing.T) {
+	binary := []byte("remote enforcer")
+	digest := sha256.Sum256(binary)
+
+	allowlist := NewSHA256Allowlist([]string{strings.ToUpper(hex.EncodeToString(digest[:]))})
+	if err := allowlist.VerifyBinary("enforcer", bytes.NewReader(binary)); err != nil {
+		t.Errorf("TEST:Allowed binary rejected %v", err)
+	}
+
+	if err := allowlist.VerifyBinary("enforcer", bytes.NewReader([]byte("tampered"))); err == nil {
+		t.Errorf("TEST:Tampered binary accepted")
+	}
+}
+
+func TestSignatureVerifier(t *testing.T) {
+	dir, err := ioutil.TempDir("", "processmon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	binary := []byte("remote enforcer")
+	digest := sha256.Sum256(binary)
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signature, err := asn1.Marshal(struct{ R, S interface{} }{r, s})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := dir + "/enforcer"
+	if err := ioutil.WriteFile(path+".sig", signature, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	verifier := NewSignatureVerifier(&key.PublicKey)
+	if err := verifier.VerifyBinary(path, bytes.NewReader(binary)); err != nil {
+		t.Errorf("TEST:Signed binary rejected %v", err)
+	}
+
+	if err := verifier.VerifyBinary(path, bytes.NewReader([]byte("tampered"))); err == nil {
+		t.Errorf("TEST:Tampered binary accepted")
+	}
+
+	if err := verifier.VerifyBinary(dir+"/unsigned", bytes.NewReader(binary)); err == nil {
+		t.Errorf("TEST:Unsigned binary accepted")
+	}
+}
+
+func TestLaunchEnv(t *testing.T) {
+	env := launchEnv([]string{"PATH=/bin", "SECRET=injected", "LD_PRELOAD=/tmp/hook.so", "SOCKET_PATH=/tmp/x.sock", "TRIREME_RPC_TRANSPORT=netrpc", "HOME=/root"})
+	if strings.Join(env, " ") != "PATH=/bin HOME=/root" {
+		t.Errorf("TEST:Launcher variables passed to the enforcer %v", env)
+	}
+}
+
+func TestLaunchUnverifiedProcess(t *testing.T) {
+	rpchdl := rpcwrapper.NewTestRPCClient()
+	p := newProcessMon()
+	p.SetnsNetPath("/tmp/")
+	p.SetBinaryVerifier(NewSHA256Allowlist([]string{}))
+
+	if err := p.LaunchProcess("unverified", 1, rpchdl, "", "mysecret"); err != ErrBinaryNotVerified {
+		t.Errorf("TEST:Launched a binary that failed verification %v", err)
+	}
+
+	if _, _, err := p.GetProcessStatus("unverified"); err == nil {
+		t.Errorf("TEST:Unverified process registered")
+	}
+	os.Remove("/tmp/unverified")
+}
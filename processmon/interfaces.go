@@ -6,9 +6,16 @@ import "github.com/aporeto-inc/trireme/enforcer/utils/rpcwrapper"
 type ProcessManager interface {
 	GetExitStatus(contextID string) bool
 	SetExitStatus(contextID string, status bool) error
+	GetProcessStatus(contextID string) (int, bool, error)
 	KillProcess(contextID string)
+	AbortProcess(contextID string) error
 	LaunchProcess(contextID string, refPid int, rpchdl rpcwrapper.RPCClient, arg string, statssecret string) error
+	LaunchProcessInNetns(contextID string, netnsPath string, rpchdl rpcwrapper.RPCClient, arg string, statssecret string) error
 	SetnsNetPath(netpath string)
+	SetBinaryVerifier(verifier BinaryVerifier)
+	SetEnforcerBinary(path string) error
+	EnforcerBinary() string
+	GetProcessBinary(contextID string) (string, error)
 	//	ProcessExists(pid int) error
 }
 
@@ -20,6 +20,7 @@ import (
 	"github.com/aporeto-inc/trireme/cache"
 	"github.com/aporeto-inc/trireme/crypto"
 	"github.com/aporeto-inc/trireme/enforcer/utils/rpcwrapper"
+	"github.com/aporeto-inc/trireme/utils/errortypes"
 	"github.com/kardianos/osext"
 )
 
@@ -33,6 +34,10 @@ var processName = ""
 //ProcessMon exported
 type ProcessMon struct {
 	activeProcesses *cache.Cache
+	verifier        BinaryVerifier
+	// binary is the staged enforcer binary, the binary of this process if empty
+	binary string
+	sync.RWMutex
 }
 
 var launcher *ProcessMon
@@ -43,6 +48,7 @@ type processInfo struct {
 	RPCHdl    rpcwrapper.RPCClient
 	process   *os.Process
 	deleted   bool
+	binary    string
 }
 
 type processMonitor struct {
@@ -72,11 +78,14 @@ var ErrSymLinkFailed = errors.New("Failed to create symlink for use by ip netns"
 var ErrFailedtoLaunch = errors.New("Failed to launch enforcer")
 
 // ErrProcessDoesNotExists Exported
-var ErrProcessDoesNotExists = errors.New("Process in that context does not exist")
+var ErrProcessDoesNotExists = errortypes.Errorf(errortypes.ErrPUNotFound, "Process in that context does not exist")
 
 //ErrBinaryNotFound Exported
 var ErrBinaryNotFound = errors.New("Enforcer Binary not found")
 
+//ErrBinaryNotVerified Exported
+var ErrBinaryNotVerified = errors.New("Enforcer Binary failed verification")
+
 func init() {
 
 	netnspath = "/var/run/netns/"
@@ -102,17 +111,24 @@ func collectChildExitStatus() {
 	}
 }
 
-// processIOReader will read from a reader and print it on the calling process
+// processIOReader will read from a reader and log it in the calling process
 func processIOReader(fd io.Reader, contextID string, exited chan int) {
 	reader := bufio.NewReader(fd)
 	for {
 		str, err := reader.ReadString('\n')
 		if err != nil {
 			exited <- 1
-			fmt.Println("Error: reader failed. Exiting thread !")
+			log.WithFields(log.Fields{
+				"package":   "processmon",
+				"contextID": contextID,
+				"error":     err.Error(),
+			}).Debug("Enforcer output closed")
 			return
 		}
-		fmt.Print("[" + contextID + "]:" + str)
+		log.WithFields(log.Fields{
+			"package":   "processmon",
+			"contextID": contextID,
+		}).Info(strings.TrimSuffix(str, "\n"))
 	}
 }
 
@@ -123,6 +139,64 @@ func (p *ProcessMon) SetnsNetPath(netpath string) {
 	netnspath = netpath
 }
 
+//SetBinaryVerifier sets the verifier of the enforcer binary. The binary is not verified
+//if the verifier is nil.
+func (p *ProcessMon) SetBinaryVerifier(verifier BinaryVerifier) {
+
+	p.Lock()
+	p.verifier = verifier
+	p.Unlock()
+}
+
+//SetEnforcerBinary stages the binary of the enforcers launched afterwards. The running
+//enforcers keep their binary until they are launched again. An empty path stages the
+//binary of this process.
+func (p *ProcessMon) SetEnforcerBinary(path string) error {
+
+	if path != "" {
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("Cannot stage enforcer binary %s: %s", path, err)
+		}
+
+		if !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+			return fmt.Errorf("Cannot stage enforcer binary %s: not an executable file", path)
+		}
+	}
+
+	p.Lock()
+	p.binary = path
+	p.Unlock()
+
+	return nil
+}
+
+//EnforcerBinary returns the path of the staged enforcer binary
+func (p *ProcessMon) EnforcerBinary() string {
+
+	p.RLock()
+	defer p.RUnlock()
+
+	if p.binary != "" {
+		return p.binary
+	}
+
+	path, _ := osext.Executable()
+
+	return path
+}
+
+//GetProcessBinary returns the path of the binary the process of a context was launched from
+func (p *ProcessMon) GetProcessBinary(contextID string) (string, error) {
+
+	s, err := p.activeProcesses.Get(contextID)
+	if err != nil {
+		return "", ErrProcessDoesNotExists
+	}
+
+	return s.(*processInfo).binary, nil
+}
+
 //GetExitStatus reports if the process is marked for deletion or deleted
 func (p *ProcessMon) GetExitStatus(contextID string) bool {
 
@@ -152,6 +226,22 @@ func (p *ProcessMon) SetExitStatus(contextID string, status bool) error {
 	return nil
 }
 
+//GetProcessStatus returns the PID of the process launched for a context and whether it is still running
+func (p *ProcessMon) GetProcessStatus(contextID string) (int, bool, error) {
+
+	s, err := p.activeProcesses.Get(contextID)
+	if err != nil {
+		return 0, false, ErrProcessDoesNotExists
+	}
+
+	info := s.(*processInfo)
+	if info.deleted {
+		return info.process.Pid, false, nil
+	}
+
+	return info.process.Pid, info.process.Signal(syscall.Signal(0)) == nil, nil
+}
+
 //KillProcess sends a rpc to the process to exit failing which it will kill the process
 func (p *ProcessMon) KillProcess(contextID string) {
 
@@ -169,21 +259,91 @@ func (p *ProcessMon) KillProcess(contextID string) {
 	if err != nil {
 		s.(*processInfo).process.Kill()
 	}
-	s.(*processInfo).RPCHdl.DestroyRPCClient(contextID)
+	p.forget(contextID, s.(*processInfo))
+}
+
+//AbortProcess kills the process of a context without asking it to exit, for the
+//processes that do not respond. The context can be launched again afterwards.
+func (p *ProcessMon) AbortProcess(contextID string) error {
+
+	s, err := p.activeProcesses.Get(contextID)
+	if err != nil {
+		return ErrProcessDoesNotExists
+	}
+
+	log.WithFields(log.Fields{"package": "ProcessMon",
+		"contextID": contextID,
+		"pid":       s.(*processInfo).process.Pid,
+	}).Warn("Aborting the enforcer")
+
+	s.(*processInfo).process.Kill()
+	p.forget(contextID, s.(*processInfo))
+
+	return nil
+}
+
+//forget releases the resources of the process of a context
+func (p *ProcessMon) forget(contextID string, info *processInfo) {
+
+	info.RPCHdl.DestroyRPCClient(contextID)
 	os.Remove(netnspath + contextID)
 	p.activeProcesses.Remove(contextID)
-
 }
 
 //LaunchProcess prepares the environment for the new process and launches the process
 func (p *ProcessMon) LaunchProcess(contextID string, refPid int, rpchdl rpcwrapper.RPCClient, arg string, statsServerSecret string) error {
-	secretLength := 32
-	var cmdName string
 
 	_, err := p.activeProcesses.Get(contextID)
 	if err == nil {
 		return nil
 	}
+
+	p.linkNetns(contextID, "/proc/"+strconv.Itoa(refPid)+"/ns/net")
+
+	nsEnv := []string{"CONTAINER_PID=" + strconv.Itoa(refPid)}
+
+	// The network namespace of a rootless container can only be entered through its
+	// user namespace. The enforcer keeps the host credentials, so the files it
+	// creates are owned by the host root whatever the uid mapping.
+	if userNamespaced(refPid) {
+		uid, mapped := mappedID(procPath+"/"+strconv.Itoa(refPid)+"/uid_map", os.Getuid())
+		log.WithFields(log.Fields{"package": "ProcessMon",
+			"contextID": contextID,
+			"uid":       uid,
+			"mapped":    mapped,
+		}).Info("Launching the enforcer in the user namespace of the container")
+
+		nsEnv = append(nsEnv, "CONTAINER_USERNS=1")
+	}
+
+	return p.launch(contextID, rpchdl, arg, statsServerSecret, nsEnv, nil)
+}
+
+//LaunchProcessInNetns launches the process in a network namespace identified by its path,
+//like the namespaces created by ip netns. The namespace is opened here and handed over
+//to the process as a file descriptor, since there is no process to reference it by PID.
+func (p *ProcessMon) LaunchProcessInNetns(contextID string, netnsPath string, rpchdl rpcwrapper.RPCClient, arg string, statsServerSecret string) error {
+
+	_, err := p.activeProcesses.Get(contextID)
+	if err == nil {
+		return nil
+	}
+
+	netns, err := os.Open(netnsPath)
+	if err != nil {
+		return fmt.Errorf("Cannot open network namespace %s: %s", netnsPath, err)
+	}
+	defer netns.Close()
+
+	p.linkNetns(contextID, netnsPath)
+
+	// The first extra file is fd 3 in the child
+	return p.launch(contextID, rpchdl, arg, statsServerSecret, []string{"NETNS_FD=3"}, []*os.File{netns})
+}
+
+//linkNetns creates the link used by ip netns to the network namespace of a context
+func (p *ProcessMon) linkNetns(contextID string, target string) {
+
 	_, staterr := os.Stat(netnspath)
 	if staterr != nil {
 		mkerr := os.MkdirAll(netnspath, os.ModeDir)
@@ -196,19 +356,47 @@ func (p *ProcessMon) LaunchProcess(contextID string, refPid int, rpchdl rpcwrapp
 	}
 
 	if _, lerr := os.Stat(netnspath + contextID); lerr != nil {
-		linkErr := os.Symlink("/proc/"+strconv.Itoa(refPid)+"/ns/net",
-			netnspath+contextID)
+		linkErr := os.Symlink(target, netnspath+contextID)
 		if linkErr != nil {
 			log.WithFields(log.Fields{"package": "ProcessMon",
 				"error": linkErr,
 			}).Error(ErrSymLinkFailed)
 		}
 	}
-	namedPipe := "SOCKET_PATH=/var/run/" + contextID + ".sock"
+}
 
-	cmdName, _ = osext.Executable()
+//launch starts the process with the namespace environment and files
+func (p *ProcessMon) launch(contextID string, rpchdl rpcwrapper.RPCClient, arg string, statsServerSecret string, nsEnv []string, nsFiles []*os.File) error {
+	secretLength := 32
+	var cmdName string
+
+	socketPath := rpcwrapper.EnforcerSocketPath(contextID)
+	namedPipe := "SOCKET_PATH=" + socketPath
+
+	cmdName = p.EnforcerBinary()
+	binaryPath := cmdName
 	cmdArgs := []string{arg}
 
+	p.RLock()
+	verifier := p.verifier
+	p.RUnlock()
+
+	if verifier != nil {
+		binary, err := openVerifiedBinary(cmdName, verifier)
+		if err != nil {
+			log.WithFields(log.Fields{"package": "ProcessMon",
+				"error": err,
+				"PATH":  cmdName,
+			}).Error("Enforcer binary verification failed")
+			return ErrBinaryNotVerified
+		}
+		defer binary.Close()
+
+		// Execute the verified file through its descriptor in the child
+		nsFiles = append(nsFiles, binary)
+		cmdName = "/proc/self/fd/" + strconv.Itoa(2+len(nsFiles))
+	}
+
 	if _, ok := GlobalCommandArgs["--log-level"]; ok {
 		cmdArgs = append(cmdArgs, "--log-level")
 		cmdArgs = append(cmdArgs, GlobalCommandArgs["--log-level"].(string))
@@ -224,7 +412,9 @@ func (p *ProcessMon) LaunchProcess(contextID string, refPid int, rpchdl rpcwrapp
 	stdout, err := cmd.StdoutPipe()
 	stderr, err := cmd.StderrPipe()
 
-	statschannelenv := "STATSCHANNEL_PATH=" + rpcwrapper.StatsChannel
+	statschannelenv := "STATSCHANNEL_PATH=" + rpcwrapper.StatsChannelPath()
+	runtimeenv := rpcwrapper.EnvRuntimeDir + "=" + rpcwrapper.RuntimeDir()
+	transportenv := rpcwrapper.EnvTransport + "=" + rpcwrapper.TransportOf(rpchdl).String()
 
 	randomkeystring, err := crypto.GenerateRandomString(secretLength)
 	if err != nil {
@@ -238,7 +428,9 @@ func (p *ProcessMon) LaunchProcess(contextID string, refPid int, rpchdl rpcwrapp
 	rpcClientSecret := "SECRET=" + randomkeystring
 	envStatsSecret := "STATS_SECRET=" + statsServerSecret
 
-	cmd.Env = append(os.Environ(), []string{namedPipe, statschannelenv, rpcClientSecret, envStatsSecret, "CONTAINER_PID=" + strconv.Itoa(refPid)}...)
+	cmd.Env = append(launchEnv(os.Environ()), []string{namedPipe, statschannelenv, runtimeenv, transportenv, rpcClientSecret, envStatsSecret}...)
+	cmd.Env = append(cmd.Env, nsEnv...)
+	cmd.ExtraFiles = nsFiles
 
 	err = cmd.Start()
 	if err != nil {
@@ -268,11 +460,12 @@ func (p *ProcessMon) LaunchProcess(contextID string, refPid int, rpchdl rpcwrapp
 	go processIOReader(stdout, contextID, exited)
 	go processIOReader(stderr, contextID, exited)
 
-	rpchdl.NewRPCClient(contextID, "/var/run/"+contextID+".sock", randomkeystring)
+	rpchdl.NewRPCClient(contextID, socketPath, randomkeystring)
 	p.activeProcesses.Add(contextID, &processInfo{contextID: contextID,
 		process: cmd.Process,
 		RPCHdl:  rpchdl,
-		deleted: false})
+		deleted: false,
+		binary:  binaryPath})
 
 	return nil
 }
@@ -3,6 +3,7 @@ package processmon
 import (
 	"errors"
 	"os"
+	"os/exec"
 	"strconv"
 	"testing"
 
@@ -64,6 +65,36 @@ func TestLaunchProcess(t *testing.T) {
 	}
 }
 
+func TestLaunchProcessInNetns(t *testing.T) {
+	rpchdl := rpcwrapper.NewTestRPCClient()
+	p := newProcessMon()
+	contextID := "netns12345"
+	p.SetnsNetPath("/tmp/")
+	setprocessname("cat")
+	//A missing namespace should fail
+	err := p.LaunchProcessInNetns(contextID, "/var/run/netns/doesnotexist", rpchdl, "", "mysecret")
+	if err == nil {
+		t.Errorf("TEST:Launch Process succeeds with a missing namespace")
+	}
+	//The namespace of the test is guaranteed to be there
+	err = p.LaunchProcessInNetns(contextID, "/proc/self/ns/net", rpchdl, "", "mysecret")
+	if err != nil {
+		t.Errorf("TEST:Launch Process Fails to launch a process in a namespace %v", err)
+		t.SkipNow()
+	}
+	if target, lerr := os.Readlink("/tmp/" + contextID); lerr != nil || target != "/proc/self/ns/net" {
+		t.Errorf("TEST:Netns link not created %v", lerr)
+	}
+	//Cleanup
+	rpchdl.MockRemoteCall(t, func(passed_contextID string, methodName string, req *rpcwrapper.Request, resp *rpcwrapper.Response) error {
+		return errors.New("Null Error")
+	})
+	p.KillProcess(contextID)
+	if _, err = os.Lstat("/tmp/" + contextID); err == nil {
+		t.Errorf("TEST:Netns resource leaked ")
+	}
+}
+
 func TestGetExitStatus(t *testing.T) {
 	contextID := "12345"
 	refPid := 1
@@ -162,3 +193,51 @@ func TestKillProcess(t *testing.T) {
 	}
 
 }
+
+func TestSetEnforcerBinary(t *testing.T) {
+	rpchdl := rpcwrapper.NewTestRPCClient()
+	p := newProcessMon()
+	p.SetnsNetPath("/tmp/")
+
+	if err := p.SetEnforcerBinary("/nonexistent/enforcer"); err == nil {
+		t.Errorf("TEST:Staged a binary that does not exist")
+	}
+
+	if err := p.SetEnforcerBinary(os.TempDir()); err == nil {
+		t.Errorf("TEST:Staged a directory")
+	}
+
+	cat, err := exec.LookPath("cat")
+	if err != nil {
+		t.Skip("cat is not installed")
+	}
+
+	if err = p.SetEnforcerBinary(cat); err != nil {
+		t.Fatalf("TEST:Failed to stage the binary %v", err)
+	}
+
+	if p.EnforcerBinary() != cat {
+		t.Errorf("TEST:Staged binary is %s instead of %s", p.EnforcerBinary(), cat)
+	}
+
+	if err = p.LaunchProcess("staged", 1, rpchdl, "", "mysecret"); err != nil {
+		t.Fatalf("TEST:Failed to launch the staged binary %v", err)
+	}
+
+	if binary, err := p.GetProcessBinary("staged"); err != nil || binary != cat {
+		t.Errorf("TEST:Process launched from %s instead of %s %v", binary, cat, err)
+	}
+
+	rpchdl.MockRemoteCall(t, func(passed_contextID string, methodName string, req *rpcwrapper.Request, resp *rpcwrapper.Response) error {
+		return errors.New("Null Error")
+	})
+	p.KillProcess("staged")
+
+	if _, err = p.GetProcessBinary("staged"); err == nil {
+		t.Errorf("TEST:Binary reported for a killed process")
+	}
+
+	if err = p.SetEnforcerBinary(""); err != nil || p.EnforcerBinary() == cat {
+		t.Errorf("TEST:Failed to restore the binary of the process %v", err)
+	}
+}
@@ -8,20 +8,34 @@ import (
 )
 
 type mockedMethods struct {
-	GetExitStatusMock func(string) bool
-	KillProcessMock   func(string)
-	LaunchProcessMock func(string, int, rpcwrapper.RPCClient, string, string) error
-	SetExitStatusMock func(string, bool) error
-	SetnsNetPathMock  func(string)
+	GetExitStatusMock        func(string) bool
+	GetProcessStatusMock     func(string) (int, bool, error)
+	KillProcessMock          func(string)
+	AbortProcessMock         func(string) error
+	LaunchProcessMock        func(string, int, rpcwrapper.RPCClient, string, string) error
+	LaunchProcessInNetnsMock func(string, string, rpcwrapper.RPCClient, string, string) error
+	SetExitStatusMock        func(string, bool) error
+	SetnsNetPathMock         func(string)
+	SetBinaryVerifierMock    func(BinaryVerifier)
+	SetEnforcerBinaryMock    func(string) error
+	EnforcerBinaryMock       func() string
+	GetProcessBinaryMock     func(string) (string, error)
 }
 
 type TestProcessManager interface {
 	ProcessManager
 	MockGetExitStatus(t *testing.T, impl func(string) bool)
+	MockGetProcessStatus(t *testing.T, impl func(string) (int, bool, error))
 	MockKillProcess(t *testing.T, impl func(string))
+	MockAbortProcess(t *testing.T, impl func(string) error)
 	MockLaunchProcess(t *testing.T, impl func(string, int, rpcwrapper.RPCClient, string, string) error)
+	MockLaunchProcessInNetns(t *testing.T, impl func(string, string, rpcwrapper.RPCClient, string, string) error)
 	MockSetExitStatus(t *testing.T, impl func(string, bool) error)
 	MockSetnsNetPath(t *testing.T, impl func(string))
+	MockSetBinaryVerifier(t *testing.T, impl func(BinaryVerifier))
+	MockSetEnforcerBinary(t *testing.T, impl func(string) error)
+	MockEnforcerBinary(t *testing.T, impl func() string)
+	MockGetProcessBinary(t *testing.T, impl func(string) (string, error))
 }
 
 type testProcessMon struct {
@@ -58,15 +72,36 @@ func (m *testProcessMon) MockSetnsNetPath(t *testing.T, impl func(string)) {
 func (m *testProcessMon) MockGetExitStatus(t *testing.T, impl func(string) bool) {
 	m.currentMocks(t).GetExitStatusMock = impl
 }
+func (m *testProcessMon) MockGetProcessStatus(t *testing.T, impl func(string) (int, bool, error)) {
+	m.currentMocks(t).GetProcessStatusMock = impl
+}
 func (m *testProcessMon) MockKillProcess(t *testing.T, impl func(string)) {
 	m.currentMocks(t).KillProcessMock = impl
 }
+func (m *testProcessMon) MockAbortProcess(t *testing.T, impl func(string) error) {
+	m.currentMocks(t).AbortProcessMock = impl
+}
 func (m *testProcessMon) MockLaunchProcess(t *testing.T, impl func(string, int, rpcwrapper.RPCClient, string, string) error) {
 	m.currentMocks(t).LaunchProcessMock = impl
 }
+func (m *testProcessMon) MockLaunchProcessInNetns(t *testing.T, impl func(string, string, rpcwrapper.RPCClient, string, string) error) {
+	m.currentMocks(t).LaunchProcessInNetnsMock = impl
+}
 func (m *testProcessMon) MockSetExitStatus(t *testing.T, impl func(string, bool) error) {
 	m.currentMocks(t).SetExitStatusMock = impl
 }
+func (m *testProcessMon) MockSetBinaryVerifier(t *testing.T, impl func(BinaryVerifier)) {
+	m.currentMocks(t).SetBinaryVerifierMock = impl
+}
+func (m *testProcessMon) MockSetEnforcerBinary(t *testing.T, impl func(string) error) {
+	m.currentMocks(t).SetEnforcerBinaryMock = impl
+}
+func (m *testProcessMon) MockEnforcerBinary(t *testing.T, impl func() string) {
+	m.currentMocks(t).EnforcerBinaryMock = impl
+}
+func (m *testProcessMon) MockGetProcessBinary(t *testing.T, impl func(string) (string, error)) {
+	m.currentMocks(t).GetProcessBinaryMock = impl
+}
 
 func (m *testProcessMon) SetnsNetPath(netpath string) {
 	if mock := m.currentMocks(m.currentTest); mock != nil && mock.SetnsNetPathMock != nil {
@@ -75,6 +110,31 @@ func (m *testProcessMon) SetnsNetPath(netpath string) {
 	}
 	return
 }
+func (m *testProcessMon) SetBinaryVerifier(verifier BinaryVerifier) {
+	if mock := m.currentMocks(m.currentTest); mock != nil && mock.SetBinaryVerifierMock != nil {
+		mock.SetBinaryVerifierMock(verifier)
+		return
+	}
+	return
+}
+func (m *testProcessMon) SetEnforcerBinary(path string) error {
+	if mock := m.currentMocks(m.currentTest); mock != nil && mock.SetEnforcerBinaryMock != nil {
+		return mock.SetEnforcerBinaryMock(path)
+	}
+	return nil
+}
+func (m *testProcessMon) EnforcerBinary() string {
+	if mock := m.currentMocks(m.currentTest); mock != nil && mock.EnforcerBinaryMock != nil {
+		return mock.EnforcerBinaryMock()
+	}
+	return ""
+}
+func (m *testProcessMon) GetProcessBinary(contextID string) (string, error) {
+	if mock := m.currentMocks(m.currentTest); mock != nil && mock.GetProcessBinaryMock != nil {
+		return mock.GetProcessBinaryMock(contextID)
+	}
+	return "", nil
+}
 func (m *testProcessMon) GetExitStatus(contextID string) bool {
 	if mock := m.currentMocks(m.currentTest); mock != nil && mock.GetExitStatusMock != nil {
 		return mock.GetExitStatusMock(contextID)
@@ -82,6 +142,13 @@ func (m *testProcessMon) GetExitStatus(contextID string) bool {
 	}
 	return true
 }
+func (m *testProcessMon) GetProcessStatus(contextID string) (int, bool, error) {
+	if mock := m.currentMocks(m.currentTest); mock != nil && mock.GetProcessStatusMock != nil {
+		return mock.GetProcessStatusMock(contextID)
+
+	}
+	return 0, false, nil
+}
 func (m *testProcessMon) SetExitStatus(contextID string, status bool) error {
 	if mock := m.currentMocks(m.currentTest); mock != nil && mock.SetExitStatusMock != nil {
 		return mock.SetExitStatusMock(contextID, status)
@@ -95,6 +162,12 @@ func (m *testProcessMon) KillProcess(contextID string) {
 		return
 	}
 }
+func (m *testProcessMon) AbortProcess(contextID string) error {
+	if mock := m.currentMocks(m.currentTest); mock != nil && mock.AbortProcessMock != nil {
+		return mock.AbortProcessMock(contextID)
+	}
+	return nil
+}
 func (m *testProcessMon) LaunchProcess(contextID string, refPid int, rpchdl rpcwrapper.RPCClient, processname string, statssecret string) error {
 	if mock := m.currentMocks(m.currentTest); mock != nil && mock.LaunchProcessMock != nil {
 		return mock.LaunchProcessMock(contextID, refPid, rpchdl, processname, statssecret)
@@ -102,3 +175,10 @@ func (m *testProcessMon) LaunchProcess(contextID string, refPid int, rpchdl rpcw
 	}
 	return nil
 }
+func (m *testProcessMon) LaunchProcessInNetns(contextID string, netnsPath string, rpchdl rpcwrapper.RPCClient, processname string, statssecret string) error {
+	if mock := m.currentMocks(m.currentTest); mock != nil && mock.LaunchProcessInNetnsMock != nil {
+		return mock.LaunchProcessInNetnsMock(contextID, netnsPath, rpchdl, processname, statssecret)
+
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package processmon
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// procPath is the mount point of procfs
+var procPath = "/proc"
+
+// userNamespaced returns true if the process runs in another user namespace than
+// the launcher, like the processes of rootless podman or docker containers
+func userNamespaced(pid int) bool {
+
+	own, err := os.Readlink(procPath + "/self/ns/user")
+	if err != nil {
+		return false
+	}
+
+	target, err := os.Readlink(procPath + "/" + strconv.Itoa(pid) + "/ns/user")
+	if err != nil {
+		return false
+	}
+
+	return own != target
+}
+
+// mappedID returns the id of a host uid or gid in the user namespace of a process,
+// given the path of its uid_map or gid_map. The second value is false if the id is
+// not mapped, the process then sees it as the overflow id.
+func mappedID(mapFile string, hostID int) (int, bool) {
+
+	file, err := os.Open(mapFile)
+	if err != nil {
+		return 0, false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+
+		inside, err1 := strconv.Atoi(fields[0])
+		outside, err2 := strconv.Atoi(fields[1])
+		count, err3 := strconv.Atoi(fields[2])
+		if err1 != nil || err2 != nil || err3 != nil {
+			continue
+		}
+
+		if hostID >= outside && hostID < outside+count {
+			return inside + hostID - outside, true
+		}
+	}
+
+	return 0, false
+}
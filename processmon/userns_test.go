@@ -0,0 +1,57 @@
+package processmon
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUserNamespaced(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "proc")
+	if err != nil {
+		t.Fatalf("Cannot create directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for pid, userns := range map[string]string{"self": "user:[1]", "10": "user:[1]", "20": "user:[2]"} {
+		os.MkdirAll(filepath.Join(dir, pid, "ns"), 0755)
+		os.Symlink(userns, filepath.Join(dir, pid, "ns", "user"))
+	}
+
+	defer func(path string) { procPath = path }(procPath)
+	procPath = dir
+
+	if userNamespaced(10) {
+		t.Errorf("A process of the user namespace of the launcher was detected as user-namespaced")
+	}
+	if !userNamespaced(20) {
+		t.Errorf("A process of another user namespace was not detected")
+	}
+	if userNamespaced(30) {
+		t.Errorf("An unknown process was detected as user-namespaced")
+	}
+}
+
+func TestMappedID(t *testing.T) {
+
+	file, err := ioutil.TempFile("", "uid_map")
+	if err != nil {
+		t.Fatalf("Cannot create file: %s", err)
+	}
+	defer os.Remove(file.Name())
+
+	file.WriteString("         0       1000          1\n         1     100000      65536\n")
+	file.Close()
+
+	if id, ok := mappedID(file.Name(), 1000); !ok || id != 0 {
+		t.Errorf("Host uid 1000 was expected to be root in the namespace, got %d %v", id, ok)
+	}
+	if id, ok := mappedID(file.Name(), 100009); !ok || id != 10 {
+		t.Errorf("Host uid 100009 was expected to be 10 in the namespace, got %d %v", id, ok)
+	}
+	if _, ok := mappedID(file.Name(), 0); ok {
+		t.Errorf("Host root was not expected to be mapped")
+	}
+}
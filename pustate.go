@@ -0,0 +1,298 @@
+package trireme
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/enforcer"
+	"github.com/aporeto-inc/trireme/monitor"
+	"github.com/aporeto-inc/trireme/policy"
+	"github.com/aporeto-inc/trireme/supervisor"
+	"github.com/aporeto-inc/trireme/utils/errortypes"
+)
+
+// EnforcementMode describes how the policy of a PU is enforced
+type EnforcementMode string
+
+const (
+	// EnforcementPending is the mode of a PU whose policy was not applied yet
+	EnforcementPending EnforcementMode = "pending"
+
+	// EnforcementEnforced is the mode of a PU policed by the enforcer and the supervisor
+	EnforcementEnforced EnforcementMode = "enforced"
+
+	// EnforcementIgnored is the mode of a PU with an AllowAll policy that is not policed
+	EnforcementIgnored EnforcementMode = "ignored"
+
+	// EnforcementObserved is the mode of a PU in observe mode, whose policy is
+	// resolved but not policed
+	EnforcementObserved EnforcementMode = "observed"
+
+	// EnforcementFailed is the mode of a PU whose last policy could not be applied
+	EnforcementFailed EnforcementMode = "failed"
+
+	// EnforcementQuarantined is the mode of a PU restricted to a quarantine policy
+	EnforcementQuarantined EnforcementMode = "quarantined"
+
+	// EnforcementBroken is the mode of a PU whose policy failed more times than the
+	// retry policy allows. It is no longer retried until a new policy is pushed.
+	EnforcementBroken EnforcementMode = "broken"
+)
+
+// PUState is the state of a PU as seen by Trireme
+type PUState struct {
+	// ContextID is the identifier of the PU
+	ContextID string
+
+	// PUType is the type of the PU
+	PUType constants.PUType
+
+	// Tags are the runtime tags of the PU
+	Tags *policy.TagsMap
+
+	// Revision is the number of policies applied to the PU since it was created
+	Revision int
+
+	// Mode is how the policy of the PU is enforced
+	Mode EnforcementMode
+
+	// RemotePID is the PID of the remote enforcer of the PU. It is zero when the
+	// datapath of the PU runs in the Trireme process.
+	RemotePID int
+
+	// Healthy is false if the last policy failed to apply or the remote enforcer
+	// of the PU is not running
+	Healthy bool
+
+	// LastError is the error of the last policy that failed to apply to the PU. The
+	// mode of the PU is unchanged if it was returned to its previous policy.
+	LastError string
+
+	// Failures is the number of consecutive failures of the policy of the PU
+	Failures int
+}
+
+// enforcementState is the enforcement state recorded for a PU
+type enforcementState struct {
+	revision  int
+	mode      EnforcementMode
+	lastError string
+	failures  int
+	// summary summarizes the last policy applied to the PU
+	summary *monitor.PolicySummary
+}
+
+// stateTracker records the enforcement state of the PUs. The requests are handled
+// by a single routine but the state can be listed at any time.
+type stateTracker struct {
+	states map[string]*enforcementState
+	sync.RWMutex
+}
+
+func newStateTracker() *stateTracker {
+
+	return &stateTracker{
+		states: map[string]*enforcementState{},
+	}
+}
+
+// add records a PU whose policy was not applied yet
+func (s *stateTracker) add(contextID string) {
+
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.states[contextID]; !ok {
+		s.states[contextID] = &enforcementState{mode: EnforcementPending}
+	}
+}
+
+// applied records the outcome of a policy applied to a PU
+func (s *stateTracker) applied(contextID string, mode EnforcementMode) {
+
+	s.Lock()
+	defer s.Unlock()
+
+	state, ok := s.states[contextID]
+	if !ok {
+		state = &enforcementState{}
+		s.states[contextID] = state
+	}
+
+	if mode != EnforcementFailed {
+		state.revision++
+		state.lastError = ""
+		state.failures = 0
+	}
+	state.mode = mode
+}
+
+// summarized records the summary of the policy applied to a PU
+func (s *stateTracker) summarized(contextID string, p *policy.PUPolicy) {
+
+	s.Lock()
+	defer s.Unlock()
+
+	state, ok := s.states[contextID]
+	if !ok {
+		return
+	}
+
+	state.summary = summarize(p)
+}
+
+// retried records the consecutive failures of a PU and whether its circuit is open
+func (s *stateTracker) retried(contextID string, failures int, broken bool) {
+
+	s.Lock()
+	defer s.Unlock()
+
+	state, ok := s.states[contextID]
+	if !ok {
+		return
+	}
+
+	state.failures = failures
+	if broken {
+		state.mode = EnforcementBroken
+	}
+}
+
+// failed records a policy that could not be applied to a PU. A PU returned to the
+// policy it had keeps its mode, any other PU is recorded as failed.
+func (s *stateTracker) failed(contextID string, err error) {
+
+	s.Lock()
+	defer s.Unlock()
+
+	state, ok := s.states[contextID]
+	if !ok {
+		state = &enforcementState{mode: EnforcementPending}
+		s.states[contextID] = state
+	}
+
+	state.lastError = err.Error()
+
+	if terr, ok := err.(*supervisor.TransactionError); ok && terr.RolledBack && state.mode != EnforcementPending {
+		return
+	}
+	state.mode = EnforcementFailed
+}
+
+// remove forgets the state of a PU
+func (s *stateTracker) remove(contextID string) {
+
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.states, contextID)
+}
+
+// contextIDs returns the sorted list of the PUs tracked
+func (s *stateTracker) contextIDs() []string {
+
+	s.RLock()
+	defer s.RUnlock()
+
+	contextIDs := make([]string, 0, len(s.states))
+	for contextID := range s.states {
+		contextIDs = append(contextIDs, contextID)
+	}
+	sort.Strings(contextIDs)
+
+	return contextIDs
+}
+
+// lookup returns a copy of the state of a PU, if it is tracked
+func (s *stateTracker) lookup(contextID string) (enforcementState, bool) {
+
+	s.RLock()
+	defer s.RUnlock()
+
+	if state, ok := s.states[contextID]; ok {
+		return *state, true
+	}
+
+	return enforcementState{}, false
+}
+
+// get returns a copy of the state of a PU
+func (s *stateTracker) get(contextID string) enforcementState {
+
+	s.RLock()
+	defer s.RUnlock()
+
+	if state, ok := s.states[contextID]; ok {
+		return *state
+	}
+
+	return enforcementState{mode: EnforcementPending}
+}
+
+// summarize returns the summary of a policy, without its mode
+func summarize(p *policy.PUPolicy) *monitor.PolicySummary {
+
+	summary := &monitor.PolicySummary{
+		Revision:      revisionOf(p),
+		DefaultAction: "reject",
+		Rules: len(p.ApplicationACLs().Rules) + len(p.NetworkACLs().Rules) +
+			len(p.ReceiverRules().TagSelectors) + len(p.TransmitterRules().TagSelectors),
+	}
+
+	if p.TriremeAction == policy.AllowAll {
+		summary.DefaultAction = "accept"
+	}
+
+	return summary
+}
+
+// PolicySummary implements the monitor.PolicySummarizer interface. It returns the
+// summary of the last policy applied to the PU, with its current mode.
+func (t *trireme) PolicySummary(contextID string) (*monitor.PolicySummary, error) {
+
+	state, ok := t.states.lookup(contextID)
+	if !ok || state.summary == nil {
+		return nil, errortypes.Errorf(errortypes.ErrPUNotFound, "No policy applied to context %s", contextID)
+	}
+
+	summary := *state.summary
+	summary.Mode = string(state.mode)
+
+	return &summary, nil
+}
+
+// ListPUs returns the state of all the PUs known by Trireme sorted by contextID
+func (t *trireme) ListPUs() []*PUState {
+
+	list := []*PUState{}
+	for _, contextID := range t.states.contextIDs() {
+		runtime, err := t.PURuntime(contextID)
+		if err != nil {
+			continue
+		}
+
+		state := t.states.get(contextID)
+
+		puState := &PUState{
+			ContextID: contextID,
+			PUType:    runtime.PUType(),
+			Tags:      runtime.Tags(),
+			Revision:  state.revision,
+			Mode:      state.mode,
+			Healthy:   state.mode != EnforcementFailed && state.mode != EnforcementBroken && state.lastError == "",
+			LastError: state.lastError,
+			Failures:  state.failures,
+		}
+
+		if reporter, ok := t.enforcers[runtime.PUType()].(enforcer.RemoteEnforcerReporter); ok && state.mode == EnforcementEnforced {
+			pid, running, err := reporter.RemoteEnforcerStatus(contextID)
+			puState.RemotePID = pid
+			puState.Healthy = err == nil && running
+		}
+
+		list = append(list, puState)
+	}
+
+	return list
+}
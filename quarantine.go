@@ -0,0 +1,180 @@
+package trireme
+
+import (
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/policy"
+	"github.com/aporeto-inc/trireme/utils/errortypes"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// QuarantineMode is the minimal policy applied to a quarantined PU
+type QuarantineMode struct {
+	// Networks are the only networks the PU can exchange traffic with, like the
+	// network of a forensics collector. All the traffic is dropped when it is empty.
+	Networks []string
+}
+
+// quarantine is the state of a quarantined PU
+type quarantine struct {
+	mode *QuarantineMode
+	// pending is the last policy received during the quarantine, applied when it is
+	// lifted
+	pending *policy.PUPolicy
+}
+
+// Quarantine restricts a PU to the minimal policy of the mode until it is called
+// with a nil mode. The policy updates received in the meantime are applied when
+// the quarantine is lifted.
+func (t *trireme) Quarantine(contextID string, mode *QuarantineMode) <-chan error {
+
+	c := make(chan error, 1)
+
+	req := &triremeRequest{
+		contextID:      contextID,
+		reqType:        quarantineUpdate,
+		quarantineMode: mode,
+		returnChan:     c,
+	}
+
+	t.requests <- req
+
+	return c
+}
+
+// quarantinePolicy returns the policy of a quarantined PU. It has no identity rule
+// and no trireme network, so that only the networks of the mode are reachable.
+func quarantinePolicy(contextID string, runtime *policy.PURuntime, mode *QuarantineMode) *policy.PUPolicy {
+
+	rules := []policy.IPRule{}
+	for _, network := range mode.Networks {
+		rules = append(rules, policy.IPRule{
+			Address:  network,
+			Protocol: "all",
+			Action:   policy.Accept,
+		})
+	}
+
+	p := policy.NewPUPolicy(
+		contextID,
+		policy.Police,
+		policy.NewIPRuleList(rules),
+		policy.NewIPRuleList(rules),
+		nil,
+		nil,
+		runtime.Tags(),
+		nil,
+		runtime.IPAddresses(),
+		[]string{},
+		nil,
+	)
+	p.UpdateTrustedNetworks(mode.Networks)
+
+	return p
+}
+
+// doQuarantine applies or lifts the quarantine of a PU. The enforcer is updated first
+// and is not rolled back if the supervisor fails, so that a failed quarantine
+// leaves the PU isolated rather than open.
+func (t *trireme) doQuarantine(contextID string, mode *QuarantineMode) error {
+
+	runtimeInfo, err := t.PURuntime(contextID)
+	if err != nil {
+		return errortypes.Errorf(errortypes.ErrPUNotFound, "Quarantine failed because couldn't find runtime for contextID %s", contextID)
+	}
+	runtime := runtimeInfo.(*policy.PURuntime)
+
+	if mode == nil {
+		return t.doReleaseQuarantine(contextID, runtime)
+	}
+
+	q, ok := t.quarantined[contextID]
+	if !ok {
+		q = &quarantine{}
+		t.quarantined[contextID] = q
+	}
+	q.mode = mode
+
+	containerInfo := policy.PUInfoFromPolicyAndRuntime(contextID, quarantinePolicy(contextID, runtime, mode), runtime)
+	t.enableFeatures(containerInfo)
+
+	if err := t.enforcers[runtime.PUType()].Enforce(contextID, containerInfo); err != nil {
+		t.states.applied(contextID, EnforcementFailed)
+		return errortypes.Wrapf(nil, err, "Quarantine failed for Enforcer")
+	}
+
+	if err := t.supervisors[runtime.PUType()].Supervise(contextID, containerInfo); err != nil {
+		t.states.applied(contextID, EnforcementFailed)
+		return errortypes.Wrapf(nil, err, "Quarantine failed for Supervisor")
+	}
+
+	log.WithFields(log.Fields{
+		"package":   "trireme",
+		"contextID": contextID,
+		"networks":  mode.Networks,
+	}).Info("PU quarantined")
+
+	t.collectQuarantineEvent(contextID, collector.AdminQuarantine, mode.Networks)
+	t.states.applied(contextID, EnforcementQuarantined)
+	t.applied[contextID] = containerInfo
+	t.states.summarized(contextID, containerInfo.Policy)
+
+	return nil
+}
+
+// doReleaseQuarantine lifts the quarantine of a PU and applies the last policy it
+// received, or the policy of the resolver
+func (t *trireme) doReleaseQuarantine(contextID string, runtime *policy.PURuntime) error {
+
+	q, ok := t.quarantined[contextID]
+	if !ok {
+		return nil
+	}
+
+	policyInfo := q.pending
+	if policyInfo == nil {
+		resolved, err := t.resolvePolicy(contextID, runtime)
+		if err != nil {
+			return errortypes.Wrapf(errortypes.ErrPolicyRejected, err, "Policy Error for this context: %s", contextID)
+		}
+
+		if resolved == nil {
+			return errortypes.Errorf(errortypes.ErrPolicyRejected, "Nil policy returned for context: %s", contextID)
+		}
+
+		policyInfo = resolved.Clone()
+	}
+
+	delete(t.quarantined, contextID)
+	t.collectQuarantineEvent(contextID, collector.AdminReleaseQuarantine, nil)
+
+	containerInfo := policy.PUInfoFromPolicyAndRuntime(contextID, policyInfo, runtime)
+	addTransmitterLabel(contextID, containerInfo)
+
+	// The quarantine was enforced even if the policy of the PU is not
+	if !mustEnforce(contextID, containerInfo) {
+		errS := t.supervisors[runtime.PUType()].Unsupervise(contextID)
+		errE := t.enforcers[runtime.PUType()].Unenforce(contextID)
+		if errS != nil || errE != nil {
+			t.states.applied(contextID, EnforcementFailed)
+			return errortypes.Errorf(nil, "Quarantine release failed for contextID %s. supervisor %s, enforcer %s", contextID, errS, errE)
+		}
+
+		delete(t.applied, contextID)
+		t.states.applied(contextID, EnforcementIgnored)
+		return nil
+	}
+
+	return t.doUpdatePolicy(contextID, policyInfo)
+}
+
+func (t *trireme) collectQuarantineEvent(contextID string, action string, networks []string) {
+
+	if c, ok := t.collector.(collector.AdminEventCollector); ok {
+		c.CollectAdminEvent(&collector.AdminRecord{
+			Action:    action,
+			ContextID: contextID,
+			IPs:       networks,
+		})
+	}
+}
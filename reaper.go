@@ -0,0 +1,219 @@
+package trireme
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/aporeto-inc/trireme/monitor"
+	"github.com/aporeto-inc/trireme/policy"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// A LivenessProbe checks if the workload of a PU is still alive. The docker monitor
+// is one, checking that the container of the PU exists and runs.
+type LivenessProbe interface {
+
+	// Alive returns false if the workload of the PU is dead. The PU is left alone if
+	// an error is returned.
+	Alive(contextID string, runtime policy.RuntimeReader) (bool, error)
+}
+
+// ReaperPolicy is how the dead PUs are detected. The monitors may miss the events
+// stopping a PU, leaving its rules and remote enforcer running forever. The reaper
+// probes the cached PUs periodically and destroys the ones found dead by any of the
+// probes MaxFailures times in a row.
+type ReaperPolicy struct {
+	// Interval is the interval between two probes of the PUs. Zero disables the
+	// reaper.
+	Interval time.Duration
+	// MaxFailures is the number of probes failed in a row before the PU is destroyed
+	MaxFailures int
+	// Probes are the liveness probes of the PUs
+	Probes []LivenessProbe
+}
+
+// DefaultReaperPolicy is the reaper policy unless configured otherwise. It probes the
+// processes and the network namespaces of the PUs.
+var DefaultReaperPolicy = ReaperPolicy{
+	Interval:    30 * time.Second,
+	MaxFailures: 2,
+	Probes:      []LivenessProbe{NewProcessProbe()},
+}
+
+// validate returns an error if the reaper policy is invalid
+func (r ReaperPolicy) validate() error {
+
+	if r.Interval < 0 {
+		return fmt.Errorf("Reaper interval cannot be negative")
+	}
+
+	if r.MaxFailures < 1 {
+		return fmt.Errorf("Max failures must be at least 1")
+	}
+
+	for _, probe := range r.Probes {
+		if probe == nil {
+			return fmt.Errorf("Liveness probe cannot be nil")
+		}
+	}
+
+	return nil
+}
+
+// processProbe probes the process and the network namespace of the PUs
+type processProbe struct{}
+
+// NewProcessProbe returns a LivenessProbe finding dead the PUs whose process exited
+// or whose network namespace was removed. The PUs without a PID or a network
+// namespace path are alive.
+func NewProcessProbe() LivenessProbe {
+
+	return &processProbe{}
+}
+
+// Alive implements the LivenessProbe interface
+func (p *processProbe) Alive(contextID string, runtime policy.RuntimeReader) (bool, error) {
+
+	if pid := runtime.Pid(); pid > 0 {
+		if err := syscall.Kill(pid, 0); err == syscall.ESRCH {
+			return false, nil
+		}
+	}
+
+	netns, ok := runtime.(interface {
+		NetNSPath() (string, bool)
+	})
+	if !ok {
+		return true, nil
+	}
+
+	path, ok := netns.NetNSPath()
+	if !ok || path == "" {
+		return true, nil
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// SetReaperPolicy implements the ReaperConfigurer interface
+func (t *trireme) SetReaperPolicy(reaper ReaperPolicy) error {
+
+	if err := reaper.validate(); err != nil {
+		return err
+	}
+
+	t.reaper = reaper
+
+	return nil
+}
+
+// scheduleReaper schedules the next probes of the PUs, unless the reaper is disabled
+// or Trireme is stopped
+func (t *trireme) scheduleReaper() {
+
+	t.reaperLock.Lock()
+	defer t.reaperLock.Unlock()
+
+	if t.reaper.Interval == 0 || t.reaperStopped {
+		return
+	}
+
+	t.reaperTimer = t.clock.AfterFunc(t.reaper.Interval, t.reapDead)
+}
+
+// stopReaper cancels the probes scheduled
+func (t *trireme) stopReaper() {
+
+	t.reaperLock.Lock()
+	defer t.reaperLock.Unlock()
+
+	t.reaperStopped = true
+	if t.reaperTimer != nil {
+		t.reaperTimer.Stop()
+	}
+}
+
+// reapDead probes the cached PUs and stops and destroys the ones found dead too many
+// times in a row, as if their monitor had seen them die
+func (t *trireme) reapDead() {
+
+	defer t.scheduleReaper()
+
+	failures := map[string]int{}
+
+	for _, contextID := range t.states.contextIDs() {
+
+		runtime, err := t.PURuntime(contextID)
+		if err != nil {
+			continue
+		}
+
+		if t.alive(contextID, runtime) {
+			continue
+		}
+
+		failures[contextID] = t.reaperFailures[contextID] + 1
+		if failures[contextID] < t.reaper.MaxFailures {
+			log.WithFields(log.Fields{
+				"package":   "trireme",
+				"contextID": contextID,
+				"failures":  failures[contextID],
+			}).Debug("PU found dead by its liveness probe")
+			continue
+		}
+
+		delete(failures, contextID)
+
+		log.WithFields(log.Fields{
+			"package":   "trireme",
+			"contextID": contextID,
+		}).Warn("Destroying the dead PU")
+
+		for _, event := range []monitor.Event{monitor.EventStop, monitor.EventDestroy} {
+			if err := <-t.HandlePUEvent(contextID, event); err != nil {
+				log.WithFields(log.Fields{
+					"package":   "trireme",
+					"contextID": contextID,
+					"event":     event,
+					"error":     err.Error(),
+				}).Warn("Failed to destroy the dead PU")
+			}
+		}
+	}
+
+	t.reaperFailures = failures
+}
+
+// alive returns false if any of the probes found the PU dead. The probes failing are
+// ignored.
+func (t *trireme) alive(contextID string, runtime policy.RuntimeReader) bool {
+
+	for _, probe := range t.reaper.Probes {
+
+		alive, err := probe.Alive(contextID, runtime)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"package":   "trireme",
+				"contextID": contextID,
+				"error":     err.Error(),
+			}).Debug("Failed to probe the PU")
+			continue
+		}
+
+		if !alive {
+			return false
+		}
+	}
+
+	return true
+}
@@ -1,13 +1,23 @@
 package trireme
 
 import (
+	"io"
+
 	"github.com/aporeto-inc/trireme/monitor"
 	"github.com/aporeto-inc/trireme/policy"
 )
 
 const (
-	handleEvent  = 1
-	policyUpdate = 2
+	handleEvent        = 1
+	policyUpdate       = 2
+	quarantineUpdate   = 3
+	rolloutStart       = 4
+	rolloutEnd         = 5
+	retryRequest       = 6
+	snapshotRequest    = 7
+	convergenceRequest = 8
+	enforcerRestart    = 9
+	runtimeUpdate      = 10
 )
 
 type triremeRequest struct {
@@ -15,5 +25,21 @@ type triremeRequest struct {
 	reqType    int
 	eventType  monitor.Event
 	policyInfo *policy.PUPolicy
+	// quarantineMode is the mode of a quarantine request, nil to lift it
+	quarantineMode *QuarantineMode
+	rollout        *Rollout
+	promote        bool
+	// retried is the failed request applied again by a retry request and attempt
+	// the retry of the PU it belongs to
+	retried *triremeRequest
+	attempt int
+	// snapshot is the writer of a snapshot request
+	snapshot io.Writer
+	// revision and convergence are the revision and the channel of the report of a
+	// convergence request
+	revision    string
+	convergence chan *ConvergenceReport
+	// tags are the runtime tags set by a runtime update
+	tags       map[string]string
 	returnChan chan error
 }
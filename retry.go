@@ -0,0 +1,240 @@
+package trireme
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aporeto-inc/trireme/monitor"
+	"github.com/aporeto-inc/trireme/utils/clock"
+	"github.com/aporeto-inc/trireme/utils/errortypes"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// RetryPolicy is how the PUs whose policy fails to apply are retried. The delay
+// between two retries doubles after every failure. Once a PU failed more than
+// MaxRetries times in a row its circuit is opened: it is no longer retried, it is
+// reported in the EnforcementBroken mode and its runtime events are rejected until
+// a new policy is pushed for it or it is stopped.
+type RetryPolicy struct {
+	// InitialBackoff is the delay before the first retry
+	InitialBackoff time.Duration
+	// MaxBackoff is the maximum delay between two retries
+	MaxBackoff time.Duration
+	// MaxRetries is the number of retries before the circuit of the PU is opened
+	MaxRetries int
+}
+
+// DefaultRetryPolicy is the retry policy of Trireme unless configured otherwise
+var DefaultRetryPolicy = RetryPolicy{
+	InitialBackoff: time.Second,
+	MaxBackoff:     5 * time.Minute,
+	MaxRetries:     10,
+}
+
+// validate returns an error if the retry policy is invalid
+func (r RetryPolicy) validate() error {
+
+	if r.InitialBackoff <= 0 {
+		return fmt.Errorf("Initial backoff must be positive")
+	}
+
+	if r.MaxBackoff < r.InitialBackoff {
+		return fmt.Errorf("Max backoff cannot be lower than the initial backoff")
+	}
+
+	if r.MaxRetries < 0 {
+		return fmt.Errorf("Max retries cannot be negative")
+	}
+
+	return nil
+}
+
+// backoff returns the delay before the retry following the given number of failures
+func (r RetryPolicy) backoff(failures int) time.Duration {
+
+	delay := r.InitialBackoff
+	for i := 1; i < failures && delay < r.MaxBackoff; i++ {
+		delay *= 2
+	}
+
+	if delay > r.MaxBackoff {
+		return r.MaxBackoff
+	}
+
+	return delay
+}
+
+// breaker is the retry state of a PU whose policy failed to apply. It is only used
+// by the request routine.
+type breaker struct {
+	failures int
+	// attempt identifies the retry scheduled, so that a retry superseded by another
+	// request of the PU is ignored
+	attempt int
+	timer   clock.Timer
+	open    bool
+}
+
+// SetRetryPolicy implements the RetryConfigurer interface
+func (t *trireme) SetRetryPolicy(retry RetryPolicy) error {
+
+	if err := retry.validate(); err != nil {
+		return err
+	}
+
+	t.retry = retry
+
+	return nil
+}
+
+// retriable returns true if the request applies a policy and is retried if it fails
+func retriable(req *triremeRequest) bool {
+
+	switch req.reqType {
+	case policyUpdate, runtimeUpdate:
+		return true
+	case handleEvent:
+		return req.eventType == monitor.EventStart || req.eventType == monitor.EventUpdate
+	default:
+		return false
+	}
+}
+
+// handleWithRetries handles a request and schedules a retry of the PU if its policy
+// failed to apply. The runtime events of the PUs whose circuit is open are rejected,
+// while a pushed policy is always tried and closes the circuit if it succeeds.
+func (t *trireme) handleWithRetries(req *triremeRequest) error {
+
+	b := t.breakers[req.contextID]
+	t.trigger = triggerOf(req)
+
+	if req.reqType == retryRequest {
+		if b == nil || b.attempt != req.attempt {
+			return nil
+		}
+
+		err := t.doRetry(req.retried)
+		t.recordAttempt(req.retried, err)
+		return err
+	}
+
+	if !retriable(req) {
+		err := t.handleRequest(req)
+		if req.reqType == handleEvent && req.eventType == monitor.EventStop {
+			t.resetBreaker(req.contextID)
+		}
+		return err
+	}
+
+	if b != nil && b.open && req.reqType != policyUpdate {
+		return errortypes.Errorf(errortypes.ErrCircuitOpen, "Policy of context %s failed %d times. Waiting for a new policy", req.contextID, b.failures)
+	}
+
+	err := t.handleRequest(req)
+	t.recordAttempt(req, err)
+
+	return err
+}
+
+// doRetry applies again the policy of a failed request, without notifying the
+// resolver of the event again
+func (t *trireme) doRetry(req *triremeRequest) error {
+
+	if req.reqType == policyUpdate {
+		return t.doPushedPolicy(req.contextID, req.policyInfo)
+	}
+
+	if req.eventType == monitor.EventStart {
+		return t.doHandleCreate(req.contextID)
+	}
+
+	return t.doHandleUpdate(req.contextID)
+}
+
+// recordAttempt records the outcome of a request applying the policy of a PU. A
+// failure schedules a retry after the backoff, or opens the circuit of the PU once
+// its retries are exhausted.
+func (t *trireme) recordAttempt(req *triremeRequest, err error) {
+
+	contextID := req.contextID
+
+	if err == nil || errortypes.Is(err, errortypes.ErrPUNotFound) {
+		t.resetBreaker(contextID)
+		return
+	}
+
+	b, ok := t.breakers[contextID]
+	if !ok {
+		b = &breaker{}
+		t.breakers[contextID] = b
+	}
+
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+
+	b.failures++
+	b.attempt++
+
+	if b.failures > t.retry.MaxRetries {
+		b.open = true
+		t.states.retried(contextID, b.failures, true)
+
+		log.WithFields(log.Fields{
+			"package":   "trireme",
+			"contextID": contextID,
+			"failures":  b.failures,
+			"error":     err.Error(),
+		}).Error("Giving up on the policy of the PU")
+		return
+	}
+
+	t.states.retried(contextID, b.failures, false)
+
+	delay := t.retry.backoff(b.failures)
+	retry := &triremeRequest{
+		contextID:  contextID,
+		reqType:    retryRequest,
+		retried:    req,
+		attempt:    b.attempt,
+		returnChan: make(chan error, 1),
+	}
+	b.timer = t.clock.AfterFunc(delay, func() {
+		t.requests <- retry
+	})
+
+	log.WithFields(log.Fields{
+		"package":   "trireme",
+		"contextID": contextID,
+		"failures":  b.failures,
+		"delay":     delay,
+		"error":     err.Error(),
+	}).Warn("Policy of the PU failed. Retrying")
+}
+
+// resetBreaker forgets the failures of a PU and cancels its retry
+func (t *trireme) resetBreaker(contextID string) {
+
+	b, ok := t.breakers[contextID]
+	if !ok {
+		return
+	}
+
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+
+	delete(t.breakers, contextID)
+}
+
+// stopRetries cancels the retries scheduled
+func (t *trireme) stopRetries() {
+
+	for _, b := range t.breakers {
+		if b.timer != nil {
+			b.timer.Stop()
+		}
+	}
+}
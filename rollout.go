@@ -0,0 +1,222 @@
+package trireme
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/policy"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Rollout applies a candidate policy revision to a subset of the PUs while the
+// others stay on the current revision
+type Rollout struct {
+	// Revision identifies the candidate revision. It is added to the annotations of
+	// the policies with the collector.PolicyRevisionTag key, so that the flows of
+	// every revision can be measured.
+	Revision string
+	// Resolver resolves the candidate policy of the PUs of the rollout
+	Resolver PolicyResolver
+	// Selector selects the PUs by their runtime tags. An empty selector selects all
+	// the PUs.
+	Selector map[string]string
+	// Percentage is the percentage of the selected PUs that get the candidate policy.
+	// The PUs are chosen by their contextID, so a PU stays in the rollout when it
+	// restarts.
+	Percentage int
+}
+
+// validate returns an error if the rollout is incomplete
+func (r *Rollout) validate() error {
+
+	if r.Revision == "" {
+		return fmt.Errorf("Rollout revision cannot be empty")
+	}
+
+	if r.Resolver == nil {
+		return fmt.Errorf("Rollout resolver cannot be nil")
+	}
+
+	if r.Percentage < 0 || r.Percentage > 100 {
+		return fmt.Errorf("Invalid rollout percentage %d", r.Percentage)
+	}
+
+	return nil
+}
+
+// selects returns true if the PU gets the candidate policy
+func (r *Rollout) selects(contextID string, runtime policy.RuntimeReader) bool {
+
+	tags := runtime.Tags()
+	for k, v := range r.Selector {
+		if value, ok := tags.Get(k); !ok || value != v {
+			return false
+		}
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(contextID))
+
+	return int(h.Sum32()%100) < r.Percentage
+}
+
+// StartRollout applies the candidate revision of the rollout to the PUs it selects.
+// Only one rollout can run at a time.
+func (t *trireme) StartRollout(rollout *Rollout) <-chan error {
+
+	c := make(chan error, 1)
+
+	req := &triremeRequest{
+		reqType:    rolloutStart,
+		rollout:    rollout,
+		returnChan: c,
+	}
+
+	t.requests <- req
+
+	return c
+}
+
+// EndRollout ends the running rollout. If promote is true, the candidate revision
+// becomes the current revision of all the PUs. Otherwise the PUs of the rollout
+// return to the current revision.
+func (t *trireme) EndRollout(promote bool) <-chan error {
+
+	c := make(chan error, 1)
+
+	req := &triremeRequest{
+		reqType:    rolloutEnd,
+		promote:    promote,
+		returnChan: c,
+	}
+
+	t.requests <- req
+
+	return c
+}
+
+// doPushedPolicy applies a policy pushed with UpdatePolicy. The pushed policies are
+// policies of the current revision, so the PUs of a rollout resolve their candidate
+// policy again instead.
+func (t *trireme) doPushedPolicy(contextID string, newPolicy *policy.PUPolicy) error {
+
+	runtime, err := t.PURuntime(contextID)
+	if err == nil && t.inRollout(contextID, runtime) {
+		return t.doHandleUpdate(contextID)
+	}
+
+	if t.revision != "" {
+		newPolicy.AddAnnotation(collector.PolicyRevisionTag, t.revision)
+	}
+
+	return t.doUpdatePolicy(contextID, newPolicy)
+}
+
+// resolvePolicy resolves the policy of a PU with the resolver of its revision
+func (t *trireme) resolvePolicy(contextID string, runtime policy.RuntimeReader) (*policy.PUPolicy, error) {
+
+	resolver, revision := t.resolver, t.revision
+	if t.inRollout(contextID, runtime) {
+		resolver, revision = t.rollout.Resolver, t.rollout.Revision
+	}
+
+	policyInfo, err := resolver.ResolvePolicy(contextID, runtime)
+	t.auditResolution(contextID, revision, policyInfo, err)
+
+	if err != nil || policyInfo == nil || revision == "" {
+		return policyInfo, err
+	}
+
+	policyInfo = policyInfo.Clone()
+	policyInfo.AddAnnotation(collector.PolicyRevisionTag, revision)
+
+	return policyInfo, nil
+}
+
+// inRollout returns true if a PU gets the candidate policy of the running rollout
+func (t *trireme) inRollout(contextID string, runtime policy.RuntimeReader) bool {
+
+	return t.rollout != nil && t.rollout.selects(contextID, runtime)
+}
+
+// doStartRollout starts a rollout and resolves the policy of the PUs it selects
+func (t *trireme) doStartRollout(rollout *Rollout) error {
+
+	if t.rollout != nil {
+		return fmt.Errorf("Rollout of revision %s is already running", t.rollout.Revision)
+	}
+
+	if err := rollout.validate(); err != nil {
+		return err
+	}
+
+	t.rollout = rollout
+
+	return t.updateRolloutPUs(func(contextID string, runtime policy.RuntimeReader) bool {
+		return rollout.selects(contextID, runtime)
+	})
+}
+
+// doEndRollout ends the running rollout and resolves the policy of the PUs whose
+// revision changes
+func (t *trireme) doEndRollout(promote bool) error {
+
+	rollout := t.rollout
+	if rollout == nil {
+		return fmt.Errorf("No rollout is running")
+	}
+
+	t.rollout = nil
+
+	if promote {
+		t.resolver = rollout.Resolver
+		t.revision = rollout.Revision
+	}
+
+	log.WithFields(log.Fields{
+		"package":  "trireme",
+		"revision": rollout.Revision,
+		"promote":  promote,
+	}).Info("Rollout ended")
+
+	return t.updateRolloutPUs(func(contextID string, runtime policy.RuntimeReader) bool {
+		return rollout.selects(contextID, runtime) != promote
+	})
+}
+
+// updateRolloutPUs resolves again the policy of the running PUs matching the filter.
+// All the PUs are updated even if some fail.
+func (t *trireme) updateRolloutPUs(filter func(contextID string, runtime policy.RuntimeReader) bool) error {
+
+	failed := []string{}
+
+	for _, contextID := range t.states.contextIDs() {
+
+		if t.states.get(contextID).mode == EnforcementPending {
+			continue
+		}
+
+		runtime, err := t.PURuntime(contextID)
+		if err != nil || !filter(contextID, runtime) {
+			continue
+		}
+
+		if err := t.doHandleUpdate(contextID); err != nil {
+			log.WithFields(log.Fields{
+				"package":   "trireme",
+				"contextID": contextID,
+				"error":     err.Error(),
+			}).Error("Unable to update the revision of the policy")
+			failed = append(failed, contextID)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("Unable to update the policy of the PUs %s", strings.Join(failed, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,291 @@
+package trireme
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/policy"
+	"github.com/aporeto-inc/trireme/supervisor"
+	"github.com/aporeto-inc/trireme/utils/features"
+)
+
+// Version is the version of Trireme reported in the snapshots. It is set when the
+// binary is built with -ldflags "-X github.com/aporeto-inc/trireme.Version=<version>".
+var Version = "unknown"
+
+// redacted replaces the values of the tags that may hold secrets in the snapshots
+const redacted = "<redacted>"
+
+// sensitiveKeys are the parts of the tag keys whose values are redacted
+var sensitiveKeys = []string{"secret", "token", "password", "passwd", "credential", "key", "cert"}
+
+// snapshotInfo describes the Trireme instance of a snapshot
+type snapshotInfo struct {
+	Version   string          `json:"version"`
+	GoVersion string          `json:"go_version"`
+	ServerID  string          `json:"server_id"`
+	Time      time.Time       `json:"time"`
+	PUTypes   []string        `json:"pu_types"`
+	Revision  string          `json:"revision,omitempty"`
+	Rollout   *rolloutInfo    `json:"rollout,omitempty"`
+	Retry     RetryPolicy     `json:"retry"`
+	Features  *features.Flags `json:"features,omitempty"`
+}
+
+// rolloutInfo describes the running rollout of a snapshot
+type rolloutInfo struct {
+	Revision   string            `json:"revision"`
+	Selector   map[string]string `json:"selector,omitempty"`
+	Percentage int               `json:"percentage"`
+}
+
+// policySnapshot is the policy applied to a PU without its secrets
+type policySnapshot struct {
+	ContextID        string               `json:"context_id"`
+	ManagementID     string               `json:"management_id,omitempty"`
+	Action           policy.PUAction      `json:"action"`
+	ApplicationACLs  []policy.IPRule      `json:"application_acls"`
+	NetworkACLs      []policy.IPRule      `json:"network_acls"`
+	TransmitterRules []policy.TagSelector `json:"transmitter_rules"`
+	ReceiverRules    []policy.TagSelector `json:"receiver_rules"`
+	Identity         map[string]string    `json:"identity"`
+	Annotations      map[string]string    `json:"annotations"`
+	IPs              map[string]string    `json:"ips"`
+	TriremeNetworks  []string             `json:"trireme_networks"`
+	TrustedNetworks  []string             `json:"trusted_networks"`
+	Features         []string             `json:"features,omitempty"`
+}
+
+// eventsSnapshot are the recent events of the collector
+type eventsSnapshot struct {
+	Flows      []*collector.FlowRecord      `json:"flows"`
+	Containers []*collector.ContainerRecord `json:"containers"`
+}
+
+// Snapshot writes a gzipped tar archive of the state of Trireme for the support
+// bundles. It holds the state of the PUs, their policies without the values of the
+// tags that look like secrets, the rules of the supervisors implementing the
+// supervisor.RuleDumper interface, the recent events of a collector implementing the
+// collector.EventHistory interface and the version and configuration of Trireme.
+func (t *trireme) Snapshot(w io.Writer) error {
+
+	c := make(chan error, 1)
+
+	t.requests <- &triremeRequest{
+		reqType:    snapshotRequest,
+		snapshot:   w,
+		returnChan: c,
+	}
+
+	return <-c
+}
+
+// doSnapshot writes the snapshot. It runs in the request routine, which owns the
+// policies applied to the PUs.
+func (t *trireme) doSnapshot(w io.Writer) error {
+
+	now := t.clock.Now()
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	files := []struct {
+		name    string
+		content interface{}
+	}{
+		{name: "version.json", content: t.snapshotInfo(now)},
+		{name: "pus.json", content: t.ListPUs()},
+		{name: "policies.json", content: t.policySnapshots()},
+	}
+
+	if history, ok := t.collector.(collector.EventHistory); ok {
+		flows, containers := history.RecentEvents()
+		files = append(files, struct {
+			name    string
+			content interface{}
+		}{name: "events.json", content: &eventsSnapshot{Flows: flows, Containers: containers}})
+	}
+
+	for _, f := range files {
+		buf := &bytes.Buffer{}
+		enc := json.NewEncoder(buf)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.content); err != nil {
+			return err
+		}
+
+		if err := addSnapshotFile(tw, f.name, buf.Bytes(), now); err != nil {
+			return err
+		}
+	}
+
+	for _, puType := range t.puTypes() {
+		dumper, ok := t.supervisors[puType].(supervisor.RuleDumper)
+		if !ok {
+			continue
+		}
+
+		// A failed dump is reported in the archive rather than failing the snapshot
+		buf := &bytes.Buffer{}
+		if err := dumper.DumpRules(buf); err != nil {
+			buf.WriteString("\n" + err.Error() + "\n")
+		}
+
+		if err := addSnapshotFile(tw, "rules/"+puTypeName(puType)+".txt", buf.Bytes(), now); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return gz.Close()
+}
+
+// snapshotInfo returns the version and the configuration of Trireme
+func (t *trireme) snapshotInfo(now time.Time) *snapshotInfo {
+
+	info := &snapshotInfo{
+		Version:   Version,
+		GoVersion: runtime.Version(),
+		ServerID:  t.serverID,
+		Time:      now,
+		PUTypes:   []string{},
+		Revision:  t.revision,
+		Retry:     t.retry,
+		Features:  t.features,
+	}
+
+	for _, puType := range t.puTypes() {
+		info.PUTypes = append(info.PUTypes, puTypeName(puType))
+	}
+
+	if t.rollout != nil {
+		info.Rollout = &rolloutInfo{
+			Revision:   t.rollout.Revision,
+			Selector:   t.rollout.Selector,
+			Percentage: t.rollout.Percentage,
+		}
+	}
+
+	return info
+}
+
+// policySnapshots returns the policies applied to the PUs sorted by contextID
+func (t *trireme) policySnapshots() []*policySnapshot {
+
+	contextIDs := make([]string, 0, len(t.applied))
+	for contextID := range t.applied {
+		contextIDs = append(contextIDs, contextID)
+	}
+	sort.Strings(contextIDs)
+
+	policies := make([]*policySnapshot, 0, len(contextIDs))
+	for _, contextID := range contextIDs {
+		p := t.applied[contextID].Policy
+
+		policies = append(policies, &policySnapshot{
+			ContextID:        contextID,
+			ManagementID:     p.ManagementID,
+			Action:           p.TriremeAction,
+			ApplicationACLs:  p.ApplicationACLs().Rules,
+			NetworkACLs:      p.NetworkACLs().Rules,
+			TransmitterRules: p.TransmitterRules().TagSelectors,
+			ReceiverRules:    p.ReceiverRules().TagSelectors,
+			Identity:         redactTags(p.Identity()),
+			Annotations:      redactTags(p.Annotations()),
+			IPs:              p.IPAddresses().IPs,
+			TriremeNetworks:  p.TriremeNetworks(),
+			TrustedNetworks:  p.TrustedNetworks(),
+			Features:         p.Features(),
+		})
+	}
+
+	return policies
+}
+
+// puTypes returns the PU types of the supervisors in a stable order
+func (t *trireme) puTypes() []constants.PUType {
+
+	types := []int{}
+	for puType := range t.supervisors {
+		types = append(types, int(puType))
+	}
+	sort.Ints(types)
+
+	puTypes := make([]constants.PUType, len(types))
+	for i, puType := range types {
+		puTypes[i] = constants.PUType(puType)
+	}
+
+	return puTypes
+}
+
+// puTypeName returns the name of a PU type in the snapshots
+func puTypeName(puType constants.PUType) string {
+
+	switch puType {
+	case constants.ContainerPU:
+		return "container"
+	case constants.LinuxProcessPU:
+		return "linux-process"
+	case constants.WindowsProcessPU:
+		return "windows-process"
+	default:
+		return "unknown"
+	}
+}
+
+// redactTags returns the tags with the values of the keys that may hold secrets
+// redacted
+func redactTags(tags *policy.TagsMap) map[string]string {
+
+	redactedTags := map[string]string{}
+	if tags == nil {
+		return redactedTags
+	}
+
+	for k, v := range tags.Tags {
+		redactedTags[k] = v
+
+		key := strings.ToLower(k)
+		for _, sensitive := range sensitiveKeys {
+			if strings.Contains(key, sensitive) {
+				redactedTags[k] = redacted
+				break
+			}
+		}
+	}
+
+	return redactedTags
+}
+
+// addSnapshotFile adds a file to the archive of a snapshot
+func addSnapshotFile(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: modTime,
+	}
+
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+
+	_, err := tw.Write(data)
+
+	return err
+}
@@ -0,0 +1,238 @@
+package supervisor
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/policy"
+)
+
+// BandwidthAccountingConfigurer is implemented by the supervisors that can account
+// for the traffic of the processing units
+type BandwidthAccountingConfigurer interface {
+
+	// EnableBandwidthAccounting reports the traffic of the processing units to the
+	// collector at every interval. It must be called before the supervisor is started.
+	EnableBandwidthAccounting(interval time.Duration) error
+}
+
+// bandwidthAccountant is implemented by the implementations that count the traffic
+// of the PUs
+type bandwidthAccountant interface {
+
+	// EnableAccounting counts the traffic of the PUs configured after the call
+	EnableAccounting()
+
+	// Counters returns the traffic of a PU since its version was configured
+	Counters(version int, contextID string, appACLs, netACLs *policy.IPRuleList) (*collector.BandwidthRecord, error)
+}
+
+// accountedPU is a PU whose traffic is reported
+type accountedPU struct {
+	version int
+	tags    *policy.TagsMap
+	appACLs *policy.IPRuleList
+	netACLs *policy.IPRuleList
+	// last are the counters of the version at the previous report, if any
+	last *collector.BandwidthRecord
+	// since is the time of the previous report
+	since time.Time
+}
+
+// bandwidthReporter reports the traffic of the PUs counted by the implementation,
+// and the matches of their ACLs if enabled. The counters of a PU restart from zero
+// with each version of its rules, so the traffic between the last report of a
+// version and its replacement is not reported.
+type bandwidthReporter struct {
+	accountant bandwidthAccountant
+	collector  collector.BandwidthEventCollector
+	rules      collector.RuleStatsEventCollector
+	interval   time.Duration
+	pus        map[string]*accountedPU
+	now        func() time.Time
+	stop       chan struct{}
+	sync.Mutex
+}
+
+// EnableBandwidthAccounting implements the BandwidthAccountingConfigurer interface
+func (s *Config) EnableBandwidthAccounting(interval time.Duration) error {
+
+	if interval <= 0 {
+		return fmt.Errorf("Invalid accounting interval %s", interval)
+	}
+
+	c, ok := s.collector.(collector.BandwidthEventCollector)
+	if !ok {
+		return fmt.Errorf("Collector does not collect bandwidth events")
+	}
+
+	b, err := s.accountingReporter(interval)
+	if err != nil {
+		return err
+	}
+
+	b.collector = c
+
+	return nil
+}
+
+// accountingReporter returns the reporter of the counters of the PUs, created for the
+// interval if needed. The traffic and the rule matches are reported together.
+func (s *Config) accountingReporter(interval time.Duration) (*bandwidthReporter, error) {
+
+	if s.bandwidth != nil {
+		if s.bandwidth.interval != interval {
+			return nil, fmt.Errorf("Accounting interval already set to %s", s.bandwidth.interval)
+		}
+		return s.bandwidth, nil
+	}
+
+	accountant, ok := s.impl.(bandwidthAccountant)
+	if !ok {
+		return nil, fmt.Errorf("Supervisor implementation does not support bandwidth accounting")
+	}
+
+	accountant.EnableAccounting()
+
+	s.bandwidth = &bandwidthReporter{
+		accountant: accountant,
+		interval:   interval,
+		pus:        map[string]*accountedPU{},
+		now:        time.Now,
+		stop:       make(chan struct{}),
+	}
+
+	return s.bandwidth, nil
+}
+
+// track starts or restarts the accounting of a PU for a version of its rules
+func (b *bandwidthReporter) track(contextID string, version int, containerInfo *policy.PUInfo) {
+
+	b.Lock()
+	defer b.Unlock()
+
+	pu, ok := b.pus[contextID]
+	if !ok {
+		pu = &accountedPU{since: b.now()}
+		b.pus[contextID] = pu
+	}
+
+	pu.tags = containerInfo.Policy.Annotations()
+	pu.appACLs = containerInfo.Policy.ApplicationACLs()
+	pu.netACLs = containerInfo.Policy.NetworkACLs()
+
+	if pu.version != version {
+		pu.version = version
+		pu.last = nil
+	}
+}
+
+// forget stops the accounting of a PU
+func (b *bandwidthReporter) forget(contextID string) {
+
+	b.Lock()
+	defer b.Unlock()
+
+	delete(b.pus, contextID)
+}
+
+// run reports the traffic at every interval until the reporter is stopped
+func (b *bandwidthReporter) run() {
+
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			b.report()
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// report sends the traffic of the PUs since the previous report to the collector.
+// The PUs without traffic are not reported, but the matches of their ACLs are.
+func (b *bandwidthReporter) report() {
+
+	b.Lock()
+	defer b.Unlock()
+
+	now := b.now()
+
+	for contextID, pu := range b.pus {
+		counters, err := b.accountant.Counters(pu.version, contextID, pu.appACLs, pu.netACLs)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"package":   "supervisor",
+				"contextID": contextID,
+				"error":     err.Error(),
+			}).Debug("Failed to read the traffic of the PU")
+			continue
+		}
+
+		record := bandwidthDelta(counters, pu.last)
+		record.Tags = pu.tags
+		record.Interval = now.Sub(pu.since)
+
+		pu.last = counters
+		pu.since = now
+
+		if b.rules != nil {
+			b.rules.CollectRuleStatsEvent(ruleStats(record, pu))
+		}
+
+		if b.collector == nil || (record.TxPackets == 0 && record.RxPackets == 0) {
+			continue
+		}
+
+		b.collector.CollectBandwidthEvent(record)
+	}
+}
+
+// bandwidthDelta returns the traffic counted since the previous counters of the same
+// version, or all the traffic if there are none
+func bandwidthDelta(counters, last *collector.BandwidthRecord) *collector.BandwidthRecord {
+
+	if last == nil {
+		last = &collector.BandwidthRecord{}
+	}
+
+	record := &collector.BandwidthRecord{
+		ContextID: counters.ContextID,
+		TxBytes:   counters.TxBytes - last.TxBytes,
+		TxPackets: counters.TxPackets - last.TxPackets,
+		RxBytes:   counters.RxBytes - last.RxBytes,
+		RxPackets: counters.RxPackets - last.RxPackets,
+		Rules:     []*collector.RuleBandwidth{},
+	}
+
+	previous := map[collector.RuleBandwidth]*collector.RuleBandwidth{}
+	for _, r := range last.Rules {
+		previous[collector.RuleBandwidth{Direction: r.Direction, Rule: r.Rule}] = r
+	}
+
+	for _, r := range counters.Rules {
+		delta := &collector.RuleBandwidth{
+			Direction: r.Direction,
+			Rule:      r.Rule,
+			Bytes:     r.Bytes,
+			Packets:   r.Packets,
+		}
+
+		if p, ok := previous[collector.RuleBandwidth{Direction: r.Direction, Rule: r.Rule}]; ok {
+			delta.Bytes -= p.Bytes
+			delta.Packets -= p.Packets
+		}
+
+		if delta.Packets > 0 {
+			record.Rules = append(record.Rules, delta)
+		}
+	}
+
+	return record
+}
@@ -0,0 +1,200 @@
+package supervisor
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/enforcer"
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+	"github.com/aporeto-inc/trireme/policy"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// testAccountant returns the counters of the PUs of a fake implementation
+type testAccountant struct {
+	Implementor
+	counters map[string]*collector.BandwidthRecord
+	versions map[string]int
+}
+
+func (a *testAccountant) EnableAccounting() {}
+
+func (a *testAccountant) Counters(version int, contextID string, appACLs, netACLs *policy.IPRuleList) (*collector.BandwidthRecord, error) {
+
+	a.versions[contextID] = version
+
+	c, ok := a.counters[contextID]
+	if !ok {
+		return nil, fmt.Errorf("No chain")
+	}
+
+	return c, nil
+}
+
+// bandwidthCollector records the bandwidth events
+type bandwidthCollector struct {
+	collector.DefaultCollector
+	records []*collector.BandwidthRecord
+}
+
+func (c *bandwidthCollector) CollectBandwidthEvent(record *collector.BandwidthRecord) {
+	c.records = append(c.records, record)
+}
+
+func TestEnableBandwidthAccounting(t *testing.T) {
+	Convey("Given a supervisor", t, func() {
+		secrets := tokens.NewPSKSecrets([]byte("test password"))
+
+		Convey("If the collector does not collect bandwidth events, it should fail", func() {
+			c := &collector.DefaultCollector{}
+			e := enforcer.NewDefaultDatapathEnforcer("serverID", c, nil, secrets, constants.LocalContainer)
+			s, _ := NewSupervisor(c, e, constants.LocalContainer, constants.IPTables)
+
+			So(s.EnableBandwidthAccounting(time.Minute), ShouldNotBeNil)
+		})
+
+		Convey("If the implementation does not account for the traffic, it should fail", func() {
+			c := &bandwidthCollector{}
+			e := enforcer.NewDefaultDatapathEnforcer("serverID", c, nil, secrets, constants.LocalContainer)
+			s, _ := NewSupervisor(c, e, constants.LocalContainer, constants.IPSets)
+
+			So(s.EnableBandwidthAccounting(time.Minute), ShouldNotBeNil)
+		})
+
+		Convey("If the interval is invalid, it should fail", func() {
+			c := &bandwidthCollector{}
+			e := enforcer.NewDefaultDatapathEnforcer("serverID", c, nil, secrets, constants.LocalContainer)
+			s, _ := NewSupervisor(c, e, constants.LocalContainer, constants.IPTables)
+
+			So(s.EnableBandwidthAccounting(0), ShouldNotBeNil)
+		})
+
+		Convey("If the implementation and the collector support it, it should succeed", func() {
+			c := &bandwidthCollector{}
+			e := enforcer.NewDefaultDatapathEnforcer("serverID", c, nil, secrets, constants.LocalContainer)
+			s, _ := NewSupervisor(c, e, constants.LocalContainer, constants.IPTables)
+
+			So(s.EnableBandwidthAccounting(time.Minute), ShouldBeNil)
+			So(s.bandwidth, ShouldNotBeNil)
+			So(s.bandwidth.interval, ShouldEqual, time.Minute)
+		})
+	})
+}
+
+func TestBandwidthReport(t *testing.T) {
+	Convey("Given a bandwidth reporter", t, func() {
+		accountant := &testAccountant{
+			counters: map[string]*collector.BandwidthRecord{},
+			versions: map[string]int{},
+		}
+		c := &bandwidthCollector{}
+
+		now := time.Unix(1000, 0)
+		b := &bandwidthReporter{
+			accountant: accountant,
+			collector:  c,
+			interval:   time.Minute,
+			pus:        map[string]*accountedPU{},
+			now:        func() time.Time { return now },
+			stop:       make(chan struct{}),
+		}
+
+		web := policy.IPRule{Address: "10.0.0.0/8", Port: "80", Protocol: "TCP", Action: policy.Accept}
+
+		annotations := policy.NewTagsMap(map[string]string{"app": "web"})
+		puInfo := policy.NewPUInfo("pu1", constants.ContainerPU)
+		puInfo.Policy = policy.NewPUPolicy("pu1", policy.Police, policy.NewIPRuleList([]policy.IPRule{web}), nil, nil, nil, nil, annotations, nil, nil, nil)
+
+		b.track("pu1", 0, puInfo)
+
+		accountant.counters["pu1"] = &collector.BandwidthRecord{
+			ContextID: "pu1",
+			TxBytes:   1000,
+			TxPackets: 10,
+			RxBytes:   2000,
+			RxPackets: 20,
+			Rules: []*collector.RuleBandwidth{
+				{Direction: collector.BandwidthApplication, Rule: web, Bytes: 60, Packets: 1},
+			},
+		}
+
+		Convey("When I report the traffic", func() {
+			now = now.Add(time.Minute)
+			b.report()
+
+			Convey("The collector should receive all the traffic", func() {
+				So(len(c.records), ShouldEqual, 1)
+				So(c.records[0].ContextID, ShouldEqual, "pu1")
+				So(c.records[0].Tags, ShouldEqual, annotations)
+				So(c.records[0].Interval, ShouldEqual, time.Minute)
+				So(c.records[0].TxBytes, ShouldEqual, 1000)
+				So(c.records[0].RxPackets, ShouldEqual, 20)
+				So(c.records[0].Rules, ShouldResemble, []*collector.RuleBandwidth{
+					{Direction: collector.BandwidthApplication, Rule: web, Bytes: 60, Packets: 1},
+				})
+			})
+
+			Convey("When I report it again", func() {
+				accountant.counters["pu1"] = &collector.BandwidthRecord{
+					ContextID: "pu1",
+					TxBytes:   1500,
+					TxPackets: 15,
+					RxBytes:   2000,
+					RxPackets: 20,
+					Rules: []*collector.RuleBandwidth{
+						{Direction: collector.BandwidthApplication, Rule: web, Bytes: 60, Packets: 1},
+					},
+				}
+				now = now.Add(30 * time.Second)
+				b.report()
+
+				Convey("The collector should receive the traffic of the interval", func() {
+					So(len(c.records), ShouldEqual, 2)
+					So(c.records[1].Interval, ShouldEqual, 30*time.Second)
+					So(c.records[1].TxBytes, ShouldEqual, 500)
+					So(c.records[1].TxPackets, ShouldEqual, 5)
+					So(c.records[1].RxBytes, ShouldEqual, 0)
+					So(c.records[1].Rules, ShouldBeEmpty)
+				})
+			})
+
+			Convey("When there is no traffic, nothing should be reported", func() {
+				b.report()
+				So(len(c.records), ShouldEqual, 1)
+			})
+
+			Convey("When the PU is updated, the counters of the new version should be reported", func() {
+				b.track("pu1", 1, puInfo)
+				accountant.counters["pu1"] = &collector.BandwidthRecord{
+					ContextID: "pu1",
+					TxBytes:   100,
+					TxPackets: 1,
+				}
+				b.report()
+
+				So(accountant.versions["pu1"], ShouldEqual, 1)
+				So(len(c.records), ShouldEqual, 2)
+				So(c.records[1].TxBytes, ShouldEqual, 100)
+			})
+
+			Convey("When the PU is forgotten, it should no longer be reported", func() {
+				b.forget("pu1")
+				accountant.counters["pu1"].TxPackets = 100
+				b.report()
+
+				So(len(c.records), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When the counters cannot be read, nothing should be reported", func() {
+			delete(accountant.counters, "pu1")
+			b.report()
+
+			So(c.records, ShouldBeEmpty)
+		})
+	})
+}
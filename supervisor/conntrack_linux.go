@@ -0,0 +1,317 @@
+// +build linux
+
+package supervisor
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"syscall"
+)
+
+const (
+	// netlinkNetfilter is the netlink family of the netfilter subsystems
+	netlinkNetfilter = 12
+	// ctnetlinkSubsystem is the netfilter subsystem of the connection tracking
+	ctnetlinkSubsystem = 1
+
+	// Messages of the connection tracking subsystem
+	ctnetlinkGet    = 1
+	ctnetlinkDelete = 2
+
+	// Attributes of a flow
+	ctaTupleOrig = 1
+	ctaProtoinfo = 4
+
+	// Attributes of a tuple
+	ctaTupleIP    = 1
+	ctaTupleProto = 2
+
+	// Attributes of the addresses of a tuple
+	ctaIPv4Src = 1
+	ctaIPv4Dst = 2
+	ctaIPv6Src = 3
+	ctaIPv6Dst = 4
+
+	// Attributes of the protocol of a tuple
+	ctaProtoNum     = 1
+	ctaProtoSrcPort = 2
+	ctaProtoDstPort = 3
+
+	// Attributes of the state of a TCP flow
+	ctaProtoinfoTCP      = 1
+	ctaProtoinfoTCPState = 1
+	tcpStateEstablished  = 3
+
+	// nlaFNested flags the nested attributes
+	nlaFNested = 0x8000
+	// nlaHeaderLen is the length of the header of an attribute
+	nlaHeaderLen = 4
+	// nfgenmsgLen is the length of the header of the netfilter messages
+	nfgenmsgLen = 4
+)
+
+// conntrackNetlink is the connection tracking table of the kernel, accessed with
+// the netlink messages of the connection tracking subsystem. The messages are
+// encoded in the host byte order of the little endian architectures.
+type conntrackNetlink struct {
+	seq uint32
+	sync.Mutex
+}
+
+// newConntrackTable returns the connection tracking table of the kernel
+func newConntrackTable() conntrackTable {
+
+	return &conntrackNetlink{}
+}
+
+// Flows implements the conntrackTable interface
+func (c *conntrackNetlink) Flows(ip string) ([]*conntrackFlow, error) {
+
+	address := net.ParseIP(ip)
+	if address == nil {
+		return nil, fmt.Errorf("Invalid address %s", ip)
+	}
+
+	family := uint8(syscall.AF_INET6)
+	if address.To4() != nil {
+		family = syscall.AF_INET
+	}
+
+	messages, err := c.request(ctnetlinkRequest(ctnetlinkGet, syscall.NLM_F_REQUEST|syscall.NLM_F_DUMP, family, c.next(), nil))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list the flows of %s: %s", ip, err)
+	}
+
+	flows := []*conntrackFlow{}
+	for _, m := range messages {
+		flow, ok := parseCtnetlinkFlow(m)
+		if !ok || (!flow.source.Equal(address) && !flow.destination.Equal(address)) {
+			continue
+		}
+		flows = append(flows, flow)
+	}
+
+	return flows, nil
+}
+
+// Delete implements the conntrackTable interface
+func (c *conntrackNetlink) Delete(flow *conntrackFlow) error {
+
+	family := uint8(syscall.AF_INET6)
+	if flow.source.To4() != nil {
+		family = syscall.AF_INET
+	}
+
+	if _, err := c.request(ctnetlinkRequest(ctnetlinkDelete, syscall.NLM_F_REQUEST|syscall.NLM_F_ACK, family, c.next(), ctnetlinkTuple(flow))); err != nil {
+		return fmt.Errorf("Unable to delete the flow: %s", err)
+	}
+
+	return nil
+}
+
+// next returns the sequence number of the next request
+func (c *conntrackNetlink) next() uint32 {
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.seq++
+
+	return c.seq
+}
+
+// request sends a request on a new socket and returns the flows of the answers
+// until the end of the dump or the acknowledgment
+func (c *conntrackNetlink) request(request []byte) ([]syscall.NetlinkMessage, error) {
+
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, netlinkNetfilter)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot open netlink socket: %s", err)
+	}
+	defer syscall.Close(fd)
+
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return nil, fmt.Errorf("Cannot bind netlink socket: %s", err)
+	}
+
+	if err := syscall.Sendto(fd, request, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return nil, fmt.Errorf("Cannot send the request: %s", err)
+	}
+
+	return readAnswers(make([]byte, syscall.Getpagesize()*4), func(buffer []byte) (int, error) {
+		n, _, err := syscall.Recvfrom(fd, buffer, 0)
+		return n, err
+	})
+}
+
+// readAnswers reads the answers of a request until the end of the dump or the
+// acknowledgment. The buffer is reused by the reads, so the data of the answers are
+// copied out of it.
+func readAnswers(buffer []byte, recv func([]byte) (int, error)) ([]syscall.NetlinkMessage, error) {
+
+	answers := []syscall.NetlinkMessage{}
+
+	for {
+		n, err := recv(buffer)
+		if err != nil {
+			if err == syscall.EINTR {
+				continue
+			}
+			return nil, err
+		}
+
+		messages, err := syscall.ParseNetlinkMessage(buffer[:n])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, m := range messages {
+			switch m.Header.Type {
+			case syscall.NLMSG_DONE:
+				return answers, nil
+			case syscall.NLMSG_ERROR:
+				if len(m.Data) < 4 {
+					return nil, fmt.Errorf("Invalid netlink error")
+				}
+				if errno := int32(binary.LittleEndian.Uint32(m.Data[0:4])); errno != 0 {
+					return nil, syscall.Errno(-errno)
+				}
+				return answers, nil
+			default:
+				m.Data = append([]byte(nil), m.Data...)
+				answers = append(answers, m)
+			}
+		}
+	}
+}
+
+// ctnetlinkRequest returns a request of the connection tracking subsystem
+func ctnetlinkRequest(msgType uint16, flags uint16, family uint8, seq uint32, attributes []byte) []byte {
+
+	request := make([]byte, syscall.NLMSG_HDRLEN+nfgenmsgLen, syscall.NLMSG_HDRLEN+nfgenmsgLen+len(attributes))
+	request = append(request, attributes...)
+
+	binary.LittleEndian.PutUint32(request[0:4], uint32(len(request)))
+	binary.LittleEndian.PutUint16(request[4:6], ctnetlinkSubsystem<<8|msgType)
+	binary.LittleEndian.PutUint16(request[6:8], flags)
+	binary.LittleEndian.PutUint32(request[8:12], seq)
+	request[syscall.NLMSG_HDRLEN] = family
+
+	return request
+}
+
+// ctnetlinkTuple returns the attribute of the original tuple of the flow
+func ctnetlinkTuple(flow *conntrackFlow) []byte {
+
+	var addresses []byte
+	if source, destination := flow.source.To4(), flow.destination.To4(); source != nil && destination != nil {
+		addresses = append(netlinkAttribute(ctaIPv4Src, source), netlinkAttribute(ctaIPv4Dst, destination)...)
+	} else {
+		addresses = append(netlinkAttribute(ctaIPv6Src, flow.source.To16()), netlinkAttribute(ctaIPv6Dst, flow.destination.To16())...)
+	}
+
+	protocol := uint8(syscall.IPPROTO_TCP)
+	if flow.protocol == "udp" {
+		protocol = syscall.IPPROTO_UDP
+	}
+
+	ports := make([]byte, 4)
+	binary.BigEndian.PutUint16(ports[0:2], uint16(flow.sourcePort))
+	binary.BigEndian.PutUint16(ports[2:4], uint16(flow.destinationPort))
+
+	proto := netlinkAttribute(ctaProtoNum, []byte{protocol})
+	proto = append(proto, netlinkAttribute(ctaProtoSrcPort, ports[0:2])...)
+	proto = append(proto, netlinkAttribute(ctaProtoDstPort, ports[2:4])...)
+
+	tuple := append(netlinkAttribute(ctaTupleIP|nlaFNested, addresses), netlinkAttribute(ctaTupleProto|nlaFNested, proto)...)
+
+	return netlinkAttribute(ctaTupleOrig|nlaFNested, tuple)
+}
+
+// netlinkAttribute returns the attribute padded to 4 bytes
+func netlinkAttribute(attrType uint16, value []byte) []byte {
+
+	length := nlaHeaderLen + len(value)
+	attribute := make([]byte, (length+3)&^3)
+
+	binary.LittleEndian.PutUint16(attribute[0:2], uint16(length))
+	binary.LittleEndian.PutUint16(attribute[2:4], attrType)
+	copy(attribute[nlaHeaderLen:], value)
+
+	return attribute
+}
+
+// parseNetlinkAttributes returns the values of the attributes by type
+func parseNetlinkAttributes(data []byte) map[uint16][]byte {
+
+	attributes := map[uint16][]byte{}
+
+	for len(data) >= nlaHeaderLen {
+		length := int(binary.LittleEndian.Uint16(data[0:2]))
+		if length < nlaHeaderLen || length > len(data) {
+			break
+		}
+
+		attributes[binary.LittleEndian.Uint16(data[2:4])&^nlaFNested] = data[nlaHeaderLen:length]
+
+		aligned := (length + 3) &^ 3
+		if aligned > len(data) {
+			break
+		}
+		data = data[aligned:]
+	}
+
+	return attributes
+}
+
+// parseCtnetlinkFlow returns the original direction of an established TCP flow
+// or of a UDP flow of a message of the connection tracking subsystem
+func parseCtnetlinkFlow(m syscall.NetlinkMessage) (*conntrackFlow, bool) {
+
+	if len(m.Data) < nfgenmsgLen {
+		return nil, false
+	}
+
+	attributes := parseNetlinkAttributes(m.Data[nfgenmsgLen:])
+
+	tuple := parseNetlinkAttributes(attributes[ctaTupleOrig])
+	addresses := parseNetlinkAttributes(tuple[ctaTupleIP])
+	proto := parseNetlinkAttributes(tuple[ctaTupleProto])
+
+	flow := &conntrackFlow{}
+
+	if source, ok := addresses[ctaIPv4Src]; ok {
+		flow.source, flow.destination = net.IP(source), net.IP(addresses[ctaIPv4Dst])
+	} else {
+		flow.source, flow.destination = net.IP(addresses[ctaIPv6Src]), net.IP(addresses[ctaIPv6Dst])
+	}
+
+	if len(flow.source) == 0 || len(flow.destination) == 0 {
+		return nil, false
+	}
+
+	number := proto[ctaProtoNum]
+	if len(number) != 1 || len(proto[ctaProtoSrcPort]) != 2 || len(proto[ctaProtoDstPort]) != 2 {
+		return nil, false
+	}
+
+	flow.sourcePort = int(binary.BigEndian.Uint16(proto[ctaProtoSrcPort]))
+	flow.destinationPort = int(binary.BigEndian.Uint16(proto[ctaProtoDstPort]))
+
+	switch number[0] {
+	case syscall.IPPROTO_UDP:
+		flow.protocol = "udp"
+	case syscall.IPPROTO_TCP:
+		flow.protocol = "tcp"
+		tcp := parseNetlinkAttributes(parseNetlinkAttributes(attributes[ctaProtoinfo])[ctaProtoinfoTCP])
+		if state := tcp[ctaProtoinfoTCPState]; len(state) != 1 || state[0] != tcpStateEstablished {
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+
+	return flow, true
+}
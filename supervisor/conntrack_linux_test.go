@@ -0,0 +1,137 @@
+// +build linux
+
+package supervisor
+
+import (
+	"encoding/binary"
+	"net"
+	"syscall"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCtnetlinkMessages(t *testing.T) {
+	Convey("Given an established TCP flow", t, func() {
+		flow := testFlow("172.17.0.1", 40000, "192.30.253.10", 443)
+
+		Convey("The deletion request should hold the original tuple", func() {
+			request := ctnetlinkRequest(ctnetlinkDelete, syscall.NLM_F_REQUEST|syscall.NLM_F_ACK, syscall.AF_INET, 7, ctnetlinkTuple(flow))
+
+			So(binary.LittleEndian.Uint32(request[0:4]), ShouldEqual, len(request))
+			So(binary.LittleEndian.Uint16(request[4:6]), ShouldEqual, 0x102)
+			So(binary.LittleEndian.Uint32(request[8:12]), ShouldEqual, 7)
+			So(request[syscall.NLMSG_HDRLEN], ShouldEqual, syscall.AF_INET)
+
+			tuple := parseNetlinkAttributes(parseNetlinkAttributes(request[syscall.NLMSG_HDRLEN+nfgenmsgLen:])[ctaTupleOrig])
+			addresses := parseNetlinkAttributes(tuple[ctaTupleIP])
+			So(net.IP(addresses[ctaIPv4Src]).String(), ShouldEqual, "172.17.0.1")
+			So(net.IP(addresses[ctaIPv4Dst]).String(), ShouldEqual, "192.30.253.10")
+
+			proto := parseNetlinkAttributes(tuple[ctaTupleProto])
+			So(proto[ctaProtoNum], ShouldResemble, []byte{syscall.IPPROTO_TCP})
+			So(proto[ctaProtoSrcPort], ShouldResemble, []byte{0x9c, 0x40})
+			So(proto[ctaProtoDstPort], ShouldResemble, []byte{0x01, 0xbb})
+		})
+
+		Convey("The flow of a dump should be parsed back", func() {
+			tcp := netlinkAttribute(ctaProtoinfoTCP|nlaFNested, netlinkAttribute(ctaProtoinfoTCPState, []byte{tcpStateEstablished}))
+			data := append(make([]byte, nfgenmsgLen), ctnetlinkTuple(flow)...)
+			data = append(data, netlinkAttribute(ctaProtoinfo|nlaFNested, tcp)...)
+
+			parsed, ok := parseCtnetlinkFlow(syscall.NetlinkMessage{Data: data})
+			So(ok, ShouldBeTrue)
+			So(parsed.protocol, ShouldEqual, "tcp")
+			So(parsed.source.Equal(flow.source), ShouldBeTrue)
+			So(parsed.destination.Equal(flow.destination), ShouldBeTrue)
+			So(parsed.sourcePort, ShouldEqual, 40000)
+			So(parsed.destinationPort, ShouldEqual, 443)
+		})
+
+		Convey("The flows that are not established should be ignored", func() {
+			tcp := netlinkAttribute(ctaProtoinfoTCP|nlaFNested, netlinkAttribute(ctaProtoinfoTCPState, []byte{1}))
+			data := append(make([]byte, nfgenmsgLen), ctnetlinkTuple(flow)...)
+			data = append(data, netlinkAttribute(ctaProtoinfo|nlaFNested, tcp)...)
+
+			_, ok := parseCtnetlinkFlow(syscall.NetlinkMessage{Data: data})
+			So(ok, ShouldBeFalse)
+		})
+	})
+
+	Convey("Given an IPv6 UDP flow", t, func() {
+		flow := &conntrackFlow{
+			protocol:        "udp",
+			source:          net.ParseIP("2001:db8::1"),
+			destination:     net.ParseIP("2001:db8::2"),
+			sourcePort:      5353,
+			destinationPort: 53,
+		}
+
+		Convey("The flow should be encoded and parsed back", func() {
+			data := append(make([]byte, nfgenmsgLen), ctnetlinkTuple(flow)...)
+
+			parsed, ok := parseCtnetlinkFlow(syscall.NetlinkMessage{Data: data})
+			So(ok, ShouldBeTrue)
+			So(parsed, ShouldResemble, flow)
+		})
+	})
+}
+
+func TestReadAnswers(t *testing.T) {
+	Convey("Given a dump of flows spanning several reads", t, func() {
+		flows := []*conntrackFlow{
+			testFlow("172.17.0.1", 40000, "192.30.253.10", 443),
+			testFlow("172.17.0.1", 40001, "192.30.253.11", 443),
+			testFlow("172.17.0.1", 40002, "192.30.253.12", 443),
+		}
+
+		tcp := netlinkAttribute(ctaProtoinfoTCP|nlaFNested, netlinkAttribute(ctaProtoinfoTCPState, []byte{tcpStateEstablished}))
+
+		reads := [][]byte{}
+		for _, flow := range flows {
+			attributes := append(ctnetlinkTuple(flow), netlinkAttribute(ctaProtoinfo|nlaFNested, tcp)...)
+			reads = append(reads, ctnetlinkRequest(ctnetlinkGet, syscall.NLM_F_MULTI, syscall.AF_INET, 1, attributes))
+		}
+
+		done := make([]byte, syscall.NLMSG_HDRLEN)
+		binary.LittleEndian.PutUint32(done[0:4], syscall.NLMSG_HDRLEN)
+		binary.LittleEndian.PutUint16(done[4:6], syscall.NLMSG_DONE)
+		reads = append(reads, done)
+
+		// The reads share a buffer, like the reads of the socket
+		buffer := make([]byte, 1024)
+		recv := func(b []byte) (int, error) {
+			n := copy(b, reads[0])
+			reads = reads[1:]
+			return n, nil
+		}
+
+		Convey("The flows of all the reads should be returned", func() {
+			answers, err := readAnswers(buffer, recv)
+			So(err, ShouldBeNil)
+			So(answers, ShouldHaveLength, 3)
+
+			for i, m := range answers {
+				parsed, ok := parseCtnetlinkFlow(m)
+				So(ok, ShouldBeTrue)
+				So(parsed.destination.Equal(flows[i].destination), ShouldBeTrue)
+				So(parsed.sourcePort, ShouldEqual, flows[i].sourcePort)
+			}
+		})
+	})
+
+	Convey("Given an acknowledgment with an error", t, func() {
+		ack := make([]byte, syscall.NLMSG_HDRLEN+4)
+		binary.LittleEndian.PutUint32(ack[0:4], uint32(len(ack)))
+		binary.LittleEndian.PutUint16(ack[4:6], syscall.NLMSG_ERROR)
+		errno := -int32(syscall.ENOENT)
+		binary.LittleEndian.PutUint32(ack[syscall.NLMSG_HDRLEN:], uint32(errno))
+
+		Convey("The error should be returned", func() {
+			_, err := readAnswers(make([]byte, 1024), func(b []byte) (int, error) {
+				return copy(b, ack), nil
+			})
+			So(err, ShouldEqual, syscall.ENOENT)
+		})
+	})
+}
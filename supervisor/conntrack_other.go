@@ -0,0 +1,9 @@
+// +build !linux
+
+package supervisor
+
+// newConntrackTable returns the connection tracking table of the conntrack command
+func newConntrackTable() conntrackTable {
+
+	return &conntrackCLI{}
+}
@@ -0,0 +1,260 @@
+package supervisor
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aporeto-inc/trireme/policy"
+)
+
+// DefaultDNSRefreshInterval is the default interval between two resolutions of the
+// domain names of the ACLs
+const DefaultDNSRefreshInterval = 60 * time.Second
+
+// DNSRefreshConfigurer is implemented by the supervisors that resolve the domain
+// names of the ACLs
+type DNSRefreshConfigurer interface {
+
+	// SetDNSRefreshInterval sets the interval between two resolutions of the domain
+	// names. It must be called before the supervisor is started.
+	SetDNSRefreshInterval(interval time.Duration) error
+}
+
+// resolvedPU is a PU whose ACLs have domain names
+type resolvedPU struct {
+	// containerInfo is the PU as supervised, with the domain names
+	containerInfo *policy.PUInfo
+	names         []string
+}
+
+// dnsResolver replaces the domain names of the ACLs by their addresses. The names
+// are resolved again at every interval, and the rules of the PUs are updated when
+// the addresses of their names change. A name that cannot be resolved keeps its
+// previous addresses, and has no rule until it is first resolved.
+type dnsResolver struct {
+	lookup   func(host string) ([]net.IP, error)
+	update   func(contextID string, containerInfo *policy.PUInfo) error
+	interval time.Duration
+	// addresses are the addresses of the names of the PUs
+	addresses map[string][]string
+	pus       map[string]*resolvedPU
+	stop      chan struct{}
+	sync.Mutex
+}
+
+// newDNSResolver returns a resolver updating the rules of the PUs with the function
+func newDNSResolver(update func(contextID string, containerInfo *policy.PUInfo) error) *dnsResolver {
+
+	return &dnsResolver{
+		lookup:    net.LookupIP,
+		update:    update,
+		interval:  DefaultDNSRefreshInterval,
+		addresses: map[string][]string{},
+		pus:       map[string]*resolvedPU{},
+		stop:      make(chan struct{}),
+	}
+}
+
+// SetDNSRefreshInterval implements the DNSRefreshConfigurer interface
+func (s *Config) SetDNSRefreshInterval(interval time.Duration) error {
+
+	if interval <= 0 {
+		return fmt.Errorf("Invalid DNS refresh interval %s", interval)
+	}
+
+	s.dns.interval = interval
+
+	return nil
+}
+
+// updateResolvedPU updates the rules of a supervised PU whose domain names changed
+// of addresses
+func (s *Config) updateResolvedPU(contextID string, containerInfo *policy.PUInfo) error {
+
+	if _, err := s.versionTracker.Get(contextID); err != nil {
+		return nil
+	}
+
+	return s.Supervise(contextID, containerInfo)
+}
+
+// resolve returns the PU with the domain names of its ACLs replaced by their
+// addresses, and remembers the PU so that its rules follow the addresses
+func (r *dnsResolver) resolve(contextID string, containerInfo *policy.PUInfo) *policy.PUInfo {
+
+	names := containerInfo.Policy.DomainNames()
+	if len(names) == 0 {
+		r.forget(contextID)
+		return containerInfo
+	}
+
+	r.Lock()
+	unresolved := []string{}
+	for _, name := range names {
+		if _, ok := r.addresses[name]; !ok {
+			unresolved = append(unresolved, name)
+		}
+	}
+	r.Unlock()
+
+	resolved := map[string][]string{}
+	for _, name := range unresolved {
+		addresses, err := r.resolveName(name)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"package":   "supervisor",
+				"contextID": contextID,
+				"name":      name,
+				"error":     err.Error(),
+			}).Warn("Cannot resolve the domain name of the ACLs")
+		}
+		resolved[name] = addresses
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	for name, addresses := range resolved {
+		if _, ok := r.addresses[name]; !ok {
+			r.addresses[name] = addresses
+		}
+	}
+
+	addresses := map[string][]string{}
+	for _, name := range names {
+		addresses[name] = r.addresses[name]
+	}
+
+	r.pus[contextID] = &resolvedPU{
+		containerInfo: containerInfo,
+		names:         names,
+	}
+
+	return policy.PUInfoFromPolicyAndRuntime(containerInfo.ContextID, containerInfo.Policy.PolicyForAddresses(addresses), containerInfo.Runtime)
+}
+
+// forget stops following the names of a PU
+func (r *dnsResolver) forget(contextID string) {
+
+	r.Lock()
+	defer r.Unlock()
+
+	delete(r.pus, contextID)
+}
+
+// resolveName returns the sorted addresses of a name
+func (r *dnsResolver) resolveName(name string) ([]string, error) {
+
+	ips, err := r.lookup(name)
+	if err != nil {
+		return []string{}, err
+	}
+
+	addresses := []string{}
+	for _, ip := range ips {
+		addresses = append(addresses, ip.String())
+	}
+	sort.Strings(addresses)
+
+	return addresses, nil
+}
+
+// run refreshes the addresses at every interval until the resolver is stopped
+func (r *dnsResolver) run() {
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.refresh()
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// refresh resolves the names of the PUs again and updates the rules of the PUs
+// whose names changed of addresses. The names no PU uses anymore are forgotten.
+func (r *dnsResolver) refresh() {
+
+	r.Lock()
+	names := map[string]bool{}
+	for _, pu := range r.pus {
+		for _, name := range pu.names {
+			names[name] = true
+		}
+	}
+	r.Unlock()
+
+	changed := map[string][]string{}
+	for name := range names {
+		addresses, err := r.resolveName(name)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"package": "supervisor",
+				"name":    name,
+				"error":   err.Error(),
+			}).Debug("Cannot refresh the domain name of the ACLs")
+			continue
+		}
+		changed[name] = addresses
+	}
+
+	r.Lock()
+	for name := range r.addresses {
+		if !names[name] {
+			delete(r.addresses, name)
+		}
+	}
+
+	for name, addresses := range changed {
+		if sameAddresses(r.addresses[name], addresses) {
+			delete(changed, name)
+			continue
+		}
+		r.addresses[name] = addresses
+	}
+
+	updated := map[string]*policy.PUInfo{}
+	for contextID, pu := range r.pus {
+		for _, name := range pu.names {
+			if _, ok := changed[name]; ok {
+				updated[contextID] = pu.containerInfo
+				break
+			}
+		}
+	}
+	r.Unlock()
+
+	for contextID, containerInfo := range updated {
+		if err := r.update(contextID, containerInfo); err != nil {
+			log.WithFields(log.Fields{
+				"package":   "supervisor",
+				"contextID": contextID,
+				"error":     err.Error(),
+			}).Error("Failed to update the rules of the resolved domain names")
+		}
+	}
+}
+
+// sameAddresses returns true if both sorted lists hold the same addresses
+func sameAddresses(a, b []string) bool {
+
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
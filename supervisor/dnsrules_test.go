@@ -0,0 +1,124 @@
+package supervisor
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/policy"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fqdnPUInfo returns a PU whose application ACLs have a domain name
+func fqdnPUInfo(contextID string, name string) *policy.PUInfo {
+
+	appACLs := policy.NewIPRuleList([]policy.IPRule{
+		{Address: "10.1.1.0/24", Port: "80", Protocol: "tcp", Action: policy.Accept},
+		{Address: name, Port: "443", Protocol: "tcp", Action: policy.Accept},
+	})
+
+	p := policy.NewPUPolicy(contextID, policy.Police, appACLs, policy.NewIPRuleList(nil), nil, nil, nil, nil, nil, nil, nil)
+
+	return policy.PUInfoFromPolicyAndRuntime(contextID, p, policy.NewPURuntimeWithDefaults())
+}
+
+func TestDNSResolver(t *testing.T) {
+	Convey("Given a DNS resolver", t, func() {
+		records := map[string][]net.IP{
+			"api.example.com": {net.ParseIP("192.0.2.2"), net.ParseIP("192.0.2.1")},
+		}
+		lookups := 0
+
+		updates := map[string]*policy.PUInfo{}
+		r := newDNSResolver(func(contextID string, containerInfo *policy.PUInfo) error {
+			updates[contextID] = containerInfo
+			return nil
+		})
+		r.lookup = func(host string) ([]net.IP, error) {
+			lookups++
+			ips, ok := records[host]
+			if !ok {
+				return nil, fmt.Errorf("no such host")
+			}
+			return ips, nil
+		}
+
+		Convey("When I resolve a PU without domain names, it should be unchanged", func() {
+			containerInfo := policy.NewPUInfo("pu1", constants.ContainerPU)
+			So(r.resolve("pu1", containerInfo), ShouldEqual, containerInfo)
+			So(r.pus, ShouldBeEmpty)
+		})
+
+		Convey("When I resolve a PU with a domain name", func() {
+			containerInfo := fqdnPUInfo("pu1", "api.example.com")
+			resolved := r.resolve("pu1", containerInfo)
+
+			Convey("Then its rule should be replaced by the rules of the addresses", func() {
+				So(resolved.Policy.ApplicationACLs().Rules, ShouldResemble, []policy.IPRule{
+					{Address: "10.1.1.0/24", Port: "80", Protocol: "tcp", Action: policy.Accept},
+					{Address: "192.0.2.1", Port: "443", Protocol: "tcp", Action: policy.Accept},
+					{Address: "192.0.2.2", Port: "443", Protocol: "tcp", Action: policy.Accept},
+				})
+				So(containerInfo.Policy.ApplicationACLs().Rules[1].Address, ShouldEqual, "api.example.com")
+			})
+
+			Convey("Then the addresses of the name should be cached", func() {
+				r.resolve("pu2", fqdnPUInfo("pu2", "api.example.com"))
+				So(lookups, ShouldEqual, 1)
+			})
+
+			Convey("Then the PU should not be updated if the addresses did not change", func() {
+				records["api.example.com"] = []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2")}
+				r.refresh()
+				So(updates, ShouldBeEmpty)
+			})
+
+			Convey("Then the PU should be updated when the addresses change", func() {
+				records["api.example.com"] = []net.IP{net.ParseIP("192.0.2.3")}
+				r.refresh()
+
+				So(updates["pu1"], ShouldEqual, containerInfo)
+				So(r.resolve("pu1", containerInfo).Policy.ApplicationACLs().Rules[1].Address, ShouldEqual, "192.0.2.3")
+			})
+
+			Convey("Then the addresses should be kept if the name cannot be resolved", func() {
+				delete(records, "api.example.com")
+				r.refresh()
+
+				So(updates, ShouldBeEmpty)
+				So(r.addresses["api.example.com"], ShouldResemble, []string{"192.0.2.1", "192.0.2.2"})
+			})
+
+			Convey("Then the name should be forgotten once the PU is", func() {
+				r.forget("pu1")
+				r.refresh()
+
+				So(r.addresses, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When I resolve a PU whose domain name does not resolve, it should have no rule for the name", func() {
+			resolved := r.resolve("pu1", fqdnPUInfo("pu1", "unknown.example.com"))
+
+			So(len(resolved.Policy.ApplicationACLs().Rules), ShouldEqual, 1)
+			So(r.pus, ShouldContainKey, "pu1")
+		})
+	})
+}
+
+func TestIsDomainName(t *testing.T) {
+	Convey("Given addresses of rules", t, func() {
+		So(policy.IsDomainName("api.example.com"), ShouldBeTrue)
+		So(policy.IsDomainName("api.example.com."), ShouldBeTrue)
+		So(policy.IsDomainName("localhost"), ShouldBeTrue)
+		So(policy.IsDomainName("10.1.1.1"), ShouldBeFalse)
+		So(policy.IsDomainName("10.1.1.0/24"), ShouldBeFalse)
+		So(policy.IsDomainName("2001:db8::1"), ShouldBeFalse)
+		So(policy.IsDomainName("10.1"), ShouldBeFalse)
+		So(policy.IsDomainName("-bad.example.com"), ShouldBeFalse)
+		So(policy.IsDomainName("bad..example.com"), ShouldBeFalse)
+		So(policy.IsDomainName(""), ShouldBeFalse)
+	})
+}
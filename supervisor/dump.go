@@ -0,0 +1,43 @@
+package supervisor
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+
+	"github.com/aporeto-inc/trireme/supervisor/ipsetctrl"
+)
+
+// A RuleDumper writes the rules programmed by a supervisor, for the support bundles
+type RuleDumper interface {
+
+	// DumpRules writes the rules in the format of the tools that list them.
+	DumpRules(w io.Writer) error
+}
+
+// DumpRules implements the RuleDumper interface. It writes the output of iptables-save,
+// of ip6tables-save if IPv6 is enabled and, for the ipset implementation, the output
+// of ipset list.
+func (s *Config) DumpRules(w io.Writer) error {
+
+	commands := [][]string{{"iptables-save"}}
+	if s.ipv6 != nil {
+		commands = append(commands, []string{"ip6tables-save"})
+	}
+	if _, ok := s.impl.(*ipsetctrl.Instance); ok {
+		commands = append(commands, []string{"ipset", "list"})
+	}
+
+	for _, command := range commands {
+		out, err := exec.Command(command[0], command[1:]...).Output()
+		if err != nil {
+			return fmt.Errorf("Cannot dump the rules with %s: %s", command[0], err)
+		}
+
+		if _, err := w.Write(out); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,38 @@
+package supervisor
+
+import "fmt"
+
+// PolicyGroupsConfigurer is implemented by the supervisors that can share the rules
+// of the processing units with identical policies
+type PolicyGroupsConfigurer interface {
+
+	// EnablePolicyGroups shares the ACLs of the processing units with identical ACLs
+	// instead of programming them for each unit. It must be called before the
+	// processing units are supervised.
+	EnablePolicyGroups() error
+}
+
+// policyGrouper is implemented by the implementations that can share the ACLs of
+// the PUs
+type policyGrouper interface {
+
+	// EnablePolicyGroups shares the ACLs of the PUs configured after the call
+	EnablePolicyGroups() error
+}
+
+// EnablePolicyGroups implements the PolicyGroupsConfigurer interface
+func (s *Config) EnablePolicyGroups() error {
+
+	for _, f := range s.implementations() {
+		grouper, ok := f.impl.(policyGrouper)
+		if !ok {
+			return fmt.Errorf("Supervisor implementation does not support policy groups")
+		}
+
+		if err := grouper.EnablePolicyGroups(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -1,6 +1,10 @@
 package supervisor
 
-import "github.com/aporeto-inc/trireme/policy"
+import (
+	"github.com/aporeto-inc/trireme/policy"
+	"github.com/aporeto-inc/trireme/supervisor/ipsetctrl"
+	"github.com/aporeto-inc/trireme/supervisor/iptablesctrl"
+)
 
 // A Supervisor is implementing the node control plane that captures the packets.
 type Supervisor interface {
@@ -27,6 +31,79 @@ type Excluder interface {
 	AddExcludedIPs(ips []string) error
 }
 
+// ControllerProtector is implemented by the supervisors that keep the agent connected
+// to its controller whatever the policy of the processing units
+type ControllerProtector interface {
+
+	// SetControllerNetworks replaces the networks of the controller
+	SetControllerNetworks(networks []string) error
+}
+
+// MTLSRedirector is implemented by the supervisors that redirect the connections of
+// the mutual TLS data-plane mode to the enforcer
+type MTLSRedirector interface {
+
+	// SetMTLSRedirect redirects the connections of the processing units to the networks
+	// to the client port of the enforcer, and the connections of the peer enforcers to
+	// its server port. It must be called before Start.
+	SetMTLSRedirect(networks []string, clientPort, serverPort int) error
+}
+
+// IPv6Configurer is implemented by the supervisors that can enforce the policies of
+// the IPv6 addresses of the processing units
+type IPv6Configurer interface {
+
+	// EnableIPv6 programs the ip6tables rules of the processing units whose policy
+	// enables the IPv6 feature. It must be called before Start.
+	EnableIPv6() error
+}
+
+// FirewallProfileConfigurer is implemented by the supervisors that can co-exist with
+// the firewall manager of the host
+type FirewallProfileConfigurer interface {
+
+	// SetFirewallProfile anchors the rules as the profile of the firewall manager
+	// requires. It must be called before Start.
+	SetFirewallProfile(profile *iptablesctrl.Profile) error
+}
+
+// VerdictCacheReporter is implemented by the supervisors that cache the verdicts of
+// the datapath in the kernel
+type VerdictCacheReporter interface {
+
+	// VerdictCacheStats returns the statistics of the verdict cache
+	VerdictCacheStats() (*ipsetctrl.VerdictStats, error)
+}
+
+// verdictReporter is implemented by the implementations that cache the verdicts
+type verdictReporter interface {
+	VerdictStats() (*ipsetctrl.VerdictStats, error)
+}
+
+// markMasker is implemented by the implementations that can share the packet mark
+// with other tools
+type markMasker interface {
+
+	// SetMarkMask restricts the rules to the bits of the mask
+	SetMarkMask(mask uint32) error
+}
+
+// firewallProfiler is implemented by the implementations that support the profiles
+// of the firewall managers
+type firewallProfiler interface {
+
+	// SetProfile anchors the rules as the profile requires
+	SetProfile(profile *iptablesctrl.Profile) error
+}
+
+// queueDisabler is implemented by the implementations that can leave the packets
+// to a capture mechanism other than the netfilter queues
+type queueDisabler interface {
+
+	// DisableQueues stops sending the packets to the netfilter queues
+	DisableQueues()
+}
+
 // Implementor is the interface of the implementation based on iptables, ipsets, remote etc
 type Implementor interface {
 
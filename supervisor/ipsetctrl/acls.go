@@ -5,7 +5,7 @@ import (
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/aporeto-inc/trireme/policy"
-	"github.com/bvandewalle/go-ipset/ipset"
+	"github.com/aporeto-inc/trireme/utils/errortypes"
 )
 
 const (
@@ -13,24 +13,29 @@ const (
 	netChainPrefix = "TRIREME-Net-"
 	allowPrefix    = "A-"
 	rejectPrefix   = "R-"
+
+	// ipv6ChainPrefix prefixes the names of the IPv6 sets of the PUs
+	ipv6ChainPrefix = "6-"
 )
 
 // createACLSets creates the sets for a given PU
 func (i *Instance) createACLSets(version string, set string, rules *policy.IPRuleList) error {
 
-	allowSet, err := i.ips.NewIpset(set+allowPrefix+version, "hash:net,port", &ipset.Params{})
+	allowSet, err := i.ips.NewIpset(set+allowPrefix+version, "hash:net,port", i.params())
 	if err != nil {
-		return fmt.Errorf("Couldn't create IPSet for Trireme: %s", err.Error())
+		return errortypes.Errorf(errortypes.ErrRuleProgramming, "Couldn't create IPSet for Trireme: %s", err.Error())
 	}
 
-	rejectSet, err := i.ips.NewIpset(set+rejectPrefix+version, "hash:net,port", &ipset.Params{})
+	rejectSet, err := i.ips.NewIpset(set+rejectPrefix+version, "hash:net,port", i.params())
 	if err != nil {
-		return fmt.Errorf("Couldn't create IPSet for Trireme: %s", err.Error())
+		return errortypes.Errorf(errortypes.ErrRuleProgramming, "Couldn't create IPSet for Trireme: %s", err.Error())
 	}
 
 	for _, rule := range rules.Rules {
 		var err error
-		switch rule.Action {
+		// The rejected flows are dropped, resets and mirroring are not supported with
+		// the sets
+		switch rule.Action &^ (policy.Reset | policy.Mirror) {
 		case policy.Accept:
 			err = allowSet.Add(rule.Address+","+rule.Port, 0)
 		case policy.Reject:
@@ -39,7 +44,7 @@ func (i *Instance) createACLSets(version string, set string, rules *policy.IPRul
 			continue
 		}
 		if err != nil {
-			return fmt.Errorf("Couldn't create IPSet for Trireme: %s", err.Error())
+			return errortypes.Errorf(errortypes.ErrRuleProgramming, "Couldn't create IPSet for Trireme: %s", err.Error())
 		}
 	}
 
@@ -190,9 +195,9 @@ func (i *Instance) deleteNetSetRules(version, setPrefix, ip string) error {
 }
 
 func (i *Instance) deleteSet(set string) error {
-	ipSet, err := i.ips.NewIpset(set, "hash:net,port", &ipset.Params{})
+	ipSet, err := i.ips.NewIpset(set, "hash:net,port", i.params())
 	if err != nil {
-		return fmt.Errorf("Couldn't create IPSet for Trireme: %s", err)
+		return errortypes.Errorf(errortypes.ErrRuleProgramming, "Couldn't create IPSet for Trireme: %s", err)
 	}
 
 	ipSet.Destroy()
@@ -202,24 +207,24 @@ func (i *Instance) deleteSet(set string) error {
 // setupIpset sets up an ipset
 func (i *Instance) setupIpset(target, container string) error {
 
-	ips, err := i.ips.NewIpset(target, "hash:net", &ipset.Params{})
+	ips, err := i.ips.NewIpset(target, "hash:net", i.params())
 	if err != nil {
 		log.WithFields(log.Fields{
 			"package": "supervisor",
 			"error":   err.Error(),
 		}).Debug("Error creating NewIPSet")
-		return fmt.Errorf("Couldn't create IPSet for %s: %s", target, err)
+		return errortypes.Errorf(errortypes.ErrRuleProgramming, "Couldn't create IPSet for %s: %s", target, err)
 	}
 
 	i.targetSet = ips
 
-	cSet, err := i.ips.NewIpset(container, "hash:ip", &ipset.Params{})
+	cSet, err := i.ips.NewIpset(container, "hash:ip", i.params())
 	if err != nil {
 		log.WithFields(log.Fields{
 			"package": "supervisor",
 			"error":   err.Error(),
 		}).Debug("Error creating NewIPSet")
-		return fmt.Errorf("Failed to create container set")
+		return errortypes.Errorf(errortypes.ErrRuleProgramming, "Failed to create container set")
 	}
 
 	i.containerSet = cSet
@@ -240,7 +245,7 @@ func (i *Instance) addTargetNets(networks []string) error {
 				"package": "supervisor",
 				"error":   err.Error(),
 			}).Debug("Error adding ip to IPSet")
-			return fmt.Errorf("Error adding ip %s to target networks IPSet: %s", net, err)
+			return errortypes.Errorf(errortypes.ErrRuleProgramming, "Error adding ip %s to target networks IPSet: %s", net, err)
 		}
 	}
 	return nil
@@ -257,7 +262,7 @@ func (i *Instance) addContainerToSet(ip string) error {
 			"package": "supervisor",
 			"error":   err.Error(),
 		}).Debug("Error adding container to set ")
-		return fmt.Errorf("Error adding ip %s to container set : %s", ip, err)
+		return errortypes.Errorf(errortypes.ErrRuleProgramming, "Error adding ip %s to container set : %s", ip, err)
 	}
 	return nil
 }
@@ -273,7 +278,7 @@ func (i *Instance) delContainerFromSet(ip string) error {
 			"package": "supervisor",
 			"error":   err.Error(),
 		}).Debug("Error adding container to set ")
-		return fmt.Errorf("Error adding ip %s to container set : %s", ip, err)
+		return errortypes.Errorf(errortypes.ErrRuleProgramming, "Error adding ip %s to container set : %s", ip, err)
 	}
 	return nil
 }
@@ -305,7 +310,7 @@ func (i *Instance) setupTrapRules(set string) error {
 		{
 			i.appPacketIPTableContext, i.appPacketIPTableSection,
 			"-m", "set", "--match-set", set, "dst",
-			"-m", "set", "--match-set", containerSet, "src",
+			"-m", "set", "--match-set", i.containerSetName, "src",
 			"-p", "tcp", "--tcp-flags", "FIN,SYN,RST,PSH,URG", "SYN",
 			"-j", "NFQUEUE", "--queue-balance", i.applicationQueues,
 		},
@@ -313,7 +318,7 @@ func (i *Instance) setupTrapRules(set string) error {
 		// Application Matching Trireme SRC and DST. Established connections.
 		{
 			i.appAckPacketIPTableContext, i.appPacketIPTableSection,
-			"-m", "set", "--match-set", containerSet, "src",
+			"-m", "set", "--match-set", i.containerSetName, "src",
 			"-m", "set", "--match-set", set, "dst",
 			"-p", "tcp", "--tcp-flags", "FIN,SYN,RST,PSH,URG", "SYN",
 			"-j", "ACCEPT",
@@ -322,7 +327,7 @@ func (i *Instance) setupTrapRules(set string) error {
 		// Application Matching Trireme SRC and DST. SYN, SYNACK connections.
 		{
 			i.appAckPacketIPTableContext, i.appPacketIPTableSection,
-			"-m", "set", "--match-set", containerSet, "src",
+			"-m", "set", "--match-set", i.containerSetName, "src",
 			"-m", "set", "--match-set", set, "dst",
 			"-p", "tcp", "--tcp-flags", "SYN,ACK", "ACK",
 			"-m", "connbytes", "--connbytes", ":3", "--connbytes-dir", "original", "--connbytes-mode", "packets",
@@ -332,7 +337,7 @@ func (i *Instance) setupTrapRules(set string) error {
 		// Default Drop from Trireme to Network
 		{
 			i.appAckPacketIPTableContext, i.appPacketIPTableSection,
-			"-m", "set", "--match-set", containerSet, "src",
+			"-m", "set", "--match-set", i.containerSetName, "src",
 			"-p", "tcp", "-m", "state", "--state", "NEW",
 			"-j", "DROP",
 		},
@@ -341,7 +346,7 @@ func (i *Instance) setupTrapRules(set string) error {
 		{
 			i.netPacketIPTableContext, i.netPacketIPTableSection,
 			"-m", "set", "--match-set", set, "src",
-			"-m", "set", "--match-set", containerSet, "dst",
+			"-m", "set", "--match-set", i.containerSetName, "dst",
 			"-p", "tcp",
 			"-m", "connbytes", "--connbytes", ":3", "--connbytes-dir", "original", "--connbytes-mode", "packets",
 			"-j", "NFQUEUE", "--queue-balance", i.networkQueues,
@@ -350,7 +355,7 @@ func (i *Instance) setupTrapRules(set string) error {
 		// Default Drop from Network to Trireme.
 		{
 			i.netPacketIPTableContext, i.netPacketIPTableSection,
-			"-m", "set", "--match-set", containerSet, "dst",
+			"-m", "set", "--match-set", i.containerSetName, "dst",
 			"-p", "tcp", "-m", "state", "--state", "NEW",
 			"-j", "DROP",
 		},
@@ -369,7 +374,8 @@ func (i *Instance) setupTrapRules(set string) error {
 	return nil
 }
 
-// cleanIPSets cleans all the ipsets
+// cleanIPSets cleans all the ipsets. The sets still referenced by the rules of the
+// other family are not destroyed, so the IPv6 instance is stopped first.
 func (i *Instance) cleanIPSets() error {
 
 	i.ipt.ClearChain(i.appPacketIPTableContext, i.appPacketIPTableSection)
@@ -3,11 +3,13 @@ package ipsetctrl
 import (
 	"fmt"
 	"strconv"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/aporeto-inc/trireme/constants"
 	"github.com/aporeto-inc/trireme/policy"
 	"github.com/aporeto-inc/trireme/supervisor/provider"
+	"github.com/bvandewalle/go-ipset/ipset"
 )
 
 const (
@@ -30,6 +32,18 @@ type Instance struct {
 	netPacketIPTableContext    string
 	netPacketIPTableSection    string
 	mode                       constants.ModeType
+	targetSetName              string
+	containerSetName           string
+	appSetPrefix               string
+	netSetPrefix               string
+	hashFamily                 string
+	anyNetwork                 string
+
+	// verdicts caches the verdicts of the datapath for verdictTimeout, if set
+	verdicts       provider.Ipset
+	verdictTimeout time.Duration
+	verdictStats   VerdictStats
+	listRules      func(table, chain string) ([]byte, error)
 }
 
 // NewInstance creates a new iptables controller instance
@@ -52,6 +66,11 @@ func NewInstance(networkQueues, applicationQueues string, mark int, remote bool,
 		appAckPacketIPTableContext: "mangle",
 		netPacketIPTableContext:    "mangle",
 		mode: mode,
+		targetSetName:    triremeSet,
+		containerSetName: containerSet,
+		appSetPrefix:     appChainPrefix,
+		netSetPrefix:     netChainPrefix,
+		anyNetwork:       "0.0.0.0/0",
 	}
 
 	if remote {
@@ -65,6 +84,32 @@ func NewInstance(networkQueues, applicationQueues string, mark int, remote bool,
 	return i, nil
 }
 
+// IPv6Instance returns an instance programming the ip6tables rules and the IPv6
+// ipsets of the IPv6 addresses with the configuration of the instance. The sets have
+// their own names, since the sets of both families share the same namespace.
+func (i *Instance) IPv6Instance() (*Instance, error) {
+
+	if i.verdictTimeout > 0 {
+		return nil, fmt.Errorf("The verdict cache does not support IPv6")
+	}
+
+	ipt, err := provider.NewGoIP6TablesProvider()
+	if err != nil {
+		return nil, fmt.Errorf("Cannot initialize IP6tables provider")
+	}
+
+	i6 := *i
+	i6.ipt = ipt
+	i6.targetSetName = triremeSet + "6"
+	i6.containerSetName = containerSet + "6"
+	i6.appSetPrefix = ipv6ChainPrefix + appChainPrefix
+	i6.netSetPrefix = ipv6ChainPrefix + netChainPrefix
+	i6.hashFamily = "inet6"
+	i6.anyNetwork = "::/0"
+
+	return &i6, nil
+}
+
 // DefaultIPAddress returns the default IP address for the processing unit
 func (i *Instance) defaultIP(addresslist map[string]string) (string, bool) {
 
@@ -72,16 +117,38 @@ func (i *Instance) defaultIP(addresslist map[string]string) (string, bool) {
 		return ip, true
 	}
 
-	return "0.0.0.0/0", false
+	return i.anyNetwork, false
+}
+
+// addresses returns the default address of the processing unit followed by the ones
+// of its additional networks. The sets of the ACLs are shared by all the addresses.
+func (i *Instance) addresses(addresslist *policy.IPMap) ([]string, bool) {
+
+	ips := []string{}
+	if ip, ok := i.defaultIP(addresslist.IPs); ok {
+		ips = append(ips, ip)
+	}
+
+	for _, network := range addresslist.AdditionalNetworks() {
+		ips = append(ips, addresslist.IPs[network])
+	}
+
+	return ips, len(ips) > 0
 }
 
 // chainPrefix returns the chain name for the specific PU
 func (i *Instance) setPrefix(contextID string) (app, net string) {
-	app = appChainPrefix + contextID + "-"
-	net = netChainPrefix + contextID + "-"
+	app = i.appSetPrefix + contextID + "-"
+	net = i.netSetPrefix + contextID + "-"
 	return app, net
 }
 
+// params returns the parameters of the sets of the family of the instance
+func (i *Instance) params() *ipset.Params {
+
+	return &ipset.Params{HashFamily: i.hashFamily}
+}
+
 // ConfigureRules implmenets the ConfigureRules interface
 func (i *Instance) ConfigureRules(version int, contextID string, containerInfo *policy.PUInfo) error {
 
@@ -96,13 +163,12 @@ func (i *Instance) ConfigureRules(version int, contextID string, containerInfo *
 		return fmt.Errorf("No policy rules provided -nil ")
 	}
 
-	// Currently processing only containers with one IP address
-	ipAddress, ok := i.defaultIP(policyrules.IPAddresses().IPs)
+	ipAddresses, ok := i.addresses(policyrules.IPAddresses())
 	if !ok {
 		return fmt.Errorf("No ip address found")
 	}
 
-	if err := i.addAllRules(version, appSetPrefix, netSetPrefix, policyrules.ApplicationACLs(), policyrules.NetworkACLs(), ipAddress); err != nil {
+	if err := i.addAllRules(version, appSetPrefix, netSetPrefix, policyrules.ApplicationACLs(), policyrules.NetworkACLs(), ipAddresses); err != nil {
 		return err
 	}
 
@@ -118,16 +184,17 @@ func (i *Instance) DeleteRules(version int, contextID string, ipAddresses *polic
 
 	appSetPrefix, netSetPrefix := i.setPrefix(contextID)
 
-	// Currently processing only containers with one IP address
-	ipAddress, ok := i.defaultIP(ipAddresses.IPs)
+	ips, ok := i.addresses(ipAddresses)
 	if !ok {
 		return fmt.Errorf("No ip address found")
 	}
 
-	i.delContainerFromSet(ipAddress)
+	for _, ipAddress := range ips {
+		i.delContainerFromSet(ipAddress)
 
-	i.deleteAppSetRules(strconv.Itoa(version), appSetPrefix, ipAddress)
-	i.deleteNetSetRules(strconv.Itoa(version), netSetPrefix, ipAddress)
+		i.deleteAppSetRules(strconv.Itoa(version), appSetPrefix, ipAddress)
+		i.deleteNetSetRules(strconv.Itoa(version), netSetPrefix, ipAddress)
+	}
 
 	i.deleteSet(appSetPrefix + allowPrefix + strconv.Itoa(version))
 	i.deleteSet(appSetPrefix + rejectPrefix + strconv.Itoa(version))
@@ -143,20 +210,21 @@ func (i *Instance) UpdateRules(version int, contextID string, containerInfo *pol
 	policyrules := containerInfo.Policy
 	appSetPrefix, netSetPrefix := i.setPrefix(contextID)
 
-	// Currently processing only containers with one IP address
-	ipAddress, ok := i.defaultIP(policyrules.IPAddresses().IPs)
+	ipAddresses, ok := i.addresses(policyrules.IPAddresses())
 	if !ok {
 		return fmt.Errorf("No ip address found")
 	}
 
-	if err := i.addAllRules(version, appSetPrefix, netSetPrefix, policyrules.ApplicationACLs(), policyrules.NetworkACLs(), ipAddress); err != nil {
+	if err := i.addAllRules(version, appSetPrefix, netSetPrefix, policyrules.ApplicationACLs(), policyrules.NetworkACLs(), ipAddresses); err != nil {
 		return err
 	}
 
 	previousVersion := strconv.Itoa(version - 1)
 
-	i.deleteAppSetRules(previousVersion, appSetPrefix, ipAddress)
-	i.deleteNetSetRules(previousVersion, netSetPrefix, ipAddress)
+	for _, ipAddress := range ipAddresses {
+		i.deleteAppSetRules(previousVersion, appSetPrefix, ipAddress)
+		i.deleteNetSetRules(previousVersion, netSetPrefix, ipAddress)
+	}
 
 	i.deleteSet(appSetPrefix + allowPrefix + previousVersion)
 	i.deleteSet(appSetPrefix + rejectPrefix + previousVersion)
@@ -167,12 +235,14 @@ func (i *Instance) UpdateRules(version int, contextID string, containerInfo *pol
 
 }
 
-func (i *Instance) addAllRules(version int, appSetPrefix, netSetPrefix string, appACLs *policy.IPRuleList, netACLs *policy.IPRuleList, ip string) error {
+func (i *Instance) addAllRules(version int, appSetPrefix, netSetPrefix string, appACLs *policy.IPRuleList, netACLs *policy.IPRuleList, ips []string) error {
 
 	versionstring := strconv.Itoa(version)
 
-	if err := i.addContainerToSet(ip); err != nil {
-		return err
+	for _, ip := range ips {
+		if err := i.addContainerToSet(ip); err != nil {
+			return err
+		}
 	}
 
 	if err := i.createACLSets(versionstring, appSetPrefix, appACLs); err != nil {
@@ -183,12 +253,14 @@ func (i *Instance) addAllRules(version int, appSetPrefix, netSetPrefix string, a
 		return err
 	}
 
-	if err := i.addAppSetRules(versionstring, appSetPrefix, ip); err != nil {
-		return err
-	}
+	for _, ip := range ips {
+		if err := i.addAppSetRules(versionstring, appSetPrefix, ip); err != nil {
+			return err
+		}
 
-	if err := i.addNetSetRules(versionstring, netSetPrefix, ip); err != nil {
-		return err
+		if err := i.addNetSetRules(versionstring, netSetPrefix, ip); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -196,13 +268,18 @@ func (i *Instance) addAllRules(version int, appSetPrefix, netSetPrefix string, a
 // Start implements the start of the interface
 func (i *Instance) Start() error {
 
-	if err := i.setupIpset(triremeSet, containerSet); err != nil {
+	if err := i.setupIpset(i.targetSetName, i.containerSetName); err != nil {
 		return err
 	}
 
-	if err := i.setupTrapRules(triremeSet); err != nil {
+	if err := i.setupTrapRules(i.targetSetName); err != nil {
 		return err
 	}
+
+	if i.verdictTimeout > 0 {
+		return i.setupVerdictCache()
+	}
+
 	return nil
 }
 
@@ -3,6 +3,7 @@ package ipsetctrl
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/aporeto-inc/trireme/constants"
 	"github.com/aporeto-inc/trireme/policy"
@@ -76,6 +77,33 @@ func TestDefaultIP(t *testing.T) {
 	})
 }
 
+func TestAddresses(t *testing.T) {
+	Convey("Given an iptables controller", t, func() {
+		i, _ := NewInstance("0:1", "2:3", 0x1000, true, constants.LocalContainer)
+		Convey("When I get the addresses of a list with additional networks", func() {
+			addresslist := policy.NewIPMap(map[string]string{
+				"net2":                  "10.3.1.1",
+				policy.DefaultNamespace: "10.1.1.1",
+				"net1":                  "10.2.1.1",
+			})
+			addresses, status := i.addresses(addresslist)
+
+			Convey("I should get the default IP followed by the other ones", func() {
+				So(addresses, ShouldResemble, []string{"10.1.1.1", "10.2.1.1", "10.3.1.1"})
+				So(status, ShouldBeTrue)
+			})
+		})
+
+		Convey("When I provide an empty list", func() {
+			_, status := i.addresses(policy.NewIPMap(nil))
+
+			Convey("I should get a false status", func() {
+				So(status, ShouldBeFalse)
+			})
+		})
+	})
+}
+
 func TestSetPrefix(t *testing.T) {
 	Convey("When I test the creation of the name of the chain", t, func() {
 		i, _ := NewInstance("0:1", "2:3", 0x1000, true, constants.LocalContainer)
@@ -89,6 +117,70 @@ func TestSetPrefix(t *testing.T) {
 	})
 }
 
+func TestIPv6Instance(t *testing.T) {
+	Convey("Given an ipsets controller", t, func() {
+		i, _ := NewInstance("0:1", "2:3", 0x1000, true, constants.LocalContainer)
+
+		Convey("When I create its IPv6 instance", func() {
+			i6, err := i.IPv6Instance()
+
+			Convey("It should use the IPv6 sets", func() {
+				So(err, ShouldBeNil)
+				So(i6.targetSetName, ShouldEqual, "TriremeSet6")
+				So(i6.containerSetName, ShouldEqual, "ContainerSet6")
+				So(i.targetSetName, ShouldEqual, "TriremeSet")
+
+				app, net := i6.setPrefix("Context")
+				So(app, ShouldResemble, "6-TRIREME-App-Context-")
+				So(net, ShouldResemble, "6-TRIREME-Net-Context-")
+
+				address, status := i6.defaultIP(map[string]string{})
+				So(address, ShouldResemble, "::/0")
+				So(status, ShouldBeFalse)
+			})
+
+			Convey("When I start it", func() {
+				iptables := provider.NewTestIptablesProvider()
+				ipsets := provider.NewTestIpsetProvider()
+				i6.ipt = iptables
+				i6.ips = ipsets
+
+				families := map[string]string{}
+				ipsets.MockNewIpset(t, func(name string, hasht string, p *ipset.Params) (provider.Ipset, error) {
+					families[name] = p.HashFamily
+					testset := provider.NewTestIpset()
+					testset.MockAdd(t, func(entry string, timeout int) error {
+						return nil
+					})
+					return testset, nil
+				})
+				iptables.MockInsert(t, func(table string, chain string, pos int, rulespec ...string) error {
+					return nil
+				})
+				iptables.MockAppend(t, func(table string, chain string, rulespec ...string) error {
+					return nil
+				})
+
+				err := i6.Start()
+
+				Convey("It should create the IPv6 sets", func() {
+					So(err, ShouldBeNil)
+					So(families, ShouldResemble, map[string]string{"TriremeSet6": "inet6", "ContainerSet6": "inet6"})
+				})
+			})
+		})
+
+		Convey("When I create the IPv6 instance of a verdict cache", func() {
+			vc, _ := NewVerdictCacheInstance("0:1", "2:3", 0x1000, constants.LocalContainer, time.Minute)
+			_, err := vc.IPv6Instance()
+
+			Convey("It should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
 func TestConfigureRules(t *testing.T) {
 	Convey("Given an ipset controller properly configured", t, func() {
 
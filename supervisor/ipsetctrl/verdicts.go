@@ -0,0 +1,206 @@
+package ipsetctrl
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/utils/errortypes"
+	"github.com/bvandewalle/go-ipset/ipset"
+)
+
+const (
+	// verdictSet caches the accepted flows as client address, server port and server
+	// address
+	verdictSet = "TriremeVerdicts"
+	// DefaultVerdictTimeout is the time after which a cached verdict expires. The
+	// flows of the expired verdicts are accepted by the connection tracking.
+	DefaultVerdictTimeout = time.Minute
+)
+
+// VerdictStats are the statistics of the verdict cache
+type VerdictStats struct {
+	// Cached is the number of verdicts cached by the datapath
+	Cached uint64
+	// Failed is the number of verdicts that could not be cached
+	Failed uint64
+	// Evicted is the number of verdicts removed before their expiration
+	Evicted uint64
+	// Hits is the number of packets accepted by the cached verdicts
+	Hits uint64
+}
+
+// NewVerdictCacheInstance creates a new ipset controller instance caching the
+// verdicts of the datapath for the given timeout
+func NewVerdictCacheInstance(networkQueues, applicationQueues string, mark int, mode constants.ModeType, timeout time.Duration) (*Instance, error) {
+
+	if timeout < time.Second {
+		return nil, fmt.Errorf("Invalid verdict timeout %s", timeout)
+	}
+
+	i, err := NewInstance(networkQueues, applicationQueues, mark, false, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	i.verdictTimeout = timeout
+	i.listRules = func(table, chain string) ([]byte, error) {
+		return exec.Command("iptables", "-t", table, "-L", chain, "-n", "-v", "-x").CombinedOutput()
+	}
+
+	return i, nil
+}
+
+// verdictRules returns the rules accepting the packets of the cached flows in both
+// directions. The Syn packets are always queued, so that the new flows are authorized
+// by the datapath.
+func (i *Instance) verdictRules() [][]string {
+
+	rules := [][]string{}
+
+	for _, chain := range [][]string{
+		{i.appAckPacketIPTableContext, i.appPacketIPTableSection},
+		{i.netPacketIPTableContext, i.netPacketIPTableSection},
+	} {
+		for _, flags := range []string{"src,dst,dst", "dst,src,src"} {
+			rules = append(rules, []string{
+				chain[0], chain[1],
+				"-p", "tcp", "--tcp-flags", "SYN", "NONE",
+				"-m", "set", "--match-set", verdictSet, flags,
+				"-j", "ACCEPT",
+			})
+		}
+	}
+
+	return rules
+}
+
+// setupVerdictCache creates the verdict set and the rules accepting its flows before
+// the trap rules
+func (i *Instance) setupVerdictCache() error {
+
+	set, err := i.ips.NewIpset(verdictSet, "hash:ip,port,ip", &ipset.Params{Timeout: int(i.verdictTimeout.Seconds())})
+	if err != nil {
+		return errortypes.Errorf(errortypes.ErrRuleProgramming, "Couldn't create the verdict set: %s", err)
+	}
+
+	i.verdicts = set
+
+	for _, rule := range i.verdictRules() {
+		if err := i.ipt.Insert(rule[0], rule[1], 1, rule[2:]...); err != nil {
+			log.WithFields(log.Fields{
+				"package": "supervisor",
+				"error":   err.Error(),
+			}).Debug("Failed to add the rules of the verdict cache")
+			return err
+		}
+	}
+
+	return nil
+}
+
+// verdictEntry returns the entry of a flow in the verdict set
+func verdictEntry(source, destination net.IP, port uint16) string {
+
+	return source.String() + ",tcp:" + strconv.Itoa(int(port)) + "," + destination.String()
+}
+
+// CacheVerdict implements the enforcer.VerdictCache interface
+func (i *Instance) CacheVerdict(source, destination net.IP, port uint16) error {
+
+	if i.verdicts == nil {
+		return fmt.Errorf("Verdict cache not configured")
+	}
+
+	if err := i.verdicts.Add(verdictEntry(source, destination, port), int(i.verdictTimeout.Seconds())); err != nil {
+		atomic.AddUint64(&i.verdictStats.Failed, 1)
+		return errortypes.Errorf(errortypes.ErrRuleProgramming, "Cannot cache the verdict of %s: %s", verdictEntry(source, destination, port), err)
+	}
+
+	atomic.AddUint64(&i.verdictStats.Cached, 1)
+
+	return nil
+}
+
+// EvictVerdict implements the enforcer.VerdictCache interface
+func (i *Instance) EvictVerdict(source, destination net.IP, port uint16) error {
+
+	if i.verdicts == nil {
+		return fmt.Errorf("Verdict cache not configured")
+	}
+
+	if err := i.verdicts.Del(verdictEntry(source, destination, port)); err != nil {
+		// The verdict expired already
+		if ok, terr := i.verdicts.Test(verdictEntry(source, destination, port)); terr == nil && !ok {
+			return nil
+		}
+		return errortypes.Errorf(errortypes.ErrRuleProgramming, "Cannot evict the verdict of %s: %s", verdictEntry(source, destination, port), err)
+	}
+
+	atomic.AddUint64(&i.verdictStats.Evicted, 1)
+
+	return nil
+}
+
+// VerdictStats returns the statistics of the verdict cache. The hits are the
+// counters of the rules accepting the cached flows.
+func (i *Instance) VerdictStats() (*VerdictStats, error) {
+
+	if i.verdicts == nil {
+		return nil, fmt.Errorf("Verdict cache not configured")
+	}
+
+	stats := &VerdictStats{
+		Cached:  atomic.LoadUint64(&i.verdictStats.Cached),
+		Failed:  atomic.LoadUint64(&i.verdictStats.Failed),
+		Evicted: atomic.LoadUint64(&i.verdictStats.Evicted),
+	}
+
+	for _, chain := range [][]string{
+		{i.appAckPacketIPTableContext, i.appPacketIPTableSection},
+		{i.netPacketIPTableContext, i.netPacketIPTableSection},
+	} {
+		out, err := i.listRules(chain[0], chain[1])
+		if err != nil {
+			return nil, fmt.Errorf("Cannot read the counters of %s %s: %s", chain[0], chain[1], err)
+		}
+
+		stats.Hits += verdictHits(out)
+	}
+
+	return stats, nil
+}
+
+// verdictHits returns the sum of the packet counters of the rules of the verdict set
+// in a verbose iptables listing
+func verdictHits(listing []byte) uint64 {
+
+	hits := uint64(0)
+
+	scanner := bufio.NewScanner(bytes.NewReader(listing))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.Contains(line, "match-set "+verdictSet+" ") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if packets, err := strconv.ParseUint(fields[0], 10, 64); err == nil {
+			hits += packets
+		}
+	}
+
+	return hits
+}
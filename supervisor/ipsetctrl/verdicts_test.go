@@ -0,0 +1,154 @@
+package ipsetctrl
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/supervisor/provider"
+	"github.com/bvandewalle/go-ipset/ipset"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const verdictListing = `Chain PREROUTING (policy ACCEPT 0 packets, 0 bytes)
+    pkts      bytes target     prot opt in     out     source               destination
+      12     1400 ACCEPT     tcp  --  *      *       0.0.0.0/0            0.0.0.0/0            tcp flags:0x02/0x00 match-set TriremeVerdicts src,dst,dst
+       3      180 ACCEPT     tcp  --  *      *       0.0.0.0/0            0.0.0.0/0            tcp flags:0x02/0x00 match-set TriremeVerdicts dst,src,src
+      40     2400 NFQUEUE    tcp  --  *      *       0.0.0.0/0            0.0.0.0/0            match-set TriremeNet dst mark match 0x1000 NFQUEUE balance 0:1
+`
+
+func TestNewVerdictCacheInstance(t *testing.T) {
+	Convey("When I create a verdict cache instance", t, func() {
+
+		Convey("If the timeout is too short, it should fail", func() {
+			i, err := NewVerdictCacheInstance("0:1", "2:3", 0x1000, constants.LocalContainer, time.Millisecond)
+			So(err, ShouldNotBeNil)
+			So(i, ShouldBeNil)
+		})
+
+		Convey("If the timeout is valid, it should succeed", func() {
+			i, err := NewVerdictCacheInstance("0:1", "2:3", 0x1000, constants.LocalContainer, DefaultVerdictTimeout)
+			So(err, ShouldBeNil)
+			So(i.verdictTimeout, ShouldEqual, DefaultVerdictTimeout)
+			So(i.appPacketIPTableSection, ShouldResemble, "PREROUTING")
+		})
+	})
+}
+
+func TestVerdictCache(t *testing.T) {
+	Convey("Given a verdict cache instance", t, func() {
+
+		i, _ := NewVerdictCacheInstance("0:1", "2:3", 0x1000, constants.LocalContainer, DefaultVerdictTimeout)
+		iptables := provider.NewTestIptablesProvider()
+		i.ipt = iptables
+		ipsets := provider.NewTestIpsetProvider()
+		i.ips = ipsets
+
+		entries := map[string]int{}
+		set := provider.NewTestIpset()
+		set.MockAdd(t, func(entry string, timeout int) error {
+			entries[entry] = timeout
+			return nil
+		})
+		set.MockDel(t, func(entry string) error {
+			if _, ok := entries[entry]; !ok {
+				return fmt.Errorf("Element not found")
+			}
+			delete(entries, entry)
+			return nil
+		})
+		set.MockTest(t, func(entry string) (bool, error) {
+			_, ok := entries[entry]
+			return ok, nil
+		})
+
+		Convey("When the cache is not set up, caching should fail", func() {
+			So(i.CacheVerdict(net.ParseIP("10.1.1.1"), net.ParseIP("10.2.2.2"), 80), ShouldNotBeNil)
+		})
+
+		Convey("When I set up the cache", func() {
+			var params *ipset.Params
+			ipsets.MockNewIpset(t, func(name string, hasht string, p *ipset.Params) (provider.Ipset, error) {
+				if name != verdictSet || hasht != "hash:ip,port,ip" {
+					return nil, fmt.Errorf("Unexpected set %s %s", name, hasht)
+				}
+				params = p
+				return set, nil
+			})
+
+			rules := [][]string{}
+			iptables.MockInsert(t, func(table string, chain string, pos int, rulespec ...string) error {
+				if pos != 1 {
+					return fmt.Errorf("Unexpected position %d", pos)
+				}
+				rules = append(rules, append([]string{table, chain}, rulespec...))
+				return nil
+			})
+
+			err := i.setupVerdictCache()
+
+			Convey("The set and the rules should be created", func() {
+				So(err, ShouldBeNil)
+				So(params.Timeout, ShouldEqual, 60)
+				So(rules, ShouldResemble, i.verdictRules())
+				So(len(rules), ShouldEqual, 4)
+				So(rules[0], ShouldContain, "src,dst,dst")
+				So(rules[1], ShouldContain, "dst,src,src")
+			})
+
+			Convey("When I cache and evict verdicts", func() {
+				So(i.CacheVerdict(net.ParseIP("10.1.1.1"), net.ParseIP("10.2.2.2"), 80), ShouldBeNil)
+				So(i.CacheVerdict(net.ParseIP("10.1.1.3"), net.ParseIP("10.2.2.2"), 443), ShouldBeNil)
+
+				So(entries, ShouldResemble, map[string]int{
+					"10.1.1.1,tcp:80,10.2.2.2":  60,
+					"10.1.1.3,tcp:443,10.2.2.2": 60,
+				})
+
+				So(i.EvictVerdict(net.ParseIP("10.1.1.1"), net.ParseIP("10.2.2.2"), 80), ShouldBeNil)
+				// An expired verdict is not an error
+				So(i.EvictVerdict(net.ParseIP("10.1.1.1"), net.ParseIP("10.2.2.2"), 80), ShouldBeNil)
+
+				set.MockAdd(t, func(entry string, timeout int) error {
+					return fmt.Errorf("Set is full")
+				})
+				So(i.CacheVerdict(net.ParseIP("10.1.1.4"), net.ParseIP("10.2.2.2"), 80), ShouldNotBeNil)
+
+				i.listRules = func(table, chain string) ([]byte, error) {
+					return []byte(verdictListing), nil
+				}
+
+				stats, err := i.VerdictStats()
+
+				Convey("The statistics should account for them", func() {
+					So(err, ShouldBeNil)
+					So(stats, ShouldResemble, &VerdictStats{
+						Cached:  2,
+						Failed:  1,
+						Evicted: 1,
+						Hits:    30,
+					})
+				})
+			})
+
+			Convey("When the counters cannot be read, the statistics should fail", func() {
+				i.listRules = func(table, chain string) ([]byte, error) {
+					return nil, fmt.Errorf("iptables failed")
+				}
+
+				_, err := i.VerdictStats()
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the set cannot be created, the setup should fail", func() {
+			ipsets.MockNewIpset(t, func(name string, hasht string, p *ipset.Params) (provider.Ipset, error) {
+				return nil, fmt.Errorf("Error")
+			})
+
+			So(i.setupVerdictCache(), ShouldNotBeNil)
+		})
+	})
+}
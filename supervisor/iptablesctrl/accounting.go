@@ -0,0 +1,182 @@
+package iptablesctrl
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/policy"
+)
+
+const (
+	// accountingComment is the comment of the rules counting all the packets of the
+	// chains of a PU
+	accountingComment = "Trireme bandwidth"
+	// aclCommentPrefix is the prefix of the comments identifying the ACLs of a PU
+	aclCommentPrefix = "Trireme acl "
+)
+
+// EnableAccounting counts the traffic of the PUs configured after the call, in
+// total and for each of their ACLs
+func (i *Instance) EnableAccounting() {
+
+	i.accounting = true
+}
+
+// aclComment returns the match commenting the rule of an ACL, so that its counters
+// can be found, or no match if the accounting is disabled
+func (i *Instance) aclComment(direction string, index int) []string {
+
+	if !i.accounting {
+		return []string{}
+	}
+
+	return []string{"-m", "comment", "--comment", aclCommentPrefix + direction + " " + strconv.Itoa(index)}
+}
+
+// addAccountingRules adds the rules counting all the packets at the top of the
+// chains of a PU. The rules have no target, so the packets continue to the next
+// rules.
+func (i *Instance) addAccountingRules(appChain string, netChain string) error {
+
+	if !i.accounting {
+		return nil
+	}
+
+	for _, chain := range [][]string{
+		{i.appAckPacketIPTableContext, appChain},
+		{i.netPacketIPTableContext, netChain},
+	} {
+		if err := i.ipt.Insert(chain[0], chain[1], 1, "-m", "comment", "--comment", accountingComment); err != nil {
+			log.WithFields(log.Fields{
+				"package": "iptablesctrl",
+				"context": chain[0],
+				"chain":   chain[1],
+				"error":   err.Error(),
+			}).Debug("Failed to add the accounting rule")
+			return err
+		}
+	}
+
+	return nil
+}
+
+// listChain returns the verbose listing of a chain with its exact counters
+func listChain(table, chain string) ([]byte, error) {
+
+	return exec.Command("iptables", "-t", table, "-L", chain, "-n", "-v", "-x").CombinedOutput()
+}
+
+// listChain6 returns the verbose listing of an ip6tables chain with its exact counters
+func listChain6(table, chain string) ([]byte, error) {
+
+	return exec.Command("ip6tables", "-t", table, "-L", chain, "-n", "-v", "-x").CombinedOutput()
+}
+
+// chainCounters is a counter of a verbose listing of a chain
+type chainCounters struct {
+	packets uint64
+	bytes   uint64
+}
+
+// commentCounters returns the counters of the rules of a verbose listing of a chain
+// by their comment
+func commentCounters(listing []byte) map[string]*chainCounters {
+
+	counters := map[string]*chainCounters{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(listing))
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		start := strings.Index(line, "/* ")
+		end := strings.LastIndex(line, " */")
+		if start < 0 || end < start+3 {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		packets, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		size, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		counters[line[start+3:end]] = &chainCounters{packets: packets, bytes: size}
+	}
+
+	return counters
+}
+
+// Counters returns the traffic of a PU counted since the chains of the version were
+// created. The ACLs are the rules the version was configured with.
+func (i *Instance) Counters(version int, contextID string, appACLs, netACLs *policy.IPRuleList) (*collector.BandwidthRecord, error) {
+
+	if !i.accounting {
+		return nil, fmt.Errorf("Accounting is not enabled")
+	}
+
+	appChain, netChain := i.chainName(contextID, version)
+
+	record := &collector.BandwidthRecord{
+		ContextID: contextID,
+		Rules:     []*collector.RuleBandwidth{},
+	}
+
+	for _, chain := range []struct {
+		table     string
+		name      string
+		direction string
+		acls      *policy.IPRuleList
+		packets   *uint64
+		bytes     *uint64
+	}{
+		{i.appAckPacketIPTableContext, appChain, collector.BandwidthApplication, appACLs, &record.TxPackets, &record.TxBytes},
+		{i.netPacketIPTableContext, netChain, collector.BandwidthNetwork, netACLs, &record.RxPackets, &record.RxBytes},
+	} {
+		listing, err := i.listChain(chain.table, chain.name)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot read the counters of %s: %s", chain.name, err)
+		}
+
+		counters := commentCounters(listing)
+
+		total, ok := counters[accountingComment]
+		if !ok {
+			return nil, fmt.Errorf("No accounting rule in %s", chain.name)
+		}
+
+		*chain.packets = total.packets
+		*chain.bytes = total.bytes
+
+		if chain.acls == nil {
+			continue
+		}
+
+		for index, rule := range chain.acls.Rules {
+			if c, ok := counters[aclCommentPrefix+chain.direction+" "+strconv.Itoa(index)]; ok {
+				record.Rules = append(record.Rules, &collector.RuleBandwidth{
+					Direction: chain.direction,
+					Rule:      rule,
+					Packets:   c.packets,
+					Bytes:     c.bytes,
+				})
+			}
+		}
+	}
+
+	return record, nil
+}
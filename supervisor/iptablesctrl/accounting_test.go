@@ -0,0 +1,101 @@
+package iptablesctrl
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/policy"
+	"github.com/aporeto-inc/trireme/supervisor/provider"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const appChainListing = `Chain TRIREME-App-pu1-0 (1 references)
+    pkts      bytes target     prot opt in     out     source               destination
+      42    51200            all  --  *      *       0.0.0.0/0            0.0.0.0/0            /* Trireme bandwidth */
+       2      120 ACCEPT     tcp  --  *      *       0.0.0.0/0            10.0.0.0/8           /* Trireme acl application 1 */ state NEW tcp dpt:80
+       0        0 ACCEPT     tcp  --  *      *       0.0.0.0/0            0.0.0.0/0            state ESTABLISHED
+`
+
+const netChainListing = `Chain TRIREME-Net-pu1-0 (1 references)
+    pkts      bytes target     prot opt in     out     source               destination
+      30     9000            all  --  *      *       0.0.0.0/0            0.0.0.0/0            /* Trireme bandwidth */
+`
+
+func TestAccounting(t *testing.T) {
+	Convey("Given an iptables controller", t, func() {
+		i, _ := NewInstance("0:1", "2:3", 0x1000, constants.LocalContainer)
+		iptables := provider.NewTestIptablesProvider()
+		i.ipt = iptables
+
+		Convey("When the accounting is disabled", func() {
+			Convey("The ACLs should have no comment", func() {
+				So(i.aclComment(collector.BandwidthApplication, 0), ShouldBeEmpty)
+			})
+
+			Convey("No accounting rule should be added", func() {
+				So(i.addAccountingRules("app", "net"), ShouldBeNil)
+			})
+
+			Convey("The counters should not be available", func() {
+				_, err := i.Counters(0, "pu1", nil, nil)
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the accounting is enabled", func() {
+			i.EnableAccounting()
+
+			Convey("The ACLs should be commented with their index", func() {
+				So(i.aclComment(collector.BandwidthNetwork, 3), ShouldResemble, []string{"-m", "comment", "--comment", "Trireme acl network 3"})
+			})
+
+			Convey("The accounting rules should be inserted at the top of the chains", func() {
+				rules := [][]string{}
+				iptables.MockInsert(t, func(table string, chain string, pos int, rulespec ...string) error {
+					So(pos, ShouldEqual, 1)
+					rules = append(rules, append([]string{table, chain}, rulespec...))
+					return nil
+				})
+
+				So(i.addAccountingRules("app", "net"), ShouldBeNil)
+				So(rules, ShouldResemble, [][]string{
+					{"mangle", "app", "-m", "comment", "--comment", "Trireme bandwidth"},
+					{"mangle", "net", "-m", "comment", "--comment", "Trireme bandwidth"},
+				})
+			})
+
+			Convey("The counters should be read from the chains of the version", func() {
+				web := policy.IPRule{Address: "10.0.0.0/8", Port: "80", Protocol: "TCP", Action: policy.Accept}
+				dns := policy.IPRule{Address: "8.8.8.8", Port: "53", Protocol: "UDP", Action: policy.Accept}
+
+				i.listChain = func(table, chain string) ([]byte, error) {
+					switch chain {
+					case "TRIREME-App-pu1-0":
+						return []byte(appChainListing), nil
+					case "TRIREME-Net-pu1-0":
+						return []byte(netChainListing), nil
+					}
+					return nil, fmt.Errorf("No chain %s", chain)
+				}
+
+				record, err := i.Counters(0, "pu1", policy.NewIPRuleList([]policy.IPRule{dns, web}), policy.NewIPRuleList(nil))
+				So(err, ShouldBeNil)
+				So(record, ShouldResemble, &collector.BandwidthRecord{
+					ContextID: "pu1",
+					TxBytes:   51200,
+					TxPackets: 42,
+					RxBytes:   9000,
+					RxPackets: 30,
+					Rules: []*collector.RuleBandwidth{
+						{Direction: collector.BandwidthApplication, Rule: web, Bytes: 120, Packets: 2},
+					},
+				})
+
+				_, err = i.Counters(1, "pu1", nil, nil)
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
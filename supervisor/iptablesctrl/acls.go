@@ -6,8 +6,10 @@ import (
 	"strings"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/aporeto-inc/trireme/collector"
 	"github.com/aporeto-inc/trireme/constants"
 	"github.com/aporeto-inc/trireme/policy"
+	"github.com/aporeto-inc/trireme/utils/marks"
 )
 
 func (i *Instance) cgroupChainRules(appChain string, netChain string, mark string, port string) [][]string {
@@ -18,7 +20,7 @@ func (i *Instance) cgroupChainRules(appChain string, netChain string, mark strin
 			i.appCgroupIPTableSection,
 			"-m", "cgroup", "--cgroup", mark,
 			"-m", "comment", "--comment", "Server specific chain",
-			"-j", "MARK", "--set-mark", mark,
+			"-j", "MARK", "--set-mark", i.cgroupMarkSpec(mark),
 		},
 		{
 			i.appAckPacketIPTableContext,
@@ -39,7 +41,18 @@ func (i *Instance) cgroupChainRules(appChain string, netChain string, mark strin
 		},
 	}
 
-	return str
+	return append(str, i.mtlsCgroupRules(mark)...)
+}
+
+// cgroupMarkSpec returns the iptables representation of the mark of a cgroup
+func (i *Instance) cgroupMarkSpec(mark string) string {
+
+	value, err := strconv.ParseUint(mark, 10, 32)
+	if err != nil {
+		return mark
+	}
+
+	return marks.Spec(uint32(value), i.markMask)
 }
 
 // chainRules provides the list of rules that are used to send traffic to
@@ -60,7 +73,7 @@ func (i *Instance) chainRules(appChain string, netChain string, ip string) [][]s
 
 	rules = append(rules, []string{
 		i.appAckPacketIPTableContext,
-		i.appPacketIPTableSection,
+		i.appAckPacketIPTableSection,
 		"-s", ip,
 		"-m", "comment", "--comment", "Container specific chain",
 		"-j", appChain,
@@ -146,6 +159,114 @@ func (i *Instance) trapRules(appChain string, netChain string, network string, a
 
 }
 
+// trustedNetworkRules provides the rules that accept the traffic of a trusted network
+// ahead of the packet trap. Only the SYN packets are sent to the enforcer, so that
+// the connections are reported without the identity handshake.
+func (i *Instance) trustedNetworkRules(appChain string, netChain string, network string, appQueue string, netQueue string) [][]string {
+
+	rules := [][]string{}
+
+	if i.mode == constants.LocalContainer {
+		rules = append(rules, []string{
+			i.appPacketIPTableContext, appChain,
+			"-d", network,
+			"-p", "tcp", "--tcp-flags", "FIN,SYN,RST,PSH,URG", "SYN",
+			"-m", "comment", "--comment", "Trireme trusted network",
+			"-j", "NFQUEUE", "--queue-balance", appQueue,
+		})
+	} else {
+		rules = append(rules, []string{
+			i.appAckPacketIPTableContext, appChain,
+			"-d", network,
+			"-p", "tcp", "--tcp-flags", "FIN,SYN,RST,PSH,URG", "SYN",
+			"-m", "comment", "--comment", "Trireme trusted network",
+			"-j", "NFQUEUE", "--queue-balance", appQueue,
+		})
+	}
+
+	rules = append(rules, []string{
+		i.appAckPacketIPTableContext, appChain,
+		"-d", network,
+		"-m", "comment", "--comment", "Trireme trusted network",
+		"-j", i.acceptTarget,
+	})
+
+	rules = append(rules, []string{
+		i.netPacketIPTableContext, netChain,
+		"-s", network,
+		"-p", "tcp", "--tcp-flags", "SYN,ACK", "SYN",
+		"-m", "comment", "--comment", "Trireme trusted network",
+		"-j", "NFQUEUE", "--queue-balance", netQueue,
+	})
+
+	rules = append(rules, []string{
+		i.netPacketIPTableContext, netChain,
+		"-s", network,
+		"-m", "comment", "--comment", "Trireme trusted network",
+		"-j", i.acceptTarget,
+	})
+
+	return rules
+}
+
+// dnsRules provides the rules that restrict the DNS queries of a PU to its servers.
+// When the domains are restricted, the UDP queries are sent to the enforcer that
+// inspects their question, and the TCP queries are dropped since they cannot be
+// inspected.
+func (i *Instance) dnsRules(appChain string, dns *policy.DNSPolicy, appQueue string) [][]string {
+
+	rules := [][]string{}
+
+	servers := dns.Servers
+	if len(servers) == 0 {
+		servers = []string{i.anyNetwork}
+	}
+
+	queueContext := i.appAckPacketIPTableContext
+	if i.mode == constants.LocalContainer {
+		queueContext = i.appPacketIPTableContext
+	}
+
+	for _, server := range servers {
+
+		if len(dns.Domains) > 0 {
+			rules = append(rules, []string{
+				queueContext, appChain,
+				"-d", server,
+				"-p", "udp", "--dport", "53",
+				"-m", "comment", "--comment", "Trireme DNS policy",
+				"-j", "NFQUEUE", "--queue-balance", appQueue,
+			})
+		}
+
+		for _, protocol := range []string{"udp", "tcp"} {
+
+			if protocol == "tcp" && len(dns.Domains) > 0 {
+				continue
+			}
+
+			rules = append(rules, []string{
+				i.appAckPacketIPTableContext, appChain,
+				"-d", server,
+				"-p", protocol, "--dport", "53",
+				"-m", "comment", "--comment", "Trireme DNS policy",
+				"-j", i.acceptTarget,
+			})
+		}
+	}
+
+	for _, protocol := range []string{"udp", "tcp"} {
+		rules = append(rules, []string{
+			i.appAckPacketIPTableContext, appChain,
+			"-p", protocol, "--dport", "53",
+			"-m", "comment", "--comment", "Trireme DNS policy",
+			"-j", "DROP",
+		})
+	}
+
+	return rules
+}
+
 // exclusionChainRules provides the list of rules that are used to send traffic to
 // a particular chain
 func (i *Instance) exclusionChainRules(ipList []string) [][]string {
@@ -162,11 +283,11 @@ func (i *Instance) exclusionChainRules(ipList []string) [][]string {
 		}
 		rules = append(rules, []string{
 			i.appAckPacketIPTableContext,
-			i.appPacketIPTableSection,
+			i.appAckPacketIPTableSection,
 			"-d", ip,
 			"-p", "tcp",
 			"-m", "comment", "--comment", "Trireme excluded IP",
-			"-j", "ACCEPT",
+			"-j", i.acceptTarget,
 		})
 
 		rules = append(rules, []string{
@@ -174,9 +295,31 @@ func (i *Instance) exclusionChainRules(ipList []string) [][]string {
 			i.netPacketIPTableSection,
 			"-s", ip,
 			"-m", "comment", "--comment", "Trireme excluded IP",
-			"-j", "ACCEPT",
+			"-j", i.acceptTarget,
+		})
+	}
+	return rules
+}
+
+// controllerRules provides the rules that accept the traffic of the controller on top
+// of the network section, so that no policy can lock the agent out of its controller.
+// The agent opens the connections and its packets never go through the application
+// chains of the PUs, so only the established traffic from the controller is needed.
+func (i *Instance) controllerRules(networks []string) [][]string {
+
+	rules := [][]string{}
+
+	for _, network := range networks {
+		rules = append(rules, []string{
+			i.netPacketIPTableContext,
+			i.netPacketIPTableSection,
+			"-s", network,
+			"-m", "state", "--state", "ESTABLISHED",
+			"-m", "comment", "--comment", "Trireme controller",
+			"-j", i.acceptTarget,
 		})
 	}
+
 	return rules
 }
 
@@ -226,6 +369,10 @@ func (i *Instance) addContainerChain(appChain string, netChain string) error {
 
 func (i *Instance) processRulesFromList(rulelist [][]string, methodType string) error {
 	for _, cr := range rulelist {
+		if i.queuesDisabled && queueRule(cr) {
+			continue
+		}
+
 		switch methodType {
 		case "Append":
 			if err := i.ipt.Append(cr[0], cr[1], cr[2:]...); err != nil {
@@ -265,10 +412,37 @@ func (i *Instance) processRulesFromList(rulelist [][]string, methodType string)
 	return nil
 }
 
+// queueRule returns true if the target of the rule is a netfilter queue
+func queueRule(rule []string) bool {
+
+	for j := 0; j+1 < len(rule); j++ {
+		if rule[j] == "-j" && rule[j+1] == "NFQUEUE" {
+			return true
+		}
+	}
+
+	return false
+}
+
 // addChainrules implements all the iptable rules that redirect traffic to a chain
 func (i *Instance) addChainRules(appChain string, netChain string, ip string, port string, mark string) error {
 
 	if i.mode == constants.LocalServer {
+		value, err := strconv.ParseUint(mark, 10, 32)
+		if err != nil {
+			return fmt.Errorf("Invalid cgroup mark %s", mark)
+		}
+
+		if err := marks.Validate(i.markMask, uint32(value)); err != nil {
+			return err
+		}
+
+		if i.mtls != nil {
+			if _, err := marks.Loopback(uint32(value)); err != nil {
+				return err
+			}
+		}
+
 		return i.processRulesFromList(i.cgroupChainRules(appChain, netChain, mark, port), "Append")
 	}
 	return i.processRulesFromList(i.chainRules(appChain, netChain, ip), "Append")
@@ -289,20 +463,72 @@ func (i *Instance) addPacketTrap(appChain string, netChain string, ip string, ne
 	return nil
 }
 
+// addTrustedNetworks adds the rules of the trusted networks. They must be added
+// before the packet trap.
+func (i *Instance) addTrustedNetworks(appChain string, netChain string, networks []string) error {
+
+	for _, network := range networks {
+
+		err := i.processRulesFromList(i.trustedNetworkRules(appChain, netChain, network, i.applicationQueues, i.networkQueues), "Append")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addDNSRules adds the rules of the DNS policy. They must be added before the rules
+// of the trusted networks, so that a trusted network cannot be used to reach
+// another DNS server.
+func (i *Instance) addDNSRules(appChain string, dns *policy.DNSPolicy) error {
+
+	if !dns.Restricted() {
+		return nil
+	}
+
+	return i.processRulesFromList(i.dnsRules(appChain, dns, i.applicationQueues), "Append")
+}
+
+// rejectTarget returns the target of an ACL rejecting the flows of the rule. The
+// flows are reset when the rule asks for it and the REJECT target is available,
+// which is only the case in the filter table. They are dropped otherwise.
+func (i *Instance) rejectTarget(table string, rule policy.IPRule) []string {
+
+	if rule.Action&policy.Reset == 0 || table != "filter" {
+		return []string{"-j", "DROP"}
+	}
+
+	if strings.EqualFold(rule.Protocol, "tcp") {
+		return []string{"-j", "REJECT", "--reject-with", "tcp-reset"}
+	}
+
+	return []string{"-j", "REJECT", "--reject-with", i.rejectWithICMP}
+}
+
 // addAppACLs adds a set of rules to the external services that are initiated
 // by an application. The allow rules are inserted with highest priority.
 func (i *Instance) addAppACLs(chain string, ip string, rules *policy.IPRuleList) error {
 
-	for _, rule := range rules.Rules {
+	return i.addAppACLRules(chain, chain, rules)
+}
+
+// addAppACLRules adds the application ACLs, the reject rules at the top of the
+// reject chain and the other rules at the end of the accept chain
+func (i *Instance) addAppACLRules(rejectChain, chain string, rules *policy.IPRuleList) error {
+
+	for index, rule := range rules.Rules {
 		if rule.Protocol == "UDP" || rule.Protocol == "TCP" {
-			switch rule.Action {
+			switch rule.Action &^ (policy.Reset | policy.Mirror) {
 			case policy.Accept:
 				if err := i.ipt.Append(
 					i.appAckPacketIPTableContext, chain,
-					"-p", rule.Protocol, "-m", "state", "--state", "NEW",
-					"-d", rule.Address,
-					"--dport", rule.Port,
-					"-j", "ACCEPT",
+					append(i.aclComment(collector.BandwidthApplication, index),
+						"-p", rule.Protocol, "-m", "state", "--state", "NEW",
+						"-d", rule.Address,
+						"--dport", rule.Port,
+						"-j", i.acceptTarget,
+					)...,
 				); err != nil {
 					log.WithFields(log.Fields{
 						"package":                   "iptablesctrl",
@@ -314,11 +540,12 @@ func (i *Instance) addAppACLs(chain string, ip string, rules *policy.IPRuleList)
 				}
 			case policy.Reject:
 				if err := i.ipt.Insert(
-					i.appAckPacketIPTableContext, chain, 1,
-					"-p", rule.Protocol, "-m", "state", "--state", "NEW",
-					"-d", rule.Address,
-					"--dport", rule.Port,
-					"-j", "DROP",
+					i.appAckPacketIPTableContext, rejectChain, 1,
+					append(append(i.aclComment(collector.BandwidthApplication, index),
+						"-p", rule.Protocol, "-m", "state", "--state", "NEW",
+						"-d", rule.Address,
+						"--dport", rule.Port,
+					), i.rejectTarget(i.appAckPacketIPTableContext, rule)...)...,
 				); err != nil {
 					log.WithFields(log.Fields{
 						"package":                   "iptablesctrl",
@@ -332,13 +559,15 @@ func (i *Instance) addAppACLs(chain string, ip string, rules *policy.IPRuleList)
 				continue
 			}
 		} else {
-			switch rule.Action {
+			switch rule.Action &^ (policy.Reset | policy.Mirror) {
 			case policy.Accept:
 				if err := i.ipt.Append(
 					i.appAckPacketIPTableContext, chain,
-					"-p", rule.Protocol,
-					"-d", rule.Address,
-					"-j", "ACCEPT",
+					append(i.aclComment(collector.BandwidthApplication, index),
+						"-p", rule.Protocol,
+						"-d", rule.Address,
+						"-j", i.acceptTarget,
+					)...,
 				); err != nil {
 					log.WithFields(log.Fields{
 						"package":                   "iptablesctrl",
@@ -350,10 +579,11 @@ func (i *Instance) addAppACLs(chain string, ip string, rules *policy.IPRuleList)
 				}
 			case policy.Reject:
 				if err := i.ipt.Insert(
-					i.appAckPacketIPTableContext, chain, 1,
-					"-p", rule.Protocol,
-					"-d", rule.Address,
-					"-j", "DROP",
+					i.appAckPacketIPTableContext, rejectChain, 1,
+					append(append(i.aclComment(collector.BandwidthApplication, index),
+						"-p", rule.Protocol,
+						"-d", rule.Address,
+					), i.rejectTarget(i.appAckPacketIPTableContext, rule)...)...,
 				); err != nil {
 					log.WithFields(log.Fields{
 						"package":                   "iptablesctrl",
@@ -372,9 +602,9 @@ func (i *Instance) addAppACLs(chain string, ip string, rules *policy.IPRuleList)
 	// Accept established connections
 	if err := i.ipt.Append(
 		i.appAckPacketIPTableContext, chain,
-		"-d", "0.0.0.0/0",
+		"-d", i.anyNetwork,
 		"-p", "udp", "-m", "state", "--state", "ESTABLISHED",
-		"-j", "ACCEPT"); err != nil {
+		"-j", i.acceptTarget); err != nil {
 
 		log.WithFields(log.Fields{
 			"package": "iptablesctrl",
@@ -387,9 +617,9 @@ func (i *Instance) addAppACLs(chain string, ip string, rules *policy.IPRuleList)
 
 	if err := i.ipt.Append(
 		i.appAckPacketIPTableContext, chain,
-		"-d", "0.0.0.0/0",
+		"-d", i.anyNetwork,
 		"-p", "tcp", "-m", "state", "--state", "ESTABLISHED",
-		"-j", "ACCEPT"); err != nil {
+		"-j", i.acceptTarget); err != nil {
 
 		log.WithFields(log.Fields{
 			"package": "iptablesctrl",
@@ -403,7 +633,7 @@ func (i *Instance) addAppACLs(chain string, ip string, rules *policy.IPRuleList)
 	// Drop everything else
 	if err := i.ipt.Append(
 		i.appAckPacketIPTableContext, chain,
-		"-d", "0.0.0.0/0",
+		"-d", i.anyNetwork,
 		"-j", "DROP"); err != nil {
 
 		log.WithFields(log.Fields{
@@ -422,17 +652,26 @@ func (i *Instance) addAppACLs(chain string, ip string, rules *policy.IPRuleList)
 // explicit rules are added with the higest priority since they are direct allows.
 func (i *Instance) addNetACLs(chain, ip string, rules *policy.IPRuleList) error {
 
-	for _, rule := range rules.Rules {
+	return i.addNetACLRules(chain, chain, rules)
+}
+
+// addNetACLRules adds the network ACLs, the reject rules at the top of the reject
+// chain and the other rules at the end of the accept chain
+func (i *Instance) addNetACLRules(rejectChain, chain string, rules *policy.IPRuleList) error {
+
+	for index, rule := range rules.Rules {
 
 		if rule.Protocol == "UDP" || rule.Protocol == "TCP" {
-			switch rule.Action {
+			switch rule.Action &^ (policy.Reset | policy.Mirror) {
 			case policy.Accept:
 				if err := i.ipt.Append(
 					i.netPacketIPTableContext, chain,
-					"-p", rule.Protocol,
-					"-s", rule.Address,
-					"--dport", rule.Port,
-					"-j", "ACCEPT",
+					append(i.aclComment(collector.BandwidthNetwork, index),
+						"-p", rule.Protocol,
+						"-s", rule.Address,
+						"--dport", rule.Port,
+						"-j", i.acceptTarget,
+					)...,
 				); err != nil {
 					log.WithFields(log.Fields{
 						"package":                   "iptablesctrl",
@@ -445,11 +684,12 @@ func (i *Instance) addNetACLs(chain, ip string, rules *policy.IPRuleList) error
 				}
 			case policy.Reject:
 				if err := i.ipt.Insert(
-					i.netPacketIPTableContext, chain, 1,
-					"-p", rule.Protocol,
-					"-s", rule.Address,
-					"--dport", rule.Port,
-					"-j", "DROP",
+					i.netPacketIPTableContext, rejectChain, 1,
+					append(append(i.aclComment(collector.BandwidthNetwork, index),
+						"-p", rule.Protocol,
+						"-s", rule.Address,
+						"--dport", rule.Port,
+					), i.rejectTarget(i.netPacketIPTableContext, rule)...)...,
 				); err != nil {
 					log.WithFields(log.Fields{
 						"package":                   "iptablesctrl",
@@ -464,13 +704,15 @@ func (i *Instance) addNetACLs(chain, ip string, rules *policy.IPRuleList) error
 				continue
 			}
 		} else {
-			switch rule.Action {
+			switch rule.Action &^ (policy.Reset | policy.Mirror) {
 			case policy.Accept:
 				if err := i.ipt.Append(
 					i.netPacketIPTableContext, chain,
-					"-p", rule.Protocol,
-					"-s", rule.Address,
-					"-j", "ACCEPT",
+					append(i.aclComment(collector.BandwidthNetwork, index),
+						"-p", rule.Protocol,
+						"-s", rule.Address,
+						"-j", i.acceptTarget,
+					)...,
 				); err != nil {
 					log.WithFields(log.Fields{
 						"package":                   "iptablesctrl",
@@ -483,10 +725,11 @@ func (i *Instance) addNetACLs(chain, ip string, rules *policy.IPRuleList) error
 				}
 			case policy.Reject:
 				if err := i.ipt.Insert(
-					i.netPacketIPTableContext, chain, 1,
-					"-p", rule.Protocol,
-					"-s", rule.Address,
-					"-j", "DROP",
+					i.netPacketIPTableContext, rejectChain, 1,
+					append(append(i.aclComment(collector.BandwidthNetwork, index),
+						"-p", rule.Protocol,
+						"-s", rule.Address,
+					), i.rejectTarget(i.netPacketIPTableContext, rule)...)...,
 				); err != nil {
 					log.WithFields(log.Fields{
 						"package":                   "iptablesctrl",
@@ -506,9 +749,9 @@ func (i *Instance) addNetACLs(chain, ip string, rules *policy.IPRuleList) error
 	// Accept established connections
 	if err := i.ipt.Append(
 		i.netPacketIPTableContext, chain,
-		"-s", "0.0.0.0/0",
+		"-s", i.anyNetwork,
 		"-p", "tcp", "-m", "state", "--state", "ESTABLISHED",
-		"-j", "ACCEPT",
+		"-j", i.acceptTarget,
 	); err != nil {
 		log.WithFields(log.Fields{
 			"package":                   "iptablesctrl",
@@ -522,9 +765,9 @@ func (i *Instance) addNetACLs(chain, ip string, rules *policy.IPRuleList) error
 
 	if err := i.ipt.Append(
 		i.netPacketIPTableContext, chain,
-		"-s", "0.0.0.0/0",
+		"-s", i.anyNetwork,
 		"-p", "udp", "-m", "state", "--state", "ESTABLISHED",
-		"-j", "ACCEPT",
+		"-j", i.acceptTarget,
 	); err != nil {
 		log.WithFields(log.Fields{
 			"package":                   "iptablesctrl",
@@ -539,7 +782,7 @@ func (i *Instance) addNetACLs(chain, ip string, rules *policy.IPRuleList) error
 	// Drop everything else
 	if err := i.ipt.Append(
 		i.netPacketIPTableContext, chain,
-		"-s", "0.0.0.0/0",
+		"-s", i.anyNetwork,
 		"-j", "DROP",
 	); err != nil {
 		log.WithFields(log.Fields{
@@ -634,7 +877,7 @@ func (i *Instance) CaptureSYNACKPackets() error {
 
 	err := i.ipt.Insert(
 		i.appAckPacketIPTableContext,
-		i.appPacketIPTableSection, 1,
+		i.appAckPacketIPTableSection, 1,
 		"-p", "tcp", "--tcp-flags", "SYN,ACK", "SYN,ACK",
 		"-j", "NFQUEUE", "--queue-bypass", "--queue-balance", i.applicationQueues)
 
@@ -670,7 +913,7 @@ func (i *Instance) CleanCaptureSynAckPackets() error {
 
 	i.ipt.Delete(
 		i.appAckPacketIPTableContext,
-		i.appPacketIPTableSection,
+		i.appAckPacketIPTableSection,
 		"-p", "tcp", "--tcp-flags", "SYN,ACK", "SYN,ACK",
 		"-j", "NFQUEUE", "--queue-bypass", "--queue-balance", i.applicationQueues)
 
@@ -702,10 +945,10 @@ func (i *Instance) acceptMarkedPackets() error {
 
 	return i.ipt.Insert(
 		i.appAckPacketIPTableContext,
-		i.appPacketIPTableSection, 1,
+		i.appAckPacketIPTableSection, 1,
 		"-m", "mark",
-		"--mark", strconv.Itoa(i.mark),
-		"-j", "ACCEPT")
+		"--mark", marks.Spec(uint32(i.mark), i.markMask),
+		"-j", i.acceptTarget)
 
 }
 
@@ -715,19 +958,70 @@ func (i *Instance) removeMarkRule() error {
 		return nil
 	}
 
-	i.ipt.Delete(i.appAckPacketIPTableContext, i.appPacketIPTableSection,
+	i.ipt.Delete(i.appAckPacketIPTableContext, i.appAckPacketIPTableSection,
 		"-m", "mark",
-		"--mark", strconv.Itoa(i.mark),
-		"-j", "ACCEPT")
+		"--mark", marks.Spec(uint32(i.mark), i.markMask),
+		"-j", i.acceptTarget)
 
 	return nil
 }
 
+// addAnchor creates the trireme chains of the anchors and anchors them in their hook.
+// Docker appends a RETURN rule to DOCKER-USER and the firewall managers keep their
+// rules in the hooks, so the anchors must be inserted and not appended.
+func (i *Instance) addAnchor() error {
+
+	for _, a := range i.anchors {
+
+		if err := i.ipt.NewChain(a.table, a.chain); err != nil {
+			log.WithFields(log.Fields{
+				"package": "iptablesctrl",
+				"chain":   a.chain,
+				"error":   err.Error(),
+			}).Debug("Failed to create the anchor chain")
+			return err
+		}
+
+		position, err := i.anchorPosition(a)
+		if err != nil {
+			return err
+		}
+
+		if err := i.ipt.Insert(a.table, a.hook, position,
+			"-m", "comment", "--comment", "Trireme anchor",
+			"-j", a.chain); err != nil {
+			log.WithFields(log.Fields{
+				"package": "iptablesctrl",
+				"chain":   a.hook,
+				"error":   err.Error(),
+			}).Debug("Failed to anchor trireme chain. The hook must exist, like DOCKER-USER since Docker 17.06")
+			return err
+		}
+	}
+
+	return i.addBypassRules()
+}
+
+// removeAnchor removes the rules of the hooks that jump to the trireme chains
+func (i *Instance) removeAnchor() {
+
+	for _, a := range i.anchors {
+		i.ipt.Delete(a.table, a.hook,
+			"-m", "comment", "--comment", "Trireme anchor",
+			"-j", a.chain)
+	}
+}
+
 func (i *Instance) cleanACLs() error {
 
 	// Clean the mark rule
 	i.removeMarkRule()
 
+	i.removeMTLSRedirect()
+
+	// The anchor chain cannot be deleted while it is referenced
+	i.removeAnchor()
+
 	if i.mode == constants.LocalServer {
 		i.CleanCaptureSynAckPackets()
 	}
@@ -738,11 +1032,13 @@ func (i *Instance) cleanACLs() error {
 	}
 
 	// Clean Application Rules/Chains
-	i.cleanACLSection(i.appAckPacketIPTableContext, i.appPacketIPTableSection, chainPrefix)
+	i.cleanACLSection(i.appAckPacketIPTableContext, i.appAckPacketIPTableSection, chainPrefix)
 
 	// Clean Network Rules/Chains
 	i.cleanACLSection(i.netPacketIPTableContext, i.netPacketIPTableSection, chainPrefix)
 
+	i.resetGroups()
+
 	return nil
 }
 
@@ -759,10 +1055,17 @@ func (i *Instance) cleanACLSection(context, section, chainPrefix string) {
 
 	rules, _ := i.ipt.ListChains(context)
 
+	// The chains are all cleared first, since the chains of the policy groups
+	// cannot be deleted while the chains of the PUs jump to them
 	for _, rule := range rules {
-
 		if strings.Contains(rule, chainPrefix) {
 			i.ipt.ClearChain(context, rule)
+		}
+	}
+
+	for _, rule := range rules {
+
+		if strings.Contains(rule, chainPrefix) {
 			i.ipt.DeleteChain(context, rule)
 		}
 	}
@@ -781,3 +1084,124 @@ func (i *Instance) deleteExclusionChainRules(ip []string) error {
 	return i.processRulesFromList(i.exclusionChainRules(ip), "Delete")
 
 }
+
+// mtlsRedirect is the redirection of the connections of the mutual TLS data-plane mode
+type mtlsRedirect struct {
+	networks   []string
+	clientPort int
+	serverPort int
+}
+
+// mtlsRedirectRules provides the rules that redirect the connections to the mutual TLS
+// networks to the client port of the enforcer and the connections of the peer
+// enforcers to its server port. Connections opened by the enforcer carry the mark
+// and are not captured. In local server mode, the connections of the PUs are
+// redirected by the rules of their cgroup.
+func (i *Instance) mtlsRedirectRules() [][]string {
+
+	rules := [][]string{}
+
+	if i.mtls == nil {
+		return rules
+	}
+
+	if i.mode != constants.LocalServer {
+		for _, network := range i.mtls.networks {
+			rules = append(rules, []string{
+				"nat",
+				i.builtinHook(i.appPacketIPTableSection),
+				"-p", "tcp",
+				"-d", network,
+				"-m", "mark", "!", "--mark", marks.Spec(uint32(i.mark), i.markMask),
+				"-m", "comment", "--comment", "Trireme mutual TLS",
+				"-j", "REDIRECT", "--to-ports", strconv.Itoa(i.mtls.clientPort),
+			})
+		}
+	}
+
+	if i.mode == constants.LocalContainer {
+		rules = append(rules, []string{
+			"nat",
+			"PREROUTING",
+			"-p", "tcp",
+			"--dport", strconv.Itoa(i.mtls.serverPort),
+			"-m", "comment", "--comment", "Trireme mutual TLS",
+			"-j", "REDIRECT", "--to-ports", strconv.Itoa(i.mtls.serverPort),
+		})
+	}
+
+	// The enforcer carries the connections of the peers to the PUs
+	rules = append(rules, []string{
+		i.netPacketIPTableContext,
+		i.netPacketIPTableSection,
+		"-m", "mark", "--mark", marks.Spec(uint32(i.mark), i.markMask),
+		"-m", "comment", "--comment", "Trireme mutual TLS",
+		"-j", i.acceptTarget,
+	})
+
+	return rules
+}
+
+// mtlsCgroupRules provides the rules that redirect the connections of the processes
+// of a cgroup to the mutual TLS networks. They are sent to the loopback address of
+// the mark of the cgroup, where the enforcer finds the PU of the connection. The
+// IPv6 loopback network has a single address, so only the IPv4 connections are
+// redirected.
+func (i *Instance) mtlsCgroupRules(mark string) [][]string {
+
+	rules := [][]string{}
+
+	if i.mtls == nil {
+		return rules
+	}
+
+	value, err := strconv.ParseUint(mark, 10, 32)
+	if err != nil {
+		return rules
+	}
+
+	loopback, err := marks.Loopback(uint32(value))
+	if err != nil {
+		return rules
+	}
+
+	for _, network := range policy.FamilyNetworks(i.mtls.networks, policy.IPv4) {
+		rules = append(rules, []string{
+			"nat",
+			i.builtinHook(i.appPacketIPTableSection),
+			"-p", "tcp",
+			"-d", network,
+			"-m", "cgroup", "--cgroup", mark,
+			"-m", "comment", "--comment", "Trireme mutual TLS",
+			"-j", "DNAT", "--to-destination", loopback.String() + ":" + strconv.Itoa(i.mtls.clientPort),
+		})
+	}
+
+	return rules
+}
+
+// SetMTLSRedirect redirects the connections to the networks to the ports of the mutual
+// TLS data-plane mode of the enforcer. It must be called before Start.
+func (i *Instance) SetMTLSRedirect(networks []string, clientPort, serverPort int) error {
+
+	if clientPort == 0 || serverPort == 0 {
+		return fmt.Errorf("Mutual TLS requires a client and a server port")
+	}
+
+	i.mtls = &mtlsRedirect{
+		networks:   networks,
+		clientPort: clientPort,
+		serverPort: serverPort,
+	}
+
+	return nil
+}
+
+// removeMTLSRedirect removes the rules of the mutual TLS data-plane mode. The rules
+// may be missing, so each rule is deleted on its own.
+func (i *Instance) removeMTLSRedirect() {
+
+	for _, rule := range i.mtlsRedirectRules() {
+		i.processRulesFromList([][]string{rule}, "Delete")
+	}
+}
@@ -283,6 +283,129 @@ func TestAddPacketTrap(t *testing.T) {
 	})
 }
 
+func TestAddTrustedNetworks(t *testing.T) {
+
+	Convey("Given an iptables controller for Local Server", t, func() {
+		i, _ := NewInstance("0:1", "2:3", 0x1000, constants.LocalServer)
+		iptables := provider.NewTestIptablesProvider()
+		i.ipt = iptables
+
+		Convey("When I add a trusted network", func() {
+			rules := [][]string{}
+			iptables.MockAppend(t, func(table string, chain string, rulespec ...string) error {
+				rules = append(rules, append([]string{table, chain}, rulespec...))
+				return nil
+			})
+			err := i.addTrustedNetworks("appchain", "netchain", []string{"10.1.0.0/16"})
+
+			Convey("I should get no error", func() {
+				So(err, ShouldBeNil)
+			})
+
+			Convey("Only the SYN packets should be queued and the rest accepted", func() {
+				So(len(rules), ShouldEqual, 4)
+				So(matchSpec("NFQUEUE", rules[0]), ShouldBeNil)
+				So(matchSpec("SYN", rules[0]), ShouldBeNil)
+				So(matchSpec("ACCEPT", rules[1]), ShouldBeNil)
+				So(rules[1][1], ShouldEqual, "appchain")
+				So(matchSpec("NFQUEUE", rules[2]), ShouldBeNil)
+				So(matchSpec("ACCEPT", rules[3]), ShouldBeNil)
+				So(rules[3][1], ShouldEqual, "netchain")
+				So(matchSpec("10.1.0.0/16", rules[3]), ShouldBeNil)
+			})
+		})
+
+		Convey("When I add a trusted network and the netPacketIPTableContext fails", func() {
+			iptables.MockAppend(t, func(table string, chain string, rulespec ...string) error {
+				if chain == "netchain" {
+					return fmt.Errorf("Error")
+				}
+				return nil
+			})
+			err := i.addTrustedNetworks("appchain", "netchain", []string{"10.1.0.0/16"})
+
+			Convey("I should get an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given an iptables controller for Local Container", t, func() {
+		i, _ := NewInstance("0:1", "2:3", 0x1000, constants.LocalContainer)
+		iptables := provider.NewTestIptablesProvider()
+		i.ipt = iptables
+
+		Convey("When I add a trusted network the SYN packets should be queued from the raw table", func() {
+			rules := [][]string{}
+			iptables.MockAppend(t, func(table string, chain string, rulespec ...string) error {
+				rules = append(rules, append([]string{table, chain}, rulespec...))
+				return nil
+			})
+			err := i.addTrustedNetworks("appchain", "netchain", []string{"10.1.0.0/16"})
+
+			So(err, ShouldBeNil)
+			So(len(rules), ShouldEqual, 4)
+			So(rules[0][0], ShouldEqual, "raw")
+			So(matchSpec("NFQUEUE", rules[0]), ShouldBeNil)
+			So(rules[1][0], ShouldEqual, "mangle")
+			So(matchSpec("ACCEPT", rules[1]), ShouldBeNil)
+		})
+	})
+}
+
+func TestAddDNSRules(t *testing.T) {
+
+	Convey("Given an iptables controller for Local Container", t, func() {
+		i, _ := NewInstance("0:1", "2:3", 0x1000, constants.LocalContainer)
+		iptables := provider.NewTestIptablesProvider()
+		i.ipt = iptables
+		rules := [][]string{}
+		iptables.MockAppend(t, func(table string, chain string, rulespec ...string) error {
+			rules = append(rules, append([]string{table, chain}, rulespec...))
+			return nil
+		})
+
+		Convey("When I add a DNS policy restricting the servers", func() {
+			err := i.addDNSRules("appchain", policy.NewDNSPolicy([]string{"10.0.0.53/32"}, nil))
+
+			Convey("The queries to the servers should be accepted and the others dropped", func() {
+				So(err, ShouldBeNil)
+				So(len(rules), ShouldEqual, 4)
+				So(matchSpec("10.0.0.53/32", rules[0]), ShouldBeNil)
+				So(matchSpec("ACCEPT", rules[0]), ShouldBeNil)
+				So(matchSpec("tcp", rules[1]), ShouldBeNil)
+				So(matchSpec("ACCEPT", rules[1]), ShouldBeNil)
+				So(matchSpec("DROP", rules[2]), ShouldBeNil)
+				So(matchSpec("DROP", rules[3]), ShouldBeNil)
+			})
+		})
+
+		Convey("When I add a DNS policy restricting the domains", func() {
+			err := i.addDNSRules("appchain", policy.NewDNSPolicy(nil, []string{"example.com"}))
+
+			Convey("The UDP queries should be queued from the raw table and TCP dropped", func() {
+				So(err, ShouldBeNil)
+				So(len(rules), ShouldEqual, 4)
+				So(rules[0][0], ShouldEqual, "raw")
+				So(matchSpec("NFQUEUE", rules[0]), ShouldBeNil)
+				So(matchSpec("udp", rules[1]), ShouldBeNil)
+				So(matchSpec("ACCEPT", rules[1]), ShouldBeNil)
+				So(matchSpec("DROP", rules[3]), ShouldBeNil)
+				So(matchSpec("tcp", rules[3]), ShouldBeNil)
+			})
+		})
+
+		Convey("When I add an empty DNS policy", func() {
+			err := i.addDNSRules("appchain", policy.NewDNSPolicy(nil, nil))
+
+			Convey("No rule should be added", func() {
+				So(err, ShouldBeNil)
+				So(len(rules), ShouldEqual, 0)
+			})
+		})
+	})
+}
+
 func TestAddAppACLs(t *testing.T) {
 
 	Convey("Given an iptables controller ", t, func() {
@@ -873,3 +996,182 @@ func TestClearCaptureSynAckPackets(t *testing.T) {
 		})
 	})
 }
+
+func TestMTLSRedirect(t *testing.T) {
+	Convey("Given an iptables controller", t, func() {
+		i, _ := NewInstance("0:1", "2:3", 0x1000, constants.LocalContainer)
+		iptables := provider.NewTestIptablesProvider()
+		i.ipt = iptables
+
+		Convey("When I set the mutual TLS redirection", func() {
+			So(i.SetMTLSRedirect([]string{"10.0.0.0/8", "192.168.0.0/16"}, 5001, 5002), ShouldBeNil)
+
+			redirects := 0
+			iptables.MockInsert(t, func(table string, chain string, pos int, rulespec ...string) error {
+				if table == "nat" {
+					redirects++
+				}
+				return nil
+			})
+
+			err := i.processRulesFromList(i.mtlsRedirectRules(), "Insert")
+			Convey("I should redirect both networks and the server port", func() {
+				So(err, ShouldBeNil)
+				So(redirects, ShouldEqual, 3)
+			})
+		})
+
+		Convey("When I set the mutual TLS redirection and the nat table fails", func() {
+			So(i.SetMTLSRedirect([]string{"10.0.0.0/8"}, 5001, 5002), ShouldBeNil)
+
+			iptables.MockInsert(t, func(table string, chain string, pos int, rulespec ...string) error {
+				if table == "nat" {
+					return fmt.Errorf("Error")
+				}
+				return nil
+			})
+
+			err := i.processRulesFromList(i.mtlsRedirectRules(), "Insert")
+			Convey("I should get an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When I set the mutual TLS redirection without ports", func() {
+			err := i.SetMTLSRedirect([]string{"10.0.0.0/8"}, 0, 5002)
+			Convey("I should get an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given an iptables controller in local server mode", t, func() {
+		i, _ := NewInstance("0:1", "2:3", 0x1000, constants.LocalServer)
+		iptables := provider.NewTestIptablesProvider()
+		i.ipt = iptables
+		So(i.SetMTLSRedirect([]string{"10.0.0.0/8"}, 5001, 5002), ShouldBeNil)
+
+		Convey("When I install the mutual TLS redirection", func() {
+			chains := []string{}
+			iptables.MockInsert(t, func(table string, chain string, pos int, rulespec ...string) error {
+				chains = append(chains, table+":"+chain)
+				return nil
+			})
+
+			err := i.processRulesFromList(i.mtlsRedirectRules(), "Insert")
+			Convey("I should only accept the connections of the enforcer to the PUs", func() {
+				So(err, ShouldBeNil)
+				So(chains, ShouldResemble, []string{i.netPacketIPTableContext + ":" + i.netPacketIPTableSection})
+			})
+		})
+
+		Convey("When I add the rules of a PU", func() {
+			rules := [][]string{}
+			iptables.MockAppend(t, func(table string, chain string, rulespec ...string) error {
+				rules = append(rules, append([]string{table, chain}, rulespec...))
+				return nil
+			})
+
+			err := i.addChainRules("appChain", "netChain", "", "80", "65537")
+			Convey("I should redirect the connections of its cgroup to the address of its mark", func() {
+				So(err, ShouldBeNil)
+				So(rules[len(rules)-1], ShouldResemble, []string{
+					"nat", "OUTPUT",
+					"-p", "tcp",
+					"-d", "10.0.0.0/8",
+					"-m", "cgroup", "--cgroup", "65537",
+					"-m", "comment", "--comment", "Trireme mutual TLS",
+					"-j", "DNAT", "--to-destination", "127.1.0.1:5001",
+				})
+			})
+		})
+
+		Convey("When I add the rules of a PU whose mark does not fit in a loopback address", func() {
+			err := i.addChainRules("appChain", "netChain", "", "80", "16777216")
+			Convey("I should get an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestDisableQueues(t *testing.T) {
+
+	Convey("Given an iptables controller for Remote Container with the queues disabled", t, func() {
+		i, _ := NewInstance("0:1", "2:3", 0x1000, constants.RemoteContainer)
+		iptables := provider.NewTestIptablesProvider()
+		i.ipt = iptables
+		i.DisableQueues()
+		rules := [][]string{}
+		iptables.MockAppend(t, func(table string, chain string, rulespec ...string) error {
+			rules = append(rules, append([]string{table, chain}, rulespec...))
+			return nil
+		})
+
+		Convey("When I add the packet trap", func() {
+			err := i.addPacketTrap("appchain", "netchain", "172.17.0.2", []string{"0.0.0.0/0"})
+
+			Convey("No rule should be added", func() {
+				So(err, ShouldBeNil)
+				So(len(rules), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When I add a DNS policy restricting the domains", func() {
+			err := i.addDNSRules("appchain", policy.NewDNSPolicy(nil, []string{"example.com"}))
+
+			Convey("The queries should be dropped instead of queued", func() {
+				So(err, ShouldBeNil)
+				So(len(rules), ShouldEqual, 3)
+				So(matchSpec("udp", rules[1]), ShouldBeNil)
+				So(matchSpec("DROP", rules[1]), ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestRejectTarget(t *testing.T) {
+
+	Convey("Given an iptables controller", t, func() {
+		i, _ := NewInstance("0:1", "2:3", 0x1000, constants.LocalContainer)
+
+		Convey("A rule rejecting without reset should drop", func() {
+			rule := policy.IPRule{Protocol: "TCP", Action: policy.Reject}
+			So(i.rejectTarget("filter", rule), ShouldResemble, []string{"-j", "DROP"})
+		})
+
+		Convey("A TCP rule rejecting with reset should reset in the filter table", func() {
+			rule := policy.IPRule{Protocol: "TCP", Action: policy.Reject | policy.Reset}
+			So(i.rejectTarget("filter", rule), ShouldResemble, []string{"-j", "REJECT", "--reject-with", "tcp-reset"})
+			So(i.rejectTarget("mangle", rule), ShouldResemble, []string{"-j", "DROP"})
+		})
+
+		Convey("A UDP rule rejecting with reset should answer administratively prohibited", func() {
+			rule := policy.IPRule{Protocol: "UDP", Action: policy.Reject | policy.Reset}
+			So(i.rejectTarget("filter", rule), ShouldResemble, []string{"-j", "REJECT", "--reject-with", "icmp-admin-prohibited"})
+		})
+
+		Convey("When I add an application ACL rejecting with reset", func() {
+			iptables := provider.NewTestIptablesProvider()
+			i.ipt = iptables
+			rules := [][]string{}
+			iptables.MockInsert(t, func(table string, chain string, pos int, rulespec ...string) error {
+				rules = append(rules, append([]string{table, chain}, rulespec...))
+				return nil
+			})
+			iptables.MockAppend(t, func(table string, chain string, rulespec ...string) error {
+				return nil
+			})
+
+			err := i.addAppACLs("appchain", "172.17.0.2", policy.NewIPRuleList([]policy.IPRule{
+				{Address: "10.0.0.0/8", Port: "80", Protocol: "TCP", Action: policy.Reject | policy.Reset},
+			}))
+
+			Convey("The rule should still be installed", func() {
+				So(err, ShouldBeNil)
+				So(len(rules), ShouldEqual, 1)
+				So(matchSpec("DROP", rules[0]), ShouldBeNil)
+			})
+		})
+	})
+}
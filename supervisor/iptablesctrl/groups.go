@@ -0,0 +1,228 @@
+package iptablesctrl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aporeto-inc/trireme/policy"
+)
+
+const (
+	// groupChainPrefix is the prefix of the chains of the ACLs shared by the PUs
+	groupChainPrefix = chainPrefix + "Group-"
+	// groupHashLength is the length of the hash of the ACLs in the chain names,
+	// which iptables limits to 28 characters
+	groupHashLength = 10
+)
+
+// aclGroup is a set of ACLs shared by the PUs with the same rules. The reject rules
+// are in a chain jumped to from the top of the chains of the PUs and the other rules
+// in a chain jumped to from their end, like the rules of a PU without group.
+type aclGroup struct {
+	table       string
+	rejectChain string
+	acceptChain string
+	refs        int
+}
+
+// aclGroups are the groups of ACLs of an instance and the groups used by the
+// versions of the PUs
+type aclGroups struct {
+	groups map[string]*aclGroup
+	pus    map[string][]string
+	sync.Mutex
+}
+
+// newACLGroups returns no groups
+func newACLGroups() *aclGroups {
+
+	return &aclGroups{
+		groups: map[string]*aclGroup{},
+		pus:    map[string][]string{},
+	}
+}
+
+// EnablePolicyGroups shares the chains of the ACLs between the PUs configured after
+// the call that have the same ACLs. The chains of a group are deleted with the last
+// PU using them. The ACLs are not shared when the accounting is enabled, since their
+// counters are reported for each PU.
+func (i *Instance) EnablePolicyGroups() error {
+
+	if i.acceptTarget != "ACCEPT" {
+		return fmt.Errorf("Policy groups are not supported when the accepted packets return to the hooks")
+	}
+
+	if i.groups == nil {
+		i.groups = newACLGroups()
+	}
+
+	return nil
+}
+
+// PolicyGroups returns the number of groups of ACLs and the number of references
+// of the versions of the PUs to them
+func (i *Instance) PolicyGroups() (groups int, refs int) {
+
+	if i.groups == nil {
+		return 0, 0
+	}
+
+	i.groups.Lock()
+	defer i.groups.Unlock()
+
+	for _, g := range i.groups.groups {
+		refs += g.refs
+	}
+
+	return len(i.groups.groups), refs
+}
+
+// aclHash returns the hash identifying a list of ACLs. The mirror action is
+// ignored, since it is not programmed in the chains of the ACLs.
+func aclHash(rules *policy.IPRuleList) string {
+
+	hash := sha256.New()
+	for _, rule := range rules.Rules {
+		fmt.Fprintf(hash, "%s\x00%s\x00%s\x00%d\n", rule.Address, rule.Port, rule.Protocol, rule.Action&^policy.Mirror)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))[:groupHashLength]
+}
+
+// addACLs adds the ACLs of a policy to the chains of a PU, or the jumps to the
+// chains of their groups if the ACLs are shared
+func (i *Instance) addACLs(appChain, netChain, ip string, policyrules *policy.PUPolicy) error {
+
+	if i.groups == nil || i.accounting {
+		if err := i.addAppACLs(appChain, ip, policyrules.ApplicationACLs()); err != nil {
+			return err
+		}
+
+		return i.addNetACLs(netChain, ip, policyrules.NetworkACLs())
+	}
+
+	if err := i.addGroupACLs(appChain, appChain, i.appAckPacketIPTableContext, "A", policyrules.ApplicationACLs(), i.addAppACLRules); err != nil {
+		return err
+	}
+
+	return i.addGroupACLs(appChain, netChain, i.netPacketIPTableContext, "N", policyrules.NetworkACLs(), i.addNetACLRules)
+}
+
+// addGroupACLs jumps from the chain of a PU to the chains of the group of the ACLs,
+// creating the group if no other PU uses it. The reference is owned by the version
+// of the PU identified by its application chain.
+func (i *Instance) addGroupACLs(owner, chain, table, direction string, rules *policy.IPRuleList, add func(rejectChain, chain string, rules *policy.IPRuleList) error) error {
+
+	i.groups.Lock()
+	defer i.groups.Unlock()
+
+	key := groupChainPrefix + aclHash(rules) + "-" + direction
+
+	g, ok := i.groups.groups[key]
+	if !ok {
+		g = &aclGroup{
+			table:       table,
+			rejectChain: key + "R",
+			acceptChain: key + "A",
+		}
+
+		if err := i.createGroupChains(g, rules, add); err != nil {
+			i.deleteGroupChains(g)
+			return err
+		}
+
+		i.groups.groups[key] = g
+	}
+
+	// The reference is taken before the jumps, so that the chains of the PU are
+	// deleted before the group if a jump fails
+	g.refs++
+	i.groups.pus[owner] = append(i.groups.pus[owner], key)
+
+	if err := i.ipt.Insert(table, chain, 1, "-j", g.rejectChain); err != nil {
+		return err
+	}
+
+	return i.ipt.Append(table, chain, "-j", g.acceptChain)
+}
+
+// createGroupChains creates the chains of a group with its ACLs
+func (i *Instance) createGroupChains(g *aclGroup, rules *policy.IPRuleList, add func(rejectChain, chain string, rules *policy.IPRuleList) error) error {
+
+	for _, chain := range []string{g.rejectChain, g.acceptChain} {
+		if err := i.ipt.NewChain(g.table, chain); err != nil {
+			log.WithFields(log.Fields{
+				"package": "iptablesctrl",
+				"chain":   chain,
+				"context": g.table,
+				"error":   err.Error(),
+			}).Debug("Failed to create the chain of the policy group")
+			return err
+		}
+	}
+
+	return add(g.rejectChain, g.acceptChain, rules)
+}
+
+// deleteGroupChains deletes the chains of a group
+func (i *Instance) deleteGroupChains(g *aclGroup) {
+
+	for _, chain := range []string{g.rejectChain, g.acceptChain} {
+		i.ipt.ClearChain(g.table, chain)
+		if err := i.ipt.DeleteChain(g.table, chain); err != nil {
+			log.WithFields(log.Fields{
+				"package": "iptablesctrl",
+				"chain":   chain,
+				"context": g.table,
+				"error":   err.Error(),
+			}).Debug("Failed to delete the chain of the policy group")
+		}
+	}
+}
+
+// releaseGroups releases the groups of the ACLs of a version of a PU, whose chains
+// must be deleted before. The groups without reference are deleted.
+func (i *Instance) releaseGroups(owner string) {
+
+	if i.groups == nil {
+		return
+	}
+
+	i.groups.Lock()
+	defer i.groups.Unlock()
+
+	for _, key := range i.groups.pus[owner] {
+		g, ok := i.groups.groups[key]
+		if !ok {
+			continue
+		}
+
+		g.refs--
+		if g.refs > 0 {
+			continue
+		}
+
+		i.deleteGroupChains(g)
+		delete(i.groups.groups, key)
+	}
+
+	delete(i.groups.pus, owner)
+}
+
+// resetGroups forgets the groups, whose chains were cleaned with the other chains
+// of trireme
+func (i *Instance) resetGroups() {
+
+	if i.groups == nil {
+		return
+	}
+
+	i.groups.Lock()
+	defer i.groups.Unlock()
+
+	i.groups.groups = map[string]*aclGroup{}
+	i.groups.pus = map[string][]string{}
+}
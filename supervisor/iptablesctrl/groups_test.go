@@ -0,0 +1,176 @@
+package iptablesctrl
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/policy"
+	"github.com/aporeto-inc/trireme/supervisor/provider"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// groupTestPU returns a container with the ACLs in both directions
+func groupTestPU(contextID, ip string, rules *policy.IPRuleList) *policy.PUInfo {
+
+	ipl := policy.NewIPMap(map[string]string{policy.DefaultNamespace: ip})
+
+	containerinfo := policy.NewPUInfo(contextID, constants.ContainerPU)
+	containerinfo.Policy = policy.NewPUPolicy(contextID, policy.Police, rules, rules, nil, nil, nil, nil, ipl, []string{"172.17.0.0/24"}, nil)
+	containerinfo.Runtime = policy.NewPURuntimeWithDefaults()
+
+	return containerinfo
+}
+
+func TestPolicyGroups(t *testing.T) {
+	Convey("Given an iptables controller with policy groups", t, func() {
+		i, _ := NewInstance("0:1", "2:3", 0x1000, constants.LocalContainer)
+		iptables := provider.NewTestIptablesProvider()
+		i.ipt = iptables
+		So(i.EnablePolicyGroups(), ShouldBeNil)
+
+		created := []string{}
+		deleted := []string{}
+		jumps := map[string][]string{}
+
+		iptables.MockNewChain(t, func(table, chain string) error {
+			created = append(created, chain)
+			return nil
+		})
+		iptables.MockDeleteChain(t, func(table, chain string) error {
+			deleted = append(deleted, chain)
+			return nil
+		})
+		iptables.MockInsert(t, func(table, chain string, pos int, rulespec ...string) error {
+			if len(rulespec) == 2 && strings.HasPrefix(rulespec[1], groupChainPrefix) {
+				jumps[chain] = append(jumps[chain], rulespec[1])
+			}
+			return nil
+		})
+		iptables.MockAppend(t, func(table, chain string, rulespec ...string) error {
+			if len(rulespec) == 2 && strings.HasPrefix(rulespec[1], groupChainPrefix) {
+				jumps[chain] = append(jumps[chain], rulespec[1])
+			}
+			return nil
+		})
+
+		groupChains := func(chains []string) []string {
+			groups := []string{}
+			for _, chain := range chains {
+				if strings.HasPrefix(chain, groupChainPrefix) {
+					groups = append(groups, chain)
+				}
+			}
+			return groups
+		}
+
+		web := policy.NewIPRuleList([]policy.IPRule{
+			{Address: "192.30.253.0/24", Port: "80", Protocol: "TCP", Action: policy.Reject},
+			{Address: "192.30.253.0/24", Port: "443", Protocol: "TCP", Action: policy.Accept},
+		})
+		dns := policy.NewIPRuleList([]policy.IPRule{
+			{Address: "8.8.8.8", Port: "53", Protocol: "UDP", Action: policy.Accept},
+		})
+
+		Convey("When two PUs with the same ACLs are configured", func() {
+			So(i.ConfigureRules(0, "pu1", groupTestPU("pu1", "172.17.0.1", web)), ShouldBeNil)
+			So(i.ConfigureRules(0, "pu2", groupTestPU("pu2", "172.17.0.2", web)), ShouldBeNil)
+
+			Convey("The chains of the ACLs should be created once", func() {
+				So(len(groupChains(created)), ShouldEqual, 4)
+
+				groups, refs := i.PolicyGroups()
+				So(groups, ShouldEqual, 2)
+				So(refs, ShouldEqual, 4)
+			})
+
+			Convey("The chains of both PUs should jump to the same groups", func() {
+				app1, net1 := i.chainName("pu1", 0)
+				app2, net2 := i.chainName("pu2", 0)
+				So(len(jumps[app1]), ShouldEqual, 2)
+				So(len(jumps[net1]), ShouldEqual, 2)
+				So(jumps[app1], ShouldResemble, jumps[app2])
+				So(jumps[net1], ShouldResemble, jumps[net2])
+				So(jumps[app1], ShouldNotResemble, jumps[net1])
+			})
+
+			Convey("When the first PU is deleted, the groups should be kept", func() {
+				So(i.DeleteRules(0, "pu1", policy.NewIPMap(map[string]string{policy.DefaultNamespace: "172.17.0.1"}), "", ""), ShouldBeNil)
+				So(groupChains(deleted), ShouldBeEmpty)
+
+				groups, refs := i.PolicyGroups()
+				So(groups, ShouldEqual, 2)
+				So(refs, ShouldEqual, 2)
+
+				Convey("When the last PU is deleted, the groups should be deleted", func() {
+					So(i.DeleteRules(0, "pu2", policy.NewIPMap(map[string]string{policy.DefaultNamespace: "172.17.0.2"}), "", ""), ShouldBeNil)
+					So(len(groupChains(deleted)), ShouldEqual, 4)
+
+					groups, refs := i.PolicyGroups()
+					So(groups, ShouldEqual, 0)
+					So(refs, ShouldEqual, 0)
+				})
+			})
+
+			Convey("When a PU is updated with other ACLs, it should move to another group", func() {
+				So(i.UpdateRules(1, "pu1", groupTestPU("pu1", "172.17.0.1", dns)), ShouldBeNil)
+				So(len(groupChains(created)), ShouldEqual, 8)
+				So(groupChains(deleted), ShouldBeEmpty)
+
+				groups, refs := i.PolicyGroups()
+				So(groups, ShouldEqual, 4)
+				So(refs, ShouldEqual, 4)
+
+				Convey("When the other PU is updated to the same ACLs, the old groups should be deleted", func() {
+					So(i.UpdateRules(1, "pu2", groupTestPU("pu2", "172.17.0.2", dns)), ShouldBeNil)
+					So(len(groupChains(created)), ShouldEqual, 8)
+					So(len(groupChains(deleted)), ShouldEqual, 4)
+
+					groups, refs := i.PolicyGroups()
+					So(groups, ShouldEqual, 2)
+					So(refs, ShouldEqual, 4)
+				})
+			})
+		})
+
+		Convey("When the accounting is enabled, the ACLs should not be shared", func() {
+			i.EnableAccounting()
+			So(i.ConfigureRules(0, "pu1", groupTestPU("pu1", "172.17.0.1", web)), ShouldBeNil)
+			So(groupChains(created), ShouldBeEmpty)
+		})
+
+		Convey("When the controller is stopped, the groups should be forgotten", func() {
+			So(i.ConfigureRules(0, "pu1", groupTestPU("pu1", "172.17.0.1", web)), ShouldBeNil)
+			So(i.Stop(), ShouldBeNil)
+
+			groups, _ := i.PolicyGroups()
+			So(groups, ShouldEqual, 0)
+		})
+	})
+
+	Convey("Given a DOCKER-USER iptables controller", t, func() {
+		i, _ := NewDockerUserInstance("0:1", "2:3", 0x1000, constants.LocalContainer)
+
+		Convey("The policy groups should not be supported", func() {
+			So(i.EnablePolicyGroups(), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestACLHash(t *testing.T) {
+	Convey("Given lists of ACLs", t, func() {
+		accept := policy.NewIPRuleList([]policy.IPRule{{Address: "10.0.0.0/8", Port: "80", Protocol: "TCP", Action: policy.Accept}})
+		mirrored := policy.NewIPRuleList([]policy.IPRule{{Address: "10.0.0.0/8", Port: "80", Protocol: "TCP", Action: policy.Accept | policy.Mirror}})
+		reject := policy.NewIPRuleList([]policy.IPRule{{Address: "10.0.0.0/8", Port: "80", Protocol: "TCP", Action: policy.Reject}})
+
+		Convey("The hash should only depend on the programmed rules", func() {
+			So(len(aclHash(accept)), ShouldEqual, groupHashLength)
+			So(aclHash(accept), ShouldEqual, aclHash(mirrored))
+			So(aclHash(accept), ShouldNotEqual, aclHash(reject))
+		})
+
+		Convey("The names of the chains of the groups should be valid", func() {
+			So(len(groupChainPrefix+aclHash(accept)+"-AR"), ShouldBeLessThanOrEqualTo, 28)
+		})
+	})
+}
@@ -2,12 +2,16 @@ package iptablesctrl
 
 import (
 	"fmt"
+	"os/exec"
 	"strconv"
+	"strings"
+	"sync"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/aporeto-inc/trireme/constants"
 	"github.com/aporeto-inc/trireme/monitor/linuxmonitor/cgnetcls"
 	"github.com/aporeto-inc/trireme/policy"
+	"github.com/aporeto-inc/trireme/utils/marks"
 
 	"github.com/aporeto-inc/trireme/supervisor/provider"
 )
@@ -16,6 +20,13 @@ const (
 	chainPrefix    = "TRIREME-"
 	appChainPrefix = chainPrefix + "App-"
 	netChainPrefix = chainPrefix + "Net-"
+
+	// dockerUserChain is the chain of the filter table that docker reserves for
+	// user rules. It is evaluated before any docker rule of the FORWARD chain.
+	dockerUserChain = "DOCKER-USER"
+	// dockerUserAnchorChain holds all the trireme rules of the filter table. It is
+	// the target of a single rule at the top of the DOCKER-USER chain.
+	dockerUserAnchorChain = chainPrefix + "DockerUser"
 )
 
 // Instance  is the structure holding all information about a implementation
@@ -27,11 +38,41 @@ type Instance struct {
 	appPacketIPTableContext    string
 	appAckPacketIPTableContext string
 	appPacketIPTableSection    string
+	appAckPacketIPTableSection string
 	netPacketIPTableContext    string
 	netPacketIPTableSection    string
 	appCgroupIPTableSection    string
 	appSynAckIPTableSection    string
+	acceptTarget               string
+	anchors                    []anchor
+	profile                    *Profile
+	bypass                     []string
 	mode                       constants.ModeType
+	controllerNetworks         []string
+	mtls                       *mtlsRedirect
+	markMask                   uint32
+	queuesDisabled             bool
+	listRules                  func() (string, error)
+	accounting                 bool
+	listChain                  func(table, chain string) ([]byte, error)
+	anyNetwork                 string
+	rejectWithICMP             string
+	groups                     *aclGroups
+	interfaces                 *puInterfaces
+}
+
+// interfaceChains are the chains of an additional interface of a PU
+type interfaceChains struct {
+	app string
+	net string
+	ip  string
+}
+
+// puInterfaces are the chains of the additional interfaces programmed for each
+// version of the PUs, by the application chain of the version
+type puInterfaces struct {
+	chains map[string][]*interfaceChains
+	sync.Mutex
 }
 
 // NewInstance creates a new iptables controller instance
@@ -50,7 +91,13 @@ func NewInstance(networkQueues, applicationQueues string, mark int, mode constan
 		appPacketIPTableContext:    "raw",
 		appAckPacketIPTableContext: "mangle",
 		netPacketIPTableContext:    "mangle",
+		acceptTarget:               "ACCEPT",
 		mode: mode,
+		listRules: iptablesSave,
+		listChain: listChain,
+		anyNetwork:     "0.0.0.0/0",
+		rejectWithICMP: "icmp-admin-prohibited",
+		interfaces:     &puInterfaces{chains: map[string][]*interfaceChains{}},
 	}
 
 	if mode == constants.LocalServer || mode == constants.RemoteContainer {
@@ -65,10 +112,76 @@ func NewInstance(networkQueues, applicationQueues string, mark int, mode constan
 		i.appSynAckIPTableSection = "INPUT"
 	}
 
+	i.appAckPacketIPTableSection = i.appPacketIPTableSection
+
 	return i, nil
 
 }
 
+// NewDockerUserInstance creates a new iptables controller instance that co-exists with
+// the iptables management of docker. The rules that filter the traffic of the containers
+// are installed in a trireme chain of the filter table anchored at the top of the
+// DOCKER-USER chain instead of the mangle table. Accepted packets return to the FORWARD
+// chain so that the docker rules still apply.
+func NewDockerUserInstance(networkQueues, applicationQueues string, mark int, mode constants.ModeType) (*Instance, error) {
+
+	if mode != constants.LocalContainer {
+		return nil, fmt.Errorf("DOCKER-USER integration is only supported for local containers")
+	}
+
+	i, err := NewInstance(networkQueues, applicationQueues, mark, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	i.appAckPacketIPTableContext = "filter"
+	i.appAckPacketIPTableSection = dockerUserAnchorChain
+	i.netPacketIPTableContext = "filter"
+	i.netPacketIPTableSection = dockerUserAnchorChain
+	i.acceptTarget = "RETURN"
+	i.anchors = []anchor{{table: "filter", hook: dockerUserChain, chain: dockerUserAnchorChain}}
+
+	return i, nil
+}
+
+// IPv6Instance returns an instance programming the ip6tables rules of the IPv6
+// addresses with the configuration of the instance. The chains have the same names
+// as the ones of the iptables rules, since the tables of the families are distinct.
+func (i *Instance) IPv6Instance() (*Instance, error) {
+
+	ipt, err := provider.NewGoIP6TablesProvider()
+	if err != nil {
+		return nil, fmt.Errorf("Cannot initialize IP6tables provider")
+	}
+
+	i6 := *i
+	i6.ipt = ipt
+	i6.controllerNetworks = policy.FamilyNetworks(i.controllerNetworks, policy.IPv6)
+	i6.listRules = ip6tablesSave
+	i6.listChain = listChain6
+	i6.anyNetwork = "::/0"
+	i6.rejectWithICMP = "icmp6-adm-prohibited"
+	i6.interfaces = &puInterfaces{chains: map[string][]*interfaceChains{}}
+
+	if i.profile != nil {
+		i6.bypass = i.profile.Bypass6
+	}
+
+	if i.mtls != nil {
+		i6.mtls = &mtlsRedirect{
+			networks:   policy.FamilyNetworks(i.mtls.networks, policy.IPv6),
+			clientPort: i.mtls.clientPort,
+			serverPort: i.mtls.serverPort,
+		}
+	}
+
+	if i.groups != nil {
+		i6.groups = newACLGroups()
+	}
+
+	return &i6, nil
+}
+
 // chainPrefix returns the chain name for the specific PU
 func (i *Instance) chainName(contextID string, version int) (app, net string) {
 	app = appChainPrefix + contextID + "-" + strconv.Itoa(version)
@@ -84,10 +197,10 @@ func (i *Instance) defaultIP(addresslist map[string]string) (string, bool) {
 	}
 
 	if i.mode == constants.LocalContainer {
-		return "0.0.0.0/0", false
+		return i.anyNetwork, false
 	}
 
-	return "0.0.0.0/0", true
+	return i.anyNetwork, true
 }
 
 // ConfigureRules implmenets the ConfigureRules interface
@@ -129,19 +242,35 @@ func (i *Instance) ConfigureRules(version int, contextID string, containerInfo *
 		}
 	}
 
+	if err := i.addDNSRules(appChain, containerInfo.Policy.DNSPolicy()); err != nil {
+		return err
+	}
+
+	if err := i.addTrustedNetworks(appChain, netChain, containerInfo.Policy.TrustedNetworks()); err != nil {
+		return err
+	}
+
 	if err := i.addPacketTrap(appChain, netChain, ipAddress, containerInfo.Policy.TriremeNetworks()); err != nil {
 		return err
 	}
 
-	if err := i.addAppACLs(appChain, ipAddress, policyrules.ApplicationACLs()); err != nil {
+	if err := i.addUDPPacketTrap(appChain, netChain, containerInfo.Policy); err != nil {
 		return err
 	}
 
-	if err := i.addNetACLs(netChain, ipAddress, policyrules.NetworkACLs()); err != nil {
+	if err := i.addACLs(appChain, netChain, ipAddress, policyrules); err != nil {
 		return err
 	}
 
-	return nil
+	if err := i.addMirrorRules(appChain, netChain, policyrules); err != nil {
+		return err
+	}
+
+	if err := i.addAccountingRules(appChain, netChain); err != nil {
+		return err
+	}
+
+	return i.configureInterfaces(version, contextID, containerInfo)
 }
 
 // DeleteRules implements the DeleteRules interface
@@ -169,8 +298,9 @@ func (i *Instance) DeleteRules(version int, contextID string, ipAddresses *polic
 	}
 
 	i.deleteAllContainerChains(appChain, netChain)
+	i.releaseGroups(appChain)
 
-	return nil
+	return i.deleteInterfaces(version, contextID)
 }
 
 // UpdateRules implements the update part of the interface
@@ -200,15 +330,31 @@ func (i *Instance) UpdateRules(version int, contextID string, containerInfo *pol
 		return err
 	}
 
+	if err := i.addDNSRules(appChain, containerInfo.Policy.DNSPolicy()); err != nil {
+		return err
+	}
+
+	if err := i.addTrustedNetworks(appChain, netChain, containerInfo.Policy.TrustedNetworks()); err != nil {
+		return err
+	}
+
 	if err := i.addPacketTrap(appChain, netChain, ipAddress, containerInfo.Policy.TriremeNetworks()); err != nil {
 		return err
 	}
 
-	if err := i.addAppACLs(appChain, ipAddress, policyrules.ApplicationACLs()); err != nil {
+	if err := i.addUDPPacketTrap(appChain, netChain, containerInfo.Policy); err != nil {
 		return err
 	}
 
-	if err := i.addNetACLs(netChain, ipAddress, policyrules.NetworkACLs()); err != nil {
+	if err := i.addACLs(appChain, netChain, ipAddress, policyrules); err != nil {
+		return err
+	}
+
+	if err := i.addMirrorRules(appChain, netChain, policyrules); err != nil {
+		return err
+	}
+
+	if err := i.addAccountingRules(appChain, netChain); err != nil {
 		return err
 	}
 
@@ -249,14 +395,122 @@ func (i *Instance) UpdateRules(version int, contextID string, containerInfo *pol
 		}
 	}
 
-	// Delete the old chain to clean up
-	if err := i.deleteAllContainerChains(oldAppChain, oldNetChain); err != nil {
+	// Delete the old chain to clean up, then the groups it was the last to use
+	err := i.deleteAllContainerChains(oldAppChain, oldNetChain)
+	i.releaseGroups(oldAppChain)
+	if err != nil {
+		return err
+	}
+
+	if err := i.configureInterfaces(version, contextID, containerInfo); err != nil {
 		return err
 	}
 
+	return i.deleteInterfaces(version-1, contextID)
+}
+
+// interfaceChainName returns the chain names for an additional interface of the PU
+func (i *Instance) interfaceChainName(contextID string, version int, index int) (app, net string) {
+	app, net = i.chainName(contextID, version)
+	suffix := "-" + strconv.Itoa(index+1)
+	return app + suffix, net + suffix
+}
+
+// configureInterfaces programs the chains of the additional interfaces of a multi-homed
+// container. Each interface gets the section of the policy of its network. The chains
+// are recorded with the version, so that they are deleted with the addresses they
+// were programmed for.
+func (i *Instance) configureInterfaces(version int, contextID string, containerInfo *policy.PUInfo) error {
+
+	if i.mode != constants.LocalContainer {
+		return nil
+	}
+
+	owner, _ := i.chainName(contextID, version)
+	ips := containerInfo.Policy.IPAddresses()
+	defaultIP, _ := i.defaultIP(ips.IPs)
+
+	for index, network := range ips.AdditionalNetworks() {
+
+		ipAddress := ips.IPs[network]
+		if ipAddress == defaultIP {
+			continue
+		}
+
+		appChain, netChain := i.interfaceChainName(contextID, version, index)
+		policyrules := containerInfo.Policy.PolicyForNetwork(network)
+
+		if err := i.addContainerChain(appChain, netChain); err != nil {
+			return err
+		}
+
+		i.interfaces.Lock()
+		i.interfaces.chains[owner] = append(i.interfaces.chains[owner], &interfaceChains{app: appChain, net: netChain, ip: ipAddress})
+		i.interfaces.Unlock()
+
+		if err := i.addDNSRules(appChain, containerInfo.Policy.DNSPolicy()); err != nil {
+			return err
+		}
+
+		if err := i.addTrustedNetworks(appChain, netChain, policyrules.TrustedNetworks()); err != nil {
+			return err
+		}
+
+		if err := i.addPacketTrap(appChain, netChain, ipAddress, policyrules.TriremeNetworks()); err != nil {
+			return err
+		}
+
+		if err := i.addUDPPacketTrap(appChain, netChain, policyrules); err != nil {
+			return err
+		}
+
+		if err := i.addAppACLs(appChain, ipAddress, policyrules.ApplicationACLs()); err != nil {
+			return err
+		}
+
+		if err := i.addNetACLs(netChain, ipAddress, policyrules.NetworkACLs()); err != nil {
+			return err
+		}
+
+		if err := i.addMirrorRules(appChain, netChain, policyrules); err != nil {
+			return err
+		}
+
+		if err := i.addChainRules(appChain, netChain, ipAddress, "", ""); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// deleteInterfaces removes the chains of the additional interfaces recorded for a
+// version of a multi-homed container. All the chains are removed, and the first
+// failure is returned.
+func (i *Instance) deleteInterfaces(version int, contextID string) error {
+
+	owner, _ := i.chainName(contextID, version)
+
+	i.interfaces.Lock()
+	chains := i.interfaces.chains[owner]
+	delete(i.interfaces.chains, owner)
+	i.interfaces.Unlock()
+
+	var failure error
+
+	for _, c := range chains {
+		if err := i.deleteChainRules(c.app, c.net, c.ip, "", ""); err != nil && failure == nil {
+			failure = fmt.Errorf("Cannot delete the rules of the interface %s: %s", c.ip, err)
+		}
+
+		if err := i.deleteAllContainerChains(c.app, c.net); err != nil && failure == nil {
+			failure = fmt.Errorf("Cannot delete the chains of the interface %s: %s", c.ip, err)
+		}
+	}
+
+	return failure
+}
+
 // Start starts the iptables controller
 func (i *Instance) Start() error {
 	log.WithFields(log.Fields{
@@ -266,6 +520,14 @@ func (i *Instance) Start() error {
 	// Clean any previous ACLs
 	i.cleanACLs()
 
+	if err := i.checkMarks(); err != nil {
+		return err
+	}
+
+	if err := i.addAnchor(); err != nil {
+		return err
+	}
+
 	if i.mode == constants.LocalContainer {
 		if i.acceptMarkedPackets() != nil {
 			log.WithFields(log.Fields{
@@ -277,7 +539,7 @@ func (i *Instance) Start() error {
 	}
 
 	// Explicit rule to capture all SynAck packets
-	if i.mode != constants.LocalContainer {
+	if i.mode != constants.LocalContainer && !i.queuesDisabled {
 		if err := i.CaptureSYNACKPackets(); err != nil {
 			log.WithFields(log.Fields{"package": "supervisor",
 				"Error": err.Error(),
@@ -286,7 +548,12 @@ func (i *Instance) Start() error {
 		}
 	}
 
-	return nil
+	// The sections were cleaned, so the controller rules must be installed again
+	if err := i.processRulesFromList(i.controllerRules(i.controllerNetworks), "Insert"); err != nil {
+		return err
+	}
+
+	return i.processRulesFromList(i.mtlsRedirectRules(), "Insert")
 }
 
 // Stop stops the supervisor
@@ -311,3 +578,103 @@ func (i *Instance) RemoveExcludedIP(ip []string) error {
 
 	return i.deleteExclusionChainRules(ip)
 }
+
+// SetControllerNetworks replaces the networks of the controller. The traffic of the
+// connections of the agent to the controller is accepted ahead of any policy.
+func (i *Instance) SetControllerNetworks(networks []string) error {
+
+	i.processRulesFromList(i.controllerRules(i.controllerNetworks), "Delete")
+
+	i.controllerNetworks = networks
+
+	return i.processRulesFromList(i.controllerRules(networks), "Insert")
+}
+
+// DisableQueues stops sending the packets to the netfilter queues, the packets being
+// captured by other means. The rules with a NFQUEUE target are not installed.
+func (i *Instance) DisableQueues() {
+
+	i.queuesDisabled = true
+}
+
+// SetMarkMask restricts the rules to the bits of the packet mark owned by trireme
+func (i *Instance) SetMarkMask(mask uint32) error {
+
+	if err := marks.Validate(mask, uint32(i.mark)); err != nil {
+		return err
+	}
+
+	i.markMask = mask
+
+	return nil
+}
+
+// checkMarks refuses to start when the rules of other tools use the bits of the
+// mark mask configured for trireme. The trireme rules must be cleaned before. Without
+// a configured mask, the rules using the bits of the trireme mark are only reported,
+// since trireme does not claim the whole mark from the other tools.
+func (i *Instance) checkMarks() error {
+
+	rules, err := i.listRules()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"package": "iptablesctrl",
+			"error":   err.Error(),
+		}).Warn("Cannot list the iptables rules to detect mark collisions")
+		return nil
+	}
+
+	bits := i.markMask
+	if bits == 0 {
+		bits = uint32(i.mark)
+	}
+
+	diagnosis := []string{}
+
+	for _, conflict := range marks.Conflicts(rules, bits, chainPrefix) {
+		if strings.Contains(conflict.Rule, "Trireme") {
+			continue
+		}
+
+		diagnosis = append(diagnosis, conflict.String())
+	}
+
+	if len(diagnosis) == 0 {
+		return nil
+	}
+
+	if i.markMask == 0 {
+		log.WithFields(log.Fields{
+			"package":   "iptablesctrl",
+			"mark":      marks.Spec(uint32(i.mark), i.markMask),
+			"conflicts": strings.Join(diagnosis, "; "),
+		}).Warn("Packet mark collides with other rules, configure a mark and a mark mask excluding their bits")
+		return nil
+	}
+
+	return fmt.Errorf("Packet mark %s collides with other rules, configure a mark and a mark mask excluding their bits: %s",
+		marks.Spec(uint32(i.mark), i.markMask), strings.Join(diagnosis, "; "))
+}
+
+// iptablesSave returns the rules of all the tables
+func iptablesSave() (string, error) {
+
+	return saveRules("iptables-save")
+}
+
+// ip6tablesSave returns the ip6tables rules of all the tables
+func ip6tablesSave() (string, error) {
+
+	return saveRules("ip6tables-save")
+}
+
+// saveRules returns the output of the save command of a family
+func saveRules(command string) (string, error) {
+
+	output, err := exec.Command(command).Output()
+	if err != nil {
+		return "", err
+	}
+
+	return string(output), nil
+}
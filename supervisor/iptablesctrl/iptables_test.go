@@ -2,6 +2,7 @@ package iptablesctrl
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/aporeto-inc/trireme/constants"
@@ -45,6 +46,91 @@ func TestNewInstance(t *testing.T) {
 	})
 }
 
+func TestNewDockerUserInstance(t *testing.T) {
+
+	Convey("When I create a new DOCKER-USER iptables instance", t, func() {
+
+		Convey("If I create a local container implementation", func() {
+			i, err := NewDockerUserInstance("0:1", "2:3", 0x1000, constants.LocalContainer)
+			Convey("It should succeed and use the anchor chain of the filter table", func() {
+				So(err, ShouldBeNil)
+				So(i, ShouldNotBeNil)
+				So(i.appPacketIPTableContext, ShouldResemble, "raw")
+				So(i.appPacketIPTableSection, ShouldResemble, "PREROUTING")
+				So(i.appAckPacketIPTableContext, ShouldResemble, "filter")
+				So(i.appAckPacketIPTableSection, ShouldResemble, dockerUserAnchorChain)
+				So(i.netPacketIPTableContext, ShouldResemble, "filter")
+				So(i.netPacketIPTableSection, ShouldResemble, dockerUserAnchorChain)
+				So(i.acceptTarget, ShouldResemble, "RETURN")
+			})
+		})
+
+		Convey("If I create a local server implementation", func() {
+			i, err := NewDockerUserInstance("0:1", "2:3", 0x1000, constants.LocalServer)
+			Convey("It should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(i, ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestIPv6Instance(t *testing.T) {
+
+	Convey("Given a DOCKER-USER iptables instance with controller networks of both families", t, func() {
+		i, _ := NewDockerUserInstance("0:1", "2:3", 0x1000, constants.LocalContainer)
+		i.controllerNetworks = []string{"10.1.0.0/16", "fd00:1::/64"}
+
+		Convey("When I create its IPv6 instance", func() {
+			i6, err := i.IPv6Instance()
+
+			Convey("It should keep the configuration and program the IPv6 rules", func() {
+				So(err, ShouldBeNil)
+				So(i6.netPacketIPTableSection, ShouldEqual, dockerUserAnchorChain)
+				So(i6.acceptTarget, ShouldEqual, "RETURN")
+				So(i6.controllerNetworks, ShouldResemble, []string{"fd00:1::/64"})
+				So(i6.anyNetwork, ShouldEqual, "::/0")
+				So(i.anyNetwork, ShouldEqual, "0.0.0.0/0")
+				So(i6.rejectTarget("filter", policy.IPRule{Protocol: "udp", Action: policy.Reject | policy.Reset}), ShouldResemble, []string{"-j", "REJECT", "--reject-with", "icmp6-adm-prohibited"})
+			})
+
+			Convey("When I configure the rules of an IPv6 container", func() {
+				iptables := provider.NewTestIptablesProvider()
+				i6.ipt = iptables
+
+				rules := []string{}
+				iptables.MockAppend(t, func(table string, chain string, rulespec ...string) error {
+					rules = append(rules, fmt.Sprint(rulespec))
+					return nil
+				})
+				iptables.MockInsert(t, func(table string, chain string, pos int, rulespec ...string) error {
+					rules = append(rules, fmt.Sprint(rulespec))
+					return nil
+				})
+				iptables.MockNewChain(t, func(table string, chain string) error {
+					return nil
+				})
+
+				ipl := policy.NewIPMap(map[string]string{policy.DefaultNamespace: "fd00::2"})
+				acls := policy.NewIPRuleList([]policy.IPRule{{Address: "fd00:2::/64", Port: "443", Protocol: "tcp", Action: policy.Accept}})
+				containerinfo := policy.NewPUInfo("Context", constants.ContainerPU)
+				containerinfo.Policy = policy.NewPUPolicy("Context", policy.Police, acls, acls, nil, nil, nil, nil, ipl, []string{"fd00::/8"}, nil)
+				containerinfo.Runtime = policy.NewPURuntimeWithDefaults()
+
+				err := i6.ConfigureRules(1, "Context", containerinfo)
+
+				Convey("The rules should match the IPv6 addresses", func() {
+					So(err, ShouldBeNil)
+					So(rules, ShouldContain, fmt.Sprint([]string{"-d", "::/0", "-j", "DROP"}))
+					for _, rule := range rules {
+						So(strings.Contains(rule, "0.0.0.0/0"), ShouldBeFalse)
+					}
+				})
+			})
+		})
+	})
+}
+
 func TestChainName(t *testing.T) {
 	Convey("When I test the creation of the name of the chain", t, func() {
 		i, _ := NewInstance("0:1", "2:3", 0x1000, constants.LocalContainer)
@@ -163,6 +249,106 @@ func TestConfigureRules(t *testing.T) {
 
 		})
 
+		Convey("With a multi-homed container and a policy for its second network", func() {
+
+			ipl := policy.NewIPMap(map[string]string{})
+			ipl.IPs[policy.DefaultNamespace] = "172.17.0.1"
+			ipl.IPs["macvlan"] = "10.0.0.5"
+			policyrules := policy.NewPUPolicy("Context",
+				policy.Police,
+				rules,
+				rules,
+				nil,
+				nil,
+				nil,
+				nil, ipl, []string{"172.17.0.0/24"}, nil)
+
+			policyrules.SetNetworkPolicy("macvlan", &policy.NetworkPolicy{
+				ApplicationACLs: policy.NewIPRuleList([]policy.IPRule{
+					policy.IPRule{
+						Address:  "10.0.0.0/8",
+						Port:     "443",
+						Protocol: "TCP",
+						Action:   policy.Accept,
+					},
+				}),
+			})
+
+			containerinfo := policy.NewPUInfo("Context", constants.ContainerPU)
+			containerinfo.Policy = policyrules
+			containerinfo.Runtime = policy.NewPURuntimeWithDefaults()
+
+			chains := map[string]bool{}
+			inserts := map[string]int{}
+			jumps := map[string]bool{}
+
+			iptables.MockAppend(t, func(table string, chain string, rulespec ...string) error {
+				if rulespec[len(rulespec)-1] == "TRIREME-App-Context-1-1" {
+					jumps[rulespec[1]] = true
+				}
+				return nil
+			})
+			iptables.MockInsert(t, func(table string, chain string, pos int, rulespec ...string) error {
+				inserts[chain]++
+				return nil
+			})
+			iptables.MockNewChain(t, func(table string, chain string) error {
+				chains[chain] = true
+				return nil
+			})
+
+			err := i.ConfigureRules(1, "Context", containerinfo)
+			Convey("It should program a chain per interface with the policy of its network", func() {
+				So(err, ShouldBeNil)
+				So(chains["TRIREME-App-Context-1-1"], ShouldBeTrue)
+				So(chains["TRIREME-Net-Context-1-1"], ShouldBeTrue)
+				So(jumps["10.0.0.5"], ShouldBeTrue)
+				So(inserts["TRIREME-App-Context-1"], ShouldEqual, 1)
+				So(inserts["TRIREME-App-Context-1-1"], ShouldEqual, 0)
+				So(inserts["TRIREME-Net-Context-1-1"], ShouldEqual, 1)
+			})
+
+			Convey("When I delete the rules with addresses without the second network", func() {
+				deletedRules := map[string]bool{}
+				deletedChains := map[string]bool{}
+				iptables.MockDelete(t, func(table string, chain string, rulespec ...string) error {
+					if rulespec[len(rulespec)-1] == "TRIREME-App-Context-1-1" {
+						deletedRules[rulespec[1]] = true
+					}
+					return nil
+				})
+				iptables.MockDeleteChain(t, func(table string, chain string) error {
+					deletedChains[chain] = true
+					return nil
+				})
+
+				ips := policy.NewIPMap(map[string]string{policy.DefaultNamespace: "172.17.0.1"})
+				err := i.DeleteRules(1, "Context", ips, "", "")
+
+				Convey("The chains of the interface should be deleted with its address", func() {
+					So(err, ShouldBeNil)
+					So(deletedRules["10.0.0.5"], ShouldBeTrue)
+					So(deletedChains["TRIREME-App-Context-1-1"], ShouldBeTrue)
+					So(deletedChains["TRIREME-Net-Context-1-1"], ShouldBeTrue)
+				})
+			})
+
+			Convey("When the rules of the interface cannot be deleted", func() {
+				iptables.MockDelete(t, func(table string, chain string, rulespec ...string) error {
+					if rulespec[len(rulespec)-1] == "TRIREME-App-Context-1-1" {
+						return fmt.Errorf("error")
+					}
+					return nil
+				})
+
+				err := i.DeleteRules(1, "Context", ipl, "", "")
+
+				Convey("I should receive an error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+
 		Convey("With a set of policy rules and invalid IP", func() {
 			ipl := policy.NewIPMap(map[string]string{})
 			policyrules := policy.NewPUPolicy("Context",
@@ -454,6 +640,116 @@ func TestStart(t *testing.T) {
 	})
 }
 
+func TestStartMarkConflicts(t *testing.T) {
+	Convey("Given an iptables controller on a host where kube-proxy marks packets", t, func() {
+		i, _ := NewInstance("0:1", "2:3", 0x1000, constants.LocalContainer)
+		iptables := provider.NewTestIptablesProvider()
+		i.ipt = iptables
+		i.listRules = func() (string, error) {
+			return "*nat\n-A KUBE-MARK-MASQ -j MARK --set-xmark 0x4000/0x4000\nCOMMIT\n", nil
+		}
+		iptables.MockListChains(t, func(table string) ([]string, error) {
+			return []string{}, nil
+		})
+
+		Convey("When I start the controller without a mask", func() {
+			err := i.Start()
+			Convey("I should get no error", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When I start the controller without a mask and a mark used by kube-proxy", func() {
+			i.mark = 0x4000
+			err := i.Start()
+			Convey("I should only get a warning", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When I start the controller with a mask including the bits of kube-proxy", func() {
+			So(i.SetMarkMask(0xf000), ShouldBeNil)
+			err := i.Start()
+			Convey("I should get an error naming the rule", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "KUBE-MARK-MASQ")
+			})
+		})
+
+		Convey("When I start the controller with a mask excluding the bits of kube-proxy", func() {
+			So(i.SetMarkMask(0x3000), ShouldBeNil)
+			err := i.Start()
+			Convey("I should get no error", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When I configure a mask that does not contain the mark", func() {
+			err := i.SetMarkMask(0xff)
+			Convey("I should get an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestStartDockerUser(t *testing.T) {
+	Convey("Given a DOCKER-USER iptables controller", t, func() {
+		i, _ := NewDockerUserInstance("0:1", "2:3", 0x1000, constants.LocalContainer)
+		iptables := provider.NewTestIptablesProvider()
+		i.ipt = iptables
+
+		iptables.MockDelete(t, func(table string, chain string, rulespec ...string) error {
+			return nil
+		})
+		iptables.MockClearChain(t, func(table string, chain string) error {
+			So(chain, ShouldNotEqual, dockerUserChain)
+			return nil
+		})
+		iptables.MockListChains(t, func(table string) ([]string, error) {
+			return []string{}, nil
+		})
+
+		Convey("When I start the controller", func() {
+			anchored := false
+			iptables.MockNewChain(t, func(table string, chain string) error {
+				So(table, ShouldEqual, "filter")
+				So(chain, ShouldEqual, dockerUserAnchorChain)
+				return nil
+			})
+			iptables.MockInsert(t, func(table string, chain string, pos int, rulespec ...string) error {
+				if chain == dockerUserChain {
+					So(pos, ShouldEqual, 1)
+					So(rulespec[len(rulespec)-1], ShouldEqual, dockerUserAnchorChain)
+					anchored = true
+				}
+				return nil
+			})
+			err := i.Start()
+			Convey("The trireme chain should be anchored at the top of DOCKER-USER", func() {
+				So(err, ShouldBeNil)
+				So(anchored, ShouldBeTrue)
+			})
+		})
+
+		Convey("When I start the controller and DOCKER-USER does not exist", func() {
+			iptables.MockNewChain(t, func(table string, chain string) error {
+				return nil
+			})
+			iptables.MockInsert(t, func(table string, chain string, pos int, rulespec ...string) error {
+				if chain == dockerUserChain {
+					return fmt.Errorf("No chain/target/match by that name")
+				}
+				return nil
+			})
+			err := i.Start()
+			Convey("I should get an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
 func TestStop(t *testing.T) {
 	Convey("Given an iptables controller", t, func() {
 		i, _ := NewInstance("0:1", "2:3", 0x1000, constants.RemoteContainer)
@@ -534,3 +830,95 @@ func TestRemoveExcludedIP(t *testing.T) {
 
 	})
 }
+
+// chainSimulator keeps the order of the rules of the chains
+type chainSimulator struct {
+	chains map[string][][]string
+}
+
+func newChainSimulator(t *testing.T, iptables provider.TestIptablesProvider) *chainSimulator {
+
+	c := &chainSimulator{chains: map[string][][]string{}}
+
+	iptables.MockAppend(t, func(table string, chain string, rulespec ...string) error {
+		c.chains[table+"/"+chain] = append(c.chains[table+"/"+chain], rulespec)
+		return nil
+	})
+	iptables.MockInsert(t, func(table string, chain string, pos int, rulespec ...string) error {
+		c.chains[table+"/"+chain] = append([][]string{rulespec}, c.chains[table+"/"+chain]...)
+		return nil
+	})
+	iptables.MockDelete(t, func(table string, chain string, rulespec ...string) error {
+		rules := [][]string{}
+		for _, rule := range c.chains[table+"/"+chain] {
+			if fmt.Sprint(rule) != fmt.Sprint(rulespec) {
+				rules = append(rules, rule)
+			}
+		}
+		c.chains[table+"/"+chain] = rules
+		return nil
+	})
+	iptables.MockClearChain(t, func(table string, chain string) error {
+		delete(c.chains, table+"/"+chain)
+		return nil
+	})
+	iptables.MockListChains(t, func(table string) ([]string, error) {
+		return []string{}, nil
+	})
+
+	return c
+}
+
+func TestControllerNetworks(t *testing.T) {
+
+	Convey("Given an iptables controller for Local Server with the controller network set", t, func() {
+		i, _ := NewInstance("0:1", "2:3", 0x1000, constants.LocalServer)
+		iptables := provider.NewTestIptablesProvider()
+		i.ipt = iptables
+		chains := newChainSimulator(t, iptables)
+
+		So(i.SetControllerNetworks([]string{"10.0.0.5/32"}), ShouldBeNil)
+		section := i.netPacketIPTableContext + "/" + i.netPacketIPTableSection
+
+		Convey("When the controller starts and a PU rejecting all the traffic is added", func() {
+			So(i.Start(), ShouldBeNil)
+			So(i.addChainRules("appchain", "netchain", "", "1:65535", "100"), ShouldBeNil)
+
+			Convey("The controller traffic should be accepted before any other rule", func() {
+				So(len(chains.chains[section]), ShouldEqual, 3)
+				So(matchSpec("10.0.0.5/32", chains.chains[section][0]), ShouldBeNil)
+				So(matchSpec("ESTABLISHED", chains.chains[section][0]), ShouldBeNil)
+				So(matchSpec("ACCEPT", chains.chains[section][0]), ShouldBeNil)
+			})
+		})
+
+		Convey("When the controller network changes", func() {
+			So(i.SetControllerNetworks([]string{"10.0.1.0/24"}), ShouldBeNil)
+
+			Convey("Only the new network should be accepted", func() {
+				So(len(chains.chains[section]), ShouldEqual, 1)
+				So(matchSpec("10.0.1.0/24", chains.chains[section][0]), ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given a DOCKER-USER iptables controller with the controller network set", t, func() {
+		i, _ := NewDockerUserInstance("0:1", "2:3", 0x1000, constants.LocalContainer)
+		iptables := provider.NewTestIptablesProvider()
+		i.ipt = iptables
+		iptables.MockNewChain(t, func(table string, chain string) error {
+			return nil
+		})
+		chains := newChainSimulator(t, iptables)
+
+		So(i.SetControllerNetworks([]string{"10.0.0.5/32"}), ShouldBeNil)
+
+		Convey("The controller traffic should return to the docker chains", func() {
+			So(i.Start(), ShouldBeNil)
+
+			rules := chains.chains["filter/"+dockerUserAnchorChain]
+			So(matchSpec("10.0.0.5/32", rules[0]), ShouldBeNil)
+			So(matchSpec("RETURN", rules[0]), ShouldBeNil)
+		})
+	})
+}
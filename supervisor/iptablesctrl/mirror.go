@@ -0,0 +1,134 @@
+package iptablesctrl
+
+import (
+	"fmt"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aporeto-inc/trireme/policy"
+)
+
+// mirrorTarget returns the target copying the packets to the destination of the
+// mirror policy, preceded by the rate limit of the policy
+func (i *Instance) mirrorTarget(mirror *policy.MirrorPolicy) ([]string, error) {
+
+	if err := mirror.Validate(); err != nil {
+		return nil, err
+	}
+
+	target := []string{}
+
+	if mirror.RateLimit > 0 {
+		limit := strconv.Itoa(mirror.RateLimit)
+		target = append(target, "-m", "limit", "--limit", limit+"/second", "--limit-burst", limit)
+	}
+
+	switch mirror.Target {
+	case policy.MirrorGateway:
+		// The TEE target is only available in the mangle table
+		if i.appAckPacketIPTableContext != "mangle" || i.netPacketIPTableContext != "mangle" {
+			return nil, fmt.Errorf("Mirror gateway is not supported by this implementation")
+		}
+		target = append(target, "-j", "TEE", "--gateway", mirror.Gateway)
+
+	case policy.MirrorNFLOG:
+		target = append(target, "-j", "NFLOG", "--nflog-group", strconv.Itoa(mirror.Group))
+		if mirror.HeadersOnly {
+			target = append(target, "--nflog-size", strconv.Itoa(policy.MirrorHeadersLength))
+		}
+	}
+
+	return target, nil
+}
+
+// mirrorMatches returns the matches of the packets of both directions of the flows
+// of an ACL. The matches of the packets sent by the PU come first.
+func mirrorMatches(rule policy.IPRule, outgoing bool) (sent []string, received []string) {
+
+	sent = []string{"-p", rule.Protocol, "-d", rule.Address}
+	received = []string{"-p", rule.Protocol, "-s", rule.Address}
+
+	if rule.Protocol != "TCP" && rule.Protocol != "UDP" {
+		return sent, received
+	}
+
+	// The port of an application ACL is the port of the peer, the port of a network
+	// ACL is the port of the PU
+	if outgoing {
+		return append(sent, "--dport", rule.Port), append(received, "--sport", rule.Port)
+	}
+
+	return append(sent, "--sport", rule.Port), append(received, "--dport", rule.Port)
+}
+
+// mirrorRules returns the rules copying the packets of the mirrored ACLs of the
+// policy. The rules do not terminate the packets, which are then filtered by the
+// other rules of the chains.
+func (i *Instance) mirrorRules(appChain string, netChain string, p *policy.PUPolicy) ([][]string, error) {
+
+	rules := [][]string{}
+
+	appACLs := p.ApplicationACLs()
+	netACLs := p.NetworkACLs()
+
+	if !appACLs.Mirrored() && !netACLs.Mirrored() {
+		return rules, nil
+	}
+
+	mirror := p.MirrorPolicy()
+	if mirror == nil {
+		return nil, fmt.Errorf("Mirrored rules without mirror policy")
+	}
+
+	target, err := i.mirrorTarget(mirror)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, acls := range []struct {
+		rules    *policy.IPRuleList
+		outgoing bool
+	}{
+		{appACLs, true},
+		{netACLs, false},
+	} {
+		for _, rule := range acls.rules.Rules {
+			if rule.Action&policy.Mirror == 0 {
+				continue
+			}
+
+			sent, received := mirrorMatches(rule, acls.outgoing)
+
+			rules = append(rules,
+				append(append([]string{i.appAckPacketIPTableContext, appChain}, sent...), target...),
+				append(append([]string{i.netPacketIPTableContext, netChain}, received...), target...),
+			)
+		}
+	}
+
+	return rules, nil
+}
+
+// addMirrorRules adds the rules of the mirrored ACLs at the top of the chains of a
+// PU, so that they see all the packets of the flows
+func (i *Instance) addMirrorRules(appChain string, netChain string, p *policy.PUPolicy) error {
+
+	rules, err := i.mirrorRules(appChain, netChain, p)
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		if err := i.ipt.Insert(rule[0], rule[1], 1, rule[2:]...); err != nil {
+			log.WithFields(log.Fields{
+				"package": "iptablesctrl",
+				"context": rule[0],
+				"chain":   rule[1],
+				"error":   err.Error(),
+			}).Debug("Failed to add a mirror rule")
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package iptablesctrl
+
+import (
+	"testing"
+
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/policy"
+	"github.com/aporeto-inc/trireme/supervisor/provider"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func mirrorPolicy(mirror *policy.MirrorPolicy) *policy.PUPolicy {
+
+	appACLs := policy.NewIPRuleList([]policy.IPRule{
+		{Address: "10.1.0.0/16", Port: "5432", Protocol: "TCP", Action: policy.Accept | policy.Mirror},
+		{Address: "10.2.0.0/16", Port: "80", Protocol: "TCP", Action: policy.Accept},
+	})
+	netACLs := policy.NewIPRuleList([]policy.IPRule{
+		{Address: "10.3.0.0/16", Port: "443", Protocol: "TCP", Action: policy.Reject | policy.Mirror},
+		{Address: "10.4.0.0/16", Protocol: "icmp", Action: policy.Accept | policy.Mirror},
+	})
+
+	p := policy.NewPUPolicy("pu", policy.Police, appACLs, netACLs, nil, nil, nil, nil, nil, nil, nil)
+	p.UpdateMirrorPolicy(mirror)
+
+	return p
+}
+
+func TestMirrorRules(t *testing.T) {
+	Convey("Given an iptables controller", t, func() {
+		i, _ := NewInstance("0:1", "2:3", 0x1000, constants.LocalContainer)
+		iptables := provider.NewTestIptablesProvider()
+		i.ipt = iptables
+
+		Convey("When no ACL is mirrored, there should be no rule", func() {
+			p := policy.NewPUPolicy("pu", policy.Police, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+			rules, err := i.mirrorRules("app", "net", p)
+			So(err, ShouldBeNil)
+			So(rules, ShouldBeEmpty)
+		})
+
+		Convey("When ACLs are mirrored without mirror policy, it should fail", func() {
+			_, err := i.mirrorRules("app", "net", mirrorPolicy(nil))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("When the mirror policy is invalid, it should fail", func() {
+			_, err := i.mirrorRules("app", "net", mirrorPolicy(&policy.MirrorPolicy{Target: policy.MirrorGateway, Gateway: "10.0.0.1", HeadersOnly: true}))
+			So(err, ShouldNotBeNil)
+
+			_, err = i.mirrorRules("app", "net", mirrorPolicy(&policy.MirrorPolicy{Target: "erspan"}))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("When the ACLs are mirrored to a gateway, both directions of their flows should be copied", func() {
+			rules, err := i.mirrorRules("app", "net", mirrorPolicy(&policy.MirrorPolicy{Target: policy.MirrorGateway, Gateway: "10.0.0.1", RateLimit: 100}))
+			So(err, ShouldBeNil)
+
+			target := []string{"-m", "limit", "--limit", "100/second", "--limit-burst", "100", "-j", "TEE", "--gateway", "10.0.0.1"}
+			So(rules, ShouldResemble, [][]string{
+				append([]string{"mangle", "app", "-p", "TCP", "-d", "10.1.0.0/16", "--dport", "5432"}, target...),
+				append([]string{"mangle", "net", "-p", "TCP", "-s", "10.1.0.0/16", "--sport", "5432"}, target...),
+				append([]string{"mangle", "app", "-p", "TCP", "-d", "10.3.0.0/16", "--sport", "443"}, target...),
+				append([]string{"mangle", "net", "-p", "TCP", "-s", "10.3.0.0/16", "--dport", "443"}, target...),
+				append([]string{"mangle", "app", "-p", "icmp", "-d", "10.4.0.0/16"}, target...),
+				append([]string{"mangle", "net", "-p", "icmp", "-s", "10.4.0.0/16"}, target...),
+			})
+		})
+
+		Convey("When the headers of the ACLs are logged, the packets should be truncated", func() {
+			rules, err := i.mirrorRules("app", "net", mirrorPolicy(&policy.MirrorPolicy{Target: policy.MirrorNFLOG, Group: 5, HeadersOnly: true}))
+			So(err, ShouldBeNil)
+			So(len(rules), ShouldEqual, 6)
+			So(rules[0], ShouldResemble, []string{"mangle", "app", "-p", "TCP", "-d", "10.1.0.0/16", "--dport", "5432", "-j", "NFLOG", "--nflog-group", "5", "--nflog-size", "128"})
+		})
+
+		Convey("When the mirror rules are added, they should be inserted at the top of the chains", func() {
+			inserted := 0
+			iptables.MockInsert(t, func(table string, chain string, pos int, rulespec ...string) error {
+				So(pos, ShouldEqual, 1)
+				inserted++
+				return nil
+			})
+
+			err := i.addMirrorRules("app", "net", mirrorPolicy(&policy.MirrorPolicy{Target: policy.MirrorNFLOG, Group: 5}))
+			So(err, ShouldBeNil)
+			So(inserted, ShouldEqual, 6)
+		})
+	})
+}
+
+func TestMirrorGatewayDockerUser(t *testing.T) {
+	Convey("Given an iptables controller in the filter table", t, func() {
+		i, _ := NewDockerUserInstance("0:1", "2:3", 0x1000, constants.LocalContainer)
+
+		Convey("When the ACLs are mirrored to a gateway, it should fail", func() {
+			_, err := i.mirrorRules("app", "net", mirrorPolicy(&policy.MirrorPolicy{Target: policy.MirrorGateway, Gateway: "10.0.0.1"}))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("When the ACLs are logged, it should succeed", func() {
+			rules, err := i.mirrorRules("app", "net", mirrorPolicy(&policy.MirrorPolicy{Target: policy.MirrorNFLOG}))
+			So(err, ShouldBeNil)
+			So(rules[0][0], ShouldEqual, "filter")
+		})
+	})
+}
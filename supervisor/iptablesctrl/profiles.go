@@ -0,0 +1,260 @@
+package iptablesctrl
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aporeto-inc/trireme/constants"
+)
+
+// Profile is a co-existence profile with the firewall manager of the host. By default
+// the trireme rules are installed in the built-in chains of the hooks of netfilter,
+// which are cleared when the controller starts, and the rules of the other managers
+// of these chains are lost. With a profile, the trireme rules are installed in
+// trireme chains anchored in the hooks by a single rule, whose position is chosen
+// for the firewall manager. Custom profiles can be defined for other managers.
+type Profile struct {
+	// Name is the name of the profile
+	Name string
+
+	// HookSuffix anchors the trireme chains in the chains of the firewall manager
+	// named after the hooks with the suffix, like the direct chains of firewalld,
+	// instead of the built-in chains of the hooks
+	HookSuffix string
+
+	// After are the prefixes of the chains of the firewall manager that keep their
+	// precedence over trireme. The anchors are inserted after the last rule jumping
+	// to one of them, and at the top of the hooks otherwise.
+	After []string
+
+	// Return accepts the packets with a RETURN target, so that the rules of the
+	// firewall manager after the anchors still apply to the accepted packets. The
+	// policy groups are not supported since the PU chains cannot accept packets.
+	Return bool
+
+	// Bypass are the ipsets of type hash:ip,port of the IPv4 destinations whose
+	// packets received by the host bypass the trireme rules, like the virtual IPs
+	// of the services of IPVS, whose connections are forwarded to other hosts
+	Bypass []string
+
+	// Bypass6 are the ipsets of the IPv6 destinations that bypass the trireme rules
+	Bypass6 []string
+}
+
+var (
+	// ProfileFirewalld anchors the trireme chains in the direct chains of firewalld,
+	// which are kept when firewalld adds its rules. The accepted packets return to
+	// the zones of firewalld.
+	ProfileFirewalld = Profile{
+		Name:       "firewalld",
+		HookSuffix: "_direct",
+		Return:     true,
+	}
+
+	// ProfileUFW anchors the trireme chains at the top of the hooks. ufw only manages
+	// the filter table, but its rules of the hooks must not be cleared.
+	ProfileUFW = Profile{
+		Name: "ufw",
+	}
+
+	// ProfileKubeProxyIPTables anchors the trireme chains after the chains of
+	// kube-proxy, which translates the addresses of the services first
+	ProfileKubeProxyIPTables = Profile{
+		Name:  "kube-proxy-iptables",
+		After: []string{"KUBE-"},
+	}
+
+	// ProfileKubeProxyIPVS anchors the trireme chains after the chains of kube-proxy
+	// in IPVS mode. The cluster IPs are local addresses of the hosts in this mode,
+	// and the connections to the services are forwarded by IPVS without the trireme
+	// rules of the local PUs.
+	ProfileKubeProxyIPVS = Profile{
+		Name:    "kube-proxy-ipvs",
+		After:   []string{"KUBE-"},
+		Bypass:  []string{"KUBE-CLUSTER-IP"},
+		Bypass6: []string{"KUBE-6-CLUSTER-IP"},
+	}
+
+	// ProfileCalico anchors the trireme chains after the chains of Calico, which
+	// keeps its rules at the top of the hooks and inserts them again otherwise
+	ProfileCalico = Profile{
+		Name:  "calico",
+		After: []string{"cali-"},
+	}
+)
+
+// profiles are the predefined profiles by name
+var profiles = map[string]Profile{
+	ProfileFirewalld.Name:         ProfileFirewalld,
+	ProfileUFW.Name:               ProfileUFW,
+	ProfileKubeProxyIPTables.Name: ProfileKubeProxyIPTables,
+	ProfileKubeProxyIPVS.Name:     ProfileKubeProxyIPVS,
+	ProfileCalico.Name:            ProfileCalico,
+}
+
+// ProfileByName returns the predefined profile of a firewall manager
+func ProfileByName(name string) (*Profile, error) {
+
+	profile, ok := profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown firewall profile %s", name)
+	}
+
+	return &profile, nil
+}
+
+// anchor is a trireme chain anchored in a hook
+type anchor struct {
+	table string
+	// hook is the chain of the anchor rule
+	hook string
+	// builtin is the built-in chain of the hook
+	builtin string
+	chain   string
+	// bypass returns the packets of the bypassed destinations to the hook
+	bypass bool
+}
+
+// SetProfile installs the rules in trireme chains anchored as the profile requires.
+// It must be called before Start.
+func (i *Instance) SetProfile(profile *Profile) error {
+
+	if i.profile != nil {
+		return fmt.Errorf("Firewall profile %s is already set", i.profile.Name)
+	}
+
+	if len(i.anchors) > 0 {
+		return fmt.Errorf("Firewall profiles are not supported with the DOCKER-USER integration")
+	}
+
+	if profile.Return && i.groups != nil {
+		return fmt.Errorf("Firewall profile %s does not support the policy groups", profile.Name)
+	}
+
+	i.profile = profile
+	i.bypass = profile.Bypass
+
+	if profile.Return {
+		i.acceptTarget = "RETURN"
+	}
+
+	// The raw table is only used by the local containers, and the cgroups by the
+	// other PUs
+	if i.mode == constants.LocalContainer {
+		i.appPacketIPTableSection = i.anchorSection(i.appPacketIPTableContext, i.appPacketIPTableSection, false)
+	}
+
+	i.appAckPacketIPTableSection = i.anchorSection(i.appAckPacketIPTableContext, i.appAckPacketIPTableSection, false)
+
+	if i.mode != constants.LocalContainer {
+		i.appCgroupIPTableSection = i.anchorSection(i.appAckPacketIPTableContext, i.appCgroupIPTableSection, false)
+	}
+
+	i.netPacketIPTableSection = i.anchorSection(i.netPacketIPTableContext, i.netPacketIPTableSection, true)
+
+	return nil
+}
+
+// anchorSection returns the trireme chain anchored in the hook of a section
+func (i *Instance) anchorSection(table, section string, bypass bool) string {
+
+	for _, a := range i.anchors {
+		if a.table == table && a.builtin == section {
+			return a.chain
+		}
+	}
+
+	a := anchor{
+		table:   table,
+		hook:    section + i.profile.HookSuffix,
+		builtin: section,
+		chain:   chainPrefix + section,
+		bypass:  bypass,
+	}
+
+	i.anchors = append(i.anchors, a)
+
+	return a.chain
+}
+
+// builtinHook returns the built-in chain of the hook of a section
+func (i *Instance) builtinHook(section string) string {
+
+	for _, a := range i.anchors {
+		if a.chain == section && a.builtin != "" {
+			return a.builtin
+		}
+	}
+
+	return section
+}
+
+// anchorPosition returns the position of the anchor rule in its hook
+func (i *Instance) anchorPosition(a anchor) (int, error) {
+
+	if i.profile == nil || len(i.profile.After) == 0 {
+		return 1, nil
+	}
+
+	listing, err := i.listChain(a.table, a.hook)
+	if err != nil {
+		return 0, fmt.Errorf("Cannot list the rules of %s: %s", a.hook, err)
+	}
+
+	return lastJump(listing, i.profile.After) + 1, nil
+}
+
+// lastJump returns the number of the last rule of a verbose listing of a chain that
+// jumps to a chain with one of the prefixes, or zero if there is none
+func lastJump(listing []byte, prefixes []string) int {
+
+	last := 0
+	number := 0
+
+	scanner := bufio.NewScanner(bytes.NewReader(listing))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+
+		if _, err := strconv.ParseUint(fields[0], 10, 64); err != nil {
+			continue
+		}
+
+		number++
+
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(fields[2], prefix) {
+				last = number
+			}
+		}
+	}
+
+	return last
+}
+
+// addBypassRules returns the packets of the bypassed destinations to the hooks of
+// the network anchors, ahead of the rules of the PUs
+func (i *Instance) addBypassRules() error {
+
+	for _, a := range i.anchors {
+		if !a.bypass {
+			continue
+		}
+
+		for _, set := range i.bypass {
+			if err := i.ipt.Append(a.table, a.chain,
+				"-m", "set", "--match-set", set, "dst,dst",
+				"-m", "comment", "--comment", "Trireme bypass",
+				"-j", "RETURN"); err != nil {
+				return fmt.Errorf("Cannot bypass the destinations of %s: %s", set, err)
+			}
+		}
+	}
+
+	return nil
+}
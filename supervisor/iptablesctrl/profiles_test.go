@@ -0,0 +1,230 @@
+package iptablesctrl
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/supervisor/provider"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// profileListing is the verbose listing of the mangle PREROUTING chain of a host
+// running Calico
+const profileListing = `Chain PREROUTING (policy ACCEPT 0 packets, 0 bytes)
+    pkts      bytes target     prot opt in     out     source               destination
+    1024    65536 cali-PREROUTING  all  --  *      *       0.0.0.0/0            0.0.0.0/0            /* cali:6gwbT8clXdHdC1b1 */
+      12      720 MARK       all  --  *      *       0.0.0.0/0            0.0.0.0/0            MARK set 0x1
+       3      180 cali-from-host-endpoint  all  --  *      *       0.0.0.0/0            0.0.0.0/0
+       0        0            all  --  *      *       10.0.0.0/8           0.0.0.0/0
+`
+
+// startProfile starts the controller and returns the rules inserted and appended
+// in the chains and the cleared chains
+func startProfile(t *testing.T, i *Instance) (inserted map[string]int, appended []string, cleared []string, err error) {
+
+	iptables := provider.NewTestIptablesProvider()
+	i.ipt = iptables
+
+	inserted = map[string]int{}
+
+	iptables.MockInsert(t, func(table string, chain string, pos int, rulespec ...string) error {
+		if len(rulespec) == 6 && rulespec[3] == "Trireme anchor" {
+			inserted[table+" "+chain+" "+rulespec[5]] = pos
+		}
+		return nil
+	})
+	iptables.MockAppend(t, func(table string, chain string, rulespec ...string) error {
+		appended = append(appended, table+" "+chain+" "+fmt.Sprint(rulespec))
+		return nil
+	})
+	iptables.MockDelete(t, func(table string, chain string, rulespec ...string) error {
+		return nil
+	})
+	iptables.MockNewChain(t, func(table string, chain string) error {
+		return nil
+	})
+	iptables.MockClearChain(t, func(table string, chain string) error {
+		cleared = append(cleared, chain)
+		return nil
+	})
+	iptables.MockListChains(t, func(table string) ([]string, error) {
+		return []string{}, nil
+	})
+
+	err = i.Start()
+
+	return inserted, appended, cleared, err
+}
+
+func TestProfileByName(t *testing.T) {
+
+	Convey("The predefined profiles should be found by name", t, func() {
+		for _, name := range []string{"firewalld", "ufw", "kube-proxy-iptables", "kube-proxy-ipvs", "calico"} {
+			profile, err := ProfileByName(name)
+			So(err, ShouldBeNil)
+			So(profile.Name, ShouldEqual, name)
+		}
+
+		Convey("The profiles should be copies", func() {
+			profile, _ := ProfileByName("calico")
+			profile.After = nil
+			So(ProfileCalico.After, ShouldResemble, []string{"cali-"})
+		})
+
+		Convey("An unknown profile should be an error", func() {
+			_, err := ProfileByName("iptables")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestLastJump(t *testing.T) {
+
+	Convey("The anchors should be after the last jump to the chains of the manager", t, func() {
+		So(lastJump([]byte(profileListing), []string{"cali-"}), ShouldEqual, 3)
+		So(lastJump([]byte(profileListing), []string{"KUBE-"}), ShouldEqual, 0)
+		So(lastJump([]byte{}, []string{"cali-"}), ShouldEqual, 0)
+	})
+}
+
+func TestSetProfile(t *testing.T) {
+
+	Convey("Given an iptables controller of local containers", t, func() {
+		i, _ := NewInstance("0:1", "2:3", 0x1000, constants.LocalContainer)
+
+		Convey("When I set the profile of Calico", func() {
+			So(i.SetProfile(&ProfileCalico), ShouldBeNil)
+
+			Convey("The rules should be installed in the anchored trireme chains", func() {
+				So(i.appPacketIPTableSection, ShouldEqual, "TRIREME-PREROUTING")
+				So(i.appAckPacketIPTableSection, ShouldEqual, "TRIREME-PREROUTING")
+				So(i.netPacketIPTableSection, ShouldEqual, "TRIREME-POSTROUTING")
+				So(i.acceptTarget, ShouldEqual, "ACCEPT")
+				So(len(i.anchors), ShouldEqual, 3)
+			})
+
+			Convey("The mutual TLS redirection should stay in the built-in chain of the nat table", func() {
+				So(i.SetMTLSRedirect([]string{"10.0.0.0/8"}, 1000, 1001), ShouldBeNil)
+				rules := i.mtlsRedirectRules()
+				So(rules[0][0], ShouldEqual, "nat")
+				So(rules[0][1], ShouldEqual, "PREROUTING")
+			})
+
+			Convey("When I start the controller", func() {
+				listed := []string{}
+				i.listChain = func(table, chain string) ([]byte, error) {
+					listed = append(listed, table+" "+chain)
+					if table == "mangle" && chain == "PREROUTING" {
+						return []byte(profileListing), nil
+					}
+					return []byte{}, nil
+				}
+
+				inserted, _, cleared, err := startProfile(t, i)
+
+				Convey("The anchors should be inserted after the chains of Calico", func() {
+					So(err, ShouldBeNil)
+					So(inserted["mangle PREROUTING TRIREME-PREROUTING"], ShouldEqual, 4)
+					So(inserted["raw PREROUTING TRIREME-PREROUTING"], ShouldEqual, 1)
+					So(inserted["mangle POSTROUTING TRIREME-POSTROUTING"], ShouldEqual, 1)
+					So(listed, ShouldContain, "mangle PREROUTING")
+				})
+
+				Convey("The built-in chains of the hooks should not be cleared", func() {
+					So(cleared, ShouldNotContain, "PREROUTING")
+					So(cleared, ShouldNotContain, "POSTROUTING")
+					So(cleared, ShouldContain, "TRIREME-PREROUTING")
+				})
+			})
+
+			Convey("When I start the controller and the hook cannot be listed", func() {
+				i.listChain = func(table, chain string) ([]byte, error) {
+					return nil, fmt.Errorf("iptables: No chain/target/match by that name")
+				}
+
+				_, _, _, err := startProfile(t, i)
+
+				Convey("I should get an error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey("Another profile should be rejected", func() {
+				So(i.SetProfile(&ProfileUFW), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When I set the profile of firewalld", func() {
+			So(i.SetProfile(&ProfileFirewalld), ShouldBeNil)
+
+			Convey("The packets should be accepted by returning to the hooks", func() {
+				So(i.acceptTarget, ShouldEqual, "RETURN")
+				So(i.EnablePolicyGroups(), ShouldNotBeNil)
+			})
+
+			Convey("The anchors should be at the top of the direct chains", func() {
+				inserted, _, _, err := startProfile(t, i)
+				So(err, ShouldBeNil)
+				So(inserted["raw PREROUTING_direct TRIREME-PREROUTING"], ShouldEqual, 1)
+				So(inserted["mangle PREROUTING_direct TRIREME-PREROUTING"], ShouldEqual, 1)
+				So(inserted["mangle POSTROUTING_direct TRIREME-POSTROUTING"], ShouldEqual, 1)
+			})
+		})
+
+		Convey("When the policy groups are enabled", func() {
+			So(i.EnablePolicyGroups(), ShouldBeNil)
+
+			Convey("The profiles returning the packets should be rejected", func() {
+				So(i.SetProfile(&ProfileFirewalld), ShouldNotBeNil)
+				So(i.SetProfile(&ProfileCalico), ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given an iptables controller of local servers with the profile of kube-proxy in IPVS mode", t, func() {
+		i, _ := NewInstance("0:1", "2:3", 0x1000, constants.LocalServer)
+		So(i.SetProfile(&ProfileKubeProxyIPVS), ShouldBeNil)
+		i.listChain = func(table, chain string) ([]byte, error) {
+			return []byte{}, nil
+		}
+
+		Convey("The application and the cgroup rules should share the anchor of the output hook", func() {
+			So(i.appAckPacketIPTableSection, ShouldEqual, "TRIREME-OUTPUT")
+			So(i.appCgroupIPTableSection, ShouldEqual, "TRIREME-OUTPUT")
+			So(i.netPacketIPTableSection, ShouldEqual, "TRIREME-INPUT")
+			So(i.appPacketIPTableSection, ShouldEqual, "OUTPUT")
+			So(len(i.anchors), ShouldEqual, 2)
+		})
+
+		Convey("When I start the controller", func() {
+			inserted, appended, _, err := startProfile(t, i)
+
+			Convey("The cluster IPs should bypass the network rules", func() {
+				So(err, ShouldBeNil)
+				So(inserted["mangle INPUT TRIREME-INPUT"], ShouldEqual, 1)
+				So(appended, ShouldResemble, []string{
+					"mangle TRIREME-INPUT [-m set --match-set KUBE-CLUSTER-IP dst,dst -m comment --comment Trireme bypass -j RETURN]",
+				})
+			})
+		})
+
+		Convey("When I create its IPv6 instance", func() {
+			i6, err := i.IPv6Instance()
+
+			Convey("The IPv6 cluster IPs should bypass the network rules", func() {
+				So(err, ShouldBeNil)
+				So(i6.bypass, ShouldResemble, []string{"KUBE-6-CLUSTER-IP"})
+				So(i6.netPacketIPTableSection, ShouldEqual, "TRIREME-INPUT")
+			})
+		})
+	})
+
+	Convey("Given a DOCKER-USER iptables controller", t, func() {
+		i, _ := NewDockerUserInstance("0:1", "2:3", 0x1000, constants.LocalContainer)
+
+		Convey("The profiles should not be supported", func() {
+			So(i.SetProfile(&ProfileUFW), ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,56 @@
+package iptablesctrl
+
+import (
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/policy"
+	"github.com/aporeto-inc/trireme/utils/features"
+)
+
+// udpTrapRules provides the rules that send the UDP packets exchanged with a network
+// to the enforcer, which authorizes the UDP flows with tokens. All the packets are
+// sent since the tokens are removed from the datagrams of a flow until it is
+// replied, and a flow without replies is never established.
+func (i *Instance) udpTrapRules(appChain string, netChain string, network string, appQueue string, netQueue string) [][]string {
+
+	appContext := i.appAckPacketIPTableContext
+	if i.mode == constants.LocalContainer {
+		appContext = i.appPacketIPTableContext
+	}
+
+	return [][]string{
+		{
+			appContext, appChain,
+			"-d", network,
+			"-p", "udp",
+			"-m", "comment", "--comment", "Trireme UDP enforcement",
+			"-j", "NFQUEUE", "--queue-balance", appQueue,
+		},
+		{
+			i.netPacketIPTableContext, netChain,
+			"-s", network,
+			"-p", "udp",
+			"-m", "comment", "--comment", "Trireme UDP enforcement",
+			"-j", "NFQUEUE", "--queue-balance", netQueue,
+		},
+	}
+}
+
+// addUDPPacketTrap adds the rules sending the UDP packets exchanged with the Trireme
+// networks to the enforcer when the policy enables the UDP enforcement. They must be
+// added after the DNS rules, which accept the queries of the allowed servers.
+func (i *Instance) addUDPPacketTrap(appChain string, netChain string, policyrules *policy.PUPolicy) error {
+
+	if !policyrules.FeatureEnabled(string(features.UDPEnforcement)) {
+		return nil
+	}
+
+	for _, network := range policyrules.TriremeNetworks() {
+
+		err := i.processRulesFromList(i.udpTrapRules(appChain, netChain, network, i.applicationQueues, i.networkQueues), "Append")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
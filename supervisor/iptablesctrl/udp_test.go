@@ -0,0 +1,78 @@
+package iptablesctrl
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/policy"
+	"github.com/aporeto-inc/trireme/supervisor/provider"
+	"github.com/aporeto-inc/trireme/utils/features"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAddUDPPacketTrap(t *testing.T) {
+
+	Convey("Given an iptables controller for LocalContainer", t, func() {
+		i, _ := NewInstance("0:1", "2:3", 0x1000, constants.LocalContainer)
+		iptables := provider.NewTestIptablesProvider()
+		i.ipt = iptables
+
+		rules := [][]string{}
+		iptables.MockAppend(t, func(table string, chain string, rulespec ...string) error {
+			rules = append(rules, append([]string{table, chain}, rulespec...))
+			return nil
+		})
+
+		p := policy.NewPUPolicy("pu", policy.Police, nil, nil, nil, nil, nil, nil, nil, []string{"10.0.0.0/8", "172.17.0.0/16"}, nil)
+
+		Convey("When the policy does not enable the UDP enforcement, there should be no rule", func() {
+			So(i.addUDPPacketTrap("appchain", "netchain", p), ShouldBeNil)
+			So(rules, ShouldBeEmpty)
+		})
+
+		Convey("When the policy enables the UDP enforcement", func() {
+			p.UpdateFeatures([]string{string(features.UDPEnforcement)})
+			err := i.addUDPPacketTrap("appchain", "netchain", p)
+
+			Convey("Then the UDP packets of the Trireme networks should be queued", func() {
+				So(err, ShouldBeNil)
+				So(len(rules), ShouldEqual, 4)
+				So(rules[0], ShouldResemble, []string{
+					i.appPacketIPTableContext, "appchain",
+					"-d", "10.0.0.0/8",
+					"-p", "udp",
+					"-m", "comment", "--comment", "Trireme UDP enforcement",
+					"-j", "NFQUEUE", "--queue-balance", "2:3",
+				})
+				So(rules[1], ShouldResemble, []string{
+					i.netPacketIPTableContext, "netchain",
+					"-s", "10.0.0.0/8",
+					"-p", "udp",
+					"-m", "comment", "--comment", "Trireme UDP enforcement",
+					"-j", "NFQUEUE", "--queue-balance", "0:1",
+				})
+				So(rules[3][3], ShouldEqual, "172.17.0.0/16")
+			})
+		})
+
+		Convey("When the rules cannot be added, I should get an error", func() {
+			p.UpdateFeatures([]string{string(features.UDPEnforcement)})
+			iptables.MockAppend(t, func(table string, chain string, rulespec ...string) error {
+				return fmt.Errorf("Error")
+			})
+
+			So(i.addUDPPacketTrap("appchain", "netchain", p), ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given an iptables controller for LocalServer", t, func() {
+		i, _ := NewInstance("0:1", "2:3", 0x1000, constants.LocalServer)
+
+		Convey("The application packets should be queued in the table of the ack packets", func() {
+			rules := i.udpTrapRules("appchain", "netchain", "10.0.0.0/8", "2:3", "0:1")
+			So(len(rules), ShouldEqual, 2)
+			So(rules[0][0], ShouldEqual, i.appAckPacketIPTableContext)
+		})
+	})
+}
@@ -0,0 +1,219 @@
+package supervisor
+
+import (
+	"fmt"
+
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/policy"
+	"github.com/aporeto-inc/trireme/supervisor/ipsetctrl"
+	"github.com/aporeto-inc/trireme/supervisor/iptablesctrl"
+	"github.com/aporeto-inc/trireme/utils/errortypes"
+	"github.com/aporeto-inc/trireme/utils/features"
+)
+
+// puFamilies are the families whose rules are programmed for a PU
+type puFamilies struct {
+	ipv4 bool
+	ipv6 bool
+}
+
+// has returns true if the rules of the family are programmed
+func (f puFamilies) has(family policy.IPFamily) bool {
+
+	if family == policy.IPv6 {
+		return f.ipv6
+	}
+
+	return f.ipv4
+}
+
+// familyImplementor is the implementation programming the rules of a family
+type familyImplementor struct {
+	family policy.IPFamily
+	impl   Implementor
+}
+
+// EnableIPv6 implements the IPv6Configurer interface
+func (s *Config) EnableIPv6() error {
+
+	if s.ipv6 != nil {
+		return nil
+	}
+
+	var impl Implementor
+
+	switch i := s.impl.(type) {
+	case *iptablesctrl.Instance:
+		i6, err := i.IPv6Instance()
+		if err != nil {
+			return err
+		}
+		impl = i6
+	case *ipsetctrl.Instance:
+		i6, err := i.IPv6Instance()
+		if err != nil {
+			return err
+		}
+		impl = i6
+	default:
+		return fmt.Errorf("Supervisor implementation does not support IPv6")
+	}
+
+	s.ipv6 = impl
+
+	return nil
+}
+
+// implementations returns the implementations of the enabled families
+func (s *Config) implementations() []familyImplementor {
+
+	implementations := []familyImplementor{{family: policy.IPv4, impl: s.impl}}
+	if s.ipv6 != nil {
+		implementations = append(implementations, familyImplementor{family: policy.IPv6, impl: s.ipv6})
+	}
+
+	return implementations
+}
+
+// families returns the families of the rules of a PU. The local containers have the
+// rules of the families of their addresses, like both families for the dual-stack
+// containers. The other PUs are not restricted to an address and have the rules of
+// both families when the policy enables IPv6.
+func (s *Config) families(containerInfo *policy.PUInfo) (puFamilies, error) {
+
+	enabled := s.ipv6 != nil && containerInfo.Policy.FeatureEnabled(string(features.IPv6))
+
+	if s.mode != constants.LocalContainer {
+		return puFamilies{ipv4: true, ipv6: enabled}, nil
+	}
+
+	families := puFamilies{}
+	for _, ip := range containerInfo.Policy.IPAddresses().IPs {
+		if policy.FamilyOf(ip) == policy.IPv4 {
+			families.ipv4 = true
+			continue
+		}
+
+		if !enabled {
+			return puFamilies{}, errortypes.Errorf(errortypes.ErrPolicyRejected, "Cannot enforce the policy of the IPv6 address %s without IPv6 enabled", ip)
+		}
+		families.ipv6 = true
+	}
+
+	if !families.ipv4 && !families.ipv6 {
+		families.ipv4 = true
+	}
+
+	return families, nil
+}
+
+// familyInfo returns the PU restricted to the addresses and the rules of the family.
+// The first address of the family of a local container becomes its default address
+// when its default address is of the other family. Without IPv6, the implementation
+// receives the PU as it is, unless its default address is promoted.
+func (s *Config) familyInfo(containerInfo *policy.PUInfo, family policy.IPFamily) *policy.PUInfo {
+
+	p := containerInfo.Policy
+	if s.ipv6 != nil {
+		p = p.PolicyForFamily(family)
+	}
+
+	if s.mode == constants.LocalContainer {
+		p = p.PromoteDefaultNetwork()
+	}
+
+	if p == containerInfo.Policy {
+		return containerInfo
+	}
+
+	return policy.PUInfoFromPolicyAndRuntime(containerInfo.ContextID, p, containerInfo.Runtime)
+}
+
+// familyIPs returns the addresses of the family, with the same default address as
+// the PU returned by familyInfo
+func (s *Config) familyIPs(ips *policy.IPMap, family policy.IPFamily) *policy.IPMap {
+
+	if s.ipv6 != nil {
+		ips = ips.Family(family)
+	}
+
+	if s.mode == constants.LocalContainer {
+		ips, _ = ips.PromoteDefault()
+	}
+
+	return ips
+}
+
+// familyNetworks returns the networks of the family
+func (s *Config) familyNetworks(networks []string, family policy.IPFamily) []string {
+
+	if s.ipv6 == nil {
+		return networks
+	}
+
+	return policy.FamilyNetworks(networks, family)
+}
+
+// configureRules configures the rules of a version of a PU for its families
+func (s *Config) configureRules(version int, contextID string, containerInfo *policy.PUInfo, families puFamilies) error {
+
+	for _, f := range s.implementations() {
+		if !families.has(f.family) {
+			continue
+		}
+
+		if err := f.impl.ConfigureRules(version, contextID, s.familyInfo(containerInfo, f.family)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// updateRules replaces the rules of the previous version of a PU. The rules of a
+// family the PU gained are configured, and the ones of a family it lost are deleted.
+func (s *Config) updateRules(cachedEntry *cacheData, contextID string, containerInfo *policy.PUInfo, families puFamilies) error {
+
+	version := cachedEntry.version
+	previous := cachedEntry.families
+	cachedEntry.families = families
+
+	for _, f := range s.implementations() {
+
+		var err error
+
+		switch {
+		case previous.has(f.family) && families.has(f.family):
+			err = f.impl.UpdateRules(version, contextID, s.familyInfo(containerInfo, f.family))
+		case families.has(f.family):
+			err = f.impl.ConfigureRules(version, contextID, s.familyInfo(containerInfo, f.family))
+		case previous.has(f.family):
+			err = f.impl.DeleteRules(version-1, contextID, s.familyIPs(cachedEntry.ips, f.family), cachedEntry.port, cachedEntry.mark)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteRules deletes the rules of a version of a PU for its families. All the rules
+// are deleted even if some deletions fail, and the first error is returned.
+func (s *Config) deleteRules(version int, contextID string, ips *policy.IPMap, port string, mark string, families puFamilies) error {
+
+	var first error
+
+	for _, f := range s.implementations() {
+		if !families.has(f.family) {
+			continue
+		}
+
+		if err := f.impl.DeleteRules(version, contextID, s.familyIPs(ips, f.family), port, mark); err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
@@ -90,14 +90,76 @@ func (_m *MockExcluder) EXPECT() *_MockExcluderRecorder {
 	return _m.recorder
 }
 
-func (_m *MockExcluder) AddExcludedIP(ip []string) error {
-	ret := _m.ctrl.Call(_m, "AddExcludedIP", ip)
+func (_m *MockExcluder) AddExcludedIPs(ips []string) error {
+	ret := _m.ctrl.Call(_m, "AddExcludedIPs", ips)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockExcluderRecorder) AddExcludedIP(arg0 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "AddExcludedIP", arg0)
+func (_mr *_MockExcluderRecorder) AddExcludedIPs(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "AddExcludedIPs", arg0)
+}
+
+// Mock of ControllerProtector interface
+type MockControllerProtector struct {
+	ctrl     *gomock.Controller
+	recorder *_MockControllerProtectorRecorder
+}
+
+// Recorder for MockControllerProtector (not exported)
+type _MockControllerProtectorRecorder struct {
+	mock *MockControllerProtector
+}
+
+func NewMockControllerProtector(ctrl *gomock.Controller) *MockControllerProtector {
+	mock := &MockControllerProtector{ctrl: ctrl}
+	mock.recorder = &_MockControllerProtectorRecorder{mock}
+	return mock
+}
+
+func (_m *MockControllerProtector) EXPECT() *_MockControllerProtectorRecorder {
+	return _m.recorder
+}
+
+func (_m *MockControllerProtector) SetControllerNetworks(networks []string) error {
+	ret := _m.ctrl.Call(_m, "SetControllerNetworks", networks)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockControllerProtectorRecorder) SetControllerNetworks(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetControllerNetworks", arg0)
+}
+
+// Mock of MTLSRedirector interface
+type MockMTLSRedirector struct {
+	ctrl     *gomock.Controller
+	recorder *_MockMTLSRedirectorRecorder
+}
+
+// Recorder for MockMTLSRedirector (not exported)
+type _MockMTLSRedirectorRecorder struct {
+	mock *MockMTLSRedirector
+}
+
+func NewMockMTLSRedirector(ctrl *gomock.Controller) *MockMTLSRedirector {
+	mock := &MockMTLSRedirector{ctrl: ctrl}
+	mock.recorder = &_MockMTLSRedirectorRecorder{mock}
+	return mock
+}
+
+func (_m *MockMTLSRedirector) EXPECT() *_MockMTLSRedirectorRecorder {
+	return _m.recorder
+}
+
+func (_m *MockMTLSRedirector) SetMTLSRedirect(networks []string, clientPort int, serverPort int) error {
+	ret := _m.ctrl.Call(_m, "SetMTLSRedirect", networks, clientPort, serverPort)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockMTLSRedirectorRecorder) SetMTLSRedirect(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetMTLSRedirect", arg0, arg1, arg2)
 }
 
 // Mock of Implementor interface
@@ -0,0 +1,316 @@
+package supervisor
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/policy"
+)
+
+// PreExistingFlows is the treatment of the flows established before a PU is supervised
+type PreExistingFlows int
+
+const (
+	// PreExistingFlowsAllow leaves the flows established before the supervision
+	PreExistingFlowsAllow PreExistingFlows = iota
+	// PreExistingFlowsRevalidate keeps the flows accepted by the ACLs and the trusted
+	// networks of the policy, and terminates the others. The flows of the trireme
+	// networks are terminated since the identity of their peers is unknown.
+	PreExistingFlowsRevalidate
+	// PreExistingFlowsKill terminates the flows established before the supervision
+	PreExistingFlowsKill
+)
+
+// PreExistingFlowConfigurer is implemented by the supervisors that can handle the
+// flows established before a processing unit is supervised
+type PreExistingFlowConfigurer interface {
+
+	// SetPreExistingFlows sets the treatment of the pre-existing flows
+	SetPreExistingFlows(treatment PreExistingFlows)
+}
+
+// conntrackFlow is a flow of the connection tracking table, in its original direction
+type conntrackFlow struct {
+	protocol        string
+	source          net.IP
+	destination     net.IP
+	sourcePort      int
+	destinationPort int
+}
+
+// conntrackTable lists and terminates the established flows
+type conntrackTable interface {
+
+	// Flows returns the established flows of the address
+	Flows(ip string) ([]*conntrackFlow, error)
+
+	// Delete removes the flow. Its next packets no longer match the established
+	// state and are dropped by the rules of the PU.
+	Delete(flow *conntrackFlow) error
+}
+
+// conntrackCLI is the connection tracking table of the conntrack command
+type conntrackCLI struct{}
+
+// Flows implements the conntrackTable interface
+func (c *conntrackCLI) Flows(ip string) ([]*conntrackFlow, error) {
+
+	flows := []*conntrackFlow{}
+
+	for _, direction := range []string{"--orig-src", "--orig-dst"} {
+		out, err := exec.Command("conntrack", "-L", direction, ip).Output()
+		if err != nil {
+			return nil, fmt.Errorf("Unable to list the flows of %s: %s", ip, err)
+		}
+
+		flows = append(flows, parseConntrackFlows(string(out))...)
+	}
+
+	return flows, nil
+}
+
+// Delete implements the conntrackTable interface
+func (c *conntrackCLI) Delete(flow *conntrackFlow) error {
+
+	out, err := exec.Command("conntrack", "-D",
+		"-p", flow.protocol,
+		"--orig-src", flow.source.String(),
+		"--orig-dst", flow.destination.String(),
+		"--orig-port-src", strconv.Itoa(flow.sourcePort),
+		"--orig-port-dst", strconv.Itoa(flow.destinationPort),
+	).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("Unable to delete the flow: %s %s", err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// parseConntrackFlows parses the established TCP and UDP flows of the output of
+// conntrack -L. The first tuple of a line is the original direction.
+func parseConntrackFlows(out string) []*conntrackFlow {
+
+	flows := []*conntrackFlow{}
+
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || (fields[0] != "tcp" && fields[0] != "udp") {
+			continue
+		}
+
+		if fields[0] == "tcp" && !containsField(fields, "ESTABLISHED") {
+			continue
+		}
+
+		flow := &conntrackFlow{protocol: fields[0]}
+		for _, field := range fields {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+
+			switch kv[0] {
+			case "src":
+				if flow.source == nil {
+					flow.source = net.ParseIP(kv[1])
+				}
+			case "dst":
+				if flow.destination == nil {
+					flow.destination = net.ParseIP(kv[1])
+				}
+			case "sport":
+				if flow.sourcePort == 0 {
+					flow.sourcePort, _ = strconv.Atoi(kv[1])
+				}
+			case "dport":
+				if flow.destinationPort == 0 {
+					flow.destinationPort, _ = strconv.Atoi(kv[1])
+				}
+			}
+		}
+
+		if flow.source != nil && flow.destination != nil {
+			flows = append(flows, flow)
+		}
+	}
+
+	return flows
+}
+
+// containsField returns true if the field is in the list
+func containsField(fields []string, field string) bool {
+
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SetPreExistingFlows implements the PreExistingFlowConfigurer interface
+func (s *Config) SetPreExistingFlows(treatment PreExistingFlows) {
+
+	s.preExisting = treatment
+}
+
+// handlePreExistingFlows applies the treatment of the flows established before the
+// supervision of the PU and reports how many flows were kept and terminated
+func (s *Config) handlePreExistingFlows(contextID string, containerInfo *policy.PUInfo) {
+
+	if s.mode == constants.LocalServer {
+		// The addresses of the host are shared by all the processes
+		return
+	}
+
+	kept, killed := 0, 0
+
+	for _, ip := range policyIPs(containerInfo.Policy) {
+		flows, err := s.conntrack.Flows(ip.String())
+		if err != nil {
+			log.WithFields(log.Fields{
+				"package":   "supervisor",
+				"contextID": contextID,
+				"error":     err.Error(),
+			}).Warn("Unable to list the pre-existing flows")
+			continue
+		}
+
+		for _, flow := range flows {
+			if s.preExisting == PreExistingFlowsRevalidate && flowAccepted(flow, ip, containerInfo.Policy) {
+				kept++
+				continue
+			}
+
+			if err := s.conntrack.Delete(flow); err != nil {
+				log.WithFields(log.Fields{
+					"package":   "supervisor",
+					"contextID": contextID,
+					"error":     err.Error(),
+				}).Warn("Unable to terminate a pre-existing flow")
+				kept++
+				continue
+			}
+			killed++
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"package":   "supervisor",
+		"contextID": contextID,
+		"kept":      kept,
+		"killed":    killed,
+	}).Info("Handled the pre-existing flows")
+
+	tags := containerInfo.Policy.Annotations()
+
+	if kept > 0 {
+		s.collector.CollectFlowEvent(&collector.FlowRecord{
+			ContextID: contextID,
+			Count:     kept,
+			Tags:      tags,
+			Action:    collector.FlowAccept,
+			Mode:      collector.PreExistingFlow,
+		})
+	}
+
+	if killed > 0 {
+		s.collector.CollectFlowEvent(&collector.FlowRecord{
+			ContextID: contextID,
+			Count:     killed,
+			Tags:      tags,
+			Action:    collector.FlowReject,
+			Mode:      collector.PreExistingFlow,
+		})
+	}
+}
+
+// flowAccepted returns true if the policy accepts the flow of the address. The
+// outgoing flows are matched against the application ACLs and the incoming flows
+// against the network ACLs. The reject rules take precedence.
+func flowAccepted(flow *conntrackFlow, ip net.IP, p *policy.PUPolicy) bool {
+
+	var remote net.IP
+	var port int
+	var rules *policy.IPRuleList
+
+	switch {
+	case flow.source.Equal(ip):
+		remote, port, rules = flow.destination, flow.destinationPort, p.ApplicationACLs()
+	case flow.destination.Equal(ip):
+		remote, port, rules = flow.source, flow.destinationPort, p.NetworkACLs()
+	default:
+		return false
+	}
+
+	accepted := false
+	for _, rule := range rules.Rules {
+		if !ruleMatches(rule, flow.protocol, remote, port) {
+			continue
+		}
+		if rule.Action&policy.Reject != 0 {
+			return false
+		}
+		if rule.Action&policy.Accept != 0 {
+			accepted = true
+		}
+	}
+
+	if accepted {
+		return true
+	}
+
+	for _, network := range p.TrustedNetworks() {
+		if _, n, err := net.ParseCIDR(network); err == nil && n.Contains(remote) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ruleMatches returns true if the ACL rule applies to the protocol, remote address
+// and port
+func ruleMatches(rule policy.IPRule, protocol string, remote net.IP, port int) bool {
+
+	if _, n, err := net.ParseCIDR(rule.Address); err == nil {
+		if !n.Contains(remote) {
+			return false
+		}
+	} else if ip := net.ParseIP(rule.Address); ip == nil || !ip.Equal(remote) {
+		return false
+	}
+
+	ruleProtocol := strings.ToLower(rule.Protocol)
+	if ruleProtocol != "tcp" && ruleProtocol != "udp" {
+		return ruleProtocol == "all" || ruleProtocol == protocol
+	}
+
+	if ruleProtocol != protocol {
+		return false
+	}
+
+	bounds := strings.SplitN(rule.Port, ":", 2)
+	first, err := strconv.Atoi(bounds[0])
+	if err != nil {
+		return false
+	}
+
+	last := first
+	if len(bounds) == 2 {
+		if last, err = strconv.Atoi(bounds[1]); err != nil {
+			return false
+		}
+	}
+
+	return port >= first && port <= last
+}
@@ -0,0 +1,119 @@
+package supervisor
+
+import (
+	"net"
+	"testing"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/enforcer"
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// testConntrack holds the flows of a fake connection tracking table
+type testConntrack struct {
+	flows   []*conntrackFlow
+	deleted []*conntrackFlow
+}
+
+func (t *testConntrack) Flows(ip string) ([]*conntrackFlow, error) {
+	return t.flows, nil
+}
+
+func (t *testConntrack) Delete(flow *conntrackFlow) error {
+	t.deleted = append(t.deleted, flow)
+	return nil
+}
+
+// flowCollector records the flow events
+type flowCollector struct {
+	collector.DefaultCollector
+	records []*collector.FlowRecord
+}
+
+func (c *flowCollector) CollectFlowEvent(record *collector.FlowRecord) {
+	c.records = append(c.records, record)
+}
+
+func testFlow(src string, sport int, dst string, dport int) *conntrackFlow {
+	return &conntrackFlow{
+		protocol:        "tcp",
+		source:          net.ParseIP(src),
+		destination:     net.ParseIP(dst),
+		sourcePort:      sport,
+		destinationPort: dport,
+	}
+}
+
+func TestPreExistingFlows(t *testing.T) {
+	Convey("Given a supervisor with pre-existing flows", t, func() {
+		c := &flowCollector{}
+		secrets := tokens.NewPSKSecrets([]byte("test password"))
+		e := enforcer.NewDefaultDatapathEnforcer("serverID", c, nil, secrets, constants.LocalContainer)
+
+		s, _ := NewSupervisor(c, e, constants.LocalContainer, constants.IPTables)
+
+		accepted := testFlow("172.17.0.1", 40000, "192.30.253.10", 443)
+		rejected := testFlow("172.17.0.1", 40001, "192.30.253.10", 80)
+		trusted := testFlow("10.2.0.5", 50000, "172.17.0.1", 8080)
+		peer := testFlow("172.17.0.5", 50001, "172.17.0.1", 8080)
+		unknown := testFlow("10.1.1.1", 50002, "172.17.0.1", 8080)
+
+		ct := &testConntrack{flows: []*conntrackFlow{accepted, rejected, trusted, peer, unknown}}
+		s.conntrack = ct
+
+		puInfo := createPUInfo()
+		puInfo.Policy.UpdateTrustedNetworks([]string{"10.2.0.0/16"})
+
+		Convey("When the pre-existing flows are revalidated", func() {
+			s.SetPreExistingFlows(PreExistingFlowsRevalidate)
+			s.handlePreExistingFlows("contextID", puInfo)
+
+			Convey("Then the flows rejected or not accepted by the policy should be terminated", func() {
+				So(ct.deleted, ShouldResemble, []*conntrackFlow{rejected, peer, unknown})
+			})
+
+			Convey("Then the kept and terminated flows should be reported", func() {
+				So(len(c.records), ShouldEqual, 2)
+				So(c.records[0].Action, ShouldEqual, collector.FlowAccept)
+				So(c.records[0].Count, ShouldEqual, 2)
+				So(c.records[0].Mode, ShouldEqual, collector.PreExistingFlow)
+				So(c.records[1].Action, ShouldEqual, collector.FlowReject)
+				So(c.records[1].Count, ShouldEqual, 3)
+			})
+		})
+
+		Convey("When the pre-existing flows are killed", func() {
+			s.SetPreExistingFlows(PreExistingFlowsKill)
+			s.handlePreExistingFlows("contextID", puInfo)
+
+			Convey("Then all the flows should be terminated", func() {
+				So(len(ct.deleted), ShouldEqual, 5)
+				So(len(c.records), ShouldEqual, 1)
+				So(c.records[0].Count, ShouldEqual, 5)
+			})
+		})
+	})
+}
+
+func TestParseConntrackFlows(t *testing.T) {
+
+	Convey("Given the output of conntrack", t, func() {
+		out := "tcp      6 431999 ESTABLISHED src=172.17.0.1 dst=192.30.253.10 sport=40000 dport=443 src=192.30.253.10 dst=172.17.0.1 sport=443 dport=40000 [ASSURED] mark=0 use=1\n" +
+			"tcp      6 119 TIME_WAIT src=172.17.0.1 dst=192.30.253.10 sport=40001 dport=80 src=192.30.253.10 dst=172.17.0.1 sport=80 dport=40001 [ASSURED] mark=0 use=1\n" +
+			"udp      17 29 src=172.17.0.1 dst=8.8.8.8 sport=5353 dport=53 src=8.8.8.8 dst=172.17.0.1 sport=53 dport=5353 mark=0 use=1\n" +
+			"icmp     1 29 src=172.17.0.1 dst=8.8.8.8 type=8 code=0 id=1 src=8.8.8.8 dst=172.17.0.1 type=0 code=0 id=1 mark=0 use=1\n"
+
+		Convey("Then the established TCP and the UDP flows should be parsed in their original direction", func() {
+			flows := parseConntrackFlows(out)
+			So(len(flows), ShouldEqual, 2)
+			So(flows[0].protocol, ShouldEqual, "tcp")
+			So(flows[0].source.String(), ShouldEqual, "172.17.0.1")
+			So(flows[0].destinationPort, ShouldEqual, 443)
+			So(flows[1].protocol, ShouldEqual, "udp")
+			So(flows[1].sourcePort, ShouldEqual, 5353)
+		})
+	})
+}
@@ -15,6 +15,8 @@ import (
 
 	"github.com/aporeto-inc/trireme/policy"
 	"github.com/aporeto-inc/trireme/processmon"
+	"github.com/aporeto-inc/trireme/supervisor"
+	"github.com/aporeto-inc/trireme/utils/errortypes"
 )
 
 //ProxyInfo is a struct used to store state for the remote launcher.
@@ -29,11 +31,106 @@ type ProxyInfo struct {
 	prochdl           processmon.ProcessManager
 	rpchdl            rpcwrapper.RPCClient
 	initDone          map[string]bool
+	preExisting       supervisor.PreExistingFlows
+	ipv6              bool
+	mtls              *rpcwrapper.MTLSPayload
+	calls             *rpcwrapper.CallQueue
+	launcher          remoteLauncher
+	ackHandler        func(contextID string, puInfo *policy.PUInfo)
+}
+
+// remoteLauncher is implemented by the enforcer proxy to launch the remote enforcers
+// of the PUs applied by a single transaction
+type remoteLauncher interface {
+	LaunchRemoteEnforcer(contextID string, puInfo *policy.PUInfo) error
+}
+
+// transaction is a queued EnforceAndSupervise call
+type transaction struct {
+	puInfo *policy.PUInfo
 }
 
 //Supervise Calls Supervise on the remote supervisor
+// The policies received while the remote supervisor is initialized, or while another
+// call is in progress for the PU, are coalesced and only the latest one is applied.
 func (s *ProxyInfo) Supervise(contextID string, puInfo *policy.PUInfo) error {
 
+	if !s.calls.Acquire(contextID, puInfo) {
+		log.WithFields(log.Fields{
+			"package":   "remsupervisor",
+			"contextID": contextID,
+		}).Debug("Queued the policy until the remote supervisor is ready")
+		return nil
+	}
+
+	return s.drain(contextID, s.supervise(contextID, puInfo))
+}
+
+// Unsupervise exported stops enforcing policy for the given IP.
+// It is applied after the call in progress for the PU, if any.
+func (s *ProxyInfo) Unsupervise(contextID string) error {
+
+	if !s.calls.Acquire(contextID, nil) {
+		log.WithFields(log.Fields{
+			"package":   "remsupervisor",
+			"contextID": contextID,
+		}).Debug("Queued the unsupervise until the remote supervisor is ready")
+		return nil
+	}
+
+	return s.drain(contextID, s.unsupervise(contextID))
+}
+
+// EnforceAndSupervise implements the PolicyTransactor interface. The remote enforcer
+// applies the policy to its enforcer and its supervisor in a single call and restores
+// the policy it had if either fails.
+func (s *ProxyInfo) EnforceAndSupervise(contextID string, puInfo *policy.PUInfo) error {
+
+	if !s.calls.Acquire(contextID, &transaction{puInfo: puInfo}) {
+		log.WithFields(log.Fields{
+			"package":   "remsupervisor",
+			"contextID": contextID,
+		}).Debug("Queued the policy until the remote supervisor is ready")
+		return nil
+	}
+
+	return s.drain(contextID, s.enforceAndSupervise(contextID, puInfo))
+}
+
+// drain makes the call queued for the context while its previous call was in
+// progress and returns the error of the previous call. The errors of the queued
+// calls are logged since their callers already returned.
+func (s *ProxyInfo) drain(contextID string, err error) error {
+
+	for {
+		call, ok := s.calls.Next(contextID)
+		if !ok {
+			return err
+		}
+
+		var qerr error
+		switch c := call.(type) {
+		case *policy.PUInfo:
+			qerr = s.supervise(contextID, c)
+		case *transaction:
+			qerr = s.enforceAndSupervise(contextID, c.puInfo)
+		default:
+			qerr = s.unsupervise(contextID)
+		}
+
+		if qerr != nil {
+			log.WithFields(log.Fields{
+				"package":   "remsupervisor",
+				"contextID": contextID,
+				"error":     qerr.Error(),
+			}).Error("Failed to apply the queued call to the remote supervisor")
+		}
+	}
+}
+
+// supervise initializes the remote supervisor of the PU if needed and sends it the policy
+func (s *ProxyInfo) supervise(contextID string, puInfo *policy.PUInfo) error {
+
 	if _, ok := s.initDone[contextID]; !ok {
 		err := s.InitRemoteSupervisor(contextID, puInfo)
 		if err != nil {
@@ -56,6 +153,10 @@ func (s *ProxyInfo) Supervise(contextID string, puInfo *policy.PUInfo) error {
 			PuPolicy:         puInfo.Policy,
 			ExcludedIPs:      s.ExcludedIPs,
 			TriremeNetworks:  puInfo.Policy.TriremeNetworks(),
+			TrustedNetworks:  puInfo.Policy.TrustedNetworks(),
+			DNSPolicy:        puInfo.Policy.DNSPolicy(),
+			MirrorPolicy:     puInfo.Policy.MirrorPolicy(),
+			Features:         puInfo.Policy.Features(),
 		},
 	}
 
@@ -72,8 +173,83 @@ func (s *ProxyInfo) Supervise(contextID string, puInfo *policy.PUInfo) error {
 
 }
 
-// Unsupervise exported stops enforcing policy for the given IP.
-func (s *ProxyInfo) Unsupervise(contextID string) error {
+// enforceAndSupervise launches and initializes the remote enforcer of the PU if needed
+// and sends it the policy of both its enforcer and its supervisor
+func (s *ProxyInfo) enforceAndSupervise(contextID string, puInfo *policy.PUInfo) error {
+
+	if s.launcher == nil {
+		return &supervisor.TransactionError{
+			Component:  supervisor.TransactionEnforcer,
+			Err:        fmt.Errorf("Enforcer cannot launch remote enforcers"),
+			RolledBack: true,
+		}
+	}
+
+	if err := s.launcher.LaunchRemoteEnforcer(contextID, puInfo); err != nil {
+		return &supervisor.TransactionError{
+			Component:  supervisor.TransactionEnforcer,
+			Err:        err,
+			RolledBack: true,
+		}
+	}
+
+	if _, ok := s.initDone[contextID]; !ok {
+		if err := s.InitRemoteSupervisor(contextID, puInfo); err != nil {
+			return &supervisor.TransactionError{
+				Component:  supervisor.TransactionSupervisor,
+				Err:        err,
+				RolledBack: true,
+			}
+		}
+	}
+
+	request := &rpcwrapper.Request{
+		Payload: &rpcwrapper.EnforceAndSupervisePayload{
+			EnforcePayload: *rpcwrapper.NewEnforcePayload(contextID, puInfo),
+			ExcludedIPs:    s.ExcludedIPs,
+		},
+	}
+
+	resp := &rpcwrapper.Response{}
+	if err := s.rpchdl.RemoteCall(contextID, "Server.EnforceAndSupervise", request, resp); err != nil {
+		log.WithFields(log.Fields{
+			"package":   "remsupervisor",
+			"contextID": contextID,
+			"error":     err.Error(),
+		}).Error("Failed to apply the policy to the remote enforcer")
+		delete(s.initDone, contextID)
+		return &supervisor.TransactionError{
+			Component: supervisor.TransactionEnforcer,
+			Err:       err,
+		}
+	}
+
+	if resp.Status != "" {
+		status, _ := resp.Payload.(rpcwrapper.TransactionResponsePayload)
+		return &supervisor.TransactionError{
+			Component:  status.Component,
+			Err:        errortypes.Decode(resp.Status),
+			RolledBack: status.RolledBack,
+		}
+	}
+
+	if s.ackHandler != nil {
+		s.ackHandler(contextID, puInfo)
+	}
+
+	return nil
+}
+
+// SetAckHandler implements the PolicyAcknowledger interface. The policies are
+// acknowledged when the remote enforcer applied them, which is after the call
+// returned for the policies queued while the remote enforcer starts.
+func (s *ProxyInfo) SetAckHandler(handler func(contextID string, puInfo *policy.PUInfo)) {
+
+	s.ackHandler = handler
+}
+
+// unsupervise stops the supervision of the remote supervisor of the PU
+func (s *ProxyInfo) unsupervise(contextID string) error {
 
 	delete(s.initDone, contextID)
 
@@ -134,6 +310,11 @@ func NewProxySupervisor(collector collector.EventCollector, enforcer enforcer.Po
 		rpchdl:            rpchdl,
 		initDone:          make(map[string]bool),
 		ExcludedIPs:       []string{},
+		calls:             rpcwrapper.NewCallQueue(),
+	}
+
+	if launcher, ok := enforcer.(remoteLauncher); ok {
+		s.launcher = launcher
 	}
 
 	return s, nil
@@ -145,7 +326,10 @@ func (s *ProxyInfo) InitRemoteSupervisor(contextID string, puInfo *policy.PUInfo
 
 	request := &rpcwrapper.Request{
 		Payload: &rpcwrapper.InitSupervisorPayload{
-			CaptureMethod: rpcwrapper.IPTables,
+			CaptureMethod:    rpcwrapper.IPTables,
+			PreExistingFlows: s.preExisting,
+			IPv6:             s.ipv6,
+			MTLSRedirect:     s.mtls,
 		},
 	}
 
@@ -163,6 +347,38 @@ func (s *ProxyInfo) InitRemoteSupervisor(contextID string, puInfo *policy.PUInfo
 
 }
 
+// SetPreExistingFlows implements the PreExistingFlowConfigurer interface. The treatment
+// is sent to the remote supervisors when they are initialized.
+func (s *ProxyInfo) SetPreExistingFlows(treatment supervisor.PreExistingFlows) {
+
+	s.preExisting = treatment
+}
+
+// EnableIPv6 implements the IPv6Configurer interface. The remote supervisors
+// initialized after the call program the rules of the IPv6 addresses.
+func (s *ProxyInfo) EnableIPv6() error {
+
+	s.ipv6 = true
+	return nil
+}
+
+// SetMTLSRedirect implements the MTLSRedirector interface. The remote supervisors
+// initialized after the call redirect the connections of the mutual TLS mode.
+func (s *ProxyInfo) SetMTLSRedirect(networks []string, clientPort, serverPort int) error {
+
+	if clientPort == 0 || serverPort == 0 {
+		return fmt.Errorf("Mutual TLS requires a client and a server port")
+	}
+
+	s.mtls = &rpcwrapper.MTLSPayload{
+		Networks:   networks,
+		ClientPort: clientPort,
+		ServerPort: serverPort,
+	}
+
+	return nil
+}
+
 //AddExcludedIPs call addexcluded ip on the remote supervisor
 func (s *ProxyInfo) AddExcludedIPs(ips []string) error {
 	s.ExcludedIPs = ips
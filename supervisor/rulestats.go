@@ -0,0 +1,88 @@
+package supervisor
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/policy"
+)
+
+// RuleStatsConfigurer is implemented by the supervisors that can count the matches
+// of the ACLs of the processing units
+type RuleStatsConfigurer interface {
+
+	// EnableRuleStats reports the matches of the ACLs of the processing units to the
+	// collector at every interval. It must be called before the supervisor is started.
+	// The interval must be the interval of the bandwidth accounting, if enabled.
+	EnableRuleStats(interval time.Duration) error
+}
+
+// EnableRuleStats implements the RuleStatsConfigurer interface. The matches are read
+// from the counters of the ACLs used by the bandwidth accounting.
+func (s *Config) EnableRuleStats(interval time.Duration) error {
+
+	if interval <= 0 {
+		return fmt.Errorf("Invalid rule stats interval %s", interval)
+	}
+
+	c, ok := s.collector.(collector.RuleStatsEventCollector)
+	if !ok {
+		return fmt.Errorf("Collector does not collect rule stats events")
+	}
+
+	b, err := s.accountingReporter(interval)
+	if err != nil {
+		return err
+	}
+
+	b.rules = c
+
+	return nil
+}
+
+// ruleStats returns the matches of all the ACLs of a PU from the traffic of the
+// interval. The ACLs without traffic are reported without match.
+func ruleStats(record *collector.BandwidthRecord, pu *accountedPU) *collector.RuleStatsRecord {
+
+	matched := map[collector.RuleBandwidth]*collector.RuleBandwidth{}
+	for _, r := range record.Rules {
+		matched[collector.RuleBandwidth{Direction: r.Direction, Rule: r.Rule}] = r
+	}
+
+	stats := &collector.RuleStatsRecord{
+		ContextID: record.ContextID,
+		Tags:      record.Tags,
+		Interval:  record.Interval,
+		Rules:     []*collector.RuleHits{},
+	}
+
+	for _, acls := range []struct {
+		direction string
+		rules     *policy.IPRuleList
+	}{
+		{collector.RuleApplication, pu.appACLs},
+		{collector.RuleNetwork, pu.netACLs},
+	} {
+		if acls.rules == nil {
+			continue
+		}
+
+		for index, rule := range acls.rules.Rules {
+			hits := &collector.RuleHits{
+				Direction: acls.direction,
+				Index:     index,
+				Rule:      rule,
+			}
+
+			if r, ok := matched[collector.RuleBandwidth{Direction: acls.direction, Rule: rule}]; ok {
+				hits.Hits = r.Packets
+				hits.Bytes = r.Bytes
+			}
+
+			stats.Rules = append(stats.Rules, hits)
+		}
+	}
+
+	return stats
+}
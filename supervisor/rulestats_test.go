@@ -0,0 +1,134 @@
+package supervisor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/enforcer"
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+	"github.com/aporeto-inc/trireme/policy"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// ruleStatsCollector records the rule stats events
+type ruleStatsCollector struct {
+	collector.DefaultCollector
+	records []*collector.RuleStatsRecord
+}
+
+func (c *ruleStatsCollector) CollectRuleStatsEvent(record *collector.RuleStatsRecord) {
+	c.records = append(c.records, record)
+}
+
+func TestEnableRuleStats(t *testing.T) {
+	Convey("Given a supervisor", t, func() {
+		secrets := tokens.NewPSKSecrets([]byte("test password"))
+
+		Convey("If the collector does not collect rule stats events, it should fail", func() {
+			c := &bandwidthCollector{}
+			e := enforcer.NewDefaultDatapathEnforcer("serverID", c, nil, secrets, constants.LocalContainer)
+			s, _ := NewSupervisor(c, e, constants.LocalContainer, constants.IPTables)
+
+			So(s.EnableRuleStats(time.Minute), ShouldNotBeNil)
+		})
+
+		Convey("If the implementation does not count the matches, it should fail", func() {
+			c := &ruleStatsCollector{}
+			e := enforcer.NewDefaultDatapathEnforcer("serverID", c, nil, secrets, constants.LocalContainer)
+			s, _ := NewSupervisor(c, e, constants.LocalContainer, constants.IPSets)
+
+			So(s.EnableRuleStats(time.Minute), ShouldNotBeNil)
+		})
+
+		Convey("If the interval is invalid, it should fail", func() {
+			c := &ruleStatsCollector{}
+			e := enforcer.NewDefaultDatapathEnforcer("serverID", c, nil, secrets, constants.LocalContainer)
+			s, _ := NewSupervisor(c, e, constants.LocalContainer, constants.IPTables)
+
+			So(s.EnableRuleStats(0), ShouldNotBeNil)
+		})
+
+		Convey("If the implementation and the collector support it, it should succeed", func() {
+			c := &ruleStatsCollector{}
+			e := enforcer.NewDefaultDatapathEnforcer("serverID", c, nil, secrets, constants.LocalContainer)
+			s, _ := NewSupervisor(c, e, constants.LocalContainer, constants.IPTables)
+
+			So(s.EnableRuleStats(time.Minute), ShouldBeNil)
+			So(s.bandwidth.rules, ShouldEqual, c)
+			So(s.bandwidth.collector, ShouldBeNil)
+
+			Convey("The bandwidth accounting should share the interval", func() {
+				So(s.EnableBandwidthAccounting(30*time.Second), ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestRuleStatsReport(t *testing.T) {
+	Convey("Given a reporter of the rule matches", t, func() {
+		accountant := &testAccountant{
+			counters: map[string]*collector.BandwidthRecord{},
+			versions: map[string]int{},
+		}
+		c := &ruleStatsCollector{}
+
+		now := time.Unix(1000, 0)
+		b := &bandwidthReporter{
+			accountant: accountant,
+			rules:      c,
+			interval:   time.Minute,
+			pus:        map[string]*accountedPU{},
+			now:        func() time.Time { return now },
+			stop:       make(chan struct{}),
+		}
+
+		web := policy.IPRule{Address: "10.0.0.0/8", Port: "80", Protocol: "TCP", Action: policy.Accept}
+		ssh := policy.IPRule{Address: "10.0.0.0/8", Port: "22", Protocol: "TCP", Action: policy.Reject}
+		dns := policy.IPRule{Address: "0.0.0.0/0", Port: "53", Protocol: "UDP", Action: policy.Accept}
+
+		annotations := policy.NewTagsMap(map[string]string{"app": "web"})
+		puInfo := policy.NewPUInfo("pu1", constants.ContainerPU)
+		puInfo.Policy = policy.NewPUPolicy("pu1", policy.Police, policy.NewIPRuleList([]policy.IPRule{web, ssh}), policy.NewIPRuleList([]policy.IPRule{dns}), nil, nil, nil, annotations, nil, nil, nil)
+
+		b.track("pu1", 0, puInfo)
+
+		accountant.counters["pu1"] = &collector.BandwidthRecord{
+			ContextID: "pu1",
+			TxBytes:   1000,
+			TxPackets: 10,
+			Rules: []*collector.RuleBandwidth{
+				{Direction: collector.BandwidthApplication, Rule: web, Bytes: 600, Packets: 10},
+			},
+		}
+
+		Convey("When I report the matches", func() {
+			now = now.Add(time.Minute)
+			b.report()
+
+			Convey("The collector should receive the matches of all the ACLs", func() {
+				So(len(c.records), ShouldEqual, 1)
+				So(c.records[0].ContextID, ShouldEqual, "pu1")
+				So(c.records[0].Tags, ShouldEqual, annotations)
+				So(c.records[0].Interval, ShouldEqual, time.Minute)
+				So(c.records[0].Rules, ShouldResemble, []*collector.RuleHits{
+					{Direction: collector.RuleApplication, Index: 0, Rule: web, Hits: 10, Bytes: 600},
+					{Direction: collector.RuleApplication, Index: 1, Rule: ssh},
+					{Direction: collector.RuleNetwork, Index: 0, Rule: dns},
+				})
+			})
+
+			Convey("When there is no traffic, the unused ACLs should still be reported", func() {
+				b.report()
+
+				So(len(c.records), ShouldEqual, 2)
+				So(len(c.records[1].Rules), ShouldEqual, 3)
+				for _, r := range c.records[1].Rules {
+					So(r.Hits, ShouldEqual, 0)
+				}
+			})
+		})
+	})
+}
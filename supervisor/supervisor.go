@@ -2,6 +2,7 @@ package supervisor
 
 import (
 	"fmt"
+	"net"
 	"strconv"
 
 	log "github.com/Sirupsen/logrus"
@@ -13,13 +14,18 @@ import (
 	"github.com/aporeto-inc/trireme/policy"
 	"github.com/aporeto-inc/trireme/supervisor/ipsetctrl"
 	"github.com/aporeto-inc/trireme/supervisor/iptablesctrl"
+	"github.com/aporeto-inc/trireme/utils/errortypes"
 )
 
 type cacheData struct {
-	version int
-	ips     *policy.IPMap
-	mark    string
-	port    string
+	version  int
+	ips      *policy.IPMap
+	mark     string
+	port     string
+	families puFamilies
+	// policy is the last policy of the PU, whose accepted flows are compared
+	// with the ones of the next policy
+	policy *policy.PUPolicy
 }
 
 // Config is the structure holding all information about the supervisor
@@ -36,6 +42,18 @@ type Config struct {
 	Mark        int
 	excludedIPs []string
 	impl        Implementor
+
+	// ipv6 programs the rules of the IPv6 addresses, if enabled
+	ipv6 Implementor
+
+	preExisting PreExistingFlows
+	conntrack   conntrackTable
+
+	// bandwidth reports the traffic of the PUs, if enabled
+	bandwidth *bandwidthReporter
+
+	// dns resolves the domain names of the ACLs
+	dns *dnsResolver
 }
 
 // NewSupervisor will create a new connection supervisor that uses IPTables
@@ -67,12 +85,20 @@ func NewSupervisor(collector collector.EventCollector, enforcerInstance enforcer
 		applicationQueues: strconv.Itoa(int(filterQueue.ApplicationQueue)) + ":" + strconv.Itoa(int(filterQueue.ApplicationQueue+filterQueue.NumberOfApplicationQueues-1)),
 		Mark:              filterQueue.MarkValue,
 		excludedIPs:       []string{},
+		preExisting:       PreExistingFlowsAllow,
+		conntrack:         newConntrackTable(),
 	}
 
+	s.dns = newDNSResolver(s.updateResolvedPU)
+
 	var err error
 	switch implementation {
 	case constants.IPSets:
 		s.impl, err = ipsetctrl.NewInstance(s.networkQueues, s.applicationQueues, s.Mark, false, mode)
+	case constants.IPSetsVerdictCache:
+		s.impl, err = newVerdictCacheInstance(s, enforcerInstance, mode)
+	case constants.IPTablesDockerUser:
+		s.impl, err = iptablesctrl.NewDockerUserInstance(s.networkQueues, s.applicationQueues, s.Mark, mode)
 	default:
 		s.impl, err = iptablesctrl.NewInstance(s.networkQueues, s.applicationQueues, s.Mark, mode)
 	}
@@ -81,6 +107,26 @@ func NewSupervisor(collector collector.EventCollector, enforcerInstance enforcer
 		return nil, fmt.Errorf("Unable to initialize supervisor controllers")
 	}
 
+	if filterQueue.MarkMask != 0 {
+		masker, ok := s.impl.(markMasker)
+		if !ok {
+			return nil, fmt.Errorf("Supervisor implementation does not support mark masks")
+		}
+
+		if err := masker.SetMarkMask(filterQueue.MarkMask); err != nil {
+			return nil, fmt.Errorf("Invalid mark mask: %s", err)
+		}
+	}
+
+	if filterQueue.CaptureMode == enforcer.CaptureRawSocket || filterQueue.CaptureMode == enforcer.CaptureEBPF {
+		disabler, ok := s.impl.(queueDisabler)
+		if !ok {
+			return nil, fmt.Errorf("Supervisor implementation does not support raw socket capture")
+		}
+
+		disabler.DisableQueues()
+	}
+
 	return s, nil
 }
 
@@ -92,6 +138,8 @@ func (s *Config) Supervise(contextID string, containerInfo *policy.PUInfo) error
 		return fmt.Errorf("Runtime, Policy and ContainerInfo should not be nil")
 	}
 
+	containerInfo = s.dns.resolve(contextID, containerInfo)
+
 	_, err := s.versionTracker.Get(contextID)
 
 	if err != nil {
@@ -111,14 +159,19 @@ func (s *Config) Unsupervise(contextID string) error {
 	version, err := s.versionTracker.Get(contextID)
 
 	if err != nil {
-		return fmt.Errorf("Cannot find policy version")
+		return errortypes.Errorf(errortypes.ErrPUNotFound, "Cannot find policy version of %s", contextID)
 	}
 
 	cacheEntry := version.(*cacheData)
 
-	s.impl.DeleteRules(cacheEntry.version, contextID, cacheEntry.ips, cacheEntry.port, cacheEntry.mark)
+	s.deleteRules(cacheEntry.version, contextID, cacheEntry.ips, cacheEntry.port, cacheEntry.mark, cacheEntry.families)
 
 	s.versionTracker.Remove(contextID)
+	s.dns.forget(contextID)
+
+	if s.bandwidth != nil {
+		s.bandwidth.forget(contextID)
+	}
 
 	return nil
 }
@@ -130,17 +183,41 @@ func (s *Config) Start() error {
 	}).Debug("Start the supervisor")
 
 	if err := s.impl.Start(); err != nil {
-		return fmt.Errorf("Filter of marked packets was not set")
+		return errortypes.Wrapf(errortypes.ErrRuleProgramming, err, "Filter of marked packets was not set")
 	}
 
+	if s.ipv6 != nil {
+		if err := s.ipv6.Start(); err != nil {
+			return errortypes.Wrapf(errortypes.ErrRuleProgramming, err, "Filter of marked IPv6 packets was not set")
+		}
+	}
+
+	if s.bandwidth != nil {
+		go s.bandwidth.run()
+	}
+
+	go s.dns.run()
+
 	return nil
 }
 
 // Stop stops the supervisor
 func (s *Config) Stop() error {
 
+	// The IPv6 sets of the ipset implementation are only destroyed once the rules
+	// of both families are removed, so the IPv6 implementation is stopped first
+	if s.ipv6 != nil {
+		s.ipv6.Stop()
+	}
+
 	s.impl.Stop()
 
+	if s.bandwidth != nil {
+		close(s.bandwidth.stop)
+	}
+
+	close(s.dns.stop)
+
 	return nil
 }
 
@@ -157,11 +234,19 @@ func (s *Config) doCreatePU(contextID string, containerInfo *policy.PUInfo) erro
 	if !ok {
 		port = "0"
 	}
+
+	families, err := s.families(containerInfo)
+	if err != nil {
+		return err
+	}
+
 	cacheEntry := &cacheData{
-		version: version,
-		ips:     containerInfo.Policy.IPAddresses(),
-		mark:    mark,
-		port:    port,
+		version:  version,
+		ips:      containerInfo.Policy.IPAddresses(),
+		mark:     mark,
+		port:     port,
+		families: families,
+		policy:   containerInfo.Policy.Clone(),
 	}
 
 	// Version the policy so that we can do hitless policy changes
@@ -170,9 +255,17 @@ func (s *Config) doCreatePU(contextID string, containerInfo *policy.PUInfo) erro
 		return err
 	}
 
-	if err := s.impl.ConfigureRules(version, contextID, containerInfo); err != nil {
+	if err := s.configureRules(version, contextID, containerInfo, families); err != nil {
 		s.Unsupervise(contextID)
-		return err
+		return errortypes.Wrapf(errortypes.ErrRuleProgramming, err, "Cannot configure the rules of %s", contextID)
+	}
+
+	if s.bandwidth != nil {
+		s.bandwidth.track(contextID, version, s.familyInfo(containerInfo, policy.IPv4))
+	}
+
+	if s.preExisting != PreExistingFlowsAllow {
+		s.handlePreExistingFlows(contextID, containerInfo)
 	}
 
 	return nil
@@ -185,27 +278,155 @@ func (s *Config) doUpdatePU(contextID string, containerInfo *policy.PUInfo) erro
 	cacheEntry, err := s.versionTracker.LockedModify(contextID, add, 1)
 
 	if err != nil {
-		return fmt.Errorf("Error finding PU in cache %s", err)
+		return errortypes.Wrapf(errortypes.ErrPUNotFound, err, "Error finding PU in cache")
 	}
 
 	cachedEntry := cacheEntry.(*cacheData)
 
-	if err := s.impl.UpdateRules(cachedEntry.version, contextID, containerInfo); err != nil {
+	families, err := s.families(containerInfo)
+	if err != nil {
 		s.Unsupervise(contextID)
 		return err
 	}
 
+	ips := containerInfo.Policy.IPAddresses()
+	if s.mode != constants.LocalServer && !sameIPs(cachedEntry.ips, ips) {
+		return s.doUpdateAddresses(contextID, cachedEntry, containerInfo, families)
+	}
+
+	if err := s.updateRules(cachedEntry, contextID, containerInfo, families); err != nil {
+		s.Unsupervise(contextID)
+		return errortypes.Wrapf(errortypes.ErrRuleProgramming, err, "Cannot update the rules of %s", contextID)
+	}
+
+	if s.bandwidth != nil {
+		s.bandwidth.track(contextID, cachedEntry.version, s.familyInfo(containerInfo, policy.IPv4))
+	}
+
+	s.flushDeniedFlows(contextID, cachedEntry, containerInfo)
+
+	return nil
+}
+
+// doUpdateAddresses reprograms a PU whose IP addresses changed. The rules of the new
+// version are configured for the new addresses before the rules of the previous
+// version are removed with the previous addresses.
+func (s *Config) doUpdateAddresses(contextID string, cachedEntry *cacheData, containerInfo *policy.PUInfo, families puFamilies) error {
+
+	oldIPs, oldFamilies := cachedEntry.ips, cachedEntry.families
+	cachedEntry.ips = containerInfo.Policy.IPAddresses()
+	cachedEntry.families = families
+
+	if err := s.configureRules(cachedEntry.version, contextID, containerInfo, families); err != nil {
+		s.deleteRules(cachedEntry.version-1, contextID, oldIPs, cachedEntry.port, cachedEntry.mark, oldFamilies)
+		s.Unsupervise(contextID)
+		return errortypes.Wrapf(errortypes.ErrRuleProgramming, err, "Cannot configure the rules of %s", contextID)
+	}
+
+	if err := s.deleteRules(cachedEntry.version-1, contextID, oldIPs, cachedEntry.port, cachedEntry.mark, oldFamilies); err != nil {
+		log.WithFields(log.Fields{
+			"package":   "supervisor",
+			"contextID": contextID,
+			"error":     err.Error(),
+		}).Warn("Failed to remove the rules of the previous addresses")
+	}
+
+	if s.bandwidth != nil {
+		s.bandwidth.track(contextID, cachedEntry.version, s.familyInfo(containerInfo, policy.IPv4))
+	}
+
+	s.flushDeniedFlows(contextID, cachedEntry, containerInfo)
+
 	return nil
 }
 
+// sameIPs returns true if both maps hold the same addresses
+func sameIPs(a, b *policy.IPMap) bool {
+
+	if len(a.IPs) != len(b.IPs) {
+		return false
+	}
+
+	for k, v := range a.IPs {
+		if ip, ok := b.IPs[k]; !ok || ip != v {
+			return false
+		}
+	}
+
+	return true
+}
+
 // AddExcludedIPs adds an exception for the destination parameter IP, allowing all the traffic.
 func (s *Config) AddExcludedIPs(ips []string) error {
 	// Remove everything and then apply the updatedSet.
 	if len(s.excludedIPs) > 0 {
-		s.impl.RemoveExcludedIP(s.excludedIPs)
+		for _, f := range s.implementations() {
+			f.impl.RemoveExcludedIP(s.familyNetworks(s.excludedIPs, f.family))
+		}
 	}
 	s.excludedIPs = ips
-	return s.impl.AddExcludedIP(ips)
+
+	for _, f := range s.implementations() {
+		if err := f.impl.AddExcludedIP(s.familyNetworks(ips, f.family)); err != nil {
+			return errortypes.Wrapf(errortypes.ErrRuleProgramming, err, "Cannot exclude the addresses")
+		}
+	}
+
+	return nil
+}
+
+// SetControllerNetworks implements the ControllerProtector interface
+func (s *Config) SetControllerNetworks(networks []string) error {
+
+	protectors := []ControllerProtector{}
+	for _, f := range s.implementations() {
+		protector, ok := f.impl.(ControllerProtector)
+		if !ok {
+			return fmt.Errorf("Supervisor implementation cannot protect the controller connectivity")
+		}
+		protectors = append(protectors, protector)
+	}
+
+	for _, network := range networks {
+		if _, _, err := net.ParseCIDR(network); err != nil && net.ParseIP(network) == nil {
+			return fmt.Errorf("Invalid controller network %s", network)
+		}
+	}
+
+	for i, f := range s.implementations() {
+		if err := protectors[i].SetControllerNetworks(s.familyNetworks(networks, f.family)); err != nil {
+			return errortypes.Wrapf(errortypes.ErrRuleProgramming, err, "Cannot protect the controller connectivity")
+		}
+	}
+
+	return nil
+}
+
+// SetMTLSRedirect implements the MTLSRedirector interface
+func (s *Config) SetMTLSRedirect(networks []string, clientPort, serverPort int) error {
+
+	redirectors := []MTLSRedirector{}
+	for _, f := range s.implementations() {
+		redirector, ok := f.impl.(MTLSRedirector)
+		if !ok {
+			return fmt.Errorf("Supervisor implementation does not support mutual TLS")
+		}
+		redirectors = append(redirectors, redirector)
+	}
+
+	for _, network := range networks {
+		if _, _, err := net.ParseCIDR(network); err != nil {
+			return fmt.Errorf("Invalid mutual TLS network %s", network)
+		}
+	}
+
+	for i, f := range s.implementations() {
+		if err := redirectors[i].SetMTLSRedirect(s.familyNetworks(networks, f.family), clientPort, serverPort); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 func add(a, b interface{}) interface{} {
@@ -213,3 +434,54 @@ func add(a, b interface{}) interface{} {
 	entry.version += b.(int)
 	return entry
 }
+
+// newVerdictCacheInstance creates the ipset implementation caching the verdicts of
+// the enforcer
+func newVerdictCacheInstance(s *Config, enforcerInstance enforcer.PolicyEnforcer, mode constants.ModeType) (Implementor, error) {
+
+	configurer, ok := enforcerInstance.(enforcer.VerdictCacheConfigurer)
+	if !ok {
+		return nil, fmt.Errorf("Enforcer does not support verdict caching")
+	}
+
+	i, err := ipsetctrl.NewVerdictCacheInstance(s.networkQueues, s.applicationQueues, s.Mark, mode, ipsetctrl.DefaultVerdictTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	configurer.SetVerdictCache(i)
+
+	return i, nil
+}
+
+// VerdictCacheStats implements the VerdictCacheReporter interface
+func (s *Config) VerdictCacheStats() (*ipsetctrl.VerdictStats, error) {
+
+	reporter, ok := s.impl.(verdictReporter)
+	if !ok {
+		return nil, fmt.Errorf("Supervisor implementation does not cache verdicts")
+	}
+
+	return reporter.VerdictStats()
+}
+
+// SetFirewallProfile implements the FirewallProfileConfigurer interface
+func (s *Config) SetFirewallProfile(profile *iptablesctrl.Profile) error {
+
+	profilers := []firewallProfiler{}
+	for _, f := range s.implementations() {
+		profiler, ok := f.impl.(firewallProfiler)
+		if !ok {
+			return fmt.Errorf("Supervisor implementation does not support firewall profiles")
+		}
+		profilers = append(profilers, profiler)
+	}
+
+	for _, profiler := range profilers {
+		if err := profiler.SetProfile(profile); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/aporeto-inc/trireme/enforcer"
 	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
 	"github.com/aporeto-inc/trireme/policy"
+	"github.com/aporeto-inc/trireme/supervisor/iptablesctrl"
 	mock_supervisor "github.com/aporeto-inc/trireme/supervisor/mock"
 
 	. "github.com/smartystreets/goconvey/convey"
@@ -143,6 +144,22 @@ func TestSupervise(t *testing.T) {
 			})
 		})
 
+		Convey("When I send supervise command after the IP address of the PU changed", func() {
+			impl.EXPECT().ConfigureRules(0, "contextID", puInfo).Return(nil)
+			s.Supervise("contextID", puInfo)
+
+			oldIPs := puInfo.Policy.IPAddresses()
+			newInfo := createPUInfo()
+			newInfo.Policy.SetIPAddresses(policy.NewIPMap(map[string]string{policy.DefaultNamespace: "172.17.0.99"}))
+
+			impl.EXPECT().ConfigureRules(1, "contextID", newInfo).Return(nil)
+			impl.EXPECT().DeleteRules(0, "contextID", oldIPs, gomock.Any(), gomock.Any()).Return(nil)
+			err := s.Supervise("contextID", newInfo)
+			Convey("I should reprogram the rules for the new address", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
 	})
 }
 
@@ -181,6 +198,160 @@ func TestUnsupervise(t *testing.T) {
 	})
 }
 
+func TestSuperviseIPv6(t *testing.T) {
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	Convey("Given a supervisor with IPv6 enabled", t, func() {
+		c := &collector.DefaultCollector{}
+		secrets := tokens.NewPSKSecrets([]byte("test password"))
+		e := enforcer.NewDefaultDatapathEnforcer("serverID", c, nil, secrets, constants.LocalContainer)
+
+		s, _ := NewSupervisor(c, e, constants.LocalContainer, constants.IPTables)
+		impl := mock_supervisor.NewMockImplementor(ctrl)
+		impl6 := mock_supervisor.NewMockImplementor(ctrl)
+		s.impl = impl
+		s.ipv6 = impl6
+
+		ips := policy.NewIPMap(map[string]string{policy.DefaultNamespace: "fd00::2"})
+		rules := policy.NewIPRuleList([]policy.IPRule{
+			{Address: "192.30.253.0/24", Port: "443", Protocol: "TCP", Action: policy.Accept},
+			{Address: "fd00:1::/64", Port: "443", Protocol: "TCP", Action: policy.Accept},
+		})
+		plc := policy.NewPUPolicy("contextID", policy.Police, rules, rules, nil, nil, nil, nil, ips, []string{"172.17.0.0/24", "fd00::/8"}, nil)
+		puInfo := policy.PUInfoFromPolicyAndRuntime("contextID", plc, policy.NewPURuntimeWithDefaults())
+
+		Convey("When I supervise an IPv6 PU whose policy enables IPv6", func() {
+			plc.UpdateFeatures([]string{"ipv6"})
+
+			var configured *policy.PUInfo
+			impl6.EXPECT().ConfigureRules(0, "contextID", gomock.Any()).Do(func(version int, contextID string, info *policy.PUInfo) {
+				configured = info
+			}).Return(nil)
+			err := s.Supervise("contextID", puInfo)
+
+			Convey("I should only program the IPv6 rules", func() {
+				So(err, ShouldBeNil)
+				So(configured.Policy.ApplicationACLs().Rules, ShouldHaveLength, 1)
+				So(configured.Policy.ApplicationACLs().Rules[0].Address, ShouldEqual, "fd00:1::/64")
+				So(configured.Policy.TriremeNetworks(), ShouldResemble, []string{"fd00::/8"})
+			})
+
+			Convey("When I unsupervise it", func() {
+				impl6.EXPECT().DeleteRules(0, "contextID", gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				err := s.Unsupervise("contextID")
+
+				Convey("I should delete the IPv6 rules", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+		})
+
+		Convey("When I supervise an IPv6 PU whose policy does not enable IPv6", func() {
+			err := s.Supervise("contextID", puInfo)
+
+			Convey("I should get an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestFamiliesMultiIP(t *testing.T) {
+
+	Convey("Given a supervisor in the local container mode", t, func() {
+		c := &collector.DefaultCollector{}
+		secrets := tokens.NewPSKSecrets([]byte("test password"))
+		e := enforcer.NewDefaultDatapathEnforcer("serverID", c, nil, secrets, constants.LocalContainer)
+
+		s, _ := NewSupervisor(c, e, constants.LocalContainer, constants.IPTables)
+
+		rules := policy.NewIPRuleList([]policy.IPRule{
+			{Address: "192.30.253.0/24", Port: "443", Protocol: "TCP", Action: policy.Accept},
+			{Address: "fd00:1::/64", Port: "443", Protocol: "TCP", Action: policy.Accept},
+		})
+
+		Convey("When I supervise a dual-stack PU with IPv6 enabled", func() {
+			s.ipv6 = s.impl
+
+			ips := policy.NewIPMap(map[string]string{
+				policy.DefaultNamespace:     "172.17.0.2",
+				policy.DefaultIPv6Namespace: "fd00::2",
+			})
+			plc := policy.NewPUPolicy("contextID", policy.Police, rules, rules, nil, nil, nil, nil, ips, []string{"172.17.0.0/24", "fd00::/8"}, nil)
+			puInfo := policy.PUInfoFromPolicyAndRuntime("contextID", plc, policy.NewPURuntimeWithDefaults())
+
+			Convey("Then the rules of both families should be programmed if the policy enables IPv6", func() {
+				plc.UpdateFeatures([]string{"ipv6"})
+
+				families, err := s.families(puInfo)
+				So(err, ShouldBeNil)
+				So(families, ShouldResemble, puFamilies{ipv4: true, ipv6: true})
+			})
+
+			Convey("Then each family should have its address as the default one", func() {
+				ipv4 := s.familyInfo(puInfo, policy.IPv4).Policy
+				ipv6 := s.familyInfo(puInfo, policy.IPv6).Policy
+
+				So(ipv4.IPAddresses().IPs, ShouldResemble, map[string]string{policy.DefaultNamespace: "172.17.0.2"})
+				So(ipv6.IPAddresses().IPs, ShouldResemble, map[string]string{policy.DefaultNamespace: "fd00::2"})
+				So(ipv6.ApplicationACLs().Rules[0].Address, ShouldEqual, "fd00:1::/64")
+				So(s.familyIPs(ips, policy.IPv6).IPs, ShouldResemble, map[string]string{policy.DefaultNamespace: "fd00::2"})
+			})
+
+			Convey("Then I should get an error if the policy does not enable IPv6", func() {
+				_, err := s.families(puInfo)
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When I supervise a PU whose default address is of the other family", func() {
+			s.ipv6 = s.impl
+
+			ips := policy.NewIPMap(map[string]string{
+				policy.DefaultNamespace: "fd00::2",
+				"net1":                  "10.1.0.2",
+			})
+			plc := policy.NewPUPolicy("contextID", policy.Police, rules, rules, nil, nil, nil, nil, ips, []string{"10.0.0.0/8", "fd00::/8"}, nil)
+			plc.UpdateFeatures([]string{"ipv6"})
+			plc.SetNetworkPolicy("net1", &policy.NetworkPolicy{
+				NetworkACLs: policy.NewIPRuleList([]policy.IPRule{
+					{Address: "10.1.0.0/16", Port: "80", Protocol: "TCP", Action: policy.Accept},
+				}),
+			})
+			puInfo := policy.PUInfoFromPolicyAndRuntime("contextID", plc, policy.NewPURuntimeWithDefaults())
+
+			Convey("Then the address of the family should be the default one with the rules of its network", func() {
+				ipv4 := s.familyInfo(puInfo, policy.IPv4).Policy
+
+				So(ipv4.IPAddresses().IPs, ShouldResemble, map[string]string{policy.DefaultNamespace: "10.1.0.2"})
+				So(ipv4.NetworkACLs().Rules[0].Address, ShouldEqual, "10.1.0.0/16")
+				So(ipv4.ApplicationACLs().Rules[0].Address, ShouldEqual, "192.30.253.0/24")
+			})
+		})
+
+		Convey("When I supervise a PU attached only to additional networks without IPv6", func() {
+			ips := policy.NewIPMap(map[string]string{
+				"net1": "10.1.0.2",
+				"net2": "10.2.0.2",
+			})
+			plc := policy.NewPUPolicy("contextID", policy.Police, rules, rules, nil, nil, nil, nil, ips, []string{"10.0.0.0/8"}, nil)
+			puInfo := policy.PUInfoFromPolicyAndRuntime("contextID", plc, policy.NewPURuntimeWithDefaults())
+
+			Convey("Then the address of the first network should be the default one", func() {
+				families, err := s.families(puInfo)
+				So(err, ShouldBeNil)
+				So(families, ShouldResemble, puFamilies{ipv4: true})
+
+				info := s.familyInfo(puInfo, policy.IPv4)
+				So(info.Policy.IPAddresses().IPs, ShouldResemble, map[string]string{policy.DefaultNamespace: "10.1.0.2", "net2": "10.2.0.2"})
+				So(s.familyIPs(ips, policy.IPv4).IPs, ShouldResemble, info.Policy.IPAddresses().IPs)
+			})
+		})
+	})
+}
+
 func TestStart(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -211,3 +382,73 @@ func TestStart(t *testing.T) {
 		})
 	})
 }
+
+func TestSetFirewallProfile(t *testing.T) {
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	Convey("Given an iptables supervisor", t, func() {
+		c := &collector.DefaultCollector{}
+		secrets := tokens.NewPSKSecrets([]byte("test password"))
+		e := enforcer.NewDefaultDatapathEnforcer("serverID", c, nil, secrets, constants.LocalContainer)
+
+		s, _ := NewSupervisor(c, e, constants.LocalContainer, constants.IPTables)
+
+		Convey("When I set the profile of Calico", func() {
+			err := s.SetFirewallProfile(&iptablesctrl.ProfileCalico)
+
+			Convey("I should get no error", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When the implementation does not support the profiles", func() {
+			s.impl = mock_supervisor.NewMockImplementor(ctrl)
+			err := s.SetFirewallProfile(&iptablesctrl.ProfileCalico)
+
+			Convey("I should get an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestSetMTLSRedirect(t *testing.T) {
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	Convey("Given an iptables supervisor", t, func() {
+		c := &collector.DefaultCollector{}
+		secrets := tokens.NewPSKSecrets([]byte("test password"))
+		e := enforcer.NewDefaultDatapathEnforcer("serverID", c, nil, secrets, constants.LocalContainer)
+
+		s, _ := NewSupervisor(c, e, constants.LocalContainer, constants.IPTables)
+
+		Convey("When I set the mutual TLS redirection", func() {
+			err := s.SetMTLSRedirect([]string{"10.0.0.0/8"}, 5001, 5002)
+
+			Convey("I should get no error", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When I set the mutual TLS redirection with an invalid network", func() {
+			err := s.SetMTLSRedirect([]string{"invalid"}, 5001, 5002)
+
+			Convey("I should get an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the implementation does not support mutual TLS", func() {
+			s.impl = mock_supervisor.NewMockImplementor(ctrl)
+			err := s.SetMTLSRedirect([]string{"10.0.0.0/8"}, 5001, 5002)
+
+			Convey("I should get an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
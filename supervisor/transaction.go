@@ -0,0 +1,133 @@
+package supervisor
+
+import (
+	"fmt"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aporeto-inc/trireme/enforcer"
+	"github.com/aporeto-inc/trireme/policy"
+)
+
+// Components of a policy transaction
+const (
+	// TransactionEnforcer is the enforcer of the PU
+	TransactionEnforcer = "enforcer"
+	// TransactionSupervisor is the supervisor of the PU
+	TransactionSupervisor = "supervisor"
+)
+
+// TransactionError is returned when the policy of a PU could not be applied to both
+// its enforcer and its supervisor
+type TransactionError struct {
+	// Component is the component that failed to apply the policy
+	Component string
+	// Err is the error of the component
+	Err error
+	// RolledBack is true if the PU was returned to the policy it had before the
+	// transaction, or to no policy at all if it had none
+	RolledBack bool
+}
+
+func (e *TransactionError) Error() string {
+
+	if e.RolledBack {
+		return fmt.Sprintf("%s failed: %s. Previous policy restored", e.Component, e.Err)
+	}
+
+	return fmt.Sprintf("%s failed: %s. Rollback failed", e.Component, e.Err)
+}
+
+// Cause returns the error of the component, so that the transaction error has its
+// category
+func (e *TransactionError) Cause() error {
+
+	return e.Err
+}
+
+// A PolicyTransactor applies the policy of a PU to the enforcer and the supervisor as
+// a single transaction. It is implemented by the supervisors of the remote enforcers,
+// where both are applied by a single call.
+type PolicyTransactor interface {
+
+	// EnforceAndSupervise applies the policy to the enforcer and the supervisor of the
+	// PU, or to neither of them. It returns a *TransactionError if it failed.
+	EnforceAndSupervise(contextID string, puInfo *policy.PUInfo) error
+}
+
+// A PolicyAcknowledger reports the policies it applied to the PUs. It is implemented
+// by the supervisors that apply some policies after the call that received them
+// returned, so that the caller cannot tell when the policy is in place.
+type PolicyAcknowledger interface {
+
+	// SetAckHandler sets the handler called with each policy applied to a PU
+	SetAckHandler(handler func(contextID string, puInfo *policy.PUInfo))
+}
+
+// ApplyTransaction applies the policy of a PU to the enforcer and then to the
+// supervisor. If either fails, both are returned to the previous policy of the PU, or
+// stop enforcing and supervising it if previous is nil.
+func ApplyTransaction(e enforcer.PolicyEnforcer, s Supervisor, contextID string, puInfo, previous *policy.PUInfo) error {
+
+	if err := e.Enforce(contextID, puInfo); err != nil {
+		return &TransactionError{
+			Component:  TransactionEnforcer,
+			Err:        err,
+			RolledBack: rollbackEnforcer(e, contextID, previous) == nil,
+		}
+	}
+
+	if err := s.Supervise(contextID, puInfo); err != nil {
+		errS := rollbackSupervisor(s, contextID, previous)
+		errE := rollbackEnforcer(e, contextID, previous)
+
+		return &TransactionError{
+			Component:  TransactionSupervisor,
+			Err:        err,
+			RolledBack: errS == nil && errE == nil,
+		}
+	}
+
+	return nil
+}
+
+// rollbackEnforcer returns the enforcer to the previous policy of the PU
+func rollbackEnforcer(e enforcer.PolicyEnforcer, contextID string, previous *policy.PUInfo) error {
+
+	var err error
+	if previous != nil {
+		err = e.Enforce(contextID, previous)
+	} else {
+		err = e.Unenforce(contextID)
+	}
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"package":   "supervisor",
+			"contextID": contextID,
+			"error":     err.Error(),
+		}).Error("Failed to roll back the enforcer")
+	}
+
+	return err
+}
+
+// rollbackSupervisor returns the supervisor to the previous policy of the PU
+func rollbackSupervisor(s Supervisor, contextID string, previous *policy.PUInfo) error {
+
+	var err error
+	if previous != nil {
+		err = s.Supervise(contextID, previous)
+	} else {
+		err = s.Unsupervise(contextID)
+	}
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"package":   "supervisor",
+			"contextID": contextID,
+			"error":     err.Error(),
+		}).Error("Failed to roll back the supervisor")
+	}
+
+	return err
+}
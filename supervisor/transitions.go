@@ -0,0 +1,100 @@
+package supervisor
+
+import (
+	"net"
+	"reflect"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/policy"
+)
+
+// flushDeniedFlows terminates the established flows of the PU that were accepted by
+// the previous version of its policy and are denied by the new one. Their next
+// packets no longer match the established state and go through the new rules
+// instead of being accepted until the flows expire.
+func (s *Config) flushDeniedFlows(contextID string, cachedEntry *cacheData, containerInfo *policy.PUInfo) {
+
+	previous := cachedEntry.policy
+	cachedEntry.policy = containerInfo.Policy.Clone()
+
+	if previous == nil || s.mode == constants.LocalServer || containerInfo.Policy.KeepTrackedFlows() {
+		return
+	}
+
+	if !aclsChanged(previous, containerInfo.Policy) {
+		return
+	}
+
+	killed := 0
+
+	for _, ip := range policyIPs(containerInfo.Policy) {
+		flows, err := s.conntrack.Flows(ip.String())
+		if err != nil {
+			log.WithFields(log.Fields{
+				"package":   "supervisor",
+				"contextID": contextID,
+				"error":     err.Error(),
+			}).Warn("Unable to list the established flows")
+			continue
+		}
+
+		for _, flow := range flows {
+			if !flowAccepted(flow, ip, previous) || flowAccepted(flow, ip, containerInfo.Policy) {
+				continue
+			}
+
+			if err := s.conntrack.Delete(flow); err != nil {
+				log.WithFields(log.Fields{
+					"package":   "supervisor",
+					"contextID": contextID,
+					"error":     err.Error(),
+				}).Warn("Unable to terminate a denied flow")
+				continue
+			}
+			killed++
+		}
+	}
+
+	if killed == 0 {
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"package":   "supervisor",
+		"contextID": contextID,
+		"killed":    killed,
+	}).Info("Terminated the established flows denied by the new policy")
+
+	s.collector.CollectFlowEvent(&collector.FlowRecord{
+		ContextID: contextID,
+		Count:     killed,
+		Tags:      containerInfo.Policy.Annotations(),
+		Action:    collector.FlowReject,
+		Mode:      collector.ReauthorizationFailed,
+	})
+}
+
+// aclsChanged returns true if the ACLs or the trusted networks of the policies differ
+func aclsChanged(previous, current *policy.PUPolicy) bool {
+
+	return !reflect.DeepEqual(previous.ApplicationACLs().Rules, current.ApplicationACLs().Rules) ||
+		!reflect.DeepEqual(previous.NetworkACLs().Rules, current.NetworkACLs().Rules) ||
+		!reflect.DeepEqual(previous.TrustedNetworks(), current.TrustedNetworks())
+}
+
+// policyIPs returns the addresses of the policy, with or without their prefix length
+func policyIPs(p *policy.PUPolicy) []net.IP {
+
+	ips := []net.IP{}
+	for _, address := range p.IPAddresses().IPs {
+		if ip, _, err := net.ParseCIDR(address); err == nil {
+			ips = append(ips, ip)
+		} else if ip := net.ParseIP(address); ip != nil {
+			ips = append(ips, ip)
+		}
+	}
+
+	return ips
+}
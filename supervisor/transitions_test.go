@@ -0,0 +1,90 @@
+package supervisor
+
+import (
+	"testing"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/enforcer"
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+	"github.com/aporeto-inc/trireme/policy"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFlushDeniedFlows(t *testing.T) {
+	Convey("Given a supervised PU with established flows", t, func() {
+		c := &flowCollector{}
+		secrets := tokens.NewPSKSecrets([]byte("test password"))
+		e := enforcer.NewDefaultDatapathEnforcer("serverID", c, nil, secrets, constants.LocalContainer)
+
+		s, _ := NewSupervisor(c, e, constants.LocalContainer, constants.IPTables)
+
+		accepted := testFlow("172.17.0.1", 40000, "192.30.253.10", 443)
+		rejected := testFlow("172.17.0.1", 40001, "192.30.253.10", 80)
+		trusted := testFlow("10.2.0.5", 50000, "172.17.0.1", 8080)
+
+		ct := &testConntrack{flows: []*conntrackFlow{accepted, rejected, trusted}}
+		s.conntrack = ct
+
+		previous := createPUInfo()
+		previous.Policy.UpdateTrustedNetworks([]string{"10.2.0.0/16"})
+
+		entry := &cacheData{policy: previous.Policy.Clone()}
+
+		Convey("When the new policy denies some of the accepted flows", func() {
+			rules := policy.NewIPRuleList([]policy.IPRule{
+				policy.IPRule{
+					Address:  "192.30.253.0/24",
+					Port:     "80:443",
+					Protocol: "TCP",
+					Action:   policy.Reject,
+				},
+			})
+
+			ips := previous.Policy.IPAddresses()
+			plc := policy.NewPUPolicy("context", policy.Police, rules, rules, nil, nil, nil, nil, ips, []string{"172.17.0.0/24"}, nil)
+			current := policy.PUInfoFromPolicyAndRuntime("context", plc, previous.Runtime)
+
+			Convey("Then the flows accepted by the previous policy only should be terminated", func() {
+				s.flushDeniedFlows("contextID", entry, current)
+
+				So(ct.deleted, ShouldResemble, []*conntrackFlow{accepted, trusted})
+				So(len(c.records), ShouldEqual, 1)
+				So(c.records[0].Action, ShouldEqual, collector.FlowReject)
+				So(c.records[0].Mode, ShouldEqual, collector.ReauthorizationFailed)
+				So(c.records[0].Count, ShouldEqual, 2)
+				So(entry.policy.NetworkACLs().Rules, ShouldResemble, rules.Rules)
+			})
+
+			Convey("Then the flows should be kept if the PU opted out", func() {
+				plc.UpdateKeepTrackedFlows(true)
+				s.flushDeniedFlows("contextID", entry, current)
+
+				So(ct.deleted, ShouldBeEmpty)
+				So(c.records, ShouldBeEmpty)
+				So(entry.policy.KeepTrackedFlows(), ShouldBeTrue)
+			})
+
+			Convey("Then the flows should be kept in the local server mode", func() {
+				s.mode = constants.LocalServer
+				s.flushDeniedFlows("contextID", entry, current)
+
+				So(ct.deleted, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the ACLs of the policy are unchanged", func() {
+			current := createPUInfo()
+			current.Policy.UpdateTrustedNetworks([]string{"10.2.0.0/16"})
+
+			Convey("Then the flows should not be listed", func() {
+				ct.flows = nil
+				s.flushDeniedFlows("contextID", entry, current)
+
+				So(ct.deleted, ShouldBeEmpty)
+				So(c.records, ShouldBeEmpty)
+			})
+		})
+	})
+}
@@ -0,0 +1,78 @@
+package testutils
+
+import (
+	"sync"
+
+	"github.com/aporeto-inc/trireme/collector"
+)
+
+// Collector keeps the records reported by the stack
+type Collector struct {
+	flows      []*collector.FlowRecord
+	containers []*collector.ContainerRecord
+	sync.Mutex
+}
+
+// NewCollector returns a collector keeping the records in memory
+func NewCollector() *Collector {
+
+	return &Collector{
+		flows:      []*collector.FlowRecord{},
+		containers: []*collector.ContainerRecord{},
+	}
+}
+
+// CollectFlowEvent implements the collector.EventCollector interface
+func (c *Collector) CollectFlowEvent(record *collector.FlowRecord) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.flows = append(c.flows, record)
+}
+
+// CollectContainerEvent implements the collector.EventCollector interface
+func (c *Collector) CollectContainerEvent(record *collector.ContainerRecord) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.containers = append(c.containers, record)
+}
+
+// Flows returns the flow records of the PU, or all of them if the contextID is empty
+func (c *Collector) Flows(contextID string) []*collector.FlowRecord {
+	c.Lock()
+	defer c.Unlock()
+
+	flows := []*collector.FlowRecord{}
+	for _, r := range c.flows {
+		if contextID == "" || r.ContextID == contextID {
+			flows = append(flows, r)
+		}
+	}
+
+	return flows
+}
+
+// Containers returns the container records of the PU, or all of them if the contextID is empty
+func (c *Collector) Containers(contextID string) []*collector.ContainerRecord {
+	c.Lock()
+	defer c.Unlock()
+
+	containers := []*collector.ContainerRecord{}
+	for _, r := range c.containers {
+		if contextID == "" || r.ContextID == contextID {
+			containers = append(containers, r)
+		}
+	}
+
+	return containers
+}
+
+// Reset removes the records
+func (c *Collector) Reset() {
+	c.Lock()
+	defer c.Unlock()
+
+	c.flows = []*collector.FlowRecord{}
+	c.containers = []*collector.ContainerRecord{}
+}
@@ -0,0 +1,176 @@
+package testutils
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/aporeto-inc/trireme/cache"
+	"github.com/aporeto-inc/trireme/enforcer"
+	"github.com/aporeto-inc/trireme/enforcer/utils/packet"
+	"github.com/aporeto-inc/trireme/utils/clock"
+)
+
+// Datapath is a simulated datapath. The packets of the simulated connections are
+// handed to the enforcer as if they were captured, and the packets accepted by the
+// enforcer are handed to the other side of the connection.
+type Datapath struct {
+	network     *source
+	application *source
+
+	verdicts map[*enforcer.CapturedPacket]*verdict
+	sync.Mutex
+}
+
+// source holds the packet handler of the enforcer
+type source struct {
+	handler func(p *enforcer.CapturedPacket)
+}
+
+// verdict is the verdict of the enforcer for a packet and the packet it accepted
+type verdict struct {
+	accepted bool
+	packet   []byte
+}
+
+// NewDatapath returns a simulated datapath
+func NewDatapath() *Datapath {
+
+	return &Datapath{
+		network:     &source{},
+		application: &source{},
+		verdicts:    map[*enforcer.CapturedPacket]*verdict{},
+	}
+}
+
+// Start implements the enforcer.PacketSource interface
+func (s *source) Start(handler func(p *enforcer.CapturedPacket)) error {
+
+	s.handler = handler
+
+	return nil
+}
+
+// NetworkSource implements the enforcer.Datapath interface
+func (d *Datapath) NetworkSource() enforcer.PacketSource {
+	return d.network
+}
+
+// ApplicationSource implements the enforcer.Datapath interface
+func (d *Datapath) ApplicationSource() enforcer.PacketSource {
+	return d.application
+}
+
+// NewFlowTable implements the enforcer.Datapath interface
+func (d *Datapath) NewFlowTable(lifetime time.Duration, clk clock.Clock) enforcer.FlowTable {
+	return cache.NewCacheWithClock(lifetime, clk)
+}
+
+// SetVerdict implements the enforcer.Datapath interface
+func (d *Datapath) SetVerdict(p *enforcer.CapturedPacket, v enforcer.PacketVerdict, buffer, options, payload []byte, mark int) error {
+	d.Lock()
+	defer d.Unlock()
+
+	accepted := make([]byte, 0, len(buffer)+len(options)+len(payload))
+	accepted = append(accepted, buffer...)
+	accepted = append(accepted, options...)
+	accepted = append(accepted, payload...)
+
+	d.verdicts[p] = &verdict{
+		accepted: v == enforcer.VerdictAccept,
+		packet:   accepted,
+	}
+
+	return nil
+}
+
+// Connect simulates the TCP handshake of a connection between two addresses. Each
+// packet goes through the application side of its sender and the network side of
+// its receiver. It returns an error naming the first packet dropped by the enforcer.
+func (d *Datapath) Connect(src string, srcPort uint16, dst string, dstPort uint16) error {
+
+	if d.network.handler == nil || d.application.handler == nil {
+		return fmt.Errorf("Enforcer is not started")
+	}
+
+	steps := []struct {
+		name   string
+		packet []byte
+	}{
+		{name: "SYN", packet: tcpPacket(src, srcPort, dst, dstPort, packet.TCPSynMask, 1000, 0)},
+		{name: "SYN-ACK", packet: tcpPacket(dst, dstPort, src, srcPort, packet.TCPSynAckMask, 5000, 1001)},
+		{name: "ACK", packet: tcpPacket(src, srcPort, dst, dstPort, packet.TCPAckMask, 1001, 5001)},
+	}
+
+	for _, step := range steps {
+
+		sent, err := d.process(d.application, step.packet)
+		if err != nil {
+			return fmt.Errorf("%s was dropped by the sender: %s", step.name, err)
+		}
+
+		if _, err := d.process(d.network, sent); err != nil {
+			return fmt.Errorf("%s was dropped by the receiver: %s", step.name, err)
+		}
+	}
+
+	return nil
+}
+
+// process hands the packet to the enforcer and returns the packet it accepted
+func (d *Datapath) process(s *source, buffer []byte) ([]byte, error) {
+
+	p := &enforcer.CapturedPacket{
+		Buffer: buffer,
+		Mark:   "0",
+	}
+
+	s.handler(p)
+
+	d.Lock()
+	defer d.Unlock()
+
+	v, ok := d.verdicts[p]
+	if !ok {
+		return nil, fmt.Errorf("no verdict")
+	}
+	delete(d.verdicts, p)
+
+	if !v.accepted {
+		return nil, fmt.Errorf("policy")
+	}
+
+	return v.packet, nil
+}
+
+// tcpPacket returns a TCP packet without options nor payload
+func tcpPacket(src string, srcPort uint16, dst string, dstPort uint16, flags uint8, seq, ack uint32) []byte {
+
+	buffer := make([]byte, 40)
+
+	buffer[0] = 0x45
+	binary.BigEndian.PutUint16(buffer[2:4], uint16(len(buffer)))
+	buffer[8] = 64
+	buffer[9] = packet.IPProtocolTCP
+	copy(buffer[12:16], net.ParseIP(src).To4())
+	copy(buffer[16:20], net.ParseIP(dst).To4())
+
+	binary.BigEndian.PutUint16(buffer[20:22], srcPort)
+	binary.BigEndian.PutUint16(buffer[22:24], dstPort)
+	binary.BigEndian.PutUint32(buffer[24:28], seq)
+	binary.BigEndian.PutUint32(buffer[28:32], ack)
+	buffer[32] = 0x50
+	buffer[33] = flags
+	binary.BigEndian.PutUint16(buffer[34:36], 0xffff)
+
+	p, err := packet.New(packet.PacketTypeApplication, buffer, "0")
+	if err != nil {
+		return buffer
+	}
+	p.UpdateIPChecksum()
+	p.UpdateTCPChecksum()
+
+	return p.GetBytes()
+}
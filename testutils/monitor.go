@@ -0,0 +1,69 @@
+package testutils
+
+import (
+	"fmt"
+
+	"github.com/aporeto-inc/trireme/monitor"
+	"github.com/aporeto-inc/trireme/policy"
+)
+
+// Monitor generates the events of the PUs on request of the test
+type Monitor struct {
+	handler monitor.ProcessingUnitsHandler
+	started bool
+}
+
+// NewMonitor returns a monitor sending the events to the handler
+func NewMonitor(handler monitor.ProcessingUnitsHandler) *Monitor {
+
+	return &Monitor{
+		handler: handler,
+	}
+}
+
+// Start implements the monitor.Monitor interface
+func (m *Monitor) Start() error {
+
+	m.started = true
+
+	return nil
+}
+
+// Stop implements the monitor.Monitor interface
+func (m *Monitor) Stop() error {
+
+	m.started = false
+
+	return nil
+}
+
+// StartPU sets the runtime of a PU and sends its start event. It returns when the
+// policy of the PU is enforced.
+func (m *Monitor) StartPU(contextID string, runtime *policy.PURuntime) error {
+
+	if err := m.handler.SetPURuntime(contextID, runtime); err != nil {
+		return err
+	}
+
+	return m.SendEvent(contextID, monitor.EventStart)
+}
+
+// StopPU sends the stop and destroy events of a PU
+func (m *Monitor) StopPU(contextID string) error {
+
+	if err := m.SendEvent(contextID, monitor.EventStop); err != nil {
+		return err
+	}
+
+	return m.SendEvent(contextID, monitor.EventDestroy)
+}
+
+// SendEvent sends an event of a PU and waits for its processing
+func (m *Monitor) SendEvent(contextID string, event monitor.Event) error {
+
+	if !m.started {
+		return fmt.Errorf("Monitor is not started")
+	}
+
+	return <-m.handler.HandlePUEvent(contextID, event)
+}
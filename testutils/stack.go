@@ -0,0 +1,104 @@
+// Package testutils wires an in-memory trireme stack to run end to end policy tests
+// without root privileges, iptables or Docker. The PU events are generated by the
+// test, the rules are kept in memory and the packets of the simulated connections
+// go through the datapath of a real enforcer. The flows and the tokens expire with
+// a fake clock advanced by the test.
+package testutils
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aporeto-inc/trireme"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/enforcer"
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+	"github.com/aporeto-inc/trireme/supervisor"
+	"github.com/aporeto-inc/trireme/utils/clock"
+)
+
+// Stack is an in-memory trireme stack
+type Stack struct {
+	trireme.Trireme
+
+	Monitor    *Monitor
+	Supervisor *Supervisor
+	Datapath   *Datapath
+	Collector  *Collector
+	Clock      *clock.Fake
+}
+
+// stackEpoch is the initial time of the clock of the stacks
+var stackEpoch = time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// NewStack returns an in-memory stack of the resolver. The policies returned by the
+// resolver must hold the addresses of the PUs, since no network is created for them.
+func NewStack(serverID string, resolver trireme.PolicyResolver, secrets tokens.Secrets) (*Stack, error) {
+
+	if resolver == nil {
+		return nil, fmt.Errorf("Resolver cannot be nil")
+	}
+
+	if secrets == nil {
+		return nil, fmt.Errorf("Secrets cannot be nil")
+	}
+
+	clk := clock.NewFake(stackEpoch)
+	c := NewCollector()
+	s := NewSupervisor()
+	dp := NewDatapath()
+
+	e := enforcer.NewDefaultDatapathEnforcer(serverID, c, nil, secrets, constants.LocalContainer)
+
+	configurer, ok := e.(enforcer.DatapathConfigurer)
+	if !ok {
+		return nil, fmt.Errorf("Enforcer does not support alternative datapaths")
+	}
+	configurer.SetDatapath(dp)
+
+	clockConfigurer, ok := e.(enforcer.ClockConfigurer)
+	if !ok {
+		return nil, fmt.Errorf("Enforcer does not support alternative clocks")
+	}
+	if err := clockConfigurer.SetClock(clk); err != nil {
+		return nil, err
+	}
+
+	t := trireme.NewTrireme(
+		serverID,
+		resolver,
+		map[constants.PUType]supervisor.Supervisor{constants.ContainerPU: s},
+		map[constants.PUType]supervisor.Excluder{constants.ContainerPU: s},
+		map[constants.PUType]enforcer.PolicyEnforcer{constants.ContainerPU: e},
+		c,
+	)
+
+	return &Stack{
+		Trireme:    t,
+		Monitor:    NewMonitor(t),
+		Supervisor: s,
+		Datapath:   dp,
+		Collector:  c,
+		Clock:      clk,
+	}, nil
+}
+
+// Start starts trireme and the monitor
+func (s *Stack) Start() error {
+
+	if err := s.Trireme.Start(); err != nil {
+		return err
+	}
+
+	return s.Monitor.Start()
+}
+
+// Stop stops the monitor and trireme
+func (s *Stack) Stop() error {
+
+	if err := s.Monitor.Stop(); err != nil {
+		return err
+	}
+
+	return s.Trireme.Stop()
+}
@@ -0,0 +1,94 @@
+package testutils
+
+import (
+	"testing"
+
+	"github.com/aporeto-inc/trireme/collector"
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/enforcer/utils/tokens"
+	"github.com/aporeto-inc/trireme/monitor"
+	"github.com/aporeto-inc/trireme/policy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// roleResolver accepts the connections to the PUs of the role db from the PUs of the role web
+type roleResolver struct{}
+
+func (r *roleResolver) ResolvePolicy(contextID string, runtime policy.RuntimeReader) (*policy.PUPolicy, error) {
+
+	role, _ := runtime.Tag("role")
+
+	p := policy.NewPUPolicy(contextID, policy.Police, nil, nil, nil, nil, nil, nil, runtime.IPAddresses(), []string{"10.0.0.0/8"}, nil)
+	p.AddIdentityTag("role", role)
+
+	if role == "db" {
+		p.AddReceiverRules(&policy.TagSelector{
+			Clause: []policy.KeyValueOperator{
+				{
+					Key:      "role",
+					Value:    []string{"web"},
+					Operator: policy.Equal,
+				},
+			},
+			Action: policy.Accept,
+		})
+	}
+
+	return p, nil
+}
+
+func (r *roleResolver) HandlePUEvent(contextID string, eventType monitor.Event) {}
+
+func testRuntime(name, role, ip string) *policy.PURuntime {
+
+	return policy.NewPURuntime(
+		name,
+		1,
+		policy.NewTagsMap(map[string]string{"role": role}),
+		policy.NewIPMap(map[string]string{policy.DefaultNamespace: ip}),
+		constants.ContainerPU,
+		nil,
+	)
+}
+
+func TestStack(t *testing.T) {
+
+	Convey("Given I start an in-memory stack", t, func() {
+
+		stack, err := NewStack("serverID", &roleResolver{}, tokens.NewPSKSecrets([]byte("test password")))
+		So(err, ShouldBeNil)
+		So(stack.Start(), ShouldBeNil)
+
+		Convey("When I start two PUs", func() {
+
+			So(stack.Monitor.StartPU("web", testRuntime("web", "web", "10.1.0.1")), ShouldBeNil)
+			So(stack.Monitor.StartPU("db", testRuntime("db", "db", "10.1.0.2")), ShouldBeNil)
+
+			Convey("Then the PUs should be supervised", func() {
+				So(stack.Supervisor.Supervised("web"), ShouldNotBeNil)
+				So(stack.Supervisor.Supervised("db"), ShouldNotBeNil)
+			})
+
+			Convey("Then the connections accepted by the policy should be established", func() {
+				So(stack.Datapath.Connect("10.1.0.1", 40000, "10.1.0.2", 5432), ShouldBeNil)
+
+				flows := stack.Collector.Flows("db")
+				So(len(flows), ShouldEqual, 1)
+				So(flows[0].Action, ShouldEqual, collector.FlowAccept)
+			})
+
+			Convey("Then the connections rejected by the policy should be dropped", func() {
+				So(stack.Datapath.Connect("10.1.0.2", 40000, "10.1.0.1", 80), ShouldNotBeNil)
+			})
+
+			Convey("When I stop a PU", func() {
+
+				So(stack.Monitor.StopPU("db"), ShouldBeNil)
+
+				Convey("Then it should no longer be supervised", func() {
+					So(stack.Supervisor.Supervised("db"), ShouldBeNil)
+				})
+			})
+		})
+	})
+}
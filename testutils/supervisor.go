@@ -0,0 +1,80 @@
+package testutils
+
+import (
+	"sync"
+
+	"github.com/aporeto-inc/trireme/policy"
+)
+
+// Supervisor keeps the supervised PUs in memory instead of programming the rules
+// of the host
+type Supervisor struct {
+	pus         map[string]*policy.PUInfo
+	excludedIPs []string
+	sync.Mutex
+}
+
+// NewSupervisor returns an in-memory supervisor
+func NewSupervisor() *Supervisor {
+
+	return &Supervisor{
+		pus:         map[string]*policy.PUInfo{},
+		excludedIPs: []string{},
+	}
+}
+
+// Supervise implements the supervisor.Supervisor interface
+func (s *Supervisor) Supervise(contextID string, puInfo *policy.PUInfo) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.pus[contextID] = puInfo
+
+	return nil
+}
+
+// Unsupervise implements the supervisor.Supervisor interface
+func (s *Supervisor) Unsupervise(contextID string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.pus, contextID)
+
+	return nil
+}
+
+// Start implements the supervisor.Supervisor interface
+func (s *Supervisor) Start() error {
+	return nil
+}
+
+// Stop implements the supervisor.Supervisor interface
+func (s *Supervisor) Stop() error {
+	return nil
+}
+
+// AddExcludedIPs implements the supervisor.Excluder interface
+func (s *Supervisor) AddExcludedIPs(ips []string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.excludedIPs = append([]string{}, ips...)
+
+	return nil
+}
+
+// Supervised returns the PU information of a supervised PU, or nil
+func (s *Supervisor) Supervised(contextID string) *policy.PUInfo {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.pus[contextID]
+}
+
+// ExcludedIPs returns the excluded addresses
+func (s *Supervisor) ExcludedIPs() []string {
+	s.Lock()
+	defer s.Unlock()
+
+	return append([]string{}, s.excludedIPs...)
+}
@@ -2,6 +2,7 @@ package trireme
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/aporeto-inc/trireme/cache"
 	"github.com/aporeto-inc/trireme/collector"
@@ -10,6 +11,11 @@ import (
 	"github.com/aporeto-inc/trireme/monitor"
 	"github.com/aporeto-inc/trireme/policy"
 	"github.com/aporeto-inc/trireme/supervisor"
+	"github.com/aporeto-inc/trireme/utils/auditlog"
+	"github.com/aporeto-inc/trireme/utils/clock"
+	"github.com/aporeto-inc/trireme/utils/errortypes"
+	"github.com/aporeto-inc/trireme/utils/features"
+	"github.com/aporeto-inc/trireme/utils/tracing"
 
 	log "github.com/Sirupsen/logrus"
 )
@@ -24,7 +30,49 @@ type trireme struct {
 	resolver    PolicyResolver
 	collector   collector.EventCollector
 	stop        chan bool
+	stopped     chan bool
 	requests    chan *triremeRequest
+	states      *stateTracker
+	// quarantined are the quarantined PUs. It is only used by the request routine.
+	quarantined map[string]*quarantine
+	// applied is the policy last applied to each enforced PU, restored when a new
+	// policy fails. It is only used by the request routine.
+	applied map[string]*policy.PUInfo
+	// revision is the current policy revision and rollout the running rollout of
+	// a candidate revision. They are only used by the request routine.
+	revision string
+	rollout  *Rollout
+	// breakers are the retry states of the PUs whose policy failed. They are only
+	// used by the request routine.
+	breakers map[string]*breaker
+	retry    RetryPolicy
+	clock    clock.Clock
+	// features are the feature flags of the datapath
+	features *features.Flags
+	// services are the services referenced by the IPRules of the policies
+	services *policy.ServiceRegistry
+	// convergence tracks the policy revisions acknowledged by the PUs
+	convergence *convergenceTracker
+	// updating is 1 while the remote enforcers are updated
+	updating int32
+	// health is the health policy of the remote enforcers. The failures of their
+	// health checks are only used by the health checks.
+	health         EnforcerHealthPolicy
+	healthFailures map[string]int
+	healthTimer    clock.Timer
+	healthStopped  bool
+	healthLock     sync.Mutex
+	// reaper is the policy detecting the dead PUs. The failures of their probes are
+	// only used by the reaper.
+	reaper         ReaperPolicy
+	reaperFailures map[string]int
+	reaperTimer    clock.Timer
+	reaperStopped  bool
+	reaperLock     sync.Mutex
+	// auditLog records the policy resolutions and enforcements, and trigger is the
+	// trigger of the request being handled. It is only used by the request routine.
+	auditLog *auditlog.Log
+	trigger  string
 }
 
 // NewTrireme returns a reference to the trireme object based on the parameter subelements.
@@ -40,8 +88,20 @@ func NewTrireme(serverID string, resolver PolicyResolver, supervisors map[consta
 		collector:   eventCollector,
 		stop:        make(chan bool),
 		requests:    make(chan *triremeRequest),
+		states:      newStateTracker(),
+		quarantined: map[string]*quarantine{},
+		applied:     map[string]*policy.PUInfo{},
+		breakers:    map[string]*breaker{},
+		retry:       DefaultRetryPolicy,
+		clock:       clock.New(),
+		convergence: newConvergenceTracker(),
+		health:      DefaultEnforcerHealthPolicy,
+		reaper:      DefaultReaperPolicy,
+		services:    policy.NewWellKnownServiceRegistry(),
 	}
 
+	trireme.trackAcknowledgements()
+
 	return trireme
 }
 
@@ -70,8 +130,14 @@ func (t *trireme) Start() error {
 		}
 	}
 
-	// Starting main trireme routine
-	go t.run()
+	// Starting main trireme routine. The stop channel is closed when stopped, and a
+	// new one is needed when started again.
+	t.stop = make(chan bool)
+	t.stopped = make(chan bool)
+	go t.run(t.stop, t.stopped)
+
+	t.scheduleHealthChecks()
+	t.scheduleReaper()
 
 	return nil
 }
@@ -80,6 +146,23 @@ func (t *trireme) Start() error {
 // for PU Creation/Update and Policy Updates
 func (t *trireme) Stop() error {
 
+	// The timers are stopped first, so that no health check or probe restarts an
+	// enforcer being stopped
+	t.stopHealthChecks()
+	t.stopReaper()
+
+	// close the stop channel for the trireme worker routine and the requests waiting
+	// for it, and wait for the request being handled.
+	select {
+	case <-t.stop:
+	default:
+		close(t.stop)
+	}
+
+	if t.stopped != nil {
+		<-t.stopped
+	}
+
 	for _, s := range t.supervisors {
 		if err := s.Stop(); err != nil {
 			log.WithFields(log.Fields{
@@ -98,9 +181,6 @@ func (t *trireme) Stop() error {
 		}
 	}
 
-	// send the stop signal for the trireme worker routine.
-	t.stop <- true
-
 	return nil
 }
 
@@ -154,8 +234,32 @@ func (t *trireme) PURuntime(contextID string) (policy.RuntimeReader, error) {
 // SetPURuntime returns the RuntimeInfo based on the contextID.
 func (t *trireme) SetPURuntime(contextID string, runtimeInfo *policy.PURuntime) error {
 
-	return t.cache.AddOrUpdate(contextID, runtimeInfo)
+	if err := t.cache.AddOrUpdate(contextID, runtimeInfo); err != nil {
+		return err
+	}
+
+	t.states.add(contextID)
+
+	return nil
+
+}
+
+// UpdateRuntimeTags implements the RuntimeUpdater interface
+func (t *trireme) UpdateRuntimeTags(contextID string, tags map[string]string) <-chan error {
+
+	c := make(chan error, 1)
+
+	req := &triremeRequest{
+		contextID:  contextID,
+		reqType:    runtimeUpdate,
+		eventType:  monitor.EventUpdate,
+		tags:       tags,
+		returnChan: c,
+	}
 
+	t.requests <- req
+
+	return c
 }
 
 // addTransmitterLabel adds the TransmitterLabel as a fixed label in the policy.
@@ -201,12 +305,12 @@ func (t *trireme) doHandleCreate(contextID string) error {
 			Event:     collector.ContainerFailed,
 		})
 
-		return fmt.Errorf("Couldn't get the runtimeInfo from the cache %s", err)
+		return errortypes.Wrapf(errortypes.ErrPUNotFound, err, "Couldn't get the runtimeInfo from the cache")
 	}
 
 	runtimeInfo := cachedElement.(*policy.PURuntime)
 
-	policyInfo, err := t.resolver.ResolvePolicy(contextID, runtimeInfo)
+	policyInfo, err := t.resolvePolicy(contextID, runtimeInfo)
 
 	if err != nil {
 		t.collector.CollectContainerEvent(&collector.ContainerRecord{
@@ -216,7 +320,9 @@ func (t *trireme) doHandleCreate(contextID string) error {
 			Event:     collector.ContainerFailed,
 		})
 
-		return fmt.Errorf("Policy Error for this context: %s. Container killed. %s", contextID, err)
+		t.states.applied(contextID, EnforcementFailed)
+
+		return errortypes.Wrapf(errortypes.ErrPolicyRejected, err, "Policy Error for this context: %s. Container killed", contextID)
 	}
 
 	if policyInfo == nil {
@@ -227,7 +333,9 @@ func (t *trireme) doHandleCreate(contextID string) error {
 			Event:     collector.ContainerFailed,
 		})
 
-		return fmt.Errorf("Nil policy returned for context: %s. Container killed", contextID)
+		t.states.applied(contextID, EnforcementFailed)
+
+		return errortypes.Errorf(errortypes.ErrPolicyRejected, "Nil policy returned for context: %s. Container killed", contextID)
 	}
 
 	ip, _ := policyInfo.DefaultIPAddress()
@@ -247,23 +355,24 @@ func (t *trireme) doHandleCreate(contextID string) error {
 			Event:     collector.ContainerIgnored,
 		})
 
+		t.states.applied(contextID, EnforcementIgnored)
+		t.states.summarized(contextID, containerInfo.Policy)
+
 		return nil
 	}
 
-	if err := t.enforcers[containerInfo.Runtime.PUType()].Enforce(contextID, containerInfo); err != nil {
-
+	if puModeOf(contextID, runtimeInfo) == PUModeObserve {
 		t.collector.CollectContainerEvent(&collector.ContainerRecord{
 			ContextID: contextID,
 			IPAddress: ip,
 			Tags:      policyInfo.Annotations(),
-			Event:     collector.ContainerFailed,
+			Event:     collector.ContainerIgnored,
 		})
 
-		return fmt.Errorf("Not able to setup enforcer: %s", err)
+		return t.doObserve(contextID, containerInfo)
 	}
 
-	if err := t.supervisors[containerInfo.Runtime.PUType()].Supervise(contextID, containerInfo); err != nil {
-		t.enforcers[containerInfo.Runtime.PUType()].Unenforce(contextID)
+	if err := t.applyPolicy(contextID, containerInfo); err != nil {
 
 		t.collector.CollectContainerEvent(&collector.ContainerRecord{
 			ContextID: contextID,
@@ -272,7 +381,9 @@ func (t *trireme) doHandleCreate(contextID string) error {
 			Event:     collector.ContainerFailed,
 		})
 
-		return fmt.Errorf("Not able to setup supervisor: %s", err)
+		t.states.failed(contextID, err)
+
+		return errortypes.Wrapf(nil, err, "Not able to setup the PU")
 	}
 
 	t.collector.CollectContainerEvent(&collector.ContainerRecord{
@@ -282,6 +393,8 @@ func (t *trireme) doHandleCreate(contextID string) error {
 		Event:     collector.ContainerStart,
 	})
 
+	t.states.applied(contextID, EnforcementEnforced)
+
 	return nil
 }
 
@@ -297,15 +410,20 @@ func (t *trireme) doHandleDelete(contextID string) error {
 			Event:     collector.UnknownContainerDelete,
 		})
 
-		return fmt.Errorf("Error getting Runtime out of cache for ContextID %s : %s", contextID, err)
+		return errortypes.Wrapf(errortypes.ErrPUNotFound, err, "Error getting Runtime out of cache for ContextID %s", contextID)
 	}
 
 	ip, _ := runtime.DefaultIPAddress()
+	revision := t.appliedRevision(contextID)
 
 	errS := t.supervisors[runtime.PUType()].Unsupervise(contextID)
 	errE := t.enforcers[runtime.PUType()].Unenforce(contextID)
 
 	t.cache.Remove(contextID)
+	t.states.remove(contextID)
+	delete(t.quarantined, contextID)
+	delete(t.applied, contextID)
+	t.convergence.remove(contextID, t.clock.Now())
 
 	if errS != nil || errE != nil {
 		t.collector.CollectContainerEvent(&collector.ContainerRecord{
@@ -315,9 +433,14 @@ func (t *trireme) doHandleDelete(contextID string) error {
 			Event:     collector.ContainerDelete,
 		})
 
-		return fmt.Errorf("Delete Error for contextID %s. supervisor %s, enforcer %s", contextID, errS, errE)
+		err := fmt.Errorf("Delete Error for contextID %s. supervisor %s, enforcer %s", contextID, errS, errE)
+		t.audit(auditlog.ActionUnenforce, contextID, revision, "", err)
+
+		return err
 	}
 
+	t.audit(auditlog.ActionUnenforce, contextID, revision, "", nil)
+
 	t.collector.CollectContainerEvent(&collector.ContainerRecord{
 		ContextID: contextID,
 		IPAddress: ip,
@@ -331,23 +454,90 @@ func (t *trireme) doHandleDelete(contextID string) error {
 func (t *trireme) doHandleEvent(contextID string, event monitor.Event) error {
 	// Notify The PolicyResolver that an event occurred:
 	t.resolver.HandlePUEvent(contextID, event)
+	if t.rollout != nil {
+		t.rollout.Resolver.HandlePUEvent(contextID, event)
+	}
 
 	switch event {
 	case monitor.EventStart:
 		return t.doHandleCreate(contextID)
 	case monitor.EventStop:
 		return t.doHandleDelete(contextID)
+	case monitor.EventUpdate:
+		return t.doHandleUpdate(contextID)
 	default:
 		return nil
 	}
 }
 
+// doHandleUpdate reprograms a running PU after its runtime changed. The policy is
+// resolved again with the new runtime and the enforcer and supervisor state are
+// updated in place.
+func (t *trireme) doHandleUpdate(contextID string) error {
+
+	runtimeInfo, err := t.PURuntime(contextID)
+	if err != nil {
+		return errortypes.Errorf(errortypes.ErrPUNotFound, "Runtime update failed because couldn't find runtime for contextID %s", contextID)
+	}
+
+	policyInfo, err := t.resolvePolicy(contextID, runtimeInfo)
+	if err != nil {
+		return errortypes.Wrapf(errortypes.ErrPolicyRejected, err, "Policy Error for this context: %s", contextID)
+	}
+
+	if policyInfo == nil {
+		return errortypes.Errorf(errortypes.ErrPolicyRejected, "Nil policy returned for context: %s", contextID)
+	}
+
+	return t.doUpdatePolicy(contextID, policyInfo.Clone())
+}
+
+// doUpdateRuntimeTags sets the tags of the runtime of a PU and handles the update of
+// the runtime like a runtime event, so that the resolver knows of it
+func (t *trireme) doUpdateRuntimeTags(contextID string, tags map[string]string) error {
+
+	runtimeInfo, err := t.PURuntime(contextID)
+	if err != nil {
+		return errortypes.Errorf(errortypes.ErrPUNotFound, "Runtime update failed because couldn't find runtime for contextID %s", contextID)
+	}
+
+	updated := runtimeInfo.(*policy.PURuntime).Clone()
+
+	runtimeTags := updated.Tags()
+	for k, v := range tags {
+		if v == "" {
+			delete(runtimeTags.Tags, k)
+			continue
+		}
+		runtimeTags.Add(k, v)
+	}
+	updated.SetTags(runtimeTags)
+
+	if err := t.cache.AddOrUpdate(contextID, updated); err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"package":   "trireme",
+		"contextID": contextID,
+		"tags":      tags,
+	}).Info("Updated the runtime tags of the PU")
+
+	return t.doHandleEvent(contextID, monitor.EventUpdate)
+}
+
 func (t *trireme) doUpdatePolicy(contextID string, newPolicy *policy.PUPolicy) error {
 
+	// The policy of a quarantined PU is applied when the quarantine is lifted
+	if q, ok := t.quarantined[contextID]; ok {
+		q.pending = newPolicy
+		return nil
+	}
+
 	runtimeInfo, err := t.PURuntime(contextID)
 
 	if err != nil {
-		return fmt.Errorf("Policy Update failed because couldn't find runtime for contextID %s", contextID)
+		return errortypes.Errorf(errortypes.ErrPUNotFound, "Policy Update failed because couldn't find runtime for contextID %s", contextID)
 	}
 
 	containerInfo := policy.PUInfoFromPolicyAndRuntime(contextID, newPolicy, runtimeInfo.(*policy.PURuntime))
@@ -358,28 +548,20 @@ func (t *trireme) doUpdatePolicy(contextID string, newPolicy *policy.PUPolicy) e
 		return nil
 	}
 
-	if err = t.enforcers[containerInfo.Runtime.PUType()].Enforce(contextID, containerInfo); err != nil {
+	if puModeOf(contextID, containerInfo.Runtime) == PUModeObserve {
+		return t.doObserve(contextID, containerInfo)
+	}
+
+	if err = t.applyPolicy(contextID, containerInfo); err != nil {
 
 		log.WithFields(log.Fields{
 			"package":   "trireme",
 			"contextID": contextID,
+			"policy":    newPolicy,
 			"error":     err.Error(),
-		}).Error("Policy Update failed for Enforcer")
-		return fmt.Errorf("Policy Update failed for Enforcer %s", err)
-	}
-
-	if err = t.supervisors[containerInfo.Runtime.PUType()].Supervise(contextID, containerInfo); err != nil {
-		t.enforcers[containerInfo.Runtime.PUType()].Unenforce(contextID)
-
-		log.WithFields(log.Fields{
-			"package":     "trireme",
-			"trireme":     t,
-			"contextID":   contextID,
-			"policy":      newPolicy,
-			"runtimeInfo": runtimeInfo,
-			"error":       err,
-		}).Error("Policy Update failed for Supervisor")
-		return fmt.Errorf("Policy Update failed for Supervisor %s", err)
+		}).Error("Policy Update failed")
+		t.states.failed(contextID, err)
+		return errortypes.Wrapf(nil, err, "Policy Update failed")
 	}
 
 	ip, _ := newPolicy.DefaultIPAddress()
@@ -390,15 +572,144 @@ func (t *trireme) doUpdatePolicy(contextID string, newPolicy *policy.PUPolicy) e
 		Event:     collector.ContainerUpdate,
 	})
 
+	t.states.applied(contextID, EnforcementEnforced)
+
+	return nil
+}
+
+// applyPolicy applies the policy of a PU to its enforcer and its supervisor as a
+// single transaction. If either fails, the PU is returned to the policy previously
+// applied, so that the ACLs and the datapath never enforce different policies.
+func (t *trireme) applyPolicy(contextID string, containerInfo *policy.PUInfo) (err error) {
+
+	puType := containerInfo.Runtime.PUType()
+
+	oldRevision := t.appliedRevision(contextID)
+	revision := revisionOf(containerInfo.Policy)
+	defer func() {
+		t.audit(auditlog.ActionEnforce, contextID, oldRevision, revision, err)
+	}()
+
+	t.enableFeatures(containerInfo)
+
+	containerInfo, err = t.resolveServices(containerInfo)
+	if err != nil {
+		return err
+	}
+
+	t.convergence.requested(contextID, revision, t.clock.Now())
+
+	if transactor, ok := t.supervisors[puType].(supervisor.PolicyTransactor); ok {
+		err = transactor.EnforceAndSupervise(contextID, containerInfo)
+	} else {
+		err = supervisor.ApplyTransaction(t.enforcers[puType], t.supervisors[puType], contextID, containerInfo, t.applied[contextID])
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if _, ok := t.supervisors[puType].(supervisor.PolicyAcknowledger); !ok {
+		t.convergence.acknowledged(contextID, revision, t.clock.Now())
+	}
+
+	t.applied[contextID] = containerInfo
+	t.states.summarized(contextID, containerInfo.Policy)
+
 	return nil
 }
 
-func (t *trireme) handleRequest(request *triremeRequest) error {
+// SetServiceRegistry implements the ServiceConfigurer interface
+func (t *trireme) SetServiceRegistry(services *policy.ServiceRegistry) {
+
+	t.services = services
+}
+
+// resolveServices returns the PU with the rules of the services of its policy replaced
+// by the rules of their ports. The policies without services are left alone.
+func (t *trireme) resolveServices(containerInfo *policy.PUInfo) (*policy.PUInfo, error) {
+
+	if len(containerInfo.Policy.ServiceNames()) == 0 {
+		return containerInfo, nil
+	}
+
+	resolved, err := containerInfo.Policy.PolicyForServices(t.services)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to resolve the services of the policy: %s", err)
+	}
+
+	return policy.PUInfoFromPolicyAndRuntime(containerInfo.ContextID, resolved, containerInfo.Runtime), nil
+}
+
+// SetFeatureFlags implements the FeatureConfigurer interface
+func (t *trireme) SetFeatureFlags(flags *features.Flags) {
+
+	t.features = flags
+}
+
+// enableFeatures sets the datapath features enabled by the flags and by the mode of
+// the PU in its policy
+func (t *trireme) enableFeatures(containerInfo *policy.PUInfo) {
+
+	enabled := t.features.For(containerInfo.Runtime.PUType(), containerInfo.Runtime.Tags())
+
+	containerInfo.Policy.UpdateFeatures(modeFeatures(containerInfo.ContextID, containerInfo.Runtime, enabled))
+}
+
+// requestSpans are the names of the spans of the requests applying a policy
+var requestSpans = map[int]string{
+	handleEvent:     "trireme.HandlePUEvent",
+	policyUpdate:    "trireme.UpdatePolicy",
+	enforcerRestart: "trireme.RestartEnforcer",
+	runtimeUpdate:   "trireme.UpdateRuntimeTags",
+}
+
+// handleRequest handles a request. The requests applying a policy are traced as
+// children of the operation bound to their PU, like the event of a monitor, and the
+// calls made for the PU while they are handled are traced as their children.
+func (t *trireme) handleRequest(request *triremeRequest) (err error) {
+
+	name, ok := requestSpans[request.reqType]
+	if !ok {
+		return t.dispatchRequest(request)
+	}
+
+	ctx, span := tracing.Start(tracing.ContextOf(request.contextID), name)
+	span.SetAttribute(tracing.ContextIDAttribute, request.contextID)
+	if request.reqType == handleEvent {
+		span.SetAttribute(tracing.EventAttribute, string(request.eventType))
+	}
+	defer func() {
+		tracing.End(span, err)
+	}()
+
+	unbind := tracing.Bind(request.contextID, ctx)
+	defer unbind()
+
+	return t.dispatchRequest(request)
+}
+
+// dispatchRequest handles a request according to its type
+func (t *trireme) dispatchRequest(request *triremeRequest) error {
 	switch request.reqType {
 	case handleEvent:
 		return t.doHandleEvent(request.contextID, request.eventType)
 	case policyUpdate:
-		return t.doUpdatePolicy(request.contextID, request.policyInfo)
+		return t.doPushedPolicy(request.contextID, request.policyInfo)
+	case quarantineUpdate:
+		return t.doQuarantine(request.contextID, request.quarantineMode)
+	case snapshotRequest:
+		return t.doSnapshot(request.snapshot)
+	case convergenceRequest:
+		return t.doWaitForConvergence(request.revision, request.convergence)
+	case rolloutStart:
+		return t.doStartRollout(request.rollout)
+	case rolloutEnd:
+		return t.doEndRollout(request.promote)
+	case enforcerRestart:
+		return t.doRestartEnforcer(request.contextID)
+	case runtimeUpdate:
+		return t.doUpdateRuntimeTags(request.contextID, request.tags)
 	default:
 		log.WithFields(log.Fields{
 			"package": "trireme",
@@ -408,6 +719,16 @@ func (t *trireme) handleRequest(request *triremeRequest) error {
 	}
 }
 
+// Enforcer returns the Trireme enforcer for the given PU Type
+func (t *trireme) Enforcer(kind constants.PUType) enforcer.PolicyEnforcer {
+
+	if e, ok := t.enforcers[kind]; ok {
+		return e
+	}
+
+	return nil
+}
+
 // Supervisor returns the Trireme supervisor for the given PU Type
 func (t *trireme) Supervisor(kind constants.PUType) supervisor.Supervisor {
 
@@ -418,21 +739,49 @@ func (t *trireme) Supervisor(kind constants.PUType) supervisor.Supervisor {
 	return nil
 }
 
+// FlushStats implements the StatsFlusher interface
+func (t *trireme) FlushStats(contextID string) error {
+
+	runtime, err := t.PURuntime(contextID)
+	if err != nil {
+		return errortypes.Wrapf(errortypes.ErrPUNotFound, err, "Cannot flush the stats of %s", contextID)
+	}
+
+	flusher, ok := t.enforcers[runtime.PUType()].(enforcer.StatsFlusher)
+	if !ok {
+		return nil
+	}
+
+	return flusher.FlushStats(contextID)
+}
+
 //AddExcludedIpList  pushes the list of excluded IP to all supervisors in the system
 func (t *trireme) AddExcludedIPList(ipList []string) error {
 	for _, excluder := range t.excluders {
 		excluder.AddExcludedIPs(ipList)
 	}
+
+	if c, ok := t.collector.(collector.AdminEventCollector); ok {
+		c.CollectAdminEvent(&collector.AdminRecord{
+			Action: collector.AdminExcludeIPs,
+			IPs:    ipList,
+		})
+	}
+
 	return nil
 
 }
-func (t *trireme) run() {
+func (t *trireme) run(stop chan bool, stopped chan bool) {
+
+	defer close(stopped)
+
 	for {
 		select {
-		case <-t.stop:
+		case <-stop:
 			log.WithFields(log.Fields{
 				"package": "trireme",
 			}).Debug("Stopping trireme worker.")
+			t.stopRetries()
 			return
 		case req := <-t.requests:
 			log.WithFields(log.Fields{
@@ -440,7 +789,7 @@ func (t *trireme) run() {
 				"type":      req.reqType,
 				"contextID": req.contextID,
 			}).Debug("Handling Trireme Request.")
-			req.returnChan <- t.handleRequest(req)
+			req.returnChan <- t.handleWithRetries(req)
 		}
 	}
 }
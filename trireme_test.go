@@ -1,8 +1,18 @@
 package trireme
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/aporeto-inc/trireme/collector"
 	"github.com/aporeto-inc/trireme/constants"
@@ -10,6 +20,10 @@ import (
 	"github.com/aporeto-inc/trireme/monitor"
 	"github.com/aporeto-inc/trireme/policy"
 	"github.com/aporeto-inc/trireme/supervisor"
+	"github.com/aporeto-inc/trireme/utils/auditlog"
+	"github.com/aporeto-inc/trireme/utils/clock"
+	"github.com/aporeto-inc/trireme/utils/errortypes"
+	"github.com/aporeto-inc/trireme/utils/features"
 )
 
 func createMocks() (TestPolicyResolver, map[constants.PUType]supervisor.Supervisor, map[constants.PUType]supervisor.Excluder, map[constants.PUType]enforcer.PolicyEnforcer, monitor.TestMonitor, collector.EventCollector) {
@@ -270,6 +284,64 @@ func TestSimpleUpdate(t *testing.T) {
 	doTestUpdate(t, trireme, tresolver, tsupervisor[constants.ContainerPU].(supervisor.TestSupervisor), tenforcer[constants.ContainerPU].(enforcer.TestPolicyEnforcer), tmonitor, contextID, runtime, newPolicy)
 }
 
+func TestRuntimeUpdate(t *testing.T) {
+	tresolver, tsupervisor, texcluder, tenforcer, tmonitor, tcollector := createMocks()
+	trireme := NewTrireme("serverID", tresolver, tsupervisor, texcluder, tenforcer, tcollector)
+	trireme.Start()
+	contextID := "123123"
+	runtime := policy.NewPURuntimeWithDefaults()
+	runtime.SetIPAddresses(policy.NewIPMap(map[string]string{"bridge": "10.10.10.10"}))
+
+	s := tsupervisor[constants.ContainerPU].(supervisor.TestSupervisor)
+	e := tenforcer[constants.ContainerPU].(enforcer.TestPolicyEnforcer)
+
+	doTestCreate(t, trireme, tresolver, s, e, tmonitor, contextID, runtime)
+
+	// The address of the PU changes
+	newRuntime := policy.NewPURuntimeWithDefaults()
+	newRuntime.SetIPAddresses(policy.NewIPMap(map[string]string{"bridge": "10.10.10.20"}))
+
+	resolverCount := 0
+	supervisorIP := ""
+	enforcerIP := ""
+
+	tresolver.MockResolvePolicy(t, func(contextID string, RuntimeReader policy.RuntimeReader) (*policy.PUPolicy, error) {
+		resolverCount++
+		ipaddrs := RuntimeReader.IPAddresses()
+		return policy.NewPUPolicy("SomeId", policy.Police, nil, nil, nil, nil, nil, nil, ipaddrs, []string{"172.17.0.0/24"}, nil), nil
+	})
+
+	s.MockSupervise(t, func(contextID string, puInfo *policy.PUInfo) error {
+		supervisorIP, _ = puInfo.Policy.DefaultIPAddress()
+		return nil
+	})
+
+	s.MockUnsupervise(t, func(contextID string) error {
+		t.Errorf("Runtime update should not unsupervise the PU")
+		return nil
+	})
+
+	e.MockEnforce(t, func(contextID string, puInfo *policy.PUInfo) error {
+		enforcerIP, _ = puInfo.Policy.DefaultIPAddress()
+		return nil
+	})
+
+	trireme.SetPURuntime(contextID, newRuntime)
+	if err := <-trireme.HandlePUEvent(contextID, monitor.EventUpdate); err != nil {
+		t.Errorf("Runtime update was supposed to be nil, was %s", err)
+	}
+
+	if resolverCount != 1 {
+		t.Errorf("Runtime update didn't go to Resolver")
+	}
+	if supervisorIP != "10.10.10.20" {
+		t.Errorf("Supervisor was expected to get the new address, got %s", supervisorIP)
+	}
+	if enforcerIP != "10.10.10.20" {
+		t.Errorf("Enforcer was expected to get the new address, got %s", enforcerIP)
+	}
+}
+
 func TestCache(t *testing.T) {
 	tresolver, tsupervisor, texcluder, tenforcer, tmonitor, tcollector := createMocks()
 	trireme := NewTrireme("serverID", tresolver, tsupervisor, texcluder, tenforcer, tcollector)
@@ -314,6 +386,27 @@ func TestStop(t *testing.T) {
 	doTestCreate(t, trireme, tresolver, tsupervisor[constants.ContainerPU].(supervisor.TestSupervisor), tenforcer[constants.ContainerPU].(enforcer.TestPolicyEnforcer), tmonitor, contextID, runtime)
 }
 
+func TestRestartEnforcerStopped(t *testing.T) {
+	tresolver, tsupervisor, texcluder, tenforcer, _, tcollector := createMocks()
+	tr := NewTrireme("serverID", tresolver, tsupervisor, texcluder, tenforcer, tcollector).(*trireme)
+	tr.Start()
+	tr.Stop()
+
+	c := make(chan error, 1)
+	go func() {
+		c <- tr.restartEnforcer("123123")
+	}()
+
+	select {
+	case err := <-c:
+		if err == nil {
+			t.Errorf("The restart of an enforcer was expected to fail once stopped")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("The restart of an enforcer was not expected to block once stopped")
+	}
+}
+
 func TestAddExcludedIP(t *testing.T) {
 	tresolver, tsupervisor, texcluder, tenforcer, _, tcollector := createMocks()
 	trireme := NewTrireme("serverID", tresolver, tsupervisor, texcluder, tenforcer, tcollector)
@@ -352,3 +445,1123 @@ func TestTransmitterLabel(t *testing.T) {
 	}
 
 }
+
+func TestListPUs(t *testing.T) {
+	tresolver, tsupervisor, texcluder, tenforcer, tmonitor, tcollector := createMocks()
+	trireme := NewTrireme("serverID", tresolver, tsupervisor, texcluder, tenforcer, tcollector)
+	trireme.Start()
+
+	s := tsupervisor[constants.ContainerPU].(supervisor.TestSupervisor)
+	e := tenforcer[constants.ContainerPU].(enforcer.TestPolicyEnforcer)
+
+	if len(trireme.ListPUs()) != 0 {
+		t.Errorf("No PU was expected before any event")
+	}
+
+	runtime := policy.NewPURuntime("", 0, policy.NewTagsMap(map[string]string{"app": "web"}), nil, constants.ContainerPU, nil)
+
+	doTestCreate(t, trireme, tresolver, s, e, tmonitor, "123123", runtime)
+
+	failed := policy.NewPURuntimeWithDefaults()
+	trireme.SetPURuntime("456456", failed)
+
+	pus := trireme.ListPUs()
+	if len(pus) != 2 {
+		t.Fatalf("Two PUs were expected, got %d", len(pus))
+	}
+
+	if pus[0].ContextID != "123123" || pus[0].Mode != EnforcementEnforced || pus[0].Revision != 1 || !pus[0].Healthy {
+		t.Errorf("Unexpected state for an enforced PU: %+v", pus[0])
+	}
+	if v, ok := pus[0].Tags.Get("app"); !ok || v != "web" {
+		t.Errorf("Runtime tags were expected in the state, got %v", pus[0].Tags)
+	}
+	if pus[0].RemotePID != 0 {
+		t.Errorf("No remote enforcer was expected, got PID %d", pus[0].RemotePID)
+	}
+	if pus[1].ContextID != "456456" || pus[1].Mode != EnforcementPending || pus[1].Revision != 0 {
+		t.Errorf("Unexpected state for a pending PU: %+v", pus[1])
+	}
+
+	ipl := policy.NewIPMap(map[string]string{policy.DefaultNamespace: "127.0.0.1"})
+	<-trireme.UpdatePolicy("123123", policy.NewPUPolicy("", policy.Police, nil, nil, nil, nil, nil, nil, ipl, []string{"172.17.0.0/24"}, nil))
+
+	if pus = trireme.ListPUs(); pus[0].Revision != 2 {
+		t.Errorf("Revision was expected to be 2 after an update, got %d", pus[0].Revision)
+	}
+
+	e.MockEnforce(t, func(contextID string, puInfo *policy.PUInfo) error {
+		return fmt.Errorf("enforcer failure")
+	})
+	<-trireme.UpdatePolicy("123123", policy.NewPUPolicy("", policy.Police, nil, nil, nil, nil, nil, nil, ipl, []string{"172.17.0.0/24"}, nil))
+
+	if pus = trireme.ListPUs(); pus[0].Mode != EnforcementFailed || pus[0].Healthy || pus[0].Revision != 2 {
+		t.Errorf("Unexpected state after a failed update: %+v", pus[0])
+	}
+
+	doTestDelete(t, trireme, tresolver, s, e, tmonitor, "123123", runtime)
+
+	if pus = trireme.ListPUs(); len(pus) != 1 || pus[0].ContextID != "456456" {
+		t.Errorf("Deleted PU was not expected in the list: %+v", pus)
+	}
+}
+
+func TestPolicySummary(t *testing.T) {
+	tresolver, tsupervisor, texcluder, tenforcer, tmonitor, tcollector := createMocks()
+	trireme := NewTrireme("serverID", tresolver, tsupervisor, texcluder, tenforcer, tcollector)
+	trireme.Start()
+
+	s := tsupervisor[constants.ContainerPU].(supervisor.TestSupervisor)
+	e := tenforcer[constants.ContainerPU].(enforcer.TestPolicyEnforcer)
+
+	summarizer := trireme.(monitor.PolicySummarizer)
+
+	if _, err := summarizer.PolicySummary("123123"); err == nil {
+		t.Errorf("No summary was expected before the PU is created")
+	}
+
+	runtime := policy.NewPURuntime("", 0, nil, nil, constants.ContainerPU, nil)
+	doTestCreate(t, trireme, tresolver, s, e, tmonitor, "123123", runtime)
+
+	summary, err := summarizer.PolicySummary("123123")
+	if err != nil {
+		t.Fatalf("A summary was expected for an enforced PU: %s", err)
+	}
+	if summary.DefaultAction != "reject" || summary.Mode != string(EnforcementEnforced) || summary.Rules != 0 {
+		t.Errorf("Unexpected summary for an enforced PU: %+v", summary)
+	}
+
+	ipl := policy.NewIPMap(map[string]string{policy.DefaultNamespace: "127.0.0.1"})
+	acls := policy.NewIPRuleList([]policy.IPRule{{Address: "10.0.0.0/8", Port: "80", Protocol: "TCP", Action: policy.Accept}})
+	rules := policy.NewTagSelectorList([]policy.TagSelector{{Action: policy.Accept}})
+	annotations := policy.NewTagsMap(map[string]string{collector.PolicyRevisionTag: "r2"})
+	<-trireme.UpdatePolicy("123123", policy.NewPUPolicy("", policy.Police, acls, nil, nil, rules, nil, annotations, ipl, []string{"172.17.0.0/24"}, nil))
+
+	summary, _ = summarizer.PolicySummary("123123")
+	if summary.Revision != "r2" || summary.Rules != 2 {
+		t.Errorf("Unexpected summary after an update: %+v", summary)
+	}
+
+	doTestDelete(t, trireme, tresolver, s, e, tmonitor, "123123", runtime)
+
+	if _, err := summarizer.PolicySummary("123123"); err == nil {
+		t.Errorf("No summary was expected after the PU is deleted")
+	}
+}
+
+func TestQuarantine(t *testing.T) {
+	tresolver, tsupervisor, texcluder, tenforcer, tmonitor, tcollector := createMocks()
+	trireme := NewTrireme("serverID", tresolver, tsupervisor, texcluder, tenforcer, tcollector)
+	trireme.Start()
+
+	s := tsupervisor[constants.ContainerPU].(supervisor.TestSupervisor)
+	e := tenforcer[constants.ContainerPU].(enforcer.TestPolicyEnforcer)
+	runtime := policy.NewPURuntimeWithDefaults()
+
+	if err := <-trireme.Quarantine("123123", &QuarantineMode{}); err == nil {
+		t.Errorf("Quarantine of an unknown PU was expected to fail")
+	}
+
+	doTestCreate(t, trireme, tresolver, s, e, tmonitor, "123123", runtime)
+
+	var enforced, supervised *policy.PUPolicy
+	e.MockEnforce(t, func(contextID string, puInfo *policy.PUInfo) error {
+		enforced = puInfo.Policy
+		return nil
+	})
+	s.MockSupervise(t, func(contextID string, puInfo *policy.PUInfo) error {
+		supervised = puInfo.Policy
+		return nil
+	})
+
+	if err := <-trireme.Quarantine("123123", &QuarantineMode{Networks: []string{"10.9.0.0/24"}}); err != nil {
+		t.Fatalf("Quarantine failed: %s", err)
+	}
+
+	if enforced == nil || supervised != enforced {
+		t.Fatalf("The same quarantine policy was expected in the enforcer and the supervisor")
+	}
+	if len(enforced.TriremeNetworks()) != 0 || len(enforced.ReceiverRules().TagSelectors) != 0 {
+		t.Errorf("No identity rule was expected in the quarantine policy")
+	}
+	if trusted := enforced.TrustedNetworks(); len(trusted) != 1 || trusted[0] != "10.9.0.0/24" {
+		t.Errorf("The quarantine network was expected to be trusted, got %v", trusted)
+	}
+	if rules := enforced.ApplicationACLs().Rules; len(rules) != 1 || rules[0].Address != "10.9.0.0/24" {
+		t.Errorf("The quarantine network was expected in the ACLs, got %v", rules)
+	}
+	if pus := trireme.ListPUs(); pus[0].Mode != EnforcementQuarantined {
+		t.Errorf("Unexpected state for a quarantined PU: %+v", pus[0])
+	}
+
+	enforced = nil
+	ipl := policy.NewIPMap(map[string]string{policy.DefaultNamespace: "127.0.0.1"})
+	<-trireme.UpdatePolicy("123123", policy.NewPUPolicy("", policy.Police, nil, nil, nil, nil, nil, nil, ipl, []string{"192.168.0.0/16"}, nil))
+
+	if enforced != nil {
+		t.Errorf("No policy was expected to be applied during the quarantine")
+	}
+
+	if err := <-trireme.Quarantine("123123", nil); err != nil {
+		t.Fatalf("Quarantine release failed: %s", err)
+	}
+
+	if enforced == nil || len(enforced.TriremeNetworks()) != 1 || enforced.TriremeNetworks()[0] != "192.168.0.0/16" {
+		t.Errorf("The policy received during the quarantine was expected after the release")
+	}
+	if pus := trireme.ListPUs(); pus[0].Mode != EnforcementEnforced {
+		t.Errorf("Unexpected state after the release of the quarantine: %+v", pus[0])
+	}
+}
+
+func TestRollout(t *testing.T) {
+	tresolver, tsupervisor, texcluder, tenforcer, tmonitor, tcollector := createMocks()
+	trireme := NewTrireme("serverID", tresolver, tsupervisor, texcluder, tenforcer, tcollector)
+	trireme.Start()
+
+	s := tsupervisor[constants.ContainerPU].(supervisor.TestSupervisor)
+	e := tenforcer[constants.ContainerPU].(enforcer.TestPolicyEnforcer)
+
+	web := policy.NewPURuntime("", 0, policy.NewTagsMap(map[string]string{"app": "web"}), nil, constants.ContainerPU, nil)
+	db := policy.NewPURuntime("", 0, policy.NewTagsMap(map[string]string{"app": "db"}), nil, constants.ContainerPU, nil)
+	doTestCreate(t, trireme, tresolver, s, e, tmonitor, "web", web)
+	doTestCreate(t, trireme, tresolver, s, e, tmonitor, "db", db)
+
+	candidate := NewTestPolicyResolver()
+	candidate.MockResolvePolicy(t, func(contextID string, RuntimeReader policy.RuntimeReader) (*policy.PUPolicy, error) {
+		ipl := policy.NewIPMap(map[string]string{policy.DefaultNamespace: "127.0.0.1"})
+		return policy.NewPUPolicy("", policy.Police, nil, nil, nil, nil, nil, nil, ipl, []string{"10.0.0.0/8"}, nil), nil
+	})
+
+	revisions := map[string]string{}
+	e.MockEnforce(t, func(contextID string, puInfo *policy.PUInfo) error {
+		revisions[contextID], _ = puInfo.Policy.Annotations().Get(collector.PolicyRevisionTag)
+		return nil
+	})
+	s.MockSupervise(t, func(contextID string, puInfo *policy.PUInfo) error {
+		return nil
+	})
+
+	if err := <-trireme.StartRollout(&Rollout{Revision: "v2", Resolver: candidate, Percentage: 101}); err == nil {
+		t.Errorf("Rollout with an invalid percentage was expected to fail")
+	}
+
+	rollout := &Rollout{Revision: "v2", Resolver: candidate, Selector: map[string]string{"app": "web"}, Percentage: 100}
+	if err := <-trireme.StartRollout(rollout); err != nil {
+		t.Fatalf("Rollout failed to start: %s", err)
+	}
+
+	if len(revisions) != 1 || revisions["web"] != "v2" {
+		t.Errorf("Only the selected PU was expected on the candidate revision, got %v", revisions)
+	}
+
+	if err := <-trireme.StartRollout(rollout); err == nil {
+		t.Errorf("A second rollout was expected to fail")
+	}
+
+	if err := <-trireme.EndRollout(true); err != nil {
+		t.Fatalf("Rollout failed to end: %s", err)
+	}
+
+	if len(revisions) != 2 || revisions["db"] != "v2" {
+		t.Errorf("All the PUs were expected on the promoted revision, got %v", revisions)
+	}
+
+	if err := <-trireme.EndRollout(false); err == nil {
+		t.Errorf("Ending a rollout that is not running was expected to fail")
+	}
+}
+
+func TestPolicyTransaction(t *testing.T) {
+	tresolver, tsupervisor, texcluder, tenforcer, tmonitor, tcollector := createMocks()
+	trireme := NewTrireme("serverID", tresolver, tsupervisor, texcluder, tenforcer, tcollector)
+	trireme.Start()
+
+	s := tsupervisor[constants.ContainerPU].(supervisor.TestSupervisor)
+	e := tenforcer[constants.ContainerPU].(enforcer.TestPolicyEnforcer)
+	runtime := policy.NewPURuntimeWithDefaults()
+
+	doTestCreate(t, trireme, tresolver, s, e, tmonitor, "123123", runtime)
+
+	var enforced []*policy.PUPolicy
+	e.MockEnforce(t, func(contextID string, puInfo *policy.PUInfo) error {
+		enforced = append(enforced, puInfo.Policy)
+		return nil
+	})
+	s.MockSupervise(t, func(contextID string, puInfo *policy.PUInfo) error {
+		if len(puInfo.Policy.TriremeNetworks()) == 1 && puInfo.Policy.TriremeNetworks()[0] == "192.168.0.0/16" {
+			return fmt.Errorf("supervisor failure")
+		}
+		return nil
+	})
+
+	ipl := policy.NewIPMap(map[string]string{policy.DefaultNamespace: "127.0.0.1"})
+	err := <-trireme.UpdatePolicy("123123", policy.NewPUPolicy("", policy.Police, nil, nil, nil, nil, nil, nil, ipl, []string{"192.168.0.0/16"}, nil))
+	if err == nil {
+		t.Fatalf("The update was expected to fail")
+	}
+
+	if len(enforced) != 2 || enforced[1].TriremeNetworks()[0] != "172.17.0.0/24" {
+		t.Errorf("The previous policy was expected to be restored in the enforcer, got %v", enforced)
+	}
+
+	pus := trireme.ListPUs()
+	if pus[0].Mode != EnforcementEnforced || pus[0].Revision != 1 || pus[0].Healthy || pus[0].LastError == "" {
+		t.Errorf("Unexpected state after a rolled back update: %+v", pus[0])
+	}
+
+	unenforced := 0
+	e.MockUnenforce(t, func(contextID string) error {
+		unenforced++
+		return nil
+	})
+	s.MockSupervise(t, func(contextID string, puInfo *policy.PUInfo) error {
+		return fmt.Errorf("supervisor failure")
+	})
+
+	tresolver.MockResolvePolicy(t, func(contextID string, RuntimeReader policy.RuntimeReader) (*policy.PUPolicy, error) {
+		return policy.NewPUPolicy("", policy.Police, nil, nil, nil, nil, nil, nil, ipl, []string{"172.17.0.0/24"}, nil), nil
+	})
+
+	trireme.SetPURuntime("456456", policy.NewPURuntimeWithDefaults())
+	if err := <-trireme.HandlePUEvent("456456", monitor.EventStart); err == nil {
+		t.Fatalf("The creation was expected to fail")
+	}
+
+	if unenforced != 1 {
+		t.Errorf("The PU was expected to be unenforced after a failed creation")
+	}
+	if pus = trireme.ListPUs(); pus[1].Mode != EnforcementFailed {
+		t.Errorf("Unexpected state after a failed creation: %+v", pus[1])
+	}
+}
+
+func TestRetries(t *testing.T) {
+	tresolver, tsupervisor, texcluder, tenforcer, _, tcollector := createMocks()
+	tr := NewTrireme("serverID", tresolver, tsupervisor, texcluder, tenforcer, tcollector)
+
+	clk := clock.NewFake(time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC))
+	tr.(*trireme).clock = clk
+	if err := tr.(RetryConfigurer).SetRetryPolicy(RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 2 * time.Second, MaxRetries: 2}); err != nil {
+		t.Fatalf("Retry policy was expected to be valid: %s", err)
+	}
+	tr.Start()
+
+	// wait returns once the requests queued before it were handled
+	wait := func() {
+		<-tr.Quarantine("unknown", nil)
+	}
+
+	ipl := policy.NewIPMap(map[string]string{policy.DefaultNamespace: "127.0.0.1"})
+	tresolver.MockResolvePolicy(t, func(contextID string, RuntimeReader policy.RuntimeReader) (*policy.PUPolicy, error) {
+		return policy.NewPUPolicy("", policy.Police, nil, nil, nil, nil, nil, nil, ipl, []string{"172.17.0.0/24"}, nil), nil
+	})
+
+	e := tenforcer[constants.ContainerPU].(enforcer.TestPolicyEnforcer)
+	attempts := 0
+	e.MockEnforce(t, func(contextID string, puInfo *policy.PUInfo) error {
+		attempts++
+		return fmt.Errorf("enforcer failure")
+	})
+
+	tr.SetPURuntime("123123", policy.NewPURuntimeWithDefaults())
+	if err := <-tr.HandlePUEvent("123123", monitor.EventStart); err == nil {
+		t.Fatalf("The creation was expected to fail")
+	}
+
+	clk.Advance(500 * time.Millisecond)
+	wait()
+	if attempts != 1 {
+		t.Errorf("No retry was expected before the backoff, got %d attempts", attempts)
+	}
+
+	clk.Advance(500 * time.Millisecond)
+	wait()
+	if pus := tr.ListPUs(); attempts != 2 || pus[0].Failures != 2 || pus[0].Mode != EnforcementFailed {
+		t.Errorf("A retry was expected after the backoff, got %d attempts and %+v", attempts, pus[0])
+	}
+
+	clk.Advance(2 * time.Second)
+	wait()
+	if pus := tr.ListPUs(); attempts != 3 || pus[0].Mode != EnforcementBroken || pus[0].Healthy {
+		t.Errorf("The circuit was expected to open after the retries, got %d attempts and %+v", attempts, pus[0])
+	}
+
+	clk.Advance(time.Minute)
+	wait()
+	if attempts != 3 {
+		t.Errorf("No retry was expected once the circuit is open, got %d attempts", attempts)
+	}
+
+	if err := <-tr.HandlePUEvent("123123", monitor.EventUpdate); !errortypes.Is(err, errortypes.ErrCircuitOpen) {
+		t.Errorf("The events of a PU whose circuit is open were expected to be rejected, got %v", err)
+	}
+
+	e.MockEnforce(t, func(contextID string, puInfo *policy.PUInfo) error {
+		return nil
+	})
+
+	if err := <-tr.UpdatePolicy("123123", policy.NewPUPolicy("", policy.Police, nil, nil, nil, nil, nil, nil, ipl, []string{"172.17.0.0/24"}, nil)); err != nil {
+		t.Fatalf("A pushed policy was expected to close the circuit: %s", err)
+	}
+	if pus := tr.ListPUs(); pus[0].Mode != EnforcementEnforced || pus[0].Failures != 0 || !pus[0].Healthy {
+		t.Errorf("Unexpected state after the circuit closed: %+v", pus[0])
+	}
+}
+
+func TestFeatureFlags(t *testing.T) {
+	tresolver, tsupervisor, texcluder, tenforcer, tmonitor, tcollector := createMocks()
+	tr := NewTrireme("serverID", tresolver, tsupervisor, texcluder, tenforcer, tcollector)
+
+	flags, _ := features.NewFlags(&features.Flag{Feature: features.IPv6, Enabled: true})
+	tr.(FeatureConfigurer).SetFeatureFlags(flags)
+	tr.Start()
+
+	s := tsupervisor[constants.ContainerPU].(supervisor.TestSupervisor)
+	e := tenforcer[constants.ContainerPU].(enforcer.TestPolicyEnforcer)
+
+	doTestCreate(t, tr, tresolver, s, e, tmonitor, "123123", policy.NewPURuntimeWithDefaults())
+
+	var enforced *policy.PUPolicy
+	e.MockEnforce(t, func(contextID string, puInfo *policy.PUInfo) error {
+		enforced = puInfo.Policy
+		return nil
+	})
+
+	ipl := policy.NewIPMap(map[string]string{policy.DefaultNamespace: "127.0.0.1"})
+	<-tr.UpdatePolicy("123123", policy.NewPUPolicy("", policy.Police, nil, nil, nil, nil, nil, nil, ipl, []string{"172.17.0.0/24"}, nil))
+
+	if enforced == nil || !enforced.FeatureEnabled(string(features.IPv6)) || enforced.FeatureEnabled(string(features.UDPEnforcement)) {
+		t.Errorf("Only the features enabled by the flags were expected in the policy")
+	}
+}
+
+func TestServices(t *testing.T) {
+	tresolver, tsupervisor, texcluder, tenforcer, tmonitor, tcollector := createMocks()
+	tr := NewTrireme("serverID", tresolver, tsupervisor, texcluder, tenforcer, tcollector)
+
+	services, err := policy.NewServiceRegistry(append(policy.WellKnownServices, &policy.Service{
+		Name:    "kafka",
+		Aliases: []string{"Кафка"},
+		Ports:   []policy.ServicePort{{Protocol: "tcp", Port: "9092-9093"}},
+	})...)
+	if err != nil {
+		t.Fatalf("The services were expected to be valid: %s", err)
+	}
+	tr.(ServiceConfigurer).SetServiceRegistry(services)
+	tr.Start()
+
+	s := tsupervisor[constants.ContainerPU].(supervisor.TestSupervisor)
+	e := tenforcer[constants.ContainerPU].(enforcer.TestPolicyEnforcer)
+
+	doTestCreate(t, tr, tresolver, s, e, tmonitor, "123123", policy.NewPURuntimeWithDefaults())
+
+	var enforced *policy.PUPolicy
+	e.MockEnforce(t, func(contextID string, puInfo *policy.PUInfo) error {
+		enforced = puInfo.Policy
+		return nil
+	})
+
+	ipl := policy.NewIPMap(map[string]string{policy.DefaultNamespace: "127.0.0.1"})
+	acls := policy.NewIPRuleList([]policy.IPRule{
+		{Address: "10.0.0.0/8", Service: "кафка", Action: policy.Accept},
+		{Address: "0.0.0.0/0", Service: "DNS", Protocol: "udp", Action: policy.Accept},
+		{Address: "10.1.0.0/16", Port: "8080", Protocol: "TCP", Action: policy.Accept},
+	})
+	if err := <-tr.UpdatePolicy("123123", policy.NewPUPolicy("", policy.Police, nil, acls, nil, nil, nil, nil, ipl, []string{"172.17.0.0/24"}, nil)); err != nil {
+		t.Fatalf("The policy was expected to be applied: %s", err)
+	}
+
+	expected := []policy.IPRule{
+		{Address: "10.0.0.0/8", Port: "9092:9093", Protocol: "TCP", Action: policy.Accept},
+		{Address: "0.0.0.0/0", Port: "53", Protocol: "UDP", Action: policy.Accept},
+		{Address: "10.1.0.0/16", Port: "8080", Protocol: "TCP", Action: policy.Accept},
+	}
+	if enforced == nil || !reflect.DeepEqual(enforced.NetworkACLs().Rules, expected) {
+		t.Errorf("The services were expected to be replaced by their ports, got %+v", enforced)
+	}
+
+	acls = policy.NewIPRuleList([]policy.IPRule{{Address: "10.0.0.0/8", Service: "zookeeper", Action: policy.Accept}})
+	if err := <-tr.UpdatePolicy("123123", policy.NewPUPolicy("", policy.Police, nil, acls, nil, nil, nil, nil, ipl, []string{"172.17.0.0/24"}, nil)); err == nil {
+		t.Errorf("A policy referencing an unknown service was expected to fail")
+	}
+
+	if err := services.Register(&policy.Service{Name: "zookeeper", Aliases: []string{"kafka"}, Ports: []policy.ServicePort{{Protocol: "TCP", Port: "2181"}}}); err == nil {
+		t.Errorf("A service reusing the name of another service was expected to fail")
+	}
+	if err := services.Register(&policy.Service{Name: "zookeeper", Ports: []policy.ServicePort{{Protocol: "TCP", Port: "2181-80"}}}); err == nil {
+		t.Errorf("A service with an invalid port range was expected to fail")
+	}
+
+	services.Unregister("КАФКА")
+	if _, ok := services.Lookup("kafka"); ok {
+		t.Errorf("The service was expected to be unregistered by its alias")
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	tresolver, tsupervisor, texcluder, tenforcer, tmonitor, tcollector := createMocks()
+	history := collector.NewHistoryCollector(tcollector, 10)
+	tr := NewTrireme("serverID", tresolver, tsupervisor, texcluder, tenforcer, history)
+	tr.Start()
+
+	s := tsupervisor[constants.ContainerPU].(supervisor.TestSupervisor)
+	e := tenforcer[constants.ContainerPU].(enforcer.TestPolicyEnforcer)
+
+	doTestCreate(t, tr, tresolver, s, e, tmonitor, "123123", policy.NewPURuntimeWithDefaults())
+
+	ipl := policy.NewIPMap(map[string]string{policy.DefaultNamespace: "127.0.0.1"})
+	p := policy.NewPUPolicy("", policy.Police, nil, nil, nil, nil, nil, nil, ipl, []string{"172.17.0.0/24"}, nil)
+	p.AddIdentityTag("app", "web")
+	p.AddAnnotation("api_token", "s3cr3t")
+	if err := <-tr.UpdatePolicy("123123", p); err != nil {
+		t.Fatalf("Update failed: %s", err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := tr.Snapshot(buf); err != nil {
+		t.Fatalf("Snapshot failed: %s", err)
+	}
+
+	gz, err := gzip.NewReader(buf)
+	if err != nil {
+		t.Fatalf("The snapshot was expected to be gzipped: %s", err)
+	}
+
+	files := map[string]string{}
+	tr2 := tar.NewReader(gz)
+	for {
+		header, err := tr2.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("The snapshot was expected to be a tar archive: %s", err)
+		}
+		data, _ := ioutil.ReadAll(tr2)
+		files[header.Name] = string(data)
+	}
+
+	for _, name := range []string{"version.json", "pus.json", "policies.json", "events.json"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("The snapshot was expected to hold %s, got %v", name, files)
+		}
+	}
+
+	if !strings.Contains(files["policies.json"], `"app": "web"`) {
+		t.Errorf("The identity of the PU was expected in the policies: %s", files["policies.json"])
+	}
+	if strings.Contains(files["policies.json"], "s3cr3t") || !strings.Contains(files["policies.json"], `"api_token": "<redacted>"`) {
+		t.Errorf("The secrets were expected to be redacted from the policies: %s", files["policies.json"])
+	}
+	if !strings.Contains(files["events.json"], `"123123"`) {
+		t.Errorf("The events of the PU were expected in the snapshot: %s", files["events.json"])
+	}
+	if !strings.Contains(files["version.json"], `"server_id": "serverID"`) {
+		t.Errorf("The configuration was expected in the snapshot: %s", files["version.json"])
+	}
+}
+
+func TestConvergenceTracker(t *testing.T) {
+
+	start := time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC)
+	c := newConvergenceTracker()
+
+	c.requested("pu1", "r1", start)
+	c.requested("pu2", "r1", start)
+
+	ch := make(chan *ConvergenceReport, 1)
+	c.wait("r1", ch, start)
+
+	c.acknowledged("pu1", "r1", start.Add(time.Second))
+	c.acknowledged("pu2", "r0", start.Add(time.Second))
+
+	select {
+	case <-ch:
+		t.Fatalf("The revision was not expected to converge before all its PUs acknowledged it")
+	default:
+	}
+
+	report := c.convergence("r1", start.Add(2*time.Second))
+	if report.Converged || len(report.PUs) != 2 {
+		t.Fatalf("Invalid report %+v", report)
+	}
+	if !report.PUs[0].Acknowledged || report.PUs[0].Lag != time.Second {
+		t.Errorf("pu1 was expected to acknowledge the revision after a second, got %+v", report.PUs[0])
+	}
+	if report.PUs[1].Acknowledged || report.PUs[1].Lag != 2*time.Second {
+		t.Errorf("pu2 was expected to lag by two seconds, got %+v", report.PUs[1])
+	}
+
+	c.acknowledged("pu2", "r1", start.Add(3*time.Second))
+
+	select {
+	case report := <-ch:
+		if !report.Converged || report.MaxLag != 3*time.Second {
+			t.Errorf("The revision was expected to converge with a lag of 3s, got %+v", report)
+		}
+	default:
+		t.Fatalf("The waiter was expected to be notified")
+	}
+
+	c.requested("pu2", "r2", start.Add(4*time.Second))
+	c.remove("pu1", start.Add(4*time.Second))
+	if report := c.convergence("r1", start.Add(4*time.Second)); !report.Converged || len(report.PUs) != 0 {
+		t.Errorf("The PUs updated or deleted were expected to leave the revision, got %+v", report)
+	}
+}
+
+func TestConvergence(t *testing.T) {
+	tresolver, tsupervisor, texcluder, tenforcer, tmonitor, tcollector := createMocks()
+	tr := NewTrireme("serverID", tresolver, tsupervisor, texcluder, tenforcer, tcollector)
+	tr.Start()
+
+	s := tsupervisor[constants.ContainerPU].(supervisor.TestSupervisor)
+	e := tenforcer[constants.ContainerPU].(enforcer.TestPolicyEnforcer)
+
+	doTestCreate(t, tr, tresolver, s, e, tmonitor, "123123", policy.NewPURuntimeWithDefaults())
+
+	reporter := tr.(ConvergenceReporter)
+	waiter := reporter.WaitForConvergence("r1")
+
+	ipl := policy.NewIPMap(map[string]string{policy.DefaultNamespace: "127.0.0.1"})
+	p := policy.NewPUPolicy("", policy.Police, nil, nil, nil, nil, nil, nil, ipl, []string{"172.17.0.0/24"}, nil)
+	p.AddAnnotation(collector.PolicyRevisionTag, "r1")
+
+	if report := <-waiter; !report.Converged || len(report.PUs) != 0 {
+		t.Errorf("A revision without PUs was expected to be converged, got %+v", report)
+	}
+
+	if err := <-tr.UpdatePolicy("123123", p); err != nil {
+		t.Fatalf("Update failed: %s", err)
+	}
+
+	report := <-reporter.WaitForConvergence("r1")
+	if !report.Converged || len(report.PUs) != 1 || report.PUs[0].ContextID != "123123" || !report.PUs[0].Acknowledged {
+		t.Errorf("The PU was expected to acknowledge the revision, got %+v", report)
+	}
+}
+
+// flushingEnforcer is an enforcer of remote enforcers recording the flushed PUs
+type flushingEnforcer struct {
+	enforcer.PolicyEnforcer
+	flushed []string
+}
+
+func (f *flushingEnforcer) FlushStats(contextID string) error {
+	f.flushed = append(f.flushed, contextID)
+	return nil
+}
+
+func TestFlushStats(t *testing.T) {
+	tresolver, tsupervisor, texcluder, tenforcer, tmonitor, tcollector := createMocks()
+
+	e := tenforcer[constants.ContainerPU].(enforcer.TestPolicyEnforcer)
+	flusher := &flushingEnforcer{PolicyEnforcer: e}
+	tenforcer[constants.ContainerPU] = flusher
+
+	tr := NewTrireme("serverID", tresolver, tsupervisor, texcluder, tenforcer, tcollector)
+	tr.Start()
+
+	s := tsupervisor[constants.ContainerPU].(supervisor.TestSupervisor)
+	doTestCreate(t, tr, tresolver, s, e, tmonitor, "123123", policy.NewPURuntimeWithDefaults())
+
+	if err := tr.(StatsFlusher).FlushStats("unknown"); err == nil {
+		t.Errorf("Flushing the stats of an unknown PU was expected to fail")
+	}
+
+	if err := tr.(StatsFlusher).FlushStats("123123"); err != nil {
+		t.Fatalf("Flush failed: %s", err)
+	}
+
+	if len(flusher.flushed) != 1 || flusher.flushed[0] != "123123" {
+		t.Errorf("The stats of the PU were expected to be flushed, got %v", flusher.flushed)
+	}
+}
+
+// updatingEnforcer is an enforcer of remote enforcers recording the binary each PU
+// was enforced with
+type updatingEnforcer struct {
+	enforcer.PolicyEnforcer
+	staged   string
+	broken   string
+	binaries map[string]string
+	sync.Mutex
+}
+
+func (u *updatingEnforcer) Enforce(contextID string, puInfo *policy.PUInfo) error {
+	u.Lock()
+	if _, ok := u.binaries[contextID]; !ok {
+		u.binaries[contextID] = u.staged
+	}
+	u.Unlock()
+	return u.PolicyEnforcer.Enforce(contextID, puInfo)
+}
+
+func (u *updatingEnforcer) Unenforce(contextID string) error {
+	u.Lock()
+	delete(u.binaries, contextID)
+	u.Unlock()
+	return u.PolicyEnforcer.Unenforce(contextID)
+}
+
+func (u *updatingEnforcer) StageRemoteEnforcer(binary string) (string, error) {
+	u.Lock()
+	defer u.Unlock()
+	previous := u.staged
+	u.staged = binary
+	return previous, nil
+}
+
+func (u *updatingEnforcer) RemoteEnforcerBinary(contextID string) (string, error) {
+	u.Lock()
+	defer u.Unlock()
+	binary, ok := u.binaries[contextID]
+	if !ok {
+		return "", fmt.Errorf("no remote enforcer")
+	}
+	return binary, nil
+}
+
+func (u *updatingEnforcer) RemoteEnforcerStatus(contextID string) (int, bool, error) {
+	u.Lock()
+	defer u.Unlock()
+	binary, ok := u.binaries[contextID]
+	return 1, ok && binary != u.broken, nil
+}
+
+func TestUpdateRemoteEnforcers(t *testing.T) {
+	tresolver, tsupervisor, texcluder, tenforcer, tmonitor, tcollector := createMocks()
+
+	tr := NewTrireme("serverID", tresolver, tsupervisor, texcluder, tenforcer, tcollector)
+	tr.Start()
+
+	if report := <-tr.(EnforcerUpdater).UpdateRemoteEnforcers(&EnforcerUpdate{Binary: "/bin/v2"}); report.Err == nil {
+		t.Errorf("An update without remote enforcers was expected to fail")
+	}
+
+	e := tenforcer[constants.ContainerPU].(enforcer.TestPolicyEnforcer)
+	updater := &updatingEnforcer{PolicyEnforcer: e, staged: "/bin/v1", binaries: map[string]string{}}
+	tenforcer[constants.ContainerPU] = updater
+
+	tr = NewTrireme("serverID", tresolver, tsupervisor, texcluder, tenforcer, tcollector)
+	tr.Start()
+
+	s := tsupervisor[constants.ContainerPU].(supervisor.TestSupervisor)
+	doTestCreate(t, tr, tresolver, s, e, tmonitor, "123123", policy.NewPURuntimeWithDefaults())
+	doTestCreate(t, tr, tresolver, s, e, tmonitor, "456456", policy.NewPURuntimeWithDefaults())
+
+	e.MockEnforce(t, func(contextID string, puInfo *policy.PUInfo) error {
+		return nil
+	})
+	s.MockSupervise(t, func(contextID string, puInfo *policy.PUInfo) error {
+		return nil
+	})
+
+	report := <-tr.(EnforcerUpdater).UpdateRemoteEnforcers(&EnforcerUpdate{Binary: "/bin/v2"})
+	if report.Err != nil || strings.Join(report.Updated, ",") != "123123,456456" {
+		t.Fatalf("All the remote enforcers were expected to be updated, got %+v", report)
+	}
+
+	if updater.binaries["123123"] != "/bin/v2" || updater.binaries["456456"] != "/bin/v2" {
+		t.Errorf("The remote enforcers were expected to run the new binary, got %v", updater.binaries)
+	}
+
+	for _, pu := range tr.ListPUs() {
+		if pu.Mode != EnforcementEnforced || !pu.Healthy {
+			t.Errorf("Unexpected state after the update: %+v", pu)
+		}
+	}
+
+	report = <-tr.(EnforcerUpdater).UpdateRemoteEnforcers(&EnforcerUpdate{Binary: "/bin/v2"})
+	if report.Err != nil || len(report.Updated) != 0 {
+		t.Errorf("The remote enforcers running the binary were expected to be skipped, got %+v", report)
+	}
+
+	updater.broken = "/bin/v3"
+	checked := 0
+	report = <-tr.(EnforcerUpdater).UpdateRemoteEnforcers(&EnforcerUpdate{
+		Binary:        "/bin/v3",
+		HealthTimeout: 10 * time.Millisecond,
+		HealthCheck: func(contextID string) error {
+			checked++
+			return nil
+		},
+	})
+	if report.Err == nil || report.Failed != "123123" || !report.RolledBack || len(report.Updated) != 0 {
+		t.Fatalf("The update was expected to stop at the first PU, got %+v", report)
+	}
+
+	if checked != 0 {
+		t.Errorf("The health check was expected to wait for the remote enforcer to run")
+	}
+
+	if updater.staged != "/bin/v2" || updater.binaries["123123"] != "/bin/v2" || updater.binaries["456456"] != "/bin/v2" {
+		t.Errorf("The previous binary was expected to be restored, got %s %v", updater.staged, updater.binaries)
+	}
+}
+
+// healthEnforcer is an enforcer of remote enforcers whose health checks fail while
+// they are broken
+type healthEnforcer struct {
+	enforcer.PolicyEnforcer
+	broken  bool
+	aborted []string
+}
+
+func (h *healthEnforcer) HealthCheck(contextID string) error {
+	if h.broken {
+		return fmt.Errorf("remote enforcer does not respond")
+	}
+	return nil
+}
+
+func (h *healthEnforcer) AbortRemoteEnforcer(contextID string) error {
+	h.aborted = append(h.aborted, contextID)
+	h.broken = false
+	return nil
+}
+
+func TestEnforcerHealth(t *testing.T) {
+	tresolver, tsupervisor, texcluder, tenforcer, tmonitor, tcollector := createMocks()
+
+	e := tenforcer[constants.ContainerPU].(enforcer.TestPolicyEnforcer)
+	checker := &healthEnforcer{PolicyEnforcer: e}
+	tenforcer[constants.ContainerPU] = checker
+
+	tr := NewTrireme("serverID", tresolver, tsupervisor, texcluder, tenforcer, tcollector)
+
+	if err := tr.(EnforcerHealthConfigurer).SetEnforcerHealthPolicy(EnforcerHealthPolicy{Interval: time.Second}); err == nil {
+		t.Errorf("A health policy without failures was expected to be invalid")
+	}
+
+	clk := clock.NewFake(time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC))
+	tr.(*trireme).clock = clk
+	if err := tr.(EnforcerHealthConfigurer).SetEnforcerHealthPolicy(EnforcerHealthPolicy{Interval: time.Second, MaxFailures: 2}); err != nil {
+		t.Fatalf("Health policy was expected to be valid: %s", err)
+	}
+	tr.Start()
+
+	s := tsupervisor[constants.ContainerPU].(supervisor.TestSupervisor)
+	doTestCreate(t, tr, tresolver, s, e, tmonitor, "123123", policy.NewPURuntimeWithDefaults())
+
+	enforced := 0
+	e.MockEnforce(t, func(contextID string, puInfo *policy.PUInfo) error {
+		enforced++
+		return nil
+	})
+	s.MockSupervise(t, func(contextID string, puInfo *policy.PUInfo) error {
+		return nil
+	})
+
+	clk.Advance(time.Second)
+	if enforced != 0 || len(checker.aborted) != 0 {
+		t.Errorf("A healthy remote enforcer was not expected to be restarted")
+	}
+
+	checker.broken = true
+	clk.Advance(time.Second)
+	if enforced != 0 || len(checker.aborted) != 0 {
+		t.Errorf("The remote enforcer was not expected to be restarted before the max failures")
+	}
+
+	clk.Advance(time.Second)
+	if enforced != 1 || len(checker.aborted) != 1 || checker.aborted[0] != "123123" {
+		t.Errorf("The remote enforcer was expected to be restarted, got %d enforces and %v", enforced, checker.aborted)
+	}
+
+	if pus := tr.ListPUs(); pus[0].Mode != EnforcementEnforced || !pus[0].Healthy {
+		t.Errorf("Unexpected state after the restart: %+v", pus[0])
+	}
+
+	tr.Stop()
+	checker.broken = true
+	clk.Advance(10 * time.Second)
+	if len(checker.aborted) != 1 {
+		t.Errorf("No health check was expected once stopped")
+	}
+}
+
+// deadProbe is a liveness probe finding dead the PUs of its list
+type deadProbe struct {
+	dead map[string]bool
+}
+
+func (p *deadProbe) Alive(contextID string, runtime policy.RuntimeReader) (bool, error) {
+	return !p.dead[contextID], nil
+}
+
+func TestReaper(t *testing.T) {
+	tresolver, tsupervisor, texcluder, tenforcer, tmonitor, tcollector := createMocks()
+	tr := NewTrireme("serverID", tresolver, tsupervisor, texcluder, tenforcer, tcollector)
+
+	if err := tr.(ReaperConfigurer).SetReaperPolicy(ReaperPolicy{Interval: time.Second, MaxFailures: 2, Probes: []LivenessProbe{nil}}); err == nil {
+		t.Errorf("A reaper policy with a nil probe was expected to be invalid")
+	}
+
+	probe := &deadProbe{dead: map[string]bool{}}
+	clk := clock.NewFake(time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC))
+	tr.(*trireme).clock = clk
+	if err := tr.(ReaperConfigurer).SetReaperPolicy(ReaperPolicy{Interval: time.Second, MaxFailures: 2, Probes: []LivenessProbe{probe}}); err != nil {
+		t.Fatalf("Reaper policy was expected to be valid: %s", err)
+	}
+	tr.Start()
+
+	e := tenforcer[constants.ContainerPU].(enforcer.TestPolicyEnforcer)
+	s := tsupervisor[constants.ContainerPU].(supervisor.TestSupervisor)
+	doTestCreate(t, tr, tresolver, s, e, tmonitor, "123123", policy.NewPURuntimeWithDefaults())
+
+	events := []monitor.Event{}
+	tresolver.MockHandlePUEvent(t, func(contextID string, eventType monitor.Event) {
+		events = append(events, eventType)
+	})
+	unenforced := 0
+	e.MockUnenforce(t, func(contextID string) error {
+		unenforced++
+		return nil
+	})
+	s.MockUnsupervise(t, func(contextID string) error {
+		return nil
+	})
+
+	clk.Advance(time.Second)
+	if unenforced != 0 {
+		t.Errorf("A live PU was not expected to be destroyed")
+	}
+
+	probe.dead["123123"] = true
+	clk.Advance(time.Second)
+	if unenforced != 0 {
+		t.Errorf("The PU was not expected to be destroyed before the max failures")
+	}
+
+	clk.Advance(time.Second)
+	if unenforced != 1 || len(events) != 2 || events[0] != monitor.EventStop || events[1] != monitor.EventDestroy {
+		t.Errorf("The dead PU was expected to be stopped and destroyed, got %d unenforces and %v", unenforced, events)
+	}
+
+	if pus := tr.ListPUs(); len(pus) != 0 {
+		t.Errorf("The dead PU was not expected to be listed: %+v", pus)
+	}
+
+	tr.Stop()
+}
+
+func TestProcessProbe(t *testing.T) {
+	probe := NewProcessProbe()
+
+	if alive, err := probe.Alive("123123", policy.NewPURuntime("", os.Getpid(), nil, nil, constants.LinuxProcessPU, nil)); err != nil || !alive {
+		t.Errorf("A running process was expected to be alive, got %t %v", alive, err)
+	}
+
+	if alive, err := probe.Alive("123123", policy.NewPURuntimeWithDefaults()); err != nil || !alive {
+		t.Errorf("A PU without a process was expected to be alive, got %t %v", alive, err)
+	}
+
+	options := policy.NewTagsMap(map[string]string{policy.NetNSPathOption: "/var/run/netns/trireme-test-none"})
+	if alive, err := probe.Alive("123123", policy.NewPURuntime("", 0, nil, nil, constants.ContainerPU, options)); err != nil || alive {
+		t.Errorf("A PU without its network namespace was expected to be dead, got %t %v", alive, err)
+	}
+}
+
+func TestUpdateRuntimeTags(t *testing.T) {
+	tresolver, tsupervisor, texcluder, tenforcer, tmonitor, tcollector := createMocks()
+	tr := NewTrireme("serverID", tresolver, tsupervisor, texcluder, tenforcer, tcollector)
+	tr.Start()
+
+	e := tenforcer[constants.ContainerPU].(enforcer.TestPolicyEnforcer)
+	s := tsupervisor[constants.ContainerPU].(supervisor.TestSupervisor)
+
+	runtime := policy.NewPURuntime("", 0, policy.NewTagsMap(map[string]string{"app": "web", "owner": "alice"}), nil, constants.ContainerPU, nil)
+	doTestCreate(t, tr, tresolver, s, e, tmonitor, "123123", runtime)
+
+	if err := <-tr.(RuntimeUpdater).UpdateRuntimeTags("unknown", map[string]string{"compromised": "true"}); !errortypes.Is(err, errortypes.ErrPUNotFound) {
+		t.Errorf("Updating the runtime of an unknown PU was expected to fail, got %v", err)
+	}
+
+	ipl := policy.NewIPMap(map[string]string{policy.DefaultNamespace: "127.0.0.1"})
+	resolved := map[string]string{}
+	tresolver.MockResolvePolicy(t, func(contextID string, RuntimeReader policy.RuntimeReader) (*policy.PUPolicy, error) {
+		resolved = RuntimeReader.Tags().Tags
+		return policy.NewPUPolicy("", policy.Police, nil, nil, nil, nil, nil, nil, ipl, []string{"172.17.0.0/24"}, nil), nil
+	})
+
+	var enforced *policy.PUInfo
+	e.MockEnforce(t, func(contextID string, puInfo *policy.PUInfo) error {
+		enforced = puInfo
+		return nil
+	})
+	s.MockSupervise(t, func(contextID string, puInfo *policy.PUInfo) error {
+		return nil
+	})
+
+	if err := <-tr.(RuntimeUpdater).UpdateRuntimeTags("123123", map[string]string{"compromised": "true", "owner": ""}); err != nil {
+		t.Fatalf("Runtime update failed: %s", err)
+	}
+
+	expected := map[string]string{"app": "web", "compromised": "true"}
+	if !reflect.DeepEqual(resolved, expected) {
+		t.Errorf("The policy was expected to be resolved with the new tags, got %v", resolved)
+	}
+
+	if enforced == nil || !reflect.DeepEqual(enforced.Runtime.Tags().Tags, expected) {
+		t.Errorf("The policy was expected to be applied with the new runtime, got %+v", enforced)
+	}
+
+	if updated, _ := tr.PURuntime("123123"); !reflect.DeepEqual(updated.Tags().Tags, expected) {
+		t.Errorf("The runtime of the PU was expected to be updated, got %v", updated.Tags().Tags)
+	}
+
+	if tags := runtime.Tags().Tags; tags["owner"] != "alice" {
+		t.Errorf("The runtime of the monitor was not expected to change, got %v", tags)
+	}
+}
+
+func TestPUModes(t *testing.T) {
+	tresolver, tsupervisor, texcluder, tenforcer, _, tcollector := createMocks()
+	tr := NewTrireme("serverID", tresolver, tsupervisor, texcluder, tenforcer, tcollector)
+	tr.Start()
+
+	e := tenforcer[constants.ContainerPU].(enforcer.TestPolicyEnforcer)
+	s := tsupervisor[constants.ContainerPU].(supervisor.TestSupervisor)
+
+	ipl := policy.NewIPMap(map[string]string{policy.DefaultNamespace: "127.0.0.1"})
+	tresolver.MockResolvePolicy(t, func(contextID string, RuntimeReader policy.RuntimeReader) (*policy.PUPolicy, error) {
+		return policy.NewPUPolicy("", policy.Police, nil, nil, nil, nil, nil, nil, ipl, []string{"172.17.0.0/24"}, nil), nil
+	})
+
+	var enforced *policy.PUInfo
+	unenforced := 0
+	e.MockEnforce(t, func(contextID string, puInfo *policy.PUInfo) error {
+		enforced = puInfo
+		return nil
+	})
+	e.MockUnenforce(t, func(contextID string) error {
+		unenforced++
+		return nil
+	})
+	s.MockSupervise(t, func(contextID string, puInfo *policy.PUInfo) error {
+		return nil
+	})
+	s.MockUnsupervise(t, func(contextID string) error {
+		return nil
+	})
+
+	mode := func(contextID string) string {
+		summary, err := tr.(monitor.PolicySummarizer).PolicySummary(contextID)
+		if err != nil {
+			return ""
+		}
+		return summary.Mode
+	}
+
+	runtime := policy.NewPURuntime("", 0, policy.NewTagsMap(map[string]string{ModeTag: string(PUModeObserve)}), nil, constants.ContainerPU, nil)
+	tr.SetPURuntime("observed", runtime)
+	if err := <-tr.HandlePUEvent("observed", monitor.EventStart); err != nil {
+		t.Fatalf("Starting an observed PU failed: %s", err)
+	}
+
+	if enforced != nil || mode("observed") != string(EnforcementObserved) {
+		t.Errorf("The policy of an observed PU was not expected to be enforced, mode %s", mode("observed"))
+	}
+
+	if err := <-tr.(RuntimeUpdater).UpdateRuntimeTags("observed", map[string]string{ModeTag: string(PUModeEnforce)}); err != nil {
+		t.Fatalf("Enforcing an observed PU failed: %s", err)
+	}
+
+	if enforced == nil || mode("observed") != string(EnforcementEnforced) {
+		t.Errorf("The policy of the PU was expected to be enforced once opted in, mode %s", mode("observed"))
+	}
+
+	if err := <-tr.(RuntimeUpdater).UpdateRuntimeTags("observed", map[string]string{ModeTag: string(PUModeObserve)}); err != nil {
+		t.Fatalf("Observing an enforced PU failed: %s", err)
+	}
+
+	if unenforced != 1 || mode("observed") != string(EnforcementObserved) {
+		t.Errorf("The policy of the PU was expected to be removed once opted out, mode %s", mode("observed"))
+	}
+
+	enforced = nil
+	runtime = policy.NewPURuntime("", 0, policy.NewTagsMap(map[string]string{ModeTag: string(PUModeOffload)}), nil, constants.ContainerPU, nil)
+	tr.SetPURuntime("offloaded", runtime)
+	if err := <-tr.HandlePUEvent("offloaded", monitor.EventStart); err != nil {
+		t.Fatalf("Starting an offloaded PU failed: %s", err)
+	}
+
+	if enforced == nil || !enforced.Policy.FeatureEnabled(string(features.EBPFFastPath)) {
+		t.Errorf("The policy of an offloaded PU was expected to enable the eBPF fast path")
+	}
+
+	enforced = nil
+	runtime = policy.NewPURuntime("", 0, policy.NewTagsMap(map[string]string{ModeTag: "unknown"}), nil, constants.ContainerPU, nil)
+	tr.SetPURuntime("unknown", runtime)
+	if err := <-tr.HandlePUEvent("unknown", monitor.EventStart); err != nil {
+		t.Fatalf("Starting a PU of an unknown mode failed: %s", err)
+	}
+
+	if enforced == nil || enforced.Policy.FeatureEnabled(string(features.EBPFFastPath)) {
+		t.Errorf("A PU of an unknown mode was expected to be enforced")
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	tresolver, tsupervisor, texcluder, tenforcer, tmonitor, tcollector := createMocks()
+	tr := NewTrireme("serverID", tresolver, tsupervisor, texcluder, tenforcer, tcollector)
+
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatalf("Unable to create the audit directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	auditLog, err := auditlog.Open(dir+"/audit.log", []byte("0123456789abcdef"))
+	if err != nil {
+		t.Fatalf("Unable to open the audit log: %s", err)
+	}
+	defer auditLog.Close()
+
+	tr.(AuditConfigurer).SetAuditLog(auditLog)
+	tr.Start()
+
+	s := tsupervisor[constants.ContainerPU].(supervisor.TestSupervisor)
+	e := tenforcer[constants.ContainerPU].(enforcer.TestPolicyEnforcer)
+	runtime := policy.NewPURuntimeWithDefaults()
+	doTestCreate(t, tr, tresolver, s, e, tmonitor, "web", runtime)
+
+	candidate := NewTestPolicyResolver()
+	candidate.MockResolvePolicy(t, func(contextID string, RuntimeReader policy.RuntimeReader) (*policy.PUPolicy, error) {
+		ipl := policy.NewIPMap(map[string]string{policy.DefaultNamespace: "127.0.0.1"})
+		return policy.NewPUPolicy("", policy.Police, nil, nil, nil, nil, nil, nil, ipl, []string{"10.0.0.0/8"}, nil), nil
+	})
+
+	if err := <-tr.StartRollout(&Rollout{Revision: "v2", Resolver: candidate, Percentage: 100}); err != nil {
+		t.Fatalf("Rollout failed to start: %s", err)
+	}
+
+	doTestDelete(t, tr, tresolver, s, e, tmonitor, "web", runtime)
+
+	entries, err := auditLog.Entries(0)
+	if err != nil {
+		t.Fatalf("The audit log was expected to be verified: %s", err)
+	}
+
+	expected := []auditlog.Entry{
+		{Trigger: "monitor-start", Action: auditlog.ActionResolve},
+		{Trigger: "monitor-start", Action: auditlog.ActionEnforce},
+		{Trigger: "rollout-start", Action: auditlog.ActionResolve, NewRevision: "v2"},
+		{Trigger: "rollout-start", Action: auditlog.ActionEnforce, NewRevision: "v2"},
+		{Trigger: "monitor-stop", Action: auditlog.ActionUnenforce, OldRevision: "v2"},
+	}
+
+	if len(entries) != len(expected) {
+		t.Fatalf("Unexpected audit entries: %+v", entries)
+	}
+
+	for i, entry := range entries {
+		if entry.Node != "serverID" || entry.ContextID != "web" || entry.Error != "" ||
+			entry.Trigger != expected[i].Trigger || entry.Action != expected[i].Action ||
+			entry.OldRevision != expected[i].OldRevision || entry.NewRevision != expected[i].NewRevision {
+			t.Errorf("Unexpected audit entry %d: %+v", i, entry)
+		}
+	}
+}
@@ -12,4 +12,18 @@ mockgen -source supervisor/provider/ipsetprovider.go -destination supervisor/pro
 
 mockgen -source supervisor/provider/iptablesprovider.go -destination supervisor/provider/mock/mockIptablesprovider.go -package mockprovider 
 
+echo "Trireme Mocks"
+mockgen -source interfaces.go -destination mock/mock_trireme.go -package mock_trireme
+
+echo "Monitor Mocks"
+mockgen -source monitor/interfaces.go -destination monitor/mock/mock_monitor.go -package mock_monitor
+
+echo "Collector Mocks"
+mockgen -source collector/interfaces.go -destination collector/mock/mock_collector.go -package mock_collector
+
+echo "Enforcer Mocks"
+mockgen -source enforcer/interfaces.go -destination enforcer/mock/mock_enforcer.go -package mock_enforcer
+
+mockgen -source enforcer/utils/rpcwrapper/interfaces.go -destination enforcer/utils/rpcwrapper/mock/mock_rpcwrapper.go -package mock_rpcwrapper
+
 echo >&2 "OK"
@@ -0,0 +1,467 @@
+// Package auditlog records the policy changes of Trireme in an append-only log whose
+// entries are chained by their HMAC, so that an entry removed or modified after it
+// was written breaks the chain when the log is verified. The entries cannot be
+// rewritten with a valid chain without the key of the log.
+package auditlog
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aporeto-inc/trireme/utils/clock"
+)
+
+const (
+	// DefaultMaxSize is the size of the log file above which it is rotated
+	DefaultMaxSize = 10 * 1024 * 1024
+
+	// DefaultMaxFiles is the number of rotated files retained
+	DefaultMaxFiles = 10
+
+	// MinKeyLength is the minimum length of the key of the HMAC of the entries
+	MinKeyLength = 16
+)
+
+// Action is the action recorded by an entry
+type Action string
+
+const (
+	// ActionResolve is the resolution of the policy of a PU
+	ActionResolve Action = "resolve"
+	// ActionEnforce is the enforcement of the policy of a PU
+	ActionEnforce Action = "enforce"
+	// ActionUnenforce is the removal of the policy of a PU
+	ActionUnenforce Action = "unenforce"
+)
+
+// Entry is an entry of the audit log
+type Entry struct {
+	// Sequence is the number of the entry in the log, starting at 1
+	Sequence uint64 `json:"seq"`
+	// Time is the time of the entry
+	Time time.Time `json:"time"`
+	// Node is the identifier of the Trireme instance that recorded the entry
+	Node string `json:"node,omitempty"`
+	// Trigger is what caused the action, like an event of a monitor or a policy
+	// pushed by the controller
+	Trigger     string `json:"trigger,omitempty"`
+	Action      Action `json:"action"`
+	ContextID   string `json:"context_id,omitempty"`
+	OldRevision string `json:"old_revision,omitempty"`
+	NewRevision string `json:"new_revision,omitempty"`
+	// Error is the error of the action, if it failed
+	Error string `json:"error,omitempty"`
+	// PrevHash is the hash of the previous entry, empty for the first entry
+	PrevHash string `json:"prev_hash"`
+	// Hash is the HMAC-SHA256 of the entry without its hash, with the key of the log
+	Hash string `json:"hash"`
+}
+
+// digest returns the HMAC of the entry with the key
+func (e *Entry) digest(key []byte) (string, error) {
+
+	unhashed := *e
+	unhashed.Hash = ""
+
+	data, err := json.Marshal(&unhashed)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// follows checks that the entry was written with the key and is chained to the
+// previous one. The first entry read is trusted to be the first one retained, since
+// the entries before it may have been rotated out.
+func (e *Entry) follows(prev *Entry, key []byte) error {
+
+	digest, err := e.digest(key)
+	if err != nil {
+		return err
+	}
+
+	if !hmac.Equal([]byte(digest), []byte(e.Hash)) {
+		return fmt.Errorf("Entry %d was modified", e.Sequence)
+	}
+
+	if prev == nil {
+		return nil
+	}
+
+	if e.Sequence != prev.Sequence+1 || e.PrevHash != prev.Hash {
+		return fmt.Errorf("Entry %d does not follow entry %d", e.Sequence, prev.Sequence)
+	}
+
+	return nil
+}
+
+// Log is an audit log stored in a file. The file is rotated when it exceeds its
+// maximum size, and the first entry of the new file is chained to the last entry
+// of the rotated one.
+type Log struct {
+	path     string
+	key      []byte
+	maxSize  int64
+	maxFiles int
+	clock    clock.Clock
+	file     *os.File
+	size     int64
+	last     *Entry
+	sync.Mutex
+}
+
+// Option is an option of the audit log
+type Option func(*Log)
+
+// WithMaxSize rotates the file of the log when it exceeds the size
+func WithMaxSize(size int64) Option {
+
+	return func(l *Log) {
+		l.maxSize = size
+	}
+}
+
+// WithMaxFiles retains the number of rotated files. The older files are removed.
+func WithMaxFiles(files int) Option {
+
+	return func(l *Log) {
+		l.maxFiles = files
+	}
+}
+
+// WithClock sets the clock of the time of the entries
+func WithClock(c clock.Clock) Option {
+
+	return func(l *Log) {
+		l.clock = c
+	}
+}
+
+// Open opens the audit log of the file at the path, whose entries are authenticated
+// with the key. The key comes from the configuration of the program and must be
+// kept out of reach of the writers of the file. The existing entries are verified,
+// and the new entries are chained to the last one.
+func Open(path string, key []byte, opts ...Option) (*Log, error) {
+
+	if len(key) < MinKeyLength {
+		return nil, fmt.Errorf("The key of audit log %s must have at least %d bytes", path, MinKeyLength)
+	}
+
+	l := &Log{
+		path:     path,
+		key:      append([]byte{}, key...),
+		maxSize:  DefaultMaxSize,
+		maxFiles: DefaultMaxFiles,
+		clock:    clock.New(),
+	}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	if l.maxSize <= 0 || l.maxFiles < 0 {
+		return nil, fmt.Errorf("Invalid rotation of audit log %s", path)
+	}
+
+	last, err := l.read(0, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Audit log %s is corrupted: %s", path, err)
+	}
+	l.last = last
+
+	if err := l.openFile(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// openFile opens the current file of the log for appending
+func (l *Log) openFile() error {
+
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("Unable to open audit log %s: %s", l.path, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("Unable to open audit log %s: %s", l.path, err)
+	}
+
+	l.file = file
+	l.size = info.Size()
+
+	return nil
+}
+
+// Append records an entry. Its sequence, its hash and the hash of the previous
+// entry are set, and its time if it is not set. The file is synced before Append
+// returns.
+func (l *Log) Append(entry Entry) (*Entry, error) {
+
+	l.Lock()
+	defer l.Unlock()
+
+	if l.file == nil {
+		return nil, fmt.Errorf("Audit log %s is closed", l.path)
+	}
+
+	entry.Sequence = 1
+	entry.PrevHash = ""
+	if l.last != nil {
+		entry.Sequence = l.last.Sequence + 1
+		entry.PrevHash = l.last.Hash
+	}
+
+	if entry.Time.IsZero() {
+		entry.Time = l.clock.Now()
+	}
+	entry.Time = entry.Time.UTC()
+
+	hash, err := entry.digest(l.key)
+	if err != nil {
+		return nil, err
+	}
+	entry.Hash = hash
+
+	line, err := json.Marshal(&entry)
+	if err != nil {
+		return nil, err
+	}
+	line = append(line, '\n')
+
+	if l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := l.file.Write(line); err != nil {
+		return nil, fmt.Errorf("Unable to write audit log %s: %s", l.path, err)
+	}
+
+	if err := l.file.Sync(); err != nil {
+		return nil, fmt.Errorf("Unable to sync audit log %s: %s", l.path, err)
+	}
+
+	l.size += int64(len(line))
+	l.last = &entry
+
+	return &entry, nil
+}
+
+// rotate renames the current file to the first rotated file and opens a new one.
+// The oldest rotated file is removed, and the first entry retained is then trusted
+// when the log is verified.
+func (l *Log) rotate() error {
+
+	if err := l.file.Close(); err != nil {
+		return fmt.Errorf("Unable to close audit log %s: %s", l.path, err)
+	}
+	l.file = nil
+
+	os.Remove(l.segment(l.maxFiles))
+
+	for i := l.maxFiles - 1; i >= 0; i-- {
+		if err := os.Rename(l.segment(i), l.segment(i+1)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("Unable to rotate audit log %s: %s", l.path, err)
+		}
+	}
+
+	return l.openFile()
+}
+
+// segment returns the path of a file of the log, the current file being 0 and the
+// oldest rotated file maxFiles
+func (l *Log) segment(i int) string {
+
+	if i == 0 {
+		return l.path
+	}
+
+	return l.path + "." + strconv.Itoa(i)
+}
+
+// read verifies the entries of the files of the log, from the oldest, and calls the
+// function with the entries from the sequence. It returns the last entry.
+func (l *Log) read(from uint64, fn func(*Entry) error) (*Entry, error) {
+
+	var last *Entry
+
+	for i := l.maxFiles; i >= 0; i-- {
+		file, err := os.Open(l.segment(i))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		last, err = readEntries(file, l.key, last, from, fn)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return last, nil
+}
+
+// readEntries verifies the entries of the reader with the key and chained to the
+// previous entry, and calls the function with the entries from the sequence. It
+// returns the last entry.
+func readEntries(r io.Reader, key []byte, prev *Entry, from uint64, fn func(*Entry) error) (*Entry, error) {
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		entry := &Entry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			return nil, fmt.Errorf("Invalid entry after entry %d: %s", sequenceOf(prev), err)
+		}
+
+		if err := entry.follows(prev, key); err != nil {
+			return nil, err
+		}
+
+		if fn != nil && entry.Sequence >= from {
+			if err := fn(entry); err != nil {
+				return nil, err
+			}
+		}
+
+		prev = entry
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return prev, nil
+}
+
+// sequenceOf returns the sequence of an entry, or zero for no entry
+func sequenceOf(entry *Entry) uint64 {
+
+	if entry == nil {
+		return 0
+	}
+
+	return entry.Sequence
+}
+
+// Last returns the last entry of the log, or nil if the log is empty. Its hash
+// attests all the entries of the log.
+func (l *Log) Last() *Entry {
+
+	l.Lock()
+	defer l.Unlock()
+
+	if l.last == nil {
+		return nil
+	}
+
+	last := *l.last
+
+	return &last
+}
+
+// Entries returns the retained entries of the log from the sequence, after they
+// are verified
+func (l *Log) Entries(from uint64) ([]*Entry, error) {
+
+	l.Lock()
+	defer l.Unlock()
+
+	entries := []*Entry{}
+
+	_, err := l.read(from, func(entry *Entry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Export writes the retained entries of the log from the sequence to the writer, one
+// JSON entry per line, after they are verified. The export can be verified with
+// Verify.
+func (l *Log) Export(w io.Writer, from uint64) error {
+
+	l.Lock()
+	defer l.Unlock()
+
+	encoder := json.NewEncoder(w)
+
+	_, err := l.read(from, func(entry *Entry) error {
+		return encoder.Encode(entry)
+	})
+
+	return err
+}
+
+// Verify verifies all the retained entries of the log
+func (l *Log) Verify() error {
+
+	l.Lock()
+	defer l.Unlock()
+
+	last, err := l.read(0, nil)
+	if err != nil {
+		return err
+	}
+
+	if sequenceOf(last) != sequenceOf(l.last) {
+		return fmt.Errorf("Entries after entry %d were removed", sequenceOf(last))
+	}
+
+	return nil
+}
+
+// Close closes the log
+func (l *Log) Close() error {
+
+	l.Lock()
+	defer l.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+
+	err := l.file.Close()
+	l.file = nil
+
+	return err
+}
+
+// Verify verifies the entries of an export of a log with the key of the log. The
+// other entries must be chained to the first one. It returns the last entry, or nil
+// if there is no entry. The caller compares its hash with the hash of the last entry
+// of the log to check that no entry was removed at the end of the export.
+func Verify(r io.Reader, key []byte) (*Entry, error) {
+
+	if len(key) < MinKeyLength {
+		return nil, fmt.Errorf("The key of the audit log must have at least %d bytes", MinKeyLength)
+	}
+
+	return readEntries(r, key, nil, 0, nil)
+}
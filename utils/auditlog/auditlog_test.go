@@ -0,0 +1,231 @@
+package auditlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aporeto-inc/trireme/utils/clock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var (
+	testKey  = []byte("0123456789abcdef")
+	otherKey = []byte("fedcba9876543210")
+)
+
+func TestLog(t *testing.T) {
+
+	Convey("Given an audit log with a fake clock", t, func() {
+
+		dir, err := ioutil.TempDir("", "auditlog")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "audit.log")
+		start := time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+		l, err := Open(path, testKey, WithClock(clock.NewFake(start)))
+		So(err, ShouldBeNil)
+		defer l.Close()
+
+		So(l.Last(), ShouldBeNil)
+
+		Convey("When I append entries", func() {
+			first, err := l.Append(Entry{Action: ActionResolve, ContextID: "pu1", NewRevision: "v1"})
+			So(err, ShouldBeNil)
+			second, err := l.Append(Entry{Action: ActionEnforce, ContextID: "pu1", NewRevision: "v1"})
+			So(err, ShouldBeNil)
+
+			Convey("The entries should be chained", func() {
+				So(first.Sequence, ShouldEqual, 1)
+				So(first.PrevHash, ShouldEqual, "")
+				So(first.Time, ShouldResemble, start)
+				So(second.Sequence, ShouldEqual, 2)
+				So(second.PrevHash, ShouldEqual, first.Hash)
+				So(l.Last().Hash, ShouldEqual, second.Hash)
+				So(l.Verify(), ShouldBeNil)
+			})
+
+			Convey("The entries should be listed from a sequence", func() {
+				entries, err := l.Entries(2)
+				So(err, ShouldBeNil)
+				So(len(entries), ShouldEqual, 1)
+				So(entries[0].Action, ShouldEqual, ActionEnforce)
+			})
+
+			Convey("When I reopen the log", func() {
+				So(l.Close(), ShouldBeNil)
+
+				reopened, err := Open(path, testKey)
+				So(err, ShouldBeNil)
+				defer reopened.Close()
+
+				Convey("The new entries should be chained to the last entry", func() {
+					third, err := reopened.Append(Entry{Action: ActionUnenforce, ContextID: "pu1", OldRevision: "v1"})
+					So(err, ShouldBeNil)
+					So(third.Sequence, ShouldEqual, 3)
+					So(third.PrevHash, ShouldEqual, second.Hash)
+					So(reopened.Verify(), ShouldBeNil)
+				})
+			})
+
+			Convey("When an entry is modified", func() {
+				data, err := ioutil.ReadFile(path)
+				So(err, ShouldBeNil)
+				data = bytes.Replace(data, []byte(`"action":"enforce"`), []byte(`"action":"unenforce"`), 1)
+				So(ioutil.WriteFile(path, data, 0600), ShouldBeNil)
+
+				Convey("The log should not be verified", func() {
+					So(l.Verify(), ShouldNotBeNil)
+
+					_, err := Open(path, testKey)
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey("When an entry is rewritten with another key", func() {
+				data, err := ioutil.ReadFile(path)
+				So(err, ShouldBeNil)
+				lines := strings.SplitAfter(string(data), "\n")
+
+				forged := second
+				forged.Action = ActionUnenforce
+				forged.Hash = ""
+				forged.Hash, err = forged.digest(otherKey)
+				So(err, ShouldBeNil)
+				line, err := json.Marshal(&forged)
+				So(err, ShouldBeNil)
+				So(ioutil.WriteFile(path, []byte(lines[0]+string(line)+"\n"), 0600), ShouldBeNil)
+
+				Convey("The log should not be verified", func() {
+					So(l.Verify(), ShouldNotBeNil)
+
+					_, err := Open(path, testKey)
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey("When the first entry is removed", func() {
+				data, err := ioutil.ReadFile(path)
+				So(err, ShouldBeNil)
+				lines := strings.SplitAfter(string(data), "\n")
+				So(ioutil.WriteFile(path, []byte(strings.Join(lines[1:], "")), 0600), ShouldBeNil)
+
+				Convey("The remaining entries should be verified without the log", func() {
+					file, err := os.Open(path)
+					So(err, ShouldBeNil)
+					defer file.Close()
+
+					last, err := Verify(file, testKey)
+					So(err, ShouldBeNil)
+					So(last.Hash, ShouldEqual, second.Hash)
+				})
+			})
+
+			Convey("When the last entry is removed", func() {
+				data, err := ioutil.ReadFile(path)
+				So(err, ShouldBeNil)
+				lines := strings.SplitAfter(string(data), "\n")
+				So(ioutil.WriteFile(path, []byte(lines[0]), 0600), ShouldBeNil)
+
+				Convey("The log should not be verified", func() {
+					So(l.Verify(), ShouldNotBeNil)
+				})
+			})
+
+			Convey("When I export the log", func() {
+				var buf bytes.Buffer
+				So(l.Export(&buf, 0), ShouldBeNil)
+
+				Convey("The export should be verified up to the last entry", func() {
+					last, err := Verify(&buf, testKey)
+					So(err, ShouldBeNil)
+					So(last.Hash, ShouldEqual, second.Hash)
+				})
+
+				Convey("The export should not be verified with another key", func() {
+					_, err := Verify(&buf, otherKey)
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey("When I export the log with an entry removed", func() {
+				var buf bytes.Buffer
+				So(l.Export(&buf, 0), ShouldBeNil)
+				third, err := l.Append(Entry{Action: ActionUnenforce, ContextID: "pu1"})
+				So(err, ShouldBeNil)
+				So(l.Export(&buf, 3), ShouldBeNil)
+
+				So(third.Sequence, ShouldEqual, 3)
+				lines := strings.SplitAfter(buf.String(), "\n")
+				tampered := lines[0] + lines[2]
+
+				Convey("The export should not be verified", func() {
+					_, err := Verify(strings.NewReader(tampered), testKey)
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+
+		Convey("The log should be closed", func() {
+			So(l.Close(), ShouldBeNil)
+			_, err := l.Append(Entry{Action: ActionResolve})
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given an audit log rotated after every entry", t, func() {
+
+		dir, err := ioutil.TempDir("", "auditlog")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "audit.log")
+
+		l, err := Open(path, testKey, WithMaxSize(1), WithMaxFiles(2))
+		So(err, ShouldBeNil)
+		defer l.Close()
+
+		Convey("When I append more entries than the files retained", func() {
+			for i := 0; i < 5; i++ {
+				_, err := l.Append(Entry{Action: ActionEnforce, ContextID: "pu1"})
+				So(err, ShouldBeNil)
+			}
+
+			Convey("The oldest files should be removed", func() {
+				_, err := os.Stat(path + ".2")
+				So(err, ShouldBeNil)
+				_, err = os.Stat(path + ".3")
+				So(os.IsNotExist(err), ShouldBeTrue)
+			})
+
+			Convey("The retained entries should be chained across the files", func() {
+				entries, err := l.Entries(0)
+				So(err, ShouldBeNil)
+				So(len(entries), ShouldEqual, 3)
+				So(entries[0].Sequence, ShouldEqual, 3)
+				So(entries[2].Sequence, ShouldEqual, 5)
+				So(l.Verify(), ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("An invalid rotation should be rejected", t, func() {
+		_, err := Open(filepath.Join(os.TempDir(), "audit.log"), testKey, WithMaxSize(0))
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("A short key should be rejected", t, func() {
+		_, err := Open(filepath.Join(os.TempDir(), "audit.log"), []byte("short"))
+		So(err, ShouldNotBeNil)
+
+		_, err = Verify(strings.NewReader(""), nil)
+		So(err, ShouldNotBeNil)
+	})
+}
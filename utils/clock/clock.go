@@ -0,0 +1,161 @@
+// Package clock abstracts the source of time, so that the expiry of the tokens, the
+// caches and the flows of the datapath can be tested with a fake clock.
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is a source of time
+type Clock interface {
+
+	// Now returns the current time.
+	Now() time.Time
+
+	// AfterFunc calls the function once the duration elapsed.
+	AfterFunc(d time.Duration, f func()) Timer
+
+	// Sleep pauses the current goroutine for the duration.
+	Sleep(d time.Duration)
+}
+
+// Timer is a timer created by a clock
+type Timer interface {
+
+	// Stop prevents the timer from firing. It returns false if the timer already
+	// fired or was stopped.
+	Stop() bool
+}
+
+// realClock is the clock of the system
+type realClock struct{}
+
+// New returns the clock of the system
+func New() Clock {
+	return realClock{}
+}
+
+// Now implements the Clock interface
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// AfterFunc implements the Clock interface
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// Sleep implements the Clock interface
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// Fake is a clock whose time only moves when it is advanced
+type Fake struct {
+	now    time.Time
+	timers []*fakeTimer
+	sync.Mutex
+}
+
+// fakeTimer is a timer of a fake clock
+type fakeTimer struct {
+	clock   *Fake
+	expiry  time.Time
+	f       func()
+	stopped bool
+}
+
+// byExpiry sorts the timers by expiry
+type byExpiry []*fakeTimer
+
+func (t byExpiry) Len() int           { return len(t) }
+func (t byExpiry) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t byExpiry) Less(i, j int) bool { return t[i].expiry.Before(t[j].expiry) }
+
+// NewFake returns a fake clock starting at the given time
+func NewFake(now time.Time) *Fake {
+
+	return &Fake{
+		now:    now,
+		timers: []*fakeTimer{},
+	}
+}
+
+// Now implements the Clock interface
+func (c *Fake) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.now
+}
+
+// AfterFunc implements the Clock interface. The function is called when the clock
+// is advanced past the expiry of the timer.
+func (c *Fake) AfterFunc(d time.Duration, f func()) Timer {
+	c.Lock()
+	defer c.Unlock()
+
+	t := &fakeTimer{
+		clock:  c,
+		expiry: c.now.Add(d),
+		f:      f,
+	}
+	c.timers = append(c.timers, t)
+
+	return t
+}
+
+// Sleep implements the Clock interface. It returns when the clock is advanced past
+// the duration.
+func (c *Fake) Sleep(d time.Duration) {
+
+	done := make(chan struct{})
+	c.AfterFunc(d, func() { close(done) })
+	<-done
+}
+
+// Advance moves the clock forward and fires the timers that expired, in the order
+// of their expiry. The functions of the timers are called before Advance returns.
+func (c *Fake) Advance(d time.Duration) {
+	c.Lock()
+
+	c.now = c.now.Add(d)
+
+	sort.Stable(byExpiry(c.timers))
+
+	expired := []*fakeTimer{}
+	pending := []*fakeTimer{}
+	for _, t := range c.timers {
+		if t.stopped {
+			continue
+		}
+		if t.expiry.After(c.now) {
+			pending = append(pending, t)
+			continue
+		}
+		t.stopped = true
+		expired = append(expired, t)
+	}
+	c.timers = pending
+
+	c.Unlock()
+
+	for _, t := range expired {
+		t.f()
+	}
+}
+
+// Stop implements the Timer interface
+func (t *fakeTimer) Stop() bool {
+	t.clock.Lock()
+	defer t.clock.Unlock()
+
+	if t.stopped {
+		return false
+	}
+	t.stopped = true
+
+	return true
+}
@@ -0,0 +1,67 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFake(t *testing.T) {
+
+	Convey("Given a fake clock", t, func() {
+
+		start := time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC)
+		c := NewFake(start)
+
+		fired := []string{}
+		c.AfterFunc(2*time.Second, func() { fired = append(fired, "second") })
+		c.AfterFunc(time.Second, func() { fired = append(fired, "first") })
+		stopped := c.AfterFunc(time.Second, func() { fired = append(fired, "stopped") })
+		So(stopped.Stop(), ShouldBeTrue)
+
+		Convey("Then its time should not move by itself", func() {
+			So(c.Now(), ShouldResemble, start)
+		})
+
+		Convey("When I advance it before the expiry of the timers", func() {
+			c.Advance(500 * time.Millisecond)
+
+			Convey("Then no timer should fire", func() {
+				So(c.Now(), ShouldResemble, start.Add(500*time.Millisecond))
+				So(fired, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When I advance it past the expiry of the timers", func() {
+			c.Advance(3 * time.Second)
+
+			Convey("Then the timers should fire in the order of their expiry", func() {
+				So(fired, ShouldResemble, []string{"first", "second"})
+			})
+
+			Convey("Then the fired timers should no longer stop", func() {
+				So(stopped.Stop(), ShouldBeFalse)
+			})
+		})
+
+		Convey("When a goroutine sleeps", func() {
+			done := make(chan struct{})
+			go func() {
+				c.Sleep(time.Minute)
+				close(done)
+			}()
+
+			Convey("Then it should wake up when the clock is advanced", func() {
+				for {
+					c.Advance(time.Minute)
+					select {
+					case <-done:
+						return
+					case <-time.After(time.Millisecond):
+					}
+				}
+			})
+		})
+	})
+}
@@ -74,11 +74,8 @@ func (p *CustomPolicyResolver) ResolvePolicy(context string, runtimeInfo policy.
 		},
 	})
 
-	// Use the bridge IP from Docker.
-	ipl := policy.NewIPMap(map[string]string{})
-	if ip, ok := runtimeInfo.DefaultIPAddress(); ok {
-		ipl.IPs[policy.DefaultNamespace] = ip
-	}
+	// Use all the IPs from Docker, like the IPv6 one of a dual-stack container.
+	ipl := runtimeInfo.IPAddresses()
 
 	identity := runtimeInfo.Tags()
 
@@ -0,0 +1,166 @@
+// Package errortypes defines the categories of the failures of Trireme. The errors
+// returned by the monitors, the enforcers, the supervisors and the RPC channels carry
+// their category, so that the embedding code can branch on it with Is instead of
+// matching the error strings.
+package errortypes
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The categories of the failures
+var (
+	// ErrPUNotFound is the category of the failures on an unknown processing unit
+	ErrPUNotFound = errors.New("processing unit not found")
+	// ErrPolicyRejected is the category of the failures caused by the policy, like a
+	// rejected connection or a missing policy
+	ErrPolicyRejected = errors.New("rejected by the policy")
+	// ErrRPCTimeout is the category of the failures to reach a remote enforcer or
+	// the controller in time
+	ErrRPCTimeout = errors.New("rpc timeout")
+	// ErrRuleProgramming is the category of the failures to program the iptables or
+	// ipset rules
+	ErrRuleProgramming = errors.New("rule programming failed")
+	// ErrCircuitOpen is the category of the failures of the processing units whose
+	// policy failed to apply more times than their retries allow
+	ErrCircuitOpen = errors.New("circuit open")
+)
+
+var categories = []error{
+	ErrPUNotFound,
+	ErrPolicyRejected,
+	ErrRPCTimeout,
+	ErrRuleProgramming,
+	ErrCircuitOpen,
+}
+
+// Error is an error of a category with the error that caused it
+type Error struct {
+	// Category is one of the categories of this package, or nil if the error has
+	// the category of its cause
+	Category error
+	Message  string
+	Cause    error
+}
+
+// Error is part of the error interface
+func (e *Error) Error() string {
+
+	if e.Cause == nil {
+		return e.Message
+	}
+
+	return e.Message + ": " + e.Cause.Error()
+}
+
+// Errorf returns an error of the category with a formatted message
+func Errorf(category error, format string, args ...interface{}) error {
+
+	return &Error{
+		Category: category,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+// Wrapf returns an error of the category caused by err. The error has the category
+// of err if the category is nil.
+func Wrapf(category error, err error, format string, args ...interface{}) error {
+
+	return &Error{
+		Category: category,
+		Message:  fmt.Sprintf(format, args...),
+		Cause:    err,
+	}
+}
+
+// Is returns true if the error, or one of its causes, is of the category. The
+// errors that are not categories, like the errors of the packages, are matched
+// anywhere in the causes of the error.
+func Is(err error, category error) bool {
+
+	if isCategory(category) {
+		return Category(err) == category
+	}
+
+	for ; err != nil; err = cause(err) {
+		if err == category {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Category returns the category of the error, or nil if it has none
+func Category(err error) error {
+
+	for ; err != nil; err = cause(err) {
+
+		if isCategory(err) {
+			return err
+		}
+
+		if e, ok := err.(*Error); ok && e.Category != nil {
+			return e.Category
+		}
+	}
+
+	return nil
+}
+
+// isCategory returns true if the error is one of the categories of this package
+func isCategory(err error) bool {
+
+	for _, category := range categories {
+		if err == category {
+			return true
+		}
+	}
+
+	return false
+}
+
+// A causer is an error of another package caused by another error, whose category
+// is the category of its cause
+type causer interface {
+	Cause() error
+}
+
+// cause returns the error that caused an error, or nil
+func cause(err error) error {
+
+	switch e := err.(type) {
+	case *Error:
+		return e.Cause
+	case causer:
+		return e.Cause()
+	}
+
+	return nil
+}
+
+// Encode returns the message of the error prefixed with its category, for the
+// channels that only carry the messages of the errors, like the errors of net/rpc
+func Encode(err error) string {
+
+	category := Category(err)
+	if category == nil {
+		return err.Error()
+	}
+
+	return category.Error() + ": " + err.Error()
+}
+
+// Decode returns the error of a message returned by Encode, with its category
+func Decode(message string) error {
+
+	for _, category := range categories {
+		if prefix := category.Error() + ": "; strings.HasPrefix(message, prefix) {
+			return Errorf(category, "%s", strings.TrimPrefix(message, prefix))
+		}
+	}
+
+	return errors.New(message)
+}
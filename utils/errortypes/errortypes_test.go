@@ -0,0 +1,79 @@
+package errortypes
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCategories(t *testing.T) {
+	Convey("Given an error of a category caused by another error", t, func() {
+		cause := errors.New("exit status 1")
+		err := Wrapf(ErrRuleProgramming, cause, "Cannot configure the rules of %s", "pu1")
+
+		Convey("It should have the category", func() {
+			So(Is(err, ErrRuleProgramming), ShouldBeTrue)
+			So(Is(err, ErrPUNotFound), ShouldBeFalse)
+			So(Category(err), ShouldEqual, ErrRuleProgramming)
+		})
+
+		Convey("Its message should include the cause", func() {
+			So(err.Error(), ShouldEqual, "Cannot configure the rules of pu1: exit status 1")
+		})
+
+		Convey("When it is wrapped without a category", func() {
+			wrapped := Wrapf(nil, err, "Not able to setup supervisor")
+
+			Convey("It should keep the category of the cause", func() {
+				So(Is(wrapped, ErrRuleProgramming), ShouldBeTrue)
+				So(Category(wrapped), ShouldEqual, ErrRuleProgramming)
+			})
+		})
+
+		Convey("When it is wrapped with another category", func() {
+			wrapped := Wrapf(ErrPolicyRejected, err, "Policy Error")
+
+			Convey("It should have the new category only", func() {
+				So(Is(wrapped, ErrPolicyRejected), ShouldBeTrue)
+				So(Is(wrapped, ErrRuleProgramming), ShouldBeFalse)
+			})
+		})
+	})
+
+	Convey("Given errors without a category", t, func() {
+		So(Category(errors.New("plain")), ShouldBeNil)
+		So(Category(Errorf(nil, "plain")), ShouldBeNil)
+		So(Is(nil, ErrRPCTimeout), ShouldBeFalse)
+		So(Category(ErrRPCTimeout), ShouldEqual, ErrRPCTimeout)
+	})
+
+	Convey("Given an error of a category caused by a sentinel error", t, func() {
+		sentinel := errors.New("Failed to enforce rules")
+		err := Wrapf(ErrRPCTimeout, sentinel, "Server.Enforce timed out")
+
+		Convey("It should match the category and the sentinel", func() {
+			So(Is(err, ErrRPCTimeout), ShouldBeTrue)
+			So(Is(err, sentinel), ShouldBeTrue)
+			So(Is(Wrapf(nil, err, "Not able to setup the PU"), sentinel), ShouldBeTrue)
+			So(Is(err, errors.New("Failed to enforce rules")), ShouldBeFalse)
+		})
+	})
+
+	Convey("Given an error of a category encoded in a message", t, func() {
+		err := Wrapf(ErrRuleProgramming, errors.New("exit status 1"), "Cannot configure the rules of %s", "pu1")
+		message := Encode(err)
+
+		Convey("The decoded error should have the category and the message", func() {
+			decoded := Decode(message)
+			So(Is(decoded, ErrRuleProgramming), ShouldBeTrue)
+			So(decoded.Error(), ShouldEqual, err.Error())
+		})
+
+		Convey("An error without category should be decoded without category", func() {
+			decoded := Decode(Encode(errors.New("plain")))
+			So(Category(decoded), ShouldBeNil)
+			So(decoded.Error(), ShouldEqual, "plain")
+		})
+	})
+}
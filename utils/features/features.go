@@ -0,0 +1,175 @@
+// Package features gates the risky behaviors of the datapath behind flags, so that a
+// new behavior can be enabled on a subset of the processing units before it is
+// rolled out to all of them. Every feature is disabled unless a flag enables it.
+package features
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/policy"
+)
+
+// Feature is a behavior of the datapath gated by a flag
+type Feature string
+
+// The features gated by a flag
+const (
+	// EBPFFastPath caches the verdicts of the accepted flows in the kernel, the eBPF
+	// program or the ipsets, so that their packets are no longer queued
+	EBPFFastPath Feature = "ebpf-fast-path"
+	// UDPEnforcement enforces the identity of the UDP flows
+	UDPEnforcement Feature = "udp-enforcement"
+	// IPv6 enforces the policy of the IPv6 addresses of the processing units
+	IPv6 Feature = "ipv6"
+)
+
+var known = map[Feature]bool{
+	EBPFFastPath:   true,
+	UDPEnforcement: true,
+	IPv6:           true,
+}
+
+// puTypes are the names of the PU types in the flags
+var puTypes = map[string]constants.PUType{
+	"container":     constants.ContainerPU,
+	"linux-process": constants.LinuxProcessPU,
+}
+
+// Flag enables or disables a feature for the processing units it selects
+type Flag struct {
+	// Feature is the feature of the flag
+	Feature Feature `json:"feature"`
+	// Enabled enables the feature, or disables it for the PUs enabled by an
+	// earlier flag
+	Enabled bool `json:"enabled"`
+	// PUTypes selects the PUs of the types, "container" or "linux-process". All the
+	// types are selected if it is empty.
+	PUTypes []string `json:"pu_types,omitempty"`
+	// Selector selects the PUs by their runtime tags. All the PUs are selected if it
+	// is empty.
+	Selector map[string]string `json:"selector,omitempty"`
+}
+
+// Flags are the flags of the features. A flag overrides the flags before it for the
+// PUs it selects.
+type Flags struct {
+	Flags []*Flag `json:"flags"`
+}
+
+// NewFlags returns the flags after validating them
+func NewFlags(flags ...*Flag) (*Flags, error) {
+
+	f := &Flags{Flags: flags}
+	if err := f.validate(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Parse returns the flags of a JSON document
+func Parse(data []byte) (*Flags, error) {
+
+	f := &Flags{}
+	if err := json.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("Invalid feature flags: %s", err)
+	}
+
+	if err := f.validate(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Load returns the flags of a JSON file
+func Load(path string) (*Flags, error) {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read the feature flags: %s", err)
+	}
+
+	return Parse(data)
+}
+
+// validate returns an error if a flag has an unknown feature or PU type
+func (f *Flags) validate() error {
+
+	for _, flag := range f.Flags {
+		if !known[flag.Feature] {
+			return fmt.Errorf("Unknown feature %s", flag.Feature)
+		}
+
+		for _, name := range flag.PUTypes {
+			if _, ok := puTypes[name]; !ok {
+				return fmt.Errorf("Unknown PU type %s for the feature %s", name, flag.Feature)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Enabled returns true if the feature is enabled for a PU of the type and the tags.
+// A nil Flags enables no feature.
+func (f *Flags) Enabled(feature Feature, puType constants.PUType, tags *policy.TagsMap) bool {
+
+	if f == nil {
+		return false
+	}
+
+	enabled := false
+	for _, flag := range f.Flags {
+		if flag.Feature == feature && flag.selects(puType, tags) {
+			enabled = flag.Enabled
+		}
+	}
+
+	return enabled
+}
+
+// For returns the sorted names of the features enabled for a PU of the type and the
+// tags
+func (f *Flags) For(puType constants.PUType, tags *policy.TagsMap) []string {
+
+	enabled := []string{}
+	for _, feature := range []Feature{EBPFFastPath, IPv6, UDPEnforcement} {
+		if f.Enabled(feature, puType, tags) {
+			enabled = append(enabled, string(feature))
+		}
+	}
+
+	return enabled
+}
+
+// selects returns true if the flag applies to a PU of the type and the tags
+func (flag *Flag) selects(puType constants.PUType, tags *policy.TagsMap) bool {
+
+	if len(flag.PUTypes) > 0 {
+		selected := false
+		for _, name := range flag.PUTypes {
+			if puTypes[name] == puType {
+				selected = true
+				break
+			}
+		}
+		if !selected {
+			return false
+		}
+	}
+
+	for k, v := range flag.Selector {
+		if tags == nil {
+			return false
+		}
+		if value, ok := tags.Get(k); !ok || value != v {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,61 @@
+package features
+
+import (
+	"testing"
+
+	"github.com/aporeto-inc/trireme/constants"
+	"github.com/aporeto-inc/trireme/policy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFlags(t *testing.T) {
+
+	Convey("Given feature flags canarying UDP on the containers of the canary tier", t, func() {
+		flags, err := Parse([]byte(`{"flags": [
+			{"feature": "udp-enforcement", "enabled": true, "pu_types": ["container"]},
+			{"feature": "udp-enforcement", "enabled": false, "selector": {"tier": "stable"}},
+			{"feature": "ipv6", "enabled": true, "selector": {"tier": "canary"}}
+		]}`))
+		So(err, ShouldBeNil)
+
+		canary := policy.NewTagsMap(map[string]string{"tier": "canary"})
+		stable := policy.NewTagsMap(map[string]string{"tier": "stable"})
+
+		Convey("Then the features should be enabled for the selected PUs only", func() {
+			So(flags.Enabled(UDPEnforcement, constants.ContainerPU, canary), ShouldBeTrue)
+			So(flags.Enabled(UDPEnforcement, constants.LinuxProcessPU, canary), ShouldBeFalse)
+			So(flags.Enabled(IPv6, constants.LinuxProcessPU, canary), ShouldBeTrue)
+		})
+
+		Convey("Then the later flags should override the earlier ones", func() {
+			So(flags.Enabled(UDPEnforcement, constants.ContainerPU, stable), ShouldBeFalse)
+		})
+
+		Convey("Then the features without a flag should be disabled", func() {
+			So(flags.Enabled(EBPFFastPath, constants.ContainerPU, canary), ShouldBeFalse)
+			So(flags.For(constants.ContainerPU, canary), ShouldResemble, []string{"ipv6", "udp-enforcement"})
+			So(flags.For(constants.ContainerPU, stable), ShouldResemble, []string{})
+		})
+	})
+
+	Convey("Given no feature flags", t, func() {
+		var flags *Flags
+
+		Convey("Then no feature should be enabled", func() {
+			So(flags.Enabled(IPv6, constants.ContainerPU, nil), ShouldBeFalse)
+		})
+	})
+
+	Convey("Given invalid feature flags", t, func() {
+
+		Convey("Then an unknown feature should be rejected", func() {
+			_, err := Parse([]byte(`{"flags": [{"feature": "teleport", "enabled": true}]}`))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Then an unknown PU type should be rejected", func() {
+			_, err := NewFlags(&Flag{Feature: IPv6, Enabled: true, PUTypes: []string{"vm"}})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
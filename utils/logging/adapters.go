@@ -0,0 +1,96 @@
+package logging
+
+import (
+	"sort"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// logrusLogger sends the messages to a logrus logger
+type logrusLogger struct {
+	logger *log.Logger
+}
+
+// NewLogrusLogger returns a Logger sending the messages to a logrus logger with its
+// own output, formatter and level. It must not be the standard logger.
+func NewLogrusLogger(logger *log.Logger) Logger {
+
+	return &logrusLogger{logger: logger}
+}
+
+// Enabled implements the Logger interface
+func (l *logrusLogger) Enabled(level Level) bool {
+
+	return l.logger.Level >= toLogrus(level)
+}
+
+// Log implements the Logger interface
+func (l *logrusLogger) Log(level Level, message string, fields Fields) {
+
+	entry := l.logger.WithFields(log.Fields(fields))
+
+	switch level {
+	case DebugLevel:
+		entry.Debug(message)
+	case InfoLevel:
+		entry.Info(message)
+	case WarnLevel:
+		entry.Warn(message)
+	default:
+		entry.Error(message)
+	}
+}
+
+// SugaredLogger is the logger of the structured messages of zap. A
+// *zap.SugaredLogger is one.
+type SugaredLogger interface {
+	Debugw(message string, keysAndValues ...interface{})
+	Infow(message string, keysAndValues ...interface{})
+	Warnw(message string, keysAndValues ...interface{})
+	Errorw(message string, keysAndValues ...interface{})
+}
+
+// zapLogger sends the messages to a zap logger
+type zapLogger struct {
+	logger SugaredLogger
+	level  Level
+}
+
+// NewZapLogger returns a Logger sending the messages of the level and above to a
+// zap logger, with their fields sorted by key
+func NewZapLogger(logger SugaredLogger, level Level) Logger {
+
+	return &zapLogger{logger: logger, level: level}
+}
+
+// Enabled implements the Logger interface
+func (l *zapLogger) Enabled(level Level) bool {
+
+	return level >= l.level
+}
+
+// Log implements the Logger interface
+func (l *zapLogger) Log(level Level, message string, fields Fields) {
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	keysAndValues := make([]interface{}, 0, 2*len(keys))
+	for _, k := range keys {
+		keysAndValues = append(keysAndValues, k, fields[k])
+	}
+
+	switch level {
+	case DebugLevel:
+		l.logger.Debugw(message, keysAndValues...)
+	case InfoLevel:
+		l.logger.Infow(message, keysAndValues...)
+	case WarnLevel:
+		l.logger.Warnw(message, keysAndValues...)
+	default:
+		l.logger.Errorw(message, keysAndValues...)
+	}
+}
@@ -0,0 +1,160 @@
+// Package logging lets the programs embedding Trireme control its logs. Trireme logs
+// with the standard logger of logrus. Once a Logger is set, the messages of the
+// standard logger are sent to it with their structured fields, like the contextID
+// and the PU type, instead of the output of logrus.
+package logging
+
+import (
+	"io"
+	"io/ioutil"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Level is the level of a message
+type Level int
+
+// The levels of the messages, from the most verbose
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+// The fields of the messages identifying a PU
+const (
+	// ContextIDField is the field of the context of the PU
+	ContextIDField = "contextID"
+	// PUTypeField is the field of the type of the PU
+	PUTypeField = "puType"
+)
+
+// Fields are the structured fields of a message
+type Fields map[string]interface{}
+
+// Logger receives the messages of Trireme
+type Logger interface {
+
+	// Enabled returns true if the messages of the level are logged
+	Enabled(level Level) bool
+
+	// Log logs a message of the level with its fields. The fatal messages are
+	// logged at the ErrorLevel before the program exits.
+	Log(level Level, message string, fields Fields)
+}
+
+// forwarder is the hook of the standard logger sending its messages to the Logger
+type forwarder struct {
+	logger   Logger
+	hooked   bool
+	out      io.Writer
+	logLevel log.Level
+	sync.RWMutex
+}
+
+var hook = &forwarder{}
+
+// SetLogger sends the messages of Trireme to the logger, or back to the output of
+// logrus if it is nil. The level of the standard logger is set to the most verbose
+// level enabled by the logger.
+func SetLogger(logger Logger) {
+
+	hook.Lock()
+	defer hook.Unlock()
+
+	std := log.StandardLogger()
+
+	if !hook.hooked {
+		log.AddHook(hook)
+		hook.hooked = true
+	}
+
+	if logger == nil {
+		if hook.logger != nil {
+			log.SetOutput(hook.out)
+			log.SetLevel(hook.logLevel)
+		}
+		hook.logger = nil
+		return
+	}
+
+	if hook.logger == nil {
+		hook.out = std.Out
+		hook.logLevel = log.GetLevel()
+	}
+
+	hook.logger = logger
+
+	log.SetOutput(ioutil.Discard)
+	log.SetLevel(log.ErrorLevel)
+	for _, level := range []Level{DebugLevel, InfoLevel, WarnLevel} {
+		if logger.Enabled(level) {
+			log.SetLevel(toLogrus(level))
+			break
+		}
+	}
+}
+
+// Levels implements the Hook interface of logrus
+func (f *forwarder) Levels() []log.Level {
+
+	return log.AllLevels
+}
+
+// Fire implements the Hook interface of logrus
+func (f *forwarder) Fire(entry *log.Entry) error {
+
+	f.RLock()
+	logger := f.logger
+	f.RUnlock()
+
+	if logger == nil {
+		return nil
+	}
+
+	level := fromLogrus(entry.Level)
+	if !logger.Enabled(level) {
+		return nil
+	}
+
+	fields := make(Fields, len(entry.Data))
+	for k, v := range entry.Data {
+		fields[k] = v
+	}
+
+	logger.Log(level, entry.Message, fields)
+
+	return nil
+}
+
+// fromLogrus returns the level of a logrus level
+func fromLogrus(level log.Level) Level {
+
+	switch level {
+	case log.DebugLevel:
+		return DebugLevel
+	case log.InfoLevel:
+		return InfoLevel
+	case log.WarnLevel:
+		return WarnLevel
+	default:
+		return ErrorLevel
+	}
+}
+
+// toLogrus returns the logrus level of a level
+func toLogrus(level Level) log.Level {
+
+	switch level {
+	case DebugLevel:
+		return log.DebugLevel
+	case InfoLevel:
+		return log.InfoLevel
+	case WarnLevel:
+		return log.WarnLevel
+	default:
+		return log.ErrorLevel
+	}
+}
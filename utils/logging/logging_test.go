@@ -0,0 +1,130 @@
+package logging
+
+import (
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// message is a message received by a recorder
+type message struct {
+	level   Level
+	message string
+	fields  Fields
+}
+
+// recorder is a Logger recording the messages of the level and above
+type recorder struct {
+	level    Level
+	messages []*message
+}
+
+func (r *recorder) Enabled(level Level) bool {
+
+	return level >= r.level
+}
+
+func (r *recorder) Log(level Level, msg string, fields Fields) {
+
+	r.messages = append(r.messages, &message{level: level, message: msg, fields: fields})
+}
+
+// sugared is a zap sugared logger recording its messages
+type sugared struct {
+	calls []string
+	kvs   []interface{}
+}
+
+func (s *sugared) record(call string, keysAndValues []interface{}) {
+
+	s.calls = append(s.calls, call)
+	s.kvs = keysAndValues
+}
+
+func (s *sugared) Debugw(msg string, keysAndValues ...interface{}) {
+	s.record("debug:"+msg, keysAndValues)
+}
+func (s *sugared) Infow(msg string, keysAndValues ...interface{}) {
+	s.record("info:"+msg, keysAndValues)
+}
+func (s *sugared) Warnw(msg string, keysAndValues ...interface{}) {
+	s.record("warn:"+msg, keysAndValues)
+}
+func (s *sugared) Errorw(msg string, keysAndValues ...interface{}) {
+	s.record("error:"+msg, keysAndValues)
+}
+
+func TestSetLogger(t *testing.T) {
+
+	Convey("Given a logger of the info messages", t, func() {
+
+		r := &recorder{level: InfoLevel}
+		SetLogger(r)
+		defer SetLogger(nil)
+
+		Convey("The messages of logrus should be sent with their fields", func() {
+			hook.Fire(&log.Entry{Level: log.WarnLevel, Message: "Policy failed", Data: log.Fields{ContextIDField: "123", PUTypeField: 1}})
+
+			So(r.messages, ShouldHaveLength, 1)
+			So(r.messages[0].level, ShouldEqual, WarnLevel)
+			So(r.messages[0].message, ShouldEqual, "Policy failed")
+			So(r.messages[0].fields, ShouldResemble, Fields{ContextIDField: "123", PUTypeField: 1})
+		})
+
+		Convey("The messages below the level of the logger should not be sent", func() {
+			hook.Fire(&log.Entry{Level: log.DebugLevel, Message: "Packet"})
+
+			So(r.messages, ShouldHaveLength, 0)
+		})
+
+		Convey("The fatal messages should be sent as errors", func() {
+			hook.Fire(&log.Entry{Level: log.FatalLevel, Message: "Exiting"})
+
+			So(r.messages, ShouldHaveLength, 1)
+			So(r.messages[0].level, ShouldEqual, ErrorLevel)
+		})
+
+		Convey("The messages should not be sent once the logger is removed", func() {
+			SetLogger(nil)
+			hook.Fire(&log.Entry{Level: log.ErrorLevel, Message: "Failed"})
+
+			So(r.messages, ShouldHaveLength, 0)
+		})
+	})
+}
+
+func TestAdapters(t *testing.T) {
+
+	Convey("Given a zap logger of the warnings", t, func() {
+
+		s := &sugared{}
+		logger := NewZapLogger(s, WarnLevel)
+
+		Convey("The levels below the warnings should not be enabled", func() {
+			So(logger.Enabled(InfoLevel), ShouldBeFalse)
+			So(logger.Enabled(WarnLevel), ShouldBeTrue)
+			So(logger.Enabled(ErrorLevel), ShouldBeTrue)
+		})
+
+		Convey("The messages should be logged with their fields sorted by key", func() {
+			logger.Log(ErrorLevel, "Failed", Fields{ContextIDField: "123", "package": "trireme"})
+
+			So(s.calls, ShouldResemble, []string{"error:Failed"})
+			So(s.kvs, ShouldResemble, []interface{}{ContextIDField, "123", "package", "trireme"})
+		})
+	})
+
+	Convey("Given a logrus logger of the info messages", t, func() {
+
+		l := log.New()
+		l.Level = log.InfoLevel
+		logger := NewLogrusLogger(l)
+
+		Convey("The debug messages should not be enabled", func() {
+			So(logger.Enabled(DebugLevel), ShouldBeFalse)
+			So(logger.Enabled(InfoLevel), ShouldBeTrue)
+			So(logger.Enabled(ErrorLevel), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,37 @@
+package marks
+
+import (
+	"fmt"
+	"net"
+)
+
+// maxLoopbackMark is the largest mark that fits in the host part of the loopback network
+const maxLoopbackMark = 1<<24 - 1
+
+// Loopback returns the address of the loopback network that carries a cgroup mark.
+// The connections of the local processes that are redirected to an enforcer are
+// sent to the address of their mark, so that the enforcer can find their PU.
+func Loopback(mark uint32) (net.IP, error) {
+
+	if mark == 0 || mark > maxLoopbackMark {
+		return nil, fmt.Errorf("Mark %d does not fit in a loopback address", mark)
+	}
+
+	return net.IPv4(127, byte(mark>>16), byte(mark>>8), byte(mark)), nil
+}
+
+// FromLoopback returns the mark carried by an address returned by Loopback
+func FromLoopback(ip net.IP) (uint32, bool) {
+
+	ip4 := ip.To4()
+	if ip4 == nil || ip4[0] != 127 {
+		return 0, false
+	}
+
+	mark := uint32(ip4[1])<<16 | uint32(ip4[2])<<8 | uint32(ip4[3])
+	if mark == 0 {
+		return 0, false
+	}
+
+	return mark, true
+}
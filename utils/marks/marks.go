@@ -0,0 +1,189 @@
+// Package marks manages the bits of the packet marks used by trireme and detects
+// the rules of other tools that use the same bits, like kube-proxy or Cilium.
+package marks
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FullMask is the mask of the whole packet mark. Trireme owns the whole mark when
+// no mask is configured.
+const FullMask = 0xffffffff
+
+// mask returns the effective mask, a zero mask being the whole mark
+func mask(m uint32) uint32 {
+
+	if m == 0 {
+		return FullMask
+	}
+
+	return m
+}
+
+// Validate returns an error if a mark has bits outside of the mask
+func Validate(m uint32, values ...uint32) error {
+
+	for _, value := range values {
+		if value&^mask(m) != 0 {
+			return fmt.Errorf("Mark 0x%x does not fit in the mark mask 0x%x", value, mask(m))
+		}
+	}
+
+	return nil
+}
+
+// Apply returns the packet mark with the bits of the mask replaced by value
+func Apply(mark, value, m uint32) uint32 {
+
+	return mark&^mask(m) | value&mask(m)
+}
+
+// Spec returns the iptables representation of a mark. The mask is omitted when
+// trireme owns the whole mark, so that the rules are the same as without a mask.
+func Spec(value, m uint32) string {
+
+	if mask(m) == FullMask {
+		return strconv.FormatUint(uint64(value), 10)
+	}
+
+	return fmt.Sprintf("0x%x/0x%x", value, m)
+}
+
+// Conflict is a rule of another tool that uses bits of the trireme marks
+type Conflict struct {
+	Table string
+	Chain string
+	Rule  string
+	// Bits are the bits of the packet mark used by the rule
+	Bits uint32
+}
+
+// String returns a diagnosis of the conflict
+func (c *Conflict) String() string {
+
+	return fmt.Sprintf("Rule '%s' of chain %s in table %s uses the mark bits 0x%x", c.Rule, c.Chain, c.Table, c.Bits)
+}
+
+// Conflicts returns the rules of an iptables-save output that use bits of the mask.
+// The rules of the chains with the given prefix belong to trireme and are ignored.
+func Conflicts(save string, m uint32, prefix string) []*Conflict {
+
+	conflicts := []*Conflict{}
+	table := ""
+
+	for _, line := range strings.Split(save, "\n") {
+
+		line = strings.TrimSpace(line)
+
+		if strings.HasPrefix(line, "*") {
+			table = line[1:]
+			continue
+		}
+
+		if !strings.HasPrefix(line, "-A ") {
+			continue
+		}
+
+		args := strings.Fields(line)
+		if len(args) < 2 || strings.HasPrefix(args[1], prefix) {
+			continue
+		}
+
+		if bits := markBits(args[2:]); bits&mask(m) != 0 {
+			conflicts = append(conflicts, &Conflict{
+				Table: table,
+				Chain: args[1],
+				Rule:  strings.Join(args[2:], " "),
+				Bits:  bits,
+			})
+		}
+	}
+
+	return conflicts
+}
+
+// markBits returns the bits of the packet mark read or written by a rule. The
+// options of the connmark match and of the CONNMARK target apply to the mark of
+// the connection, except when the mark of the connection is restored to the packet.
+func markBits(args []string) uint32 {
+
+	var bits uint32
+	extension := ""
+
+	for i := 0; i < len(args); i++ {
+
+		arg := args[i]
+		value := ""
+		if i+1 < len(args) {
+			value = args[i+1]
+		}
+
+		switch arg {
+		case "-m", "-j":
+			extension = value
+			i++
+
+		case "--mark", "--set-mark", "--set-xmark", "--on-mark":
+			if extension == "mark" || extension == "MARK" || extension == "TPROXY" {
+				bits |= maskedBits(value)
+			}
+			i++
+
+		case "--or-mark", "--xor-mark":
+			if extension == "MARK" {
+				bits |= parseMark(value)
+			}
+			i++
+
+		case "--and-mark":
+			if extension == "MARK" {
+				bits |= ^parseMark(value)
+			}
+			i++
+
+		case "--restore-mark":
+			if extension == "CONNMARK" {
+				bits |= restoreBits(args[i+1:])
+			}
+		}
+	}
+
+	return bits
+}
+
+// maskedBits returns the bits of a value[/mask] option
+func maskedBits(option string) uint32 {
+
+	parts := strings.SplitN(option, "/", 2)
+	if len(parts) == 2 {
+		return parseMark(parts[1])
+	}
+
+	return FullMask
+}
+
+// restoreBits returns the bits of the packet mark written by --restore-mark
+func restoreBits(args []string) uint32 {
+
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == "--nfmask" || args[i] == "--mask" {
+			return parseMark(args[i+1])
+		}
+	}
+
+	return FullMask
+}
+
+// parseMark parses a mark in any base. An invalid mark is considered to use all the
+// bits, so that it is reported.
+func parseMark(value string) uint32 {
+
+	mark, err := strconv.ParseUint(value, 0, 32)
+	if err != nil {
+		return FullMask
+	}
+
+	return uint32(mark)
+}
@@ -0,0 +1,96 @@
+package marks
+
+import (
+	"net"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const kubeProxyRules = `# Generated by iptables-save
+*nat
+:KUBE-MARK-MASQ - [0:0]
+-A KUBE-MARK-MASQ -j MARK --set-xmark 0x4000/0x4000
+-A KUBE-POSTROUTING -m mark --mark 0x4000/0x4000 -j MASQUERADE
+COMMIT
+*mangle
+-A PREROUTING -j CONNMARK --restore-mark --nfmask 0xff --ctmask 0xff
+-A PREROUTING -m connmark --mark 0x100/0x100 -j CONNMARK --save-mark
+-A TRIREME-App -j MARK --set-mark 100
+COMMIT
+`
+
+func TestConflicts(t *testing.T) {
+	Convey("Given the rules of kube-proxy", t, func() {
+
+		Convey("They should conflict with trireme owning the whole mark", func() {
+			conflicts := Conflicts(kubeProxyRules, 0, "TRIREME-")
+			So(len(conflicts), ShouldEqual, 3)
+			So(conflicts[0].Table, ShouldEqual, "nat")
+			So(conflicts[0].Chain, ShouldEqual, "KUBE-MARK-MASQ")
+			So(conflicts[0].Bits, ShouldEqual, 0x4000)
+			So(conflicts[2].Table, ShouldEqual, "mangle")
+			So(conflicts[2].Bits, ShouldEqual, 0xff)
+		})
+
+		Convey("They should not conflict with a mask excluding their bits", func() {
+			So(len(Conflicts(kubeProxyRules, 0xff0000, "TRIREME-")), ShouldEqual, 0)
+		})
+
+		Convey("The restore of the connection mark should conflict with its bits only", func() {
+			conflicts := Conflicts(kubeProxyRules, 0x0f, "TRIREME-")
+			So(len(conflicts), ShouldEqual, 1)
+			So(conflicts[0].Chain, ShouldEqual, "PREROUTING")
+		})
+	})
+}
+
+func TestSpec(t *testing.T) {
+	Convey("Given a mark", t, func() {
+
+		Convey("It should be decimal without a mask", func() {
+			So(Spec(0x1000, 0), ShouldEqual, "4096")
+			So(Spec(0x1000, FullMask), ShouldEqual, "4096")
+		})
+
+		Convey("It should carry the mask otherwise", func() {
+			So(Spec(0x1000, 0xf000), ShouldEqual, "0x1000/0xf000")
+		})
+
+		Convey("It should only replace the bits of the mask", func() {
+			So(Apply(0x4001, 0x1000, 0xf000), ShouldEqual, 0x1001)
+			So(Apply(0x4001, 0x1000, 0), ShouldEqual, 0x1000)
+		})
+
+		Convey("It should be validated against the mask", func() {
+			So(Validate(0xf000, 0x1000), ShouldBeNil)
+			So(Validate(0xf000, 0x1000, 0x10), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestLoopback(t *testing.T) {
+
+	Convey("Given a cgroup mark", t, func() {
+
+		Convey("Its loopback address should carry the mark", func() {
+			ip, err := Loopback(0x10203)
+			So(err, ShouldBeNil)
+			So(ip.String(), ShouldEqual, "127.1.2.3")
+
+			mark, ok := FromLoopback(ip)
+			So(ok, ShouldBeTrue)
+			So(mark, ShouldEqual, 0x10203)
+		})
+
+		Convey("A mark larger than the loopback network should be rejected", func() {
+			_, err := Loopback(1 << 24)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("An address outside of the loopback network should not carry a mark", func() {
+			_, ok := FromLoopback(net.ParseIP("10.1.2.3"))
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
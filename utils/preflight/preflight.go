@@ -0,0 +1,313 @@
+// Package preflight verifies at startup that the host provides what Trireme needs
+// to enforce the policies: the kernel modules, the iptables and ipset tools, the
+// capabilities of the process and the connection tracking settings. A host that does
+// not meet the requirements is reported with the actions that fix it, instead of
+// failing later when the first processing unit is supervised.
+package preflight
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aporeto-inc/trireme/constants"
+)
+
+// Capability is a Linux capability required by Trireme
+type Capability struct {
+	// Name is the name of the capability
+	Name string
+	// Bit is the bit of the capability in the capability sets
+	Bit uint
+}
+
+// The capabilities required by Trireme
+var (
+	// CapNetAdmin programs iptables, ipset and the NFQUEUEs
+	CapNetAdmin = Capability{Name: "CAP_NET_ADMIN", Bit: 12}
+	// CapSysAdmin enters the network namespaces of the containers and manages the
+	// net_cls cgroups of the Linux processes
+	CapSysAdmin = Capability{Name: "CAP_SYS_ADMIN", Bit: 21}
+)
+
+// Binary is a tool run by Trireme
+type Binary struct {
+	// Name is the name of the tool in the PATH
+	Name string
+	// MinVersion is the oldest version of the tool that is supported
+	MinVersion string
+}
+
+// Requirements are the requirements of the host
+type Requirements struct {
+	// Modules are the kernel modules that must be loaded or built in
+	Modules []string
+	// Binaries are the tools that must be in the PATH
+	Binaries []*Binary
+	// Capabilities are the effective capabilities the process must have
+	Capabilities []Capability
+	// Sysctls are the paths, relative to /proc/sys, of the settings that must exist
+	Sysctls []string
+	// Chains are the iptables chains of the filter table that must exist
+	Chains []string
+}
+
+// RequirementsFor returns the requirements of a supervisor of the mode and the
+// implementation
+func RequirementsFor(mode constants.ModeType, impl constants.ImplementationType) *Requirements {
+
+	r := &Requirements{
+		Modules:      []string{"nfnetlink_queue"},
+		Binaries:     []*Binary{{Name: "iptables", MinVersion: "1.4.11"}},
+		Capabilities: []Capability{CapNetAdmin},
+	}
+
+	if impl == constants.IPSets || impl == constants.IPSetsVerdictCache {
+		r.Modules = append(r.Modules, "ip_set")
+		r.Binaries = append(r.Binaries, &Binary{Name: "ipset", MinVersion: "6.0"})
+	}
+
+	if impl == constants.IPTablesDockerUser {
+		r.Chains = append(r.Chains, "DOCKER-USER")
+	}
+
+	// These modes make conntrack liberal for TCP, see NewDatapathEnforcer
+	if mode == constants.RemoteContainer || mode == constants.LocalServer {
+		r.Capabilities = append(r.Capabilities, CapSysAdmin)
+		r.Sysctls = append(r.Sysctls, "net/netfilter/nf_conntrack_tcp_be_liberal")
+	}
+
+	return r
+}
+
+// Failure is a requirement the host does not meet
+type Failure struct {
+	// Requirement describes the requirement
+	Requirement string
+	// Remedy is the action that fixes the host
+	Remedy string
+}
+
+// Error is returned when the host does not meet some requirements
+type Error struct {
+	Failures []*Failure
+}
+
+func (e *Error) Error() string {
+
+	lines := []string{"Host does not meet the requirements of Trireme:"}
+	for _, f := range e.Failures {
+		lines = append(lines, fmt.Sprintf("  - %s: %s", f.Requirement, f.Remedy))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Host inspects the host through the proc and sys file systems and the tools
+type Host struct {
+	procRoot string
+	sysRoot  string
+	lookPath func(file string) (string, error)
+	output   func(name string, args ...string) ([]byte, error)
+}
+
+// NewHost returns the host Trireme runs on
+func NewHost() *Host {
+
+	return &Host{
+		procRoot: "/proc",
+		sysRoot:  "/sys",
+		lookPath: exec.LookPath,
+		output: func(name string, args ...string) ([]byte, error) {
+			return exec.Command(name, args...).CombinedOutput()
+		},
+	}
+}
+
+// Check returns an *Error listing all the requirements the host does not meet
+func (h *Host) Check(r *Requirements) error {
+
+	failures := []*Failure{}
+
+	for _, module := range r.Modules {
+		if f := h.checkModule(module); f != nil {
+			failures = append(failures, f)
+		}
+	}
+
+	for _, binary := range r.Binaries {
+		if f := h.checkBinary(binary); f != nil {
+			failures = append(failures, f)
+		}
+	}
+
+	failures = append(failures, h.checkCapabilities(r.Capabilities)...)
+
+	for _, sysctl := range r.Sysctls {
+		if _, err := os.Stat(filepath.Join(h.procRoot, "sys", sysctl)); err != nil {
+			failures = append(failures, &Failure{
+				Requirement: "Setting " + strings.Replace(sysctl, "/", ".", -1) + " is missing",
+				Remedy:      "load the connection tracking with modprobe nf_conntrack",
+			})
+		}
+	}
+
+	for _, chain := range r.Chains {
+		if _, err := h.output("iptables", "-t", "filter", "-n", "-L", chain); err != nil {
+			failures = append(failures, &Failure{
+				Requirement: "Chain " + chain + " is missing",
+				Remedy:      "upgrade Docker to 17.06 or later, or use another implementation",
+			})
+		}
+	}
+
+	if len(failures) > 0 {
+		return &Error{Failures: failures}
+	}
+
+	return nil
+}
+
+// checkModule returns a failure if the kernel module is neither loaded nor built in
+func (h *Host) checkModule(module string) *Failure {
+
+	modules, err := ioutil.ReadFile(filepath.Join(h.procRoot, "modules"))
+	if err == nil {
+		for _, line := range strings.Split(string(modules), "\n") {
+			if strings.HasPrefix(line, module+" ") {
+				return nil
+			}
+		}
+	}
+
+	// The modules built in the kernel are not listed in /proc/modules
+	if _, err := os.Stat(filepath.Join(h.sysRoot, "module", module)); err == nil {
+		return nil
+	}
+
+	return &Failure{
+		Requirement: "Kernel module " + module + " is not loaded",
+		Remedy:      "load it with modprobe " + module,
+	}
+}
+
+// versionRegexp matches the version in the output of iptables and ipset --version
+var versionRegexp = regexp.MustCompile(`v([0-9]+(\.[0-9]+)*)`)
+
+// checkBinary returns a failure if the tool is missing or older than its minimum
+// version
+func (h *Host) checkBinary(b *Binary) *Failure {
+
+	if _, err := h.lookPath(b.Name); err != nil {
+		return &Failure{
+			Requirement: b.Name + " is not installed",
+			Remedy:      "install " + b.Name + " " + b.MinVersion + " or later and add it to the PATH",
+		}
+	}
+
+	out, err := h.output(b.Name, "--version")
+	if err != nil {
+		return &Failure{
+			Requirement: b.Name + " --version failed: " + strings.TrimSpace(string(out)),
+			Remedy:      "check that " + b.Name + " can run with the privileges of Trireme",
+		}
+	}
+
+	match := versionRegexp.FindStringSubmatch(string(out))
+	if match == nil {
+		return &Failure{
+			Requirement: "Unknown version of " + b.Name + ": " + strings.TrimSpace(string(out)),
+			Remedy:      "install " + b.Name + " " + b.MinVersion + " or later",
+		}
+	}
+
+	if compareVersions(match[1], b.MinVersion) < 0 {
+		return &Failure{
+			Requirement: b.Name + " " + match[1] + " is older than " + b.MinVersion,
+			Remedy:      "upgrade " + b.Name + " to " + b.MinVersion + " or later",
+		}
+	}
+
+	return nil
+}
+
+// checkCapabilities returns a failure for each capability missing from the
+// effective set of the process
+func (h *Host) checkCapabilities(capabilities []Capability) []*Failure {
+
+	if len(capabilities) == 0 {
+		return nil
+	}
+
+	status, err := ioutil.ReadFile(filepath.Join(h.procRoot, "self", "status"))
+	if err != nil {
+		return []*Failure{{
+			Requirement: "Cannot read the capabilities of the process: " + err.Error(),
+			Remedy:      "mount the proc file system",
+		}}
+	}
+
+	effective, err := EffectiveCapabilities(string(status))
+	if err != nil {
+		return []*Failure{{
+			Requirement: "Cannot read the capabilities of the process: " + err.Error(),
+			Remedy:      "mount the proc file system",
+		}}
+	}
+
+	failures := []*Failure{}
+	for _, c := range capabilities {
+		if effective&(1<<c.Bit) == 0 {
+			failures = append(failures, &Failure{
+				Requirement: "Process has no " + c.Name,
+				Remedy:      "run Trireme as root or grant it " + c.Name,
+			})
+		}
+	}
+
+	return failures
+}
+
+// EffectiveCapabilities returns the effective capability set of the content of a
+// /proc/<pid>/status file
+func EffectiveCapabilities(status string) (uint64, error) {
+
+	for _, line := range strings.Split(status, "\n") {
+		if !strings.HasPrefix(line, "CapEff:") {
+			continue
+		}
+
+		return strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(line, "CapEff:")), 16, 64)
+	}
+
+	return 0, fmt.Errorf("No effective capabilities in process status")
+}
+
+// compareVersions compares two dotted versions. It returns a negative number if a
+// is older than b, 0 if they are equal and a positive number otherwise.
+func compareVersions(a, b string) int {
+
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+
+		if x != y {
+			return x - y
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,116 @@
+package preflight
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aporeto-inc/trireme/constants"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeHost returns a host whose proc and sys file systems are in a temporary
+// directory and whose tools have the given versions
+func fakeHost(root string, versions map[string]string) *Host {
+
+	return &Host{
+		procRoot: filepath.Join(root, "proc"),
+		sysRoot:  filepath.Join(root, "sys"),
+		lookPath: func(file string) (string, error) {
+			if _, ok := versions[file]; !ok {
+				return "", fmt.Errorf("not found")
+			}
+			return "/sbin/" + file, nil
+		},
+		output: func(name string, args ...string) ([]byte, error) {
+			if args[0] == "--version" {
+				return []byte(versions[name]), nil
+			}
+			return nil, fmt.Errorf("No chain/target/match by that name")
+		},
+	}
+}
+
+func writeFile(root, path, content string) {
+
+	path = filepath.Join(root, path)
+	So(os.MkdirAll(filepath.Dir(path), 0755), ShouldBeNil)
+	So(ioutil.WriteFile(path, []byte(content), 0644), ShouldBeNil)
+}
+
+func TestCheck(t *testing.T) {
+	Convey("Given a host", t, func() {
+		root, err := ioutil.TempDir("", "preflight")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(root)
+
+		versions := map[string]string{
+			"iptables": "iptables v1.6.0",
+			"ipset":    "ipset v6.30, protocol version: 6",
+		}
+		h := fakeHost(root, versions)
+
+		writeFile(root, "proc/modules", "nfnetlink_queue 20480 0 - Live 0x0000000000000000\n")
+		writeFile(root, "sys/module/ip_set/refcnt", "0\n")
+		writeFile(root, "proc/self/status", "Name:\ttrireme\nCapEff:\t0000003fffffffff\n")
+		writeFile(root, "proc/sys/net/netfilter/nf_conntrack_tcp_be_liberal", "0\n")
+
+		Convey("When it meets the requirements, the check should succeed", func() {
+			So(h.Check(RequirementsFor(constants.LocalServer, constants.IPSets)), ShouldBeNil)
+		})
+
+		Convey("When a module is missing, the check should say how to load it", func() {
+			writeFile(root, "proc/modules", "\n")
+
+			err := h.Check(RequirementsFor(constants.LocalContainer, constants.IPTables))
+			So(err, ShouldNotBeNil)
+			So(err.(*Error).Failures, ShouldResemble, []*Failure{{
+				Requirement: "Kernel module nfnetlink_queue is not loaded",
+				Remedy:      "load it with modprobe nfnetlink_queue",
+			}})
+		})
+
+		Convey("When a tool is missing or too old, the check should fail", func() {
+			delete(versions, "ipset")
+			versions["iptables"] = "iptables v1.4.7"
+
+			err := h.Check(RequirementsFor(constants.LocalContainer, constants.IPSets))
+			So(err, ShouldNotBeNil)
+			So(len(err.(*Error).Failures), ShouldEqual, 2)
+			So(err.Error(), ShouldContainSubstring, "iptables 1.4.7 is older than 1.4.11")
+			So(err.Error(), ShouldContainSubstring, "ipset is not installed")
+		})
+
+		Convey("When the process lacks a capability, the check should fail", func() {
+			writeFile(root, "proc/self/status", "CapEff:\t0000000000001000\n")
+
+			So(h.Check(RequirementsFor(constants.LocalContainer, constants.IPTables)), ShouldBeNil)
+
+			err := h.Check(RequirementsFor(constants.RemoteContainer, constants.IPTables))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "Process has no CAP_SYS_ADMIN")
+		})
+
+		Convey("When conntrack or the DOCKER-USER chain are missing, the check should fail", func() {
+			So(os.Remove(filepath.Join(root, "proc/sys/net/netfilter/nf_conntrack_tcp_be_liberal")), ShouldBeNil)
+
+			err := h.Check(RequirementsFor(constants.LocalServer, constants.IPTables))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "net.netfilter.nf_conntrack_tcp_be_liberal is missing")
+
+			err = h.Check(RequirementsFor(constants.LocalContainer, constants.IPTablesDockerUser))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "Chain DOCKER-USER is missing")
+		})
+	})
+}
+
+func TestCompareVersions(t *testing.T) {
+	Convey("Versions should be compared by their numbers", t, func() {
+		So(compareVersions("1.4.21", "1.4.11"), ShouldBeGreaterThan, 0)
+		So(compareVersions("1.4", "1.4.0"), ShouldEqual, 0)
+		So(compareVersions("6.9", "6.30"), ShouldBeLessThan, 0)
+	})
+}
@@ -0,0 +1,35 @@
+// +build linux
+
+package selfprotect
+
+import (
+	"net"
+	"syscall"
+)
+
+// peerPid returns the pid of the process at the other end of the connection. The
+// credentials are read on the descriptor of the connection rather than on a copy
+// from File, which would switch the connection to blocking mode and prevent its
+// reads from being interrupted by Close.
+func peerPid(conn *net.UnixConn) (int, error) {
+
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	var cred *syscall.Ucred
+	var credErr error
+
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil {
+		return 0, err
+	}
+
+	if credErr != nil {
+		return 0, credErr
+	}
+
+	return int(cred.Pid), nil
+}
@@ -0,0 +1,87 @@
+// Package selfprotect protects the control sockets of trireme from the processing
+// units it enforces.
+package selfprotect
+
+import (
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aporeto-inc/trireme/monitor/linuxmonitor/cgnetcls"
+)
+
+// workloadListener closes the accepted connections of the workloads
+type workloadListener struct {
+	net.Listener
+}
+
+// NewWorkloadFilter returns a listener that only accepts the unix connections of
+// processes that are not processing units. A workload must not be able to drive the
+// monitor or the enforcers, for instance to unregister itself.
+func NewWorkloadFilter(listener net.Listener) net.Listener {
+
+	return &workloadListener{Listener: listener}
+}
+
+// Accept is part of the net.Listener interface
+func (l *workloadListener) Accept() (net.Conn, error) {
+
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		unixConn, ok := conn.(*net.UnixConn)
+		if !ok {
+			return conn, nil
+		}
+
+		pid, err := peerPid(unixConn)
+		if err == nil && !IsWorkload(pid) {
+			return conn, nil
+		}
+
+		log.WithFields(log.Fields{
+			"package": "selfprotect",
+			"pid":     pid,
+			"error":   err,
+		}).Warn("Rejected connection to a control socket")
+
+		conn.Close()
+	}
+}
+
+// IsWorkload returns true if the process belongs to a processing unit
+func IsWorkload(pid int) bool {
+
+	data, err := ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/cgroup")
+	if err != nil {
+		return false
+	}
+
+	return workloadCgroup(string(data))
+}
+
+// workloadCgroup returns true if the net_cls cgroup of a /proc/<pid>/cgroup file is
+// a cgroup of trireme
+func workloadCgroup(data string) bool {
+
+	for _, line := range strings.Split(data, "\n") {
+
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+
+		for _, controller := range strings.Split(fields[1], ",") {
+			if controller == "net_cls" {
+				return strings.HasPrefix(fields[2], cgnetcls.TriremeBasePath+"/")
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,62 @@
+package selfprotect
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWorkloadCgroup(t *testing.T) {
+
+	Convey("Given the cgroups of a process", t, func() {
+
+		Convey("A process in a trireme net_cls cgroup should be a workload", func() {
+			So(workloadCgroup("11:net_cls,net_prio:/trireme/1234\n4:memory:/user.slice\n"), ShouldBeTrue)
+			So(workloadCgroup("3:net_cls:/trireme/nginx\n"), ShouldBeTrue)
+		})
+
+		Convey("A process in another net_cls cgroup should not be a workload", func() {
+			So(workloadCgroup("11:net_cls,net_prio:/\n4:memory:/trireme/1234\n"), ShouldBeFalse)
+			So(workloadCgroup("11:net_cls,net_prio:/triremeagent\n"), ShouldBeFalse)
+			So(workloadCgroup("0::/trireme/1234\n"), ShouldBeFalse)
+		})
+	})
+}
+
+func TestWorkloadFilter(t *testing.T) {
+
+	Convey("Given a control socket protected from the workloads", t, func() {
+
+		dir, err := ioutil.TempDir("", "selfprotect")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		listener, err := net.Listen("unix", filepath.Join(dir, "control.sock"))
+		So(err, ShouldBeNil)
+		defer listener.Close()
+
+		protected := NewWorkloadFilter(listener)
+
+		Convey("The agent should not be locked out of its own socket", func() {
+
+			accepted := make(chan error, 1)
+			go func() {
+				conn, err := protected.Accept()
+				if err == nil {
+					conn.Close()
+				}
+				accepted <- err
+			}()
+
+			conn, err := net.Dial("unix", filepath.Join(dir, "control.sock"))
+			So(err, ShouldBeNil)
+			defer conn.Close()
+
+			So(<-accepted, ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,164 @@
+// Package sockets creates the unix sockets of trireme with the permissions and the
+// ownership configured for the host.
+package sockets
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	// DefaultMode is the mode of the sockets: only the owner connects
+	DefaultMode os.FileMode = 0700
+	// DefaultDirMode is the mode of the directories created for the sockets
+	DefaultDirMode os.FileMode = 0700
+)
+
+// Options are the permissions and the ownership of the unix sockets and of the
+// directories created for them
+type Options struct {
+	// Mode is the mode of the sockets
+	Mode os.FileMode
+	// DirMode is the mode of the directories created for the sockets. The existing
+	// directories are not modified.
+	DirMode os.FileMode
+	// UID owns the sockets and the directories created, -1 for the user of the process
+	UID int
+	// GID owns the sockets and the directories created, -1 for the group of the process
+	GID int
+}
+
+// DefaultOptions returns the options of the sockets accessible only to the user of
+// the process
+func DefaultOptions() *Options {
+
+	return &Options{
+		Mode:    DefaultMode,
+		DirMode: DefaultDirMode,
+		UID:     -1,
+		GID:     -1,
+	}
+}
+
+var (
+	defaults     = DefaultOptions()
+	defaultsLock sync.RWMutex
+)
+
+// SetDefaultOptions sets the options of the sockets created without options. A nil
+// options restores the default.
+func SetDefaultOptions(options *Options) {
+
+	if options == nil {
+		options = DefaultOptions()
+	}
+
+	defaultsLock.Lock()
+	defaults = options
+	defaultsLock.Unlock()
+}
+
+// GetDefaultOptions returns the options of the sockets created without options
+func GetDefaultOptions() *Options {
+
+	defaultsLock.RLock()
+	defer defaultsLock.RUnlock()
+
+	options := *defaults
+	return &options
+}
+
+// Listen listens on the unix socket of the path with the default options
+func Listen(path string) (net.Listener, error) {
+
+	return ListenWithOptions(path, nil)
+}
+
+// ListenWithOptions listens on the unix socket of the path. The directory of the
+// socket is created if it does not exist and a stale socket, on which nothing
+// listens, is removed. The mode and the ownership of the options are applied
+// before the listener is returned.
+func ListenWithOptions(path string, options *Options) (net.Listener, error) {
+
+	if path == "" {
+		return nil, fmt.Errorf("Socket path is empty")
+	}
+
+	if options == nil {
+		options = GetDefaultOptions()
+	}
+
+	if err := MkdirAll(filepath.Dir(path), options); err != nil {
+		return nil, err
+	}
+
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("Cannot create socket %s: file exists and is not a socket", path)
+		}
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("Cannot create socket %s: address already in use", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("Cannot remove stale socket %s: %s", path, err)
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := apply(path, options.Mode, options); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	return listener, nil
+}
+
+// MkdirAll creates the directory and its parents with the mode and the ownership
+// of the options
+func MkdirAll(dir string, options *Options) error {
+
+	if options == nil {
+		options = GetDefaultOptions()
+	}
+
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+
+	if err := MkdirAll(filepath.Dir(dir), options); err != nil {
+		return err
+	}
+
+	if err := os.Mkdir(dir, options.DirMode); err != nil && !os.IsExist(err) {
+		return fmt.Errorf("Cannot create socket directory %s: %s", dir, err)
+	}
+
+	return apply(dir, options.DirMode, options)
+}
+
+// apply sets the mode and the ownership of a file. The mode is set explicitly so
+// that the umask does not apply.
+func apply(path string, mode os.FileMode, options *Options) error {
+
+	if err := os.Chmod(path, mode); err != nil {
+		return fmt.Errorf("Cannot set the mode of %s: %s", path, err)
+	}
+
+	if options.UID == -1 && options.GID == -1 {
+		return nil
+	}
+
+	if err := os.Chown(path, options.UID, options.GID); err != nil {
+		return fmt.Errorf("Cannot set the owner of %s: %s", path, err)
+	}
+
+	return nil
+}
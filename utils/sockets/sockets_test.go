@@ -0,0 +1,108 @@
+package sockets
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestListen(t *testing.T) {
+	Convey("Given a directory for the sockets", t, func() {
+		dir, err := ioutil.TempDir("", "sockets")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		Convey("When I listen on a socket of a missing directory", func() {
+			path := filepath.Join(dir, "run", "trireme", "test.sock")
+			listener, err := Listen(path)
+			So(err, ShouldBeNil)
+			defer listener.Close()
+
+			Convey("Then the socket and the directories should only be accessible to the owner", func() {
+				info, err := os.Stat(path)
+				So(err, ShouldBeNil)
+				So(info.Mode()&os.ModeSocket, ShouldNotEqual, 0)
+				So(info.Mode().Perm(), ShouldEqual, DefaultMode)
+
+				info, err = os.Stat(filepath.Dir(path))
+				So(err, ShouldBeNil)
+				So(info.Mode().Perm(), ShouldEqual, DefaultDirMode)
+			})
+		})
+
+		Convey("When I listen on a socket with options", func() {
+			path := filepath.Join(dir, "test.sock")
+			listener, err := ListenWithOptions(path, &Options{Mode: 0760, DirMode: 0750, UID: -1, GID: os.Getgid()})
+			So(err, ShouldBeNil)
+			defer listener.Close()
+
+			Convey("Then the socket should have the mode of the options", func() {
+				info, err := os.Stat(path)
+				So(err, ShouldBeNil)
+				So(info.Mode().Perm(), ShouldEqual, os.FileMode(0760))
+			})
+		})
+
+		Convey("When I listen on a stale socket", func() {
+			path := filepath.Join(dir, "test.sock")
+			stale, err := Listen(path)
+			So(err, ShouldBeNil)
+			stale.(*net.UnixListener).SetUnlinkOnClose(false)
+			stale.Close()
+
+			Convey("Then the socket should be replaced", func() {
+				listener, err := Listen(path)
+				So(err, ShouldBeNil)
+				listener.Close()
+			})
+		})
+
+		Convey("When I listen on a socket in use", func() {
+			path := filepath.Join(dir, "busy.sock")
+			busy, err := Listen(path)
+			So(err, ShouldBeNil)
+			defer busy.Close()
+
+			Convey("Then I should get an error and the socket should be kept", func() {
+				_, err := Listen(path)
+				So(err, ShouldNotBeNil)
+
+				conn, err := net.Dial("unix", path)
+				So(err, ShouldBeNil)
+				conn.Close()
+			})
+		})
+
+		Convey("When I listen on a path that is not a socket", func() {
+			path := filepath.Join(dir, "file")
+			So(ioutil.WriteFile(path, []byte("data"), 0600), ShouldBeNil)
+
+			Convey("Then I should get an error and the file should be kept", func() {
+				_, err := Listen(path)
+				So(err, ShouldNotBeNil)
+
+				data, _ := ioutil.ReadFile(path)
+				So(string(data), ShouldEqual, "data")
+			})
+		})
+
+		Convey("When I change the default options", func() {
+			SetDefaultOptions(&Options{Mode: 0770, DirMode: 0770, UID: -1, GID: -1})
+			defer SetDefaultOptions(nil)
+
+			Convey("Then the sockets should have the new default mode", func() {
+				path := filepath.Join(dir, "test.sock")
+				listener, err := Listen(path)
+				So(err, ShouldBeNil)
+				defer listener.Close()
+
+				info, _ := os.Stat(path)
+				So(info.Mode().Perm(), ShouldEqual, os.FileMode(0770))
+			})
+		})
+	})
+}
@@ -0,0 +1,98 @@
+// +build otel
+
+// Package otel adapts the tracers and the propagators of OpenTelemetry to Trireme.
+// It is only built with the otel build tag, so that Trireme does not depend on
+// OpenTelemetry otherwise:
+//
+//	tracing.SetTracer(otel.NewTracer(otelapi.Tracer("trireme")))
+//	tracing.SetPropagator(otel.NewPropagator(otelapi.GetTextMapPropagator()))
+package otel
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aporeto-inc/trireme/utils/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer starts the spans with an OpenTelemetry tracer
+type tracer struct {
+	tracer trace.Tracer
+}
+
+// NewTracer returns a tracing.Tracer starting the spans with an OpenTelemetry tracer
+func NewTracer(t trace.Tracer) tracing.Tracer {
+
+	return &tracer{tracer: t}
+}
+
+// Start implements the tracing.Tracer interface
+func (t *tracer) Start(ctx context.Context, name string) (context.Context, tracing.Span) {
+
+	ctx, s := t.tracer.Start(ctx, name)
+
+	return ctx, &span{span: s}
+}
+
+// span is an OpenTelemetry span
+type span struct {
+	span trace.Span
+}
+
+// SetAttribute implements the tracing.Span interface
+func (s *span) SetAttribute(key string, value interface{}) {
+
+	switch v := value.(type) {
+	case string:
+		s.span.SetAttributes(attribute.String(key, v))
+	case int:
+		s.span.SetAttributes(attribute.Int(key, v))
+	case int64:
+		s.span.SetAttributes(attribute.Int64(key, v))
+	case bool:
+		s.span.SetAttributes(attribute.Bool(key, v))
+	default:
+		s.span.SetAttributes(attribute.String(key, fmt.Sprintf("%v", v)))
+	}
+}
+
+// RecordError implements the tracing.Span interface
+func (s *span) RecordError(err error) {
+
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+// End implements the tracing.Span interface
+func (s *span) End() {
+
+	s.span.End()
+}
+
+// propagator carries the spans with an OpenTelemetry propagator
+type propagator struct {
+	propagator propagation.TextMapPropagator
+}
+
+// NewPropagator returns a tracing.Propagator carrying the spans with an
+// OpenTelemetry propagator, like the one of the W3C trace context
+func NewPropagator(p propagation.TextMapPropagator) tracing.Propagator {
+
+	return &propagator{propagator: p}
+}
+
+// Inject implements the tracing.Propagator interface
+func (p *propagator) Inject(ctx context.Context, metadata map[string]string) {
+
+	p.propagator.Inject(ctx, propagation.MapCarrier(metadata))
+}
+
+// Extract implements the tracing.Propagator interface
+func (p *propagator) Extract(ctx context.Context, metadata map[string]string) context.Context {
+
+	return p.propagator.Extract(ctx, propagation.MapCarrier(metadata))
+}
@@ -0,0 +1,197 @@
+// Package tracing lets the programs embedding Trireme trace the policies applied to
+// the PUs, from the events of the monitors to the remote enforcers. Trireme starts
+// the spans with the Tracer set and carries their context in the metadata of the
+// remote calls with the Propagator set. Nothing is traced until a Tracer is set. The
+// otel package adapts the tracers and the propagators of OpenTelemetry.
+package tracing
+
+import (
+	"context"
+	"sync"
+)
+
+// The attributes of the spans
+const (
+	// ContextIDAttribute is the attribute of the context of the PU
+	ContextIDAttribute = "trireme.context_id"
+	// MethodAttribute is the attribute of the method of a remote call
+	MethodAttribute = "rpc.method"
+	// EventAttribute is the attribute of the event of a PU
+	EventAttribute = "trireme.event"
+)
+
+// Span is an operation of a trace
+type Span interface {
+
+	// SetAttribute sets an attribute of the span
+	SetAttribute(key string, value interface{})
+
+	// RecordError records the error of the operation
+	RecordError(err error)
+
+	// End ends the span
+	End()
+}
+
+// Tracer starts the spans
+type Tracer interface {
+
+	// Start starts a span child of the span of the context, and returns the
+	// context of the new span
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Propagator carries the span of a context across the processes in the metadata of
+// the messages, like the traceparent of the W3C trace context
+type Propagator interface {
+
+	// Inject sets the span of the context in the metadata
+	Inject(ctx context.Context, metadata map[string]string)
+
+	// Extract returns the context of the span of the metadata
+	Extract(ctx context.Context, metadata map[string]string) context.Context
+}
+
+// noop neither traces nor propagates
+type noop struct{}
+
+func (noop) Start(ctx context.Context, name string) (context.Context, Span) { return ctx, noop{} }
+func (noop) SetAttribute(key string, value interface{})                     {}
+func (noop) RecordError(err error)                                          {}
+func (noop) End()                                                           {}
+func (noop) Inject(ctx context.Context, metadata map[string]string)         {}
+func (noop) Extract(ctx context.Context, metadata map[string]string) context.Context {
+	return ctx
+}
+
+// registry holds the tracer, the propagator and the contexts of the operations in
+// progress on the PUs
+type registry struct {
+	tracer     Tracer
+	propagator Propagator
+	bound      map[string]context.Context
+	sync.RWMutex
+}
+
+var global = &registry{
+	tracer:     noop{},
+	propagator: noop{},
+	bound:      map[string]context.Context{},
+}
+
+// SetTracer sets the tracer of the spans, or disables the tracing if it is nil
+func SetTracer(tracer Tracer) {
+
+	global.Lock()
+	defer global.Unlock()
+
+	if tracer == nil {
+		tracer = noop{}
+	}
+
+	global.tracer = tracer
+}
+
+// SetPropagator sets the propagator of the spans across the processes, or disables
+// the propagation if it is nil
+func SetPropagator(propagator Propagator) {
+
+	global.Lock()
+	defer global.Unlock()
+
+	if propagator == nil {
+		propagator = noop{}
+	}
+
+	global.propagator = propagator
+}
+
+// Start starts a span with the tracer set
+func Start(ctx context.Context, name string) (context.Context, Span) {
+
+	global.RLock()
+	tracer := global.tracer
+	global.RUnlock()
+
+	return tracer.Start(ctx, name)
+}
+
+// Inject returns the metadata carrying the span of the context, or nil if there is
+// nothing to carry
+func Inject(ctx context.Context) map[string]string {
+
+	global.RLock()
+	propagator := global.propagator
+	global.RUnlock()
+
+	metadata := map[string]string{}
+	propagator.Inject(ctx, metadata)
+
+	if len(metadata) == 0 {
+		return nil
+	}
+
+	return metadata
+}
+
+// Extract returns the context of the span carried by the metadata
+func Extract(ctx context.Context, metadata map[string]string) context.Context {
+
+	global.RLock()
+	propagator := global.propagator
+	global.RUnlock()
+
+	if len(metadata) == 0 {
+		return ctx
+	}
+
+	return propagator.Extract(ctx, metadata)
+}
+
+// Bind makes the context the context of the operations on a PU until the returned
+// function is called. The calls made for the PU without a context, like the remote
+// calls of the enforcer proxy, are traced as children of its span.
+func Bind(contextID string, ctx context.Context) func() {
+
+	global.Lock()
+	defer global.Unlock()
+
+	previous, ok := global.bound[contextID]
+	global.bound[contextID] = ctx
+
+	return func() {
+
+		global.Lock()
+		defer global.Unlock()
+
+		if ok {
+			global.bound[contextID] = previous
+			return
+		}
+
+		delete(global.bound, contextID)
+	}
+}
+
+// ContextOf returns the context bound to a PU, or the background context
+func ContextOf(contextID string) context.Context {
+
+	global.RLock()
+	defer global.RUnlock()
+
+	if ctx, ok := global.bound[contextID]; ok {
+		return ctx
+	}
+
+	return context.Background()
+}
+
+// End records the error of the operation of a span, if any, and ends the span
+func End(span Span, err error) {
+
+	if err != nil {
+		span.RecordError(err)
+	}
+
+	span.End()
+}
@@ -0,0 +1,115 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type spanKey struct{}
+
+// span is a span recorded by a recorder
+type span struct {
+	name       string
+	parent     *span
+	attributes map[string]interface{}
+	err        error
+	ended      bool
+}
+
+func (s *span) SetAttribute(key string, value interface{}) { s.attributes[key] = value }
+func (s *span) RecordError(err error)                      { s.err = err }
+func (s *span) End()                                       { s.ended = true }
+
+// recorder is a Tracer recording its spans and a Propagator carrying their names
+type recorder struct {
+	spans []*span
+}
+
+func (r *recorder) Start(ctx context.Context, name string) (context.Context, Span) {
+
+	parent, _ := ctx.Value(spanKey{}).(*span)
+	s := &span{name: name, parent: parent, attributes: map[string]interface{}{}}
+	r.spans = append(r.spans, s)
+
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func (r *recorder) Inject(ctx context.Context, metadata map[string]string) {
+
+	if s, ok := ctx.Value(spanKey{}).(*span); ok {
+		metadata["span"] = s.name
+	}
+}
+
+func (r *recorder) Extract(ctx context.Context, metadata map[string]string) context.Context {
+
+	return context.WithValue(ctx, spanKey{}, &span{name: metadata["span"]})
+}
+
+func TestTracing(t *testing.T) {
+
+	Convey("Given no tracer", t, func() {
+
+		Convey("The spans should do nothing and carry nothing", func() {
+			ctx, s := Start(context.Background(), "operation")
+			End(s, errors.New("failed"))
+
+			So(ctx, ShouldEqual, context.Background())
+			So(Inject(ctx), ShouldBeNil)
+		})
+	})
+
+	Convey("Given a tracer and a propagator", t, func() {
+
+		r := &recorder{}
+		SetTracer(r)
+		SetPropagator(r)
+		defer SetTracer(nil)
+		defer SetPropagator(nil)
+
+		Convey("The spans should be children of the span of their context", func() {
+			ctx, parent := Start(context.Background(), "parent")
+			_, child := Start(ctx, "child")
+			End(child, errors.New("failed"))
+
+			So(r.spans, ShouldHaveLength, 2)
+			So(r.spans[1].parent, ShouldEqual, parent)
+			So(r.spans[1].err, ShouldNotBeNil)
+			So(r.spans[1].ended, ShouldBeTrue)
+		})
+
+		Convey("The spans should be carried by the metadata", func() {
+			ctx, _ := Start(context.Background(), "client")
+			metadata := Inject(ctx)
+			So(metadata, ShouldResemble, map[string]string{"span": "client"})
+
+			_, server := Start(Extract(context.Background(), metadata), "server")
+			So(server.(*span).parent.name, ShouldEqual, "client")
+		})
+
+		Convey("The calls without metadata should not be extracted", func() {
+			So(Extract(context.Background(), nil), ShouldEqual, context.Background())
+		})
+
+		Convey("The operations on a PU should be children of the context bound to it", func() {
+			ctx, event := Start(context.Background(), "event")
+			unbind := Bind("123", ctx)
+
+			rctx, request := Start(ContextOf("123"), "request")
+			unbindRequest := Bind("123", rctx)
+
+			_, call := Start(ContextOf("123"), "call")
+			So(call.(*span).parent, ShouldEqual, request)
+			So(request.(*span).parent, ShouldEqual, event)
+
+			unbindRequest()
+			So(ContextOf("123"), ShouldEqual, ctx)
+
+			unbind()
+			So(ContextOf("123"), ShouldEqual, context.Background())
+		})
+	})
+}